@@ -0,0 +1,104 @@
+// SHSH - Terminal Broker
+//
+// The broker runs next to a Docker host and attaches terminal exec sessions on
+// behalf of the API tier (see internal/broker), so the API/SSE tier can scale
+// independently of the hosts running learner containers.
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/broker"
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/joho/godotenv"
+	"google.golang.org/grpc"
+)
+
+func main() {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+	slog.SetDefault(logger)
+
+	if err := godotenv.Load(); err != nil {
+		slog.Info("No .env file found, using environment variables")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	mgr, err := container.NewDockerManagerWithConfig(cfg)
+	if err != nil {
+		slog.Error("Failed to initialize container manager", "error", err)
+		os.Exit(1)
+	}
+
+	tlsConfig := broker.TLSConfig{CertFile: cfg.Broker.TLSCert, KeyFile: cfg.Broker.TLSKey, CAFile: cfg.Broker.TLSCA}
+	if err := broker.CheckListen(cfg.Broker.ListenAddr, cfg.Broker.Token, tlsConfig); err != nil {
+		slog.Error("Refusing to start broker", "addr", cfg.Broker.ListenAddr, "error", err)
+		os.Exit(1)
+	}
+	if cfg.Broker.Token == "" && cfg.Broker.TLSCA == "" {
+		slog.Warn("SHSH_BROKER_TOKEN is empty; broker accepts unauthenticated calls on loopback")
+	}
+	backend, ok := mgr.(broker.ExecBackend)
+	if !ok {
+		slog.Error("Container manager cannot check which containers it manages")
+		os.Exit(1)
+	}
+	srv := broker.NewServer(backend, cfg.Broker.Token)
+	serverOpts := srv.ServerOptions()
+	if tlsConfig.Enabled() {
+		creds, err := tlsConfig.ServerCredentials()
+		if err != nil {
+			slog.Error("Failed to load broker TLS settings", "error", err)
+			os.Exit(1)
+		}
+		serverOpts = append(serverOpts, grpc.Creds(creds))
+	}
+	gs := grpc.NewServer(serverOpts...)
+	srv.Register(gs)
+
+	lis, err := (&net.ListenConfig{}).Listen(context.Background(), "tcp", cfg.Broker.ListenAddr)
+	if err != nil {
+		slog.Error("Failed to listen", "addr", cfg.Broker.ListenAddr, "error", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		slog.Info("Terminal broker listening", "addr", cfg.Broker.ListenAddr, "instance_id", cfg.InstanceID)
+		if err := gs.Serve(lis); err != nil {
+			slog.Error("Broker failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	<-ctx.Done()
+	slog.Info("Shutting down broker...")
+
+	// Attached terminals never finish on their own; cut them off after a grace period.
+	stopped := make(chan struct{})
+	go func() {
+		gs.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		gs.Stop()
+	}
+	slog.Info("Broker stopped successfully")
+}
@@ -0,0 +1,33 @@
+// SHSH - Event spec generator
+//
+// Writes the AsyncAPI document for the SSE payloads defined in internal/events.
+// Run via `go generate ./internal/events` or `make events-spec`.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ashureev/shsh-labs/internal/events"
+)
+
+func main() {
+	out := flag.String("o", "", "output file (default: stdout)")
+	flag.Parse()
+
+	spec, err := events.AsyncAPI()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *out == "" {
+		_, _ = os.Stdout.Write(spec)
+		return
+	}
+	if err := os.WriteFile(*out, spec, 0o600); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,80 @@
+// SHSH - Package Proxy
+//
+// The package proxy runs in a container on the playground network (see
+// internal/pkgproxy), caching the apt and pip packages learners install and
+// refusing those the operator's policy does not allow.
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/pkgproxy"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+	slog.SetDefault(logger)
+
+	if err := godotenv.Load(); err != nil {
+		slog.Info("No .env file found, using environment variables")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	proxy, err := pkgproxy.New(pkgproxy.Options{
+		Policy:        pkgproxy.Policy{Allow: cfg.PackageProxy.Allow, Deny: cfg.PackageProxy.Deny},
+		CacheDir:      cfg.PackageProxy.CacheDir,
+		MaxCacheBytes: cfg.PackageProxy.MaxCacheBytes,
+		AptHosts:      cfg.PackageProxy.AptHosts,
+		PyPIIndex:     cfg.PackageProxy.PyPIIndex,
+		PyPIFiles:     cfg.PackageProxy.PyPIFiles,
+	})
+	if err != nil {
+		slog.Error("Failed to initialize package proxy", "error", err)
+		os.Exit(1)
+	}
+
+	srv := &http.Server{
+		Addr:              cfg.PackageProxy.ListenAddr,
+		Handler:           proxy,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		slog.Info("Package proxy listening", "addr", cfg.PackageProxy.ListenAddr,
+			"allow", len(cfg.PackageProxy.Allow), "deny", len(cfg.PackageProxy.Deny))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Package proxy failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	<-ctx.Done()
+	slog.Info("Shutting down package proxy...")
+
+	// Large package downloads may still be running; cut them off after a grace period.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Package proxy shutdown failed", "error", err)
+	}
+	slog.Info("Package proxy stopped successfully")
+}
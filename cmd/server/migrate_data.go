@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/store"
+)
+
+// cutoverChecklist is printed after a successful copy.
+const cutoverChecklist = `Cutover checklist:
+  1. Stop every server instance, so SQLite no longer changes.
+  2. Back up %[1]s.
+  3. Run migrate-data -replace again to copy what changed since the last run.
+  4. Set DB_DRIVER=postgres and DATABASE_URL on every instance, and remove
+     DB_ENCRYPTION_KEY; agent sessions were decrypted while copying.
+  5. Start the servers and check that learners, their sessions and progress
+     are there.
+  6. Keep the SQLite file until you no longer need to roll back; to roll
+     back, stop the servers and set DB_DRIVER=sqlite again.
+`
+
+// runMigrateData implements the migrate-data subcommand, which copies the
+// SQLite database to PostgreSQL, and returns the exit code.
+func runMigrateData(args []string) int {
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		return 1
+	}
+
+	flags := flag.NewFlagSet("migrate-data", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	// Secrets from the environment are applied after parsing, so usage
+	// does not print them.
+	sqlitePath := flags.String("sqlite", cfg.DBPath, "SQLite database to copy")
+	postgresURL := flags.String("postgres", "", "PostgreSQL connection URL to copy to (default: DATABASE_URL)")
+	var opts store.DataMigrationOptions
+	flags.StringVar(&opts.EncryptionKey, "encryption-key", "", "key agent sessions were encrypted with (default: DB_ENCRYPTION_KEY)")
+	flags.BoolVar(&opts.Replace, "replace", false, "replace rows already in PostgreSQL instead of refusing to copy")
+	flags.BoolVar(&opts.VerifyOnly, "verify-only", false, "only compare the databases")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: server migrate-data [flags]")
+		fmt.Fprintln(flags.Output(), "Copies users, agent sessions, command history and challenge progress from SQLite to PostgreSQL.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if *postgresURL == "" {
+		*postgresURL = cfg.Database.URL
+	}
+	if opts.EncryptionKey == "" {
+		opts.EncryptionKey = cfg.Database.EncryptionKey
+	}
+	if *postgresURL == "" {
+		fmt.Fprintln(os.Stderr, "migrate-data: -postgres or DATABASE_URL is required")
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	report, err := store.MigrateData(ctx, *sqlitePath, *postgresURL, opts)
+	if report != nil {
+		printDataMigration(os.Stdout, report)
+	}
+	if err != nil {
+		slog.Error("Data migration failed", "error", err)
+		return 1
+	}
+	if report.Copied {
+		fmt.Fprintf(os.Stdout, "\n"+cutoverChecklist, *sqlitePath)
+	}
+	return 0
+}
+
+// printDataMigration writes the per-table verification of report.
+func printDataMigration(w io.Writer, report *store.DataMigrationReport) {
+	fmt.Fprintf(w, "Schema version %d\n\n", report.SchemaVersion)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TABLE\tSQLITE ROWS\tPOSTGRES ROWS\tSQLITE CHECKSUM\tPOSTGRES CHECKSUM\tRESULT")
+	for _, table := range report.Tables {
+		result := "ok"
+		if !table.Verified() {
+			result = "MISMATCH"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\n", table.Table, table.SourceRows, table.TargetRows,
+			table.SourceChecksum, table.TargetChecksum, result)
+	}
+	_ = tw.Flush()
+}
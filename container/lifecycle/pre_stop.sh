@@ -0,0 +1,27 @@
+#!/bin/bash
+# SHSH Pre-Stop Hook
+# Runs before the server stops this container (TTL expiry, destroy, recycle).
+# The server installs the pre-stop.sh of the learner's challenge into
+# /etc/shsh/pre-stop.d (e.g. to flush a database); hooks run in name order.
+# A failing script is reported but does not block the others.
+# Hooks run as root, so scripts not owned by root or writable by anyone else
+# are skipped.
+
+SHSH_PRE_STOP_DIR="${SHSH_PRE_STOP_DIR:-/etc/shsh/pre-stop.d}"
+
+status=0
+for hook in "$SHSH_PRE_STOP_DIR"/*; do
+    [[ -f "$hook" && -x "$hook" ]] || continue
+    if [[ ! -O "$hook" || -n "$(find "$hook" -maxdepth 0 -perm /022)" ]]; then
+        echo "Skipping pre-stop hook not owned and only writable by root: $hook" >&2
+        status=1
+        continue
+    fi
+    echo "Running pre-stop hook: $hook"
+    if ! "$hook"; then
+        echo "Pre-stop hook failed: $hook" >&2
+        status=1
+    fi
+done
+
+exit $status
@@ -0,0 +1,119 @@
+// Package affinity records which server instance holds a user's terminal
+// exec stream, so a front proxy in a load-balanced deployment can route the
+// user's WebSocket and SSE connections to the same instance.
+package affinity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/redis"
+)
+
+// keyPrefix namespaces route keys in Redis; the full key is keyPrefix+userID.
+const keyPrefix = "shsh:route:"
+
+// routeTimeout bounds a route command when ctx has no deadline; lookups sit
+// on the path of every WebSocket and SSE connection.
+const routeTimeout = 2 * time.Second
+
+// maxIdleConns is how many Redis connections a registry keeps open. Route
+// updates are infrequent (once per provision), so few are needed.
+const maxIdleConns = 2
+
+// Route identifies the instance that should serve a user's connections.
+type Route struct {
+	InstanceID string `json:"instance_id"`
+	Address    string `json:"address,omitempty"`
+}
+
+// Registry publishes and resolves user routes.
+type Registry interface {
+	// Record publishes the route for a user, replacing any previous one.
+	Record(ctx context.Context, userID string, route Route) error
+
+	// Lookup returns the route for a user and whether one was found.
+	Lookup(ctx context.Context, userID string) (Route, bool, error)
+
+	// Forget removes the route for a user.
+	Forget(ctx context.Context, userID string) error
+}
+
+// RedisRegistry stores routes as JSON values under shsh:route:<user_id>, where
+// proxies can read them directly.
+type RedisRegistry struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisRegistry creates a registry backed by the Redis server at addr
+// (host:port or redis://[:password@]host:port[/db]). Keys expire after ttl;
+// zero keeps them until forgotten.
+func NewRedisRegistry(addr string, ttl time.Duration) (*RedisRegistry, error) {
+	addr, password, db, err := redis.ParseAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisRegistry{
+		client: redis.NewClient(addr, password, db, maxIdleConns),
+		ttl:    ttl,
+	}, nil
+}
+
+// do sends one command, bounded by routeTimeout if ctx has no deadline.
+func (r *RedisRegistry) do(ctx context.Context, args ...any) (any, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, routeTimeout)
+		defer cancel()
+	}
+	return r.client.Do(ctx, args...)
+}
+
+// Record publishes the route for a user.
+func (r *RedisRegistry) Record(ctx context.Context, userID string, route Route) error {
+	value, err := json.Marshal(route)
+	if err != nil {
+		return fmt.Errorf("marshal route: %w", err)
+	}
+
+	args := []any{"SET", keyPrefix + userID, value}
+	if r.ttl > 0 {
+		args = append(args, "PX", r.ttl.Milliseconds())
+	}
+	if _, err := r.do(ctx, args...); err != nil {
+		return fmt.Errorf("record route: %w", err)
+	}
+	return nil
+}
+
+// Lookup returns the route for a user.
+func (r *RedisRegistry) Lookup(ctx context.Context, userID string) (Route, bool, error) {
+	reply, err := r.do(ctx, "GET", keyPrefix+userID)
+	if err != nil {
+		return Route{}, false, fmt.Errorf("lookup route: %w", err)
+	}
+	if reply == nil {
+		return Route{}, false, nil
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return Route{}, false, fmt.Errorf("lookup route: %w", redis.ErrProtocol)
+	}
+
+	var route Route
+	if err := json.Unmarshal([]byte(value), &route); err != nil {
+		return Route{}, false, fmt.Errorf("decode route: %w", err)
+	}
+	return route, true, nil
+}
+
+// Forget removes the route for a user.
+func (r *RedisRegistry) Forget(ctx context.Context, userID string) error {
+	if _, err := r.do(ctx, "DEL", keyPrefix+userID); err != nil {
+		return fmt.Errorf("forget route: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package affinity
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis serves GET, SET and DEL over RESP from an in-memory map.
+type fakeRedis struct {
+	mu   sync.Mutex
+	data map[string]string
+	args [][]string
+}
+
+func startFakeRedis(t *testing.T) (*fakeRedis, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	srv := &fakeRedis{data: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+	return srv, ln.Addr().String()
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.args = append(s.args, args)
+		var reply string
+		switch strings.ToUpper(args[0]) {
+		case "SET":
+			s.data[args[1]] = args[2]
+			reply = "+OK\r\n"
+		case "GET":
+			if v, ok := s.data[args[1]]; ok {
+				reply = "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+			} else {
+				reply = "$-1\r\n"
+			}
+		case "DEL":
+			_, ok := s.data[args[1]]
+			delete(s.data, args[1])
+			if ok {
+				reply = ":1\r\n"
+			} else {
+				reply = ":0\r\n"
+			}
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		s.mu.Unlock()
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeRedis) lastArgs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.args[len(s.args)-1]
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(header[1:]))
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func TestRedisRegistryRoundTrip(t *testing.T) {
+	srv, addr := startFakeRedis(t)
+	registry, err := NewRedisRegistry("redis://"+addr, time.Hour)
+	if err != nil {
+		t.Fatalf("NewRedisRegistry: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, ok, err := registry.Lookup(ctx, "user-1"); err != nil || ok {
+		t.Fatalf("expected no route before record, got ok=%v err=%v", ok, err)
+	}
+
+	want := Route{InstanceID: "node-a", Address: "10.0.0.5:8080"}
+	if err := registry.Record(ctx, "user-1", want); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if args := srv.lastArgs(); len(args) != 5 || args[1] != "shsh:route:user-1" || args[3] != "PX" || args[4] != "3600000" {
+		t.Fatalf("unexpected SET command: %q", args)
+	}
+
+	got, ok, err := registry.Lookup(ctx, "user-1")
+	if err != nil || !ok || got != want {
+		t.Fatalf("expected %+v, got %+v ok=%v err=%v", want, got, ok, err)
+	}
+
+	if err := registry.Forget(ctx, "user-1"); err != nil {
+		t.Fatalf("forget: %v", err)
+	}
+	if _, ok, _ := registry.Lookup(ctx, "user-1"); ok {
+		t.Fatal("expected route to be forgotten")
+	}
+}
+
+func TestRedisRegistryReportsServerErrors(t *testing.T) {
+	_, addr := startFakeRedis(t)
+	registry, err := NewRedisRegistry(addr, 0)
+	if err != nil {
+		t.Fatalf("NewRedisRegistry: %v", err)
+	}
+	if _, err := registry.do(context.Background(), "PING"); err == nil {
+		t.Fatal("expected redis error reply to surface as an error")
+	}
+}
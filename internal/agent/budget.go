@@ -0,0 +1,287 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+)
+
+// AI modes a Budget selects, from full service down to none of the agent.
+const (
+	ModeFull       = "full"        // Every command is analyzed and chat reaches the agent
+	ModeErrorsOnly = "errors_only" // Only failing commands are analyzed
+	ModeLocal      = "local"       // Local hints answer instead of the agent, except for probes
+)
+
+const (
+	// budgetBuckets is the number of slices the rolling window is kept in.
+	budgetBuckets = 10
+	// budgetWebhookTimeout bounds posting one mode change.
+	budgetWebhookTimeout = 10 * time.Second
+)
+
+// ModeChange is reported when a Budget changes mode.
+type ModeChange struct {
+	Mode      string    `json:"mode"`
+	Previous  string    `json:"previous"`
+	Reason    string    `json:"reason"`
+	ErrorRate float64   `json:"error_rate"` // Over the window when the mode changed
+	At        time.Time `json:"at"`
+}
+
+// recovery reports whether the change restores AI features.
+func (c *ModeChange) recovery() bool {
+	return c.Mode == ModeFull || (c.Previous == ModeLocal && c.Mode == ModeErrorsOnly)
+}
+
+// BudgetStatus reports a Budget for the health endpoint.
+type BudgetStatus struct {
+	Mode         string    `json:"mode"`
+	Since        time.Time `json:"since,omitzero"` // When the mode was entered; zero if it never changed
+	Calls        int       `json:"calls"`          // Agent calls in the window
+	Failures     int       `json:"failures"`       // Failed or slow calls in the window
+	ErrorRate    float64   `json:"error_rate"`
+	AvgLatencyMs int64     `json:"avg_latency_ms"`
+}
+
+// budgetBucket counts the calls of one slice of the window.
+type budgetBucket struct {
+	start    time.Time
+	calls    int
+	failures int
+	latency  time.Duration
+}
+
+// Budget tracks the error rate and latency of agent calls over a rolling
+// window and degrades AI features when the agent fails too often, so that a
+// struggling backend is not waited on for every command of every learner.
+// Past ErrorsOnlyRate only failing commands are analyzed; past LocalRate the
+// agent is replaced by local hints, except for one probe call per
+// ProbeInterval. A successful probe steps back to errors-only, and
+// RecoverAfter consecutive successful calls restore full behavior.
+type Budget struct {
+	cfg    config.AIBudgetConfig
+	notify func(ModeChange)
+	now    func() time.Time
+
+	mu        sync.Mutex
+	buckets   [budgetBuckets]budgetBucket
+	mode      string
+	since     time.Time
+	successes int // Consecutive successful calls
+	lastProbe time.Time
+}
+
+// NewBudget creates a budget in full mode.
+func NewBudget(cfg config.AIBudgetConfig) *Budget {
+	return &Budget{cfg: cfg, now: time.Now, mode: ModeFull}
+}
+
+// SetNotifier calls fn with every mode change, in addition to logging it.
+func (b *Budget) SetNotifier(fn func(ModeChange)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.notify = fn
+}
+
+// Mode returns the current mode.
+func (b *Budget) Mode() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.mode
+}
+
+// BudgetStatus reports the mode and the calls in the window.
+func (b *Budget) BudgetStatus() BudgetStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	calls, failures, latency := b.totalsLocked(b.now())
+	status := BudgetStatus{Mode: b.mode, Since: b.since, Calls: calls, Failures: failures}
+	if calls > 0 {
+		status.ErrorRate = float64(failures) / float64(calls)
+		status.AvgLatencyMs = (latency / time.Duration(calls)).Milliseconds()
+	}
+	return status
+}
+
+// admit reports the current mode and whether a call may reach the agent:
+// always outside local mode, and once per ProbeInterval in it.
+func (b *Budget) admit() (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.mode != ModeLocal {
+		return b.mode, true
+	}
+	now := b.now()
+	if now.Sub(b.lastProbe) < b.cfg.ProbeInterval {
+		return b.mode, false
+	}
+	b.lastProbe = now
+	return b.mode, true
+}
+
+// record adds a finished call and changes mode if the budget calls for it.
+func (b *Budget) record(latency time.Duration, failed bool) {
+	if latency > b.cfg.SlowCall {
+		failed = true
+	}
+	change, notify := b.add(latency, failed)
+	if change == nil {
+		return
+	}
+	if change.recovery() {
+		slog.Info("AI agent recovering, restoring AI features", "mode", change.Mode, "previous", change.Previous, "reason", change.Reason)
+	} else {
+		slog.Warn("AI agent over its error budget, degrading AI features", "mode", change.Mode, "previous", change.Previous, "reason", change.Reason)
+	}
+	if notify != nil {
+		notify(*change)
+	}
+}
+
+// add counts a call in the window and returns the mode change it causes, if
+// any, with the notifier to report it to.
+func (b *Budget) add(latency time.Duration, failed bool) (*ModeChange, func(ModeChange)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	bucket := b.bucketLocked(now)
+	bucket.calls++
+	bucket.latency += latency
+	if failed {
+		bucket.failures++
+		b.successes = 0
+	} else {
+		b.successes++
+	}
+
+	calls, failures, _ := b.totalsLocked(now)
+	rate := float64(failures) / float64(calls)
+	judged := calls >= b.cfg.MinCalls
+	var next, reason string
+	switch {
+	case b.mode != ModeLocal && judged && rate >= b.cfg.LocalRate:
+		next = ModeLocal
+		reason = fmt.Sprintf("%d of %d calls failed in %s", failures, calls, b.cfg.Window)
+	case b.mode == ModeFull && judged && rate >= b.cfg.ErrorsOnlyRate:
+		next = ModeErrorsOnly
+		reason = fmt.Sprintf("%d of %d calls failed in %s", failures, calls, b.cfg.Window)
+	case b.mode == ModeLocal && !failed:
+		next = ModeErrorsOnly
+		reason = "probe call succeeded"
+	case b.mode == ModeErrorsOnly && b.successes >= b.cfg.RecoverAfter:
+		next = ModeFull
+		reason = fmt.Sprintf("%d consecutive calls succeeded", b.successes)
+	default:
+		return nil, nil
+	}
+
+	change := &ModeChange{Mode: next, Previous: b.mode, Reason: reason, ErrorRate: rate, At: now}
+	b.mode = next
+	b.since = now
+	if next == ModeLocal {
+		// The first probe waits a full interval.
+		b.lastProbe = now
+	}
+	if change.recovery() {
+		// Failures from before the recovery must not degrade again.
+		b.buckets = [budgetBuckets]budgetBucket{}
+	}
+	return change, b.notify
+}
+
+// bucketLocked returns the bucket of the slice now falls in, clearing it if
+// it holds an earlier slice.
+func (b *Budget) bucketLocked(now time.Time) *budgetBucket {
+	width := b.bucketWidth()
+	start := now.Truncate(width)
+	bucket := &b.buckets[int(start.UnixNano()/int64(width))%budgetBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = budgetBucket{start: start}
+	}
+	return bucket
+}
+
+// totalsLocked sums the buckets within the window.
+func (b *Budget) totalsLocked(now time.Time) (calls, failures int, latency time.Duration) {
+	oldest := now.Truncate(b.bucketWidth()).Add(-b.cfg.Window)
+	for _, bucket := range b.buckets {
+		if bucket.start.After(oldest) {
+			calls += bucket.calls
+			failures += bucket.failures
+			latency += bucket.latency
+		}
+	}
+	return calls, failures, latency
+}
+
+func (b *Budget) bucketWidth() time.Duration {
+	return max(b.cfg.Window/budgetBuckets, time.Millisecond)
+}
+
+// trackCalls records the call seq makes to the agent when it finishes:
+// failed if it yields an error or a response failed reports as one.
+// Calls the caller abandons, such as chats of learners who left, are not
+// counted unless they had already run too long.
+func trackCalls[T any](ctx context.Context, b *Budget, seq iter.Seq2[T, error], failed func(T) bool) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		start := time.Now()
+		callFailed := false
+		defer func() {
+			latency := time.Since(start)
+			if ctx.Err() != nil && !callFailed && latency <= b.cfg.SlowCall {
+				return
+			}
+			b.record(latency, callFailed)
+		}()
+		for value, err := range seq {
+			if err != nil && !(errors.Is(err, context.Canceled) && ctx.Err() != nil) {
+				callFailed = true
+			}
+			if err == nil && failed != nil && failed(value) {
+				callFailed = true
+			}
+			if !yield(value, err) {
+				return
+			}
+		}
+	}
+}
+
+// NewBudgetWebhook returns a notifier posting each mode change as JSON to
+// url, for admins' alerting.
+func NewBudgetWebhook(url string) func(ModeChange) {
+	return func(change ModeChange) {
+		body, err := json.Marshal(change)
+		if err != nil {
+			return
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), budgetWebhookTimeout)
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+			if err != nil {
+				return
+			}
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				slog.Warn("Failed to post AI mode change", "error", err, "mode", change.Mode)
+				return
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				slog.Warn("AI mode change webhook rejected the post", "status", resp.StatusCode, "mode", change.Mode)
+			}
+		}()
+	}
+}
@@ -0,0 +1,175 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+)
+
+var errAgentDown = errors.New("agent down")
+
+// budgetProcessor answers every call, or fails it while fail is set.
+type budgetProcessor struct {
+	calls int
+	fail  bool
+}
+
+func (p *budgetProcessor) ProcessTerminalInput(_ context.Context, input TerminalInput) iter.Seq2[*Response, error] {
+	p.calls++
+	fail := p.fail
+	return func(yield func(*Response, error) bool) {
+		if fail {
+			yield(nil, errAgentDown)
+			return
+		}
+		yield(&Response{Type: string(ResponseTypeLLM), Content: "hint for " + input.Command}, nil)
+	}
+}
+
+func (p *budgetProcessor) Chat(context.Context, ChatRequest) iter.Seq2[*ChatResponse, error] {
+	p.calls++
+	fail := p.fail
+	return func(yield func(*ChatResponse, error) bool) {
+		if fail {
+			yield(nil, errAgentDown)
+			return
+		}
+		yield(&ChatResponse{Response: "answer"}, nil)
+	}
+}
+
+func (p *budgetProcessor) UpdateSessionSignals(context.Context, SessionSignalRequest) error {
+	return nil
+}
+func (p *budgetProcessor) ResetSession(context.Context, string, string) error { return nil }
+func (p *budgetProcessor) GetStats() Stats                                    { return Stats{} }
+func (p *budgetProcessor) Close()                                             {}
+
+func newTestBudget(now *time.Time) *Budget {
+	b := NewBudget(config.AIBudgetConfig{
+		Window:         time.Minute,
+		MinCalls:       4,
+		ErrorsOnlyRate: 0.25,
+		LocalRate:      0.5,
+		SlowCall:       10 * time.Second,
+		ProbeInterval:  30 * time.Second,
+		RecoverAfter:   2,
+	})
+	b.now = func() time.Time { return *now }
+	return b
+}
+
+func drainTerminal(s *Service, input TerminalInput) []*Response {
+	var responses []*Response
+	for resp, err := range s.ProcessTerminalInput(context.Background(), input) {
+		if err == nil {
+			responses = append(responses, resp)
+		}
+	}
+	return responses
+}
+
+func drainChat(s *Service) []*ChatResponse {
+	var responses []*ChatResponse
+	for resp, err := range s.Chat(context.Background(), ChatRequest{UserID: "u1", Message: "help"}) {
+		if err == nil {
+			responses = append(responses, resp)
+		}
+	}
+	return responses
+}
+
+func TestBudgetDegradesAndRecovers(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	budget := newTestBudget(&now)
+	var changes []ModeChange
+	budget.SetNotifier(func(c ModeChange) { changes = append(changes, c) })
+	processor := &budgetProcessor{fail: true}
+	service, _ := NewServiceWithProcessor(processor)
+	service.SetBudget(budget)
+
+	for range 4 {
+		drainChat(service)
+	}
+	if budget.Mode() != ModeLocal || len(changes) != 1 || changes[0].Previous != ModeFull {
+		t.Fatalf("expected full -> local after 4 failures, mode %s, changes %+v", budget.Mode(), changes)
+	}
+
+	// Local mode answers without the agent until a probe is due.
+	calls := processor.calls
+	if got := drainChat(service); len(got) != 1 || got[0].Response != localChatReply {
+		t.Fatalf("expected the local chat reply, got %+v", got)
+	}
+	got := drainTerminal(service, TerminalInput{Command: "pyhton3 app.py", ExitCode: 127, Output: "pyhton3: command not found"})
+	if len(got) != 1 || got[0].Pattern != "local:command_not_found" || got[0].Content[:9] != "`pyhton3`" {
+		t.Fatalf("expected a local command-not-found hint, got %+v", got)
+	}
+	if got := drainTerminal(service, TerminalInput{Command: "ls", ExitCode: 0}); len(got) != 0 {
+		t.Fatalf("successful commands get no local hint, got %+v", got)
+	}
+	if processor.calls != calls {
+		t.Fatalf("local mode called the agent %d times", processor.calls-calls)
+	}
+
+	// A successful probe steps up to errors-only.
+	now = now.Add(30 * time.Second)
+	processor.fail = false
+	if got := drainTerminal(service, TerminalInput{Command: "ls", ExitCode: 0}); len(got) != 1 {
+		t.Fatalf("expected the probe to reach the agent, got %+v", got)
+	}
+	if budget.Mode() != ModeErrorsOnly {
+		t.Fatalf("expected errors_only after a successful probe, got %s", budget.Mode())
+	}
+
+	calls = processor.calls
+	if got := drainTerminal(service, TerminalInput{Command: "ls", ExitCode: 0}); len(got) != 0 || processor.calls != calls {
+		t.Fatal("errors-only mode must not analyze successful commands")
+	}
+	if got := drainTerminal(service, TerminalInput{Command: "cat missing", ExitCode: 1}); len(got) != 1 {
+		t.Fatalf("errors-only mode should analyze failing commands, got %+v", got)
+	}
+	if budget.Mode() != ModeFull || len(changes) != 3 || changes[2].Mode != ModeFull {
+		t.Fatalf("expected full after 2 consecutive successes, mode %s, changes %+v", budget.Mode(), changes)
+	}
+	if status := budget.BudgetStatus(); status.Calls != 0 || status.Failures != 0 {
+		t.Fatalf("recovery should clear the window, got %+v", status)
+	}
+}
+
+func TestBudgetErrorsOnlyAndWindow(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	budget := newTestBudget(&now)
+
+	budget.record(time.Second, true)
+	now = now.Add(2 * time.Minute)
+	for range 3 {
+		budget.record(time.Second, false)
+	}
+	if budget.Mode() != ModeFull {
+		t.Fatalf("failures older than the window must not count, got %s", budget.Mode())
+	}
+	budget.record(11*time.Second, false)
+	if budget.Mode() != ModeErrorsOnly {
+		t.Fatalf("expected a slow call to spend the budget, got %s", budget.Mode())
+	}
+	if status := budget.BudgetStatus(); status.Calls != 4 || status.Failures != 1 || status.ErrorRate != 0.25 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+}
+
+func TestBudgetIgnoresAbandonedCalls(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	budget := newTestBudget(&now)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	seq := func(yield func(*Response, error) bool) { yield(nil, ctx.Err()) }
+	for range trackCalls(ctx, budget, seq, nil) {
+	}
+	if status := budget.BudgetStatus(); status.Calls != 0 {
+		t.Fatalf("abandoned calls must not count, got %+v", status)
+	}
+}
@@ -0,0 +1,201 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultChatDedupeWindow is how long a finished chat stream can still be
+// replayed to an identical request.
+const defaultChatDedupeWindow = 5 * time.Second
+
+// chatFrame is one SSE event of a chat response stream.
+type chatFrame struct {
+	event string
+	data  string
+}
+
+// chatFlight is a single chat response stream shared by every identical
+// request from a session. Frames are recorded so requests that attach late
+// replay the stream from the start.
+type chatFlight struct {
+	key    string
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu          sync.Mutex
+	frames      []chatFrame
+	done        bool
+	finishedAt  time.Time
+	subscribers int
+	changed     chan struct{} // closed and replaced whenever frames or done change
+}
+
+// publish records a frame and wakes subscribers.
+func (f *chatFlight) publish(event, data string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.frames = append(f.frames, chatFrame{event: event, data: data})
+	f.notifyLocked()
+}
+
+// finish marks the stream complete and wakes subscribers.
+func (f *chatFlight) finish(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.done = true
+	f.finishedAt = now
+	f.notifyLocked()
+}
+
+func (f *chatFlight) notifyLocked() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// since returns the frames published from index next onwards, whether the
+// flight has finished and the channel closed on the next change.
+func (f *chatFlight) since(next int) (frames []chatFrame, done bool, changed <-chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.frames[next:], f.done, f.changed
+}
+
+// subscribe adds a subscriber to the flight.
+func (f *chatFlight) subscribe() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subscribers++
+}
+
+// unsubscribe removes a subscriber and reports whether the flight is now
+// running with nobody left to receive it.
+func (f *chatFlight) unsubscribe() (abandoned bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subscribers--
+	return f.subscribers == 0 && !f.done
+}
+
+// finishedBefore reports whether the flight finished before cutoff.
+func (f *chatFlight) finishedBefore(cutoff time.Time) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.done && f.finishedAt.Before(cutoff)
+}
+
+// stream writes the flight's frames to w as they are published, starting
+// from the first one, until the flight finishes or ctx is done.
+func (f *chatFlight) stream(ctx context.Context, w http.ResponseWriter, flusher http.Flusher) error {
+	next := 0
+	for {
+		frames, done, changed := f.since(next)
+
+		for _, frame := range frames {
+			if err := writeSSE(w, frame.event, frame.data); err != nil {
+				return err
+			}
+		}
+		if len(frames) > 0 {
+			flusher.Flush()
+			next += len(frames)
+		}
+		if done {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// chatFlights deduplicates identical concurrent chat messages. The first
+// request for a message starts a flight; identical requests from the same
+// session attach to it while it runs and for a short window afterwards.
+type chatFlights struct {
+	mu      sync.Mutex
+	flights map[string]*chatFlight
+	window  time.Duration
+}
+
+func newChatFlights(window time.Duration) *chatFlights {
+	return &chatFlights{
+		flights: make(map[string]*chatFlight),
+		window:  window,
+	}
+}
+
+// chatFlightKey identifies a message within a session.
+func chatFlightKey(userID, sessionID, message string) string {
+	sum := sha256.Sum256([]byte(message))
+	return userID + ":" + sessionID + ":" + hex.EncodeToString(sum[:])
+}
+
+// join subscribes to the flight for key, starting a new one if none is
+// running or recently finished. started reports whether the caller must
+// produce the flight's frames; the flight's context is detached from any
+// single request and is cancelled only once every subscriber has left.
+func (c *chatFlights) join(parent context.Context, key string, now time.Time) (flight *chatFlight, started bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneLocked(now)
+
+	if f, ok := c.flights[key]; ok {
+		f.subscribe()
+		return f, false
+	}
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(parent))
+	f := &chatFlight{
+		key:         key,
+		ctx:         ctx,
+		cancel:      cancel,
+		subscribers: 1,
+		changed:     make(chan struct{}),
+	}
+	c.flights[key] = f
+	return f, true
+}
+
+// leave unsubscribes from f. When the last subscriber leaves a running
+// flight it is cancelled and forgotten, so a retry starts a fresh stream.
+func (c *chatFlights) leave(f *chatFlight) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if f.unsubscribe() {
+		c.dropLocked(f)
+	}
+}
+
+// drop cancels f and forgets it so the next identical request starts afresh.
+func (c *chatFlights) drop(f *chatFlight) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dropLocked(f)
+}
+
+func (c *chatFlights) dropLocked(f *chatFlight) {
+	f.cancel()
+	if c.flights[f.key] == f {
+		delete(c.flights, f.key)
+	}
+}
+
+// pruneLocked forgets flights that finished more than the window ago.
+func (c *chatFlights) pruneLocked(now time.Time) {
+	cutoff := now.Add(-c.window)
+	for key, f := range c.flights {
+		if f.finishedBefore(cutoff) {
+			f.cancel()
+			delete(c.flights, key)
+		}
+	}
+}
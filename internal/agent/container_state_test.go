@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/store"
+)
+
+// lastCommandRepo reports one command per session, run in pwd.
+type lastCommandRepo struct {
+	store.Repository
+	pwd string
+}
+
+func (r *lastCommandRepo) ListCommands(_ context.Context, userID, sessionID string, _ int) ([]*domain.CommandRecord, error) {
+	if r.pwd == "" {
+		return nil, nil
+	}
+	return []*domain.CommandRecord{{UserID: userID, SessionID: sessionID, Command: "ls", PWD: r.pwd}}, nil
+}
+
+// fakeInspector records the directory it was asked to list.
+type fakeInspector struct {
+	dir string
+	err error
+}
+
+func (i *fakeInspector) InspectState(_ context.Context, _, dir string) (*container.StateSnapshot, error) {
+	i.dir = dir
+	if i.err != nil {
+		return nil, i.err
+	}
+	return &container.StateSnapshot{Processes: "1 bash", DiskUsage: "50%", WorkingDir: "notes.txt", Uptime: "up 5m"}, nil
+}
+
+func TestContainerStateListsLastCommandDir(t *testing.T) {
+	inspector := &fakeInspector{}
+	h := newHandlerWithService(nil, &lastCommandRepo{pwd: "/home/learner/work/lab"}, make(chan *Response), WithStateInspector(inspector))
+	defer close(h.done)
+
+	state := h.containerState(t.Context(), ChatRequest{UserID: "alice", SessionID: "tab-1", ContainerID: "c1"})
+	if state == nil {
+		t.Fatal("expected a container state")
+	}
+	if inspector.dir != "/home/learner/work/lab" {
+		t.Fatalf("listed %q, want the last command's directory", inspector.dir)
+	}
+	if state.Processes != "1 bash" || state.WorkingDir != "notes.txt" || state.Uptime != "up 5m" {
+		t.Fatalf("unexpected state %+v", state)
+	}
+
+	// Without commands the container's own working directory is listed.
+	h.repo = &lastCommandRepo{}
+	if h.containerState(t.Context(), ChatRequest{UserID: "alice", SessionID: "tab-1", ContainerID: "c1"}); inspector.dir != "" {
+		t.Fatalf("listed %q, want the default directory", inspector.dir)
+	}
+}
+
+func TestContainerStateOmittedWhenUnavailable(t *testing.T) {
+	req := ChatRequest{UserID: "alice", SessionID: "tab-1", ContainerID: "c1"}
+
+	h := newHandlerWithService(nil, &lastCommandRepo{}, make(chan *Response))
+	defer close(h.done)
+	if state := h.containerState(t.Context(), req); state != nil {
+		t.Fatalf("expected no state without an inspector, got %+v", state)
+	}
+
+	h.stateInspector = &fakeInspector{err: errors.New("container not running")}
+	if state := h.containerState(t.Context(), req); state != nil {
+		t.Fatalf("expected no state when inspection fails, got %+v", state)
+	}
+
+	h.stateInspector = &fakeInspector{}
+	if state := h.containerState(t.Context(), ChatRequest{UserID: "alice"}); state != nil {
+		t.Fatalf("expected no state without a container, got %+v", state)
+	}
+}
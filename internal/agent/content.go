@@ -0,0 +1,202 @@
+package agent
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/ashureev/shsh-labs/internal/events"
+)
+
+// maxRunnableLines bounds the commands in a block offered for running; longer
+// blocks are scripts to read, not commands to click.
+const maxRunnableLines = 5
+
+var (
+	// fenceOpenPattern matches a code fence opening line and captures the
+	// fence and the language.
+	fenceOpenPattern = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})[ \t]*([^ \t`]*)")
+
+	// htmlBlockPattern matches elements whose content must go with them.
+	htmlBlockPattern = regexp.MustCompile(`(?is)<(?:script|style|iframe|object|embed|template)\b.*?</(?:script|style|iframe|object|embed|template)\s*>`)
+	// htmlCommentPattern matches HTML comments.
+	htmlCommentPattern = regexp.MustCompile(`(?s)<!--.*?-->`)
+	// htmlTagPattern matches opening, closing and self-closing tags of HTML
+	// elements. Placeholders such as <file> are not HTML and are left alone.
+	htmlTagPattern = regexp.MustCompile(`(?i)</?(?:a|abbr|b|blockquote|body|br|button|code|details|div|em|embed|font|form|h[1-6]|head|hr|html|i|iframe|img|input|kbd|li|link|meta|object|ol|p|pre|script|select|small|span|strong|style|sub|summary|sup|svg|table|tbody|td|template|textarea|th|thead|tr|u|ul|video)(?:\s[^<>]*)?/?>`)
+
+	// placeholderPattern matches text the learner is meant to replace.
+	placeholderPattern = regexp.MustCompile(`<[A-Za-z_][\w-]*>|\.\.\.|…`)
+)
+
+// shellLanguages are the fence languages whose blocks may be runnable.
+var shellLanguages = map[string]bool{
+	"bash": true, "sh": true, "shell": true, "zsh": true, "console": true,
+}
+
+// postProcessContent prepares agent Markdown for the sidebar. It strips HTML
+// outside code, closes a code fence left open (e.g. by truncation) and
+// returns the text with its fenced code blocks.
+func postProcessContent(s string) (string, []events.CodeBlock) {
+	if s == "" {
+		return s, nil
+	}
+
+	var (
+		out    []string
+		prose  []string
+		blocks []events.CodeBlock
+		fence  string // closing fence prefix while inside a block
+		lang   string
+		code   []string
+	)
+	flushProse := func() {
+		if len(prose) > 0 {
+			out = append(out, stripHTML(strings.Join(prose, "\n")))
+			prose = nil
+		}
+	}
+
+	for _, line := range strings.Split(s, "\n") {
+		if fence == "" {
+			m := fenceOpenPattern.FindStringSubmatch(line)
+			if m == nil {
+				prose = append(prose, line)
+				continue
+			}
+			flushProse()
+			fence, lang, code = m[1], strings.ToLower(m[2]), nil
+			out = append(out, line)
+			continue
+		}
+
+		out = append(out, line)
+		if isClosingFence(line, fence) {
+			blocks = append(blocks, newCodeBlock(lang, code))
+			fence = ""
+			continue
+		}
+		code = append(code, line)
+	}
+	flushProse()
+
+	if fence != "" {
+		out = append(out, fence)
+		blocks = append(blocks, newCodeBlock(lang, code))
+	}
+	return strings.Join(out, "\n"), blocks
+}
+
+// isClosingFence reports whether line closes a block opened with fence: the
+// same character, at least as long, with nothing after it.
+func isClosingFence(line, fence string) bool {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return false
+	}
+	trimmed = strings.TrimRight(trimmed, " \t")
+	return len(trimmed) >= len(fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+func newCodeBlock(lang string, lines []string) events.CodeBlock {
+	block := events.CodeBlock{
+		Language: lang,
+		Code:     strings.TrimSuffix(strings.Join(lines, "\n"), "\n"),
+	}
+	if command, ok := runnableCommand(lang, lines); ok {
+		block.Runnable = true
+		block.Command = command
+	}
+	return block
+}
+
+// runnableCommand returns the text to type for a shell block, or false if the
+// block is not a short, self-contained command. Console blocks must consist
+// of "$ " prompts only, which are removed.
+func runnableCommand(lang string, lines []string) (string, bool) {
+	if !shellLanguages[lang] {
+		return "", false
+	}
+	var commands []string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if lang == "console" {
+			command, ok := strings.CutPrefix(line, "$ ")
+			if !ok {
+				return "", false // command output
+			}
+			line = command
+		}
+		if placeholderPattern.MatchString(line) {
+			return "", false
+		}
+		commands = append(commands, line)
+	}
+	if len(commands) == 0 || len(commands) > maxRunnableLines {
+		return "", false
+	}
+	return strings.Join(commands, "\n"), true
+}
+
+// stripHTML removes HTML elements from Markdown prose, keeping inline code
+// spans, where angle brackets are literal, untouched.
+func stripHTML(s string) string {
+	if !strings.Contains(s, "<") {
+		return s
+	}
+	var b strings.Builder
+	for len(s) > 0 {
+		start, end := inlineCodeSpan(s)
+		if start < 0 {
+			b.WriteString(stripHTMLText(s))
+			break
+		}
+		b.WriteString(stripHTMLText(s[:start]))
+		b.WriteString(s[start:end])
+		s = s[end:]
+	}
+	return b.String()
+}
+
+func stripHTMLText(s string) string {
+	s = htmlBlockPattern.ReplaceAllString(s, "")
+	s = htmlCommentPattern.ReplaceAllString(s, "")
+	return htmlTagPattern.ReplaceAllString(s, "")
+}
+
+// inlineCodeSpan returns the bounds of the first inline code span in s: a run
+// of backticks closed by a run of the same length. It returns -1, -1 if there
+// is none.
+func inlineCodeSpan(s string) (int, int) {
+	for i := 0; i < len(s); {
+		if s[i] != '`' {
+			i++
+			continue
+		}
+		n := backtickRun(s[i:])
+		for j := i + n; j < len(s); {
+			if s[j] != '`' {
+				j++
+				continue
+			}
+			m := backtickRun(s[j:])
+			if m == n {
+				return i, j + m
+			}
+			j += m
+		}
+		// An unmatched run is literal text.
+		i += n
+	}
+	return -1, -1
+}
+
+func backtickRun(s string) int {
+	n := 0
+	for n < len(s) && s[n] == '`' {
+		n++
+	}
+	return n
+}
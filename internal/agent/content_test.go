@@ -0,0 +1,73 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPostProcessContentStripsHTMLOutsideCode(t *testing.T) {
+	in := "Use <b>ls</b> to list <file> names.<script>alert(1)</script>\n" +
+		"Inline `<div>` stays.<!-- hidden -->\n" +
+		"```html\n<div>kept</div>\n```"
+	want := "Use ls to list <file> names.\n" +
+		"Inline `<div>` stays.\n" +
+		"```html\n<div>kept</div>\n```"
+
+	got, blocks := postProcessContent(in)
+	if got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if len(blocks) != 1 || blocks[0].Code != "<div>kept</div>" || blocks[0].Runnable {
+		t.Fatalf("unexpected blocks: %+v", blocks)
+	}
+}
+
+func TestPostProcessContentClosesOpenFence(t *testing.T) {
+	got, blocks := postProcessContent("Try:\n```bash\nls -la")
+	if !strings.HasSuffix(got, "\n```") {
+		t.Fatalf("expected closing fence, got %q", got)
+	}
+	if len(blocks) != 1 || blocks[0].Code != "ls -la" {
+		t.Fatalf("unexpected blocks: %+v", blocks)
+	}
+}
+
+func TestPostProcessContentRunnable(t *testing.T) {
+	tests := []struct {
+		name    string
+		block   string
+		want    bool
+		command string
+	}{
+		{name: "shell command", block: "```bash\nls -la\n```", want: true, command: "ls -la"},
+		{name: "comments skipped", block: "```sh\n# list files\nls\n```", want: true, command: "ls"},
+		{name: "console prompts", block: "```console\n$ cd /tmp\n$ pwd\n```", want: true, command: "cd /tmp\npwd"},
+		{name: "console output", block: "```console\n$ pwd\n/tmp\n```", want: false},
+		{name: "placeholder", block: "```bash\ncat <file>\n```", want: false},
+		{name: "not shell", block: "```python\nprint(1)\n```", want: false},
+		{name: "no language", block: "```\nls\n```", want: false},
+		{name: "too long", block: "```bash\n" + strings.Repeat("echo hi\n", maxRunnableLines+1) + "```", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, blocks := postProcessContent(tt.block)
+			if len(blocks) != 1 {
+				t.Fatalf("expected one block, got %d", len(blocks))
+			}
+			if blocks[0].Runnable != tt.want || blocks[0].Command != tt.command {
+				t.Fatalf("got runnable=%v command=%q, want %v %q", blocks[0].Runnable, blocks[0].Command, tt.want, tt.command)
+			}
+		})
+	}
+}
+
+func TestInlineCodeSpan(t *testing.T) {
+	s := "a ``x ` y`` b"
+	start, end := inlineCodeSpan(s)
+	if s[start:end] != "``x ` y``" {
+		t.Fatalf("got %q", s[start:end])
+	}
+	if start, _ := inlineCodeSpan("unmatched ` tick"); start != -1 {
+		t.Fatalf("expected no span, got start %d", start)
+	}
+}
@@ -44,6 +44,9 @@ type ConversationLogEvent struct {
 type logRequest struct {
 	path  string
 	event ConversationLogEvent
+	// purged, when set, makes the request remove the directory at path
+	// instead of writing event, and receives the result.
+	purged chan error
 }
 
 // ConversationLogger writes conversation events to NDJSON.
@@ -52,6 +55,14 @@ type ConversationLogger interface {
 	Close() error
 }
 
+// ConversationLogPurger is implemented by loggers that can delete what they
+// wrote about a user.
+type ConversationLogPurger interface {
+	// PurgeUser deletes the user's per-session logs. Events already copied to
+	// the global log are kept.
+	PurgeUser(userID string) error
+}
+
 type noopConversationLogger struct{}
 
 func (noopConversationLogger) Log(ConversationLogEvent) {}
@@ -144,6 +155,30 @@ func (l *fileConversationLogger) Log(event ConversationLogEvent) {
 	}
 }
 
+// PurgeUser deletes the user's log directory. The removal is queued behind
+// the user's pending events, so none of them recreate it afterwards.
+func (l *fileConversationLogger) PurgeUser(userID string) error {
+	dir := filepath.Join(l.cfg.Dir, safePathPart(userID))
+	req := logRequest{path: dir, purged: make(chan error, 1)}
+
+	if !l.enqueue(req) {
+		return removeUserLogs(dir)
+	}
+	return <-req.purged
+}
+
+// enqueue blocks until req is queued, or reports false if the logger is
+// closed. Holding mu keeps Close from closing the queue meanwhile.
+func (l *fileConversationLogger) enqueue(req logRequest) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return false
+	}
+	l.queue <- req
+	return true
+}
+
 func (l *fileConversationLogger) Close() error {
 	l.stopOnce.Do(func() {
 		l.mu.Lock()
@@ -159,6 +194,10 @@ func (l *fileConversationLogger) worker() {
 	defer l.wg.Done()
 
 	for req := range l.queue {
+		if req.purged != nil {
+			req.purged <- removeUserLogs(req.path)
+			continue
+		}
 		if err := l.writeEvent(req.path, req.event); err != nil {
 			l.logger.Error("failed to write conversation log event",
 				"error", err,
@@ -210,6 +249,13 @@ func (l *fileConversationLogger) writeEvent(path string, event ConversationLogEv
 	return nil
 }
 
+func removeUserLogs(dir string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("remove conversation logs: %w", err)
+	}
+	return nil
+}
+
 func (l *fileConversationLogger) eventPath(userID, sessionID string) string {
 	safeUser := safePathPart(userID)
 	safeSession := safePathPart(sessionID)
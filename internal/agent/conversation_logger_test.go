@@ -77,3 +77,34 @@ func waitForLogLine(t *testing.T, path string) string {
 	t.Fatalf("timed out waiting for log file %s", path)
 	return ""
 }
+
+func TestConversationLoggerPurgeUser(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	logger, err := NewConversationLogger(ConversationLogConfig{
+		Enabled:   true,
+		Dir:       dir,
+		QueueSize: 16,
+	}, slog.Default())
+	if err != nil {
+		t.Fatalf("NewConversationLogger failed: %v", err)
+	}
+	defer func() { _ = logger.Close() }()
+
+	for _, userID := range []string{"user-1", "user-2"} {
+		logger.Log(ConversationLogEvent{UserID: userID, SessionID: "sess-1", ContentRaw: "hi"})
+	}
+	purger, ok := logger.(ConversationLogPurger)
+	if !ok {
+		t.Fatal("expected file logger to support purging")
+	}
+	if err := purger.PurgeUser("user-1"); err != nil {
+		t.Fatalf("PurgeUser failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "user-1")); !os.IsNotExist(err) {
+		t.Fatalf("expected user-1 logs to be removed, stat err: %v", err)
+	}
+	waitForLogLine(t, filepath.Join(dir, "user-2", "sess-1.ndjson"))
+}
@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/handoff"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/store"
+)
+
+const (
+	// eventIDBlock is how many SSE event IDs are reserved in the repository at
+	// a time, so persisting the high-water mark costs one write per block.
+	eventIDBlock = 100
+	// eventIDReserveTimeout bounds a single reservation.
+	eventIDReserveTimeout = 2 * time.Second
+)
+
+// eventIDs hands out SSE event IDs per tab session. Each session has its own
+// sequence, so IDs reveal nothing about other users' traffic, and reserved
+// ranges are persisted so IDs keep increasing across restarts. If the
+// repository is unavailable IDs continue in memory; the stream epoch then
+// tells reconnecting clients that their Last-Event-ID is stale.
+type eventIDs struct {
+	repo  store.Repository
+	epoch string
+
+	mu       sync.Mutex
+	sessions map[identity.SessionKey]*eventIDRange
+}
+
+// eventIDRange is the unused part of a session's reserved IDs.
+type eventIDRange struct {
+	next      int64 // next ID to hand out
+	limit     int64 // last reserved ID
+	persisted bool  // whether limit is recorded in the repository
+}
+
+func newEventIDs(repo store.Repository) *eventIDs {
+	return &eventIDs{
+		repo:     repo,
+		epoch:    strconv.FormatInt(time.Now().UnixNano(), 36),
+		sessions: make(map[identity.SessionKey]*eventIDRange),
+	}
+}
+
+// next returns the session's next event ID.
+func (e *eventIDs) next(key identity.SessionKey) int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	r, ok := e.sessions[key]
+	if !ok {
+		r = &eventIDRange{next: 1}
+		e.sessions[key] = r
+	}
+	if r.next > r.limit {
+		e.reserve(key, r)
+	}
+	id := r.next
+	r.next++
+	return id
+}
+
+// reserve refills r with the next block of IDs.
+func (e *eventIDs) reserve(key identity.SessionKey, r *eventIDRange) {
+	if e.repo != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), eventIDReserveTimeout)
+		defer cancel()
+		mark, err := e.repo.ReserveEventIDs(ctx, key.UserID(), key.SessionID(), eventIDBlock)
+		switch {
+		case err != nil:
+			slog.Warn("Failed to reserve SSE event IDs", "error", err, "user_id", key.UserID(), "session_id", key.SessionID())
+		case mark-eventIDBlock+1 >= r.next:
+			r.next = mark - eventIDBlock + 1
+			r.limit = mark
+			r.persisted = true
+			return
+		}
+	}
+	// Continue in memory; IDs stay monotonic within this process.
+	r.limit = r.next + eventIDBlock - 1
+	r.persisted = false
+}
+
+// forget drops a session's unused IDs once its stream closes; the next ID
+// then comes from a fresh reservation. Sequences kept only in memory are
+// retained, as they could not be resumed.
+func (e *eventIDs) forget(key identity.SessionKey) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if r, ok := e.sessions[key]; ok && r.persisted {
+		delete(e.sessions, key)
+	}
+}
+
+// handoff returns the epoch and the last ID handed out in each session, for
+// the process replacing this one.
+func (e *eventIDs) handoff() handoff.EventStreams {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	streams := handoff.EventStreams{Epoch: e.epoch}
+	for key, r := range e.sessions {
+		if r.next > 1 {
+			streams.Sessions = append(streams.Sessions, handoff.EventIDMark{
+				UserID:    key.UserID(),
+				SessionID: key.SessionID(),
+				LastID:    r.next - 1,
+			})
+		}
+	}
+	return streams
+}
+
+// resume continues the sequences of the process this one replaces, keeping
+// its epoch so that reconnecting tabs' Last-Event-IDs stay valid. Sessions
+// the previous process had forgotten were persisted, so reservations keep
+// them increasing. It must be called before any ID is handed out.
+func (e *eventIDs) resume(streams handoff.EventStreams) {
+	if streams.Epoch == "" {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.epoch = streams.Epoch
+	for _, mark := range streams.Sessions {
+		// An exhausted range, so the next ID comes from a fresh reservation.
+		e.sessions[identity.NewSessionKey(mark.UserID, mark.SessionID)] = &eventIDRange{
+			next:  mark.LastID + 1,
+			limit: mark.LastID,
+		}
+	}
+}
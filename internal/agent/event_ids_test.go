@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/store"
+)
+
+// markRepo persists event ID high-water marks in memory.
+type markRepo struct {
+	store.Repository
+	marks map[identity.SessionKey]int64
+	fail  bool
+}
+
+func (r *markRepo) ReserveEventIDs(_ context.Context, userID, sessionID string, n int64) (int64, error) {
+	if r.fail {
+		return 0, errors.New("database unavailable")
+	}
+	key := identity.NewSessionKey(userID, sessionID)
+	r.marks[key] += n
+	return r.marks[key], nil
+}
+
+func TestEventIDsArePerSession(t *testing.T) {
+	ids := newEventIDs(nil)
+	alice := identity.NewSessionKey("alice", "tab-1")
+	bob := identity.NewSessionKey("bob", "tab-1")
+
+	if got := []int64{ids.next(alice), ids.next(alice), ids.next(bob)}; got[0] != 1 || got[1] != 2 || got[2] != 1 {
+		t.Fatalf("expected independent sequences [1 2 1], got %v", got)
+	}
+}
+
+func TestEventIDsResumeAfterRestart(t *testing.T) {
+	repo := &markRepo{marks: make(map[identity.SessionKey]int64)}
+	key := identity.NewSessionKey("alice", "tab-1")
+
+	first := newEventIDs(repo)
+	for range 3 {
+		first.next(key)
+	}
+
+	restarted := newEventIDs(repo)
+	if got := restarted.next(key); got != eventIDBlock+1 {
+		t.Fatalf("expected IDs to continue past the reserved block at %d, got %d", eventIDBlock+1, got)
+	}
+	if first.epoch == "" || restarted.epoch == first.epoch {
+		t.Fatalf("expected a new epoch after restart, got %q and %q", first.epoch, restarted.epoch)
+	}
+}
+
+func TestEventIDsContinueWhenReservationFails(t *testing.T) {
+	repo := &markRepo{marks: make(map[identity.SessionKey]int64), fail: true}
+	ids := newEventIDs(repo)
+	key := identity.NewSessionKey("alice", "tab-1")
+
+	for want := int64(1); want <= eventIDBlock+1; want++ {
+		if got := ids.next(key); got != want {
+			t.Fatalf("expected ID %d, got %d", want, got)
+		}
+	}
+
+	// A sequence that was never persisted survives the stream closing.
+	ids.forget(key)
+	if got := ids.next(key); got != eventIDBlock+2 {
+		t.Fatalf("expected in-memory sequence to continue, got %d", got)
+	}
+}
+
+func TestEventIDsResumeFromHandoff(t *testing.T) {
+	repo := &markRepo{marks: make(map[identity.SessionKey]int64), fail: true}
+	key := identity.NewSessionKey("alice", "tab-1")
+
+	first := newEventIDs(repo)
+	for range 3 {
+		first.next(key)
+	}
+	state := first.handoff()
+
+	// IDs kept only in memory continue after the mark, in the same epoch.
+	restarted := newEventIDs(repo)
+	restarted.resume(state)
+	if restarted.epoch != first.epoch {
+		t.Fatalf("expected the epoch %q to be kept, got %q", first.epoch, restarted.epoch)
+	}
+	if got := restarted.next(key); got != 4 {
+		t.Fatalf("expected IDs to continue at 4, got %d", got)
+	}
+
+	// Reservations still apply once the repository is back.
+	repo.fail = false
+	repo.marks[key] = eventIDBlock
+	again := newEventIDs(repo)
+	again.resume(restarted.handoff())
+	if got := again.next(key); got != eventIDBlock+1 {
+		t.Fatalf("expected the next reserved block at %d, got %d", eventIDBlock+1, got)
+	}
+}
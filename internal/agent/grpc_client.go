@@ -151,11 +151,12 @@ func (c *GrpcClient) Chat(ctx context.Context, req ChatRequest) iter.Seq2[*ChatR
 		}
 
 		stream, err := c.client.Chat(ctx, &agent.ChatRequest{
-			Message:     req.Message,
-			UserId:      req.UserID,
-			ContainerId: req.ContainerID,
-			VolumePath:  req.VolumePath,
-			SessionId:   sessionID,
+			Message:        req.Message,
+			UserId:         req.UserID,
+			ContainerId:    req.ContainerID,
+			VolumePath:     req.VolumePath,
+			SessionId:      sessionID,
+			ContainerState: containerStateProto(req.ContainerState),
 		})
 		if err != nil {
 			yield(nil, fmt.Errorf("chat request failed: %w", err))
@@ -334,3 +335,17 @@ func safeIntToInt32(v int) int32 {
 	}
 	return int32(v)
 }
+
+// containerStateProto converts a container snapshot for the wire.
+func containerStateProto(state *ContainerStateOutput) *agent.ContainerState {
+	if state == nil {
+		return nil
+	}
+	return &agent.ContainerState{
+		Processes:   state.Processes,
+		DiskUsage:   state.DiskUsage,
+		Environment: state.Environment,
+		Uptime:      state.Uptime,
+		WorkingDir:  state.WorkingDir,
+	}
+}
@@ -2,6 +2,7 @@ package agent
 
 import (
 	"container/list"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,10 +12,18 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/events"
+	"github.com/ashureev/shsh-labs/internal/handoff"
 	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/session"
+	"github.com/ashureev/shsh-labs/internal/shared"
 	"github.com/ashureev/shsh-labs/internal/store"
 	"github.com/docker/docker/client"
 	"github.com/go-chi/chi/v5"
@@ -24,18 +33,43 @@ import (
 // defaultMaxRequestBodySize is the default maximum allowed request body size (1MB).
 const defaultMaxRequestBodySize = 1 << 20 // 1MB
 
+// defaultSSEMaxMessageSize is the default maximum size of a text field in an SSE event (32KB).
+const defaultSSEMaxMessageSize = 32 * 1024
+
+// defaultSSEChunkSize is the default size above which text fields are split across events (8KB).
+const defaultSSEChunkSize = 8 * 1024
+
+// defaultSSESendBufferSize is the default number of events buffered per connection.
+const defaultSSESendBufferSize = 32
+
+// defaultSSEWriteTimeout is the default deadline for writing one event to a client.
+const defaultSSEWriteTimeout = 10 * time.Second
+
 // SSEConnection represents a single SSE client connection.
+// Only the goroutine serving the stream writes to it; broadcasts are handed
+// over through the buffered send channel so a stalled client cannot block
+// delivery to others.
 type SSEConnection struct {
 	ID          int64
 	UserID      string
 	SessionID   string
+	Classroom   string
 	EventID     int64
 	ConnectedAt time.Time
 	LastEventID int64
 	Writer      http.ResponseWriter
 	Flusher     http.Flusher
 	Done        chan struct{}
-	mu          sync.Mutex
+	doneOnce    sync.Once
+	send        chan sseFrame
+	dropped     atomic.Int64
+	reported    int64 // Drops already reported to the client; owned by the serving goroutine
+}
+
+// sseFrame is a response waiting in a connection's send buffer.
+type sseFrame struct {
+	eventID int64
+	resp    *Response
 }
 
 // SSEMessageQueue buffers messages for disconnected clients, sharded per session.
@@ -43,7 +77,7 @@ type SSEConnection struct {
 // messages belonging to another user.
 type SSEMessageQueue struct {
 	mu      sync.RWMutex
-	queues  map[string]*list.List // sessionKey (userID:sessionID) -> messages
+	queues  map[identity.SessionKey]*list.List // sessionKey -> messages
 	maxSize int
 }
 
@@ -62,14 +96,14 @@ func NewSSEMessageQueue(maxSize int) *SSEMessageQueue {
 		maxSize = 100 // Default: keep last 100 messages per session
 	}
 	return &SSEMessageQueue{
-		queues:  make(map[string]*list.List),
+		queues:  make(map[identity.SessionKey]*list.List),
 		maxSize: maxSize,
 	}
 }
 
 // Enqueue adds a message to the per-session queue.
 func (q *SSEMessageQueue) Enqueue(userID, sessionID string, eventID int64, resp *Response) {
-	key := sseSessionKey(userID, sessionID)
+	key := identity.NewSessionKey(userID, sessionID)
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
@@ -92,7 +126,7 @@ func (q *SSEMessageQueue) Enqueue(userID, sessionID string, eventID int64, resp
 
 // GetMissedMessages retrieves messages after a specific event ID for a session.
 func (q *SSEMessageQueue) GetMissedMessages(userID, sessionID string, afterEventID int64) []*QueuedMessage {
-	key := sseSessionKey(userID, sessionID)
+	key := identity.NewSessionKey(userID, sessionID)
 	q.mu.RLock()
 	defer q.mu.RUnlock()
 
@@ -110,10 +144,10 @@ func (q *SSEMessageQueue) GetMissedMessages(userID, sessionID string, afterEvent
 	return missed
 }
 
-// Prune removes the queue for a session when the SSE connection closes.
-// Call this from the HandleStream defer to free memory promptly.
+// Prune removes the queue for a session. HandleStream registers it to run
+// when the session ends, freeing memory promptly.
 func (q *SSEMessageQueue) Prune(userID, sessionID string) {
-	key := sseSessionKey(userID, sessionID)
+	key := identity.NewSessionKey(userID, sessionID)
 	q.mu.Lock()
 	defer q.mu.Unlock()
 	delete(q.queues, key)
@@ -122,23 +156,97 @@ func (q *SSEMessageQueue) Prune(userID, sessionID string) {
 // Handler handles AI agent HTTP requests with robust SSE support.
 type Handler struct {
 	agent          *Service
-	dockerClient   *client.Client
 	repo           store.Repository
 	rateLimiter    *RateLimiter
 	broadcastChan  chan *Response
-	sseConnections map[string]map[int64]*SSEConnection // sessionKey -> ConnectionID -> Connection
+	sseConnections map[identity.SessionKey]map[int64]*SSEConnection // sessionKey -> ConnectionID -> Connection
 	messageQueue   *SSEMessageQueue
 	connectionsMu  sync.RWMutex
-	eventCounter   int64
+	eventIDs       *eventIDs
 	connectionID   int64 // Counter for unique connection IDs
 	counterMu      sync.Mutex
 	done           chan struct{} // Closed to signal goroutine shutdown
 	log            ConversationLogger
 	cfg            *config.Config
+	classrooms     ClassroomResolver
+	deliveryMu     sync.Mutex
+	deliveries     map[Target]*DeliveryStats
+	drops          dropStats
+	chatFlights    *chatFlights
+	sessions       *session.Lifecycle
+	stateInspector container.StateInspector
+}
+
+// dropStats counts messages dropped since the last drop report.
+type dropStats struct {
+	sidebar    atomic.Int64 // Dropped by the terminal monitor, learned from markers
+	connection atomic.Int64 // Dropped from full connection send buffers
 }
 
-func sseSessionKey(userID, sessionID string) string {
-	return userID + ":" + sessionID
+// dropReportInterval is how often aggregate drop counts are logged.
+const dropReportInterval = time.Minute
+
+// ClassroomResolver maps a user to the classroom their connections join for
+// TargetClassroom broadcasts.
+type ClassroomResolver interface {
+	// ClassroomOf returns the user's classroom, or "" if they are in none.
+	ClassroomOf(ctx context.Context, userID string) string
+}
+
+// SetClassroomResolver enables classroom-wide broadcasts. It must be called
+// before streams connect; connections record their classroom on connect.
+func (h *Handler) SetClassroomResolver(resolver ClassroomResolver) {
+	h.classrooms = resolver
+}
+
+// errBroadcastFull is returned by Announce when the broadcast channel is full.
+var errBroadcastFull = errors.New("broadcast channel full")
+
+// Announce broadcasts an instructor announcement to the connections in
+// classroom, or to every connection when classroom is empty. It fails
+// rather than wait when the broadcast channel is full.
+func (h *Handler) Announce(classroom, message string) error {
+	resp := &Response{Type: string(ResponseTypeAnnouncement), Content: message, Target: TargetAll}
+	if classroom != "" {
+		resp.Target, resp.Classroom = TargetClassroom, classroom
+	}
+	select {
+	case h.broadcastChan <- resp:
+		return nil
+	default:
+		return errBroadcastFull
+	}
+}
+
+// DeliveryStats returns a snapshot of broadcast delivery counts per target.
+func (h *Handler) DeliveryStats() map[Target]DeliveryStats {
+	h.deliveryMu.Lock()
+	defer h.deliveryMu.Unlock()
+
+	stats := make(map[Target]DeliveryStats, len(h.deliveries))
+	for target, s := range h.deliveries {
+		stats[target] = *s
+	}
+	return stats
+}
+
+func (h *Handler) recordDelivery(target Target, delivered, dropped int) {
+	h.deliveryMu.Lock()
+	defer h.deliveryMu.Unlock()
+
+	s, ok := h.deliveries[target]
+	if !ok {
+		s = &DeliveryStats{}
+		h.deliveries[target] = s
+	}
+	s.Messages++
+	s.Dropped += int64(dropped)
+	s.Deliveries += int64(delivered)
+	if delivered == 0 {
+		s.Undelivered++
+		return
+	}
+	s.LastDeliveredAt = time.Now()
 }
 
 // RateLimiter implements a per-user rate limiter.
@@ -186,6 +294,37 @@ func (r *RateLimiter) Allow(key string) bool {
 	return true
 }
 
+// RateLimitStatus describes a key's position in its rate-limit window.
+type RateLimitStatus struct {
+	Limit     int           `json:"limit"`
+	Remaining int           `json:"remaining"`
+	Window    time.Duration `json:"-"`
+	// ResetAt is when the oldest counted request leaves the window, freeing a
+	// slot; zero when nothing is counted.
+	ResetAt time.Time `json:"reset_at,omitzero"`
+}
+
+// Status reports the key's current rate-limit state without counting a request.
+func (r *RateLimiter) Status(key string) RateLimitStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cutoff := time.Now().Add(-r.window)
+	status := RateLimitStatus{Limit: r.limit, Window: r.window}
+	used := 0
+	for _, t := range r.requests[key] {
+		if !t.After(cutoff) {
+			continue
+		}
+		if used == 0 {
+			status.ResetAt = t.Add(r.window)
+		}
+		used++
+	}
+	status.Remaining = max(r.limit-used, 0)
+	return status
+}
+
 // startEviction runs a background goroutine that periodically removes expired
 // keys from the requests map, preventing unbounded memory growth.
 func (r *RateLimiter) startEviction() {
@@ -213,29 +352,77 @@ func (r *RateLimiter) startEviction() {
 	}()
 }
 
-// NewHandlerWithGrpcClient creates a new agent handler using the gRPC client.
-// Deprecated: Use NewHandlerWithGrpcClientAndConfig instead.
-func NewHandlerWithGrpcClient(dockerClient *client.Client, repo store.Repository, broadcastChan chan *Response, grpcClient *GrpcClient, conversationLogger ConversationLogger) (*Handler, error) {
-	agentService, err := NewServiceWithProcessor(grpcClient)
-	if err != nil {
-		return nil, err
-	}
+// HandlerOption configures a handler built by NewHandler.
+type HandlerOption func(*handlerOptions)
 
-	return newHandlerWithService(dockerClient, repo, broadcastChan, agentService, conversationLogger, nil), nil
+type handlerOptions struct {
+	conversationLogger ConversationLogger
+	cfg                *config.Config
+	sessions           *session.Lifecycle
+	stateInspector     container.StateInspector
 }
 
-// NewHandlerWithGrpcClientAndConfig creates a new agent handler using the gRPC client with configuration.
-func NewHandlerWithGrpcClientAndConfig(dockerClient *client.Client, repo store.Repository, broadcastChan chan *Response, grpcClient *GrpcClient, conversationLogger ConversationLogger, cfg *config.Config) (*Handler, error) {
-	agentService, err := NewServiceWithProcessor(grpcClient)
+// WithConversationLogger logs chat and terminal conversations to l.
+func WithConversationLogger(l ConversationLogger) HandlerOption {
+	return func(o *handlerOptions) { o.conversationLogger = l }
+}
+
+// WithConfig sets the server configuration; without it defaults are used.
+func WithConfig(cfg *config.Config) HandlerOption {
+	return func(o *handlerOptions) { o.cfg = cfg }
+}
+
+// WithSessionLifecycle shares the session lifecycle with the terminal
+// handler, so a tab's replay queue lives as long as its terminal or stream.
+func WithSessionLifecycle(l *session.Lifecycle) HandlerOption {
+	return func(o *handlerOptions) { o.sessions = l }
+}
+
+// WithStateInspector gives chat a snapshot of the learner's container,
+// taken through i, so the agent answers from what is actually there.
+func WithStateInspector(i container.StateInspector) HandlerOption {
+	return func(o *handlerOptions) { o.stateInspector = i }
+}
+
+// NewHandler creates a new agent handler whose service runs on processor,
+// e.g. a *GrpcClient.
+func NewHandler(processor Processor, repo store.Repository, broadcastChan chan *Response, opts ...HandlerOption) (*Handler, error) {
+	agentService, err := NewServiceWithProcessor(processor)
 	if err != nil {
 		return nil, err
 	}
 
-	return newHandlerWithService(dockerClient, repo, broadcastChan, agentService, conversationLogger, cfg), nil
+	return newHandlerWithService(agentService, repo, broadcastChan, opts...), nil
+}
+
+// NewHandlerWithGrpcClient creates a new agent handler using the gRPC client.
+// The Docker client is unused; the handler reaches containers through its
+// StateInspector.
+//
+// Deprecated: Use NewHandler with WithConversationLogger instead.
+func NewHandlerWithGrpcClient(_ *client.Client, repo store.Repository, broadcastChan chan *Response, grpcClient *GrpcClient, conversationLogger ConversationLogger) (*Handler, error) {
+	return NewHandler(grpcClient, repo, broadcastChan, WithConversationLogger(conversationLogger))
+}
+
+// NewHandlerWithGrpcClientAndConfig creates a new agent handler using the gRPC client with configuration.
+// The Docker client is unused.
+//
+// Deprecated: Use NewHandler with WithConversationLogger and WithConfig
+// instead.
+func NewHandlerWithGrpcClientAndConfig(_ *client.Client, repo store.Repository, broadcastChan chan *Response, grpcClient *GrpcClient, conversationLogger ConversationLogger, cfg *config.Config) (*Handler, error) {
+	return NewHandler(grpcClient, repo, broadcastChan, WithConversationLogger(conversationLogger), WithConfig(cfg))
 }
 
 // newHandlerWithService creates a handler with the given agent service.
-func newHandlerWithService(dockerClient *client.Client, repo store.Repository, broadcastChan chan *Response, agentService *Service, conversationLogger ConversationLogger, cfg *config.Config) *Handler {
+func newHandlerWithService(agentService *Service, repo store.Repository, broadcastChan chan *Response, opts ...HandlerOption) *Handler {
+	var o handlerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	conversationLogger, cfg := o.conversationLogger, o.cfg
+	if o.sessions == nil {
+		o.sessions = session.NewLifecycle(nil)
+	}
 	if conversationLogger == nil {
 		conversationLogger = noopConversationLogger{}
 	}
@@ -243,27 +430,34 @@ func newHandlerWithService(dockerClient *client.Client, repo store.Repository, b
 	// Use config values if available, otherwise use defaults
 	rateLimitRequests := 10
 	rateLimitWindow := time.Minute
+	chatDedupeWindow := defaultChatDedupeWindow
 
 	if cfg != nil {
 		rateLimitRequests = cfg.RateLimit.RequestsPerWindow
 		rateLimitWindow = cfg.RateLimit.WindowDuration
+		chatDedupeWindow = cfg.RateLimit.ChatDedupeWindow
 	}
 
 	handler := &Handler{
 		agent:          agentService,
-		dockerClient:   dockerClient,
 		repo:           repo,
 		rateLimiter:    NewRateLimiter(rateLimitRequests, rateLimitWindow),
 		broadcastChan:  broadcastChan,
-		sseConnections: make(map[string]map[int64]*SSEConnection),
+		sseConnections: make(map[identity.SessionKey]map[int64]*SSEConnection),
 		messageQueue:   NewSSEMessageQueue(100),
+		eventIDs:       newEventIDs(repo),
 		done:           make(chan struct{}),
 		log:            conversationLogger,
 		cfg:            cfg,
+		deliveries:     make(map[Target]*DeliveryStats),
+		chatFlights:    newChatFlights(chatDedupeWindow),
+		sessions:       o.sessions,
+		stateInspector: o.stateInspector,
 	}
 
 	// Start the broadcaster goroutine
 	go handler.broadcastLoop(broadcastChan)
+	go handler.dropReportLoop(dropReportInterval)
 
 	return handler
 }
@@ -295,13 +489,6 @@ func (h *Handler) HandleChat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Rate-limit by userID only (not userID:sessionID) so clients cannot bypass
-	// throttling by rotating session IDs.
-	if !h.rateLimiter.Allow(user.UserID) {
-		http.Error(w, `{"error": "rate limit exceeded"}`, http.StatusTooManyRequests)
-		return
-	}
-
 	// Use config value for max body size if available
 	maxBodySize := int64(defaultMaxRequestBodySize)
 	if h.cfg != nil {
@@ -324,59 +511,89 @@ func (h *Handler) HandleChat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	req.ContainerID = user.ContainerID
-	req.VolumePath = user.VolumePath
-	req.UserID = user.UserID
-	req.SessionID = sessionID
-	reqID := chiMiddleware.GetReqID(r.Context())
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, `{"error": "streaming not supported"}`, http.StatusInternalServerError)
+		return
+	}
 
-	slog.Info("Agent chat request",
-		"user_id", user.UserID,
-		"session_id", sessionID,
-		"container_id", req.ContainerID,
-		"message_length", len(req.Message),
-	)
-	h.log.Log(ConversationLogEvent{
-		Timestamp:  time.Now().UTC().Format(time.RFC3339Nano),
-		UserID:     req.UserID,
-		SessionID:  req.SessionID,
-		Channel:    "chat_http",
-		Direction:  "outbound",
-		EventType:  "chat_user_message",
-		ContentRaw: req.Message,
-		Content:    cleanForReadability(req.Message),
-		Meta: map[string]any{
-			"request_id": reqID,
-		},
-	})
+	// Identical messages from the same session (double-clicks, client retries)
+	// attach to the stream already answering them instead of asking again.
+	flight, started := h.chatFlights.join(r.Context(), chatFlightKey(user.UserID, sessionID, req.Message), time.Now())
+	defer h.chatFlights.leave(flight)
+
+	if started {
+		// Rate-limit by userID only (not userID:sessionID) so clients cannot bypass
+		// throttling by rotating session IDs. Kept-warm users are exempt.
+		if !user.IsKeptWarm(time.Now()) && !h.rateLimiter.Allow(user.UserID) {
+			// Requests that attached meanwhile get the same answer.
+			flight.publish("error", "rate limit exceeded")
+			flight.finish(time.Now())
+			h.chatFlights.drop(flight)
+			http.Error(w, `{"error": "rate limit exceeded"}`, http.StatusTooManyRequests)
+			return
+		}
+
+		req.ContainerID = user.ContainerID
+		req.VolumePath = user.VolumePath
+		req.UserID = user.UserID
+		req.SessionID = sessionID
+		reqID := chiMiddleware.GetReqID(r.Context())
+
+		slog.Info("Agent chat request",
+			"user_id", user.UserID,
+			"session_id", sessionID,
+			"container_id", req.ContainerID,
+			"message_length", len(req.Message),
+		)
+		h.log.Log(ConversationLogEvent{
+			Timestamp:  time.Now().UTC().Format(time.RFC3339Nano),
+			UserID:     req.UserID,
+			SessionID:  req.SessionID,
+			Channel:    "chat_http",
+			Direction:  "outbound",
+			EventType:  "chat_user_message",
+			ContentRaw: req.Message,
+			Content:    cleanForReadability(req.Message),
+			Meta: map[string]any{
+				"request_id": reqID,
+			},
+		})
+
+		go h.runChat(flight, req, reqID)
+	} else {
+		slog.Info("Duplicate agent chat request attached to existing stream",
+			"user_id", user.UserID,
+			"session_id", sessionID,
+		)
+	}
 
 	// Stream response via SSE.
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		http.Error(w, `{"error": "streaming not supported"}`, http.StatusInternalServerError)
-		return
+	if err := flight.stream(r.Context(), w, flusher); err != nil && !errors.Is(err, context.Canceled) {
+		slog.Warn("failed to write SSE chat event", "error", err)
 	}
+}
+
+// runChat produces the chat response for req into flight. It runs detached
+// from any one request so duplicates can share it; the flight's context is
+// cancelled once every attached request has gone.
+func (h *Handler) runChat(flight *chatFlight, req ChatRequest, reqID string) {
+	defer flight.finish(time.Now())
+
+	req.ContainerState = h.containerState(flight.ctx, req)
 
 	var assistantContent strings.Builder
 	streamChunks := 0
-	partial := false
-	streamErrMsg := ""
 
-	for resp, err := range h.agent.Chat(r.Context(), req) {
+	for resp, err := range h.agent.Chat(flight.ctx, req) {
 		if err != nil {
-			partial = true
-			streamErrMsg = err.Error()
 			slog.Error("Agent stream failed", "error", err)
-			h.logAssistantMessage(req.UserID, req.SessionID, assistantContent.String(), streamChunks, partial, streamErrMsg, reqID)
-			if writeErr := writeSSE(w, "error", err.Error()); writeErr != nil {
-				slog.Warn("failed to write SSE error event", "error", writeErr)
-				return
-			}
-			flusher.Flush()
+			h.logAssistantMessage(req.UserID, req.SessionID, assistantContent.String(), streamChunks, true, err.Error(), reqID)
+			flight.publish("error", err.Error())
 			return
 		}
 
@@ -385,25 +602,51 @@ func (h *Handler) HandleChat(w http.ResponseWriter, r *http.Request) {
 			assistantContent.WriteString(resp.Response)
 		}
 
+		if resp != nil && len(resp.Response) > h.sseMessageLimit() {
+			truncated := *resp
+			truncated.Response = shared.TruncateWithMarker(resp.Response, h.sseMessageLimit())
+			resp = &truncated
+		}
+
 		data, err := json.Marshal(resp)
 		if err != nil {
 			slog.Warn("failed to marshal chat response", "error", err)
-			if writeErr := writeSSE(w, "error", "failed to serialize response"); writeErr != nil {
-				slog.Warn("failed to write SSE serialization error", "error", writeErr)
-			}
-			flusher.Flush()
+			flight.publish("error", "failed to serialize response")
 			return
 		}
-		if err := writeSSE(w, "message", string(data)); err != nil {
-			slog.Warn("failed to write SSE message event", "error", err)
-			partial = true
-			streamErrMsg = err.Error()
-			h.logAssistantMessage(req.UserID, req.SessionID, assistantContent.String(), streamChunks, partial, streamErrMsg, reqID)
-			return
+		flight.publish("message", string(data))
+	}
+	h.logAssistantMessage(req.UserID, req.SessionID, assistantContent.String(), streamChunks, false, "", reqID)
+}
+
+// containerState snapshots the learner's container for a chat, listing the
+// directory of their last command in the tab. It returns nil when no snapshot
+// can be taken; the agent then answers without one.
+func (h *Handler) containerState(ctx context.Context, req ChatRequest) *ContainerStateOutput {
+	if h.stateInspector == nil || req.ContainerID == "" {
+		return nil
+	}
+	var dir string
+	if h.repo != nil {
+		cmds, err := h.repo.ListCommands(ctx, req.UserID, req.SessionID, 1)
+		if err != nil {
+			slog.Warn("Failed to read last command for container state", "user_id", req.UserID, "error", err)
+		} else if len(cmds) > 0 {
+			dir = cmds[0].PWD
 		}
-		flusher.Flush()
 	}
-	h.logAssistantMessage(req.UserID, req.SessionID, assistantContent.String(), streamChunks, partial, streamErrMsg, reqID)
+	snapshot, err := h.stateInspector.InspectState(ctx, req.ContainerID, dir)
+	if err != nil {
+		slog.Warn("Chat without container state", "user_id", req.UserID, "container_id", req.ContainerID, "error", err)
+		return nil
+	}
+	return &ContainerStateOutput{
+		Processes:   snapshot.Processes,
+		DiskUsage:   snapshot.DiskUsage,
+		Environment: snapshot.Environment,
+		Uptime:      snapshot.Uptime,
+		WorkingDir:  snapshot.WorkingDir,
+	}
 }
 
 func (h *Handler) logAssistantMessage(userID, sessionID, content string, streamChunks int, partial bool, streamErrMsg, requestID string) {
@@ -446,11 +689,53 @@ func (h *Handler) Close() {
 	}
 }
 
+// ChatRateLimit reports the user's chat rate-limit state.
+func (h *Handler) ChatRateLimit(userID string) RateLimitStatus {
+	return h.rateLimiter.Status(userID)
+}
+
+// CloseStreams ends every SSE stream, so that a graceful shutdown does not
+// wait for them. Clients reconnect with their Last-Event-ID.
+func (h *Handler) CloseStreams() {
+	h.connectionsMu.Lock()
+	defer h.connectionsMu.Unlock()
+	for _, conns := range h.sseConnections {
+		for _, conn := range conns {
+			conn.doneOnce.Do(func() { close(conn.Done) })
+		}
+	}
+}
+
+// EventStreamState returns the SSE stream epoch and event ID high-water
+// marks for the process replacing this one.
+func (h *Handler) EventStreamState() handoff.EventStreams {
+	return h.eventIDs.handoff()
+}
+
+// ResumeEventStreams continues the SSE event IDs of the process this one
+// replaces, so that reconnecting tabs resume their streams rather than start
+// over. It must be called before the handler serves streams.
+func (h *Handler) ResumeEventStreams(streams handoff.EventStreams) {
+	h.eventIDs.resume(streams)
+}
+
 // GetService returns the underlying agent service.
 func (h *Handler) GetService() *Service {
 	return h.agent
 }
 
+// removeConnection unregisters a stream connection.
+func (h *Handler) removeConnection(streamKey identity.SessionKey, connID int64) {
+	h.connectionsMu.Lock()
+	defer h.connectionsMu.Unlock()
+	if userConns, exists := h.sseConnections[streamKey]; exists {
+		delete(userConns, connID)
+		if len(userConns) == 0 {
+			delete(h.sseConnections, streamKey)
+		}
+	}
+}
+
 // broadcastLoop listens for messages and distributes them to connected clients.
 func (h *Handler) broadcastLoop(broadcastChan chan *Response) {
 	slog.Info("[BROADCAST] Broadcast loop started")
@@ -470,11 +755,15 @@ func (h *Handler) broadcastLoop(broadcastChan chan *Response) {
 			}
 
 			slog.Info("[BROADCAST] Received message",
+				"target", resp.target(),
 				"user_id", resp.UserID,
 				"type", resp.Type,
 				"silent", resp.Silent,
 				"content_len", len(resp.Content),
 			)
+			if resp.Type == string(ResponseTypeMessagesDropped) {
+				h.drops.sidebar.Add(int64(resp.Dropped))
+			}
 			raw := resp.Sidebar
 			if raw == "" {
 				raw = resp.Content
@@ -496,77 +785,265 @@ func (h *Handler) broadcastLoop(broadcastChan chan *Response) {
 					"alert":           resp.Alert,
 					"pattern":         resp.Pattern,
 					"tools_used":      resp.ToolsUsed,
+					"target":          resp.target(),
+					"classroom":       resp.Classroom,
 				},
 			})
 
-			h.counterMu.Lock()
-			h.eventCounter++
-			eventID := h.eventCounter
-			h.counterMu.Unlock()
-
-			// Queue message for potential replay
-			h.messageQueue.Enqueue(resp.UserID, resp.SessionID, eventID, resp)
-
-			sessionKey := sseSessionKey(resp.UserID, resp.SessionID)
-			// Send to all connected clients for this user/session (fan-out)
-			h.connectionsMu.RLock()
-			userConns, exists := h.sseConnections[sessionKey]
-			if !exists {
-				h.connectionsMu.RUnlock()
-				slog.Warn("[BROADCAST] No connections found for session", "user_id", resp.UserID, "session_id", resp.SessionID)
-				continue
-			}
+			h.broadcast(resp)
+		}
+	}
+}
 
-			// Snapshot connections to avoid holding RLock during writes
-			conns := make([]*SSEConnection, 0, len(userConns))
-			for _, c := range userConns {
-				conns = append(conns, c)
-			}
-			h.connectionsMu.RUnlock()
+// broadcast writes resp to every connection its target selects and queues it
+// for replay in each receiving tab session. Each session numbers the message
+// in its own event ID sequence.
+func (h *Handler) broadcast(resp *Response) {
+	target := resp.target()
+	conns := h.recipients(resp)
+
+	// Queue message for potential replay. Session-targeted messages are queued
+	// even without a stream connection while the tab's session is open, so a
+	// reconnecting stream still receives them; an ended session's queue would
+	// never be pruned.
+	eventIDs := make(map[identity.SessionKey]int64)
+	queue := func(userID, sessionID string) {
+		key := identity.NewSessionKey(userID, sessionID)
+		if _, ok := eventIDs[key]; ok {
+			return
+		}
+		eventIDs[key] = h.eventIDs.next(key)
+		h.messageQueue.Enqueue(userID, sessionID, eventIDs[key], resp)
+	}
+	if target == TargetSession && h.sessions.Active(resp.UserID, resp.SessionID) {
+		queue(resp.UserID, resp.SessionID)
+	}
+	for _, conn := range conns {
+		queue(conn.UserID, conn.SessionID)
+	}
 
-			for _, conn := range conns {
-				h.sendToConnection(conn, eventID, resp)
-			}
+	delivered, dropped := 0, 0
+	for _, conn := range conns {
+		eventID := eventIDs[identity.NewSessionKey(conn.UserID, conn.SessionID)]
+		if h.sendToConnection(conn, eventID, resp) {
+			delivered++
+		} else {
+			dropped++
 		}
 	}
+	h.recordDelivery(target, delivered, dropped)
+
+	if delivered == 0 {
+		slog.Warn("[BROADCAST] No connections found for target",
+			"target", target,
+			"user_id", resp.UserID,
+			"session_id", resp.SessionID,
+			"classroom", resp.Classroom)
+		go h.persistNotification(resp)
+		return
+	}
+	slog.Debug("[BROADCAST] Delivered message", "target", target, "sessions", len(eventIDs), "connections", delivered)
 }
 
-// sendToConnection sends a message to a specific connection.
-func (h *Handler) sendToConnection(conn *SSEConnection, eventID int64, resp *Response) {
-	conn.mu.Lock()
-	defer conn.mu.Unlock()
+// persistNotification stores a response addressed to an offline user in the
+// notification center, which outlives the in-memory replay queue.
+func (h *Handler) persistNotification(resp *Response) {
+	target := resp.target()
+	if h.repo == nil || resp.Silent || resp.UserID == "" || (target != TargetSession && target != TargetUser) {
+		return
+	}
+	// Desktop notifications only matter while a tab is open.
+	if ResponseType(resp.Type).IsDesktopNotification() {
+		return
+	}
+	body := resp.Sidebar
+	if body == "" {
+		body = resp.Content
+	}
+	if body == "" {
+		return
+	}
 
+	n := &domain.Notification{
+		UserID: resp.UserID,
+		Kind:   domain.NotificationProactiveHint,
+		Body:   shared.TruncateWithMarker(body, h.sseMessageLimit()),
+	}
+	if responseEvent(resp, h.sseMessageLimit()).EventType() == events.TypeAlert {
+		n.Kind = domain.NotificationAlert
+		n.Title = resp.Alert
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.repo.CreateNotification(ctx, n); err != nil {
+		slog.Warn("[BROADCAST] Failed to persist notification", "error", err, "user_id", resp.UserID)
+	}
+}
+
+// recipients snapshots the connections selected by resp's target, so writes
+// happen without holding connectionsMu.
+func (h *Handler) recipients(resp *Response) []*SSEConnection {
+	h.connectionsMu.RLock()
+	defer h.connectionsMu.RUnlock()
+
+	var conns []*SSEConnection
+	target := resp.target()
+	if target == TargetSession {
+		for _, c := range h.sseConnections[identity.NewSessionKey(resp.UserID, resp.SessionID)] {
+			conns = append(conns, c)
+		}
+		return conns
+	}
+
+	for _, sessionConns := range h.sseConnections {
+		for _, c := range sessionConns {
+			switch {
+			case target == TargetAll,
+				target == TargetUser && c.UserID == resp.UserID,
+				target == TargetClassroom && resp.Classroom != "" && c.Classroom == resp.Classroom:
+				conns = append(conns, c)
+			}
+		}
+	}
+	return conns
+}
+
+// sendToConnection queues a message on a connection's send buffer without
+// blocking and reports whether it was accepted. When the buffer is full the
+// message is dropped for that connection; it stays in the replay queue, so the
+// client recovers it on reconnect.
+func (h *Handler) sendToConnection(conn *SSEConnection, eventID int64, resp *Response) bool {
 	select {
 	case <-conn.Done:
-		return // Connection closed
+		return false // Connection closed
 	default:
 	}
 
-	data, err := json.Marshal(map[string]interface{}{
-		"type":    resp.Type,
-		"content": resp.Content,
-		"sidebar": resp.Sidebar,
-		"alert":   resp.Alert,
-		"pattern": resp.Pattern,
-	})
-	if err != nil {
-		slog.Error("[SEND] Failed to marshal SSE message", "error", err, "conn_id", conn.ID)
-		return
-	}
-
-	// Write with event ID for replay capability
-	_, err = fmt.Fprintf(conn.Writer, "id: %d\nevent: message\ndata: %s\n\n", eventID, string(data))
-	if err != nil {
-		slog.Error("[SEND] Failed to write to SSE connection",
-			"error", err,
+	select {
+	case conn.send <- sseFrame{eventID: eventID, resp: resp}:
+		return true
+	default:
+		dropped := conn.dropped.Add(1)
+		h.drops.connection.Add(1)
+		slog.Warn("[SEND] SSE send buffer full, dropping message",
 			"conn_id", conn.ID,
 			"user_id", conn.UserID,
+			"event_id", eventID,
+			"dropped", dropped,
 		)
-		return
+		return false
 	}
+}
+
+// reportDrops tells the client how many messages were dropped from conn's
+// send buffer since the last report, so it can show the gap. The marker
+// carries no event ID, leaving the client's replay position unchanged. It
+// must only be called from the goroutine serving the connection.
+func (h *Handler) reportDrops(conn *SSEConnection) error {
+	dropped := conn.dropped.Load()
+	if dropped == conn.reported {
+		return nil
+	}
+	marker := &events.MessagesDropped{Count: int(dropped - conn.reported), Source: events.DropSourceConnection}
+	if err := h.writeEvent(conn, func(w io.Writer) error { return events.Write(w, 0, marker) }); err != nil {
+		return err
+	}
+	conn.reported = dropped
+	return nil
+}
 
+// dropReportLoop logs the number of messages dropped in each interval, if
+// any, until the handler is closed.
+func (h *Handler) dropReportLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+			sidebar := h.drops.sidebar.Swap(0)
+			connection := h.drops.connection.Swap(0)
+			if sidebar == 0 && connection == 0 {
+				continue
+			}
+			slog.Warn("[BROADCAST] Messages dropped",
+				"interval", interval,
+				"sidebar", sidebar,
+				"connection", connection,
+			)
+		}
+	}
+}
+
+// writeFrame writes a queued message to conn, split into parts if its text
+// is long. It must only be called from the goroutine serving the connection.
+func (h *Handler) writeFrame(conn *SSEConnection, frame sseFrame) error {
+	payload := responseEvent(frame.resp, h.sseMessageLimit())
+	parts := chunkEvent(payload, h.sseChunkSize(), strconv.FormatInt(frame.eventID, 10))
+	for i, part := range parts {
+		// Only the last part carries the event ID, so a client that reconnects
+		// mid-message has the whole message replayed.
+		var id int64
+		if i == len(parts)-1 {
+			id = frame.eventID
+		}
+		if err := h.writeEvent(conn, func(w io.Writer) error {
+			return events.Write(w, id, part)
+		}); err != nil {
+			return err
+		}
+	}
+	conn.EventID = frame.eventID
+	return nil
+}
+
+// writeEvent runs write against conn within the write timeout and flushes it,
+// so a client that stops reading fails the write instead of blocking forever.
+func (h *Handler) writeEvent(conn *SSEConnection, write func(io.Writer) error) error {
+	rc := http.NewResponseController(conn.Writer)
+	if err := rc.SetWriteDeadline(time.Now().Add(h.sseWriteTimeout())); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if err := write(conn.Writer); err != nil {
+		return err
+	}
 	conn.Flusher.Flush()
-	conn.EventID = eventID
+	return nil
+}
+
+// sseMessageLimit returns the maximum size of a text field in an SSE event.
+func (h *Handler) sseMessageLimit() int {
+	if h.cfg != nil && h.cfg.SSE.MaxMessageSize > 0 {
+		return h.cfg.SSE.MaxMessageSize
+	}
+	return defaultSSEMaxMessageSize
+}
+
+// sseChunkSize returns the size above which text fields are split across
+// events, or 0 if chunking is disabled.
+func (h *Handler) sseChunkSize() int {
+	if h.cfg != nil {
+		return max(h.cfg.SSE.ChunkSize, 0)
+	}
+	return defaultSSEChunkSize
+}
+
+// sseSendBufferSize returns the number of events buffered per connection.
+func (h *Handler) sseSendBufferSize() int {
+	if h.cfg != nil && h.cfg.SSE.SendBufferSize > 0 {
+		return h.cfg.SSE.SendBufferSize
+	}
+	return defaultSSESendBufferSize
+}
+
+// sseWriteTimeout returns the deadline for writing one event to a client.
+func (h *Handler) sseWriteTimeout() time.Duration {
+	if h.cfg != nil && h.cfg.SSE.WriteTimeout > 0 {
+		return h.cfg.SSE.WriteTimeout
+	}
+	return defaultSSEWriteTimeout
 }
 
 // HandleStream handles SSE stream for proactive agent messages from terminal monitoring.
@@ -580,7 +1057,7 @@ func (h *Handler) sendToConnection(conn *SSEConnection, eventID int64, resp *Res
 func (h *Handler) HandleStream(w http.ResponseWriter, r *http.Request) {
 	userID := identity.UserIDFromContext(r.Context())
 	sessionID := identity.SessionIDFromContext(r.Context())
-	streamKey := sseSessionKey(userID, sessionID)
+	streamKey := identity.NewSessionKey(userID, sessionID)
 	if userID == "" {
 		http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
 		return
@@ -614,6 +1091,15 @@ func (h *Handler) HandleStream(w http.ResponseWriter, r *http.Request) {
 			)
 		}
 	}
+	// An ID from another stream epoch may not belong to this sequence.
+	if epoch := r.URL.Query().Get("epoch"); lastEventID > 0 && epoch != "" && epoch != h.eventIDs.epoch {
+		slog.Info("SSE client reconnecting from a previous stream epoch",
+			"user_id", user.UserID,
+			"client_epoch", epoch,
+			"epoch", h.eventIDs.epoch,
+		)
+		lastEventID = 0
+	}
 
 	// Set SSE headers
 	w.Header().Set("Content-Type", "text/event-stream")
@@ -643,18 +1129,30 @@ func (h *Handler) HandleStream(w http.ResponseWriter, r *http.Request) {
 	connID := h.connectionID
 	h.counterMu.Unlock()
 
+	classroom := ""
+	if h.classrooms != nil {
+		classroom = h.classrooms.ClassroomOf(r.Context(), user.UserID)
+	}
+
 	conn := &SSEConnection{
 		ID:          connID,
 		UserID:      user.UserID,
 		SessionID:   sessionID,
+		Classroom:   classroom,
 		ConnectedAt: time.Now(),
 		LastEventID: lastEventID,
 		Writer:      w,
 		Flusher:     flusher,
 		Done:        make(chan struct{}),
+		send:        make(chan sseFrame, h.sseSendBufferSize()),
 	}
 
-	// Register connection
+	// Register connection. Connection state is released by the hold's single
+	// Close; the replay queue outlives it until the tab's last terminal or
+	// stream closes.
+	hold := h.sessions.Acquire(user.UserID, sessionID)
+	defer hold.Close()
+
 	h.connectionsMu.Lock()
 	if _, exists := h.sseConnections[streamKey]; !exists {
 		h.sseConnections[streamKey] = make(map[int64]*SSEConnection)
@@ -662,20 +1160,19 @@ func (h *Handler) HandleStream(w http.ResponseWriter, r *http.Request) {
 	h.sseConnections[streamKey][connID] = conn
 	h.connectionsMu.Unlock()
 
-	defer func() {
-		h.connectionsMu.Lock()
-		if userConns, exists := h.sseConnections[streamKey]; exists {
-			delete(userConns, connID)
-			if len(userConns) == 0 {
-				delete(h.sseConnections, streamKey)
-			}
-		}
-		h.connectionsMu.Unlock()
-		// Prune the per-session message queue when the last connection for this
-		// session closes, freeing memory promptly.
+	hold.OnSessionEnd("sse_replay", func() {
 		h.messageQueue.Prune(user.UserID, sessionID)
-		slog.Info("SSE connection closed", "user_id", user.UserID, "session_id", sessionID, "conn_id", connID)
-	}()
+		h.eventIDs.forget(streamKey)
+	})
+	hold.Defer(func() {
+		h.removeConnection(streamKey, connID)
+		slog.Info("SSE connection closed",
+			"user_id", user.UserID,
+			"session_id", sessionID,
+			"conn_id", connID,
+			"dropped", conn.dropped.Load(),
+		)
+	})
 
 	// Send missed messages if reconnecting
 	if lastEventID > 0 {
@@ -687,25 +1184,22 @@ func (h *Handler) HandleStream(w http.ResponseWriter, r *http.Request) {
 				"count", len(missed),
 			)
 			for _, msg := range missed {
-				h.sendToConnection(conn, msg.EventID, msg.Response)
+				if err := h.writeFrame(conn, sseFrame{eventID: msg.EventID, resp: msg.Response}); err != nil {
+					slog.Warn("failed to replay missed SSE message", "error", err, "user_id", user.UserID)
+					return
+				}
 			}
 		}
 	}
 
 	// Send initial connection event
-	h.counterMu.Lock()
-	h.eventCounter++
-	eventID := h.eventCounter
-	h.counterMu.Unlock()
-
+	eventID := h.eventIDs.next(streamKey)
 	conn.EventID = eventID
-	connectedData := fmt.Sprintf(`{"status":"connected","user_id":"%s","event_id":%d}`,
-		user.UserID, eventID)
-	if err := writeSSEWithID(w, eventID, "connected", connectedData); err != nil {
+	connected := &events.System{Status: "connected", UserID: user.UserID, EventID: eventID, Epoch: h.eventIDs.epoch}
+	if err := h.writeEvent(conn, func(w io.Writer) error { return events.Write(w, eventID, connected) }); err != nil {
 		slog.Warn("failed to write SSE connected event", "error", err, "user_id", user.UserID)
 		return
 	}
-	flusher.Flush()
 
 	slog.Info("SSE connection established",
 		"user_id", user.UserID,
@@ -730,15 +1224,20 @@ func (h *Handler) HandleStream(w http.ResponseWriter, r *http.Request) {
 		case <-conn.Done:
 			slog.Info("SSE connection done signal", "user_id", user.UserID, "session_id", sessionID)
 			return
+		case frame := <-conn.send:
+			if err := h.reportDrops(conn); err != nil {
+				slog.Warn("failed to write SSE drop marker", "error", err, "user_id", user.UserID, "conn_id", connID)
+				return
+			}
+			if err := h.writeFrame(conn, frame); err != nil {
+				slog.Warn("failed to write SSE message", "error", err, "user_id", user.UserID, "conn_id", connID)
+				return
+			}
 		case <-keepalive.C:
-			conn.mu.Lock()
-			if err := writeSSE(w, "ping", `{"status":"alive"}`); err != nil {
-				conn.mu.Unlock()
+			if err := h.writeEvent(conn, func(w io.Writer) error { return writeSSE(w, "ping", `{"status":"alive"}`) }); err != nil {
 				slog.Warn("failed to write SSE keepalive ping", "error", err, "user_id", user.UserID)
 				return
 			}
-			flusher.Flush()
-			conn.mu.Unlock()
 		}
 	}
 }
@@ -748,7 +1247,134 @@ func writeSSE(w io.Writer, event, data string) error {
 	return err
 }
 
-func writeSSEWithID(w io.Writer, id int64, event, data string) error {
-	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event, data)
-	return err
+// responseEvent converts an agent response into its typed SSE payload,
+// truncating text fields to limit bytes and post-processing the Markdown.
+func responseEvent(resp *Response, limit int) events.Payload {
+	if resp.Type == string(ResponseTypeMessagesDropped) {
+		return &events.MessagesDropped{Count: resp.Dropped, Source: events.DropSourceSidebar}
+	}
+	if t := ResponseType(resp.Type); t.IsDesktopNotification() {
+		return &events.DesktopNotify{
+			Reason: resp.Type,
+			Title:  desktopNotifyTitles[t],
+			Body:   shared.TruncateWithMarker(resp.Content, limit),
+		}
+	}
+
+	content := shared.TruncateWithMarker(resp.Content, limit)
+	sidebar := shared.TruncateWithMarker(resp.Sidebar, limit)
+	truncated := len(content) < len(resp.Content) || len(sidebar) < len(resp.Sidebar)
+	// Post-process after truncating, which may cut a code block in two.
+	content, blocks := postProcessContent(content)
+	if sidebar != "" {
+		sidebar, blocks = postProcessContent(sidebar)
+	}
+	if resp.Type == string(ResponseTypeAlert) || strings.HasPrefix(resp.Type, "safety-") || resp.Alert != "" {
+		alert := shared.TruncateWithMarker(resp.Alert, limit)
+		return &events.Alert{
+			Kind:           resp.Type,
+			Content:        content,
+			Sidebar:        sidebar,
+			Alert:          alert,
+			Pattern:        resp.Pattern,
+			RequireConfirm: resp.RequireConfirm,
+			Truncated:      truncated || len(alert) < len(resp.Alert),
+			CodeBlocks:     blocks,
+		}
+	}
+	return &events.ProactiveHint{
+		Kind:       resp.Type,
+		Content:    content,
+		Sidebar:    sidebar,
+		Pattern:    resp.Pattern,
+		Truncated:  truncated,
+		CodeBlocks: blocks,
+	}
+}
+
+// desktopNotifyTitles are the notification titles per response type.
+var desktopNotifyTitles = map[ResponseType]string{
+	ResponseTypeBell:            "Terminal bell",
+	ResponseTypeCommandFinished: "Command finished",
+}
+
+// chunkEvent splits a hint or alert whose content or sidebar exceeds size
+// bytes into ordered parts identified by id. Other payloads, and payloads
+// within size, are returned as the only part.
+func chunkEvent(p events.Payload, size int, id string) []events.Payload {
+	if size <= 0 {
+		return []events.Payload{p}
+	}
+	switch p := p.(type) {
+	case *events.ProactiveHint:
+		contents, sidebars, count := splitTextFields(p.Content, p.Sidebar, size)
+		if count == 1 {
+			return []events.Payload{p}
+		}
+		parts := make([]events.Payload, count)
+		for i := range count {
+			part := *p
+			part.Content, part.Sidebar = contents[i], sidebars[i]
+			part.Chunk = &events.Chunk{ID: id, Index: i, Count: count}
+			if i < count-1 {
+				part.CodeBlocks = nil
+			}
+			parts[i] = &part
+		}
+		return parts
+	case *events.Alert:
+		contents, sidebars, count := splitTextFields(p.Content, p.Sidebar, size)
+		if count == 1 {
+			return []events.Payload{p}
+		}
+		parts := make([]events.Payload, count)
+		for i := range count {
+			part := *p
+			part.Content, part.Sidebar = contents[i], sidebars[i]
+			part.Chunk = &events.Chunk{ID: id, Index: i, Count: count}
+			if i < count-1 {
+				part.CodeBlocks = nil
+			}
+			parts[i] = &part
+		}
+		return parts
+	default:
+		return []events.Payload{p}
+	}
+}
+
+// splitTextFields splits content and sidebar into pieces of at most size
+// bytes and pads the shorter list with empty pieces so both have count.
+func splitTextFields(content, sidebar string, size int) (contents, sidebars []string, count int) {
+	contents = splitText(content, size)
+	sidebars = splitText(sidebar, size)
+	count = max(len(contents), len(sidebars))
+	for len(contents) < count {
+		contents = append(contents, "")
+	}
+	for len(sidebars) < count {
+		sidebars = append(sidebars, "")
+	}
+	return contents, sidebars, count
+}
+
+// splitText cuts s into pieces of at most size bytes without splitting a
+// UTF-8 sequence. An empty s yields one empty piece.
+func splitText(s string, size int) []string {
+	if len(s) <= size {
+		return []string{s}
+	}
+	var pieces []string
+	for len(s) > size {
+		cut := size
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		if cut == 0 {
+			cut = size // size is smaller than one rune; keep the bytes flowing
+		}
+		pieces = append(pieces, s[:cut])
+		s = s[cut:]
+	}
+	return append(pieces, s)
 }
@@ -0,0 +1,393 @@
+package agent
+
+import (
+	"errors"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ashureev/shsh-labs/internal/events"
+	"github.com/ashureev/shsh-labs/internal/identity"
+)
+
+func TestResponseEventTypes(t *testing.T) {
+	tests := []struct {
+		name string
+		resp *Response
+		want events.Type
+	}{
+		{name: "pattern hint", resp: &Response{Type: "pattern", Content: "try ls"}, want: events.TypeProactiveHint},
+		{name: "recap", resp: &Response{Type: string(ResponseTypeRecap), Content: "while away"}, want: events.TypeProactiveHint},
+		{name: "alert", resp: &Response{Type: string(ResponseTypeAlert), Alert: "careful"}, want: events.TypeAlert},
+		{name: "safety tier", resp: &Response{Type: "safety-tier2", Content: "rm -rf", RequireConfirm: true}, want: events.TypeAlert},
+		{name: "bell", resp: &Response{Type: string(ResponseTypeBell), Content: "ding"}, want: events.TypeDesktopNotify},
+		{name: "command finished", resp: &Response{Type: string(ResponseTypeCommandFinished), Content: "make"}, want: events.TypeDesktopNotify},
+		{name: "messages dropped", resp: &Response{Type: string(ResponseTypeMessagesDropped), Dropped: 2}, want: events.TypeMessagesDropped},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := responseEvent(tt.resp, 1024).EventType(); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResponseEventTruncatesText(t *testing.T) {
+	resp := &Response{Type: "llm", Content: strings.Repeat("a", 100)}
+	hint, ok := responseEvent(resp, 10).(*events.ProactiveHint)
+	if !ok {
+		t.Fatal("expected proactive hint")
+	}
+	if len(hint.Content) >= 100 {
+		t.Fatalf("expected truncated content, got %d bytes", len(hint.Content))
+	}
+	if !hint.Truncated {
+		t.Fatal("expected truncated flag")
+	}
+	if short := responseEvent(&Response{Type: "llm", Content: "ok"}, 10).(*events.ProactiveHint); short.Truncated {
+		t.Fatal("short content flagged as truncated")
+	}
+}
+
+func TestChunkEventSplitsAtRuneBoundaries(t *testing.T) {
+	content := strings.Repeat("é", 10) // 20 bytes
+	hint := &events.ProactiveHint{Kind: "llm", Content: content, Sidebar: "side"}
+	parts := chunkEvent(hint, 7, "42")
+	if len(parts) != 4 {
+		t.Fatalf("expected 4 parts, got %d", len(parts))
+	}
+
+	var gotContent, gotSidebar strings.Builder
+	for i, p := range parts {
+		part := p.(*events.ProactiveHint)
+		if part.Chunk == nil || part.Chunk.ID != "42" || part.Chunk.Index != i || part.Chunk.Count != 4 {
+			t.Fatalf("part %d: unexpected chunk %+v", i, part.Chunk)
+		}
+		if !utf8.ValidString(part.Content) {
+			t.Fatalf("part %d: invalid UTF-8 %q", i, part.Content)
+		}
+		gotContent.WriteString(part.Content)
+		gotSidebar.WriteString(part.Sidebar)
+	}
+	if gotContent.String() != content || gotSidebar.String() != "side" {
+		t.Fatalf("reassembled %q / %q", gotContent.String(), gotSidebar.String())
+	}
+
+	if parts := chunkEvent(hint, 0, "42"); len(parts) != 1 || parts[0] != hint {
+		t.Fatal("chunk size 0 should disable chunking")
+	}
+}
+
+func TestWriteFrameSendsEventIDOnLastChunk(t *testing.T) {
+	h := newHandlerWithService(nil, nil, make(chan *Response))
+	rr := addTestConnection(h, 1, "user-1", "tab-1", "")
+	conn := h.sseConnections[identity.NewSessionKey("user-1", "tab-1")][1]
+
+	resp := &Response{Type: "llm", Content: strings.Repeat("a", defaultSSEChunkSize+1)}
+	if err := h.writeFrame(conn, sseFrame{eventID: 7, resp: resp}); err != nil {
+		t.Fatalf("write frame: %v", err)
+	}
+	body := rr.Body.String()
+	if n := strings.Count(body, "event: proactive_hint"); n != 2 {
+		t.Fatalf("expected 2 parts, got %d", n)
+	}
+	if strings.Count(body, "id: ") != 1 || !strings.HasSuffix(strings.TrimSpace(body[:strings.LastIndex(body, "event:")]), "id: 7") {
+		t.Fatalf("expected only the last part to carry the event ID:\n%s", body)
+	}
+	if conn.EventID != 7 {
+		t.Fatalf("connection event ID = %d, want 7", conn.EventID)
+	}
+}
+
+func addTestConnection(h *Handler, id int64, userID, sessionID, classroom string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	key := identity.NewSessionKey(userID, sessionID)
+	h.connectionsMu.Lock()
+	defer h.connectionsMu.Unlock()
+	if h.sseConnections[key] == nil {
+		h.sseConnections[key] = make(map[int64]*SSEConnection)
+	}
+	h.sseConnections[key][id] = &SSEConnection{
+		ID:        id,
+		UserID:    userID,
+		SessionID: sessionID,
+		Classroom: classroom,
+		Writer:    rr,
+		Flusher:   rr,
+		Done:      make(chan struct{}),
+		send:      make(chan sseFrame, defaultSSESendBufferSize),
+	}
+	return rr
+}
+
+// flushTestConnections writes every buffered message, standing in for the
+// goroutines that serve each stream.
+func flushTestConnections(t *testing.T, h *Handler) {
+	t.Helper()
+	h.connectionsMu.RLock()
+	defer h.connectionsMu.RUnlock()
+	for _, sessionConns := range h.sseConnections {
+		for _, conn := range sessionConns {
+			for len(conn.send) > 0 {
+				if err := h.writeFrame(conn, <-conn.send); err != nil {
+					t.Fatalf("write frame: %v", err)
+				}
+			}
+		}
+	}
+}
+
+func TestBroadcastTargets(t *testing.T) {
+	h := newHandlerWithService(nil, nil, make(chan *Response))
+	defer close(h.done)
+
+	aliceTab1 := addTestConnection(h, 1, "alice", "tab-1", "class-a")
+	aliceTab2 := addTestConnection(h, 2, "alice", "tab-2", "class-a")
+	bob := addTestConnection(h, 3, "bob", "tab-1", "class-a")
+	carol := addTestConnection(h, 4, "carol", "tab-1", "class-b")
+	all := []*httptest.ResponseRecorder{aliceTab1, aliceTab2, bob, carol}
+
+	tests := []struct {
+		name string
+		resp *Response
+		want []*httptest.ResponseRecorder
+	}{
+		{name: "session", resp: &Response{UserID: "alice", SessionID: "tab-1"}, want: []*httptest.ResponseRecorder{aliceTab1}},
+		{name: "user", resp: &Response{UserID: "alice", Target: TargetUser}, want: []*httptest.ResponseRecorder{aliceTab1, aliceTab2}},
+		{name: "classroom", resp: &Response{Classroom: "class-a", Target: TargetClassroom}, want: []*httptest.ResponseRecorder{aliceTab1, aliceTab2, bob}},
+		{name: "all", resp: &Response{Target: TargetAll}, want: all},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, rr := range all {
+				rr.Body.Reset()
+			}
+			tt.resp.Type = "llm"
+			tt.resp.Content = "hello " + tt.name
+			h.broadcast(tt.resp)
+			flushTestConnections(t, h)
+
+			for i, rr := range all {
+				got := strings.Contains(rr.Body.String(), "hello "+tt.name)
+				want := slices.Contains(tt.want, rr)
+				if got != want {
+					t.Errorf("connection %d: delivered=%v, want %v", i+1, got, want)
+				}
+			}
+		})
+	}
+
+	h.broadcast(&Response{Target: TargetClassroom, Classroom: "empty", Content: "nobody"})
+	stats := h.DeliveryStats()
+	if s := stats[TargetUser]; s.Messages != 1 || s.Deliveries != 2 {
+		t.Fatalf("unexpected user stats: %+v", s)
+	}
+	if s := stats[TargetClassroom]; s.Messages != 2 || s.Deliveries != 3 || s.Undelivered != 1 {
+		t.Fatalf("unexpected classroom stats: %+v", s)
+	}
+	if missed := h.messageQueue.GetMissedMessages("alice", "tab-2", 0); len(missed) != 3 {
+		t.Fatalf("expected 3 replayable messages for alice tab-2, got %d", len(missed))
+	}
+}
+
+func TestAnnounce(t *testing.T) {
+	h := newHandlerWithService(nil, nil, make(chan *Response, 1))
+	defer close(h.done)
+
+	classA := addTestConnection(h, 1, "alice", "tab-1", "class-a")
+	classB := addTestConnection(h, 2, "bob", "tab-1", "class-b")
+
+	waitForMessages := func(target Target, want int64) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for h.DeliveryStats()[target].Messages < want {
+			if time.Now().After(deadline) {
+				t.Fatalf("announcement to %s was not broadcast", target)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		flushTestConnections(t, h)
+	}
+
+	if err := h.Announce("class-a", "quiz at noon"); err != nil {
+		t.Fatalf("Announce: %v", err)
+	}
+	waitForMessages(TargetClassroom, 1)
+	if !strings.Contains(classA.Body.String(), "quiz at noon") || strings.Contains(classB.Body.String(), "quiz at noon") {
+		t.Fatalf("classroom announcement reached the wrong connections: %q, %q", classA.Body.String(), classB.Body.String())
+	}
+
+	if err := h.Announce("", "lab closes soon"); err != nil {
+		t.Fatalf("Announce: %v", err)
+	}
+	waitForMessages(TargetAll, 1)
+	for _, rr := range []*httptest.ResponseRecorder{classA, classB} {
+		if !strings.Contains(rr.Body.String(), "lab closes soon") {
+			t.Fatalf("announcement to everyone missing: %q", rr.Body.String())
+		}
+	}
+}
+
+func TestAnnounceFailsWhenBroadcastChannelFull(t *testing.T) {
+	h := &Handler{broadcastChan: make(chan *Response, 1)}
+	h.broadcastChan <- &Response{}
+	if err := h.Announce("", "hello"); !errors.Is(err, errBroadcastFull) {
+		t.Fatalf("Announce on a full channel = %v, want errBroadcastFull", err)
+	}
+}
+
+func TestBroadcastDropsWhenSendBufferFull(t *testing.T) {
+	h := newHandlerWithService(nil, nil, make(chan *Response))
+	defer close(h.done)
+	rr := addTestConnection(h, 1, "alice", "tab-1", "")
+	key := identity.NewSessionKey("alice", "tab-1")
+	h.sseConnections[key][1].send = make(chan sseFrame, 1)
+
+	h.broadcast(&Response{UserID: "alice", SessionID: "tab-1", Type: "llm", Content: "first"})
+	h.broadcast(&Response{UserID: "alice", SessionID: "tab-1", Type: "llm", Content: "second"})
+	flushTestConnections(t, h)
+
+	body := rr.Body.String()
+	if !strings.Contains(body, "first") || strings.Contains(body, "second") {
+		t.Fatalf("expected only the buffered message to be written, got %q", body)
+	}
+	if s := h.DeliveryStats()[TargetSession]; s.Deliveries != 1 || s.Dropped != 1 {
+		t.Fatalf("unexpected session stats: %+v", s)
+	}
+	if got := h.sseConnections[key][1].dropped.Load(); got != 1 {
+		t.Fatalf("expected 1 dropped message on the connection, got %d", got)
+	}
+	if missed := h.messageQueue.GetMissedMessages("alice", "tab-1", 0); len(missed) != 2 {
+		t.Fatalf("expected dropped message to remain replayable, got %d", len(missed))
+	}
+}
+
+func TestReportDropsMarksGapBeforeNextFrame(t *testing.T) {
+	h := newHandlerWithService(nil, nil, make(chan *Response))
+	defer close(h.done)
+	rr := addTestConnection(h, 1, "alice", "tab-1", "")
+	conn := h.sseConnections[identity.NewSessionKey("alice", "tab-1")][1]
+	conn.send = make(chan sseFrame, 1)
+
+	for _, content := range []string{"first", "second", "third"} {
+		h.broadcast(&Response{UserID: "alice", SessionID: "tab-1", Type: "llm", Content: content})
+	}
+	if err := h.reportDrops(conn); err != nil {
+		t.Fatalf("report drops: %v", err)
+	}
+	if err := h.reportDrops(conn); err != nil {
+		t.Fatalf("report drops: %v", err)
+	}
+
+	body := rr.Body.String()
+	if n := strings.Count(body, "event: messages_dropped"); n != 1 {
+		t.Fatalf("expected 1 drop marker, got %d:\n%s", n, body)
+	}
+	if !strings.Contains(body, `"count":2`) || !strings.Contains(body, `"source":"connection"`) || strings.Contains(body, "id: ") {
+		t.Fatalf("unexpected drop marker:\n%s", body)
+	}
+	if got := h.drops.connection.Load(); got != 2 {
+		t.Fatalf("expected 2 connection drops counted, got %d", got)
+	}
+}
+
+func TestRateLimiterStatus(t *testing.T) {
+	rl := &RateLimiter{requests: make(map[string][]time.Time), limit: 3, window: time.Minute}
+	if s := rl.Status("u"); s.Remaining != 3 || !s.ResetAt.IsZero() {
+		t.Fatalf("expected full quota, got %+v", s)
+	}
+
+	rl.Allow("u")
+	rl.Allow("u")
+	s := rl.Status("u")
+	if s.Limit != 3 || s.Remaining != 1 || s.ResetAt.IsZero() {
+		t.Fatalf("expected one remaining with reset time, got %+v", s)
+	}
+	if rl.Status("u").Remaining != 1 {
+		t.Fatal("status must not count as a request")
+	}
+}
+
+func TestChatFlightsShareIdenticalMessages(t *testing.T) {
+	flights := newChatFlights(time.Second)
+	now := time.Now()
+	key := chatFlightKey("u", "s", "hello")
+
+	first, started := flights.join(t.Context(), key, now)
+	if !started {
+		t.Fatal("expected first request to start a flight")
+	}
+	second, started := flights.join(t.Context(), key, now)
+	if started || second != first {
+		t.Fatal("expected identical request to attach to the running flight")
+	}
+	if _, started := flights.join(t.Context(), chatFlightKey("u", "other", "hello"), now); !started {
+		t.Fatal("expected another session to start its own flight")
+	}
+
+	first.publish("message", `{"response":"hi"}`)
+	first.finish(now)
+
+	// A late duplicate replays the whole stream.
+	late, started := flights.join(t.Context(), key, now.Add(500*time.Millisecond))
+	if started || late != first {
+		t.Fatal("expected duplicate within the window to replay the finished flight")
+	}
+	rr := httptest.NewRecorder()
+	if err := late.stream(t.Context(), rr, rr); err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if want := "event: message\ndata: {\"response\":\"hi\"}\n\n"; rr.Body.String() != want {
+		t.Fatalf("got %q, want %q", rr.Body.String(), want)
+	}
+
+	if _, started := flights.join(t.Context(), key, now.Add(2*time.Second)); !started {
+		t.Fatal("expected a new flight after the window")
+	}
+}
+
+func TestChatFlightCancelledWhenAbandoned(t *testing.T) {
+	flights := newChatFlights(time.Second)
+	key := chatFlightKey("u", "s", "hello")
+
+	flight, _ := flights.join(t.Context(), key, time.Now())
+	flights.join(t.Context(), key, time.Now())
+
+	flights.leave(flight)
+	if flight.ctx.Err() != nil {
+		t.Fatal("flight cancelled while a request is still attached")
+	}
+	flights.leave(flight)
+	if flight.ctx.Err() == nil {
+		t.Fatal("expected flight to be cancelled once every request left")
+	}
+	if _, started := flights.join(t.Context(), key, time.Now()); !started {
+		t.Fatal("expected a retry to start a fresh flight")
+	}
+}
+
+func TestBroadcastQueuesOnlyForOpenSessions(t *testing.T) {
+	h := newHandlerWithService(nil, nil, make(chan *Response))
+	defer close(h.done)
+
+	hold := h.sessions.Acquire("alice", "tab-1")
+	hold.OnSessionEnd("sse_replay", func() { h.messageQueue.Prune("alice", "tab-1") })
+	h.broadcast(&Response{UserID: "alice", SessionID: "tab-1", Type: "llm", Content: "open"})
+	h.broadcast(&Response{UserID: "alice", SessionID: "tab-2", Type: "llm", Content: "closed"})
+
+	if missed := h.messageQueue.GetMissedMessages("alice", "tab-1", 0); len(missed) != 1 {
+		t.Fatalf("expected 1 replayable message for the open session, got %d", len(missed))
+	}
+	if missed := h.messageQueue.GetMissedMessages("alice", "tab-2", 0); len(missed) != 0 {
+		t.Fatalf("queued %d messages for a session with no connection", len(missed))
+	}
+
+	hold.Close()
+	if missed := h.messageQueue.GetMissedMessages("alice", "tab-1", 0); len(missed) != 0 {
+		t.Fatalf("replay queue survived the end of its session")
+	}
+}
@@ -0,0 +1,97 @@
+package agent
+
+import (
+	"iter"
+	"strings"
+)
+
+// localChatReply answers chat messages while the agent is replaced by
+// local hints.
+const localChatReply = "The AI mentor is unavailable right now, so this message could not be answered. " +
+	"Quick hints for failing commands still appear here; please ask again in a few minutes."
+
+// localHint is a canned hint for a common failure, used while the agent is
+// over its error budget. {program} in the hint names the command's program.
+type localHint struct {
+	name  string
+	match func(input TerminalInput) bool
+	hint  string
+}
+
+// localHints are tried in order; the first match answers.
+var localHints = []localHint{
+	{
+		name: "command_not_found",
+		match: func(input TerminalInput) bool {
+			return input.ExitCode == 127 || strings.Contains(input.Output, "command not found")
+		},
+		hint: "`{program}` was not found. Check the spelling; `type {program}` shows whether the shell knows it, and it may need to be installed first.",
+	},
+	{
+		name: "permission_denied",
+		match: func(input TerminalInput) bool {
+			return input.ExitCode == 126 || strings.Contains(input.Output, "Permission denied")
+		},
+		hint: "Permission was denied. `ls -l` shows who may read, write or run a file, and `chmod` changes it.",
+	},
+	{
+		name: "no_such_file",
+		match: func(input TerminalInput) bool {
+			return strings.Contains(input.Output, "No such file or directory")
+		},
+		hint: "A path does not exist. `pwd` shows where you are and `ls` what is there; paths without a leading `/` start from the current directory.",
+	},
+	{
+		name: "syntax_error",
+		match: func(input TerminalInput) bool {
+			return strings.Contains(input.Output, "syntax error")
+		},
+		hint: "The shell could not parse the command. Look for an unmatched quote or bracket, or a missing `then`, `do` or `fi`.",
+	},
+	{
+		name: "disk_full",
+		match: func(input TerminalInput) bool {
+			return strings.Contains(input.Output, "No space left on device")
+		},
+		hint: "The disk is full. `df -h` shows free space and `du -sh *` what uses it.",
+	},
+	{
+		name: "usage",
+		match: func(input TerminalInput) bool {
+			output := strings.ToLower(input.Output)
+			return strings.Contains(output, "usage:") || strings.Contains(output, "invalid option") ||
+				strings.Contains(output, "unrecognized option")
+		},
+		hint: "`{program}` did not accept its arguments. `{program} --help` or `man {program}` lists the options it takes.",
+	},
+}
+
+// localHintResponses answers a failing command with the first matching local
+// hint, and other commands with nothing.
+func localHintResponses(input TerminalInput) iter.Seq2[*Response, error] {
+	return func(yield func(*Response, error) bool) {
+		if input.ExitCode <= 0 {
+			return
+		}
+		program, _, _ := strings.Cut(strings.TrimSpace(input.Command), " ")
+		for _, h := range localHints {
+			if h.match(input) {
+				yield(&Response{
+					Type:      string(ResponseTypePattern),
+					Content:   strings.ReplaceAll(h.hint, "{program}", program),
+					Pattern:   "local:" + h.name,
+					UserID:    input.UserID,
+					SessionID: input.SessionID,
+				}, nil)
+				return
+			}
+		}
+	}
+}
+
+// localChatResponses answers a chat message with localChatReply.
+func localChatResponses() iter.Seq2[*ChatResponse, error] {
+	return func(yield func(*ChatResponse, error) bool) {
+		yield(&ChatResponse{Response: localChatReply}, nil)
+	}
+}
@@ -7,9 +7,16 @@ import (
 	"time"
 )
 
+// UsageRecorder meters AI calls per user, e.g. for usage-based billing.
+type UsageRecorder interface {
+	RecordAICall(userID string)
+}
+
 // Service provides AI chat functionality using the Agent pipeline.
 type Service struct {
 	processor Processor
+	usage     UsageRecorder
+	budget    *Budget
 }
 
 // NewServiceWithProcessor creates a new agent service with a custom processor.
@@ -19,16 +26,72 @@ func NewServiceWithProcessor(processor Processor) (*Service, error) {
 	}, nil
 }
 
+// SetUsageRecorder meters every chat message and every terminal analysis
+// that produced a response as one AI call of its user.
+func (s *Service) SetUsageRecorder(r UsageRecorder) {
+	s.usage = r
+}
+
+// SetBudget tracks agent calls against budget and degrades chat and
+// terminal analysis in the modes it selects. Local hints and replies are
+// not metered as AI calls.
+func (s *Service) SetBudget(budget *Budget) {
+	s.budget = budget
+}
+
 // Chat processes a user message and returns response chunks.
 // This is the main entry point for reactive chat (user-initiated).
 func (s *Service) Chat(ctx context.Context, req ChatRequest) iter.Seq2[*ChatResponse, error] {
-	return s.processor.Chat(ctx, req)
+	if s.budget != nil {
+		if _, ok := s.budget.admit(); !ok {
+			return localChatResponses()
+		}
+	}
+	if s.usage != nil {
+		s.usage.RecordAICall(req.UserID)
+	}
+	if s.budget == nil {
+		return s.processor.Chat(ctx, req)
+	}
+	return trackCalls(ctx, s.budget, s.processor.Chat(ctx, req), nil)
 }
 
 // ProcessTerminalInput processes terminal commands through the agent pipeline.
 // This is for proactive assistance (agent-initiated based on terminal activity).
+// Most commands need no assistance, so only analyses that respond are
+// metered. While the budget is in errors-only mode, only commands that
+// failed are analyzed.
 func (s *Service) ProcessTerminalInput(ctx context.Context, input TerminalInput) iter.Seq2[*Response, error] {
-	return s.processor.ProcessTerminalInput(ctx, input)
+	var responses iter.Seq2[*Response, error]
+	if s.budget == nil {
+		responses = s.processor.ProcessTerminalInput(ctx, input)
+	} else {
+		mode, ok := s.budget.admit()
+		switch {
+		case !ok:
+			return localHintResponses(input)
+		case mode == ModeErrorsOnly && input.ExitCode <= 0:
+			return func(func(*Response, error) bool) {}
+		}
+		responses = trackCalls(ctx, s.budget, s.processor.ProcessTerminalInput(ctx, input), func(resp *Response) bool {
+			return resp != nil && resp.Type == string(ResponseTypeError)
+		})
+	}
+	if s.usage == nil {
+		return responses
+	}
+	return func(yield func(*Response, error) bool) {
+		metered := false
+		for resp, err := range responses {
+			if !metered && err == nil && resp != nil {
+				s.usage.RecordAICall(input.UserID)
+				metered = true
+			}
+			if !yield(resp, err) {
+				return
+			}
+		}
+	}
 }
 
 // GetStats returns agent statistics.
@@ -12,6 +12,9 @@ type ChatRequest struct {
 	VolumePath  string `json:"-"`
 	UserID      string `json:"-"`
 	SessionID   string `json:"-"`
+	// ContainerState is a snapshot of the learner's container taken by the
+	// handler, or nil if none could be taken.
+	ContainerState *ContainerStateOutput `json:"-"`
 }
 
 // ChatResponse represents a chat response from the agent.
@@ -54,8 +57,27 @@ const (
 	ResponseTypeSilent ResponseType = "silent"
 	// ResponseTypeError indicates an error response.
 	ResponseTypeError ResponseType = "error"
+	// ResponseTypeRecap summarizes activity that happened while the learner's tab was hidden.
+	ResponseTypeRecap ResponseType = "recap"
+	// ResponseTypeBell relays a terminal bell from a hidden tab as a desktop notification.
+	ResponseTypeBell ResponseType = "bell"
+	// ResponseTypeCommandFinished reports a long-running command that finished
+	// while the learner's tab was hidden, as a desktop notification.
+	ResponseTypeCommandFinished ResponseType = "command_finished"
+	// ResponseTypeMessagesDropped reports responses the terminal monitor
+	// dropped because the sidebar channel was full; Dropped holds the count.
+	ResponseTypeMessagesDropped ResponseType = "messages_dropped"
+	// ResponseTypeAnnouncement is an instructor's message to a classroom or
+	// to everyone.
+	ResponseTypeAnnouncement ResponseType = "announcement"
 )
 
+// IsDesktopNotification reports whether t is delivered as a desktop
+// notification rather than a sidebar message.
+func (t ResponseType) IsDesktopNotification() bool {
+	return t == ResponseTypeBell || t == ResponseTypeCommandFinished
+}
+
 // Config holds agent configuration.
 type Config struct {
 	Provider         string
@@ -76,12 +98,16 @@ func DefaultConfig() Config {
 	}
 }
 
+// ExitCodeUnknown is sent as TerminalInput.ExitCode when the shell did not
+// report the command's status, so the agent must not assume success or failure.
+const ExitCodeUnknown = -1
+
 // TerminalInput represents a terminal command for agent processing.
 type TerminalInput struct {
 	Command    string
 	PWD        string
 	Output     string
-	ExitCode   int
+	ExitCode   int // ExitCodeUnknown when the shell did not report one
 	Timestamp  int64
 	UserID     string
 	SessionID  string
@@ -114,4 +140,48 @@ type Response struct {
 	Block          bool
 	UserID         string
 	SessionID      string
+	// Target selects the receiving connections; empty means TargetSession.
+	Target Target
+	// Classroom is the classroom addressed by TargetClassroom.
+	Classroom string
+	// Dropped is the number of dropped responses a
+	// ResponseTypeMessagesDropped marker reports.
+	Dropped int
+}
+
+// Target selects which SSE connections receive a broadcast Response.
+type Target string
+
+const (
+	// TargetSession delivers to the response's user and tab session.
+	TargetSession Target = "session"
+	// TargetUser delivers to every tab session of the response's user.
+	TargetUser Target = "user"
+	// TargetClassroom delivers to every connection in the response's classroom.
+	TargetClassroom Target = "classroom"
+	// TargetAll delivers to every connection, e.g. for announcements.
+	TargetAll Target = "all"
+)
+
+// target returns the response's target, defaulting to TargetSession.
+func (r *Response) target() Target {
+	if r.Target == "" {
+		return TargetSession
+	}
+	return r.Target
+}
+
+// DeliveryStats counts broadcast deliveries for one target.
+type DeliveryStats struct {
+	// Messages is the number of responses broadcast to the target.
+	Messages int64 `json:"messages"`
+	// Deliveries is the number of connections the responses were written to.
+	Deliveries int64 `json:"deliveries"`
+	// Undelivered is the number of responses that reached no connection.
+	Undelivered int64 `json:"undelivered"`
+	// Dropped is the number of times a response was discarded for a
+	// connection whose send buffer was full.
+	Dropped int64 `json:"dropped"`
+	// LastDeliveredAt is when a response last reached a connection.
+	LastDeliveredAt time.Time `json:"last_delivered_at,omitzero"`
 }
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/events"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+	"github.com/go-chi/chi/v5"
+)
+
+// AccessibilityHandler streams terminal activity as structured events for
+// screen readers and other assistive frontends.
+type AccessibilityHandler struct {
+	feed *terminal.AccessibilityFeed
+	cfg  *config.Config
+}
+
+// NewAccessibilityHandler creates an accessibility handler. A nil feed makes
+// the stream unavailable.
+func NewAccessibilityHandler(feed *terminal.AccessibilityFeed, cfg *config.Config) *AccessibilityHandler {
+	return &AccessibilityHandler{feed: feed, cfg: cfg}
+}
+
+// RegisterRoutes registers terminal accessibility routes.
+func (h *AccessibilityHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/api/terminal/activity", h.Activity)
+}
+
+// Activity handles GET /api/terminal/activity.
+// It streams terminal_activity events (see internal/events) for the calling
+// tab's terminal: one when a command finishes, with its result, and one when
+// the prompt returns. Frontends announce these instead of the raw output.
+func (h *AccessibilityHandler) Activity(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	if userID == "" {
+		Error(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if h.feed == nil {
+		Error(w, http.StatusNotImplemented, "activity_unsupported")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		Error(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	activity, unsubscribe := h.feed.Subscribe(identity.SessionKeyFromContext(r.Context()))
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	retryDelay := 5 * time.Second
+	keepaliveInterval := 10 * time.Second
+	if h.cfg != nil {
+		retryDelay = h.cfg.SSE.RetryDelay
+		keepaliveInterval = h.cfg.SSE.KeepaliveInterval
+	}
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", retryDelay.Milliseconds()); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(keepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			if _, err := io.WriteString(w, "event: ping\ndata: {\"status\":\"alive\"}\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event := <-activity:
+			if err := events.Write(w, 0, activityEvent(event)); err != nil {
+				slog.Warn("failed to write terminal activity event", "error", err, "user_id", userID)
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// activityEvent converts an accessibility event into its typed SSE payload.
+func activityEvent(e terminal.AccessibilityEvent) *events.TerminalActivity {
+	p := &events.TerminalActivity{
+		Kind:       e.Kind,
+		Sequence:   e.Sequence,
+		Command:    e.Command,
+		Status:     e.Status,
+		DurationMs: e.Duration.Milliseconds(),
+		PWD:        e.PWD,
+		Summary:    e.Summary,
+	}
+	if e.ExitCode != terminal.ExitCodeUnknown {
+		code := e.ExitCode
+		p.ExitCode = &code
+	}
+	return p
+}
@@ -0,0 +1,69 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+)
+
+func TestActivityStreamsTabCommands(t *testing.T) {
+	repo := newFakeRepo()
+	feed := terminal.NewAccessibilityFeed()
+	handler := NewAccessibilityHandler(feed, nil)
+	srv := httptest.NewServer(identity.Middleware(repo, true)(http.HandlerFunc(handler.Activity)))
+	defer srv.Close()
+
+	req, _ := http.NewRequestWithContext(t.Context(), http.MethodGet, srv.URL+"/api/terminal/activity?session_id=tab-1", nil)
+	req.AddCookie(&http.Cookie{Name: identity.AnonCookieName, Value: provisionTestUser})
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected response %d", resp.StatusCode)
+	}
+	lines := bufio.NewScanner(resp.Body)
+	if !lines.Scan() || !strings.HasPrefix(lines.Text(), "retry: ") {
+		t.Fatalf("expected the retry delay first, got %q", lines.Text())
+	}
+
+	// Only commands of the subscribed tab are streamed.
+	other := terminal.CommandSession{Key: identity.NewSessionKey(provisionTestUser, "tab-2")}
+	feed.OnCommandCompleted(terminal.CommandEntry{Sequence: 1, Command: "pwd"}, other)
+	tab := terminal.CommandSession{Key: identity.NewSessionKey(provisionTestUser, "tab-1")}
+	feed.OnCommandCompleted(terminal.CommandEntry{Sequence: 2, Command: "make", ExitCode: 2, Duration: 3 * time.Second, PWD: "/home/learner"}, tab)
+
+	var data []string
+	for len(data) < 2 && lines.Scan() {
+		if line, ok := strings.CutPrefix(lines.Text(), "data: "); ok {
+			data = append(data, line)
+		}
+	}
+	want := []string{
+		`{"v":1,"event":"terminal_activity","kind":"command","seq":2,"command":"make","status":"failed","exit_code":2,"duration_ms":3000,"pwd":"/home/learner","summary":"make failed with exit code 2 after 3s."}`,
+		`{"v":1,"event":"terminal_activity","kind":"prompt","seq":2,"pwd":"/home/learner","summary":"Prompt ready in /home/learner."}`,
+	}
+	if strings.Join(data, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected events:\n%s", strings.Join(data, "\n"))
+	}
+}
+
+func TestActivityUnavailableWithoutFeed(t *testing.T) {
+	repo := newFakeRepo()
+	handler := NewAccessibilityHandler(nil, nil)
+	req := httptest.NewRequest(http.MethodGet, "/api/terminal/activity", nil)
+	req.AddCookie(&http.Cookie{Name: identity.AnonCookieName, Value: provisionTestUser})
+	rr := httptest.NewRecorder()
+	identity.Middleware(repo, true)(http.HandlerFunc(handler.Activity)).ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotImplemented {
+		t.Fatalf("expected 501, got %d", rr.Code)
+	}
+}
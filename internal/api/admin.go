@@ -0,0 +1,840 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/agent"
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/curriculum"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+	"github.com/ashureev/shsh-labs/internal/terminal/demo"
+	"github.com/go-chi/chi/v5"
+)
+
+// defaultKeepWarmMax bounds a keep-warm exemption when no config is given.
+const defaultKeepWarmMax = 4 * time.Hour
+
+// Windows, in days, of the intervention analytics.
+const (
+	defaultAnalyticsDays = 30
+	maxAnalyticsDays     = 365
+)
+
+// Page sizes of the container event log.
+const (
+	defaultContainerEventLimit = 100
+	maxContainerEventLimit     = 1000
+)
+
+// selfTestTimeout bounds a self-test run, including cleanup.
+const selfTestTimeout = 3 * time.Minute
+
+// maxAnnouncementLength bounds an announcement's text.
+const maxAnnouncementLength = 4 * 1024
+
+// defaultCurriculumSyncTimeout bounds a curriculum source sync when no
+// config is given.
+const defaultCurriculumSyncTimeout = 2 * time.Minute
+
+// keepWarmRequest is the body of PUT /api/admin/users/{userID}/keep-warm.
+type keepWarmRequest struct {
+	DurationSeconds int64 `json:"duration_seconds"`
+}
+
+// demoRecordingRequest is the body of POST /api/admin/demos/{name}/recording.
+type demoRecordingRequest struct {
+	UserID string `json:"user_id"`
+	Title  string `json:"title"`
+}
+
+// pairingRequest is the body of POST /api/admin/pairs.
+type pairingRequest struct {
+	HostID    string `json:"host_id"`
+	PartnerID string `json:"partner_id"`
+}
+
+// curriculumSourceRequest is the body of PUT
+// /api/admin/curriculum/sources/{name}.
+type curriculumSourceRequest struct {
+	URL        string   `json:"url"`
+	Ref        string   `json:"ref"`
+	Classrooms []string `json:"classrooms"`
+}
+
+// imageBuildRequest is the body of POST /api/admin/images/builds.
+type imageBuildRequest struct {
+	Challenges []string `json:"challenges"` // Empty builds every challenge's image
+	Force      bool     `json:"force"`      // Rebuild without the cache, even if unchanged
+}
+
+// resourceTierRequest is the body of PUT
+// /api/admin/users/{userID}/resource-tier.
+type resourceTierRequest struct {
+	Tier string `json:"tier"`
+}
+
+// classroomRequest is the body of PUT /api/admin/users/{userID}/classroom.
+type classroomRequest struct {
+	Classroom string `json:"classroom"`
+}
+
+// announcementRequest is the body of POST /api/admin/announcements. An empty
+// classroom addresses everyone.
+type announcementRequest struct {
+	Classroom string `json:"classroom,omitempty"`
+	Message   string `json:"message"`
+}
+
+// broadcaster delivers announcements over the agent's SSE streams.
+type broadcaster interface {
+	Announce(classroom, message string) error
+	DeliveryStats() map[agent.Target]agent.DeliveryStats
+}
+
+// keepWarmEntry describes one user's keep-warm exemption.
+type keepWarmEntry struct {
+	UserID        string    `json:"user_id"`
+	Username      string    `json:"username"`
+	Active        bool      `json:"active"`
+	KeepWarmUntil time.Time `json:"keep_warm_until,omitzero"`
+}
+
+// AdminHandler serves the operator API. Every route requires the configured
+// admin token as "Authorization: Bearer <token>"; without a token the routes
+// are not registered.
+type AdminHandler struct {
+	*Handler
+	token       string
+	keepWarmMax time.Duration
+	demos       *demo.Library
+	selfTest    *terminal.SelfTest
+	selfTestMu  sync.Mutex // Held while a self-test runs
+	curriculum  *curriculum.Catalog
+	builder     *container.Builder
+	challenges  *ChallengeHandler // Grants learners sudo
+	broadcasts  broadcaster
+	syncTimeout time.Duration
+	resources   config.ContainerConfig // Resource tiers admins can assign
+}
+
+// NewAdminHandler creates an admin handler.
+func NewAdminHandler(base *Handler, cfg *config.Config) *AdminHandler {
+	h := &AdminHandler{Handler: base, keepWarmMax: defaultKeepWarmMax, syncTimeout: defaultCurriculumSyncTimeout}
+	if cfg != nil {
+		h.token = cfg.Admin.Token
+		h.resources = cfg.Container
+		if cfg.Admin.KeepWarmMax > 0 {
+			h.keepWarmMax = cfg.Admin.KeepWarmMax
+		}
+		if cfg.Curriculum.SyncTimeout > 0 {
+			h.syncTimeout = cfg.Curriculum.SyncTimeout
+		}
+	}
+	return h
+}
+
+// SetDemoLibrary enables the routes that record and delete demos.
+func (h *AdminHandler) SetDemoLibrary(library *demo.Library) {
+	h.demos = library
+}
+
+// SetSelfTest enables POST /api/admin/selftest.
+func (h *AdminHandler) SetSelfTest(selfTest *terminal.SelfTest) {
+	h.selfTest = selfTest
+}
+
+// SetCurriculum enables the routes that manage git curriculum sources.
+func (h *AdminHandler) SetCurriculum(catalog *curriculum.Catalog) {
+	h.curriculum = catalog
+}
+
+// SetImageBuilder enables the routes that build challenge images.
+func (h *AdminHandler) SetImageBuilder(builder *container.Builder) {
+	h.builder = builder
+}
+
+// SetSudo enables the routes that grant and revoke learners' sudo, when
+// challenges lists challenges that may grant it.
+func (h *AdminHandler) SetSudo(challenges *ChallengeHandler) {
+	h.challenges = challenges
+}
+
+// SetBroadcaster enables the routes that send announcements and report
+// broadcast deliveries.
+func (h *AdminHandler) SetBroadcaster(b broadcaster) {
+	h.broadcasts = b
+}
+
+// RegisterRoutes registers admin routes when an admin token is configured.
+func (h *AdminHandler) RegisterRoutes(r chi.Router) {
+	if h.token == "" {
+		return
+	}
+	r.Route("/api/admin", func(r chi.Router) {
+		r.Use(h.requireToken)
+		r.Get("/keep-warm", h.ListKeepWarm)
+		r.Put("/users/{userID}/keep-warm", h.SetKeepWarm)
+		r.Delete("/users/{userID}/keep-warm", h.ClearKeepWarm)
+		r.Get("/resource-tiers", h.ListResourceTiers)
+		r.Put("/users/{userID}/resource-tier", h.SetResourceTier)
+		r.Delete("/users/{userID}/resource-tier", h.ClearResourceTier)
+		r.Put("/users/{userID}/classroom", h.SetClassroom)
+		r.Delete("/users/{userID}/classroom", h.ClearClassroom)
+		r.Get("/users/{userID}/archived-sessions", h.ListArchivedSessions)
+		r.Get("/users/{userID}/container-events", h.ListContainerEvents)
+		r.Get("/analytics/interventions", h.ListInterventionStats)
+		r.Get("/pairs", h.ListPairs)
+		r.Post("/pairs", h.StartPair)
+		r.Delete("/pairs/{userID}", h.EndPair)
+		if h.demos != nil {
+			r.Post("/demos/{name}/recording", h.StartDemoRecording)
+			r.Delete("/demos/{name}/recording", h.StopDemoRecording)
+			r.Delete("/demos/{name}", h.DeleteDemo)
+		}
+		if h.selfTest != nil {
+			r.Post("/selftest", h.RunSelfTest)
+		}
+		if h.resources.PrePullConcurrency > 0 {
+			r.Get("/images/prepull", h.GetImagePrePull)
+			r.Post("/images/prepull", h.StartImagePrePull)
+		}
+		if h.builder != nil {
+			r.Get("/images/builds", h.GetImageBuilds)
+			r.Post("/images/builds", h.StartImageBuild)
+		}
+		if h.challenges != nil && h.challenges.sudoEnabled() {
+			r.Post("/users/{userID}/sudo", h.challenges.GrantSudo)
+			r.Delete("/users/{userID}/sudo", h.challenges.RevokeUserSudo)
+		}
+		if h.broadcasts != nil {
+			r.Post("/announcements", h.Announce)
+			r.Get("/deliveries", h.GetDeliveryStats)
+		}
+		if h.curriculum != nil {
+			r.Get("/curriculum/sources", h.ListCurriculumSources)
+			r.Put("/curriculum/sources/{name}", h.PutCurriculumSource)
+			r.Post("/curriculum/sources/{name}/sync", h.SyncCurriculumSource)
+			r.Delete("/curriculum/sources/{name}", h.DeleteCurriculumSource)
+		}
+	})
+}
+
+// requireToken rejects requests without the admin bearer token.
+func (h *AdminHandler) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			Error(w, http.StatusUnauthorized, "invalid admin token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ListKeepWarm handles GET /api/admin/keep-warm.
+func (h *AdminHandler) ListKeepWarm(w http.ResponseWriter, r *http.Request) {
+	users, err := h.repo.ListKeptWarmUsers(r.Context(), time.Now())
+	if err != nil {
+		slog.Error("Failed to list kept warm users", "error", err)
+		Error(w, http.StatusInternalServerError, "failed to load keep-warm users")
+		return
+	}
+	entries := make([]keepWarmEntry, 0, len(users))
+	for _, user := range users {
+		entries = append(entries, newKeepWarmEntry(user))
+	}
+	JSON(w, http.StatusOK, map[string]interface{}{"users": entries})
+}
+
+// SetKeepWarm handles PUT /api/admin/users/{userID}/keep-warm. It exempts
+// the user from TTL cleanup and chat rate limits for duration_seconds,
+// capped at the configured maximum.
+func (h *AdminHandler) SetKeepWarm(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 4*1024)
+	var req keepWarmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.DurationSeconds <= 0 {
+		Error(w, http.StatusBadRequest, "duration_seconds must be positive")
+		return
+	}
+	duration := min(time.Duration(req.DurationSeconds)*time.Second, h.keepWarmMax)
+	h.updateKeepWarm(w, r, time.Now().Add(duration))
+}
+
+// ClearKeepWarm handles DELETE /api/admin/users/{userID}/keep-warm.
+func (h *AdminHandler) ClearKeepWarm(w http.ResponseWriter, r *http.Request) {
+	h.updateKeepWarm(w, r, time.Time{})
+}
+
+func (h *AdminHandler) updateKeepWarm(w http.ResponseWriter, r *http.Request, until time.Time) {
+	userID := chi.URLParam(r, "userID")
+	user, err := h.repo.GetUser(r.Context(), userID)
+	if err != nil {
+		slog.Error("Failed to get user for keep-warm", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to load user")
+		return
+	}
+	if user == nil {
+		Error(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	if err := h.repo.SetKeepWarm(r.Context(), userID, until); err != nil {
+		slog.Error("Failed to update keep-warm", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to update keep-warm")
+		return
+	}
+	user.KeepWarmUntil = until
+	slog.Info("Admin updated keep-warm", "user_id", userID, "keep_warm_until", until)
+	JSON(w, http.StatusOK, newKeepWarmEntry(user))
+}
+
+// ListResourceTiers handles GET /api/admin/resource-tiers with the tiers
+// users can be assigned and the default tier.
+func (h *AdminHandler) ListResourceTiers(w http.ResponseWriter, _ *http.Request) {
+	tiers := make([]map[string]any, 0, len(h.resources.Tiers))
+	for _, tier := range h.resources.Tiers {
+		tiers = append(tiers, map[string]any{
+			"name":         tier.Name,
+			"memory_bytes": tier.MemoryLimitBytes,
+			"cpu_quota":    tier.CPUQuota,
+			"pids_limit":   tier.PidsLimit,
+		})
+	}
+	JSON(w, http.StatusOK, map[string]any{"tiers": tiers, "default": h.resources.DefaultTier})
+}
+
+// SetResourceTier handles PUT /api/admin/users/{userID}/resource-tier. The
+// tier overrides the default and image tiers from the user's next
+// provision; a running Docker container is updated to it in place.
+func (h *AdminHandler) SetResourceTier(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 4*1024)
+	var req resourceTierRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if _, ok := h.resources.Tier(req.Tier); !ok || req.Tier == "" {
+		Error(w, http.StatusBadRequest, "unknown_tier")
+		return
+	}
+	h.updateResourceTier(w, r, req.Tier)
+}
+
+// ClearResourceTier handles DELETE /api/admin/users/{userID}/resource-tier.
+func (h *AdminHandler) ClearResourceTier(w http.ResponseWriter, r *http.Request) {
+	h.updateResourceTier(w, r, "")
+}
+
+func (h *AdminHandler) updateResourceTier(w http.ResponseWriter, r *http.Request, tier string) {
+	userID := chi.URLParam(r, "userID")
+	user, err := h.repo.GetUser(r.Context(), userID)
+	if err != nil {
+		slog.Error("Failed to get user for resource tier", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to load user")
+		return
+	}
+	if user == nil {
+		Error(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	if err := h.repo.SetResourceTier(r.Context(), userID, tier); err != nil {
+		slog.Error("Failed to update resource tier", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to update resource tier")
+		return
+	}
+	slog.Info("Admin updated resource tier", "user_id", userID, "tier", tier)
+	JSON(w, http.StatusOK, map[string]string{"user_id": userID, "resource_tier": tier})
+}
+
+// SetClassroom handles PUT /api/admin/users/{userID}/classroom. Terminals
+// and agent streams pick up the classroom when they next connect; the
+// challenge list follows it at once.
+func (h *AdminHandler) SetClassroom(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 4*1024)
+	var req classroomRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if !terminal.ValidClassroom(req.Classroom) {
+		Error(w, http.StatusBadRequest, "invalid_classroom")
+		return
+	}
+	h.updateClassroom(w, r, req.Classroom)
+}
+
+// ClearClassroom handles DELETE /api/admin/users/{userID}/classroom.
+func (h *AdminHandler) ClearClassroom(w http.ResponseWriter, r *http.Request) {
+	h.updateClassroom(w, r, "")
+}
+
+func (h *AdminHandler) updateClassroom(w http.ResponseWriter, r *http.Request, classroom string) {
+	userID := chi.URLParam(r, "userID")
+	user, err := h.repo.GetUser(r.Context(), userID)
+	if err != nil {
+		slog.Error("Failed to get user for classroom", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to load user")
+		return
+	}
+	if user == nil {
+		Error(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	if err := h.repo.SetClassroom(r.Context(), userID, classroom); err != nil {
+		slog.Error("Failed to update classroom", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to update classroom")
+		return
+	}
+	slog.Info("Admin updated classroom", "user_id", userID, "classroom", classroom)
+	JSON(w, http.StatusOK, map[string]string{"user_id": userID, "classroom": classroom})
+}
+
+// Announce handles POST /api/admin/announcements, sending a message to the
+// open tabs of a classroom, or of everyone without one.
+func (h *AdminHandler) Announce(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 2*maxAnnouncementLength)
+	var req announcementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	message := strings.TrimSpace(req.Message)
+	switch {
+	case message == "":
+		Error(w, http.StatusBadRequest, "message is required")
+		return
+	case len(message) > maxAnnouncementLength:
+		Error(w, http.StatusBadRequest, "message too long")
+		return
+	case req.Classroom != "" && !terminal.ValidClassroom(req.Classroom):
+		Error(w, http.StatusBadRequest, "invalid_classroom")
+		return
+	}
+
+	if err := h.broadcasts.Announce(req.Classroom, message); err != nil {
+		slog.Warn("Failed to send announcement", "error", err, "classroom", req.Classroom)
+		Error(w, http.StatusServiceUnavailable, "broadcast_busy")
+		return
+	}
+	slog.Info("Admin sent announcement", "classroom", req.Classroom, "length", len(message))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// GetDeliveryStats handles GET /api/admin/deliveries with broadcast delivery
+// counts per target.
+func (h *AdminHandler) GetDeliveryStats(w http.ResponseWriter, _ *http.Request) {
+	JSON(w, http.StatusOK, map[string]any{"targets": h.broadcasts.DeliveryStats()})
+}
+
+// ListArchivedSessions handles GET /api/admin/users/{userID}/archived-sessions,
+// returning the user's expired agent sessions, newest first, for tutors to
+// review.
+func (h *AdminHandler) ListArchivedSessions(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	sessions, err := h.repo.ListArchivedSessions(r.Context(), userID)
+	if err != nil {
+		slog.Error("Failed to list archived sessions", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to load archived sessions")
+		return
+	}
+	JSON(w, http.StatusOK, map[string]interface{}{
+		"user_id":  userID,
+		"sessions": domain.NewArchivedSessionExports(sessions),
+	})
+}
+
+// ListContainerEvents handles GET /api/admin/users/{userID}/container-events,
+// returning the user's latest ?limit=N (default 100) container lifecycle
+// events, newest first, to debug reports of a container disappearing.
+func (h *AdminHandler) ListContainerEvents(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	limit := defaultContainerEventLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > maxContainerEventLimit {
+			Error(w, http.StatusBadRequest, "limit must be between 1 and 1000")
+			return
+		}
+		limit = n
+	}
+	events, err := h.repo.ListContainerEvents(r.Context(), userID, limit)
+	if err != nil {
+		slog.Error("Failed to list container events", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to load container events")
+		return
+	}
+	if events == nil {
+		events = []*domain.ContainerEvent{}
+	}
+	JSON(w, http.StatusOK, map[string]interface{}{
+		"user_id": userID,
+		"events":  events,
+	})
+}
+
+// ListInterventionStats handles GET /api/admin/analytics/interventions. It
+// reports, per hint, how often the learner's next command succeeded, repeated
+// the failing command or failed otherwise, over the last ?days=N days
+// (default 30).
+func (h *AdminHandler) ListInterventionStats(w http.ResponseWriter, r *http.Request) {
+	days := defaultAnalyticsDays
+	if s := r.URL.Query().Get("days"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > maxAnalyticsDays {
+			Error(w, http.StatusBadRequest, "days must be between 1 and 365")
+			return
+		}
+		days = n
+	}
+	since := time.Now().AddDate(0, 0, -days)
+	stats, err := h.repo.ListInterventionStats(r.Context(), since)
+	if err != nil {
+		slog.Error("Failed to list intervention stats", "error", err)
+		Error(w, http.StatusInternalServerError, "failed to load intervention stats")
+		return
+	}
+	if stats == nil {
+		stats = []*domain.InterventionStats{}
+	}
+	JSON(w, http.StatusOK, map[string]interface{}{
+		"since": since,
+		"hints": stats,
+	})
+}
+
+// ListPairs handles GET /api/admin/pairs.
+func (h *AdminHandler) ListPairs(w http.ResponseWriter, _ *http.Request) {
+	pairs := h.sm.ListPairings()
+	if pairs == nil {
+		pairs = []terminal.PairStatus{}
+	}
+	JSON(w, http.StatusOK, map[string]interface{}{"pairs": pairs})
+}
+
+// StartPair handles POST /api/admin/pairs. The partner joins the host's
+// container through a pair terminal (/ws/terminal?pair=1), watching as
+// navigator until the host hands over control. Pairs live in this server's
+// session manager, so both learners must be routed to it.
+func (h *AdminHandler) StartPair(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 4*1024)
+	var req pairingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	for _, userID := range []string{req.HostID, req.PartnerID} {
+		user, err := h.repo.GetUser(r.Context(), userID)
+		if err != nil {
+			slog.Error("Failed to get user for pairing", "error", err, "user_id", userID)
+			Error(w, http.StatusInternalServerError, "failed to load user")
+			return
+		}
+		if user == nil {
+			Error(w, http.StatusNotFound, "user not found")
+			return
+		}
+	}
+
+	status, err := h.sm.StartPairing(req.HostID, req.PartnerID)
+	switch {
+	case errors.Is(err, terminal.ErrSelfPairing):
+		Error(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, terminal.ErrAlreadyPaired):
+		Error(w, http.StatusConflict, "already_paired")
+		return
+	case err != nil:
+		slog.Error("Failed to start pairing", "error", err, "host", req.HostID, "partner", req.PartnerID)
+		Error(w, http.StatusInternalServerError, "failed to start pairing")
+		return
+	}
+	JSON(w, http.StatusOK, status)
+}
+
+// EndPair handles DELETE /api/admin/pairs/{userID}, dissolving the pair
+// either member belongs to.
+func (h *AdminHandler) EndPair(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.sm.EndPairing(chi.URLParam(r, "userID"), "admin"); err != nil {
+		Error(w, http.StatusNotFound, "pair not found")
+		return
+	}
+	JSON(w, http.StatusOK, map[string]string{"status": "ended"})
+}
+
+// StartDemoRecording handles POST /api/admin/demos/{name}/recording. The
+// next terminal tab of user_id with traffic is recorded until the recording
+// is stopped.
+func (h *AdminHandler) StartDemoRecording(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	r.Body = http.MaxBytesReader(w, r.Body, 4*1024)
+	var req demoRecordingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	user, err := h.repo.GetUser(r.Context(), req.UserID)
+	if err != nil {
+		slog.Error("Failed to get user for demo recording", "error", err, "user_id", req.UserID)
+		Error(w, http.StatusInternalServerError, "failed to load user")
+		return
+	}
+	if user == nil {
+		Error(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	switch err := h.demos.StartRecording(name, req.Title, req.UserID); {
+	case errors.Is(err, demo.ErrInvalidName):
+		Error(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, demo.ErrRecording):
+		Error(w, http.StatusConflict, "recording_in_progress")
+		return
+	case err != nil:
+		slog.Error("Failed to start demo recording", "error", err, "demo", name)
+		Error(w, http.StatusInternalServerError, "failed to start recording")
+		return
+	}
+	slog.Info("Admin started demo recording", "demo", name, "user_id", req.UserID)
+	JSON(w, http.StatusOK, map[string]interface{}{
+		"name":    name,
+		"user_id": req.UserID,
+		"status":  "recording",
+	})
+}
+
+// StopDemoRecording handles DELETE /api/admin/demos/{name}/recording,
+// saving the recording to the demo library.
+func (h *AdminHandler) StopDemoRecording(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	d, err := h.demos.StopRecording(name)
+	switch {
+	case errors.Is(err, demo.ErrNotRecording):
+		Error(w, http.StatusNotFound, "no recording in progress")
+		return
+	case errors.Is(err, demo.ErrEmpty):
+		Error(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	case err != nil:
+		slog.Error("Failed to save demo recording", "error", err, "demo", name)
+		Error(w, http.StatusInternalServerError, "failed to save recording")
+		return
+	}
+	slog.Info("Admin saved demo recording", "demo", name, "steps", d.StepCount)
+	JSON(w, http.StatusOK, d.Summary)
+}
+
+// DeleteDemo handles DELETE /api/admin/demos/{name}.
+func (h *AdminHandler) DeleteDemo(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	switch err := h.demos.Delete(name); {
+	case errors.Is(err, demo.ErrNotFound), errors.Is(err, demo.ErrInvalidName):
+		Error(w, http.StatusNotFound, "demo not found")
+		return
+	case err != nil:
+		slog.Error("Failed to delete demo", "error", err, "demo", name)
+		Error(w, http.StatusInternalServerError, "failed to delete demo")
+		return
+	}
+	slog.Info("Admin deleted demo", "demo", name)
+	JSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// RunSelfTest handles POST /api/admin/selftest. It provisions a throwaway
+// container, runs a command through the terminal monitor and, when AI is
+// enabled, the agent, then cleans up. The report is returned with 200 when
+// every step passed and 503 otherwise; one self-test runs at a time.
+func (h *AdminHandler) RunSelfTest(w http.ResponseWriter, r *http.Request) {
+	if !h.selfTestMu.TryLock() {
+		Error(w, http.StatusConflict, "selftest_in_progress")
+		return
+	}
+	defer h.selfTestMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(r.Context(), selfTestTimeout)
+	defer cancel()
+	report := h.selfTest.Run(ctx)
+	slog.Info("Admin ran self-test", "passed", report.Passed, "user_id", report.UserID)
+	if !report.Passed {
+		JSON(w, http.StatusServiceUnavailable, report)
+		return
+	}
+	JSON(w, http.StatusOK, report)
+}
+
+// GetImagePrePull handles GET /api/admin/images/prepull with the progress
+// of each host's latest image pre-pull.
+func (h *AdminHandler) GetImagePrePull(w http.ResponseWriter, _ *http.Request) {
+	prePuller, ok := h.mgr.(container.ImagePrePuller)
+	if !ok {
+		Error(w, http.StatusNotImplemented, "prepull_unsupported")
+		return
+	}
+	JSON(w, http.StatusOK, map[string]interface{}{"hosts": prePuller.PrePullStatus()})
+}
+
+// StartImagePrePull handles POST /api/admin/images/prepull. It pulls the
+// images of newly added challenges onto every healthy host, answering 202
+// with the progress, or 409 while every host is still pulling.
+func (h *AdminHandler) StartImagePrePull(w http.ResponseWriter, r *http.Request) {
+	prePuller, ok := h.mgr.(container.ImagePrePuller)
+	if !ok {
+		Error(w, http.StatusNotImplemented, "prepull_unsupported")
+		return
+	}
+	// The pulls outlive the request; each image is bounded on its own.
+	if !prePuller.PrePull(context.WithoutCancel(r.Context())) {
+		Error(w, http.StatusConflict, "prepull_in_progress")
+		return
+	}
+	slog.Info("Admin started image pre-pull")
+	JSON(w, http.StatusAccepted, map[string]interface{}{"hosts": prePuller.PrePullStatus()})
+}
+
+// GetImageBuilds handles GET /api/admin/images/builds with the latest build
+// of each challenge image.
+func (h *AdminHandler) GetImageBuilds(w http.ResponseWriter, _ *http.Request) {
+	running, builds := h.builder.Status()
+	JSON(w, http.StatusOK, map[string]interface{}{"running": running, "images": builds})
+}
+
+// StartImageBuild handles POST /api/admin/images/builds. It builds the
+// images of the listed challenges, or of every challenge, on every healthy
+// host, answering 202 with the progress, 404 for a challenge without an
+// image, or 409 while a build runs. Unchanged images are kept unless force
+// is set.
+func (h *AdminHandler) StartImageBuild(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 16*1024)
+	var req imageBuildRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	refs := make([]string, 0, len(req.Challenges))
+	for _, id := range req.Challenges {
+		refs = append(refs, curriculum.LabImageRef(id))
+	}
+
+	// The build outlives the request; each image is bounded on its own.
+	switch err := h.builder.Build(context.WithoutCancel(r.Context()), req.Force, refs...); {
+	case errors.Is(err, container.ErrBuildNotFound):
+		Error(w, http.StatusNotFound, "challenge has no image")
+		return
+	case errors.Is(err, container.ErrBuildRunning):
+		Error(w, http.StatusConflict, "build_in_progress")
+		return
+	case err != nil:
+		slog.Error("Failed to start image build", "error", err)
+		Error(w, http.StatusInternalServerError, "failed to start image build")
+		return
+	}
+	slog.Info("Admin started image build", "challenges", req.Challenges, "force", req.Force)
+	running, builds := h.builder.Status()
+	JSON(w, http.StatusAccepted, map[string]interface{}{"running": running, "images": builds})
+}
+
+// ListCurriculumSources handles GET /api/admin/curriculum/sources. URLs are
+// returned without credentials.
+func (h *AdminHandler) ListCurriculumSources(w http.ResponseWriter, _ *http.Request) {
+	JSON(w, http.StatusOK, map[string]interface{}{"sources": h.curriculum.Sources()})
+}
+
+// PutCurriculumSource handles PUT /api/admin/curriculum/sources/{name}. It
+// registers or updates a git repository as a curriculum source and syncs
+// it. A failed sync still registers the source: the response carries the
+// error and the source is retried on the sync schedule.
+func (h *AdminHandler) PutCurriculumSource(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	r.Body = http.MaxBytesReader(w, r.Body, 16*1024)
+	var req curriculumSourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.syncTimeout)
+	defer cancel()
+	status, err := h.curriculum.Register(ctx, curriculum.Source{
+		Name:       name,
+		URL:        req.URL,
+		Ref:        req.Ref,
+		Classrooms: req.Classrooms,
+	})
+	switch {
+	case errors.Is(err, curriculum.ErrInvalidSource):
+		Error(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		slog.Error("Failed to register curriculum source", "error", err, "source", name)
+		Error(w, http.StatusInternalServerError, "failed to register curriculum source")
+		return
+	}
+	slog.Info("Admin registered curriculum source", "source", name, "commit", status.Commit, "sync_error", status.Error)
+	JSON(w, http.StatusOK, status)
+}
+
+// SyncCurriculumSource handles POST
+// /api/admin/curriculum/sources/{name}/sync, pulling the source now.
+func (h *AdminHandler) SyncCurriculumSource(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	ctx, cancel := context.WithTimeout(r.Context(), h.syncTimeout)
+	defer cancel()
+	status, err := h.curriculum.Sync(ctx, name)
+	switch {
+	case errors.Is(err, curriculum.ErrSourceNotFound):
+		Error(w, http.StatusNotFound, "curriculum source not found")
+		return
+	case err != nil:
+		slog.Error("Failed to sync curriculum source", "error", err, "source", name)
+		Error(w, http.StatusInternalServerError, "failed to sync curriculum source")
+		return
+	}
+	JSON(w, http.StatusOK, status)
+}
+
+// DeleteCurriculumSource handles DELETE /api/admin/curriculum/sources/{name}.
+// Its challenges stop being served; learners' progress on them is kept.
+func (h *AdminHandler) DeleteCurriculumSource(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	switch err := h.curriculum.Remove(name); {
+	case errors.Is(err, curriculum.ErrSourceNotFound):
+		Error(w, http.StatusNotFound, "curriculum source not found")
+		return
+	case err != nil:
+		slog.Error("Failed to remove curriculum source", "error", err, "source", name)
+		Error(w, http.StatusInternalServerError, "failed to remove curriculum source")
+		return
+	}
+	slog.Info("Admin removed curriculum source", "source", name)
+	JSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func newKeepWarmEntry(user *domain.User) keepWarmEntry {
+	entry := keepWarmEntry{
+		UserID:   user.UserID,
+		Username: user.Username,
+		Active:   user.IsKeptWarm(time.Now()),
+	}
+	if entry.Active {
+		entry.KeepWarmUntil = user.KeepWarmUntil
+	}
+	return entry
+}
@@ -0,0 +1,521 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/agent"
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/curriculum"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+	"github.com/go-chi/chi/v5"
+)
+
+func newAdminRouter(t *testing.T, token string) (*fakeRepo, http.Handler) {
+	t.Helper()
+	repo := newFakeRepo()
+	repo.users["u1"] = &domain.User{UserID: "u1", Username: "instructor"}
+	cfg := &config.Config{Admin: config.AdminConfig{Token: token, KeepWarmMax: time.Hour}}
+	r := chi.NewRouter()
+	NewAdminHandler(NewHandler(repo, &fakeManager{}, terminal.NewSessionManager(), ""), cfg).RegisterRoutes(r)
+	return repo, r
+}
+
+func doAdminRequest(h http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAdminRoutesRequireToken(t *testing.T) {
+	_, h := newAdminRouter(t, "secret")
+	if rr := doAdminRequest(h, http.MethodGet, "/api/admin/keep-warm", "", ""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", rr.Code)
+	}
+	if rr := doAdminRequest(h, http.MethodGet, "/api/admin/keep-warm", "wrong", ""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with wrong token, got %d", rr.Code)
+	}
+
+	_, disabled := newAdminRouter(t, "")
+	if rr := doAdminRequest(disabled, http.MethodGet, "/api/admin/keep-warm", "", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 with admin API disabled, got %d", rr.Code)
+	}
+}
+
+func TestAdminKeepWarm(t *testing.T) {
+	repo, h := newAdminRouter(t, "secret")
+
+	rr := doAdminRequest(h, http.MethodPut, "/api/admin/users/u1/keep-warm", "secret", `{"duration_seconds": 86400}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	user, _ := repo.GetUser(context.Background(), "u1")
+	if !user.IsKeptWarm(time.Now()) {
+		t.Fatal("expected user to be kept warm")
+	}
+	if until := time.Until(user.KeepWarmUntil); until > time.Hour {
+		t.Fatalf("expected duration capped at 1h, got %s", until)
+	}
+
+	rr = doAdminRequest(h, http.MethodGet, "/api/admin/keep-warm", "secret", "")
+	var list struct {
+		Users []keepWarmEntry `json:"users"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&list); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if len(list.Users) != 1 || list.Users[0].UserID != "u1" || !list.Users[0].Active {
+		t.Fatalf("unexpected list: %+v", list.Users)
+	}
+
+	if rr := doAdminRequest(h, http.MethodDelete, "/api/admin/users/u1/keep-warm", "secret", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 on clear, got %d", rr.Code)
+	}
+	user, _ = repo.GetUser(context.Background(), "u1")
+	if user.IsKeptWarm(time.Now()) {
+		t.Fatal("expected keep-warm cleared")
+	}
+}
+
+func TestAdminResourceTier(t *testing.T) {
+	repo := newFakeRepo()
+	repo.users["u1"] = &domain.User{UserID: "u1"}
+	cfg := &config.Config{
+		Admin:     config.AdminConfig{Token: "secret"},
+		Container: config.ContainerConfig{Tiers: []config.ResourceTier{{Name: "large", MemoryLimitBytes: 1 << 30}}},
+	}
+	h := chi.NewRouter()
+	NewAdminHandler(NewHandler(repo, &fakeManager{}, terminal.NewSessionManager(), ""), cfg).RegisterRoutes(h)
+
+	if rr := doAdminRequest(h, http.MethodPut, "/api/admin/users/u1/resource-tier", "secret", `{"tier":"huge"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown tier, got %d", rr.Code)
+	}
+	if rr := doAdminRequest(h, http.MethodPut, "/api/admin/users/u1/resource-tier", "secret", `{"tier":"large"}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if user, _ := repo.GetUser(context.Background(), "u1"); user.ResourceTier != "large" {
+		t.Fatalf("expected tier large, got %q", user.ResourceTier)
+	}
+	if rr := doAdminRequest(h, http.MethodDelete, "/api/admin/users/u1/resource-tier", "secret", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 on clear, got %d", rr.Code)
+	}
+	if user, _ := repo.GetUser(context.Background(), "u1"); user.ResourceTier != "" {
+		t.Fatalf("expected tier cleared, got %q", user.ResourceTier)
+	}
+	if rr := doAdminRequest(h, http.MethodPut, "/api/admin/users/nobody/resource-tier", "secret", `{"tier":"large"}`); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown user, got %d", rr.Code)
+	}
+}
+
+func TestAdminClassroom(t *testing.T) {
+	repo, h := newAdminRouter(t, "secret")
+
+	if rr := doAdminRequest(h, http.MethodPut, "/api/admin/users/u1/classroom", "secret", `{"classroom":"Period 3"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid classroom, got %d", rr.Code)
+	}
+	if rr := doAdminRequest(h, http.MethodPut, "/api/admin/users/u1/classroom", "secret", `{"classroom":"period-3"}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if user, _ := repo.GetUser(context.Background(), "u1"); user.Classroom != "period-3" {
+		t.Fatalf("expected classroom period-3, got %q", user.Classroom)
+	}
+	if rr := doAdminRequest(h, http.MethodDelete, "/api/admin/users/u1/classroom", "secret", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 on clear, got %d", rr.Code)
+	}
+	if user, _ := repo.GetUser(context.Background(), "u1"); user.Classroom != "" {
+		t.Fatalf("expected classroom cleared, got %q", user.Classroom)
+	}
+	if rr := doAdminRequest(h, http.MethodPut, "/api/admin/users/nobody/classroom", "secret", `{"classroom":"period-3"}`); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown user, got %d", rr.Code)
+	}
+}
+
+type announcement struct{ classroom, message string }
+
+type fakeBroadcaster struct {
+	sent []announcement
+	err  error
+}
+
+func (b *fakeBroadcaster) Announce(classroom, message string) error {
+	if b.err != nil {
+		return b.err
+	}
+	b.sent = append(b.sent, announcement{classroom, message})
+	return nil
+}
+
+func (b *fakeBroadcaster) DeliveryStats() map[agent.Target]agent.DeliveryStats {
+	return map[agent.Target]agent.DeliveryStats{agent.TargetAll: {Messages: int64(len(b.sent)), Deliveries: 3}}
+}
+
+func TestAdminAnnouncements(t *testing.T) {
+	cfg := &config.Config{Admin: config.AdminConfig{Token: "secret"}}
+	apiHandler := NewHandler(newFakeRepo(), &fakeManager{}, terminal.NewSessionManager(), "")
+
+	// Without a broadcaster the routes are not registered.
+	h := chi.NewRouter()
+	NewAdminHandler(apiHandler, cfg).RegisterRoutes(h)
+	if rr := doAdminRequest(h, http.MethodPost, "/api/admin/announcements", "secret", `{"message":"hi"}`); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without a broadcaster, got %d", rr.Code)
+	}
+
+	b := &fakeBroadcaster{}
+	admin := NewAdminHandler(apiHandler, cfg)
+	admin.SetBroadcaster(b)
+	h = chi.NewRouter()
+	admin.RegisterRoutes(h)
+
+	for _, body := range []string{`{"message":"  "}`, `{"message":"hi","classroom":"Period 3"}`, `{"message":"` + strings.Repeat("x", maxAnnouncementLength+1) + `"}`} {
+		if rr := doAdminRequest(h, http.MethodPost, "/api/admin/announcements", "secret", body); rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %.40s, got %d", body, rr.Code)
+		}
+	}
+	if rr := doAdminRequest(h, http.MethodPost, "/api/admin/announcements", "secret", `{"message":" Lab closes at noon "}`); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doAdminRequest(h, http.MethodPost, "/api/admin/announcements", "secret", `{"message":"Quiz","classroom":"period-3"}`); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	want := []announcement{{"", "Lab closes at noon"}, {"period-3", "Quiz"}}
+	if len(b.sent) != 2 || b.sent[0] != want[0] || b.sent[1] != want[1] {
+		t.Fatalf("sent %+v, want %+v", b.sent, want)
+	}
+
+	b.err = errors.New("full")
+	if rr := doAdminRequest(h, http.MethodPost, "/api/admin/announcements", "secret", `{"message":"hi"}`); rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 when the broadcast is refused, got %d", rr.Code)
+	}
+
+	rr := doAdminRequest(h, http.MethodGet, "/api/admin/deliveries", "secret", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Targets map[agent.Target]agent.DeliveryStats `json:"targets"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if stats := resp.Targets[agent.TargetAll]; stats.Messages != 2 || stats.Deliveries != 3 {
+		t.Fatalf("unexpected delivery stats: %+v", resp.Targets)
+	}
+}
+
+func TestAdminListArchivedSessions(t *testing.T) {
+	repo, h := newAdminRouter(t, "secret")
+	archivedAt := time.Unix(1700000000, 0).UTC()
+	repo.archived = []*domain.ArchivedAgentSession{{
+		AgentSession: domain.AgentSession{UserID: "u1", AttemptCount: 2, MessagesJSON: `[{"role":"user","content":"ls"}]`},
+		ArchivedAt:   archivedAt,
+	}}
+
+	rr := doAdminRequest(h, http.MethodGet, "/api/admin/users/u1/archived-sessions", "secret", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Sessions []domain.ArchivedSessionExport `json:"sessions"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Sessions) != 1 || !resp.Sessions[0].ArchivedAt.Equal(archivedAt) || resp.Sessions[0].AttemptCount != 2 {
+		t.Fatalf("unexpected sessions: %+v", resp.Sessions)
+	}
+	if got := string(resp.Sessions[0].Messages); got != `[{"role":"user","content":"ls"}]` {
+		t.Fatalf("unexpected messages: %s", got)
+	}
+}
+
+func TestAdminListContainerEvents(t *testing.T) {
+	repo, h := newAdminRouter(t, "secret")
+	ctx := context.Background()
+	container.RecordEvent(ctx, repo, "u1", "c1", domain.ContainerEventCreate, container.ReasonProvision)
+	container.RecordEvent(ctx, repo, "u2", "c2", domain.ContainerEventCreate, container.ReasonProvision)
+	container.RecordEvent(ctx, repo, "u1", "c1", domain.ContainerEventExpire, container.ReasonTTL)
+	container.RecordEvent(ctx, repo, "u1", "c1", domain.ContainerEventStop, container.ReasonTTL)
+
+	rr := doAdminRequest(h, http.MethodGet, "/api/admin/users/u1/container-events?limit=2", "secret", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Events []domain.ContainerEvent `json:"events"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode events: %v", err)
+	}
+	if len(resp.Events) != 2 || resp.Events[0].Event != domain.ContainerEventStop || resp.Events[1].Event != domain.ContainerEventExpire {
+		t.Fatalf("expected the latest two events newest first, got %+v", resp.Events)
+	}
+	if resp.Events[0].Reason != container.ReasonTTL || resp.Events[0].ContainerID != "c1" {
+		t.Fatalf("unexpected event: %+v", resp.Events[0])
+	}
+
+	if rr := doAdminRequest(h, http.MethodGet, "/api/admin/users/u1/container-events?limit=0", "secret", ""); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid limit, got %d", rr.Code)
+	}
+}
+
+func TestAdminKeepWarmRejectsBadInput(t *testing.T) {
+	_, h := newAdminRouter(t, "secret")
+	if rr := doAdminRequest(h, http.MethodPut, "/api/admin/users/u1/keep-warm", "secret", `{"duration_seconds": 0}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for zero duration, got %d", rr.Code)
+	}
+	if rr := doAdminRequest(h, http.MethodPut, "/api/admin/users/nobody/keep-warm", "secret", `{"duration_seconds": 60}`); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown user, got %d", rr.Code)
+	}
+}
+
+func TestAdminPairs(t *testing.T) {
+	repo, h := newAdminRouter(t, "secret")
+	repo.users["u2"] = &domain.User{UserID: "u2", Username: "learner"}
+
+	if rr := doAdminRequest(h, http.MethodPost, "/api/admin/pairs", "secret", `{"host_id":"u1","partner_id":"nobody"}`); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown partner, got %d", rr.Code)
+	}
+	rr := doAdminRequest(h, http.MethodPost, "/api/admin/pairs", "secret", `{"host_id":"u1","partner_id":"u2"}`)
+	var status terminal.PairStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if status.Host != "u1" || status.Partner != "u2" || status.Driver != "u1" {
+		t.Fatalf("unexpected pair: %+v", status)
+	}
+	if rr := doAdminRequest(h, http.MethodPost, "/api/admin/pairs", "secret", `{"host_id":"u2","partner_id":"u1"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for already paired users, got %d", rr.Code)
+	}
+	if rr := doAdminRequest(h, http.MethodGet, "/api/admin/pairs", "secret", ""); !strings.Contains(rr.Body.String(), `"partner":"u2"`) {
+		t.Fatalf("expected pair in list, got %s", rr.Body.String())
+	}
+	if rr := doAdminRequest(h, http.MethodDelete, "/api/admin/pairs/u2", "secret", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 when ending pair, got %d", rr.Code)
+	}
+	if rr := doAdminRequest(h, http.MethodDelete, "/api/admin/pairs/u1", "secret", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for ended pair, got %d", rr.Code)
+	}
+}
+
+func TestAdminInterventionStats(t *testing.T) {
+	repo, h := newAdminRouter(t, "secret")
+	now := time.Now()
+	for _, outcome := range []domain.InterventionOutcome{
+		domain.InterventionResolved, domain.InterventionResolved, domain.InterventionRepeated, domain.InterventionNoFollowUp,
+	} {
+		repo.interventions = append(repo.interventions, &domain.Intervention{
+			UserID: "u1", SessionID: "s1", ResponseType: "pattern", Pattern: "permission_denied",
+			Outcome: outcome, HintedAt: now, ResolvedAt: now,
+		})
+	}
+	repo.interventions = append(repo.interventions, &domain.Intervention{
+		UserID: "u1", ResponseType: "llm", Outcome: domain.InterventionFailed, HintedAt: now.AddDate(0, 0, -10),
+	})
+
+	rr := doAdminRequest(h, http.MethodGet, "/api/admin/analytics/interventions?days=7", "secret", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Hints []domain.InterventionStats `json:"hints"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Hints) != 1 {
+		t.Fatalf("expected stats for one hint, got %+v", resp.Hints)
+	}
+	s := resp.Hints[0]
+	if s.Pattern != "permission_denied" || s.Hints != 4 || s.Resolved != 2 || s.Repeated != 1 || s.NoFollowUp != 1 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+	if s.SuccessRate < 0.66 || s.SuccessRate > 0.67 {
+		t.Fatalf("success rate = %v, want 2/3", s.SuccessRate)
+	}
+
+	if rr := doAdminRequest(h, http.MethodGet, "/api/admin/analytics/interventions?days=0", "secret", ""); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for days=0, got %d", rr.Code)
+	}
+}
+
+// unprovisionableManager fails every provision request.
+type unprovisionableManager struct {
+	fakeManager
+}
+
+func (m *unprovisionableManager) EnsureContainer(context.Context, string, string, string, time.Time, map[string]string) (string, error) {
+	return "", errors.New("docker unavailable")
+}
+
+func TestAdminSelfTest(t *testing.T) {
+	_, h := newAdminRouter(t, "secret")
+	if rr := doAdminRequest(h, http.MethodPost, "/api/admin/selftest", "secret", ""); rr.Code == http.StatusOK || rr.Code == http.StatusServiceUnavailable {
+		t.Fatalf("selftest route should not exist without a self-test, got %d", rr.Code)
+	}
+
+	cfg := &config.Config{Admin: config.AdminConfig{Token: "secret"}}
+	mgr := &unprovisionableManager{}
+	admin := NewAdminHandler(NewHandler(newFakeRepo(), mgr, terminal.NewSessionManager(), ""), cfg)
+	admin.SetSelfTest(terminal.NewSelfTest(mgr, nil, nil))
+	r := chi.NewRouter()
+	admin.RegisterRoutes(r)
+
+	rr := doAdminRequest(r, http.MethodPost, "/api/admin/selftest", "secret", "")
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 for a failed self-test, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var report terminal.SelfTestReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if report.Passed || len(report.Steps) == 0 || report.Steps[0].Name != "provision" || report.Steps[0].Status != terminal.SelfTestFailed {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	admin.selfTestMu.Lock()
+	defer admin.selfTestMu.Unlock()
+	if rr := doAdminRequest(r, http.MethodPost, "/api/admin/selftest", "secret", ""); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 while a self-test runs, got %d", rr.Code)
+	}
+}
+
+// prePullManager records pre-pulls; one runs until running is cleared.
+type prePullManager struct {
+	fakeManager
+	src     container.ImageSource
+	running bool
+}
+
+func (m *prePullManager) SetImageSource(src container.ImageSource) { m.src = src }
+
+func (m *prePullManager) PrePull(context.Context) bool {
+	if m.running {
+		return false
+	}
+	m.running = true
+	return true
+}
+
+func (m *prePullManager) PrePullStatus() []container.PrePullStatus {
+	state := container.PrePullIdle
+	if m.running {
+		state = container.PrePullRunning
+	}
+	return []container.PrePullStatus{{Host: "a", State: state, Images: []container.ImagePull{}}}
+}
+
+func TestAdminImagePrePull(t *testing.T) {
+	cfg := &config.Config{Admin: config.AdminConfig{Token: "secret"}, Container: config.ContainerConfig{PrePullConcurrency: 2}}
+	r := chi.NewRouter()
+	NewAdminHandler(NewHandler(newFakeRepo(), &prePullManager{}, terminal.NewSessionManager(), ""), cfg).RegisterRoutes(r)
+
+	if rr := doAdminRequest(r, http.MethodGet, "/api/admin/images/prepull", "secret", ""); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"state":"idle"`) {
+		t.Fatalf("unexpected status %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doAdminRequest(r, http.MethodPost, "/api/admin/images/prepull", "secret", ""); rr.Code != http.StatusAccepted || !strings.Contains(rr.Body.String(), `"state":"running"`) {
+		t.Fatalf("unexpected start %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doAdminRequest(r, http.MethodPost, "/api/admin/images/prepull", "secret", ""); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 while pulling, got %d", rr.Code)
+	}
+
+	r = chi.NewRouter()
+	NewAdminHandler(NewHandler(newFakeRepo(), &fakeManager{}, terminal.NewSessionManager(), ""), cfg).RegisterRoutes(r)
+	if rr := doAdminRequest(r, http.MethodGet, "/api/admin/images/prepull", "secret", ""); rr.Code != http.StatusNotImplemented {
+		t.Fatalf("expected 501 without pre-pull support, got %d", rr.Code)
+	}
+
+	cfg.Container.PrePullConcurrency = 0
+	r = chi.NewRouter()
+	NewAdminHandler(NewHandler(newFakeRepo(), &prePullManager{}, terminal.NewSessionManager(), ""), cfg).RegisterRoutes(r)
+	if rr := doAdminRequest(r, http.MethodPost, "/api/admin/images/prepull", "secret", ""); rr.Code == http.StatusAccepted {
+		t.Fatal("pre-pull route should not exist when disabled")
+	}
+}
+
+// buildManager builds images once release is closed.
+type buildManager struct {
+	fakeManager
+	release chan struct{}
+}
+
+func (m *buildManager) BuildImage(ctx context.Context, spec container.BuildSpec, force bool) (container.BuildResult, error) {
+	<-m.release
+	return container.BuildResult{Ref: spec.Ref, Digest: "sha256:1", Cached: !force}, nil
+}
+
+func TestAdminImageBuilds(t *testing.T) {
+	mgr := &buildManager{release: make(chan struct{})}
+	builder := container.NewBuilder(mgr, func() []container.BuildSpec {
+		return []container.BuildSpec{{Ref: curriculum.LabImageRef("web"), Source: "web"}}
+	})
+	admin := NewAdminHandler(NewHandler(newFakeRepo(), mgr, terminal.NewSessionManager(), ""), &config.Config{Admin: config.AdminConfig{Token: "secret"}})
+	admin.SetImageBuilder(builder)
+	r := chi.NewRouter()
+	admin.RegisterRoutes(r)
+
+	if rr := doAdminRequest(r, http.MethodPost, "/api/admin/images/builds", "secret", `{"challenges":["dns"]}`); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a challenge without an image, got %d", rr.Code)
+	}
+	rr := doAdminRequest(r, http.MethodPost, "/api/admin/images/builds", "secret", `{"challenges":["web"],"force":true}`)
+	if rr.Code != http.StatusAccepted || !strings.Contains(rr.Body.String(), `"running":true`) {
+		t.Fatalf("unexpected start %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doAdminRequest(r, http.MethodPost, "/api/admin/images/builds", "secret", ""); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 while building, got %d", rr.Code)
+	}
+
+	close(mgr.release)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rr := doAdminRequest(r, http.MethodGet, "/api/admin/images/builds", "secret", "")
+		if strings.Contains(rr.Body.String(), `"state":"built"`) && strings.Contains(rr.Body.String(), `"running":false`) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("build did not finish: %s", rr.Body.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAdminCurriculumSources(t *testing.T) {
+	cfg := &config.Config{Admin: config.AdminConfig{Token: "secret"}}
+	admin := NewAdminHandler(NewHandler(newFakeRepo(), &fakeManager{}, terminal.NewSessionManager(), ""), cfg)
+	admin.SetCurriculum(curriculum.NewCatalog(curriculum.Embedded(), t.TempDir(), 1<<20))
+	r := chi.NewRouter()
+	admin.RegisterRoutes(r)
+
+	if rr := doAdminRequest(r, http.MethodPut, "/api/admin/curriculum/sources/course", "secret", `{"url":"file:///srv/course"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a non-http source, got %d", rr.Code)
+	}
+	if rr := doAdminRequest(r, http.MethodPost, "/api/admin/curriculum/sources/course/sync", "secret", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 syncing an unknown source, got %d", rr.Code)
+	}
+
+	// An unreachable repository is still registered, with the sync error.
+	rr := doAdminRequest(r, http.MethodPut, "/api/admin/curriculum/sources/course", "secret", `{"url":"http://127.0.0.1:1/course.git"}`)
+	var status curriculum.SourceStatus
+	if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &status) != nil || status.Error == "" {
+		t.Fatalf("unexpected register response %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := doAdminRequest(r, http.MethodGet, "/api/admin/curriculum/sources", "secret", ""); !strings.Contains(rr.Body.String(), `"name":"course"`) {
+		t.Fatalf("source not listed: %s", rr.Body.String())
+	}
+	if rr := doAdminRequest(r, http.MethodDelete, "/api/admin/curriculum/sources/course", "secret", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 deleting the source, got %d", rr.Code)
+	}
+}
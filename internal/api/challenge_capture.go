@@ -0,0 +1,292 @@
+package api
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/identity"
+)
+
+const (
+	// captureStartTimeout bounds starting the capture sidecar, including
+	// pulling its image.
+	captureStartTimeout = 2 * time.Minute
+	// captureRetention is how long a finished capture stays downloadable.
+	captureRetention = 30 * time.Minute
+	// maxPcapPacket bounds the captured length of one packet, the largest
+	// snapshot length tcpdump accepts.
+	maxPcapPacket = 262144
+)
+
+// Capture states.
+const (
+	captureRunning  = "running"
+	captureFinished = "finished"
+	captureFailed   = "failed"
+)
+
+var errInvalidPcap = errors.New("capture output is not a pcap stream")
+
+// trafficCapture is a learner's recording of their container's traffic.
+type trafficCapture struct {
+	ChallengeID string     `json:"challenge_id"`
+	Status      string     `json:"status"`
+	StartedAt   time.Time  `json:"started_at"`
+	EndedAt     *time.Time `json:"ended_at,omitempty"`
+	Packets     int        `json:"packets"`
+	Bytes       int        `json:"bytes"`
+	Truncated   bool       `json:"truncated"` // Stopped at the size limit
+	Error       string     `json:"error,omitempty"`
+
+	pcap []byte
+	stop context.CancelFunc
+}
+
+// captureTracker holds the latest capture of each user, bounded to one at a
+// time per user.
+type captureTracker struct {
+	mu       sync.Mutex
+	captures map[string]*trafficCapture
+}
+
+func newCaptureTracker() *captureTracker {
+	return &captureTracker{captures: make(map[string]*trafficCapture)}
+}
+
+// begin registers a new capture for userID unless one is running.
+func (t *captureTracker) begin(userID, challengeID string, stop context.CancelFunc) (*trafficCapture, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c := t.captures[userID]; c != nil && c.Status == captureRunning {
+		return nil, false
+	}
+	c := &trafficCapture{ChallengeID: challengeID, Status: captureRunning, StartedAt: time.Now(), stop: stop}
+	t.captures[userID] = c
+	return c, true
+}
+
+// get returns a copy of the user's capture of challengeID and its pcap data
+// so far.
+func (t *captureTracker) get(userID, challengeID string) (trafficCapture, []byte, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := t.captures[userID]
+	if c == nil || c.ChallengeID != challengeID {
+		return trafficCapture{}, nil, false
+	}
+	// Packets are only appended, so the prefix stays valid after unlocking.
+	return *c, c.pcap[:len(c.pcap):len(c.pcap)], true
+}
+
+// stop ends the user's capture of challengeID if it is running.
+func (t *captureTracker) stop(userID, challengeID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := t.captures[userID]
+	if c == nil || c.ChallengeID != challengeID {
+		return false
+	}
+	c.stop()
+	return true
+}
+
+// append adds whole pcap data to a capture.
+func (t *captureTracker) append(c *trafficCapture, data []byte, packet bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c.pcap = append(c.pcap, data...)
+	c.Bytes = len(c.pcap)
+	if packet {
+		c.Packets++
+	}
+}
+
+// finish marks a capture done and forgets it after captureRetention.
+func (t *captureTracker) finish(userID string, c *trafficCapture, truncated bool, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	c.EndedAt = &now
+	c.Truncated = truncated
+	c.Status = captureFinished
+	if err != nil {
+		c.Status = captureFailed
+		c.Error = err.Error()
+	}
+	time.AfterFunc(captureRetention, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.captures[userID] == c {
+			delete(t.captures, userID)
+		}
+	})
+}
+
+// StartCapture handles POST /api/challenges/{id}/capture.
+// It starts recording the learner's container traffic for challenges listed
+// in SHSH_CAPTURE_CHALLENGES, so lessons on tcpdump and Wireshark can work
+// with the learner's own packets. The capture stops after
+// SHSH_CAPTURE_MAX_DURATION, at SHSH_CAPTURE_MAX_BYTES, when the container
+// stops or on DELETE, and its pcap is served from
+// /api/challenges/{id}/capture/pcap. A learner runs one capture at a time.
+func (h *ChallengeHandler) StartCapture(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	challengeID, ok := h.checkpointChallenge(w, r)
+	if !ok {
+		return
+	}
+	if h.cfg == nil || !h.cfg.Capture.Allows(challengeID) {
+		Error(w, http.StatusForbidden, "capture_not_enabled")
+		return
+	}
+	capturer, ok := h.mgr.(container.Capturer)
+	if !ok {
+		Error(w, http.StatusNotImplemented, "capture_unsupported")
+		return
+	}
+	user, ok := h.checkpointUser(w, r, userID)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.cfg.Capture.MaxDuration)
+	c, ok := h.captures.begin(userID, challengeID, cancel)
+	if !ok {
+		cancel()
+		Error(w, http.StatusConflict, "capture_running")
+		return
+	}
+
+	startCtx, startCancel := context.WithTimeout(r.Context(), captureStartTimeout)
+	defer startCancel()
+	stream, err := capturer.CaptureTraffic(startCtx, user.ContainerID, container.CaptureOptions{
+		Image:   h.cfg.Capture.Image,
+		SnapLen: h.cfg.Capture.SnapLen,
+	})
+	if err != nil {
+		cancel()
+		h.captures.finish(userID, c, false, errors.New("failed to start capture"))
+		slog.Error("Failed to start traffic capture", "error", err, "user_id", userID, "challenge_id", challengeID)
+		Error(w, http.StatusInternalServerError, "failed to start capture")
+		return
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = stream.Close()
+	}()
+	go func() {
+		defer cancel()
+		truncated, err := h.recordPcap(c, stream, h.cfg.Capture.MaxBytes)
+		h.captures.finish(userID, c, truncated, err)
+		slog.Info("Traffic capture finished", "user_id", userID, "challenge_id", challengeID, "truncated", truncated, "error", err)
+	}()
+
+	slog.Info("Traffic capture started by user", "user_id", userID, "challenge_id", challengeID)
+	status, _, _ := h.captures.get(userID, challengeID)
+	JSON(w, http.StatusAccepted, status)
+}
+
+// GetCapture handles GET /api/challenges/{id}/capture with the status of the
+// learner's capture.
+func (h *ChallengeHandler) GetCapture(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	challengeID, ok := h.checkpointChallenge(w, r)
+	if !ok {
+		return
+	}
+	status, _, ok := h.captures.get(userID, challengeID)
+	if !ok {
+		Error(w, http.StatusNotFound, "capture not found")
+		return
+	}
+	JSON(w, http.StatusOK, status)
+}
+
+// StopCapture handles DELETE /api/challenges/{id}/capture. The recorded
+// packets stay downloadable.
+func (h *ChallengeHandler) StopCapture(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	challengeID, ok := h.checkpointChallenge(w, r)
+	if !ok {
+		return
+	}
+	if !h.captures.stop(userID, challengeID) {
+		Error(w, http.StatusNotFound, "capture not found")
+		return
+	}
+	JSON(w, http.StatusOK, map[string]string{"status": "stopping"})
+}
+
+// DownloadCapture handles GET /api/challenges/{id}/capture/pcap. A running
+// capture serves the packets recorded so far.
+func (h *ChallengeHandler) DownloadCapture(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	challengeID, ok := h.checkpointChallenge(w, r)
+	if !ok {
+		return
+	}
+	_, pcap, ok := h.captures.get(userID, challengeID)
+	if !ok || len(pcap) == 0 {
+		Error(w, http.StatusNotFound, "capture not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.tcpdump.pcap")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pcap"`, challengeID))
+	w.Header().Set("Content-Length", strconv.Itoa(len(pcap)))
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(pcap)
+}
+
+// recordPcap copies whole packets of a pcap stream into c until the stream
+// ends or the next packet would grow it past maxBytes, so the kept data is
+// always a valid pcap file. It reports whether the size limit was reached.
+func (h *ChallengeHandler) recordPcap(c *trafficCapture, r io.Reader, maxBytes int64) (bool, error) {
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return false, errInvalidPcap
+	}
+	var order binary.ByteOrder
+	switch binary.LittleEndian.Uint32(header) {
+	case 0xa1b2c3d4, 0xa1b23c4d: // Microsecond and nanosecond timestamps
+		order = binary.LittleEndian
+	case 0xd4c3b2a1, 0x4d3cb2a1:
+		order = binary.BigEndian
+	default:
+		return false, errInvalidPcap
+	}
+	h.captures.append(c, header, false)
+	size := int64(len(header))
+
+	record := make([]byte, 16)
+	for {
+		if _, err := io.ReadFull(r, record); err != nil {
+			// The stream ends when the capture is stopped, possibly
+			// mid-packet.
+			return false, nil
+		}
+		capLen := order.Uint32(record[8:12])
+		if capLen > maxPcapPacket {
+			return false, errInvalidPcap
+		}
+		packet := make([]byte, 16+int(capLen))
+		copy(packet, record)
+		if _, err := io.ReadFull(r, packet[16:]); err != nil {
+			return false, nil
+		}
+		if size+int64(len(packet)) > maxBytes {
+			return true, nil
+		}
+		h.captures.append(c, packet, true)
+		size += int64(len(packet))
+	}
+}
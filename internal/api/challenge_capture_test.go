@@ -0,0 +1,117 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/curriculum"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+	"github.com/go-chi/chi/v5"
+)
+
+// captureManager serves each capture from the next of its streams.
+type captureManager struct {
+	fakeManager
+	streams chan io.ReadCloser
+}
+
+func (m *captureManager) CaptureTraffic(context.Context, string, container.CaptureOptions) (io.ReadCloser, error) {
+	return <-m.streams, nil
+}
+
+// pcapStream returns a little-endian pcap file with one packet per payload.
+func pcapStream(payloads ...string) []byte {
+	var b bytes.Buffer
+	_ = binary.Write(&b, binary.LittleEndian, []uint32{0xa1b2c3d4, 0x00040002, 0, 0, maxPcapPacket, 113})
+	for i, p := range payloads {
+		_ = binary.Write(&b, binary.LittleEndian, []uint32{uint32(i), 0, uint32(len(p)), uint32(len(p))})
+		b.WriteString(p)
+	}
+	return b.Bytes()
+}
+
+func waitCaptureDone(t *testing.T, repo *fakeRepo, r chi.Router) trafficCapture {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var status trafficCapture
+		rr := serveCheckpoint(repo, r, http.MethodGet, "/api/challenges/netlab/capture", "")
+		if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+			t.Fatalf("capture status: %d %s", rr.Code, rr.Body.String())
+		}
+		if status.Status != captureRunning {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("capture did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestChallengeCaptureRecordsBoundedPcap(t *testing.T) {
+	repo := newFakeRepo()
+	mgr := &captureManager{streams: make(chan io.ReadCloser, 2)}
+	lib := curriculum.NewLibrary(fstest.MapFS{
+		"netlab/content.md": {Data: []byte("# Net lab")},
+		"intro/content.md":  {Data: []byte("# Intro")},
+	})
+	cfg := &config.Config{Capture: config.CaptureConfig{
+		Challenges:  []string{"netlab"},
+		MaxBytes:    int64(len(pcapStream("one", "two"))),
+		MaxDuration: time.Minute,
+	}}
+	r := chi.NewRouter()
+	NewChallengeHandler(NewHandler(repo, mgr, terminal.NewSessionManager(), ""), lib, WithConfig(cfg)).RegisterRoutes(r)
+	if err := repo.UpsertUser(t.Context(), &domain.User{UserID: provisionTestUser, ContainerID: "container-1"}); err != nil {
+		t.Fatalf("upsert user: %v", err)
+	}
+
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/intro/capture", ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a challenge without capture, got %d", rr.Code)
+	}
+
+	// The third packet would exceed the size limit.
+	mgr.streams <- io.NopCloser(bytes.NewReader(pcapStream("one", "two", "three")))
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/netlab/capture", ""); rr.Code != http.StatusAccepted {
+		t.Fatalf("start: expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	status := waitCaptureDone(t, repo, r)
+	if status.Status != captureFinished || status.Packets != 2 || !status.Truncated {
+		t.Fatalf("unexpected capture status %+v", status)
+	}
+	rr := serveCheckpoint(repo, r, http.MethodGet, "/api/challenges/netlab/capture/pcap", "")
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), pcapStream("one", "two")) {
+		t.Fatalf("download: %d, %d bytes", rr.Code, rr.Body.Len())
+	}
+
+	// A capture runs until stopped, keeping the packets seen so far.
+	pr, pw := io.Pipe()
+	mgr.streams <- pr
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/netlab/capture", ""); rr.Code != http.StatusAccepted {
+		t.Fatalf("restart: expected 202, got %d", rr.Code)
+	}
+	if _, err := pw.Write(pcapStream("one")); err != nil {
+		t.Fatal(err)
+	}
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/netlab/capture", ""); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 while a capture runs, got %d", rr.Code)
+	}
+	if rr := serveCheckpoint(repo, r, http.MethodDelete, "/api/challenges/netlab/capture", ""); rr.Code != http.StatusOK {
+		t.Fatalf("stop: expected 200, got %d", rr.Code)
+	}
+	if status := waitCaptureDone(t, repo, r); status.Status != captureFinished || status.Packets != 1 || status.Truncated {
+		t.Fatalf("unexpected stopped capture %+v", status)
+	}
+}
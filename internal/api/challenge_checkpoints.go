@@ -0,0 +1,187 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/curriculum"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// checkpointTimeout bounds copying a work volume to or from a snapshot.
+	checkpointTimeout = 2 * time.Minute
+	// maxChallengeStep bounds step numbers so a client cannot create
+	// snapshot volumes without limit.
+	maxChallengeStep = 100
+)
+
+// CompleteStep handles POST /api/challenges/{id}/steps/{step}/complete.
+// It checkpoints the user's work volume so they can later roll back to the
+// state right after this step. Completing a step again replaces its
+// checkpoint.
+func (h *ChallengeHandler) CompleteStep(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	challengeID, ok := h.checkpointChallenge(w, r)
+	if !ok {
+		return
+	}
+	step, err := strconv.Atoi(chi.URLParam(r, "step"))
+	if err != nil || step < 0 || step >= maxChallengeStep {
+		Error(w, http.StatusBadRequest, "invalid step")
+		return
+	}
+
+	checkpointer, ok := h.mgr.(container.Checkpointer)
+	if !ok {
+		Error(w, http.StatusNotImplemented, "checkpoints_unsupported")
+		return
+	}
+	user, ok := h.checkpointUser(w, r, userID)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), checkpointTimeout)
+	defer cancel()
+	key := fmt.Sprintf("%s-step%d", challengeID, step)
+	snapshot, diff, err := checkpointer.CreateCheckpoint(ctx, userID, user.ContainerID, key)
+	if err != nil {
+		slog.Error("Failed to create checkpoint", "error", err, "user_id", userID, "challenge_id", challengeID, "step", step)
+		Error(w, http.StatusInternalServerError, "failed to create checkpoint")
+		return
+	}
+
+	checkpoint := &domain.ChallengeCheckpoint{
+		UserID:      userID,
+		ChallengeID: challengeID,
+		Step:        step,
+		Snapshot:    snapshot,
+		Diff:        diff,
+		CreatedAt:   time.Now(),
+	}
+	if err := h.repo.UpsertChallengeCheckpoint(r.Context(), checkpoint); err != nil {
+		slog.Error("Failed to store checkpoint", "error", err, "user_id", userID, "challenge_id", challengeID, "step", step)
+		Error(w, http.StatusInternalServerError, "failed to store checkpoint")
+		return
+	}
+	JSON(w, http.StatusOK, checkpoint)
+}
+
+// ListCheckpoints handles GET /api/challenges/{id}/checkpoints.
+func (h *ChallengeHandler) ListCheckpoints(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	challengeID, ok := h.checkpointChallenge(w, r)
+	if !ok {
+		return
+	}
+	checkpoints, err := h.repo.ListChallengeCheckpoints(r.Context(), userID, challengeID)
+	if err != nil {
+		slog.Error("Failed to list checkpoints", "error", err, "user_id", userID, "challenge_id", challengeID)
+		Error(w, http.StatusInternalServerError, "failed to load checkpoints")
+		return
+	}
+	if checkpoints == nil {
+		checkpoints = []*domain.ChallengeCheckpoint{}
+	}
+	JSON(w, http.StatusOK, map[string]interface{}{"checkpoints": checkpoints})
+}
+
+// Rollback handles POST /api/challenges/{id}/rollback with a body of
+// {"step": N}. It restores the user's work volume to the checkpoint taken
+// when step N was completed. Open terminals are closed so shells do not keep
+// stale working directories; they reconnect on their own.
+func (h *ChallengeHandler) Rollback(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	challengeID, ok := h.checkpointChallenge(w, r)
+	if !ok {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 4*1024)
+	var req struct {
+		Step *int `json:"step"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Step == nil {
+		Error(w, http.StatusBadRequest, "step is required")
+		return
+	}
+
+	checkpointer, ok := h.mgr.(container.Checkpointer)
+	if !ok {
+		Error(w, http.StatusNotImplemented, "checkpoints_unsupported")
+		return
+	}
+	user, ok := h.checkpointUser(w, r, userID)
+	if !ok {
+		return
+	}
+
+	checkpoints, err := h.repo.ListChallengeCheckpoints(r.Context(), userID, challengeID)
+	if err != nil {
+		slog.Error("Failed to list checkpoints", "error", err, "user_id", userID, "challenge_id", challengeID)
+		Error(w, http.StatusInternalServerError, "failed to load checkpoints")
+		return
+	}
+	var checkpoint *domain.ChallengeCheckpoint
+	for _, c := range checkpoints {
+		if c.Step == *req.Step {
+			checkpoint = c
+			break
+		}
+	}
+	if checkpoint == nil {
+		Error(w, http.StatusNotFound, "checkpoint not found")
+		return
+	}
+
+	h.sm.CloseSession(userID)
+
+	ctx, cancel := context.WithTimeout(r.Context(), checkpointTimeout)
+	defer cancel()
+	if err := checkpointer.RestoreCheckpoint(ctx, userID, user.ContainerID, checkpoint.Snapshot); err != nil {
+		slog.Error("Failed to restore checkpoint", "error", err, "user_id", userID, "challenge_id", challengeID, "step", checkpoint.Step)
+		Error(w, http.StatusInternalServerError, "failed to restore checkpoint")
+		return
+	}
+
+	slog.Info("Challenge rolled back", "user_id", userID, "challenge_id", challengeID, "step", checkpoint.Step)
+	JSON(w, http.StatusOK, map[string]interface{}{"status": "restored", "checkpoint": checkpoint})
+}
+
+// checkpointChallenge returns the challenge named in the URL, writing a 404
+// if the curriculum does not have it or does not show it to the user.
+func (h *ChallengeHandler) checkpointChallenge(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := chi.URLParam(r, "id")
+	if _, err := h.catalog.Content(id, h.classroomOf(r)); err != nil {
+		if !errors.Is(err, curriculum.ErrNotFound) {
+			slog.Error("Failed to load challenge content", "error", err, "challenge_id", id)
+		}
+		Error(w, http.StatusNotFound, "challenge not found")
+		return "", false
+	}
+	return id, true
+}
+
+// checkpointUser returns the user, writing an error response unless they
+// have a container to checkpoint or restore into.
+func (h *ChallengeHandler) checkpointUser(w http.ResponseWriter, r *http.Request, userID string) (*domain.User, bool) {
+	user, err := h.repo.GetUser(r.Context(), userID)
+	if err != nil || user == nil {
+		Error(w, http.StatusUnauthorized, "user not found")
+		return nil, false
+	}
+	if user.ContainerID == "" {
+		Error(w, http.StatusConflict, "no active container")
+		return nil, false
+	}
+	return user, true
+}
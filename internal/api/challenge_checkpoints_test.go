@@ -0,0 +1,107 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/ashureev/shsh-labs/internal/curriculum"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+	"github.com/go-chi/chi/v5"
+)
+
+// checkpointManager records checkpoints taken and restored.
+type checkpointManager struct {
+	fakeManager
+	mu       sync.Mutex
+	restored []string
+}
+
+func (m *checkpointManager) CreateCheckpoint(_ context.Context, userID, _, key string) (string, domain.FilesystemDiff, error) {
+	return "playground-" + userID + "-ckpt-" + key, domain.FilesystemDiff{Added: 2, Paths: []string{"A /etc/motd"}}, nil
+}
+
+func (m *checkpointManager) RestoreCheckpoint(_ context.Context, _, _, snapshot string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.restored = append(m.restored, snapshot)
+	return nil
+}
+
+func serveCheckpoint(repo *fakeRepo, r chi.Router, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.AddCookie(&http.Cookie{Name: identity.AnonCookieName, Value: provisionTestUser})
+	rr := httptest.NewRecorder()
+	identity.Middleware(repo, true)(r).ServeHTTP(rr, req)
+	return rr
+}
+
+func newCheckpointRouter(repo *fakeRepo, mgr *checkpointManager) chi.Router {
+	lib := curriculum.NewLibrary(fstest.MapFS{"intro/content.md": {Data: []byte("# Intro")}})
+	r := chi.NewRouter()
+	NewChallengeHandler(NewHandler(repo, mgr, terminal.NewSessionManager(), ""), lib).RegisterRoutes(r)
+	return r
+}
+
+func TestChallengeRollbackRestoresStepCheckpoint(t *testing.T) {
+	repo := newFakeRepo()
+	mgr := &checkpointManager{}
+	r := newCheckpointRouter(repo, mgr)
+	if err := repo.UpsertUser(t.Context(), &domain.User{UserID: provisionTestUser, ContainerID: "container-1"}); err != nil {
+		t.Fatalf("upsert user: %v", err)
+	}
+
+	for _, step := range []string{"1", "3"} {
+		if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/intro/steps/"+step+"/complete", ""); rr.Code != http.StatusOK {
+			t.Fatalf("complete step %s: expected 200, got %d: %s", step, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := serveCheckpoint(repo, r, http.MethodGet, "/api/challenges/intro/checkpoints", "")
+	var list struct {
+		Checkpoints []domain.ChallengeCheckpoint `json:"checkpoints"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || len(list.Checkpoints) != 2 {
+		t.Fatalf("expected 2 checkpoints, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if list.Checkpoints[1].Diff.Added != 2 {
+		t.Fatalf("expected diff summary, got %+v", list.Checkpoints[1])
+	}
+
+	rr = serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/intro/rollback", `{"step":3}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("rollback: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	mgr.mu.Lock()
+	restored := mgr.restored
+	mgr.mu.Unlock()
+	if len(restored) != 1 || restored[0] != "playground-"+provisionTestUser+"-ckpt-intro-step3" {
+		t.Fatalf("expected step 3 snapshot restored, got %v", restored)
+	}
+
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/intro/rollback", `{"step":2}`); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for step without checkpoint, got %d", rr.Code)
+	}
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/missing/rollback", `{"step":1}`); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown challenge, got %d", rr.Code)
+	}
+}
+
+func TestChallengeCheckpointsUnsupported(t *testing.T) {
+	repo := newFakeRepo()
+	lib := curriculum.NewLibrary(fstest.MapFS{"intro/content.md": {Data: []byte("# Intro")}})
+	r := chi.NewRouter()
+	NewChallengeHandler(NewHandler(repo, &fakeManager{}, terminal.NewSessionManager(), ""), lib).RegisterRoutes(r)
+
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/intro/steps/1/complete", ""); rr.Code != http.StatusNotImplemented {
+		t.Fatalf("expected 501, got %d", rr.Code)
+	}
+}
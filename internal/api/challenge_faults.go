@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/curriculum"
+	"github.com/ashureev/shsh-labs/internal/identity"
+)
+
+// faultTimeout bounds injecting a challenge's faults, including filling a
+// disk.
+const faultTimeout = time.Minute
+
+// InjectFaults handles POST /api/challenges/{id}/faults. It breaks the
+// learner's environment again the way the challenge's faults.txt describes,
+// so a troubleshooting scenario can be retried from the start.
+func (h *ChallengeHandler) InjectFaults(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	challengeID, ok := h.checkpointChallenge(w, r)
+	if !ok {
+		return
+	}
+	faults, ok := h.challengeFaults(w, r, challengeID)
+	if !ok {
+		return
+	}
+	if len(faults) == 0 {
+		Error(w, http.StatusNotFound, "challenge has no faults")
+		return
+	}
+	if !h.injectFaults(w, r, userID, challengeID, faults) {
+		return
+	}
+	JSON(w, http.StatusOK, map[string]interface{}{"status": "injected", "faults": faults})
+}
+
+// challengeFaults returns the faults of a challenge, writing an error
+// response if its faults.txt cannot be read.
+func (h *ChallengeHandler) challengeFaults(w http.ResponseWriter, r *http.Request, challengeID string) ([]curriculum.Fault, bool) {
+	faults, err := h.catalog.Faults(challengeID, h.classroomOf(r))
+	if err != nil {
+		slog.Error("Failed to load challenge faults", "error", err, "challenge_id", challengeID)
+		Error(w, http.StatusInternalServerError, "failed to load challenge faults")
+		return nil, false
+	}
+	return faults, true
+}
+
+// injectFaults runs the faults in the user's container, writing an error
+// response unless all of them were injected.
+func (h *ChallengeHandler) injectFaults(w http.ResponseWriter, r *http.Request, userID, challengeID string, faults []curriculum.Fault) bool {
+	runner, ok := h.mgr.(container.HookRunner)
+	if !ok {
+		Error(w, http.StatusNotImplemented, "faults_unsupported")
+		return false
+	}
+	user, ok := h.checkpointUser(w, r, userID)
+	if !ok {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), faultTimeout)
+	defer cancel()
+	exitCode, err := runner.RunHook(ctx, user.ContainerID, curriculum.FaultScript(faults))
+	if err != nil || exitCode != 0 {
+		slog.Error("Failed to inject challenge faults", "error", err, "exit_code", exitCode, "user_id", userID, "challenge_id", challengeID)
+		Error(w, http.StatusInternalServerError, "failed to inject faults")
+		return false
+	}
+	slog.Info("Challenge faults injected", "user_id", userID, "challenge_id", challengeID, "faults", len(faults))
+	return true
+}
@@ -0,0 +1,105 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/ashureev/shsh-labs/internal/curriculum"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+	"github.com/go-chi/chi/v5"
+)
+
+// hookManager records the hooks it runs and exits with exitCode.
+type hookManager struct {
+	fakeManager
+	scripts  []string
+	exitCode int
+}
+
+func (m *hookManager) RunHook(_ context.Context, _ string, script string) (int, error) {
+	m.scripts = append(m.scripts, script)
+	return m.exitCode, nil
+}
+
+func TestChallengeStartInjectsFaults(t *testing.T) {
+	repo := newFakeRepo()
+	mgr := &hookManager{}
+	lib := curriculum.NewLibrary(fstest.MapFS{
+		"broken-web/content.md": {Data: []byte("# Fix the web server")},
+		"broken-web/faults.txt": {Data: []byte("kill nginx\nremove /var/www/index.html\n")},
+		"intro/content.md":      {Data: []byte("# Intro")},
+	})
+	r := chi.NewRouter()
+	NewChallengeHandler(NewHandler(repo, mgr, terminal.NewSessionManager(), ""), lib).RegisterRoutes(r)
+
+	// Faults need a container to break.
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/broken-web/start", ""); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 without a container, got %d", rr.Code)
+	}
+	if err := repo.UpsertUser(t.Context(), &domain.User{UserID: provisionTestUser, ContainerID: "container-1"}); err != nil {
+		t.Fatalf("upsert user: %v", err)
+	}
+
+	mgr.exitCode = 1
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/broken-web/start", ""); rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 when a fault fails, got %d", rr.Code)
+	}
+	mgr.exitCode = 0
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/broken-web/start", ""); rr.Code != http.StatusCreated {
+		t.Fatalf("start: expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(mgr.scripts) != 2 || !strings.Contains(mgr.scripts[1], "pkill -x -- 'nginx'") || !strings.Contains(mgr.scripts[1], "rm -rf -- '/var/www/index.html'") {
+		t.Fatalf("unexpected hooks %q", mgr.scripts)
+	}
+
+	// Starting again keeps the learner's progress; re-injecting is explicit.
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/broken-web/start", ""); rr.Code != http.StatusOK || len(mgr.scripts) != 2 {
+		t.Fatalf("restart: %d with %d hooks", rr.Code, len(mgr.scripts))
+	}
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/broken-web/faults", ""); rr.Code != http.StatusOK || len(mgr.scripts) != 3 {
+		t.Fatalf("re-inject: %d with %d hooks", rr.Code, len(mgr.scripts))
+	}
+
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/intro/start", ""); rr.Code != http.StatusCreated || len(mgr.scripts) != 3 {
+		t.Fatalf("challenge without faults: %d with %d hooks", rr.Code, len(mgr.scripts))
+	}
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/intro/faults", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a challenge without faults, got %d", rr.Code)
+	}
+}
+
+func TestChallengeStartInstallsPreStopHook(t *testing.T) {
+	repo := newFakeRepo()
+	mgr := &hookManager{}
+	lib := curriculum.NewLibrary(fstest.MapFS{
+		"db/content.md":    {Data: []byte("# Databases")},
+		"db/pre-stop.sh":   {Data: []byte("pg_ctl stop -m fast\n")},
+		"intro/content.md": {Data: []byte("# Intro")},
+	})
+	r := chi.NewRouter()
+	NewChallengeHandler(NewHandler(repo, mgr, terminal.NewSessionManager(), ""), lib).RegisterRoutes(r)
+	if err := repo.UpsertUser(t.Context(), &domain.User{UserID: provisionTestUser, ContainerID: "container-1"}); err != nil {
+		t.Fatalf("upsert user: %v", err)
+	}
+
+	mgr.exitCode = 1
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/db/start", ""); rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 when the hook cannot be installed, got %d", rr.Code)
+	}
+	mgr.exitCode = 0
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/db/start", ""); rr.Code != http.StatusCreated {
+		t.Fatalf("start: expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(mgr.scripts) != 2 || mgr.scripts[1] != curriculum.PreStopInstallScript("db", "pg_ctl stop -m fast\n") {
+		t.Fatalf("unexpected hooks %q", mgr.scripts)
+	}
+
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/intro/start", ""); rr.Code != http.StatusCreated || len(mgr.scripts) != 2 {
+		t.Fatalf("challenge without a hook: %d with %d hooks", rr.Code, len(mgr.scripts))
+	}
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/curriculum"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+)
+
+// labTimeout bounds starting a lab, including pulling its nodes' images.
+const labTimeout = 5 * time.Minute
+
+// StartLab handles POST /api/challenges/{id}/lab. It starts the containers
+// listed in the challenge's topology.txt, replacing any lab the learner had
+// running, so a networking exercise can be reset to a clean state.
+func (h *ChallengeHandler) StartLab(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	challengeID, ok := h.checkpointChallenge(w, r)
+	if !ok {
+		return
+	}
+	nodes, ok := h.challengeTopology(w, r, challengeID)
+	if !ok {
+		return
+	}
+	if len(nodes) == 0 {
+		Error(w, http.StatusNotFound, "challenge has no lab")
+		return
+	}
+	topo, ok := h.startLab(w, r, userID, challengeID, nodes)
+	if !ok {
+		return
+	}
+	JSON(w, http.StatusCreated, topo)
+}
+
+// GetLab handles GET /api/challenges/{id}/lab. It lists the nodes of the
+// learner's lab with their state and address; terminals attach to a node
+// with the node query parameter of the terminal WebSocket.
+func (h *ChallengeHandler) GetLab(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	challengeID, ok := h.checkpointChallenge(w, r)
+	if !ok {
+		return
+	}
+	topo, _, _, ok := h.currentLab(w, r, userID, challengeID)
+	if !ok {
+		return
+	}
+	JSON(w, http.StatusOK, topo)
+}
+
+// StopLab handles DELETE /api/challenges/{id}/lab.
+func (h *ChallengeHandler) StopLab(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	challengeID, ok := h.checkpointChallenge(w, r)
+	if !ok {
+		return
+	}
+	_, labs, user, ok := h.currentLab(w, r, userID, challengeID)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), labTimeout)
+	defer cancel()
+	if err := labs.DestroyTopology(ctx, userID, user.ContainerID); err != nil && !errors.Is(err, container.ErrTopologyNotFound) {
+		slog.Error("Failed to stop lab", "error", err, "user_id", userID, "challenge_id", challengeID)
+		Error(w, http.StatusInternalServerError, "failed to stop lab")
+		return
+	}
+	JSON(w, http.StatusOK, map[string]string{"status": "stopped"})
+}
+
+// challengeTopology returns the lab nodes of a challenge, writing an error
+// response if its topology.txt cannot be read.
+func (h *ChallengeHandler) challengeTopology(w http.ResponseWriter, r *http.Request, challengeID string) ([]curriculum.Node, bool) {
+	nodes, err := h.catalog.Topology(challengeID, h.classroomOf(r))
+	if err != nil {
+		slog.Error("Failed to load challenge topology", "error", err, "challenge_id", challengeID)
+		Error(w, http.StatusInternalServerError, "failed to load challenge lab")
+		return nil, false
+	}
+	return nodes, true
+}
+
+// startLab starts nodes as the user's lab, writing an error response unless
+// all of them started.
+func (h *ChallengeHandler) startLab(w http.ResponseWriter, r *http.Request, userID, challengeID string, nodes []curriculum.Node) (*container.Topology, bool) {
+	labs, ok := h.mgr.(container.TopologyManager)
+	if !ok {
+		Error(w, http.StatusNotImplemented, "lab_unsupported")
+		return nil, false
+	}
+	user, ok := h.checkpointUser(w, r, userID)
+	if !ok {
+		return nil, false
+	}
+
+	specs := make([]container.TopologyNode, 0, len(nodes))
+	for _, node := range nodes {
+		specs = append(specs, container.TopologyNode{Name: node.Name, Image: node.Image, Env: node.Env})
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), labTimeout)
+	defer cancel()
+	topo, err := labs.CreateTopology(ctx, userID, user.ContainerID, challengeID, specs)
+	if err != nil {
+		slog.Error("Failed to start lab", "error", err, "user_id", userID, "challenge_id", challengeID)
+		Error(w, http.StatusInternalServerError, "failed to start lab")
+		return nil, false
+	}
+	return topo, true
+}
+
+// currentLab returns the user's lab if it belongs to challengeID, writing an
+// error response otherwise.
+func (h *ChallengeHandler) currentLab(w http.ResponseWriter, r *http.Request, userID, challengeID string) (*container.Topology, container.TopologyManager, *domain.User, bool) {
+	labs, ok := h.mgr.(container.TopologyManager)
+	if !ok {
+		Error(w, http.StatusNotImplemented, "lab_unsupported")
+		return nil, nil, nil, false
+	}
+	user, ok := h.checkpointUser(w, r, userID)
+	if !ok {
+		return nil, nil, nil, false
+	}
+	topo, err := labs.Topology(r.Context(), userID, user.ContainerID)
+	if errors.Is(err, container.ErrTopologyNotFound) || (err == nil && topo.Lab != challengeID) {
+		Error(w, http.StatusNotFound, "no lab running")
+		return nil, nil, nil, false
+	}
+	if err != nil {
+		slog.Error("Failed to look up lab", "error", err, "user_id", userID, "challenge_id", challengeID)
+		Error(w, http.StatusInternalServerError, "failed to look up lab")
+		return nil, nil, nil, false
+	}
+	return topo, labs, user, true
+}
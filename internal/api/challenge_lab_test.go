@@ -0,0 +1,121 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"testing/fstest"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/curriculum"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+	"github.com/go-chi/chi/v5"
+)
+
+// labManager keeps one lab in memory, like a manager with a single user.
+type labManager struct {
+	fakeManager
+	lab     *container.Topology
+	created [][]container.TopologyNode
+}
+
+func (m *labManager) CreateTopology(_ context.Context, _, _, lab string, nodes []container.TopologyNode) (*container.Topology, error) {
+	m.created = append(m.created, nodes)
+	m.lab = &container.Topology{Lab: lab, Network: "shsh-lab-test"}
+	for _, node := range nodes {
+		m.lab.Nodes = append(m.lab.Nodes, container.NodeStatus{Name: node.Name, Image: node.Image, State: "running"})
+	}
+	return m.lab, nil
+}
+
+func (m *labManager) Topology(context.Context, string, string) (*container.Topology, error) {
+	if m.lab == nil {
+		return nil, container.ErrTopologyNotFound
+	}
+	return m.lab, nil
+}
+
+func (m *labManager) DestroyTopology(context.Context, string, string) error {
+	if m.lab == nil {
+		return container.ErrTopologyNotFound
+	}
+	m.lab = nil
+	return nil
+}
+
+func (m *labManager) AttachNode(context.Context, string, string, string, container.TerminalOptions) (string, io.ReadWriteCloser, error) {
+	return "", nil, container.ErrNodeNotFound
+}
+
+func TestChallengeLabLifecycle(t *testing.T) {
+	repo := newFakeRepo()
+	mgr := &labManager{}
+	lib := curriculum.NewLibrary(fstest.MapFS{
+		"web-stack/content.md":   {Data: []byte("# Debug a web stack")},
+		"web-stack/topology.txt": {Data: []byte("client playground:latest\nweb nginx:1.27-alpine\ndb postgres:16-alpine POSTGRES_PASSWORD=lab\n")},
+		"intro/content.md":       {Data: []byte("# Intro")},
+	})
+	r := chi.NewRouter()
+	NewChallengeHandler(NewHandler(repo, mgr, terminal.NewSessionManager(), ""), lib).RegisterRoutes(r)
+	if err := repo.UpsertUser(t.Context(), &domain.User{UserID: provisionTestUser, ContainerID: "container-1"}); err != nil {
+		t.Fatalf("upsert user: %v", err)
+	}
+
+	// Starting the challenge starts its lab.
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/web-stack/start", ""); rr.Code != http.StatusCreated {
+		t.Fatalf("start: expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(mgr.created) != 1 || len(mgr.created[0]) != 3 || mgr.created[0][2].Env[0] != "POSTGRES_PASSWORD=lab" {
+		t.Fatalf("unexpected lab nodes %+v", mgr.created)
+	}
+
+	rr := serveCheckpoint(repo, r, http.MethodGet, "/api/challenges/web-stack/lab", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("get: expected 200, got %d", rr.Code)
+	}
+	var topo container.Topology
+	if err := json.NewDecoder(rr.Body).Decode(&topo); err != nil {
+		t.Fatalf("decode lab: %v", err)
+	}
+	if topo.Lab != "web-stack" || len(topo.Nodes) != 3 || topo.Nodes[1].Name != "web" {
+		t.Fatalf("unexpected lab %+v", topo)
+	}
+	if rr := serveCheckpoint(repo, r, http.MethodGet, "/api/challenges/intro/lab", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for another challenge's lab, got %d", rr.Code)
+	}
+
+	// Restarting the lab replaces it.
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/web-stack/lab", ""); rr.Code != http.StatusCreated || len(mgr.created) != 2 {
+		t.Fatalf("restart lab: %d with %d creations", rr.Code, len(mgr.created))
+	}
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/intro/lab", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a challenge without a lab, got %d", rr.Code)
+	}
+
+	if rr := serveCheckpoint(repo, r, http.MethodDelete, "/api/challenges/web-stack/lab", ""); rr.Code != http.StatusOK {
+		t.Fatalf("stop: expected 200, got %d", rr.Code)
+	}
+	if rr := serveCheckpoint(repo, r, http.MethodGet, "/api/challenges/web-stack/lab", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after stopping, got %d", rr.Code)
+	}
+}
+
+func TestChallengeLabUnsupported(t *testing.T) {
+	repo := newFakeRepo()
+	lib := curriculum.NewLibrary(fstest.MapFS{
+		"web-stack/content.md":   {Data: []byte("# Debug a web stack")},
+		"web-stack/topology.txt": {Data: []byte("web nginx:1.27-alpine\n")},
+	})
+	r := chi.NewRouter()
+	NewChallengeHandler(NewHandler(repo, &fakeManager{}, terminal.NewSessionManager(), ""), lib).RegisterRoutes(r)
+	if err := repo.UpsertUser(t.Context(), &domain.User{UserID: provisionTestUser, ContainerID: "container-1"}); err != nil {
+		t.Fatalf("upsert user: %v", err)
+	}
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/web-stack/lab", ""); rr.Code != http.StatusNotImplemented {
+		t.Fatalf("expected 501, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/curriculum"
+)
+
+// installPreStop installs the challenge's pre-stop hook, if it has one, in
+// the user's container, writing an error response if it cannot be.
+func (h *ChallengeHandler) installPreStop(w http.ResponseWriter, r *http.Request, userID, challengeID string) bool {
+	hook, err := h.catalog.PreStop(challengeID, h.classroomOf(r))
+	if err != nil {
+		slog.Error("Failed to load challenge pre-stop hook", "error", err, "challenge_id", challengeID)
+		Error(w, http.StatusInternalServerError, "failed to load challenge pre-stop hook")
+		return false
+	}
+	if hook == "" {
+		return true
+	}
+	runner, ok := h.mgr.(container.HookRunner)
+	if !ok {
+		Error(w, http.StatusNotImplemented, "hooks_unsupported")
+		return false
+	}
+	user, ok := h.checkpointUser(w, r, userID)
+	if !ok {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), faultTimeout)
+	defer cancel()
+	exitCode, err := runner.RunHook(ctx, user.ContainerID, curriculum.PreStopInstallScript(challengeID, hook))
+	if err != nil || exitCode != 0 {
+		slog.Error("Failed to install challenge pre-stop hook", "error", err, "exit_code", exitCode, "user_id", userID, "challenge_id", challengeID)
+		Error(w, http.StatusInternalServerError, "failed to install pre-stop hook")
+		return false
+	}
+	slog.Info("Challenge pre-stop hook installed", "user_id", userID, "challenge_id", challengeID)
+	return true
+}
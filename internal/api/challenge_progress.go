@@ -0,0 +1,203 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+)
+
+// GetProgress handles GET /api/challenges/progress. It lists the challenges
+// the user has started and completed, which outlive their container.
+func (h *ChallengeHandler) GetProgress(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	assignments, err := h.repo.ListChallengeAssignments(r.Context(), userID)
+	if err != nil {
+		slog.Error("Failed to list challenge assignments", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to load challenge progress")
+		return
+	}
+	completions, err := h.repo.ListChallengeCompletions(r.Context(), userID)
+	if err != nil {
+		slog.Error("Failed to list challenge completions", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to load challenge progress")
+		return
+	}
+	if assignments == nil {
+		assignments = []*domain.ChallengeAssignment{}
+	}
+	if completions == nil {
+		completions = []*domain.ChallengeCompletion{}
+	}
+	JSON(w, http.StatusOK, map[string]interface{}{"assignments": assignments, "completions": completions})
+}
+
+// StartChallenge handles POST /api/challenges/{id}/start. Starting a
+// challenge again returns the existing assignment unchanged. A challenge
+// with a faults.txt first breaks the learner's container as it describes,
+// one with a pre-stop.sh installs it there, and one with a topology.txt
+// starts its lab; it is not started if any of these fails.
+func (h *ChallengeHandler) StartChallenge(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	challengeID, ok := h.checkpointChallenge(w, r)
+	if !ok {
+		return
+	}
+	existing, ok := h.challengeAssignment(w, r, userID, challengeID)
+	if !ok {
+		return
+	}
+	if existing != nil {
+		JSON(w, http.StatusOK, existing)
+		return
+	}
+
+	content, err := h.catalog.Content(challengeID, h.classroomOf(r))
+	if err != nil {
+		slog.Error("Failed to load challenge content", "error", err, "challenge_id", challengeID)
+		Error(w, http.StatusInternalServerError, "failed to load challenge content")
+		return
+	}
+	faults, ok := h.challengeFaults(w, r, challengeID)
+	if !ok {
+		return
+	}
+	if len(faults) > 0 && !h.injectFaults(w, r, userID, challengeID, faults) {
+		return
+	}
+	if !h.installPreStop(w, r, userID, challengeID) {
+		return
+	}
+	nodes, ok := h.challengeTopology(w, r, challengeID)
+	if !ok {
+		return
+	}
+	if len(nodes) > 0 {
+		if _, ok := h.startLab(w, r, userID, challengeID, nodes); !ok {
+			return
+		}
+	}
+
+	now := time.Now()
+	assignment := &domain.ChallengeAssignment{
+		UserID:     userID,
+		Challenge:  domain.Challenge{ID: challengeID, Title: content.Title},
+		AssignedAt: now,
+		UpdatedAt:  now,
+	}
+	if err := h.repo.UpsertChallengeAssignment(r.Context(), assignment); err != nil {
+		slog.Error("Failed to store challenge assignment", "error", err, "user_id", userID, "challenge_id", challengeID)
+		Error(w, http.StatusInternalServerError, "failed to start challenge")
+		return
+	}
+	JSON(w, http.StatusCreated, assignment)
+}
+
+// RecordAttempt handles POST /api/challenges/{id}/attempts with a body of
+// {"step": N, "passed": bool}.
+func (h *ChallengeHandler) RecordAttempt(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	challengeID, ok := h.checkpointChallenge(w, r)
+	if !ok {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 4*1024)
+	var req struct {
+		Step   *int `json:"step"`
+		Passed bool `json:"passed"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Step == nil {
+		Error(w, http.StatusBadRequest, "step is required")
+		return
+	}
+	if *req.Step < 0 || *req.Step >= maxChallengeStep {
+		Error(w, http.StatusBadRequest, "invalid step")
+		return
+	}
+
+	attempt := &domain.ChallengeAttempt{
+		UserID:      userID,
+		ChallengeID: challengeID,
+		Step:        *req.Step,
+		Passed:      req.Passed,
+		AttemptedAt: time.Now(),
+	}
+	if err := h.repo.InsertChallengeAttempt(r.Context(), attempt); err != nil {
+		slog.Error("Failed to store challenge attempt", "error", err, "user_id", userID, "challenge_id", challengeID)
+		Error(w, http.StatusInternalServerError, "failed to record attempt")
+		return
+	}
+	JSON(w, http.StatusCreated, attempt)
+}
+
+// CompleteChallenge handles POST /api/challenges/{id}/complete. The first
+// completion is kept, with the attempts and hints it took; completing the
+// challenge again returns it with "first" set to false.
+func (h *ChallengeHandler) CompleteChallenge(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	challengeID, ok := h.checkpointChallenge(w, r)
+	if !ok {
+		return
+	}
+	assignment, ok := h.challengeAssignment(w, r, userID, challengeID)
+	if !ok {
+		return
+	}
+	attempts, err := h.repo.ListChallengeAttempts(r.Context(), userID, challengeID)
+	if err != nil {
+		slog.Error("Failed to list challenge attempts", "error", err, "user_id", userID, "challenge_id", challengeID)
+		Error(w, http.StatusInternalServerError, "failed to complete challenge")
+		return
+	}
+
+	completion := &domain.ChallengeCompletion{
+		UserID:      userID,
+		ChallengeID: challengeID,
+		Attempts:    len(attempts),
+		CompletedAt: time.Now(),
+	}
+	if assignment != nil {
+		completion.HintsUsed = assignment.HintsUsed
+	}
+	first, err := h.repo.CompleteChallenge(r.Context(), completion)
+	if err != nil {
+		slog.Error("Failed to store challenge completion", "error", err, "user_id", userID, "challenge_id", challengeID)
+		Error(w, http.StatusInternalServerError, "failed to complete challenge")
+		return
+	}
+	if !first {
+		completions, err := h.repo.ListChallengeCompletions(r.Context(), userID)
+		if err != nil {
+			slog.Error("Failed to list challenge completions", "error", err, "user_id", userID)
+			Error(w, http.StatusInternalServerError, "failed to complete challenge")
+			return
+		}
+		for _, c := range completions {
+			if c.ChallengeID == challengeID {
+				completion = c
+				break
+			}
+		}
+	}
+	JSON(w, http.StatusOK, map[string]interface{}{"completion": completion, "first": first})
+}
+
+// challengeAssignment returns the user's assignment to a challenge, or nil
+// if they have not started it, writing an error response on failure.
+func (h *ChallengeHandler) challengeAssignment(w http.ResponseWriter, r *http.Request, userID, challengeID string) (*domain.ChallengeAssignment, bool) {
+	assignments, err := h.repo.ListChallengeAssignments(r.Context(), userID)
+	if err != nil {
+		slog.Error("Failed to list challenge assignments", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to load challenge progress")
+		return nil, false
+	}
+	for _, a := range assignments {
+		if a.Challenge.ID == challengeID {
+			return a, true
+		}
+	}
+	return nil, true
+}
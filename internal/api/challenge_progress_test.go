@@ -0,0 +1,62 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+)
+
+func TestChallengeProgressPersistsAttemptsAndCompletion(t *testing.T) {
+	repo := newFakeRepo()
+	r := newCheckpointRouter(repo, &checkpointManager{})
+
+	rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/intro/start", "")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("start status = %d: %s", rr.Code, rr.Body.String())
+	}
+	var assignment domain.ChallengeAssignment
+	if err := json.Unmarshal(rr.Body.Bytes(), &assignment); err != nil || assignment.Challenge.Title != "Intro" {
+		t.Fatalf("unexpected assignment %s: %v", rr.Body.String(), err)
+	}
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/intro/start", ""); rr.Code != http.StatusOK {
+		t.Fatalf("restart status = %d", rr.Code)
+	}
+
+	for _, body := range []string{`{"step": 1, "passed": false}`, `{"step": 1, "passed": true}`} {
+		if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/intro/attempts", body); rr.Code != http.StatusCreated {
+			t.Fatalf("attempt status = %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/intro/attempts", `{"passed": true}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("attempt without step status = %d", rr.Code)
+	}
+
+	var completed struct {
+		Completion domain.ChallengeCompletion `json:"completion"`
+		First      bool                       `json:"first"`
+	}
+	rr = serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/intro/complete", "")
+	if err := json.Unmarshal(rr.Body.Bytes(), &completed); err != nil || !completed.First || completed.Completion.Attempts != 2 {
+		t.Fatalf("unexpected completion %d %s: %v", rr.Code, rr.Body.String(), err)
+	}
+	serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/intro/attempts", `{"step": 2, "passed": true}`)
+	rr = serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/intro/complete", "")
+	if err := json.Unmarshal(rr.Body.Bytes(), &completed); err != nil || completed.First || completed.Completion.Attempts != 2 {
+		t.Fatalf("repeat completion should keep the first: %s", rr.Body.String())
+	}
+
+	rr = serveCheckpoint(repo, r, http.MethodGet, "/api/challenges/progress", "")
+	var progress struct {
+		Assignments []domain.ChallengeAssignment `json:"assignments"`
+		Completions []domain.ChallengeCompletion `json:"completions"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &progress); err != nil || len(progress.Assignments) != 1 || len(progress.Completions) != 1 {
+		t.Fatalf("unexpected progress %s: %v", rr.Body.String(), err)
+	}
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/missing/start", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("unknown challenge status = %d", rr.Code)
+	}
+}
@@ -0,0 +1,326 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/handoff"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// learnerUID is the user learners' shells run as.
+	learnerUID = "1000"
+	// sudoGrantFile is the sudoers drop-in holding a learner's grant.
+	sudoGrantFile = "/etc/sudoers.d/shsh-grant"
+	// sudoIOLogDir is where sudo records the output of commands run under
+	// a grant, for instructors to review.
+	sudoIOLogDir = "/var/log/sudo-io/shsh"
+	// sudoHookTimeout bounds writing or removing a grant.
+	sudoHookTimeout = 30 * time.Second
+	// exitSudoMissing is the exit code of the grant script in an image
+	// without sudo.
+	exitSudoMissing = 3
+)
+
+// sudoGrant is a learner's temporary root access in their container.
+type sudoGrant struct {
+	ChallengeID string    `json:"challenge_id"`
+	GrantedAt   time.Time `json:"granted_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+
+	containerID string
+	timer       *time.Timer
+}
+
+// sudoTracker holds the grant of each user, at most one at a time.
+type sudoTracker struct {
+	mu     sync.Mutex
+	grants map[string]*sudoGrant
+}
+
+func newSudoTracker() *sudoTracker {
+	return &sudoTracker{grants: make(map[string]*sudoGrant)}
+}
+
+// put records g as the user's grant, replacing and returning the previous
+// one so its timer no longer revokes it.
+func (t *sudoTracker) put(userID string, g *sudoGrant) *sudoGrant {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	prev := t.grants[userID]
+	if prev != nil {
+		prev.timer.Stop()
+	}
+	t.grants[userID] = g
+	return prev
+}
+
+// get returns a copy of the user's grant in challengeID.
+func (t *sudoTracker) get(userID, challengeID string) (sudoGrant, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	g := t.grants[userID]
+	if g == nil || g.ChallengeID != challengeID {
+		return sudoGrant{}, false
+	}
+	return *g, true
+}
+
+// take forgets the user's grant if it is g, or, when g is nil, their grant
+// in challengeID or in any challenge if challengeID is empty, and returns it.
+func (t *sudoTracker) take(userID, challengeID string, g *sudoGrant) *sudoGrant {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cur := t.grants[userID]
+	if cur == nil || (g != nil && cur != g) || (g == nil && challengeID != "" && cur.ChallengeID != challengeID) {
+		return nil
+	}
+	cur.timer.Stop()
+	delete(t.grants, userID)
+	return cur
+}
+
+// handoff returns every grant for the process replacing this one.
+func (t *sudoTracker) handoff() []handoff.SudoGrant {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	grants := make([]handoff.SudoGrant, 0, len(t.grants))
+	for userID, g := range t.grants {
+		grants = append(grants, handoff.SudoGrant{
+			UserID:      userID,
+			ChallengeID: g.ChallengeID,
+			ContainerID: g.containerID,
+			GrantedAt:   g.GrantedAt,
+			ExpiresAt:   g.ExpiresAt,
+		})
+	}
+	return grants
+}
+
+// sudoGrantRequest is the body of POST /api/admin/users/{userID}/sudo.
+type sudoGrantRequest struct {
+	ChallengeID     string `json:"challenge_id"`
+	DurationSeconds int64  `json:"duration_seconds"`
+}
+
+// sudoEnabled reports whether some challenge may grant sudo.
+func (h *ChallengeHandler) sudoEnabled() bool {
+	return h.cfg != nil && len(h.cfg.Sudo.Challenges) > 0
+}
+
+// GrantSudo handles POST /api/admin/users/{userID}/sudo, behind the admin
+// token: a learner's session cannot grant itself root.
+// It lets the learner run sudo in their container for duration_seconds,
+// capped at SHSH_SUDO_MAX_DURATION, in challenges listed in
+// SHSH_SUDO_CHALLENGES, so an instructor or lesson tooling can hand out root
+// for the step that needs it. Granting again replaces the running grant. The
+// grant is revoked when it expires or on DELETE; the container also removes
+// it on its own at expiry, so a server restart cannot leave it behind.
+// Grants and revocations are recorded in the container audit log, and sudo
+// logs the output of every command run under a grant to sudoIOLogDir.
+//
+// Revocation is best-effort. It removes the sudoers entry and ends running
+// sudo commands, but root can leave things behind that outlive it, such as a
+// setuid binary or another sudoers file. Only recycling the container
+// guarantees the learner no longer has root.
+func (h *ChallengeHandler) GrantSudo(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	r.Body = http.MaxBytesReader(w, r.Body, 4*1024)
+	var req sudoGrantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	challengeID := req.ChallengeID
+	if h.cfg == nil || !h.cfg.Sudo.Allows(challengeID) {
+		Error(w, http.StatusForbidden, "sudo_not_enabled")
+		return
+	}
+	if req.DurationSeconds <= 0 {
+		Error(w, http.StatusBadRequest, "duration_seconds must be positive")
+		return
+	}
+	runner, ok := h.mgr.(container.HookRunner)
+	if !ok {
+		Error(w, http.StatusNotImplemented, "sudo_unsupported")
+		return
+	}
+	user, err := h.repo.GetUser(r.Context(), userID)
+	if err != nil || user == nil {
+		Error(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if user.ContainerID == "" {
+		Error(w, http.StatusConflict, "no active container")
+		return
+	}
+
+	duration := h.cfg.Sudo.MaxDuration
+	if req.DurationSeconds < int64(duration/time.Second) {
+		duration = time.Duration(req.DurationSeconds) * time.Second
+	}
+	now := time.Now()
+	g := &sudoGrant{ChallengeID: challengeID, GrantedAt: now, ExpiresAt: now.Add(duration), containerID: user.ContainerID}
+
+	ctx, cancel := context.WithTimeout(r.Context(), sudoHookTimeout)
+	defer cancel()
+	exitCode, err := runner.RunHook(ctx, user.ContainerID, sudoGrantScript(g.ExpiresAt, duration))
+	if err == nil && exitCode == exitSudoMissing {
+		Error(w, http.StatusConflict, "sudo_not_installed")
+		return
+	}
+	if err != nil || exitCode != 0 {
+		slog.Error("Failed to grant sudo", "error", err, "exit_code", exitCode, "user_id", userID, "challenge_id", challengeID)
+		Error(w, http.StatusInternalServerError, "failed to grant sudo")
+		return
+	}
+
+	if prev := h.armSudo(runner, userID, g); prev != nil && prev.containerID != g.containerID {
+		h.revokeSudo(r.Context(), runner, userID, prev, container.ReasonSudoReleased)
+	}
+	container.RecordEvent(r.Context(), h.repo, userID, user.ContainerID, domain.ContainerEventSudoGrant, challengeID)
+	slog.Info("Sudo granted", "user_id", userID, "challenge_id", challengeID, "container_id", user.ContainerID, "expires_at", g.ExpiresAt)
+	JSON(w, http.StatusCreated, g)
+}
+
+// GetSudo handles GET /api/challenges/{id}/sudo with the learner's grant.
+func (h *ChallengeHandler) GetSudo(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	challengeID, ok := h.checkpointChallenge(w, r)
+	if !ok {
+		return
+	}
+	g, ok := h.sudo.get(userID, challengeID)
+	if !ok {
+		Error(w, http.StatusNotFound, "sudo grant not found")
+		return
+	}
+	JSON(w, http.StatusOK, g)
+}
+
+// RevokeSudo handles DELETE /api/challenges/{id}/sudo, with which the
+// learner gives up their grant before it expires.
+func (h *ChallengeHandler) RevokeSudo(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	challengeID, ok := h.checkpointChallenge(w, r)
+	if !ok {
+		return
+	}
+	h.revokeSudoOf(w, r, userID, challengeID)
+}
+
+// RevokeUserSudo handles DELETE /api/admin/users/{userID}/sudo, ending the
+// learner's grant in whichever challenge it was given.
+func (h *ChallengeHandler) RevokeUserSudo(w http.ResponseWriter, r *http.Request) {
+	h.revokeSudoOf(w, r, chi.URLParam(r, "userID"), "")
+}
+
+// revokeSudoOf revokes the user's grant in challengeID, or in any challenge
+// if challengeID is empty.
+func (h *ChallengeHandler) revokeSudoOf(w http.ResponseWriter, r *http.Request, userID, challengeID string) {
+	runner, ok := h.mgr.(container.HookRunner)
+	if !ok {
+		Error(w, http.StatusNotImplemented, "sudo_unsupported")
+		return
+	}
+	g := h.sudo.take(userID, challengeID, nil)
+	if g == nil {
+		Error(w, http.StatusNotFound, "sudo grant not found")
+		return
+	}
+	if !h.revokeSudo(r.Context(), runner, userID, g, container.ReasonSudoReleased) {
+		Error(w, http.StatusInternalServerError, "failed to revoke sudo")
+		return
+	}
+	JSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+// armSudo records g as the user's grant and revokes it at expiry, returning
+// the grant it replaces.
+func (h *ChallengeHandler) armSudo(runner container.HookRunner, userID string, g *sudoGrant) *sudoGrant {
+	g.timer = time.AfterFunc(time.Until(g.ExpiresAt), func() {
+		if h.sudo.take(userID, g.ChallengeID, g) != nil {
+			h.revokeSudo(context.Background(), runner, userID, g, container.ReasonSudoExpired)
+		}
+	})
+	return h.sudo.put(userID, g)
+}
+
+// SudoGrants returns the running grants for the process replacing this one.
+func (h *ChallengeHandler) SudoGrants() []handoff.SudoGrant {
+	return h.sudo.handoff()
+}
+
+// ResumeSudoGrants takes over the grants of the process this one replaces,
+// so they are reported and revoked on time. Grants that expired in between
+// are revoked now, ending sudo commands the container's own removal left
+// running; grants of containers since replaced went with them.
+func (h *ChallengeHandler) ResumeSudoGrants(ctx context.Context, grants []handoff.SudoGrant) {
+	runner, ok := h.mgr.(container.HookRunner)
+	if !ok {
+		return
+	}
+	for _, resumed := range grants {
+		user, err := h.repo.GetUser(ctx, resumed.UserID)
+		if err != nil || user == nil || user.ContainerID != resumed.ContainerID {
+			continue
+		}
+		g := &sudoGrant{
+			ChallengeID: resumed.ChallengeID,
+			GrantedAt:   resumed.GrantedAt,
+			ExpiresAt:   resumed.ExpiresAt,
+			containerID: resumed.ContainerID,
+		}
+		if !time.Now().Before(g.ExpiresAt) {
+			h.revokeSudo(ctx, runner, resumed.UserID, g, container.ReasonSudoExpired)
+			continue
+		}
+		h.armSudo(runner, resumed.UserID, g)
+		slog.Info("Sudo grant resumed", "user_id", resumed.UserID, "challenge_id", g.ChallengeID, "expires_at", g.ExpiresAt)
+	}
+}
+
+// revokeSudo removes a grant from its container and ends the sudo commands
+// still running under it. A container that is gone has nothing to revoke,
+// so only a failed removal is reported.
+func (h *ChallengeHandler) revokeSudo(ctx context.Context, runner container.HookRunner, userID string, g *sudoGrant, reason string) bool {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sudoHookTimeout)
+	defer cancel()
+	exitCode, err := runner.RunHook(ctx, g.containerID, sudoRevokeScript)
+	if err == nil && exitCode != 0 {
+		slog.Error("Failed to revoke sudo", "exit_code", exitCode, "user_id", userID, "challenge_id", g.ChallengeID, "container_id", g.containerID)
+		return false
+	}
+	container.RecordEvent(ctx, h.repo, userID, g.containerID, domain.ContainerEventSudoRevoke, reason)
+	slog.Info("Sudo revoked", "user_id", userID, "challenge_id", g.ChallengeID, "container_id", g.containerID, "reason", reason, "error", err)
+	return true
+}
+
+// sudoGrantScript installs a grant for the learner, uid 1000, that logs the
+// output of their sudo commands, and schedules its removal inside the
+// container at expiry. The grant is tagged with its expiry so the removal
+// leaves a later grant alone. The logs stay after the grant is removed.
+func sudoGrantScript(expiresAt time.Time, duration time.Duration) string {
+	tag := fmt.Sprintf("# shsh grant expires %d", expiresAt.Unix())
+	return fmt.Sprintf(`set -e
+command -v sudo >/dev/null 2>&1 || exit %d
+printf '%%s\n' '%s' 'Defaults:#%s log_output, iolog_dir=%s' '#%s ALL=(ALL) NOPASSWD:ALL' > %s.tmp
+chmod 0440 %s.tmp
+mv -f %s.tmp %s
+nohup sh -c 'sleep %d; grep -qx -- "%s" %s && rm -f %s' </dev/null >/dev/null 2>&1 &
+`, exitSudoMissing, tag, learnerUID, sudoIOLogDir, learnerUID, sudoGrantFile, sudoGrantFile, sudoGrantFile, sudoGrantFile,
+		int64(duration.Round(time.Second)/time.Second), tag, sudoGrantFile, sudoGrantFile)
+}
+
+// sudoRevokeScript removes a grant and stops the commands running under it;
+// sudo passes the signal on to them.
+var sudoRevokeScript = fmt.Sprintf("rm -f %s\npkill -TERM -x sudo || true\n", sudoGrantFile)
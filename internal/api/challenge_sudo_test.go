@@ -0,0 +1,282 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/curriculum"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/handoff"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+	"github.com/go-chi/chi/v5"
+)
+
+// sudoHookManager records hooks and the containers they ran in; expiry runs
+// them from a timer goroutine.
+type sudoHookManager struct {
+	fakeManager
+	mu    sync.Mutex
+	hooks []sudoHook
+	ran   chan struct{}
+}
+
+type sudoHook struct {
+	containerID, script string
+}
+
+func newSudoHookManager() *sudoHookManager {
+	return &sudoHookManager{ran: make(chan struct{}, 16)}
+}
+
+func (m *sudoHookManager) RunHook(_ context.Context, containerID, script string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, sudoHook{containerID: containerID, script: script})
+	select {
+	case m.ran <- struct{}{}:
+	default:
+	}
+	return 0, nil
+}
+
+func (m *sudoHookManager) Hooks() []sudoHook {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.hooks)
+}
+
+const sudoAdminToken = "admin-token"
+
+// newSudoRouter serves the challenge and admin routes with sudo enabled in
+// admin-lab.
+func newSudoRouter(t *testing.T, repo *fakeRepo, mgr container.Manager) (*ChallengeHandler, chi.Router) {
+	t.Helper()
+	lib := curriculum.NewLibrary(fstest.MapFS{
+		"admin-lab/content.md": {Data: []byte("# Manage services")},
+		"intro/content.md":     {Data: []byte("# Intro")},
+	})
+	cfg := &config.Config{
+		Sudo:  config.SudoConfig{Challenges: []string{"admin-lab"}, MaxDuration: 10 * time.Minute},
+		Admin: config.AdminConfig{Token: sudoAdminToken},
+	}
+	base := NewHandler(repo, mgr, terminal.NewSessionManager(), "")
+	h := NewChallengeHandler(base, lib, WithConfig(cfg))
+	admin := NewAdminHandler(base, cfg)
+	admin.SetSudo(h)
+	r := chi.NewRouter()
+	h.RegisterRoutes(r)
+	admin.RegisterRoutes(r)
+	if err := repo.UpsertUser(t.Context(), &domain.User{UserID: provisionTestUser, ContainerID: "container-1"}); err != nil {
+		t.Fatalf("upsert user: %v", err)
+	}
+	return h, r
+}
+
+func grantSudo(r http.Handler, body string) *httptest.ResponseRecorder {
+	return doAdminRequest(r, http.MethodPost, "/api/admin/users/"+provisionTestUser+"/sudo", sudoAdminToken, body)
+}
+
+func TestChallengeSudoGrantIsBoundedAndAudited(t *testing.T) {
+	repo := newFakeRepo()
+	mgr := newSudoHookManager()
+	_, r := newSudoRouter(t, repo, mgr)
+
+	// The learner's session cannot grant itself sudo.
+	if rr := serveCheckpoint(repo, r, http.MethodPost, "/api/challenges/admin-lab/sudo", `{"duration_seconds":60}`); rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for a learner grant, got %d", rr.Code)
+	}
+	if rr := doAdminRequest(r, http.MethodPost, "/api/admin/users/"+provisionTestUser+"/sudo", "wrong", `{"challenge_id":"admin-lab","duration_seconds":60}`); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without the admin token, got %d", rr.Code)
+	}
+	if rr := grantSudo(r, `{"challenge_id":"intro","duration_seconds":60}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a challenge without sudo, got %d", rr.Code)
+	}
+	if rr := doAdminRequest(r, http.MethodPost, "/api/admin/users/nobody/sudo", sudoAdminToken, `{"challenge_id":"admin-lab","duration_seconds":60}`); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown user, got %d", rr.Code)
+	}
+
+	// Longer grants are capped at the configured maximum.
+	rr := grantSudo(r, `{"challenge_id":"admin-lab","duration_seconds":86400}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("grant: expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var grant sudoGrant
+	if err := json.NewDecoder(rr.Body).Decode(&grant); err != nil {
+		t.Fatalf("decode grant: %v", err)
+	}
+	if d := grant.ExpiresAt.Sub(grant.GrantedAt); d != 10*time.Minute {
+		t.Fatalf("expected a 10m grant, got %v", d)
+	}
+	hooks := mgr.Hooks()
+	if len(hooks) != 1 || hooks[0].containerID != "container-1" ||
+		!strings.Contains(hooks[0].script, "'Defaults:#1000 log_output, iolog_dir=/var/log/sudo-io/shsh' '#1000 ALL=(ALL) NOPASSWD:ALL' > /etc/sudoers.d/shsh-grant.tmp") ||
+		!strings.Contains(hooks[0].script, "sleep 600;") {
+		t.Fatalf("unexpected grant hook %q", hooks)
+	}
+	if rr := serveCheckpoint(repo, r, http.MethodGet, "/api/challenges/admin-lab/sudo", ""); rr.Code != http.StatusOK {
+		t.Fatalf("status: expected 200, got %d", rr.Code)
+	}
+
+	// The learner may give the grant up early.
+	if rr := serveCheckpoint(repo, r, http.MethodDelete, "/api/challenges/admin-lab/sudo", ""); rr.Code != http.StatusOK {
+		t.Fatalf("revoke: expected 200, got %d", rr.Code)
+	}
+	if hooks := mgr.Hooks(); len(hooks) != 2 || !strings.Contains(hooks[1].script, "rm -f /etc/sudoers.d/shsh-grant") {
+		t.Fatalf("unexpected revoke hook %q", hooks)
+	}
+	if rr := serveCheckpoint(repo, r, http.MethodGet, "/api/challenges/admin-lab/sudo", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after revoking, got %d", rr.Code)
+	}
+
+	events, err := repo.ListContainerEvents(t.Context(), provisionTestUser, 10)
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 2 || events[1].Event != domain.ContainerEventSudoGrant || events[1].Reason != "admin-lab" ||
+		events[0].Event != domain.ContainerEventSudoRevoke || events[0].Reason != "sudo_released" {
+		t.Fatalf("unexpected audit events %+v", events)
+	}
+}
+
+func TestChallengeSudoGrantReplacesPrevious(t *testing.T) {
+	repo := newFakeRepo()
+	mgr := newSudoHookManager()
+	h, r := newSudoRouter(t, repo, mgr)
+
+	if rr := grantSudo(r, `{"challenge_id":"admin-lab","duration_seconds":60}`); rr.Code != http.StatusCreated {
+		t.Fatalf("grant: expected 201, got %d", rr.Code)
+	}
+	// A grant in the same container overwrites the sudoers entry.
+	if rr := grantSudo(r, `{"challenge_id":"admin-lab","duration_seconds":120}`); rr.Code != http.StatusCreated {
+		t.Fatalf("regrant: expected 201, got %d", rr.Code)
+	}
+	if hooks := mgr.Hooks(); len(hooks) != 2 || hooks[1].script == sudoRevokeScript {
+		t.Fatalf("expected two grants and no revocation, got %q", hooks)
+	}
+	if got := h.SudoGrants(); len(got) != 1 || got[0].ExpiresAt.Sub(got[0].GrantedAt) != 2*time.Minute {
+		t.Fatalf("expected only the second grant, got %+v", got)
+	}
+
+	// A grant in a new container revokes the one left in the old container.
+	if err := repo.UpsertUser(t.Context(), &domain.User{UserID: provisionTestUser, ContainerID: "container-2"}); err != nil {
+		t.Fatalf("upsert user: %v", err)
+	}
+	if rr := grantSudo(r, `{"challenge_id":"admin-lab","duration_seconds":60}`); rr.Code != http.StatusCreated {
+		t.Fatalf("grant in new container: expected 201, got %d", rr.Code)
+	}
+	hooks := mgr.Hooks()
+	if len(hooks) != 4 || hooks[2].containerID != "container-2" ||
+		hooks[3].containerID != "container-1" || hooks[3].script != sudoRevokeScript {
+		t.Fatalf("expected the old container's grant to be revoked, got %q", hooks)
+	}
+	if got := h.SudoGrants(); len(got) != 1 || got[0].ContainerID != "container-2" {
+		t.Fatalf("unexpected grants %+v", got)
+	}
+}
+
+func TestChallengeSudoGrantExpires(t *testing.T) {
+	repo := newFakeRepo()
+	mgr := newSudoHookManager()
+	h, _ := newSudoRouter(t, repo, mgr)
+
+	now := time.Now()
+	h.armSudo(mgr, provisionTestUser, &sudoGrant{ChallengeID: "admin-lab", GrantedAt: now, ExpiresAt: now.Add(10 * time.Millisecond), containerID: "container-1"})
+	select {
+	case <-mgr.ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("grant was not revoked at expiry")
+	}
+	if hooks := mgr.Hooks(); len(hooks) != 1 || hooks[0].script != sudoRevokeScript {
+		t.Fatalf("unexpected hooks %q", hooks)
+	}
+	if got := h.SudoGrants(); len(got) != 0 {
+		t.Fatalf("expected no grants after expiry, got %+v", got)
+	}
+	// The event is recorded after the hook; wait for it.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		events, err := repo.ListContainerEvents(t.Context(), provisionTestUser, 10)
+		if err != nil {
+			t.Fatalf("list events: %v", err)
+		}
+		if len(events) == 1 && events[0].Event == domain.ContainerEventSudoRevoke && events[0].Reason == "sudo_expired" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected audit events %+v", events)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestChallengeSudoAdminRevoke(t *testing.T) {
+	repo := newFakeRepo()
+	mgr := newSudoHookManager()
+	h, r := newSudoRouter(t, repo, mgr)
+
+	if rr := doAdminRequest(r, http.MethodDelete, "/api/admin/users/"+provisionTestUser+"/sudo", sudoAdminToken, ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without a grant, got %d", rr.Code)
+	}
+	if rr := grantSudo(r, `{"challenge_id":"admin-lab","duration_seconds":60}`); rr.Code != http.StatusCreated {
+		t.Fatalf("grant: expected 201, got %d", rr.Code)
+	}
+	if rr := doAdminRequest(r, http.MethodDelete, "/api/admin/users/"+provisionTestUser+"/sudo", sudoAdminToken, ""); rr.Code != http.StatusOK {
+		t.Fatalf("revoke: expected 200, got %d", rr.Code)
+	}
+	if hooks := mgr.Hooks(); len(hooks) != 2 || hooks[1].script != sudoRevokeScript {
+		t.Fatalf("unexpected hooks %q", hooks)
+	}
+	if got := h.SudoGrants(); len(got) != 0 {
+		t.Fatalf("expected no grants after revoking, got %+v", got)
+	}
+}
+
+func TestChallengeSudoGrantsResumeAfterRestart(t *testing.T) {
+	repo := newFakeRepo()
+	mgr := &hookManager{}
+	lib := curriculum.NewLibrary(fstest.MapFS{"admin-lab/content.md": {Data: []byte("# Manage services")}})
+	cfg := &config.Config{Sudo: config.SudoConfig{Challenges: []string{"admin-lab"}, MaxDuration: 10 * time.Minute}}
+	h := NewChallengeHandler(NewHandler(repo, mgr, terminal.NewSessionManager(), ""), lib, WithConfig(cfg))
+	r := chi.NewRouter()
+	h.RegisterRoutes(r)
+	for userID, containerID := range map[string]string{provisionTestUser: "container-1", "expired": "container-2", "replaced": "container-4"} {
+		if err := repo.UpsertUser(t.Context(), &domain.User{UserID: userID, ContainerID: containerID}); err != nil {
+			t.Fatalf("upsert user: %v", err)
+		}
+	}
+
+	now := time.Now()
+	h.ResumeSudoGrants(t.Context(), []handoff.SudoGrant{
+		{UserID: provisionTestUser, ChallengeID: "admin-lab", ContainerID: "container-1", GrantedAt: now.Add(-time.Minute), ExpiresAt: now.Add(time.Minute)},
+		{UserID: "expired", ChallengeID: "admin-lab", ContainerID: "container-2", GrantedAt: now.Add(-2 * time.Minute), ExpiresAt: now.Add(-time.Minute)},
+		{UserID: "replaced", ChallengeID: "admin-lab", ContainerID: "container-3", GrantedAt: now.Add(-time.Minute), ExpiresAt: now.Add(time.Minute)},
+	})
+
+	if rr := serveCheckpoint(repo, r, http.MethodGet, "/api/challenges/admin-lab/sudo", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected the running grant to be resumed, got %d", rr.Code)
+	}
+	if got := h.SudoGrants(); len(got) != 1 || got[0].UserID != provisionTestUser || got[0].ContainerID != "container-1" {
+		t.Fatalf("unexpected grants %+v", got)
+	}
+	if len(mgr.scripts) != 1 || !strings.Contains(mgr.scripts[0], "rm -f /etc/sudoers.d/shsh-grant") {
+		t.Fatalf("expected only the expired grant to be revoked, got %q", mgr.scripts)
+	}
+	events, err := repo.ListContainerEvents(t.Context(), "expired", 10)
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 1 || events[0].Event != domain.ContainerEventSudoRevoke || events[0].Reason != "sudo_expired" {
+		t.Fatalf("unexpected audit events %+v", events)
+	}
+}
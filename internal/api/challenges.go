@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/curriculum"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/go-chi/chi/v5"
+)
+
+// challengeAssetMaxAge is how long browsers may cache challenge assets
+// without revalidating. Assets only change on deploy or when a curriculum
+// source syncs a new commit.
+const challengeAssetMaxAge = 3600
+
+// classroomResolver looks up the classroom a user belongs to, or "".
+type classroomResolver interface {
+	ClassroomOf(ctx context.Context, userID string) string
+}
+
+// ChallengeHandler serves lesson content bundled with the curriculum, records
+// learners' progress through it, checkpoints their work, captures their
+// traffic in networking challenges, starts the multi-container labs those
+// use, breaks their environment for troubleshooting ones and hands out
+// time-boxed sudo where a lesson needs it.
+type ChallengeHandler struct {
+	*Handler
+	catalog    *curriculum.Catalog
+	cfg        *config.Config
+	classrooms classroomResolver
+	captures   *captureTracker
+	sudo       *sudoTracker
+}
+
+// NewChallengeHandler creates a challenge content handler serving library.
+// WithCatalog replaces library with a catalog that also serves git
+// curriculum sources; WithConfig is the only other option it uses.
+func NewChallengeHandler(base *Handler, library *curriculum.Library, opts ...Option) *ChallengeHandler {
+	o := applyOptions(opts)
+	catalog := o.catalog
+	if catalog == nil {
+		catalog = curriculum.NewCatalog(library, "", 0)
+	}
+	return &ChallengeHandler{Handler: base, catalog: catalog, cfg: o.cfg, captures: newCaptureTracker(), sudo: newSudoTracker()}
+}
+
+// SetClassroomResolver shows learners the challenges of curriculum sources
+// assigned to their classroom. Without it only built-in challenges and
+// sources assigned to every classroom are served.
+func (h *ChallengeHandler) SetClassroomResolver(resolver classroomResolver) {
+	h.classrooms = resolver
+}
+
+// RegisterRoutes registers challenge content routes. Checkpoint routes copy
+// the user's files, so they are left out when the file API is disabled;
+// capture and sudo routes are only registered when some challenge may use
+// them. Sudo is granted through the admin API; see AdminHandler.SetSudo.
+func (h *ChallengeHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/api/challenges", h.ListChallenges)
+	r.Get("/api/challenges/progress", h.GetProgress)
+	r.Get("/api/challenges/{id}/content", h.GetContent)
+	r.Get("/api/challenges/{id}/assets/*", h.GetAsset)
+	if h.cfg == nil || h.cfg.FileAPI {
+		r.Post("/api/challenges/{id}/steps/{step}/complete", h.CompleteStep)
+		r.Get("/api/challenges/{id}/checkpoints", h.ListCheckpoints)
+		r.Post("/api/challenges/{id}/rollback", h.Rollback)
+	}
+	if h.cfg != nil && len(h.cfg.Capture.Challenges) > 0 {
+		r.Post("/api/challenges/{id}/capture", h.StartCapture)
+		r.Get("/api/challenges/{id}/capture", h.GetCapture)
+		r.Delete("/api/challenges/{id}/capture", h.StopCapture)
+		r.Get("/api/challenges/{id}/capture/pcap", h.DownloadCapture)
+	}
+	if h.sudoEnabled() {
+		r.Get("/api/challenges/{id}/sudo", h.GetSudo)
+		r.Delete("/api/challenges/{id}/sudo", h.RevokeSudo)
+	}
+	r.Post("/api/challenges/{id}/start", h.StartChallenge)
+	r.Post("/api/challenges/{id}/faults", h.InjectFaults)
+	r.Post("/api/challenges/{id}/lab", h.StartLab)
+	r.Get("/api/challenges/{id}/lab", h.GetLab)
+	r.Delete("/api/challenges/{id}/lab", h.StopLab)
+	r.Post("/api/challenges/{id}/attempts", h.RecordAttempt)
+	r.Post("/api/challenges/{id}/complete", h.CompleteChallenge)
+}
+
+// ListChallenges handles GET /api/challenges. It lists the challenges the
+// learner can open: the built-in ones and those of curriculum sources
+// assigned to their classroom.
+func (h *ChallengeHandler) ListChallenges(w http.ResponseWriter, r *http.Request) {
+	challenges, err := h.catalog.List(h.classroomOf(r))
+	if err != nil {
+		slog.Error("Failed to list challenges", "error", err)
+		Error(w, http.StatusInternalServerError, "failed to list challenges")
+		return
+	}
+	JSON(w, http.StatusOK, map[string]interface{}{"challenges": challenges})
+}
+
+// GetContent handles GET /api/challenges/{id}/content.
+// The rendered HTML is already sanitized and can be inserted as-is. Clients
+// revalidate with If-None-Match.
+func (h *ChallengeHandler) GetContent(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	content, err := h.catalog.Content(id, h.classroomOf(r))
+	if errors.Is(err, curriculum.ErrNotFound) {
+		Error(w, http.StatusNotFound, "challenge not found")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to load challenge content", "error", err, "challenge_id", id)
+		Error(w, http.StatusInternalServerError, "failed to load challenge content")
+		return
+	}
+
+	w.Header().Set("ETag", content.ETag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Header.Get("If-None-Match") == content.ETag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	JSON(w, http.StatusOK, content)
+}
+
+// GetAsset handles GET /api/challenges/{id}/assets/*.
+func (h *ChallengeHandler) GetAsset(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	name := chi.URLParam(r, "*")
+	asset, err := h.catalog.Asset(id, h.classroomOf(r), name)
+	if errors.Is(err, curriculum.ErrNotFound) {
+		Error(w, http.StatusNotFound, "asset not found")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to load challenge asset", "error", err, "challenge_id", id, "asset", name)
+		Error(w, http.StatusInternalServerError, "failed to load asset")
+		return
+	}
+
+	w.Header().Set("ETag", asset.ETag)
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(challengeAssetMaxAge))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if r.Header.Get("If-None-Match") == asset.ETag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", asset.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(asset.Data)))
+	if _, err := w.Write(asset.Data); err != nil {
+		slog.Debug("Failed to write challenge asset", "error", err, "challenge_id", id)
+	}
+}
+
+// classroomOf returns the classroom of the requesting user, or "" without a
+// classroom resolver.
+func (h *ChallengeHandler) classroomOf(r *http.Request) string {
+	if h.classrooms == nil {
+		return ""
+	}
+	return h.classrooms.ClassroomOf(r.Context(), identity.UserIDFromContext(r.Context()))
+}
@@ -0,0 +1,76 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/ashureev/shsh-labs/internal/curriculum"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+	"github.com/go-chi/chi/v5"
+)
+
+func newChallengeRouter() chi.Router {
+	lib := curriculum.NewLibrary(fstest.MapFS{
+		"intro/content.md":       {Data: []byte("# Intro\n\nHello")},
+		"intro/assets/sheet.txt": {Data: []byte("ls -la")},
+	})
+	r := chi.NewRouter()
+	NewChallengeHandler(NewHandler(newFakeRepo(), &fakeManager{}, terminal.NewSessionManager(), ""), lib).RegisterRoutes(r)
+	return r
+}
+
+func TestChallengeContentRevalidates(t *testing.T) {
+	r := newChallengeRouter()
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/challenges/intro/content", nil))
+	etag := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected 200 with ETag, got %d etag=%q", rr.Code, etag)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/challenges/intro/content", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/challenges/missing/content", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown challenge, got %d", rr.Code)
+	}
+}
+
+func TestListChallenges(t *testing.T) {
+	rr := httptest.NewRecorder()
+	newChallengeRouter().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/challenges", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `{"id":"intro","title":"Intro"}`) {
+		t.Fatalf("unexpected listing %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestChallengeAssetCached(t *testing.T) {
+	r := newChallengeRouter()
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/challenges/intro/assets/sheet.txt", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "ls -la" {
+		t.Fatalf("unexpected asset response %d: %q", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Cache-Control") == "" || rr.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("missing caching headers: %v", rr.Header())
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/challenges/intro/assets/..%2Fcontent.md", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected traversal to be refused, got %d", rr.Code)
+	}
+}
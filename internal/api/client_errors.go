@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/shared"
+	"github.com/go-chi/chi/v5"
+	chiMiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	defaultClientErrorMaxSize = 16 * 1024
+	// Per-field caps keep one noisy report from flooding the log line.
+	maxClientErrorMessage   = 1024
+	maxClientErrorStack     = 8 * 1024
+	maxClientErrorField     = 256
+	maxClientErrorContext   = 20
+	maxClientErrorKindBytes = 64
+)
+
+// clientErrorReport is the body of POST /api/client-errors.
+type clientErrorReport struct {
+	// Kind classifies the failure, e.g. "uncaught", "unhandled_rejection",
+	// "sse_parse" or "terminal".
+	Kind      string            `json:"kind"`
+	Message   string            `json:"message"`
+	Stack     string            `json:"stack,omitempty"`
+	URL       string            `json:"url,omitempty"`
+	Component string            `json:"component,omitempty"`
+	RequestID string            `json:"request_id,omitempty"` // request the failure relates to, if any
+	Context   map[string]string `json:"context,omitempty"`
+}
+
+// ClientErrorHandler ingests error reports from the SPA into the server log.
+type ClientErrorHandler struct {
+	*Handler
+	cfg    *config.Config
+	sample func() float64
+}
+
+// NewClientErrorHandler creates a client error handler.
+func NewClientErrorHandler(base *Handler, cfg *config.Config) *ClientErrorHandler {
+	return &ClientErrorHandler{Handler: base, cfg: cfg, sample: rand.Float64}
+}
+
+// RegisterRoutes registers client error routes.
+func (h *ClientErrorHandler) RegisterRoutes(r chi.Router) {
+	r.Post("/api/client-errors", h.ReportError)
+}
+
+// ReportError handles POST /api/client-errors.
+// Reports are sampled and truncated, then logged with the caller's user and
+// session so they can be correlated with server-side events.
+func (h *ClientErrorHandler) ReportError(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	if userID == "" {
+		Error(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	maxSize := int64(defaultClientErrorMaxSize)
+	sampleRate := 1.0
+	if h.cfg != nil {
+		maxSize = h.cfg.ClientErrors.MaxReportSize
+		sampleRate = h.cfg.ClientErrors.SampleRate
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+	var report clientErrorReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			Error(w, http.StatusRequestEntityTooLarge, "report too large")
+			return
+		}
+		Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if strings.TrimSpace(report.Message) == "" {
+		Error(w, http.StatusBadRequest, "message is required")
+		return
+	}
+
+	if h.sample() >= sampleRate {
+		JSON(w, http.StatusAccepted, map[string]bool{"logged": false})
+		return
+	}
+
+	kind := shared.TruncateWithMarker(report.Kind, maxClientErrorKindBytes)
+	if kind == "" {
+		kind = "unknown"
+	}
+	attrs := []any{
+		"kind", kind,
+		"message", shared.TruncateWithMarker(report.Message, maxClientErrorMessage),
+		"user_id", userID,
+		"session_id", identity.SessionIDFromContext(r.Context()),
+		"request_id", chiMiddleware.GetReqID(r.Context()),
+		"client_request_id", shared.TruncateWithMarker(report.RequestID, maxClientErrorField),
+		"url", shared.TruncateWithMarker(report.URL, maxClientErrorField),
+		"component", shared.TruncateWithMarker(report.Component, maxClientErrorField),
+		"user_agent", shared.TruncateWithMarker(r.UserAgent(), maxClientErrorField),
+		"stack", shared.TruncateWithMarker(report.Stack, maxClientErrorStack),
+	}
+	if len(report.Context) > 0 {
+		attrs = append(attrs, "context", clientErrorContext(report.Context))
+	}
+	slog.Warn("Client error reported", attrs...)
+
+	JSON(w, http.StatusAccepted, map[string]bool{"logged": true})
+}
+
+// clientErrorContext caps the number and size of free-form context entries.
+func clientErrorContext(in map[string]string) map[string]string {
+	out := make(map[string]string, min(len(in), maxClientErrorContext))
+	for k, v := range in {
+		if len(out) == maxClientErrorContext {
+			break
+		}
+		out[shared.TruncateWithMarker(k, maxClientErrorKindBytes)] = shared.TruncateWithMarker(v, maxClientErrorField)
+	}
+	return out
+}
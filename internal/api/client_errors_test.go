@@ -0,0 +1,78 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+)
+
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func postClientError(t *testing.T, handler *ClientErrorHandler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/client-errors", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	identity.Middleware(handler.repo, true)(http.HandlerFunc(handler.ReportError)).ServeHTTP(rr, req)
+	return rr
+}
+
+func newTestClientErrorHandler(cfg *config.Config) *ClientErrorHandler {
+	return NewClientErrorHandler(NewHandler(newFakeRepo(), &fakeManager{}, terminal.NewSessionManager(), ""), cfg)
+}
+
+func TestClientErrorLoggedWithCorrelation(t *testing.T) {
+	logs := captureLogs(t)
+	handler := newTestClientErrorHandler(nil)
+
+	rr := postClientError(t, handler, `{"kind":"sse_parse","message":"Unexpected token","request_id":"chat-1","context":{"event":"alert"}}`)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	out := logs.String()
+	for _, want := range []string{"Client error reported", "kind=sse_parse", "client_request_id=chat-1", "user_id=anon_", "context=map[event:alert]"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("log missing %q: %s", want, out)
+		}
+	}
+}
+
+func TestClientErrorSampledOut(t *testing.T) {
+	logs := captureLogs(t)
+	handler := newTestClientErrorHandler(&config.Config{ClientErrors: config.ClientErrorConfig{SampleRate: 0.5, MaxReportSize: 1024}})
+	handler.sample = func() float64 { return 0.9 }
+
+	rr := postClientError(t, handler, `{"kind":"uncaught","message":"boom"}`)
+	if rr.Code != http.StatusAccepted || !strings.Contains(rr.Body.String(), `"logged":false`) {
+		t.Fatalf("expected sampled-out 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if strings.Contains(logs.String(), "Client error reported") {
+		t.Fatal("sampled-out report must not be logged")
+	}
+}
+
+func TestClientErrorRejectsInvalidReports(t *testing.T) {
+	handler := newTestClientErrorHandler(&config.Config{ClientErrors: config.ClientErrorConfig{SampleRate: 1, MaxReportSize: 64}})
+
+	if rr := postClientError(t, handler, `{"kind":"uncaught"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without message, got %d", rr.Code)
+	}
+	big := `{"message":"` + strings.Repeat("x", 100) + `"}`
+	if rr := postClientError(t, handler, big); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for oversized report, got %d", rr.Code)
+	}
+}
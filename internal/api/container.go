@@ -2,66 +2,152 @@ package api
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/ashureev/shsh-labs/internal/affinity"
+	"github.com/ashureev/shsh-labs/internal/agent"
 	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/curriculum"
+	"github.com/ashureev/shsh-labs/internal/domain"
 	"github.com/ashureev/shsh-labs/internal/identity"
 	"github.com/ashureev/shsh-labs/internal/shared"
 	"github.com/ashureev/shsh-labs/internal/store"
+	"github.com/ashureev/shsh-labs/internal/terminal"
 	"github.com/go-chi/chi/v5"
+	chiMiddleware "github.com/go-chi/chi/v5/middleware"
 )
 
-// provisionLocks prevents concurrent provisioning for the same user.
-var provisionLocks sync.Map
-
 // destroyLocks prevents concurrent destroy requests for the same user.
 var destroyLocks sync.Map
 
+// errRecreateFailed is returned when the watchdog's provision of a new
+// container fails.
+var errRecreateFailed = errors.New("recreate container failed")
+
 type sessionResetter interface {
 	ResetSession(ctx context.Context, userID, sessionID string) error
 }
 
+// provisionRequest is the optional body of POST /api/provision.
+type provisionRequest struct {
+	Image string `json:"image"` // Name of one of the configured images; empty uses the default
+}
+
 // ContainerHandler handles container-related endpoints.
 type ContainerHandler struct {
 	*Handler
 	aiEnabled    bool
 	cfg          *config.Config
 	agentSession sessionResetter
+	routes       affinity.Registry
+	queueWake    chan struct{} // nil unless StartProvisionQueue was called
+	logPurger    agent.ConversationLogPurger
+	quiet        QuietHoursController
+	provisionIPs *agent.RateLimiter // nil unless provisions are limited per client IP
 }
 
-// NewContainerHandlerWithAI creates a new container handler with AI enabled flag.
-// Deprecated: Use NewContainerHandlerWithAIAndConfig instead.
-func NewContainerHandlerWithAI(base *Handler, aiEnabled bool) *ContainerHandler {
-	return &ContainerHandler{Handler: base, aiEnabled: aiEnabled}
+// Option configures a handler built by NewContainerHandler, NewHealthHandler,
+// NewChallengeHandler or NewTerminalRunHandler. Options a handler has no use
+// for are ignored.
+type Option func(*handlerOptions)
+
+type handlerOptions struct {
+	aiEnabled bool
+	cfg       *config.Config
+	resetter  sessionResetter
+	mgr       container.Manager
+	catalog   *curriculum.Catalog
+}
+
+func applyOptions(opts []Option) handlerOptions {
+	var o handlerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithAI reports AI features as enabled to the frontend.
+func WithAI(enabled bool) Option {
+	return func(o *handlerOptions) { o.aiEnabled = enabled }
 }
 
-// NewContainerHandler creates a new container handler (AI disabled by default).
-// Deprecated: Use NewContainerHandlerWithConfig instead.
-func NewContainerHandler(base *Handler) *ContainerHandler {
-	return &ContainerHandler{Handler: base, aiEnabled: false}
+// WithConfig sets the server configuration; without it defaults are used.
+func WithConfig(cfg *config.Config) Option {
+	return func(o *handlerOptions) { o.cfg = cfg }
+}
+
+// WithSessionResetter resets the user's agent session when their container
+// is destroyed.
+func WithSessionResetter(r sessionResetter) Option {
+	return func(o *handlerOptions) { o.resetter = r }
+}
+
+// WithManager adds container runtime availability to the health report.
+func WithManager(mgr container.Manager) Option {
+	return func(o *handlerOptions) { o.mgr = mgr }
+}
+
+// WithCatalog serves challenges from catalog, which adds git curriculum
+// sources to the built-in library.
+func WithCatalog(catalog *curriculum.Catalog) Option {
+	return func(o *handlerOptions) { o.catalog = catalog }
+}
+
+// NewContainerHandler creates a new container handler. AI is disabled unless
+// WithAI is given.
+func NewContainerHandler(base *Handler, opts ...Option) *ContainerHandler {
+	o := applyOptions(opts)
+	h := &ContainerHandler{
+		Handler:      base,
+		aiEnabled:    o.aiEnabled,
+		cfg:          o.cfg,
+		agentSession: o.resetter,
+	}
+	if o.cfg != nil && o.cfg.RateLimit.ProvisionPerIP > 0 {
+		h.provisionIPs = agent.NewRateLimiter(o.cfg.RateLimit.ProvisionPerIP, o.cfg.RateLimit.ProvisionWindow)
+	}
+	return h
+}
+
+// NewContainerHandlerWithAI creates a new container handler with AI enabled flag.
+//
+// Deprecated: Use NewContainerHandler with WithAI instead.
+func NewContainerHandlerWithAI(base *Handler, aiEnabled bool) *ContainerHandler {
+	return NewContainerHandler(base, WithAI(aiEnabled))
 }
 
 // NewContainerHandlerWithAIAndConfig creates a new container handler with AI enabled flag and config.
+//
+// Deprecated: Use NewContainerHandler with WithAI and WithConfig instead.
 func NewContainerHandlerWithAIAndConfig(base *Handler, aiEnabled bool, cfg *config.Config) *ContainerHandler {
-	return &ContainerHandler{Handler: base, aiEnabled: aiEnabled, cfg: cfg}
+	return NewContainerHandler(base, WithAI(aiEnabled), WithConfig(cfg))
 }
 
 // NewContainerHandlerWithConfig creates a new container handler with config (AI disabled by default).
+//
+// Deprecated: Use NewContainerHandler with WithConfig instead.
 func NewContainerHandlerWithConfig(base *Handler, cfg *config.Config) *ContainerHandler {
-	return &ContainerHandler{Handler: base, aiEnabled: false, cfg: cfg}
+	return NewContainerHandler(base, WithConfig(cfg))
 }
 
 // NewContainerHandlerWithAIConfigAndSessionReset creates a new container handler with optional agent session reset support.
+//
+// Deprecated: Use NewContainerHandler with WithAI, WithConfig and
+// WithSessionResetter instead.
 func NewContainerHandlerWithAIConfigAndSessionReset(base *Handler, aiEnabled bool, cfg *config.Config, resetter sessionResetter) *ContainerHandler {
-	return &ContainerHandler{
-		Handler:      base,
-		aiEnabled:    aiEnabled,
-		cfg:          cfg,
-		agentSession: resetter,
-	}
+	return NewContainerHandler(base, WithAI(aiEnabled), WithConfig(cfg), WithSessionResetter(resetter))
 }
 
 // RegisterRoutes registers container routes.
@@ -70,7 +156,15 @@ func (h *ContainerHandler) RegisterRoutes(r chi.Router) {
 		r.Get("/me", h.GetMe)
 		r.Get("/config", h.GetConfig)
 		r.Post("/provision", h.Provision)
+		r.Get("/provision/status", h.ProvisionStatus)
+		r.Get("/provision/events", h.ProvisionEvents)
 		r.Post("/destroy", h.Destroy)
+		r.Post("/container/pause", h.Pause)
+		r.Get("/container/stats", h.Stats)
+		r.Get("/container/processes", h.Processes)
+		r.Get("/container/ports", h.Ports)
+		r.Put("/focus", h.StartFocus)
+		r.Delete("/focus", h.EndFocus)
 	})
 }
 
@@ -88,79 +182,302 @@ func (h *ContainerHandler) GetMe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	JSON(w, http.StatusOK, map[string]interface{}{
+	resp := map[string]interface{}{
 		"user_id":       user.UserID,
 		"username":      user.Username,
 		"container_id":  user.ContainerID,
-		"container_ttl": int64(user.SessionTTL(60 * time.Minute).Seconds()),
-	})
+		"container_ttl": int64(user.SessionTTL(h.sessionTTL()).Seconds()),
+	}
+	if user.IsKeptWarm(time.Now()) {
+		resp["keep_warm_until"] = user.KeepWarmUntil
+	}
+	JSON(w, http.StatusOK, resp)
+}
+
+// sessionTTL returns how long an idle session lives.
+func (h *ContainerHandler) sessionTTL() time.Duration {
+	if h.cfg != nil {
+		return h.cfg.SessionTTL
+	}
+	return 60 * time.Minute
+}
+
+// imageRef returns the reference of the image a user picked by name. The
+// empty name selects the manager's default image and is always allowed.
+func (h *ContainerHandler) imageRef(name string) (string, bool) {
+	if name == "" {
+		return "", true
+	}
+	if h.cfg == nil {
+		return "", false
+	}
+	return h.cfg.Container.ImageRef(name)
+}
+
+// imageName returns the name learners request the image ref by, or "" for
+// the default image and references no configured image has.
+func (h *ContainerHandler) imageName(ref string) string {
+	if h.cfg == nil {
+		return ""
+	}
+	for _, image := range h.cfg.Container.Images {
+		if image.Ref == ref {
+			return image.Name
+		}
+	}
+	return ""
+}
+
+// resourceTier returns the limits of a user's containers: the tier an admin
+// assigned the user, else the tier of the image they picked, else the
+// configured default. h.cfg must be set.
+func (h *ContainerHandler) resourceTier(user *domain.User, imageName string) config.ResourceTier {
+	image, _ := h.cfg.Container.Image(imageName)
+	return h.cfg.Container.ResolveTier(user.ResourceTier, image.Tier)
 }
 
 // GetConfig returns the server configuration for the frontend.
-func (h *ContainerHandler) GetConfig(w http.ResponseWriter, _ *http.Request) {
-	JSON(w, http.StatusOK, map[string]interface{}{
+func (h *ContainerHandler) GetConfig(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]interface{}{
 		"ai_enabled": h.aiEnabled,
-	})
+		"runtime":    h.mgr.Runtime(),
+	}
+	if h.cfg != nil {
+		resp["profile"] = h.cfg.Profile
+		resp["file_api"] = h.cfg.FileAPI
+		resp["terminal_e2e"] = h.cfg.Terminal.E2E
+		images := make([]string, 0, len(h.cfg.Container.Images))
+		for _, image := range h.cfg.Container.Images {
+			images = append(images, image.Name)
+		}
+		resp["images"] = images
+		resp["capture_challenges"] = append([]string{}, h.cfg.Capture.Challenges...)
+	}
+	if h.quiet != nil {
+		resp["quiet_hours"] = h.quiet.QuietStatus(identity.UserIDFromContext(r.Context()), time.Now())
+	}
+	JSON(w, http.StatusOK, resp)
 }
 
-// Provision creates and starts a container for the user.
+// Provision starts creating a container for the user and returns 202 with the
+// operation; progress is available from /api/provision/status and as SSE from
+// /api/provision/events.
+// Clients may send an Idempotency-Key header: while an operation is running,
+// duplicate requests get its status instead of starting another create, and a
+// retry with the key of a finished operation replays its result.
+// With SHSH_PROVISION_RATE_LIMIT set, each client IP may provision that many
+// times per window, so anonymous visitors cannot cycle identities to churn
+// containers.
+// An optional {"image": name} body picks one of SHSH_CONTAINER_IMAGES; a
+// running container of another image is replaced, keeping the user's files.
 func (h *ContainerHandler) Provision(w http.ResponseWriter, r *http.Request) {
 	userID := identity.UserIDFromContext(r.Context())
 
-	// Prevent concurrent provisioning requests.
-	lock, _ := provisionLocks.LoadOrStore(userID, &sync.Mutex{})
-	mutex := lock.(*sync.Mutex)
-	if !mutex.TryLock() {
-		slog.Warn("Provisioning already in progress", "user_id", userID)
-		Error(w, http.StatusConflict, "provisioning_in_progress")
+	r.Body = http.MaxBytesReader(w, r.Body, 4*1024)
+	var req provisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		Error(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
-	defer func() {
-		mutex.Unlock()
-		provisionLocks.Delete(userID)
-	}()
+	if req.Image != "" {
+		if _, ok := h.imageRef(req.Image); !ok {
+			Error(w, http.StatusBadRequest, "unknown_image")
+			return
+		}
+	}
+
+	if h.provisionIPs != nil {
+		ip := identity.IPFromRequest(r)
+		if !h.provisionIPs.Allow(ip) {
+			slog.Warn("Provision rate limited", "user_id", userID, "ip", ip)
+			if reset := h.provisionIPs.Status(ip).ResetAt; !reset.IsZero() {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(reset).Seconds()))))
+			}
+			Error(w, http.StatusTooManyRequests, "provision_rate_limited")
+			return
+		}
+	}
+
+	key := strings.TrimSpace(r.Header.Get(idempotencyKeyHeader))
+	if key != "" && !idempotencyKeyPattern.MatchString(key) {
+		Error(w, http.StatusBadRequest, "invalid idempotency key")
+		return
+	}
+
+	op, started := provisionOps.begin(userID, key, req.Image, time.Now())
+	if !started {
+		slog.Info("Returning existing provision operation",
+			"user_id", userID, "operation_id", op.ID, "status", op.Status)
+		JSON(w, op.responseStatus(), op)
+		return
+	}
+
+	// Detach from the request; it ends as soon as the 202 is written.
+	go h.provisionAsync(context.WithoutCancel(r.Context()), userID, op)
+	JSON(w, http.StatusAccepted, op)
+}
+
+// provisionAsync runs a provision operation to completion, records the
+// outcome for status polling and event streams and returns it. If every host
+// is at capacity and the wait queue is enabled, the operation stays running
+// as queued and the queue worker finishes it.
+func (h *ContainerHandler) provisionAsync(ctx context.Context, userID string, op provisionOperation) provisionOperation {
+	h.attemptProvision(ctx, userID, &op)
+	if op.Stage == provisionStageQueued && op.Status == provisionStatusProvisioning {
+		slog.Info("Provision operation queued for capacity", "user_id", userID, "operation_id", op.ID)
+		h.refreshProvisionQueue(ctx)
+		return op
+	}
+	op = provisionOps.finish(userID, op)
+	slog.Info("Provision operation finished",
+		"user_id", userID, "operation_id", op.ID, "status", op.Status, "duration", op.FinishedAt.Sub(op.StartedAt))
+	return op
+}
+
+// RecreateContainer provisions a new container for a user whose container
+// died, from image, the reference the dead container ran. A provision the
+// user already started is left to finish instead. It is the recreate
+// callback of the container watchdog.
+func (h *ContainerHandler) RecreateContainer(ctx context.Context, userID, image string) error {
+	op, started := provisionOps.begin(userID, "", h.imageName(image), time.Now())
+	if !started {
+		return nil
+	}
+	if op = h.provisionAsync(ctx, userID, op); op.Status == provisionStatusFailed {
+		return fmt.Errorf("%w: %s", errRecreateFailed, op.Error)
+	}
+	return nil
+}
+
+// attemptProvision runs one provisioning attempt for op within the create
+// timeout, reporting stages to the tracker.
+func (h *ContainerHandler) attemptProvision(ctx context.Context, userID string, op *provisionOperation) {
+	createTimeout := 2 * time.Minute
+	if h.cfg != nil {
+		createTimeout = h.cfg.Timeout.ContainerCreate
+	}
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
+	ctx = container.WithProgress(ctx, func(stage string) {
+		provisionOps.setStage(userID, op.ID, stage)
+	})
+	h.runProvision(ctx, userID, op)
+}
+
+// runProvision ensures the user's container and records the outcome on op.
+func (h *ContainerHandler) runProvision(ctx context.Context, userID string, op *provisionOperation) {
+	fail := func(status int, message string) {
+		op.Status = provisionStatusFailed
+		op.Error = message
+		op.httpStatus = status
+	}
 
-	ctx := r.Context()
 	user, err := h.repo.GetUser(ctx, userID)
 	if err != nil || user == nil {
 		slog.Error("Failed to get user for provisioning", "error", err, "user_id", userID)
-		Error(w, http.StatusUnauthorized, "user not found")
+		fail(http.StatusUnauthorized, "user not found")
 		return
 	}
 
-	slog.Info("Provisioning container", "user_id", userID, "volume_path", user.VolumePath)
+	slog.Info("Provisioning container", "user_id", userID, "volume_path", user.VolumePath, "operation_id", op.ID, "image", op.Image)
 
-	containerID, err := h.mgr.EnsureContainer(ctx, userID, user.ContainerID, user.LastSeenAt, nil)
+	if h.cfg != nil {
+		ctx = container.WithResourceTier(ctx, h.resourceTier(user, op.Image))
+	}
+	image, _ := h.imageRef(op.Image)
+	containerID, err := h.mgr.EnsureContainer(ctx, userID, user.ContainerID, image, user.LastSeenAt, nil)
+	if errors.Is(err, container.ErrRuntimeUnavailable) {
+		slog.Error("Container runtime unavailable", "error", err, "user_id", userID)
+		fail(http.StatusServiceUnavailable, "runtime_unavailable")
+		return
+	}
+	if errors.Is(err, container.ErrNoHostCapacity) {
+		if h.queueProvision(ctx, userID, op) {
+			return
+		}
+		slog.Error("No docker host capacity", "error", err, "user_id", userID)
+		fail(http.StatusServiceUnavailable, "no_capacity")
+		return
+	}
 	if err != nil {
 		slog.Error("Failed to provision container", "error", err, "user_id", userID)
-		Error(w, http.StatusInternalServerError, err.Error())
+		fail(http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	if err := h.repo.UpdateContainerID(ctx, userID, containerID, ""); err != nil {
 		slog.Error("Failed to update container ID", "error", err, "user_id", userID)
-		Error(w, http.StatusInternalServerError, "failed to update container state")
+		fail(http.StatusInternalServerError, "failed to update container state")
 		return
 	}
 
-	slog.Info("Container provisioned", "user_id", userID, "container_id", containerID)
-	JSON(w, http.StatusOK, map[string]interface{}{
-		"status":       "ready",
-		"container_id": containerID,
-	})
+	h.recordRoute(ctx, userID)
+
+	runtime := h.mgr.Runtime()
+	slog.Info("Container provisioned", "user_id", userID, "container_id", containerID, "runtime", runtime.Effective)
+	op.Status = provisionStatusReady
+	op.Stage = container.StageReady
+	op.ContainerID = containerID
+	op.Runtime = runtime.Effective
+	op.RuntimeFallback = runtime.Fallback
+	op.httpStatus = http.StatusOK
 }
 
-// Destroy stops and removes the user's container.
+// ProvisionStatus returns the user's current or most recent provision
+// operation. An operation_id query parameter restricts it to that operation.
+func (h *ContainerHandler) ProvisionStatus(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+
+	op, ok := provisionOps.get(userID)
+	if id := r.URL.Query().Get("operation_id"); ok && id != "" && id != op.ID {
+		ok = false
+	}
+	if !ok {
+		Error(w, http.StatusNotFound, "no_provision_operation")
+		return
+	}
+	JSON(w, http.StatusOK, op)
+}
+
+// Destroy stops and removes the user's container. The named volume holding
+// the user's home directory is kept, so the next provision resumes their files.
+//
+// With purge=true the volume, the user's records and their conversation logs
+// are deleted as well, leaving nothing of the identity behind. Purging is irreversible, so it also requires confirm=true and is
+// audit-logged whether or not it succeeds.
 func (h *ContainerHandler) Destroy(w http.ResponseWriter, r *http.Request) {
 	userID := identity.UserIDFromContext(r.Context())
 	sessionID := identity.SessionIDFromContext(r.Context())
 	ctx := r.Context()
 
+	purge := r.URL.Query().Get("purge") == "true"
+	var audit *slog.Logger
+	if purge {
+		audit = slog.With(
+			"audit", "destroy_purge",
+			"user_id", userID,
+			"session_id", sessionID,
+			"request_id", chiMiddleware.GetReqID(ctx),
+			"ip", identity.IPFromRequest(r),
+		)
+		if r.URL.Query().Get("confirm") != "true" {
+			audit.Warn("Purge rejected", "reason", "confirmation_required")
+			Error(w, http.StatusPreconditionRequired, "confirmation_required")
+			return
+		}
+	}
+
 	// Prevent concurrent destroy requests.
 	lock, _ := destroyLocks.LoadOrStore(userID, &sync.Mutex{})
 	mutex := lock.(*sync.Mutex)
 	if !mutex.TryLock() {
 		slog.Warn("Destroy already in progress", "user_id", userID)
+		if purge {
+			audit.Warn("Purge rejected", "reason", "destroy_in_progress")
+			Error(w, http.StatusConflict, "destroy_in_progress")
+			return
+		}
 		JSON(w, http.StatusOK, map[string]string{"status": "destroying"})
 		return
 	}
@@ -178,6 +495,7 @@ func (h *ContainerHandler) Destroy(w http.ResponseWriter, r *http.Request) {
 
 	// Close any active terminal session.
 	h.sm.CloseSession(userID)
+	h.cancelQueuedProvision(ctx, userID)
 
 	if h.agentSession != nil {
 		resetTimeout := 2 * time.Second
@@ -202,6 +520,7 @@ func (h *ContainerHandler) Destroy(w http.ResponseWriter, r *http.Request) {
 			Error(w, http.StatusInternalServerError, "failed to update database state")
 			return
 		}
+		h.ForgetRoute(ctx, userID)
 
 		containerID := user.ContainerID
 		// Use config timeout if available
@@ -209,20 +528,85 @@ func (h *ContainerHandler) Destroy(w http.ResponseWriter, r *http.Request) {
 		if h.cfg != nil {
 			destroyTimeout = h.cfg.Timeout.DestroyCleanup
 		}
-		go func() {
-			cleanupCtx, cancel := context.WithTimeout(context.Background(), destroyTimeout)
-			defer cancel()
-
-			if err := h.mgr.StopContainer(cleanupCtx, containerID); err != nil {
-				slog.Error("Failed to stop container", "error", err, "container_id", containerID, "user_id", userID)
-			} else {
-				slog.Info("Container stop/remove completed", "container_id", containerID, "user_id", userID)
+		if purge {
+			// The volume can only be removed once its container is gone.
+			stopCtx, cancel := context.WithTimeout(container.WithLifecycleReason(context.WithoutCancel(ctx), container.ReasonUserDestroy), destroyTimeout)
+			err := h.mgr.StopContainer(stopCtx, containerID)
+			cancel()
+			if err != nil {
+				audit.Error("Purge failed", "stage", "stop_container", "container_id", containerID, "error", err)
+				Error(w, http.StatusInternalServerError, "failed to stop container")
+				return
 			}
-		}()
+			h.wakeProvisionQueue()
+		} else {
+			go h.stopContainerAsync(userID, containerID, destroyTimeout)
+		}
+	}
+
+	if purge {
+		h.purgeUserData(ctx, w, userID, audit)
+		return
 	}
 
 	slog.Info("Container destroyed", "user_id", userID)
-	JSON(w, http.StatusOK, map[string]string{"status": "destroyed"})
+	JSON(w, http.StatusOK, map[string]string{"status": "destroyed", "volume": "kept"})
+}
+
+// stopContainerAsync stops a destroyed container in the background so
+// destroy returns immediately.
+func (h *ContainerHandler) stopContainerAsync(userID, containerID string, timeout time.Duration) {
+	cleanupCtx, cancel := context.WithTimeout(container.WithLifecycleReason(context.Background(), container.ReasonUserDestroy), timeout)
+	defer cancel()
+
+	if err := h.mgr.StopContainer(cleanupCtx, containerID); err != nil {
+		slog.Error("Failed to stop container", "error", err, "container_id", containerID, "user_id", userID)
+		return
+	}
+	slog.Info("Container stop/remove completed", "container_id", containerID, "user_id", userID)
+	// Capacity freed; let the next queued user in.
+	h.wakeProvisionQueue()
+}
+
+// SetConversationLogPurger makes purges delete the user's conversation logs
+// as well.
+func (h *ContainerHandler) SetConversationLogPurger(p agent.ConversationLogPurger) {
+	h.logPurger = p
+}
+
+// purgeUserData erases every trace of the user after their container has
+// been removed: the volume, all stored records, the conversation logs and the
+// identity cookie. It writes the destroy response.
+func (h *ContainerHandler) purgeUserData(ctx context.Context, w http.ResponseWriter, userID string, audit *slog.Logger) {
+	remover, ok := h.mgr.(container.VolumeRemover)
+	if !ok {
+		audit.Error("Purge failed", "stage", "remove_volume", "error", "volume removal not supported")
+		Error(w, http.StatusNotImplemented, "purge_unsupported")
+		return
+	}
+	if err := remover.RemoveVolume(ctx, userID); err != nil {
+		audit.Error("Purge failed", "stage", "remove_volume", "error", err)
+		Error(w, http.StatusInternalServerError, "failed to remove volume")
+		return
+	}
+	if err := h.repo.PurgeUser(ctx, userID); err != nil {
+		audit.Error("Purge failed", "stage", "purge_records", "error", err)
+		Error(w, http.StatusInternalServerError, "failed to delete user data")
+		return
+	}
+	if h.logPurger != nil {
+		if err := h.logPurger.PurgeUser(userID); err != nil {
+			audit.Error("Purge failed", "stage", "purge_conversation_logs", "error", err)
+			Error(w, http.StatusInternalServerError, "failed to delete conversation logs")
+			return
+		}
+	}
+	// Without the cookie the next request starts a fresh identity instead of
+	// recreating this one.
+	identity.ClearAnonCookie(w)
+
+	audit.Info("User data purged")
+	JSON(w, http.StatusOK, map[string]string{"status": "destroyed", "volume": "purged"})
 }
 
 // updateContainerIDWithRetry attempts to update container ID with exponential backoff
@@ -324,19 +708,55 @@ func (h *ContainerHandler) resetAgentSessionWithRetry(ctx context.Context, userI
 
 // HealthHandler handles health check endpoints.
 type HealthHandler struct {
-	repo store.Repository
-	cfg  *config.Config
+	repo     store.Repository
+	mgr      container.Manager
+	cfg      *config.Config
+	analysis AnalysisReporter
+	aiBudget AIBudgetReporter
+}
+
+// AnalysisReporter reports the state of the AI analysis worker pool.
+type AnalysisReporter interface {
+	AnalysisStats() terminal.AnalysisStats
+}
+
+// SetAnalysisReporter adds the AI analysis worker pool to the health report.
+func (h *HealthHandler) SetAnalysisReporter(reporter AnalysisReporter) {
+	h.analysis = reporter
 }
 
-// NewHealthHandler creates a new health handler.
-// Deprecated: Use NewHealthHandlerWithConfig instead.
-func NewHealthHandler(repo store.Repository) *HealthHandler {
-	return &HealthHandler{repo: repo}
+// AIBudgetReporter reports the mode the AI agent's error budget selects.
+type AIBudgetReporter interface {
+	BudgetStatus() agent.BudgetStatus
+}
+
+// SetAIBudgetReporter adds the AI agent's error budget to the health report.
+// A degraded AI mode is reported under checks without failing the health
+// check, since AI features are optional.
+func (h *HealthHandler) SetAIBudgetReporter(reporter AIBudgetReporter) {
+	h.aiBudget = reporter
+}
+
+// NewHealthHandler creates a new health handler. WithManager adds container
+// runtime availability to its report.
+func NewHealthHandler(repo store.Repository, opts ...Option) *HealthHandler {
+	o := applyOptions(opts)
+	return &HealthHandler{repo: repo, mgr: o.mgr, cfg: o.cfg}
 }
 
 // NewHealthHandlerWithConfig creates a new health handler with configuration.
+//
+// Deprecated: Use NewHealthHandler with WithConfig instead.
 func NewHealthHandlerWithConfig(repo store.Repository, cfg *config.Config) *HealthHandler {
-	return &HealthHandler{repo: repo, cfg: cfg}
+	return NewHealthHandler(repo, WithConfig(cfg))
+}
+
+// NewHealthHandlerWithManager creates a new health handler that also reports
+// container runtime availability.
+//
+// Deprecated: Use NewHealthHandler with WithManager and WithConfig instead.
+func NewHealthHandlerWithManager(repo store.Repository, mgr container.Manager, cfg *config.Config) *HealthHandler {
+	return NewHealthHandler(repo, WithManager(mgr), WithConfig(cfg))
 }
 
 // Health returns the health status of the API and its dependencies.
@@ -361,11 +781,104 @@ func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
 		statusCode = http.StatusServiceUnavailable
 	} else {
 		status["checks"].(map[string]string)["database"] = "ok"
+		if details, err := h.repo.HealthDetails(ctx); err != nil {
+			slog.Warn("Failed to collect database health details", "error", err)
+		} else {
+			status["database"] = details
+		}
+	}
+	if reporter, ok := h.repo.(store.StatsReporter); ok {
+		status["database_queries"] = reporter.Stats()
+	}
+	if h.analysis != nil {
+		status["analysis"] = h.analysis.AnalysisStats()
+	}
+	if h.aiBudget != nil {
+		budget := h.aiBudget.BudgetStatus()
+		status["ai"] = budget
+		status["checks"].(map[string]string)["ai"] = "ok"
+		if budget.Mode != agent.ModeFull {
+			status["checks"].(map[string]string)["ai"] = "degraded"
+		}
+	}
+
+	if h.mgr != nil {
+		runtime := h.mgr.Runtime()
+		status["runtime"] = runtime
+		switch {
+		case runtime.Available:
+			status["checks"].(map[string]string)["runtime"] = "ok"
+		case runtime.Fallback:
+			status["checks"].(map[string]string)["runtime"] = "fallback"
+		case !runtime.Usable():
+			status["status"] = "degraded"
+			status["checks"].(map[string]string)["runtime"] = "unavailable"
+			statusCode = http.StatusServiceUnavailable
+		default:
+			status["checks"].(map[string]string)["runtime"] = "unknown"
+		}
+
+		if reporter, ok := h.mgr.(container.HostReporter); ok {
+			hosts := reporter.Hosts()
+			status["hosts"] = hosts
+			healthy := 0
+			for _, host := range hosts {
+				if host.Healthy {
+					healthy++
+				}
+			}
+			switch healthy {
+			case len(hosts):
+				status["checks"].(map[string]string)["docker_hosts"] = "ok"
+			case 0:
+				status["status"] = "degraded"
+				status["checks"].(map[string]string)["docker_hosts"] = "unavailable"
+				statusCode = http.StatusServiceUnavailable
+			default:
+				status["checks"].(map[string]string)["docker_hosts"] = "partial"
+			}
+		}
+
+		if prePuller, ok := h.mgr.(container.ImagePrePuller); ok && h.cfg != nil && h.cfg.Container.PrePullConcurrency > 0 {
+			images := prePuller.PrePullStatus()
+			status["images"] = images
+			check := imagesCheck(images)
+			status["checks"].(map[string]string)["images"] = check
+			if check == "pulling" || check == "missing" {
+				// No host can provision without pulling first.
+				status["status"] = "degraded"
+				statusCode = http.StatusServiceUnavailable
+			}
+		}
 	}
 
 	JSON(w, statusCode, status)
 }
 
+// imagesCheck summarizes the pre-pulls of the hosts: ok when every host has
+// the images learners need, partial when some do, and otherwise pulling
+// until a pre-pull fails and missing after.
+func imagesCheck(statuses []container.PrePullStatus) string {
+	ready, failed := 0, false
+	for _, s := range statuses {
+		if s.Ready() {
+			ready++
+		} else if s.State == container.PrePullDone {
+			failed = true
+		}
+	}
+	switch {
+	case ready == len(statuses):
+		return "ok"
+	case ready > 0:
+		return "partial"
+	case failed:
+		return "missing"
+	default:
+		return "pulling"
+	}
+}
+
 // RegisterHealth registers the health check route.
 func (h *HealthHandler) RegisterHealth(r chi.Router) {
 	r.Get("/health", h.Health)
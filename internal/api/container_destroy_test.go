@@ -7,19 +7,36 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/ashureev/shsh-labs/internal/container"
 	"github.com/ashureev/shsh-labs/internal/domain"
 	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/store"
 	"github.com/ashureev/shsh-labs/internal/terminal"
 	"github.com/docker/docker/client"
 )
 
 type fakeRepo struct {
-	mu    sync.Mutex
-	users map[string]*domain.User
+	mu            sync.Mutex
+	users         map[string]*domain.User
+	notifications []*domain.Notification
+	queue         []string
+	commands      []*domain.CommandRecord
+	archived      []*domain.ArchivedAgentSession
+	checkpoints   []*domain.ChallengeCheckpoint
+	shares        []*domain.SessionShare
+	agentSessions []*domain.AgentSession
+	interventions []*domain.Intervention
+	assignments   []*domain.ChallengeAssignment
+	attempts      []*domain.ChallengeAttempt
+	completions   []*domain.ChallengeCompletion
+	events        []*domain.ContainerEvent
+	snippets      []*domain.Snippet
 }
 
 func newFakeRepo() *fakeRepo {
@@ -59,36 +76,469 @@ func (f *fakeRepo) UpdateContainerID(_ context.Context, userID string, container
 	return nil
 }
 
+func (f *fakeRepo) UpdateInstanceID(_ context.Context, userID string, instanceID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if user := f.users[userID]; user != nil {
+		user.InstanceID = instanceID
+	}
+	return nil
+}
+
 func (f *fakeRepo) GetExpiredSessions(_ context.Context, _ time.Duration) ([]*domain.User, error) {
 	return nil, nil
 }
 
+func (f *fakeRepo) GetActiveContainers(_ context.Context) ([]*domain.User, error) {
+	return nil, nil
+}
+
+func (f *fakeRepo) SetKeepWarm(_ context.Context, userID string, until time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if user := f.users[userID]; user != nil {
+		user.KeepWarmUntil = until
+	}
+	return nil
+}
+
+func (f *fakeRepo) SetResourceTier(_ context.Context, userID, tier string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if user := f.users[userID]; user != nil {
+		user.ResourceTier = tier
+	}
+	return nil
+}
+
+func (f *fakeRepo) SetClassroom(_ context.Context, userID, classroom string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if user := f.users[userID]; user != nil {
+		user.Classroom = classroom
+	}
+	return nil
+}
+
+func (f *fakeRepo) ListKeptWarmUsers(_ context.Context, now time.Time) ([]*domain.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var users []*domain.User
+	for _, user := range f.users {
+		if user.IsKeptWarm(now) {
+			copy := *user
+			users = append(users, &copy)
+		}
+	}
+	return users, nil
+}
+
 func (f *fakeRepo) Ping(_ context.Context) error { return nil }
-func (f *fakeRepo) Close() error                 { return nil }
+func (f *fakeRepo) HealthDetails(_ context.Context) (*store.HealthDetails, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &store.HealthDetails{Driver: "fake", RowCounts: map[string]int64{"users": int64(len(f.users))}}, nil
+}
+func (f *fakeRepo) Close() error { return nil }
 
-func (f *fakeRepo) GetAgentSession(_ context.Context, _ string) (*domain.AgentSession, error) {
+func (f *fakeRepo) GetAgentSession(_ context.Context, userID, sessionID string) (*domain.AgentSession, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, session := range f.agentSessions {
+		if session.UserID == userID && session.SessionID == sessionID {
+			copy := *session
+			return &copy, nil
+		}
+	}
+	return nil, nil
+}
+func (f *fakeRepo) ListAgentSessions(_ context.Context, _ string) ([]*domain.AgentSession, error) {
 	return nil, nil
 }
 func (f *fakeRepo) UpsertAgentSession(_ context.Context, _ *domain.AgentSession) error { return nil }
-func (f *fakeRepo) DeleteAgentSession(_ context.Context, _ string) error               { return nil }
+func (f *fakeRepo) DeleteAgentSession(_ context.Context, _, _ string) error            { return nil }
+func (f *fakeRepo) DeleteAgentSessions(_ context.Context, _ string) error              { return nil }
 func (f *fakeRepo) CleanupExpiredSessions(_ context.Context, _ time.Duration) (int64, error) {
 	return 0, nil
 }
+func (f *fakeRepo) ListArchivedSessions(_ context.Context, userID string) ([]*domain.ArchivedAgentSession, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []*domain.ArchivedAgentSession
+	for i := len(f.archived) - 1; i >= 0; i-- {
+		if f.archived[i].UserID == userID {
+			out = append(out, f.archived[i])
+		}
+	}
+	return out, nil
+}
+func (f *fakeRepo) PruneArchivedSessions(_ context.Context, _ time.Duration) (int64, error) {
+	return 0, nil
+}
+func (f *fakeRepo) AggregateCommandStats(_ context.Context) (int64, error) { return 0, nil }
+func (f *fakeRepo) ListDailyCommandStats(_ context.Context, _ string, _ time.Time) ([]*domain.DailyCommandStats, error) {
+	return nil, nil
+}
+func (f *fakeRepo) InsertIntervention(_ context.Context, i *domain.Intervention) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	copy := *i
+	f.interventions = append(f.interventions, &copy)
+	return nil
+}
+func (f *fakeRepo) ListInterventionStats(_ context.Context, since time.Time) ([]*domain.InterventionStats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	counts := make(map[string]map[domain.InterventionOutcome]int)
+	var keys []string
+	for _, i := range f.interventions {
+		if i.HintedAt.Before(since) {
+			continue
+		}
+		key := i.ResponseType + "\x00" + i.Pattern
+		if counts[key] == nil {
+			counts[key] = make(map[domain.InterventionOutcome]int)
+			keys = append(keys, key)
+		}
+		counts[key][i.Outcome]++
+	}
+	var stats []*domain.InterventionStats
+	for _, key := range keys {
+		responseType, pattern, _ := strings.Cut(key, "\x00")
+		stats = append(stats, domain.NewInterventionStats(responseType, pattern, counts[key]))
+	}
+	return stats, nil
+}
+func (f *fakeRepo) UpsertChallengeCheckpoint(_ context.Context, c *domain.ChallengeCheckpoint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	copy := *c
+	f.checkpoints = slices.DeleteFunc(f.checkpoints, func(old *domain.ChallengeCheckpoint) bool {
+		return old.UserID == c.UserID && old.ChallengeID == c.ChallengeID && old.Step == c.Step
+	})
+	f.checkpoints = append(f.checkpoints, &copy)
+	return nil
+}
+func (f *fakeRepo) ListChallengeCheckpoints(_ context.Context, userID, challengeID string) ([]*domain.ChallengeCheckpoint, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []*domain.ChallengeCheckpoint
+	for _, c := range f.checkpoints {
+		if c.UserID == userID && c.ChallengeID == challengeID {
+			copy := *c
+			out = append(out, &copy)
+		}
+	}
+	return out, nil
+}
+func (f *fakeRepo) UpsertChallengeAssignment(_ context.Context, a *domain.ChallengeAssignment) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	copy := *a
+	for i, old := range f.assignments {
+		if old.UserID == a.UserID && old.Challenge.ID == a.Challenge.ID {
+			copy.AssignedAt = old.AssignedAt
+			f.assignments[i] = &copy
+			return nil
+		}
+	}
+	f.assignments = append(f.assignments, &copy)
+	return nil
+}
+func (f *fakeRepo) ListChallengeAssignments(_ context.Context, userID string) ([]*domain.ChallengeAssignment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []*domain.ChallengeAssignment
+	for _, a := range f.assignments {
+		if a.UserID == userID {
+			copy := *a
+			out = append(out, &copy)
+		}
+	}
+	return out, nil
+}
+func (f *fakeRepo) InsertChallengeAttempt(_ context.Context, a *domain.ChallengeAttempt) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	a.ID = int64(len(f.attempts) + 1)
+	copy := *a
+	f.attempts = append(f.attempts, &copy)
+	return nil
+}
+func (f *fakeRepo) ListChallengeAttempts(_ context.Context, userID, challengeID string) ([]*domain.ChallengeAttempt, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []*domain.ChallengeAttempt
+	for _, a := range f.attempts {
+		if a.UserID == userID && a.ChallengeID == challengeID {
+			copy := *a
+			out = append(out, &copy)
+		}
+	}
+	return out, nil
+}
+func (f *fakeRepo) CompleteChallenge(_ context.Context, c *domain.ChallengeCompletion) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, old := range f.completions {
+		if old.UserID == c.UserID && old.ChallengeID == c.ChallengeID {
+			return false, nil
+		}
+	}
+	copy := *c
+	f.completions = append(f.completions, &copy)
+	return true, nil
+}
+func (f *fakeRepo) ListChallengeCompletions(_ context.Context, userID string) ([]*domain.ChallengeCompletion, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []*domain.ChallengeCompletion
+	for _, c := range f.completions {
+		if c.UserID == userID {
+			copy := *c
+			out = append(out, &copy)
+		}
+	}
+	return out, nil
+}
+func (f *fakeRepo) InsertContainerEvent(_ context.Context, e *domain.ContainerEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e.ID = int64(len(f.events) + 1)
+	copy := *e
+	f.events = append(f.events, &copy)
+	return nil
+}
+func (f *fakeRepo) ListContainerEvents(_ context.Context, userID string, limit int) ([]*domain.ContainerEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []*domain.ContainerEvent
+	for i := len(f.events) - 1; i >= 0 && len(out) < limit; i-- {
+		if f.events[i].UserID == userID {
+			copy := *f.events[i]
+			out = append(out, &copy)
+		}
+	}
+	return out, nil
+}
+func (f *fakeRepo) PruneContainerEvents(context.Context, time.Duration) (int64, error) {
+	return 0, nil
+}
+func (f *fakeRepo) CreateSessionShare(_ context.Context, share *domain.SessionShare) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	copy := *share
+	f.shares = append(f.shares, &copy)
+	return nil
+}
+func (f *fakeRepo) GetSessionShare(_ context.Context, token string) (*domain.SessionShare, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, share := range f.shares {
+		if share.Token == token && !share.Expired(time.Now()) {
+			copy := *share
+			return &copy, nil
+		}
+	}
+	return nil, nil
+}
+func (f *fakeRepo) ListSessionShares(_ context.Context, userID string) ([]*domain.SessionShare, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []*domain.SessionShare
+	for i := len(f.shares) - 1; i >= 0; i-- {
+		if share := f.shares[i]; share.UserID == userID && !share.Expired(time.Now()) {
+			copy := *share
+			out = append(out, &copy)
+		}
+	}
+	return out, nil
+}
+func (f *fakeRepo) DeleteSessionShare(_ context.Context, userID, token string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := len(f.shares)
+	f.shares = slices.DeleteFunc(f.shares, func(share *domain.SessionShare) bool {
+		return share.UserID == userID && share.Token == token
+	})
+	return len(f.shares) < n, nil
+}
+func (f *fakeRepo) UpsertSnippet(_ context.Context, snippet *domain.Snippet) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	copy := *snippet
+	f.snippets = slices.DeleteFunc(f.snippets, func(s *domain.Snippet) bool {
+		return s.UserID == snippet.UserID && s.Name == snippet.Name
+	})
+	f.snippets = append(f.snippets, &copy)
+	return nil
+}
+func (f *fakeRepo) ListSnippets(_ context.Context, userID string) ([]*domain.Snippet, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []*domain.Snippet
+	for _, snippet := range f.snippets {
+		if snippet.UserID == userID {
+			copy := *snippet
+			out = append(out, &copy)
+		}
+	}
+	slices.SortFunc(out, func(a, b *domain.Snippet) int { return strings.Compare(a.Name, b.Name) })
+	return out, nil
+}
+func (f *fakeRepo) DeleteSnippet(_ context.Context, userID, name string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := len(f.snippets)
+	f.snippets = slices.DeleteFunc(f.snippets, func(s *domain.Snippet) bool {
+		return s.UserID == userID && s.Name == name
+	})
+	return len(f.snippets) < n, nil
+}
+func (f *fakeRepo) PruneExpiredSessionShares(_ context.Context) (int64, error)     { return 0, nil }
 func (f *fakeRepo) DeleteLegacyLocalState(_ context.Context) (int64, int64, error) { return 0, 0, nil }
+func (f *fakeRepo) InsertCommand(_ context.Context, c *domain.CommandRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c.ID = int64(len(f.commands) + 1)
+	copy := *c
+	f.commands = append(f.commands, &copy)
+	return nil
+}
+
+func (f *fakeRepo) ListCommands(_ context.Context, userID, sessionID string, limit int) ([]*domain.CommandRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []*domain.CommandRecord
+	for i := len(f.commands) - 1; i >= 0; i-- {
+		c := f.commands[i]
+		if c.UserID != userID || (sessionID != "" && c.SessionID != sessionID) {
+			continue
+		}
+		out = append(out, c)
+		if limit > 0 && len(out) == limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) ExportUserData(ctx context.Context, userID string) (*domain.UserDataExport, error) {
+	user, _ := f.GetUser(ctx, userID)
+	if user == nil {
+		return nil, nil
+	}
+	commands, _ := f.ListCommands(ctx, userID, "", 0)
+	return domain.NewUserDataExport(user, nil, commands, time.Now()), nil
+}
+
+func (f *fakeRepo) PurgeUser(_ context.Context, userID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.users, userID)
+	f.commands = slices.DeleteFunc(f.commands, func(c *domain.CommandRecord) bool { return c.UserID == userID })
+	f.notifications = slices.DeleteFunc(f.notifications, func(n *domain.Notification) bool { return n.UserID == userID })
+	f.queue = slices.DeleteFunc(f.queue, func(id string) bool { return id == userID })
+	return nil
+}
 
-type fakeManager struct{}
+func (f *fakeRepo) ReserveEventIDs(_ context.Context, _, _ string, n int64) (int64, error) {
+	return n, nil
+}
 
-func (f *fakeManager) EnsureContainer(context.Context, string, string, time.Time, map[string]string) (string, error) {
+func (f *fakeRepo) EnqueueProvision(_ context.Context, userID string, _ time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !slices.Contains(f.queue, userID) {
+		f.queue = append(f.queue, userID)
+	}
+	return nil
+}
+
+func (f *fakeRepo) DequeueProvision(_ context.Context, userID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queue = slices.DeleteFunc(f.queue, func(id string) bool { return id == userID })
+	return nil
+}
+
+func (f *fakeRepo) ListProvisionQueue(_ context.Context) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.queue), nil
+}
+
+func (f *fakeRepo) CreateNotification(_ context.Context, n *domain.Notification) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n.ID = int64(len(f.notifications) + 1)
+	copy := *n
+	f.notifications = append(f.notifications, &copy)
+	return nil
+}
+
+func (f *fakeRepo) ListNotifications(_ context.Context, userID string, unreadOnly bool, limit int) ([]*domain.Notification, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []*domain.Notification
+	for i := len(f.notifications) - 1; i >= 0 && len(out) < limit; i-- {
+		n := f.notifications[i]
+		if n.UserID != userID || (unreadOnly && n.IsRead()) {
+			continue
+		}
+		copy := *n
+		out = append(out, &copy)
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) MarkNotificationsRead(_ context.Context, userID string, ids []int64, readAt time.Time) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var marked int64
+	for _, n := range f.notifications {
+		if n.UserID != userID || n.IsRead() || (len(ids) > 0 && !slices.Contains(ids, n.ID)) {
+			continue
+		}
+		ts := readAt
+		n.ReadAt = &ts
+		marked++
+	}
+	return marked, nil
+}
+
+func (f *fakeRepo) CountUnreadNotifications(_ context.Context, userID string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	count := 0
+	for _, n := range f.notifications {
+		if n.UserID == userID && !n.IsRead() {
+			count++
+		}
+	}
+	return count, nil
+}
+
+type fakeManager struct {
+	runtime container.RuntimeStatus
+}
+
+func (f *fakeManager) EnsureContainer(context.Context, string, string, string, time.Time, map[string]string) (string, error) {
 	return "", nil
 }
 func (f *fakeManager) StopContainer(context.Context, string) error     { return nil }
 func (f *fakeManager) IsRunning(context.Context, string) (bool, error) { return false, nil }
+func (f *fakeManager) ProbeContainer(context.Context, string) error    { return nil }
 func (f *fakeManager) CreateExecSession(context.Context, string) (string, io.ReadWriteCloser, error) {
 	return "", nil, nil
 }
 func (f *fakeManager) ResizeExecSession(context.Context, string, uint, uint) error { return nil }
 func (f *fakeManager) Client() *client.Client                                      { return nil }
 func (f *fakeManager) EnsureNetwork(context.Context) (string, error)               { return "", nil }
+func (f *fakeManager) Runtime() container.RuntimeStatus                            { return f.runtime }
+func (f *fakeManager) ReapOrphans(context.Context, container.OwnerLookup, time.Duration) (container.ReapResult, error) {
+	return container.ReapResult{}, nil
+}
 
 type fakeSessionResetter struct {
 	mu          sync.Mutex
@@ -123,7 +573,7 @@ func TestDestroyResetsCurrentSession(t *testing.T) {
 	repo := newFakeRepo()
 	base := NewHandler(repo, &fakeManager{}, terminal.NewSessionManager(), "")
 	resetter := &fakeSessionResetter{}
-	handler := NewContainerHandlerWithAIConfigAndSessionReset(base, true, nil, resetter)
+	handler := NewContainerHandler(base, WithAI(true), WithSessionResetter(resetter))
 
 	req := httptest.NewRequest(http.MethodPost, "/api/destroy", nil)
 	req.Header.Set(identity.SessionHeaderName, "tab-ephemeral")
@@ -147,7 +597,7 @@ func TestDestroyReturnsSuccessWhenResetFails(t *testing.T) {
 	repo := newFakeRepo()
 	base := NewHandler(repo, &fakeManager{}, terminal.NewSessionManager(), "")
 	resetter := &fakeSessionResetter{err: errors.New("agent unavailable")}
-	handler := NewContainerHandlerWithAIConfigAndSessionReset(base, true, nil, resetter)
+	handler := NewContainerHandler(base, WithAI(true), WithSessionResetter(resetter))
 
 	req := httptest.NewRequest(http.MethodPost, "/api/destroy", nil)
 	req.Header.Set(identity.SessionHeaderName, "tab-ephemeral")
@@ -163,3 +613,117 @@ func TestDestroyReturnsSuccessWhenResetFails(t *testing.T) {
 		t.Fatalf("expected at least one reset attempt, got %d", resetter.callCount())
 	}
 }
+
+// volumeManager records container stops and volume removals.
+type volumeManager struct {
+	fakeManager
+	mu      sync.Mutex
+	calls   []string
+	removed []string
+}
+
+func (m *volumeManager) StopContainer(_ context.Context, containerID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, "stop:"+containerID)
+	return nil
+}
+
+func (m *volumeManager) RemoveVolume(_ context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, "remove_volume:"+userID)
+	m.removed = append(m.removed, userID)
+	return nil
+}
+
+func serveDestroy(repo *fakeRepo, handler *ContainerHandler, query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/destroy"+query, nil)
+	req.AddCookie(&http.Cookie{Name: identity.AnonCookieName, Value: provisionTestUser})
+	rr := httptest.NewRecorder()
+	identity.Middleware(repo, true)(http.HandlerFunc(handler.Destroy)).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestDestroyPurgeRequiresConfirmation(t *testing.T) {
+	repo := newFakeRepo()
+	mgr := &volumeManager{}
+	handler := NewContainerHandler(NewHandler(repo, mgr, terminal.NewSessionManager(), ""))
+
+	rr := serveDestroy(repo, handler, "?purge=true")
+	if rr.Code != http.StatusPreconditionRequired {
+		t.Fatalf("expected 428 without confirmation, got %d", rr.Code)
+	}
+	if len(mgr.removed) != 0 {
+		t.Fatalf("volume removed without confirmation: %v", mgr.removed)
+	}
+}
+
+func TestDestroyPurgeRemovesVolumeAfterContainer(t *testing.T) {
+	repo := newFakeRepo()
+	mgr := &volumeManager{}
+	handler := NewContainerHandler(NewHandler(repo, mgr, terminal.NewSessionManager(), ""))
+	if err := repo.UpsertUser(t.Context(), &domain.User{UserID: provisionTestUser, ContainerID: "container-1"}); err != nil {
+		t.Fatalf("upsert user: %v", err)
+	}
+
+	rr := serveDestroy(repo, handler, "?purge=true&confirm=true")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"volume":"purged"`) {
+		t.Fatalf("expected purge to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	want := []string{"stop:container-1", "remove_volume:" + provisionTestUser}
+	if !slices.Equal(mgr.calls, want) {
+		t.Fatalf("expected %v, got %v", want, mgr.calls)
+	}
+}
+
+type fakeLogPurger struct{ purged []string }
+
+func (p *fakeLogPurger) PurgeUser(userID string) error {
+	p.purged = append(p.purged, userID)
+	return nil
+}
+
+func TestDestroyPurgeErasesIdentity(t *testing.T) {
+	repo := newFakeRepo()
+	handler := NewContainerHandler(NewHandler(repo, &volumeManager{}, terminal.NewSessionManager(), ""))
+	logs := &fakeLogPurger{}
+	handler.SetConversationLogPurger(logs)
+	if err := repo.InsertCommand(t.Context(), &domain.CommandRecord{UserID: provisionTestUser, Command: "ls"}); err != nil {
+		t.Fatalf("insert command: %v", err)
+	}
+
+	rr := serveDestroy(repo, handler, "?purge=true&confirm=true")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected purge to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if user, _ := repo.GetUser(t.Context(), provisionTestUser); user != nil {
+		t.Fatal("expected user record to be purged")
+	}
+	if commands, _ := repo.ListCommands(t.Context(), provisionTestUser, "", 0); len(commands) != 0 {
+		t.Fatalf("expected command history to be purged, got %d", len(commands))
+	}
+	if !slices.Equal(logs.purged, []string{provisionTestUser}) {
+		t.Fatalf("expected conversation logs purged for %s, got %v", provisionTestUser, logs.purged)
+	}
+	cookies := rr.Result().Cookies()
+	if last := cookies[len(cookies)-1]; last.Name != identity.AnonCookieName || last.MaxAge >= 0 {
+		t.Fatalf("expected identity cookie to be cleared, got %+v", last)
+	}
+}
+
+func TestDestroyKeepsVolumeByDefault(t *testing.T) {
+	repo := newFakeRepo()
+	mgr := &volumeManager{}
+	handler := NewContainerHandler(NewHandler(repo, mgr, terminal.NewSessionManager(), ""))
+
+	rr := serveDestroy(repo, handler, "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"volume":"kept"`) {
+		t.Fatalf("expected volume to be kept, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(mgr.removed) != 0 {
+		t.Fatalf("volume removed without purge: %v", mgr.removed)
+	}
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/identity"
+)
+
+// pauseTimeout bounds a pause request against the Docker host.
+const pauseTimeout = 10 * time.Second
+
+// Pause handles POST /api/container/pause.
+// It freezes the user's container so it stops using CPU while keeping its
+// processes and files; open terminals are closed first. The container resumes
+// when a terminal reconnects or the user provisions again, and still counts
+// toward the session TTL while paused.
+func (h *ContainerHandler) Pause(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+
+	pauser, ok := h.mgr.(container.Pauser)
+	if !ok {
+		Error(w, http.StatusNotImplemented, "pause_unsupported")
+		return
+	}
+
+	user, err := h.repo.GetUser(r.Context(), userID)
+	if err != nil || user == nil {
+		Error(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+	if user.ContainerID == "" {
+		Error(w, http.StatusConflict, "no active container")
+		return
+	}
+
+	// A paused container cannot serve its terminals, so end them cleanly
+	// rather than leaving them frozen.
+	h.sm.CloseSession(userID)
+
+	ctx, cancel := context.WithTimeout(r.Context(), pauseTimeout)
+	defer cancel()
+	if err := pauser.PauseContainer(ctx, user.ContainerID); err != nil {
+		slog.Error("Failed to pause container", "error", err, "user_id", userID, "container_id", user.ContainerID)
+		Error(w, http.StatusInternalServerError, "failed to pause container")
+		return
+	}
+
+	slog.Info("Container paused by user", "user_id", userID, "container_id", user.ContainerID)
+	JSON(w, http.StatusOK, map[string]string{"status": "paused"})
+}
@@ -0,0 +1,78 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+)
+
+// pauseManager records paused and resumed containers.
+type pauseManager struct {
+	fakeManager
+	mu     sync.Mutex
+	paused []string
+}
+
+func (m *pauseManager) PauseContainer(_ context.Context, containerID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.paused = append(m.paused, containerID)
+	return nil
+}
+
+func (m *pauseManager) ResumeContainer(context.Context, string) error { return nil }
+
+func servePause(repo *fakeRepo, handler *ContainerHandler) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/container/pause", nil)
+	req.AddCookie(&http.Cookie{Name: identity.AnonCookieName, Value: provisionTestUser})
+	rr := httptest.NewRecorder()
+	identity.Middleware(repo, true)(http.HandlerFunc(handler.Pause)).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestPausePausesUserContainer(t *testing.T) {
+	repo := newFakeRepo()
+	mgr := &pauseManager{}
+	handler := NewContainerHandler(NewHandler(repo, mgr, terminal.NewSessionManager(), ""))
+	if err := repo.UpsertUser(t.Context(), &domain.User{UserID: provisionTestUser, ContainerID: "container-1"}); err != nil {
+		t.Fatalf("upsert user: %v", err)
+	}
+
+	rr := servePause(repo, handler)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	if !slices.Equal(mgr.paused, []string{"container-1"}) {
+		t.Fatalf("expected container-1 paused, got %v", mgr.paused)
+	}
+}
+
+func TestPauseWithoutContainer(t *testing.T) {
+	repo := newFakeRepo()
+	handler := NewContainerHandler(NewHandler(repo, &pauseManager{}, terminal.NewSessionManager(), ""))
+
+	rr := servePause(repo, handler)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 without a container, got %d", rr.Code)
+	}
+}
+
+func TestPauseUnsupportedManager(t *testing.T) {
+	repo := newFakeRepo()
+	handler := NewContainerHandler(NewHandler(repo, &fakeManager{}, terminal.NewSessionManager(), ""))
+
+	rr := servePause(repo, handler)
+	if rr.Code != http.StatusNotImplemented {
+		t.Fatalf("expected 501 for a manager without pause support, got %d", rr.Code)
+	}
+}
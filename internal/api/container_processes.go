@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+)
+
+// inspectTimeout bounds listing a container's processes or ports.
+const inspectTimeout = 10 * time.Second
+
+// Processes handles GET /api/container/processes.
+// It lists every process in the user's container, so the UI can show what
+// is running without the learner typing ps.
+func (h *ContainerHandler) Processes(w http.ResponseWriter, r *http.Request) {
+	inspector, user, ok := h.inspectTarget(w, r)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), inspectTimeout)
+	defer cancel()
+	procs, err := inspector.Processes(ctx, user.ContainerID)
+	if err != nil {
+		slog.Warn("Failed to list container processes", "error", err, "user_id", user.UserID, "container_id", user.ContainerID)
+		Error(w, http.StatusInternalServerError, "failed to list processes")
+		return
+	}
+	if procs == nil {
+		procs = []container.Process{}
+	}
+	JSON(w, http.StatusOK, map[string]interface{}{"processes": procs})
+}
+
+// Ports handles GET /api/container/ports.
+// It lists the TCP ports listening and UDP ports bound in the user's
+// container with the process holding each, so questions such as whether
+// nginx is listening on port 80 are answered from the container itself.
+func (h *ContainerHandler) Ports(w http.ResponseWriter, r *http.Request) {
+	inspector, user, ok := h.inspectTarget(w, r)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), inspectTimeout)
+	defer cancel()
+	ports, err := inspector.Ports(ctx, user.ContainerID)
+	if err != nil {
+		slog.Warn("Failed to list container ports", "error", err, "user_id", user.UserID, "container_id", user.ContainerID)
+		Error(w, http.StatusInternalServerError, "failed to list ports")
+		return
+	}
+	if ports == nil {
+		ports = []container.Port{}
+	}
+	JSON(w, http.StatusOK, map[string]interface{}{"ports": ports})
+}
+
+// inspectTarget returns the manager's process inspector and the user whose
+// container it inspects, writing an error response if either is missing.
+func (h *ContainerHandler) inspectTarget(w http.ResponseWriter, r *http.Request) (container.ProcessInspector, *domain.User, bool) {
+	userID := identity.UserIDFromContext(r.Context())
+
+	inspector, ok := h.mgr.(container.ProcessInspector)
+	if !ok {
+		Error(w, http.StatusNotImplemented, "inspect_unsupported")
+		return nil, nil, false
+	}
+	user, err := h.repo.GetUser(r.Context(), userID)
+	if err != nil || user == nil {
+		Error(w, http.StatusUnauthorized, "user not found")
+		return nil, nil, false
+	}
+	if user.ContainerID == "" {
+		Error(w, http.StatusConflict, "no active container")
+		return nil, nil, false
+	}
+	return inspector, user, true
+}
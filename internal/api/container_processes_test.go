@@ -0,0 +1,68 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+)
+
+// inspectManager reports a fixed set of processes and ports.
+type inspectManager struct {
+	fakeManager
+	procs []container.Process
+	ports []container.Port
+}
+
+func (m *inspectManager) Processes(context.Context, string) ([]container.Process, error) {
+	return m.procs, nil
+}
+
+func (m *inspectManager) Ports(context.Context, string) ([]container.Port, error) {
+	return m.ports, nil
+}
+
+func TestContainerProcessesAndPorts(t *testing.T) {
+	repo := newFakeRepo()
+	mgr := &inspectManager{
+		procs: []container.Process{{PID: 1, User: "learner", State: "S", Name: "sleep", Command: "sleep infinity"}},
+		ports: []container.Port{{Protocol: "tcp", Address: "0.0.0.0", Port: 80, PID: 42, Process: "nginx"}},
+	}
+	handler := NewContainerHandler(NewHandler(repo, mgr, terminal.NewSessionManager(), ""))
+	serve := func(h http.HandlerFunc, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.AddCookie(&http.Cookie{Name: identity.AnonCookieName, Value: provisionTestUser})
+		rr := httptest.NewRecorder()
+		identity.Middleware(repo, true)(h).ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := serve(handler.Ports, "/api/container/ports"); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 without a container, got %d", rr.Code)
+	}
+	if err := repo.UpsertUser(t.Context(), &domain.User{UserID: provisionTestUser, ContainerID: "container-1"}); err != nil {
+		t.Fatalf("upsert user: %v", err)
+	}
+
+	rr := serve(handler.Processes, "/api/container/processes")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"command":"sleep infinity"`) {
+		t.Fatalf("processes: %d %s", rr.Code, rr.Body.String())
+	}
+	rr = serve(handler.Ports, "/api/container/ports")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `{"protocol":"tcp","address":"0.0.0.0","port":80,"pid":42,"process":"nginx"}`) {
+		t.Fatalf("ports: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Nothing listening is an empty list, not null.
+	mgr.ports = nil
+	if rr := serve(handler.Ports, "/api/container/ports"); !strings.Contains(rr.Body.String(), `"ports":[]`) {
+		t.Fatalf("expected an empty list, got %s", rr.Body.String())
+	}
+}
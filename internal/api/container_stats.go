@@ -0,0 +1,101 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/events"
+	"github.com/ashureev/shsh-labs/internal/identity"
+)
+
+// Stats handles GET /api/container/stats.
+// It streams the user's container CPU, memory and process usage as SSE
+// container_stats events (see internal/events), about one per second, so
+// learners can watch what their commands cost. The stream ends when the
+// container stops; clients reconnect after provisioning again.
+func (h *ContainerHandler) Stats(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+
+	streamer, ok := h.mgr.(container.StatsStreamer)
+	if !ok {
+		Error(w, http.StatusNotImplemented, "stats_unsupported")
+		return
+	}
+	user, err := h.repo.GetUser(r.Context(), userID)
+	if err != nil || user == nil {
+		Error(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+	if user.ContainerID == "" {
+		Error(w, http.StatusConflict, "no active container")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		Error(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	samples, err := streamer.Stats(r.Context(), user.ContainerID)
+	if err != nil {
+		slog.Warn("Failed to stream container stats", "error", err, "user_id", userID, "container_id", user.ContainerID)
+		Error(w, http.StatusConflict, "container not running")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	retryDelay := 5 * time.Second
+	keepaliveInterval := 10 * time.Second
+	if h.cfg != nil {
+		retryDelay = h.cfg.SSE.RetryDelay
+		keepaliveInterval = h.cfg.SSE.KeepaliveInterval
+	}
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", retryDelay.Milliseconds()); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	// A paused container produces no samples, so keep the connection alive.
+	keepalive := time.NewTicker(keepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			if _, err := io.WriteString(w, "event: ping\ndata: {\"status\":\"alive\"}\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case sample, ok := <-samples:
+			if !ok {
+				return
+			}
+			if err := events.Write(w, 0, statsEvent(sample)); err != nil {
+				slog.Warn("failed to write container stats event", "error", err, "user_id", userID)
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// statsEvent converts a usage sample into its typed SSE payload.
+func statsEvent(s container.Stats) *events.ContainerStats {
+	return &events.ContainerStats{
+		CPUMillicores:      s.CPUMillicores,
+		CPULimitMillicores: s.CPULimitMillicores,
+		MemoryBytes:        s.MemoryBytes,
+		MemoryLimitBytes:   s.MemoryLimitBytes,
+		Pids:               s.Pids,
+		PidsLimit:          s.PidsLimit,
+	}
+}
@@ -0,0 +1,63 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+)
+
+// statsManager streams a fixed set of samples.
+type statsManager struct {
+	fakeManager
+	samples []container.Stats
+}
+
+func (m *statsManager) Stats(context.Context, string) (<-chan container.Stats, error) {
+	out := make(chan container.Stats, len(m.samples))
+	for _, s := range m.samples {
+		out <- s
+	}
+	close(out)
+	return out, nil
+}
+
+func TestContainerStatsStreamsSamples(t *testing.T) {
+	repo := newFakeRepo()
+	mgr := &statsManager{samples: []container.Stats{
+		{CPUMillicores: 120, CPULimitMillicores: 500, MemoryBytes: 1 << 20, MemoryLimitBytes: 512 << 20},
+		{CPUMillicores: 480, CPULimitMillicores: 500, MemoryBytes: 2 << 20, MemoryLimitBytes: 512 << 20},
+	}}
+	handler := NewContainerHandler(NewHandler(repo, mgr, terminal.NewSessionManager(), ""))
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/container/stats", nil)
+		req.AddCookie(&http.Cookie{Name: identity.AnonCookieName, Value: provisionTestUser})
+		rr := httptest.NewRecorder()
+		identity.Middleware(repo, true)(http.HandlerFunc(handler.Stats)).ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := serve(); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 without a container, got %d", rr.Code)
+	}
+	if err := repo.UpsertUser(t.Context(), &domain.User{UserID: provisionTestUser, ContainerID: "container-1"}); err != nil {
+		t.Fatalf("upsert user: %v", err)
+	}
+
+	// The stream ends when the container stops producing samples.
+	rr := serve()
+	body := rr.Body.String()
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected response %d: %s", rr.Code, body)
+	}
+	if strings.Count(body, "event: container_stats\n") != 2 || !strings.Contains(body, `"cpu_millicores":480,"cpu_limit_millicores":500,"memory_bytes":2097152`) {
+		t.Fatalf("unexpected stream:\n%s", body)
+	}
+}
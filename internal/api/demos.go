@@ -0,0 +1,147 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/ashureev/shsh-labs/internal/events"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+	"github.com/ashureev/shsh-labs/internal/terminal/demo"
+	"github.com/go-chi/chi/v5"
+)
+
+// Playback speed bounds for GET /api/demos/{name}/play.
+const (
+	minDemoSpeed = 0.25
+	maxDemoSpeed = 4
+)
+
+// DemoHandler serves the library of recorded demos to learners, who replay
+// them into a read-only pane.
+type DemoHandler struct {
+	*Handler
+	library *demo.Library
+	pty     *terminal.PTYController
+}
+
+// NewDemoHandler creates a demo handler. Playback uses pty's timing.
+func NewDemoHandler(base *Handler, library *demo.Library, pty *terminal.PTYController) *DemoHandler {
+	return &DemoHandler{Handler: base, library: library, pty: pty}
+}
+
+// RegisterRoutes registers demo routes.
+func (h *DemoHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/api/demos", h.ListDemos)
+	r.Get("/api/demos/{name}", h.GetDemo)
+	r.Get("/api/demos/{name}/play", h.PlayDemo)
+}
+
+// ListDemos handles GET /api/demos.
+func (h *DemoHandler) ListDemos(w http.ResponseWriter, _ *http.Request) {
+	demos, err := h.library.List()
+	if err != nil {
+		slog.Error("Failed to list demos", "error", err)
+		Error(w, http.StatusInternalServerError, "failed to load demos")
+		return
+	}
+	JSON(w, http.StatusOK, map[string]interface{}{"demos": demos})
+}
+
+// GetDemo handles GET /api/demos/{name}, returning the demo split into
+// steps so the client can step through it.
+func (h *DemoHandler) GetDemo(w http.ResponseWriter, r *http.Request) {
+	d, ok := h.loadDemo(w, r)
+	if !ok {
+		return
+	}
+	JSON(w, http.StatusOK, d)
+}
+
+// PlayDemo handles GET /api/demos/{name}/play, streaming the demo's output
+// as demo_frame SSE events with its recorded timing. A step query parameter
+// plays only that step; speed (0.25-4, default 1) scales the timing. The
+// stream ends with an event that has done set.
+func (h *DemoHandler) PlayDemo(w http.ResponseWriter, r *http.Request) {
+	d, ok := h.loadDemo(w, r)
+	if !ok {
+		return
+	}
+
+	first, last := 0, len(d.Steps)-1
+	if s := r.URL.Query().Get("step"); s != "" {
+		step, err := strconv.Atoi(s)
+		if err != nil || step < 0 || step >= len(d.Steps) {
+			Error(w, http.StatusBadRequest, "invalid step")
+			return
+		}
+		first, last = step, step
+	}
+	speed := 1.0
+	if s := r.URL.Query().Get("speed"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			Error(w, http.StatusBadRequest, "invalid speed")
+			return
+		}
+		speed = min(max(v, minDemoSpeed), maxDemoSpeed)
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		Error(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	out := &demoFrameWriter{w: w, flusher: flusher, demo: d.Name}
+	for i := first; i <= last; i++ {
+		out.step = i
+		if err := h.pty.Play(r.Context(), out, d.Steps[i].PlaybackFrames(), speed); err != nil {
+			slog.Debug("Demo playback stopped", "error", err, "demo", d.Name)
+			return
+		}
+	}
+	if err := events.Write(w, 0, &events.DemoFrame{Demo: d.Name, Step: last, Done: true}); err != nil {
+		return
+	}
+	flusher.Flush()
+}
+
+// loadDemo fetches the demo named in the URL, writing an error response if
+// it cannot.
+func (h *DemoHandler) loadDemo(w http.ResponseWriter, r *http.Request) (*demo.Demo, bool) {
+	name := chi.URLParam(r, "name")
+	d, err := h.library.Get(name)
+	switch {
+	case errors.Is(err, demo.ErrNotFound), errors.Is(err, demo.ErrInvalidName):
+		Error(w, http.StatusNotFound, "demo not found")
+		return nil, false
+	case err != nil:
+		slog.Error("Failed to load demo", "error", err, "demo", name)
+		Error(w, http.StatusInternalServerError, "failed to load demo")
+		return nil, false
+	}
+	return d, true
+}
+
+// demoFrameWriter sends each write from the PTY controller as a demo_frame
+// event.
+type demoFrameWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	demo    string
+	step    int
+}
+
+func (f *demoFrameWriter) Write(p []byte) (int, error) {
+	if err := events.Write(f.w, 0, &events.DemoFrame{Demo: f.demo, Step: f.step, Data: string(p)}); err != nil {
+		return 0, err
+	}
+	f.flusher.Flush()
+	return len(p), nil
+}
@@ -0,0 +1,76 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+	"github.com/ashureev/shsh-labs/internal/terminal/demo"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestDemoRecordAndPlay(t *testing.T) {
+	repo := newFakeRepo()
+	repo.users["u1"] = &domain.User{UserID: "u1", Username: "instructor"}
+	base := NewHandler(repo, &fakeManager{}, terminal.NewSessionManager(), "")
+	library := demo.NewLibrary(t.TempDir(), time.Hour)
+
+	admin := NewAdminHandler(base, &config.Config{Admin: config.AdminConfig{Token: "secret"}})
+	admin.SetDemoLibrary(library)
+	r := chi.NewRouter()
+	admin.RegisterRoutes(r)
+	NewDemoHandler(base, library, terminal.NewPTYController(terminal.PTYConfig{}, nil)).RegisterRoutes(r)
+
+	if rr := doAdminRequest(r, http.MethodPost, "/api/admin/demos/find-files/recording", "secret", `{"user_id":"nobody"}`); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown user, got %d", rr.Code)
+	}
+	rr := doAdminRequest(r, http.MethodPost, "/api/admin/demos/find-files/recording", "secret", `{"user_id":"u1","title":"Finding files"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	library.TapOutput("u1", "tab1", []byte("$ "))
+	library.TapInput("u1", "tab1", []byte("ls\r"))
+	library.TapOutput("u1", "tab1", []byte("ls\r\nnotes.txt\r\n$ "))
+	library.TapInput("u1", "tab1", []byte("pwd\r"))
+	library.TapOutput("u1", "tab1", []byte("pwd\r\n/home\r\n$ "))
+	if rr := doAdminRequest(r, http.MethodDelete, "/api/admin/demos/find-files/recording", "secret", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 when stopping, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = doAdminRequest(r, http.MethodGet, "/api/demos/find-files", "", "")
+	var d demo.Demo
+	if err := json.Unmarshal(rr.Body.Bytes(), &d); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("GET demo: %d %s", rr.Code, rr.Body.String())
+	}
+	if d.Title != "Finding files" || d.StepCount != 2 || d.Steps[1].Command != "pwd" {
+		t.Fatalf("unexpected demo: %+v", d)
+	}
+
+	rr = doAdminRequest(r, http.MethodGet, "/api/demos/find-files/play?step=1&speed=4", "", "")
+	body := rr.Body.String()
+	if rr.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected SSE response, got %q", rr.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(body, `"data":"pwd\r\n/home\r\n$ "`) || strings.Contains(body, "notes.txt") {
+		t.Fatalf("expected only step 1 output, got %s", body)
+	}
+	if !strings.Contains(body, `"done":true`) {
+		t.Fatalf("expected final done event, got %s", body)
+	}
+	if rr := doAdminRequest(r, http.MethodGet, "/api/demos/find-files/play?step=2", "", ""); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for out of range step, got %d", rr.Code)
+	}
+
+	if rr := doAdminRequest(r, http.MethodDelete, "/api/admin/demos/find-files", "secret", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 when deleting, got %d", rr.Code)
+	}
+	if rr := doAdminRequest(r, http.MethodGet, "/api/demos/find-files", "", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", rr.Code)
+	}
+}
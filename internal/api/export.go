@@ -0,0 +1,51 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/go-chi/chi/v5"
+)
+
+// ExportHandler serves a user's data export.
+type ExportHandler struct {
+	*Handler
+}
+
+// NewExportHandler creates an export handler.
+func NewExportHandler(base *Handler) *ExportHandler {
+	return &ExportHandler{Handler: base}
+}
+
+// RegisterRoutes registers export routes.
+func (h *ExportHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/api/export", h.Export)
+}
+
+// Export handles GET /api/export. It returns the caller's user record, agent
+// session and command history as a JSON download.
+func (h *ExportHandler) Export(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	if userID == "" {
+		Error(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	export, err := h.repo.ExportUserData(r.Context(), userID)
+	if err != nil {
+		slog.Error("Failed to export user data", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to export data")
+		return
+	}
+	if export == nil {
+		Error(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	filename := fmt.Sprintf("shsh-export-%s.json", export.ExportedAt.UTC().Format("20060102T150405Z"))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+	JSON(w, http.StatusOK, export)
+}
@@ -0,0 +1,77 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+)
+
+func TestExportUserData(t *testing.T) {
+	repo := newFakeRepo()
+	ctx := context.Background()
+	base := time.Unix(1_700_000_000, 0)
+	for i, command := range []string{"ls", "pwd"} {
+		c := &domain.CommandRecord{
+			UserID:    provisionTestUser,
+			SessionID: "tab-1",
+			Sequence:  i + 1,
+			Command:   command,
+			Duration:  1500 * time.Millisecond,
+			EndedAt:   base.Add(time.Duration(i) * time.Minute),
+		}
+		if err := repo.InsertCommand(ctx, c); err != nil {
+			t.Fatalf("insert command: %v", err)
+		}
+	}
+
+	handler := NewExportHandler(NewHandler(repo, &fakeManager{}, terminal.NewSessionManager(), ""))
+	req := httptest.NewRequest(http.MethodGet, "/api/export", nil)
+	req.AddCookie(&http.Cookie{Name: identity.AnonCookieName, Value: provisionTestUser})
+	rr := httptest.NewRecorder()
+	identity.Middleware(repo, true)(http.HandlerFunc(handler.Export)).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if disposition := rr.Header().Get("Content-Disposition"); !strings.HasPrefix(disposition, "attachment;") {
+		t.Fatalf("expected attachment, got %q", disposition)
+	}
+	var export domain.UserDataExport
+	if err := json.NewDecoder(rr.Body).Decode(&export); err != nil {
+		t.Fatalf("decode export: %v", err)
+	}
+	if export.User == nil || export.User.UserID != provisionTestUser {
+		t.Fatalf("unexpected user: %+v", export.User)
+	}
+	if len(export.Commands) != 2 || export.Commands[0].Command != "ls" || export.Commands[1].DurationMs != 1500 {
+		t.Fatalf("expected commands oldest first, got %+v", export.Commands)
+	}
+}
+
+func TestNewUserDataExportKeepsStoredJSON(t *testing.T) {
+	challenge := `{"id":"c1"}`
+	session := &domain.AgentSession{MessagesJSON: `[{"role":"user","content":"hi"}]`, ChallengeJSON: &challenge}
+	data, err := json.Marshal(domain.NewUserDataExport(&domain.User{UserID: "u1"}, []*domain.AgentSession{session}, nil, time.Now()))
+	if err != nil {
+		t.Fatalf("marshal export: %v", err)
+	}
+	if !strings.Contains(string(data), `"messages":[{"role":"user","content":"hi"}]`) ||
+		!strings.Contains(string(data), `"challenge":{"id":"c1"}`) {
+		t.Fatalf("stored JSON not embedded: %s", data)
+	}
+
+	session.MessagesJSON = "not json"
+	data, err = json.Marshal(domain.NewUserDataExport(&domain.User{UserID: "u1"}, []*domain.AgentSession{session}, nil, time.Now()))
+	if err != nil || !strings.Contains(string(data), `"messages":"not json"`) {
+		t.Fatalf("invalid JSON not quoted: %s (%v)", data, err)
+	}
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// defaultFileMaxBytes is the file size limit used when no config is
+	// given.
+	defaultFileMaxBytes = 10 * 1024 * 1024
+	// fileTimeout bounds a single file browser operation.
+	fileTimeout = 30 * time.Second
+	// uploadOverhead allows for the multipart headers of an upload on top
+	// of its files.
+	uploadOverhead = 64 * 1024
+)
+
+// FileHandler lets the frontend show a file tree of the learner's work
+// volume next to the terminal, and open, edit, upload and download its
+// files. Files are reached through the running container as the terminal
+// user, so the learner's own permissions apply.
+type FileHandler struct {
+	*Handler
+	maxBytes int64
+}
+
+// NewFileHandler creates a file browser handler.
+func NewFileHandler(base *Handler, cfg *config.Config) *FileHandler {
+	h := &FileHandler{Handler: base, maxBytes: defaultFileMaxBytes}
+	if cfg != nil && cfg.FileMaxBytes > 0 {
+		h.maxBytes = cfg.FileMaxBytes
+	}
+	return h
+}
+
+// RegisterRoutes registers file browser routes. Paths are given in the path
+// query parameter, relative to the work volume.
+func (h *FileHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/api/files", h.ListFiles)
+	r.Get("/api/files/content", h.ReadFile)
+	r.Put("/api/files/content", h.WriteFile)
+	r.Post("/api/files/upload", h.UploadFiles)
+}
+
+// ListFiles handles GET /api/files?path=dir with the entries of a directory;
+// an empty path lists the top of the volume.
+func (h *FileHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
+	browser, user, ok := h.fileTarget(w, r)
+	if !ok {
+		return
+	}
+	dir := r.URL.Query().Get("path")
+	ctx, cancel := context.WithTimeout(r.Context(), fileTimeout)
+	defer cancel()
+	entries, err := browser.ListFiles(ctx, user.ContainerID, dir)
+	if err != nil {
+		h.fileError(w, err, user.UserID, "list", dir)
+		return
+	}
+	JSON(w, http.StatusOK, map[string]interface{}{"path": dir, "entries": entries})
+}
+
+// ReadFile handles GET /api/files/content?path=file. Text is served as
+// text/plain and anything else as an octet stream, never as a type the
+// browser would render. With download=1 the file is sent as an attachment.
+func (h *FileHandler) ReadFile(w http.ResponseWriter, r *http.Request) {
+	browser, user, ok := h.fileTarget(w, r)
+	if !ok {
+		return
+	}
+	name := r.URL.Query().Get("path")
+	if name == "" {
+		Error(w, http.StatusBadRequest, "path is required")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), fileTimeout)
+	defer cancel()
+	data, err := browser.ReadFile(ctx, user.ContainerID, name, h.maxBytes)
+	if err != nil {
+		h.fileError(w, err, user.UserID, "read", name)
+		return
+	}
+
+	contentType := "application/octet-stream"
+	if utf8.Valid(data) {
+		contentType = "text/plain; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Cache-Control", "no-store")
+	if r.URL.Query().Get("download") == "1" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base("/"+name)))
+	}
+	_, _ = w.Write(data)
+}
+
+// WriteFile handles PUT /api/files/content?path=file, replacing the file with
+// the request body and creating missing directories.
+func (h *FileHandler) WriteFile(w http.ResponseWriter, r *http.Request) {
+	browser, user, ok := h.fileTarget(w, r)
+	if !ok {
+		return
+	}
+	name := r.URL.Query().Get("path")
+	if name == "" {
+		Error(w, http.StatusBadRequest, "path is required")
+		return
+	}
+	// The body is read in full first so an oversized one never leaves a
+	// truncated file behind.
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBytes))
+	if err != nil {
+		h.bodyError(w, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), fileTimeout)
+	defer cancel()
+	if err := browser.WriteFile(ctx, user.ContainerID, name, bytes.NewReader(data)); err != nil {
+		h.fileError(w, err, user.UserID, "write", name)
+		return
+	}
+	JSON(w, http.StatusOK, map[string]interface{}{"path": name, "size": len(data)})
+}
+
+// UploadFiles handles POST /api/files/upload?path=dir with a multipart form,
+// writing each file part into the directory under its own base name. The
+// files of one upload together are bounded by the file size limit.
+func (h *FileHandler) UploadFiles(w http.ResponseWriter, r *http.Request) {
+	browser, user, ok := h.fileTarget(w, r)
+	if !ok {
+		return
+	}
+	dir := r.URL.Query().Get("path")
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBytes+uploadOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		Error(w, http.StatusBadRequest, "expected a multipart form")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), fileTimeout)
+	defer cancel()
+	uploaded := []string{}
+	remaining := h.maxBytes
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			h.bodyError(w, err)
+			return
+		}
+		filename := path.Base("/" + part.FileName())
+		if part.FileName() == "" || filename == "/" {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(part, remaining+1))
+		if err != nil {
+			h.bodyError(w, err)
+			return
+		}
+		if remaining -= int64(len(data)); remaining < 0 {
+			Error(w, http.StatusRequestEntityTooLarge, "file too large")
+			return
+		}
+		name := path.Join(dir, filename)
+		if err := browser.WriteFile(ctx, user.ContainerID, name, bytes.NewReader(data)); err != nil {
+			h.fileError(w, err, user.UserID, "upload", name)
+			return
+		}
+		uploaded = append(uploaded, name)
+	}
+	if len(uploaded) == 0 {
+		Error(w, http.StatusBadRequest, "no files uploaded")
+		return
+	}
+	slog.Info("Files uploaded by user", "user_id", user.UserID, "files", len(uploaded))
+	JSON(w, http.StatusOK, map[string]interface{}{"uploaded": uploaded})
+}
+
+// fileTarget returns the manager's file browser and the user whose volume
+// it browses, writing an error response if either is missing.
+func (h *FileHandler) fileTarget(w http.ResponseWriter, r *http.Request) (container.FileBrowser, *domain.User, bool) {
+	userID := identity.UserIDFromContext(r.Context())
+
+	browser, ok := h.mgr.(container.FileBrowser)
+	if !ok {
+		Error(w, http.StatusNotImplemented, "files_unsupported")
+		return nil, nil, false
+	}
+	user, err := h.repo.GetUser(r.Context(), userID)
+	if err != nil || user == nil {
+		Error(w, http.StatusUnauthorized, "user not found")
+		return nil, nil, false
+	}
+	if user.ContainerID == "" {
+		Error(w, http.StatusConflict, "no active container")
+		return nil, nil, false
+	}
+	return browser, user, true
+}
+
+// fileError writes the response for a failed file operation.
+func (h *FileHandler) fileError(w http.ResponseWriter, err error, userID, op, name string) {
+	switch {
+	case errors.Is(err, container.ErrFileNotFound):
+		Error(w, http.StatusNotFound, "file not found")
+	case errors.Is(err, container.ErrFileType):
+		Error(w, http.StatusBadRequest, "wrong file type")
+	case errors.Is(err, container.ErrFileDenied):
+		Error(w, http.StatusForbidden, "permission denied")
+	case errors.Is(err, container.ErrFileTooLarge):
+		Error(w, http.StatusRequestEntityTooLarge, "file too large")
+	default:
+		slog.Error("File browser operation failed", "error", err, "user_id", userID, "op", op, "path", name)
+		Error(w, http.StatusInternalServerError, "file operation failed")
+	}
+}
+
+// bodyError writes the response for a request body that could not be read.
+func (h *FileHandler) bodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		Error(w, http.StatusRequestEntityTooLarge, "file too large")
+		return
+	}
+	Error(w, http.StatusBadRequest, "invalid request body")
+}
@@ -0,0 +1,106 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+	"github.com/go-chi/chi/v5"
+)
+
+// fileManager keeps a flat work volume in memory.
+type fileManager struct {
+	fakeManager
+	files map[string][]byte
+}
+
+func (m *fileManager) ListFiles(_ context.Context, _ string, dir string) ([]container.FileEntry, error) {
+	var entries []container.FileEntry
+	for name, data := range m.files {
+		if path.Dir(name) == path.Clean("/" + dir)[1:] || (dir == "" && !strings.Contains(name, "/")) {
+			entries = append(entries, container.FileEntry{Name: path.Base(name), Type: "file", Size: int64(len(data))})
+		}
+	}
+	return entries, nil
+}
+
+func (m *fileManager) ReadFile(_ context.Context, _ string, name string, maxBytes int64) ([]byte, error) {
+	data, ok := m.files[name]
+	if !ok {
+		return nil, container.ErrFileNotFound
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, container.ErrFileTooLarge
+	}
+	return data, nil
+}
+
+func (m *fileManager) WriteFile(_ context.Context, _ string, name string, content io.Reader) error {
+	data, err := io.ReadAll(content)
+	m.files[name] = data
+	return err
+}
+
+func TestFileBrowser(t *testing.T) {
+	repo := newFakeRepo()
+	mgr := &fileManager{files: map[string][]byte{"page.html": []byte("<script>alert(1)</script>")}}
+	r := chi.NewRouter()
+	NewFileHandler(NewHandler(repo, mgr, terminal.NewSessionManager(), ""), &config.Config{FileMaxBytes: 64}).RegisterRoutes(r)
+
+	if rr := serveCheckpoint(repo, r, http.MethodGet, "/api/files", ""); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 without a container, got %d", rr.Code)
+	}
+	if err := repo.UpsertUser(t.Context(), &domain.User{UserID: provisionTestUser, ContainerID: "container-1"}); err != nil {
+		t.Fatalf("upsert user: %v", err)
+	}
+
+	if rr := serveCheckpoint(repo, r, http.MethodPut, "/api/files/content?path=src/main.go", "package main\n"); rr.Code != http.StatusOK {
+		t.Fatalf("write: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := serveCheckpoint(repo, r, http.MethodPut, "/api/files/content?path=big.txt", strings.Repeat("x", 65)); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for an oversized write, got %d", rr.Code)
+	}
+	if _, ok := mgr.files["big.txt"]; ok {
+		t.Fatal("oversized write reached the volume")
+	}
+	rr := serveCheckpoint(repo, r, http.MethodGet, "/api/files?path=src", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"name":"main.go"`) {
+		t.Fatalf("list: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Files are never served as a type the browser renders.
+	rr = serveCheckpoint(repo, r, http.MethodGet, "/api/files/content?path=page.html&download=1", "")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "text/plain; charset=utf-8" ||
+		rr.Header().Get("Content-Disposition") != `attachment; filename="page.html"` {
+		t.Fatalf("read: %d %v", rr.Code, rr.Header())
+	}
+	if rr := serveCheckpoint(repo, r, http.MethodGet, "/api/files/content?path=missing", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a missing file, got %d", rr.Code)
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "../notes.txt")
+	_, _ = part.Write([]byte("todo"))
+	_ = form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/files/upload?path=docs", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.AddCookie(&http.Cookie{Name: identity.AnonCookieName, Value: provisionTestUser})
+	rr = httptest.NewRecorder()
+	identity.Middleware(repo, true)(r).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || string(mgr.files["docs/notes.txt"]) != "todo" {
+		t.Fatalf("upload: %d %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+)
+
+// Focus window lengths: the default when none is given, and the cap.
+const (
+	defaultFocusDuration = time.Hour
+	maxFocusDuration     = 8 * time.Hour
+)
+
+// QuietHoursController holds back proactive messages during quiet hours and
+// learner-set focus windows. terminal.Monitor implements it.
+type QuietHoursController interface {
+	QuietStatus(userID string, now time.Time) terminal.QuietStatus
+	SetFocus(userID string, until time.Time)
+}
+
+// focusRequest is the body of PUT /api/focus. The field is optional.
+type focusRequest struct {
+	DurationSeconds int64 `json:"duration_seconds"`
+}
+
+// SetQuietHours reports quiet hours in /api/config and enables the focus
+// routes.
+func (h *ContainerHandler) SetQuietHours(quiet QuietHoursController) {
+	h.quiet = quiet
+}
+
+// StartFocus handles PUT /api/focus. It holds back the caller's proactive
+// messages for duration_seconds (default one hour, at most eight); chat
+// still works.
+func (h *ContainerHandler) StartFocus(w http.ResponseWriter, r *http.Request) {
+	if h.quiet == nil {
+		Error(w, http.StatusNotImplemented, "focus_unsupported")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 4*1024)
+	var req focusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.DurationSeconds < 0 {
+		Error(w, http.StatusBadRequest, "duration_seconds must be positive")
+		return
+	}
+	duration := defaultFocusDuration
+	if req.DurationSeconds > 0 {
+		duration = min(time.Duration(req.DurationSeconds)*time.Second, maxFocusDuration)
+	}
+
+	userID := identity.UserIDFromContext(r.Context())
+	now := time.Now()
+	h.quiet.SetFocus(userID, now.Add(duration))
+	JSON(w, http.StatusOK, map[string]interface{}{"quiet_hours": h.quiet.QuietStatus(userID, now)})
+}
+
+// EndFocus handles DELETE /api/focus, ending the caller's focus window.
+func (h *ContainerHandler) EndFocus(w http.ResponseWriter, r *http.Request) {
+	if h.quiet == nil {
+		Error(w, http.StatusNotImplemented, "focus_unsupported")
+		return
+	}
+	userID := identity.UserIDFromContext(r.Context())
+	h.quiet.SetFocus(userID, time.Time{})
+	JSON(w, http.StatusOK, map[string]interface{}{"quiet_hours": h.quiet.QuietStatus(userID, time.Now())})
+}
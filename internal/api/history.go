@@ -0,0 +1,284 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/store"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+var (
+	errInvalidExitFilter = errors.New("exit must be zero, nonzero, or an integer exit code")
+	errInvalidSince      = errors.New("since must be RFC3339 or unix seconds")
+	errInvalidPagination = errors.New("limit and offset must be non-negative integers")
+)
+
+// historySource provides executed command history for a user session.
+type historySource interface {
+	GetCommandHistory(userID, sessionID string, limit int) []terminal.CommandEntry
+}
+
+// HistoryHandler serves the searchable terminal history API.
+type HistoryHandler struct {
+	source historySource
+	repo   store.Repository
+}
+
+// NewHistoryHandler creates a history handler. A nil source yields empty history.
+func NewHistoryHandler(source historySource) *HistoryHandler {
+	return &HistoryHandler{source: source}
+}
+
+// NewPersistentHistoryHandler creates a history handler that reads commands
+// persisted in repo (see terminal.CommandRecorder), so history survives
+// restarts.
+func NewPersistentHistoryHandler(repo store.Repository) *HistoryHandler {
+	return &HistoryHandler{repo: repo}
+}
+
+// RegisterRoutes registers terminal history routes.
+func (h *HistoryHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/api/terminal/history", h.GetHistory)
+}
+
+// historyFilter holds parsed history query parameters.
+type historyFilter struct {
+	exitMode string // "", "zero", "nonzero", "unknown", or "code"
+	exitCode int
+	since    time.Time
+	query    string
+	limit    int
+	offset   int
+}
+
+// historyEntry is the JSON representation of a command entry.
+type historyEntry struct {
+	Sequence   int       `json:"seq"`
+	Command    string    `json:"command"`
+	PWD        string    `json:"pwd,omitempty"`
+	ExitCode   *int      `json:"exit_code"` // nil when the shell did not report one
+	DurationMs int64     `json:"duration_ms"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// historyFacets summarizes exit outcomes across entries matching the non-exit filters.
+type historyFacets struct {
+	Zero    int `json:"zero"`
+	Nonzero int `json:"nonzero"`
+	Unknown int `json:"unknown"`
+}
+
+// GetHistory handles GET /api/terminal/history.
+//
+// Supported query parameters:
+//   - exit: "zero", "nonzero", "unknown", or a specific exit code
+//   - since: RFC3339 timestamp or unix seconds
+//   - q: case-insensitive substring match on the command
+//   - limit, offset: pagination (newest entries first)
+func (h *HistoryHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	sessionID := identity.SessionIDFromContext(r.Context())
+	if userID == "" {
+		Error(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	filter, err := parseHistoryFilter(r)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entries, err := h.commandHistory(r.Context(), userID, sessionID)
+	if err != nil {
+		slog.Error("Failed to load command history", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to load history")
+		return
+	}
+
+	matched, facets := filterHistory(entries, filter)
+
+	total := len(matched)
+	start := filter.offset
+	if start > total {
+		start = total
+	}
+	end := start + filter.limit
+	if end > total {
+		end = total
+	}
+
+	page := make([]historyEntry, 0, end-start)
+	for _, e := range matched[start:end] {
+		entry := historyEntry{
+			Sequence:   e.Sequence,
+			Command:    e.Command,
+			PWD:        e.PWD,
+			DurationMs: e.Duration.Milliseconds(),
+			Timestamp:  e.Timestamp,
+		}
+		if e.ExitCode != terminal.ExitCodeUnknown {
+			code := e.ExitCode
+			entry.ExitCode = &code
+		}
+		page = append(page, entry)
+	}
+
+	resp := map[string]interface{}{
+		"entries": page,
+		"total":   total,
+		"limit":   filter.limit,
+		"offset":  filter.offset,
+		"facets":  map[string]interface{}{"exit": facets},
+	}
+	if end < total {
+		resp["next_offset"] = end
+	}
+	JSON(w, http.StatusOK, resp)
+}
+
+// commandHistory returns the session's commands, oldest first.
+func (h *HistoryHandler) commandHistory(ctx context.Context, userID, sessionID string) ([]terminal.CommandEntry, error) {
+	if h.repo == nil {
+		if h.source == nil {
+			return nil, nil
+		}
+		return h.source.GetCommandHistory(userID, sessionID, 0), nil
+	}
+
+	records, err := h.repo.ListCommands(ctx, userID, sessionID, 0)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]terminal.CommandEntry, len(records))
+	for i, c := range records {
+		entries[len(records)-1-i] = terminal.CommandEntry{
+			Sequence:  c.Sequence,
+			Command:   c.Command,
+			PWD:       c.PWD,
+			ExitCode:  c.ExitCode,
+			Duration:  c.Duration,
+			Timestamp: c.EndedAt,
+			StartTime: c.StartedAt,
+			EndTime:   c.EndedAt,
+		}
+	}
+	return entries, nil
+}
+
+func parseHistoryFilter(r *http.Request) (historyFilter, error) {
+	q := r.URL.Query()
+	filter := historyFilter{
+		query: strings.ToLower(strings.TrimSpace(q.Get("q"))),
+		limit: defaultHistoryLimit,
+	}
+
+	switch exit := strings.TrimSpace(q.Get("exit")); exit {
+	case "", "all":
+	case "zero", "nonzero", "unknown":
+		filter.exitMode = exit
+	default:
+		code, err := strconv.Atoi(exit)
+		if err != nil {
+			return filter, errInvalidExitFilter
+		}
+		filter.exitMode = "code"
+		filter.exitCode = code
+	}
+
+	if since := strings.TrimSpace(q.Get("since")); since != "" {
+		if ts, err := time.Parse(time.RFC3339, since); err == nil {
+			filter.since = ts
+		} else if secs, err := strconv.ParseInt(since, 10, 64); err == nil {
+			filter.since = time.Unix(secs, 0)
+		} else {
+			return filter, errInvalidSince
+		}
+	}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return filter, errInvalidPagination
+		}
+		if n > 0 {
+			filter.limit = n
+		}
+	}
+	if filter.limit > maxHistoryLimit {
+		filter.limit = maxHistoryLimit
+	}
+
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return filter, errInvalidPagination
+		}
+		filter.offset = n
+	}
+
+	return filter, nil
+}
+
+// filterHistory returns matching entries newest-first along with exit facets.
+// Facets are computed before the exit filter is applied so the UI can show
+// counts for both buckets regardless of the current selection.
+func filterHistory(entries []terminal.CommandEntry, filter historyFilter) ([]terminal.CommandEntry, historyFacets) {
+	var facets historyFacets
+	matched := make([]terminal.CommandEntry, 0, len(entries))
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if !filter.since.IsZero() && e.Timestamp.Before(filter.since) {
+			continue
+		}
+		if filter.query != "" && !strings.Contains(strings.ToLower(e.Command), filter.query) {
+			continue
+		}
+
+		unknown := e.ExitCode == terminal.ExitCodeUnknown
+		switch {
+		case unknown:
+			facets.Unknown++
+		case e.ExitCode == 0:
+			facets.Zero++
+		default:
+			facets.Nonzero++
+		}
+
+		switch filter.exitMode {
+		case "zero":
+			if e.ExitCode != 0 {
+				continue
+			}
+		case "nonzero":
+			if !e.Failed() {
+				continue
+			}
+		case "unknown":
+			if !unknown {
+				continue
+			}
+		case "code":
+			if e.ExitCode != filter.exitCode {
+				continue
+			}
+		}
+		matched = append(matched, e)
+	}
+
+	return matched, facets
+}
@@ -0,0 +1,156 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+)
+
+type fakeHistorySource struct {
+	entries []terminal.CommandEntry
+}
+
+func (f *fakeHistorySource) GetCommandHistory(_, _ string, _ int) []terminal.CommandEntry {
+	return f.entries
+}
+
+type historyResponse struct {
+	Entries    []historyEntry `json:"entries"`
+	Total      int            `json:"total"`
+	NextOffset *int           `json:"next_offset"`
+	Facets     struct {
+		Exit historyFacets `json:"exit"`
+	} `json:"facets"`
+}
+
+func doHistoryRequest(t *testing.T, source historySource, query string) (int, historyResponse) {
+	t.Helper()
+	handler := NewHistoryHandler(source)
+	req := httptest.NewRequest(http.MethodGet, "/api/terminal/history"+query, nil)
+	rr := httptest.NewRecorder()
+	identity.Middleware(newFakeRepo(), true)(http.HandlerFunc(handler.GetHistory)).ServeHTTP(rr, req)
+
+	var resp historyResponse
+	if rr.Code == http.StatusOK {
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+	}
+	return rr.Code, resp
+}
+
+func TestHistoryFiltersAndFacets(t *testing.T) {
+	base := time.Unix(1_700_000_000, 0)
+	source := &fakeHistorySource{entries: []terminal.CommandEntry{
+		{Sequence: 1, Command: "ls -la", ExitCode: 0, Timestamp: base},
+		{Sequence: 2, Command: "cat missing.txt", ExitCode: 1, Timestamp: base.Add(time.Minute)},
+		{Sequence: 3, Command: "grep foo log.txt", ExitCode: 2, Timestamp: base.Add(2 * time.Minute)},
+		{Sequence: 4, Command: "cat notes.txt", ExitCode: 0, Timestamp: base.Add(3 * time.Minute)},
+	}}
+
+	code, resp := doHistoryRequest(t, source, "?exit=nonzero")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if resp.Total != 2 || resp.Entries[0].Sequence != 3 || resp.Entries[1].Sequence != 2 {
+		t.Fatalf("expected nonzero entries newest-first [3 2], got %+v", resp.Entries)
+	}
+	if resp.Facets.Exit.Zero != 2 || resp.Facets.Exit.Nonzero != 2 {
+		t.Fatalf("unexpected facets: %+v", resp.Facets.Exit)
+	}
+
+	_, resp = doHistoryRequest(t, source, "?q=CAT&since=1700000030")
+	if resp.Total != 2 || resp.Entries[0].Sequence != 4 {
+		t.Fatalf("expected cat entries after since, got %+v", resp.Entries)
+	}
+
+	_, resp = doHistoryRequest(t, source, "?limit=1&offset=1")
+	if len(resp.Entries) != 1 || resp.Entries[0].Sequence != 3 {
+		t.Fatalf("expected second-newest entry, got %+v", resp.Entries)
+	}
+	if resp.NextOffset == nil || *resp.NextOffset != 2 {
+		t.Fatalf("expected next_offset 2, got %v", resp.NextOffset)
+	}
+}
+
+func TestHistoryUnknownExitCodes(t *testing.T) {
+	source := &fakeHistorySource{entries: []terminal.CommandEntry{
+		{Sequence: 1, Command: "ls", ExitCode: 0},
+		{Sequence: 2, Command: "grep denied auth.log", ExitCode: terminal.ExitCodeUnknown},
+		{Sequence: 3, Command: "cat missing.txt", ExitCode: 1},
+	}}
+
+	_, resp := doHistoryRequest(t, source, "?exit=nonzero")
+	if resp.Total != 1 || resp.Entries[0].Sequence != 3 {
+		t.Fatalf("expected only the reported failure, got %+v", resp.Entries)
+	}
+	if resp.Facets.Exit.Zero != 1 || resp.Facets.Exit.Nonzero != 1 || resp.Facets.Exit.Unknown != 1 {
+		t.Fatalf("unexpected facets: %+v", resp.Facets.Exit)
+	}
+
+	_, resp = doHistoryRequest(t, source, "?exit=unknown")
+	if resp.Total != 1 || resp.Entries[0].Sequence != 2 || resp.Entries[0].ExitCode != nil {
+		t.Fatalf("expected the unknown entry with a null exit code, got %+v", resp.Entries)
+	}
+}
+
+func TestHistoryRejectsInvalidFilters(t *testing.T) {
+	for _, query := range []string{"?exit=bogus", "?since=yesterday", "?limit=-1"} {
+		if code, _ := doHistoryRequest(t, &fakeHistorySource{}, query); code != http.StatusBadRequest {
+			t.Errorf("query %q: expected 400, got %d", query, code)
+		}
+	}
+}
+
+func TestHistoryWithoutSourceIsEmpty(t *testing.T) {
+	code, resp := doHistoryRequest(t, nil, "")
+	if code != http.StatusOK || resp.Total != 0 || len(resp.Entries) != 0 {
+		t.Fatalf("expected empty history, got code=%d resp=%+v", code, resp)
+	}
+}
+
+func TestPersistentHistoryReadsRepository(t *testing.T) {
+	repo := newFakeRepo()
+	ctx := context.Background()
+	base := time.Unix(1_700_000_000, 0)
+	for i, c := range []domain.CommandRecord{
+		{SessionID: "tab-1", Command: "ls", ExitCode: 0},
+		{SessionID: "tab-2", Command: "pwd", ExitCode: 0},
+		{SessionID: "tab-1", Command: "cat missing.txt", ExitCode: 1},
+	} {
+		c.UserID = provisionTestUser
+		c.Sequence = i + 1
+		c.EndedAt = base.Add(time.Duration(i) * time.Minute)
+		if err := repo.InsertCommand(ctx, &c); err != nil {
+			t.Fatalf("insert command: %v", err)
+		}
+	}
+
+	handler := NewPersistentHistoryHandler(repo)
+	req := httptest.NewRequest(http.MethodGet, "/api/terminal/history?session_id=tab-1", nil)
+	req.AddCookie(&http.Cookie{Name: identity.AnonCookieName, Value: provisionTestUser})
+	rr := httptest.NewRecorder()
+	identity.Middleware(repo, true)(http.HandlerFunc(handler.GetHistory)).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var resp historyResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Total != 2 || resp.Entries[0].Command != "cat missing.txt" || resp.Entries[1].Command != "ls" {
+		t.Fatalf("expected tab-1 commands newest-first, got %+v", resp.Entries)
+	}
+	if !resp.Entries[0].Timestamp.Equal(base.Add(2 * time.Minute)) {
+		t.Fatalf("expected end time as timestamp, got %v", resp.Entries[0].Timestamp)
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/agent"
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/go-chi/chi/v5"
+)
+
+// chatLimitSource reports a user's chat rate-limit state.
+type chatLimitSource interface {
+	ChatRateLimit(userID string) agent.RateLimitStatus
+}
+
+// chatLimits is the chat section of the limits response.
+type chatLimits struct {
+	Enabled bool `json:"enabled"`
+	// Exempt is true while the user is kept warm and not rate limited.
+	Exempt bool `json:"exempt,omitempty"`
+	agent.RateLimitStatus
+	WindowSeconds int64 `json:"window_seconds,omitempty"`
+}
+
+// provisionLimits is the provisioning section of the limits response.
+type provisionLimits struct {
+	// InProgress is true while a provision operation runs; new requests join it.
+	InProgress  bool   `json:"in_progress"`
+	OperationID string `json:"operation_id,omitempty"`
+	// QueuePosition is set while the operation waits for host capacity.
+	QueuePosition int `json:"queue_position,omitempty"`
+}
+
+// containerLimits is the container section of the limits response.
+type containerLimits struct {
+	Active            bool  `json:"active"`
+	TTLSeconds        int64 `json:"ttl_seconds"`
+	SessionTTLSeconds int64 `json:"session_ttl_seconds"`
+	// KeepWarmUntil is set while the container is exempt from TTL cleanup.
+	KeepWarmUntil time.Time `json:"keep_warm_until,omitzero"`
+}
+
+// LimitsHandler reports the caller's rate limits and quotas so the frontend
+// can disable actions before they fail.
+type LimitsHandler struct {
+	*Handler
+	chat chatLimitSource
+	cfg  *config.Config
+}
+
+// NewLimitsHandler creates a limits handler. A nil chat source reports chat
+// as disabled.
+func NewLimitsHandler(base *Handler, chat chatLimitSource, cfg *config.Config) *LimitsHandler {
+	return &LimitsHandler{Handler: base, chat: chat, cfg: cfg}
+}
+
+// RegisterRoutes registers limits routes.
+func (h *LimitsHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/api/limits", h.GetLimits)
+}
+
+// GetLimits handles GET /api/limits.
+func (h *LimitsHandler) GetLimits(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	if userID == "" {
+		Error(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	user, err := h.repo.GetUser(r.Context(), userID)
+	if err != nil || user == nil {
+		slog.Error("Failed to get user for limits", "error", err, "user_id", userID)
+		Error(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+
+	keptWarm := user.IsKeptWarm(time.Now())
+	chat := chatLimits{}
+	if h.chat != nil {
+		status := h.chat.ChatRateLimit(userID)
+		chat = chatLimits{
+			Enabled:         true,
+			Exempt:          keptWarm,
+			RateLimitStatus: status,
+			WindowSeconds:   int64(status.Window.Seconds()),
+		}
+	}
+
+	provision := provisionLimits{}
+	if op, ok := provisionOps.get(userID); ok && op.Status == provisionStatusProvisioning {
+		provision = provisionLimits{InProgress: true, OperationID: op.ID, QueuePosition: op.QueuePosition}
+	}
+
+	sessionTTL := 60 * time.Minute
+	if h.cfg != nil {
+		sessionTTL = h.cfg.SessionTTL
+	}
+
+	containerStatus := containerLimits{
+		Active:            user.HasActiveContainer(),
+		TTLSeconds:        int64(user.SessionTTL(sessionTTL).Seconds()),
+		SessionTTLSeconds: int64(sessionTTL.Seconds()),
+	}
+	if keptWarm {
+		containerStatus.KeepWarmUntil = user.KeepWarmUntil
+	}
+
+	JSON(w, http.StatusOK, map[string]interface{}{
+		"chat": chat,
+		// No AI quota is enforced beyond the chat rate limit.
+		"ai_quota":  nil,
+		"provision": provision,
+		"container": containerStatus,
+	})
+}
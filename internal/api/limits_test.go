@@ -0,0 +1,71 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/agent"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+)
+
+type fakeChatLimits struct {
+	status agent.RateLimitStatus
+}
+
+func (f fakeChatLimits) ChatRateLimit(string) agent.RateLimitStatus { return f.status }
+
+type limitsResponse struct {
+	Chat struct {
+		Enabled       bool  `json:"enabled"`
+		Limit         int   `json:"limit"`
+		Remaining     int   `json:"remaining"`
+		WindowSeconds int64 `json:"window_seconds"`
+	} `json:"chat"`
+	AIQuota   *struct{}       `json:"ai_quota"`
+	Provision provisionLimits `json:"provision"`
+	Container containerLimits `json:"container"`
+}
+
+func doLimitsRequest(t *testing.T, chat chatLimitSource) (int, limitsResponse) {
+	t.Helper()
+	repo := newFakeRepo()
+	handler := NewLimitsHandler(NewHandler(repo, &fakeManager{}, terminal.NewSessionManager(), ""), chat, nil)
+	req := httptest.NewRequest(http.MethodGet, "/api/limits", nil)
+	rr := httptest.NewRecorder()
+	identity.Middleware(repo, true)(http.HandlerFunc(handler.GetLimits)).ServeHTTP(rr, req)
+
+	var resp limitsResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return rr.Code, resp
+}
+
+func TestLimitsReportsChatRateLimit(t *testing.T) {
+	chat := fakeChatLimits{status: agent.RateLimitStatus{Limit: 10, Remaining: 3, Window: time.Minute}}
+	code, resp := doLimitsRequest(t, chat)
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if !resp.Chat.Enabled || resp.Chat.Limit != 10 || resp.Chat.Remaining != 3 || resp.Chat.WindowSeconds != 60 {
+		t.Fatalf("unexpected chat limits: %+v", resp.Chat)
+	}
+	if resp.Container.Active || resp.Container.SessionTTLSeconds != 3600 {
+		t.Fatalf("unexpected container limits: %+v", resp.Container)
+	}
+	if resp.Provision.InProgress {
+		t.Fatalf("expected no provision in progress, got %+v", resp.Provision)
+	}
+}
+
+func TestLimitsWithoutAI(t *testing.T) {
+	code, resp := doLimitsRequest(t, nil)
+	if code != http.StatusOK || resp.Chat.Enabled {
+		t.Fatalf("expected chat disabled, got code=%d chat=%+v", code, resp.Chat)
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultNotificationLimit = 50
+	maxNotificationLimit     = 200
+	// maxMarkReadIDs bounds the IDs accepted by one mark-read request.
+	maxMarkReadIDs = 200
+)
+
+// markReadRequest is the body of POST /api/notifications/read. An empty ids
+// list marks every notification read.
+type markReadRequest struct {
+	IDs []int64 `json:"ids"`
+}
+
+// NotificationHandler serves the notification center API.
+type NotificationHandler struct {
+	*Handler
+}
+
+// NewNotificationHandler creates a notification handler.
+func NewNotificationHandler(base *Handler) *NotificationHandler {
+	return &NotificationHandler{Handler: base}
+}
+
+// RegisterRoutes registers notification routes.
+func (h *NotificationHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/api/notifications", h.ListNotifications)
+	r.Post("/api/notifications/read", h.MarkRead)
+}
+
+// ListNotifications handles GET /api/notifications.
+//
+// Supported query parameters:
+//   - unread: "true" to return only unread notifications
+//   - limit: maximum number of notifications (newest first)
+func (h *NotificationHandler) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	if userID == "" {
+		Error(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	query := r.URL.Query()
+	unreadOnly := query.Get("unread") == "true"
+	limit := defaultNotificationLimit
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			Error(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(parsed, maxNotificationLimit)
+	}
+
+	notifications, err := h.repo.ListNotifications(r.Context(), userID, unreadOnly, limit)
+	if err != nil {
+		slog.Error("Failed to list notifications", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to load notifications")
+		return
+	}
+	unread, err := h.repo.CountUnreadNotifications(r.Context(), userID)
+	if err != nil {
+		slog.Error("Failed to count unread notifications", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to load notifications")
+		return
+	}
+
+	if notifications == nil {
+		notifications = []*domain.Notification{}
+	}
+	JSON(w, http.StatusOK, map[string]interface{}{
+		"notifications": notifications,
+		"unread":        unread,
+	})
+}
+
+// MarkRead handles POST /api/notifications/read.
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	if userID == "" {
+		Error(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 16*1024)
+	var req markReadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if len(req.IDs) > maxMarkReadIDs {
+		Error(w, http.StatusBadRequest, "too many ids")
+		return
+	}
+
+	marked, err := h.repo.MarkNotificationsRead(r.Context(), userID, req.IDs, time.Now())
+	if err != nil {
+		slog.Error("Failed to mark notifications read", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to update notifications")
+		return
+	}
+	unread, err := h.repo.CountUnreadNotifications(r.Context(), userID)
+	if err != nil {
+		slog.Error("Failed to count unread notifications", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to update notifications")
+		return
+	}
+
+	JSON(w, http.StatusOK, map[string]interface{}{
+		"marked": marked,
+		"unread": unread,
+	})
+}
@@ -0,0 +1,93 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+	"github.com/go-chi/chi/v5"
+)
+
+const notificationTestUser = "anon_fedcba9876543210fedcba9876543210"
+
+type notificationsResponse struct {
+	Notifications []domain.Notification `json:"notifications"`
+	Unread        int                   `json:"unread"`
+	Marked        int64                 `json:"marked"`
+}
+
+func doNotificationRequest(t *testing.T, repo *fakeRepo, method, path, body string) (int, notificationsResponse) {
+	t.Helper()
+	handler := NewNotificationHandler(NewHandler(repo, &fakeManager{}, terminal.NewSessionManager(), ""))
+	r := chi.NewRouter()
+	r.Use(identity.Middleware(repo, true))
+	handler.RegisterRoutes(r)
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.AddCookie(&http.Cookie{Name: identity.AnonCookieName, Value: notificationTestUser})
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	var resp notificationsResponse
+	if rr.Code == http.StatusOK {
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+	}
+	return rr.Code, resp
+}
+
+func TestNotificationsListAndMarkRead(t *testing.T) {
+	repo := newFakeRepo()
+	ctx := context.Background()
+	for _, body := range []string{"first hint", "second hint", "third hint"} {
+		if err := repo.CreateNotification(ctx, &domain.Notification{
+			UserID: notificationTestUser, Kind: domain.NotificationProactiveHint, Body: body,
+		}); err != nil {
+			t.Fatalf("create notification: %v", err)
+		}
+	}
+	if err := repo.CreateNotification(ctx, &domain.Notification{UserID: "someone-else", Body: "not mine"}); err != nil {
+		t.Fatalf("create notification: %v", err)
+	}
+
+	code, resp := doNotificationRequest(t, repo, http.MethodGet, "/api/notifications", "")
+	if code != http.StatusOK || resp.Unread != 3 || len(resp.Notifications) != 3 {
+		t.Fatalf("expected 3 unread notifications, got code=%d resp=%+v", code, resp)
+	}
+	if resp.Notifications[0].Body != "third hint" {
+		t.Fatalf("expected newest first, got %q", resp.Notifications[0].Body)
+	}
+
+	code, resp = doNotificationRequest(t, repo, http.MethodPost, "/api/notifications/read", `{"ids":[1]}`)
+	if code != http.StatusOK || resp.Marked != 1 || resp.Unread != 2 {
+		t.Fatalf("expected one marked and two unread, got code=%d resp=%+v", code, resp)
+	}
+
+	_, resp = doNotificationRequest(t, repo, http.MethodGet, "/api/notifications?unread=true", "")
+	if len(resp.Notifications) != 2 {
+		t.Fatalf("expected 2 unread notifications, got %+v", resp.Notifications)
+	}
+
+	code, resp = doNotificationRequest(t, repo, http.MethodPost, "/api/notifications/read", `{}`)
+	if code != http.StatusOK || resp.Marked != 2 || resp.Unread != 0 {
+		t.Fatalf("expected remaining notifications marked, got code=%d resp=%+v", code, resp)
+	}
+}
+
+func TestNotificationsRejectInvalidInput(t *testing.T) {
+	repo := newFakeRepo()
+	if code, _ := doNotificationRequest(t, repo, http.MethodGet, "/api/notifications?limit=0", ""); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid limit, got %d", code)
+	}
+	if code, _ := doNotificationRequest(t, repo, http.MethodPost, "/api/notifications/read", `not json`); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid body, got %d", code)
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/go-chi/chi/v5"
+)
+
+// PairingHandler lets learners see and leave the pair an instructor put them
+// in. Pairs are created through the admin API and driven over the pair
+// terminal connection.
+type PairingHandler struct {
+	*Handler
+}
+
+// NewPairingHandler creates a pairing handler.
+func NewPairingHandler(base *Handler) *PairingHandler {
+	return &PairingHandler{Handler: base}
+}
+
+// RegisterRoutes registers pairing routes.
+func (h *PairingHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/api/pairing", h.GetPairing)
+	r.Delete("/api/pairing", h.LeavePairing)
+}
+
+// GetPairing handles GET /api/pairing, returning the user's pair and role.
+func (h *PairingHandler) GetPairing(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	status, ok := h.sm.Pairing(userID)
+	if !ok {
+		JSON(w, http.StatusOK, map[string]interface{}{"paired": false})
+		return
+	}
+	role := "navigator"
+	if status.Driver == userID {
+		role = "driver"
+	}
+	JSON(w, http.StatusOK, map[string]interface{}{
+		"paired": true,
+		"role":   role,
+		"pair":   status,
+	})
+}
+
+// LeavePairing handles DELETE /api/pairing. Either member may end the pair;
+// both pair terminals are closed.
+func (h *PairingHandler) LeavePairing(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	if _, err := h.sm.EndPairing(userID, "left"); err != nil {
+		Error(w, http.StatusNotFound, "not paired")
+		return
+	}
+	JSON(w, http.StatusOK, map[string]string{"status": "ended"})
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/go-chi/chi/v5"
+)
+
+// portForwardHeaderTimeout bounds how long a forwarded service may take to
+// start its response.
+const portForwardHeaderTimeout = time.Minute
+
+// portForwardCSP sandboxes forwarded pages into an opaque origin. Without it
+// a page the learner, or anyone who got code into their container, serves
+// would run as the app and could read its storage and call its API.
+const portForwardCSP = "sandbox allow-scripts allow-forms allow-popups allow-modals allow-downloads"
+
+// PortForwardHandler lets learners open web servers they start in their
+// container, such as python3 -m http.server or nginx, in the browser.
+// /proxy/{port}/path is forwarded to http://127.0.0.1:{port}/path in the
+// learner's own container. Pages are served from the app's origin, so only
+// links relative to the page work; X-Forwarded-Prefix tells frameworks that
+// honour it where they are mounted. They are sandboxed into an opaque origin
+// by portForwardCSP, so they cannot act as the app.
+type PortForwardHandler struct {
+	*Handler
+}
+
+// NewPortForwardHandler creates a port forwarding handler.
+func NewPortForwardHandler(base *Handler) *PortForwardHandler {
+	return &PortForwardHandler{Handler: base}
+}
+
+// RegisterRoutes registers the forwarding routes for every method. They must
+// be behind the identity middleware.
+func (h *PortForwardHandler) RegisterRoutes(r chi.Router) {
+	r.HandleFunc("/proxy/{port}", h.RedirectPort)
+	r.HandleFunc("/proxy/{port}/*", h.ForwardPort)
+}
+
+// RedirectPort handles /proxy/{port}, adding the trailing slash the page's
+// relative links resolve against.
+func (h *PortForwardHandler) RedirectPort(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.EscapedPath() + "/"
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// ForwardPort handles /proxy/{port}/*. Requests are relayed without the
+// learner's identity cookie, and the service cannot replace it; WebSocket
+// upgrades, used by development servers to reload pages, pass through.
+// Requests sent by another origin, the app's included, are refused: only
+// navigations and the sandboxed pages themselves, whose origin is "null",
+// reach the service with the learner's cookie.
+func (h *PortForwardHandler) ForwardPort(w http.ResponseWriter, r *http.Request) {
+	if origin := r.Header.Get("Origin"); origin != "" && origin != "null" {
+		slog.Warn("Port forward origin rejected", "origin", origin, "user_id", identity.UserIDFromContext(r.Context()))
+		Error(w, http.StatusForbidden, "cross_origin_request")
+		return
+	}
+	rawPort := chi.URLParam(r, "port")
+	port, err := strconv.Atoi(rawPort)
+	if err != nil || port < 1 || port > 65535 {
+		Error(w, http.StatusBadRequest, "invalid port")
+		return
+	}
+	forwarder, ok := h.mgr.(container.PortForwarder)
+	if !ok {
+		Error(w, http.StatusNotImplemented, "port_forward_unsupported")
+		return
+	}
+	userID := identity.UserIDFromContext(r.Context())
+	user, err := h.repo.GetUser(r.Context(), userID)
+	if err != nil || user == nil {
+		Error(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+	if user.ContainerID == "" {
+		Error(w, http.StatusConflict, "no active container")
+		return
+	}
+
+	prefix := "/proxy/" + rawPort
+	target := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			rest := strings.TrimPrefix(pr.In.URL.EscapedPath(), prefix)
+			pr.Out.URL.Scheme = "http"
+			pr.Out.URL.Host = target
+			pr.Out.URL.RawPath = rest
+			pr.Out.URL.Path, _ = url.PathUnescape(rest) // rest is a suffix of a valid escaped path
+			pr.Out.Host = ""
+			pr.SetXForwarded()
+			pr.Out.Header.Set("X-Forwarded-Prefix", prefix)
+			dropCookie(pr.Out, identity.AnonCookieName)
+		},
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return forwarder.DialPort(ctx, user.ContainerID, port)
+			},
+			// Each connection is an exec session; none are kept idle.
+			DisableKeepAlives:     true,
+			ResponseHeaderTimeout: portForwardHeaderTimeout,
+		},
+		// Development servers stream; pass their output on as it comes.
+		FlushInterval: -1,
+		ModifyResponse: func(resp *http.Response) error {
+			dropSetCookie(resp.Header, identity.AnonCookieName)
+			// Added rather than set: a policy of the service's own still applies.
+			resp.Header.Add("Content-Security-Policy", portForwardCSP)
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error) {
+			switch {
+			case errors.Is(err, container.ErrPortClosed):
+				Error(w, http.StatusBadGateway, fmt.Sprintf("nothing listening on port %d", port))
+			case errors.Is(err, context.Canceled):
+				// The browser went away.
+			default:
+				slog.Warn("Port forward failed", "error", err, "user_id", userID, "port", port)
+				Error(w, http.StatusBadGateway, "port forward failed")
+			}
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// dropCookie removes cookie name from a request's Cookie headers.
+func dropCookie(r *http.Request, name string) {
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if cookie.Name != name {
+			r.AddCookie(cookie)
+		}
+	}
+}
+
+// dropSetCookie removes the Set-Cookie headers that set cookie name.
+func dropSetCookie(header http.Header, name string) {
+	values := header.Values("Set-Cookie")
+	header.Del("Set-Cookie")
+	for _, value := range values {
+		if cookie, err := http.ParseSetCookie(value); err == nil && cookie.Name == name {
+			continue
+		}
+		header.Add("Set-Cookie", value)
+	}
+}
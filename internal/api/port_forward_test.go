@@ -0,0 +1,112 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+	"github.com/go-chi/chi/v5"
+)
+
+// portManager forwards port 8000 to a local server; other ports are closed.
+type portManager struct {
+	fakeManager
+	addr string
+}
+
+func (m *portManager) DialPort(ctx context.Context, _ string, port int) (net.Conn, error) {
+	if port != 8000 {
+		return nil, fmt.Errorf("%w %d", container.ErrPortClosed, port)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", m.addr)
+}
+
+func TestPortForward(t *testing.T) {
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: identity.AnonCookieName, Value: "anon_hijacked"})
+		http.SetCookie(w, &http.Cookie{Name: "flask", Value: "1"})
+		_, _ = fmt.Fprintf(w, "path=%s query=%s prefix=%s cookies=%s", r.URL.EscapedPath(), r.URL.RawQuery,
+			r.Header.Get("X-Forwarded-Prefix"), r.Header.Get("Cookie"))
+	}))
+	defer service.Close()
+
+	repo := newFakeRepo()
+	r := chi.NewRouter()
+	NewPortForwardHandler(NewHandler(repo, &portManager{addr: service.Listener.Addr().String()}, terminal.NewSessionManager(), "")).RegisterRoutes(r)
+	if err := repo.UpsertUser(t.Context(), &domain.User{UserID: provisionTestUser, ContainerID: "container-1"}); err != nil {
+		t.Fatalf("upsert user: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/proxy/8000/static/a%20b.css?v=2", nil)
+	req.AddCookie(&http.Cookie{Name: identity.AnonCookieName, Value: provisionTestUser})
+	req.AddCookie(&http.Cookie{Name: "flask", Value: "1"})
+	rr := httptest.NewRecorder()
+	identity.Middleware(repo, true)(r).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if body := rr.Body.String(); body != "path=/static/a%20b.css query=v=2 prefix=/proxy/8000 cookies=flask=1" {
+		t.Fatalf("unexpected forwarded request %q", body)
+	}
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Value == "anon_hijacked" {
+			t.Fatal("the service replaced the identity cookie")
+		}
+	}
+	if !strings.Contains(strings.Join(rr.Header().Values("Set-Cookie"), ";"), "flask=1") {
+		t.Fatalf("service cookies should pass through, got %v", rr.Header().Values("Set-Cookie"))
+	}
+	if csp := rr.Header().Get("Content-Security-Policy"); !strings.HasPrefix(csp, "sandbox ") || strings.Contains(csp, "allow-same-origin") {
+		t.Fatalf("expected the page to be sandboxed, got CSP %q", csp)
+	}
+
+	// The sandboxed page may post to its service; the app and other sites may not.
+	for origin, want := range map[string]int{
+		"null":                  http.StatusOK,
+		"http://localhost:3000": http.StatusForbidden,
+		"https://evil.example":  http.StatusForbidden,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/proxy/8000/form", strings.NewReader("a=1"))
+		req.AddCookie(&http.Cookie{Name: identity.AnonCookieName, Value: provisionTestUser})
+		req.Header.Set("Origin", origin)
+		rr := httptest.NewRecorder()
+		identity.Middleware(repo, true)(r).ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Fatalf("origin %s: expected %d, got %d", origin, want, rr.Code)
+		}
+	}
+
+	if rr := serveCheckpoint(repo, r, http.MethodGet, "/proxy/8000?x=1", ""); rr.Code != http.StatusFound || rr.Header().Get("Location") != "/proxy/8000/?x=1" {
+		t.Fatalf("expected a redirect to the slash, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if rr := serveCheckpoint(repo, r, http.MethodGet, "/proxy/9000/", ""); rr.Code != http.StatusBadGateway || !strings.Contains(rr.Body.String(), "nothing listening on port 9000") {
+		t.Fatalf("expected 502 for a closed port, got %d: %s", rr.Code, rr.Body.String())
+	}
+	for _, path := range []string{"/proxy/0/", "/proxy/65536/", "/proxy/web/"} {
+		if rr := serveCheckpoint(repo, r, http.MethodGet, path, ""); rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d", path, rr.Code)
+		}
+	}
+}
+
+func TestPortForwardUnsupported(t *testing.T) {
+	repo := newFakeRepo()
+	r := chi.NewRouter()
+	NewPortForwardHandler(NewHandler(repo, &fakeManager{}, terminal.NewSessionManager(), "")).RegisterRoutes(r)
+	if err := repo.UpsertUser(t.Context(), &domain.User{UserID: provisionTestUser, ContainerID: "container-1"}); err != nil {
+		t.Fatalf("upsert user: %v", err)
+	}
+	if rr := serveCheckpoint(repo, r, http.MethodGet, "/proxy/8000/", ""); rr.Code != http.StatusNotImplemented {
+		t.Fatalf("expected 501, got %d", rr.Code)
+	}
+}
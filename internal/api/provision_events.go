@@ -0,0 +1,98 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/events"
+	"github.com/ashureev/shsh-labs/internal/identity"
+)
+
+// ProvisionEvents streams the user's provision operation as SSE progress
+// events (see internal/events), one per stage change, and ends after the
+// operation finishes.
+// An operation_id query parameter restricts it to that operation.
+func (h *ContainerHandler) ProvisionEvents(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+
+	op, ok, changed := provisionOps.watch(userID)
+	operationID := r.URL.Query().Get("operation_id")
+	if operationID == "" {
+		operationID = op.ID
+	}
+	if !ok || op.ID != operationID {
+		Error(w, http.StatusNotFound, "no_provision_operation")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		Error(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	retryDelay := 5 * time.Second
+	keepaliveInterval := 10 * time.Second
+	if h.cfg != nil {
+		retryDelay = h.cfg.SSE.RetryDelay
+		keepaliveInterval = h.cfg.SSE.KeepaliveInterval
+	}
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", retryDelay.Milliseconds()); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(keepaliveInterval)
+	defer keepalive.Stop()
+
+	lastSent := ""
+	for {
+		if state := fmt.Sprintf("%s/%s/%d", op.Status, op.Stage, op.QueuePosition); state != lastSent {
+			if err := events.Write(w, 0, op.progressEvent()); err != nil {
+				slog.Warn("failed to write provision event", "error", err, "user_id", userID)
+				return
+			}
+			flusher.Flush()
+			lastSent = state
+		}
+		if op.Status != provisionStatusProvisioning {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			if _, err := io.WriteString(w, "event: ping\ndata: {\"status\":\"alive\"}\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-changed:
+			op, ok, changed = provisionOps.watch(userID)
+			if !ok || op.ID != operationID {
+				return
+			}
+		}
+	}
+}
+
+// progressEvent converts the operation into its typed SSE payload.
+func (op provisionOperation) progressEvent() *events.Progress {
+	return &events.Progress{
+		OperationID:     op.ID,
+		Status:          op.Status,
+		Stage:           op.Stage,
+		QueuePosition:   op.QueuePosition,
+		ContainerID:     op.ContainerID,
+		Runtime:         op.Runtime,
+		RuntimeFallback: op.RuntimeFallback,
+		Error:           op.Error,
+	}
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// idempotencyKeyHeader carries the client-chosen key for a provision request.
+	idempotencyKeyHeader = "Idempotency-Key"
+	// provisionOperationRetention is how long a finished operation is replayed
+	// for retries carrying the same idempotency key.
+	provisionOperationRetention = 10 * time.Minute
+)
+
+// Provision operation states.
+const (
+	provisionStatusProvisioning = "provisioning"
+	provisionStatusReady        = "ready"
+	provisionStatusFailed       = "failed"
+)
+
+var idempotencyKeyPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// provisionOps tracks the current or most recent provision operation per user.
+var provisionOps = newProvisionTracker()
+
+// provisionOperation is a single provisioning attempt. It doubles as the JSON
+// body of provision and provision status responses.
+type provisionOperation struct {
+	ID              string     `json:"operation_id"`
+	Status          string     `json:"status"`
+	Stage           string     `json:"stage,omitempty"`
+	QueuePosition   int        `json:"queue_position,omitempty"`
+	ContainerID     string     `json:"container_id,omitempty"`
+	Runtime         string     `json:"runtime,omitempty"`
+	RuntimeFallback bool       `json:"runtime_fallback"`
+	Image           string     `json:"image,omitempty"`
+	Error           string     `json:"error,omitempty"`
+	StartedAt       time.Time  `json:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+
+	key        string
+	httpStatus int
+}
+
+// responseStatus is the HTTP status used when the operation is returned from
+// POST /api/provision.
+func (op provisionOperation) responseStatus() int {
+	if op.Status == provisionStatusProvisioning {
+		return http.StatusAccepted
+	}
+	return op.httpStatus
+}
+
+// provisionTracker deduplicates provision requests. Only one operation runs
+// per user; duplicates observe it instead of starting another create.
+type provisionTracker struct {
+	mu  sync.Mutex
+	ops map[string]*provisionOperation
+	// changed is closed and replaced whenever any operation changes.
+	changed chan struct{}
+}
+
+func newProvisionTracker() *provisionTracker {
+	return &provisionTracker{
+		ops:     make(map[string]*provisionOperation),
+		changed: make(chan struct{}),
+	}
+}
+
+func (t *provisionTracker) notifyLocked() {
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// begin starts a new operation for the user and returns it with started=true.
+// If an operation is already running, or a finished one has the same
+// idempotency key and is still retained, that operation is returned instead.
+// image is the name of the image the user picked, or "" for the default.
+func (t *provisionTracker) begin(userID, key, image string, now time.Time) (provisionOperation, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pruneLocked(now)
+	if op, ok := t.ops[userID]; ok {
+		if op.Status == provisionStatusProvisioning || (key != "" && op.key == key) {
+			return *op, false
+		}
+	}
+
+	id := key
+	if id == "" {
+		id = newOperationID()
+	}
+	op := &provisionOperation{
+		ID:        id,
+		Status:    provisionStatusProvisioning,
+		StartedAt: now,
+		Image:     image,
+		key:       key,
+	}
+	t.ops[userID] = op
+	t.notifyLocked()
+	return *op, true
+}
+
+// setStage records the stage a running operation has reached.
+func (t *provisionTracker) setStage(userID, id, stage string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if op, ok := t.ops[userID]; ok && op.ID == id && op.Status == provisionStatusProvisioning {
+		op.Stage = stage
+		op.QueuePosition = 0
+		t.notifyLocked()
+	}
+}
+
+// setQueued marks the user's running operation as waiting for capacity at
+// the given 1-based queue position.
+func (t *provisionTracker) setQueued(userID string, position int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	op, ok := t.ops[userID]
+	if !ok || op.Status != provisionStatusProvisioning {
+		return
+	}
+	if op.Stage != provisionStageQueued || op.QueuePosition != position {
+		op.Stage = provisionStageQueued
+		op.QueuePosition = position
+		t.notifyLocked()
+	}
+}
+
+// finish stores the outcome of a finished operation, unless the user has
+// since moved on to another one, and returns it.
+func (t *provisionTracker) finish(userID string, result provisionOperation) provisionOperation {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	finished := time.Now()
+	result.FinishedAt = &finished
+	if op, ok := t.ops[userID]; ok && op.ID == result.ID {
+		*op = result
+		t.notifyLocked()
+	}
+	return result
+}
+
+// get returns the user's current or most recent operation.
+func (t *provisionTracker) get(userID string) (provisionOperation, bool) {
+	op, ok, _ := t.watch(userID)
+	return op, ok
+}
+
+// watch is like get but also returns a channel that is closed on the next
+// change to any operation.
+func (t *provisionTracker) watch(userID string) (provisionOperation, bool, <-chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	op, ok := t.ops[userID]
+	if !ok {
+		return provisionOperation{}, false, t.changed
+	}
+	return *op, true, t.changed
+}
+
+func (t *provisionTracker) pruneLocked(now time.Time) {
+	for userID, op := range t.ops {
+		if op.FinishedAt != nil && now.Sub(*op.FinishedAt) > provisionOperationRetention {
+			delete(t.ops, userID)
+		}
+	}
+}
+
+func newOperationID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "prov_" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return "prov_" + hex.EncodeToString(buf)
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	// provisionStageQueued is the stage of an operation waiting for capacity.
+	provisionStageQueued = "queued"
+	// defaultProvisionQueueInterval is how often the queue head is retried.
+	defaultProvisionQueueInterval = 5 * time.Second
+)
+
+// StartProvisionQueue enables the provisioning wait queue and must be called
+// before the handler serves requests. Once started, a provision that finds
+// every host at capacity is queued (persisted in the repository) instead of
+// failing; queued users are provisioned in order as capacity frees, and their
+// position is reported on the operation. Users still queued from a previous
+// run are resumed.
+func (h *ContainerHandler) StartProvisionQueue(ctx context.Context) {
+	interval := defaultProvisionQueueInterval
+	if h.cfg != nil && h.cfg.Container.QueueRetryInterval > 0 {
+		interval = h.cfg.Container.QueueRetryInterval
+	}
+	h.queueWake = make(chan struct{}, 1)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		slog.Info("Provision queue worker started", "interval", interval)
+
+		for {
+			h.drainProvisionQueue(ctx)
+			select {
+			case <-ticker.C:
+			case <-h.queueWake:
+			case <-ctx.Done():
+				slog.Info("Provision queue worker shutting down", "reason", ctx.Err())
+				return
+			}
+		}
+	}()
+}
+
+// wakeProvisionQueue asks the queue worker to retry now, e.g. after a
+// container was destroyed.
+func (h *ContainerHandler) wakeProvisionQueue() {
+	if h.queueWake == nil {
+		return
+	}
+	select {
+	case h.queueWake <- struct{}{}:
+	default:
+	}
+}
+
+// queueProvision puts the user in the wait queue and marks op as queued.
+// It reports false when the queue is disabled or cannot be written, in which
+// case the caller fails the operation.
+func (h *ContainerHandler) queueProvision(ctx context.Context, userID string, op *provisionOperation) bool {
+	if h.queueWake == nil {
+		return false
+	}
+	if err := h.repo.EnqueueProvision(ctx, userID, time.Now()); err != nil {
+		slog.Error("Failed to queue provision", "error", err, "user_id", userID)
+		return false
+	}
+	op.Stage = provisionStageQueued
+	return true
+}
+
+// drainProvisionQueue provisions queued users in order until one still finds
+// no capacity, then refreshes the positions of everyone left waiting.
+func (h *ContainerHandler) drainProvisionQueue(ctx context.Context) {
+	userIDs, err := h.repo.ListProvisionQueue(ctx)
+	if err != nil {
+		slog.Error("Failed to list provision queue", "error", err)
+		return
+	}
+
+	for i, userID := range userIDs {
+		if ctx.Err() != nil {
+			return
+		}
+		// Joins the user's running operation; after a restart it starts one.
+		op, _ := provisionOps.begin(userID, "", "", time.Now())
+
+		op.QueuePosition = 0
+		h.attemptProvision(ctx, userID, &op)
+		if ctx.Err() != nil {
+			// Shutting down: keep the user queued for the next run.
+			return
+		}
+		if op.Stage == provisionStageQueued && op.Status == provisionStatusProvisioning {
+			setQueuePositions(userIDs[i:])
+			return
+		}
+
+		if err := h.repo.DequeueProvision(ctx, userID); err != nil {
+			slog.Error("Failed to dequeue provision", "error", err, "user_id", userID)
+		}
+		op = provisionOps.finish(userID, op)
+		slog.Info("Queued provision operation finished",
+			"user_id", userID, "operation_id", op.ID, "status", op.Status, "waited", op.FinishedAt.Sub(op.StartedAt))
+	}
+}
+
+// refreshProvisionQueue recomputes queue positions without attempting to
+// provision anyone.
+func (h *ContainerHandler) refreshProvisionQueue(ctx context.Context) {
+	userIDs, err := h.repo.ListProvisionQueue(ctx)
+	if err != nil {
+		slog.Error("Failed to list provision queue", "error", err)
+		return
+	}
+	setQueuePositions(userIDs)
+}
+
+func setQueuePositions(userIDs []string) {
+	for i, userID := range userIDs {
+		provisionOps.setQueued(userID, i+1)
+	}
+}
+
+// cancelQueuedProvision removes the user from the wait queue and fails a
+// queued operation, e.g. when they destroy their sandbox while waiting.
+func (h *ContainerHandler) cancelQueuedProvision(ctx context.Context, userID string) {
+	if h.queueWake == nil {
+		return
+	}
+	if err := h.repo.DequeueProvision(ctx, userID); err != nil {
+		slog.Error("Failed to dequeue provision", "error", err, "user_id", userID)
+		return
+	}
+	op, ok := provisionOps.get(userID)
+	if !ok || op.Status != provisionStatusProvisioning || op.Stage != provisionStageQueued {
+		return
+	}
+	op.Status = provisionStatusFailed
+	op.Error = "cancelled"
+	op.QueuePosition = 0
+	op.httpStatus = http.StatusConflict
+	provisionOps.finish(userID, op)
+	h.refreshProvisionQueue(ctx)
+}
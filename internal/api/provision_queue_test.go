@@ -0,0 +1,95 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+)
+
+// capacityManager rejects creates with ErrNoHostCapacity while full is set.
+type capacityManager struct {
+	fakeManager
+	full atomic.Bool
+}
+
+func (m *capacityManager) EnsureContainer(_ context.Context, userID string, _ string, _ string, _ time.Time, _ map[string]string) (string, error) {
+	if m.full.Load() {
+		return "", container.ErrNoHostCapacity
+	}
+	return "container-" + userID, nil
+}
+
+func TestProvisionQueueWaitsForCapacity(t *testing.T) {
+	provisionOps = newProvisionTracker()
+	repo := newFakeRepo()
+	mgr := &capacityManager{}
+	mgr.full.Store(true)
+	handler := NewContainerHandler(NewHandler(repo, mgr, terminal.NewSessionManager(), ""))
+	handler.queueWake = make(chan struct{}, 1)
+
+	users := []string{"anon_a", "anon_b", "anon_c"}
+	for _, userID := range users {
+		if err := repo.UpsertUser(t.Context(), &domain.User{UserID: userID}); err != nil {
+			t.Fatalf("upsert user: %v", err)
+		}
+		op, _ := provisionOps.begin(userID, "", "", time.Now())
+		handler.provisionAsync(t.Context(), userID, op)
+	}
+
+	for i, userID := range users {
+		op, _ := provisionOps.get(userID)
+		if op.Status != provisionStatusProvisioning || op.Stage != provisionStageQueued || op.QueuePosition != i+1 {
+			t.Fatalf("expected %s queued at %d, got %+v", userID, i+1, op)
+		}
+	}
+
+	// Leaving the queue moves everyone behind up.
+	handler.cancelQueuedProvision(t.Context(), "anon_b")
+	if op, _ := provisionOps.get("anon_b"); op.Status != provisionStatusFailed || op.Error != "cancelled" {
+		t.Fatalf("expected cancelled operation, got %+v", op)
+	}
+	if op, _ := provisionOps.get("anon_c"); op.QueuePosition != 2 {
+		t.Fatalf("expected anon_c to move to position 2, got %+v", op)
+	}
+
+	handler.drainProvisionQueue(t.Context())
+	if queue, _ := repo.ListProvisionQueue(t.Context()); !slices.Equal(queue, []string{"anon_a", "anon_c"}) {
+		t.Fatalf("expected users to stay queued while full, got %v", queue)
+	}
+
+	mgr.full.Store(false)
+	handler.drainProvisionQueue(t.Context())
+	for _, userID := range []string{"anon_a", "anon_c"} {
+		op, _ := provisionOps.get(userID)
+		if op.Status != provisionStatusReady || op.ContainerID != "container-"+userID || op.QueuePosition != 0 {
+			t.Fatalf("expected %s provisioned, got %+v", userID, op)
+		}
+	}
+	if queue, _ := repo.ListProvisionQueue(t.Context()); len(queue) != 0 {
+		t.Fatalf("expected empty queue, got %v", queue)
+	}
+}
+
+func TestProvisionWithoutQueueFailsOnCapacity(t *testing.T) {
+	provisionOps = newProvisionTracker()
+	repo := newFakeRepo()
+	mgr := &capacityManager{}
+	mgr.full.Store(true)
+	handler := NewContainerHandler(NewHandler(repo, mgr, terminal.NewSessionManager(), ""))
+	if err := repo.UpsertUser(t.Context(), &domain.User{UserID: "anon_a"}); err != nil {
+		t.Fatalf("upsert user: %v", err)
+	}
+
+	op, _ := provisionOps.begin("anon_a", "", "", time.Now())
+	handler.provisionAsync(t.Context(), "anon_a", op)
+	if op, _ := provisionOps.get("anon_a"); op.Status != provisionStatusFailed || op.Error != "no_capacity" {
+		t.Fatalf("expected no_capacity failure, got %+v", op)
+	}
+}
@@ -0,0 +1,301 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+	"github.com/go-chi/chi/v5"
+)
+
+const provisionTestUser = "anon_0123456789abcdef0123456789abcdef"
+
+// blockingManager holds EnsureContainer until release is closed.
+type blockingManager struct {
+	fakeManager
+	entered chan struct{}
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (m *blockingManager) EnsureContainer(ctx context.Context, _ string, _ string, _ string, _ time.Time, _ map[string]string) (string, error) {
+	container.ReportProgress(ctx, container.StageCreating)
+	if m.calls.Add(1) == 1 {
+		close(m.entered)
+	}
+	<-m.release
+	return "container-1", nil
+}
+
+func newProvisionRouter(handler *ContainerHandler) http.Handler {
+	r := chi.NewRouter()
+	r.Use(identity.Middleware(handler.repo, true))
+	handler.RegisterRoutes(r)
+	return r
+}
+
+func serveProvision(handler *ContainerHandler, method, path, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.AddCookie(&http.Cookie{Name: identity.AnonCookieName, Value: provisionTestUser})
+	if key != "" {
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+	rr := httptest.NewRecorder()
+	newProvisionRouter(handler).ServeHTTP(rr, req)
+	return rr
+}
+
+// readProgressEvents decodes "progress" events from an SSE stream until it ends.
+func readProgressEvents(t *testing.T, body io.Reader) <-chan provisionOperation {
+	t.Helper()
+	events := make(chan provisionOperation, 8)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(body)
+		event := ""
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: ") && event == "progress":
+				var op provisionOperation
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &op); err == nil {
+					events <- op
+				}
+			}
+		}
+	}()
+	return events
+}
+
+func decodeProvision(t *testing.T, rr *httptest.ResponseRecorder) (int, provisionOperation) {
+	t.Helper()
+	var op provisionOperation
+	if err := json.NewDecoder(rr.Body).Decode(&op); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return rr.Code, op
+}
+
+func doProvisionRequest(t *testing.T, handler *ContainerHandler, method, path, key string) (int, provisionOperation) {
+	t.Helper()
+	return decodeProvision(t, serveProvision(handler, method, path, key))
+}
+
+// waitProvisionFinished waits for the user's operation to finish, so it does
+// not outlive the test that started it.
+func waitProvisionFinished(t *testing.T, userID string) provisionOperation {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		op, ok := provisionOps.get(userID)
+		if ok && op.Status != provisionStatusProvisioning {
+			return op
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("provision operation did not finish: %+v", op)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestProvisionDeduplicatesConcurrentRequests(t *testing.T) {
+	provisionOps = newProvisionTracker()
+	mgr := &blockingManager{entered: make(chan struct{}), release: make(chan struct{})}
+	handler := NewContainerHandler(NewHandler(newFakeRepo(), mgr, terminal.NewSessionManager(), ""))
+
+	code, op := doProvisionRequest(t, handler, http.MethodPost, "/api/provision", "key-1")
+	if code != http.StatusAccepted || op.Status != provisionStatusProvisioning || op.ID != "key-1" {
+		t.Fatalf("expected accepted operation key-1, got code=%d op=%+v", code, op)
+	}
+	<-mgr.entered
+
+	code, op = doProvisionRequest(t, handler, http.MethodPost, "/api/provision", "key-2")
+	if code != http.StatusAccepted || op.Status != provisionStatusProvisioning || op.ID != "key-1" {
+		t.Fatalf("expected in-progress operation key-1, got code=%d op=%+v", code, op)
+	}
+
+	code, op = doProvisionRequest(t, handler, http.MethodGet, "/api/provision/status", "")
+	if code != http.StatusOK || op.Stage != container.StageCreating {
+		t.Fatalf("expected creating stage, got code=%d op=%+v", code, op)
+	}
+
+	srv := httptest.NewServer(newProvisionRouter(handler))
+	defer srv.Close()
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/provision/events?operation_id=key-1", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.AddCookie(&http.Cookie{Name: identity.AnonCookieName, Value: provisionTestUser})
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("open event stream: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected event stream, got %q", ct)
+	}
+
+	events := readProgressEvents(t, resp.Body)
+	if first := <-events; first.Stage != container.StageCreating {
+		t.Fatalf("expected creating event first, got %+v", first)
+	}
+	close(mgr.release)
+	if last := <-events; last.Status != provisionStatusReady || last.ContainerID != "container-1" {
+		t.Fatalf("expected ready event, got %+v", last)
+	}
+
+	code, op = doProvisionRequest(t, handler, http.MethodPost, "/api/provision", "key-1")
+	if code != http.StatusOK || op.ContainerID != "container-1" || op.FinishedAt == nil {
+		t.Fatalf("expected replayed result, got code=%d op=%+v", code, op)
+	}
+	if calls := mgr.calls.Load(); calls != 1 {
+		t.Fatalf("expected a single create, got %d", calls)
+	}
+
+	code, op = doProvisionRequest(t, handler, http.MethodGet, "/api/provision/status?operation_id=key-1", "")
+	if code != http.StatusOK || op.Status != provisionStatusReady {
+		t.Fatalf("expected ready status, got code=%d op=%+v", code, op)
+	}
+}
+
+func TestProvisionRejectsInvalidIdempotencyKey(t *testing.T) {
+	provisionOps = newProvisionTracker()
+	handler := NewContainerHandler(NewHandler(newFakeRepo(), &fakeManager{}, terminal.NewSessionManager(), ""))
+
+	if code, _ := doProvisionRequest(t, handler, http.MethodPost, "/api/provision", "bad key!"); code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", code)
+	}
+}
+
+func TestProvisionStatusWithoutOperation(t *testing.T) {
+	provisionOps = newProvisionTracker()
+	handler := NewContainerHandler(NewHandler(newFakeRepo(), &fakeManager{}, terminal.NewSessionManager(), ""))
+
+	if code, _ := doProvisionRequest(t, handler, http.MethodGet, "/api/provision/status", ""); code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", code)
+	}
+}
+
+func TestProvisionRateLimitedPerIP(t *testing.T) {
+	provisionOps = newProvisionTracker()
+	cfg := &config.Config{RateLimit: config.RateLimitConfig{ProvisionPerIP: 1, ProvisionWindow: time.Minute}}
+	handler := NewContainerHandler(NewHandler(newFakeRepo(), &fakeManager{}, terminal.NewSessionManager(), ""), WithConfig(cfg))
+
+	if rr := serveProvision(handler, http.MethodPost, "/api/provision", ""); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected first provision accepted, got %d", rr.Code)
+	}
+	rr := serveProvision(handler, http.MethodPost, "/api/provision", "")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 429 with Retry-After, got %d %v", rr.Code, rr.Header())
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/provision", nil)
+	req.RemoteAddr = "198.51.100.7:4000"
+	req.AddCookie(&http.Cookie{Name: identity.AnonCookieName, Value: provisionTestUser})
+	other := httptest.NewRecorder()
+	newProvisionRouter(handler).ServeHTTP(other, req)
+	if other.Code == http.StatusTooManyRequests {
+		t.Fatal("limit must be per client IP")
+	}
+	waitProvisionFinished(t, provisionTestUser)
+}
+
+// imageManager reports the image each EnsureContainer call asked for.
+type imageManager struct {
+	fakeManager
+	images chan string
+}
+
+func (m *imageManager) EnsureContainer(_ context.Context, _ string, _ string, image string, _ time.Time, _ map[string]string) (string, error) {
+	m.images <- image
+	return "container-1", nil
+}
+
+func TestProvisionSelectsImage(t *testing.T) {
+	provisionOps = newProvisionTracker()
+	cfg := &config.Config{Container: config.ContainerConfig{Images: []config.ContainerImage{{Name: "git-lab", Ref: "shsh/git-lab:1"}}}}
+	mgr := &imageManager{images: make(chan string, 1)}
+	router := newProvisionRouter(NewContainerHandler(NewHandler(newFakeRepo(), mgr, terminal.NewSessionManager(), ""), WithConfig(cfg)))
+	provision := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/provision", strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: identity.AnonCookieName, Value: provisionTestUser})
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := provision(`{"image":"networking-lab"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an image not configured, got %d", rr.Code)
+	}
+	rr := provision(`{"image":"git-lab"}`)
+	if rr.Code != http.StatusAccepted || !strings.Contains(rr.Body.String(), `"image":"git-lab"`) {
+		t.Fatalf("unexpected response %d: %s", rr.Code, rr.Body.String())
+	}
+	if op := waitProvisionFinished(t, provisionTestUser); op.Status != provisionStatusReady {
+		t.Fatalf("provision failed: %+v", op)
+	}
+	if image := <-mgr.images; image != "shsh/git-lab:1" {
+		t.Fatalf("container created from %q", image)
+	}
+}
+
+// tierManager reports the resource tier each EnsureContainer call asked for.
+type tierManager struct {
+	fakeManager
+	tiers chan string
+}
+
+func (m *tierManager) EnsureContainer(ctx context.Context, _ string, _ string, _ string, _ time.Time, _ map[string]string) (string, error) {
+	tier, _ := container.ResourceTierFromContext(ctx)
+	m.tiers <- tier.Name
+	return "container-1", nil
+}
+
+func TestProvisionAppliesResourceTier(t *testing.T) {
+	provisionOps = newProvisionTracker()
+	cfg := &config.Config{Container: config.ContainerConfig{
+		Images:      []config.ContainerImage{{Name: "net-lab", Ref: "shsh/net-lab:1", Tier: "large"}},
+		Tiers:       []config.ResourceTier{{Name: "small"}, {Name: "large"}},
+		DefaultTier: "small",
+	}}
+	repo := newFakeRepo()
+	mgr := &tierManager{tiers: make(chan string, 1)}
+	router := newProvisionRouter(NewContainerHandler(NewHandler(repo, mgr, terminal.NewSessionManager(), ""), WithConfig(cfg)))
+	provision := func(body string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/provision", strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: identity.AnonCookieName, Value: provisionTestUser})
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		if op := waitProvisionFinished(t, provisionTestUser); op.Status != provisionStatusReady {
+			t.Fatalf("provision failed: %+v", op)
+		}
+		return <-mgr.tiers
+	}
+
+	if tier := provision(""); tier != "small" {
+		t.Fatalf("expected the default tier, got %q", tier)
+	}
+	if tier := provision(`{"image":"net-lab"}`); tier != "large" {
+		t.Fatalf("expected the image's tier, got %q", tier)
+	}
+	if err := repo.SetResourceTier(t.Context(), provisionTestUser, "small"); err != nil {
+		t.Fatal(err)
+	}
+	if tier := provision(`{"image":"net-lab"}`); tier != "small" {
+		t.Fatalf("expected the admin-assigned tier to win, got %q", tier)
+	}
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/ashureev/shsh-labs/internal/affinity"
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/go-chi/chi/v5"
+)
+
+// routeInstanceHeader carries the target instance ID so a proxy using an
+// auth-request style subrequest can route without parsing the body.
+const routeInstanceHeader = "X-Shsh-Route-Instance"
+
+// Route hint sources.
+const (
+	routeSourceRedis = "redis"
+	routeSourceStore = "store"
+	routeSourceNone  = "none"
+)
+
+// routeHintResponse is the body of GET /api/route-hint.
+type routeHintResponse struct {
+	InstanceID string `json:"instance_id,omitempty"`
+	Address    string `json:"address,omitempty"`
+	Local      bool   `json:"local"`
+	Source     string `json:"source"`
+}
+
+// RouteHintHandler tells a front proxy which instance holds a user's terminal
+// exec stream so WebSocket and SSE connections land on it.
+type RouteHintHandler struct {
+	*Handler
+	cfg    *config.Config
+	routes affinity.Registry
+}
+
+// NewRouteHintHandler creates a route hint handler. routes may be nil when
+// Redis lookup is disabled; the store is consulted instead.
+func NewRouteHintHandler(base *Handler, routes affinity.Registry, cfg *config.Config) *RouteHintHandler {
+	return &RouteHintHandler{Handler: base, cfg: cfg, routes: routes}
+}
+
+// RegisterRoutes registers route hint routes.
+func (h *RouteHintHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/api/route-hint", h.GetRouteHint)
+}
+
+// GetRouteHint handles GET /api/route-hint.
+// Redis is preferred when configured; otherwise the instance recorded on the
+// user's session record is returned while a container is assigned.
+func (h *RouteHintHandler) GetRouteHint(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	if userID == "" {
+		Error(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	self := selfRoute(h.cfg)
+	resp := routeHintResponse{Source: routeSourceNone}
+
+	if h.routes != nil {
+		route, ok, err := h.routes.Lookup(r.Context(), userID)
+		if err != nil {
+			slog.Warn("Route lookup failed, falling back to store", "user_id", userID, "error", err)
+		} else if ok {
+			resp = routeHintResponse{InstanceID: route.InstanceID, Address: route.Address, Source: routeSourceRedis}
+		}
+	}
+
+	if resp.Source == routeSourceNone {
+		user, err := h.repo.GetUser(r.Context(), userID)
+		if err != nil || user == nil {
+			Error(w, http.StatusUnauthorized, "user not found")
+			return
+		}
+		if user.HasActiveContainer() && user.InstanceID != "" {
+			resp.InstanceID = user.InstanceID
+			resp.Source = routeSourceStore
+			if user.InstanceID == self.InstanceID {
+				resp.Address = self.Address
+			}
+		}
+	}
+
+	resp.Local = resp.InstanceID != "" && resp.InstanceID == self.InstanceID
+	if resp.InstanceID != "" {
+		w.Header().Set(routeInstanceHeader, resp.InstanceID)
+	}
+	JSON(w, http.StatusOK, resp)
+}
+
+// selfRoute returns the route to this instance.
+func selfRoute(cfg *config.Config) affinity.Route {
+	if cfg == nil {
+		return affinity.Route{}
+	}
+	return affinity.Route{InstanceID: cfg.InstanceID, Address: cfg.Affinity.AdvertiseAddr}
+}
+
+// SetRouteRegistry enables publishing routes to a shared registry on
+// provision and destroy.
+func (h *ContainerHandler) SetRouteRegistry(routes affinity.Registry) {
+	h.routes = routes
+}
+
+// recordRoute marks this instance as holding the user's terminal session.
+// Failures are logged; routing hints are advisory.
+func (h *ContainerHandler) recordRoute(ctx context.Context, userID string) {
+	self := selfRoute(h.cfg)
+	if self.InstanceID == "" {
+		return
+	}
+	if err := h.repo.UpdateInstanceID(ctx, userID, self.InstanceID); err != nil {
+		slog.Warn("Failed to record session instance", "user_id", userID, "error", err)
+	}
+	if h.routes != nil {
+		if err := h.routes.Record(ctx, userID, self); err != nil {
+			slog.Warn("Failed to publish route", "user_id", userID, "error", err)
+		}
+	}
+}
+
+// ForgetRoute clears the user's routing hint once their container is gone,
+// whether it was destroyed or recycled by the health worker.
+func (h *ContainerHandler) ForgetRoute(ctx context.Context, userID string) {
+	if err := h.repo.UpdateInstanceID(ctx, userID, ""); err != nil {
+		slog.Warn("Failed to clear session instance", "user_id", userID, "error", err)
+	}
+	if h.routes != nil {
+		if err := h.routes.Forget(ctx, userID); err != nil {
+			slog.Warn("Failed to remove route", "user_id", userID, "error", err)
+		}
+	}
+}
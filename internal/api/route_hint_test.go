@@ -0,0 +1,105 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ashureev/shsh-labs/internal/affinity"
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+)
+
+type fakeRouteRegistry struct {
+	routes map[string]affinity.Route
+}
+
+func (f *fakeRouteRegistry) Record(_ context.Context, userID string, route affinity.Route) error {
+	f.routes[userID] = route
+	return nil
+}
+
+func (f *fakeRouteRegistry) Lookup(_ context.Context, userID string) (affinity.Route, bool, error) {
+	route, ok := f.routes[userID]
+	return route, ok, nil
+}
+
+func (f *fakeRouteRegistry) Forget(_ context.Context, userID string) error {
+	delete(f.routes, userID)
+	return nil
+}
+
+const routeHintTestUser = "anon_0123456789abcdef0123456789abcdef"
+
+func doRouteHintRequest(t *testing.T, handler *RouteHintHandler, repo *fakeRepo) (*httptest.ResponseRecorder, routeHintResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/route-hint", nil)
+	req.AddCookie(&http.Cookie{Name: identity.AnonCookieName, Value: routeHintTestUser})
+	rr := httptest.NewRecorder()
+	identity.Middleware(repo, true)(http.HandlerFunc(handler.GetRouteHint)).ServeHTTP(rr, req)
+
+	var resp routeHintResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return rr, resp
+}
+
+func TestRouteHintUsesSessionRecord(t *testing.T) {
+	repo := newFakeRepo()
+	cfg := &config.Config{InstanceID: "node-a", Affinity: config.AffinityConfig{AdvertiseAddr: "10.0.0.5:8080"}}
+	handler := NewRouteHintHandler(NewHandler(repo, &fakeManager{}, terminal.NewSessionManager(), ""), nil, cfg)
+
+	_, resp := doRouteHintRequest(t, handler, repo)
+	if resp.Source != routeSourceNone || resp.InstanceID != "" {
+		t.Fatalf("expected no route without a container, got %+v", resp)
+	}
+
+	_ = repo.UpdateContainerID(context.Background(), routeHintTestUser, "container-1", "")
+	_ = repo.UpdateInstanceID(context.Background(), routeHintTestUser, "node-a")
+
+	rr, resp := doRouteHintRequest(t, handler, repo)
+	if resp.Source != routeSourceStore || !resp.Local || resp.Address != "10.0.0.5:8080" {
+		t.Fatalf("expected local store route, got %+v", resp)
+	}
+	if rr.Header().Get(routeInstanceHeader) != "node-a" {
+		t.Fatalf("expected route header node-a, got %q", rr.Header().Get(routeInstanceHeader))
+	}
+}
+
+func TestRouteHintPrefersRegistry(t *testing.T) {
+	repo := newFakeRepo()
+	registry := &fakeRouteRegistry{routes: map[string]affinity.Route{
+		routeHintTestUser: {InstanceID: "node-b", Address: "10.0.0.6:8080"},
+	}}
+	cfg := &config.Config{InstanceID: "node-a"}
+	handler := NewRouteHintHandler(NewHandler(repo, &fakeManager{}, terminal.NewSessionManager(), ""), registry, cfg)
+
+	_, resp := doRouteHintRequest(t, handler, repo)
+	if resp.Source != routeSourceRedis || resp.InstanceID != "node-b" || resp.Local {
+		t.Fatalf("expected remote registry route, got %+v", resp)
+	}
+}
+
+func TestForgetRouteClearsRegistryAndRecord(t *testing.T) {
+	repo := newFakeRepo()
+	_ = repo.UpsertUser(context.Background(), &domain.User{UserID: routeHintTestUser, InstanceID: "node-a"})
+	registry := &fakeRouteRegistry{routes: map[string]affinity.Route{
+		routeHintTestUser: {InstanceID: "node-a"},
+	}}
+	handler := NewContainerHandler(NewHandler(repo, &fakeManager{}, terminal.NewSessionManager(), ""))
+	handler.SetRouteRegistry(registry)
+
+	handler.ForgetRoute(context.Background(), routeHintTestUser)
+	if _, ok := registry.routes[routeHintTestUser]; ok {
+		t.Fatal("expected the published route to be forgotten")
+	}
+	if user, _ := repo.GetUser(context.Background(), routeHintTestUser); user.InstanceID != "" {
+		t.Fatalf("expected the session instance to be cleared, got %q", user.InstanceID)
+	}
+}
@@ -0,0 +1,307 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/store"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+	"github.com/go-chi/chi/v5"
+)
+
+type healthResponse struct {
+	Status  string                   `json:"status"`
+	Checks  map[string]string        `json:"checks"`
+	Runtime *container.RuntimeStatus `json:"runtime"`
+}
+
+func doHealthRequest(t *testing.T, runtime container.RuntimeStatus) (int, healthResponse) {
+	t.Helper()
+	handler := NewHealthHandler(newFakeRepo(), WithManager(&fakeManager{runtime: runtime}))
+	rr := httptest.NewRecorder()
+	handler.Health(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	var resp healthResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return rr.Code, resp
+}
+
+func TestHealthReportsRuntime(t *testing.T) {
+	tests := []struct {
+		name       string
+		runtime    container.RuntimeStatus
+		wantCode   int
+		wantStatus string
+		wantCheck  string
+	}{
+		{
+			name:       "available",
+			runtime:    container.RuntimeStatus{Requested: "runsc", Effective: "runsc", Available: true},
+			wantCode:   http.StatusOK,
+			wantStatus: "healthy",
+			wantCheck:  "ok",
+		},
+		{
+			name:       "fallback",
+			runtime:    container.RuntimeStatus{Requested: "runsc", Effective: "runc", Fallback: true, Error: "missing"},
+			wantCode:   http.StatusOK,
+			wantStatus: "healthy",
+			wantCheck:  "fallback",
+		},
+		{
+			name:       "unavailable",
+			runtime:    container.RuntimeStatus{Requested: "runsc", Effective: "runsc", Error: "missing"},
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: "degraded",
+			wantCheck:  "unavailable",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := doHealthRequest(t, tt.runtime)
+			if code != tt.wantCode || resp.Status != tt.wantStatus || resp.Checks["runtime"] != tt.wantCheck {
+				t.Fatalf("got code=%d status=%q check=%q, want %d %q %q",
+					code, resp.Status, resp.Checks["runtime"], tt.wantCode, tt.wantStatus, tt.wantCheck)
+			}
+			if resp.Runtime == nil || resp.Runtime.Fallback != tt.runtime.Fallback {
+				t.Fatalf("expected runtime details in response, got %+v", resp.Runtime)
+			}
+		})
+	}
+}
+
+func TestConfigReportsRuntime(t *testing.T) {
+	runtime := container.RuntimeStatus{Requested: "runsc", Effective: "runc", Fallback: true}
+	base := NewHandler(newFakeRepo(), &fakeManager{runtime: runtime}, terminal.NewSessionManager(), "")
+	handler := NewContainerHandler(base)
+
+	rr := httptest.NewRecorder()
+	handler.GetConfig(rr, httptest.NewRequest(http.MethodGet, "/api/config", nil))
+
+	var resp struct {
+		Runtime container.RuntimeStatus `json:"runtime"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Runtime != runtime {
+		t.Fatalf("expected runtime %+v, got %+v", runtime, resp.Runtime)
+	}
+}
+
+type fakePoolManager struct {
+	fakeManager
+	hosts []container.HostStatus
+}
+
+func (f *fakePoolManager) Hosts() []container.HostStatus { return f.hosts }
+
+func TestHealthReportsDockerHosts(t *testing.T) {
+	runtime := container.RuntimeStatus{Effective: "runc", Available: true}
+	tests := []struct {
+		name      string
+		healthy   []bool
+		wantCode  int
+		wantCheck string
+	}{
+		{name: "all healthy", healthy: []bool{true, true}, wantCode: http.StatusOK, wantCheck: "ok"},
+		{name: "partial", healthy: []bool{true, false}, wantCode: http.StatusOK, wantCheck: "partial"},
+		{name: "none healthy", healthy: []bool{false, false}, wantCode: http.StatusServiceUnavailable, wantCheck: "unavailable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mgr := &fakePoolManager{fakeManager: fakeManager{runtime: runtime}}
+			for i, healthy := range tt.healthy {
+				mgr.hosts = append(mgr.hosts, container.HostStatus{Name: string(rune('a' + i)), Healthy: healthy})
+			}
+			handler := NewHealthHandler(newFakeRepo(), WithManager(mgr))
+			rr := httptest.NewRecorder()
+			handler.Health(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+			var resp healthResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if rr.Code != tt.wantCode || resp.Checks["docker_hosts"] != tt.wantCheck {
+				t.Fatalf("got code=%d check=%q, want %d %q", rr.Code, resp.Checks["docker_hosts"], tt.wantCode, tt.wantCheck)
+			}
+		})
+	}
+}
+
+// imageStatusManager reports fixed pre-pull statuses.
+type imageStatusManager struct {
+	fakeManager
+	statuses []container.PrePullStatus
+}
+
+func (m *imageStatusManager) SetImageSource(container.ImageSource)     {}
+func (m *imageStatusManager) PrePull(context.Context) bool             { return false }
+func (m *imageStatusManager) PrePullStatus() []container.PrePullStatus { return m.statuses }
+
+func TestHealthWaitsForImages(t *testing.T) {
+	runtime := container.RuntimeStatus{Effective: "runc", Available: true}
+	ready := container.PrePullStatus{Host: "a", State: container.PrePullDone, Images: []container.ImagePull{{Image: "playground:latest", State: container.ImagePulled}}}
+	pulling := container.PrePullStatus{Host: "b", State: container.PrePullRunning, Images: []container.ImagePull{{Image: "playground:latest", State: container.ImagePulling}}}
+	failed := container.PrePullStatus{Host: "b", State: container.PrePullDone, Images: []container.ImagePull{{Image: "playground:latest", State: container.ImageFailed}}}
+	tests := []struct {
+		name      string
+		statuses  []container.PrePullStatus
+		wantCode  int
+		wantCheck string
+	}{
+		{name: "pulling", statuses: []container.PrePullStatus{pulling}, wantCode: http.StatusServiceUnavailable, wantCheck: "pulling"},
+		{name: "not started", statuses: []container.PrePullStatus{{Host: "a", State: container.PrePullIdle}}, wantCode: http.StatusServiceUnavailable, wantCheck: "pulling"},
+		{name: "failed", statuses: []container.PrePullStatus{failed}, wantCode: http.StatusServiceUnavailable, wantCheck: "missing"},
+		{name: "partial", statuses: []container.PrePullStatus{ready, failed}, wantCode: http.StatusOK, wantCheck: "partial"},
+		{name: "ready", statuses: []container.PrePullStatus{ready}, wantCode: http.StatusOK, wantCheck: "ok"},
+	}
+
+	cfg := &config.Config{Container: config.ContainerConfig{PrePullConcurrency: 2}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mgr := &imageStatusManager{fakeManager: fakeManager{runtime: runtime}, statuses: tt.statuses}
+			handler := NewHealthHandler(newFakeRepo(), WithManager(mgr), WithConfig(cfg))
+			rr := httptest.NewRecorder()
+			handler.Health(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+			var resp healthResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if rr.Code != tt.wantCode || resp.Checks["images"] != tt.wantCheck {
+				t.Fatalf("got code=%d check=%q, want %d %q", rr.Code, resp.Checks["images"], tt.wantCode, tt.wantCheck)
+			}
+		})
+	}
+}
+
+func TestHealthReportsQueryStats(t *testing.T) {
+	repo := store.NewInstrumented(newFakeRepo())
+	if _, err := repo.GetUser(context.Background(), "user-1"); err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+
+	handler := NewHealthHandler(repo)
+	rr := httptest.NewRecorder()
+	handler.Health(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	var resp struct {
+		Queries map[string]store.QueryStats `json:"database_queries"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	// The health check's own Ping is recorded too.
+	if got := resp.Queries["GetUser"].Calls; got != 1 {
+		t.Fatalf("GetUser calls = %d, want 1", got)
+	}
+	if got := resp.Queries["Ping"].Calls; got != 1 {
+		t.Fatalf("Ping calls = %d, want 1", got)
+	}
+	if got := len(resp.Queries["GetUser"].Histogram); got != len(store.QueryLatencyBuckets)+1 {
+		t.Fatalf("histogram has %d buckets, want %d", got, len(store.QueryLatencyBuckets)+1)
+	}
+}
+
+// lockedRepo fails user lookups with SQLite lock contention.
+type lockedRepo struct {
+	*fakeRepo
+}
+
+func (r lockedRepo) GetUser(context.Context, string) (*domain.User, error) {
+	return nil, errors.New("database is locked")
+}
+
+func TestHealthReportsDatabaseDetails(t *testing.T) {
+	fake := newFakeRepo()
+	if err := fake.UpsertUser(context.Background(), &domain.User{UserID: "user-1"}); err != nil {
+		t.Fatalf("upsert user: %v", err)
+	}
+	repo := store.NewInstrumented(lockedRepo{fake})
+	if _, err := repo.GetUser(context.Background(), "user-1"); err == nil {
+		t.Fatal("expected lock error")
+	}
+
+	handler := NewHealthHandler(repo)
+	rr := httptest.NewRecorder()
+	handler.Health(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	var resp struct {
+		Database *store.HealthDetails `json:"database"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Database == nil {
+		t.Fatal("health response has no database details")
+	}
+	if resp.Database.Driver != "fake" || resp.Database.RowCounts["users"] != 1 {
+		t.Fatalf("unexpected database details: %+v", resp.Database)
+	}
+	if resp.Database.BusyErrors != 1 {
+		t.Fatalf("busy errors = %d, want 1", resp.Database.BusyErrors)
+	}
+}
+
+func TestFocusWindowReportedInConfig(t *testing.T) {
+	monitor := terminal.NewMonitor(nil, nil, nil)
+	defer monitor.Stop()
+	base := NewHandler(newFakeRepo(), &fakeManager{}, terminal.NewSessionManager(), "")
+	handler := NewContainerHandler(base)
+	handler.SetQuietHours(monitor)
+	r := chi.NewRouter()
+	r.Use(identity.Middleware(base.repo, true))
+	handler.RegisterRoutes(r)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: identity.AnonCookieName, Value: provisionTestUser})
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	config := func() terminal.QuietStatus {
+		t.Helper()
+		rr := serve(http.MethodGet, "/api/config", "")
+		var resp struct {
+			QuietHours terminal.QuietStatus `json:"quiet_hours"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode config: %v", err)
+		}
+		return resp.QuietHours
+	}
+
+	if status := config(); status.Active {
+		t.Fatalf("expected no quiet hours, got %+v", status)
+	}
+	if rr := serve(http.MethodPut, "/api/focus", `{"duration_seconds": 86400}`); rr.Code != http.StatusOK {
+		t.Fatalf("start focus status = %d: %s", rr.Code, rr.Body.String())
+	}
+	status := config()
+	if !status.Active || status.Reason != terminal.QuietReasonFocus || time.Until(status.FocusUntil) > 8*time.Hour {
+		t.Fatalf("unexpected focus status: %+v", status)
+	}
+	if rr := serve(http.MethodDelete, "/api/focus", ""); rr.Code != http.StatusOK {
+		t.Fatalf("end focus status = %d: %s", rr.Code, rr.Body.String())
+	}
+	if status := config(); status.Active {
+		t.Fatalf("expected focus to end, got %+v", status)
+	}
+}
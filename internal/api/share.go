@@ -0,0 +1,218 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/go-chi/chi/v5"
+)
+
+// Share link lifetimes used when no config is given.
+const (
+	defaultShareTTL    = 24 * time.Hour
+	defaultShareMaxTTL = 7 * 24 * time.Hour
+)
+
+// shareRequest is the body of POST /api/shares. Both fields are optional.
+type shareRequest struct {
+	SessionID       string `json:"session_id"`
+	DurationSeconds int64  `json:"duration_seconds"`
+}
+
+// sharedSession is the public view of a share link.
+type sharedSession struct {
+	CreatedAt time.Time       `json:"created_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+	Session   json.RawMessage `json:"session"`
+}
+
+// ShareHandler lets learners publish a read-only, time-limited link to a
+// sanitized transcript of a finished tab session, and serves those links to
+// anyone holding them.
+type ShareHandler struct {
+	*Handler
+	defaultTTL time.Duration
+	maxTTL     time.Duration
+}
+
+// NewShareHandler creates a share handler.
+func NewShareHandler(base *Handler, cfg *config.Config) *ShareHandler {
+	h := &ShareHandler{Handler: base, defaultTTL: defaultShareTTL, maxTTL: defaultShareMaxTTL}
+	if cfg != nil && cfg.Share.DefaultTTL > 0 && cfg.Share.MaxTTL >= cfg.Share.DefaultTTL {
+		h.defaultTTL = cfg.Share.DefaultTTL
+		h.maxTTL = cfg.Share.MaxTTL
+	}
+	return h
+}
+
+// RegisterRoutes registers the routes learners manage their links with. They
+// must be behind the identity middleware.
+func (h *ShareHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/api/shares", h.ListShares)
+	r.Post("/api/shares", h.CreateShare)
+	r.Delete("/api/shares/{token}", h.DeleteShare)
+}
+
+// RegisterPublicRoutes registers the route serving shared transcripts. It
+// must not be behind the identity middleware: links are opened by people
+// without a session.
+func (h *ShareHandler) RegisterPublicRoutes(r chi.Router) {
+	r.Get("/api/share/{token}", h.GetShare)
+}
+
+// ListShares handles GET /api/shares, returning the caller's unexpired links.
+func (h *ShareHandler) ListShares(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	shares, err := h.repo.ListSessionShares(r.Context(), userID)
+	if err != nil {
+		slog.Error("Failed to list session shares", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to load shares")
+		return
+	}
+	if shares == nil {
+		shares = []*domain.SessionShare{}
+	}
+	JSON(w, http.StatusOK, map[string]interface{}{"shares": shares})
+}
+
+// CreateShare handles POST /api/shares. It snapshots the sanitized
+// transcript of session_id, or of the calling tab when omitted, and returns
+// a link valid for duration_seconds, capped at the configured maximum. The
+// session must have no open terminal.
+func (h *ShareHandler) CreateShare(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	r.Body = http.MaxBytesReader(w, r.Body, 4*1024)
+	var req shareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.DurationSeconds < 0 {
+		Error(w, http.StatusBadRequest, "duration_seconds must be positive")
+		return
+	}
+	sessionID := req.SessionID
+	if sessionID == "" {
+		sessionID = identity.SessionIDFromContext(r.Context())
+	}
+	if h.sm.GetActive(userID, sessionID) != nil {
+		Error(w, http.StatusConflict, "session_active")
+		return
+	}
+
+	transcript, ok := h.transcript(w, r, userID, sessionID)
+	if !ok {
+		return
+	}
+	data, err := json.Marshal(transcript)
+	if err != nil {
+		slog.Error("Failed to encode shared transcript", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to create share")
+		return
+	}
+
+	ttl := h.defaultTTL
+	if req.DurationSeconds > 0 {
+		ttl = min(time.Duration(req.DurationSeconds)*time.Second, h.maxTTL)
+	}
+	now := time.Now()
+	share := &domain.SessionShare{
+		Token:      rand.Text(),
+		UserID:     userID,
+		SessionID:  sessionID,
+		Transcript: string(data),
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	if err := h.repo.CreateSessionShare(r.Context(), share); err != nil {
+		slog.Error("Failed to store session share", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to create share")
+		return
+	}
+	slog.Info("Session share created", "user_id", userID, "session_id", sessionID, "expires_at", share.ExpiresAt)
+	JSON(w, http.StatusCreated, map[string]interface{}{
+		"share": share,
+		"path":  "/api/share/" + share.Token,
+	})
+}
+
+// transcript builds the sanitized transcript of a tab session, writing an
+// error response if there is nothing to share.
+func (h *ShareHandler) transcript(w http.ResponseWriter, r *http.Request, userID, sessionID string) (*domain.SharedTranscript, bool) {
+	user, err := h.repo.GetUser(r.Context(), userID)
+	if err != nil {
+		slog.Error("Failed to get user for share", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to load user")
+		return nil, false
+	}
+	if user == nil {
+		Error(w, http.StatusNotFound, "user not found")
+		return nil, false
+	}
+	commands, err := h.repo.ListCommands(r.Context(), userID, sessionID, 0)
+	if err != nil {
+		slog.Error("Failed to list commands for share", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to load session")
+		return nil, false
+	}
+	session, err := h.repo.GetAgentSession(r.Context(), userID, sessionID)
+	if err != nil {
+		slog.Error("Failed to get agent session for share", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to load session")
+		return nil, false
+	}
+
+	transcript := domain.NewSharedTranscript(user, commands, session)
+	if len(transcript.Commands) == 0 && len(transcript.Messages) == 0 {
+		Error(w, http.StatusNotFound, "session has nothing to share")
+		return nil, false
+	}
+	return transcript, true
+}
+
+// DeleteShare handles DELETE /api/shares/{token}, revoking one of the
+// caller's links.
+func (h *ShareHandler) DeleteShare(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	deleted, err := h.repo.DeleteSessionShare(r.Context(), userID, chi.URLParam(r, "token"))
+	if err != nil {
+		slog.Error("Failed to delete session share", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to revoke share")
+		return
+	}
+	if !deleted {
+		Error(w, http.StatusNotFound, "share not found")
+		return
+	}
+	JSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+// GetShare handles GET /api/share/{token}, the public view of a link. Expired
+// and revoked links are indistinguishable from unknown ones.
+func (h *ShareHandler) GetShare(w http.ResponseWriter, r *http.Request) {
+	share, err := h.repo.GetSessionShare(r.Context(), chi.URLParam(r, "token"))
+	if err != nil {
+		slog.Error("Failed to get session share", "error", err)
+		Error(w, http.StatusInternalServerError, "failed to load share")
+		return
+	}
+	if share == nil || share.Expired(time.Now()) {
+		Error(w, http.StatusNotFound, "share not found")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	JSON(w, http.StatusOK, sharedSession{
+		CreatedAt: share.CreatedAt,
+		ExpiresAt: share.ExpiresAt,
+		Session:   json.RawMessage(share.Transcript),
+	})
+}
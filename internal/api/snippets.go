@@ -0,0 +1,267 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/go-chi/chi/v5"
+	chiMiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	// maxSnippetLength bounds the body of a snippet.
+	maxSnippetLength = 4096
+	// maxSnippetLines bounds how many lines a snippet types.
+	maxSnippetLines = 50
+	// maxSnippetDescription bounds the description of a snippet.
+	maxSnippetDescription = 200
+	// maxSnippetsPerUser bounds how many snippets a user may keep.
+	maxSnippetsPerUser = 100
+)
+
+// snippetName is the form of snippet names, which appear in URLs.
+var snippetName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// snippetRequest is the body of PUT /api/terminal/snippets/{name}.
+type snippetRequest struct {
+	Description string `json:"description"`
+	Body        string `json:"body"`
+}
+
+// insertSnippetRequest is the body of POST /api/terminal/snippets/{name}/insert.
+type insertSnippetRequest struct {
+	Values  map[string]string `json:"values"`
+	Execute bool              `json:"execute"`
+}
+
+// snippetView is a snippet as returned to the frontend, with the values it
+// asks for on insertion.
+type snippetView struct {
+	*domain.Snippet
+	Placeholders []domain.SnippetPlaceholder `json:"placeholders"`
+}
+
+func newSnippetView(s *domain.Snippet) snippetView {
+	placeholders := s.Placeholders()
+	if placeholders == nil {
+		placeholders = []domain.SnippetPlaceholder{}
+	}
+	return snippetView{Snippet: s, Placeholders: placeholders}
+}
+
+// ListSnippets handles GET /api/terminal/snippets, returning the caller's
+// snippets sorted by name.
+func (h *TerminalRunHandler) ListSnippets(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	if userID == "" {
+		Error(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	snippets, err := h.repo.ListSnippets(r.Context(), userID)
+	if err != nil {
+		slog.Error("Failed to list snippets", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to load snippets")
+		return
+	}
+	views := make([]snippetView, 0, len(snippets))
+	for _, s := range snippets {
+		views = append(views, newSnippetView(s))
+	}
+	JSON(w, http.StatusOK, map[string]interface{}{"snippets": views})
+}
+
+// SaveSnippet handles PUT /api/terminal/snippets/{name}, creating or
+// replacing one of the caller's snippets. The body may span several lines
+// and use {{name}} or {{name:default}} placeholders, filled in on insertion.
+func (h *TerminalRunHandler) SaveSnippet(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	if userID == "" {
+		Error(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	name := chi.URLParam(r, "name")
+	if !snippetName.MatchString(name) {
+		Error(w, http.StatusBadRequest, "invalid snippet name")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 16*1024)
+	var req snippetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	body := strings.TrimRight(strings.ReplaceAll(req.Body, "\r\n", "\n"), "\n")
+	description := strings.TrimSpace(req.Description)
+	switch {
+	case strings.TrimSpace(body) == "":
+		Error(w, http.StatusBadRequest, "body is required")
+		return
+	case len(body) > maxSnippetLength:
+		Error(w, http.StatusBadRequest, "body too long")
+		return
+	case strings.Count(body, "\n") >= maxSnippetLines:
+		Error(w, http.StatusBadRequest, fmt.Sprintf("body must have at most %d lines", maxSnippetLines))
+		return
+	case hasControl(body, "\n"):
+		Error(w, http.StatusBadRequest, "body must not contain control characters")
+		return
+	case len(description) > maxSnippetDescription:
+		Error(w, http.StatusBadRequest, "description too long")
+		return
+	case hasControl(description, ""):
+		Error(w, http.StatusBadRequest, "description must not contain control characters")
+		return
+	}
+
+	existing, err := h.repo.ListSnippets(r.Context(), userID)
+	if err != nil {
+		slog.Error("Failed to list snippets", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to save snippet")
+		return
+	}
+	if len(existing) >= maxSnippetsPerUser && findSnippet(existing, name) == nil {
+		Error(w, http.StatusConflict, "snippet_limit_reached")
+		return
+	}
+
+	snippet := &domain.Snippet{
+		UserID:      userID,
+		Name:        name,
+		Description: description,
+		Body:        body,
+		UpdatedAt:   time.Now().UTC(),
+	}
+	if err := h.repo.UpsertSnippet(r.Context(), snippet); err != nil {
+		slog.Error("Failed to store snippet", "error", err, "user_id", userID, "snippet", name)
+		Error(w, http.StatusInternalServerError, "failed to save snippet")
+		return
+	}
+	JSON(w, http.StatusOK, newSnippetView(snippet))
+}
+
+// DeleteSnippet handles DELETE /api/terminal/snippets/{name}.
+func (h *TerminalRunHandler) DeleteSnippet(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	if userID == "" {
+		Error(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	deleted, err := h.repo.DeleteSnippet(r.Context(), userID, chi.URLParam(r, "name"))
+	if err != nil {
+		slog.Error("Failed to delete snippet", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to delete snippet")
+		return
+	}
+	if !deleted {
+		Error(w, http.StatusNotFound, "snippet not found")
+		return
+	}
+	JSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// InsertSnippet handles POST /api/terminal/snippets/{name}/insert. It fills
+// in the snippet's placeholders from values and types the result into the
+// calling tab's terminal like /api/terminal/run, so it is monitored and
+// audit-logged the same way. As when pasting, every line but the last is
+// entered; the last is entered only if execute is set. Snippets are written
+// by the learner, so no confirmation is required.
+func (h *TerminalRunHandler) InsertSnippet(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	sessionID := identity.SessionIDFromContext(r.Context())
+	if userID == "" {
+		Error(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	name := chi.URLParam(r, "name")
+
+	r.Body = http.MaxBytesReader(w, r.Body, 16*1024)
+	var req insertSnippetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	snippets, err := h.repo.ListSnippets(r.Context(), userID)
+	if err != nil {
+		slog.Error("Failed to list snippets", "error", err, "user_id", userID)
+		Error(w, http.StatusInternalServerError, "failed to load snippet")
+		return
+	}
+	snippet := findSnippet(snippets, name)
+	if snippet == nil {
+		Error(w, http.StatusNotFound, "snippet not found")
+		return
+	}
+
+	audit := slog.With(
+		"audit", "terminal_run",
+		"user_id", userID,
+		"session_id", sessionID,
+		"request_id", chiMiddleware.GetReqID(r.Context()),
+		"source", "snippet",
+		"snippet", name,
+		"ip", identity.IPFromRequest(r),
+	)
+
+	for placeholder, value := range req.Values {
+		if hasControl(value, "") {
+			audit.Warn("Terminal run rejected", "reason", "invalid_value", "placeholder", placeholder)
+			Error(w, http.StatusBadRequest, fmt.Sprintf("value of %s must be a single line", placeholder))
+			return
+		}
+	}
+	text, err := snippet.Expand(req.Values)
+	if err != nil {
+		audit.Warn("Terminal run rejected", "reason", "missing_values")
+		Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	audit = audit.With("command", text)
+	lines := strings.Split(text, "\n")
+	for _, line := range lines {
+		if len(line) > maxRunCommandLength {
+			audit.Warn("Terminal run rejected", "reason", "command_too_long")
+			Error(w, http.StatusBadRequest, "snippet line too long")
+			return
+		}
+	}
+
+	if !h.typeLines(w, audit, userID, sessionID, lines, req.Execute) {
+		return
+	}
+
+	JSON(w, http.StatusAccepted, map[string]interface{}{
+		"status":  "typing",
+		"snippet": name,
+		"command": text,
+		"execute": req.Execute,
+	})
+}
+
+// findSnippet returns the snippet named name, or nil.
+func findSnippet(snippets []*domain.Snippet, name string) *domain.Snippet {
+	for _, s := range snippets {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// hasControl reports whether s contains control characters other than those
+// in allowed. Tabs count as control characters: typed into a shell they
+// trigger completion.
+func hasControl(s, allowed string) bool {
+	return strings.ContainsFunc(s, func(r rune) bool {
+		return unicode.IsControl(r) && !strings.ContainsRune(allowed, r)
+	})
+}
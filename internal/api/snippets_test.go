@@ -0,0 +1,133 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+	"github.com/go-chi/chi/v5"
+)
+
+func newSnippetRouter(repo *fakeRepo, sm *terminal.SessionManager) chi.Router {
+	h := NewTerminalRunHandler(NewHandler(repo, &fakeManager{}, sm, ""), terminal.NewPTYController(terminal.PTYConfig{}, nil))
+	r := chi.NewRouter()
+	r.Use(identity.Middleware(repo, true))
+	h.RegisterRoutes(r)
+	return r
+}
+
+func serveSnippet(r chi.Router, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.AddCookie(&http.Cookie{Name: identity.AnonCookieName, Value: provisionTestUser})
+	req.Header.Set(identity.SessionHeaderName, "tab-1")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestSnippetsCRUD(t *testing.T) {
+	repo := newFakeRepo()
+	r := newSnippetRouter(repo, terminal.NewSessionManager())
+
+	rr := serveSnippet(r, http.MethodPut, "/api/terminal/snippets/tarball",
+		`{"description":"Pack a directory","body":"tar czf {{archive:out.tgz}} {{dir}}\n"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("save: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = serveSnippet(r, http.MethodGet, "/api/terminal/snippets", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("list: expected 200, got %d", rr.Code)
+	}
+	var list struct {
+		Snippets []struct {
+			Name         string `json:"name"`
+			Body         string `json:"body"`
+			Placeholders []struct {
+				Name     string `json:"name"`
+				Default  string `json:"default"`
+				Required bool   `json:"required"`
+			} `json:"placeholders"`
+		} `json:"snippets"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&list); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if len(list.Snippets) != 1 || list.Snippets[0].Body != "tar czf {{archive:out.tgz}} {{dir}}" {
+		t.Fatalf("unexpected snippets: %+v", list.Snippets)
+	}
+	placeholders := list.Snippets[0].Placeholders
+	if len(placeholders) != 2 || placeholders[0].Name != "archive" || placeholders[0].Default != "out.tgz" || placeholders[0].Required ||
+		placeholders[1].Name != "dir" || !placeholders[1].Required {
+		t.Fatalf("unexpected placeholders: %+v", placeholders)
+	}
+
+	if rr := serveSnippet(r, http.MethodDelete, "/api/terminal/snippets/tarball", ""); rr.Code != http.StatusOK {
+		t.Fatalf("delete: expected 200, got %d", rr.Code)
+	}
+	if rr := serveSnippet(r, http.MethodDelete, "/api/terminal/snippets/tarball", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("second delete: expected 404, got %d", rr.Code)
+	}
+}
+
+func TestSaveSnippetValidation(t *testing.T) {
+	r := newSnippetRouter(newFakeRepo(), terminal.NewSessionManager())
+	for _, tc := range []struct {
+		name, path, body string
+	}{
+		{"bad name", "/api/terminal/snippets/Bad_Name", `{"body":"ls"}`},
+		{"empty body", "/api/terminal/snippets/empty", `{"body":" \n"}`},
+		{"tab", "/api/terminal/snippets/tab", `{"body":"ls\t-l"}`},
+		{"escape", "/api/terminal/snippets/esc", `{"body":"echo \u001b[2J"}`},
+		{"too many lines", "/api/terminal/snippets/long", `{"body":"` + strings.Repeat(`echo\n`, maxSnippetLines+1) + `"}`},
+	} {
+		if rr := serveSnippet(r, http.MethodPut, tc.path, tc.body); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", tc.name, rr.Code)
+		}
+	}
+}
+
+func TestInsertSnippetTypesExpandedLines(t *testing.T) {
+	repo := newFakeRepo()
+	sm := terminal.NewSessionManager()
+	r := newSnippetRouter(repo, sm)
+	input := &syncBuffer{}
+	sm.RegisterInput(provisionTestUser, "tab-1", input)
+
+	if rr := serveSnippet(r, http.MethodPut, "/api/terminal/snippets/greet",
+		`{"body":"cd {{dir:/tmp}}\necho {{greeting}}"}`); rr.Code != http.StatusOK {
+		t.Fatalf("save: expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if rr := serveSnippet(r, http.MethodPost, "/api/terminal/snippets/greet/insert", `{}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for missing value, got %d", rr.Code)
+	}
+	if rr := serveSnippet(r, http.MethodPost, "/api/terminal/snippets/greet/insert",
+		`{"values":{"greeting":"hi\nrm -rf /"}}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for multiline value, got %d", rr.Code)
+	}
+	if rr := serveSnippet(r, http.MethodPost, "/api/terminal/snippets/missing/insert", `{}`); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown snippet, got %d", rr.Code)
+	}
+
+	rr := serveSnippet(r, http.MethodPost, "/api/terminal/snippets/greet/insert", `{"values":{"greeting":"hello"}}`)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("insert: expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Every line but the last is entered; the last waits for the learner.
+	want := "cd /tmp\recho hello"
+	deadline := time.Now().Add(2 * time.Second)
+	for input.String() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %q typed, got %q", want, input.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	chiMiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+// previewLocks allows one preview per user at a time; each clones the
+// user's container.
+var previewLocks = newKeyedLocks[string]()
+
+// previewCommandRequest is the body of POST /api/terminal/preview.
+type previewCommandRequest struct {
+	Command string `json:"command"`
+	Source  string `json:"source,omitempty"`
+}
+
+// PreviewCommand handles POST /api/terminal/preview.
+// It runs a command, typically a destructive one the agent suggested, in a
+// disposable clone of the user's container and reports what it would do,
+// so the learner can decide before sending it to /api/terminal/run. The
+// command runs in the directory of the tab's last command.
+func (h *TerminalRunHandler) PreviewCommand(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	sessionID := identity.SessionIDFromContext(r.Context())
+	if userID == "" {
+		Error(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 16*1024)
+	var req previewCommandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	audit := slog.With(
+		"audit", "terminal_preview",
+		"user_id", userID,
+		"session_id", sessionID,
+		"request_id", chiMiddleware.GetReqID(r.Context()),
+		"command", req.Command,
+		"source", req.Source,
+		"ip", identity.IPFromRequest(r),
+	)
+
+	command := strings.TrimSpace(req.Command)
+	switch {
+	case command == "":
+		audit.Warn("Terminal preview rejected", "reason", "empty_command")
+		Error(w, http.StatusBadRequest, "command is required")
+		return
+	case len(command) > maxRunCommandLength:
+		audit.Warn("Terminal preview rejected", "reason", "command_too_long")
+		Error(w, http.StatusBadRequest, "command too long")
+		return
+	case strings.ContainsAny(command, "\r\n"):
+		audit.Warn("Terminal preview rejected", "reason", "multiline_command")
+		Error(w, http.StatusBadRequest, "command must be a single line")
+		return
+	}
+
+	previewer, ok := h.mgr.(container.CommandPreviewer)
+	if !ok {
+		Error(w, http.StatusNotImplemented, "preview_unsupported")
+		return
+	}
+	user, err := h.repo.GetUser(r.Context(), userID)
+	if err != nil || user == nil {
+		Error(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+	if user.ContainerID == "" {
+		Error(w, http.StatusConflict, "no active container")
+		return
+	}
+
+	lock, ok := previewLocks.tryLock(userID)
+	if !ok {
+		audit.Warn("Terminal preview rejected", "reason", "preview_in_progress")
+		Error(w, http.StatusConflict, "preview_in_progress")
+		return
+	}
+	defer previewLocks.release(userID, lock)
+	defer lock.Unlock()
+	if h.previews != nil && !h.previews.Allow(userID) {
+		audit.Warn("Terminal preview rejected", "reason", "rate_limited")
+		if reset := h.previews.Status(userID).ResetAt; !reset.IsZero() {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(reset).Seconds()))))
+		}
+		Error(w, http.StatusTooManyRequests, "preview_rate_limited")
+		return
+	}
+
+	var dir string
+	if cmds, err := h.repo.ListCommands(r.Context(), userID, sessionID, 1); err == nil && len(cmds) > 0 {
+		dir = cmds[0].PWD
+	}
+	preview, err := previewer.PreviewCommand(r.Context(), userID, user.ContainerID, command, dir)
+	if err != nil {
+		audit.Error("Terminal preview failed", "error", err, "container_id", user.ContainerID)
+		Error(w, http.StatusInternalServerError, "failed to preview command")
+		return
+	}
+	audit.Info("Terminal preview completed",
+		"exit_code", preview.ExitCode,
+		"timed_out", preview.TimedOut,
+		"removed", preview.RemovedCount,
+		"created", preview.CreatedCount)
+	JSON(w, http.StatusOK, preview)
+}
@@ -0,0 +1,125 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+	"github.com/go-chi/chi/v5"
+)
+
+// previewManager reports a fixed preview and records what it was asked.
+type previewManager struct {
+	fakeManager
+	preview      *container.CommandPreview
+	command, dir string
+	containerID  string
+}
+
+func (m *previewManager) PreviewCommand(_ context.Context, _, containerID, command, dir string) (*container.CommandPreview, error) {
+	m.containerID, m.command, m.dir = containerID, command, dir
+	return m.preview, nil
+}
+
+func TestPreviewCommand(t *testing.T) {
+	repo := newFakeRepo()
+	mgr := &previewManager{preview: &container.CommandPreview{
+		ExitCode:     0,
+		Removed:      []string{"/home/learner/work/notes.txt"},
+		RemovedCount: 1,
+		Created:      []string{},
+	}}
+	handler := NewTerminalRunHandler(NewHandler(repo, mgr, terminal.NewSessionManager(), ""), terminal.NewPTYController(terminal.PTYConfig{}, nil))
+	serve := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/terminal/preview", strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: identity.AnonCookieName, Value: provisionTestUser})
+		req.Header.Set(identity.SessionHeaderName, "tab-1")
+		rr := httptest.NewRecorder()
+		identity.Middleware(repo, true)(http.HandlerFunc(handler.PreviewCommand)).ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := serve(`{"command":"rm -rf *"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 without a container, got %d", rr.Code)
+	}
+	if err := repo.UpsertUser(t.Context(), &domain.User{UserID: provisionTestUser, ContainerID: "container-1"}); err != nil {
+		t.Fatalf("upsert user: %v", err)
+	}
+	if rr := serve(`{"command":"rm -rf *\nls"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for multiline command, got %d", rr.Code)
+	}
+	if rr := serve(`{"command":"  "}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for empty command, got %d", rr.Code)
+	}
+
+	if err := repo.InsertCommand(t.Context(), &domain.CommandRecord{UserID: provisionTestUser, SessionID: "tab-1", Command: "cd lab", PWD: "/home/learner/work/lab"}); err != nil {
+		t.Fatalf("insert command: %v", err)
+	}
+	rr := serve(`{"command":" rm -rf * ","source":"agent"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), `"removed":["/home/learner/work/notes.txt"],"removed_count":1,"created":[]`) {
+		t.Fatalf("unexpected preview %s", rr.Body.String())
+	}
+	if mgr.containerID != "container-1" || mgr.command != "rm -rf *" || mgr.dir != "/home/learner/work/lab" {
+		t.Fatalf("previewed %q in %q of %q", mgr.command, mgr.dir, mgr.containerID)
+	}
+}
+
+func TestPreviewCommandUnsupported(t *testing.T) {
+	repo := newFakeRepo()
+	handler := NewTerminalRunHandler(NewHandler(repo, &fakeManager{}, terminal.NewSessionManager(), ""), terminal.NewPTYController(terminal.PTYConfig{}, nil))
+	req := httptest.NewRequest(http.MethodPost, "/api/terminal/preview", strings.NewReader(`{"command":"rm -rf *"}`))
+	rr := httptest.NewRecorder()
+	identity.Middleware(repo, true)(http.HandlerFunc(handler.PreviewCommand)).ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotImplemented {
+		t.Fatalf("expected 501, got %d", rr.Code)
+	}
+}
+
+func TestPreviewCommandRateLimited(t *testing.T) {
+	repo := newFakeRepo()
+	if err := repo.UpsertUser(t.Context(), &domain.User{UserID: provisionTestUser, ContainerID: "container-1"}); err != nil {
+		t.Fatalf("upsert user: %v", err)
+	}
+	cfg := &config.Config{CommandPreview: true, RateLimit: config.RateLimitConfig{PreviewPerUser: 2, PreviewWindow: time.Minute}}
+	mgr := &previewManager{preview: &container.CommandPreview{Removed: []string{}, Created: []string{}}}
+	handler := NewTerminalRunHandler(NewHandler(repo, mgr, terminal.NewSessionManager(), ""), terminal.NewPTYController(terminal.PTYConfig{}, nil), WithConfig(cfg))
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodPost, "/api/terminal/preview", strings.NewReader(`{"command":"rm -rf *"}`))
+		req.AddCookie(&http.Cookie{Name: identity.AnonCookieName, Value: provisionTestUser})
+		rr := httptest.NewRecorder()
+		identity.Middleware(repo, true)(http.HandlerFunc(handler.PreviewCommand)).ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Fatalf("preview %d: expected %d, got %d", i+1, want, rr.Code)
+		}
+		if want == http.StatusTooManyRequests && rr.Header().Get("Retry-After") == "" {
+			t.Fatal("expected Retry-After on a rate limited preview")
+		}
+	}
+}
+
+func TestPreviewCommandRouteDisabled(t *testing.T) {
+	repo := newFakeRepo()
+	cfg := &config.Config{CommandPreview: false}
+	handler := NewTerminalRunHandler(NewHandler(repo, &previewManager{}, terminal.NewSessionManager(), ""), terminal.NewPTYController(terminal.PTYConfig{}, nil), WithConfig(cfg))
+	r := chi.NewRouter()
+	handler.RegisterRoutes(r)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/terminal/preview", strings.NewReader(`{"command":"rm -rf *"}`)))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 with command previews disabled, got %d", rr.Code)
+	}
+}
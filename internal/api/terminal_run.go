@@ -0,0 +1,237 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/agent"
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+	"github.com/go-chi/chi/v5"
+	chiMiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	// maxRunCommandLength bounds commands accepted by the run endpoint.
+	maxRunCommandLength = 1024
+	// runCommandTimeout bounds how long a single injected command may take to type.
+	runCommandTimeout = 2 * time.Minute
+)
+
+// runLocks prevents overlapping command injection into the same terminal session.
+var runLocks = newKeyedLocks[identity.SessionKey]()
+
+// keyedLocks hands out one mutex per key and forgets it once nobody holds
+// it, so the map does not grow with every session ever seen.
+type keyedLocks[K comparable] struct {
+	mu    sync.Mutex
+	locks map[K]*keyedLock
+}
+
+// keyedLock is the mutex of one key; refs is guarded by keyedLocks.mu.
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newKeyedLocks[K comparable]() *keyedLocks[K] {
+	return &keyedLocks[K]{locks: make(map[K]*keyedLock)}
+}
+
+// tryLock locks the mutex of key unless another caller holds it. On success
+// the caller must defer both lock.Unlock and release.
+func (l *keyedLocks[K]) tryLock(key K) (*keyedLock, bool) {
+	lock := l.acquire(key)
+	if !lock.TryLock() {
+		l.release(key, lock)
+		return nil, false
+	}
+	return lock, true
+}
+
+func (l *keyedLocks[K]) acquire(key K) *keyedLock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock := l.locks[key]
+	if lock == nil {
+		lock = &keyedLock{}
+		l.locks[key] = lock
+	}
+	lock.refs++
+	return lock
+}
+
+// release drops a reference taken by tryLock, forgetting the mutex of key
+// when it was the last.
+func (l *keyedLocks[K]) release(key K, lock *keyedLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, key)
+	}
+}
+
+// runCommandRequest is the body of POST /api/terminal/run.
+type runCommandRequest struct {
+	Command   string `json:"command"`
+	Confirmed bool   `json:"confirmed"`
+	Execute   *bool  `json:"execute,omitempty"`
+	Source    string `json:"source,omitempty"`
+}
+
+// TerminalRunHandler types confirmed commands into the user's active terminal.
+type TerminalRunHandler struct {
+	*Handler
+	pty      *terminal.PTYController
+	cfg      *config.Config
+	previews *agent.RateLimiter // nil unless previews are limited per user
+}
+
+// NewTerminalRunHandler creates a handler that injects commands via the given
+// PTY controller. WithConfig sets whether command previews are served and how
+// often each user may run one.
+func NewTerminalRunHandler(base *Handler, pty *terminal.PTYController, opts ...Option) *TerminalRunHandler {
+	o := applyOptions(opts)
+	h := &TerminalRunHandler{Handler: base, pty: pty, cfg: o.cfg}
+	if o.cfg != nil && o.cfg.RateLimit.PreviewPerUser > 0 {
+		h.previews = agent.NewRateLimiter(o.cfg.RateLimit.PreviewPerUser, o.cfg.RateLimit.PreviewWindow)
+	}
+	return h
+}
+
+// RegisterRoutes registers terminal run routes. Previews commit and clone the
+// user's container, so they are left out when command previews are disabled.
+func (h *TerminalRunHandler) RegisterRoutes(r chi.Router) {
+	r.Post("/api/terminal/run", h.RunCommand)
+	if h.cfg == nil || h.cfg.CommandPreview {
+		r.Post("/api/terminal/preview", h.PreviewCommand)
+	}
+	r.Get("/api/terminal/snippets", h.ListSnippets)
+	r.Put("/api/terminal/snippets/{name}", h.SaveSnippet)
+	r.Delete("/api/terminal/snippets/{name}", h.DeleteSnippet)
+	r.Post("/api/terminal/snippets/{name}/insert", h.InsertSnippet)
+}
+
+// RunCommand handles POST /api/terminal/run.
+// The frontend must set confirmed=true after the learner explicitly approves
+// the command; every request is audit-logged whether or not it is accepted.
+func (h *TerminalRunHandler) RunCommand(w http.ResponseWriter, r *http.Request) {
+	userID := identity.UserIDFromContext(r.Context())
+	sessionID := identity.SessionIDFromContext(r.Context())
+	reqID := chiMiddleware.GetReqID(r.Context())
+	if userID == "" {
+		Error(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 16*1024)
+	var req runCommandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	audit := slog.With(
+		"audit", "terminal_run",
+		"user_id", userID,
+		"session_id", sessionID,
+		"request_id", reqID,
+		"command", req.Command,
+		"source", req.Source,
+		"ip", identity.IPFromRequest(r),
+	)
+
+	command := strings.TrimSpace(req.Command)
+	switch {
+	case command == "":
+		audit.Warn("Terminal run rejected", "reason", "empty_command")
+		Error(w, http.StatusBadRequest, "command is required")
+		return
+	case len(command) > maxRunCommandLength:
+		audit.Warn("Terminal run rejected", "reason", "command_too_long")
+		Error(w, http.StatusBadRequest, "command too long")
+		return
+	case strings.ContainsAny(command, "\r\n"):
+		audit.Warn("Terminal run rejected", "reason", "multiline_command")
+		Error(w, http.StatusBadRequest, "command must be a single line")
+		return
+	case !req.Confirmed:
+		audit.Warn("Terminal run rejected", "reason", "confirmation_required")
+		Error(w, http.StatusPreconditionRequired, "confirmation_required")
+		return
+	}
+
+	execute := true
+	if req.Execute != nil {
+		execute = *req.Execute
+	}
+	if !h.typeLines(w, audit, userID, sessionID, []string{command}, execute) {
+		return
+	}
+
+	JSON(w, http.StatusAccepted, map[string]interface{}{
+		"status":  "typing",
+		"command": command,
+		"execute": execute,
+	})
+}
+
+// typeLines types lines into the terminal of the given tab in the
+// background, pressing Enter after every line but the last, which is only
+// entered if execute is set. Each line has runCommandTimeout to be typed.
+// It writes an error response and returns false if the tab has no terminal
+// or another injection into it is still typing.
+func (h *TerminalRunHandler) typeLines(w http.ResponseWriter, audit *slog.Logger, userID, sessionID string, lines []string, execute bool) bool {
+	input := h.sm.InputWriter(userID, sessionID)
+	if input == nil {
+		audit.Warn("Terminal run rejected", "reason", "no_active_terminal")
+		Error(w, http.StatusConflict, "no_active_terminal")
+		return false
+	}
+
+	lockKey := identity.NewSessionKey(userID, sessionID)
+	lock, ok := runLocks.tryLock(lockKey)
+	if !ok {
+		audit.Warn("Terminal run rejected", "reason", "run_in_progress")
+		Error(w, http.StatusConflict, "run_in_progress")
+		return false
+	}
+
+	audit.Info("Terminal run accepted", "execute", execute)
+
+	go func() {
+		defer runLocks.release(lockKey, lock)
+		defer lock.Unlock()
+
+		var typed int
+		var elapsed time.Duration
+		var executed bool
+		for i, line := range lines {
+			ctx, cancel := context.WithTimeout(context.Background(), runCommandTimeout)
+			result := h.pty.TypeCommand(ctx, input, line, execute || i < len(lines)-1)
+			cancel()
+			typed += result.CharactersTyped
+			elapsed += result.Duration
+			executed = result.Executed
+			if result.Error != nil {
+				audit.Error("Terminal run failed",
+					"error", result.Error,
+					"characters_typed", typed,
+					"duration_ms", elapsed.Milliseconds())
+				return
+			}
+		}
+		audit.Info("Terminal run completed",
+			"executed", executed,
+			"characters_typed", typed,
+			"duration_ms", elapsed.Milliseconds())
+	}()
+	return true
+}
@@ -0,0 +1,118 @@
+//nolint:revive // "api" package name is intentionally concise for this layer.
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func doRunRequest(t *testing.T, handler *TerminalRunHandler, repo *fakeRepo, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/terminal/run", strings.NewReader(body))
+	req.Header.Set(identity.SessionHeaderName, "tab-1")
+	rr := httptest.NewRecorder()
+	identity.Middleware(repo, true)(http.HandlerFunc(handler.RunCommand)).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestRunCommandRequiresConfirmationAndActiveTerminal(t *testing.T) {
+	repo := newFakeRepo()
+	sm := terminal.NewSessionManager()
+	handler := NewTerminalRunHandler(NewHandler(repo, &fakeManager{}, sm, ""), terminal.NewPTYController(terminal.PTYConfig{}, nil))
+
+	if rr := doRunRequest(t, handler, repo, `{"command":"ls"}`); rr.Code != http.StatusPreconditionRequired {
+		t.Fatalf("expected 428 without confirmation, got %d", rr.Code)
+	}
+	if rr := doRunRequest(t, handler, repo, `{"command":"ls","confirmed":true}`); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 without active terminal, got %d", rr.Code)
+	}
+	if rr := doRunRequest(t, handler, repo, `{"command":"ls\nrm -rf /","confirmed":true}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for multiline command, got %d", rr.Code)
+	}
+}
+
+func TestRunCommandTypesIntoActiveTerminal(t *testing.T) {
+	repo := newFakeRepo()
+	sm := terminal.NewSessionManager()
+	handler := NewTerminalRunHandler(NewHandler(repo, &fakeManager{}, sm, ""), terminal.NewPTYController(terminal.PTYConfig{}, nil))
+
+	// The identity middleware mints a fresh anonymous user, so register the
+	// input writer from inside the request chain.
+	input := &syncBuffer{}
+	req := httptest.NewRequest(http.MethodPost, "/api/terminal/run", strings.NewReader(`{"command":"chmod +x run.sh","confirmed":true}`))
+	req.Header.Set(identity.SessionHeaderName, "tab-1")
+	rr := httptest.NewRecorder()
+	identity.Middleware(repo, true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sm.RegisterInput(identity.UserIDFromContext(r.Context()), "tab-1", input)
+		handler.RunCommand(w, r)
+	})).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for input.String() != "chmod +x run.sh\r" {
+		if time.Now().After(deadline) {
+			t.Fatalf("command not typed, got %q", input.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestKeyedLocksAllowOneHolder(t *testing.T) {
+	locks := newKeyedLocks[string]()
+	var held, overlaps atomic.Int32
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				lock, ok := locks.tryLock("tab-1")
+				if !ok {
+					continue
+				}
+				if held.Add(1) > 1 {
+					overlaps.Add(1)
+				}
+				held.Add(-1)
+				lock.Unlock()
+				locks.release("tab-1", lock)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := overlaps.Load(); n > 0 {
+		t.Fatalf("lock was held %d times by two callers", n)
+	}
+	if n := len(locks.locks); n != 0 {
+		t.Fatalf("%d locks left after every holder released", n)
+	}
+}
@@ -0,0 +1,195 @@
+package broker
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/proto/broker"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeBackend echoes input back through a pipe and records resizes. It
+// manages every container except those listed in foreign.
+type fakeBackend struct {
+	mu      sync.Mutex
+	resizes []*broker.ResizeRequest
+	opts    container.TerminalOptions
+	foreign map[string]bool
+	opened  int
+}
+
+func (f *fakeBackend) IsManagedContainer(_ context.Context, containerID string) (bool, error) {
+	return !f.foreign[containerID], nil
+}
+
+func (f *fakeBackend) CreateExecSession(_ context.Context, containerID string) (string, io.ReadWriteCloser, error) {
+	f.mu.Lock()
+	f.opened++
+	f.mu.Unlock()
+	local, remote := net.Pipe()
+	go func() {
+		_, _ = io.Copy(remote, remote)
+	}()
+	return "exec-" + containerID, local, nil
+}
+
+func (f *fakeBackend) CreateTerminalExecSession(ctx context.Context, containerID string, opts container.TerminalOptions) (string, io.ReadWriteCloser, error) {
+	f.mu.Lock()
+	f.opts = opts
+	f.mu.Unlock()
+	return f.CreateExecSession(ctx, containerID)
+}
+
+func (f *fakeBackend) ResizeExecSession(_ context.Context, execID string, cols, rows uint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.resizes = append(f.resizes, &broker.ResizeRequest{ExecId: execID, Cols: uint32(cols), Rows: uint32(rows)})
+	return nil
+}
+
+func startBroker(t *testing.T, backend ExecBackend, serverToken, clientToken string) *Client {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := NewServer(backend, serverToken)
+	gs := grpc.NewServer(srv.ServerOptions()...)
+	srv.Register(gs)
+	go func() { _ = gs.Serve(lis) }()
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial broker: %v", err)
+	}
+	client := newClientWithConn(conn, clientToken)
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestBrokerAttachRoundTrip(t *testing.T) {
+	backend := &fakeBackend{}
+	client := startBroker(t, backend, "secret", "secret")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	execID, exec, err := client.CreateExecSession(ctx, "c1")
+	if err != nil {
+		t.Fatalf("create exec session: %v", err)
+	}
+	defer func() { _ = exec.Close() }()
+	if execID != "exec-c1" {
+		t.Fatalf("expected exec-c1, got %q", execID)
+	}
+
+	if _, err := exec.Write([]byte("echo hi\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf := make([]byte, len("echo hi\n"))
+	if _, err := io.ReadFull(exec, buf); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(buf) != "echo hi\n" {
+		t.Fatalf("expected echoed input, got %q", buf)
+	}
+
+	if err := client.ResizeExecSession(ctx, execID, 120, 40); err != nil {
+		t.Fatalf("resize: %v", err)
+	}
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	want := &broker.ResizeRequest{ExecId: "exec-c1", Cols: 120, Rows: 40}
+	if len(backend.resizes) != 1 || !proto.Equal(backend.resizes[0], want) {
+		t.Fatalf("unexpected resizes: %+v", backend.resizes)
+	}
+}
+
+func TestBrokerPassesTerminalOptions(t *testing.T) {
+	backend := &fakeBackend{}
+	client := startBroker(t, backend, "", "")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	want := container.TerminalOptions{Term: "xterm-256color", ColorTerm: "truecolor", Cols: 132, Rows: 43}
+	_, exec, err := client.CreateTerminalExecSession(ctx, "c1", want)
+	if err != nil {
+		t.Fatalf("create exec session: %v", err)
+	}
+	defer func() { _ = exec.Close() }()
+
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if backend.opts != want {
+		t.Fatalf("expected %+v, got %+v", want, backend.opts)
+	}
+}
+
+func TestBrokerRejectsBadToken(t *testing.T) {
+	client := startBroker(t, &fakeBackend{}, "secret", "wrong")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, _, err := client.CreateExecSession(ctx, "c1"); err == nil {
+		t.Fatal("expected attach with a bad token to fail")
+	}
+	if err := client.ResizeExecSession(ctx, "exec-c1", 80, 24); err == nil {
+		t.Fatal("expected resize with a bad token to fail")
+	}
+}
+
+func TestBrokerRejectsUnmanagedContainer(t *testing.T) {
+	backend := &fakeBackend{foreign: map[string]bool{"other": true}}
+	client := startBroker(t, backend, "", "")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, _, err := client.CreateExecSession(ctx, "other")
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied, got %v", err)
+	}
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if backend.opened != 0 {
+		t.Fatalf("expected no exec session, %d opened", backend.opened)
+	}
+}
+
+func TestCheckListen(t *testing.T) {
+	withTLS := TLSConfig{CertFile: "broker.crt", KeyFile: "broker.key"}
+	withMTLS := TLSConfig{CertFile: "broker.crt", KeyFile: "broker.key", CAFile: "ca.crt"}
+	tests := []struct {
+		addr, token string
+		tls         TLSConfig
+		ok          bool
+	}{
+		{"127.0.0.1:50061", "", TLSConfig{}, true},
+		{"[::1]:50061", "", TLSConfig{}, true},
+		{"localhost:50061", "", TLSConfig{}, true},
+		{":50061", "", TLSConfig{}, false},
+		{"0.0.0.0:50061", "", TLSConfig{}, false},
+		{"10.0.0.5:50061", "", TLSConfig{}, false},
+		{":50061", "secret", TLSConfig{}, false},
+		{":50061", "", withTLS, false},
+		{":50061", "secret", withTLS, true},
+		{":50061", "", withMTLS, true},
+		{":50061", "secret", TLSConfig{CAFile: "ca.crt"}, false},
+	}
+	for _, tt := range tests {
+		if err := CheckListen(tt.addr, tt.token, tt.tls); (err == nil) != tt.ok {
+			t.Errorf("CheckListen(%q, %q, %+v) = %v, want ok=%v", tt.addr, tt.token, tt.tls, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/proto/broker"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// Client attaches to exec sessions through a remote broker. It implements the
+// exec subset of container.Manager so the terminal WebSocket handler can use
+// it in place of a local Docker manager.
+type Client struct {
+	conn   *grpc.ClientConn
+	client broker.TerminalBrokerClient
+	token  string
+}
+
+// ClientOption configures optional Client settings.
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	tls TLSConfig
+}
+
+// WithTLS dials the broker over TLS; without it the connection is plaintext.
+func WithTLS(cfg TLSConfig) ClientOption {
+	return func(o *clientOptions) { o.tls = cfg }
+}
+
+// NewClient creates a broker client for addr (host:port). The connection is
+// established lazily on first use.
+func NewClient(addr, token string, opts ...ClientOption) (*Client, error) {
+	var o clientOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	creds := insecure.NewCredentials()
+	if o.tls.Enabled() {
+		var err error
+		if creds, err = o.tls.ClientCredentials(); err != nil {
+			return nil, fmt.Errorf("create broker client for %s: %w", addr, err)
+		}
+	}
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("create broker client for %s: %w", addr, err)
+	}
+	return newClientWithConn(conn, token), nil
+}
+
+func newClientWithConn(conn *grpc.ClientConn, token string) *Client {
+	return &Client{conn: conn, client: broker.NewTerminalBrokerClient(conn), token: token}
+}
+
+// Close closes the broker connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) outgoing(ctx context.Context) context.Context {
+	if c.token == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, authMetadata, bearerPrefix+c.token)
+}
+
+// CreateExecSession opens a shell in the container via the broker. The
+// returned stream stays attached until closed or ctx is canceled.
+func (c *Client) CreateExecSession(ctx context.Context, containerID string) (string, io.ReadWriteCloser, error) {
+	return c.CreateTerminalExecSession(ctx, containerID, container.TerminalOptions{})
+}
+
+// CreateTerminalExecSession opens a shell for the client terminal described
+// by opts via the broker.
+func (c *Client) CreateTerminalExecSession(ctx context.Context, containerID string, opts container.TerminalOptions) (string, io.ReadWriteCloser, error) {
+	streamCtx, cancel := context.WithCancel(c.outgoing(ctx))
+	stream, err := c.client.Attach(streamCtx)
+	if err != nil {
+		cancel()
+		return "", nil, fmt.Errorf("open broker stream: %w", err)
+	}
+
+	open := &broker.AttachFrame{Open: &broker.OpenExec{
+		ContainerId: containerID,
+		UserId:      identity.UserIDFromContext(ctx),
+		SessionId:   identity.SessionIDFromContext(ctx),
+		Term:        opts.Term,
+		Colorterm:   opts.ColorTerm,
+		Cols:        uint32(opts.Cols),
+		Rows:        uint32(opts.Rows),
+	}}
+	if err := stream.Send(open); err != nil {
+		cancel()
+		return "", nil, fmt.Errorf("send broker open frame: %w", err)
+	}
+
+	first, err := stream.Recv()
+	if err != nil {
+		cancel()
+		return "", nil, fmt.Errorf("attach via broker: %w", err)
+	}
+	return first.GetExecId(), &remoteExec{stream: stream, cancel: cancel}, nil
+}
+
+// ResizeExecSession resizes an exec session owned by the broker.
+func (c *Client) ResizeExecSession(ctx context.Context, execID string, cols, rows uint) error {
+	req := &broker.ResizeRequest{ExecId: execID, Cols: uint32(cols), Rows: uint32(rows)}
+	if _, err := c.client.Resize(c.outgoing(ctx), req); err != nil {
+		return fmt.Errorf("resize exec session %s via broker: %w", execID, err)
+	}
+	return nil
+}
+
+// remoteExec adapts an Attach stream to io.ReadWriteCloser.
+type remoteExec struct {
+	stream  broker.TerminalBroker_AttachClient
+	cancel  context.CancelFunc
+	pending []byte
+
+	sendMu    sync.Mutex
+	closeOnce sync.Once
+}
+
+func (r *remoteExec) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		frame, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.pending = frame.GetData()
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *remoteExec) Write(p []byte) (int, error) {
+	r.sendMu.Lock()
+	defer r.sendMu.Unlock()
+	if err := r.stream.Send(&broker.AttachFrame{Data: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (r *remoteExec) Close() error {
+	var err error
+	r.closeOnce.Do(func() {
+		err = r.closeSend()
+		r.cancel()
+	})
+	return err
+}
+
+func (r *remoteExec) closeSend() error {
+	r.sendMu.Lock()
+	defer r.sendMu.Unlock()
+	return r.stream.CloseSend()
+}
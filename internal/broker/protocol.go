@@ -0,0 +1,23 @@
+// Package broker implements the terminal broker: a small gRPC service,
+// colocated with a Docker host, that owns exec attachment so the API/SSE tier
+// can scale separately and hold no Docker exec streams itself.
+//
+// The protocol is the shsh.broker.v1.TerminalBroker service defined in
+// internal/proto/broker/broker.proto:
+//
+//	rpc Attach(stream AttachFrame) returns (stream ExecFrame)
+//	rpc Resize(ResizeRequest) returns (ResizeResponse)
+//
+// The first AttachFrame must carry Open; the broker replies with an ExecFrame
+// carrying the exec ID, then both sides exchange Data until either closes.
+// Open is refused for containers not labeled as managed by the broker's
+// instance (SHSH_INSTANCE_ID). Resize is unary so the API tier can resize by exec ID without tracking
+// streams. When a token is configured, every call must send it as
+// "authorization: Bearer <token>" metadata.
+package broker
+
+const (
+	authMetadata  = "authorization"
+	bearerPrefix  = "Bearer "
+	readChunkSize = 32 * 1024
+)
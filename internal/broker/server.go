@@ -0,0 +1,231 @@
+package broker
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/proto/broker"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ExecBackend creates and resizes exec sessions in the containers it manages;
+// container.DockerManager satisfies it.
+type ExecBackend interface {
+	IsManagedContainer(ctx context.Context, containerID string) (bool, error)
+	CreateExecSession(ctx context.Context, containerID string) (string, io.ReadWriteCloser, error)
+	ResizeExecSession(ctx context.Context, execID string, cols, rows uint) error
+}
+
+// Server serves the terminal broker protocol on top of an ExecBackend.
+type Server struct {
+	broker.UnimplementedTerminalBrokerServer
+
+	backend ExecBackend
+	token   string
+}
+
+var (
+	// errUnmanagedContainer is returned for an Open frame naming a container
+	// this instance did not create.
+	errUnmanagedContainer = status.Error(codes.PermissionDenied, "container is not managed by this instance")
+	// errNoTLS is returned by CheckListen for a broker reachable from other
+	// hosts over plaintext.
+	errNoTLS = errors.New("SHSH_BROKER_TLS_CERT and SHSH_BROKER_TLS_KEY are required unless the broker listens on loopback")
+	// errNoToken is returned by CheckListen for a broker reachable from other
+	// hosts that authenticates neither a token nor client certificates.
+	errNoToken = errors.New("SHSH_BROKER_TOKEN or SHSH_BROKER_TLS_CA is required unless the broker listens on loopback")
+)
+
+// CheckListen refuses to serve on a non-loopback addr without TLS, or without
+// a token or client certificates to authenticate callers: the broker opens
+// shells in containers on request and carries their keystrokes.
+func CheckListen(addr, token string, tlsConfig TLSConfig) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("broker listen address %q: %w", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	if tlsConfig.CertFile == "" || tlsConfig.KeyFile == "" {
+		return errNoTLS
+	}
+	if token == "" && tlsConfig.CAFile == "" {
+		return errNoToken
+	}
+	return nil
+}
+
+// NewServer creates a broker server. An empty token disables token
+// authentication, which CheckListen only allows on loopback or with client
+// certificates.
+func NewServer(backend ExecBackend, token string) *Server {
+	return &Server{backend: backend, token: token}
+}
+
+// Register registers the broker service on a gRPC server.
+func (s *Server) Register(gs *grpc.Server) {
+	broker.RegisterTerminalBrokerServer(gs, s)
+}
+
+// ServerOptions returns the interceptors enforcing token authentication.
+func (s *Server) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := s.authorize(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := s.authorize(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}
+}
+
+func (s *Server) authorize(ctx context.Context) error {
+	if s.token == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get(authMetadata) {
+		token := strings.TrimPrefix(value, bearerPrefix)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid broker token")
+}
+
+// createExec starts the shell an Open frame asks for, matching the client
+// terminal when the backend supports it. Only containers the backend manages
+// for this instance are accepted, so a caller cannot open a shell in any other
+// container on the host.
+func (s *Server) createExec(ctx context.Context, open *broker.OpenExec) (string, io.ReadWriteCloser, error) {
+	managed, err := s.backend.IsManagedContainer(ctx, open.GetContainerId())
+	if err != nil {
+		return "", nil, status.Errorf(codes.NotFound, "inspect container: %v", err)
+	}
+	if !managed {
+		return "", nil, errUnmanagedContainer
+	}
+	opts := container.TerminalOptions{
+		Term:      open.GetTerm(),
+		ColorTerm: open.GetColorterm(),
+		Cols:      uint(open.GetCols()),
+		Rows:      uint(open.GetRows()),
+	}
+	if creator, ok := s.backend.(container.TerminalExecCreator); ok && opts != (container.TerminalOptions{}) {
+		return creator.CreateTerminalExecSession(ctx, open.GetContainerId(), opts)
+	}
+	return s.backend.CreateExecSession(ctx, open.GetContainerId())
+}
+
+// Attach bridges one exec session to an Attach stream.
+func (s *Server) Attach(stream broker.TerminalBroker_AttachServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	open := first.GetOpen()
+	if open.GetContainerId() == "" {
+		return status.Error(codes.InvalidArgument, "first frame must open an exec session")
+	}
+
+	execID, exec, err := s.createExec(stream.Context(), open)
+	if err != nil {
+		slog.Error("Broker failed to create exec session",
+			"container_id", open.GetContainerId(),
+			"user_id", open.GetUserId(),
+			"error", err)
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return status.Errorf(codes.Unavailable, "create exec session: %v", err)
+	}
+	defer func() {
+		if closeErr := exec.Close(); closeErr != nil {
+			slog.Debug("Broker failed to close exec stream", "exec_id", execID, "error", closeErr)
+		}
+	}()
+
+	if err := stream.Send(&broker.ExecFrame{ExecId: execID}); err != nil {
+		return err
+	}
+	slog.Info("Broker attached exec session",
+		"exec_id", execID,
+		"container_id", open.GetContainerId(),
+		"user_id", open.GetUserId(),
+		"session_id", open.GetSessionId())
+
+	done := make(chan error, 2)
+	go func() {
+		buf := make([]byte, readChunkSize)
+		for {
+			n, err := exec.Read(buf)
+			if n > 0 {
+				if sendErr := stream.Send(&broker.ExecFrame{Data: buf[:n]}); sendErr != nil {
+					done <- sendErr
+					return
+				}
+			}
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					err = nil
+				}
+				done <- err
+				return
+			}
+		}
+	}()
+	go func() {
+		for {
+			frame, err := stream.Recv()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					err = nil
+				}
+				done <- err
+				return
+			}
+			if len(frame.GetData()) == 0 {
+				continue
+			}
+			if _, err := exec.Write(frame.GetData()); err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+
+	err = <-done
+	slog.Info("Broker detached exec session", "exec_id", execID, "error", err)
+	return err
+}
+
+// Resize resizes an exec session started by Attach.
+func (s *Server) Resize(ctx context.Context, req *broker.ResizeRequest) (*broker.ResizeResponse, error) {
+	if req.GetExecId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "exec_id is required")
+	}
+	if err := s.backend.ResizeExecSession(ctx, req.GetExecId(), uint(req.GetCols()), uint(req.GetRows())); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "resize exec session: %v", err)
+	}
+	return &broker.ResizeResponse{}, nil
+}
@@ -0,0 +1,87 @@
+package broker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc/credentials"
+)
+
+var (
+	errNoServerCert = errors.New("broker TLS needs both a certificate and a key")
+	errInvalidCA    = errors.New("broker TLS CA file holds no PEM certificates")
+)
+
+// TLSConfig names the PEM files securing the connection between the API tier
+// and the broker. On the broker, CertFile and KeyFile are its serving
+// certificate and CAFile, when set, verifies client certificates. On the API
+// tier, CAFile verifies the broker (system roots when empty) and CertFile and
+// KeyFile, when set, are presented as the client certificate.
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+}
+
+// Enabled reports whether any TLS setting is configured.
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != "" || c.CAFile != ""
+}
+
+// ServerCredentials returns the broker's transport credentials, requiring
+// client certificates signed by CAFile when it is set.
+func (c TLSConfig) ServerCredentials() (credentials.TransportCredentials, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, errNoServerCert
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load broker certificate: %w", err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if c.CAFile != "" {
+		pool, err := loadCertPool(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return credentials.NewTLS(cfg), nil
+}
+
+// ClientCredentials returns the API tier's transport credentials for dialing
+// the broker.
+func (c TLSConfig) ClientCredentials() (credentials.TransportCredentials, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.CAFile != "" {
+		pool, err := loadCertPool(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load broker client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return credentials.NewTLS(cfg), nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read broker TLS CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errInvalidCA
+	}
+	return pool, nil
+}
@@ -0,0 +1,160 @@
+package broker
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testPKI holds PEM files of a CA and a broker and client certificate it signed.
+type testPKI struct {
+	caFile, brokerCert, brokerKey, clientCert, clientKey string
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	t.Helper()
+	dir := t.TempDir()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate CA key: %v", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("create CA certificate: %v", err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatalf("parse CA certificate: %v", err)
+	}
+
+	issue := func(name string, serial int64, usage x509.ExtKeyUsage) (string, string) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("generate %s key: %v", name, err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			DNSNames:     []string{name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatalf("create %s certificate: %v", name, err)
+		}
+		keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatalf("marshal %s key: %v", name, err)
+		}
+		return writePEM(t, dir, name+".crt", "CERTIFICATE", der), writePEM(t, dir, name+".key", "PRIVATE KEY", keyDER)
+	}
+
+	pki := testPKI{caFile: writePEM(t, dir, "ca.crt", "CERTIFICATE", caDER)}
+	pki.brokerCert, pki.brokerKey = issue("bufnet", 2, x509.ExtKeyUsageServerAuth)
+	pki.clientCert, pki.clientKey = issue("api", 3, x509.ExtKeyUsageClientAuth)
+	return pki
+}
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+// startTLSBroker serves the broker over TLS and dials it with creds.
+func startTLSBroker(t *testing.T, serverTLS TLSConfig, creds credentials.TransportCredentials) *Client {
+	t.Helper()
+	serverCreds, err := serverTLS.ServerCredentials()
+	if err != nil {
+		t.Fatalf("server credentials: %v", err)
+	}
+	lis := bufconn.Listen(1 << 20)
+	srv := NewServer(&fakeBackend{}, "")
+	gs := grpc.NewServer(append(srv.ServerOptions(), grpc.Creds(serverCreds))...)
+	srv.Register(gs)
+	go func() { _ = gs.Serve(lis) }()
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(creds),
+	)
+	if err != nil {
+		t.Fatalf("dial broker: %v", err)
+	}
+	client := newClientWithConn(conn, "")
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestBrokerMutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	serverTLS := TLSConfig{CertFile: pki.brokerCert, KeyFile: pki.brokerKey, CAFile: pki.caFile}
+
+	tests := []struct {
+		name  string
+		creds func() (credentials.TransportCredentials, error)
+		ok    bool
+	}{
+		{"client certificate", TLSConfig{CertFile: pki.clientCert, KeyFile: pki.clientKey, CAFile: pki.caFile}.ClientCredentials, true},
+		{"no client certificate", TLSConfig{CAFile: pki.caFile}.ClientCredentials, false},
+		{"plaintext", func() (credentials.TransportCredentials, error) { return insecure.NewCredentials(), nil }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			creds, err := tt.creds()
+			if err != nil {
+				t.Fatalf("client credentials: %v", err)
+			}
+			client := startTLSBroker(t, serverTLS, creds)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, exec, err := client.CreateExecSession(ctx, "c1")
+			if (err == nil) != tt.ok {
+				t.Fatalf("CreateExecSession error = %v, want ok=%v", err, tt.ok)
+			}
+			if exec != nil {
+				_ = exec.Close()
+			}
+		})
+	}
+}
+
+func TestServerCredentialsNeedsKeyPair(t *testing.T) {
+	if _, err := (TLSConfig{CAFile: "ca.crt"}).ServerCredentials(); err == nil {
+		t.Fatal("expected server credentials without a certificate to fail")
+	}
+}
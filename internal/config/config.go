@@ -4,11 +4,25 @@
 // All timeouts and operational parameters are configurable.
 //
 // Configuration categories:
-//   - Timeouts: Container stop/create, health checks, cleanup, TTL worker
-//   - Resources: Memory limits, CPU quotas, PIDs limits
+//   - Timeouts: Container stop/create, pre-stop hooks, health checks, cleanup, TTL worker
+//   - Resources: Memory limits, CPU quotas, PIDs limits, resource tiers, health probes, orphan reaper
 //   - Rate Limiting: Request limits per time window
-//   - SSE: Server-Sent Events retry and keepalive settings
+//   - SSE: Server-Sent Events retry, keepalive, message size, chunking, and send buffer settings
+//   - Database: Storage driver (SQLite, PostgreSQL or Redis) and connection pooling
 //   - Retry: Database retry attempts and delays
+//   - Terminal: WebSocket terminal behavior (tab visibility, message size limits, output floods)
+//   - Affinity: Instance routing hints for load-balanced deployments
+//   - Broker: Terminal broker address and credentials for horizontal scaling
+//   - Admin: Operator API token and keep-warm limits
+//   - Curriculum: Git curriculum source checkouts and sync schedule
+//   - Usage: Metered usage records for billing hosted deployments
+//   - Capture: Opt-in network traffic capture for networking challenges
+//   - Sudo: Opt-in time-boxed root grants for administration challenges
+//   - Package proxy: Caching apt/pip proxy and the packages learners may install
+//   - AI budget: Agent error budget past which AI features degrade
+//   - Handoff: State a server shutting down leaves for the next one
+//   - Profile: SHSH_PROFILE=public switches to stricter defaults for an
+//     anonymous demo terminal embedded on a public page
 //
 // For a complete list of all environment variables, see .env.example
 package config
@@ -16,7 +30,10 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -25,9 +42,46 @@ import (
 var (
 	errEmptyPort                      = errors.New("PORT cannot be empty")
 	errEmptyDBPath                    = errors.New("DB_PATH cannot be empty")
+	errInvalidDBDriver                = errors.New("DB_DRIVER must be sqlite, postgres or redis")
+	errEmptyDatabaseURL               = errors.New("DATABASE_URL is required when DB_DRIVER=postgres")
+	errEmptyRedisURL                  = errors.New("REDIS_URL is required when DB_DRIVER=redis")
+	errEmptyInstanceID                = errors.New("SHSH_INSTANCE_ID cannot be empty")
 	errEmptyConversationLogDir        = errors.New("CONVERSATION_LOG_DIR cannot be empty")
 	errEmptyConversationLogGlobalPath = errors.New("CONVERSATION_LOG_GLOBAL_PATH cannot be empty")
 	errInvalidConversationLogQueue    = errors.New("CONVERSATION_LOG_QUEUE_SIZE must be > 0")
+	errInvalidDockerHost              = errors.New("SHSH_DOCKER_HOSTS entries must be name=endpoint[?capacity=N] with unique names")
+	errInvalidContainerImage          = errors.New("SHSH_CONTAINER_IMAGES entries must be name=image[?tier=name] with unique lowercase names")
+	errInvalidPrePullConcurrency      = errors.New("SHSH_IMAGE_PREPULL_CONCURRENCY must be >= 0")
+	errInvalidResourceTier            = errors.New("SHSH_CONTAINER_TIERS entries must be name=memory:cpus:pids with unique lowercase names and positive limits")
+	errUnknownResourceTier            = errors.New("SHSH_CONTAINER_DEFAULT_TIER and image tiers must name a tier of SHSH_CONTAINER_TIERS")
+	errInvalidWSMessageSize           = errors.New("SHSH_WS_MAX_MESSAGE_SIZE must be > 0")
+	errInvalidWSInputSize             = errors.New("SHSH_WS_MAX_INPUT_SIZE must be > 0 and <= SHSH_WS_MAX_MESSAGE_SIZE")
+	errEmptyTerminalE2EKey            = errors.New("SHSH_TERMINAL_E2E_SIGNING_KEY is required when SHSH_TERMINAL_E2E is set")
+	errInvalidClientErrorSampleRate   = errors.New("SHSH_CLIENT_ERROR_SAMPLE_RATE must be between 0 and 1")
+	errInvalidClientErrorMaxSize      = errors.New("SHSH_CLIENT_ERROR_MAX_SIZE must be > 0")
+	errInvalidShareTTL                = errors.New("SHSH_SHARE_TTL must be > 0 and <= SHSH_SHARE_MAX_TTL")
+	errInvalidFileMaxBytes            = errors.New("SHSH_FILE_MAX_BYTES must be > 0")
+	errInvalidCurriculumSync          = errors.New("SHSH_CURRICULUM_SYNC_TIMEOUT and SHSH_CURRICULUM_MAX_BUNDLE_SIZE must be > 0")
+	errInvalidUsageSink               = errors.New("SHSH_USAGE_SINK must be empty, file, webhook or stripe")
+	errInvalidUsageInterval           = errors.New("SHSH_USAGE_SAMPLE_INTERVAL must be > 0 and <= SHSH_USAGE_FLUSH_INTERVAL")
+	errEmptyUsageFile                 = errors.New("SHSH_USAGE_FILE is required when SHSH_USAGE_SINK=file")
+	errEmptyUsageWebhookURL           = errors.New("SHSH_USAGE_WEBHOOK_URL is required when SHSH_USAGE_SINK=webhook")
+	errIncompleteUsageStripe          = errors.New("SHSH_USAGE_STRIPE_KEY and SHSH_USAGE_STRIPE_CUSTOMERS are required when SHSH_USAGE_SINK=stripe")
+	errInvalidPausedTTL               = errors.New("SHSH_CONTAINER_PAUSED_TTL must be longer than SHSH_SESSION_TTL when SHSH_CONTAINER_PAUSE_ON_EXPIRY is set")
+	errInvalidCaptureLimits           = errors.New("SHSH_CAPTURE_MAX_BYTES, SHSH_CAPTURE_MAX_DURATION and SHSH_CAPTURE_SNAPLEN must be > 0")
+	errInvalidSudoDuration            = errors.New("SHSH_SUDO_MAX_DURATION must be > 0")
+	errPackageProxyBackend            = errors.New("SHSH_PKG_PROXY is only supported with CONTAINER_BACKEND=docker or podman")
+	errInvalidPackageProxy            = errors.New("SHSH_PKG_PROXY_IMAGE, SHSH_PKG_PROXY_CACHE_DIR, SHSH_PKG_PROXY_APT_HOSTS and SHSH_PKG_PROXY_PYPI_INDEX are required and SHSH_PKG_PROXY_MAX_CACHE_BYTES must be >= 0 when SHSH_PKG_PROXY is set")
+	errInvalidMaintenanceWindow       = errors.New("DB_MAINTENANCE_WINDOW must be empty or HH:MM-HH:MM")
+	errEncryptionKeyDriver            = errors.New("DB_ENCRYPTION_KEY is only supported with DB_DRIVER=sqlite")
+	errInvalidContainerBackend        = errors.New("CONTAINER_BACKEND must be docker, podman or kubernetes")
+	errInvalidEgressPolicy            = errors.New("SHSH_CONTAINER_EGRESS_POLICY must be full, deny or allowlist")
+	errInvalidEgressAllow             = errors.New("SHSH_CONTAINER_EGRESS_ALLOW must list domains, IPv4 addresses or CIDRs, and is required when SHSH_CONTAINER_EGRESS_POLICY=allowlist")
+	errKubernetesDockerHosts          = errors.New("SHSH_DOCKER_HOSTS cannot be used with CONTAINER_BACKEND=kubernetes")
+	errInvalidProfile                 = errors.New("SHSH_PROFILE must be standard or public")
+	errPodmanDockerHosts              = errors.New("SHSH_DOCKER_HOSTS cannot be used with CONTAINER_BACKEND=podman; list the podman sockets as docker hosts instead")
+	errInvalidHandoffMaxAge           = errors.New("SHSH_HANDOFF_MAX_AGE must be > 0 when SHSH_HANDOFF_FILE is set")
+	errInvalidAIBudget                = errors.New("SHSH_AI_BUDGET_WINDOW must be >= 0; when set, SHSH_AI_BUDGET_MIN_CALLS and SHSH_AI_BUDGET_RECOVER_AFTER must be > 0, SHSH_AI_BUDGET_SLOW_CALL and SHSH_AI_BUDGET_PROBE_INTERVAL > 0, and 0 < SHSH_AI_BUDGET_ERRORS_ONLY_RATE <= SHSH_AI_BUDGET_LOCAL_RATE <= 1")
 )
 
 // TimeoutConfig holds timeout-related configuration.
@@ -37,8 +91,32 @@ type TimeoutConfig struct {
 	HealthCheck       time.Duration // Health check DB timeout
 	DestroyCleanup    time.Duration // Background destroy timeout
 	TTLWorkerInterval time.Duration // TTL cleanup worker interval
+	PreStopHook       time.Duration // Default bound for container pre-stop hooks (0 disables hooks)
 }
 
+// Deployment profiles selectable with SHSH_PROFILE.
+const (
+	ProfileStandard = "standard"
+	// ProfilePublic is for a demo terminal embedded on a public page: shorter
+	// TTLs, tighter resource and rate limits by default, and egress denied,
+	// abuse detection on and the file API off regardless of other settings.
+	ProfilePublic = "public"
+)
+
+// Container backends selectable with CONTAINER_BACKEND.
+const (
+	ContainerBackendDocker     = "docker"
+	ContainerBackendPodman     = "podman"
+	ContainerBackendKubernetes = "kubernetes"
+)
+
+// Egress policies selectable with SHSH_CONTAINER_EGRESS_POLICY.
+const (
+	EgressFull      = "full"      // Containers reach any destination
+	EgressDeny      = "deny"      // Containers have no outbound network access
+	EgressAllowlist = "allowlist" // Containers reach only DNS and EgressAllow
+)
+
 // ContainerConfig holds container resource and retry configuration.
 type ContainerConfig struct {
 	MemoryLimitBytes    int64         // Memory limit in bytes (default: 512MB)
@@ -46,12 +124,79 @@ type ContainerConfig struct {
 	PidsLimit           int64         // PIDs limit (default: 256)
 	CreateRetryAttempts int           // Container create retry attempts (default: 20)
 	CreateRetryDelay    time.Duration // Delay between create retries (default: 250ms)
+	HealthInterval      time.Duration // Interval between container health probes (default: 30s, 0 disables)
+	HealthTimeout       time.Duration // Timeout for a single health probe (default: 5s)
+	HealthRetries       int           // Consecutive failed probes before a container is recycled (default: 3)
+	WatchdogInterval    time.Duration // Interval between sweeps for crashed or OOM-killed containers; Docker events are watched in between (default: 30s, 0 disables)
+	AutoRecreate        bool          // Provision a new container for users whose container crashed or was OOM-killed (default: false)
+	RuntimeFallback     bool          // Fall back to runc when ContainerRuntime is unavailable (default: false)
+	ReaperInterval      time.Duration // Interval between orphaned resource sweeps (default: 10m, 0 disables)
+	ReaperGracePeriod   time.Duration // Minimum resource age before it can be reaped (default: 10m)
+	Hosts               []DockerHost  // Docker hosts to schedule containers across; empty uses DOCKER_HOST (default: none)
+	HostCheckInterval   time.Duration // Interval between Docker host health checks (default: 15s)
+	QueueRetryInterval  time.Duration // Interval between provisioning attempts for users queued for capacity (default: 5s)
+	PrePullConcurrency  int           // Images pulled at once per Docker host when warming its image cache (default: 2, 0 disables)
+	AutoPauseDelay      time.Duration // Pause a container this long after its last terminal disconnects (default: 5m, 0 disables)
+	PauseOnExpiry       bool          // Pause containers of sessions idle past the TTL instead of removing them (default: false)
+	PausedTTL           time.Duration // Idle time after which a session paused on expiry is removed (default: 24h)
+	MaxLifetime         time.Duration // Container age past which terminal output and running commands no longer keep an idle session (default: 8h, public: 2h, 0 disables)
+
+	Backend      string           // "docker", "podman" or "kubernetes" (default: docker)
+	PodmanSocket string           // Podman API endpoint; empty uses CONTAINER_HOST or the rootless, then rootful socket (default: "")
+	Kubernetes   KubernetesConfig // Settings of the kubernetes backend
+	EgressPolicy string           // "full", "deny" or "allowlist" (default: deny if SHSH_CONTAINER_EGRESS_DENY is set, otherwise full; always deny in the public profile)
+	EgressAllow  []string         // Domains, IPs and CIDRs reachable under the allowlist policy (default: none)
+	EgressImage  string           // Image of the sidecar applying the allowlist; empty uses the playground image (default: "")
+	Images       []ContainerImage // Images learners may pick when provisioning; empty only offers the default image (default: none)
+	Tiers        []ResourceTier   // Named resource limits admins and images can assign (default: small, medium and large)
+	DefaultTier  string           // Tier of users without one; empty uses the memory, CPU and PIDs limits above (default: "")
+}
+
+// ContainerImage is an image learners may request by name on provision.
+type ContainerImage struct {
+	Name string // Name clients request, e.g. networking-lab
+	Ref  string // Image reference containers are created from, e.g. shsh/networking-lab:1
+	Tier string // Resource tier of containers of this image; empty uses the default tier
+}
+
+// ResourceTier is a named set of container resource limits.
+type ResourceTier struct {
+	Name             string // Name admins assign, e.g. large
+	MemoryLimitBytes int64  // Memory limit in bytes
+	CPUQuota         int64  // CPU quota in microseconds per 100ms period, e.g. 50000 = 0.5 CPU
+	PidsLimit        int64  // PIDs limit
+}
+
+// KubernetesConfig configures the kubernetes container backend, which runs
+// each learner in a pod with a persistent volume claim.
+type KubernetesConfig struct {
+	APIServer    string        // API server URL; empty uses the in-cluster service account (default: "")
+	Namespace    string        // Namespace of learner pods and volumes; empty uses the service account's (default: "")
+	Image        string        // Playground image, pullable by the cluster (default: playground:latest)
+	RuntimeClass string        // RuntimeClass of learner pods, e.g. gvisor; empty uses the cluster default (default: "")
+	StorageClass string        // StorageClass of learner volumes; empty uses the cluster default (default: "")
+	VolumeSize   string        // Requested size of each learner volume (default: 1Gi)
+	StartTimeout time.Duration // How long a new pod may take to start running (default: 2m)
+}
+
+// DockerHost is one Docker endpoint in a multi-host pool.
+type DockerHost struct {
+	Name     string // Unique host name used in logs and status
+	Endpoint string // Docker API endpoint, e.g. unix:///var/run/docker.sock or tcp://10.0.0.6:2375
+	Capacity int    // Max running containers on the host; 0 = unlimited
 }
 
 // RateLimitConfig holds rate limiting configuration.
 type RateLimitConfig struct {
 	RequestsPerWindow int           // Max requests per window (default: 10)
 	WindowDuration    time.Duration // Rate limit window (default: 1m)
+	ChatDedupeWindow  time.Duration // Window in which identical chat messages share one stream (default: 5s)
+
+	ProvisionPerIP  int           // Provision requests per client IP per ProvisionWindow; 0 disables (default: 0, public profile: 5)
+	ProvisionWindow time.Duration // Window of the per-IP provision limit (default: 10m)
+
+	PreviewPerUser int           // Command previews per user per PreviewWindow; 0 disables (default: 5)
+	PreviewWindow  time.Duration // Window of the per-user preview limit (default: 10m)
 }
 
 // SSEConfig holds Server-Sent Events configuration.
@@ -59,6 +204,10 @@ type SSEConfig struct {
 	MaxRequestBodySize int64         // Max request body size in bytes (default: 1MB)
 	RetryDelay         time.Duration // SSE retry delay (default: 5s)
 	KeepaliveInterval  time.Duration // SSE keepalive interval (default: 10s)
+	MaxMessageSize     int           // Max bytes per text field in an SSE event before truncation (default: 32KB)
+	ChunkSize          int           // Text fields longer than this are split across several events; 0 disables (default: 8KB)
+	SendBufferSize     int           // Events buffered per connection before new ones are dropped (default: 32)
+	WriteTimeout       time.Duration // Deadline for writing one event to a client (default: 10s)
 }
 
 // RetryConfig holds retry-related configuration.
@@ -67,19 +216,236 @@ type RetryConfig struct {
 	DatabaseRetryBaseDelay time.Duration // Base delay for DB retries (default: 50ms)
 }
 
+// TerminalConfig holds WebSocket terminal configuration.
+type TerminalConfig struct {
+	HiddenPingTimeout time.Duration // Treat a tab as hidden after this long without pings (default: 90s, 0 disables)
+	MaxMessageSize    int64         // Max WebSocket frame size in bytes; larger frames close the connection (default: 64KB)
+	MaxInputSize      int           // Max terminal input bytes per "data" message (default: 16KB)
+	MaxCapturedOutput int           // Max command output kept for AI analysis before truncation (default: 64KB)
+	FloodThreshold    int           // Output bytes/sec that switch monitor forwarding to sampling (default: 256KB, 0 disables)
+	FloodSampleBudget int           // Output bytes/sec still forwarded to the monitor while sampling (default: 16KB)
+	NotifyBell        bool          // Relay terminal bells from hidden tabs as desktop notifications (default: true)
+	NotifyAfter       time.Duration // Relay completions of commands this long from hidden tabs (default: 10s, 0 disables)
+	Banner            string        // Text written to a tab's terminal on first attach to a container; \n, \t and \e escapes expand (default: "")
+	BannerDir         string        // Directory of <classroom>.txt banners that replace Banner for classroom members (default: "")
+	BannerScript      string        // Shell command run in the container on first attach; its output follows the banner (default: "")
+	InputFilter       string        // Control keys dropped from terminal input, e.g. "ctrl-s,ctrl-q" (default: "")
+	InputFilterDir    string        // Directory of <classroom>.keys files that replace InputFilter for classroom members (default: "")
+	QuietHours        string        // Daily HH:MM-HH:MM windows of server local time without proactive messages, e.g. "22:00-07:00" (default: "")
+	QuietHoursDir     string        // Directory of <classroom>.quiet files that replace QuietHours for classroom members (default: "")
+	AnalysisDeadline  time.Duration // Cancel AI analysis jobs running this long and recycle their workers (default: 3m, 0 disables)
+	DemoDir           string        // Directory of recorded demos learners can replay (default: ./data/demos)
+	DemoMaxDuration   time.Duration // Stop capturing a demo recording after this long (default: 30m, 0 disables)
+
+	AbuseDetection bool // Block commands such as miners, scanners and fork bombs (default: false; always on in the public profile)
+	AbuseStrikes   int  // Blocked commands after which the session is ended and its container stopped (default: 3, public profile: 1)
+
+	E2E           bool   // Encrypt terminal input and output between the browser and the terminal monitor, refusing terminals that do not (default: false)
+	E2ESigningKey string // Base64 PKCS#8 P-256 key signing the server's key shares; its public key is pinned in the frontend build (default: "")
+}
+
+// AffinityConfig holds session affinity settings for multi-instance deployments.
+type AffinityConfig struct {
+	AdvertiseAddr string        // Address a front proxy uses to reach this instance (default: "")
+	RedisAddr     string        // Redis host:port for route lookups; empty disables Redis (default: "")
+	KeyTTL        time.Duration // Expiry of route keys in Redis (default: 24h)
+}
+
+// BrokerConfig holds terminal broker settings for the split API/broker deployment.
+type BrokerConfig struct {
+	Addr       string // Broker address used by the API tier; empty attaches to Docker directly (default: "")
+	ListenAddr string // Address the broker process listens on (default: "127.0.0.1:50061")
+	Token      string // Shared secret required on broker calls; empty disables token auth and is only allowed on loopback or with TLSCA (default: "")
+	TLSCert    string // PEM certificate the broker serves, or the API tier presents as a client certificate (default: "")
+	TLSKey     string // PEM private key of TLSCert (default: "")
+	TLSCA      string // PEM CA bundle the API tier verifies the broker with, or the broker verifies client certificates with (default: "")
+}
+
+// AdminConfig holds settings for the operator API under /api/admin.
+type AdminConfig struct {
+	Token       string        // Bearer token required by the admin API, shared with instructors; empty disables it (default: "")
+	KeepWarmMax time.Duration // Longest keep-warm exemption one request may grant (default: 4h)
+}
+
+// ClientErrorConfig holds frontend error report ingestion settings.
+type ClientErrorConfig struct {
+	SampleRate    float64 // Fraction of reports logged, 0-1 (default: 1)
+	MaxReportSize int64   // Max report body size in bytes (default: 16KB)
+}
+
+// AIBudgetConfig sets the error budget of the AI agent. Past it, AI features
+// degrade to analyzing failing commands only, then to local hints, instead
+// of every command waiting on a failing agent.
+type AIBudgetConfig struct {
+	Window         time.Duration // Rolling window agent calls are judged over (default: 5m, 0 disables degradation)
+	MinCalls       int           // Calls in the window before their error rate is judged (default: 20)
+	ErrorsOnlyRate float64       // Share of failed calls past which only failing commands are analyzed (default: 0.2)
+	LocalRate      float64       // Share of failed calls past which the agent is replaced by local hints (default: 0.5)
+	SlowCall       time.Duration // Calls taking longer than this count as failed (default: 20s)
+	ProbeInterval  time.Duration // How often one call still reaches the agent while local hints are served (default: 30s)
+	RecoverAfter   int           // Consecutive successful calls that restore full behavior (default: 5)
+	WebhookURL     string        // URL mode changes are posted to as JSON; empty only logs them (default: "")
+}
+
+// HandoffConfig sets where a server shutting down leaves its in-memory state
+// for the process replacing it.
+type HandoffConfig struct {
+	File   string        // State file written on shutdown and consumed on start; empty disables the handoff (default: ./data/handoff.json)
+	MaxAge time.Duration // Oldest state file a starting server resumes from (default: 5m)
+}
+
+// ShareConfig holds settings for public read-only session share links.
+type ShareConfig struct {
+	DefaultTTL time.Duration // Lifetime of a share link when the learner does not pick one (default: 24h)
+	MaxTTL     time.Duration // Longest lifetime a learner may pick (default: 168h)
+}
+
+// CurriculumConfig holds settings for git curriculum sources registered
+// through the admin API.
+type CurriculumConfig struct {
+	Dir           string        // Directory holding source checkouts and the source list (default: "./data/curriculum")
+	SyncInterval  time.Duration // How often sources are pulled; 0 only syncs on demand (default: 15m)
+	SyncTimeout   time.Duration // Bound on fetching one source (default: 2m)
+	MaxBundleSize int64         // Max size in bytes of a fetched pack and its checkout (default: 32MB)
+}
+
+// UsageConfig holds settings for metering per-user usage, so a hosted
+// deployment can bill for container time, AI calls and storage.
+type UsageConfig struct {
+	Sink              string        // Where usage records go: "file", "webhook" or "stripe"; empty disables metering (default: "")
+	SampleInterval    time.Duration // How often running containers are sampled for container time (default: 1m)
+	FlushInterval     time.Duration // Length of a usage period; records are emitted at its end (default: 1h)
+	FilePath          string        // NDJSON file the file sink appends to (default: "./data/usage/usage.ndjson")
+	WebhookURL        string        // URL the webhook sink posts record batches to (default: "")
+	WebhookSecret     string        // Key of the HMAC-SHA256 signature sent with webhook batches; empty sends none (default: "")
+	StripeKey         string        // Stripe secret key of the stripe sink (default: "")
+	StripeCustomers   string        // JSON file mapping user IDs to Stripe customer IDs (default: "")
+	StripeEventPrefix string        // Prefix of the Stripe meter event names, e.g. shsh_container_seconds (default: "shsh_")
+}
+
+// CaptureConfig holds settings for recording a learner's container traffic
+// as a pcap file in networking challenges. Capture is off unless challenges
+// are listed, and learners start each capture themselves.
+type CaptureConfig struct {
+	Challenges  []string      // IDs of the challenges that may capture traffic; empty disables capture (default: none; always none in the public profile)
+	Image       string        // Image of the tcpdump sidecar; empty uses the playground image (default: "")
+	MaxBytes    int64         // Max size in bytes of one capture; later packets are dropped (default: 10MB)
+	MaxDuration time.Duration // Capture stops on its own after this long (default: 5m)
+	SnapLen     int           // Bytes kept of each packet (default: 262144)
+}
+
+// SudoConfig holds settings for granting learners root in their container
+// for a limited time. Grants are off unless challenges are listed.
+type SudoConfig struct {
+	Challenges  []string      // IDs of the challenges that may grant sudo; empty disables grants (default: none; always none in the public profile)
+	MaxDuration time.Duration // Longest grant; it is revoked on its own afterwards (default: 10m)
+}
+
+// PackageProxyConfig holds settings for the apt/pip caching proxy run next
+// to playground containers on each Docker host, and the policy deciding which
+// packages learners may install through it.
+type PackageProxyConfig struct {
+	Enabled       bool     // Run the proxy and point learners' apt and pip at it (default: false)
+	Image         string   // Image of the proxy container (default: "shsh-pkgproxy:latest")
+	ListenAddr    string   // Address the proxy process listens on (default: ":3142")
+	CacheDir      string   // Directory the proxy caches package files in (default: "/var/cache/shsh-pkgproxy")
+	MaxCacheBytes int64    // Cache size above which the oldest files are evicted; 0 is unbounded (default: 10GB)
+	Allow         []string // Package name globs learners may install; empty allows all not denied (default: none)
+	Deny          []string // Package name globs learners may never install (default: miners, scanners and flooders)
+	AptHosts      []string // Mirrors apt may fetch through the proxy (default: Ubuntu and Debian archives)
+	PyPIIndex     string   // Upstream simple index (default: "https://pypi.org/simple")
+	PyPIFiles     string   // Upstream base URL of the files the index links to (default: "https://files.pythonhosted.org")
+}
+
+// defaultPackageDeny lists packages with no teaching use in a playground that
+// are used for abuse, matching what terminal abuse detection flags.
+const defaultPackageDeny = "xmrig,xmrig-*,minerd,cpuminer,cpuminer-*,ethminer,nbminer,t-rex,masscan,zmap,hping3,t50,slowhttptest,slowloris,thc-*"
+
+// Usage sinks selectable with SHSH_USAGE_SINK.
+const (
+	UsageSinkFile    = "file"
+	UsageSinkWebhook = "webhook"
+	UsageSinkStripe  = "stripe"
+)
+
 // Config holds all application configuration.
 type Config struct {
 	Port             string
 	FrontendURL      string
 	DBPath           string
+	Database         DatabaseConfig
 	SessionTTL       time.Duration
 	ContainerRuntime string // Docker runtime: "" = default (runc), "runsc" = gVisor
+	InstanceID       string // Identifies this server in Docker resource labels (default: hostname)
 	ConversationLog  ConversationLogConfig
 	Timeout          TimeoutConfig
 	Container        ContainerConfig
 	RateLimit        RateLimitConfig
 	SSE              SSEConfig
 	Retry            RetryConfig
+	Terminal         TerminalConfig
+	Affinity         AffinityConfig
+	Broker           BrokerConfig
+	ClientErrors     ClientErrorConfig
+	AIBudget         AIBudgetConfig
+	Handoff          HandoffConfig
+	Admin            AdminConfig
+	Share            ShareConfig
+	Curriculum       CurriculumConfig
+	Usage            UsageConfig
+	Capture          CaptureConfig
+	Sudo             SudoConfig
+	PackageProxy     PackageProxyConfig
+	Profile          string // "standard" or "public" (default: standard)
+	FileAPI          bool   // Serve file browser, export, share and challenge checkpoint routes (default: true; always off in the public profile)
+	PortForward      bool   // Serve /proxy/{port}/ to web servers in learner containers (default: true; always off in the public profile)
+	CommandPreview   bool   // Serve /api/terminal/preview, which runs commands in a committed clone of the container (default: true; always off in the public profile)
+	FileMaxBytes     int64  // Largest file the file browser reads, writes or uploads (default: 10MB)
+}
+
+// Database drivers selectable with DB_DRIVER.
+const (
+	DBDriverSQLite   = "sqlite"
+	DBDriverPostgres = "postgres"
+	DBDriverRedis    = "redis"
+)
+
+// DatabaseConfig selects the repository backend.
+type DatabaseConfig struct {
+	Driver          string        // "sqlite" (uses DBPath), "postgres" (uses URL) or "redis" (uses RedisURL) (default: sqlite)
+	URL             string        // PostgreSQL connection URL (default: "")
+	MaxOpenConns    int           // Max open PostgreSQL connections per instance (default: 25)
+	MaxIdleConns    int           // Max idle PostgreSQL or Redis connections kept in the pool (default: 5)
+	ConnMaxLifetime time.Duration // Recycle PostgreSQL connections after this long (default: 5m)
+	RedisURL        string        // Redis host:port or redis:// URL, shared with the Python agent (default: "")
+	RedisPassword   string        // Redis password (default: "")
+	RedisDB         int           // Redis database number (default: 0)
+	RedisSessionTTL time.Duration // Expiry of agent sessions and SSE event ID marks in Redis (default: 168h)
+	BackupDir       string        // Directory for SQLite backups, also searched for a restore at startup (default: ./data/backups)
+	BackupInterval  time.Duration // Time between SQLite backups; 0 disables them (default: 6h)
+	BackupRetain    int           // Number of SQLite backups kept (default: 7)
+
+	MaintenanceInterval time.Duration     // Time between SQLite WAL checkpoints and VACUUMs; 0 disables them (default: 24h)
+	MaintenanceWindow   MaintenanceWindow // Local time of day maintenance is held back to; zero allows any time (default: 03:00-05:00)
+
+	SessionArchiveRetention time.Duration // How long expired agent sessions stay archived for tutor review; SQL stores only (default: 720h)
+	ContainerEventRetention time.Duration // How long container lifecycle events are kept; SQL stores only, 0 keeps them (default: 720h)
+	AnalyticsInterval       time.Duration // Time between folds of new commands into daily per-user stats; SQL stores only, 0 disables (default: 5m)
+
+	UserCacheSize int           // Users kept in the in-process GetUser cache; 0 disables (default: 1024)
+	UserCacheTTL  time.Duration // How long a cached user is served; bounds staleness across instances (default: 5s)
+
+	CommandLogDir         string // Keep command history in per-user append-only segment files here instead of the database; empty disables (default: "")
+	CommandLogSegmentSize int64  // Size in bytes a command log segment grows to before a new one is started (default: 1MB)
+
+	EncryptionKey string // Base64 AES key (16, 24 or 32 bytes) encrypting agent session messages and challenge state at rest; SQLite only, empty disables (default: "")
+}
+
+// MaintenanceWindow is a daily span of local time, as offsets from
+// midnight. End before Start wraps past midnight; equal bounds mean any time.
+type MaintenanceWindow struct {
+	Start time.Duration
+	End   time.Duration
 }
 
 // ConversationLogConfig controls JSON conversation logging.
@@ -98,12 +464,62 @@ func Load() (*Config, error) {
 		queueSize = 1000
 	}
 
+	dockerHosts, err := parseDockerHosts(getEnv("SHSH_DOCKER_HOSTS", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	containerImages, err := parseContainerImages(getEnv("SHSH_CONTAINER_IMAGES", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	resourceTiers, err := parseResourceTiers(getEnv("SHSH_CONTAINER_TIERS", defaultResourceTiers))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	maintenanceWindow, err := parseMaintenanceWindow(getEnv("DB_MAINTENANCE_WINDOW", "03:00-05:00"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	profile := strings.ToLower(getEnv("SHSH_PROFILE", ProfileStandard))
+	public := profile == ProfilePublic
+
 	cfg := &Config{
 		Port:             getEnv("PORT", "8080"),
 		FrontendURL:      getEnv("FRONTEND_URL", ""),
 		DBPath:           getEnv("DB_PATH", "./data/playground.db"),
-		SessionTTL:       60 * time.Minute,
+		SessionTTL:       getEnvDuration("SHSH_SESSION_TTL", byProfile(public, 60*time.Minute, 10*time.Minute)),
 		ContainerRuntime: getEnv("CONTAINER_RUNTIME", ""),
+		InstanceID:       getEnv("SHSH_INSTANCE_ID", defaultInstanceID()),
+		Database: DatabaseConfig{
+			Driver:          strings.ToLower(getEnv("DB_DRIVER", DBDriverSQLite)),
+			URL:             getEnv("DATABASE_URL", ""),
+			MaxOpenConns:    getEnvInt("DB_MAX_OPEN_CONNS", 25),
+			MaxIdleConns:    getEnvInt("DB_MAX_IDLE_CONNS", 5),
+			ConnMaxLifetime: getEnvDuration("DB_CONN_MAX_LIFETIME", 5*time.Minute),
+			RedisURL:        getEnv("REDIS_URL", ""),
+			RedisPassword:   getEnv("REDIS_PASSWORD", ""),
+			RedisDB:         getEnvInt("REDIS_DB", 0),
+			RedisSessionTTL: getEnvDuration("REDIS_SESSION_TTL", 7*24*time.Hour),
+			BackupDir:       getEnv("DB_BACKUP_DIR", "./data/backups"),
+			BackupInterval:  getEnvDuration("DB_BACKUP_INTERVAL", 6*time.Hour),
+			BackupRetain:    getEnvInt("DB_BACKUP_RETAIN", 7),
+
+			MaintenanceInterval: getEnvDuration("DB_MAINTENANCE_INTERVAL", 24*time.Hour),
+			MaintenanceWindow:   maintenanceWindow,
+
+			SessionArchiveRetention: getEnvDuration("DB_SESSION_ARCHIVE_RETENTION", 30*24*time.Hour),
+			ContainerEventRetention: getEnvDuration("DB_CONTAINER_EVENT_RETENTION", 30*24*time.Hour),
+			AnalyticsInterval:       getEnvDuration("DB_ANALYTICS_INTERVAL", 5*time.Minute),
+
+			UserCacheSize: getEnvInt("DB_USER_CACHE_SIZE", 1024),
+			UserCacheTTL:  getEnvDuration("DB_USER_CACHE_TTL", 5*time.Second),
+
+			CommandLogDir:         getEnv("DB_COMMAND_LOG_DIR", ""),
+			CommandLogSegmentSize: getEnvInt64("DB_COMMAND_LOG_SEGMENT_SIZE", 1<<20),
+
+			EncryptionKey: getEnv("DB_ENCRYPTION_KEY", ""),
+		},
 		ConversationLog: ConversationLogConfig{
 			Enabled:       getEnvBool("CONVERSATION_LOG_ENABLED", true),
 			Dir:           getEnv("CONVERSATION_LOG_DIR", "./data/logs/conversations"),
@@ -116,29 +532,186 @@ func Load() (*Config, error) {
 			ContainerCreate:   getEnvDuration("SHSH_CONTAINER_CREATE_TIMEOUT", 2*time.Minute),
 			HealthCheck:       getEnvDuration("SHSH_HEALTH_CHECK_TIMEOUT", 5*time.Second),
 			DestroyCleanup:    getEnvDuration("SHSH_DESTROY_CLEANUP_TIMEOUT", 30*time.Second),
-			TTLWorkerInterval: getEnvDuration("SHSH_TTL_WORKER_INTERVAL", 5*time.Minute),
+			TTLWorkerInterval: getEnvDuration("SHSH_TTL_WORKER_INTERVAL", byProfile(public, 5*time.Minute, time.Minute)),
+			PreStopHook:       getEnvDuration("SHSH_CONTAINER_PRE_STOP_TIMEOUT", 10*time.Second),
 		},
 		Container: ContainerConfig{
-			MemoryLimitBytes:    getEnvInt64("SHSH_CONTAINER_MEMORY_LIMIT", 512*1024*1024),
-			CPUQuota:            getEnvInt64("SHSH_CONTAINER_CPU_QUOTA", 50000),
-			PidsLimit:           getEnvInt64("SHSH_CONTAINER_PIDS_LIMIT", 256),
+			MemoryLimitBytes:    getEnvInt64("SHSH_CONTAINER_MEMORY_LIMIT", byProfile[int64](public, 512*1024*1024, 256*1024*1024)),
+			CPUQuota:            getEnvInt64("SHSH_CONTAINER_CPU_QUOTA", byProfile[int64](public, 50000, 25000)),
+			PidsLimit:           getEnvInt64("SHSH_CONTAINER_PIDS_LIMIT", byProfile[int64](public, 256, 64)),
 			CreateRetryAttempts: getEnvInt("SHSH_CONTAINER_CREATE_RETRY_ATTEMPTS", 20),
 			CreateRetryDelay:    getEnvDuration("SHSH_CONTAINER_CREATE_RETRY_DELAY", 250*time.Millisecond),
+			HealthInterval:      getEnvDuration("SHSH_CONTAINER_HEALTH_INTERVAL", 30*time.Second),
+			HealthTimeout:       getEnvDuration("SHSH_CONTAINER_HEALTH_TIMEOUT", 5*time.Second),
+			HealthRetries:       getEnvInt("SHSH_CONTAINER_HEALTH_RETRIES", 3),
+			WatchdogInterval:    getEnvDuration("SHSH_CONTAINER_WATCHDOG_INTERVAL", 30*time.Second),
+			AutoRecreate:        getEnvBool("SHSH_CONTAINER_AUTO_RECREATE", false),
+			RuntimeFallback:     getEnvBool("SHSH_CONTAINER_RUNTIME_FALLBACK", false),
+			ReaperInterval:      getEnvDuration("SHSH_CONTAINER_REAPER_INTERVAL", 10*time.Minute),
+			ReaperGracePeriod:   getEnvDuration("SHSH_CONTAINER_REAPER_GRACE_PERIOD", 10*time.Minute),
+			Hosts:               dockerHosts,
+			HostCheckInterval:   getEnvDuration("SHSH_DOCKER_HOST_CHECK_INTERVAL", 15*time.Second),
+			QueueRetryInterval:  getEnvDuration("SHSH_PROVISION_QUEUE_INTERVAL", 5*time.Second),
+			PrePullConcurrency:  getEnvInt("SHSH_IMAGE_PREPULL_CONCURRENCY", 2),
+			AutoPauseDelay:      getEnvDuration("SHSH_CONTAINER_AUTO_PAUSE_DELAY", 5*time.Minute),
+			PauseOnExpiry:       getEnvBool("SHSH_CONTAINER_PAUSE_ON_EXPIRY", false),
+			PausedTTL:           getEnvDuration("SHSH_CONTAINER_PAUSED_TTL", 24*time.Hour),
+			MaxLifetime:         getEnvDuration("SHSH_CONTAINER_MAX_LIFETIME", byProfile(public, 8*time.Hour, 2*time.Hour)),
+
+			Backend:      strings.ToLower(getEnv("CONTAINER_BACKEND", ContainerBackendDocker)),
+			PodmanSocket: getEnv("SHSH_PODMAN_SOCKET", ""),
+			Images:       containerImages,
+			Tiers:        resourceTiers,
+			DefaultTier:  getEnv("SHSH_CONTAINER_DEFAULT_TIER", ""),
+			Kubernetes: KubernetesConfig{
+				APIServer:    getEnv("SHSH_K8S_API_SERVER", ""),
+				Namespace:    getEnv("SHSH_K8S_NAMESPACE", ""),
+				Image:        getEnv("SHSH_K8S_IMAGE", "playground:latest"),
+				RuntimeClass: getEnv("SHSH_K8S_RUNTIME_CLASS", ""),
+				StorageClass: getEnv("SHSH_K8S_STORAGE_CLASS", ""),
+				VolumeSize:   getEnv("SHSH_K8S_VOLUME_SIZE", "1Gi"),
+				StartTimeout: getEnvDuration("SHSH_K8S_POD_START_TIMEOUT", 2*time.Minute),
+			},
+			EgressPolicy: getEnv("SHSH_CONTAINER_EGRESS_POLICY", egressDefault(getEnvBool("SHSH_CONTAINER_EGRESS_DENY", false))),
+			EgressAllow:  splitList(getEnv("SHSH_CONTAINER_EGRESS_ALLOW", "")),
+			EgressImage:  getEnv("SHSH_CONTAINER_EGRESS_IMAGE", ""),
 		},
 		RateLimit: RateLimitConfig{
-			RequestsPerWindow: getEnvInt("SHSH_RATE_LIMIT_REQUESTS", 10),
+			RequestsPerWindow: getEnvInt("SHSH_RATE_LIMIT_REQUESTS", byProfile(public, 10, 3)),
 			WindowDuration:    getEnvDuration("SHSH_RATE_LIMIT_WINDOW", time.Minute),
+			ChatDedupeWindow:  getEnvDuration("SHSH_CHAT_DEDUPE_WINDOW", 5*time.Second),
+
+			ProvisionPerIP:  getEnvInt("SHSH_PROVISION_RATE_LIMIT", byProfile(public, 0, 5)),
+			ProvisionWindow: getEnvDuration("SHSH_PROVISION_RATE_WINDOW", 10*time.Minute),
+
+			PreviewPerUser: getEnvInt("SHSH_PREVIEW_RATE_LIMIT", 5),
+			PreviewWindow:  getEnvDuration("SHSH_PREVIEW_RATE_WINDOW", 10*time.Minute),
 		},
 		SSE: SSEConfig{
 			MaxRequestBodySize: getEnvInt64("SHSH_SSE_MAX_BODY_SIZE", 1<<20), // 1MB
 			RetryDelay:         getEnvDuration("SHSH_SSE_RETRY_DELAY", 5*time.Second),
 			KeepaliveInterval:  getEnvDuration("SHSH_SSE_KEEPALIVE_INTERVAL", 10*time.Second),
+			MaxMessageSize:     getEnvInt("SHSH_SSE_MAX_MESSAGE_SIZE", 32*1024),
+			ChunkSize:          getEnvInt("SHSH_SSE_CHUNK_SIZE", 8*1024),
+			SendBufferSize:     getEnvInt("SHSH_SSE_SEND_BUFFER_SIZE", 32),
+			WriteTimeout:       getEnvDuration("SHSH_SSE_WRITE_TIMEOUT", 10*time.Second),
 		},
 		Retry: RetryConfig{
 			DatabaseMaxRetries:     getEnvInt("SHSH_DB_MAX_RETRIES", 3),
 			DatabaseRetryBaseDelay: getEnvDuration("SHSH_DB_RETRY_BASE_DELAY", 50*time.Millisecond),
 		},
+		Terminal: TerminalConfig{
+			HiddenPingTimeout: getEnvDuration("SHSH_TERMINAL_HIDDEN_PING_TIMEOUT", 90*time.Second),
+			MaxMessageSize:    getEnvInt64("SHSH_WS_MAX_MESSAGE_SIZE", 64*1024),
+			MaxInputSize:      getEnvInt("SHSH_WS_MAX_INPUT_SIZE", 16*1024),
+			MaxCapturedOutput: getEnvInt("SHSH_TERMINAL_MAX_CAPTURED_OUTPUT", 64*1024),
+			FloodThreshold:    getEnvInt("SHSH_TERMINAL_FLOOD_THRESHOLD", 256*1024),
+			FloodSampleBudget: getEnvInt("SHSH_TERMINAL_FLOOD_SAMPLE_BUDGET", 16*1024),
+			NotifyBell:        getEnvBool("SHSH_TERMINAL_NOTIFY_BELL", true),
+			NotifyAfter:       getEnvDuration("SHSH_TERMINAL_NOTIFY_AFTER", 10*time.Second),
+			Banner:            getEnv("SHSH_TERMINAL_BANNER", ""),
+			BannerDir:         getEnv("SHSH_TERMINAL_BANNER_DIR", ""),
+			BannerScript:      getEnv("SHSH_TERMINAL_BANNER_SCRIPT", ""),
+			InputFilter:       getEnv("SHSH_TERMINAL_INPUT_FILTER", ""),
+			InputFilterDir:    getEnv("SHSH_TERMINAL_INPUT_FILTER_DIR", ""),
+			QuietHours:        getEnv("SHSH_TERMINAL_QUIET_HOURS", ""),
+			QuietHoursDir:     getEnv("SHSH_TERMINAL_QUIET_HOURS_DIR", ""),
+			AnalysisDeadline:  getEnvDuration("SHSH_TERMINAL_ANALYSIS_DEADLINE", 3*time.Minute),
+			DemoDir:           getEnv("SHSH_TERMINAL_DEMO_DIR", "./data/demos"),
+			DemoMaxDuration:   getEnvDuration("SHSH_TERMINAL_DEMO_MAX_DURATION", 30*time.Minute),
+
+			AbuseDetection: getEnvBool("SHSH_TERMINAL_ABUSE_DETECTION", false),
+			AbuseStrikes:   getEnvInt("SHSH_TERMINAL_ABUSE_STRIKES", byProfile(public, 3, 1)),
+
+			E2E:           getEnvBool("SHSH_TERMINAL_E2E", false),
+			E2ESigningKey: getEnv("SHSH_TERMINAL_E2E_SIGNING_KEY", ""),
+		},
+		Affinity: AffinityConfig{
+			AdvertiseAddr: getEnv("SHSH_ADVERTISE_ADDR", ""),
+			RedisAddr:     getEnv("SHSH_AFFINITY_REDIS_ADDR", ""),
+			KeyTTL:        getEnvDuration("SHSH_AFFINITY_TTL", 24*time.Hour),
+		},
+		Broker: BrokerConfig{
+			Addr:       getEnv("SHSH_BROKER_ADDR", ""),
+			ListenAddr: getEnv("SHSH_BROKER_LISTEN_ADDR", "127.0.0.1:50061"),
+			Token:      getEnv("SHSH_BROKER_TOKEN", ""),
+			TLSCert:    getEnv("SHSH_BROKER_TLS_CERT", ""),
+			TLSKey:     getEnv("SHSH_BROKER_TLS_KEY", ""),
+			TLSCA:      getEnv("SHSH_BROKER_TLS_CA", ""),
+		},
+		ClientErrors: ClientErrorConfig{
+			SampleRate:    getEnvFloat("SHSH_CLIENT_ERROR_SAMPLE_RATE", 1),
+			MaxReportSize: getEnvInt64("SHSH_CLIENT_ERROR_MAX_SIZE", 16*1024),
+		},
+		AIBudget: AIBudgetConfig{
+			Window:         getEnvDuration("SHSH_AI_BUDGET_WINDOW", 5*time.Minute),
+			MinCalls:       getEnvInt("SHSH_AI_BUDGET_MIN_CALLS", 20),
+			ErrorsOnlyRate: getEnvFloat("SHSH_AI_BUDGET_ERRORS_ONLY_RATE", 0.2),
+			LocalRate:      getEnvFloat("SHSH_AI_BUDGET_LOCAL_RATE", 0.5),
+			SlowCall:       getEnvDuration("SHSH_AI_BUDGET_SLOW_CALL", 20*time.Second),
+			ProbeInterval:  getEnvDuration("SHSH_AI_BUDGET_PROBE_INTERVAL", 30*time.Second),
+			RecoverAfter:   getEnvInt("SHSH_AI_BUDGET_RECOVER_AFTER", 5),
+			WebhookURL:     getEnv("SHSH_AI_BUDGET_WEBHOOK_URL", ""),
+		},
+		Handoff: HandoffConfig{
+			File:   getEnv("SHSH_HANDOFF_FILE", "./data/handoff.json"),
+			MaxAge: getEnvDuration("SHSH_HANDOFF_MAX_AGE", 5*time.Minute),
+		},
+		Admin: AdminConfig{
+			Token:       getEnv("SHSH_ADMIN_TOKEN", ""),
+			KeepWarmMax: getEnvDuration("SHSH_KEEP_WARM_MAX", 4*time.Hour),
+		},
+		Share: ShareConfig{
+			DefaultTTL: getEnvDuration("SHSH_SHARE_TTL", 24*time.Hour),
+			MaxTTL:     getEnvDuration("SHSH_SHARE_MAX_TTL", 7*24*time.Hour),
+		},
+		Curriculum: CurriculumConfig{
+			Dir:           getEnv("SHSH_CURRICULUM_DIR", "./data/curriculum"),
+			SyncInterval:  getEnvDuration("SHSH_CURRICULUM_SYNC_INTERVAL", 15*time.Minute),
+			SyncTimeout:   getEnvDuration("SHSH_CURRICULUM_SYNC_TIMEOUT", 2*time.Minute),
+			MaxBundleSize: getEnvInt64("SHSH_CURRICULUM_MAX_BUNDLE_SIZE", 32*1024*1024),
+		},
+		Usage: UsageConfig{
+			Sink:              strings.ToLower(getEnv("SHSH_USAGE_SINK", "")),
+			SampleInterval:    getEnvDuration("SHSH_USAGE_SAMPLE_INTERVAL", time.Minute),
+			FlushInterval:     getEnvDuration("SHSH_USAGE_FLUSH_INTERVAL", time.Hour),
+			FilePath:          getEnv("SHSH_USAGE_FILE", "./data/usage/usage.ndjson"),
+			WebhookURL:        getEnv("SHSH_USAGE_WEBHOOK_URL", ""),
+			WebhookSecret:     getEnv("SHSH_USAGE_WEBHOOK_SECRET", ""),
+			StripeKey:         getEnv("SHSH_USAGE_STRIPE_KEY", ""),
+			StripeCustomers:   getEnv("SHSH_USAGE_STRIPE_CUSTOMERS", ""),
+			StripeEventPrefix: getEnv("SHSH_USAGE_STRIPE_EVENT_PREFIX", "shsh_"),
+		},
+		Capture: CaptureConfig{
+			Challenges:  splitList(getEnv("SHSH_CAPTURE_CHALLENGES", "")),
+			Image:       getEnv("SHSH_CAPTURE_IMAGE", ""),
+			MaxBytes:    getEnvInt64("SHSH_CAPTURE_MAX_BYTES", 10*1024*1024),
+			MaxDuration: getEnvDuration("SHSH_CAPTURE_MAX_DURATION", 5*time.Minute),
+			SnapLen:     getEnvInt("SHSH_CAPTURE_SNAPLEN", 262144),
+		},
+		Sudo: SudoConfig{
+			Challenges:  splitList(getEnv("SHSH_SUDO_CHALLENGES", "")),
+			MaxDuration: getEnvDuration("SHSH_SUDO_MAX_DURATION", 10*time.Minute),
+		},
+		PackageProxy: PackageProxyConfig{
+			Enabled:       getEnvBool("SHSH_PKG_PROXY", false),
+			Image:         getEnv("SHSH_PKG_PROXY_IMAGE", "shsh-pkgproxy:latest"),
+			ListenAddr:    getEnv("SHSH_PKG_PROXY_LISTEN_ADDR", ":3142"),
+			CacheDir:      getEnv("SHSH_PKG_PROXY_CACHE_DIR", "/var/cache/shsh-pkgproxy"),
+			MaxCacheBytes: getEnvInt64("SHSH_PKG_PROXY_MAX_CACHE_BYTES", 10*1024*1024*1024),
+			Allow:         splitList(getEnv("SHSH_PKG_PROXY_ALLOW", "")),
+			Deny:          splitList(getEnv("SHSH_PKG_PROXY_DENY", defaultPackageDeny)),
+			AptHosts:      splitList(getEnv("SHSH_PKG_PROXY_APT_HOSTS", "archive.ubuntu.com,security.ubuntu.com,ports.ubuntu.com,deb.debian.org")),
+			PyPIIndex:     getEnv("SHSH_PKG_PROXY_PYPI_INDEX", "https://pypi.org/simple"),
+			PyPIFiles:     getEnv("SHSH_PKG_PROXY_PYPI_FILES", "https://files.pythonhosted.org"),
+		},
+		Profile:        profile,
+		FileAPI:        getEnvBool("SHSH_FILE_API", true),
+		PortForward:    getEnvBool("SHSH_PORT_FORWARD", true),
+		CommandPreview: getEnvBool("SHSH_COMMAND_PREVIEW", true),
+		FileMaxBytes:   getEnvInt64("SHSH_FILE_MAX_BYTES", 10*1024*1024),
 	}
+	cfg.applyProfile()
 
 	if err := cfg.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
@@ -152,8 +725,60 @@ func (c *Config) Validate() error {
 	if c.Port == "" {
 		return errEmptyPort
 	}
-	if c.DBPath == "" {
-		return errEmptyDBPath
+	if c.Profile != ProfileStandard && c.Profile != ProfilePublic {
+		return errInvalidProfile
+	}
+	switch c.Database.Driver {
+	case DBDriverSQLite:
+		if c.DBPath == "" {
+			return errEmptyDBPath
+		}
+	case DBDriverPostgres:
+		if c.Database.URL == "" {
+			return errEmptyDatabaseURL
+		}
+	case DBDriverRedis:
+		if c.Database.RedisURL == "" {
+			return errEmptyRedisURL
+		}
+	default:
+		return errInvalidDBDriver
+	}
+	if c.Database.EncryptionKey != "" && c.Database.Driver != DBDriverSQLite {
+		return errEncryptionKeyDriver
+	}
+	switch c.Container.Backend {
+	case ContainerBackendDocker:
+	case ContainerBackendPodman:
+		if len(c.Container.Hosts) > 0 {
+			return errPodmanDockerHosts
+		}
+	case ContainerBackendKubernetes:
+		if len(c.Container.Hosts) > 0 {
+			return errKubernetesDockerHosts
+		}
+	default:
+		return errInvalidContainerBackend
+	}
+	if err := c.Container.validateEgress(); err != nil {
+		return err
+	}
+	if c.Container.PrePullConcurrency < 0 {
+		return errInvalidPrePullConcurrency
+	}
+	if c.Container.PauseOnExpiry && c.Container.PausedTTL <= c.SessionTTL {
+		return errInvalidPausedTTL
+	}
+	if _, ok := c.Container.Tier(c.Container.DefaultTier); c.Container.DefaultTier != "" && !ok {
+		return errUnknownResourceTier
+	}
+	for _, image := range c.Container.Images {
+		if _, ok := c.Container.Tier(image.Tier); image.Tier != "" && !ok {
+			return errUnknownResourceTier
+		}
+	}
+	if c.InstanceID == "" {
+		return errEmptyInstanceID
 	}
 	if c.ConversationLog.Dir == "" {
 		return errEmptyConversationLogDir
@@ -164,9 +789,131 @@ func (c *Config) Validate() error {
 	if c.ConversationLog.QueueSize <= 0 {
 		return errInvalidConversationLogQueue
 	}
+	if c.Terminal.MaxMessageSize <= 0 {
+		return errInvalidWSMessageSize
+	}
+	if c.Terminal.MaxInputSize <= 0 || int64(c.Terminal.MaxInputSize) > c.Terminal.MaxMessageSize {
+		return errInvalidWSInputSize
+	}
+	if c.Terminal.E2E && c.Terminal.E2ESigningKey == "" {
+		return errEmptyTerminalE2EKey
+	}
+	if c.ClientErrors.SampleRate < 0 || c.ClientErrors.SampleRate > 1 {
+		return errInvalidClientErrorSampleRate
+	}
+	if c.ClientErrors.MaxReportSize <= 0 {
+		return errInvalidClientErrorMaxSize
+	}
+	if err := c.AIBudget.validate(); err != nil {
+		return err
+	}
+	if c.Handoff.File != "" && c.Handoff.MaxAge <= 0 {
+		return errInvalidHandoffMaxAge
+	}
+	if c.Share.DefaultTTL <= 0 || c.Share.DefaultTTL > c.Share.MaxTTL {
+		return errInvalidShareTTL
+	}
+	if c.FileAPI && c.FileMaxBytes <= 0 {
+		return errInvalidFileMaxBytes
+	}
+	if c.Curriculum.SyncTimeout <= 0 || c.Curriculum.MaxBundleSize <= 0 {
+		return errInvalidCurriculumSync
+	}
+	if len(c.Capture.Challenges) > 0 && (c.Capture.MaxBytes <= 0 || c.Capture.MaxDuration <= 0 || c.Capture.SnapLen <= 0) {
+		return errInvalidCaptureLimits
+	}
+	if len(c.Sudo.Challenges) > 0 && c.Sudo.MaxDuration <= 0 {
+		return errInvalidSudoDuration
+	}
+	if err := c.PackageProxy.validate(c.Container.Backend); err != nil {
+		return err
+	}
+	return c.Usage.validate()
+}
+
+// validate checks the settings of the configured usage sink.
+func (u UsageConfig) validate() error {
+	switch u.Sink {
+	case "":
+		return nil
+	case UsageSinkFile:
+		if u.FilePath == "" {
+			return errEmptyUsageFile
+		}
+	case UsageSinkWebhook:
+		if u.WebhookURL == "" {
+			return errEmptyUsageWebhookURL
+		}
+	case UsageSinkStripe:
+		if u.StripeKey == "" || u.StripeCustomers == "" {
+			return errIncompleteUsageStripe
+		}
+	default:
+		return errInvalidUsageSink
+	}
+	if u.SampleInterval <= 0 || u.SampleInterval > u.FlushInterval {
+		return errInvalidUsageInterval
+	}
 	return nil
 }
 
+// validate checks the budget settings when degradation is enabled.
+func (b AIBudgetConfig) validate() error {
+	if b.Window < 0 {
+		return errInvalidAIBudget
+	}
+	if b.Window == 0 {
+		return nil
+	}
+	if b.MinCalls <= 0 || b.RecoverAfter <= 0 || b.SlowCall <= 0 || b.ProbeInterval <= 0 ||
+		b.ErrorsOnlyRate <= 0 || b.ErrorsOnlyRate > b.LocalRate || b.LocalRate > 1 {
+		return errInvalidAIBudget
+	}
+	return nil
+}
+
+// validate checks the proxy settings when it is enabled.
+func (p PackageProxyConfig) validate(backend string) error {
+	if !p.Enabled {
+		return nil
+	}
+	if backend == ContainerBackendKubernetes {
+		return errPackageProxyBackend
+	}
+	if p.Image == "" || p.CacheDir == "" || len(p.AptHosts) == 0 || p.PyPIIndex == "" || p.MaxCacheBytes < 0 {
+		return errInvalidPackageProxy
+	}
+	return nil
+}
+
+// applyProfile forces the settings the profile does not let environment
+// variables relax.
+func (c *Config) applyProfile() {
+	if c.Profile != ProfilePublic {
+		return
+	}
+	c.Container.EgressPolicy = EgressDeny
+	c.Terminal.AbuseDetection = true
+	c.FileAPI = false
+	c.PortForward = false
+	c.CommandPreview = false
+	c.Capture.Challenges = nil
+	c.Sudo.Challenges = nil
+}
+
+// IsPublic reports whether the public profile is active.
+func (c *Config) IsPublic() bool {
+	return c.Profile == ProfilePublic
+}
+
+// byProfile returns publicValue in the public profile and standard otherwise.
+func byProfile[T any](public bool, standard, publicValue T) T {
+	if public {
+		return publicValue
+	}
+	return standard
+}
+
 // IsDevelopment returns true if running in development mode.
 func (c *Config) IsDevelopment() bool {
 	return c.FrontendURL == "" ||
@@ -174,6 +921,281 @@ func (c *Config) IsDevelopment() bool {
 		strings.Contains(c.FrontendURL, "127.0.0.1")
 }
 
+// parseDockerHosts parses a comma-separated list of name=endpoint entries; an
+// optional capacity query parameter on the endpoint limits running containers,
+// e.g. "a=unix:///var/run/docker.sock?capacity=40,b=tcp://10.0.0.6:2375".
+func parseDockerHosts(raw string) ([]DockerHost, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+
+	var hosts []DockerHost
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(raw, ",") {
+		name, endpoint, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		name, endpoint = strings.TrimSpace(name), strings.TrimSpace(endpoint)
+		if !ok || name == "" || endpoint == "" || seen[name] {
+			return nil, fmt.Errorf("%w: %q", errInvalidDockerHost, entry)
+		}
+		seen[name] = true
+
+		host := DockerHost{Name: name, Endpoint: endpoint}
+		if base, query, hasQuery := strings.Cut(endpoint, "?"); hasQuery {
+			values, err := url.ParseQuery(query)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q", errInvalidDockerHost, entry)
+			}
+			if capacity := values.Get("capacity"); capacity != "" {
+				n, err := strconv.Atoi(capacity)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("%w: %q", errInvalidDockerHost, entry)
+				}
+				host.Capacity = n
+			}
+			host.Endpoint = base
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+// containerImageNamePattern bounds the names clients request images by.
+var containerImageNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// parseContainerImages parses comma-separated name=image entries; an optional
+// tier query parameter picks the resource tier of the image's containers, e.g.
+// "ubuntu-base=playground:latest,net-lab=shsh/net-lab:1?tier=large".
+func parseContainerImages(raw string) ([]ContainerImage, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+
+	var images []ContainerImage
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(raw, ",") {
+		name, ref, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		name, ref = strings.TrimSpace(name), strings.TrimSpace(ref)
+		if !ok || !containerImageNamePattern.MatchString(name) || ref == "" || seen[name] {
+			return nil, fmt.Errorf("%w: %q", errInvalidContainerImage, entry)
+		}
+		seen[name] = true
+
+		image := ContainerImage{Name: name, Ref: ref}
+		if base, query, hasQuery := strings.Cut(ref, "?"); hasQuery {
+			values, err := url.ParseQuery(query)
+			if err != nil || base == "" {
+				return nil, fmt.Errorf("%w: %q", errInvalidContainerImage, entry)
+			}
+			image.Ref, image.Tier = base, values.Get("tier")
+		}
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+// defaultResourceTiers are the tiers offered when SHSH_CONTAINER_TIERS is
+// unset.
+const defaultResourceTiers = "small=256m:0.25:64,medium=512m:0.5:256,large=1g:1:512"
+
+// parseResourceTiers parses comma-separated name=memory:cpus:pids entries,
+// where memory takes an optional k, m or g suffix and cpus may be
+// fractional, e.g. "small=256m:0.25:64,large=2g:2:1024".
+func parseResourceTiers(raw string) ([]ResourceTier, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+
+	var tiers []ResourceTier
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(raw, ",") {
+		name, limits, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		name = strings.TrimSpace(name)
+		parts := strings.Split(limits, ":")
+		if !ok || !containerImageNamePattern.MatchString(name) || len(parts) != 3 || seen[name] {
+			return nil, fmt.Errorf("%w: %q", errInvalidResourceTier, entry)
+		}
+		seen[name] = true
+
+		memory, memErr := parseByteSize(strings.TrimSpace(parts[0]))
+		cpus, cpuErr := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		pids, pidsErr := strconv.ParseInt(strings.TrimSpace(parts[2]), 10, 64)
+		quota := int64(cpus * 100000)
+		if memErr != nil || cpuErr != nil || pidsErr != nil || memory <= 0 || quota < 1000 || pids <= 0 {
+			return nil, fmt.Errorf("%w: %q", errInvalidResourceTier, entry)
+		}
+		tiers = append(tiers, ResourceTier{Name: name, MemoryLimitBytes: memory, CPUQuota: quota, PidsLimit: pids})
+	}
+	return tiers, nil
+}
+
+// parseByteSize parses a byte count with an optional k, m or g suffix.
+func parseByteSize(raw string) (int64, error) {
+	multiplier := int64(1)
+	if raw != "" {
+		switch raw[len(raw)-1] {
+		case 'k', 'K':
+			multiplier = 1024
+		case 'm', 'M':
+			multiplier = 1024 * 1024
+		case 'g', 'G':
+			multiplier = 1024 * 1024 * 1024
+		}
+	}
+	if multiplier > 1 {
+		raw = raw[:len(raw)-1]
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * multiplier, nil
+}
+
+// Tier returns the resource tier named name.
+func (c ContainerConfig) Tier(name string) (ResourceTier, bool) {
+	for _, tier := range c.Tiers {
+		if tier.Name == name {
+			return tier, true
+		}
+	}
+	return ResourceTier{}, false
+}
+
+// ResolveTier returns the first of names that is a configured tier, falling
+// back to DefaultTier and then to the container's flat resource limits.
+func (c ContainerConfig) ResolveTier(names ...string) ResourceTier {
+	for _, name := range append(names, c.DefaultTier) {
+		if tier, ok := c.Tier(name); ok && name != "" {
+			return tier
+		}
+	}
+	return ResourceTier{MemoryLimitBytes: c.MemoryLimitBytes, CPUQuota: c.CPUQuota, PidsLimit: c.PidsLimit}
+}
+
+// ImageRef returns the reference of the image learners request as name.
+func (c ContainerConfig) ImageRef(name string) (string, bool) {
+	image, ok := c.Image(name)
+	return image.Ref, ok
+}
+
+// Image returns the image learners request as name.
+func (c ContainerConfig) Image(name string) (ContainerImage, bool) {
+	for _, image := range c.Images {
+		if image.Name == name {
+			return image, true
+		}
+	}
+	return ContainerImage{}, false
+}
+
+// egressDefault keeps SHSH_CONTAINER_EGRESS_DENY working as a shorthand for
+// the deny policy.
+func egressDefault(deny bool) string {
+	if deny {
+		return EgressDeny
+	}
+	return EgressFull
+}
+
+// egressDomainPattern matches the domains an egress allowlist may name.
+var egressDomainPattern = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)+$`)
+
+// validateEgress checks the egress policy and its allowlist.
+func (c ContainerConfig) validateEgress() error {
+	switch c.EgressPolicy {
+	case EgressFull, EgressDeny:
+		return nil
+	case EgressAllowlist:
+	default:
+		return errInvalidEgressPolicy
+	}
+	if len(c.EgressAllow) == 0 {
+		return errInvalidEgressAllow
+	}
+	for _, entry := range c.EgressAllow {
+		// The playground network is IPv4 only.
+		if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+			continue
+		}
+		if ip, _, err := net.ParseCIDR(entry); err == nil && ip.To4() != nil {
+			continue
+		}
+		if !egressDomainPattern.MatchString(entry) {
+			return fmt.Errorf("%w: %q", errInvalidEgressAllow, entry)
+		}
+	}
+	return nil
+}
+
+// Allows reports whether challenge challengeID may capture traffic.
+func (c CaptureConfig) Allows(challengeID string) bool {
+	for _, id := range c.Challenges {
+		if id == challengeID {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether challenge challengeID may grant sudo.
+func (c SudoConfig) Allows(challengeID string) bool {
+	for _, id := range c.Challenges {
+		if id == challengeID {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits a comma-separated list, dropping empty entries.
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseMaintenanceWindow parses a "HH:MM-HH:MM" span of local time, e.g.
+// "23:30-02:00". An empty string allows any time.
+func parseMaintenanceWindow(raw string) (MaintenanceWindow, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return MaintenanceWindow{}, nil
+	}
+	from, to, ok := strings.Cut(raw, "-")
+	if !ok {
+		return MaintenanceWindow{}, fmt.Errorf("%w: %q", errInvalidMaintenanceWindow, raw)
+	}
+	var window MaintenanceWindow
+	for _, bound := range []struct {
+		text string
+		dst  *time.Duration
+	}{{from, &window.Start}, {to, &window.End}} {
+		t, err := time.Parse("15:04", strings.TrimSpace(bound.text))
+		if err != nil {
+			return MaintenanceWindow{}, fmt.Errorf("%w: %q", errInvalidMaintenanceWindow, raw)
+		}
+		*bound.dst = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	return window, nil
+}
+
+// defaultInstanceID returns the hostname, which is stable across restarts so a
+// restarted server still recognizes the resources it created.
+func defaultInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return "shsh"
+	}
+	return hostname
+}
+
 func getEnv(key, fallback string) string {
 	if value, ok := os.LookupEnv(key); ok {
 		return value
@@ -220,6 +1242,18 @@ func getEnvInt64(key string, fallback int64) int64 {
 	return n
 }
 
+func getEnvFloat(key string, fallback float64) float64 {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return fallback
+	}
+	return f
+}
+
 func getEnvDuration(key string, fallback time.Duration) time.Duration {
 	value, ok := os.LookupEnv(key)
 	if !ok {
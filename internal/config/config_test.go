@@ -0,0 +1,30 @@
+package config
+
+import "testing"
+
+func TestPublicProfileDeniesAllowlistEgress(t *testing.T) {
+	t.Setenv("SHSH_PROFILE", ProfilePublic)
+	t.Setenv("SHSH_CONTAINER_EGRESS_POLICY", EgressAllowlist)
+	t.Setenv("SHSH_CONTAINER_EGRESS_ALLOW", "pypi.org,10.20.0.0/16")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Container.EgressPolicy != EgressDeny {
+		t.Fatalf("expected egress policy %q in the public profile, got %q", EgressDeny, cfg.Container.EgressPolicy)
+	}
+}
+
+func TestPublicProfileDisablesCommandPreview(t *testing.T) {
+	t.Setenv("SHSH_PROFILE", ProfilePublic)
+	t.Setenv("SHSH_COMMAND_PREVIEW", "true")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.CommandPreview {
+		t.Fatal("expected command previews off in the public profile")
+	}
+}
@@ -0,0 +1,108 @@
+package container
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+)
+
+// Reasons recorded with container lifecycle events.
+const (
+	ReasonProvision    = "provision"     // Created or started for a provision request
+	ReasonRestart      = "restart"       // Stopped container restarted within the grace period
+	ReasonUnpause      = "unpause"       // Paused container resumed on provision
+	ReasonUnbound      = "unbound"       // Stale container no longer bound to its user, recreated
+	ReasonRecreate     = "recreate"      // Stopped past the grace period, recreated
+	ReasonNameConflict = "name_conflict" // Leftover container holding the name of a new one
+	ReasonTTL          = "ttl"           // Session idle past its TTL
+	ReasonUnhealthy    = "unhealthy"     // Failed consecutive health probes
+	ReasonOOMKilled    = "oom_killed"    // Killed by the kernel for exceeding its memory limit
+	ReasonCrashed      = "crashed"       // Main process exited without the server stopping it
+	ReasonOrphaned     = "orphaned"      // Owner no longer exists
+	ReasonUserDestroy  = "user_destroy"  // Destroyed by its user
+	ReasonSelfTest     = "selftest"      // Throwaway container of a deployment self-test
+	ReasonAbuse        = "abuse"         // Terminated after repeated blocked commands
+	ReasonImageChange  = "image_change"  // Replaced by a container of the image its user picked
+	ReasonEgressPolicy = "egress_policy" // Started, but its egress allowlist could not be applied
+	ReasonSudoExpired  = "sudo_expired"  // Sudo grant reached its duration
+	ReasonSudoReleased = "sudo_released" // Sudo grant given up before it expired
+	ReasonLab          = "lab"           // Node of a multi-container lab topology
+)
+
+// defaultEventWriteTimeout bounds writing a lifecycle event, which happens
+// even if the operation's context was cancelled.
+const defaultEventWriteTimeout = 5 * time.Second
+
+// EventRecorder stores container lifecycle events; store.Repository
+// implements it.
+type EventRecorder interface {
+	InsertContainerEvent(ctx context.Context, e *domain.ContainerEvent) error
+}
+
+// EventAuditor is implemented by managers that record the containers they
+// create, start and stop.
+type EventAuditor interface {
+	// SetEventRecorder records lifecycle events to r. It must be called
+	// before containers are managed.
+	SetEventRecorder(r EventRecorder)
+}
+
+type lifecycleReasonKey struct{}
+
+// WithLifecycleReason returns a context whose StopContainer and
+// EnsureContainer calls record reason with their events.
+func WithLifecycleReason(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, lifecycleReasonKey{}, reason)
+}
+
+// lifecycleReason returns the reason attached to ctx, or fallback.
+func lifecycleReason(ctx context.Context, fallback string) string {
+	if reason, ok := ctx.Value(lifecycleReasonKey{}).(string); ok && reason != "" {
+		return reason
+	}
+	return fallback
+}
+
+// RecordEvent writes a lifecycle event to r, logging failures; the audit log
+// must not fail the operation it describes. A nil r or missing user is a
+// no-op.
+func RecordEvent(ctx context.Context, r EventRecorder, userID, containerID string, event domain.ContainerEventType, reason string) {
+	if r == nil || userID == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), defaultEventWriteTimeout)
+	defer cancel()
+	e := &domain.ContainerEvent{
+		UserID:      userID,
+		ContainerID: containerID,
+		Event:       event,
+		Reason:      reason,
+		CreatedAt:   time.Now(),
+	}
+	if err := r.InsertContainerEvent(ctx, e); err != nil {
+		slog.Warn("Failed to record container event",
+			"error", err,
+			"user_id", userID,
+			"container_id", containerID,
+			"event", event)
+	}
+}
+
+// SetEventRecorder records lifecycle events to r.
+func (m *DockerManager) SetEventRecorder(r EventRecorder) {
+	m.events = r
+}
+
+// SetEventRecorder records lifecycle events on every host to r.
+func (p *PoolManager) SetEventRecorder(r EventRecorder) {
+	for _, host := range p.hosts {
+		host.mgr.SetEventRecorder(r)
+	}
+}
+
+// SetEventRecorder records lifecycle events to r.
+func (m *KubernetesManager) SetEventRecorder(r EventRecorder) {
+	m.events = r
+}
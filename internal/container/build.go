@@ -0,0 +1,327 @@
+package container
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/build"
+)
+
+// buildTimeout bounds building one image.
+const buildTimeout = 30 * time.Minute
+
+var (
+	ErrBuildRunning  = errors.New("an image build is already running")
+	ErrBuildNotFound = errors.New("no such image to build")
+	errNoBuildHost   = errors.New("no healthy docker host to build on")
+)
+
+// labelBuildDigest records on a built image the digest of the context it was
+// built from, so an unchanged context is not built again.
+const labelBuildDigest = "shsh.build.digest"
+
+// Build states of an image.
+const (
+	BuildPending  = "pending"
+	BuildRunning  = "building"
+	BuildCached   = "cached" // The host already had an image of the same context
+	BuildComplete = "built"
+	BuildFailed   = "failed"
+)
+
+// BuildSpec describes an image built from a Dockerfile, such as the image of
+// a challenge's lab.
+type BuildSpec struct {
+	Ref     string // Tag the image is built as
+	Source  string // What the image is built for, e.g. the challenge ID
+	Context fs.FS  // Build context, with the Dockerfile at its root
+}
+
+// BuildResult is the outcome of building one image.
+type BuildResult struct {
+	Ref    string `json:"ref"`
+	Digest string `json:"digest"` // Digest of the build context
+	Cached bool   `json:"cached"`
+}
+
+// BuildSource returns the images to build, such as those curriculum authors
+// ship as Dockerfiles with their challenges.
+type BuildSource func() []BuildSpec
+
+// ImageBuilder is implemented by managers that can build images on their
+// hosts.
+type ImageBuilder interface {
+	// BuildImage builds spec and tags it as spec.Ref. A host that already
+	// has an image built from the same context keeps it unless force is
+	// set, which also skips the build cache.
+	BuildImage(ctx context.Context, spec BuildSpec, force bool) (BuildResult, error)
+}
+
+// BuildImage builds spec on the host.
+func (m *DockerManager) BuildImage(ctx context.Context, spec BuildSpec, force bool) (BuildResult, error) {
+	digest, err := contextDigest(spec.Context)
+	if err != nil {
+		return BuildResult{}, fmt.Errorf("build image %s: %w", spec.Ref, err)
+	}
+	result := BuildResult{Ref: spec.Ref, Digest: digest}
+	if !force {
+		inspect, err := m.cli.ImageInspect(ctx, spec.Ref)
+		if err == nil && inspect.Config != nil && inspect.Config.Labels[labelBuildDigest] == digest {
+			result.Cached = true
+			return result, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, buildTimeout)
+	defer cancel()
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := tw.AddFS(spec.Context)
+		if err == nil {
+			err = tw.Close()
+		}
+		_ = pw.CloseWithError(err)
+	}()
+	defer func() { _ = pr.Close() }()
+
+	slog.Info("Building image", "image", spec.Ref, "source", spec.Source, "force", force)
+	start := time.Now()
+	resp, err := m.cli.ImageBuild(ctx, pr, build.ImageBuildOptions{
+		Tags:        []string{spec.Ref},
+		Labels:      map[string]string{labelBuildDigest: digest, labelInstance: m.instanceID()},
+		Remove:      true,
+		ForceRemove: true,
+		NoCache:     force,
+		PullParent:  force,
+	})
+	if err != nil {
+		return BuildResult{}, fmt.Errorf("build image %s: %w", spec.Ref, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// The build only completes once its output stream has been consumed.
+	if err := readBuildOutput(resp.Body); err != nil {
+		return BuildResult{}, fmt.Errorf("build image %s: %w", spec.Ref, err)
+	}
+	slog.Info("Built image", "image", spec.Ref, "source", spec.Source, "elapsed", time.Since(start).Round(time.Second))
+	return result, nil
+}
+
+// buildMessage is one message of the Docker image build output stream.
+type buildMessage struct {
+	Stream string `json:"stream"`
+	Error  string `json:"error"`
+}
+
+// maxBuildErrorOutput bounds the build output quoted in an error.
+const maxBuildErrorOutput = 20
+
+// readBuildOutput consumes a build's output stream and returns the error it
+// reports, with the last lines of output for context, as a failed build
+// still ends the stream normally.
+func readBuildOutput(r io.Reader) error {
+	var tail []string
+	dec := json.NewDecoder(r)
+	for {
+		var msg buildMessage
+		err := dec.Decode(&msg)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Error != "" {
+			if len(tail) == 0 {
+				return errors.New(msg.Error)
+			}
+			return fmt.Errorf("%s\n%s", msg.Error, strings.Join(tail, "\n"))
+		}
+		if line := strings.TrimSpace(msg.Stream); line != "" {
+			tail = append(tail, line)
+			if len(tail) > maxBuildErrorOutput {
+				tail = tail[1:]
+			}
+		}
+	}
+}
+
+// contextDigest returns a digest of the paths, permissions and contents of
+// the files of a build context. Modification times are left out, so a
+// context checked out again hashes the same.
+func contextDigest(fsys fs.FS) (string, error) {
+	h := sha256.New()
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%o\x00", name, info.Mode())
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		fmt.Fprintf(h, "%d\x00", info.Size())
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("hash build context: %w", err)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// BuildImage builds spec on every healthy host, so a lab can start on
+// whichever host its learner's container runs. The result is cached only
+// if every host had the image.
+func (p *PoolManager) BuildImage(ctx context.Context, spec BuildSpec, force bool) (BuildResult, error) {
+	result := BuildResult{Ref: spec.Ref, Cached: true}
+	built := 0
+	for _, host := range p.hosts {
+		if !p.isHealthy(host) {
+			continue
+		}
+		hostResult, err := host.mgr.BuildImage(ctx, spec, force)
+		if err != nil {
+			return BuildResult{}, fmt.Errorf("host %s: %w", host.Name, err)
+		}
+		result.Digest = hostResult.Digest
+		result.Cached = result.Cached && hostResult.Cached
+		built++
+	}
+	if built == 0 {
+		return BuildResult{}, fmt.Errorf("build image %s: %w", spec.Ref, errNoBuildHost)
+	}
+	return result, nil
+}
+
+// ImageBuild is the latest build of one image.
+type ImageBuild struct {
+	Ref        string    `json:"ref"`
+	Source     string    `json:"source"`
+	State      string    `json:"state"`
+	Digest     string    `json:"digest,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+}
+
+// Builder builds the images of a BuildSource in the background, one at a
+// time, and keeps the outcome of each image's latest build.
+type Builder struct {
+	builder ImageBuilder
+	src     BuildSource
+
+	mu      sync.Mutex
+	running bool
+	builds  map[string]ImageBuild // By ref
+}
+
+// NewBuilder creates a builder of src's images on b's hosts.
+func NewBuilder(b ImageBuilder, src BuildSource) *Builder {
+	return &Builder{builder: b, src: src, builds: make(map[string]ImageBuild)}
+}
+
+// Build starts building in the background the images src returns whose ref
+// is in refs, or all of them if refs is empty. Images whose context is
+// unchanged are kept unless force is set. It returns ErrBuildRunning while
+// an earlier build runs and ErrBuildNotFound if src has no image of one of
+// refs. The build runs until it finishes or ctx is cancelled.
+func (b *Builder) Build(ctx context.Context, force bool, refs ...string) error {
+	specs := b.src()
+	if len(refs) > 0 {
+		for _, ref := range refs {
+			if !slices.ContainsFunc(specs, func(spec BuildSpec) bool { return spec.Ref == ref }) {
+				return fmt.Errorf("%w: %s", ErrBuildNotFound, ref)
+			}
+		}
+		specs = slices.DeleteFunc(specs, func(spec BuildSpec) bool { return !slices.Contains(refs, spec.Ref) })
+	}
+	if !b.begin(specs) {
+		return ErrBuildRunning
+	}
+	go b.run(ctx, specs, force)
+	return nil
+}
+
+// begin marks specs as pending and reports whether no build was running.
+func (b *Builder) begin(specs []BuildSpec) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.running {
+		return false
+	}
+	b.running = true
+	for _, spec := range specs {
+		b.builds[spec.Ref] = ImageBuild{Ref: spec.Ref, Source: spec.Source, State: BuildPending}
+	}
+	return true
+}
+
+func (b *Builder) run(ctx context.Context, specs []BuildSpec, force bool) {
+	defer b.finish()
+	failed := 0
+	for _, spec := range specs {
+		b.record(ImageBuild{Ref: spec.Ref, Source: spec.Source, State: BuildRunning})
+		result, err := b.builder.BuildImage(ctx, spec, force)
+		build := ImageBuild{Ref: spec.Ref, Source: spec.Source, Digest: result.Digest, FinishedAt: time.Now()}
+		switch {
+		case err != nil:
+			slog.Warn("Failed to build image", "error", err, "image", spec.Ref, "source", spec.Source)
+			build.State, build.Error = BuildFailed, err.Error()
+			failed++
+		case result.Cached:
+			build.State = BuildCached
+		default:
+			build.State = BuildComplete
+		}
+		b.record(build)
+	}
+	if failed > 0 {
+		slog.Warn("Image builds finished with failures", "images", len(specs), "failed", failed)
+	}
+}
+
+func (b *Builder) record(build ImageBuild) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.builds[build.Ref] = build
+}
+
+func (b *Builder) finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.running = false
+}
+
+// Status reports whether a build is running and the latest build of every
+// image, sorted by ref.
+func (b *Builder) Status() (bool, []ImageBuild) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	builds := make([]ImageBuild, 0, len(b.builds))
+	for _, build := range b.builds {
+		builds = append(builds, build)
+	}
+	slices.SortFunc(builds, func(a, b ImageBuild) int { return strings.Compare(a.Ref, b.Ref) })
+	return b.running, builds
+}
@@ -0,0 +1,167 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+
+	"github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// maxCaptureStderr bounds the tcpdump diagnostics kept for the log.
+const maxCaptureStderr = 4 * 1024
+
+// Capturer is implemented by managers that can record a container's network
+// traffic. tcpdump runs in a sidecar sharing the container's network
+// namespace, so the learner's container needs no extra capabilities.
+type Capturer interface {
+	// CaptureTraffic starts recording the container's traffic and returns it
+	// as a pcap stream. Closing the stream stops the capture; the stream
+	// also ends when the container stops.
+	CaptureTraffic(ctx context.Context, containerID string, opts CaptureOptions) (io.ReadCloser, error)
+}
+
+// CaptureOptions configures a traffic capture.
+type CaptureOptions struct {
+	Image   string // Image providing tcpdump; empty uses the playground image
+	SnapLen int    // Bytes kept of each packet; 0 uses tcpdump's default
+}
+
+// captureCmd returns the tcpdump invocation writing pcap to stdout, flushing
+// each packet so the stream can be read while the capture runs.
+func captureCmd(snapLen int) []string {
+	cmd := []string{"tcpdump", "-i", "any", "-n", "-U", "-w", "-"}
+	if snapLen > 0 {
+		cmd = append(cmd, "-s", strconv.Itoa(snapLen))
+	}
+	return cmd
+}
+
+// CaptureTraffic runs tcpdump in a short-lived sidecar joined to the
+// container's network namespace. The sidecar keeps only the capabilities
+// tcpdump needs to open a raw socket and drop to its own user.
+func (m *DockerManager) CaptureTraffic(ctx context.Context, containerID string, opts CaptureOptions) (io.ReadCloser, error) {
+	inspect, err := m.cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("inspect container %s: %w", containerID, err)
+	}
+	if inspect.State == nil || !inspect.State.Running {
+		return nil, errContainerNotRunning
+	}
+
+	image := opts.Image
+	if image == "" {
+		image = imageName
+	}
+	if err := m.ensureImage(ctx, image); err != nil {
+		return nil, err
+	}
+
+	var owner string
+	if inspect.Config != nil {
+		owner = inspect.Config.Labels[labelOwner]
+	}
+	config := &container.Config{
+		Image:        image,
+		User:         "0",
+		Entrypoint:   captureCmd(opts.SnapLen),
+		AttachStdout: true,
+		AttachStderr: true,
+		Labels:       m.resourceLabels(owner, ""),
+	}
+	hostConfig := &container.HostConfig{
+		NetworkMode: container.NetworkMode("container:" + containerID),
+		CapDrop:     []string{"ALL"},
+		CapAdd:      []string{"NET_RAW", "SETUID", "SETGID"},
+		SecurityOpt: []string{"no-new-privileges"},
+		Resources: container.Resources{
+			PidsLimit: ptr(int64(16)),
+		},
+	}
+	resp, err := m.cli.ContainerCreate(ctx, config, hostConfig, nil, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("create capture sidecar: %w", err)
+	}
+	stream := &captureStream{m: m, id: resp.ID}
+
+	attach, err := m.cli.ContainerAttach(ctx, resp.ID, container.AttachOptions{Stream: true, Stdout: true, Stderr: true})
+	if err != nil {
+		stream.remove(ctx)
+		return nil, fmt.Errorf("attach capture sidecar: %w", err)
+	}
+	if err := m.cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		attach.Close()
+		stream.remove(ctx)
+		return nil, fmt.Errorf("start capture sidecar: %w", err)
+	}
+
+	pr, pw := io.Pipe()
+	stream.PipeReader = pr
+	go func() {
+		defer attach.Close()
+		stderr := &limitedBuffer{max: maxCaptureStderr}
+		_, err := stdcopy.StdCopy(pw, stderr, attach.Reader)
+		if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) > 0 {
+			slog.Debug("Capture sidecar output", "container_id", containerID, "output", string(msg))
+		}
+		_ = pw.CloseWithError(err)
+	}()
+
+	slog.Info("Traffic capture started", "user_id", owner, "container_id", containerID, "sidecar_id", resp.ID)
+	return stream, nil
+}
+
+// captureStream is the pcap output of a capture sidecar; closing it removes
+// the sidecar.
+type captureStream struct {
+	*io.PipeReader
+	m    *DockerManager
+	id   string
+	once sync.Once
+}
+
+// Close stops the capture.
+func (s *captureStream) Close() error {
+	if s.PipeReader != nil {
+		_ = s.PipeReader.Close()
+	}
+	s.remove(context.Background())
+	return nil
+}
+
+func (s *captureStream) remove(ctx context.Context) {
+	s.once.Do(func() {
+		// Removal must happen even if ctx has expired.
+		if err := s.m.cli.ContainerRemove(context.WithoutCancel(ctx), s.id, container.RemoveOptions{Force: true}); err != nil && !errdefs.IsNotFound(err) {
+			slog.Warn("Failed to remove capture sidecar", "error", err, "container_id", s.id)
+		}
+	})
+}
+
+// limitedBuffer keeps the first max bytes written to it and discards the rest.
+type limitedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+// CaptureTraffic captures traffic on the host running the container.
+func (p *PoolManager) CaptureTraffic(ctx context.Context, containerID string, opts CaptureOptions) (io.ReadCloser, error) {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return nil, errContainerNotRunning
+	}
+	return host.mgr.CaptureTraffic(ctx, containerID, opts)
+}
@@ -0,0 +1,200 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+)
+
+// maxDiffPaths bounds the changed paths kept in a checkpoint's diff summary.
+const maxDiffPaths = 20
+
+// Shell scripts run by the volume copy helper, with the source volume at
+// /from and the destination at /to.
+const (
+	snapshotScript = "cp -a /from/. /to/"
+	restoreScript  = "find /to -mindepth 1 -delete && cp -a /from/. /to/"
+)
+
+var (
+	errVolumeCopyFailed     = errors.New("volume copy failed")
+	errCheckpointNotOwned   = errors.New("checkpoint belongs to another user")
+	errCheckpointNotPresent = errors.New("checkpoint volume not found")
+)
+
+// Checkpointer is implemented by managers that can snapshot a user's work
+// volume and later restore it. Only the work volume is restored; the diff
+// summary records what else changed in the container.
+type Checkpointer interface {
+	// CreateCheckpoint copies the user's work volume into a snapshot volume
+	// identified by key, replacing an earlier snapshot with the same key,
+	// and summarizes the container's filesystem changes outside the volume.
+	// It returns the snapshot volume name.
+	CreateCheckpoint(ctx context.Context, userID, containerID, key string) (string, domain.FilesystemDiff, error)
+
+	// RestoreCheckpoint replaces the contents of the user's work volume with
+	// a snapshot taken by CreateCheckpoint.
+	RestoreCheckpoint(ctx context.Context, userID, containerID, snapshot string) error
+}
+
+// checkpointVolumeName returns the name of a user's snapshot volume.
+func checkpointVolumeName(userID, key string) string {
+	return fmt.Sprintf("playground-%s-ckpt-%s", userID, key)
+}
+
+// CreateCheckpoint snapshots the user's work volume.
+func (m *DockerManager) CreateCheckpoint(ctx context.Context, userID, containerID, key string) (string, domain.FilesystemDiff, error) {
+	diff, err := m.filesystemDiff(ctx, containerID)
+	if err != nil {
+		return "", domain.FilesystemDiff{}, err
+	}
+
+	name := checkpointVolumeName(userID, key)
+	if err := m.cli.VolumeRemove(ctx, name, true); err != nil && !errdefs.IsNotFound(err) {
+		return "", domain.FilesystemDiff{}, fmt.Errorf("replace checkpoint volume %s: %w", name, err)
+	}
+	labels := m.resourceLabels(userID, "")
+	labels[labelCheckpoint] = key
+	if _, err := m.cli.VolumeCreate(ctx, volume.CreateOptions{Name: name, Labels: labels}); err != nil {
+		return "", domain.FilesystemDiff{}, fmt.Errorf("create checkpoint volume %s: %w", name, err)
+	}
+	if err := m.copyVolume(ctx, userID, volumeNameFor(userID), name, snapshotScript); err != nil {
+		if removeErr := m.cli.VolumeRemove(ctx, name, true); removeErr != nil && !errdefs.IsNotFound(removeErr) {
+			slog.Warn("Failed to remove incomplete checkpoint volume", "error", removeErr, "volume", name)
+		}
+		return "", domain.FilesystemDiff{}, err
+	}
+	slog.Info("Checkpoint created", "user_id", userID, "volume", name, "changed_paths", diff.Added+diff.Changed+diff.Deleted)
+	return name, diff, nil
+}
+
+// RestoreCheckpoint copies a snapshot back over the user's work volume.
+func (m *DockerManager) RestoreCheckpoint(ctx context.Context, userID, _ string, snapshot string) error {
+	v, err := m.cli.VolumeInspect(ctx, snapshot)
+	if errdefs.IsNotFound(err) {
+		return fmt.Errorf("%w: %s", errCheckpointNotPresent, snapshot)
+	}
+	if err != nil {
+		return fmt.Errorf("inspect checkpoint volume %s: %w", snapshot, err)
+	}
+	if v.Labels[labelOwner] != userID || v.Labels[labelCheckpoint] == "" {
+		return fmt.Errorf("%w: %s", errCheckpointNotOwned, snapshot)
+	}
+	if err := m.copyVolume(ctx, userID, snapshot, volumeNameFor(userID), restoreScript); err != nil {
+		return err
+	}
+	slog.Info("Checkpoint restored", "user_id", userID, "volume", snapshot)
+	return nil
+}
+
+// filesystemDiff summarizes the container's changes relative to its image.
+func (m *DockerManager) filesystemDiff(ctx context.Context, containerID string) (domain.FilesystemDiff, error) {
+	changes, err := m.cli.ContainerDiff(ctx, containerID)
+	if err != nil {
+		return domain.FilesystemDiff{}, fmt.Errorf("diff container %s: %w", containerID, err)
+	}
+	var diff domain.FilesystemDiff
+	for _, c := range changes {
+		switch c.Kind {
+		case container.ChangeAdd:
+			diff.Added++
+		case container.ChangeModify:
+			diff.Changed++
+		case container.ChangeDelete:
+			diff.Deleted++
+		}
+		if len(diff.Paths) < maxDiffPaths {
+			diff.Paths = append(diff.Paths, c.Kind.String()+" "+c.Path)
+		}
+	}
+	return diff, nil
+}
+
+// copyVolume runs script in a short-lived, offline helper container with
+// volume from mounted read-only at /from and volume to at /to. The helper
+// runs as root so ownership and modes are preserved.
+func (m *DockerManager) copyVolume(ctx context.Context, userID, from, to, script string) error {
+	config := &container.Config{
+		Image:  imageName,
+		User:   "0",
+		Cmd:    []string{"/bin/sh", "-c", script},
+		Labels: m.resourceLabels(userID, ""),
+	}
+	hostConfig := &container.HostConfig{
+		NetworkMode: "none",
+		Mounts: []mount.Mount{
+			{Type: mount.TypeVolume, Source: from, Target: "/from", ReadOnly: true},
+			{Type: mount.TypeVolume, Source: to, Target: "/to"},
+		},
+	}
+	resp, err := m.cli.ContainerCreate(ctx, config, hostConfig, nil, nil, "")
+	if err != nil {
+		return fmt.Errorf("create volume copy helper: %w", err)
+	}
+	defer func() {
+		// Removal must happen even if ctx has expired.
+		if err := m.cli.ContainerRemove(context.WithoutCancel(ctx), resp.ID, container.RemoveOptions{Force: true}); err != nil && !errdefs.IsNotFound(err) {
+			slog.Warn("Failed to remove volume copy helper", "error", err, "container_id", resp.ID)
+		}
+	}()
+
+	waitC, errC := m.cli.ContainerWait(ctx, resp.ID, container.WaitConditionNextExit)
+	if err := m.cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		return fmt.Errorf("start volume copy helper: %w", err)
+	}
+	select {
+	case res := <-waitC:
+		if res.StatusCode != 0 {
+			return fmt.Errorf("%w: %s to %s exited with %d", errVolumeCopyFailed, from, to, res.StatusCode)
+		}
+		return nil
+	case err := <-errC:
+		return fmt.Errorf("wait for volume copy helper: %w", err)
+	}
+}
+
+// removeCheckpointVolumes deletes every snapshot volume of a user.
+func (m *DockerManager) removeCheckpointVolumes(ctx context.Context, userID string) error {
+	list, err := m.cli.VolumeList(ctx, volume.ListOptions{Filters: filters.NewArgs(
+		filters.Arg("label", labelOwner+"="+userID),
+		filters.Arg("label", labelCheckpoint),
+	)})
+	if err != nil {
+		return fmt.Errorf("list checkpoint volumes for %s: %w", userID, err)
+	}
+	var errs []error
+	for _, v := range list.Volumes {
+		if err := m.cli.VolumeRemove(ctx, v.Name, true); err != nil && !errdefs.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("remove checkpoint volume %s: %w", v.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CreateCheckpoint snapshots the user's work volume on the host running
+// their container.
+func (p *PoolManager) CreateCheckpoint(ctx context.Context, userID, containerID, key string) (string, domain.FilesystemDiff, error) {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return "", domain.FilesystemDiff{}, errContainerNotRunning
+	}
+	return host.mgr.CreateCheckpoint(ctx, userID, containerID, key)
+}
+
+// RestoreCheckpoint restores a snapshot on the host running the user's
+// container, which also holds their volumes.
+func (p *PoolManager) RestoreCheckpoint(ctx context.Context, userID, containerID, snapshot string) error {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return errContainerNotRunning
+	}
+	return host.mgr.RestoreCheckpoint(ctx, userID, containerID, snapshot)
+}
@@ -0,0 +1,74 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// CommandRunner is implemented by managers that can run a one-off command in
+// a user's container and capture what it prints.
+type CommandRunner interface {
+	// RunCommand runs cmd as the terminal user on a TTY, so the output has
+	// terminal line endings and colors, and returns at most maxOutput bytes
+	// of it with the exit code.
+	RunCommand(ctx context.Context, containerID string, cmd []string, maxOutput int) ([]byte, int, error)
+}
+
+// RunCommand runs cmd in the container and captures its terminal output.
+func (m *DockerManager) RunCommand(ctx context.Context, containerID string, cmd []string, maxOutput int) ([]byte, int, error) {
+	resp, err := m.cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          cmd,
+		User:         containerUser,
+		AttachStdout: true,
+		AttachStderr: true,
+		Tty:          true,
+		ConsoleSize:  &[2]uint{defaultCols, defaultRows},
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("create exec: %w", err)
+	}
+
+	attachResp, err := m.cli.ContainerExecAttach(ctx, resp.ID, container.ExecStartOptions{Tty: true})
+	if err != nil {
+		return nil, 0, fmt.Errorf("attach exec: %w", err)
+	}
+	defer attachResp.Close()
+
+	var out bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		_, readErr := io.Copy(&out, io.LimitReader(attachResp.Reader, int64(maxOutput)))
+		if readErr == nil {
+			// Drain the rest so the command is not blocked writing to a full pipe.
+			_, readErr = io.Copy(io.Discard, attachResp.Reader)
+		}
+		done <- readErr
+	}()
+	select {
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	case readErr := <-done:
+		if readErr != nil {
+			return nil, 0, fmt.Errorf("read exec output: %w", readErr)
+		}
+	}
+
+	inspect, err := m.cli.ContainerExecInspect(ctx, resp.ID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("inspect exec: %w", err)
+	}
+	return out.Bytes(), inspect.ExitCode, nil
+}
+
+// RunCommand runs cmd in a container on whichever host runs it.
+func (p *PoolManager) RunCommand(ctx context.Context, containerID string, cmd []string, maxOutput int) ([]byte, int, error) {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return nil, 0, errContainerNotRunning
+	}
+	return host.mgr.RunCommand(ctx, containerID, cmd, maxOutput)
+}
@@ -0,0 +1,193 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+)
+
+var errEgressRulesFailed = errors.New("egress rules could not be applied")
+
+// egressPolicy returns the configured egress policy.
+func egressPolicy(cfg *config.Config) string {
+	if cfg == nil || cfg.Container.EgressPolicy == "" {
+		return config.EgressFull
+	}
+	return cfg.Container.EgressPolicy
+}
+
+// egressRulesScript returns the iptables commands limiting a container's
+// outbound traffic to loopback, replies, DNS to its resolvers and the
+// allowlist. iptables resolves domains when a rule is added, so a domain
+// covers the IPv4 addresses it had when the container started. When the
+// kernel has IPv6, ip6tables gets the same rules so the allowlist cannot be
+// bypassed over IPv6; there only IPv6 addresses and CIDRs are allowed.
+func egressRulesScript(allow, resolvers []string) string {
+	allow4, allow6 := splitByFamily(allow)
+	resolvers4, resolvers6 := splitByFamily(resolvers)
+	var b strings.Builder
+	b.WriteString("set -e\n")
+	writeEgressRules(&b, "iptables", allow4, resolvers4)
+	b.WriteString("if [ -e /proc/net/if_inet6 ]; then\n")
+	writeEgressRules(&b, "ip6tables", allow6, resolvers6)
+	b.WriteString("fi\n")
+	return b.String()
+}
+
+// writeEgressRules writes the OUTPUT chain of one iptables binary.
+func writeEgressRules(b *strings.Builder, iptables string, allow, resolvers []string) {
+	fmt.Fprintf(b, "%s -F OUTPUT\n", iptables)
+	fmt.Fprintf(b, "%s -A OUTPUT -o lo -j ACCEPT\n", iptables)
+	fmt.Fprintf(b, "%s -A OUTPUT -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT\n", iptables)
+	for _, resolver := range resolvers {
+		fmt.Fprintf(b, "%s -A OUTPUT -d '%s' -p udp --dport 53 -j ACCEPT\n", iptables, resolver)
+		fmt.Fprintf(b, "%s -A OUTPUT -d '%s' -p tcp --dport 53 -j ACCEPT\n", iptables, resolver)
+	}
+	for _, entry := range allow {
+		fmt.Fprintf(b, "%s -A OUTPUT -d '%s' -j ACCEPT\n", iptables, entry)
+	}
+	fmt.Fprintf(b, "%s -A OUTPUT -j REJECT\n", iptables)
+}
+
+// splitByFamily separates IPv6 addresses and CIDRs from the other entries,
+// which are IPv4 addresses, CIDRs and domains.
+func splitByFamily(entries []string) (v4, v6 []string) {
+	for _, entry := range entries {
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			ip, _, _ = net.ParseCIDR(entry)
+		}
+		if ip != nil && ip.To4() == nil {
+			v6 = append(v6, entry)
+		} else {
+			v4 = append(v4, entry)
+		}
+	}
+	return v4, v6
+}
+
+// egressResolvers returns the DNS servers a container may query: Docker's
+// embedded DNS and the upstream servers it forwards to from the container's
+// network namespace.
+func egressResolvers() []string {
+	return append([]string{dockerEmbeddedDNS}, containerDNS...)
+}
+
+// enforceEgress applies the allowlist to a container that was just started.
+// The rules live in the container's network namespace, so they are applied
+// on every start. A container the rules could not be applied to is removed
+// rather than left with open egress.
+func (m *DockerManager) enforceEgress(ctx context.Context, userID, containerID string) error {
+	if egressPolicy(m.cfg) != config.EgressAllowlist {
+		return nil
+	}
+	if err := m.applyEgressRules(ctx, userID, containerID); err != nil {
+		if stopErr := m.StopContainer(WithLifecycleReason(ctx, ReasonEgressPolicy), containerID); stopErr != nil {
+			slog.Warn("Failed to remove container without egress rules", "error", stopErr, "container_id", containerID)
+		}
+		return err
+	}
+	return nil
+}
+
+// applyEgressRules runs iptables in a short-lived sidecar joined to the
+// container's network namespace. Only the sidecar holds NET_ADMIN, so not
+// even root in the learner's container can change the rules.
+func (m *DockerManager) applyEgressRules(ctx context.Context, userID, containerID string) error {
+	image := m.cfg.Container.EgressImage
+	if image == "" {
+		image = imageName
+	}
+	if err := m.ensureImage(ctx, image); err != nil {
+		return err
+	}
+
+	config := &container.Config{
+		Image:      image,
+		User:       "0",
+		Entrypoint: []string{"/bin/sh", "-c", egressRulesScript(m.egressAllow(), egressResolvers())},
+		Labels:     m.resourceLabels(userID, ""),
+	}
+	hostConfig := &container.HostConfig{
+		NetworkMode: container.NetworkMode("container:" + containerID),
+		CapDrop:     []string{"ALL"},
+		CapAdd:      []string{"NET_ADMIN", "NET_RAW"},
+		SecurityOpt: []string{"no-new-privileges"},
+		Resources: container.Resources{
+			PidsLimit: ptr(int64(16)),
+		},
+	}
+	resp, err := m.cli.ContainerCreate(ctx, config, hostConfig, nil, nil, "")
+	if err != nil {
+		return fmt.Errorf("create egress sidecar: %w", err)
+	}
+	defer func() {
+		// Removal must happen even if ctx has expired.
+		if err := m.cli.ContainerRemove(context.WithoutCancel(ctx), resp.ID, container.RemoveOptions{Force: true}); err != nil && !errdefs.IsNotFound(err) {
+			slog.Warn("Failed to remove egress sidecar", "error", err, "container_id", resp.ID)
+		}
+	}()
+
+	waitC, errC := m.cli.ContainerWait(ctx, resp.ID, container.WaitConditionNextExit)
+	if err := m.cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		return fmt.Errorf("start egress sidecar: %w", err)
+	}
+	select {
+	case res := <-waitC:
+		if res.StatusCode != 0 {
+			return fmt.Errorf("%w: container %s, sidecar exited with %d", errEgressRulesFailed, containerID, res.StatusCode)
+		}
+	case err := <-errC:
+		return fmt.Errorf("wait for egress sidecar: %w", err)
+	}
+	slog.Info("Egress allowlist applied", "user_id", userID, "container_id", containerID, "entries", len(m.cfg.Container.EgressAllow))
+	return nil
+}
+
+// egressAllow returns the allowlist, with the package proxy when it is
+// enabled so apt and pip keep working.
+func (m *DockerManager) egressAllow() []string {
+	allow := m.cfg.Container.EgressAllow
+	if packageProxyEnabled(m.cfg) {
+		allow = append(slices.Clip(allow), pkgProxyIP)
+	}
+	return allow
+}
+
+// egressCIDRs resolves an allowlist into CIDRs, for network policies that
+// cannot name domains. Domains resolve to their IPv4 addresses.
+func egressCIDRs(ctx context.Context, allow []string) ([]string, error) {
+	var cidrs []string
+	for _, entry := range allow {
+		if _, _, err := net.ParseCIDR(entry); err == nil {
+			cidrs = append(cidrs, entry)
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			if ip.To4() == nil {
+				cidrs = append(cidrs, entry+"/128")
+			} else {
+				cidrs = append(cidrs, entry+"/32")
+			}
+			continue
+		}
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, entry)
+		if err != nil {
+			return nil, fmt.Errorf("resolve egress allowlist entry %s: %w", entry, err)
+		}
+		for _, addr := range addrs {
+			if ip4 := addr.IP.To4(); ip4 != nil {
+				cidrs = append(cidrs, ip4.String()+"/32")
+			}
+		}
+	}
+	return cidrs, nil
+}
@@ -0,0 +1,40 @@
+package container
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEgressRulesScript(t *testing.T) {
+	script := egressRulesScript(
+		[]string{"pypi.org", "10.0.0.0/8", "2001:db8::/32"},
+		[]string{"127.0.0.11", "8.8.8.8", "2001:4860:4860::8888"},
+	)
+	lines := strings.Split(strings.TrimSpace(script), "\n")
+
+	for _, want := range []string{
+		"iptables -A OUTPUT -d '8.8.8.8' -p udp --dport 53 -j ACCEPT",
+		"iptables -A OUTPUT -d '127.0.0.11' -p tcp --dport 53 -j ACCEPT",
+		"iptables -A OUTPUT -d 'pypi.org' -j ACCEPT",
+		"iptables -A OUTPUT -d '10.0.0.0/8' -j ACCEPT",
+		"ip6tables -A OUTPUT -d '2001:4860:4860::8888' -p udp --dport 53 -j ACCEPT",
+		"ip6tables -A OUTPUT -d '2001:db8::/32' -j ACCEPT",
+		"ip6tables -A OUTPUT -j REJECT",
+	} {
+		if !slices.Contains(lines, want) {
+			t.Errorf("script lacks %q:\n%s", want, script)
+		}
+	}
+	for _, line := range lines {
+		if strings.Contains(line, "--dport 53") && !strings.Contains(line, " -d '") {
+			t.Errorf("DNS rule allows any destination: %q", line)
+		}
+		if strings.HasPrefix(line, "ip6tables") && strings.Contains(line, "pypi.org") {
+			t.Errorf("domain added to ip6tables: %q", line)
+		}
+		if strings.HasPrefix(line, "iptables") && strings.Contains(line, "2001:") {
+			t.Errorf("IPv6 entry added to iptables: %q", line)
+		}
+	}
+}
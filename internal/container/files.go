@@ -0,0 +1,238 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// File access failures FileBrowser methods report.
+var (
+	ErrFileNotFound = errors.New("file not found")
+	ErrFileType     = errors.New("wrong file type") // A directory where a file is expected, or the reverse
+	ErrFileDenied   = errors.New("permission denied")
+	ErrFileTooLarge = errors.New("file too large")
+)
+
+// Exit codes of the file scripts, mapped to the errors above.
+const (
+	exitFileNotFound = 2
+	exitFileType     = 3
+	exitFileDenied   = 4
+)
+
+// maxFileStderr bounds the diagnostics kept from a file script.
+const maxFileStderr = 4 * 1024
+
+// FileEntry is an entry of a directory in a user's work volume.
+type FileEntry struct {
+	Name     string    `json:"name"`
+	Type     string    `json:"type"` // "file", "dir", "symlink" or "other"
+	Size     int64     `json:"size"`
+	Mode     string    `json:"mode"` // Permission bits in octal, e.g. 0644
+	Modified time.Time `json:"modified"`
+}
+
+// FileBrowser is implemented by managers that can reach the files of a
+// user's work volume through their running container. Paths are relative
+// to the volume and cannot leave it; files are accessed as the terminal
+// user, so the learner's own permissions apply.
+type FileBrowser interface {
+	// ListFiles lists the entries of directory dir.
+	ListFiles(ctx context.Context, containerID, dir string) ([]FileEntry, error)
+	// ReadFile returns the content of file name, failing with
+	// ErrFileTooLarge if it holds more than maxBytes.
+	ReadFile(ctx context.Context, containerID, name string, maxBytes int64) ([]byte, error)
+	// WriteFile replaces file name with content, creating missing parent
+	// directories.
+	WriteFile(ctx context.Context, containerID, name string, content io.Reader) error
+}
+
+// workPath returns the absolute path of name in the work volume. Cleaning it
+// as an absolute path first drops any .. that would leave the volume.
+func workPath(name string) string {
+	return path.Join(mountPath, path.Clean("/"+name))
+}
+
+// listFilesScript prints the entries of directory $1, NUL-terminated.
+var listFilesScript = fmt.Sprintf(`[ -e "$1" ] || exit %d
+[ -d "$1" ] || exit %d
+[ -r "$1" ] && [ -x "$1" ] || exit %d
+exec find "$1" -mindepth 1 -maxdepth 1 -printf '%%y\t%%s\t%%T@\t%%m\t%%f\0'
+`, exitFileNotFound, exitFileType, exitFileDenied)
+
+// readFileScript prints at most $2 bytes of file $1.
+var readFileScript = fmt.Sprintf(`[ -e "$1" ] || exit %d
+[ -f "$1" ] || exit %d
+[ -r "$1" ] || exit %d
+exec head -c "$2" -- "$1"
+`, exitFileNotFound, exitFileType, exitFileDenied)
+
+// writeFileScript replaces file $1 with its standard input.
+var writeFileScript = fmt.Sprintf(`[ -d "$1" ] && exit %d
+mkdir -p -- "$(dirname -- "$1")" 2>/dev/null || exit %d
+[ ! -e "$1" ] || [ -w "$1" ] || exit %d
+exec cat > "$1"
+`, exitFileType, exitFileDenied, exitFileDenied)
+
+// ListFiles lists a directory of the work volume.
+func (m *DockerManager) ListFiles(ctx context.Context, containerID, dir string) ([]FileEntry, error) {
+	var out bytes.Buffer
+	if err := m.runFileScript(ctx, containerID, listFilesScript, []string{workPath(dir)}, nil, &out); err != nil {
+		return nil, err
+	}
+	return parseFileEntries(out.Bytes()), nil
+}
+
+// ReadFile reads a file of the work volume.
+func (m *DockerManager) ReadFile(ctx context.Context, containerID, name string, maxBytes int64) ([]byte, error) {
+	var out bytes.Buffer
+	limit := strconv.FormatInt(maxBytes+1, 10)
+	if err := m.runFileScript(ctx, containerID, readFileScript, []string{workPath(name), limit}, nil, &out); err != nil {
+		return nil, err
+	}
+	if int64(out.Len()) > maxBytes {
+		return nil, ErrFileTooLarge
+	}
+	return out.Bytes(), nil
+}
+
+// WriteFile writes a file of the work volume.
+func (m *DockerManager) WriteFile(ctx context.Context, containerID, name string, content io.Reader) error {
+	return m.runFileScript(ctx, containerID, writeFileScript, []string{workPath(name)}, content, io.Discard)
+}
+
+// runFileScript runs script with args as the terminal user, feeding it stdin
+// if set and copying its output to stdout.
+func (m *DockerManager) runFileScript(ctx context.Context, containerID, script string, args []string, stdin io.Reader, stdout io.Writer) error {
+	cmd := append([]string{"/bin/sh", "-c", script, "sh"}, args...)
+	stderr := &limitedBuffer{max: maxFileStderr}
+	exitCode, err := m.execStream(ctx, containerID, containerUser, cmd, stdin, stdout, stderr)
+	if err != nil {
+		return err
+	}
+	switch exitCode {
+	case 0:
+		return nil
+	case exitFileNotFound:
+		return ErrFileNotFound
+	case exitFileType:
+		return ErrFileType
+	case exitFileDenied:
+		return ErrFileDenied
+	default:
+		return fmt.Errorf("file script exited with %d: %s", exitCode, strings.TrimSpace(stderr.String()))
+	}
+}
+
+// execStream runs cmd in the container without a TTY, feeding it stdin if
+// set, and returns its exit code once its output has been copied.
+func (m *DockerManager) execStream(ctx context.Context, containerID, user string, cmd []string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	resp, err := m.cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          cmd,
+		User:         user,
+		AttachStdin:  stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("create exec: %w", err)
+	}
+
+	attachResp, err := m.cli.ContainerExecAttach(ctx, resp.ID, container.ExecStartOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("attach exec: %w", err)
+	}
+	defer attachResp.Close()
+
+	if stdin != nil {
+		go func() {
+			_, _ = io.Copy(attachResp.Conn, stdin)
+			_ = attachResp.CloseWrite()
+		}()
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, readErr := stdcopy.StdCopy(stdout, stderr, attachResp.Reader)
+		done <- readErr
+	}()
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case readErr := <-done:
+		if readErr != nil {
+			return 0, fmt.Errorf("read exec output: %w", readErr)
+		}
+	}
+
+	inspect, err := m.cli.ContainerExecInspect(ctx, resp.ID)
+	if err != nil {
+		return 0, fmt.Errorf("inspect exec: %w", err)
+	}
+	return inspect.ExitCode, nil
+}
+
+// parseFileEntries parses the output of listFilesScript.
+func parseFileEntries(out []byte) []FileEntry {
+	entries := []FileEntry{}
+	for _, record := range bytes.Split(out, []byte{0}) {
+		fields := strings.SplitN(string(record), "\t", 5)
+		if len(fields) != 5 {
+			continue
+		}
+		entry := FileEntry{Name: fields[4], Type: "other", Mode: "0" + fields[3]}
+		switch fields[0] {
+		case "f":
+			entry.Type = "file"
+		case "d":
+			entry.Type = "dir"
+		case "l":
+			entry.Type = "symlink"
+		}
+		entry.Size, _ = strconv.ParseInt(fields[1], 10, 64)
+		if secs, err := strconv.ParseFloat(fields[2], 64); err == nil {
+			entry.Modified = time.Unix(0, int64(secs*float64(time.Second))).UTC()
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// ListFiles lists a directory of a work volume on whichever host runs the
+// container.
+func (p *PoolManager) ListFiles(ctx context.Context, containerID, dir string) ([]FileEntry, error) {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return nil, errContainerNotRunning
+	}
+	return host.mgr.ListFiles(ctx, containerID, dir)
+}
+
+// ReadFile reads a file of a work volume on whichever host runs the
+// container.
+func (p *PoolManager) ReadFile(ctx context.Context, containerID, name string, maxBytes int64) ([]byte, error) {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return nil, errContainerNotRunning
+	}
+	return host.mgr.ReadFile(ctx, containerID, name, maxBytes)
+}
+
+// WriteFile writes a file of a work volume on whichever host runs the
+// container.
+func (p *PoolManager) WriteFile(ctx context.Context, containerID, name string, content io.Reader) error {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return errContainerNotRunning
+	}
+	return host.mgr.WriteFile(ctx, containerID, name, content)
+}
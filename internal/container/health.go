@@ -0,0 +1,138 @@
+package container
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/store"
+)
+
+// Health probe defaults used when no configuration is provided.
+const (
+	defaultHealthInterval = 30 * time.Second
+	defaultHealthTimeout  = 5 * time.Second
+	defaultHealthRetries  = 3
+)
+
+// healthTracker counts consecutive probe failures per container.
+type healthTracker struct {
+	mu       sync.Mutex
+	failures map[string]int
+}
+
+func newHealthTracker() *healthTracker {
+	return &healthTracker{failures: make(map[string]int)}
+}
+
+// record stores a probe result and returns the consecutive failure count.
+func (t *healthTracker) record(containerID string, err error) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err == nil {
+		delete(t.failures, containerID)
+		return 0
+	}
+	t.failures[containerID]++
+	return t.failures[containerID]
+}
+
+// retain drops counters for containers that are no longer active.
+func (t *healthTracker) retain(active map[string]bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id := range t.failures {
+		if !active[id] {
+			delete(t.failures, id)
+		}
+	}
+}
+
+// StartHealthWorkerWithConfig runs a background goroutine that periodically
+// probes every active container and recycles ones that stop responding (a hung
+// gVisor sandbox, a broken shell) before the learner hits the failure.
+// onRecycle is called with the user ID so live terminal sessions can be closed.
+func StartHealthWorkerWithConfig(ctx context.Context, repo store.Repository, mgr Manager, onRecycle CleanupCallback, cfg *config.Config) {
+	interval, timeout, retries := defaultHealthInterval, defaultHealthTimeout, defaultHealthRetries
+	if cfg != nil {
+		interval = cfg.Container.HealthInterval
+		timeout = cfg.Container.HealthTimeout
+		retries = cfg.Container.HealthRetries
+	}
+	if interval <= 0 {
+		slog.Info("Container health worker disabled")
+		return
+	}
+	if retries <= 0 {
+		retries = 1
+	}
+
+	tracker := newHealthTracker()
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		slog.Info("Container health worker started", "interval", interval, "timeout", timeout, "retries", retries)
+
+		for {
+			select {
+			case <-ticker.C:
+				probeActiveContainers(ctx, repo, mgr, tracker, timeout, retries, onRecycle, cfg)
+			case <-ctx.Done():
+				slog.Info("Container health worker shutting down", "reason", ctx.Err())
+				return
+			}
+		}
+	}()
+}
+
+func probeActiveContainers(ctx context.Context, repo store.Repository, mgr Manager, tracker *healthTracker, timeout time.Duration, retries int, onRecycle CleanupCallback, cfg *config.Config) {
+	users, err := repo.GetActiveContainers(ctx)
+	if err != nil {
+		slog.Error("Health worker failed to list active containers", "error", err)
+		return
+	}
+
+	active := make(map[string]bool, len(users))
+	for _, user := range users {
+		active[user.ContainerID] = true
+
+		probeCtx, cancel := context.WithTimeout(ctx, timeout)
+		probeErr := mgr.ProbeContainer(probeCtx, user.ContainerID)
+		cancel()
+
+		failures := tracker.record(user.ContainerID, probeErr)
+		if probeErr == nil {
+			continue
+		}
+		slog.Warn("Container health probe failed",
+			"container_id", user.ContainerID,
+			"user_id", user.UserID,
+			"consecutive_failures", failures,
+			"error", probeErr)
+		if failures < retries {
+			continue
+		}
+
+		slog.Error("Recycling unhealthy container",
+			"container_id", user.ContainerID,
+			"user_id", user.UserID)
+		if err := mgr.StopContainer(WithLifecycleReason(ctx, ReasonUnhealthy), user.ContainerID); err != nil {
+			slog.Error("Health worker failed to stop container",
+				"error", err,
+				"container_id", user.ContainerID,
+				"user_id", user.UserID)
+		}
+		if onRecycle != nil {
+			onRecycle(user.UserID)
+		}
+		if err := updateContainerIDWithRetry(ctx, repo, user.UserID, "", user.ContainerID, cfg); err != nil {
+			slog.Warn("Health worker failed to clear container ID",
+				"error", err,
+				"user_id", user.UserID)
+		}
+		tracker.record(user.ContainerID, nil)
+	}
+	tracker.retain(active)
+}
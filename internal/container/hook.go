@@ -0,0 +1,35 @@
+package container
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// HookRunner is implemented by managers that can run lesson hooks, shell
+// scripts that set up or break a learner's environment, as root in their
+// container.
+type HookRunner interface {
+	// RunHook runs script with /bin/sh as root and returns its exit code.
+	RunHook(ctx context.Context, containerID, script string) (int, error)
+}
+
+// RunHook runs script in the container as root.
+func (m *DockerManager) RunHook(ctx context.Context, containerID, script string) (int, error) {
+	start := time.Now()
+	exitCode, err := m.execAndWait(ctx, containerID, "root", []string{"/bin/sh", "-c", script})
+	if err != nil {
+		return 0, err
+	}
+	slog.Info("Lesson hook completed", "container_id", containerID, "exit_code", exitCode, "duration", time.Since(start))
+	return exitCode, nil
+}
+
+// RunHook runs script in a container on whichever host runs it.
+func (p *PoolManager) RunHook(ctx context.Context, containerID, script string) (int, error) {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return 0, errContainerNotRunning
+	}
+	return host.mgr.RunHook(ctx, containerID, script)
+}
@@ -0,0 +1,323 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxInspectOutput bounds what a process or port listing reads.
+	maxInspectOutput = 1 << 20
+	// clockTicks is USER_HZ, the unit of CPU times in /proc/<pid>/stat,
+	// which Linux fixes at 100 for userspace.
+	clockTicks = 100
+	// pageSize is the unit of resident memory in /proc/<pid>/stat.
+	pageSize = 4096
+)
+
+var errInspectOutput = errors.New("unexpected inspection output")
+
+// Process is a process running in a container.
+type Process struct {
+	PID        int     `json:"pid"`
+	PPID       int     `json:"ppid"`
+	User       string  `json:"user"`  // User name, or the UID if it has none
+	State      string  `json:"state"` // Kernel state letter, e.g. R running, S sleeping, Z zombie
+	Name       string  `json:"name"`
+	Command    string  `json:"command"` // Full command line; empty for kernel threads
+	CPUSeconds float64 `json:"cpu_seconds"`
+	RSSBytes   int64   `json:"rss_bytes"`
+}
+
+// Port is a socket listening in a container.
+type Port struct {
+	Protocol string `json:"protocol"` // "tcp" or "udp"
+	Address  string `json:"address"`  // Local address, e.g. 0.0.0.0 or ::1
+	Port     int    `json:"port"`
+	PID      int    `json:"pid,omitempty"` // Owning process; 0 if unknown
+	Process  string `json:"process,omitempty"`
+}
+
+// ProcessInspector is implemented by managers that can list what runs in a
+// container. Listings are read from /proc as root, so they work in images
+// without ps or ss and include every user's processes.
+type ProcessInspector interface {
+	// Processes lists the container's processes by PID.
+	Processes(ctx context.Context, containerID string) ([]Process, error)
+	// Ports lists the container's listening TCP and bound UDP sockets.
+	Ports(ctx context.Context, containerID string) ([]Port, error)
+}
+
+// processesScript prints /etc/passwd, its own PID, then each process's
+// UID, command line and stat line, one per line with NUL-separated
+// arguments turned into spaces.
+const processesScript = `cat /etc/passwd 2>/dev/null
+echo "@proc $$"
+for p in /proc/[0-9]*; do
+	stat=$(cat "$p/stat" 2>/dev/null) || continue
+	uid=$(awk '/^Uid:/ {print $2}' "$p/status" 2>/dev/null)
+	cmd=$(tr '\0\n' '  ' < "$p/cmdline" 2>/dev/null)
+	printf '%s\t%s\t%s\n' "$uid" "$cmd" "$stat"
+done
+`
+
+// portsScript prints the kernel's socket tables, each after an @<table>
+// line, then the PID, socket inode and name of each process holding a
+// socket.
+const portsScript = `for t in tcp tcp6 udp udp6; do
+	[ -r /proc/net/$t ] || continue
+	echo "@$t"
+	cat /proc/net/$t
+done
+echo @fd
+for p in /proc/[0-9]*; do
+	comm=$(cat "$p/comm" 2>/dev/null) || continue
+	for fd in "$p"/fd/*; do
+		l=$(readlink "$fd" 2>/dev/null) || continue
+		case $l in socket:*) echo "${p#/proc/} ${l#socket:} $comm" ;; esac
+	done
+done
+`
+
+// Processes lists the container's processes.
+func (m *DockerManager) Processes(ctx context.Context, containerID string) ([]Process, error) {
+	out, err := m.execOutput(ctx, containerID, "root", []string{"/bin/sh", "-c", processesScript}, maxInspectOutput)
+	if err != nil {
+		return nil, err
+	}
+	return parseProcesses(out)
+}
+
+// Ports lists the container's listening sockets.
+func (m *DockerManager) Ports(ctx context.Context, containerID string) ([]Port, error) {
+	out, err := m.execOutput(ctx, containerID, "root", []string{"/bin/sh", "-c", portsScript}, maxInspectOutput)
+	if err != nil {
+		return nil, err
+	}
+	return parsePorts(out)
+}
+
+// execOutput runs cmd in the container without a TTY and returns at most
+// maxOutput bytes of its stdout. A non-zero exit is an error.
+func (m *DockerManager) execOutput(ctx context.Context, containerID, user string, cmd []string, maxOutput int) ([]byte, error) {
+	stdout := &limitedBuffer{max: maxOutput}
+	exitCode, err := m.execStream(ctx, containerID, user, cmd, nil, stdout, io.Discard)
+	if err != nil {
+		return nil, err
+	}
+	if exitCode != 0 {
+		return nil, fmt.Errorf("%w: exit code %d", errInspectOutput, exitCode)
+	}
+	return stdout.Bytes(), nil
+}
+
+// parseProcesses parses the output of processesScript.
+func parseProcesses(out []byte) ([]Process, error) {
+	users := make(map[string]string)
+	var procs []Process
+	inProcs := false
+	self := 0 // The shell listing the processes, left out with its children
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), maxInspectOutput)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !inProcs {
+			if pid, ok := strings.CutPrefix(line, "@proc "); ok {
+				inProcs = true
+				self, _ = strconv.Atoi(pid)
+			} else if fields := strings.Split(line, ":"); len(fields) > 2 {
+				users[fields[2]] = fields[0]
+			}
+			continue
+		}
+		uid, rest, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		cmd, stat, ok := strings.Cut(rest, "\t")
+		if !ok {
+			continue
+		}
+		p, ok := parseStat(stat)
+		if !ok || p.PID == self || p.PPID == self {
+			continue
+		}
+		p.User = uid
+		if name, ok := users[uid]; ok {
+			p.User = name
+		}
+		p.Command = strings.TrimSpace(cmd)
+		procs = append(procs, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInspectOutput, err)
+	}
+	if !inProcs {
+		return nil, errInspectOutput
+	}
+	sort.Slice(procs, func(i, j int) bool { return procs[i].PID < procs[j].PID })
+	return procs, nil
+}
+
+// parseStat parses a /proc/<pid>/stat line. The name is enclosed in
+// parentheses and may itself contain spaces and parentheses, so the fields
+// after it are found from the last closing one.
+func parseStat(stat string) (Process, bool) {
+	open := strings.IndexByte(stat, '(')
+	closing := strings.LastIndexByte(stat, ')')
+	if open < 0 || closing < open {
+		return Process{}, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(stat[:open]))
+	if err != nil {
+		return Process{}, false
+	}
+	// Fields from state on; state is field 3 of stat(5).
+	fields := strings.Fields(stat[closing+1:])
+	if len(fields) < 22 {
+		return Process{}, false
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	utime, _ := strconv.ParseInt(fields[11], 10, 64)
+	stime, _ := strconv.ParseInt(fields[12], 10, 64)
+	rss, _ := strconv.ParseInt(fields[21], 10, 64)
+	return Process{
+		PID:        pid,
+		PPID:       ppid,
+		State:      fields[0],
+		Name:       stat[open+1 : closing],
+		CPUSeconds: float64(utime+stime) / clockTicks,
+		RSSBytes:   rss * pageSize,
+	}, true
+}
+
+// Socket states in /proc/net/tcp and udp.
+const (
+	tcpListen  = "0A"
+	udpUnbound = "07" // TCP_CLOSE, which a bound UDP socket reports
+)
+
+// parsePorts parses the output of portsScript.
+func parsePorts(out []byte) ([]Port, error) {
+	type owner struct {
+		pid  int
+		name string
+	}
+	var ports []Port
+	inodes := make(map[string]int) // Socket inode to index in ports
+	owners := make(map[string]owner)
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), maxInspectOutput)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "@"); ok {
+			section = name
+			continue
+		}
+		fields := strings.Fields(line)
+		switch section {
+		case "":
+			return nil, errInspectOutput
+		case "fd":
+			// pid [inode] name
+			if len(fields) < 3 {
+				continue
+			}
+			pid, err := strconv.Atoi(fields[0])
+			if err != nil {
+				continue
+			}
+			inode := strings.Trim(fields[1], "[]")
+			if _, seen := owners[inode]; !seen {
+				owners[inode] = owner{pid: pid, name: strings.Join(fields[2:], " ")}
+			}
+		default:
+			// sl local_address rem_address st ... inode
+			if len(fields) < 10 || fields[0] == "sl" {
+				continue
+			}
+			protocol := strings.TrimSuffix(section, "6")
+			if (protocol == "tcp" && fields[3] != tcpListen) || (protocol == "udp" && fields[3] != udpUnbound) {
+				continue
+			}
+			addr, port, ok := parseProcAddr(fields[1])
+			if !ok {
+				continue
+			}
+			inodes[fields[9]] = len(ports)
+			ports = append(ports, Port{Protocol: protocol, Address: addr, Port: port})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInspectOutput, err)
+	}
+	for inode, i := range inodes {
+		if o, ok := owners[inode]; ok {
+			ports[i].PID = o.pid
+			ports[i].Process = o.name
+		}
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].Port != ports[j].Port {
+			return ports[i].Port < ports[j].Port
+		}
+		if ports[i].Protocol != ports[j].Protocol {
+			return ports[i].Protocol < ports[j].Protocol
+		}
+		return ports[i].Address < ports[j].Address
+	})
+	return ports, nil
+}
+
+// parseProcAddr parses a hex address:port from /proc/net. Addresses are
+// stored as 32-bit words in host byte order, little-endian on the hosts
+// containers run on; the port is big-endian.
+func parseProcAddr(s string) (string, int, bool) {
+	hexAddr, hexPort, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", 0, false
+	}
+	raw, err := hex.DecodeString(hexAddr)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return "", 0, false
+	}
+	port, err := strconv.ParseUint(hexPort, 16, 16)
+	if err != nil {
+		return "", 0, false
+	}
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		binary.BigEndian.PutUint32(ip[i:], binary.LittleEndian.Uint32(raw[i:]))
+	}
+	return ip.String(), int(port), true
+}
+
+// Processes lists the processes of a container on whichever host runs it.
+func (p *PoolManager) Processes(ctx context.Context, containerID string) ([]Process, error) {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return nil, errContainerNotRunning
+	}
+	return host.mgr.Processes(ctx, containerID)
+}
+
+// Ports lists the listening sockets of a container on whichever host runs
+// it.
+func (p *PoolManager) Ports(ctx context.Context, containerID string) ([]Port, error) {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return nil, errContainerNotRunning
+	}
+	return host.mgr.Ports(ctx, containerID)
+}
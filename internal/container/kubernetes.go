@@ -0,0 +1,748 @@
+package container
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/docker/docker/client"
+)
+
+const (
+	// kubeContainerName names the playground container in learner pods.
+	kubeContainerName = "playground"
+
+	// kubeVolumeName names the work volume in learner pods.
+	kubeVolumeName = "work"
+
+	// kubeRunAsUser is the numeric containerUser pods run as.
+	kubeRunAsUser = 1000
+
+	// kubeNameMaxLen is the longest DNS-1123 label, which pod and claim
+	// names must be.
+	kubeNameMaxLen = 63
+
+	// defaultKubeNamespace is used outside a cluster without a namespace
+	// configured.
+	defaultKubeNamespace = "default"
+
+	// defaultPodStartTimeout bounds waiting for a new pod to run.
+	defaultPodStartTimeout = 2 * time.Minute
+
+	// podStartPollInterval is how often a starting pod is checked.
+	podStartPollInterval = 500 * time.Millisecond
+)
+
+// Pod phases reported by the API server.
+const (
+	podPending = "Pending"
+	podRunning = "Running"
+)
+
+// podStartFailures are the container waiting reasons after which a pod will
+// not start on its own.
+var podStartFailures = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CrashLoopBackOff":           true,
+}
+
+var (
+	errPodStartFailed = errors.New("pod failed to start")
+	errExecNotFound   = errors.New("exec session not found")
+)
+
+// kubeObjectMeta is the metadata of a pod or claim.
+type kubeObjectMeta struct {
+	Name              string            `json:"name"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Annotations       map[string]string `json:"annotations,omitempty"`
+	DeletionTimestamp *time.Time        `json:"deletionTimestamp,omitempty"`
+}
+
+// tags merges labels and annotations; the resource labels of DockerManager
+// are split between them, since owners and timestamps are not valid label
+// values.
+func (m kubeObjectMeta) tags() map[string]string {
+	tags := make(map[string]string, len(m.Labels)+len(m.Annotations))
+	for k, v := range m.Labels {
+		tags[k] = v
+	}
+	for k, v := range m.Annotations {
+		tags[k] = v
+	}
+	return tags
+}
+
+// kubePod is the part of a pod the manager reads.
+type kubePod struct {
+	Metadata kubeObjectMeta `json:"metadata"`
+	Spec     struct {
+		Containers []struct {
+			Image string `json:"image"`
+		} `json:"containers"`
+	} `json:"spec"`
+	Status struct {
+		Phase             string `json:"phase"`
+		Message           string `json:"message"`
+		ContainerStatuses []struct {
+			State struct {
+				Waiting *struct {
+					Reason  string `json:"reason"`
+					Message string `json:"message"`
+				} `json:"waiting"`
+			} `json:"state"`
+		} `json:"containerStatuses"`
+	} `json:"status"`
+}
+
+// running reports whether the pod runs and is not being deleted.
+func (p *kubePod) running() bool {
+	return p.Status.Phase == podRunning && p.Metadata.DeletionTimestamp == nil
+}
+
+// image returns the image of the pod's playground container.
+func (p *kubePod) image() string {
+	if len(p.Spec.Containers) == 0 {
+		return ""
+	}
+	return p.Spec.Containers[0].Image
+}
+
+// startFailure returns why the pod cannot start, or "" while it may.
+func (p *kubePod) startFailure() string {
+	if p.Status.Phase != podPending && p.Status.Phase != podRunning {
+		return strings.TrimSpace(p.Status.Phase + " " + p.Status.Message)
+	}
+	for _, status := range p.Status.ContainerStatuses {
+		if waiting := status.State.Waiting; waiting != nil && podStartFailures[waiting.Reason] {
+			return strings.TrimSpace(waiting.Reason + " " + waiting.Message)
+		}
+	}
+	return ""
+}
+
+// kubeList is a list of pods or claims.
+type kubeList struct {
+	Items []struct {
+		Metadata kubeObjectMeta `json:"metadata"`
+	} `json:"items"`
+}
+
+// KubernetesManager implements Manager on a Kubernetes cluster. Each learner
+// gets a pod running the playground image with a persistent volume claim
+// mounted at the work directory, and terminals attach through the API
+// server's exec stream. Pods are never restarted in place: a learner whose
+// pod stopped gets a new one on the same claim.
+type KubernetesManager struct {
+	kube      *kubeClient
+	namespace string
+	cfg       *config.Config
+
+	mu    sync.Mutex
+	execs map[string]*kubeExecConn
+
+	events EventRecorder // nil unless lifecycle events are recorded
+}
+
+// NewKubernetesManagerWithConfig creates a manager for the cluster described
+// by cfg.Container.Kubernetes.
+func NewKubernetesManagerWithConfig(cfg *config.Config) (*KubernetesManager, error) {
+	kube, err := newKubeClient(cfg.Container.Kubernetes.APIServer)
+	if err != nil {
+		return nil, fmt.Errorf("create kubernetes client: %w", err)
+	}
+	namespace := cfg.Container.Kubernetes.Namespace
+	if namespace == "" {
+		namespace = defaultKubeNamespace
+		if data, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace")); err == nil {
+			namespace = strings.TrimSpace(string(data))
+		}
+	}
+	slog.Info("Kubernetes client initialized",
+		"api_server", kube.server,
+		"namespace", namespace,
+		"runtime_class", cfg.Container.Kubernetes.RuntimeClass)
+	return &KubernetesManager{
+		kube:      kube,
+		namespace: namespace,
+		cfg:       cfg,
+		execs:     make(map[string]*kubeExecConn),
+	}, nil
+}
+
+// kubeName derives a DNS-1123 label from prefix and userID. User IDs are
+// lowercased and truncated, so a hash of the full ID keeps names unique.
+func kubeName(prefix, userID string) string {
+	sum := sha256.Sum256([]byte(userID))
+	hash := hex.EncodeToString(sum[:4])
+	sanitized := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		if r >= 'A' && r <= 'Z' {
+			return r + ('a' - 'A')
+		}
+		return '-'
+	}, userID)
+	if maxLen := kubeNameMaxLen - len(prefix) - len(hash) - 2; len(sanitized) > maxLen {
+		sanitized = sanitized[:maxLen]
+	}
+	sanitized = strings.Trim(sanitized, "-")
+	if sanitized == "" {
+		return prefix + "-" + hash
+	}
+	return prefix + "-" + sanitized + "-" + hash
+}
+
+// podNameFor returns the name of a user's pod.
+func podNameFor(userID string) string {
+	return kubeName("playground", userID)
+}
+
+// claimNameFor returns the name of a user's volume claim.
+func claimNameFor(userID string) string {
+	return kubeName("playground-data", userID)
+}
+
+// path returns the API path of a namespaced resource collection, or of the
+// named resource in it.
+func (m *KubernetesManager) path(resource, name string) string {
+	p := "/api/v1/namespaces/" + m.namespace + "/" + resource
+	if name != "" {
+		p += "/" + name
+	}
+	return p
+}
+
+// selector matches resources created by this server instance.
+func (m *KubernetesManager) selector() string {
+	return url.Values{"labelSelector": {labelManaged + "=true," + labelInstance + "=" + configuredInstanceID(m.cfg)}}.Encode()
+}
+
+// metadata returns the metadata of a new pod or claim. Resource labels
+// that are not valid label values become annotations.
+func (m *KubernetesManager) metadata(name, userID, sessionID string) map[string]any {
+	annotations := map[string]string{
+		labelOwner:     userID,
+		labelCreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if sessionID != "" {
+		annotations[labelSession] = sessionID
+	}
+	if runtimeClass := m.cfg.Container.Kubernetes.RuntimeClass; runtimeClass != "" {
+		annotations[labelRuntime] = runtimeClass
+	}
+	return map[string]any{
+		"name": name,
+		"labels": map[string]string{
+			labelManaged:  "true",
+			labelInstance: configuredInstanceID(m.cfg),
+		},
+		"annotations": annotations,
+	}
+}
+
+// podManifest returns the pod running a user's playground.
+func (m *KubernetesManager) podManifest(name, claim, image, userID, sessionID string, tier config.ResourceTier, env map[string]string) map[string]any {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	envVars := make([]map[string]string, 0, len(keys))
+	for _, k := range keys {
+		envVars = append(envVars, map[string]string{"name": k, "value": env[k]})
+	}
+
+	// CPUQuota is in microseconds per 100ms period, so 1000 is 1 millicore.
+	limits := map[string]string{
+		"memory": strconv.FormatInt(tier.MemoryLimitBytes, 10),
+		"cpu":    strconv.FormatInt(max(tier.CPUQuota/100, 1), 10) + "m",
+	}
+	spec := map[string]any{
+		"restartPolicy":                "Never",
+		"automountServiceAccountToken": false,
+		"enableServiceLinks":           false,
+		"securityContext": map[string]any{
+			"runAsUser":  kubeRunAsUser,
+			"runAsGroup": kubeRunAsUser,
+			"fsGroup":    kubeRunAsUser,
+		},
+		"containers": []map[string]any{{
+			"name":         kubeContainerName,
+			"image":        image,
+			"stdin":        true,
+			"tty":          true,
+			"workingDir":   workingDir,
+			"env":          envVars,
+			"resources":    map[string]any{"limits": limits, "requests": limits},
+			"volumeMounts": []map[string]string{{"name": kubeVolumeName, "mountPath": mountPath}},
+		}},
+		"volumes": []map[string]any{{
+			"name":                  kubeVolumeName,
+			"persistentVolumeClaim": map[string]string{"claimName": claim},
+		}},
+	}
+	if runtimeClass := m.cfg.Container.Kubernetes.RuntimeClass; runtimeClass != "" {
+		spec["runtimeClassName"] = runtimeClass
+	}
+	return map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   m.metadata(name, userID, sessionID),
+		"spec":       spec,
+	}
+}
+
+// ensureClaim creates a user's volume claim unless it exists.
+func (m *KubernetesManager) ensureClaim(ctx context.Context, userID, sessionID string) (string, error) {
+	name := claimNameFor(userID)
+	spec := map[string]any{
+		"accessModes": []string{"ReadWriteOnce"},
+		"resources":   map[string]any{"requests": map[string]string{"storage": m.cfg.Container.Kubernetes.VolumeSize}},
+	}
+	if storageClass := m.cfg.Container.Kubernetes.StorageClass; storageClass != "" {
+		spec["storageClassName"] = storageClass
+	}
+	err := m.kube.do(ctx, http.MethodPost, m.path("persistentvolumeclaims", ""), map[string]any{
+		"apiVersion": "v1",
+		"kind":       "PersistentVolumeClaim",
+		"metadata":   m.metadata(name, userID, sessionID),
+		"spec":       spec,
+	}, nil)
+	if err != nil && !isKubeConflict(err) {
+		return "", fmt.Errorf("create volume claim %s: %w", name, err)
+	}
+	return name, nil
+}
+
+// getPod returns the named pod; a missing pod is a *kubeAPIError with code
+// 404.
+func (m *KubernetesManager) getPod(ctx context.Context, name string) (*kubePod, error) {
+	var pod kubePod
+	if err := m.kube.do(ctx, http.MethodGet, m.path("pods", name), nil, &pod); err != nil {
+		return nil, err
+	}
+	return &pod, nil
+}
+
+// deletePod deletes the named pod, giving it grace to exit.
+func (m *KubernetesManager) deletePod(ctx context.Context, name string, grace time.Duration) error {
+	query := url.Values{"gracePeriodSeconds": {strconv.Itoa(int(grace.Seconds()))}}
+	return m.kube.do(ctx, http.MethodDelete, m.path("pods", name)+"?"+query.Encode(), nil, nil)
+}
+
+// waitRunning waits for the named pod to run, failing early when it cannot
+// start.
+func (m *KubernetesManager) waitRunning(ctx context.Context, name string) error {
+	timeout := m.cfg.Container.Kubernetes.StartTimeout
+	if timeout <= 0 {
+		timeout = defaultPodStartTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(podStartPollInterval)
+	defer ticker.Stop()
+
+	for {
+		pod, err := m.getPod(ctx, name)
+		if err != nil {
+			return fmt.Errorf("get pod %s: %w", name, err)
+		}
+		if pod.running() {
+			return nil
+		}
+		if reason := pod.startFailure(); reason != "" {
+			return fmt.Errorf("%w: %s: %s", errPodStartFailed, name, reason)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("pod %s did not start within %s: %w", name, timeout, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// EnsureContainer ensures a pod exists and is running for a user. The
+// returned container ID is the pod name. An empty image uses the configured
+// Kubernetes image.
+func (m *KubernetesManager) EnsureContainer(ctx context.Context, userID string, currentContainerID string, image string, _ time.Time, env map[string]string) (string, error) {
+	name := podNameFor(userID)
+	changeImage := image != ""
+	if image == "" {
+		image = m.cfg.Container.Kubernetes.Image
+	}
+
+	pod, err := m.getPod(ctx, name)
+	switch {
+	case isKubeNotFound(err):
+	case err != nil:
+		return "", fmt.Errorf("get pod %s: %w", name, err)
+	case currentContainerID == "":
+		// The store no longer points at the pod, so it is stale.
+		slog.Info("Found unbound pod, recreating", "pod", name, "user_id", userID)
+		if err := m.StopContainer(WithLifecycleReason(ctx, ReasonUnbound), name); err != nil {
+			slog.Warn("Failed to stop unbound pod before recreation", "error", err, "pod", name)
+		}
+	case changeImage && pod.Metadata.DeletionTimestamp == nil && pod.image() != image:
+		slog.Info("Replacing pod with another image", "pod", name, "user_id", userID, "from", pod.image(), "to", image)
+		if err := m.StopContainer(WithLifecycleReason(ctx, ReasonImageChange), name); err != nil {
+			slog.Warn("Failed to stop pod before image change", "error", err, "pod", name)
+		}
+	case pod.running():
+		slog.Info("Pod already running", "pod", name, "user_id", userID)
+		return name, nil
+	case pod.Status.Phase == podPending && pod.Metadata.DeletionTimestamp == nil:
+		ReportProgress(ctx, StageStarting)
+		if err := m.waitRunning(ctx, name); err != nil {
+			return "", err
+		}
+		return name, nil
+	case pod.Metadata.DeletionTimestamp == nil:
+		slog.Info("Pod exited, recreating", "pod", name, "user_id", userID, "phase", pod.Status.Phase)
+		if err := m.StopContainer(WithLifecycleReason(ctx, ReasonRecreate), name); err != nil {
+			slog.Warn("Failed to stop pod before recreation", "error", err, "pod", name)
+		}
+	}
+
+	ReportProgress(ctx, StageCreating)
+	slog.Info("Creating new pod", "user_id", userID, "pod", name, "image", image)
+	sessionID := identity.SessionIDFromContext(ctx)
+	claim, err := m.ensureClaim(ctx, userID, sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	tier, _ := resourceTier(ctx, m.cfg)
+	manifest := m.podManifest(name, claim, image, userID, sessionID, tier, env)
+	var createErr error
+	for i := 0; i < max(m.cfg.Container.CreateRetryAttempts, 1); i++ {
+		createErr = m.kube.do(ctx, http.MethodPost, m.path("pods", ""), manifest, nil)
+		if createErr == nil || !isKubeConflict(createErr) {
+			break
+		}
+
+		// The previous pod is still terminating; skip its grace period.
+		slog.Warn("Pod name conflict during create, retrying",
+			"user_id", userID,
+			"pod", name,
+			"attempt", i+1,
+		)
+		if err := m.deletePod(ctx, name, 0); err != nil && !isKubeNotFound(err) {
+			slog.Warn("Failed to delete conflicting pod before retry", "pod", name, "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(m.cfg.Container.CreateRetryDelay):
+		}
+	}
+	if createErr != nil {
+		return "", fmt.Errorf("create pod %s: %w", name, createErr)
+	}
+
+	reason := lifecycleReason(ctx, ReasonProvision)
+	RecordEvent(ctx, m.events, userID, name, domain.ContainerEventCreate, reason)
+
+	ReportProgress(ctx, StageStarting)
+	if err := m.waitRunning(ctx, name); err != nil {
+		if deleteErr := m.deletePod(context.WithoutCancel(ctx), name, 0); deleteErr != nil && !isKubeNotFound(deleteErr) {
+			slog.Warn("Failed to delete pod after start failure", "pod", name, "error", deleteErr)
+		}
+		return "", err
+	}
+	RecordEvent(ctx, m.events, userID, name, domain.ContainerEventStart, reason)
+
+	slog.Info("Pod created and started", "pod", name, "user_id", userID)
+	return name, nil
+}
+
+// StopContainer deletes a pod, giving its processes the configured stop
+// timeout to exit. It is idempotent.
+func (m *KubernetesManager) StopContainer(ctx context.Context, containerID string) error {
+	slog.Info("Stopping pod", "pod", containerID)
+
+	pod, err := m.getPod(ctx, containerID)
+	if isKubeNotFound(err) {
+		slog.Debug("Pod already removed", "pod", containerID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get pod %s: %w", containerID, err)
+	}
+
+	grace := defaultStopTimeout
+	if m.cfg.Timeout.ContainerStop > 0 {
+		grace = m.cfg.Timeout.ContainerStop
+	}
+	if err := m.deletePod(ctx, containerID, grace); err != nil {
+		if isKubeNotFound(err) {
+			slog.Debug("Pod already removed", "pod", containerID)
+			return nil
+		}
+		return fmt.Errorf("delete pod %s: %w", containerID, err)
+	}
+
+	RecordEvent(ctx, m.events, pod.Metadata.Annotations[labelOwner], containerID, domain.ContainerEventStop, lifecycleReason(ctx, ""))
+	slog.Info("Pod deleted", "pod", containerID)
+	return nil
+}
+
+// IsRunning checks if a pod is running.
+func (m *KubernetesManager) IsRunning(ctx context.Context, containerID string) (bool, error) {
+	pod, err := m.getPod(ctx, containerID)
+	if isKubeNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("get pod %s: %w", containerID, err)
+	}
+	return pod.running(), nil
+}
+
+// ProbeContainer verifies a running pod can still execute a shell.
+func (m *KubernetesManager) ProbeContainer(ctx context.Context, containerID string) error {
+	pod, err := m.getPod(ctx, containerID)
+	if err != nil {
+		return fmt.Errorf("get pod %s: %w", containerID, err)
+	}
+	if !pod.running() {
+		return errContainerNotRunning
+	}
+
+	exitCode, err := m.kube.run(ctx, m.namespace, containerID, healthProbeCmd)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errProbeFailed, err)
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("%w with exit code %d", errProbeFailed, exitCode)
+	}
+	return nil
+}
+
+// CreateExecSession creates a new exec session in a running pod.
+func (m *KubernetesManager) CreateExecSession(ctx context.Context, containerID string) (string, io.ReadWriteCloser, error) {
+	return m.CreateTerminalExecSession(ctx, containerID, TerminalOptions{})
+}
+
+// CreateTerminalExecSession creates an exec session for the client terminal
+// described by opts. Exec streams cannot set environment variables, so the
+// shell is started through env.
+func (m *KubernetesManager) CreateTerminalExecSession(ctx context.Context, containerID string, opts TerminalOptions) (string, io.ReadWriteCloser, error) {
+	cols, rows := opts.size()
+	command := []string{"/bin/bash"}
+	if env := opts.env(); len(env) > 0 {
+		command = append(append([]string{"env"}, env...), command...)
+	}
+
+	ws, err := m.kube.exec(ctx, m.namespace, containerID, command, true, true)
+	if err != nil {
+		return "", nil, fmt.Errorf("create exec session in pod %s: %w", containerID, err)
+	}
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	execID := "exec-" + hex.EncodeToString(id)
+	conn := newKubeExecConn(ws, func() { m.forgetExec(execID) })
+	if err := conn.resize(cols, rows); err != nil {
+		_ = conn.Close()
+		return "", nil, err
+	}
+
+	m.trackExec(execID, conn)
+	slog.Info("Exec session created", "exec_id", execID, "pod", containerID, "term", opts.Term, "cols", cols, "rows", rows)
+	return execID, conn, nil
+}
+
+// trackExec records an open exec session for resizing.
+func (m *KubernetesManager) trackExec(execID string, conn *kubeExecConn) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.execs[execID] = conn
+}
+
+// execSession returns an open exec session, or nil.
+func (m *KubernetesManager) execSession(execID string) *kubeExecConn {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.execs[execID]
+}
+
+// forgetExec drops a closed exec session.
+func (m *KubernetesManager) forgetExec(execID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.execs, execID)
+}
+
+// ResizeExecSession resizes a running exec session.
+func (m *KubernetesManager) ResizeExecSession(_ context.Context, execID string, cols, rows uint) error {
+	conn := m.execSession(execID)
+	if conn == nil {
+		return fmt.Errorf("%w: %s", errExecNotFound, execID)
+	}
+	if err := conn.resize(cols, rows); err != nil {
+		return fmt.Errorf("resize exec session %s to %dx%d: %w", execID, cols, rows, err)
+	}
+	return nil
+}
+
+// Client returns nil: there is no Docker daemon behind a Kubernetes
+// manager.
+func (m *KubernetesManager) Client() *client.Client {
+	return nil
+}
+
+// EnsureNetwork verifies the namespace is reachable and returns its name.
+// Learner pods use the cluster network; the deny and allowlist egress
+// policies are enforced with a NetworkPolicy, otherwise isolate them with
+// one.
+func (m *KubernetesManager) EnsureNetwork(ctx context.Context) (string, error) {
+	if err := m.kube.do(ctx, http.MethodGet, m.path("pods", "")+"?limit=1&"+m.selector(), nil, nil); err != nil {
+		return "", fmt.Errorf("list pods in namespace %s: %w", m.namespace, err)
+	}
+	if egressPolicy(m.cfg) != config.EgressFull {
+		if err := m.ensureEgressPolicy(ctx); err != nil {
+			return "", err
+		}
+	}
+	return m.namespace, nil
+}
+
+// ensureEgressPolicy creates or replaces the NetworkPolicy limiting egress
+// from this instance's pods: none under the deny policy, DNS and the
+// allowlist under the allowlist policy. Domains are resolved when the policy
+// is written, since NetworkPolicies only take CIDRs. Switching to the full
+// policy leaves it in place; delete it to lift the limit. Exec streams reach pods through the kubelet, not the pod network,
+// so terminals keep working. The cluster's network plugin must enforce
+// NetworkPolicies.
+func (m *KubernetesManager) ensureEgressPolicy(ctx context.Context) error {
+	instance := configuredInstanceID(m.cfg)
+	path := "/apis/networking.k8s.io/v1/namespaces/" + m.namespace + "/networkpolicies"
+	name := kubeName("playground-egress", instance)
+
+	policy := egressPolicy(m.cfg)
+	egress := []any{}
+	if policy == config.EgressAllowlist {
+		cidrs, err := egressCIDRs(ctx, m.cfg.Container.EgressAllow)
+		if err != nil {
+			return err
+		}
+		to := make([]any, 0, len(cidrs))
+		for _, cidr := range cidrs {
+			to = append(to, map[string]any{"ipBlock": map[string]string{"cidr": cidr}})
+		}
+		egress = append(egress,
+			map[string]any{"ports": []any{
+				map[string]any{"protocol": "UDP", "port": 53},
+				map[string]any{"protocol": "TCP", "port": 53},
+			}},
+			map[string]any{"to": to},
+		)
+	}
+	body := map[string]any{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "NetworkPolicy",
+		"metadata": map[string]any{
+			"name":   name,
+			"labels": map[string]string{labelManaged: "true", labelInstance: instance},
+		},
+		"spec": map[string]any{
+			"podSelector": map[string]any{
+				"matchLabels": map[string]string{labelManaged: "true", labelInstance: instance},
+			},
+			"policyTypes": []string{"Egress"},
+			"egress":      egress,
+		},
+	}
+	err := m.kube.do(ctx, http.MethodPost, path, body, nil)
+	if isKubeConflict(err) {
+		err = m.kube.do(ctx, http.MethodPut, path+"/"+name, body, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("write egress network policy: %w", err)
+	}
+	slog.Info("Egress network policy applied", "namespace", m.namespace, "policy", name, "egress", policy, "rules", len(egress))
+	return nil
+}
+
+// Runtime reports the RuntimeClass new pods are created with. The cluster
+// validates it when the pod is created.
+func (m *KubernetesManager) Runtime() RuntimeStatus {
+	runtimeClass := m.cfg.Container.Kubernetes.RuntimeClass
+	return RuntimeStatus{Requested: runtimeClass, Effective: runtimeClass, Available: true}
+}
+
+// ReapOrphans removes pods and volume claims created by this instance whose
+// owner no longer exists, with the same grace as DockerManager.ReapOrphans.
+func (m *KubernetesManager) ReapOrphans(ctx context.Context, exists OwnerLookup, grace time.Duration) (ReapResult, error) {
+	var result ReapResult
+	isOrphan := orphanCheck(ctx, exists, grace)
+
+	var pods kubeList
+	if err := m.kube.do(ctx, http.MethodGet, m.path("pods", "")+"?"+m.selector(), nil, &pods); err != nil {
+		return result, fmt.Errorf("list managed pods: %w", err)
+	}
+	for _, pod := range pods.Items {
+		tags := pod.Metadata.tags()
+		if !isOrphan(tags) {
+			continue
+		}
+		slog.Info("Reaping orphaned pod", "pod", pod.Metadata.Name, "user_id", tags[labelOwner])
+		if err := m.StopContainer(WithLifecycleReason(ctx, ReasonOrphaned), pod.Metadata.Name); err != nil {
+			slog.Warn("Failed to reap orphaned pod", "pod", pod.Metadata.Name, "error", err)
+			continue
+		}
+		result.Containers++
+	}
+
+	var claims kubeList
+	if err := m.kube.do(ctx, http.MethodGet, m.path("persistentvolumeclaims", "")+"?"+m.selector(), nil, &claims); err != nil {
+		return result, fmt.Errorf("list managed volume claims: %w", err)
+	}
+	for _, claim := range claims.Items {
+		tags := claim.Metadata.tags()
+		if !isOrphan(tags) {
+			continue
+		}
+		slog.Info("Reaping orphaned volume claim", "claim", claim.Metadata.Name, "user_id", tags[labelOwner])
+		if err := m.kube.do(ctx, http.MethodDelete, m.path("persistentvolumeclaims", claim.Metadata.Name), nil, nil); err != nil {
+			if !isKubeNotFound(err) {
+				slog.Warn("Failed to reap orphaned volume claim", "claim", claim.Metadata.Name, "error", err)
+			}
+			continue
+		}
+		result.Volumes++
+	}
+
+	return result, nil
+}
+
+// RemoveVolume deletes the user's volume claim; a missing claim is not an
+// error. The cluster releases the volume once no pod uses it.
+func (m *KubernetesManager) RemoveVolume(ctx context.Context, userID string) error {
+	name := claimNameFor(userID)
+	if err := m.kube.do(ctx, http.MethodDelete, m.path("persistentvolumeclaims", name), nil, nil); err != nil && !isKubeNotFound(err) {
+		return fmt.Errorf("remove volume claim for %s: %w", userID, err)
+	}
+	return nil
+}
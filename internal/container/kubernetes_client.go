@@ -0,0 +1,348 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/coder/websocket"
+)
+
+// serviceAccountDir holds the token, CA certificate and namespace of the
+// pod's service account.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubeExecProtocol is the exec stream subprotocol: every message starts with
+// the byte of the channel it belongs to.
+const kubeExecProtocol = "v4.channel.k8s.io"
+
+// Channels of an exec stream.
+const (
+	kubeStdin  = 0
+	kubeStdout = 1
+	kubeStderr = 2
+	kubeError  = 3 // Status of the command once it exits
+	kubeResize = 4
+)
+
+const (
+	// kubeExecReadLimit bounds a single exec stream message.
+	kubeExecReadLimit = 1 << 20
+
+	// kubeErrorBodyLimit bounds the error responses decoded from the API
+	// server.
+	kubeErrorBodyLimit = 64 * 1024
+)
+
+var (
+	errNotInCluster  = errors.New("not running in a kubernetes cluster; set SHSH_K8S_API_SERVER")
+	errInvalidKubeCA = errors.New("invalid service account CA certificate")
+	errExecNoStatus  = errors.New("exec stream closed without a status")
+)
+
+// kubeAPIError is an error response of the API server.
+type kubeAPIError struct {
+	Code    int
+	Reason  string
+	Message string
+}
+
+func (e *kubeAPIError) Error() string {
+	return fmt.Sprintf("kubernetes api %d %s: %s", e.Code, e.Reason, e.Message)
+}
+
+func isKubeNotFound(err error) bool {
+	var apiErr *kubeAPIError
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+func isKubeConflict(err error) bool {
+	var apiErr *kubeAPIError
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict
+}
+
+// kubeStatus is the Status object the API server returns for errors and at
+// the end of exec streams.
+type kubeStatus struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+	Details struct {
+		Causes []struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"causes"`
+	} `json:"details"`
+}
+
+// exitCode returns the exit code an exec status reports, or false when the
+// command did not run to completion.
+func (s kubeStatus) exitCode() (int, bool) {
+	if s.Status == "Success" {
+		return 0, true
+	}
+	for _, cause := range s.Details.Causes {
+		if cause.Reason == "ExitCode" {
+			if code, err := strconv.Atoi(cause.Message); err == nil {
+				return code, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// kubeClient is a minimal client of the Kubernetes REST API, covering the
+// pods, volume claims and exec streams KubernetesManager needs.
+type kubeClient struct {
+	server    string // API server URL without a trailing slash
+	tokenFile string // Service account token, re-read so rotated tokens are used; "" sends none
+	http      *http.Client
+}
+
+// newKubeClient connects to apiServer, or to the cluster the server runs in
+// when it is empty. The service account's token and CA certificate are used
+// when present, so a local "kubectl proxy" URL works as well.
+func newKubeClient(apiServer string) (*kubeClient, error) {
+	server := apiServer
+	if server == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, errNotInCluster
+		}
+		server = "https://" + net.JoinHostPort(host, port)
+	}
+
+	transport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		transport = &http.Transport{}
+	}
+	transport = transport.Clone()
+	if ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt")); err == nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errInvalidKubeCA
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	c := &kubeClient{server: strings.TrimSuffix(server, "/"), http: &http.Client{Transport: transport}}
+	if tokenFile := filepath.Join(serviceAccountDir, "token"); fileExists(tokenFile) {
+		c.tokenFile = tokenFile
+	}
+	return c, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// header returns the headers authenticating a request.
+func (c *kubeClient) header() (http.Header, error) {
+	header := http.Header{}
+	if c.tokenFile == "" {
+		return header, nil
+	}
+	token, err := os.ReadFile(c.tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("read service account token: %w", err)
+	}
+	header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	return header, nil
+}
+
+// do sends body as JSON and decodes the response into out, when not nil.
+// Error responses are returned as *kubeAPIError.
+func (c *kubeClient) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encode %s %s: %w", method, path, err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.server+path, reader)
+	if err != nil {
+		return fmt.Errorf("build %s %s: %w", method, path, err)
+	}
+	if req.Header, err = c.header(); err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			slog.Debug("Failed to close kubernetes api response", "path", path, "error", closeErr)
+		}
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var status kubeStatus
+		if err := json.NewDecoder(io.LimitReader(resp.Body, kubeErrorBodyLimit)).Decode(&status); err != nil {
+			status.Message = http.StatusText(resp.StatusCode)
+		}
+		return &kubeAPIError{Code: resp.StatusCode, Reason: status.Reason, Message: status.Message}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// exec opens an exec stream running command in a pod's playground
+// container. Stderr is merged into stdout when tty is set.
+func (c *kubeClient) exec(ctx context.Context, namespace, pod string, command []string, tty, stdin bool) (*websocket.Conn, error) {
+	query := url.Values{}
+	query.Set("container", kubeContainerName)
+	for _, arg := range command {
+		query.Add("command", arg)
+	}
+	query.Set("stdin", strconv.FormatBool(stdin))
+	query.Set("stdout", "true")
+	query.Set("stderr", strconv.FormatBool(!tty))
+	query.Set("tty", strconv.FormatBool(tty))
+
+	header, err := c.header()
+	if err != nil {
+		return nil, err
+	}
+	path := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/exec?%s", namespace, pod, query.Encode())
+	conn, _, err := websocket.Dial(ctx, c.server+path, &websocket.DialOptions{
+		HTTPClient:   c.http,
+		HTTPHeader:   header,
+		Subprotocols: []string{kubeExecProtocol},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("open exec stream in pod %s: %w", pod, err)
+	}
+	conn.SetReadLimit(kubeExecReadLimit)
+	return conn, nil
+}
+
+// run executes command in a pod and returns its exit code.
+func (c *kubeClient) run(ctx context.Context, namespace, pod string, command []string) (int, error) {
+	conn, err := c.exec(ctx, namespace, pod, command, false, false)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = conn.CloseNow() }()
+
+	for {
+		_, msg, err := conn.Read(ctx)
+		if err != nil {
+			if websocket.CloseStatus(err) == websocket.StatusNormalClosure {
+				return 0, errExecNoStatus
+			}
+			return 0, fmt.Errorf("read exec stream: %w", err)
+		}
+		if len(msg) < 2 || msg[0] != kubeError {
+			continue
+		}
+		var status kubeStatus
+		if err := json.Unmarshal(msg[1:], &status); err != nil {
+			return 0, fmt.Errorf("decode exec status: %w", err)
+		}
+		code, ok := status.exitCode()
+		if !ok {
+			return 0, fmt.Errorf("exec failed: %s", status.Message)
+		}
+		return code, nil
+	}
+}
+
+// kubeExecConn adapts a terminal exec stream to the io.ReadWriteCloser of an
+// exec session.
+type kubeExecConn struct {
+	ws      *websocket.Conn
+	ctx     context.Context // Cancelled on Close to unblock Read
+	cancel  context.CancelFunc
+	pending []byte // Output of the last message not yet read
+	onClose func()
+	once    sync.Once
+}
+
+func newKubeExecConn(ws *websocket.Conn, onClose func()) *kubeExecConn {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &kubeExecConn{ws: ws, ctx: ctx, cancel: cancel, onClose: onClose}
+}
+
+// Read returns the shell's output. It returns io.EOF once the shell exits or
+// the session is closed.
+func (c *kubeExecConn) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		_, msg, err := c.ws.Read(c.ctx)
+		if err != nil {
+			if websocket.CloseStatus(err) == websocket.StatusNormalClosure || c.ctx.Err() != nil {
+				return 0, io.EOF
+			}
+			return 0, fmt.Errorf("read exec stream: %w", err)
+		}
+		if len(msg) > 1 && (msg[0] == kubeStdout || msg[0] == kubeStderr) {
+			c.pending = msg[1:]
+		}
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write sends p to the shell's stdin.
+func (c *kubeExecConn) Write(p []byte) (int, error) {
+	if err := c.ws.Write(c.ctx, websocket.MessageBinary, append([]byte{kubeStdin}, p...)); err != nil {
+		return 0, fmt.Errorf("write exec stream: %w", err)
+	}
+	return len(p), nil
+}
+
+// resize sets the terminal size of the shell.
+func (c *kubeExecConn) resize(cols, rows uint) error {
+	data, err := json.Marshal(map[string]uint{"Width": cols, "Height": rows})
+	if err != nil {
+		return fmt.Errorf("encode terminal size: %w", err)
+	}
+	if err := c.ws.Write(c.ctx, websocket.MessageBinary, append([]byte{kubeResize}, data...)); err != nil {
+		return fmt.Errorf("resize exec stream: %w", err)
+	}
+	return nil
+}
+
+// Close ends the session. The shell gets a hangup as its stdin closes.
+func (c *kubeExecConn) Close() error {
+	var err error
+	c.once.Do(func() {
+		c.cancel()
+		err = c.ws.CloseNow()
+		if c.onClose != nil {
+			c.onClose()
+		}
+	})
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		return fmt.Errorf("close exec stream: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+
+	"github.com/docker/docker/api/types/filters"
+)
+
+// Docker labels applied to every resource the server creates.
+const (
+	labelManaged         = "shsh.managed"
+	labelOwner           = "shsh.owner"
+	labelSession         = "shsh.session"
+	labelCreatedAt       = "shsh.created-at"
+	labelInstance        = "shsh.instance"
+	labelRuntime         = "shsh.runtime"
+	labelRuntimeFallback = "shsh.runtime.fallback"
+	labelCheckpoint      = "shsh.checkpoint"
+	labelTier            = "shsh.tier"
+	labelRole            = "shsh.role" // Marks shared infrastructure such as the package proxy
+	labelLab             = "shsh.lab"  // Challenge whose lab topology a node belongs to
+	labelLabNode         = "shsh.lab.node"
+	labelPreview         = "shsh.preview"    // Marks disposable clones that preview a command
+	labelPreviewID       = "shsh.preview.id" // Tells the image and clone of one preview apart
+)
+
+// defaultInstanceID labels resources when no configuration is provided.
+const defaultInstanceID = "shsh"
+
+// instanceID returns the server instance ID recorded on created resources.
+func (m *DockerManager) instanceID() string {
+	return configuredInstanceID(m.cfg)
+}
+
+// configuredInstanceID returns cfg's instance ID, or the default without one.
+func configuredInstanceID(cfg *config.Config) string {
+	if cfg != nil && cfg.InstanceID != "" {
+		return cfg.InstanceID
+	}
+	return defaultInstanceID
+}
+
+// resourceLabels returns the labels for a new container, volume or network.
+// userID and sessionID are omitted for shared resources.
+func (m *DockerManager) resourceLabels(userID, sessionID string) map[string]string {
+	labels := map[string]string{
+		labelManaged:   "true",
+		labelInstance:  m.instanceID(),
+		labelCreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if userID != "" {
+		labels[labelOwner] = userID
+	}
+	if sessionID != "" {
+		labels[labelSession] = sessionID
+	}
+	return labels
+}
+
+// managedFilter matches resources created by this server instance.
+func (m *DockerManager) managedFilter() filters.Args {
+	return filters.NewArgs(
+		filters.Arg("label", labelManaged+"=true"),
+		filters.Arg("label", labelInstance+"="+m.instanceID()),
+	)
+}
+
+// IsManagedContainer reports whether containerID carries the labels of a
+// container this server instance created, so callers acting on a container ID
+// from elsewhere, such as the terminal broker, cannot reach other containers
+// on the host.
+func (m *DockerManager) IsManagedContainer(ctx context.Context, containerID string) (bool, error) {
+	inspect, err := m.cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return false, fmt.Errorf("inspect container %s: %w", containerID, err)
+	}
+	if inspect.Config == nil {
+		return false, nil
+	}
+	return m.managedLabels(inspect.Config.Labels), nil
+}
+
+// managedLabels reports whether labels mark a resource of this instance.
+func (m *DockerManager) managedLabels(labels map[string]string) bool {
+	return labels[labelManaged] == "true" && labels[labelInstance] == m.instanceID()
+}
+
+// labeledCreatedAt parses the creation time label, reporting false when it is
+// missing or malformed.
+func labeledCreatedAt(labels map[string]string) (time.Time, bool) {
+	createdAt, err := time.Parse(time.RFC3339, labels[labelCreatedAt])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return createdAt, true
+}
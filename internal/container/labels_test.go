@@ -0,0 +1,26 @@
+package container
+
+import (
+	"testing"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+)
+
+func TestManagedLabels(t *testing.T) {
+	m := &DockerManager{cfg: &config.Config{InstanceID: "api-1"}}
+
+	for _, tc := range []struct {
+		name   string
+		labels map[string]string
+		want   bool
+	}{
+		{"this instance", map[string]string{labelManaged: "true", labelInstance: "api-1"}, true},
+		{"another instance", map[string]string{labelManaged: "true", labelInstance: "api-2"}, false},
+		{"not managed", map[string]string{labelInstance: "api-1"}, false},
+		{"unlabeled", nil, false},
+	} {
+		if got := m.managedLabels(tc.labels); got != tc.want {
+			t.Errorf("%s: managedLabels = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
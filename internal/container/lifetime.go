@@ -0,0 +1,89 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// errNoCreationTime is returned for containers without a readable creation
+// label, e.g. ones created before the label existed.
+var errNoCreationTime = errors.New("container has no creation time")
+
+// LifetimeReporter is implemented by managers that know when a container was
+// created, so the TTL worker can bound how long terminal activity alone keeps
+// it alive.
+type LifetimeReporter interface {
+	// ContainerCreatedAt returns when the container was created.
+	ContainerCreatedAt(ctx context.Context, containerID string) (time.Time, error)
+}
+
+// ContainerCreatedAt returns the creation time recorded in the container's
+// labels.
+func (m *DockerManager) ContainerCreatedAt(ctx context.Context, containerID string) (time.Time, error) {
+	inspect, err := m.cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("inspect container %s: %w", containerID, err)
+	}
+	if inspect.Config == nil {
+		return time.Time{}, errNoCreationTime
+	}
+	createdAt, ok := labeledCreatedAt(inspect.Config.Labels)
+	if !ok {
+		return time.Time{}, errNoCreationTime
+	}
+	return createdAt, nil
+}
+
+// ContainerCreatedAt returns the creation time of a container on whichever
+// host runs it.
+func (p *PoolManager) ContainerCreatedAt(ctx context.Context, containerID string) (time.Time, error) {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return time.Time{}, errContainerNotRunning
+	}
+	return host.mgr.ContainerCreatedAt(ctx, containerID)
+}
+
+// ContainerCreatedAt returns the creation time recorded in the pod's
+// annotations.
+func (m *KubernetesManager) ContainerCreatedAt(ctx context.Context, containerID string) (time.Time, error) {
+	pod, err := m.getPod(ctx, containerID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("get pod %s: %w", containerID, err)
+	}
+	createdAt, ok := labeledCreatedAt(pod.Metadata.tags())
+	if !ok {
+		return time.Time{}, errNoCreationTime
+	}
+	return createdAt, nil
+}
+
+// outlivedMaxLifetime reports whether a container is older than maxLifetime,
+// past which terminal activity no longer keeps an idle session. A zero
+// maxLifetime, a manager that cannot report ages or an age that cannot be
+// read never ends a session.
+func outlivedMaxLifetime(ctx context.Context, mgr Manager, containerID string, maxLifetime time.Duration) bool {
+	if maxLifetime <= 0 {
+		return false
+	}
+	reporter, ok := mgr.(LifetimeReporter)
+	if !ok {
+		return false
+	}
+	createdAt, err := reporter.ContainerCreatedAt(ctx, containerID)
+	if err != nil {
+		slog.Warn("TTL worker failed to read container age", "error", err, "container_id", containerID)
+		return false
+	}
+	if time.Since(createdAt) < maxLifetime {
+		return false
+	}
+	slog.Info("TTL worker ignoring terminal activity of container past its maximum lifetime",
+		"container_id", containerID,
+		"created_at", createdAt,
+		"max_lifetime", maxLifetime)
+	return true
+}
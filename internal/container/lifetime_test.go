@@ -0,0 +1,41 @@
+package container
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// agingManager reports a fixed creation time for every container.
+type agingManager struct {
+	Manager
+	createdAt time.Time
+	err       error
+}
+
+func (m *agingManager) ContainerCreatedAt(context.Context, string) (time.Time, error) {
+	return m.createdAt, m.err
+}
+
+func TestOutlivedMaxLifetime(t *testing.T) {
+	ctx := context.Background()
+	old := &agingManager{createdAt: time.Now().Add(-3 * time.Hour)}
+	young := &agingManager{createdAt: time.Now().Add(-time.Hour)}
+
+	for _, tc := range []struct {
+		name        string
+		mgr         Manager
+		maxLifetime time.Duration
+		want        bool
+	}{
+		{"older than the limit", old, 2 * time.Hour, true},
+		{"younger than the limit", young, 2 * time.Hour, false},
+		{"limit disabled", old, 0, false},
+		{"age unreadable", &agingManager{err: errNoCreationTime}, 2 * time.Hour, false},
+		{"manager without ages", struct{ Manager }{}, time.Nanosecond, false},
+	} {
+		if got := outlivedMaxLifetime(ctx, tc.mgr, "c1", tc.maxLifetime); got != tc.want {
+			t.Errorf("%s: outlivedMaxLifetime = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -1,4 +1,5 @@
-// Package container provides Docker container management for playground sessions.
+// Package container provides container management for playground sessions,
+// on Docker or Podman hosts or a Kubernetes cluster.
 package container
 
 import (
@@ -8,13 +9,17 @@ import (
 	"io"
 	"log/slog"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
 	"github.com/containerd/errdefs"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
 )
 
@@ -35,14 +40,34 @@ const (
 	// Playground network configuration.
 	playgroundNetwork = "shsh-playground"
 	playgroundSubnet  = "172.28.0.0/16"
+
+	// dockerEmbeddedDNS is the resolver of containers on user-defined networks.
+	dockerEmbeddedDNS = "127.0.0.11"
+)
+
+var (
+	errDNSFixCommandFailed = errors.New("dns fix command failed")
+	errContainerNotRunning = errors.New("container is not running")
+	errContainerUnhealthy  = errors.New("container reported unhealthy")
+	errProbeFailed         = errors.New("health probe failed")
+	errNetworkAllowsEgress = errors.New("the deny egress policy is configured but the playground network allows egress; remove it so it is recreated as internal")
 )
 
-var errDNSFixCommandFailed = errors.New("dns fix command failed")
+// containerDNS are the upstream resolvers of learner containers, queried by
+// Docker's embedded DNS or, under gVisor, directly.
+var containerDNS = []string{"8.8.8.8", "8.8.4.4"}
+
+// healthProbeCmd is run inside containers to confirm the sandbox can still
+// start a shell.
+var healthProbeCmd = []string{"/bin/bash", "-c", "true"}
 
 // Manager defines the interface for managing playground containers.
 type Manager interface {
 	// EnsureContainer ensures a container exists and is running for a user.
-	EnsureContainer(ctx context.Context, userID string, currentContainerID string, lastSeenAt time.Time, env map[string]string) (string, error)
+	// image is the image reference new containers are created from; empty
+	// uses the default playground image. An existing container of another
+	// image is replaced unless image is empty.
+	EnsureContainer(ctx context.Context, userID string, currentContainerID string, image string, lastSeenAt time.Time, env map[string]string) (string, error)
 
 	// StopContainer stops and removes a container.
 	StopContainer(ctx context.Context, containerID string) error
@@ -50,17 +75,27 @@ type Manager interface {
 	// IsRunning checks if a container is currently running.
 	IsRunning(ctx context.Context, containerID string) (bool, error)
 
+	// ProbeContainer verifies a running container can still execute a shell.
+	ProbeContainer(ctx context.Context, containerID string) error
+
 	// CreateExecSession creates a new exec session in a running container.
 	CreateExecSession(ctx context.Context, containerID string) (string, io.ReadWriteCloser, error)
 
 	// ResizeExecSession resizes a running exec session.
 	ResizeExecSession(ctx context.Context, execID string, cols, rows uint) error
 
-	// Client returns the underlying Docker client.
+	// Client returns the underlying Docker client, or nil when the manager
+	// has no single Docker daemon.
 	Client() *client.Client
 
 	// EnsureNetwork creates the custom bridge network if it doesn't exist.
 	EnsureNetwork(ctx context.Context) (string, error)
+
+	// Runtime reports which OCI runtime new containers are created with.
+	Runtime() RuntimeStatus
+
+	// ReapOrphans removes labeled resources whose owner no longer exists.
+	ReapOrphans(ctx context.Context, exists OwnerLookup, grace time.Duration) (ReapResult, error)
 }
 
 // DockerManager implements Manager using the Docker API.
@@ -68,6 +103,14 @@ type DockerManager struct {
 	cli     *client.Client
 	runtime string // Container runtime: "" = default (runc), "runsc" = gVisor
 	cfg     *config.Config
+
+	runtimeMu     sync.RWMutex
+	runtimeStatus RuntimeStatus
+
+	events   EventRecorder // nil unless lifecycle events are recorded
+	stopping sync.Map      // IDs of containers StopContainer is stopping
+
+	prePull prePullState
 }
 
 // NewDockerManager creates a new Docker-backed container manager.
@@ -83,7 +126,9 @@ func NewDockerManager(runtime string) (Manager, error) {
 	} else {
 		slog.Info("Docker client initialized", "runtime", "default")
 	}
-	return &DockerManager{cli: cli, runtime: runtime}, nil
+	m := &DockerManager{cli: cli, runtime: runtime}
+	m.initRuntime()
+	return m, nil
 }
 
 // NewDockerManagerWithConfig creates a new Docker-backed container manager with configuration.
@@ -97,15 +142,30 @@ func NewDockerManagerWithConfig(cfg *config.Config) (Manager, error) {
 	} else {
 		slog.Info("Docker client initialized", "runtime", "default")
 	}
-	return &DockerManager{cli: cli, runtime: cfg.ContainerRuntime, cfg: cfg}, nil
+	m := &DockerManager{cli: cli, runtime: cfg.ContainerRuntime, cfg: cfg}
+	m.initRuntime()
+	return m, nil
+}
+
+// initRuntime detects runtime availability at startup so a missing runsc is
+// reported immediately instead of on the first provision.
+func (m *DockerManager) initRuntime() {
+	ctx, cancel := context.WithTimeout(context.Background(), runtimeDetectTimeout)
+	defer cancel()
+	m.runtimeStatus = m.detectRuntime(ctx)
+	logRuntimeStatus(m.runtimeStatus)
 }
 
 // EnsureContainer ensures a container exists and is running for a user.
 //
 //nolint:gocognit,gocyclo,nestif // Orchestration flow is intentionally centralized for lifecycle correctness.
-func (m *DockerManager) EnsureContainer(ctx context.Context, userID string, currentContainerID string, lastSeenAt time.Time, env map[string]string) (string, error) {
+func (m *DockerManager) EnsureContainer(ctx context.Context, userID string, currentContainerID string, image string, lastSeenAt time.Time, env map[string]string) (string, error) {
 	containerName := fmt.Sprintf("playground-%s", userID)
-	volumeName := fmt.Sprintf("playground-%s-data", userID)
+	volumeName := volumeNameFor(userID)
+	changeImage := image != ""
+	if image == "" {
+		image = imageName
+	}
 
 	// Check if container already exists.
 	inspect, err := m.cli.ContainerInspect(ctx, containerName)
@@ -117,11 +177,32 @@ func (m *DockerManager) EnsureContainer(ctx context.Context, userID string, curr
 				"container_id", inspect.ID,
 				"user_id", userID,
 			)
-			if err := m.StopContainer(ctx, inspect.ID); err != nil {
+			if err := m.StopContainer(WithLifecycleReason(ctx, ReasonUnbound), inspect.ID); err != nil {
 				slog.Warn("Failed to stop unbound container before recreation", "error", err, "container_id", inspect.ID)
 			}
+		} else if changeImage && inspect.Config != nil && inspect.Config.Image != image {
+			slog.Info("Replacing container with another image",
+				"container_id", inspect.ID,
+				"user_id", userID,
+				"from", inspect.Config.Image,
+				"to", image)
+			if err := m.StopContainer(WithLifecycleReason(ctx, ReasonImageChange), inspect.ID); err != nil {
+				slog.Warn("Failed to stop container before image change", "error", err, "container_id", inspect.ID)
+			}
 		} else {
+			if err := m.applyResourceTier(ctx, inspect); err != nil {
+				slog.Warn("Failed to apply resource tier, keeping current limits", "error", err, "user_id", userID)
+			}
 			if inspect.State.Running {
+				if inspect.State.Paused {
+					slog.Info("Resuming paused container", "container_id", inspect.ID, "user_id", userID)
+					ReportProgress(ctx, StageStarting)
+					if err := m.cli.ContainerUnpause(ctx, inspect.ID); err != nil {
+						return "", fmt.Errorf("unpause container %s: %w", inspect.ID, err)
+					}
+					RecordEvent(ctx, m.events, userID, inspect.ID, domain.ContainerEventStart, ReasonUnpause)
+					return inspect.ID, nil
+				}
 				slog.Info("Container already running", "container_id", inspect.ID, "user_id", userID)
 				return inspect.ID, nil
 			}
@@ -129,52 +210,86 @@ func (m *DockerManager) EnsureContainer(ctx context.Context, userID string, curr
 			// Check if within grace period for restart.
 			if time.Since(lastSeenAt) < restartGracePeriod {
 				slog.Info("Restarting stopped container", "container_id", inspect.ID, "user_id", userID)
+				ReportProgress(ctx, StageStarting)
 				if err := m.cli.ContainerStart(ctx, inspect.ID, container.StartOptions{}); err != nil {
 					return "", fmt.Errorf("restart container %s: %w", inspect.ID, err)
 				}
+				RecordEvent(ctx, m.events, userID, inspect.ID, domain.ContainerEventStart, ReasonRestart)
+				if err := m.enforceEgress(ctx, userID, inspect.ID); err != nil {
+					return "", err
+				}
 				return inspect.ID, nil
 			}
 
 			// Outside grace period: recreate.
 			slog.Info("Container expired, recreating", "container_id", inspect.ID, "user_id", userID)
-			if err := m.StopContainer(ctx, inspect.ID); err != nil {
+			if err := m.StopContainer(WithLifecycleReason(ctx, ReasonRecreate), inspect.ID); err != nil {
 				slog.Warn("Failed to stop container before recreation", "error", err, "container_id", inspect.ID)
 			}
 		}
 	}
 
-	slog.Info("Creating new container", "user_id", userID, "volume", volumeName)
+	runtimeStatus := m.refreshRuntime(ctx)
+	if !runtimeStatus.Usable() {
+		return "", fmt.Errorf("%w: %s", ErrRuntimeUnavailable, runtimeStatus.Error)
+	}
+	if runtimeStatus.Fallback {
+		slog.Warn("Creating container with fallback runtime",
+			"user_id", userID,
+			"requested", runtimeStatus.Requested,
+			"effective", runtimeStatus.Effective)
+	}
+
+	if err := m.ensureImage(ctx, image); err != nil {
+		return "", err
+	}
+
+	tier, _ := resourceTier(ctx, m.cfg)
+	ReportProgress(ctx, StageCreating)
+	slog.Info("Creating new container", "user_id", userID, "volume", volumeName, "image", image, "tier", tier.Name)
 
 	envVars := make([]string, 0, len(env))
 	for k, v := range env {
 		envVars = append(envVars, fmt.Sprintf("%s=%s", k, v))
 	}
+	if packageProxyEnabled(m.cfg) {
+		envVars = append(envVars, packageProxyEnv(m.cfg)...)
+	}
+
+	// Create the volume explicitly so it carries labels; an existing volume is
+	// returned unchanged.
+	sessionID := identity.SessionIDFromContext(ctx)
+	if _, err := m.cli.VolumeCreate(ctx, volume.CreateOptions{Name: volumeName, Labels: m.resourceLabels(userID, sessionID)}); err != nil {
+		return "", fmt.Errorf("create volume %s: %w", volumeName, err)
+	}
+
+	labels := m.resourceLabels(userID, sessionID)
+	addRuntimeLabels(labels, runtimeStatus)
+	if tier.Name != "" {
+		labels[labelTier] = tier.Name
+	}
 
 	config := &container.Config{
-		Image:      imageName,
-		User:       containerUser,
-		WorkingDir: workingDir,
-		Tty:        true,
-		Env:        envVars,
+		Image:       image,
+		User:        containerUser,
+		WorkingDir:  workingDir,
+		Tty:         true,
+		Env:         envVars,
+		Labels:      labels,
+		Healthcheck: m.healthcheck(),
 	}
 
 	// Use config values if available, otherwise use defaults
-	memoryLimit := int64(512 * 1024 * 1024) // 512MB default
-	cpuQuotaVal := int64(50000)             // 0.5 CPU default
-	pidsLimitVal := int64(256)              // default
-	createRetryAttempts := 20               // default
+	createRetryAttempts := 20 // default
 	createRetryDelay := 250 * time.Millisecond
 
 	if m.cfg != nil {
-		memoryLimit = m.cfg.Container.MemoryLimitBytes
-		cpuQuotaVal = m.cfg.Container.CPUQuota
-		pidsLimitVal = m.cfg.Container.PidsLimit
 		createRetryAttempts = m.cfg.Container.CreateRetryAttempts
 		createRetryDelay = m.cfg.Container.CreateRetryDelay
 	}
 
 	hostConfig := &container.HostConfig{
-		Runtime:     m.runtime,
+		Runtime:     runtimeStatus.Effective,
 		NetworkMode: container.NetworkMode(playgroundNetwork),
 		Mounts: []mount.Mount{{
 			Type:   mount.TypeVolume,
@@ -182,11 +297,11 @@ func (m *DockerManager) EnsureContainer(ctx context.Context, userID string, curr
 			Target: mountPath,
 		}},
 		Resources: container.Resources{
-			Memory:    memoryLimit,
-			CPUQuota:  cpuQuotaVal,
-			PidsLimit: ptr(pidsLimitVal),
+			Memory:    tier.MemoryLimitBytes,
+			CPUQuota:  tier.CPUQuota,
+			PidsLimit: ptr(tier.PidsLimit),
 		},
-		DNS: []string{"8.8.8.8", "8.8.4.4"},
+		DNS: containerDNS,
 	}
 
 	var resp container.CreateResponse
@@ -212,7 +327,7 @@ func (m *DockerManager) EnsureContainer(ctx context.Context, userID string, curr
 		)
 
 		if inspect, inspectErr := m.cli.ContainerInspect(ctx, containerName); inspectErr == nil {
-			if stopErr := m.StopContainer(ctx, inspect.ID); stopErr != nil {
+			if stopErr := m.StopContainer(WithLifecycleReason(ctx, ReasonNameConflict), inspect.ID); stopErr != nil {
 				slog.Warn("Failed to stop conflicting container before retry", "container_id", inspect.ID, "error", stopErr)
 			}
 		}
@@ -227,16 +342,27 @@ func (m *DockerManager) EnsureContainer(ctx context.Context, userID string, curr
 		return "", fmt.Errorf("create container after retries: %w", createErr)
 	}
 
+	reason := lifecycleReason(ctx, ReasonProvision)
+	RecordEvent(ctx, m.events, userID, resp.ID, domain.ContainerEventCreate, reason)
+
+	ReportProgress(ctx, StageStarting)
 	if err := m.cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
 		if removeErr := m.cli.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true}); removeErr != nil && !errors.Is(removeErr, context.Canceled) {
 			slog.Warn("Failed to remove container after start failure", "container_id", resp.ID, "error", removeErr)
 		}
 		return "", fmt.Errorf("start container %s: %w", resp.ID, err)
 	}
+	RecordEvent(ctx, m.events, userID, resp.ID, domain.ContainerEventStart, reason)
+	if err := m.enforceEgress(ctx, userID, resp.ID); err != nil {
+		return "", err
+	}
+	if err := m.configurePackageProxy(ctx, resp.ID); err != nil {
+		slog.Warn("Failed to point apt at the package proxy", "error", err, "container_id", resp.ID)
+	}
 
 	// Fix DNS if using gVisor: Overwrite /etc/resolv.conf to bypass Docker's
 	// embedded DNS (127.0.0.11) which often fails with gVisor netstack.
-	if m.runtime == "runsc" {
+	if runtimeStatus.Effective == "runsc" {
 		if err := m.fixDNS(ctx, resp.ID); err != nil {
 			slog.Warn("Failed to apply DNS fix", "error", err)
 			// Proceed anyway, might work partially
@@ -249,7 +375,11 @@ func (m *DockerManager) EnsureContainer(ctx context.Context, userID string, curr
 
 // fixDNS forces public DNS servers into /etc/resolv.conf (gVisor workaround).
 func (m *DockerManager) fixDNS(ctx context.Context, containerID string) error {
-	cmd := []string{"sh", "-c", "echo 'nameserver 8.8.8.8' > /etc/resolv.conf && echo 'nameserver 8.8.4.4' >> /etc/resolv.conf"}
+	var resolvConf strings.Builder
+	for _, server := range containerDNS {
+		fmt.Fprintf(&resolvConf, "nameserver %s\n", server)
+	}
+	cmd := []string{"sh", "-c", fmt.Sprintf("printf '%s' > /etc/resolv.conf", resolvConf.String())}
 
 	execConfig := container.ExecOptions{
 		Cmd:  cmd,
@@ -288,9 +418,11 @@ func (m *DockerManager) fixDNS(ctx context.Context, containerID string) error {
 // It is idempotent and handles concurrent calls gracefully.
 func (m *DockerManager) StopContainer(ctx context.Context, containerID string) error {
 	slog.Info("Stopping container", "container_id", containerID)
+	m.stopping.Store(containerID, struct{}{})
+	defer m.stopping.Delete(containerID)
 
 	// Check if container exists before trying to stop
-	_, err := m.cli.ContainerInspect(ctx, containerID)
+	inspect, err := m.cli.ContainerInspect(ctx, containerID)
 	if err != nil {
 		if errdefs.IsNotFound(err) {
 			slog.Debug("Container already removed", "container_id", containerID)
@@ -299,12 +431,25 @@ func (m *DockerManager) StopContainer(ctx context.Context, containerID string) e
 		return fmt.Errorf("inspect container %s: %w", containerID, err)
 	}
 
-	// Stop the container with timeout
-	timeout := 10 // default 10 seconds
-	if m.cfg != nil {
-		timeout = int(m.cfg.Timeout.ContainerStop.Seconds())
+	var labels map[string]string
+	if inspect.Config != nil {
+		labels = inspect.Config.Labels
 	}
-	if err := m.cli.ContainerStop(ctx, containerID, container.StopOptions{Timeout: &timeout}); err != nil {
+	policy := m.stopPolicyFor(containerID, labels)
+	if inspect.State != nil && inspect.State.Paused {
+		// Frozen processes can neither run the pre-stop hook nor handle the
+		// stop signal, so thaw them first.
+		if err := m.cli.ContainerUnpause(ctx, containerID); err != nil {
+			slog.Debug("Failed to unpause container before stop", "container_id", containerID, "error", err)
+		}
+	}
+	if inspect.State != nil && inspect.State.Running {
+		m.runPreStop(ctx, containerID, policy)
+	}
+
+	// Stop the container; Docker escalates to SIGKILL after the timeout.
+	timeout := int(policy.stopTimeout.Seconds())
+	if err := m.cli.ContainerStop(ctx, containerID, container.StopOptions{Signal: policy.stopSignal, Timeout: &timeout}); err != nil {
 		// Container may already be stopped or being removed by another process
 		if errdefs.IsNotFound(err) {
 			slog.Debug("Container already stopped/removed", "container_id", containerID)
@@ -337,7 +482,12 @@ func (m *DockerManager) StopContainer(ctx context.Context, containerID string) e
 		return fmt.Errorf("remove container %s: %w", containerID, err)
 	}
 
+	RecordEvent(ctx, m.events, labels[labelOwner], containerID, domain.ContainerEventStop, lifecycleReason(ctx, ""))
 	slog.Info("Container stopped and removed", "container_id", containerID)
+	if owner := labels[labelOwner]; owner != "" && !isLabNode(labels) {
+		// A lab lives as long as its user's container.
+		m.removeTopologyOf(ctx, owner)
+	}
 	return nil
 }
 
@@ -353,16 +503,78 @@ func (m *DockerManager) IsRunning(ctx context.Context, containerID string) (bool
 	return inspect.State.Running, nil
 }
 
+// healthcheck returns the Docker HEALTHCHECK for playground containers, or nil
+// when health probing is disabled.
+func (m *DockerManager) healthcheck() *container.HealthConfig {
+	interval, timeout, retries := defaultHealthInterval, defaultHealthTimeout, defaultHealthRetries
+	if m.cfg != nil {
+		interval = m.cfg.Container.HealthInterval
+		timeout = m.cfg.Container.HealthTimeout
+		retries = m.cfg.Container.HealthRetries
+	}
+	if interval <= 0 {
+		return nil
+	}
+	return &container.HealthConfig{
+		Test:     append([]string{"CMD"}, healthProbeCmd...),
+		Interval: interval,
+		Timeout:  timeout,
+		Retries:  retries,
+	}
+}
+
+// ProbeContainer verifies a running container can still execute a shell.
+// It fails fast on Docker's own health status and otherwise runs the probe
+// command through exec, bounded by ctx.
+func (m *DockerManager) ProbeContainer(ctx context.Context, containerID string) error {
+	inspect, err := m.cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return fmt.Errorf("inspect container %s: %w", containerID, err)
+	}
+	if !inspect.State.Running {
+		return errContainerNotRunning
+	}
+	if inspect.State.Paused {
+		// Paused on purpose; exec would fail until it is resumed.
+		return nil
+	}
+	if inspect.State.Health != nil && inspect.State.Health.Status == container.Unhealthy {
+		return fmt.Errorf("%w (failing streak %d)", errContainerUnhealthy, inspect.State.Health.FailingStreak)
+	}
+
+	exitCode, err := m.execAndWait(ctx, containerID, containerUser, healthProbeCmd)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errProbeFailed, err)
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("%w with exit code %d", errProbeFailed, exitCode)
+	}
+	return nil
+}
+
 // CreateExecSession creates a new exec session in a running container.
 func (m *DockerManager) CreateExecSession(ctx context.Context, containerID string) (string, io.ReadWriteCloser, error) {
+	return m.CreateTerminalExecSession(ctx, containerID, TerminalOptions{})
+}
+
+// CreateTerminalExecSession creates an exec session for the client terminal
+// described by opts.
+func (m *DockerManager) CreateTerminalExecSession(ctx context.Context, containerID string, opts TerminalOptions) (string, io.ReadWriteCloser, error) {
+	return m.createTTYExec(ctx, containerID, containerUser, []string{"/bin/bash"}, opts)
+}
+
+// createTTYExec starts cmd as user on a TTY sized for the client terminal.
+func (m *DockerManager) createTTYExec(ctx context.Context, containerID, user string, cmd []string, opts TerminalOptions) (string, io.ReadWriteCloser, error) {
+	cols, rows := opts.size()
 	execConfig := container.ExecOptions{
 		AttachStdin:  true,
 		AttachStdout: true,
 		AttachStderr: true,
 		Tty:          true,
-		Cmd:          []string{"/bin/bash"},
-		User:         containerUser,
-		ConsoleSize:  &[2]uint{defaultCols, defaultRows},
+		Cmd:          cmd,
+		User:         user,
+		Env:          opts.env(),
+		ConsoleSize:  &[2]uint{cols, rows},
 	}
 
 	resp, err := m.cli.ContainerExecCreate(ctx, containerID, execConfig)
@@ -375,7 +587,7 @@ func (m *DockerManager) CreateExecSession(ctx context.Context, containerID strin
 		return "", nil, fmt.Errorf("attach to exec session %s: %w", resp.ID, err)
 	}
 
-	slog.Info("Exec session created", "exec_id", resp.ID, "container_id", containerID)
+	slog.Info("Exec session created", "exec_id", resp.ID, "container_id", containerID, "term", opts.Term, "cols", cols, "rows", rows)
 	return resp.ID, attachResp.Conn, nil
 }
 
@@ -395,8 +607,26 @@ func (m *DockerManager) Client() *client.Client {
 	return m.cli
 }
 
-// EnsureNetwork creates the custom bridge network if it doesn't exist.
+// EnsureNetwork creates the custom bridge network if it doesn't exist, then
+// starts the package proxy on it when enabled.
 func (m *DockerManager) EnsureNetwork(ctx context.Context) (string, error) {
+	networkID, err := m.ensurePlaygroundNetwork(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := m.ensurePackageProxy(ctx); err != nil {
+		return "", err
+	}
+	return networkID, nil
+}
+
+// ensurePlaygroundNetwork creates the playground network. With the deny
+// egress policy the network is internal, without a route out, and an
+// existing network that allows egress is an error rather than silently
+// reused. The allowlist policy is enforced per container on start.
+func (m *DockerManager) ensurePlaygroundNetwork(ctx context.Context) (string, error) {
+	egressDeny := egressPolicy(m.cfg) == config.EgressDeny
+
 	// Check if network already exists.
 	networks, err := m.cli.NetworkList(ctx, network.ListOptions{})
 	if err != nil {
@@ -405,14 +635,22 @@ func (m *DockerManager) EnsureNetwork(ctx context.Context) (string, error) {
 
 	for _, nw := range networks {
 		if nw.Name == playgroundNetwork {
-			slog.Info("Playground network already exists", "network_id", nw.ID)
+			if egressDeny && !nw.Internal {
+				return "", fmt.Errorf("%w: %s", errNetworkAllowsEgress, playgroundNetwork)
+			}
+			if !egressDeny && nw.Internal {
+				slog.Warn("Playground network is internal, so containers have no egress whatever the policy; remove it so it is recreated", "network", playgroundNetwork)
+			}
+			slog.Info("Playground network already exists", "network_id", nw.ID, "egress_deny", nw.Internal)
 			return nw.ID, nil
 		}
 	}
 
 	// Create the network.
 	createResp, err := m.cli.NetworkCreate(ctx, playgroundNetwork, network.CreateOptions{
-		Driver: "bridge",
+		Driver:   "bridge",
+		Internal: egressDeny,
+		Labels:   m.resourceLabels("", ""),
 		IPAM: &network.IPAM{
 			Config: []network.IPAMConfig{
 				{
@@ -425,7 +663,7 @@ func (m *DockerManager) EnsureNetwork(ctx context.Context) (string, error) {
 		return "", fmt.Errorf("create network %s: %w", playgroundNetwork, err)
 	}
 
-	slog.Info("Playground network created", "network_id", createResp.ID, "subnet", playgroundSubnet)
+	slog.Info("Playground network created", "network_id", createResp.ID, "subnet", playgroundSubnet, "egress_deny", egressDeny)
 	return createResp.ID, nil
 }
 
@@ -0,0 +1,77 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/containerd/errdefs"
+)
+
+// Pauser is implemented by managers that can freeze a container's processes
+// without stopping it, so an idle sandbox stops using CPU but keeps its state.
+type Pauser interface {
+	// PauseContainer freezes a running container; pausing a paused container
+	// is a no-op.
+	PauseContainer(ctx context.Context, containerID string) error
+
+	// ResumeContainer unfreezes a paused container; resuming a container that
+	// is not paused is a no-op.
+	ResumeContainer(ctx context.Context, containerID string) error
+}
+
+// PauseContainer freezes the container's processes.
+func (m *DockerManager) PauseContainer(ctx context.Context, containerID string) error {
+	inspect, err := m.cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return fmt.Errorf("inspect container %s: %w", containerID, err)
+	}
+	if inspect.State == nil || !inspect.State.Running {
+		return errContainerNotRunning
+	}
+	if inspect.State.Paused {
+		return nil
+	}
+	if err := m.cli.ContainerPause(ctx, containerID); err != nil {
+		return fmt.Errorf("pause container %s: %w", containerID, err)
+	}
+	slog.Info("Container paused", "container_id", containerID)
+	return nil
+}
+
+// ResumeContainer unfreezes the container if it is paused.
+func (m *DockerManager) ResumeContainer(ctx context.Context, containerID string) error {
+	inspect, err := m.cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("inspect container %s: %w", containerID, err)
+	}
+	if inspect.State == nil || !inspect.State.Paused {
+		return nil
+	}
+	if err := m.cli.ContainerUnpause(ctx, containerID); err != nil {
+		return fmt.Errorf("unpause container %s: %w", containerID, err)
+	}
+	slog.Info("Container resumed", "container_id", containerID)
+	return nil
+}
+
+// PauseContainer freezes a container on whichever host runs it.
+func (p *PoolManager) PauseContainer(ctx context.Context, containerID string) error {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return errContainerNotRunning
+	}
+	return host.mgr.PauseContainer(ctx, containerID)
+}
+
+// ResumeContainer unfreezes a container on whichever host runs it.
+func (p *PoolManager) ResumeContainer(ctx context.Context, containerID string) error {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return nil
+	}
+	return host.mgr.ResumeContainer(ctx, containerID)
+}
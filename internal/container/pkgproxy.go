@@ -0,0 +1,201 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+)
+
+const (
+	// Package proxy container, one per Docker host. It takes a fixed
+	// address at the top of the playground subnet, clear of the addresses
+	// Docker hands out from the bottom, so learner containers can be
+	// configured before it is inspected.
+	pkgProxyName   = "shsh-pkgproxy"
+	pkgProxyVolume = "shsh-pkgproxy-cache"
+	pkgProxyIP     = "172.28.255.250"
+
+	// pkgProxyAptConf points apt at the proxy in learner containers.
+	pkgProxyAptConf = "/etc/apt/apt.conf.d/01shsh-proxy"
+
+	// pkgProxyRole labels the proxy container and its cache volume. They
+	// are shared, so they carry no owner and are not labelled managed: the
+	// reaper and host capacity counts leave them alone.
+	pkgProxyRole = "pkgproxy"
+)
+
+var errPackageProxyFailed = errors.New("package proxy could not be configured")
+
+// packageProxyEnabled reports whether learner containers use the proxy.
+func packageProxyEnabled(cfg *config.Config) bool {
+	return cfg != nil && cfg.PackageProxy.Enabled
+}
+
+// packageProxyURL returns the proxy's address as seen from learner
+// containers.
+func packageProxyURL(cfg *config.Config) string {
+	port := "3142"
+	if _, p, err := net.SplitHostPort(cfg.PackageProxy.ListenAddr); err == nil && p != "" {
+		port = p
+	}
+	return "http://" + net.JoinHostPort(pkgProxyIP, port)
+}
+
+// packageProxyEnv returns the environment pointing pip in a learner
+// container at the proxy.
+func packageProxyEnv(cfg *config.Config) []string {
+	return []string{
+		"PIP_INDEX_URL=" + packageProxyURL(cfg) + "/pypi/simple/",
+		"PIP_TRUSTED_HOST=" + pkgProxyIP,
+	}
+}
+
+// pkgProxyProcessEnv returns the environment of the proxy process, which
+// reads the same settings as the server.
+func pkgProxyProcessEnv(cfg *config.Config) []string {
+	p := cfg.PackageProxy
+	return []string{
+		"SHSH_PKG_PROXY=true",
+		"SHSH_PKG_PROXY_LISTEN_ADDR=" + p.ListenAddr,
+		"SHSH_PKG_PROXY_CACHE_DIR=" + p.CacheDir,
+		"SHSH_PKG_PROXY_MAX_CACHE_BYTES=" + strconv.FormatInt(p.MaxCacheBytes, 10),
+		"SHSH_PKG_PROXY_ALLOW=" + strings.Join(p.Allow, ","),
+		"SHSH_PKG_PROXY_DENY=" + strings.Join(p.Deny, ","),
+		"SHSH_PKG_PROXY_APT_HOSTS=" + strings.Join(p.AptHosts, ","),
+		"SHSH_PKG_PROXY_PYPI_INDEX=" + p.PyPIIndex,
+		"SHSH_PKG_PROXY_PYPI_FILES=" + p.PyPIFiles,
+	}
+}
+
+// pkgProxyLabels returns the labels of the proxy container and volume.
+func (m *DockerManager) pkgProxyLabels() map[string]string {
+	labels := m.resourceLabels("", "")
+	delete(labels, labelManaged)
+	labels[labelRole] = pkgProxyRole
+	return labels
+}
+
+// ensurePackageProxy starts the proxy container on the playground network
+// if it is enabled and not already running. With the deny egress policy the
+// playground network has no route out, so the proxy is also attached to the
+// default bridge to reach the mirrors; learners still only reach the proxy.
+func (m *DockerManager) ensurePackageProxy(ctx context.Context) error {
+	if !packageProxyEnabled(m.cfg) {
+		return nil
+	}
+	cfg := m.cfg.PackageProxy
+
+	inspect, err := m.cli.ContainerInspect(ctx, pkgProxyName)
+	switch {
+	case err == nil && m.pkgProxyCurrent(inspect.Config):
+		if inspect.State != nil && inspect.State.Running {
+			slog.Info("Package proxy already running", "container_id", inspect.ID)
+			return nil
+		}
+		if err := m.cli.ContainerStart(ctx, inspect.ID, container.StartOptions{}); err != nil {
+			return fmt.Errorf("start package proxy: %w", err)
+		}
+		slog.Info("Package proxy restarted", "container_id", inspect.ID)
+		return nil
+	case err == nil:
+		slog.Info("Replacing package proxy with changed settings", "container_id", inspect.ID, "image", cfg.Image)
+		if err := m.cli.ContainerRemove(ctx, inspect.ID, container.RemoveOptions{Force: true}); err != nil && !errdefs.IsNotFound(err) {
+			return fmt.Errorf("remove package proxy: %w", err)
+		}
+	case !errdefs.IsNotFound(err):
+		return fmt.Errorf("inspect package proxy: %w", err)
+	}
+
+	if err := m.ensureImage(ctx, cfg.Image); err != nil {
+		return err
+	}
+	if _, err := m.cli.VolumeCreate(ctx, volume.CreateOptions{Name: pkgProxyVolume, Labels: m.pkgProxyLabels()}); err != nil {
+		return fmt.Errorf("create volume %s: %w", pkgProxyVolume, err)
+	}
+
+	proxyConfig := &container.Config{
+		Image:  cfg.Image,
+		Env:    pkgProxyProcessEnv(m.cfg),
+		Labels: m.pkgProxyLabels(),
+	}
+	hostConfig := &container.HostConfig{
+		NetworkMode:    container.NetworkMode(playgroundNetwork),
+		RestartPolicy:  container.RestartPolicy{Name: container.RestartPolicyUnlessStopped},
+		ReadonlyRootfs: true,
+		CapDrop:        []string{"ALL"},
+		SecurityOpt:    []string{"no-new-privileges"},
+		Mounts: []mount.Mount{{
+			Type:   mount.TypeVolume,
+			Source: pkgProxyVolume,
+			Target: cfg.CacheDir,
+		}},
+		Resources: container.Resources{
+			Memory:    512 * 1024 * 1024,
+			PidsLimit: ptr(int64(256)),
+		},
+	}
+	networkConfig := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			playgroundNetwork: {IPAMConfig: &network.EndpointIPAMConfig{IPv4Address: pkgProxyIP}},
+		},
+	}
+	resp, err := m.cli.ContainerCreate(ctx, proxyConfig, hostConfig, networkConfig, nil, pkgProxyName)
+	if err != nil {
+		return fmt.Errorf("create package proxy: %w", err)
+	}
+	if egressPolicy(m.cfg) == config.EgressDeny {
+		if err := m.cli.NetworkConnect(ctx, network.NetworkBridge, resp.ID, nil); err != nil {
+			return fmt.Errorf("connect package proxy to %s: %w", network.NetworkBridge, err)
+		}
+	}
+	if err := m.cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		return fmt.Errorf("start package proxy: %w", err)
+	}
+	slog.Info("Package proxy started", "container_id", resp.ID, "address", packageProxyURL(m.cfg),
+		"allow", len(cfg.Allow), "deny", len(cfg.Deny))
+	return nil
+}
+
+// pkgProxyCurrent reports whether an existing proxy container was created
+// with the configured image and settings, so a changed policy takes effect
+// when the server restarts.
+func (m *DockerManager) pkgProxyCurrent(cfg *container.Config) bool {
+	if cfg == nil || cfg.Image != m.cfg.PackageProxy.Image {
+		return false
+	}
+	for _, env := range pkgProxyProcessEnv(m.cfg) {
+		if !slices.Contains(cfg.Env, env) {
+			return false
+		}
+	}
+	return true
+}
+
+// configurePackageProxy points apt in a new learner container at the proxy.
+// pip is configured through the environment when the container is created.
+func (m *DockerManager) configurePackageProxy(ctx context.Context, containerID string) error {
+	if !packageProxyEnabled(m.cfg) {
+		return nil
+	}
+	line := fmt.Sprintf("Acquire::http::Proxy %q;", packageProxyURL(m.cfg))
+	exitCode, err := m.execAndWait(ctx, containerID, "root", []string{"/bin/sh", "-c", `printf '%s\n' "$1" > "$2"`, "sh", line, pkgProxyAptConf})
+	if err != nil {
+		return fmt.Errorf("configure apt proxy: %w", err)
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("%w: writing %s exited with %d", errPackageProxyFailed, pkgProxyAptConf, exitCode)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/docker/docker/client"
+)
+
+// rootfulPodmanSocket is where a system-wide "podman system service" listens.
+const rootfulPodmanSocket = "unix:///run/podman/podman.sock"
+
+// podmanDetectTimeout bounds the version query identifying the engine.
+const podmanDetectTimeout = 5 * time.Second
+
+// NewPodmanManagerWithConfig creates a container manager for hosts without a
+// Docker daemon. It talks to Podman through its Docker-compatible API, which
+// covers every call DockerManager makes, including exec sessions and resizes,
+// so containers, volumes and the playground network behave as on Docker.
+func NewPodmanManagerWithConfig(cfg *config.Config) (Manager, error) {
+	host := podmanHost(cfg.Container.PodmanSocket)
+	cli, err := client.NewClientWithOpts(client.WithHost(host), client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, fmt.Errorf("create podman client for %s: %w", host, err)
+	}
+	if cfg.ContainerRuntime != "" {
+		slog.Info("Podman client initialized", "endpoint", host, "runtime", cfg.ContainerRuntime)
+	} else {
+		slog.Info("Podman client initialized", "endpoint", host, "runtime", "default")
+	}
+	logPodmanEngine(cli, host)
+
+	m := &DockerManager{cli: cli, runtime: cfg.ContainerRuntime, cfg: cfg}
+	m.initRuntime()
+	return m, nil
+}
+
+// podmanHost returns the Podman endpoint to use: socket if set, then
+// CONTAINER_HOST as the podman CLI does, then the rootless socket of the
+// current user when it exists, then the rootful one.
+func podmanHost(socket string) string {
+	if socket != "" {
+		return socket
+	}
+	if host := os.Getenv("CONTAINER_HOST"); host != "" {
+		return host
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		if path := filepath.Join(dir, "podman", "podman.sock"); fileExists(path) {
+			return "unix://" + path
+		}
+	}
+	return rootfulPodmanSocket
+}
+
+// logPodmanEngine reports which engine answers at host, warning when it is
+// unreachable or not Podman. Like the runtime check, it does not fail startup.
+func logPodmanEngine(cli *client.Client, host string) {
+	ctx, cancel := context.WithTimeout(context.Background(), podmanDetectTimeout)
+	defer cancel()
+	version, err := cli.ServerVersion(ctx)
+	if err != nil {
+		slog.Warn("Podman API unreachable, provisioning will fail until it is up", "endpoint", host, "error", err)
+		return
+	}
+	for _, component := range version.Components {
+		if strings.HasPrefix(component.Name, "Podman") {
+			slog.Info("Podman API available", "endpoint", host, "version", component.Version, "api_version", version.APIVersion)
+			return
+		}
+	}
+	slog.Warn("CONTAINER_BACKEND=podman but the endpoint is not Podman", "endpoint", host, "platform", version.Platform.Name)
+}
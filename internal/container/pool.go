@@ -0,0 +1,466 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// ErrNoHostCapacity is returned when every healthy pool host is at capacity.
+var ErrNoHostCapacity = errors.New("no docker host with free capacity")
+
+var errNoPoolHosts = errors.New("no docker hosts configured")
+
+// defaultHostCheckInterval is the default interval for pool host health checks.
+const defaultHostCheckInterval = 15 * time.Second
+
+// HostStatus reports the state of one pool host.
+type HostStatus struct {
+	Name     string `json:"name"`
+	Endpoint string `json:"endpoint"`
+	Healthy  bool   `json:"healthy"`
+	Running  int    `json:"running"`
+	Capacity int    `json:"capacity"`
+	Error    string `json:"error,omitempty"`
+}
+
+// HostReporter is implemented by managers that schedule across several hosts.
+type HostReporter interface {
+	Hosts() []HostStatus
+}
+
+// poolHost is one Docker endpoint in the pool.
+type poolHost struct {
+	config.DockerHost
+	mgr *DockerManager
+
+	// Guarded by PoolManager.mu.
+	healthy bool
+	running int
+	lastErr string
+}
+
+func (h *poolHost) hasCapacity() bool {
+	return h.Capacity == 0 || h.running < h.Capacity
+}
+
+// PoolManager implements Manager across several Docker hosts. Users stick to
+// the host holding their container or volume; new users are placed on the
+// least-loaded healthy host with free capacity.
+type PoolManager struct {
+	hosts []*poolHost
+
+	mu            sync.RWMutex
+	containerHost map[string]*poolHost
+	execHost      map[string]*poolHost
+}
+
+// NewPoolManagerWithConfig creates a manager for the hosts in
+// cfg.Container.Hosts. Hosts start healthy; StartHostHealthWorkerWithConfig
+// keeps their state current.
+func NewPoolManagerWithConfig(cfg *config.Config) (*PoolManager, error) {
+	if len(cfg.Container.Hosts) == 0 {
+		return nil, errNoPoolHosts
+	}
+
+	p := &PoolManager{
+		containerHost: make(map[string]*poolHost),
+		execHost:      make(map[string]*poolHost),
+	}
+	for _, host := range cfg.Container.Hosts {
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithHost(host.Endpoint), client.WithAPIVersionNegotiation())
+		if err != nil {
+			return nil, fmt.Errorf("create docker client for host %s: %w", host.Name, err)
+		}
+		slog.Info("Docker pool host initialized", "host", host.Name, "endpoint", host.Endpoint, "capacity", host.Capacity)
+
+		m := &DockerManager{cli: cli, runtime: cfg.ContainerRuntime, cfg: cfg}
+		m.initRuntime()
+		p.hosts = append(p.hosts, &poolHost{DockerHost: host, mgr: m, healthy: true})
+	}
+	return p, nil
+}
+
+// EnsureContainer ensures a container exists on the user's host, scheduling
+// new users onto the least-loaded healthy host.
+func (p *PoolManager) EnsureContainer(ctx context.Context, userID string, currentContainerID string, image string, lastSeenAt time.Time, env map[string]string) (string, error) {
+	host, reserved, err := p.hostForUser(ctx, userID, currentContainerID)
+	if err != nil {
+		return "", err
+	}
+
+	containerID, err := host.mgr.EnsureContainer(ctx, userID, currentContainerID, image, lastSeenAt, env)
+	if err != nil {
+		if reserved {
+			p.release(host)
+		}
+		return "", fmt.Errorf("host %s: %w", host.Name, err)
+	}
+	p.place(host, containerID, reserved)
+	return containerID, nil
+}
+
+// place records that host runs containerID. A slot reserved by leastLoaded
+// is kept for a new container and given back for a known one.
+func (p *PoolManager) place(host *poolHost, containerID string, reserved bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, known := p.containerHost[containerID]
+	switch {
+	case !known && !reserved:
+		host.running++
+	case known && reserved && host.running > 0:
+		host.running--
+	}
+	p.containerHost[containerID] = host
+}
+
+// release gives back a slot reserved by leastLoaded.
+func (p *PoolManager) release(host *poolHost) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if host.running > 0 {
+		host.running--
+	}
+}
+
+// hostForUser returns the host already holding the user's container or volume,
+// or schedules a new one. reserved reports whether a slot was reserved on the
+// host, which the caller must place or release.
+func (p *PoolManager) hostForUser(ctx context.Context, userID, currentContainerID string) (host *poolHost, reserved bool, err error) {
+	if currentContainerID != "" {
+		if host := p.hostOf(ctx, currentContainerID); host != nil {
+			return host, false, nil
+		}
+	}
+
+	containerName := fmt.Sprintf("playground-%s", userID)
+	volumeName := volumeNameFor(userID)
+	for _, host := range p.hosts {
+		if _, err := host.mgr.cli.ContainerInspect(ctx, containerName); err == nil {
+			return host, false, nil
+		}
+		if _, err := host.mgr.cli.VolumeInspect(ctx, volumeName); err == nil {
+			if !p.isHealthy(host) {
+				return nil, false, fmt.Errorf("%w: host %s holding user data is unhealthy", ErrNoHostCapacity, host.Name)
+			}
+			return host, false, nil
+		}
+	}
+
+	host, err = p.leastLoaded(userID)
+	return host, err == nil, err
+}
+
+// leastLoaded picks the healthy host with free capacity and the fewest running
+// containers, preferring earlier hosts on ties, and reserves a slot on it so
+// concurrent placements cannot overfill it.
+func (p *PoolManager) leastLoaded(userID string) (*poolHost, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var best *poolHost
+	for _, host := range p.hosts {
+		if !host.healthy || !host.hasCapacity() {
+			continue
+		}
+		if best == nil || host.running < best.running {
+			best = host
+		}
+	}
+	if best == nil {
+		return nil, ErrNoHostCapacity
+	}
+	best.running++
+	slog.Info("Scheduled user onto docker host", "user_id", userID, "host", best.Name, "running", best.running)
+	return best, nil
+}
+
+func (p *PoolManager) isHealthy(host *poolHost) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return host.healthy
+}
+
+// hostOf returns the host running containerID, searching every host when it
+// is not cached (e.g. after a server restart). Returns nil if none has it.
+func (p *PoolManager) hostOf(ctx context.Context, containerID string) *poolHost {
+	if host := p.cachedHost(containerID); host != nil {
+		return host
+	}
+
+	for _, candidate := range p.hosts {
+		if _, err := candidate.mgr.cli.ContainerInspect(ctx, containerID); err == nil {
+			p.cacheHost(containerID, candidate)
+			return candidate
+		}
+	}
+	return nil
+}
+
+func (p *PoolManager) cachedHost(containerID string) *poolHost {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.containerHost[containerID]
+}
+
+func (p *PoolManager) cacheHost(containerID string, host *poolHost) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.containerHost[containerID] = host
+}
+
+// StopContainer stops and removes a container on whichever host runs it.
+func (p *PoolManager) StopContainer(ctx context.Context, containerID string) error {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		slog.Debug("Container not found on any pool host", "container_id", containerID)
+		return nil
+	}
+	if err := host.mgr.StopContainer(ctx, containerID); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, known := p.containerHost[containerID]; known {
+		delete(p.containerHost, containerID)
+		if host.running > 0 {
+			host.running--
+		}
+	}
+	return nil
+}
+
+// IsRunning checks if a container is running on any pool host.
+func (p *PoolManager) IsRunning(ctx context.Context, containerID string) (bool, error) {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return false, nil
+	}
+	return host.mgr.IsRunning(ctx, containerID)
+}
+
+// ProbeContainer verifies a container on its host can still execute a shell.
+func (p *PoolManager) ProbeContainer(ctx context.Context, containerID string) error {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return errContainerNotRunning
+	}
+	return host.mgr.ProbeContainer(ctx, containerID)
+}
+
+// CreateExecSession creates an exec session on the container's host.
+func (p *PoolManager) CreateExecSession(ctx context.Context, containerID string) (string, io.ReadWriteCloser, error) {
+	return p.CreateTerminalExecSession(ctx, containerID, TerminalOptions{})
+}
+
+// CreateTerminalExecSession creates an exec session for the client terminal
+// on the container's host.
+func (p *PoolManager) CreateTerminalExecSession(ctx context.Context, containerID string, opts TerminalOptions) (string, io.ReadWriteCloser, error) {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return "", nil, fmt.Errorf("create exec session: %w", errContainerNotRunning)
+	}
+	execID, stream, err := host.mgr.CreateTerminalExecSession(ctx, containerID, opts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.execHost[execID] = host
+	return execID, &poolExec{ReadWriteCloser: stream, release: func() { p.releaseExec(execID) }}, nil
+}
+
+func (p *PoolManager) releaseExec(execID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.execHost, execID)
+}
+
+// ResizeExecSession resizes an exec session on the host that created it.
+func (p *PoolManager) ResizeExecSession(ctx context.Context, execID string, cols, rows uint) error {
+	host := p.execHostOf(execID)
+	if host == nil {
+		return fmt.Errorf("resize exec session %s: %w", execID, errContainerNotRunning)
+	}
+	return host.mgr.ResizeExecSession(ctx, execID, cols, rows)
+}
+
+func (p *PoolManager) execHostOf(execID string) *poolHost {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.execHost[execID]
+}
+
+// Client returns the Docker client of a single-host pool. A pool of several
+// hosts has no one daemon to hand out, since each container lives on its own
+// host, so it returns nil; callers reach containers through the manager.
+func (p *PoolManager) Client() *client.Client {
+	if len(p.hosts) != 1 {
+		return nil
+	}
+	return p.hosts[0].mgr.Client()
+}
+
+// EnsureNetwork creates the playground network on every host and returns the
+// first host's network ID.
+func (p *PoolManager) EnsureNetwork(ctx context.Context) (string, error) {
+	var firstID string
+	for i, host := range p.hosts {
+		id, err := host.mgr.EnsureNetwork(ctx)
+		if err != nil {
+			return "", fmt.Errorf("host %s: %w", host.Name, err)
+		}
+		if i == 0 {
+			firstID = id
+		}
+	}
+	return firstID, nil
+}
+
+// Runtime reports the first host whose runtime is unavailable, or the first
+// host's status when all are available.
+func (p *PoolManager) Runtime() RuntimeStatus {
+	for _, host := range p.hosts {
+		if status := host.mgr.Runtime(); !status.Available {
+			return status
+		}
+	}
+	return p.hosts[0].mgr.Runtime()
+}
+
+// ReapOrphans removes orphaned resources on every host.
+func (p *PoolManager) ReapOrphans(ctx context.Context, exists OwnerLookup, grace time.Duration) (ReapResult, error) {
+	var total ReapResult
+	var errs []error
+	for _, host := range p.hosts {
+		result, err := host.mgr.ReapOrphans(ctx, exists, grace)
+		total.Containers += result.Containers
+		total.Volumes += result.Volumes
+		total.Images += result.Images
+		if err != nil {
+			errs = append(errs, fmt.Errorf("host %s: %w", host.Name, err))
+		}
+	}
+	return total, errors.Join(errs...)
+}
+
+// Hosts returns a snapshot of every pool host.
+func (p *PoolManager) Hosts() []HostStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	statuses := make([]HostStatus, 0, len(p.hosts))
+	for _, host := range p.hosts {
+		statuses = append(statuses, HostStatus{
+			Name:     host.Name,
+			Endpoint: host.Endpoint,
+			Healthy:  host.healthy,
+			Running:  host.running,
+			Capacity: host.Capacity,
+			Error:    host.lastErr,
+		})
+	}
+	return statuses
+}
+
+// checkHosts pings every host and refreshes its running container count.
+func (p *PoolManager) checkHosts(ctx context.Context, timeout time.Duration) {
+	for _, host := range p.hosts {
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		running, err := countRunning(checkCtx, host.mgr)
+		cancel()
+
+		wasHealthy := p.recordCheck(host, running, err)
+		switch {
+		case wasHealthy && err != nil:
+			slog.Warn("Docker pool host unhealthy", "host", host.Name, "error", err)
+		case !wasHealthy && err == nil:
+			slog.Info("Docker pool host recovered", "host", host.Name, "running", running)
+			// The host may be new or rebuilt, so warm its image cache.
+			p.prePullHost(ctx, host)
+		}
+	}
+}
+
+// recordCheck stores the result of a health check of host and reports
+// whether it was healthy before.
+func (p *PoolManager) recordCheck(host *poolHost, running int, err error) (wasHealthy bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	wasHealthy = host.healthy
+	host.healthy = err == nil
+	if err != nil {
+		host.lastErr = err.Error()
+	} else {
+		host.lastErr = ""
+		host.running = running
+	}
+	return wasHealthy
+}
+
+// countRunning pings the host and counts running playground containers.
+func countRunning(ctx context.Context, m *DockerManager) (int, error) {
+	if _, err := m.cli.Ping(ctx); err != nil {
+		return 0, fmt.Errorf("ping docker: %w", err)
+	}
+	args := m.managedFilter()
+	args.Add("status", "running")
+	containers, err := m.cli.ContainerList(ctx, container.ListOptions{Filters: args})
+	if err != nil {
+		return 0, fmt.Errorf("list running containers: %w", err)
+	}
+	return len(containers), nil
+}
+
+// StartHostHealthWorkerWithConfig periodically health-checks pool hosts so
+// unreachable hosts stop receiving new users. It does nothing unless mgr is a
+// PoolManager.
+func StartHostHealthWorkerWithConfig(ctx context.Context, mgr Manager, cfg *config.Config) {
+	pool, ok := mgr.(*PoolManager)
+	if !ok {
+		return
+	}
+	interval := defaultHostCheckInterval
+	if cfg != nil && cfg.Container.HostCheckInterval > 0 {
+		interval = cfg.Container.HostCheckInterval
+	}
+
+	pool.checkHosts(ctx, interval)
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		slog.Info("Docker host health worker started", "interval", interval, "hosts", len(pool.hosts))
+
+		for {
+			select {
+			case <-ticker.C:
+				pool.checkHosts(ctx, interval)
+			case <-ctx.Done():
+				slog.Info("Docker host health worker shutting down", "reason", ctx.Err())
+				return
+			}
+		}
+	}()
+}
+
+// poolExec forgets the exec-to-host mapping when the stream closes.
+type poolExec struct {
+	io.ReadWriteCloser
+	release func()
+	once    sync.Once
+}
+
+func (e *poolExec) Close() error {
+	e.once.Do(e.release)
+	return e.ReadWriteCloser.Close()
+}
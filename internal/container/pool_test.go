@@ -0,0 +1,102 @@
+package container
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+)
+
+func newTestPool(capacities ...int) *PoolManager {
+	p := &PoolManager{
+		containerHost: make(map[string]*poolHost),
+		execHost:      make(map[string]*poolHost),
+	}
+	for i, capacity := range capacities {
+		p.hosts = append(p.hosts, &poolHost{
+			DockerHost: config.DockerHost{Name: string(rune('a' + i)), Capacity: capacity},
+			mgr:        &DockerManager{},
+			healthy:    true,
+		})
+	}
+	return p
+}
+
+func TestLeastLoadedReservesCapacity(t *testing.T) {
+	p := newTestPool(3, 2)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	placed, full := 0, 0
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := p.leastLoaded("alice")
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				placed++
+			case errors.Is(err, ErrNoHostCapacity):
+				full++
+			default:
+				t.Errorf("unexpected error %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if placed != 5 || full != 5 {
+		t.Fatalf("placed %d and refused %d, want 5 and 5", placed, full)
+	}
+	for _, host := range p.Hosts() {
+		if host.Running != host.Capacity {
+			t.Fatalf("host %s runs %d of %d", host.Name, host.Running, host.Capacity)
+		}
+	}
+}
+
+func TestPlaceKeepsOrReleasesReservation(t *testing.T) {
+	p := newTestPool(0)
+	host := p.hosts[0]
+
+	reserved, err := p.leastLoaded("alice")
+	if err != nil {
+		t.Fatalf("leastLoaded: %v", err)
+	}
+	p.place(reserved, "c1", true)
+	if host.running != 1 {
+		t.Fatalf("running = %d after placing a new container, want 1", host.running)
+	}
+
+	// Ensuring a container the pool already knows gives the slot back.
+	if _, err := p.leastLoaded("alice"); err != nil {
+		t.Fatalf("leastLoaded: %v", err)
+	}
+	p.place(host, "c1", true)
+	if host.running != 1 {
+		t.Fatalf("running = %d after placing a known container, want 1", host.running)
+	}
+
+	// A failed EnsureContainer releases its slot.
+	if _, err := p.leastLoaded("bob"); err != nil {
+		t.Fatalf("leastLoaded: %v", err)
+	}
+	p.release(host)
+	if host.running != 1 {
+		t.Fatalf("running = %d after release, want 1", host.running)
+	}
+
+	// Containers found on a host without a reservation are counted.
+	p.place(host, "c2", false)
+	if host.running != 2 {
+		t.Fatalf("running = %d after placing an unreserved container, want 2", host.running)
+	}
+}
+
+func TestPoolClient(t *testing.T) {
+	if c := newTestPool(0, 0).Client(); c != nil {
+		t.Fatalf("a multi-host pool returned client %v", c)
+	}
+}
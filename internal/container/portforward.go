@@ -0,0 +1,91 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// ErrPortClosed is returned when nothing in the container accepts
+// connections on a forwarded port.
+var ErrPortClosed = errors.New("nothing listening on port")
+
+// portRelayScript connects to a port on the container's loopback and relays
+// the connection over the exec's stdin and stdout. It writes one byte once
+// connected, so a closed port is told apart from an empty response, and
+// exits when the service closes its side. The background copy names its
+// stdin, which bash otherwise points at /dev/null.
+const portRelayScript = `exec 3<>"/dev/tcp/127.0.0.1/$1" || exit 1; printf +; cat <&0 >&3 & exec cat <&3`
+
+// PortForwarder is implemented by managers that can open TCP connections to
+// services inside a user's container, such as a web server the learner
+// started. Servers listening on the loopback or on all interfaces are
+// reached alike.
+type PortForwarder interface {
+	// DialPort connects to port in the container, failing with
+	// ErrPortClosed if nothing listens there.
+	DialPort(ctx context.Context, containerID string, port int) (net.Conn, error)
+}
+
+// DialPort relays a connection through an exec session as the terminal
+// user, so it reaches the container even when the server cannot route to
+// the playground network.
+func (m *DockerManager) DialPort(ctx context.Context, containerID string, port int) (net.Conn, error) {
+	resp, err := m.cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          []string{"/bin/bash", "-c", portRelayScript, "relay", strconv.Itoa(port)},
+		User:         containerUser,
+		AttachStdin:  true,
+		AttachStdout: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create exec: %w", err)
+	}
+	attachResp, err := m.cli.ContainerExecAttach(ctx, resp.ID, container.ExecStartOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("attach exec: %w", err)
+	}
+
+	stdout, stdoutWriter := io.Pipe()
+	go func() {
+		_, err := stdcopy.StdCopy(stdoutWriter, io.Discard, attachResp.Reader)
+		stdoutWriter.CloseWithError(err)
+	}()
+	conn := &execConn{Conn: attachResp.Conn, stdout: stdout}
+	ready := make([]byte, 1)
+	if _, err := io.ReadFull(stdout, ready); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("%w %d", ErrPortClosed, port)
+	}
+	return conn, nil
+}
+
+// execConn is a connection relayed through an exec session: writes go to
+// the exec's stdin and reads come from its demultiplexed stdout.
+type execConn struct {
+	net.Conn
+	stdout *io.PipeReader
+}
+
+func (c *execConn) Read(p []byte) (int, error) {
+	return c.stdout.Read(p)
+}
+
+func (c *execConn) Close() error {
+	_ = c.stdout.Close()
+	return c.Conn.Close()
+}
+
+// DialPort connects to a port in a container on whichever host runs it.
+func (p *PoolManager) DialPort(ctx context.Context, containerID string, port int) (net.Conn, error) {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return nil, errContainerNotRunning
+	}
+	return host.mgr.DialPort(ctx, containerID, port)
+}
@@ -0,0 +1,317 @@
+package container
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// defaultPrePullConcurrency is the number of images pulled at once per host
+// when no config is given.
+const defaultPrePullConcurrency = 2
+
+// prePullTimeout bounds pulling one image while warming a host.
+const prePullTimeout = 30 * time.Minute
+
+// imageRetryDelay is how often EnsureImages pulls images that failed to pull
+// again.
+const imageRetryDelay = time.Minute
+
+// Pre-pull states of a host.
+const (
+	PrePullIdle    = "idle"
+	PrePullRunning = "running"
+	PrePullDone    = "done"
+)
+
+// Pre-pull states of one image on a host.
+const (
+	ImagePending = "pending"
+	ImagePulling = "pulling"
+	ImagePresent = "present" // Was already on the host
+	ImagePulled  = "pulled"
+	ImageFailed  = "failed"
+)
+
+// ImageSource returns images challenges reference, such as the nodes of lab
+// topologies, for hosts to pull before learners need them.
+type ImageSource func() []string
+
+// ImagePull is the progress of one image of a pre-pull.
+type ImagePull struct {
+	Image string `json:"image"`
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+// PrePullStatus reports the latest pre-pull of one host.
+type PrePullStatus struct {
+	Host       string      `json:"host,omitempty"` // Pool host name; empty for a single host
+	State      string      `json:"state"`
+	StartedAt  time.Time   `json:"started_at,omitzero"`
+	FinishedAt time.Time   `json:"finished_at,omitzero"`
+	Images     []ImagePull `json:"images"`
+}
+
+// Ready reports whether the host's latest pre-pull finished with every image
+// on the host.
+func (s PrePullStatus) Ready() bool {
+	if s.State != PrePullDone {
+		return false
+	}
+	for _, pull := range s.Images {
+		if pull.State == ImageFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// ImagePrePuller is implemented by managers that can warm their hosts'
+// image caches, so the first learner on a fresh host does not wait for a
+// multi-gigabyte pull. Each pre-pull fetches the playground and sidecar
+// images and those of the image source that are missing on the host.
+type ImagePrePuller interface {
+	// SetImageSource adds the images src returns to every later pre-pull.
+	SetImageSource(src ImageSource)
+	// PrePull starts a pre-pull in the background on every healthy host
+	// not already running one, and reports whether any started. The pulls
+	// run until they finish or ctx is cancelled.
+	PrePull(ctx context.Context) bool
+	// PrePullStatus reports the latest pre-pull of every host.
+	PrePullStatus() []PrePullStatus
+}
+
+// EnsureImages pulls the images learners need that the hosts are missing,
+// then pulls those that failed again every imageRetryDelay until every host
+// has all of them or ctx is done. Until then the health check reports the
+// server as not ready.
+func EnsureImages(ctx context.Context, p ImagePrePuller) {
+	p.PrePull(ctx)
+	go func() {
+		ticker := time.NewTicker(imageRetryDelay)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			statuses := p.PrePullStatus()
+			if !slices.ContainsFunc(statuses, func(s PrePullStatus) bool { return !s.Ready() }) {
+				slog.Info("All images available on every host")
+				return
+			}
+			if slices.ContainsFunc(statuses, func(s PrePullStatus) bool { return s.State == PrePullDone && !s.Ready() }) {
+				slog.Warn("Images failed to pull, pulling them again")
+				p.PrePull(ctx)
+			}
+		}
+	}()
+}
+
+// prePullState tracks the pre-pulls of one DockerManager.
+type prePullState struct {
+	mu     sync.Mutex
+	src    ImageSource
+	status PrePullStatus
+}
+
+// SetImageSource adds the images src returns to every later pre-pull.
+func (m *DockerManager) SetImageSource(src ImageSource) {
+	m.prePull.mu.Lock()
+	defer m.prePull.mu.Unlock()
+	m.prePull.src = src
+}
+
+// PrePull pulls the missing images in the background, a few at a time.
+func (m *DockerManager) PrePull(ctx context.Context) bool {
+	concurrency := m.prePullConcurrency()
+	if concurrency <= 0 {
+		return false
+	}
+	images, ok := m.beginPrePull()
+	if !ok {
+		return false
+	}
+	slog.Info("Image pre-pull started", "images", len(images), "concurrency", concurrency)
+	go m.runPrePull(ctx, images, concurrency)
+	return true
+}
+
+// PrePullStatus reports the latest pre-pull.
+func (m *DockerManager) PrePullStatus() []PrePullStatus {
+	return []PrePullStatus{m.prePullStatus()}
+}
+
+func (m *DockerManager) prePullStatus() PrePullStatus {
+	m.prePull.mu.Lock()
+	defer m.prePull.mu.Unlock()
+	status := m.prePull.status
+	status.Images = slices.Clone(status.Images)
+	if status.State == "" {
+		status.State = PrePullIdle
+	}
+	if status.Images == nil {
+		status.Images = []ImagePull{}
+	}
+	return status
+}
+
+// prePullConcurrency returns the number of images pulled at once; 0
+// disables pre-pulls.
+func (m *DockerManager) prePullConcurrency() int {
+	if m.cfg == nil {
+		return defaultPrePullConcurrency
+	}
+	return m.cfg.Container.PrePullConcurrency
+}
+
+// prePullImages returns the images a pre-pull fetches, sorted and without
+// duplicates: the playground images learners can provision, the configured
+// sidecar images and those of src.
+func (m *DockerManager) prePullImages(src ImageSource) []string {
+	images := []string{imageName}
+	if m.cfg != nil {
+		for _, image := range m.cfg.Container.Images {
+			images = append(images, image.Ref)
+		}
+		for _, ref := range []string{m.cfg.Container.EgressImage, m.cfg.Capture.Image} {
+			if ref != "" {
+				images = append(images, ref)
+			}
+		}
+	}
+	if src != nil {
+		images = append(images, src()...)
+	}
+	slices.Sort(images)
+	return slices.Compact(images)
+}
+
+// beginPrePull marks a pre-pull as running and returns its images, or
+// reports false if one is already running.
+func (m *DockerManager) beginPrePull() ([]string, bool) {
+	m.prePull.mu.Lock()
+	defer m.prePull.mu.Unlock()
+	if m.prePull.status.State == PrePullRunning {
+		return nil, false
+	}
+	images := m.prePullImages(m.prePull.src)
+	pulls := make([]ImagePull, len(images))
+	for i, ref := range images {
+		pulls[i] = ImagePull{Image: ref, State: ImagePending}
+	}
+	m.prePull.status = PrePullStatus{State: PrePullRunning, StartedAt: time.Now(), Images: pulls}
+	return images, true
+}
+
+// runPrePull pulls images with concurrency workers, recording each outcome.
+func (m *DockerManager) runPrePull(ctx context.Context, images []string, concurrency int) {
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(concurrency, len(images)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				m.recordImagePull(i, ImagePulling, nil)
+				state, err := m.prePullImage(ctx, images[i])
+				m.recordImagePull(i, state, err)
+			}
+		}()
+	}
+	for i := range images {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	failed := m.finishPrePull()
+	if failed > 0 {
+		slog.Warn("Image pre-pull finished with failures", "images", len(images), "failed", failed)
+		return
+	}
+	slog.Info("Image pre-pull finished", "images", len(images))
+}
+
+// prePullImage pulls ref unless the host already has it.
+func (m *DockerManager) prePullImage(ctx context.Context, ref string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, prePullTimeout)
+	defer cancel()
+	if _, err := m.cli.ImageInspect(ctx, ref); err == nil {
+		return ImagePresent, nil
+	}
+	if err := m.ensureImage(ctx, ref); err != nil {
+		slog.Warn("Failed to pre-pull image", "error", err, "image", ref)
+		return ImageFailed, err
+	}
+	return ImagePulled, nil
+}
+
+func (m *DockerManager) recordImagePull(i int, state string, err error) {
+	m.prePull.mu.Lock()
+	defer m.prePull.mu.Unlock()
+	m.prePull.status.Images[i].State = state
+	if err != nil {
+		m.prePull.status.Images[i].Error = err.Error()
+	}
+}
+
+// finishPrePull marks the pre-pull as done and returns how many images
+// failed.
+func (m *DockerManager) finishPrePull() int {
+	m.prePull.mu.Lock()
+	defer m.prePull.mu.Unlock()
+	m.prePull.status.State = PrePullDone
+	m.prePull.status.FinishedAt = time.Now()
+	failed := 0
+	for _, pull := range m.prePull.status.Images {
+		if pull.State == ImageFailed {
+			failed++
+		}
+	}
+	return failed
+}
+
+// SetImageSource adds the images src returns to every host's pre-pulls.
+func (p *PoolManager) SetImageSource(src ImageSource) {
+	for _, host := range p.hosts {
+		host.mgr.SetImageSource(src)
+	}
+}
+
+// PrePull starts a pre-pull on every healthy host. Hosts that become
+// healthy later, such as a host added to the pool that was still booting
+// when the server started, are pre-pulled by the host health worker.
+func (p *PoolManager) PrePull(ctx context.Context) bool {
+	started := false
+	for _, host := range p.hosts {
+		if p.isHealthy(host) && p.prePullHost(ctx, host) {
+			started = true
+		}
+	}
+	return started
+}
+
+// prePullHost starts a pre-pull on host and reports whether it started.
+func (p *PoolManager) prePullHost(ctx context.Context, host *poolHost) bool {
+	if !host.mgr.PrePull(ctx) {
+		return false
+	}
+	slog.Info("Pre-pulling images on docker host", "host", host.Name)
+	return true
+}
+
+// PrePullStatus reports the latest pre-pull of every host.
+func (p *PoolManager) PrePullStatus() []PrePullStatus {
+	statuses := make([]PrePullStatus, 0, len(p.hosts))
+	for _, host := range p.hosts {
+		status := host.mgr.prePullStatus()
+		status.Host = host.Name
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
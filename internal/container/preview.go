@@ -0,0 +1,237 @@
+package container
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"path"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+)
+
+const (
+	// previewTimeout bounds a whole preview, including cloning the
+	// container and copying the work volume into the clone.
+	previewTimeout = 90 * time.Second
+	// previewCommandTimeout bounds the previewed command itself.
+	previewCommandTimeout = 20 * time.Second
+	// maxPreviewOutput bounds the command output kept in a preview.
+	maxPreviewOutput = 8 * 1024
+	// maxPreviewPaths bounds the paths listed per kind of change.
+	maxPreviewPaths = 100
+)
+
+// exitCodeTimeout is the status timeout(1) exits with when it stops a command.
+const exitCodeTimeout = 124
+
+// CommandPreview is what a command would do to a user's container, found by
+// running it in a disposable clone.
+type CommandPreview struct {
+	ExitCode int    `json:"exit_code"`
+	TimedOut bool   `json:"timed_out,omitempty"`
+	Output   string `json:"output"` // Combined stdout and stderr, cut to maxPreviewOutput
+	// Removed and Created list at most maxPreviewPaths paths each; the
+	// counts include every path.
+	Removed      []string `json:"removed"`
+	RemovedCount int      `json:"removed_count"`
+	Created      []string `json:"created"`
+	CreatedCount int      `json:"created_count"`
+}
+
+// CommandPreviewer is implemented by managers that can preview a command.
+// The clone is offline and has the container's runtime and resource limits;
+// nothing the command does reaches the user's container or volume.
+type CommandPreviewer interface {
+	// PreviewCommand runs command with /bin/sh as the terminal user in dir,
+	// or the working directory if dir is empty, in a clone of the
+	// container, and reports what it changed.
+	PreviewCommand(ctx context.Context, userID, containerID, command, dir string) (*CommandPreview, error)
+}
+
+// previewScript changes to the directory given as $2 and runs $1 under
+// timeout(1), which is the last program the clone needs: the command may
+// remove any other.
+const previewScript = `cd -- "${2:-.}" || exit 1
+exec timeout -k 2 "$3" /bin/sh -c "$1"`
+
+// PreviewCommand commits the container to an image, starts a clone of it
+// with a copy of the work volume, and runs the command there. Changes are
+// found with docker diff, so they are read from outside the clone.
+func (m *DockerManager) PreviewCommand(ctx context.Context, userID, containerID, command, dir string) (*CommandPreview, error) {
+	ctx, cancel := context.WithTimeout(ctx, previewTimeout)
+	defer cancel()
+	// Cleanup must happen even if ctx has expired.
+	cleanupCtx := context.WithoutCancel(ctx)
+
+	inspect, err := m.cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("inspect container: %w", err)
+	}
+	if inspect.State == nil || !inspect.State.Running {
+		return nil, errContainerNotRunning
+	}
+
+	// The image and the clone carry the same labels, so the reaper can find
+	// both if the server dies before removing them.
+	labels := m.resourceLabels(userID, "")
+	labels[labelPreview] = "true"
+	labels[labelPreviewID] = rand.Text()
+	changes := make([]string, 0, len(labels))
+	for k, v := range labels {
+		changes = append(changes, fmt.Sprintf("LABEL %q=%q", k, v))
+	}
+	// The image is found by its label rather than the commit's result, so it
+	// is removed even when the commit fails after the daemon created it.
+	defer m.removePreviewImages(cleanupCtx, labels[labelPreviewID])
+	commit, err := m.cli.ContainerCommit(ctx, containerID, container.CommitOptions{
+		Comment: "shsh command preview",
+		Changes: changes,
+		Pause:   true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("commit container: %w", err)
+	}
+
+	config := &container.Config{
+		Image:       commit.ID,
+		User:        containerUser,
+		WorkingDir:  workingDir,
+		Labels:      labels,
+		Healthcheck: &container.HealthConfig{Test: []string{"NONE"}},
+	}
+	hostConfig := &container.HostConfig{NetworkMode: "none"}
+	if inspect.HostConfig != nil {
+		hostConfig.Runtime = inspect.HostConfig.Runtime
+		hostConfig.Resources = inspect.HostConfig.Resources
+	}
+	resp, err := m.cli.ContainerCreate(ctx, config, hostConfig, nil, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("create preview container: %w", err)
+	}
+	defer func() {
+		// Its exit is expected; keep the watchdog from reporting it.
+		m.stopping.Store(resp.ID, struct{}{})
+		defer m.stopping.Delete(resp.ID)
+		if err := m.cli.ContainerRemove(cleanupCtx, resp.ID, container.RemoveOptions{Force: true}); err != nil && !errdefs.IsNotFound(err) {
+			slog.Warn("Failed to remove preview container", "error", err, "container_id", resp.ID)
+		}
+	}()
+
+	if err := m.copyWorkDir(ctx, containerID, resp.ID); err != nil {
+		return nil, err
+	}
+	if err := m.cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		return nil, fmt.Errorf("start preview container: %w", err)
+	}
+
+	before, err := m.cli.ContainerDiff(ctx, resp.ID)
+	if err != nil {
+		return nil, fmt.Errorf("diff preview container: %w", err)
+	}
+	output := &limitedBuffer{max: maxPreviewOutput}
+	seconds := strconv.Itoa(int(previewCommandTimeout.Seconds()))
+	exitCode, err := m.execStream(ctx, resp.ID, containerUser, []string{"/bin/sh", "-c", previewScript, "sh", command, dir, seconds}, nil, output, output)
+	if err != nil {
+		return nil, fmt.Errorf("run previewed command: %w", err)
+	}
+	after, err := m.cli.ContainerDiff(ctx, resp.ID)
+	if err != nil {
+		return nil, fmt.Errorf("diff preview container: %w", err)
+	}
+
+	preview := &CommandPreview{
+		ExitCode: exitCode,
+		TimedOut: exitCode == exitCodeTimeout,
+		Output:   output.String(),
+	}
+	removed, created := previewChanges(before, after)
+	preview.Removed, preview.RemovedCount = capPaths(removed)
+	preview.Created, preview.CreatedCount = capPaths(created)
+	slog.Info("Command previewed", "user_id", userID, "container_id", containerID, "exit_code", exitCode, "removed", preview.RemovedCount, "created", preview.CreatedCount)
+	return preview, nil
+}
+
+// removePreviewImages removes the images committed for the preview with
+// previewID.
+func (m *DockerManager) removePreviewImages(ctx context.Context, previewID string) {
+	images, err := m.cli.ImageList(ctx, image.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", labelPreviewID+"="+previewID)),
+	})
+	if err != nil {
+		slog.Warn("Failed to list preview images", "error", err, "preview_id", previewID)
+		return
+	}
+	for _, img := range images {
+		if _, err := m.cli.ImageRemove(ctx, img.ID, image.RemoveOptions{Force: true, PruneChildren: true}); err != nil && !errdefs.IsNotFound(err) {
+			slog.Warn("Failed to remove preview image", "error", err, "image", img.ID)
+		}
+	}
+}
+
+// copyWorkDir copies the work volume of container from into the filesystem
+// of container to, which has not started, keeping ownership. Unlike a
+// volume, the copy shows up in docker diff.
+func (m *DockerManager) copyWorkDir(ctx context.Context, from, to string) error {
+	archive, _, err := m.cli.CopyFromContainer(ctx, from, mountPath)
+	if err != nil {
+		return fmt.Errorf("read work directory: %w", err)
+	}
+	defer archive.Close()
+	if err := m.cli.CopyToContainer(ctx, to, path.Dir(mountPath), archive, container.CopyToContainerOptions{CopyUIDGID: true}); err != nil {
+		return fmt.Errorf("copy work directory: %w", err)
+	}
+	return nil
+}
+
+// previewChanges returns the paths removed and created between two diffs of
+// the same container against its image, sorted. A path the first diff
+// added and the second lacks was removed.
+func previewChanges(before, after []container.FilesystemChange) (removed, created []string) {
+	was := make(map[string]container.ChangeType, len(before))
+	for _, c := range before {
+		was[c.Path] = c.Kind
+	}
+	is := make(map[string]bool, len(after))
+	for _, c := range after {
+		is[c.Path] = true
+		kind, seen := was[c.Path]
+		switch {
+		case c.Kind == container.ChangeDelete && kind != container.ChangeDelete:
+			removed = append(removed, c.Path)
+		case c.Kind == container.ChangeAdd && !seen:
+			created = append(created, c.Path)
+		}
+	}
+	for _, c := range before {
+		if c.Kind == container.ChangeAdd && !is[c.Path] {
+			removed = append(removed, c.Path)
+		}
+	}
+	slices.Sort(removed)
+	slices.Sort(created)
+	return removed, created
+}
+
+// capPaths cuts paths to maxPreviewPaths, returning how many there were.
+func capPaths(paths []string) ([]string, int) {
+	if paths == nil {
+		paths = []string{}
+	}
+	return paths[:min(len(paths), maxPreviewPaths)], len(paths)
+}
+
+// PreviewCommand previews a command on the host running the container.
+func (p *PoolManager) PreviewCommand(ctx context.Context, userID, containerID, command, dir string) (*CommandPreview, error) {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return nil, errContainerNotRunning
+	}
+	return host.mgr.PreviewCommand(ctx, userID, containerID, command, dir)
+}
@@ -0,0 +1,150 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/image"
+)
+
+// Provisioning stages reported to a ProgressFunc.
+const (
+	StagePullingImage = "pulling_image"
+	StageCreating     = "creating"
+	StageStarting     = "starting"
+	StageReady        = "ready"
+)
+
+// ProgressFunc receives provisioning stages as EnsureContainer moves through them.
+type ProgressFunc func(stage string)
+
+type progressKey struct{}
+
+// WithProgress returns a context whose EnsureContainer calls report their
+// stages to fn.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// ReportProgress passes stage to the ProgressFunc attached to ctx, if any.
+func ReportProgress(ctx context.Context, stage string) {
+	if fn, ok := ctx.Value(progressKey{}).(ProgressFunc); ok && fn != nil {
+		fn(stage)
+	}
+}
+
+// ensureImage pulls ref when the daemon does not have it.
+func (m *DockerManager) ensureImage(ctx context.Context, ref string) error {
+	_, err := m.cli.ImageInspect(ctx, ref)
+	if err == nil {
+		return nil
+	}
+	if !errdefs.IsNotFound(err) {
+		return fmt.Errorf("inspect image %s: %w", ref, err)
+	}
+
+	ReportProgress(ctx, StagePullingImage)
+	slog.Info("Pulling image", "image", ref)
+	rc, err := m.cli.ImagePull(ctx, ref, image.PullOptions{})
+	if err != nil {
+		return fmt.Errorf("pull image %s: %w", ref, err)
+	}
+	defer func() { _ = rc.Close() }()
+
+	// The pull only completes once its progress stream has been consumed.
+	if err := logPullProgress(ref, rc, pullLogInterval); err != nil {
+		return fmt.Errorf("pull image %s: %w", ref, err)
+	}
+	return nil
+}
+
+// pullLogInterval is how often the progress of a running pull is logged.
+const pullLogInterval = 10 * time.Second
+
+// pullMessage is one message of the Docker image pull progress stream.
+type pullMessage struct {
+	ID             string `json:"id"`
+	Status         string `json:"status"`
+	ProgressDetail struct {
+		Current int64 `json:"current"`
+		Total   int64 `json:"total"`
+	} `json:"progressDetail"`
+	Error string `json:"error"`
+}
+
+// pullLayer is the download progress of one layer.
+type pullLayer struct {
+	current, total int64
+	done           bool
+}
+
+// logPullProgress consumes the progress stream of pulling ref, logging the
+// layers and bytes downloaded every interval and once the pull finished. It
+// returns the error the stream reports, as a failed pull still ends the
+// stream normally.
+func logPullProgress(ref string, r io.Reader, interval time.Duration) error {
+	start := time.Now()
+	lastLog := start
+	layers := make(map[string]*pullLayer)
+	logProgress := func(msg string) {
+		var done int
+		var current, total int64
+		for _, layer := range layers {
+			if layer.done {
+				done++
+			}
+			current += layer.current
+			total += layer.total
+		}
+		slog.Info(msg,
+			"image", ref,
+			"layers_done", done,
+			"layers", len(layers),
+			"downloaded_mb", current>>20,
+			"total_mb", total>>20,
+			"elapsed", time.Since(start).Round(time.Second))
+	}
+
+	dec := json.NewDecoder(r)
+	for {
+		var msg pullMessage
+		err := dec.Decode(&msg)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Error != "" {
+			return errors.New(msg.Error)
+		}
+		switch msg.Status {
+		case "Pulling fs layer", "Already exists":
+			layers[msg.ID] = &pullLayer{done: msg.Status == "Already exists"}
+		case "Downloading":
+			if layer := layers[msg.ID]; layer != nil {
+				layer.current, layer.total = msg.ProgressDetail.Current, msg.ProgressDetail.Total
+			}
+		case "Download complete":
+			if layer := layers[msg.ID]; layer != nil {
+				layer.current = layer.total
+			}
+		case "Pull complete":
+			if layer := layers[msg.ID]; layer != nil {
+				layer.done = true
+			}
+		}
+		if time.Since(lastLog) >= interval {
+			lastLog = time.Now()
+			logProgress("Pulling image")
+		}
+	}
+	logProgress("Pulled image")
+	return nil
+}
@@ -0,0 +1,202 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/store"
+	"github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/volume"
+)
+
+// Orphan reaper defaults used when no configuration is provided.
+const (
+	defaultReaperInterval    = 10 * time.Minute
+	defaultReaperGracePeriod = 10 * time.Minute
+)
+
+// OwnerLookup reports whether a user ID from a resource label still exists.
+type OwnerLookup func(ctx context.Context, userID string) (bool, error)
+
+// ReapResult counts the resources removed by a reaper sweep.
+type ReapResult struct {
+	Containers int
+	Volumes    int
+	Images     int
+}
+
+// ReapOrphans removes containers and volumes created by this instance whose
+// owner no longer exists. Resources younger than grace, or without a readable
+// creation label, are left alone so in-flight provisioning is never raced.
+// Command preview clones and their images outlive a preview only if the
+// server died mid-preview, so they are removed once stale whoever owns them.
+func (m *DockerManager) ReapOrphans(ctx context.Context, exists OwnerLookup, grace time.Duration) (ReapResult, error) {
+	var result ReapResult
+	isOrphan := orphanCheck(ctx, exists, grace)
+
+	containers, err := m.cli.ContainerList(ctx, container.ListOptions{All: true, Filters: m.managedFilter()})
+	if err != nil {
+		return result, fmt.Errorf("list managed containers: %w", err)
+	}
+	for _, c := range containers {
+		if c.Labels[labelPreview] == "true" {
+			if stalePreview(c.Labels, grace, time.Now()) && m.reapPreviewContainer(ctx, c.ID) {
+				result.Containers++
+			}
+			continue
+		}
+		if !isOrphan(c.Labels) {
+			continue
+		}
+		slog.Info("Reaping orphaned container", "container_id", c.ID, "user_id", c.Labels[labelOwner])
+		if err := m.StopContainer(WithLifecycleReason(ctx, ReasonOrphaned), c.ID); err != nil {
+			slog.Warn("Failed to reap orphaned container", "container_id", c.ID, "error", err)
+			continue
+		}
+		result.Containers++
+	}
+
+	volumes, err := m.cli.VolumeList(ctx, volume.ListOptions{Filters: m.managedFilter()})
+	if err != nil {
+		return result, fmt.Errorf("list managed volumes: %w", err)
+	}
+	for _, v := range volumes.Volumes {
+		if !isOrphan(v.Labels) {
+			continue
+		}
+		slog.Info("Reaping orphaned volume", "volume", v.Name, "user_id", v.Labels[labelOwner])
+		if err := m.cli.VolumeRemove(ctx, v.Name, false); err != nil {
+			if !errdefs.IsNotFound(err) {
+				slog.Warn("Failed to reap orphaned volume", "volume", v.Name, "error", err)
+			}
+			continue
+		}
+		result.Volumes++
+	}
+
+	previewFilter := m.managedFilter()
+	previewFilter.Add("label", labelPreview+"=true")
+	images, err := m.cli.ImageList(ctx, image.ListOptions{Filters: previewFilter})
+	if err != nil {
+		return result, fmt.Errorf("list preview images: %w", err)
+	}
+	for _, img := range images {
+		if !stalePreview(img.Labels, grace, time.Now()) {
+			continue
+		}
+		slog.Info("Reaping stale preview image", "image", img.ID, "user_id", img.Labels[labelOwner])
+		if _, err := m.cli.ImageRemove(ctx, img.ID, image.RemoveOptions{Force: true, PruneChildren: true}); err != nil {
+			if !errdefs.IsNotFound(err) {
+				slog.Warn("Failed to reap stale preview image", "image", img.ID, "error", err)
+			}
+			continue
+		}
+		result.Images++
+	}
+
+	return result, nil
+}
+
+// reapPreviewContainer removes a leftover command preview clone, reporting
+// whether it was removed.
+func (m *DockerManager) reapPreviewContainer(ctx context.Context, containerID string) bool {
+	slog.Info("Reaping stale preview container", "container_id", containerID)
+	m.stopping.Store(containerID, struct{}{})
+	defer m.stopping.Delete(containerID)
+	if err := m.cli.ContainerRemove(ctx, containerID, container.RemoveOptions{Force: true}); err != nil {
+		if !errdefs.IsNotFound(err) {
+			slog.Warn("Failed to reap stale preview container", "container_id", containerID, "error", err)
+		}
+		return false
+	}
+	return true
+}
+
+// stalePreview reports whether a preview resource with the given labels is
+// older than both grace and the longest a preview can run.
+func stalePreview(labels map[string]string, grace time.Duration, now time.Time) bool {
+	createdAt, ok := labeledCreatedAt(labels)
+	return ok && now.Sub(createdAt) >= max(grace, previewTimeout)
+}
+
+// orphanCheck returns a function reporting whether a resource with the given
+// labels is older than grace and owned by a user that no longer exists.
+// Owner lookups are cached for the sweep.
+func orphanCheck(ctx context.Context, exists OwnerLookup, grace time.Duration) func(labels map[string]string) bool {
+	owners := make(map[string]bool)
+	return func(labels map[string]string) bool {
+		owner := labels[labelOwner]
+		if owner == "" {
+			return false
+		}
+		createdAt, ok := labeledCreatedAt(labels)
+		if !ok || time.Since(createdAt) < grace {
+			return false
+		}
+		found, cached := owners[owner]
+		if !cached {
+			var err error
+			found, err = exists(ctx, owner)
+			if err != nil {
+				slog.Warn("Reaper failed to look up owner", "user_id", owner, "error", err)
+				return false
+			}
+			owners[owner] = found
+		}
+		return !found
+	}
+}
+
+// StartReaperWithConfig runs a background goroutine that periodically removes
+// labeled containers and volumes whose owner is no longer in the store, so
+// resources leaked by a crash mid-provision don't accumulate.
+func StartReaperWithConfig(ctx context.Context, repo store.Repository, mgr Manager, cfg *config.Config) {
+	interval, grace := defaultReaperInterval, defaultReaperGracePeriod
+	if cfg != nil {
+		interval = cfg.Container.ReaperInterval
+		grace = cfg.Container.ReaperGracePeriod
+	}
+	if interval <= 0 {
+		slog.Info("Orphan reaper disabled")
+		return
+	}
+
+	exists := func(ctx context.Context, userID string) (bool, error) {
+		user, err := repo.GetUser(ctx, userID)
+		if err != nil {
+			return false, err
+		}
+		return user != nil, nil
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		slog.Info("Orphan reaper started", "interval", interval, "grace_period", grace)
+
+		for {
+			select {
+			case <-ticker.C:
+				result, err := mgr.ReapOrphans(ctx, exists, grace)
+				if err != nil {
+					slog.Error("Orphan reaper sweep failed", "error", err)
+					continue
+				}
+				if result.Containers > 0 || result.Volumes > 0 || result.Images > 0 {
+					slog.Info("Orphan reaper sweep completed",
+						"containers_removed", result.Containers,
+						"volumes_removed", result.Volumes,
+						"images_removed", result.Images)
+				}
+			case <-ctx.Done():
+				slog.Info("Orphan reaper shutting down", "reason", ctx.Err())
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,30 @@
+package container
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStalePreview(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	labelsAt := func(age time.Duration) map[string]string {
+		return map[string]string{labelCreatedAt: now.Add(-age).Format(time.RFC3339)}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		labels map[string]string
+		grace  time.Duration
+		want   bool
+	}{
+		{"older than grace", labelsAt(11 * time.Minute), 10 * time.Minute, true},
+		{"within grace", labelsAt(5 * time.Minute), 10 * time.Minute, false},
+		{"possibly still running", labelsAt(time.Minute), 0, false},
+		{"longer than a preview runs", labelsAt(2 * previewTimeout), 0, true},
+		{"no creation label", map[string]string{}, 0, false},
+	} {
+		if got := stalePreview(tc.labels, tc.grace, now); got != tc.want {
+			t.Errorf("%s: stalePreview = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// ErrRuntimeUnavailable is returned when the configured container runtime is
+// not registered with Docker and fallback is disabled.
+var ErrRuntimeUnavailable = errors.New("container runtime unavailable")
+
+// runtimeDetectTimeout bounds the Docker info query used for runtime detection.
+const runtimeDetectTimeout = 5 * time.Second
+
+// RuntimeStatus describes the OCI runtime used for new playground containers.
+type RuntimeStatus struct {
+	Requested string `json:"requested"`       // Runtime from CONTAINER_RUNTIME ("" = Docker default)
+	Effective string `json:"effective"`       // Runtime new containers are created with
+	Available bool   `json:"available"`       // Whether the requested runtime is registered with Docker
+	Fallback  bool   `json:"fallback"`        // Whether containers run on the default runtime instead
+	Error     string `json:"error,omitempty"` // Why the requested runtime is unavailable
+}
+
+// Usable reports whether new containers can be created.
+func (s RuntimeStatus) Usable() bool {
+	return s.Available || s.Fallback || s.Requested == ""
+}
+
+// Runtime returns the current runtime detection result.
+func (m *DockerManager) Runtime() RuntimeStatus {
+	m.runtimeMu.RLock()
+	defer m.runtimeMu.RUnlock()
+	return m.runtimeStatus
+}
+
+// refreshRuntime re-runs detection while the requested runtime is unavailable,
+// so installing runsc or a Docker daemon restart is picked up without a restart.
+func (m *DockerManager) refreshRuntime(ctx context.Context) RuntimeStatus {
+	status := m.Runtime()
+	if status.Available {
+		return status
+	}
+
+	detectCtx, cancel := context.WithTimeout(ctx, runtimeDetectTimeout)
+	defer cancel()
+	status = m.detectRuntime(detectCtx)
+
+	m.runtimeMu.Lock()
+	defer m.runtimeMu.Unlock()
+	m.runtimeStatus = status
+	return status
+}
+
+// detectRuntime checks the requested runtime against the runtimes registered
+// with the Docker daemon.
+func (m *DockerManager) detectRuntime(ctx context.Context) RuntimeStatus {
+	status := RuntimeStatus{Requested: m.runtime, Effective: m.runtime}
+
+	info, err := m.cli.Info(ctx)
+	if err != nil {
+		status.Error = fmt.Sprintf("query docker info: %v", err)
+		return status
+	}
+
+	if m.runtime == "" {
+		status.Available = true
+		status.Effective = info.DefaultRuntime
+		return status
+	}
+	if _, ok := info.Runtimes[m.runtime]; ok {
+		status.Available = true
+		return status
+	}
+
+	status.Error = fmt.Sprintf("runtime %q is not registered with docker", m.runtime)
+	if m.cfg != nil && m.cfg.Container.RuntimeFallback {
+		status.Fallback = true
+		status.Effective = info.DefaultRuntime
+	}
+	return status
+}
+
+// logRuntimeStatus reports the detection result at startup.
+func logRuntimeStatus(status RuntimeStatus) {
+	switch {
+	case status.Fallback:
+		slog.Warn("CONTAINER RUNTIME FALLBACK: requested runtime unavailable, containers will run WITHOUT sandbox isolation",
+			"requested", status.Requested,
+			"effective", status.Effective,
+			"error", status.Error)
+	case !status.Available:
+		slog.Error("Container runtime unavailable, provisioning will fail",
+			"requested", status.Requested,
+			"error", status.Error)
+	default:
+		slog.Info("Container runtime available", "runtime", status.Effective)
+	}
+}
+
+// addRuntimeLabels records the runtime a container uses in labels.
+func addRuntimeLabels(labels map[string]string, status RuntimeStatus) {
+	labels[labelRuntime] = status.Effective
+	if status.Fallback {
+		labels[labelRuntimeFallback] = "true"
+	}
+}
@@ -0,0 +1,170 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// stateTimeout bounds taking a state snapshot, which the agent waits on.
+	stateTimeout = 5 * time.Second
+	// maxStateSection bounds each part of a state snapshot.
+	maxStateSection = 4 * 1024
+	// maxStateProcesses bounds the processes listed in a state snapshot.
+	maxStateProcesses = 40
+)
+
+// StateSnapshot is a read-only view of a container for the agent, in the
+// form the commands a learner would run print it.
+type StateSnapshot struct {
+	Processes   string // Like ps: PID, user, state, memory and command
+	DiskUsage   string // df -h
+	Environment string // env, with secret-looking values redacted
+	Uptime      string // Time since the container started
+	WorkingDir  string // ls -la of the directory asked for
+}
+
+// StateInspector is implemented by managers that can take a StateSnapshot.
+// Snapshots only run a fixed set of read-only commands; the directory is
+// passed to them as an argument, never as shell source.
+type StateInspector interface {
+	// InspectState takes a snapshot of the container, listing dir, which
+	// is usually the terminal's working directory. An empty dir lists the
+	// container's working directory.
+	InspectState(ctx context.Context, containerID, dir string) (*StateSnapshot, error)
+}
+
+// stateScript prints the disk usage, a listing of the directory given as $1
+// and the environment, each after an @@<part> line. The environment goes
+// last as it is the longest. It runs as the terminal user, so it sees what
+// the learner sees.
+const stateScript = `echo @@df
+df -hP 2>&1
+echo @@ls
+cd -- "${1:-.}" 2>&1 && ls -la 2>&1 | head -n 100
+echo @@env
+env
+exit 0
+`
+
+// secretEnv matches environment variable names whose values are redacted
+// from snapshots.
+var secretEnv = regexp.MustCompile(`(?i)pass|secret|token|key|credential|auth`)
+
+// InspectState takes a snapshot of the container.
+func (m *DockerManager) InspectState(ctx context.Context, containerID, dir string) (*StateSnapshot, error) {
+	ctx, cancel := context.WithTimeout(ctx, stateTimeout)
+	defer cancel()
+
+	inspect, err := m.cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("inspect container: %w", err)
+	}
+	if inspect.State == nil || !inspect.State.Running {
+		return nil, errContainerNotRunning
+	}
+	snapshot := &StateSnapshot{}
+	if started, err := time.Parse(time.RFC3339Nano, inspect.State.StartedAt); err == nil {
+		snapshot.Uptime = fmt.Sprintf("up %s", time.Since(started).Round(time.Second))
+	}
+
+	procs, err := m.Processes(ctx, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("list processes: %w", err)
+	}
+	snapshot.Processes = formatProcesses(procs)
+
+	out, err := m.execOutput(ctx, containerID, containerUser, []string{"/bin/sh", "-c", stateScript, "sh", dir}, 4*maxStateSection)
+	if err != nil {
+		return nil, fmt.Errorf("read container state: %w", err)
+	}
+	parts := splitStateOutput(out)
+	snapshot.DiskUsage = truncateSection(parts["df"])
+	snapshot.Environment = truncateSection(redactEnv(parts["env"]))
+	snapshot.WorkingDir = truncateSection(parts["ls"])
+	return snapshot, nil
+}
+
+// InspectState takes a snapshot of a container on whichever host runs it.
+func (p *PoolManager) InspectState(ctx context.Context, containerID, dir string) (*StateSnapshot, error) {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return nil, errContainerNotRunning
+	}
+	return host.mgr.InspectState(ctx, containerID, dir)
+}
+
+// formatProcesses lists procs like ps, leaving out kernel threads.
+func formatProcesses(procs []Process) string {
+	var b strings.Builder
+	b.WriteString("PID\tUSER\tSTAT\tRSS\tCOMMAND\n")
+	listed := 0
+	for _, p := range procs {
+		if p.Command == "" {
+			continue
+		}
+		if listed == maxStateProcesses {
+			fmt.Fprintf(&b, "... %d more\n", len(procs)-listed)
+			break
+		}
+		fmt.Fprintf(&b, "%d\t%s\t%s\t%dM\t%s\n", p.PID, p.User, p.State, p.RSSBytes>>20, p.Command)
+		listed++
+	}
+	return truncateSection(b.String())
+}
+
+// stateParts are the parts of stateScript's output, in order.
+var stateParts = []string{"df", "ls", "env"}
+
+// splitStateOutput splits the output of stateScript into its parts. Only
+// the next part's marker is recognized, so output that happens to look like
+// a marker stays in its part.
+func splitStateOutput(out []byte) map[string]string {
+	parts := make(map[string]string)
+	next := 0
+	var name string
+	var part strings.Builder
+	for line := range bytes.Lines(out) {
+		if next < len(stateParts) && string(bytes.TrimRight(line, "\n")) == "@@"+stateParts[next] {
+			if name != "" {
+				parts[name] = part.String()
+			}
+			name = stateParts[next]
+			part.Reset()
+			next++
+			continue
+		}
+		part.Write(line)
+	}
+	if name != "" {
+		parts[name] = part.String()
+	}
+	return parts
+}
+
+// redactEnv replaces the values of secret-looking variables in env output.
+func redactEnv(env string) string {
+	lines := strings.Split(env, "\n")
+	for i, line := range lines {
+		if name, _, ok := strings.Cut(line, "="); ok && secretEnv.MatchString(name) {
+			lines[i] = name + "=[REDACTED]"
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// truncateSection cuts s to maxStateSection bytes at a line boundary.
+func truncateSection(s string) string {
+	if len(s) <= maxStateSection {
+		return s
+	}
+	cut := strings.LastIndexByte(s[:maxStateSection], '\n')
+	if cut < 0 {
+		cut = maxStateSection
+	}
+	return s[:cut+1] + "[truncated]\n"
+}
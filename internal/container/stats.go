@@ -0,0 +1,127 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// Stats is one sample of a container's resource usage.
+type Stats struct {
+	Time               time.Time
+	CPUMillicores      int64 // CPU used since the previous sample, in thousandths of a core
+	CPULimitMillicores int64 // CPU limit in thousandths of a core; 0 means unlimited
+	MemoryBytes        int64 // Memory in use, not counting reclaimable page cache
+	MemoryLimitBytes   int64
+	Pids               int64
+	PidsLimit          int64 // 0 means unlimited
+}
+
+// StatsStreamer is implemented by managers that can stream a container's
+// resource usage.
+type StatsStreamer interface {
+	// Stats streams samples of the container's usage, about one per second,
+	// until ctx ends or the container stops; the channel is then closed.
+	Stats(ctx context.Context, containerID string) (<-chan Stats, error)
+}
+
+// Stats wraps the daemon's stats stream.
+func (m *DockerManager) Stats(ctx context.Context, containerID string) (<-chan Stats, error) {
+	inspect, err := m.cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("inspect container %s: %w", containerID, err)
+	}
+	if inspect.State == nil || !inspect.State.Running {
+		return nil, errContainerNotRunning
+	}
+	var cpuLimit int64
+	if inspect.HostConfig != nil {
+		cpuLimit = cpuLimitMillicores(inspect.HostConfig.Resources)
+	}
+
+	resp, err := m.cli.ContainerStats(ctx, containerID, true)
+	if err != nil {
+		return nil, fmt.Errorf("stream stats of container %s: %w", containerID, err)
+	}
+
+	out := make(chan Stats)
+	go func() {
+		defer close(out)
+		defer func() { _ = resp.Body.Close() }()
+		dec := json.NewDecoder(resp.Body)
+		for {
+			var s container.StatsResponse
+			if err := dec.Decode(&s); err != nil {
+				return
+			}
+			sample := statsSample(s)
+			sample.CPULimitMillicores = cpuLimit
+			select {
+			case out <- sample:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// statsSample converts a daemon stats response the way docker stats does.
+func statsSample(s container.StatsResponse) Stats {
+	sample := Stats{
+		Time:             s.Read,
+		MemoryBytes:      int64(s.MemoryStats.Usage),
+		MemoryLimitBytes: int64(s.MemoryStats.Limit),
+		Pids:             int64(s.PidsStats.Current),
+		PidsLimit:        int64(s.PidsStats.Limit),
+	}
+
+	// Page cache the kernel can reclaim is not counted as used: cgroup v2
+	// reports it as inactive_file, v1 as total_inactive_file.
+	inactive, ok := s.MemoryStats.Stats["inactive_file"]
+	if !ok {
+		inactive = s.MemoryStats.Stats["total_inactive_file"]
+	}
+	if inactive < s.MemoryStats.Usage {
+		sample.MemoryBytes = int64(s.MemoryStats.Usage - inactive)
+	}
+
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(s.CPUStats.SystemUsage) - float64(s.PreCPUStats.SystemUsage)
+	cpus := float64(s.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(s.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		sample.CPUMillicores = int64(cpuDelta / systemDelta * cpus * 1000)
+	}
+	return sample
+}
+
+// cpuLimitMillicores returns a container's CPU limit, set either as a quota
+// per period or as NanoCPUs.
+func cpuLimitMillicores(r container.Resources) int64 {
+	if r.NanoCPUs > 0 {
+		return r.NanoCPUs / 1_000_000
+	}
+	if r.CPUQuota <= 0 {
+		return 0
+	}
+	period := r.CPUPeriod
+	if period <= 0 {
+		period = 100000 // The kernel's default CFS period
+	}
+	return r.CPUQuota * 1000 / period
+}
+
+// Stats streams the usage of a container on whichever host runs it.
+func (p *PoolManager) Stats(ctx context.Context, containerID string) (<-chan Stats, error) {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return nil, errContainerNotRunning
+	}
+	return host.mgr.Stats(ctx, containerID)
+}
@@ -0,0 +1,133 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// Image labels controlling how a container is stopped. Container labels
+// inherit them from the image, so each image can tune its own shutdown
+// without server configuration. The learner image's pre-stop command runs
+// the hooks challenges install (see curriculum.PreStopInstallScript).
+const (
+	labelPreStop        = "shsh.pre-stop"         // Shell command run as root before stopping
+	labelPreStopTimeout = "shsh.pre-stop-timeout" // Duration bound for the pre-stop command
+	labelStopTimeout    = "shsh.stop-timeout"     // Grace period before Docker escalates to SIGKILL
+	labelStopSignal     = "shsh.stop-signal"      // Signal sent first (default: the image's STOPSIGNAL)
+)
+
+// Stop defaults used when no configuration is provided.
+const (
+	defaultStopTimeout    = 10 * time.Second
+	defaultPreStopTimeout = 10 * time.Second
+)
+
+// stopPolicy describes how a specific container is shut down.
+type stopPolicy struct {
+	preStop        string
+	preStopTimeout time.Duration
+	stopTimeout    time.Duration
+	stopSignal     string
+}
+
+// stopPolicyFor merges the container's labels over the configured defaults.
+// Malformed durations are logged and ignored.
+func (m *DockerManager) stopPolicyFor(containerID string, labels map[string]string) stopPolicy {
+	policy := stopPolicy{
+		preStop:        labels[labelPreStop],
+		preStopTimeout: defaultPreStopTimeout,
+		stopTimeout:    defaultStopTimeout,
+		stopSignal:     labels[labelStopSignal],
+	}
+	if m.cfg != nil {
+		policy.preStopTimeout = m.cfg.Timeout.PreStopHook
+		policy.stopTimeout = m.cfg.Timeout.ContainerStop
+	}
+
+	// A zero configured pre-stop timeout disables hooks server-wide.
+	if policy.preStopTimeout > 0 {
+		policy.preStopTimeout = labelDuration(containerID, labels, labelPreStopTimeout, policy.preStopTimeout)
+	}
+	policy.stopTimeout = labelDuration(containerID, labels, labelStopTimeout, policy.stopTimeout)
+	return policy
+}
+
+func labelDuration(containerID string, labels map[string]string, key string, fallback time.Duration) time.Duration {
+	value, ok := labels[key]
+	if !ok {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		slog.Warn("Ignoring invalid stop label", "container_id", containerID, "label", key, "value", value)
+		return fallback
+	}
+	return d
+}
+
+// runPreStop executes the container's pre-stop hook, bounded by the policy
+// timeout. Failures are logged; stopping proceeds regardless.
+func (m *DockerManager) runPreStop(ctx context.Context, containerID string, policy stopPolicy) {
+	if policy.preStop == "" || policy.preStopTimeout <= 0 {
+		return
+	}
+
+	hookCtx, cancel := context.WithTimeout(ctx, policy.preStopTimeout)
+	defer cancel()
+
+	start := time.Now()
+	exitCode, err := m.execAndWait(hookCtx, containerID, "root", []string{"/bin/sh", "-c", policy.preStop})
+	switch {
+	case err != nil:
+		slog.Warn("Pre-stop hook failed", "container_id", containerID, "error", err, "duration", time.Since(start))
+	case exitCode != 0:
+		slog.Warn("Pre-stop hook exited non-zero", "container_id", containerID, "exit_code", exitCode, "duration", time.Since(start))
+	default:
+		slog.Info("Pre-stop hook completed", "container_id", containerID, "duration", time.Since(start))
+	}
+}
+
+// execAndWait runs cmd in the container, discards its output and returns the
+// exit code. A hung process never closes the stream, so the read is bounded by ctx.
+func (m *DockerManager) execAndWait(ctx context.Context, containerID, user string, cmd []string) (int, error) {
+	resp, err := m.cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          cmd,
+		User:         user,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("create exec: %w", err)
+	}
+
+	attachResp, err := m.cli.ContainerExecAttach(ctx, resp.ID, container.ExecStartOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("attach exec: %w", err)
+	}
+	defer attachResp.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, readErr := io.Copy(io.Discard, attachResp.Reader)
+		done <- readErr
+	}()
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case readErr := <-done:
+		if readErr != nil {
+			return 0, fmt.Errorf("read exec output: %w", readErr)
+		}
+	}
+
+	inspect, err := m.cli.ContainerExecInspect(ctx, resp.ID)
+	if err != nil {
+		return 0, fmt.Errorf("inspect exec: %w", err)
+	}
+	return inspect.ExitCode, nil
+}
@@ -0,0 +1,41 @@
+package container
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+)
+
+func TestStopPolicyFor(t *testing.T) {
+	m := &DockerManager{cfg: &config.Config{Timeout: config.TimeoutConfig{
+		ContainerStop: 30 * time.Second,
+		PreStopHook:   5 * time.Second,
+	}}}
+
+	policy := m.stopPolicyFor("c1", map[string]string{
+		labelPreStop:        "/usr/local/bin/shsh-pre-stop",
+		labelPreStopTimeout: "20s",
+		labelStopTimeout:    "1m",
+		labelStopSignal:     "SIGINT",
+	})
+	if policy.preStop != "/usr/local/bin/shsh-pre-stop" || policy.preStopTimeout != 20*time.Second ||
+		policy.stopTimeout != time.Minute || policy.stopSignal != "SIGINT" {
+		t.Fatalf("labels not applied: %+v", policy)
+	}
+
+	policy = m.stopPolicyFor("c1", map[string]string{labelStopTimeout: "soon", labelPreStopTimeout: "-1s"})
+	if policy.stopTimeout != 30*time.Second || policy.preStopTimeout != 5*time.Second {
+		t.Fatalf("invalid labels should fall back to the configuration: %+v", policy)
+	}
+
+	// A zero configured bound disables hooks whatever the image says.
+	m.cfg.Timeout.PreStopHook = 0
+	if policy := m.stopPolicyFor("c1", map[string]string{labelPreStopTimeout: "20s"}); policy.preStopTimeout != 0 {
+		t.Fatalf("expected hooks to stay disabled, got %v", policy.preStopTimeout)
+	}
+
+	if policy := (&DockerManager{}).stopPolicyFor("c1", nil); policy.preStopTimeout != defaultPreStopTimeout || policy.stopTimeout != defaultStopTimeout {
+		t.Fatalf("expected defaults without configuration, got %+v", policy)
+	}
+}
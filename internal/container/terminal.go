@@ -0,0 +1,49 @@
+package container
+
+import (
+	"context"
+	"io"
+)
+
+// maxTerminalSize bounds client-reported terminal dimensions.
+const maxTerminalSize = 1000
+
+// TerminalOptions describes the client terminal an exec session serves.
+// The zero value keeps Docker's defaults: TERM=xterm at 80x24.
+type TerminalOptions struct {
+	Term      string // TERM for the shell, e.g. "xterm-256color"; empty keeps the default
+	ColorTerm string // COLORTERM for the shell, e.g. "truecolor"; empty leaves it unset
+	Cols      uint   // Initial width; 0 uses 80
+	Rows      uint   // Initial height; 0 uses 24
+}
+
+// TerminalExecCreator is implemented by attachers that can create exec
+// sessions matching the client terminal.
+type TerminalExecCreator interface {
+	CreateTerminalExecSession(ctx context.Context, containerID string, opts TerminalOptions) (string, io.ReadWriteCloser, error)
+}
+
+// size returns the initial console size, falling back to 80x24 for missing
+// or out-of-range dimensions.
+func (o TerminalOptions) size() (cols, rows uint) {
+	cols, rows = o.Cols, o.Rows
+	if cols == 0 || cols > maxTerminalSize {
+		cols = defaultCols
+	}
+	if rows == 0 || rows > maxTerminalSize {
+		rows = defaultRows
+	}
+	return cols, rows
+}
+
+// env returns the environment entries the options set.
+func (o TerminalOptions) env() []string {
+	var env []string
+	if o.Term != "" {
+		env = append(env, "TERM="+o.Term)
+	}
+	if o.ColorTerm != "" {
+		env = append(env, "COLORTERM="+o.ColorTerm)
+	}
+	return env
+}
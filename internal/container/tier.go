@@ -0,0 +1,71 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/docker/docker/api/types/container"
+)
+
+// defaultResourceTier applies when a manager has no configuration.
+var defaultResourceTier = config.ResourceTier{
+	MemoryLimitBytes: 512 * 1024 * 1024, // 512MB
+	CPUQuota:         50000,             // 0.5 CPU
+	PidsLimit:        256,
+}
+
+type resourceTierKey struct{}
+
+// WithResourceTier returns a context whose EnsureContainer calls give new
+// containers tier's limits. Docker containers that already exist are updated
+// to them; running kubernetes pods keep theirs until recreated.
+func WithResourceTier(ctx context.Context, tier config.ResourceTier) context.Context {
+	return context.WithValue(ctx, resourceTierKey{}, tier)
+}
+
+// ResourceTierFromContext returns the tier attached to ctx, if any.
+func ResourceTierFromContext(ctx context.Context) (config.ResourceTier, bool) {
+	tier, ok := ctx.Value(resourceTierKey{}).(config.ResourceTier)
+	return tier, ok
+}
+
+// resourceTier returns the tier attached to ctx, falling back to the
+// configured default tier.
+func resourceTier(ctx context.Context, cfg *config.Config) (config.ResourceTier, bool) {
+	if tier, ok := ResourceTierFromContext(ctx); ok {
+		return tier, true
+	}
+	if cfg != nil {
+		return cfg.Container.ResolveTier(), false
+	}
+	return defaultResourceTier, false
+}
+
+// applyResourceTier updates an existing container to the tier requested by
+// ctx, so tier changes apply without recreating the container. Memory swap
+// is kept at twice the memory limit, as the daemon sets it on create.
+func (m *DockerManager) applyResourceTier(ctx context.Context, inspect container.InspectResponse) error {
+	tier, requested := resourceTier(ctx, m.cfg)
+	if !requested || inspect.HostConfig == nil {
+		return nil
+	}
+	current := inspect.HostConfig.Resources
+	if current.Memory == tier.MemoryLimitBytes && current.CPUQuota == tier.CPUQuota &&
+		current.PidsLimit != nil && *current.PidsLimit == tier.PidsLimit {
+		return nil
+	}
+
+	_, err := m.cli.ContainerUpdate(ctx, inspect.ID, container.UpdateConfig{Resources: container.Resources{
+		Memory:     tier.MemoryLimitBytes,
+		MemorySwap: 2 * tier.MemoryLimitBytes,
+		CPUQuota:   tier.CPUQuota,
+		PidsLimit:  ptr(tier.PidsLimit),
+	}})
+	if err != nil {
+		return fmt.Errorf("update container %s resources: %w", inspect.ID, err)
+	}
+	slog.Info("Applied resource tier to container", "container_id", inspect.ID, "tier", tier.Name)
+	return nil
+}
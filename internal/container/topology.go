@@ -0,0 +1,298 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+)
+
+// Lab topology failures TopologyManager methods report.
+var (
+	ErrTopologyNotFound = errors.New("no lab topology")
+	ErrNodeNotFound     = errors.New("lab node not found")
+)
+
+// nodeShellCmd opens bash where the node's image has it and sh otherwise;
+// server images such as nginx:alpine ship without bash.
+var nodeShellCmd = []string{"/bin/sh", "-c", "command -v bash >/dev/null 2>&1 && exec bash; exec sh"}
+
+// TopologyNode is a container to start as part of a lab.
+type TopologyNode struct {
+	Name  string   // Host name on the lab network
+	Image string   // Image reference
+	Env   []string // KEY=VALUE pairs
+}
+
+// NodeStatus describes a running lab node.
+type NodeStatus struct {
+	Name        string `json:"name"`
+	Image       string `json:"image"`
+	ContainerID string `json:"container_id"`
+	State       string `json:"state"`             // Docker state, e.g. running or exited
+	Address     string `json:"address,omitempty"` // IPv4 address on the lab network
+}
+
+// Topology is a user's running lab.
+type Topology struct {
+	Lab     string       `json:"lab"` // ID of the challenge that started it
+	Network string       `json:"network"`
+	Nodes   []NodeStatus `json:"nodes"`
+}
+
+// TopologyManager is implemented by managers that can run multi-container
+// labs, such as a client, a web server and a database for a networking
+// exercise. A user has at most one lab, on an internal network of its own
+// where nodes reach each other by name. It runs on the host of the user's
+// container and is removed with it.
+type TopologyManager interface {
+	// CreateTopology starts nodes as lab, replacing any lab the user had.
+	CreateTopology(ctx context.Context, userID, containerID, lab string, nodes []TopologyNode) (*Topology, error)
+	// Topology describes the user's lab, or fails with ErrTopologyNotFound.
+	Topology(ctx context.Context, userID, containerID string) (*Topology, error)
+	// DestroyTopology removes the user's lab, or fails with
+	// ErrTopologyNotFound.
+	DestroyTopology(ctx context.Context, userID, containerID string) error
+	// AttachNode opens a root shell on a node of the user's lab. It is
+	// resized like any other exec session.
+	AttachNode(ctx context.Context, userID, containerID, node string, opts TerminalOptions) (string, io.ReadWriteCloser, error)
+}
+
+// labNetworkName returns the name of a user's lab network.
+func labNetworkName(userID string) string {
+	return "shsh-lab-" + userID
+}
+
+// labFilter matches the lab resources of a user, or one node of them.
+func labFilter(userID, node string) filters.Args {
+	args := filters.NewArgs(
+		filters.Arg("label", labelOwner+"="+userID),
+		filters.Arg("label", labelLab),
+	)
+	if node != "" {
+		args.Add("label", labelLabNode+"="+node)
+	}
+	return args
+}
+
+// CreateTopology starts a lab on an internal network. Nodes are created
+// with the user's resource tier and runtime; a node that fails to start
+// takes the whole lab down with it.
+func (m *DockerManager) CreateTopology(ctx context.Context, userID, _ string, lab string, nodes []TopologyNode) (*Topology, error) {
+	if err := m.destroyTopology(ctx, userID); err != nil && !errors.Is(err, ErrTopologyNotFound) {
+		return nil, err
+	}
+
+	labels := m.resourceLabels(userID, identity.SessionIDFromContext(ctx))
+	labels[labelLab] = lab
+	networkName := labNetworkName(userID)
+	if _, err := m.cli.NetworkCreate(ctx, networkName, network.CreateOptions{
+		Driver:   "bridge",
+		Internal: true,
+		Labels:   labels,
+	}); err != nil {
+		return nil, fmt.Errorf("create lab network %s: %w", networkName, err)
+	}
+
+	for _, node := range nodes {
+		if err := m.startNode(ctx, userID, labels, node); err != nil {
+			// Removal must happen even if ctx has expired.
+			if cleanupErr := m.destroyTopology(context.WithoutCancel(ctx), userID); cleanupErr != nil {
+				slog.Warn("Failed to remove partial lab", "error", cleanupErr, "user_id", userID, "lab", lab)
+			}
+			return nil, fmt.Errorf("start lab node %s: %w", node.Name, err)
+		}
+	}
+	slog.Info("Lab topology started", "user_id", userID, "lab", lab, "nodes", len(nodes))
+	return m.topology(ctx, userID)
+}
+
+// startNode creates and starts one lab node. Nodes get a TTY and open stdin
+// so images whose command is a shell keep running.
+func (m *DockerManager) startNode(ctx context.Context, userID string, labLabels map[string]string, node TopologyNode) error {
+	if err := m.ensureImage(ctx, node.Image); err != nil {
+		return err
+	}
+	labels := make(map[string]string, len(labLabels)+1)
+	for k, v := range labLabels {
+		labels[k] = v
+	}
+	labels[labelLabNode] = node.Name
+
+	tier, _ := resourceTier(ctx, m.cfg)
+	networkName := labNetworkName(userID)
+	config := &container.Config{
+		Image:     node.Image,
+		Hostname:  node.Name,
+		Env:       node.Env,
+		Labels:    labels,
+		Tty:       true,
+		OpenStdin: true,
+	}
+	hostConfig := &container.HostConfig{
+		Runtime:     m.Runtime().Effective,
+		NetworkMode: container.NetworkMode(networkName),
+		Resources: container.Resources{
+			Memory:    tier.MemoryLimitBytes,
+			CPUQuota:  tier.CPUQuota,
+			PidsLimit: ptr(tier.PidsLimit),
+		},
+	}
+	networkConfig := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			networkName: {Aliases: []string{node.Name}},
+		},
+	}
+	resp, err := m.cli.ContainerCreate(ctx, config, hostConfig, networkConfig, nil, fmt.Sprintf("lab-%s-%s", userID, node.Name))
+	if err != nil {
+		return fmt.Errorf("create container: %w", err)
+	}
+	RecordEvent(ctx, m.events, userID, resp.ID, domain.ContainerEventCreate, ReasonLab)
+	if err := m.cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		return fmt.Errorf("start container: %w", err)
+	}
+	RecordEvent(ctx, m.events, userID, resp.ID, domain.ContainerEventStart, ReasonLab)
+	return nil
+}
+
+// Topology describes the user's lab.
+func (m *DockerManager) Topology(ctx context.Context, userID, _ string) (*Topology, error) {
+	return m.topology(ctx, userID)
+}
+
+func (m *DockerManager) topology(ctx context.Context, userID string) (*Topology, error) {
+	containers, err := m.cli.ContainerList(ctx, container.ListOptions{All: true, Filters: labFilter(userID, "")})
+	if err != nil {
+		return nil, fmt.Errorf("list lab nodes: %w", err)
+	}
+	if len(containers) == 0 {
+		return nil, ErrTopologyNotFound
+	}
+	networkName := labNetworkName(userID)
+	topo := &Topology{Network: networkName, Nodes: make([]NodeStatus, 0, len(containers))}
+	for _, c := range containers {
+		topo.Lab = c.Labels[labelLab]
+		status := NodeStatus{
+			Name:        c.Labels[labelLabNode],
+			Image:       c.Image,
+			ContainerID: c.ID,
+			State:       c.State,
+		}
+		if c.NetworkSettings != nil {
+			if endpoint, ok := c.NetworkSettings.Networks[networkName]; ok && endpoint != nil {
+				status.Address = endpoint.IPAddress
+			}
+		}
+		topo.Nodes = append(topo.Nodes, status)
+	}
+	sort.Slice(topo.Nodes, func(i, j int) bool { return topo.Nodes[i].Name < topo.Nodes[j].Name })
+	return topo, nil
+}
+
+// DestroyTopology removes the user's lab.
+func (m *DockerManager) DestroyTopology(ctx context.Context, userID, _ string) error {
+	return m.destroyTopology(ctx, userID)
+}
+
+// destroyTopology removes a user's lab nodes, then its network.
+func (m *DockerManager) destroyTopology(ctx context.Context, userID string) error {
+	containers, err := m.cli.ContainerList(ctx, container.ListOptions{All: true, Filters: labFilter(userID, "")})
+	if err != nil {
+		return fmt.Errorf("list lab nodes: %w", err)
+	}
+	var errs []error
+	stopCtx := WithLifecycleReason(ctx, ReasonLab)
+	for _, c := range containers {
+		if err := m.StopContainer(stopCtx, c.ID); err != nil {
+			errs = append(errs, fmt.Errorf("remove lab node %s: %w", c.Labels[labelLabNode], err))
+		}
+	}
+	networkName := labNetworkName(userID)
+	err = m.cli.NetworkRemove(ctx, networkName)
+	switch {
+	case err == nil:
+	case errdefs.IsNotFound(err):
+		if len(containers) == 0 {
+			return ErrTopologyNotFound
+		}
+	default:
+		errs = append(errs, fmt.Errorf("remove lab network %s: %w", networkName, err))
+	}
+	if len(errs) == 0 {
+		slog.Info("Lab topology removed", "user_id", userID, "nodes", len(containers))
+	}
+	return errors.Join(errs...)
+}
+
+// removeTopologyOf removes the lab of a user whose container was removed.
+func (m *DockerManager) removeTopologyOf(ctx context.Context, userID string) {
+	if err := m.destroyTopology(ctx, userID); err != nil && !errors.Is(err, ErrTopologyNotFound) {
+		slog.Warn("Failed to remove lab with its container", "error", err, "user_id", userID)
+	}
+}
+
+// AttachNode opens a shell on a lab node.
+func (m *DockerManager) AttachNode(ctx context.Context, userID, _ string, node string, opts TerminalOptions) (string, io.ReadWriteCloser, error) {
+	containers, err := m.cli.ContainerList(ctx, container.ListOptions{Filters: labFilter(userID, node)})
+	if err != nil {
+		return "", nil, fmt.Errorf("list lab nodes: %w", err)
+	}
+	if len(containers) == 0 {
+		return "", nil, fmt.Errorf("%w: %s", ErrNodeNotFound, node)
+	}
+	return m.createTTYExec(ctx, containers[0].ID, "root", nodeShellCmd, opts)
+}
+
+// isLabNode reports whether labels belong to a lab node rather than a
+// user's own container.
+func isLabNode(labels map[string]string) bool {
+	_, ok := labels[labelLab]
+	return ok
+}
+
+// CreateTopology starts a lab on whichever host runs the user's container.
+func (p *PoolManager) CreateTopology(ctx context.Context, userID, containerID, lab string, nodes []TopologyNode) (*Topology, error) {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return nil, errContainerNotRunning
+	}
+	return host.mgr.CreateTopology(ctx, userID, containerID, lab, nodes)
+}
+
+// Topology describes a lab on whichever host runs the user's container.
+func (p *PoolManager) Topology(ctx context.Context, userID, containerID string) (*Topology, error) {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return nil, errContainerNotRunning
+	}
+	return host.mgr.Topology(ctx, userID, containerID)
+}
+
+// DestroyTopology removes a lab on whichever host runs the user's
+// container.
+func (p *PoolManager) DestroyTopology(ctx context.Context, userID, containerID string) error {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return errContainerNotRunning
+	}
+	return host.mgr.DestroyTopology(ctx, userID, containerID)
+}
+
+// AttachNode opens a shell on a lab node on whichever host runs the user's
+// container.
+func (p *PoolManager) AttachNode(ctx context.Context, userID, containerID, node string, opts TerminalOptions) (string, io.ReadWriteCloser, error) {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return "", nil, errContainerNotRunning
+	}
+	return host.mgr.AttachNode(ctx, userID, containerID, node, opts)
+}
@@ -7,12 +7,21 @@ import (
 	"time"
 
 	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/domain"
 	"github.com/ashureev/shsh-labs/internal/shared"
 	"github.com/ashureev/shsh-labs/internal/store"
 )
 
-// deleteAgentSessionWithRetry attempts to delete an agent session with
-// exponential backoff to handle SQLITE_BUSY errors.
+// defaultSessionArchiveRetention is how long expired agent sessions stay
+// archived when no configuration is given.
+const defaultSessionArchiveRetention = 30 * 24 * time.Hour
+
+// defaultContainerEventRetention is how long container lifecycle events are
+// kept when no configuration is given.
+const defaultContainerEventRetention = 30 * 24 * time.Hour
+
+// deleteAgentSessionWithRetry attempts to delete a user's agent sessions
+// with exponential backoff to handle SQLITE_BUSY errors.
 func deleteAgentSessionWithRetry(ctx context.Context, repo store.Repository, userID string, cfg *config.Config) error {
 	maxRetries := 3
 	baseDelay := 100 * time.Millisecond
@@ -24,7 +33,7 @@ func deleteAgentSessionWithRetry(ctx context.Context, repo store.Repository, use
 	}
 
 	for i := 0; i < maxRetries; i++ {
-		err := repo.DeleteAgentSession(ctx, userID)
+		err := repo.DeleteAgentSessions(ctx, userID)
 		if err == nil {
 			return nil
 		}
@@ -43,7 +52,7 @@ func deleteAgentSessionWithRetry(ctx context.Context, repo store.Repository, use
 		}
 
 		// Non-retryable error or max retries exceeded
-		return fmt.Errorf("failed to delete agent session for %s after %d attempts: %w", userID, maxRetries, err)
+		return fmt.Errorf("failed to delete agent sessions for %s after %d attempts: %w", userID, maxRetries, err)
 	}
 
 	return nil
@@ -97,9 +106,28 @@ func updateContainerIDWithRetry(ctx context.Context, repo store.Repository, user
 // defaultTTLWorkerInterval is the default interval for TTL cleanup.
 const defaultTTLWorkerInterval = 5 * time.Minute
 
-// CleanupCallback is called when a session is cleaned up by the TTL worker.
+// defaultContainerMaxLifetime is the container age past which terminal
+// activity no longer keeps an idle session when no configuration is given.
+const defaultContainerMaxLifetime = 8 * time.Hour
+
+// expiryPauseTimeout bounds pausing one expired session's container.
+const expiryPauseTimeout = 10 * time.Second
+
+// expiryPauses maps the users whose containers the TTL worker paused to
+// those containers, so later sweeps do not pause them again.
+type expiryPauses map[string]string
+
+// CleanupCallback is called when a session is cleaned up by the TTL worker,
+// or its container paused when sessions are paused on expiry.
 type CleanupCallback func(userID string)
 
+// ActivitySource reports terminal activity that last_seen_at does not capture.
+type ActivitySource interface {
+	// LastActivity returns when the user's terminals were last active, e.g. by
+	// producing output or running a foreground command, or the zero time.
+	LastActivity(userID string) time.Time
+}
+
 // StartTTLWorker runs a background goroutine that periodically sweeps for
 // inactive sessions and cleans up associated containers.
 // Deprecated: Use StartTTLWorkerWithConfig instead.
@@ -110,20 +138,39 @@ func StartTTLWorker(ctx context.Context, repo store.Repository, mgr Manager, ttl
 // StartTTLWorkerWithConfig runs a background goroutine that periodically sweeps for
 // inactive sessions and cleans up associated containers with configuration.
 func StartTTLWorkerWithConfig(ctx context.Context, repo store.Repository, mgr Manager, ttl time.Duration, onCleanup CleanupCallback, cfg *config.Config) {
+	StartTTLWorkerWithActivity(ctx, repo, mgr, ttl, onCleanup, nil, cfg)
+}
+
+// StartTTLWorkerWithActivity is StartTTLWorkerWithConfig with an activity
+// source: sessions past the TTL by last_seen_at are kept, and their
+// last_seen_at advanced, while activity reports them active within the TTL.
+// Activity stops counting once the container is older than
+// SHSH_CONTAINER_MAX_LIFETIME, so a command printing forever cannot keep it
+// alive without the learner.
+//
+// With SHSH_CONTAINER_PAUSE_ON_EXPIRY set and a manager that can pause,
+// expired sessions have their container paused instead, keeping processes
+// such as tmux sessions until a terminal reconnects and resumes it. Only
+// sessions idle past SHSH_CONTAINER_PAUSED_TTL are removed.
+func StartTTLWorkerWithActivity(ctx context.Context, repo store.Repository, mgr Manager, ttl time.Duration, onCleanup CleanupCallback, activity ActivitySource, cfg *config.Config) {
 	interval := defaultTTLWorkerInterval
 	if cfg != nil {
 		interval = cfg.Timeout.TTLWorkerInterval
 	}
+	if _, ok := mgr.(Pauser); cfg != nil && cfg.Container.PauseOnExpiry && !ok {
+		slog.Warn("Container backend cannot pause; expired sessions are removed")
+	}
 
 	ticker := time.NewTicker(interval)
 	go func() {
 		defer ticker.Stop()
 		slog.Info("TTL worker started", "interval", interval, "ttl", ttl)
 
+		paused := make(expiryPauses)
 		for {
 			select {
 			case <-ticker.C:
-				cleanupExpiredSessions(ctx, repo, mgr, ttl, onCleanup, cfg)
+				cleanupExpiredSessions(ctx, repo, mgr, ttl, onCleanup, activity, paused, cfg)
 			case <-ctx.Done():
 				slog.Info("TTL worker shutting down", "reason", ctx.Err())
 				return
@@ -132,25 +179,92 @@ func StartTTLWorkerWithConfig(ctx context.Context, repo store.Repository, mgr Ma
 	}()
 }
 
-func cleanupExpiredSessions(ctx context.Context, repo store.Repository, mgr Manager, ttl time.Duration, onCleanup CleanupCallback, cfg *config.Config) {
+// expiryPauser returns the pauser and the idle time after which paused
+// sessions are removed, or nil when expired sessions are removed at once.
+func expiryPauser(mgr Manager, cfg *config.Config) (Pauser, time.Duration) {
+	if cfg == nil || !cfg.Container.PauseOnExpiry {
+		return nil, 0
+	}
+	pauser, ok := mgr.(Pauser)
+	if !ok {
+		return nil, 0
+	}
+	return pauser, cfg.Container.PausedTTL
+}
+
+func cleanupExpiredSessions(ctx context.Context, repo store.Repository, mgr Manager, ttl time.Duration, onCleanup CleanupCallback, activity ActivitySource, paused expiryPauses, cfg *config.Config) {
 	expiredUsers, err := repo.GetExpiredSessions(ctx, ttl)
 	if err != nil {
 		slog.Error("TTL worker failed to get expired sessions", "error", err)
 		return
 	}
 
+	// Sessions that are no longer expired were resumed or removed.
+	stillExpired := make(map[string]bool, len(expiredUsers))
+	for _, user := range expiredUsers {
+		stillExpired[user.UserID] = true
+	}
+	for userID := range paused {
+		if !stillExpired[userID] {
+			delete(paused, userID)
+		}
+	}
+
 	if len(expiredUsers) == 0 {
 		return
 	}
 
 	slog.Info("TTL worker found expired sessions", "count", len(expiredUsers))
 
+	pauser, pausedTTL := expiryPauser(mgr, cfg)
+	maxLifetime := defaultContainerMaxLifetime
+	if cfg != nil {
+		maxLifetime = cfg.Container.MaxLifetime
+	}
+	cleaned := 0
 	for _, user := range expiredUsers {
+		// Kept-warm sessions restart their TTL when the exemption ends.
+		if now := time.Now(); user.IsKeptWarm(now) {
+			slog.Info("TTL worker keeping warm session",
+				"user_id", user.UserID,
+				"keep_warm_until", user.KeepWarmUntil)
+			if err := repo.UpdateLastSeen(ctx, user.UserID, now); err != nil {
+				slog.Warn("TTL worker failed to update last seen", "error", err, "user_id", user.UserID)
+			}
+			continue
+		}
+		if activity != nil && !outlivedMaxLifetime(ctx, mgr, user.ContainerID, maxLifetime) {
+			if last := activity.LastActivity(user.UserID); time.Since(last) < ttl {
+				slog.Info("TTL worker keeping session with recent terminal activity",
+					"user_id", user.UserID,
+					"last_seen_at", user.LastSeenAt,
+					"last_activity", last)
+				if err := repo.UpdateLastSeen(ctx, user.UserID, last); err != nil {
+					slog.Warn("TTL worker failed to update last seen", "error", err, "user_id", user.UserID)
+				}
+				continue
+			}
+		}
+		if pauser != nil && time.Since(user.LastSeenAt) < pausedTTL {
+			if paused[user.UserID] == user.ContainerID {
+				continue
+			}
+			if pauseExpiredSession(ctx, repo, pauser, user, onCleanup) {
+				paused[user.UserID] = user.ContainerID
+				continue
+			}
+			// A container that cannot be paused, e.g. because it exited,
+			// is removed as usual.
+		}
+		delete(paused, user.UserID)
+		cleaned++
+
 		slog.Info("TTL worker cleaning up container",
 			"container_id", user.ContainerID,
 			"user_id", user.UserID)
+		RecordEvent(ctx, repo, user.UserID, user.ContainerID, domain.ContainerEventExpire, ReasonTTL)
 
-		if err := mgr.StopContainer(ctx, user.ContainerID); err != nil {
+		if err := mgr.StopContainer(WithLifecycleReason(ctx, ReasonTTL), user.ContainerID); err != nil {
 			slog.Error("TTL worker failed to stop container",
 				"error", err,
 				"container_id", user.ContainerID,
@@ -176,11 +290,65 @@ func cleanupExpiredSessions(ctx context.Context, repo store.Repository, mgr Mana
 		}
 	}
 
-	slog.Info("TTL worker cleanup completed", "cleaned", len(expiredUsers))
+	slog.Info("TTL worker cleanup completed", "cleaned", cleaned, "paused", len(paused))
 
-	if deleted, err := repo.CleanupExpiredSessions(ctx, 7*24*time.Hour); err != nil {
-		slog.Error("TTL worker failed to cleanup orphaned agent sessions", "error", err)
-	} else if deleted > 0 {
-		slog.Info("TTL worker cleaned up orphaned agent sessions", "count", deleted)
+	if archived, err := repo.CleanupExpiredSessions(ctx, 7*24*time.Hour); err != nil {
+		slog.Error("TTL worker failed to archive orphaned agent sessions", "error", err)
+	} else if archived > 0 {
+		slog.Info("TTL worker archived orphaned agent sessions", "count", archived)
+	}
+
+	retention := defaultSessionArchiveRetention
+	if cfg != nil {
+		retention = cfg.Database.SessionArchiveRetention
+	}
+	if pruned, err := repo.PruneArchivedSessions(ctx, retention); err != nil {
+		slog.Error("TTL worker failed to prune archived agent sessions", "error", err)
+	} else if pruned > 0 {
+		slog.Info("TTL worker pruned archived agent sessions", "count", pruned, "retention", retention)
+	}
+
+	eventRetention := defaultContainerEventRetention
+	if cfg != nil {
+		eventRetention = cfg.Database.ContainerEventRetention
+	}
+	if eventRetention > 0 {
+		if pruned, err := repo.PruneContainerEvents(ctx, eventRetention); err != nil {
+			slog.Error("TTL worker failed to prune container events", "error", err)
+		} else if pruned > 0 {
+			slog.Info("TTL worker pruned container events", "count", pruned, "retention", eventRetention)
+		}
+	}
+
+	if pruned, err := repo.PruneExpiredSessionShares(ctx); err != nil {
+		slog.Error("TTL worker failed to prune expired session shares", "error", err)
+	} else if pruned > 0 {
+		slog.Info("TTL worker pruned expired session shares", "count", pruned)
+	}
+}
+
+// pauseExpiredSession closes the user's terminals and pauses their container,
+// reporting whether it is paused.
+func pauseExpiredSession(ctx context.Context, repo store.Repository, pauser Pauser, user *domain.User, onCleanup CleanupCallback) bool {
+	slog.Info("TTL worker pausing container",
+		"container_id", user.ContainerID,
+		"user_id", user.UserID)
+
+	// A paused container cannot serve its terminals, so end them cleanly.
+	if onCleanup != nil {
+		onCleanup(user.UserID)
+	}
+
+	pauseCtx, cancel := context.WithTimeout(ctx, expiryPauseTimeout)
+	defer cancel()
+	if err := pauser.PauseContainer(pauseCtx, user.ContainerID); err != nil {
+		slog.Error("TTL worker failed to pause container",
+			"error", err,
+			"container_id", user.ContainerID,
+			"user_id", user.UserID)
+		return false
 	}
+	RecordEvent(ctx, repo, user.UserID, user.ContainerID, domain.ContainerEventExpire, ReasonTTL)
+	RecordEvent(ctx, repo, user.UserID, user.ContainerID, domain.ContainerEventPause, ReasonTTL)
+	return true
 }
@@ -0,0 +1,90 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types"
+)
+
+// VolumeRemover is implemented by managers that can delete a user's
+// persistent volume. The user's container must already be removed.
+type VolumeRemover interface {
+	// RemoveVolume deletes the user's volume and checkpoint snapshots; a
+	// missing volume is not an error.
+	RemoveVolume(ctx context.Context, userID string) error
+}
+
+// VolumeUsageReporter is implemented by managers that can measure the disk
+// space users' volumes take, e.g. for usage-based billing.
+type VolumeUsageReporter interface {
+	// VolumeUsage returns the bytes used per user by the volumes and
+	// checkpoint snapshots this server created. Users without a measured
+	// volume are left out.
+	VolumeUsage(ctx context.Context) (map[string]int64, error)
+}
+
+// volumeNameFor returns the name of the named volume holding a user's home.
+func volumeNameFor(userID string) string {
+	return fmt.Sprintf("playground-%s-data", userID)
+}
+
+// RemoveVolume deletes the user's volume and checkpoint snapshots.
+func (m *DockerManager) RemoveVolume(ctx context.Context, userID string) error {
+	if err := m.cli.VolumeRemove(ctx, volumeNameFor(userID), false); err != nil && !errdefs.IsNotFound(err) {
+		return fmt.Errorf("remove volume for %s: %w", userID, err)
+	}
+	return m.removeCheckpointVolumes(ctx, userID)
+}
+
+// RemoveVolume deletes the user's volume from every host that holds it.
+func (p *PoolManager) RemoveVolume(ctx context.Context, userID string) error {
+	var errs []error
+	for _, host := range p.hosts {
+		if err := host.mgr.RemoveVolume(ctx, userID); err != nil {
+			errs = append(errs, fmt.Errorf("host %s: %w", host.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// VolumeUsage returns the bytes used by each user's volumes. Docker computes
+// the sizes by walking the volumes, so calls can be slow on large hosts.
+func (m *DockerManager) VolumeUsage(ctx context.Context) (map[string]int64, error) {
+	du, err := m.cli.DiskUsage(ctx, types.DiskUsageOptions{Types: []types.DiskUsageObject{types.VolumeObject}})
+	if err != nil {
+		return nil, fmt.Errorf("disk usage: %w", err)
+	}
+	usage := make(map[string]int64)
+	for _, v := range du.Volumes {
+		owner := v.Labels[labelOwner]
+		if owner == "" || v.Labels[labelManaged] != "true" || v.Labels[labelInstance] != m.instanceID() {
+			continue
+		}
+		if v.UsageData == nil || v.UsageData.Size < 0 {
+			continue
+		}
+		usage[owner] += v.UsageData.Size
+	}
+	return usage, nil
+}
+
+// VolumeUsage sums the volume usage of every host; a user's volumes may be
+// left on more than one.
+func (p *PoolManager) VolumeUsage(ctx context.Context) (map[string]int64, error) {
+	usage := make(map[string]int64)
+	var errs []error
+	for _, host := range p.hosts {
+		hostUsage, err := host.mgr.VolumeUsage(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("host %s: %w", host.Name, err))
+			continue
+		}
+		for owner, size := range hostUsage {
+			usage[owner] += size
+		}
+	}
+	return usage, errors.Join(errs...)
+}
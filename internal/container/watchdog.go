@@ -0,0 +1,357 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/store"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+)
+
+// Watchdog defaults used when no configuration is provided.
+const (
+	defaultWatchdogInterval = 30 * time.Second
+	// watchdogInspectTimeout bounds inspecting one container during a sweep.
+	watchdogInspectTimeout = 5 * time.Second
+	// watchdogRetryDelay is the wait before subscribing to container events
+	// again after the stream failed.
+	watchdogRetryDelay = 5 * time.Second
+	// recreateCooldown is how soon after being recreated a container may die
+	// again before the watchdog stops recreating it, so that a container that
+	// cannot stay up is not recreated in a loop.
+	recreateCooldown = 5 * time.Minute
+)
+
+// ContainerExit describes a container whose main process ended without the
+// server stopping it.
+type ContainerExit struct {
+	ContainerID string
+	UserID      string // Owner label; empty for shared containers
+	Image       string // Image reference the container ran
+	OOMKilled   bool
+	ExitCode    int
+	Error       string // Runtime error, e.g. when the process could not start
+	FinishedAt  time.Time
+}
+
+// Reason returns the lifecycle reason recorded for the exit.
+func (e ContainerExit) Reason() string {
+	if e.OOMKilled {
+		return ReasonOOMKilled
+	}
+	return ReasonCrashed
+}
+
+// ExitWatcher is implemented by managers that can tell containers that died
+// from ones the server stopped, so that dead containers are recycled as soon
+// as they die rather than after several failed health probes.
+type ExitWatcher interface {
+	// ContainerExit returns how a container exited, or nil if it is still
+	// running or paused.
+	ContainerExit(ctx context.Context, containerID string) (*ContainerExit, error)
+
+	// WatchExits calls fn with each managed container that dies while the
+	// server is not stopping it. It blocks until ctx is done or the event
+	// stream fails.
+	WatchExits(ctx context.Context, fn func(ContainerExit)) error
+}
+
+// RecreateFunc provisions a new container for userID after theirs died;
+// image is the reference the dead container ran.
+type RecreateFunc func(ctx context.Context, userID, image string) error
+
+// ContainerExit inspects the container and returns how it exited.
+func (m *DockerManager) ContainerExit(ctx context.Context, containerID string) (*ContainerExit, error) {
+	if m.isStopping(containerID) {
+		return nil, nil
+	}
+	inspect, err := m.cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("inspect container %s: %w", containerID, err)
+	}
+	return exitOf(inspect), nil
+}
+
+// WatchExits follows the Docker events of managed containers.
+func (m *DockerManager) WatchExits(ctx context.Context, fn func(ContainerExit)) error {
+	args := m.managedFilter()
+	args.Add("type", string(events.ContainerEventType))
+	args.Add("event", string(events.ActionDie))
+	msgs, errs := m.cli.Events(ctx, events.ListOptions{Filters: args})
+	for {
+		select {
+		case msg := <-msgs:
+			if msg.Actor.Attributes[labelOwner] == "" {
+				continue
+			}
+			exit, err := m.ContainerExit(ctx, msg.Actor.ID)
+			if err != nil || exit == nil {
+				// Stopped by the server, or already removed by it.
+				continue
+			}
+			fn(*exit)
+		case err := <-errs:
+			return err
+		}
+	}
+}
+
+// isStopping reports whether StopContainer is stopping the container, so its
+// exit is not taken for a crash.
+func (m *DockerManager) isStopping(containerID string) bool {
+	_, ok := m.stopping.Load(containerID)
+	return ok
+}
+
+// exitOf returns how an inspected container exited, or nil if it has not.
+func exitOf(inspect container.InspectResponse) *ContainerExit {
+	state := inspect.State
+	if state == nil || state.Running || (state.Status != container.StateExited && state.Status != container.StateDead) {
+		return nil
+	}
+	exit := &ContainerExit{
+		ContainerID: inspect.ID,
+		OOMKilled:   state.OOMKilled,
+		ExitCode:    state.ExitCode,
+		Error:       state.Error,
+	}
+	if inspect.Config != nil {
+		exit.UserID = inspect.Config.Labels[labelOwner]
+		exit.Image = inspect.Config.Image
+	}
+	if finished, err := time.Parse(time.RFC3339Nano, state.FinishedAt); err == nil {
+		exit.FinishedAt = finished
+	}
+	return exit
+}
+
+// ContainerExit inspects a container on whichever host holds it.
+func (p *PoolManager) ContainerExit(ctx context.Context, containerID string) (*ContainerExit, error) {
+	host := p.hostOf(ctx, containerID)
+	if host == nil {
+		return nil, fmt.Errorf("container %s: %w", containerID, errContainerNotRunning)
+	}
+	return host.mgr.ContainerExit(ctx, containerID)
+}
+
+// WatchExits follows the events of every host until ctx is done, watching a
+// host again whenever its event stream fails.
+func (p *PoolManager) WatchExits(ctx context.Context, fn func(ContainerExit)) error {
+	var wg sync.WaitGroup
+	for _, host := range p.hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			watchExits(ctx, host.mgr, fn, "host", host.Name)
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// watchExits runs w.WatchExits until ctx is done, subscribing again after
+// watchdogRetryDelay whenever the event stream fails.
+func watchExits(ctx context.Context, w ExitWatcher, fn func(ContainerExit), logArgs ...any) {
+	for {
+		err := w.WatchExits(ctx, fn)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("Container event stream failed, watching again",
+			append([]any{"error", err, "retry_in", watchdogRetryDelay}, logArgs...)...)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(watchdogRetryDelay):
+		}
+	}
+}
+
+// watchdog recycles containers that crashed or were OOM-killed.
+type watchdog struct {
+	repo      store.Repository
+	mgr       Manager
+	exits     ExitWatcher
+	onRecycle CleanupCallback
+	recreate  RecreateFunc
+	cfg       *config.Config
+
+	mu        sync.Mutex
+	handling  map[string]bool      // Container IDs being recycled
+	recreated map[string]time.Time // When each user's container was last recreated
+}
+
+// StartWatchdogWithConfig runs background goroutines that notice containers
+// whose main process died, from container events and a periodic sweep of
+// active containers. Rather than leaving the learner to find a container that
+// is not ready, each one is removed with the reason it died (oom_killed or
+// crashed) recorded in the audit log, its user's binding is cleared and
+// onRecycle is called with the user ID so live terminal sessions can be
+// closed. A non-nil recreate then provisions the user a new container.
+// Managers that do not implement ExitWatcher are left to the health worker.
+func StartWatchdogWithConfig(ctx context.Context, repo store.Repository, mgr Manager, onRecycle CleanupCallback, recreate RecreateFunc, cfg *config.Config) {
+	interval := defaultWatchdogInterval
+	if cfg != nil {
+		interval = cfg.Container.WatchdogInterval
+	}
+	if interval <= 0 {
+		slog.Info("Container watchdog disabled")
+		return
+	}
+	exits, ok := mgr.(ExitWatcher)
+	if !ok {
+		slog.Info("Container watchdog unavailable for this backend; dead containers are left to health probes")
+		return
+	}
+
+	w := &watchdog{
+		repo:      repo,
+		mgr:       mgr,
+		exits:     exits,
+		onRecycle: onRecycle,
+		recreate:  recreate,
+		cfg:       cfg,
+		handling:  make(map[string]bool),
+		recreated: make(map[string]time.Time),
+	}
+	go watchExits(ctx, exits, func(exit ContainerExit) { w.handle(ctx, exit) })
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		slog.Info("Container watchdog started", "interval", interval, "auto_recreate", recreate != nil)
+
+		// Containers may have died while the server was down.
+		w.sweep(ctx)
+		for {
+			select {
+			case <-ticker.C:
+				w.sweep(ctx)
+			case <-ctx.Done():
+				slog.Info("Container watchdog shutting down", "reason", ctx.Err())
+				return
+			}
+		}
+	}()
+}
+
+// sweep inspects every active container, catching exits whose events were
+// missed while the event stream was down.
+func (w *watchdog) sweep(ctx context.Context) {
+	users, err := w.repo.GetActiveContainers(ctx)
+	if err != nil {
+		slog.Error("Watchdog failed to list active containers", "error", err)
+		return
+	}
+	for _, user := range users {
+		inspectCtx, cancel := context.WithTimeout(ctx, watchdogInspectTimeout)
+		exit, err := w.exits.ContainerExit(inspectCtx, user.ContainerID)
+		cancel()
+		if err != nil || exit == nil {
+			// Containers that cannot be inspected are left to health probes.
+			continue
+		}
+		if exit.UserID == "" {
+			exit.UserID = user.UserID
+		}
+		w.handle(ctx, *exit)
+	}
+}
+
+// handle recycles a dead container if it is still its user's bound
+// container.
+func (w *watchdog) handle(ctx context.Context, exit ContainerExit) {
+	if exit.UserID == "" || !w.begin(exit.ContainerID) {
+		return
+	}
+	defer w.end(exit.ContainerID)
+
+	user, err := w.repo.GetUser(ctx, exit.UserID)
+	if err != nil || user == nil || user.ContainerID != exit.ContainerID {
+		// Lab nodes, sidecars and containers already replaced are not bound.
+		return
+	}
+
+	reason := exit.Reason()
+	slog.Error("Recycling dead container",
+		"container_id", exit.ContainerID,
+		"user_id", exit.UserID,
+		"reason", reason,
+		"exit_code", exit.ExitCode,
+		"runtime_error", exit.Error,
+		"finished_at", exit.FinishedAt)
+	if err := w.mgr.StopContainer(WithLifecycleReason(ctx, reason), exit.ContainerID); err != nil {
+		slog.Error("Watchdog failed to remove dead container",
+			"error", err,
+			"container_id", exit.ContainerID,
+			"user_id", exit.UserID)
+	}
+	// Cleared before sessions close, so terminals reconnecting find no
+	// container rather than a dead one.
+	if err := updateContainerIDWithRetry(ctx, w.repo, exit.UserID, "", exit.ContainerID, w.cfg); err != nil {
+		slog.Warn("Watchdog failed to clear container ID",
+			"error", err,
+			"user_id", exit.UserID)
+		return
+	}
+	if w.onRecycle != nil {
+		w.onRecycle(exit.UserID)
+	}
+
+	if w.recreate == nil {
+		return
+	}
+	if !w.mayRecreate(exit.UserID, time.Now()) {
+		slog.Warn("Container died soon after being recreated, not recreating it again",
+			"user_id", exit.UserID,
+			"cooldown", recreateCooldown)
+		return
+	}
+	go func() {
+		if err := w.recreate(WithLifecycleReason(ctx, reason), exit.UserID, exit.Image); err != nil {
+			slog.Error("Watchdog failed to recreate container", "error", err, "user_id", exit.UserID)
+			return
+		}
+		slog.Info("Recreated dead container", "user_id", exit.UserID, "reason", reason)
+	}()
+}
+
+// begin claims a container for recycling, reporting false if an event and a
+// sweep found it at the same time.
+func (w *watchdog) begin(containerID string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.handling[containerID] {
+		return false
+	}
+	w.handling[containerID] = true
+	return true
+}
+
+func (w *watchdog) end(containerID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.handling, containerID)
+}
+
+// mayRecreate reports whether the user's container may be recreated at now,
+// recording the recreation if so.
+func (w *watchdog) mayRecreate(userID string, now time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for id, at := range w.recreated {
+		if now.Sub(at) >= recreateCooldown {
+			delete(w.recreated, id)
+		}
+	}
+	if _, recent := w.recreated[userID]; recent {
+		return false
+	}
+	w.recreated[userID] = now
+	return true
+}
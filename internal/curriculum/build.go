@@ -0,0 +1,59 @@
+package curriculum
+
+import (
+	"io/fs"
+	"path"
+)
+
+// BuiltImage is the image a topology.txt node names to run the image built
+// from its challenge's image/Dockerfile.
+const BuiltImage = "Dockerfile"
+
+// imageDockerfile is the Dockerfile of a challenge's custom environment,
+// built with the rest of image/ as its context.
+const imageDockerfile = "image/Dockerfile"
+
+// ImageBuild is a challenge's custom environment to build.
+type ImageBuild struct {
+	Challenge string
+	Ref       string
+	Context   fs.FS // The challenge's image/ directory
+}
+
+// LabImageRef returns the tag the image of challenge id is built as.
+func LabImageRef(id string) string {
+	return "shsh-lab/" + id + ":latest"
+}
+
+// ImageContext returns the build context of challenge id's image, if it has
+// an image/Dockerfile.
+func (l *Library) ImageContext(id string) (fs.FS, bool) {
+	if !challengeIDPattern.MatchString(id) {
+		return nil, false
+	}
+	info, err := fs.Stat(l.fsys, path.Join(id, imageDockerfile))
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, false
+	}
+	sub, err := fs.Sub(l.fsys, path.Join(id, path.Dir(imageDockerfile)))
+	if err != nil {
+		return nil, false
+	}
+	return sub, true
+}
+
+// Builds returns the images of the library's challenges that ship an
+// image/Dockerfile, in challenge order.
+func (l *Library) Builds() ([]ImageBuild, error) {
+	summaries, err := l.List()
+	if err != nil {
+		return nil, err
+	}
+	var builds []ImageBuild
+	for _, summary := range summaries {
+		if ctx, ok := l.ImageContext(summary.ID); ok {
+			builds = append(builds, ImageBuild{Challenge: summary.ID, Ref: LabImageRef(summary.ID), Context: ctx})
+		}
+	}
+	return builds, nil
+}
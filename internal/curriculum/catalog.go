@@ -0,0 +1,638 @@
+package curriculum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// sourcesFile is the registry of sources in the catalog directory.
+	sourcesFile = "sources.json"
+
+	// stagingPrefix names the directories a source is fetched into before
+	// its bundle is validated. Source names cannot start with a dot.
+	stagingPrefix = ".staging-"
+
+	// maxSourceClassrooms bounds the classrooms a source is assigned to.
+	maxSourceClassrooms = 100
+)
+
+// Errors returned by the catalog.
+var (
+	ErrInvalidSource  = errors.New("curriculum sources need a name of lowercase letters, digits or dashes and an http(s) git URL")
+	ErrSourceNotFound = errors.New("curriculum source not found")
+	ErrInvalidBundle  = errors.New("invalid curriculum bundle")
+)
+
+// refPattern bounds source refs to branch and tag names.
+var refPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]{0,199}$`)
+
+// Source is a git repository registered as a curriculum source. Its
+// challenges are laid out as described in the package documentation, at the
+// root of the repository or under challenges/.
+type Source struct {
+	Name       string   `json:"name"`
+	URL        string   `json:"url"`                  // http(s) URL of the repository; may carry credentials
+	Ref        string   `json:"ref,omitempty"`        // Branch or tag; empty follows the default branch
+	Classrooms []string `json:"classrooms,omitempty"` // Classrooms shown its challenges; empty shows them to everyone
+}
+
+// SourceStatus is a source with the outcome of its syncs.
+type SourceStatus struct {
+	Source
+	Commit     string    `json:"commit,omitempty"` // Commit of the challenges being served
+	Challenges []string  `json:"challenges"`
+	SyncedAt   time.Time `json:"synced_at,omitzero"`  // When Commit was checked out
+	CheckedAt  time.Time `json:"checked_at,omitzero"` // Last sync attempt
+	Error      string    `json:"error,omitempty"`     // Why the last sync failed
+}
+
+// source is a registered source and the library over its checkout.
+type source struct {
+	status  SourceStatus
+	lib     *Library // nil until a bundle was validated
+	refetch bool     // Repository or ref changed since Commit was checked out
+}
+
+// visibleTo reports whether classroom is shown the source's challenges.
+func (s *source) visibleTo(classroom string) bool {
+	return len(s.status.Classrooms) == 0 || slices.Contains(s.status.Classrooms, classroom)
+}
+
+// Catalog serves the built-in challenges together with those of registered
+// git sources. Sources are fetched into a directory and synced on a
+// schedule; a sync that fails, or whose bundle is invalid, keeps serving the
+// last good checkout.
+type Catalog struct {
+	builtin  *Library
+	dir      string
+	maxBytes int64
+	git      *gitClient
+
+	syncMu sync.Mutex // Serializes syncs and registry changes
+
+	mu      sync.Mutex
+	sources map[string]*source
+}
+
+// NewCatalog creates a catalog keeping sources in dir. A source's packfile
+// and checkout are each limited to maxBytes.
+func NewCatalog(builtin *Library, dir string, maxBytes int64) *Catalog {
+	return &Catalog{
+		builtin:  builtin,
+		dir:      dir,
+		maxBytes: maxBytes,
+		git:      &gitClient{http: &http.Client{}, maxBytes: maxBytes},
+		sources:  make(map[string]*source),
+	}
+}
+
+// Load reads the registered sources and the checkouts of their last syncs,
+// so their challenges are served again before the first sync after a
+// restart.
+func (c *Catalog) Load() error {
+	data, err := os.ReadFile(filepath.Join(c.dir, sourcesFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read curriculum sources: %w", err)
+	}
+	var statuses []SourceStatus
+	if err := json.Unmarshal(data, &statuses); err != nil {
+		return fmt.Errorf("decode curriculum sources: %w", err)
+	}
+
+	for _, status := range statuses {
+		s := &source{status: status}
+		if status.Commit != "" {
+			checkout := filepath.Join(c.dir, status.Name)
+			if root, ids, err := c.validateBundle(checkout, status.Name); err != nil {
+				slog.Warn("Ignoring invalid curriculum checkout", "error", err, "source", status.Name)
+				s.status.Commit = ""
+				s.status.Challenges = nil
+			} else {
+				s.lib = NewLibrary(os.DirFS(filepath.Join(checkout, root)))
+				s.status.Challenges = ids
+			}
+		}
+		c.add(s)
+	}
+	return nil
+}
+
+func (c *Catalog) add(s *source) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sources[s.status.Name] = s
+}
+
+// Start syncs every source now and then each interval until ctx is
+// cancelled. Each sync is bounded by timeout.
+func (c *Catalog) Start(ctx context.Context, interval, timeout time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			c.SyncAll(ctx, timeout)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// SyncAll syncs every source, logging failures.
+func (c *Catalog) SyncAll(ctx context.Context, timeout time.Duration) {
+	for _, src := range c.statuses() {
+		name := src.Name
+		syncCtx, cancel := context.WithTimeout(ctx, timeout)
+		status, err := c.Sync(syncCtx, name)
+		cancel()
+		switch {
+		case err != nil:
+			slog.Error("Failed to sync curriculum source", "source", name, "error", err)
+		case status.Error != "":
+			slog.Warn("Curriculum source sync failed", "source", name, "error", status.Error)
+		}
+	}
+}
+
+// Register adds a source or updates an existing one and syncs it. A sync
+// failure does not undo the registration; it is reported in the status.
+func (c *Catalog) Register(ctx context.Context, src Source) (SourceStatus, error) {
+	src, err := normalizeSource(src)
+	if err != nil {
+		return SourceStatus{}, err
+	}
+
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+	if err := c.upsert(src); err != nil {
+		return SourceStatus{}, err
+	}
+	return c.sync(ctx, src.Name)
+}
+
+// upsert stores src and saves the registry. An existing source keeps
+// serving its checkout until the next sync, which refetches it if the
+// repository or ref changed.
+func (c *Catalog) upsert(src Source) error {
+	c.update(src)
+	return c.save()
+}
+
+func (c *Catalog) update(src Source) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.sources[src.Name]
+	if !ok {
+		s = &source{}
+		c.sources[src.Name] = s
+	}
+	if s.status.URL != src.URL || s.status.Ref != src.Ref {
+		s.refetch = true
+	}
+	s.status.Source = src
+}
+
+// Sync fetches the source's ref and, if it moved, checks it out, validates
+// the bundle and starts serving it. A failure is recorded in the status and
+// leaves the previous checkout in place.
+func (c *Catalog) Sync(ctx context.Context, name string) (SourceStatus, error) {
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+	return c.sync(ctx, name)
+}
+
+// sync syncs a source; the caller holds syncMu.
+func (c *Catalog) sync(ctx context.Context, name string) (SourceStatus, error) {
+	status, refetch, ok := c.lookup(name)
+	if !ok {
+		return SourceStatus{}, ErrSourceNotFound
+	}
+	if refetch {
+		status.Commit = ""
+	}
+
+	checkedAt := time.Now()
+	lib, got, err := c.fetch(ctx, status)
+	result := c.record(name, checkedAt, lib, got, err)
+	if err := c.save(); err != nil {
+		return SourceStatus{}, err
+	}
+	return result.public(), nil
+}
+
+// lookup returns the status of a source and whether it must be refetched.
+func (c *Catalog) lookup(name string) (SourceStatus, bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.sources[name]
+	if !ok {
+		return SourceStatus{}, false, false
+	}
+	return s.status, s.refetch, true
+}
+
+// record stores the outcome of a sync and returns the new status.
+func (c *Catalog) record(name string, checkedAt time.Time, lib *Library, got fetched, err error) SourceStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.sources[name]
+	s.status.CheckedAt = checkedAt
+	s.status.Error = ""
+	switch {
+	case err != nil:
+		s.status.Error = err.Error()
+	case lib != nil:
+		s.lib = lib
+		s.refetch = false
+		s.status.Commit = got.commit
+		s.status.Challenges = got.challenges
+		s.status.SyncedAt = checkedAt
+		slog.Info("Curriculum source updated", "source", name, "commit", got.commit, "challenges", len(got.challenges))
+	}
+	return s.status
+}
+
+// fetched identifies a checkout that was put in place.
+type fetched struct {
+	commit     string
+	challenges []string
+}
+
+// fetch checks out the commit status's ref points to, when it differs from
+// the one being served. It returns a nil library when nothing changed.
+func (c *Catalog) fetch(ctx context.Context, status SourceStatus) (*Library, fetched, error) {
+	commit, err := c.git.resolve(ctx, status.URL, status.Ref)
+	if err != nil {
+		return nil, fetched{}, err
+	}
+	if commit == status.Commit {
+		return nil, fetched{}, nil
+	}
+	objects, err := c.git.fetch(ctx, status.URL, commit)
+	if err != nil {
+		return nil, fetched{}, err
+	}
+
+	if err := os.MkdirAll(c.dir, 0o750); err != nil {
+		return nil, fetched{}, fmt.Errorf("create curriculum directory: %w", err)
+	}
+	staging := filepath.Join(c.dir, stagingPrefix+status.Name)
+	if err := os.RemoveAll(staging); err != nil {
+		return nil, fetched{}, fmt.Errorf("clear staging directory: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(staging); err != nil {
+			slog.Warn("Failed to remove curriculum staging directory", "error", err, "path", staging)
+		}
+	}()
+	if err := checkout(objects, commit, staging, c.maxBytes); err != nil {
+		return nil, fetched{}, err
+	}
+	root, ids, err := c.validateBundle(staging, status.Name)
+	if err != nil {
+		return nil, fetched{}, err
+	}
+
+	final := filepath.Join(c.dir, status.Name)
+	if err := replaceDir(staging, final); err != nil {
+		return nil, fetched{}, err
+	}
+	return NewLibrary(os.DirFS(filepath.Join(final, root))), fetched{commit: commit, challenges: ids}, nil
+}
+
+// replaceDir moves src to dst, replacing what dst held.
+func replaceDir(src, dst string) error {
+	old := dst + ".old"
+	if err := os.RemoveAll(old); err != nil {
+		return fmt.Errorf("clear previous checkout: %w", err)
+	}
+	if err := os.Rename(dst, old); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("move previous checkout: %w", err)
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return fmt.Errorf("move new checkout: %w", err)
+	}
+	if err := os.RemoveAll(old); err != nil {
+		slog.Warn("Failed to remove previous curriculum checkout", "error", err, "path", old)
+	}
+	return nil
+}
+
+// validateBundle checks the challenges of the checkout at dir and returns
+// their directory relative to dir and their IDs. Every challenge needs a
+// title and a valid faults.txt if it has one, and IDs must not clash with
+// built-in challenges or those of other sources.
+func (c *Catalog) validateBundle(dir, name string) (string, []string, error) {
+	root := "."
+	if info, err := os.Stat(filepath.Join(dir, "challenges")); err == nil && info.IsDir() {
+		root = "challenges"
+	}
+	lib := NewLibrary(os.DirFS(filepath.Join(dir, root)))
+	summaries, err := lib.List()
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+	}
+	if len(summaries) == 0 {
+		return "", nil, fmt.Errorf("%w: no challenges found", ErrInvalidBundle)
+	}
+
+	ids := make([]string, 0, len(summaries))
+	for _, summary := range summaries {
+		if summary.Title == "" {
+			return "", nil, fmt.Errorf("%w: %s/content.md has no \"# \" title", ErrInvalidBundle, summary.ID)
+		}
+		if _, err := lib.Faults(summary.ID); err != nil {
+			return "", nil, fmt.Errorf("%w: %s/faults.txt: %w", ErrInvalidBundle, summary.ID, err)
+		}
+		if _, err := lib.Topology(summary.ID); err != nil {
+			return "", nil, fmt.Errorf("%w: %s/topology.txt: %w", ErrInvalidBundle, summary.ID, err)
+		}
+		if owner := c.owner(summary.ID, name); owner != "" {
+			return "", nil, fmt.Errorf("%w: challenge %s is already provided by %s", ErrInvalidBundle, summary.ID, owner)
+		}
+		ids = append(ids, summary.ID)
+	}
+	return root, ids, nil
+}
+
+// owner returns what provides challenge id besides source exclude: "built-in",
+// another source's name, or "".
+func (c *Catalog) owner(id, exclude string) string {
+	if _, err := c.builtin.Content(id); err == nil {
+		return "built-in"
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, s := range c.sources {
+		if name != exclude && slices.Contains(s.status.Challenges, id) {
+			return name
+		}
+	}
+	return ""
+}
+
+// Remove unregisters a source and deletes its checkout.
+func (c *Catalog) Remove(name string) error {
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+
+	if !c.delete(name) {
+		return ErrSourceNotFound
+	}
+	if err := c.save(); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(c.dir, name)); err != nil {
+		return fmt.Errorf("remove checkout of %s: %w", name, err)
+	}
+	return nil
+}
+
+// delete unregisters a source and reports whether it existed.
+func (c *Catalog) delete(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.sources[name]
+	delete(c.sources, name)
+	return ok
+}
+
+// Sources returns the registered sources sorted by name, with credentials
+// redacted from their URLs.
+func (c *Catalog) Sources() []SourceStatus {
+	statuses := c.statuses()
+	for i := range statuses {
+		statuses[i] = statuses[i].public()
+	}
+	return statuses
+}
+
+// statuses returns the status of every source sorted by name.
+func (c *Catalog) statuses() []SourceStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	statuses := make([]SourceStatus, 0, len(c.sources))
+	for _, s := range c.sources {
+		statuses = append(statuses, s.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// save writes the registry; the caller holds syncMu.
+func (c *Catalog) save() error {
+	data, err := json.MarshalIndent(c.statuses(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode curriculum sources: %w", err)
+	}
+	if err := os.MkdirAll(c.dir, 0o750); err != nil {
+		return fmt.Errorf("create curriculum directory: %w", err)
+	}
+	// The registry may hold repository credentials.
+	tmp := filepath.Join(c.dir, sourcesFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write curriculum sources: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(c.dir, sourcesFile)); err != nil {
+		return fmt.Errorf("write curriculum sources: %w", err)
+	}
+	return nil
+}
+
+// library returns the library serving challenge id to classroom.
+func (c *Catalog) library(id, classroom string) (*Library, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range c.sources {
+		if s.lib != nil && slices.Contains(s.status.Challenges, id) {
+			return s.lib, s.visibleTo(classroom)
+		}
+	}
+	return c.builtin, true
+}
+
+// Content returns the rendered content of challenge id for a member of
+// classroom ("" for none). Challenges of sources assigned to other
+// classrooms are not found.
+func (c *Catalog) Content(id, classroom string) (*Content, error) {
+	lib, ok := c.library(id, classroom)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return lib.Content(id)
+}
+
+// Asset returns an asset of challenge id for a member of classroom.
+func (c *Catalog) Asset(id, classroom, name string) (*Asset, error) {
+	lib, ok := c.library(id, classroom)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return lib.Asset(id, name)
+}
+
+// Faults returns the faults challenge id injects for a member of classroom.
+func (c *Catalog) Faults(id, classroom string) ([]Fault, error) {
+	lib, ok := c.library(id, classroom)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return lib.Faults(id)
+}
+
+// PreStop returns the pre-stop hook of challenge id for a member of
+// classroom, or "" if it has none.
+func (c *Catalog) PreStop(id, classroom string) (string, error) {
+	lib, ok := c.library(id, classroom)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return lib.PreStop(id)
+}
+
+// Topology returns the lab nodes of challenge id for a member of classroom.
+func (c *Catalog) Topology(id, classroom string) ([]Node, error) {
+	lib, ok := c.library(id, classroom)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return lib.Topology(id)
+}
+
+// Images returns the images the labs of built-in challenges and of every
+// source start, sorted and without duplicates, so hosts can pull them before
+// a learner starts a lab. Libraries that cannot be read are skipped.
+func (c *Catalog) Images() []string {
+	var images []string
+	for name, lib := range c.libraries() {
+		libImages, err := lib.Images()
+		if err != nil {
+			slog.Warn("Failed to list curriculum images", "error", err, "source", name)
+			continue
+		}
+		images = append(images, libImages...)
+	}
+	slices.Sort(images)
+	return slices.Compact(images)
+}
+
+// Builds returns the images built-in challenges and those of every source
+// build from their Dockerfiles. Libraries that cannot be read are skipped.
+func (c *Catalog) Builds() []ImageBuild {
+	var builds []ImageBuild
+	for name, lib := range c.libraries() {
+		libBuilds, err := lib.Builds()
+		if err != nil {
+			slog.Warn("Failed to list curriculum image builds", "error", err, "source", name)
+			continue
+		}
+		builds = append(builds, libBuilds...)
+	}
+	slices.SortFunc(builds, func(a, b ImageBuild) int { return strings.Compare(a.Ref, b.Ref) })
+	return builds
+}
+
+// libraries returns the built-in library and those of every synced source
+// by name.
+func (c *Catalog) libraries() map[string]*Library {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	libs := map[string]*Library{"built-in": c.builtin}
+	for name, s := range c.sources {
+		if s.lib != nil {
+			libs[name] = s.lib
+		}
+	}
+	return libs
+}
+
+// List returns the challenges shown to a member of classroom, sorted by ID.
+func (c *Catalog) List(classroom string) ([]Summary, error) {
+	summaries, err := c.builtin.List()
+	if err != nil {
+		return nil, err
+	}
+	for name, lib := range c.visible(classroom) {
+		sourceSummaries, err := lib.List()
+		if err != nil {
+			slog.Warn("Failed to list curriculum source", "error", err, "source", name)
+			continue
+		}
+		for _, summary := range sourceSummaries {
+			summary.Source = name
+			summaries = append(summaries, summary)
+		}
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].ID < summaries[j].ID })
+	return summaries, nil
+}
+
+// visible returns the libraries of the sources shown to classroom by name.
+func (c *Catalog) visible(classroom string) map[string]*Library {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	libs := make(map[string]*Library)
+	for name, s := range c.sources {
+		if s.lib != nil && s.visibleTo(classroom) {
+			libs[name] = s.lib
+		}
+	}
+	return libs
+}
+
+// normalizeSource validates src and trims its URL and classrooms.
+func normalizeSource(src Source) (Source, error) {
+	if !challengeIDPattern.MatchString(src.Name) || (src.Ref != "" && (!refPattern.MatchString(src.Ref) || strings.Contains(src.Ref, ".."))) {
+		return Source{}, ErrInvalidSource
+	}
+	u, err := url.Parse(strings.TrimSpace(src.URL))
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return Source{}, ErrInvalidSource
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	src.URL = u.String()
+
+	classrooms := make([]string, 0, len(src.Classrooms))
+	for _, classroom := range src.Classrooms {
+		if classroom = strings.TrimSpace(classroom); classroom != "" && !slices.Contains(classrooms, classroom) {
+			classrooms = append(classrooms, classroom)
+		}
+	}
+	if len(classrooms) > maxSourceClassrooms {
+		return Source{}, ErrInvalidSource
+	}
+	src.Classrooms = classrooms
+	return src, nil
+}
+
+// public returns the status as shown to operators, with the password of
+// the URL redacted.
+func (s SourceStatus) public() SourceStatus {
+	if u, err := url.Parse(s.URL); err == nil {
+		s.URL = u.Redacted()
+	}
+	if s.Challenges == nil {
+		s.Challenges = []string{}
+	}
+	return s
+}
@@ -0,0 +1,319 @@
+package curriculum
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"crypto/sha1" //nolint:gosec // Git object IDs are SHA-1.
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// testRepo builds the single-commit packs a fake git server returns.
+type testRepo struct {
+	pack   bytes.Buffer
+	count  uint32
+	offset map[string]int // Offsets of objects, for ofs-deltas
+	last   []byte         // Content of the last blob, as a delta base
+}
+
+func (r *testRepo) add(kind int, data []byte, header []byte) string {
+	if r.offset == nil {
+		r.offset = make(map[string]int)
+	}
+	size := len(data)
+	if header != nil {
+		size = len(header)
+	}
+	offset := r.pack.Len()
+	b := byte(kind<<4) | byte(size&0x0f)
+	size >>= 4
+	for size > 0 {
+		r.pack.WriteByte(b | 0x80)
+		b = byte(size & 0x7f)
+		size >>= 7
+	}
+	r.pack.WriteByte(b)
+	if header != nil {
+		data, header = header, data
+		r.pack.Write(header)
+	}
+	zw := zlib.NewWriter(&r.pack)
+	_, _ = zw.Write(data)
+	_ = zw.Close()
+	r.count++
+	id := objectID(gitObject{kind: kind, data: data})
+	if header == nil {
+		r.offset[id] = offset
+	}
+	return id
+}
+
+func (r *testRepo) blob(content string) string {
+	r.last = []byte(content)
+	return r.add(objBlob, []byte(content), nil)
+}
+
+// deltaBlob stores content as an ofs-delta replacing the first line of the
+// last blob.
+func (r *testRepo) deltaBlob(base, firstLine string) string {
+	baseData := r.last
+	rest := baseData[bytes.IndexByte(baseData, '\n'):]
+	target := append([]byte(firstLine), rest...)
+
+	var delta bytes.Buffer
+	delta.Write(varint(len(baseData)))
+	delta.Write(varint(len(target)))
+	delta.WriteByte(byte(len(firstLine)))
+	delta.WriteString(firstLine)
+	// Copy the rest of the base: offset and size in one byte each.
+	delta.Write([]byte{0x80 | 0x01 | 0x10, byte(len(baseData) - len(rest)), byte(len(rest))})
+
+	offset := r.pack.Len()
+	back := offset - r.offset[base]
+	size := delta.Len()
+	b := byte(objOfsDelta<<4) | byte(size&0x0f)
+	for size >>= 4; size > 0; size >>= 7 {
+		r.pack.WriteByte(b | 0x80)
+		b = byte(size & 0x7f)
+	}
+	r.pack.WriteByte(b)
+	r.pack.Write(ofsVarint(back))
+	zw := zlib.NewWriter(&r.pack)
+	_, _ = zw.Write(delta.Bytes())
+	_ = zw.Close()
+	r.count++
+	return objectID(gitObject{kind: objBlob, data: target})
+}
+
+func (r *testRepo) tree(entries map[string]string, dirs map[string]bool) string {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var data bytes.Buffer
+	for _, name := range names {
+		mode := "100644"
+		if dirs[name] {
+			mode = "40000"
+		}
+		raw, _ := hex.DecodeString(entries[name])
+		fmt.Fprintf(&data, "%s %s\x00", mode, name)
+		data.Write(raw)
+	}
+	return r.add(objTree, data.Bytes(), nil)
+}
+
+func (r *testRepo) commit(tree string) string {
+	return r.add(objCommit, []byte("tree "+tree+"\nauthor t <t@example.com> 0 +0000\n\nmsg\n"), nil)
+}
+
+func (r *testRepo) bytes() []byte {
+	var out bytes.Buffer
+	out.WriteString("PACK")
+	_ = binary.Write(&out, binary.BigEndian, uint32(2))
+	_ = binary.Write(&out, binary.BigEndian, r.count)
+	out.Write(r.pack.Bytes())
+	sum := sha1.Sum(out.Bytes()) //nolint:gosec // Pack checksum.
+	out.Write(sum[:])
+	return out.Bytes()
+}
+
+func varint(n int) []byte {
+	var out []byte
+	for {
+		b := byte(n & 0x7f)
+		n >>= 7
+		if n == 0 {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func ofsVarint(n int) []byte {
+	out := []byte{byte(n & 0x7f)}
+	for n >>= 7; n > 0; n >>= 7 {
+		n--
+		out = append([]byte{byte(0x80 | n&0x7f)}, out...)
+	}
+	return out
+}
+
+// gitServer serves one repository over smart HTTP protocol v2.
+type gitServer struct {
+	mu     sync.Mutex
+	commit string
+	pack   []byte
+	auth   string
+}
+
+func (s *gitServer) set(commit string, pack []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commit, s.pack = commit, pack
+}
+
+func (s *gitServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if user, pass, _ := r.BasicAuth(); user+":"+pass != s.auth {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch r.URL.Path {
+	case "/course.git/info/refs":
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+		_, _ = io.WriteString(w, pktLine("# service=git-upload-pack\n")+"0000"+pktLine("version 2\n")+pktLine("ls-refs\n")+pktLine("fetch=shallow\n")+"0000")
+	case "/course.git/git-upload-pack":
+		body, _ := io.ReadAll(r.Body)
+		if bytes.Contains(body, []byte("command=ls-refs")) {
+			_, _ = io.WriteString(w, pktLine(s.commit+" HEAD symref-target:refs/heads/main\n")+pktLine(s.commit+" refs/heads/main\n")+"0000")
+			return
+		}
+		var out strings.Builder
+		out.WriteString(pktLine("shallow-info\n") + pktLine("shallow "+s.commit+"\n") + "0001" + pktLine("packfile\n"))
+		for pack := s.pack; len(pack) > 0; {
+			n := min(len(pack), 1000)
+			out.WriteString(pktLine("\x01" + string(pack[:n])))
+			pack = pack[n:]
+		}
+		out.WriteString("0000")
+		_, _ = io.WriteString(w, out.String())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// publish builds a commit holding challenges/<id>/content.md for each
+// content, plus a README, and serves it.
+func publish(srv *gitServer, contents map[string]string) string {
+	var repo testRepo
+	challenges := make(map[string]string)
+	dirs := make(map[string]bool)
+	for id, content := range contents {
+		blob := repo.blob(content)
+		challenges[id] = repo.tree(map[string]string{"content.md": blob}, nil)
+		dirs[id] = true
+	}
+	root := repo.tree(map[string]string{
+		"README.md":  repo.blob("readme"),
+		"challenges": repo.tree(challenges, dirs),
+	}, map[string]bool{"challenges": true})
+	commit := repo.commit(root)
+	srv.set(commit, repo.bytes())
+	return commit
+}
+
+func TestCatalogSyncsGitSource(t *testing.T) {
+	srv := &gitServer{auth: "bot:s3cret"}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	builtin := NewLibrary(fstest.MapFS{"first-steps/content.md": {Data: []byte("# First steps")}})
+	dir := t.TempDir()
+	catalog := NewCatalog(builtin, dir, 1<<20)
+	ctx := context.Background()
+
+	v1 := publish(srv, map[string]string{"git-intro": "# Git intro\n\nv1"})
+	url := strings.Replace(ts.URL, "http://", "http://bot:s3cret@", 1) + "/course.git/"
+	status, err := catalog.Register(ctx, Source{Name: "course", URL: url, Classrooms: []string{"cs101"}})
+	if err != nil || status.Error != "" || status.Commit != v1 {
+		t.Fatalf("register: %+v, %v", status, err)
+	}
+	if strings.Contains(status.URL, "s3cret") || strings.Contains(catalog.Sources()[0].URL, "s3cret") {
+		t.Fatalf("credentials not redacted: %s", status.URL)
+	}
+
+	if c, err := catalog.Content("git-intro", "cs101"); err != nil || c.Title != "Git intro" {
+		t.Fatalf("content for classroom: %+v, %v", c, err)
+	}
+	if _, err := catalog.Content("git-intro", "other"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("challenge visible outside its classrooms: %v", err)
+	}
+	if list, _ := catalog.List("cs101"); len(list) != 2 || list[1].Source != "course" {
+		t.Fatalf("list for classroom: %+v", list)
+	}
+	if list, _ := catalog.List(""); len(list) != 1 {
+		t.Fatalf("list outside classroom: %+v", list)
+	}
+
+	// A new commit is picked up; one clashing with a built-in challenge is
+	// rejected and the last good checkout kept.
+	v2 := publish(srv, map[string]string{"git-intro": "# Git intro, revised\n\nv2"})
+	if status, _ := catalog.Sync(ctx, "course"); status.Commit != v2 {
+		t.Fatalf("sync did not update: %+v", status)
+	}
+	publish(srv, map[string]string{"first-steps": "# Hijack"})
+	status, _ = catalog.Sync(ctx, "course")
+	if !strings.Contains(status.Error, "already provided by built-in") || status.Commit != v2 {
+		t.Fatalf("invalid bundle accepted: %+v", status)
+	}
+	if c, _ := catalog.Content("git-intro", "cs101"); c == nil || c.Title != "Git intro, revised" {
+		t.Fatalf("last good checkout not served: %+v", c)
+	}
+
+	// A restart serves the checkout without fetching.
+	ts.Close()
+	reloaded := NewCatalog(builtin, dir, 1<<20)
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := reloaded.Content("git-intro", "cs101"); err != nil || c.Title != "Git intro, revised" {
+		t.Fatalf("reloaded content: %+v, %v", c, err)
+	}
+	if err := reloaded.Remove("course"); err != nil || len(reloaded.Sources()) != 0 {
+		t.Fatalf("remove: %v", err)
+	}
+}
+
+func TestParsePackResolvesDeltas(t *testing.T) {
+	var repo testRepo
+	base := repo.blob("# Old title\nbody\n")
+	changed := repo.deltaBlob(base, "# New title")
+	objects, err := parsePack(repo.bytes(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(objects[changed].data); got != "# New title\nbody\n" {
+		t.Fatalf("delta applied as %q", got)
+	}
+
+	if _, err := parsePack(repo.bytes(), 8); !errors.Is(err, errBundleSize) {
+		t.Fatalf("oversized object accepted: %v", err)
+	}
+	corrupt := repo.bytes()
+	corrupt[20] ^= 0xff
+	if _, err := parsePack(corrupt, 1<<20); !errors.Is(err, errBadPack) {
+		t.Fatalf("corrupt pack accepted: %v", err)
+	}
+}
+
+func TestNormalizeSource(t *testing.T) {
+	valid := Source{Name: "course", URL: "https://git.example.com/org/course.git/", Classrooms: []string{" cs101 ", "cs101", ""}}
+	src, err := normalizeSource(valid)
+	if err != nil || src.URL != "https://git.example.com/org/course.git" || len(src.Classrooms) != 1 {
+		t.Fatalf("normalize: %+v, %v", src, err)
+	}
+	for _, bad := range []Source{
+		{Name: "Course", URL: "https://git.example.com/c.git"},
+		{Name: "course", URL: "file:///srv/course"},
+		{Name: "course", URL: "ssh://git@git.example.com/c.git"},
+		{Name: "course", URL: "https://git.example.com/c.git", Ref: "--upload-pack=x"},
+		{Name: "course", URL: "https://git.example.com/c.git", Ref: "a/../b"},
+	} {
+		if _, err := normalizeSource(bad); !errors.Is(err, ErrInvalidSource) {
+			t.Errorf("accepted %+v", bad)
+		}
+	}
+}
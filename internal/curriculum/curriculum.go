@@ -0,0 +1,188 @@
+// Package curriculum serves lesson content bundled with the server.
+//
+// Each challenge is a directory under challenges/ named after its ID:
+//
+//	challenges/<id>/content.md    lesson text; the first "# " heading is the title
+//	challenges/<id>/assets/...    images and snippets referenced from content.md
+//	challenges/<id>/faults.txt    faults injected into the learner's container on start (optional)
+//	challenges/<id>/topology.txt  containers started as a multi-container lab on start (optional)
+//	challenges/<id>/pre-stop.sh   run as root before the learner's container is stopped (optional)
+//	challenges/<id>/image/...     Dockerfile and build context of the lab's custom image (optional)
+//
+// Markdown is rendered to HTML on the server from a small, safe subset (see
+// Render), so lesson text can live next to the challenge rather than in the
+// SPA build.
+//
+// Troubleshooting lessons list in faults.txt how the learner's environment
+// is broken when they start the challenge, e.g. "corrupt /etc/nginx/nginx.conf"
+// or "kill nginx"; the Fault constants list the kinds.
+//
+// Networking lessons list in topology.txt the containers of a lab, e.g. a
+// client, a web server and a database, which the learner gets on a private
+// network of their own and can open terminals on. A lab that needs a custom
+// environment builds it from the challenge's image/Dockerfile.
+//
+// Lessons that run stateful services, such as a database, shut them down
+// cleanly in pre-stop.sh, which is installed in the learner's container when
+// the challenge starts.
+//
+// A Catalog adds challenges from git repositories registered as sources,
+// laid out the same way, at the repository root or under challenges/. Their
+// content is updated by syncing the source instead of redeploying.
+package curriculum
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sync"
+)
+
+//go:embed all:challenges
+var challengesFS embed.FS
+
+// ErrNotFound is returned for unknown challenges and assets.
+var ErrNotFound = errors.New("curriculum: not found")
+
+// challengeIDPattern bounds challenge IDs to safe directory names.
+var challengeIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+// assetTypes lists the asset extensions that may be served, with their
+// content types. Formats that can carry script (SVG, HTML) are excluded.
+var assetTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".txt":  "text/plain; charset=utf-8",
+	".sh":   "text/plain; charset=utf-8",
+	".md":   "text/plain; charset=utf-8",
+}
+
+// Content is a challenge's rendered lesson text.
+type Content struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	HTML  string `json:"html"`
+	ETag  string `json:"-"`
+}
+
+// Summary describes a challenge in a listing.
+type Summary struct {
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	Source string `json:"source,omitempty"` // Curriculum source serving it; empty for built-in challenges
+}
+
+// Asset is a file bundled with a challenge.
+type Asset struct {
+	Data        []byte
+	ContentType string
+	ETag        string
+}
+
+// Library renders and caches challenge content from a filesystem laid out as
+// described in the package documentation.
+type Library struct {
+	fsys fs.FS
+
+	mu       sync.Mutex
+	rendered map[string]*Content
+}
+
+// NewLibrary creates a library reading challenge directories from the root of fsys.
+func NewLibrary(fsys fs.FS) *Library {
+	return &Library{fsys: fsys, rendered: make(map[string]*Content)}
+}
+
+// Embedded returns a library over the challenges compiled into the binary.
+func Embedded() *Library {
+	sub, err := fs.Sub(challengesFS, "challenges")
+	if err != nil {
+		panic("curriculum: failed to create sub filesystem: " + err.Error())
+	}
+	return NewLibrary(sub)
+}
+
+// Content returns the rendered content of challenge id. Rendering happens
+// once per challenge; later calls return the cached result.
+func (l *Library) Content(id string) (*Content, error) {
+	if !challengeIDPattern.MatchString(id) {
+		return nil, ErrNotFound
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c, ok := l.rendered[id]; ok {
+		return c, nil
+	}
+
+	source, err := fs.ReadFile(l.fsys, path.Join(id, "content.md"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read content for %s: %w", id, err)
+	}
+
+	title, html := Render(string(source), "/api/challenges/"+id+"/assets/")
+	c := &Content{ID: id, Title: title, HTML: html, ETag: etag([]byte(html))}
+	l.rendered[id] = c
+	return c, nil
+}
+
+// List returns the library's challenges sorted by ID. Directories without a
+// content.md are skipped.
+func (l *Library) List() ([]Summary, error) {
+	entries, err := fs.ReadDir(l.fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("read challenges: %w", err)
+	}
+	summaries := make([]Summary, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() || !challengeIDPattern.MatchString(e.Name()) {
+			continue
+		}
+		c, err := l.Content(e.Name())
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, Summary{ID: c.ID, Title: c.Title})
+	}
+	return summaries, nil
+}
+
+// Asset returns the asset at name (relative to the challenge's assets/
+// directory). Only the types in assetTypes are served.
+func (l *Library) Asset(id, name string) (*Asset, error) {
+	if !challengeIDPattern.MatchString(id) || !fs.ValidPath(name) {
+		return nil, ErrNotFound
+	}
+	contentType, ok := assetTypes[path.Ext(name)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	data, err := fs.ReadFile(l.fsys, path.Join(id, "assets", name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read asset %s for %s: %w", name, id, err)
+	}
+	return &Asset{Data: data, ContentType: contentType, ETag: etag(data)}, nil
+}
+
+func etag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
@@ -0,0 +1,241 @@
+package curriculum
+
+import (
+	"errors"
+	"io/fs"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRenderSanitizes(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "raw html escaped", in: `<script>alert(1)</script>`, want: "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{name: "javascript link dropped", in: `[click](javascript:void)`, want: "<p>click</p>\n"},
+		{name: "mixed case scheme dropped", in: `[click](JavaScript:void)`, want: "<p>click</p>\n"},
+		{name: "protocol relative link dropped", in: `[x](//evil.example)`, want: "<p>x</p>\n"},
+		{name: "attribute breakout escaped", in: `[x](https://a.example/"onmouseover=alert(1))`, want: `<p><a href="https://a.example/&#34;onmouseover=alert(1" target="_blank" rel="noopener noreferrer">x</a>)</p>` + "\n"},
+		{name: "remote image dropped", in: `![tracker](https://evil.example/p.png)`, want: "<p>tracker</p>\n"},
+		{name: "asset image rewritten", in: `![diagram](assets/tree.png)`, want: `<p><img src="/a/tree.png" alt="diagram" loading="lazy"></p>` + "\n"},
+		{name: "asset traversal dropped", in: `![x](assets/../../secret.png)`, want: "<p>x</p>\n"},
+		{name: "code is not formatted", in: "`**x** <b>`", want: "<p><code>**x** &lt;b&gt;</code></p>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, got := Render(tt.in, "/a/"); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderBlocks(t *testing.T) {
+	title, got := Render("# Title\n\nSome *text*\nwrapped.\n\n- one\n- **two**\n\n1. first\n\n```bash\necho <hi>\n```\n> quoted\n> more", "/a/")
+	if title != "Title" {
+		t.Fatalf("title = %q", title)
+	}
+	want := "<h1>Title</h1>\n" +
+		"<p>Some <em>text</em> wrapped.</p>\n" +
+		"<ul>\n<li>one</li>\n<li><strong>two</strong></li>\n</ul>\n" +
+		"<ol>\n<li>first</li>\n</ol>\n" +
+		"<pre><code class=\"language-bash\">echo &lt;hi&gt;</code></pre>\n" +
+		"<blockquote><p>quoted more</p></blockquote>\n"
+	if got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLibrary(t *testing.T) {
+	lib := NewLibrary(fstest.MapFS{
+		"intro/content.md":       {Data: []byte("# Intro\n\n[sheet](assets/sheet.txt)")},
+		"intro/assets/sheet.txt": {Data: []byte("ls")},
+		"intro/assets/page.html": {Data: []byte("<script></script>")},
+	})
+
+	content, err := lib.Content("intro")
+	if err != nil {
+		t.Fatalf("content: %v", err)
+	}
+	if content.Title != "Intro" || !strings.Contains(content.HTML, `href="/api/challenges/intro/assets/sheet.txt"`) || content.ETag == "" {
+		t.Fatalf("unexpected content: %+v", content)
+	}
+
+	if _, err := lib.Content("../etc"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found for invalid id, got %v", err)
+	}
+	if _, err := lib.Content("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found for missing challenge, got %v", err)
+	}
+
+	asset, err := lib.Asset("intro", "sheet.txt")
+	if err != nil || string(asset.Data) != "ls" || !strings.HasPrefix(asset.ContentType, "text/plain") {
+		t.Fatalf("unexpected asset %+v: %v", asset, err)
+	}
+	for _, name := range []string{"page.html", "../content.md", "missing.txt"} {
+		if _, err := lib.Asset("intro", name); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected %s to be refused, got %v", name, err)
+		}
+	}
+}
+
+func TestParseFaults(t *testing.T) {
+	faults, err := ParseFaults([]byte(`# Break the web server
+corrupt /etc/nginx/nginx.conf
+kill nginx
+
+fill-disk /var/log/big 200M
+run echo 'broken' > /tmp/state
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	script := FaultScript(faults)
+	for _, want := range []string{
+		"set -e\n",
+		`>> '/etc/nginx/nginx.conf'`,
+		"pkill -x -- 'nginx' || true",
+		"fallocate -l 200M '/var/log/big'",
+		"echo 'broken' > /tmp/state\n",
+	} {
+		if !strings.Contains(script, want) {
+			t.Fatalf("script lacks %q:\n%s", want, script)
+		}
+	}
+
+	for _, bad := range []string{"reboot now", "fill-disk /tmp/x lots", "chmod rwx /etc/passwd", "kill", "run"} {
+		if _, err := ParseFaults([]byte(bad)); !errors.Is(err, ErrInvalidFaults) {
+			t.Fatalf("expected %q to be refused, got %v", bad, err)
+		}
+	}
+}
+
+func TestParseTopology(t *testing.T) {
+	nodes, err := ParseTopology([]byte(`# Client, web server and database
+client playground:latest
+web    nginx:1.27-alpine
+
+db     postgres:16-alpine POSTGRES_PASSWORD=lab POSTGRES_DB=shop
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(nodes) != 3 || nodes[1].Name != "web" || nodes[1].Image != "nginx:1.27-alpine" || nodes[1].Env != nil ||
+		len(nodes[2].Env) != 2 || nodes[2].Env[0] != "POSTGRES_PASSWORD=lab" {
+		t.Fatalf("unexpected nodes %+v", nodes)
+	}
+
+	for _, bad := range []string{"web", "Web nginx", "web nginx\nweb httpd", "db postgres PASSWORD", "a x\nb x\nc x\nd x\ne x\nf x\ng x"} {
+		if _, err := ParseTopology([]byte(bad)); !errors.Is(err, ErrInvalidTopology) {
+			t.Fatalf("expected %q to be refused, got %v", bad, err)
+		}
+	}
+}
+
+func TestLibraryImages(t *testing.T) {
+	lib := NewLibrary(fstest.MapFS{
+		"dns/content.md":    {Data: []byte("# DNS")},
+		"dns/topology.txt":  {Data: []byte("client playground:latest\nresolver coredns/coredns:1.11\n")},
+		"web/content.md":    {Data: []byte("# Web")},
+		"web/topology.txt":  {Data: []byte("client playground:latest\nweb nginx:1.27-alpine\n")},
+		"basics/content.md": {Data: []byte("# Basics")},
+	})
+	images, err := lib.Images()
+	if err != nil {
+		t.Fatalf("images: %v", err)
+	}
+	if want := []string{"coredns/coredns:1.11", "nginx:1.27-alpine", "playground:latest"}; !slices.Equal(images, want) {
+		t.Fatalf("expected %v, got %v", want, images)
+	}
+}
+
+func TestLibraryBuildsChallengeImages(t *testing.T) {
+	lib := NewLibrary(fstest.MapFS{
+		"web/content.md":            {Data: []byte("# Web")},
+		"web/topology.txt":          {Data: []byte("client playground:latest\nweb Dockerfile\n")},
+		"web/image/Dockerfile":      {Data: []byte("FROM nginx:1.27-alpine\nCOPY site /usr/share/nginx/html\n")},
+		"web/image/site/index.html": {Data: []byte("<h1>lab</h1>")},
+	})
+
+	nodes, err := lib.Topology("web")
+	if err != nil {
+		t.Fatalf("topology: %v", err)
+	}
+	if nodes[1].Image != LabImageRef("web") || !nodes[1].Build || nodes[0].Build {
+		t.Fatalf("expected the web node to run the built image, got %+v", nodes)
+	}
+	// Built images are not pulled.
+	if images, err := lib.Images(); err != nil || !slices.Equal(images, []string{"playground:latest"}) {
+		t.Fatalf("expected only pulled images, got %v %v", images, err)
+	}
+
+	noImage := NewLibrary(fstest.MapFS{
+		"dns/content.md":   {Data: []byte("# DNS")},
+		"dns/topology.txt": {Data: []byte("resolver Dockerfile\n")},
+	})
+	if _, err := noImage.Topology("dns"); !errors.Is(err, ErrInvalidTopology) {
+		t.Fatalf("expected a built node without a Dockerfile to be refused, got %v", err)
+	}
+
+	builds, err := lib.Builds()
+	if err != nil {
+		t.Fatalf("builds: %v", err)
+	}
+	if len(builds) != 1 || builds[0].Challenge != "web" || builds[0].Ref != LabImageRef("web") {
+		t.Fatalf("unexpected builds %+v", builds)
+	}
+	if _, err := fs.Stat(builds[0].Context, "site/index.html"); err != nil {
+		t.Fatalf("expected image/ as the build context: %v", err)
+	}
+}
+
+func TestEmbeddedChallengesRender(t *testing.T) {
+	content, err := Embedded().Content("first-steps")
+	if err != nil {
+		t.Fatalf("content: %v", err)
+	}
+	if content.Title == "" {
+		t.Fatal("embedded challenge is missing a title heading")
+	}
+}
+
+func TestLibraryPreStop(t *testing.T) {
+	lib := NewLibrary(fstest.MapFS{
+		"db/content.md":    {Data: []byte("# Databases")},
+		"db/pre-stop.sh":   {Data: []byte("pg_ctl stop -m fast -D '/var/lib/postgresql'\n")},
+		"big/content.md":   {Data: []byte("# Big")},
+		"big/pre-stop.sh":  {Data: make([]byte, maxPreStopHook+1)},
+		"intro/content.md": {Data: []byte("# Intro")},
+	})
+
+	hook, err := lib.PreStop("db")
+	if err != nil || !strings.HasPrefix(hook, "pg_ctl stop") {
+		t.Fatalf("pre-stop: %q, %v", hook, err)
+	}
+	if hook, err := lib.PreStop("intro"); err != nil || hook != "" {
+		t.Fatalf("expected no hook for intro, got %q, %v", hook, err)
+	}
+	if _, err := lib.PreStop("big"); !errors.Is(err, ErrInvalidPreStop) {
+		t.Fatalf("expected an oversized hook to be refused, got %v", err)
+	}
+	if _, err := lib.PreStop("../etc"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected an invalid ID to be refused, got %v", err)
+	}
+
+	script := PreStopInstallScript("db", hook)
+	for _, want := range []string{
+		"install -d -o root -g root -m 0755 /etc/shsh/pre-stop.d\n",
+		"rm -f /etc/shsh/pre-stop.d/challenge-*\n",
+		`printf '%s' 'pg_ctl stop -m fast -D '\''/var/lib/postgresql'\''` + "\n' > '/etc/shsh/pre-stop.d/challenge-db'\n",
+		"chown root:root '/etc/shsh/pre-stop.d/challenge-db'\n",
+		"chmod 0755 '/etc/shsh/pre-stop.d/challenge-db'\n",
+	} {
+		if !strings.Contains(script, want) {
+			t.Fatalf("script lacks %q:\n%s", want, script)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package curriculum
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidFaults is returned for a faults.txt that does not parse.
+var ErrInvalidFaults = errors.New("curriculum: invalid faults")
+
+// Fault kinds a faults.txt line may start with.
+const (
+	FaultCorrupt  = "corrupt"   // corrupt <path>: append a line no config parser accepts
+	FaultFillDisk = "fill-disk" // fill-disk <path> <size>: write a file of size bytes, e.g. 200M
+	FaultKill     = "kill"      // kill <process>: kill processes with that exact name
+	FaultChmod    = "chmod"     // chmod <mode> <path>: change a file's permissions, e.g. 000
+	FaultRemove   = "remove"    // remove <path>: delete a file or directory
+	FaultRun      = "run"       // run <shell command>: anything the kinds above cannot express
+)
+
+var (
+	faultSizePattern = regexp.MustCompile(`^[1-9][0-9]*[KMG]?$`)
+	faultModePattern = regexp.MustCompile(`^[0-7]{3,4}$`)
+)
+
+// corruptLine is appended by corrupt faults. It is fixed so a scenario
+// breaks the same way every time.
+const corruptLine = "<<< shsh: this line was corrupted by the lesson >>>"
+
+// Fault is one way a troubleshooting lesson breaks the learner's
+// environment when the challenge starts.
+type Fault struct {
+	Kind string   `json:"kind"`
+	Args []string `json:"args"`
+}
+
+// ParseFaults parses a faults.txt: one fault per line as a kind followed by
+// its arguments, with blank lines and # comments ignored. The arguments of
+// run are the rest of the line; the other kinds take whitespace-separated
+// arguments.
+func ParseFaults(data []byte) ([]Fault, error) {
+	var faults []Fault
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kind, rest, _ := strings.Cut(line, " ")
+		rest = strings.TrimSpace(rest)
+		fault := Fault{Kind: kind, Args: strings.Fields(rest)}
+		if kind == FaultRun {
+			fault.Args = []string{rest}
+		}
+		if err := fault.validate(); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %w", ErrInvalidFaults, n, err)
+		}
+		faults = append(faults, fault)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidFaults, err)
+	}
+	return faults, nil
+}
+
+func (f Fault) validate() error {
+	switch f.Kind {
+	case FaultCorrupt, FaultKill, FaultRemove:
+		if len(f.Args) != 1 {
+			return fmt.Errorf("%s takes one argument", f.Kind)
+		}
+	case FaultFillDisk:
+		if len(f.Args) != 2 || !faultSizePattern.MatchString(f.Args[1]) {
+			return errors.New("fill-disk takes a path and a size such as 200M")
+		}
+	case FaultChmod:
+		if len(f.Args) != 2 || !faultModePattern.MatchString(f.Args[0]) {
+			return errors.New("chmod takes an octal mode and a path")
+		}
+	case FaultRun:
+		if f.Args[0] == "" {
+			return errors.New("run takes a command")
+		}
+	default:
+		return fmt.Errorf("unknown fault %q", f.Kind)
+	}
+	return nil
+}
+
+// Script returns the shell commands that inject the fault.
+func (f Fault) Script() string {
+	switch f.Kind {
+	case FaultCorrupt:
+		return fmt.Sprintf("printf '\\n%%s\\n' %s >> %s", shellQuote(corruptLine), shellQuote(f.Args[0]))
+	case FaultFillDisk:
+		p, size := shellQuote(f.Args[0]), f.Args[1]
+		return fmt.Sprintf("fallocate -l %s %s 2>/dev/null || head -c %s /dev/zero > %s", size, p, size, p)
+	case FaultKill:
+		// Nothing to kill already leaves the service down.
+		return fmt.Sprintf("pkill -x -- %s || true", shellQuote(f.Args[0]))
+	case FaultChmod:
+		return fmt.Sprintf("chmod %s -- %s", f.Args[0], shellQuote(f.Args[1]))
+	case FaultRemove:
+		return "rm -rf -- " + shellQuote(f.Args[0])
+	default:
+		return f.Args[0]
+	}
+}
+
+// FaultScript returns a shell script injecting faults in order, stopping at
+// the first that fails.
+func FaultScript(faults []Fault) string {
+	var b strings.Builder
+	b.WriteString("set -e\n")
+	for _, f := range faults {
+		b.WriteString(f.Script())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// Faults returns the faults challenge id injects when it starts, or none if
+// it has no faults.txt.
+func (l *Library) Faults(id string) ([]Fault, error) {
+	if !challengeIDPattern.MatchString(id) {
+		return nil, ErrNotFound
+	}
+	data, err := fs.ReadFile(l.fsys, path.Join(id, "faults.txt"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read faults for %s: %w", id, err)
+	}
+	return ParseFaults(data)
+}
+
+// shellQuote quotes s as a single POSIX shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,652 @@
+package curriculum
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"crypto/sha1" //nolint:gosec // Git object IDs are SHA-1.
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// gitUserAgent identifies the client to git servers. Some only speak
+// protocol version 2 to agents starting with "git/".
+const gitUserAgent = "git/shsh-labs"
+
+// maxDeltaDepth bounds chains of deltified objects in a pack.
+const maxDeltaDepth = 1000
+
+// Pack object types.
+const (
+	objCommit   = 1
+	objTree     = 2
+	objBlob     = 3
+	objTag      = 4
+	objOfsDelta = 6
+	objRefDelta = 7
+)
+
+var (
+	errNotSmartHTTP = errors.New("not a git smart HTTP server")
+	errNoProtocolV2 = errors.New("git server does not support protocol version 2")
+	errRefNotFound  = errors.New("ref not found")
+	errBadPack      = errors.New("malformed packfile")
+	errBadDelta     = errors.New("malformed delta")
+	errBundleSize   = errors.New("repository exceeds the size limit")
+)
+
+// gitClient fetches a snapshot of one commit from a git repository over the
+// smart HTTP protocol, version 2: what "git clone --depth 1" transfers, with
+// no history and no git binary. Credentials may be given in the URL.
+type gitClient struct {
+	http     *http.Client
+	maxBytes int64 // Bounds the packfile and the files checked out from it
+}
+
+// Kinds of pkt-lines: data, and the flush, delimiter and response-end
+// packets of protocol v2.
+const (
+	pktData = iota
+	pktFlush
+	pktDelim
+	pktEnd
+)
+
+// pktLine encodes s as a pkt-line.
+func pktLine(s string) string {
+	return fmt.Sprintf("%04x%s", len(s)+4, s)
+}
+
+// readPkt reads one pkt-line and returns its payload and kind.
+func readPkt(r *bufio.Reader) ([]byte, int, error) {
+	var head [4]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, 0, fmt.Errorf("read pkt-line: %w", err)
+	}
+	n, err := strconv.ParseUint(string(head[:]), 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid pkt-line length %q", head)
+	}
+	switch n {
+	case 0:
+		return nil, pktFlush, nil
+	case 1:
+		return nil, pktDelim, nil
+	case 2:
+		return nil, pktEnd, nil
+	case 3:
+		return nil, 0, fmt.Errorf("invalid pkt-line length %q", head)
+	}
+	payload := make([]byte, n-4)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, 0, fmt.Errorf("read pkt-line: %w", err)
+	}
+	return payload, pktData, nil
+}
+
+// command runs a protocol v2 command and returns the response body, which
+// the caller must close.
+func (c *gitClient) command(ctx context.Context, repoURL, name string, args []string) (io.ReadCloser, error) {
+	var body strings.Builder
+	body.WriteString(pktLine("command=" + name + "\n"))
+	body.WriteString("0001")
+	for _, arg := range args {
+		body.WriteString(pktLine(arg + "\n"))
+	}
+	body.WriteString("0000")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, repoURL+"/git-upload-pack", strings.NewReader(body.String()))
+	if err != nil {
+		return nil, fmt.Errorf("build %s request: %w", name, err)
+	}
+	req.Header.Set("Content-Type", "application/x-git-upload-pack-request")
+	req.Header.Set("Accept", "application/x-git-upload-pack-result")
+	req.Header.Set("Git-Protocol", "version=2")
+	req.Header.Set("User-Agent", gitUserAgent)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w", name, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("git %s: %s", name, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// handshake checks that repoURL speaks protocol version 2.
+func (c *gitClient) handshake(ctx context.Context, repoURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, repoURL+"/info/refs?service=git-upload-pack", nil)
+	if err != nil {
+		return fmt.Errorf("build handshake request: %w", err)
+	}
+	req.Header.Set("Git-Protocol", "version=2")
+	req.Header.Set("User-Agent", gitUserAgent)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("git handshake: %w", err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			slog.Debug("Failed to close git handshake response", "error", closeErr)
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("git handshake: %s", resp.Status)
+	}
+	if resp.Header.Get("Content-Type") != "application/x-git-upload-pack-advertisement" {
+		return errNotSmartHTTP
+	}
+
+	r := bufio.NewReader(resp.Body)
+	for {
+		line, kind, err := readPkt(r)
+		if err != nil {
+			return err
+		}
+		switch {
+		case kind != pktData:
+			continue
+		case bytes.HasPrefix(line, []byte("# service=")):
+			continue
+		case string(bytes.TrimSpace(line)) == "version 2":
+			return nil
+		default:
+			return errNoProtocolV2
+		}
+	}
+}
+
+// resolve returns the commit ref points to. An empty ref is the default
+// branch; otherwise branches are tried before tags.
+func (c *gitClient) resolve(ctx context.Context, repoURL, ref string) (string, error) {
+	if err := c.handshake(ctx, repoURL); err != nil {
+		return "", err
+	}
+	body, err := c.command(ctx, repoURL, "ls-refs", []string{"peel", "symrefs", "ref-prefix HEAD", "ref-prefix refs/heads/", "ref-prefix refs/tags/"})
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if closeErr := body.Close(); closeErr != nil {
+			slog.Debug("Failed to close git ls-refs response", "error", closeErr)
+		}
+	}()
+
+	refs := make(map[string]string)
+	r := bufio.NewReader(body)
+	for {
+		line, kind, err := readPkt(r)
+		if err != nil {
+			return "", err
+		}
+		if kind != pktData {
+			break
+		}
+		fields := strings.Fields(string(line))
+		if len(fields) < 2 {
+			continue
+		}
+		oid := fields[0]
+		for _, attr := range fields[2:] {
+			if peeled, ok := strings.CutPrefix(attr, "peeled:"); ok {
+				oid = peeled
+			}
+		}
+		refs[fields[1]] = oid
+	}
+
+	candidates := []string{"HEAD"}
+	if ref != "" {
+		candidates = []string{ref, "refs/heads/" + ref, "refs/tags/" + ref}
+	}
+	for _, name := range candidates {
+		if oid, ok := refs[name]; ok {
+			return oid, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", errRefNotFound, ref)
+}
+
+// fetch downloads commit with its tree and no history, and returns the
+// objects of the pack by ID.
+func (c *gitClient) fetch(ctx context.Context, repoURL, commit string) (map[string]gitObject, error) {
+	body, err := c.command(ctx, repoURL, "fetch", []string{"want " + commit, "deepen 1", "no-progress", "ofs-delta", "done"})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := body.Close(); closeErr != nil {
+			slog.Debug("Failed to close git fetch response", "error", closeErr)
+		}
+	}()
+
+	pack, err := c.readPackfile(bufio.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return parsePack(pack, c.maxBytes)
+}
+
+// readPackfile skips to the packfile section of a fetch response and
+// returns the pack it carries on side-band channel 1.
+func (c *gitClient) readPackfile(r *bufio.Reader) ([]byte, error) {
+	inPack := false
+	var pack bytes.Buffer
+	for {
+		line, kind, err := readPkt(r)
+		if err != nil {
+			return nil, err
+		}
+		if kind == pktFlush || kind == pktEnd {
+			if !inPack {
+				return nil, fmt.Errorf("%w: response has no packfile", errBadPack)
+			}
+			return pack.Bytes(), nil
+		}
+		if kind != pktData {
+			continue
+		}
+		if !inPack {
+			// Section headers and their lines before the packfile, such as
+			// shallow-info, are not needed.
+			inPack = string(line) == "packfile\n"
+			continue
+		}
+		if len(line) == 0 {
+			continue
+		}
+		switch line[0] {
+		case 1:
+			if int64(pack.Len()+len(line)-1) > c.maxBytes {
+				return nil, errBundleSize
+			}
+			pack.Write(line[1:])
+		case 3:
+			return nil, fmt.Errorf("git server error: %s", strings.TrimSpace(string(line[1:])))
+		}
+	}
+}
+
+// gitObject is an object of a pack, with deltas applied.
+type gitObject struct {
+	kind int
+	data []byte
+}
+
+// packEntry is an object as stored in the pack.
+type packEntry struct {
+	kind    int
+	data    []byte // Inflated content, or the delta for deltified objects
+	baseOfs int    // Offset of the base of an ofs-delta
+	baseID  string // ID of the base of a ref-delta
+	object  *gitObject
+	id      string
+	depth   int // Deltas applied to rebuild object
+}
+
+// parsePack reads every object of pack, resolving deltas. Objects larger
+// than maxBytes are rejected, as are packs whose objects add up to more than
+// twice that: a snapshot's files are bounded by maxBytes at checkout, and
+// the rest leaves room for its trees while stopping zlib and delta chains
+// from inflating a small pack without end.
+func parsePack(pack []byte, maxBytes int64) (map[string]gitObject, error) {
+	if len(pack) < 32 || string(pack[:4]) != "PACK" {
+		return nil, errBadPack
+	}
+	sum := sha1.Sum(pack[:len(pack)-20]) //nolint:gosec // Pack checksum.
+	if !bytes.Equal(sum[:], pack[len(pack)-20:]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", errBadPack)
+	}
+	if version := binary.BigEndian.Uint32(pack[4:8]); version != 2 && version != 3 {
+		return nil, fmt.Errorf("%w: version %d", errBadPack, version)
+	}
+	count := binary.BigEndian.Uint32(pack[8:12])
+	body := pack[:len(pack)-20]
+	// Every object takes at least two bytes, so a larger count is a lie
+	// that would only make the maps below allocate for nothing.
+	if int64(count) > int64(len(body)/2) {
+		return nil, fmt.Errorf("%w: %d objects in %d bytes", errBadPack, count, len(body))
+	}
+
+	budget := 2 * maxBytes
+	entries := make(map[int]*packEntry, count)
+	order := make([]int, 0, count)
+	pos := 12
+	for range count {
+		e, next, err := readPackEntry(body, pos, maxBytes)
+		if err != nil {
+			return nil, fmt.Errorf("object at %d: %w", pos, err)
+		}
+		if budget -= int64(len(e.data)); budget < 0 {
+			return nil, errBundleSize
+		}
+		entries[pos] = e
+		order = append(order, pos)
+		pos = next
+	}
+
+	byID := make(map[string]*packEntry, count)
+	for {
+		progress := false
+		pending := 0
+		for _, offset := range order {
+			e := entries[offset]
+			if e.object != nil {
+				continue
+			}
+			if _, err := resolveEntry(e, entries, byID, maxBytes, &budget, 0); err != nil {
+				if errors.Is(err, errRefNotFound) {
+					pending++
+					continue
+				}
+				return nil, err
+			}
+			progress = true
+		}
+		if pending == 0 {
+			break
+		}
+		if !progress {
+			return nil, fmt.Errorf("%w: missing delta base", errBadPack)
+		}
+	}
+
+	objects := make(map[string]gitObject, len(byID))
+	for id, e := range byID {
+		objects[id] = *e.object
+	}
+	return objects, nil
+}
+
+// readPackEntry decodes the object header and content at offset and returns
+// the offset of the next object.
+func readPackEntry(body []byte, offset int, maxBytes int64) (*packEntry, int, error) {
+	pos := offset
+	if pos >= len(body) {
+		return nil, 0, errBadPack
+	}
+	b := body[pos]
+	pos++
+	kind := int(b>>4) & 7
+	size := int64(b & 0x0f)
+	for shift := 4; b&0x80 != 0; shift += 7 {
+		if pos >= len(body) || shift > 56 {
+			return nil, 0, errBadPack
+		}
+		b = body[pos]
+		pos++
+		size |= int64(b&0x7f) << shift
+	}
+	if size > maxBytes {
+		return nil, 0, errBundleSize
+	}
+
+	e := &packEntry{kind: kind}
+	switch kind {
+	case objCommit, objTree, objBlob, objTag:
+	case objOfsDelta:
+		if pos >= len(body) {
+			return nil, 0, errBadPack
+		}
+		b = body[pos]
+		pos++
+		off := int(b & 0x7f)
+		for b&0x80 != 0 {
+			if pos >= len(body) || off > len(body) {
+				return nil, 0, errBadPack
+			}
+			b = body[pos]
+			pos++
+			off = ((off + 1) << 7) | int(b&0x7f)
+		}
+		if off == 0 || off > offset {
+			return nil, 0, errBadPack
+		}
+		e.baseOfs = offset - off
+	case objRefDelta:
+		if pos+20 > len(body) {
+			return nil, 0, errBadPack
+		}
+		e.baseID = hex.EncodeToString(body[pos : pos+20])
+		pos += 20
+	default:
+		return nil, 0, fmt.Errorf("%w: object type %d", errBadPack, kind)
+	}
+
+	r := bytes.NewReader(body[pos:])
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", errBadPack, err)
+	}
+	data, err := io.ReadAll(io.LimitReader(zr, size+1))
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", errBadPack, err)
+	}
+	if int64(len(data)) != size {
+		return nil, 0, fmt.Errorf("%w: size mismatch", errBadPack)
+	}
+	e.data = data
+	return e, len(body) - r.Len(), nil
+}
+
+// resolveEntry returns the object of e, applying its delta chain and
+// charging what it rebuilds to budget. It returns errRefNotFound while a
+// ref-delta base has not been resolved yet. Chains are bounded by
+// maxDeltaDepth whether or not their bases were resolved before; depth
+// bounds the recursion.
+func resolveEntry(e *packEntry, entries map[int]*packEntry, byID map[string]*packEntry, maxBytes int64, budget *int64, depth int) (*gitObject, error) {
+	if e.object != nil {
+		return e.object, nil
+	}
+	if depth > maxDeltaDepth {
+		return nil, fmt.Errorf("%w: delta chain too long", errBadPack)
+	}
+
+	var obj gitObject
+	switch e.kind {
+	case objOfsDelta, objRefDelta:
+		var base *packEntry
+		if e.kind == objOfsDelta {
+			base = entries[e.baseOfs]
+		} else {
+			base = byID[e.baseID]
+		}
+		if base == nil {
+			if e.kind == objRefDelta {
+				return nil, errRefNotFound
+			}
+			return nil, fmt.Errorf("%w: missing delta base", errBadPack)
+		}
+		baseObj, err := resolveEntry(base, entries, byID, maxBytes, budget, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if base.depth >= maxDeltaDepth {
+			return nil, fmt.Errorf("%w: delta chain too long", errBadPack)
+		}
+		data, err := applyDelta(baseObj.data, e.data, maxBytes)
+		if err != nil {
+			return nil, err
+		}
+		if *budget -= int64(len(data)); *budget < 0 {
+			return nil, errBundleSize
+		}
+		obj = gitObject{kind: baseObj.kind, data: data}
+		e.depth = base.depth + 1
+	default:
+		obj = gitObject{kind: e.kind, data: e.data}
+	}
+
+	e.object = &obj
+	e.id = objectID(obj)
+	e.data = nil
+	byID[e.id] = e
+	return e.object, nil
+}
+
+// objectID returns the ID git gives obj.
+func objectID(obj gitObject) string {
+	names := map[int]string{objCommit: "commit", objTree: "tree", objBlob: "blob", objTag: "tag"}
+	h := sha1.New() //nolint:gosec // Git object IDs are SHA-1.
+	fmt.Fprintf(h, "%s %d\x00", names[obj.kind], len(obj.data))
+	h.Write(obj.data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// applyDelta rebuilds an object from its base and a git delta. Results
+// larger than maxBytes are rejected.
+func applyDelta(base, delta []byte, maxBytes int64) ([]byte, error) {
+	srcSize, delta, ok := deltaSize(delta)
+	if !ok || srcSize != uint64(len(base)) {
+		return nil, errBadDelta
+	}
+	dstSize, delta, ok := deltaSize(delta)
+	if !ok {
+		return nil, errBadDelta
+	}
+	if dstSize > uint64(maxBytes) {
+		return nil, errBundleSize
+	}
+
+	out := make([]byte, 0, dstSize)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		switch {
+		case op&0x80 != 0:
+			var offset, size uint64
+			for i := range 7 {
+				if op&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, errBadDelta
+				}
+				if i < 4 {
+					offset |= uint64(delta[0]) << (8 * i)
+				} else {
+					size |= uint64(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > uint64(len(base)) || uint64(len(out))+size > dstSize {
+				return nil, errBadDelta
+			}
+			out = append(out, base[offset:offset+size]...)
+		case op != 0:
+			if int(op) > len(delta) || uint64(len(out))+uint64(op) > dstSize {
+				return nil, errBadDelta
+			}
+			out = append(out, delta[:op]...)
+			delta = delta[op:]
+		default:
+			return nil, errBadDelta
+		}
+	}
+	if uint64(len(out)) != dstSize {
+		return nil, errBadDelta
+	}
+	return out, nil
+}
+
+// deltaSize decodes a size at the start of a delta.
+func deltaSize(delta []byte) (uint64, []byte, bool) {
+	var size uint64
+	for i, shift := 0, 0; i < len(delta) && shift < 64; i, shift = i+1, shift+7 {
+		size |= uint64(delta[i]&0x7f) << shift
+		if delta[i]&0x80 == 0 {
+			return size, delta[i+1:], true
+		}
+	}
+	return 0, nil, false
+}
+
+// checkout writes the tree of commit to dst, which must not exist. Only
+// regular files are written; symlinks and submodules are skipped.
+func checkout(objects map[string]gitObject, commit, dst string, maxBytes int64) error {
+	obj, ok := objects[commit]
+	if !ok || obj.kind != objCommit {
+		return fmt.Errorf("%w: commit %s not in pack", errBadPack, commit)
+	}
+	header, _, _ := bytes.Cut(obj.data, []byte("\n\n"))
+	var tree string
+	for _, line := range strings.Split(string(header), "\n") {
+		if id, ok := strings.CutPrefix(line, "tree "); ok {
+			tree = id
+			break
+		}
+	}
+	if tree == "" {
+		return fmt.Errorf("%w: commit %s has no tree", errBadPack, commit)
+	}
+	budget := maxBytes
+	return writeTree(objects, tree, dst, &budget)
+}
+
+// writeTree writes tree and its subtrees to dir.
+func writeTree(objects map[string]gitObject, tree, dir string, budget *int64) error {
+	obj, ok := objects[tree]
+	if !ok || obj.kind != objTree {
+		return fmt.Errorf("%w: tree %s not in pack", errBadPack, tree)
+	}
+	if err := os.Mkdir(dir, 0o750); err != nil {
+		return fmt.Errorf("create %s: %w", dir, err)
+	}
+
+	data := obj.data
+	for len(data) > 0 {
+		mode, rest, ok := bytes.Cut(data, []byte(" "))
+		if !ok {
+			return fmt.Errorf("%w: tree %s", errBadPack, tree)
+		}
+		name, rest, ok := bytes.Cut(rest, []byte{0})
+		if !ok || len(rest) < 20 {
+			return fmt.Errorf("%w: tree %s", errBadPack, tree)
+		}
+		id := hex.EncodeToString(rest[:20])
+		data = rest[20:]
+
+		if !safeTreeName(string(name)) {
+			return fmt.Errorf("%w: unsafe path %q", errBadPack, name)
+		}
+		path := filepath.Join(dir, string(name))
+		switch string(mode) {
+		case "40000":
+			if err := writeTree(objects, id, path, budget); err != nil {
+				return err
+			}
+		case "100644", "100755":
+			blob, ok := objects[id]
+			if !ok || blob.kind != objBlob {
+				return fmt.Errorf("%w: blob %s not in pack", errBadPack, id)
+			}
+			if *budget -= int64(len(blob.data)); *budget < 0 {
+				return errBundleSize
+			}
+			if err := os.WriteFile(path, blob.data, 0o640); err != nil {
+				return fmt.Errorf("write %s: %w", path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// safeTreeName reports whether a tree entry name stays inside its directory.
+func safeTreeName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.EqualFold(name, ".git") &&
+		!strings.ContainsAny(name, `/\`)
+}
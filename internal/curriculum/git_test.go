@@ -0,0 +1,174 @@
+package curriculum
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1" //nolint:gosec // Git object IDs are SHA-1.
+	"encoding/binary"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sealPack puts the header and checksum around body.
+func sealPack(count uint32, body []byte) []byte {
+	var out bytes.Buffer
+	out.WriteString("PACK")
+	_ = binary.Write(&out, binary.BigEndian, uint32(2))
+	_ = binary.Write(&out, binary.BigEndian, count)
+	out.Write(body)
+	sum := sha1.Sum(out.Bytes()) //nolint:gosec // Pack checksum.
+	out.Write(sum[:])
+	return out.Bytes()
+}
+
+// addOfsDelta appends an ofs-delta on the object at baseOffset and returns
+// its offset.
+func addOfsDelta(r *testRepo, baseOffset int, delta []byte) int {
+	offset := r.pack.Len()
+	size := len(delta)
+	b := byte(objOfsDelta<<4) | byte(size&0x0f)
+	for size >>= 4; size > 0; size >>= 7 {
+		r.pack.WriteByte(b | 0x80)
+		b = byte(size & 0x7f)
+	}
+	r.pack.WriteByte(b)
+	r.pack.Write(ofsVarint(offset - baseOffset))
+	zw := zlib.NewWriter(&r.pack)
+	_, _ = zw.Write(delta)
+	_ = zw.Close()
+	r.count++
+	return offset
+}
+
+// copyDelta is a delta rebuilding all of a base of size bytes, at most
+// 0xffff.
+func copyDelta(size int) []byte {
+	delta := append(varint(size), varint(size)...)
+	return append(delta, 0x80|0x10|0x20, byte(size), byte(size>>8))
+}
+
+func TestParsePackRejectsBadCount(t *testing.T) {
+	var r testRepo
+	r.blob("hello\n")
+	body := r.pack.Bytes()
+
+	if _, err := parsePack(sealPack(1<<32-1, body), 1<<20); !errors.Is(err, errBadPack) {
+		t.Fatalf("expected errBadPack for an impossible count, got %v", err)
+	}
+	// More objects than the pack holds runs off its end.
+	if _, err := parsePack(sealPack(2, body), 1<<20); !errors.Is(err, errBadPack) {
+		t.Fatalf("expected errBadPack for a missing object, got %v", err)
+	}
+}
+
+func TestParsePackRejectsTruncated(t *testing.T) {
+	var r testRepo
+	r.blob("hello, world\n")
+	pack := r.bytes()
+
+	if _, err := parsePack(pack[:len(pack)-1], 1<<20); !errors.Is(err, errBadPack) {
+		t.Fatalf("expected errBadPack for a cut checksum, got %v", err)
+	}
+	body := r.pack.Bytes()
+	for _, cut := range []int{1, 2, len(body) / 2, len(body) - 1} {
+		if _, err := parsePack(sealPack(1, body[:cut]), 1<<20); !errors.Is(err, errBadPack) {
+			t.Fatalf("cut at %d: expected errBadPack, got %v", cut, err)
+		}
+	}
+	if _, err := parsePack([]byte("PACK"), 1<<20); !errors.Is(err, errBadPack) {
+		t.Fatalf("expected errBadPack for a bare header, got %v", err)
+	}
+}
+
+func TestParsePackRejectsBadOfsDelta(t *testing.T) {
+	tests := map[string]func(r *testRepo){
+		// Before the start of the pack.
+		"before pack": func(r *testRepo) {
+			addOfsDelta(r, -100, copyDelta(6))
+		},
+		// Into the middle of the blob, where no object starts.
+		"mid object": func(r *testRepo) {
+			r.blob("hello\n")
+			addOfsDelta(r, 13, copyDelta(6))
+		},
+		// A base of another size than the delta expects.
+		"size mismatch": func(r *testRepo) {
+			r.blob("hello\n")
+			addOfsDelta(r, 12, copyDelta(7))
+		},
+	}
+	for name, build := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Offsets in the pack count from its start, after the header.
+			r := testRepo{}
+			r.pack.Write(make([]byte, 12))
+			build(&r)
+			body := r.pack.Bytes()[12:]
+			if _, err := parsePack(sealPack(r.count, body), 1<<20); !errors.Is(err, errBadPack) && !errors.Is(err, errBadDelta) {
+				t.Fatalf("expected a malformed pack, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParsePackLimitsDeltaDepth(t *testing.T) {
+	build := func(depth int) []byte {
+		r := testRepo{}
+		r.pack.Write(make([]byte, 12))
+		offset := r.pack.Len()
+		r.blob("hello\n")
+		for range depth {
+			offset = addOfsDelta(&r, offset, copyDelta(6))
+		}
+		return sealPack(r.count, r.pack.Bytes()[12:])
+	}
+
+	objects, err := parsePack(build(maxDeltaDepth), 1<<20)
+	if err != nil {
+		t.Fatalf("parse pack at the depth limit: %v", err)
+	}
+	if len(objects) != 1 {
+		t.Fatalf("expected every delta to rebuild the one blob, got %d objects", len(objects))
+	}
+	if _, err := parsePack(build(maxDeltaDepth+2), 1<<20); !errors.Is(err, errBadPack) || !strings.Contains(err.Error(), "delta chain too long") {
+		t.Fatalf("expected a too long delta chain, got %v", err)
+	}
+}
+
+func TestParsePackBoundsInflatedSize(t *testing.T) {
+	r := testRepo{}
+	r.pack.Write(make([]byte, 12))
+	offset := r.pack.Len()
+	r.blob(strings.Repeat("x", 1000))
+	for range 10 {
+		offset = addOfsDelta(&r, offset, copyDelta(1000))
+	}
+	pack := sealPack(r.count, r.pack.Bytes()[12:])
+
+	if _, err := parsePack(pack, 4096); !errors.Is(err, errBundleSize) {
+		t.Fatalf("expected deltas rebuilding 11000 bytes to exceed the limit, got %v", err)
+	}
+	if _, err := parsePack(pack, 8192); err != nil {
+		t.Fatalf("parse pack within the limit: %v", err)
+	}
+}
+
+func TestCheckoutRejectsUnsafeTreeNames(t *testing.T) {
+	for _, name := range []string{"..", ".", ".git", ".GIT", "a/b", `a\b`} {
+		t.Run(name, func(t *testing.T) {
+			var r testRepo
+			blob := r.blob("pwned\n")
+			commit := r.commit(r.tree(map[string]string{name: blob}, nil))
+			objects, err := parsePack(r.bytes(), 1<<20)
+			if err != nil {
+				t.Fatalf("parse pack: %v", err)
+			}
+			err = checkout(objects, commit, filepath.Join(t.TempDir(), "src"), 1<<20)
+			if !errors.Is(err, errBadPack) || !strings.Contains(err.Error(), "unsafe path") {
+				t.Fatalf("expected an unsafe path, got %v", err)
+			}
+		})
+	}
+}
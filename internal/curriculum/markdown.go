@@ -0,0 +1,232 @@
+package curriculum
+
+import (
+	"html"
+	"io/fs"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Render converts lesson markdown to HTML and returns the text of its first
+// level-one heading as the title.
+//
+// Only a subset is supported: ATX headings, paragraphs, "-"/"*" and numbered
+// lists, "> " quotes, fenced code blocks, inline code, **bold**, *emphasis*,
+// links and images. Raw HTML is escaped rather than passed through, links
+// are limited to http(s), mailto and relative URLs, and images must be
+// bundled assets, which are rewritten under assetBase. The output is
+// therefore safe to insert into the page without further sanitization.
+func Render(markdown, assetBase string) (title, out string) {
+	r := renderer{assetBase: assetBase}
+	r.render(strings.ReplaceAll(markdown, "\r\n", "\n"))
+	return r.title, r.out.String()
+}
+
+type renderer struct {
+	assetBase string
+	title     string
+	out       strings.Builder
+
+	paragraph []string
+	list      string // "ul", "ol" or "" when no list is open
+}
+
+var (
+	headingPattern      = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	unorderedPattern    = regexp.MustCompile(`^\s*[-*]\s+(.*)$`)
+	orderedPattern      = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	imagePattern        = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+	linkPattern         = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	strongPattern       = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	emphasisPattern     = regexp.MustCompile(`\*([^*\s][^*]*)\*`)
+	codeLanguagePattern = regexp.MustCompile(`^[A-Za-z0-9_+-]{1,32}$`)
+)
+
+func (r *renderer) render(markdown string) {
+	lines := strings.Split(markdown, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			r.flush()
+			i = r.codeBlock(lines, i)
+		case trimmed == "":
+			r.flush()
+		case headingPattern.MatchString(trimmed):
+			r.flush()
+			m := headingPattern.FindStringSubmatch(trimmed)
+			level := strconv.Itoa(len(m[1]))
+			if len(m[1]) == 1 && r.title == "" {
+				r.title = m[2]
+			}
+			r.out.WriteString("<h" + level + ">" + r.inline(m[2]) + "</h" + level + ">\n")
+		case unorderedPattern.MatchString(line):
+			r.listItem("ul", unorderedPattern.FindStringSubmatch(line)[1])
+		case orderedPattern.MatchString(line):
+			r.listItem("ol", orderedPattern.FindStringSubmatch(line)[1])
+		case strings.HasPrefix(trimmed, ">"):
+			r.flush()
+			i = r.blockquote(lines, i)
+		default:
+			r.closeList()
+			r.paragraph = append(r.paragraph, trimmed)
+		}
+	}
+	r.flush()
+}
+
+// codeBlock renders the fenced block starting at lines[start] and returns
+// the index of its closing fence (or the last line if it is unterminated).
+func (r *renderer) codeBlock(lines []string, start int) int {
+	language := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[start]), "```"))
+	end := start + 1
+	for end < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[end]), "```") {
+		end++
+	}
+
+	r.out.WriteString("<pre><code")
+	if codeLanguagePattern.MatchString(language) {
+		r.out.WriteString(` class="language-` + language + `"`)
+	}
+	r.out.WriteString(">")
+	if end > start+1 {
+		r.out.WriteString(html.EscapeString(strings.Join(lines[start+1:min(end, len(lines))], "\n")))
+	}
+	r.out.WriteString("</code></pre>\n")
+	return min(end, len(lines)-1)
+}
+
+// blockquote renders consecutive "> " lines starting at lines[start] as one
+// quote and returns the index of its last line.
+func (r *renderer) blockquote(lines []string, start int) int {
+	var quoted []string
+	end := start
+	for ; end < len(lines); end++ {
+		trimmed := strings.TrimSpace(lines[end])
+		if !strings.HasPrefix(trimmed, ">") {
+			break
+		}
+		quoted = append(quoted, strings.TrimSpace(strings.TrimPrefix(trimmed, ">")))
+	}
+	r.out.WriteString("<blockquote><p>" + r.inline(strings.Join(quoted, " ")) + "</p></blockquote>\n")
+	return end - 1
+}
+
+func (r *renderer) listItem(kind, text string) {
+	r.flushParagraph()
+	if r.list != kind {
+		r.closeList()
+		r.out.WriteString("<" + kind + ">\n")
+		r.list = kind
+	}
+	r.out.WriteString("<li>" + r.inline(text) + "</li>\n")
+}
+
+func (r *renderer) flush() {
+	r.flushParagraph()
+	r.closeList()
+}
+
+func (r *renderer) flushParagraph() {
+	if len(r.paragraph) == 0 {
+		return
+	}
+	r.out.WriteString("<p>" + r.inline(strings.Join(r.paragraph, " ")) + "</p>\n")
+	r.paragraph = nil
+}
+
+func (r *renderer) closeList() {
+	if r.list == "" {
+		return
+	}
+	r.out.WriteString("</" + r.list + ">\n")
+	r.list = ""
+}
+
+// inline renders inline markup. Text is escaped first and markup is applied
+// to the escaped text, so nothing from the source reaches the output as HTML.
+func (r *renderer) inline(text string) string {
+	// Backticks delimit code spans; odd segments are code.
+	segments := strings.Split(text, "`")
+	if len(segments)%2 == 0 {
+		// Unbalanced backtick: treat the last one literally.
+		last := len(segments) - 1
+		segments[last-1] += "`" + segments[last]
+		segments = segments[:last]
+	}
+
+	var b strings.Builder
+	for i, segment := range segments {
+		escaped := html.EscapeString(segment)
+		if i%2 == 1 {
+			b.WriteString("<code>" + escaped + "</code>")
+			continue
+		}
+		escaped = imagePattern.ReplaceAllStringFunc(escaped, r.image)
+		escaped = linkPattern.ReplaceAllStringFunc(escaped, r.link)
+		escaped = strongPattern.ReplaceAllString(escaped, "<strong>$1</strong>")
+		escaped = emphasisPattern.ReplaceAllString(escaped, "<em>$1</em>")
+		b.WriteString(escaped)
+	}
+	return b.String()
+}
+
+// image renders a bundled asset image; anything else becomes its alt text.
+func (r *renderer) image(match string) string {
+	m := imagePattern.FindStringSubmatch(match)
+	alt, src := m[1], html.UnescapeString(m[2])
+	name, ok := assetName(src)
+	if !ok {
+		return alt
+	}
+	return `<img src="` + html.EscapeString(r.assetBase+name) + `" alt="` + alt + `" loading="lazy">`
+}
+
+// link renders a link with an allowed URL; anything else becomes its text.
+// Links into assets/ are rewritten to the served asset URL.
+func (r *renderer) link(match string) string {
+	m := linkPattern.FindStringSubmatch(match)
+	text, href := m[1], html.UnescapeString(m[2])
+	u, err := url.Parse(href)
+	if err != nil {
+		return text
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return `<a href="` + html.EscapeString(href) + `" target="_blank" rel="noopener noreferrer">` + text + `</a>`
+	case "mailto":
+		return `<a href="` + html.EscapeString(href) + `">` + text + `</a>`
+	case "":
+		if u.Host != "" {
+			return text
+		}
+		if strings.HasPrefix(href, "assets/") {
+			name, ok := assetName(href)
+			if !ok {
+				return text
+			}
+			href = r.assetBase + name
+		}
+		return `<a href="` + html.EscapeString(href) + `">` + text + `</a>`
+	default:
+		return text
+	}
+}
+
+// assetName returns the asset path referenced by a relative src such as
+// "assets/diagram.png" or "diagram.png".
+func assetName(src string) (string, bool) {
+	u, err := url.Parse(src)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.RawQuery != "" || strings.HasPrefix(src, "/") {
+		return "", false
+	}
+	name := strings.TrimPrefix(src, "assets/")
+	if !fs.ValidPath(name) {
+		return "", false
+	}
+	return name, true
+}
@@ -0,0 +1,51 @@
+package curriculum
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+)
+
+// preStopDir is where the learner image's shsh-pre-stop runs hooks from. It
+// is owned by root, so only the server can install hooks there.
+const preStopDir = "/etc/shsh/pre-stop.d"
+
+// maxPreStopHook bounds a challenge's pre-stop.sh.
+const maxPreStopHook = 16 * 1024
+
+// ErrInvalidPreStop is returned for a pre-stop.sh that cannot be installed.
+var ErrInvalidPreStop = errors.New("curriculum: invalid pre-stop hook")
+
+// PreStop returns the pre-stop hook of challenge id, a shell script run as
+// root before the learner's container is stopped, or "" if it has none.
+func (l *Library) PreStop(id string) (string, error) {
+	if !challengeIDPattern.MatchString(id) {
+		return "", ErrNotFound
+	}
+	data, err := fs.ReadFile(l.fsys, path.Join(id, "pre-stop.sh"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("read pre-stop hook for %s: %w", id, err)
+	}
+	if len(data) > maxPreStopHook {
+		return "", fmt.Errorf("%w: %s is larger than %d bytes", ErrInvalidPreStop, id, maxPreStopHook)
+	}
+	return string(data), nil
+}
+
+// PreStopInstallScript returns a shell script, run as root, that installs
+// hook as challenge id's pre-stop hook, root-owned and not writable by the
+// learner. It replaces the hook of any challenge started before.
+func PreStopInstallScript(id, hook string) string {
+	file := shellQuote(path.Join(preStopDir, "challenge-"+id))
+	return fmt.Sprintf(`set -e
+install -d -o root -g root -m 0755 %s
+rm -f %s/challenge-*
+printf '%%s' %s > %s
+chown root:root %s
+chmod 0755 %s
+`, preStopDir, preStopDir, shellQuote(hook), file, file, file)
+}
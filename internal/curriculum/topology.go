@@ -0,0 +1,138 @@
+package curriculum
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidTopology is returned for a topology.txt that does not parse.
+var ErrInvalidTopology = errors.New("curriculum: invalid topology")
+
+// maxTopologyNodes bounds the containers one lab starts for each learner.
+const maxTopologyNodes = 6
+
+var (
+	// nodeNamePattern bounds node names, which become host names on the
+	// lab network.
+	nodeNamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]{0,30}$`)
+	nodeEnvPattern  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+)
+
+// Node is one container of a multi-container lab, e.g. the web server of a
+// client, web server and database topology.
+type Node struct {
+	Name  string   `json:"name"`
+	Image string   `json:"image"`
+	Env   []string `json:"env,omitempty"` // KEY=VALUE pairs
+	// Build is set when Image is built from the challenge's Dockerfile
+	// rather than pulled.
+	Build bool `json:"build,omitempty"`
+}
+
+// ParseTopology parses a topology.txt: one node per line as a name, an image
+// and optional KEY=VALUE environment variables, with blank lines and #
+// comments ignored.
+//
+//	client playground:latest
+//	web    nginx:1.27-alpine
+//	db     postgres:16-alpine POSTGRES_PASSWORD=lab
+//
+// The image BuiltImage stands for the image built from the challenge's
+// image/Dockerfile.
+func ParseTopology(data []byte) ([]Node, error) {
+	var nodes []Node
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%w: line %d: a node takes a name and an image", ErrInvalidTopology, n)
+		}
+		node := Node{Name: fields[0], Image: fields[1], Env: fields[2:]}
+		if !nodeNamePattern.MatchString(node.Name) {
+			return nil, fmt.Errorf("%w: line %d: invalid node name %q", ErrInvalidTopology, n, node.Name)
+		}
+		if seen[node.Name] {
+			return nil, fmt.Errorf("%w: line %d: duplicate node %q", ErrInvalidTopology, n, node.Name)
+		}
+		for _, env := range node.Env {
+			if !nodeEnvPattern.MatchString(env) {
+				return nil, fmt.Errorf("%w: line %d: %q is not KEY=VALUE", ErrInvalidTopology, n, env)
+			}
+		}
+		if len(node.Env) == 0 {
+			node.Env = nil
+		}
+		seen[node.Name] = true
+		nodes = append(nodes, node)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidTopology, err)
+	}
+	if len(nodes) > maxTopologyNodes {
+		return nil, fmt.Errorf("%w: %d nodes, at most %d", ErrInvalidTopology, len(nodes), maxTopologyNodes)
+	}
+	return nodes, nil
+}
+
+// Topology returns the nodes challenge id starts as a lab, or none if it has
+// no topology.txt. Nodes of BuiltImage get the challenge's LabImageRef.
+func (l *Library) Topology(id string) ([]Node, error) {
+	if !challengeIDPattern.MatchString(id) {
+		return nil, ErrNotFound
+	}
+	data, err := fs.ReadFile(l.fsys, path.Join(id, "topology.txt"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read topology for %s: %w", id, err)
+	}
+	nodes, err := ParseTopology(data)
+	if err != nil {
+		return nil, err
+	}
+	for i, node := range nodes {
+		if node.Image != BuiltImage {
+			continue
+		}
+		if _, ok := l.ImageContext(id); !ok {
+			return nil, fmt.Errorf("%w: node %q uses %s but %s has no %s", ErrInvalidTopology, node.Name, BuiltImage, id, imageDockerfile)
+		}
+		nodes[i].Image, nodes[i].Build = LabImageRef(id), true
+	}
+	return nodes, nil
+}
+
+// Images returns the images the labs of the library's challenges pull,
+// sorted and without duplicates. Images built from Dockerfiles are left out.
+func (l *Library) Images() ([]string, error) {
+	summaries, err := l.List()
+	if err != nil {
+		return nil, err
+	}
+	var images []string
+	for _, summary := range summaries {
+		nodes, err := l.Topology(summary.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			if !node.Build {
+				images = append(images, node.Image)
+			}
+		}
+	}
+	slices.Sort(images)
+	return slices.Compact(images), nil
+}
@@ -4,9 +4,11 @@ import (
 	"time"
 )
 
-// AgentSession stores persisted assistant/session state for a user.
+// AgentSession stores persisted assistant/session state for one of a
+// user's tab sessions.
 type AgentSession struct {
 	UserID            string
+	SessionID         string // Empty for sessions stored before state was kept per tab
 	LastProactiveMsg  *time.Time
 	AttemptCount      int
 	JustSelfCorrected bool
@@ -15,6 +17,14 @@ type AgentSession struct {
 	MessagesJSON      string
 	CreatedAt         time.Time
 	UpdatedAt         time.Time
+	Version           int64 // Stored version when read; 0 for a new session
+}
+
+// ArchivedAgentSession is an agent session moved to the archive when it
+// expired, kept so tutors can review past learner state.
+type ArchivedAgentSession struct {
+	AgentSession
+	ArchivedAt time.Time
 }
 
 // StoredMessage is a serialized chat message entry.
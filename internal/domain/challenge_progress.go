@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"time"
+)
+
+// ChallengeAssignment is a challenge a user has started, with the state
+// needed to resume it after their container is recreated.
+type ChallengeAssignment struct {
+	UserID     string    `json:"-"`
+	Challenge  Challenge `json:"challenge"`
+	HintsUsed  int       `json:"hints_used"` // Challenge.HintIndex, which is not serialized with the challenge
+	AssignedAt time.Time `json:"assigned_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ChallengeAttempt records one check of a learner's work on a challenge
+// step.
+type ChallengeAttempt struct {
+	ID          int64     `json:"id"`
+	UserID      string    `json:"-"`
+	ChallengeID string    `json:"challenge_id"`
+	Step        int       `json:"step"`
+	Passed      bool      `json:"passed"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+// ChallengeCompletion records the first time a user completed a challenge.
+type ChallengeCompletion struct {
+	UserID      string    `json:"-"`
+	ChallengeID string    `json:"challenge_id"`
+	Attempts    int       `json:"attempts"`   // Attempts recorded before completion
+	HintsUsed   int       `json:"hints_used"` // Hints shown before completion
+	CompletedAt time.Time `json:"completed_at"`
+}
@@ -0,0 +1,25 @@
+package domain
+
+import (
+	"time"
+)
+
+// ChallengeCheckpoint records the lab state after a completed challenge step,
+// so the learner can roll back to it.
+type ChallengeCheckpoint struct {
+	UserID      string         `json:"-"`
+	ChallengeID string         `json:"challenge_id"`
+	Step        int            `json:"step"`
+	Snapshot    string         `json:"snapshot"` // Volume holding a copy of the work directory
+	Diff        FilesystemDiff `json:"diff"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+// FilesystemDiff summarizes how a container's filesystem, outside its work
+// volume, differs from its image.
+type FilesystemDiff struct {
+	Added   int      `json:"added"`
+	Changed int      `json:"changed"`
+	Deleted int      `json:"deleted"`
+	Paths   []string `json:"paths,omitempty"` // A sample of the changed paths
+}
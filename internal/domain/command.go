@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"time"
+)
+
+// CommandRecord is an executed terminal command kept in the command history.
+type CommandRecord struct {
+	ID        int64
+	UserID    string
+	SessionID string
+	Sequence  int // Position in the tab session, starting at 1
+	Command   string
+	PWD       string
+	ExitCode  int // -1 when the shell did not report an exit code
+	Duration  time.Duration
+	StartedAt time.Time
+	EndedAt   time.Time
+}
+
+// DailyCommandStats summarizes a user's commands on one UTC day, for progress
+// dashboards.
+type DailyCommandStats struct {
+	UserID        string  `json:"user_id"`
+	Day           string  `json:"day"` // YYYY-MM-DD
+	Commands      int     `json:"commands"`
+	Errors        int     `json:"errors"`     // Commands that exited non-zero
+	ErrorRate     float64 `json:"error_rate"` // Errors / Commands
+	DistinctTools int     `json:"distinct_tools"`
+}
+
+// NewDailyCommandStats builds a day's stats and derives the error rate.
+func NewDailyCommandStats(userID, day string, commands, errors, tools int) *DailyCommandStats {
+	s := &DailyCommandStats{
+		UserID:        userID,
+		Day:           day,
+		Commands:      commands,
+		Errors:        errors,
+		DistinctTools: tools,
+	}
+	if commands > 0 {
+		s.ErrorRate = float64(errors) / float64(commands)
+	}
+	return s
+}
@@ -0,0 +1,38 @@
+package domain
+
+import "time"
+
+// ContainerEventType is a container lifecycle transition.
+type ContainerEventType string
+
+const (
+	// ContainerEventCreate means a new container was created.
+	ContainerEventCreate ContainerEventType = "create"
+	// ContainerEventStart means a container was started, restarted or
+	// unpaused.
+	ContainerEventStart ContainerEventType = "start"
+	// ContainerEventStop means a container was stopped and removed.
+	ContainerEventStop ContainerEventType = "stop"
+	// ContainerEventExpire means the TTL worker found the session idle past
+	// its TTL; a stop, or a pause when sessions are paused on expiry, follows.
+	ContainerEventExpire ContainerEventType = "expire"
+	// ContainerEventPause means a container was frozen; a start follows when
+	// it is resumed.
+	ContainerEventPause ContainerEventType = "pause"
+	// ContainerEventSudoGrant means the learner was given root in the
+	// container for a limited time; the reason is the challenge ID.
+	ContainerEventSudoGrant ContainerEventType = "sudo_grant"
+	// ContainerEventSudoRevoke means a sudo grant ended.
+	ContainerEventSudoRevoke ContainerEventType = "sudo_revoke"
+)
+
+// ContainerEvent is an entry in a user's container audit log, kept to debug
+// reports of containers disappearing.
+type ContainerEvent struct {
+	ID          int64              `json:"id"`
+	UserID      string             `json:"-"`
+	ContainerID string             `json:"container_id"`
+	Event       ContainerEventType `json:"event"`
+	Reason      string             `json:"reason,omitempty"` // Why it happened, e.g. "provision", "ttl" or "user_destroy"
+	CreatedAt   time.Time          `json:"created_at"`
+}
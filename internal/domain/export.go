@@ -0,0 +1,116 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// UserDataExport bundles everything stored about a user, for data access
+// requests.
+type UserDataExport struct {
+	ExportedAt    time.Time            `json:"exported_at"`
+	User          *User                `json:"user"`
+	AgentSessions []AgentSessionExport `json:"agent_sessions"` // Most recently updated first
+	Commands      []CommandExport      `json:"commands"`       // Oldest first
+
+	ArchivedSessions []ArchivedSessionExport `json:"archived_sessions,omitempty"` // Newest first
+}
+
+// AgentSessionExport is the exported form of an AgentSession.
+type AgentSessionExport struct {
+	SessionID         string          `json:"session_id"`
+	LastProactiveMsg  *time.Time      `json:"last_proactive_msg,omitempty"`
+	AttemptCount      int             `json:"attempt_count"`
+	JustSelfCorrected bool            `json:"just_self_corrected"`
+	Challenge         json.RawMessage `json:"challenge,omitempty"`
+	Messages          json.RawMessage `json:"messages"`
+	CreatedAt         time.Time       `json:"created_at"`
+	UpdatedAt         time.Time       `json:"updated_at"`
+}
+
+// ArchivedSessionExport is the exported form of an ArchivedAgentSession.
+type ArchivedSessionExport struct {
+	ArchivedAt time.Time `json:"archived_at"`
+	AgentSessionExport
+}
+
+// NewAgentSessionExport converts a stored agent session to its exported form.
+func NewAgentSessionExport(session *AgentSession) *AgentSessionExport {
+	export := &AgentSessionExport{
+		SessionID:         session.SessionID,
+		LastProactiveMsg:  session.LastProactiveMsg,
+		AttemptCount:      session.AttemptCount,
+		JustSelfCorrected: session.JustSelfCorrected,
+		Messages:          rawJSON(session.MessagesJSON),
+		CreatedAt:         session.CreatedAt,
+		UpdatedAt:         session.UpdatedAt,
+	}
+	if session.ChallengeJSON != nil {
+		export.Challenge = rawJSON(*session.ChallengeJSON)
+	}
+	return export
+}
+
+// NewArchivedSessionExports converts archived sessions to their exported form.
+func NewArchivedSessionExports(sessions []*ArchivedAgentSession) []ArchivedSessionExport {
+	exports := make([]ArchivedSessionExport, 0, len(sessions))
+	for _, s := range sessions {
+		exports = append(exports, ArchivedSessionExport{
+			ArchivedAt:         s.ArchivedAt,
+			AgentSessionExport: *NewAgentSessionExport(&s.AgentSession),
+		})
+	}
+	return exports
+}
+
+// CommandExport is the exported form of a CommandRecord.
+type CommandExport struct {
+	SessionID  string    `json:"session_id"`
+	Sequence   int       `json:"sequence"`
+	Command    string    `json:"command"`
+	PWD        string    `json:"pwd,omitempty"`
+	ExitCode   int       `json:"exit_code"`
+	DurationMs int64     `json:"duration_ms"`
+	StartedAt  time.Time `json:"started_at"`
+	EndedAt    time.Time `json:"ended_at"`
+}
+
+// NewUserDataExport builds an export from a user's records. Commands are
+// expected newest first, as repositories list them.
+func NewUserDataExport(user *User, sessions []*AgentSession, commands []*CommandRecord, now time.Time) *UserDataExport {
+	export := &UserDataExport{
+		ExportedAt:    now,
+		User:          user,
+		AgentSessions: make([]AgentSessionExport, 0, len(sessions)),
+		Commands:      make([]CommandExport, 0, len(commands)),
+	}
+	for _, session := range sessions {
+		export.AgentSessions = append(export.AgentSessions, *NewAgentSessionExport(session))
+	}
+	for i := len(commands) - 1; i >= 0; i-- {
+		c := commands[i]
+		export.Commands = append(export.Commands, CommandExport{
+			SessionID:  c.SessionID,
+			Sequence:   c.Sequence,
+			Command:    c.Command,
+			PWD:        c.PWD,
+			ExitCode:   c.ExitCode,
+			DurationMs: c.Duration.Milliseconds(),
+			StartedAt:  c.StartedAt,
+			EndedAt:    c.EndedAt,
+		})
+	}
+	return export
+}
+
+// rawJSON embeds stored JSON as is, or as a JSON string if it is not valid.
+func rawJSON(s string) json.RawMessage {
+	if s == "" {
+		return nil
+	}
+	if json.Valid([]byte(s)) {
+		return json.RawMessage(s)
+	}
+	quoted, _ := json.Marshal(s)
+	return quoted
+}
@@ -0,0 +1,65 @@
+package domain
+
+import "time"
+
+// InterventionOutcome is what a learner did after a proactive hint, judged by
+// the next command they ran in the same tab session.
+type InterventionOutcome string
+
+const (
+	// InterventionResolved means the next command succeeded.
+	InterventionResolved InterventionOutcome = "resolved"
+	// InterventionRepeated means the learner reran the command the hint was
+	// about and it failed again.
+	InterventionRepeated InterventionOutcome = "repeated"
+	// InterventionFailed means the next command failed in another way.
+	InterventionFailed InterventionOutcome = "failed"
+	// InterventionNoFollowUp means the terminal closed before another
+	// command ran, or the shell did not report the next exit code.
+	InterventionNoFollowUp InterventionOutcome = "no_follow_up"
+)
+
+// Intervention records one proactive hint and its outcome.
+type Intervention struct {
+	UserID       string
+	SessionID    string
+	ResponseType string // Agent response type, e.g. "pattern" or "llm"
+	Pattern      string // Pattern that triggered the hint; empty for LLM hints
+	Outcome      InterventionOutcome
+	HintedAt     time.Time
+	ResolvedAt   time.Time
+}
+
+// InterventionStats summarizes the outcomes of one kind of hint, so
+// curriculum authors can see which hints help.
+type InterventionStats struct {
+	ResponseType string  `json:"response_type"`
+	Pattern      string  `json:"pattern"`
+	Hints        int     `json:"hints"`
+	Resolved     int     `json:"resolved"`
+	Repeated     int     `json:"repeated"`
+	Failed       int     `json:"failed"`
+	NoFollowUp   int     `json:"no_follow_up"`
+	SuccessRate  float64 `json:"success_rate"` // Resolved / hints with a follow-up command
+	RepeatRate   float64 `json:"repeat_rate"`  // Repeated / hints with a follow-up command
+}
+
+// NewInterventionStats builds a hint's stats from its outcome counts and
+// derives the rates.
+func NewInterventionStats(responseType, pattern string, counts map[InterventionOutcome]int) *InterventionStats {
+	s := &InterventionStats{
+		ResponseType: responseType,
+		Pattern:      pattern,
+		Resolved:     counts[InterventionResolved],
+		Repeated:     counts[InterventionRepeated],
+		Failed:       counts[InterventionFailed],
+		NoFollowUp:   counts[InterventionNoFollowUp],
+	}
+	followedUp := s.Resolved + s.Repeated + s.Failed
+	s.Hints = followedUp + s.NoFollowUp
+	if followedUp > 0 {
+		s.SuccessRate = float64(s.Resolved) / float64(followedUp)
+		s.RepeatRate = float64(s.Repeated) / float64(followedUp)
+	}
+	return s
+}
@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"time"
+)
+
+// NotificationKind categorizes a persisted notification.
+type NotificationKind string
+
+const (
+	// NotificationProactiveHint is a tutor hint the learner has not seen yet.
+	NotificationProactiveHint NotificationKind = "proactive_hint"
+	// NotificationAlert is a safety warning about a command.
+	NotificationAlert NotificationKind = "alert"
+	// NotificationSystem is a message from the platform, e.g. an announcement.
+	NotificationSystem NotificationKind = "system"
+	// NotificationAchievement announces an achievement award.
+	NotificationAchievement NotificationKind = "achievement"
+)
+
+// Notification is a message kept for a user until they mark it read.
+type Notification struct {
+	ID        int64            `json:"id"`
+	UserID    string           `json:"-"`
+	Kind      NotificationKind `json:"kind"`
+	Title     string           `json:"title,omitempty"`
+	Body      string           `json:"body"`
+	CreatedAt time.Time        `json:"created_at"`
+	ReadAt    *time.Time       `json:"read_at,omitempty"`
+}
+
+// IsRead returns true if the notification has been marked read.
+func (n *Notification) IsRead() bool {
+	return n.ReadAt != nil
+}
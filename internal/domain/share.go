@@ -0,0 +1,141 @@
+package domain
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Placeholders substituted into shared transcripts.
+const (
+	redacted           = "[REDACTED]"
+	anonymousLearner   = "learner"
+	anonymousContainer = "container"
+)
+
+// SessionShare is a public, read-only link to a sanitized transcript of one
+// of a user's finished tab sessions. The transcript is captured when the
+// link is created, so later activity in the session is never exposed.
+type SessionShare struct {
+	Token      string    `json:"token"`
+	UserID     string    `json:"-"`
+	SessionID  string    `json:"session_id"`
+	Transcript string    `json:"-"` // JSON of the SharedTranscript
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Expired reports whether the link stopped working at or before now.
+func (s *SessionShare) Expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
+
+// SharedTranscript is what a share link shows: the session's commands and
+// assistant conversation with secrets redacted and the learner anonymized.
+// Commands carry offsets from the first command rather than timestamps.
+type SharedTranscript struct {
+	Challenge string          `json:"challenge,omitempty"` // Title of the challenge being worked on
+	Commands  []SharedCommand `json:"commands"`            // Oldest first
+	Messages  []StoredMessage `json:"messages"`
+}
+
+// SharedCommand is the shared form of a CommandRecord.
+type SharedCommand struct {
+	Sequence   int    `json:"sequence"`
+	Command    string `json:"command"`
+	PWD        string `json:"pwd,omitempty"`
+	ExitCode   int    `json:"exit_code"`
+	DurationMs int64  `json:"duration_ms"`
+	OffsetMs   int64  `json:"offset_ms"`
+}
+
+// secretPatterns match credentials commonly typed into a shell or pasted
+// into a chat. Each match is rewritten with its replacement template.
+var secretPatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?(-----END [A-Z ]*PRIVATE KEY-----|$)`), redacted},
+	{regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@]+:)[^@\s/]+@`), "${1}" + redacted + "@"},
+	{regexp.MustCompile(`(?i)(\bbearer\s+)[A-Za-z0-9._~+/=-]+`), "${1}" + redacted},
+	{regexp.MustCompile(`(?i)(--(?:password|passwd|token|secret|api-key|access-key)[= ])("[^"]*"|'[^']*'|\S+)`), "${1}" + redacted},
+	{regexp.MustCompile(`(?i)(\b[A-Z0-9_.-]*(?:password|passwd|secret|token|api[_-]?key|access[_-]?key|private[_-]?key)[A-Z0-9_.-]*["']?\s*[=:]\s*)("[^"]*"|'[^']*'|[^\s"']+)`), "${1}" + redacted},
+	{regexp.MustCompile(`\b(?:AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36,}|xox[abprs]-[A-Za-z0-9-]{10,}|sk-[A-Za-z0-9_-]{20,})\b`), redacted},
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`), redacted},
+	{regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "[EMAIL]"},
+}
+
+// transcriptSanitizer redacts secrets and replaces a user's identifiers.
+type transcriptSanitizer struct {
+	identity *strings.Replacer
+}
+
+func newTranscriptSanitizer(user *User) *transcriptSanitizer {
+	var pairs []string
+	if user.ContainerID != "" {
+		pairs = append(pairs, user.ContainerID, anonymousContainer)
+		// Docker uses the short container ID as the hostname shown in prompts.
+		if len(user.ContainerID) > 12 {
+			pairs = append(pairs, user.ContainerID[:12], anonymousContainer)
+		}
+	}
+	for _, id := range []string{user.UserID, user.Username} {
+		// Very short names would mangle ordinary words.
+		if len(id) >= 3 {
+			pairs = append(pairs, id, anonymousLearner)
+		}
+	}
+	return &transcriptSanitizer{identity: strings.NewReplacer(pairs...)}
+}
+
+func (s *transcriptSanitizer) clean(text string) string {
+	for _, p := range secretPatterns {
+		text = p.re.ReplaceAllString(text, p.repl)
+	}
+	return s.identity.Replace(text)
+}
+
+// NewSharedTranscript builds the sanitized transcript of a tab session from
+// its commands, listed newest first as repositories return them, and its
+// agent session, which may be nil.
+func NewSharedTranscript(user *User, commands []*CommandRecord, session *AgentSession) *SharedTranscript {
+	s := newTranscriptSanitizer(user)
+	t := &SharedTranscript{
+		Commands: make([]SharedCommand, 0, len(commands)),
+		Messages: []StoredMessage{},
+	}
+
+	var start time.Time
+	for i := len(commands) - 1; i >= 0; i-- {
+		c := commands[i]
+		if start.IsZero() {
+			start = c.StartedAt
+		}
+		t.Commands = append(t.Commands, SharedCommand{
+			Sequence:   c.Sequence,
+			Command:    s.clean(c.Command),
+			PWD:        s.clean(c.PWD),
+			ExitCode:   c.ExitCode,
+			DurationMs: c.Duration.Milliseconds(),
+			OffsetMs:   c.StartedAt.Sub(start).Milliseconds(),
+		})
+	}
+
+	if session == nil {
+		return t
+	}
+	var messages []StoredMessage
+	if json.Unmarshal([]byte(session.MessagesJSON), &messages) == nil {
+		for _, m := range messages {
+			t.Messages = append(t.Messages, StoredMessage{Role: m.Role, Content: s.clean(m.Content)})
+		}
+	}
+	if session.ChallengeJSON != nil {
+		var challenge Challenge
+		if json.Unmarshal([]byte(*session.ChallengeJSON), &challenge) == nil {
+			t.Challenge = s.clean(challenge.Title)
+		}
+	}
+	return t
+}
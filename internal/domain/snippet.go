@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// snippetPlaceholder matches {{name}} and {{name:default}} in a snippet body.
+var snippetPlaceholder = regexp.MustCompile(`\{\{([a-zA-Z_][a-zA-Z0-9_]*)(?::([^{}\n]*))?\}\}`)
+
+// Snippet is a user-defined block of shell input the server can type into
+// the user's terminal, with placeholders filled in at insertion time.
+type Snippet struct {
+	UserID      string    `json:"-"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Body        string    `json:"body"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// SnippetPlaceholder is a value a snippet asks for when it is inserted.
+type SnippetPlaceholder struct {
+	Name    string `json:"name"`
+	Default string `json:"default,omitempty"`
+	// Required is set when the placeholder has no default.
+	Required bool `json:"required"`
+}
+
+// Placeholders returns the placeholders of the snippet in order of first
+// use. A placeholder used more than once takes its default from the first
+// use that has one.
+func (s *Snippet) Placeholders() []SnippetPlaceholder {
+	var placeholders []SnippetPlaceholder
+	for _, m := range snippetPlaceholder.FindAllStringSubmatchIndex(s.Body, -1) {
+		name := s.Body[m[2]:m[3]]
+		hasDefault := m[4] >= 0
+		i := slices.IndexFunc(placeholders, func(p SnippetPlaceholder) bool { return p.Name == name })
+		if i < 0 {
+			placeholders = append(placeholders, SnippetPlaceholder{Name: name, Required: true})
+			i = len(placeholders) - 1
+		}
+		if hasDefault && placeholders[i].Required {
+			placeholders[i].Default = s.Body[m[4]:m[5]]
+			placeholders[i].Required = false
+		}
+	}
+	return placeholders
+}
+
+// Expand returns the snippet body with its placeholders replaced by values,
+// or by their defaults when values has no entry for them. It fails if a
+// placeholder without a default has no value.
+func (s *Snippet) Expand(values map[string]string) (string, error) {
+	placeholders := s.Placeholders()
+	var missing []string
+	for _, p := range placeholders {
+		if _, ok := values[p.Name]; !ok && p.Required {
+			missing = append(missing, p.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing values for %s", strings.Join(missing, ", "))
+	}
+	return snippetPlaceholder.ReplaceAllStringFunc(s.Body, func(match string) string {
+		name := snippetPlaceholder.FindStringSubmatch(match)[1]
+		if v, ok := values[name]; ok {
+			return v
+		}
+		for _, p := range placeholders {
+			if p.Name == name {
+				return p.Default
+			}
+		}
+		return ""
+	}), nil
+}
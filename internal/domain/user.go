@@ -10,10 +10,19 @@ type User struct {
 	UserID      string    `json:"user_id"`
 	Username    string    `json:"username"`
 	ContainerID string    `json:"container_id,omitempty"`
+	InstanceID  string    `json:"instance_id,omitempty"` // Server instance holding the terminal session
 	LastSeenAt  time.Time `json:"last_seen_at"`
 	VolumePath  string    `json:"volume_path"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+	// KeepWarmUntil exempts the user from TTL cleanup and rate limits, e.g.
+	// while an instructor demos to a class. Zero means no exemption.
+	KeepWarmUntil time.Time `json:"keep_warm_until,omitzero"`
+	// ResourceTier names the resource tier an admin assigned the user's
+	// containers. Empty uses the lab's or the configured default tier.
+	ResourceTier string `json:"resource_tier,omitempty"`
+	// Classroom is the classroom an admin assigned the user to, or empty.
+	Classroom string `json:"classroom,omitempty"`
 }
 
 // HasActiveContainer returns true if the user has a non-empty container ID.
@@ -21,6 +30,11 @@ func (u *User) HasActiveContainer() bool {
 	return u.ContainerID != ""
 }
 
+// IsKeptWarm reports whether the user's keep-warm exemption is in effect at now.
+func (u *User) IsKeptWarm(now time.Time) bool {
+	return now.Before(u.KeepWarmUntil)
+}
+
 // SessionTTL returns the time until the container expires.
 // Returns 0 if the container has already expired.
 func (u *User) SessionTTL(sessionDuration time.Duration) time.Duration {
@@ -0,0 +1,291 @@
+// Package events defines the typed payloads sent to the browser over SSE.
+//
+// Every payload carries a contract version ("v") and its event type
+// ("event"); the SSE event name is the same type, so clients can register one
+// listener per type. The AsyncAPI document in docs/asyncapi.json is generated
+// from these structs:
+//
+//go:generate go run ../../cmd/eventspec -o ../../docs/asyncapi.json
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Version is the payload contract version. Bump it when a field is removed or
+// changes meaning; adding optional fields does not require a bump.
+const Version = 1
+
+// Type names an event. It is used both as the SSE event name and as the
+// "event" field of the payload.
+type Type string
+
+// Event types.
+const (
+	TypeProactiveHint    Type = "proactive_hint"
+	TypeAlert            Type = "alert"
+	TypeSystem           Type = "system"
+	TypeProgress         Type = "progress"
+	TypeChallengeUpdate  Type = "challenge_update"
+	TypeDesktopNotify    Type = "desktop_notification"
+	TypeDemoFrame        Type = "demo_frame"
+	TypeMessagesDropped  Type = "messages_dropped"
+	TypeContainerStats   Type = "container_stats"
+	TypeTerminalActivity Type = "terminal_activity"
+)
+
+// Header is embedded in every payload.
+type Header struct {
+	Version int  `json:"v"`
+	Event   Type `json:"event"`
+}
+
+func (h *Header) header() *Header { return h }
+
+// Payload is implemented by pointers to the payload structs in this package.
+type Payload interface {
+	EventType() Type
+	header() *Header
+}
+
+// ProactiveHint is an unprompted suggestion from the AI tutor.
+type ProactiveHint struct {
+	Header
+	// Kind is the agent response type, e.g. "pattern", "llm" or "recap".
+	Kind    string `json:"type"`
+	Content string `json:"content"`
+	Sidebar string `json:"sidebar,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+	// Truncated is set when Content or Sidebar exceeded the size limit and
+	// was shortened around a marker.
+	Truncated bool `json:"truncated,omitempty"`
+	// CodeBlocks lists the fenced code blocks of the text shown in the
+	// sidebar (Sidebar, or Content when Sidebar is empty).
+	CodeBlocks []CodeBlock `json:"code_blocks,omitempty"`
+	Chunk      *Chunk      `json:"chunk,omitempty"`
+}
+
+// EventType implements Payload.
+func (*ProactiveHint) EventType() Type { return TypeProactiveHint }
+
+// Alert warns the learner about a risky command.
+type Alert struct {
+	Header
+	// Kind is the agent response type, e.g. "alert" or "safety-tier2".
+	Kind           string `json:"type"`
+	Content        string `json:"content"`
+	Sidebar        string `json:"sidebar,omitempty"`
+	Alert          string `json:"alert,omitempty"`
+	Pattern        string `json:"pattern,omitempty"`
+	RequireConfirm bool   `json:"require_confirm"`
+	// Truncated is set when a text field exceeded the size limit and was
+	// shortened around a marker.
+	Truncated bool `json:"truncated,omitempty"`
+	// CodeBlocks lists the fenced code blocks of the text shown in the
+	// sidebar (Sidebar, or Content when Sidebar is empty).
+	CodeBlocks []CodeBlock `json:"code_blocks,omitempty"`
+	Chunk      *Chunk      `json:"chunk,omitempty"`
+}
+
+// EventType implements Payload.
+func (*Alert) EventType() Type { return TypeAlert }
+
+// CodeBlock is a fenced code block in agent text.
+type CodeBlock struct {
+	Language string `json:"language,omitempty"`
+	// Code is the block's text without the fences or a trailing newline.
+	Code string `json:"code"`
+	// Runnable is set for self-contained shell commands the learner may run
+	// in their terminal after confirming; Command is then the text to type.
+	Runnable bool   `json:"runnable,omitempty"`
+	Command  string `json:"command,omitempty"`
+}
+
+// Chunk marks one part of a payload whose text was too long for one event.
+// Parts share ID and arrive in order; concatenating Content (and Sidebar)
+// across all Count parts yields the full text. CodeBlocks is sent only on the
+// last part, other fields repeat on every part, and only the last part
+// carries the SSE event ID.
+type Chunk struct {
+	ID    string `json:"id"`
+	Index int    `json:"index"`
+	Count int    `json:"count"`
+}
+
+// System reports stream state such as a new connection.
+type System struct {
+	Header
+	// Status is "connected" or "error".
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	UserID  string `json:"user_id,omitempty"`
+	EventID int64  `json:"event_id,omitempty"`
+	// Epoch identifies the server's event ID sequence; it changes when IDs
+	// may have restarted. Clients pass it back as the epoch query parameter
+	// so a stale Last-Event-ID is ignored.
+	Epoch string `json:"epoch,omitempty"`
+}
+
+// EventType implements Payload.
+func (*System) EventType() Type { return TypeSystem }
+
+// Progress reports the state of a long-running operation such as provisioning.
+type Progress struct {
+	Header
+	OperationID string `json:"operation_id"`
+	// Status is "provisioning", "ready" or "failed".
+	Status string `json:"status"`
+	// Stage is the latest step reached, e.g. "queued", "pulling_image",
+	// "creating", "starting" or "ready".
+	Stage string `json:"stage,omitempty"`
+	// QueuePosition is the 1-based place in the wait queue while Stage is
+	// "queued" because every host is at capacity.
+	QueuePosition   int    `json:"queue_position,omitempty"`
+	ContainerID     string `json:"container_id,omitempty"`
+	Runtime         string `json:"runtime,omitempty"`
+	RuntimeFallback bool   `json:"runtime_fallback"`
+	Error           string `json:"error,omitempty"`
+}
+
+// EventType implements Payload.
+func (*Progress) EventType() Type { return TypeProgress }
+
+// ChallengeUpdate reports a change in the learner's current challenge.
+type ChallengeUpdate struct {
+	Header
+	ChallengeID string `json:"challenge_id"`
+	Title       string `json:"title,omitempty"`
+	// Status is "started", "hint" or "completed".
+	Status string `json:"status"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+// EventType implements Payload.
+func (*ChallengeUpdate) EventType() Type { return TypeChallengeUpdate }
+
+// DesktopNotify asks the browser to show a desktop notification because
+// something happened in the terminal while its tab was hidden.
+type DesktopNotify struct {
+	Header
+	// Reason is "bell" or "command_finished".
+	Reason string `json:"reason"`
+	Title  string `json:"title"`
+	Body   string `json:"body,omitempty"`
+}
+
+// EventType implements Payload.
+func (*DesktopNotify) EventType() Type { return TypeDesktopNotify }
+
+// DemoFrame carries recorded terminal output while a demo plays back.
+type DemoFrame struct {
+	Header
+	Demo string `json:"demo"`
+	// Step is the index of the demo step the output belongs to.
+	Step int `json:"step"`
+	// Data is the output to write to the read-only pane.
+	Data string `json:"data,omitempty"`
+	// Done is set on the final event, once playback has finished.
+	Done bool `json:"done,omitempty"`
+}
+
+// EventType implements Payload.
+func (*DemoFrame) EventType() Type { return TypeDemoFrame }
+
+// Sources of dropped messages, reported in MessagesDropped.
+const (
+	// DropSourceSidebar messages were dropped before they reached the stream,
+	// so they cannot be replayed.
+	DropSourceSidebar = "sidebar"
+	// DropSourceConnection messages were dropped because this connection fell
+	// behind. They stay in the replay queue until evicted.
+	DropSourceConnection = "connection"
+)
+
+// MessagesDropped marks a gap in the stream: messages meant for the learner
+// were dropped because a queue was full.
+type MessagesDropped struct {
+	Header
+	// Count is the number of messages dropped since the last marker.
+	Count int `json:"count"`
+	// Source is "sidebar" or "connection".
+	Source string `json:"source"`
+}
+
+// EventType implements Payload.
+func (*MessagesDropped) EventType() Type { return TypeMessagesDropped }
+
+// ContainerStats is a sample of the learner's container resource usage.
+type ContainerStats struct {
+	Header
+	// CPUMillicores is the CPU used since the previous sample, in
+	// thousandths of a core.
+	CPUMillicores int64 `json:"cpu_millicores"`
+	// CPULimitMillicores is the container's CPU limit; 0 means unlimited.
+	CPULimitMillicores int64 `json:"cpu_limit_millicores"`
+	// MemoryBytes excludes page cache the kernel can reclaim.
+	MemoryBytes      int64 `json:"memory_bytes"`
+	MemoryLimitBytes int64 `json:"memory_limit_bytes"`
+	Pids             int64 `json:"pids"`
+	// PidsLimit is 0 when the number of processes is unlimited.
+	PidsLimit int64 `json:"pids_limit"`
+}
+
+// EventType implements Payload.
+func (*ContainerStats) EventType() Type { return TypeContainerStats }
+
+// TerminalActivity summarizes what happened in a terminal, for assistive
+// frontends that announce activity instead of rendering ANSI output.
+type TerminalActivity struct {
+	Header
+	// Kind is "command" when a command finished or "prompt" when the shell
+	// is ready for input again.
+	Kind string `json:"kind"`
+	// Sequence is the command's position in the session's history; the
+	// prompt after a command shares its sequence.
+	Sequence int    `json:"seq"`
+	Command  string `json:"command,omitempty"`
+	// Status is "succeeded", "failed" or "unknown"; set on command events.
+	Status string `json:"status,omitempty"`
+	// ExitCode is omitted when the shell did not report one.
+	ExitCode   *int   `json:"exit_code,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+	PWD        string `json:"pwd,omitempty"`
+	// Summary is a short sentence describing the event, ready to be read
+	// out by a screen reader.
+	Summary string `json:"summary"`
+}
+
+// EventType implements Payload.
+func (*TerminalActivity) EventType() Type { return TypeTerminalActivity }
+
+// Marshal stamps p with the contract version and its type and encodes it.
+func Marshal(p Payload) ([]byte, error) {
+	h := p.header()
+	h.Version = Version
+	h.Event = p.EventType()
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("marshal %s event: %w", p.EventType(), err)
+	}
+	return data, nil
+}
+
+// Write writes p as an SSE event named after its type. A positive id is sent
+// as the event ID so clients can resume with Last-Event-ID.
+func Write(w io.Writer, id int64, p Payload) error {
+	data, err := Marshal(p)
+	if err != nil {
+		return err
+	}
+	if id > 0 {
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, p.EventType(), data)
+	} else {
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", p.EventType(), data)
+	}
+	if err != nil {
+		return fmt.Errorf("write %s event: %w", p.EventType(), err)
+	}
+	return nil
+}
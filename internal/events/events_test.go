@@ -0,0 +1,124 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+var exitCode = 2
+
+// samples holds a populated payload for every catalog entry.
+var samples = []Payload{
+	&ProactiveHint{Kind: "pattern", Content: "Try ls -la", Sidebar: "Hidden files start with a dot.", Pattern: "ls"},
+	&Alert{Kind: "safety-tier2", Content: "This deletes files", Alert: "rm -rf", RequireConfirm: true},
+	&System{Status: "connected", UserID: "anon_1", EventID: 7},
+	&Progress{OperationID: "prov_1", Status: "provisioning", Stage: "creating"},
+	&ChallengeUpdate{ChallengeID: "find-files", Status: "hint", Hint: "Use find"},
+	&DesktopNotify{Reason: "command_finished", Title: "Command finished", Body: "make exited with 0 after 42s"},
+	&DemoFrame{Demo: "grep-basics", Step: 1, Data: "$ grep -n main *.go\r\n"},
+	&MessagesDropped{Count: 3, Source: DropSourceSidebar},
+	&ContainerStats{CPUMillicores: 120, CPULimitMillicores: 500, MemoryBytes: 64 << 20, MemoryLimitBytes: 512 << 20, Pids: 12, PidsLimit: 256},
+	&TerminalActivity{Kind: "command", Sequence: 4, Command: "make", Status: "failed", ExitCode: &exitCode, DurationMs: 3200, PWD: "/home/learner", Summary: "make failed with exit code 2 after 3s."},
+}
+
+// validate checks data against the subset of JSON Schema produced by Schema.
+func validate(t *testing.T, schema map[string]any, data []byte) {
+	t.Helper()
+	var obj map[string]any
+	if err := json.Unmarshal(data, &obj); err != nil {
+		t.Fatalf("payload is not an object: %v", err)
+	}
+
+	properties := schema["properties"].(map[string]any)
+	for _, name := range schema["required"].([]string) {
+		if _, ok := obj[name]; !ok {
+			t.Errorf("missing required field %q in %s", name, data)
+		}
+	}
+	for name, value := range obj {
+		prop, ok := properties[name].(map[string]any)
+		if !ok {
+			t.Errorf("field %q is not in the schema", name)
+			continue
+		}
+		var got string
+		switch value.(type) {
+		case string:
+			got = "string"
+		case bool:
+			got = "boolean"
+		case float64:
+			got = "integer"
+		default:
+			got = "object"
+		}
+		if got != prop["type"] {
+			t.Errorf("field %q: got %s, schema says %v", name, got, prop["type"])
+		}
+		if want, ok := prop["const"]; ok {
+			if b, _ := json.Marshal(want); !bytes.Equal(b, mustMarshal(t, value)) {
+				t.Errorf("field %q: got %v, want const %v", name, value, want)
+			}
+		}
+	}
+}
+
+func mustMarshal(t *testing.T, v any) []byte {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return b
+}
+
+func TestPayloadsMatchSchema(t *testing.T) {
+	if len(samples) != len(catalog) {
+		t.Fatalf("expected a sample for each of %d catalog entries, got %d", len(catalog), len(samples))
+	}
+	for _, p := range samples {
+		t.Run(string(p.EventType()), func(t *testing.T) {
+			data, err := Marshal(p)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			validate(t, Schema(p), data)
+		})
+	}
+}
+
+func TestWriteNamesEventAfterType(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, 3, &System{Status: "connected"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	want := "id: 3\nevent: system\ndata: {\"v\":1,\"event\":\"system\",\"status\":\"connected\"}\n\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := Write(&buf, 0, &Progress{OperationID: "op", Status: "ready"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "event: progress\ndata: ") {
+		t.Fatalf("expected progress event without id, got %q", buf.String())
+	}
+}
+
+func TestAsyncAPISpecUpToDate(t *testing.T) {
+	want, err := AsyncAPI()
+	if err != nil {
+		t.Fatalf("generate spec: %v", err)
+	}
+	got, err := os.ReadFile("../../docs/asyncapi.json")
+	if err != nil {
+		t.Fatalf("read spec: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("docs/asyncapi.json is stale; run `go generate ./internal/events`")
+	}
+}
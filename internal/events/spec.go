@@ -0,0 +1,172 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// message describes one event type in the generated spec.
+type message struct {
+	payload Payload
+	summary string
+}
+
+// catalog lists every payload type, in spec order.
+var catalog = []message{
+	{&ProactiveHint{}, "Unprompted suggestion from the AI tutor."},
+	{&Alert{}, "Warning about a risky command; require_confirm asks the learner to confirm intent."},
+	{&System{}, "Stream state, e.g. status \"connected\" with the latest event ID."},
+	{&Progress{}, "Stage change of a long-running operation such as provisioning."},
+	{&ChallengeUpdate{}, "Change in the learner's current challenge."},
+	{&DesktopNotify{}, "Terminal bell or long-running command completion while the tab was hidden."},
+	{&DemoFrame{}, "Recorded output of an instructor demo, replayed with its original timing."},
+	{&MessagesDropped{}, "Gap in the stream: messages were dropped because a queue was full."},
+	{&ContainerStats{}, "Resource usage of the learner's container, sampled about once a second."},
+	{&TerminalActivity{}, "Finished command or new prompt in a terminal, summarized for screen readers."},
+}
+
+// channel is an SSE endpoint and the event types it emits.
+type channel struct {
+	path        string
+	description string
+	types       []Type
+}
+
+var channels = []channel{
+	{
+		path:        "/api/agent/stream",
+		description: "Proactive tutor messages for one terminal session. Events carry IDs; reconnect with Last-Event-ID to replay missed events. A \"ping\" event is sent as a keepalive.",
+		types:       []Type{TypeSystem, TypeProactiveHint, TypeAlert, TypeChallengeUpdate, TypeDesktopNotify, TypeMessagesDropped},
+	},
+	{
+		path:        "/api/provision/events",
+		description: "Progress of the user's provision operation; the stream ends after the final event. A \"ping\" event is sent as a keepalive.",
+		types:       []Type{TypeProgress},
+	},
+	{
+		path:        "/api/demos/{name}/play",
+		description: "Playback of a recorded demo, or of one step of it; the stream ends after an event with done set.",
+		types:       []Type{TypeDemoFrame},
+	},
+	{
+		path:        "/api/container/stats",
+		description: "Live CPU, memory and process usage of the user's container; the stream ends when the container stops. A \"ping\" event is sent as a keepalive.",
+		types:       []Type{TypeContainerStats},
+	},
+	{
+		path:        "/api/terminal/activity",
+		description: "Commands finishing and prompts appearing in one terminal session, as structured events assistive frontends can announce instead of the raw output. A \"ping\" event is sent as a keepalive.",
+		types:       []Type{TypeTerminalActivity},
+	},
+}
+
+// Schema returns the JSON Schema of p's payload.
+func Schema(p Payload) map[string]any {
+	properties := map[string]any{}
+	var required []string
+	addProperties(reflect.TypeOf(p).Elem(), p.EventType(), properties, &required)
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+func addProperties(t reflect.Type, event Type, properties map[string]any, required *[]string) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if field.Anonymous {
+			addProperties(field.Type, event, properties, required)
+			continue
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+
+		property := map[string]any{"type": jsonType(field.Type)}
+		switch name {
+		case "v":
+			property["const"] = Version
+		case "event":
+			property["const"] = string(event)
+		}
+		properties[name] = property
+		if !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Pointer:
+		return jsonType(t.Elem())
+	default:
+		return "object"
+	}
+}
+
+// AsyncAPI returns the AsyncAPI document describing every SSE channel and
+// payload, as indented JSON.
+func AsyncAPI() ([]byte, error) {
+	messages := map[string]any{}
+	schemas := map[string]any{}
+	for _, m := range catalog {
+		name := reflect.TypeOf(m.payload).Elem().Name()
+		messages[string(m.payload.EventType())] = map[string]any{
+			"name":    string(m.payload.EventType()),
+			"summary": m.summary,
+			"payload": map[string]any{"$ref": "#/components/schemas/" + name},
+		}
+		schemas[name] = Schema(m.payload)
+	}
+
+	chans := map[string]any{}
+	for _, c := range channels {
+		refs := make([]any, 0, len(c.types))
+		for _, t := range c.types {
+			refs = append(refs, map[string]any{"$ref": "#/components/messages/" + string(t)})
+		}
+		chans[c.path] = map[string]any{
+			"description": c.description,
+			"subscribe": map[string]any{
+				"message": map[string]any{"oneOf": refs},
+			},
+		}
+	}
+
+	doc := map[string]any{
+		"asyncapi": "2.6.0",
+		"info": map[string]any{
+			"title":       "SHSH Playground events",
+			"version":     fmt.Sprintf("%d", Version),
+			"description": "Server-sent events emitted to the browser. Generated from internal/events; do not edit.",
+		},
+		"defaultContentType": "application/json",
+		"channels":           chans,
+		"components": map[string]any{
+			"messages": messages,
+			"schemas":  schemas,
+		},
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal asyncapi document: %w", err)
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,127 @@
+// Package handoff passes in-memory state from a server shutting down to the
+// process replacing it, so that a deploy disrupts connected learners as
+// little as possible. The state is written to a file on graceful shutdown
+// and consumed by the next start: read once and removed, so a server that
+// crashes before writing a new one never resumes from stale state.
+package handoff
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stateVersion is bumped whenever State changes incompatibly; files of
+// another version are ignored.
+const stateVersion = 1
+
+// ErrStale is returned for a state file older than the maximum age, or
+// written by another instance or state version.
+var ErrStale = errors.New("handoff state is stale")
+
+// State is what one server hands the next.
+type State struct {
+	Version    int       `json:"version"`
+	InstanceID string    `json:"instance_id"`
+	WrittenAt  time.Time `json:"written_at"`
+
+	// Users are the users with a terminal connected at shutdown.
+	Users []ActiveUser `json:"users,omitempty"`
+	// SudoGrants are the temporary root grants still running.
+	SudoGrants []SudoGrant `json:"sudo_grants,omitempty"`
+	// EventStreams are the agent SSE streams' IDs.
+	EventStreams EventStreams `json:"event_streams"`
+}
+
+// ActiveUser is a user with a terminal connected at shutdown and the
+// container it was attached to.
+type ActiveUser struct {
+	UserID      string `json:"user_id"`
+	ContainerID string `json:"container_id"`
+}
+
+// SudoGrant is a learner's temporary root access in a challenge.
+type SudoGrant struct {
+	UserID      string    `json:"user_id"`
+	ChallengeID string    `json:"challenge_id"`
+	ContainerID string    `json:"container_id"`
+	GrantedAt   time.Time `json:"granted_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// EventStreams is the SSE stream epoch and the last event ID handed out in
+// each tab session, so reconnecting tabs keep their Last-Event-ID.
+type EventStreams struct {
+	Epoch    string        `json:"epoch,omitempty"`
+	Sessions []EventIDMark `json:"sessions,omitempty"`
+}
+
+// EventIDMark is the high-water mark of a tab session's event IDs.
+type EventIDMark struct {
+	UserID    string `json:"user_id"`
+	SessionID string `json:"session_id"`
+	LastID    int64  `json:"last_id"`
+}
+
+// Write stores s at path for the next server, replacing the file atomically.
+// The file is readable by the server's user only, as it names users.
+func Write(path string, s *State) error {
+	s.Version = stateVersion
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("encode handoff state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("create handoff directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create handoff file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write handoff file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write handoff file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replace handoff file: %w", err)
+	}
+	return nil
+}
+
+// Consume reads and removes the state at path. It returns nil without a
+// file, and ErrStale for state written more than maxAge before now or by
+// another state version. State of another instance is left for it.
+func Consume(path, instanceID string, maxAge time.Duration, now time.Time) (*State, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read handoff file: %w", err)
+	}
+
+	var s State
+	decodeErr := json.Unmarshal(data, &s)
+	if decodeErr == nil && s.InstanceID != instanceID {
+		return nil, fmt.Errorf("%w: written by instance %q", ErrStale, s.InstanceID)
+	}
+	if err := os.Remove(path); err != nil {
+		return nil, fmt.Errorf("remove handoff file: %w", err)
+	}
+	switch {
+	case decodeErr != nil:
+		return nil, fmt.Errorf("decode handoff state: %w", decodeErr)
+	case s.Version != stateVersion:
+		return nil, fmt.Errorf("%w: version %d", ErrStale, s.Version)
+	case now.Sub(s.WrittenAt) > maxAge:
+		return nil, fmt.Errorf("%w: written %s ago", ErrStale, now.Sub(s.WrittenAt).Round(time.Second))
+	}
+	return &s, nil
+}
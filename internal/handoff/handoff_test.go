@@ -0,0 +1,68 @@
+package handoff
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteThenConsume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "handoff.json")
+	now := time.Unix(1_700_000_000, 0).UTC()
+	state := &State{
+		InstanceID:   "shsh-1",
+		WrittenAt:    now,
+		Users:        []ActiveUser{{UserID: "u1", ContainerID: "c1"}},
+		EventStreams: EventStreams{Epoch: "e1", Sessions: []EventIDMark{{UserID: "u1", SessionID: "tab-1", LastID: 7}}},
+	}
+	if err := Write(path, state); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("expected the file to be private, got %v", perm)
+	}
+
+	got, err := Consume(path, "shsh-1", time.Minute, now.Add(30*time.Second))
+	if err != nil {
+		t.Fatalf("consume: %v", err)
+	}
+	if len(got.Users) != 1 || got.Users[0].ContainerID != "c1" || got.EventStreams.Sessions[0].LastID != 7 {
+		t.Fatalf("unexpected state %+v", got)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the file to be removed, got %v", err)
+	}
+	if got, err := Consume(path, "shsh-1", time.Minute, now); got != nil || err != nil {
+		t.Fatalf("expected nothing to resume a second time, got %+v, %v", got, err)
+	}
+}
+
+func TestConsumeRejectsStaleState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "handoff.json")
+	now := time.Unix(1_700_000_000, 0)
+	if err := Write(path, &State{InstanceID: "shsh-1", WrittenAt: now}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	// Another instance's state is left for it.
+	if _, err := Consume(path, "shsh-2", time.Minute, now); !errors.Is(err, ErrStale) {
+		t.Fatalf("expected ErrStale for another instance, got %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected the file to be kept, got %v", err)
+	}
+
+	// Old state is discarded.
+	if _, err := Consume(path, "shsh-1", time.Minute, now.Add(2*time.Minute)); !errors.Is(err, ErrStale) {
+		t.Fatalf("expected ErrStale for old state, got %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected old state to be removed, got %v", err)
+	}
+}
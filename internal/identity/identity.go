@@ -143,6 +143,19 @@ func getOrCreateAnonID(w http.ResponseWriter, r *http.Request, isDev bool) (stri
 	return id, nil
 }
 
+// ClearAnonCookie tells the browser to drop its anonymous identity, so its
+// next request starts a new one.
+func ClearAnonCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     AnonCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
 func sessionIDFromRequest(r *http.Request) string {
 	sid := r.Header.Get(SessionHeaderName)
 	if sid == "" {
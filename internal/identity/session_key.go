@@ -0,0 +1,40 @@
+package identity
+
+import (
+	"context"
+	"strings"
+)
+
+// SessionKey identifies a single browser tab of a user ("userID:sessionID").
+// Per-tab state (terminal parser, monitor, SSE queues) is keyed by SessionKey;
+// the distinct type keeps plain user IDs from being passed where a tab key is
+// expected.
+type SessionKey string
+
+// NewSessionKey builds the key for a user's tab session.
+func NewSessionKey(userID, sessionID string) SessionKey {
+	return SessionKey(userID + ":" + sessionID)
+}
+
+// SessionKeyFromContext builds the session key for the request's user and tab.
+func SessionKeyFromContext(ctx context.Context) SessionKey {
+	return NewSessionKey(UserIDFromContext(ctx), SessionIDFromContext(ctx))
+}
+
+// UserID returns the user part of the key. User IDs never contain ':', so the
+// first separator splits the key even if the session ID contains one.
+func (k SessionKey) UserID() string {
+	userID, _, _ := strings.Cut(string(k), ":")
+	return userID
+}
+
+// SessionID returns the tab session part of the key.
+func (k SessionKey) SessionID() string {
+	_, sessionID, _ := strings.Cut(string(k), ":")
+	return sessionID
+}
+
+// String implements fmt.Stringer.
+func (k SessionKey) String() string {
+	return string(k)
+}
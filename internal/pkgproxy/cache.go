@@ -0,0 +1,149 @@
+package pkgproxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cache keeps package files on disk by URL, removing the least recently
+// used ones when it outgrows its limit.
+type cache struct {
+	dir      string
+	maxBytes int64
+
+	mu   sync.Mutex
+	size int64
+}
+
+// newCache opens the cache in dir, creating it if needed.
+func newCache(dir string, maxBytes int64) (*cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create cache directory %s: %w", dir, err)
+	}
+	c := &cache{dir: dir, maxBytes: maxBytes}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if strings.HasSuffix(p, ".tmp") {
+			// Left over from a download interrupted by a restart.
+			return os.Remove(p)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		c.size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan cache directory %s: %w", dir, err)
+	}
+	return c, nil
+}
+
+// path returns where the file of url is kept.
+func (c *cache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// open returns the cached file of url, or nil on a miss. A hit counts as a
+// use for eviction.
+func (c *cache) open(url string) *os.File {
+	p := c.path(url)
+	f, err := os.Open(p)
+	if err != nil {
+		return nil
+	}
+	now := time.Now()
+	_ = os.Chtimes(p, now, now)
+	return f
+}
+
+// create returns a temporary file to download url into; commit moves it
+// into the cache once complete.
+func (c *cache) create(url string) (*os.File, error) {
+	p := c.path(url)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(filepath.Dir(p), filepath.Base(p)+".*.tmp")
+}
+
+// commit stores a complete download of url and evicts old files if the
+// cache is over its limit.
+func (c *cache) commit(url string, tmp *os.File, size int64) error {
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if _, err := os.Stat(c.path(url)); err == nil {
+		// Another learner's download of the same file finished first.
+		_ = os.Remove(tmp.Name())
+		return nil
+	}
+	if err := os.Rename(tmp.Name(), c.path(url)); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size += size
+	if c.maxBytes > 0 && c.size > c.maxBytes {
+		c.evict()
+	}
+	return nil
+}
+
+// discard drops an incomplete download.
+func (c *cache) discard(tmp *os.File) {
+	_ = tmp.Close()
+	_ = os.Remove(tmp.Name())
+}
+
+// evict removes the least recently used files until the cache is back to
+// 90% of its limit. c.mu must be held.
+func (c *cache) evict() {
+	type entry struct {
+		path string
+		size int64
+		used time.Time
+	}
+	var entries []entry
+	_ = filepath.WalkDir(c.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasSuffix(p, ".tmp") {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			entries = append(entries, entry{path: p, size: info.Size(), used: info.ModTime()})
+		}
+		return nil
+	})
+	sort.Slice(entries, func(i, j int) bool { return entries[i].used.Before(entries[j].used) })
+
+	target := c.maxBytes / 10 * 9
+	removed := 0
+	for _, e := range entries {
+		if c.size <= target {
+			break
+		}
+		if err := os.Remove(e.path); err != nil {
+			continue
+		}
+		c.size -= e.size
+		removed++
+	}
+	slog.Info("Package cache evicted", "files", removed, "size", c.size, "max", c.maxBytes)
+}
@@ -0,0 +1,74 @@
+// Package pkgproxy is a caching apt and pip proxy for playground containers.
+// It runs in its own container on the playground network (see cmd/pkgproxy),
+// so a classroom downloads each package once, and it refuses packages the
+// operator's policy does not allow, so learners cannot install abusive
+// tooling through it.
+//
+// apt reaches it as an HTTP proxy for the distribution mirrors it is allowed
+// to fetch from; pip reaches it as a package index under /pypi/simple/, with
+// file links rewritten to /pypi/files/. Package files are cached on disk up
+// to a size limit; indexes are always fetched fresh.
+package pkgproxy
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Policy decides which packages may be installed. Patterns are shell globs,
+// e.g. "python3-*", matched against lowercase package names.
+type Policy struct {
+	Allow []string // When set, only matching packages may be installed
+	Deny  []string // Matching packages are refused even if allowed
+}
+
+// Allows reports whether package name may be installed.
+func (p Policy) Allows(name string) bool {
+	name = strings.ToLower(name)
+	if matchAny(p.Deny, name) {
+		return false
+	}
+	return len(p.Allow) == 0 || matchAny(p.Allow, name)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pythonNameSeparators are folded into one dash by PEP 503 normalization.
+var pythonNameSeparators = regexp.MustCompile(`[-_.]+`)
+
+// normalizePython returns the PEP 503 normalized name of a Python project.
+func normalizePython(name string) string {
+	return pythonNameSeparators.ReplaceAllString(strings.ToLower(name), "-")
+}
+
+// debPackage returns the package name of a .deb file name such as
+// nmap_7.91+dfsg1-1_amd64.deb.
+func debPackage(file string) (string, bool) {
+	if !strings.HasSuffix(file, ".deb") && !strings.HasSuffix(file, ".udeb") {
+		return "", false
+	}
+	name, _, ok := strings.Cut(file, "_")
+	return name, ok && name != ""
+}
+
+// pythonFileProject returns the normalized project name of a wheel or source
+// distribution file name, such as requests-2.31.0-py3-none-any.whl or
+// requests-2.31.0.tar.gz. The version is the first dash-separated part
+// starting with a digit.
+func pythonFileProject(file string) (string, bool) {
+	parts := strings.Split(file, "-")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" && parts[i][0] >= '0' && parts[i][0] <= '9' {
+			return normalizePython(strings.Join(parts[:i], "-")), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,305 @@
+package pkgproxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// maxIndexBytes bounds a pip project page, which the proxy rewrites in
+	// memory. The largest projects on PyPI list a few megabytes of files.
+	maxIndexBytes = 32 << 20
+	// upstreamTimeout bounds an upstream response's headers; bodies of large
+	// packages may take much longer.
+	upstreamTimeout = 30 * time.Second
+)
+
+// Paths the proxy serves pip under.
+const (
+	pypiSimplePath = "/pypi/simple/"
+	pypiFilesPath  = "/pypi/files/"
+)
+
+var errIndexTooLarge = errors.New("package index too large")
+
+// hopHeaders are connection-level headers a proxy must not forward.
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// forwardedHeaders are the request headers passed on to uncached upstream
+// requests, so apt's conditional and partial downloads of indexes work.
+var forwardedHeaders = []string{"If-Modified-Since", "If-None-Match", "If-Range", "Range"}
+
+// Options configures a Server.
+type Options struct {
+	Policy        Policy
+	CacheDir      string       // Where package files are cached
+	MaxCacheBytes int64        // Cache size above which old files are evicted; 0 for unbounded
+	AptHosts      []string     // Mirrors apt may fetch from, e.g. archive.ubuntu.com
+	PyPIIndex     string       // Simple index URL, e.g. https://pypi.org/simple
+	PyPIFiles     string       // Base URL of the files the index links to
+	Client        *http.Client // Client for upstream requests (default: one with upstreamTimeout)
+}
+
+// Server is the proxy's HTTP handler.
+type Server struct {
+	policy    Policy
+	cache     *cache
+	aptHosts  map[string]bool
+	pypiIndex string
+	pypiFiles string
+	client    *http.Client
+}
+
+// New returns a proxy serving from the cache in opts.CacheDir.
+func New(opts Options) (*Server, error) {
+	c, err := newCache(opts.CacheDir, opts.MaxCacheBytes)
+	if err != nil {
+		return nil, err
+	}
+	client := opts.Client
+	if client == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = nil
+		transport.ResponseHeaderTimeout = upstreamTimeout
+		client = &http.Client{Transport: transport}
+	}
+	hosts := make(map[string]bool, len(opts.AptHosts))
+	for _, host := range opts.AptHosts {
+		hosts[strings.ToLower(host)] = true
+	}
+	return &Server{
+		policy:    opts.Policy,
+		cache:     c,
+		aptHosts:  hosts,
+		pypiIndex: strings.TrimSuffix(opts.PyPIIndex, "/"),
+		pypiFiles: strings.TrimSuffix(opts.PyPIFiles, "/"),
+		client:    client,
+	}, nil
+}
+
+// ServeHTTP routes apt's proxy requests and pip's index requests.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// apt sends absolute URLs, as to any HTTP proxy.
+	if r.URL.Host != "" {
+		s.serveApt(w, r)
+		return
+	}
+	switch {
+	case r.URL.Path == "/healthz":
+		w.WriteHeader(http.StatusOK)
+	case strings.HasPrefix(r.URL.Path, pypiSimplePath):
+		s.servePyPIIndex(w, r)
+	case strings.HasPrefix(r.URL.Path, pypiFilesPath):
+		s.servePyPIFile(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveApt proxies a request to an allowed mirror. Package files are
+// checked against the policy and cached; their versioned names never
+// change content. Indexes are passed through.
+func (s *Server) serveApt(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Scheme != "http" || !s.aptHosts[strings.ToLower(r.URL.Hostname())] {
+		http.Error(w, "mirror not allowed", http.StatusForbidden)
+		return
+	}
+	upstream := r.URL.String()
+	name, ok := debPackage(path.Base(r.URL.Path))
+	if !ok {
+		s.passThrough(w, r, upstream)
+		return
+	}
+	if !s.policy.Allows(name) {
+		s.refuse(w, "apt", name)
+		return
+	}
+	s.serveCached(w, r, upstream)
+}
+
+// servePyPIIndex serves a project page of the simple index, pointing its
+// file links at the proxy.
+func (s *Server) servePyPIIndex(w http.ResponseWriter, r *http.Request) {
+	project := normalizePython(strings.Trim(strings.TrimPrefix(r.URL.Path, pypiSimplePath), "/"))
+	if project == "" || strings.Contains(project, "/") {
+		// The root index lists every project on PyPI; pip never needs it.
+		http.NotFound(w, r)
+		return
+	}
+	if !s.policy.Allows(project) {
+		s.refuse(w, "pip", project)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, s.pypiIndex+"/"+project+"/", nil)
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	// The HTML form of the simple API, which every pip version reads.
+	req.Header.Set("Accept", "text/html")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		s.upstreamError(w, req.URL.String(), err)
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		w.WriteHeader(resp.StatusCode)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxIndexBytes+1))
+	if err == nil && len(body) > maxIndexBytes {
+		err = errIndexTooLarge
+	}
+	if err != nil {
+		s.upstreamError(w, req.URL.String(), err)
+		return
+	}
+
+	body = bytes.ReplaceAll(body, []byte(s.pypiFiles+"/"), []byte(pypiFilesPath))
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method == http.MethodGet {
+		_, _ = w.Write(body)
+	}
+}
+
+// servePyPIFile serves a distribution file the index linked to.
+func (s *Server) servePyPIFile(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, pypiFilesPath)
+	project, ok := pythonFileProject(path.Base(rest))
+	if !ok || strings.Contains(rest, "..") {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.policy.Allows(project) {
+		s.refuse(w, "pip", project)
+		return
+	}
+	s.serveCached(w, r, s.pypiFiles+"/"+rest)
+}
+
+// serveCached serves upstream from the cache, downloading it into the cache
+// on a miss.
+func (s *Server) serveCached(w http.ResponseWriter, r *http.Request, upstream string) {
+	if f := s.cache.open(upstream); f != nil {
+		defer func() { _ = f.Close() }()
+		info, err := f.Stat()
+		if err != nil {
+			http.Error(w, "cache read failed", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("X-Cache", "HIT")
+		http.ServeContent(w, r, "", info.ModTime(), f)
+		return
+	}
+	if r.Method == http.MethodHead {
+		s.passThrough(w, r, upstream)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, upstream, nil)
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		s.upstreamError(w, upstream, err)
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	copyHeaders(w.Header(), resp.Header)
+	w.Header().Set("X-Cache", "MISS")
+	if resp.StatusCode != http.StatusOK {
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+		return
+	}
+
+	tmp, err := s.cache.create(upstream)
+	if err != nil {
+		slog.Warn("Failed to create package cache file", "error", err)
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+		return
+	}
+	w.WriteHeader(resp.StatusCode)
+	// A learner interrupting the download leaves an incomplete file,
+	// which is dropped rather than cached.
+	n, err := io.Copy(io.MultiWriter(tmp, w), resp.Body)
+	if err != nil || (resp.ContentLength >= 0 && n != resp.ContentLength) {
+		s.cache.discard(tmp)
+		return
+	}
+	if err := s.cache.commit(upstream, tmp, n); err != nil {
+		slog.Warn("Failed to store package in cache", "error", err, "url", upstream)
+	}
+}
+
+// passThrough proxies a request without caching it.
+func (s *Server) passThrough(w http.ResponseWriter, r *http.Request, upstream string) {
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, upstream, nil)
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	for _, h := range forwardedHeaders {
+		if v := r.Header.Get(h); v != "" {
+			req.Header.Set(h, v)
+		}
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		s.upstreamError(w, upstream, err)
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	copyHeaders(w.Header(), resp.Header)
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+// refuse answers a request for a package the policy does not allow.
+func (s *Server) refuse(w http.ResponseWriter, manager, name string) {
+	slog.Info("Package refused by policy", "manager", manager, "package", name)
+	http.Error(w, fmt.Sprintf("package %s is not allowed in this playground", name), http.StatusForbidden)
+}
+
+func (s *Server) upstreamError(w http.ResponseWriter, upstream string, err error) {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		slog.Warn("Package upstream timed out", "url", upstream)
+		http.Error(w, "upstream timed out", http.StatusGatewayTimeout)
+		return
+	}
+	slog.Warn("Package upstream failed", "error", err, "url", upstream)
+	http.Error(w, "upstream failed", http.StatusBadGateway)
+}
+
+// copyHeaders copies end-to-end response headers.
+func copyHeaders(dst, src http.Header) {
+	for k, vs := range src {
+		dst[k] = append([]string(nil), vs...)
+	}
+	for _, h := range hopHeaders {
+		dst.Del(h)
+	}
+}
@@ -0,0 +1,191 @@
+package pkgproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPolicyAllows(t *testing.T) {
+	p := Policy{Allow: []string{"python3-*", "nano", "nmap"}, Deny: []string{"nmap", "xmrig"}}
+	cases := map[string]bool{
+		"nano":             true,
+		"Python3-Requests": true,
+		"nmap":             false, // Deny wins over Allow
+		"xmrig":            false,
+		"vim":              false, // Not on the allowlist
+	}
+	for name, want := range cases {
+		if got := p.Allows(name); got != want {
+			t.Errorf("Allows(%q) = %v, want %v", name, got, want)
+		}
+	}
+	if !(Policy{Deny: []string{"cpuminer*"}}).Allows("vim") {
+		t.Error("an empty allowlist should allow everything not denied")
+	}
+}
+
+func TestPackageNames(t *testing.T) {
+	if name, ok := debPackage("nmap_7.91+dfsg1-1_amd64.deb"); !ok || name != "nmap" {
+		t.Errorf("debPackage = %q, %v", name, ok)
+	}
+	if _, ok := debPackage("Packages.gz"); ok {
+		t.Error("an index is not a package")
+	}
+	files := map[string]string{
+		"requests-2.31.0-py3-none-any.whl":                "requests",
+		"Flask_SQLAlchemy-3.1.1.tar.gz":                   "flask-sqlalchemy",
+		"zope.interface-6.0-cp311-cp311-linux_x86_64.whl": "zope-interface",
+	}
+	for file, want := range files {
+		if got, ok := pythonFileProject(file); !ok || got != want {
+			t.Errorf("pythonFileProject(%q) = %q, %v, want %q", file, got, ok, want)
+		}
+	}
+}
+
+// newTestProxy returns a proxy whose apt mirror and PyPI are upstream.
+func newTestProxy(t *testing.T, policy Policy, upstream *httptest.Server) *Server {
+	t.Helper()
+	u, _ := url.Parse(upstream.URL)
+	s, err := New(Options{
+		Policy:    policy,
+		CacheDir:  t.TempDir(),
+		AptHosts:  []string{u.Hostname()},
+		PyPIIndex: upstream.URL + "/simple",
+		PyPIFiles: upstream.URL + "/files",
+		Client:    upstream.Client(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestAptCachesAllowedPackages(t *testing.T) {
+	var fetches atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		_, _ = io.WriteString(w, "deb:"+r.URL.Path)
+	}))
+	defer upstream.Close()
+	s := newTestProxy(t, Policy{Deny: []string{"xmrig"}}, upstream)
+
+	deb := upstream.URL + "/ubuntu/pool/main/n/nano/nano_7.2-1_amd64.deb"
+	for i, want := range []string{"MISS", "HIT"} {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, deb, nil))
+		if rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != want {
+			t.Fatalf("request %d: status %d, X-Cache %q, want 200 %s", i, rec.Code, rec.Header().Get("X-Cache"), want)
+		}
+		if rec.Body.String() != "deb:/ubuntu/pool/main/n/nano/nano_7.2-1_amd64.deb" {
+			t.Fatalf("request %d: body %q", i, rec.Body.String())
+		}
+	}
+	if fetches.Load() != 1 {
+		t.Fatalf("upstream fetched %d times, want 1", fetches.Load())
+	}
+
+	// Indexes pass through uncached.
+	for range 2 {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, upstream.URL+"/ubuntu/dists/noble/InRelease", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("index status %d", rec.Code)
+		}
+	}
+	if fetches.Load() != 3 {
+		t.Fatalf("upstream fetched %d times, want 3", fetches.Load())
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, upstream.URL+"/ubuntu/pool/universe/x/xmrig/xmrig_6.21_amd64.deb", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("denied package status %d, want 403", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com/ubuntu/dists/noble/InRelease", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("unlisted mirror status %d, want 403", rec.Code)
+	}
+	if fetches.Load() != 3 {
+		t.Fatalf("refused requests reached upstream")
+	}
+}
+
+func TestPyPIRewritesIndexAndChecksPolicy(t *testing.T) {
+	var upstreamURL string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/simple/requests/":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = io.WriteString(w, `<a href="`+upstreamURL+`/files/packages/ab/requests-2.31.0-py3-none-any.whl#sha256=00">requests-2.31.0-py3-none-any.whl</a>`)
+		case strings.HasPrefix(r.URL.Path, "/files/"):
+			_, _ = io.WriteString(w, "wheel")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+	upstreamURL = upstream.URL
+	s := newTestProxy(t, Policy{Deny: []string{"scapy"}}, upstream)
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pypi/simple/Requests/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("index status %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `href="/pypi/files/packages/ab/requests-2.31.0-py3-none-any.whl#sha256=00"`) {
+		t.Fatalf("index links not rewritten: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pypi/files/packages/ab/requests-2.31.0-py3-none-any.whl", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "wheel" {
+		t.Fatalf("file status %d, body %q", rec.Code, rec.Body.String())
+	}
+
+	for _, target := range []string{"/pypi/simple/scapy/", "/pypi/files/packages/cd/scapy-2.5.0.tar.gz"} {
+		rec = httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s status %d, want 403", target, rec.Code)
+		}
+	}
+}
+
+func TestCacheEvictsOldestFiles(t *testing.T) {
+	c, err := newCache(t.TempDir(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	put := func(url string, size int) {
+		tmp, err := c.create(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = tmp.WriteString(strings.Repeat("x", size))
+		if err := c.commit(url, tmp, int64(size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put("a", 60)
+	put("b", 30)
+	put("c", 30) // Over the limit: a, the oldest, goes.
+	if f := c.open("a"); f != nil {
+		_ = f.Close()
+		t.Fatal("oldest file was not evicted")
+	}
+	for _, url := range []string{"b", "c"} {
+		f := c.open(url)
+		if f == nil {
+			t.Fatalf("%s was evicted", url)
+		}
+		_ = f.Close()
+	}
+}
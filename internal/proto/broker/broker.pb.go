@@ -0,0 +1,406 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        v6.33.1
+// source: broker.proto
+
+package broker
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// OpenExec asks the broker to start a shell in a container.
+type OpenExec struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	ContainerId string                 `protobuf:"bytes,1,opt,name=container_id,json=containerId,proto3" json:"container_id,omitempty"`
+	UserId      string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	SessionId   string                 `protobuf:"bytes,3,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	// Client terminal the shell is created for; zero values keep the defaults.
+	Term          string `protobuf:"bytes,4,opt,name=term,proto3" json:"term,omitempty"`
+	Colorterm     string `protobuf:"bytes,5,opt,name=colorterm,proto3" json:"colorterm,omitempty"`
+	Cols          uint32 `protobuf:"varint,6,opt,name=cols,proto3" json:"cols,omitempty"`
+	Rows          uint32 `protobuf:"varint,7,opt,name=rows,proto3" json:"rows,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OpenExec) Reset() {
+	*x = OpenExec{}
+	mi := &file_broker_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OpenExec) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OpenExec) ProtoMessage() {}
+
+func (x *OpenExec) ProtoReflect() protoreflect.Message {
+	mi := &file_broker_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OpenExec.ProtoReflect.Descriptor instead.
+func (*OpenExec) Descriptor() ([]byte, []int) {
+	return file_broker_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *OpenExec) GetContainerId() string {
+	if x != nil {
+		return x.ContainerId
+	}
+	return ""
+}
+
+func (x *OpenExec) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *OpenExec) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *OpenExec) GetTerm() string {
+	if x != nil {
+		return x.Term
+	}
+	return ""
+}
+
+func (x *OpenExec) GetColorterm() string {
+	if x != nil {
+		return x.Colorterm
+	}
+	return ""
+}
+
+func (x *OpenExec) GetCols() uint32 {
+	if x != nil {
+		return x.Cols
+	}
+	return 0
+}
+
+func (x *OpenExec) GetRows() uint32 {
+	if x != nil {
+		return x.Rows
+	}
+	return 0
+}
+
+// AttachFrame is sent from the API tier to the broker.
+type AttachFrame struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Open          *OpenExec              `protobuf:"bytes,1,opt,name=open,proto3" json:"open,omitempty"`
+	Data          []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AttachFrame) Reset() {
+	*x = AttachFrame{}
+	mi := &file_broker_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AttachFrame) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AttachFrame) ProtoMessage() {}
+
+func (x *AttachFrame) ProtoReflect() protoreflect.Message {
+	mi := &file_broker_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AttachFrame.ProtoReflect.Descriptor instead.
+func (*AttachFrame) Descriptor() ([]byte, []int) {
+	return file_broker_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *AttachFrame) GetOpen() *OpenExec {
+	if x != nil {
+		return x.Open
+	}
+	return nil
+}
+
+func (x *AttachFrame) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+// ExecFrame is sent from the broker to the API tier.
+type ExecFrame struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ExecId        string                 `protobuf:"bytes,1,opt,name=exec_id,json=execId,proto3" json:"exec_id,omitempty"`
+	Data          []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExecFrame) Reset() {
+	*x = ExecFrame{}
+	mi := &file_broker_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExecFrame) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecFrame) ProtoMessage() {}
+
+func (x *ExecFrame) ProtoReflect() protoreflect.Message {
+	mi := &file_broker_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecFrame.ProtoReflect.Descriptor instead.
+func (*ExecFrame) Descriptor() ([]byte, []int) {
+	return file_broker_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ExecFrame) GetExecId() string {
+	if x != nil {
+		return x.ExecId
+	}
+	return ""
+}
+
+func (x *ExecFrame) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+// ResizeRequest resizes a running exec session.
+type ResizeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ExecId        string                 `protobuf:"bytes,1,opt,name=exec_id,json=execId,proto3" json:"exec_id,omitempty"`
+	Cols          uint32                 `protobuf:"varint,2,opt,name=cols,proto3" json:"cols,omitempty"`
+	Rows          uint32                 `protobuf:"varint,3,opt,name=rows,proto3" json:"rows,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResizeRequest) Reset() {
+	*x = ResizeRequest{}
+	mi := &file_broker_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResizeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResizeRequest) ProtoMessage() {}
+
+func (x *ResizeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_broker_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResizeRequest.ProtoReflect.Descriptor instead.
+func (*ResizeRequest) Descriptor() ([]byte, []int) {
+	return file_broker_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ResizeRequest) GetExecId() string {
+	if x != nil {
+		return x.ExecId
+	}
+	return ""
+}
+
+func (x *ResizeRequest) GetCols() uint32 {
+	if x != nil {
+		return x.Cols
+	}
+	return 0
+}
+
+func (x *ResizeRequest) GetRows() uint32 {
+	if x != nil {
+		return x.Rows
+	}
+	return 0
+}
+
+// ResizeResponse is the empty reply to ResizeRequest.
+type ResizeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResizeResponse) Reset() {
+	*x = ResizeResponse{}
+	mi := &file_broker_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResizeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResizeResponse) ProtoMessage() {}
+
+func (x *ResizeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_broker_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResizeResponse.ProtoReflect.Descriptor instead.
+func (*ResizeResponse) Descriptor() ([]byte, []int) {
+	return file_broker_proto_rawDescGZIP(), []int{4}
+}
+
+var File_broker_proto protoreflect.FileDescriptor
+
+const file_broker_proto_rawDesc = "" +
+	"\n" +
+	"\fbroker.proto\x12\x0eshsh.broker.v1\"\xbf\x01\n" +
+	"\bOpenExec\x12!\n" +
+	"\fcontainer_id\x18\x01 \x01(\tR\vcontainerId\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x03 \x01(\tR\tsessionId\x12\x12\n" +
+	"\x04term\x18\x04 \x01(\tR\x04term\x12\x1c\n" +
+	"\tcolorterm\x18\x05 \x01(\tR\tcolorterm\x12\x12\n" +
+	"\x04cols\x18\x06 \x01(\rR\x04cols\x12\x12\n" +
+	"\x04rows\x18\a \x01(\rR\x04rows\"O\n" +
+	"\vAttachFrame\x12,\n" +
+	"\x04open\x18\x01 \x01(\v2\x18.shsh.broker.v1.OpenExecR\x04open\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\"8\n" +
+	"\tExecFrame\x12\x17\n" +
+	"\aexec_id\x18\x01 \x01(\tR\x06execId\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\"P\n" +
+	"\rResizeRequest\x12\x17\n" +
+	"\aexec_id\x18\x01 \x01(\tR\x06execId\x12\x12\n" +
+	"\x04cols\x18\x02 \x01(\rR\x04cols\x12\x12\n" +
+	"\x04rows\x18\x03 \x01(\rR\x04rows\"\x10\n" +
+	"\x0eResizeResponse2\x9f\x01\n" +
+	"\x0eTerminalBroker\x12D\n" +
+	"\x06Attach\x12\x1b.shsh.broker.v1.AttachFrame\x1a\x19.shsh.broker.v1.ExecFrame(\x010\x01\x12G\n" +
+	"\x06Resize\x12\x1d.shsh.broker.v1.ResizeRequest\x1a\x1e.shsh.broker.v1.ResizeResponseB5Z3github.com/ashureev/shsh-labs/internal/proto/brokerb\x06proto3"
+
+var (
+	file_broker_proto_rawDescOnce sync.Once
+	file_broker_proto_rawDescData []byte
+)
+
+func file_broker_proto_rawDescGZIP() []byte {
+	file_broker_proto_rawDescOnce.Do(func() {
+		file_broker_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_broker_proto_rawDesc), len(file_broker_proto_rawDesc)))
+	})
+	return file_broker_proto_rawDescData
+}
+
+var file_broker_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_broker_proto_goTypes = []any{
+	(*OpenExec)(nil),       // 0: shsh.broker.v1.OpenExec
+	(*AttachFrame)(nil),    // 1: shsh.broker.v1.AttachFrame
+	(*ExecFrame)(nil),      // 2: shsh.broker.v1.ExecFrame
+	(*ResizeRequest)(nil),  // 3: shsh.broker.v1.ResizeRequest
+	(*ResizeResponse)(nil), // 4: shsh.broker.v1.ResizeResponse
+}
+var file_broker_proto_depIdxs = []int32{
+	0, // 0: shsh.broker.v1.AttachFrame.open:type_name -> shsh.broker.v1.OpenExec
+	1, // 1: shsh.broker.v1.TerminalBroker.Attach:input_type -> shsh.broker.v1.AttachFrame
+	3, // 2: shsh.broker.v1.TerminalBroker.Resize:input_type -> shsh.broker.v1.ResizeRequest
+	2, // 3: shsh.broker.v1.TerminalBroker.Attach:output_type -> shsh.broker.v1.ExecFrame
+	4, // 4: shsh.broker.v1.TerminalBroker.Resize:output_type -> shsh.broker.v1.ResizeResponse
+	3, // [3:5] is the sub-list for method output_type
+	1, // [1:3] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_broker_proto_init() }
+func file_broker_proto_init() {
+	if File_broker_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_broker_proto_rawDesc), len(file_broker_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_broker_proto_goTypes,
+		DependencyIndexes: file_broker_proto_depIdxs,
+		MessageInfos:      file_broker_proto_msgTypes,
+	}.Build()
+	File_broker_proto = out.File
+	file_broker_proto_goTypes = nil
+	file_broker_proto_depIdxs = nil
+}
@@ -0,0 +1,316 @@
+// Package redis is a minimal RESP2 client shared by the Redis-backed
+// repository and the session route registry: enough to issue commands,
+// pipelines, transactions and scripts over a small pool of connections.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultTimeout bounds a round trip when the context has no deadline of
+// its own.
+const defaultTimeout = 5 * time.Second
+
+// Error is an error reply from the server, e.g. WRONGTYPE. The connection
+// stays usable after one.
+type Error string
+
+func (e Error) Error() string { return "redis: " + string(e) }
+
+// ErrProtocol is returned for a reply that is not valid RESP2, or not of the
+// type a command returns.
+var ErrProtocol = errors.New("redis: malformed reply")
+
+// Client issues commands over a pool of connections to one server. It is
+// safe for concurrent use.
+type Client struct {
+	addr     string
+	password string
+	db       int
+	idle     chan *conn
+}
+
+type conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// ParseAddr accepts either host:port, as the Python agent's REDIS_URL does,
+// or a redis://[:password@]host:port[/db] URL, and returns the address with
+// any password and database number it carries.
+func ParseAddr(raw string) (addr, password string, db int, err error) {
+	if !strings.Contains(raw, "://") {
+		return raw, "", 0, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("parse redis url: %w", err)
+	}
+	if u.Scheme != "redis" {
+		return "", "", 0, fmt.Errorf("parse redis url: unsupported scheme %q", u.Scheme)
+	}
+	if pw, ok := u.User.Password(); ok {
+		password = pw
+	}
+	if path := strings.TrimPrefix(u.Path, "/"); path != "" {
+		if db, err = strconv.Atoi(path); err != nil {
+			return "", "", 0, fmt.Errorf("parse redis url: invalid database %q", path)
+		}
+	}
+	return u.Host, password, db, nil
+}
+
+// NewClient creates a client for the server at addr. New connections
+// authenticate with password and select db when they are set; up to maxIdle
+// connections are kept open between commands.
+func NewClient(addr, password string, db, maxIdle int) *Client {
+	return &Client{
+		addr:     addr,
+		password: password,
+		db:       db,
+		idle:     make(chan *conn, max(maxIdle, 1)),
+	}
+}
+
+// Do sends one command and returns its reply: simple and bulk strings as
+// string, integers as int64, arrays as []any and nulls as nil. An error
+// reply is returned as an Error.
+func (c *Client) Do(ctx context.Context, args ...any) (any, error) {
+	replies, err := c.Pipeline(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	if rerr, ok := replies[0].(Error); ok {
+		return nil, rerr
+	}
+	return replies[0], nil
+}
+
+// Pipeline sends cmds in one round trip and returns their replies in order.
+// Error replies are returned in place as Error values.
+func (c *Client) Pipeline(ctx context.Context, cmds ...[]any) ([]any, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	replies, err := cn.roundTrip(ctx, cmds)
+	if err != nil {
+		_ = cn.conn.Close()
+		return nil, err
+	}
+	c.put(cn)
+	return replies, nil
+}
+
+// Tx runs cmds atomically with MULTI/EXEC and returns their replies. Any
+// error reply, whether while queueing or executing, is returned as an Error.
+func (c *Client) Tx(ctx context.Context, cmds ...[]any) ([]any, error) {
+	wrapped := make([][]any, 0, len(cmds)+2)
+	wrapped = append(wrapped, []any{"MULTI"})
+	wrapped = append(wrapped, cmds...)
+	wrapped = append(wrapped, []any{"EXEC"})
+
+	replies, err := c.Pipeline(ctx, wrapped...)
+	if err != nil {
+		return nil, err
+	}
+	// A command rejected while queueing aborts the transaction.
+	for _, reply := range replies[:len(replies)-1] {
+		if rerr, ok := reply.(Error); ok {
+			return nil, rerr
+		}
+	}
+	results, ok := replies[len(replies)-1].([]any)
+	if !ok {
+		if rerr, ok := replies[len(replies)-1].(Error); ok {
+			return nil, rerr
+		}
+		return nil, ErrProtocol
+	}
+	for _, reply := range results {
+		if rerr, ok := reply.(Error); ok {
+			return nil, rerr
+		}
+	}
+	return results, nil
+}
+
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+	}
+
+	var d net.Dialer
+	dialCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+	nc, err := d.DialContext(dialCtx, "tcp", c.addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial redis: %w", err)
+	}
+	cn := &conn{conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+
+	var setup [][]any
+	if c.password != "" {
+		setup = append(setup, []any{"AUTH", c.password})
+	}
+	if c.db != 0 {
+		setup = append(setup, []any{"SELECT", c.db})
+	}
+	if len(setup) > 0 {
+		replies, err := cn.roundTrip(ctx, setup)
+		if err == nil {
+			for _, reply := range replies {
+				if rerr, ok := reply.(Error); ok {
+					err = rerr
+					break
+				}
+			}
+		}
+		if err != nil {
+			_ = nc.Close()
+			return nil, fmt.Errorf("set up redis connection: %w", err)
+		}
+	}
+	return cn, nil
+}
+
+func (c *Client) put(cn *conn) {
+	select {
+	case c.idle <- cn:
+	default:
+		_ = cn.conn.Close()
+	}
+}
+
+// Close closes idle connections; connections in use are closed as they are
+// returned.
+func (c *Client) Close() {
+	for {
+		select {
+		case cn := <-c.idle:
+			_ = cn.conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+func (cn *conn) roundTrip(ctx context.Context, cmds [][]any) ([]any, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultTimeout)
+	}
+	if err := cn.conn.SetDeadline(deadline); err != nil {
+		return nil, fmt.Errorf("set redis deadline: %w", err)
+	}
+
+	for _, args := range cmds {
+		if err := writeCommand(cn.w, args); err != nil {
+			return nil, err
+		}
+	}
+	if err := cn.w.Flush(); err != nil {
+		return nil, fmt.Errorf("write redis command: %w", err)
+	}
+
+	replies := make([]any, len(cmds))
+	for i := range cmds {
+		reply, err := readReply(cn.r)
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+// writeCommand encodes args as a RESP array of bulk strings.
+func writeCommand(w *bufio.Writer, args []any) error {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		var s string
+		switch v := arg.(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		case int:
+			s = strconv.Itoa(v)
+		case int64:
+			s = strconv.FormatInt(v, 10)
+		default:
+			return fmt.Errorf("redis: unsupported argument type %T", arg)
+		}
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(s), s)
+	}
+	return nil
+}
+
+// readReply decodes one RESP2 reply: simple strings and bulk strings as
+// string, integers as int64, arrays as []any, nulls as nil and errors as
+// Error.
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("read redis reply: %w", err)
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, ErrProtocol
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return Error(body), nil
+	case ':':
+		n, err := strconv.ParseInt(body, 10, 64)
+		if err != nil {
+			return nil, ErrProtocol
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, ErrProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, fmt.Errorf("read redis reply: %w", err)
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, ErrProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, ErrProtocol
+	}
+}
@@ -0,0 +1,215 @@
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeServer answers ECHO, INCR, MULTI and EXEC over RESP; every other
+// command gets an error reply. It records the commands it receives and how
+// many connections it accepted.
+type fakeServer struct {
+	mu    sync.Mutex
+	conns int
+	cmds  [][]string
+	n     int64
+}
+
+func startFakeServer(t *testing.T) (*fakeServer, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	srv := &fakeServer{}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			srv.accepted()
+			go srv.serve(conn)
+		}
+	}()
+	return srv, ln.Addr().String()
+}
+
+func (s *fakeServer) accepted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns++
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	r := bufio.NewReader(conn)
+	var queued []string
+	inTx := false
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		var reply string
+		switch {
+		case args[0] == "MULTI":
+			inTx, queued = true, nil
+			reply = "+OK\r\n"
+		case args[0] == "EXEC":
+			reply = fmt.Sprintf("*%d\r\n%s", len(queued), strings.Join(queued, ""))
+			inTx = false
+		case inTx && args[0] == "BAD":
+			reply = "-ERR unknown command 'BAD'\r\n"
+		case inTx:
+			queued = append(queued, s.reply(args))
+			reply = "+QUEUED\r\n"
+		default:
+			reply = s.reply(args)
+		}
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeServer) reply(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cmds = append(s.cmds, args)
+	switch args[0] {
+	case "AUTH", "SELECT":
+		return "+OK\r\n"
+	case "ECHO":
+		return "$" + strconv.Itoa(len(args[1])) + "\r\n" + args[1] + "\r\n"
+	case "INCR":
+		s.n++
+		return ":" + strconv.FormatInt(s.n, 10) + "\r\n"
+	case "NIL":
+		return "$-1\r\n"
+	default:
+		return "-WRONGTYPE " + args[0] + "\r\n"
+	}
+}
+
+func (s *fakeServer) received() ([][]string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cmds, s.conns
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, 0, n)
+	for range n {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(header[1:]))
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func TestParseAddr(t *testing.T) {
+	tests := []struct {
+		raw, addr, password string
+		db                  int
+		wantErr             bool
+	}{
+		{raw: "redis:6379", addr: "redis:6379"},
+		{raw: "redis://redis:6379", addr: "redis:6379"},
+		{raw: "redis://:secret@redis:6379/3", addr: "redis:6379", password: "secret", db: 3},
+		{raw: "rediss://redis:6379", wantErr: true},
+		{raw: "redis://redis:6379/x", wantErr: true},
+	}
+	for _, tt := range tests {
+		addr, password, db, err := ParseAddr(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("ParseAddr(%q) error = %v, want error %v", tt.raw, err, tt.wantErr)
+		}
+		if addr != tt.addr || password != tt.password || db != tt.db {
+			t.Fatalf("ParseAddr(%q) = %q, %q, %d", tt.raw, addr, password, db)
+		}
+	}
+}
+
+func TestClientDo(t *testing.T) {
+	srv, addr := startFakeServer(t)
+	c := NewClient(addr, "secret", 2, 1)
+	defer c.Close()
+	ctx := t.Context()
+
+	if reply, err := c.Do(ctx, "ECHO", []byte("hi\r\nthere")); err != nil || reply != "hi\r\nthere" {
+		t.Fatalf("ECHO = %v, %v", reply, err)
+	}
+	if reply, err := c.Do(ctx, "INCR", "n"); err != nil || reply != int64(1) {
+		t.Fatalf("INCR = %v, %v", reply, err)
+	}
+	if reply, err := c.Do(ctx, "NIL"); err != nil || reply != nil {
+		t.Fatalf("NIL = %v, %v", reply, err)
+	}
+	var rerr Error
+	if _, err := c.Do(ctx, "GET", "n"); !errors.As(err, &rerr) || rerr != "WRONGTYPE GET" {
+		t.Fatalf("error reply = %v, want WRONGTYPE", err)
+	}
+	// The connection survives an error reply.
+	if _, err := c.Do(ctx, "ECHO", "again"); err != nil {
+		t.Fatalf("ECHO after an error reply: %v", err)
+	}
+	if _, err := c.Do(ctx, "ECHO", 1.5); err == nil {
+		t.Fatal("Do accepted an unsupported argument type")
+	}
+
+	cmds, conns := srv.received()
+	if conns != 1 {
+		t.Fatalf("accepted %d connections, want 1 reused", conns)
+	}
+	if got := fmt.Sprint(cmds[:2]); got != "[[AUTH secret] [SELECT 2]]" {
+		t.Fatalf("connection setup = %s", got)
+	}
+}
+
+func TestClientPipelineAndTx(t *testing.T) {
+	_, addr := startFakeServer(t)
+	c := NewClient(addr, "", 0, 1)
+	defer c.Close()
+	ctx := t.Context()
+
+	replies, err := c.Pipeline(ctx, []any{"INCR", "n"}, []any{"GET", "n"}, []any{"ECHO", "x"})
+	if err != nil {
+		t.Fatalf("Pipeline: %v", err)
+	}
+	if replies[0] != int64(1) || replies[1] != Error("WRONGTYPE GET") || replies[2] != "x" {
+		t.Fatalf("Pipeline = %#v", replies)
+	}
+
+	replies, err = c.Tx(ctx, []any{"INCR", "n"}, []any{"ECHO", "y"})
+	if err != nil || len(replies) != 2 || replies[0] != int64(2) || replies[1] != "y" {
+		t.Fatalf("Tx = %#v, %v", replies, err)
+	}
+	if _, err := c.Tx(ctx, []any{"INCR", "n"}, []any{"GET", "n"}); err == nil {
+		t.Fatal("Tx hid an error reply from EXEC")
+	}
+	if _, err := c.Tx(ctx, []any{"BAD"}); err == nil {
+		t.Fatal("Tx hid a command rejected while queueing")
+	}
+}
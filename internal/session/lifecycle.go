@@ -0,0 +1,187 @@
+// Package session owns the lifecycle of per-session resources: the state a
+// browser tab's terminal WebSocket and agent SSE stream register across the
+// session manager, terminal monitor, OSC 133 parser and SSE replay queues.
+// Handlers acquire a Handle per connection and register teardown with it, so
+// a single Close releases everything and shared state is torn down exactly
+// once, when the session's last connection closes.
+package session
+
+import (
+	"log/slog"
+	"sync"
+
+	"github.com/ashureev/shsh-labs/internal/identity"
+)
+
+// Lifecycle tracks the open connections of every session.
+type Lifecycle struct {
+	logger *slog.Logger
+
+	mu       sync.Mutex
+	sessions map[identity.SessionKey]*entry
+}
+
+// entry is the state of one session.
+type entry struct {
+	refs    int
+	names   map[string]bool // Names of registered end hooks
+	onEnd   []func()
+	ending  bool
+	stopped chan struct{} // Closed once the end hooks of an ending session ran
+}
+
+// NewLifecycle creates an empty lifecycle. A nil logger uses slog.Default.
+func NewLifecycle(logger *slog.Logger) *Lifecycle {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Lifecycle{logger: logger, sessions: make(map[identity.SessionKey]*entry)}
+}
+
+// Acquire opens a connection to a session. The caller must Close the handle
+// when the connection ends. If the session is still tearing down from its
+// previous connection, Acquire waits for that to finish, so the old teardown
+// cannot remove state the new connection registers.
+func (l *Lifecycle) Acquire(userID, sessionID string) *Handle {
+	key := identity.NewSessionKey(userID, sessionID)
+	for {
+		e, wait := l.acquire(key)
+		if wait == nil {
+			return &Handle{l: l, key: key, entry: e}
+		}
+		<-wait
+	}
+}
+
+// acquire takes a reference on the session, or returns the channel to wait on
+// while it ends.
+func (l *Lifecycle) acquire(key identity.SessionKey) (*entry, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.sessions[key]
+	if ok && e.ending {
+		return nil, e.stopped
+	}
+	if !ok {
+		e = &entry{names: make(map[string]bool), stopped: make(chan struct{})}
+		l.sessions[key] = e
+	}
+	e.refs++
+	return e, nil
+}
+
+// Active reports whether the session has an open connection.
+func (l *Lifecycle) Active(userID, sessionID string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.sessions[identity.NewSessionKey(userID, sessionID)]
+	return ok && !e.ending
+}
+
+// Len returns the number of sessions with an open connection.
+func (l *Lifecycle) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.sessions)
+}
+
+// onEnd registers fn under name unless a hook of that name exists.
+func (l *Lifecycle) onEnd(e *entry, name string, fn func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e.names[name] {
+		return
+	}
+	e.names[name] = true
+	e.onEnd = append(e.onEnd, fn)
+}
+
+// release drops a reference. It reports whether it was the session's last,
+// with the session's end hooks.
+func (l *Lifecycle) release(e *entry) ([]func(), bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e.refs--
+	if e.refs > 0 {
+		return nil, false
+	}
+	e.ending = true
+	return e.onEnd, true
+}
+
+// finish removes an ended session and wakes connections waiting for it.
+func (l *Lifecycle) finish(key identity.SessionKey, e *entry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.sessions, key)
+	close(e.stopped)
+}
+
+// Handle is one connection's hold on a session.
+type Handle struct {
+	l     *Lifecycle
+	key   identity.SessionKey
+	entry *entry
+
+	mu      sync.Mutex
+	cleanup []func()
+	closed  bool
+}
+
+// Key returns the session the handle holds.
+func (h *Handle) Key() identity.SessionKey {
+	return h.key
+}
+
+// Defer registers fn to run when this connection closes. Hooks run in
+// reverse order of registration, like defers.
+func (h *Handle) Defer(fn func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.cleanup = append(h.cleanup, fn)
+}
+
+// OnSessionEnd registers fn to run once the session's last connection
+// closes. Every connection may register the same teardown: only the first
+// hook of a name is kept. Hooks run in reverse order of registration.
+func (h *Handle) OnSessionEnd(name string, fn func()) {
+	h.l.onEnd(h.entry, name, fn)
+}
+
+// Close runs the connection's hooks and, if it was the session's last
+// connection, the session's end hooks. It is safe to call more than once.
+func (h *Handle) Close() {
+	cleanup, ok := h.take()
+	if !ok {
+		return
+	}
+	runReverse(cleanup)
+
+	onEnd, last := h.l.release(h.entry)
+	if !last {
+		return
+	}
+	defer h.l.finish(h.key, h.entry)
+	runReverse(onEnd)
+	h.l.logger.Debug("Session ended", "user_id", h.key.UserID(), "session_id", h.key.SessionID())
+}
+
+// take marks the handle closed and returns its hooks, or false if it was
+// already closed.
+func (h *Handle) take() ([]func(), bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, false
+	}
+	h.closed = true
+	cleanup := h.cleanup
+	h.cleanup = nil
+	return cleanup, true
+}
+
+func runReverse(fns []func()) {
+	for i := len(fns) - 1; i >= 0; i-- {
+		fns[i]()
+	}
+}
@@ -0,0 +1,89 @@
+package session
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSessionEndsWithLastConnection(t *testing.T) {
+	l := NewLifecycle(nil)
+	var calls []string
+
+	terminal := l.Acquire("alice", "tab-1")
+	terminal.Defer(func() { calls = append(calls, "terminal") })
+	terminal.OnSessionEnd("queue", func() { calls = append(calls, "queue") })
+
+	stream := l.Acquire("alice", "tab-1")
+	stream.Defer(func() { calls = append(calls, "stream") })
+	stream.OnSessionEnd("queue", func() { calls = append(calls, "duplicate") })
+	stream.OnSessionEnd("monitor", func() { calls = append(calls, "monitor") })
+
+	terminal.Close()
+	if !l.Active("alice", "tab-1") {
+		t.Fatal("session ended while a connection is open")
+	}
+	stream.Close()
+	stream.Close()
+
+	want := []string{"terminal", "stream", "monitor", "queue"}
+	if !slices.Equal(calls, want) {
+		t.Fatalf("hooks ran as %v, want %v", calls, want)
+	}
+	if l.Active("alice", "tab-1") || l.Len() != 0 {
+		t.Fatalf("session still tracked after its last connection closed")
+	}
+}
+
+func TestSessionsAreIndependent(t *testing.T) {
+	l := NewLifecycle(nil)
+	ended := false
+	a := l.Acquire("alice", "tab-1")
+	a.OnSessionEnd("queue", func() { ended = true })
+	b := l.Acquire("alice", "tab-2")
+	defer b.Close()
+
+	a.Close()
+	if !ended {
+		t.Fatal("closing tab-1 did not end it")
+	}
+	if !l.Active("alice", "tab-2") || l.Active("alice", "tab-1") {
+		t.Fatal("closing tab-1 affected tab-2")
+	}
+}
+
+func TestAcquireWaitsForEndingSession(t *testing.T) {
+	l := NewLifecycle(nil)
+	old := l.Acquire("alice", "tab-1")
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var mu sync.Mutex
+	var order []string
+	old.OnSessionEnd("monitor", func() {
+		close(started)
+		<-release
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, "teardown")
+	})
+	go old.Close()
+	<-started
+
+	acquired := make(chan *Handle)
+	go func() { acquired <- l.Acquire("alice", "tab-1") }()
+	select {
+	case <-acquired:
+		t.Fatal("acquired a session that was still tearing down")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	h := <-acquired
+	defer h.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(order) != 1 || !l.Active("alice", "tab-1") {
+		t.Fatalf("new connection did not get a fresh session: %v", order)
+	}
+}
@@ -0,0 +1,44 @@
+package shared
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TruncateWithMarker shortens s to at most limit bytes by cutting out the
+// middle and inserting a marker that records how many bytes were dropped.
+// The head and tail are kept because command output usually has its context
+// at the start and its errors at the end. A non-positive limit disables
+// truncation.
+func TruncateWithMarker(s string, limit int) string {
+	if limit <= 0 || len(s) <= limit {
+		return s
+	}
+
+	// The marker's width depends on the dropped count, which depends on the
+	// marker's width; iterate until the two agree.
+	dropped := len(s) - limit
+	var marker string
+	var keep int
+	for {
+		marker = "\n" + TruncationMarker(dropped) + "\n"
+		keep = limit - len(marker)
+		if keep <= 0 {
+			return strings.ToValidUTF8(s[:limit], "")
+		}
+		if len(s)-keep == dropped {
+			break
+		}
+		dropped = len(s) - keep
+	}
+
+	head := keep / 2
+	tail := keep - head
+	// Cutting at arbitrary byte offsets may split a multi-byte rune.
+	return strings.ToValidUTF8(s[:head], "") + marker + strings.ToValidUTF8(s[len(s)-tail:], "")
+}
+
+// TruncationMarker returns the marker inserted in place of dropped bytes.
+func TruncationMarker(dropped int) string {
+	return fmt.Sprintf("…[truncated %d bytes]…", dropped)
+}
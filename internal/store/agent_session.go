@@ -0,0 +1,180 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+)
+
+// agentSessionColumns are the agent_sessions columns read by
+// scanAgentSession, in order.
+const agentSessionColumns = `user_id, session_id, last_proactive_msg, attempt_count,
+	just_self_corrected, is_typing, challenge_json, COALESCE(messages_json, ''), created_at, updated_at, version`
+
+// Agent session queries shared by the SQL stores; placeholders are filled in
+// per driver.
+const (
+	getAgentSessionQuery = `SELECT ` + agentSessionColumns + `
+	FROM agent_sessions WHERE user_id = %s AND session_id = %s`
+	listAgentSessionsQuery = `SELECT ` + agentSessionColumns + `
+	FROM agent_sessions WHERE user_id = %s ORDER BY updated_at DESC, session_id`
+	// upsertAgentSessionQuery creates a session at version 1, or updates one
+	// stored before versions were tracked.
+	upsertAgentSessionQuery = `
+	INSERT INTO agent_sessions (
+		user_id, session_id, last_proactive_msg, attempt_count, just_self_corrected,
+		is_typing, challenge_json, messages_json, created_at, updated_at, version
+	) VALUES (%s, %s, %s, %s, %s, %s, %s, %s, %s, %s, 1)
+	ON CONFLICT (user_id, session_id) DO UPDATE SET
+		last_proactive_msg = COALESCE(excluded.last_proactive_msg, agent_sessions.last_proactive_msg),
+		attempt_count = excluded.attempt_count,
+		just_self_corrected = excluded.just_self_corrected,
+		is_typing = excluded.is_typing,
+		challenge_json = COALESCE(excluded.challenge_json, agent_sessions.challenge_json),
+		messages_json = excluded.messages_json,
+		updated_at = excluded.updated_at,
+		version = agent_sessions.version + 1
+	WHERE agent_sessions.version = 0`
+	// updateAgentSessionQuery updates a session still at the version it was
+	// read at.
+	updateAgentSessionQuery = `
+	UPDATE agent_sessions SET
+		last_proactive_msg = COALESCE(%s, last_proactive_msg),
+		attempt_count = %s,
+		just_self_corrected = %s,
+		is_typing = %s,
+		challenge_json = COALESCE(%s, challenge_json),
+		messages_json = %s,
+		updated_at = %s,
+		version = version + 1
+	WHERE user_id = %s AND session_id = %s AND version = %s`
+)
+
+// ErrVersionConflict is returned by UpsertAgentSession when the stored
+// session is no longer at the version the caller read, because another
+// writer updated, created or archived it in the meantime.
+var ErrVersionConflict = errors.New("agent session version conflict")
+
+// upsertAgentSession writes session if the stored row is still at
+// session.Version, then advances session.Version to the stored version.
+func upsertAgentSession(ctx context.Context, db *sql.DB, d sqlDialect, session *domain.AgentSession) error {
+	query, args := fmt.Sprintf(upsertAgentSessionQuery, placeholders(d.bind, 10)...), agentSessionArgs(session)
+	if session.Version > 0 {
+		query, args = fmt.Sprintf(updateAgentSessionQuery, placeholders(d.bind, 10)...), agentSessionUpdateArgs(session)
+	}
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("upsert agent session: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("upsert agent session: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("upsert agent session at version %d: %w", session.Version, ErrVersionConflict)
+	}
+	session.Version++
+	return nil
+}
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanAgentSession reads a row selected with agentSessionColumns.
+func scanAgentSession(row rowScanner) (*domain.AgentSession, error) {
+	var session domain.AgentSession
+	var lastProactiveMsg sql.NullInt64
+	var challengeJSON sql.NullString
+	var createdAt, updatedAt int64
+	if err := row.Scan(
+		&session.UserID, &session.SessionID, &lastProactiveMsg, &session.AttemptCount,
+		&session.JustSelfCorrected, &session.IsTyping,
+		&challengeJSON, &session.MessagesJSON,
+		&createdAt, &updatedAt, &session.Version,
+	); err != nil {
+		return nil, err
+	}
+	session.CreatedAt = time.Unix(createdAt, 0)
+	session.UpdatedAt = time.Unix(updatedAt, 0)
+	if lastProactiveMsg.Valid {
+		ts := time.Unix(lastProactiveMsg.Int64, 0)
+		session.LastProactiveMsg = &ts
+	}
+	if challengeJSON.Valid {
+		session.ChallengeJSON = &challengeJSON.String
+	}
+	return &session, nil
+}
+
+// scanAgentSessions reads rows selected by listAgentSessionsQuery.
+func scanAgentSessions(rows *sql.Rows) ([]*domain.AgentSession, error) {
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			slog.Warn("failed to close rows", "query", "list_agent_sessions", "error", closeErr)
+		}
+	}()
+
+	var sessions []*domain.AgentSession
+	for rows.Next() {
+		session, err := scanAgentSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan agent session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate agent sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// agentSessionArgs returns the upsertAgentSessionQuery arguments for session.
+func agentSessionArgs(session *domain.AgentSession) []any {
+	lastProactiveMsg, challengeJSON := agentSessionOptionalArgs(session)
+	return []any{
+		session.UserID, session.SessionID, lastProactiveMsg, session.AttemptCount,
+		session.JustSelfCorrected, session.IsTyping,
+		challengeJSON, session.MessagesJSON,
+		session.CreatedAt.Unix(), time.Now().Unix(),
+	}
+}
+
+// agentSessionUpdateArgs returns the updateAgentSessionQuery arguments for
+// session.
+func agentSessionUpdateArgs(session *domain.AgentSession) []any {
+	lastProactiveMsg, challengeJSON := agentSessionOptionalArgs(session)
+	return []any{
+		lastProactiveMsg, session.AttemptCount, session.JustSelfCorrected, session.IsTyping,
+		challengeJSON, session.MessagesJSON, time.Now().Unix(),
+		session.UserID, session.SessionID, session.Version,
+	}
+}
+
+// agentSessionOptionalArgs returns the nullable columns of session; NULL
+// keeps the stored value.
+func agentSessionOptionalArgs(session *domain.AgentSession) (lastProactiveMsg, challengeJSON any) {
+	if session.LastProactiveMsg != nil {
+		lastProactiveMsg = session.LastProactiveMsg.Unix()
+	}
+	if session.ChallengeJSON != nil {
+		challengeJSON = *session.ChallengeJSON
+	}
+	return lastProactiveMsg, challengeJSON
+}
+
+// placeholders returns the first n placeholders of a driver's bind style,
+// for filling in a shared query with fmt.Sprintf.
+func placeholders(bind func(int) string, n int) []any {
+	out := make([]any, n)
+	for i := range out {
+		out[i] = bind(i + 1)
+	}
+	return out
+}
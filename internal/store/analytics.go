@@ -0,0 +1,300 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+)
+
+const (
+	// commandStatsWatermark names the analytics_watermarks row holding the
+	// last command ID folded into the daily stats.
+	commandStatsWatermark = "command_stats"
+	// commandStatsBatch bounds the commands folded in one transaction.
+	commandStatsBatch = 5000
+	// statsDayLayout formats the UTC day a command's stats are counted on.
+	statsDayLayout = "2006-01-02"
+)
+
+// postgresAnalyticsLockID keys the advisory lock that keeps servers sharing
+// a database from folding the same commands twice.
+const postgresAnalyticsLockID = 0x73687369
+
+// Placeholder styles for queries shared by the SQL stores.
+var (
+	bindQuestion = func(int) string { return "?" }
+	bindDollar   = func(n int) string { return "$" + strconv.Itoa(n) }
+)
+
+// sqlDialect holds what the shared aggregation queries need to know about a
+// driver: its placeholder style and, optionally, a lock serializing
+// aggregation transactions across servers.
+type sqlDialect struct {
+	bind func(n int) string
+	lock func(ctx context.Context, tx *sql.Tx) error
+}
+
+var (
+	sqliteDialect   = sqlDialect{bind: bindQuestion}
+	postgresDialect = sqlDialect{
+		bind: bindDollar,
+		lock: func(ctx context.Context, tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, postgresAnalyticsLockID)
+			return err
+		},
+	}
+)
+
+// StartAnalyticsWorker periodically folds newly recorded commands into the
+// daily per-user stats returned by ListDailyCommandStats. Command history
+// is trimmed per user as it grows, so the interval should be short enough
+// that no user runs more than the kept history in between.
+func StartAnalyticsWorker(ctx context.Context, repo Repository, interval time.Duration) {
+	if interval <= 0 {
+		slog.Info("Command analytics disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		slog.Info("Command analytics worker started", "interval", interval)
+
+		for {
+			select {
+			case <-ticker.C:
+				n, err := repo.AggregateCommandStats(ctx)
+				if err != nil {
+					slog.Error("Command analytics aggregation failed", "error", err)
+					continue
+				}
+				if n > 0 {
+					slog.Debug("Command analytics aggregated", "commands", n)
+				}
+			case <-ctx.Done():
+				slog.Info("Command analytics worker stopped")
+				return
+			}
+		}
+	}()
+}
+
+// commandTools returns the programs a command line runs: the first word of
+// each pipeline or list segment, without leading variable assignments or
+// wrappers such as sudo, and without a directory.
+func commandTools(command string) []string {
+	segments := strings.FieldsFunc(command, func(r rune) bool {
+		return r == '|' || r == ';' || r == '&'
+	})
+	var tools []string
+	for _, segment := range segments {
+		for _, word := range strings.Fields(segment) {
+			if strings.Contains(word, "=") && !strings.HasPrefix(word, "=") {
+				continue
+			}
+			if word == "sudo" || word == "time" || word == "env" || word == "nohup" || word == "exec" {
+				continue
+			}
+			tool := path.Base(strings.Trim(word, `"'()`))
+			if tool != "" && tool != "." && tool != "/" {
+				tools = append(tools, tool)
+			}
+			break
+		}
+	}
+	return tools
+}
+
+// dailyStats accumulates one user's commands on one day.
+type dailyStats struct {
+	commands int
+	errors   int
+	tools    map[string]struct{}
+}
+
+type statsKey struct {
+	userID string
+	day    string
+}
+
+// aggregateCommandStats folds commands recorded since the last run into the
+// daily stats tables, one batch per transaction, and returns how many were
+// folded.
+func aggregateCommandStats(ctx context.Context, db *sql.DB, d sqlDialect) (int64, error) {
+	var total int64
+	for {
+		n, err := aggregateCommandBatch(ctx, db, d)
+		total += n
+		if err != nil || n < commandStatsBatch {
+			return total, err
+		}
+	}
+}
+
+//nolint:gocognit // One transaction reads the batch, upserts stats and moves the watermark.
+func aggregateCommandBatch(ctx context.Context, db *sql.DB, d sqlDialect) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin aggregation: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	if d.lock != nil {
+		if err := d.lock(ctx, tx); err != nil {
+			return 0, fmt.Errorf("lock aggregation: %w", err)
+		}
+	}
+	bind := d.bind
+
+	var lastID int64
+	err = tx.QueryRowContext(ctx, `SELECT last_id FROM analytics_watermarks WHERE name = `+bind(1), commandStatsWatermark).Scan(&lastID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("read aggregation watermark: %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, user_id, command, exit_code, started_at FROM commands
+		WHERE id > `+bind(1)+` ORDER BY id LIMIT `+bind(2), lastID, commandStatsBatch)
+	if err != nil {
+		return 0, fmt.Errorf("query commands to aggregate: %w", err)
+	}
+	stats := make(map[statsKey]*dailyStats)
+	var n int64
+	for rows.Next() {
+		var id, startedAt int64
+		var userID, command string
+		var exitCode int
+		if err := rows.Scan(&id, &userID, &command, &exitCode, &startedAt); err != nil {
+			_ = rows.Close()
+			return 0, fmt.Errorf("scan command: %w", err)
+		}
+		key := statsKey{userID: userID, day: time.UnixMilli(startedAt).UTC().Format(statsDayLayout)}
+		s := stats[key]
+		if s == nil {
+			s = &dailyStats{tools: make(map[string]struct{})}
+			stats[key] = s
+		}
+		s.commands++
+		if exitCode > 0 {
+			s.errors++
+		}
+		for _, tool := range commandTools(command) {
+			s.tools[tool] = struct{}{}
+		}
+		lastID = id
+		n++
+	}
+	if err := rows.Close(); err != nil {
+		return 0, fmt.Errorf("close commands: %w", err)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("iterate commands: %w", err)
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	for key, s := range stats {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO command_stats_daily (user_id, day, commands, errors)
+			VALUES (`+bind(1)+`, `+bind(2)+`, `+bind(3)+`, `+bind(4)+`)
+			ON CONFLICT (user_id, day) DO UPDATE SET
+				commands = command_stats_daily.commands + excluded.commands,
+				errors = command_stats_daily.errors + excluded.errors`,
+			key.userID, key.day, s.commands, s.errors); err != nil {
+			return 0, fmt.Errorf("upsert command stats: %w", err)
+		}
+		for tool := range s.tools {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO command_tools_daily (user_id, day, tool)
+				VALUES (`+bind(1)+`, `+bind(2)+`, `+bind(3)+`)
+				ON CONFLICT (user_id, day, tool) DO NOTHING`,
+				key.userID, key.day, tool); err != nil {
+				return 0, fmt.Errorf("upsert command tool: %w", err)
+			}
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO analytics_watermarks (name, last_id) VALUES (`+bind(1)+`, `+bind(2)+`)
+		ON CONFLICT (name) DO UPDATE SET last_id = excluded.last_id`,
+		commandStatsWatermark, lastID); err != nil {
+		return 0, fmt.Errorf("update aggregation watermark: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit aggregation: %w", err)
+	}
+	return n, nil
+}
+
+// listDailyCommandStats returns a user's daily stats from since onwards,
+// oldest first.
+func listDailyCommandStats(ctx context.Context, db *sql.DB, d sqlDialect, userID string, since time.Time) ([]*domain.DailyCommandStats, error) {
+	bind := d.bind
+	rows, err := db.QueryContext(ctx, `
+		SELECT s.day, s.commands, s.errors,
+			(SELECT COUNT(*) FROM command_tools_daily t WHERE t.user_id = s.user_id AND t.day = s.day)
+		FROM command_stats_daily s
+		WHERE s.user_id = `+bind(1)+` AND s.day >= `+bind(2)+`
+		ORDER BY s.day`,
+		userID, since.UTC().Format(statsDayLayout))
+	if err != nil {
+		return nil, fmt.Errorf("query command stats: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			slog.Warn("failed to close rows", "query", "ListDailyCommandStats", "error", closeErr)
+		}
+	}()
+
+	var stats []*domain.DailyCommandStats
+	for rows.Next() {
+		var day string
+		var commands, errs, tools int
+		if err := rows.Scan(&day, &commands, &errs, &tools); err != nil {
+			return nil, fmt.Errorf("scan command stats: %w", err)
+		}
+		stats = append(stats, domain.NewDailyCommandStats(userID, day, commands, errs, tools))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate command stats: %w", err)
+	}
+	return stats, nil
+}
+
+// AggregateCommandStats folds new commands into the daily stats.
+func (s *SQLiteStore) AggregateCommandStats(ctx context.Context) (int64, error) {
+	return aggregateCommandStats(ctx, s.db, sqliteDialect)
+}
+
+// ListDailyCommandStats returns a user's daily command stats, oldest first.
+func (s *SQLiteStore) ListDailyCommandStats(ctx context.Context, userID string, since time.Time) ([]*domain.DailyCommandStats, error) {
+	return listDailyCommandStats(ctx, s.db, sqliteDialect, userID, since)
+}
+
+// AggregateCommandStats folds new commands into the daily stats.
+func (s *PostgresStore) AggregateCommandStats(ctx context.Context) (int64, error) {
+	return aggregateCommandStats(ctx, s.db, postgresDialect)
+}
+
+// ListDailyCommandStats returns a user's daily command stats, oldest first.
+func (s *PostgresStore) ListDailyCommandStats(ctx context.Context, userID string, since time.Time) ([]*domain.DailyCommandStats, error) {
+	return listDailyCommandStats(ctx, s.db, postgresDialect, userID, since)
+}
+
+// AggregateCommandStats is a no-op: command analytics need a SQL store.
+func (s *RedisStore) AggregateCommandStats(context.Context) (int64, error) {
+	return 0, nil
+}
+
+// ListDailyCommandStats returns nothing; see AggregateCommandStats.
+func (s *RedisStore) ListDailyCommandStats(context.Context, string, time.Time) ([]*domain.DailyCommandStats, error) {
+	return nil, nil
+}
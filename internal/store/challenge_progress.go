@@ -0,0 +1,438 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/redis"
+)
+
+// upsertChallengeAssignment stores a user's state in a challenge, keeping
+// the time it was first assigned.
+func upsertChallengeAssignment(ctx context.Context, db *sql.DB, d sqlDialect, a *domain.ChallengeAssignment) error {
+	challenge, err := json.Marshal(a.Challenge)
+	if err != nil {
+		return fmt.Errorf("encode challenge: %w", err)
+	}
+	bind := d.bind
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO challenge_assignments (user_id, challenge_id, challenge_json, hints_used, assigned_at, updated_at)
+		VALUES (`+bind(1)+`, `+bind(2)+`, `+bind(3)+`, `+bind(4)+`, `+bind(5)+`, `+bind(6)+`)
+		ON CONFLICT (user_id, challenge_id) DO UPDATE SET
+			challenge_json = excluded.challenge_json,
+			hints_used = excluded.hints_used,
+			updated_at = excluded.updated_at`,
+		a.UserID, a.Challenge.ID, string(challenge), a.HintsUsed, a.AssignedAt.Unix(), a.UpdatedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("upsert challenge assignment: %w", err)
+	}
+	return nil
+}
+
+// listChallengeAssignments returns a user's challenge assignments, most
+// recently updated first.
+func listChallengeAssignments(ctx context.Context, db *sql.DB, d sqlDialect, userID string) ([]*domain.ChallengeAssignment, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT challenge_json, hints_used, assigned_at, updated_at FROM challenge_assignments
+		WHERE user_id = `+d.bind(1)+`
+		ORDER BY updated_at DESC, challenge_id`,
+		userID)
+	if err != nil {
+		return nil, fmt.Errorf("query challenge assignments: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			slog.Warn("failed to close rows", "query", "ListChallengeAssignments", "error", closeErr)
+		}
+	}()
+
+	var assignments []*domain.ChallengeAssignment
+	for rows.Next() {
+		a := &domain.ChallengeAssignment{UserID: userID}
+		var challenge string
+		var assignedAt, updatedAt int64
+		if err := rows.Scan(&challenge, &a.HintsUsed, &assignedAt, &updatedAt); err != nil {
+			return nil, fmt.Errorf("scan challenge assignment: %w", err)
+		}
+		if err := json.Unmarshal([]byte(challenge), &a.Challenge); err != nil {
+			return nil, fmt.Errorf("decode challenge: %w", err)
+		}
+		a.Challenge.HintIndex = a.HintsUsed
+		a.AssignedAt = time.Unix(assignedAt, 0)
+		a.UpdatedAt = time.Unix(updatedAt, 0)
+		assignments = append(assignments, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate challenge assignments: %w", err)
+	}
+	return assignments, nil
+}
+
+// insertChallengeAttempt stores an attempt and sets its ID.
+func insertChallengeAttempt(ctx context.Context, db *sql.DB, d sqlDialect, a *domain.ChallengeAttempt) error {
+	bind := d.bind
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO challenge_attempts (user_id, challenge_id, step, passed, attempted_at)
+		VALUES (`+bind(1)+`, `+bind(2)+`, `+bind(3)+`, `+bind(4)+`, `+bind(5)+`) RETURNING id`,
+		a.UserID, a.ChallengeID, a.Step, a.Passed, a.AttemptedAt.Unix()).Scan(&a.ID)
+	if err != nil {
+		return fmt.Errorf("insert challenge attempt: %w", err)
+	}
+	return nil
+}
+
+// listChallengeAttempts returns a user's attempts at a challenge, oldest
+// first.
+func listChallengeAttempts(ctx context.Context, db *sql.DB, d sqlDialect, userID, challengeID string) ([]*domain.ChallengeAttempt, error) {
+	bind := d.bind
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, step, passed, attempted_at FROM challenge_attempts
+		WHERE user_id = `+bind(1)+` AND challenge_id = `+bind(2)+`
+		ORDER BY id`,
+		userID, challengeID)
+	if err != nil {
+		return nil, fmt.Errorf("query challenge attempts: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			slog.Warn("failed to close rows", "query", "ListChallengeAttempts", "error", closeErr)
+		}
+	}()
+
+	var attempts []*domain.ChallengeAttempt
+	for rows.Next() {
+		a := &domain.ChallengeAttempt{UserID: userID, ChallengeID: challengeID}
+		var attemptedAt int64
+		if err := rows.Scan(&a.ID, &a.Step, &a.Passed, &attemptedAt); err != nil {
+			return nil, fmt.Errorf("scan challenge attempt: %w", err)
+		}
+		a.AttemptedAt = time.Unix(attemptedAt, 0)
+		attempts = append(attempts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate challenge attempts: %w", err)
+	}
+	return attempts, nil
+}
+
+// completeChallenge stores a completion unless the user already completed
+// the challenge, and reports whether it did.
+func completeChallenge(ctx context.Context, db *sql.DB, d sqlDialect, c *domain.ChallengeCompletion) (bool, error) {
+	bind := d.bind
+	result, err := db.ExecContext(ctx, `
+		INSERT INTO challenge_completions (user_id, challenge_id, attempts, hints_used, completed_at)
+		VALUES (`+bind(1)+`, `+bind(2)+`, `+bind(3)+`, `+bind(4)+`, `+bind(5)+`)
+		ON CONFLICT (user_id, challenge_id) DO NOTHING`,
+		c.UserID, c.ChallengeID, c.Attempts, c.HintsUsed, c.CompletedAt.Unix())
+	if err != nil {
+		return false, fmt.Errorf("insert challenge completion: %w", err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("insert challenge completion: %w", err)
+	}
+	return inserted > 0, nil
+}
+
+// listChallengeCompletions returns a user's completed challenges, most
+// recent first.
+func listChallengeCompletions(ctx context.Context, db *sql.DB, d sqlDialect, userID string) ([]*domain.ChallengeCompletion, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT challenge_id, attempts, hints_used, completed_at FROM challenge_completions
+		WHERE user_id = `+d.bind(1)+`
+		ORDER BY completed_at DESC, challenge_id`,
+		userID)
+	if err != nil {
+		return nil, fmt.Errorf("query challenge completions: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			slog.Warn("failed to close rows", "query", "ListChallengeCompletions", "error", closeErr)
+		}
+	}()
+
+	var completions []*domain.ChallengeCompletion
+	for rows.Next() {
+		c := &domain.ChallengeCompletion{UserID: userID}
+		var completedAt int64
+		if err := rows.Scan(&c.ChallengeID, &c.Attempts, &c.HintsUsed, &completedAt); err != nil {
+			return nil, fmt.Errorf("scan challenge completion: %w", err)
+		}
+		c.CompletedAt = time.Unix(completedAt, 0)
+		completions = append(completions, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate challenge completions: %w", err)
+	}
+	return completions, nil
+}
+
+// UpsertChallengeAssignment stores a user's state in a challenge.
+func (s *SQLiteStore) UpsertChallengeAssignment(ctx context.Context, a *domain.ChallengeAssignment) error {
+	return upsertChallengeAssignment(ctx, s.db, sqliteDialect, a)
+}
+
+// ListChallengeAssignments returns a user's challenge assignments.
+func (s *SQLiteStore) ListChallengeAssignments(ctx context.Context, userID string) ([]*domain.ChallengeAssignment, error) {
+	return listChallengeAssignments(ctx, s.db, sqliteDialect, userID)
+}
+
+// InsertChallengeAttempt stores an attempt at a challenge step.
+func (s *SQLiteStore) InsertChallengeAttempt(ctx context.Context, a *domain.ChallengeAttempt) error {
+	return insertChallengeAttempt(ctx, s.db, sqliteDialect, a)
+}
+
+// ListChallengeAttempts returns a user's attempts at a challenge.
+func (s *SQLiteStore) ListChallengeAttempts(ctx context.Context, userID, challengeID string) ([]*domain.ChallengeAttempt, error) {
+	return listChallengeAttempts(ctx, s.db, sqliteDialect, userID, challengeID)
+}
+
+// CompleteChallenge records the first completion of a challenge.
+func (s *SQLiteStore) CompleteChallenge(ctx context.Context, c *domain.ChallengeCompletion) (bool, error) {
+	return completeChallenge(ctx, s.db, sqliteDialect, c)
+}
+
+// ListChallengeCompletions returns a user's completed challenges.
+func (s *SQLiteStore) ListChallengeCompletions(ctx context.Context, userID string) ([]*domain.ChallengeCompletion, error) {
+	return listChallengeCompletions(ctx, s.db, sqliteDialect, userID)
+}
+
+// UpsertChallengeAssignment stores a user's state in a challenge.
+func (s *PostgresStore) UpsertChallengeAssignment(ctx context.Context, a *domain.ChallengeAssignment) error {
+	return upsertChallengeAssignment(ctx, s.db, postgresDialect, a)
+}
+
+// ListChallengeAssignments returns a user's challenge assignments.
+func (s *PostgresStore) ListChallengeAssignments(ctx context.Context, userID string) ([]*domain.ChallengeAssignment, error) {
+	return listChallengeAssignments(ctx, s.db, postgresDialect, userID)
+}
+
+// InsertChallengeAttempt stores an attempt at a challenge step.
+func (s *PostgresStore) InsertChallengeAttempt(ctx context.Context, a *domain.ChallengeAttempt) error {
+	return insertChallengeAttempt(ctx, s.db, postgresDialect, a)
+}
+
+// ListChallengeAttempts returns a user's attempts at a challenge.
+func (s *PostgresStore) ListChallengeAttempts(ctx context.Context, userID, challengeID string) ([]*domain.ChallengeAttempt, error) {
+	return listChallengeAttempts(ctx, s.db, postgresDialect, userID, challengeID)
+}
+
+// CompleteChallenge records the first completion of a challenge.
+func (s *PostgresStore) CompleteChallenge(ctx context.Context, c *domain.ChallengeCompletion) (bool, error) {
+	return completeChallenge(ctx, s.db, postgresDialect, c)
+}
+
+// ListChallengeCompletions returns a user's completed challenges.
+func (s *PostgresStore) ListChallengeCompletions(ctx context.Context, userID string) ([]*domain.ChallengeCompletion, error) {
+	return listChallengeCompletions(ctx, s.db, postgresDialect, userID)
+}
+
+// redisAssignedAtSuffix marks the field of a user's challenge assignments
+// hash holding when a challenge was first assigned, next to the field named
+// after the challenge that holds the rest of the assignment.
+const redisAssignedAtSuffix = "/assigned_at"
+
+// redisChallengeAssignment is the JSON stored per challenge in a user's
+// challenge assignments hash.
+type redisChallengeAssignment struct {
+	Challenge domain.Challenge `json:"challenge"`
+	HintsUsed int              `json:"hints_used"`
+	UpdatedAt int64            `json:"updated_at"`
+}
+
+// UpsertChallengeAssignment stores a user's state in a challenge.
+func (s *RedisStore) UpsertChallengeAssignment(ctx context.Context, a *domain.ChallengeAssignment) error {
+	data, err := json.Marshal(redisChallengeAssignment{
+		Challenge: a.Challenge,
+		HintsUsed: a.HintsUsed,
+		UpdatedAt: a.UpdatedAt.Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("encode challenge assignment: %w", err)
+	}
+	key := s.key("challenge_assignments", a.UserID)
+	if _, err := s.client.Tx(ctx,
+		[]any{"HSET", key, a.Challenge.ID, string(data)},
+		[]any{"HSETNX", key, a.Challenge.ID + redisAssignedAtSuffix, a.AssignedAt.Unix()},
+	); err != nil {
+		return fmt.Errorf("upsert challenge assignment: %w", err)
+	}
+	return nil
+}
+
+// ListChallengeAssignments returns a user's challenge assignments, most
+// recently updated first.
+func (s *RedisStore) ListChallengeAssignments(ctx context.Context, userID string) ([]*domain.ChallengeAssignment, error) {
+	reply, err := s.client.Do(ctx, "HGETALL", s.key("challenge_assignments", userID))
+	if err != nil {
+		return nil, fmt.Errorf("query challenge assignments: %w", err)
+	}
+	fields, err := redisHash(reply)
+	if err != nil {
+		return nil, fmt.Errorf("query challenge assignments: %w", err)
+	}
+
+	var assignments []*domain.ChallengeAssignment
+	for field, item := range fields {
+		if strings.HasSuffix(field, redisAssignedAtSuffix) {
+			continue
+		}
+		var stored redisChallengeAssignment
+		if err := json.Unmarshal([]byte(item), &stored); err != nil {
+			return nil, fmt.Errorf("decode challenge assignment: %w", err)
+		}
+		stored.Challenge.HintIndex = stored.HintsUsed
+		assignments = append(assignments, &domain.ChallengeAssignment{
+			UserID:     userID,
+			Challenge:  stored.Challenge,
+			HintsUsed:  stored.HintsUsed,
+			AssignedAt: time.Unix(redisInt(fields[field+redisAssignedAtSuffix]), 0),
+			UpdatedAt:  time.Unix(stored.UpdatedAt, 0),
+		})
+	}
+	sort.Slice(assignments, func(i, j int) bool {
+		if !assignments[i].UpdatedAt.Equal(assignments[j].UpdatedAt) {
+			return assignments[i].UpdatedAt.After(assignments[j].UpdatedAt)
+		}
+		return assignments[i].Challenge.ID < assignments[j].Challenge.ID
+	})
+	return assignments, nil
+}
+
+// redisChallengeAttempt is the JSON stored per attempt in a user's challenge
+// attempts list.
+type redisChallengeAttempt struct {
+	ID          int64  `json:"id"`
+	ChallengeID string `json:"challenge_id"`
+	Step        int    `json:"step"`
+	Passed      bool   `json:"passed"`
+	AttemptedAt int64  `json:"attempted_at"`
+}
+
+// InsertChallengeAttempt stores an attempt at a challenge step.
+func (s *RedisStore) InsertChallengeAttempt(ctx context.Context, a *domain.ChallengeAttempt) error {
+	reply, err := s.client.Do(ctx, "INCR", s.key("challenge_attempts", "seq"))
+	if err != nil {
+		return fmt.Errorf("insert challenge attempt: %w", err)
+	}
+	id, ok := reply.(int64)
+	if !ok {
+		return fmt.Errorf("insert challenge attempt: %w", redis.ErrProtocol)
+	}
+	data, err := json.Marshal(redisChallengeAttempt{
+		ID:          id,
+		ChallengeID: a.ChallengeID,
+		Step:        a.Step,
+		Passed:      a.Passed,
+		AttemptedAt: a.AttemptedAt.Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("encode challenge attempt: %w", err)
+	}
+	if _, err := s.client.Do(ctx, "RPUSH", s.key("challenge_attempts", a.UserID), string(data)); err != nil {
+		return fmt.Errorf("insert challenge attempt: %w", err)
+	}
+	a.ID = id
+	return nil
+}
+
+// ListChallengeAttempts returns a user's attempts at a challenge, oldest
+// first.
+func (s *RedisStore) ListChallengeAttempts(ctx context.Context, userID, challengeID string) ([]*domain.ChallengeAttempt, error) {
+	reply, err := s.client.Do(ctx, "LRANGE", s.key("challenge_attempts", userID), 0, -1)
+	if err != nil {
+		return nil, fmt.Errorf("query challenge attempts: %w", err)
+	}
+	items, err := redisStrings(reply)
+	if err != nil {
+		return nil, fmt.Errorf("query challenge attempts: %w", err)
+	}
+
+	var attempts []*domain.ChallengeAttempt
+	for _, item := range items {
+		var stored redisChallengeAttempt
+		if err := json.Unmarshal([]byte(item), &stored); err != nil {
+			return nil, fmt.Errorf("decode challenge attempt: %w", err)
+		}
+		if stored.ChallengeID != challengeID {
+			continue
+		}
+		attempts = append(attempts, &domain.ChallengeAttempt{
+			ID:          stored.ID,
+			UserID:      userID,
+			ChallengeID: stored.ChallengeID,
+			Step:        stored.Step,
+			Passed:      stored.Passed,
+			AttemptedAt: time.Unix(stored.AttemptedAt, 0),
+		})
+	}
+	return attempts, nil
+}
+
+// redisChallengeCompletion is the JSON stored per challenge in a user's
+// challenge completions hash.
+type redisChallengeCompletion struct {
+	Attempts    int   `json:"attempts"`
+	HintsUsed   int   `json:"hints_used"`
+	CompletedAt int64 `json:"completed_at"`
+}
+
+// CompleteChallenge records the first completion of a challenge.
+func (s *RedisStore) CompleteChallenge(ctx context.Context, c *domain.ChallengeCompletion) (bool, error) {
+	data, err := json.Marshal(redisChallengeCompletion{
+		Attempts:    c.Attempts,
+		HintsUsed:   c.HintsUsed,
+		CompletedAt: c.CompletedAt.Unix(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("encode challenge completion: %w", err)
+	}
+	reply, err := s.client.Do(ctx, "HSETNX", s.key("challenge_completions", c.UserID), c.ChallengeID, string(data))
+	if err != nil {
+		return false, fmt.Errorf("insert challenge completion: %w", err)
+	}
+	inserted, _ := reply.(int64)
+	return inserted == 1, nil
+}
+
+// ListChallengeCompletions returns a user's completed challenges, most
+// recent first.
+func (s *RedisStore) ListChallengeCompletions(ctx context.Context, userID string) ([]*domain.ChallengeCompletion, error) {
+	reply, err := s.client.Do(ctx, "HGETALL", s.key("challenge_completions", userID))
+	if err != nil {
+		return nil, fmt.Errorf("query challenge completions: %w", err)
+	}
+	fields, err := redisHash(reply)
+	if err != nil {
+		return nil, fmt.Errorf("query challenge completions: %w", err)
+	}
+
+	var completions []*domain.ChallengeCompletion
+	for challengeID, item := range fields {
+		var stored redisChallengeCompletion
+		if err := json.Unmarshal([]byte(item), &stored); err != nil {
+			return nil, fmt.Errorf("decode challenge completion: %w", err)
+		}
+		completions = append(completions, &domain.ChallengeCompletion{
+			UserID:      userID,
+			ChallengeID: challengeID,
+			Attempts:    stored.Attempts,
+			HintsUsed:   stored.HintsUsed,
+			CompletedAt: time.Unix(stored.CompletedAt, 0),
+		})
+	}
+	sort.Slice(completions, func(i, j int) bool {
+		if !completions[i].CompletedAt.Equal(completions[j].CompletedAt) {
+			return completions[i].CompletedAt.After(completions[j].CompletedAt)
+		}
+		return completions[i].ChallengeID < completions[j].ChallengeID
+	})
+	return completions, nil
+}
@@ -0,0 +1,156 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+)
+
+// upsertChallengeCheckpoint stores a checkpoint, replacing an earlier one
+// for the same step.
+func upsertChallengeCheckpoint(ctx context.Context, db *sql.DB, d sqlDialect, c *domain.ChallengeCheckpoint) error {
+	diff, err := json.Marshal(c.Diff)
+	if err != nil {
+		return fmt.Errorf("encode checkpoint diff: %w", err)
+	}
+	bind := d.bind
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO challenge_checkpoints (user_id, challenge_id, step, snapshot, diff_json, created_at)
+		VALUES (`+bind(1)+`, `+bind(2)+`, `+bind(3)+`, `+bind(4)+`, `+bind(5)+`, `+bind(6)+`)
+		ON CONFLICT (user_id, challenge_id, step) DO UPDATE SET
+			snapshot = excluded.snapshot,
+			diff_json = excluded.diff_json,
+			created_at = excluded.created_at`,
+		c.UserID, c.ChallengeID, c.Step, c.Snapshot, string(diff), c.CreatedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("upsert challenge checkpoint: %w", err)
+	}
+	return nil
+}
+
+// listChallengeCheckpoints returns a user's checkpoints for a challenge,
+// ordered by step.
+func listChallengeCheckpoints(ctx context.Context, db *sql.DB, d sqlDialect, userID, challengeID string) ([]*domain.ChallengeCheckpoint, error) {
+	bind := d.bind
+	rows, err := db.QueryContext(ctx, `
+		SELECT step, snapshot, diff_json, created_at FROM challenge_checkpoints
+		WHERE user_id = `+bind(1)+` AND challenge_id = `+bind(2)+`
+		ORDER BY step`,
+		userID, challengeID)
+	if err != nil {
+		return nil, fmt.Errorf("query challenge checkpoints: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			slog.Warn("failed to close rows", "query", "ListChallengeCheckpoints", "error", closeErr)
+		}
+	}()
+
+	var checkpoints []*domain.ChallengeCheckpoint
+	for rows.Next() {
+		c := &domain.ChallengeCheckpoint{UserID: userID, ChallengeID: challengeID}
+		var diff string
+		var createdAt int64
+		if err := rows.Scan(&c.Step, &c.Snapshot, &diff, &createdAt); err != nil {
+			return nil, fmt.Errorf("scan challenge checkpoint: %w", err)
+		}
+		if err := json.Unmarshal([]byte(diff), &c.Diff); err != nil {
+			return nil, fmt.Errorf("decode checkpoint diff: %w", err)
+		}
+		c.CreatedAt = time.Unix(createdAt, 0)
+		checkpoints = append(checkpoints, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate challenge checkpoints: %w", err)
+	}
+	return checkpoints, nil
+}
+
+// UpsertChallengeCheckpoint stores a challenge step checkpoint.
+func (s *SQLiteStore) UpsertChallengeCheckpoint(ctx context.Context, c *domain.ChallengeCheckpoint) error {
+	return upsertChallengeCheckpoint(ctx, s.db, sqliteDialect, c)
+}
+
+// ListChallengeCheckpoints returns a user's checkpoints for a challenge.
+func (s *SQLiteStore) ListChallengeCheckpoints(ctx context.Context, userID, challengeID string) ([]*domain.ChallengeCheckpoint, error) {
+	return listChallengeCheckpoints(ctx, s.db, sqliteDialect, userID, challengeID)
+}
+
+// UpsertChallengeCheckpoint stores a challenge step checkpoint.
+func (s *PostgresStore) UpsertChallengeCheckpoint(ctx context.Context, c *domain.ChallengeCheckpoint) error {
+	return upsertChallengeCheckpoint(ctx, s.db, postgresDialect, c)
+}
+
+// ListChallengeCheckpoints returns a user's checkpoints for a challenge.
+func (s *PostgresStore) ListChallengeCheckpoints(ctx context.Context, userID, challengeID string) ([]*domain.ChallengeCheckpoint, error) {
+	return listChallengeCheckpoints(ctx, s.db, postgresDialect, userID, challengeID)
+}
+
+// redisCheckpoint is the JSON stored per step in a user's checkpoints hash,
+// under the field "<challenge>/<step>".
+type redisCheckpoint struct {
+	ChallengeID string                `json:"challenge_id"`
+	Step        int                   `json:"step"`
+	Snapshot    string                `json:"snapshot"`
+	Diff        domain.FilesystemDiff `json:"diff"`
+	CreatedAt   int64                 `json:"created_at"`
+}
+
+// UpsertChallengeCheckpoint stores a challenge step checkpoint.
+func (s *RedisStore) UpsertChallengeCheckpoint(ctx context.Context, c *domain.ChallengeCheckpoint) error {
+	data, err := json.Marshal(redisCheckpoint{
+		ChallengeID: c.ChallengeID,
+		Step:        c.Step,
+		Snapshot:    c.Snapshot,
+		Diff:        c.Diff,
+		CreatedAt:   c.CreatedAt.Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("encode challenge checkpoint: %w", err)
+	}
+	field := c.ChallengeID + "/" + strconv.Itoa(c.Step)
+	if _, err := s.client.Do(ctx, "HSET", s.key("checkpoints", c.UserID), field, string(data)); err != nil {
+		return fmt.Errorf("upsert challenge checkpoint: %w", err)
+	}
+	return nil
+}
+
+// ListChallengeCheckpoints returns a user's checkpoints for a challenge.
+func (s *RedisStore) ListChallengeCheckpoints(ctx context.Context, userID, challengeID string) ([]*domain.ChallengeCheckpoint, error) {
+	reply, err := s.client.Do(ctx, "HGETALL", s.key("checkpoints", userID))
+	if err != nil {
+		return nil, fmt.Errorf("query challenge checkpoints: %w", err)
+	}
+	fields, err := redisHash(reply)
+	if err != nil {
+		return nil, fmt.Errorf("query challenge checkpoints: %w", err)
+	}
+
+	var checkpoints []*domain.ChallengeCheckpoint
+	for _, item := range fields {
+		var stored redisCheckpoint
+		if err := json.Unmarshal([]byte(item), &stored); err != nil {
+			return nil, fmt.Errorf("decode challenge checkpoint: %w", err)
+		}
+		if stored.ChallengeID != challengeID {
+			continue
+		}
+		checkpoints = append(checkpoints, &domain.ChallengeCheckpoint{
+			UserID:      userID,
+			ChallengeID: stored.ChallengeID,
+			Step:        stored.Step,
+			Snapshot:    stored.Snapshot,
+			Diff:        stored.Diff,
+			CreatedAt:   time.Unix(stored.CreatedAt, 0),
+		})
+	}
+	sort.Slice(checkpoints, func(i, j int) bool { return checkpoints[i].Step < checkpoints[j].Step })
+	return checkpoints, nil
+}
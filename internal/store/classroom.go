@@ -0,0 +1,32 @@
+package store
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Classrooms resolves a user's classroom from their record, as assigned with
+// SetClassroom. It serves the classroom resolvers of the agent, terminal and
+// challenge handlers.
+type Classrooms struct {
+	repo Repository
+}
+
+// NewClassrooms creates a classroom resolver reading users from repo.
+func NewClassrooms(repo Repository) *Classrooms {
+	return &Classrooms{repo: repo}
+}
+
+// ClassroomOf returns the user's classroom, or "" if they are in none or
+// their record cannot be read.
+func (c *Classrooms) ClassroomOf(ctx context.Context, userID string) string {
+	user, err := c.repo.GetUser(ctx, userID)
+	if err != nil {
+		slog.Warn("Failed to resolve classroom", "error", err, "user_id", userID)
+		return ""
+	}
+	if user == nil {
+		return ""
+	}
+	return user.Classroom
+}
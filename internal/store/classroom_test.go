@@ -0,0 +1,30 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+)
+
+func TestClassroomOf(t *testing.T) {
+	repo := newTestSQLite(t)
+	ctx := t.Context()
+	classrooms := NewClassrooms(repo)
+
+	if err := repo.UpsertUser(ctx, &domain.User{UserID: "alice", Username: "alice", LastSeenAt: time.Now()}); err != nil {
+		t.Fatalf("UpsertUser: %v", err)
+	}
+	if got := classrooms.ClassroomOf(ctx, "alice"); got != "" {
+		t.Fatalf("ClassroomOf an unassigned user = %q", got)
+	}
+	if err := repo.SetClassroom(ctx, "alice", "period-3"); err != nil {
+		t.Fatalf("SetClassroom: %v", err)
+	}
+	if got := classrooms.ClassroomOf(ctx, "alice"); got != "period-3" {
+		t.Fatalf("ClassroomOf = %q, want period-3", got)
+	}
+	if got := classrooms.ClassroomOf(ctx, "bob"); got != "" {
+		t.Fatalf("ClassroomOf a missing user = %q", got)
+	}
+}
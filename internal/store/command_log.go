@@ -0,0 +1,440 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+)
+
+// defaultCommandLogSegmentSize is the size a segment file grows to before
+// the next command starts a new one.
+const defaultCommandLogSegmentSize = 1 << 20
+
+// commandLogSuffix names segment files, which are called after the ID of
+// their first command.
+const commandLogSuffix = ".log"
+
+// CommandLogRepository wraps a Repository and keeps command history in
+// per-user append-only segment files instead of the wrapped store, for
+// classrooms where a row write per command is too slow. Each user's live
+// commands are indexed in memory by file offset; the index is rebuilt from
+// the files the first time a user is accessed. Commands beyond
+// maxCommandsPerUser are dropped from the index, and a user's segments are
+// compacted into one once they hold as many dropped commands as live ones.
+//
+// Command analytics read history from the SQL tables, so they do not cover
+// commands kept here.
+type CommandLogRepository struct {
+	Repository
+
+	dir         string
+	segmentSize int64
+
+	mu    sync.Mutex
+	users map[string]*commandLogUser
+}
+
+// commandLogUser is the index of one user's segment files.
+type commandLogUser struct {
+	mu       sync.Mutex
+	dir      string
+	loaded   bool
+	entries  []commandLogEntry // Live commands, oldest first
+	segments []int64           // Segment numbers, oldest first
+	size     int64             // Size of the newest segment
+	dead     int               // Dropped commands still in the segments
+	nextID   int64
+}
+
+// commandLogEntry locates one command in a segment file.
+type commandLogEntry struct {
+	id        int64
+	sessionID string
+	segment   int64
+	offset    int64
+	length    int64
+}
+
+// commandLogRecord is one line of a segment file.
+type commandLogRecord struct {
+	ID         int64  `json:"id"`
+	SessionID  string `json:"session_id"`
+	Sequence   int    `json:"sequence"`
+	Command    string `json:"command"`
+	PWD        string `json:"pwd,omitempty"`
+	ExitCode   int    `json:"exit_code"`
+	DurationMs int64  `json:"duration_ms"`
+	StartedAt  int64  `json:"started_at"`
+	EndedAt    int64  `json:"ended_at"`
+}
+
+var _ Repository = (*CommandLogRepository)(nil)
+
+// NewCommandLog wraps repo so command history is kept in segment files under
+// dir. An empty dir returns repo unchanged; a segmentSize <= 0 uses 1MB.
+func NewCommandLog(repo Repository, dir string, segmentSize int64) (Repository, error) {
+	if dir == "" {
+		return repo, nil
+	}
+	if segmentSize <= 0 {
+		segmentSize = defaultCommandLogSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create command log directory: %w", err)
+	}
+	return &CommandLogRepository{
+		Repository:  repo,
+		dir:         dir,
+		segmentSize: segmentSize,
+		users:       make(map[string]*commandLogUser),
+	}, nil
+}
+
+// user returns the index of a user's segments, creating it unloaded.
+func (r *CommandLogRepository) user(userID string) *commandLogUser {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u := r.users[userID]
+	if u == nil {
+		// User IDs are hex encoded so any ID is a safe directory name.
+		u = &commandLogUser{dir: filepath.Join(r.dir, hex.EncodeToString([]byte(userID)))}
+		r.users[userID] = u
+	}
+	return u
+}
+
+// InsertCommand appends a command to the user's newest segment and sets c.ID.
+func (r *CommandLogRepository) InsertCommand(_ context.Context, c *domain.CommandRecord) error {
+	u := r.user(c.UserID)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.load(); err != nil {
+		return err
+	}
+
+	id := u.nextID
+	line, err := json.Marshal(commandLogRecord{
+		ID:         id,
+		SessionID:  c.SessionID,
+		Sequence:   c.Sequence,
+		Command:    c.Command,
+		PWD:        c.PWD,
+		ExitCode:   c.ExitCode,
+		DurationMs: c.Duration.Milliseconds(),
+		StartedAt:  c.StartedAt.UnixMilli(),
+		EndedAt:    c.EndedAt.UnixMilli(),
+	})
+	if err != nil {
+		return fmt.Errorf("encode command: %w", err)
+	}
+	line = append(line, '\n')
+
+	if len(u.segments) == 0 || (u.size > 0 && u.size+int64(len(line)) > r.segmentSize) {
+		u.segments = append(u.segments, id)
+		u.size = 0
+	}
+	segment := u.segments[len(u.segments)-1]
+	if err := appendFile(u.segmentPath(segment), line); err != nil {
+		return fmt.Errorf("insert command: %w", err)
+	}
+	u.entries = append(u.entries, commandLogEntry{
+		id:        id,
+		sessionID: c.SessionID,
+		segment:   segment,
+		offset:    u.size,
+		length:    int64(len(line)),
+	})
+	u.size += int64(len(line))
+	u.nextID++
+	c.ID = id
+
+	if n := len(u.entries) - maxCommandsPerUser; n > 0 {
+		u.entries = u.entries[n:]
+		u.dead += n
+	}
+	if u.dead >= len(u.entries) {
+		if err := u.compact(); err != nil {
+			return fmt.Errorf("compact command log: %w", err)
+		}
+	}
+	return nil
+}
+
+// ListCommands returns a user's commands, newest first, reading only those
+// selected through the index.
+func (r *CommandLogRepository) ListCommands(_ context.Context, userID, sessionID string, limit int) ([]*domain.CommandRecord, error) {
+	u := r.user(userID)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.load(); err != nil {
+		return nil, err
+	}
+
+	var selected []commandLogEntry
+	for i := len(u.entries) - 1; i >= 0; i-- {
+		if limit > 0 && len(selected) == limit {
+			break
+		}
+		if sessionID == "" || u.entries[i].sessionID == sessionID {
+			selected = append(selected, u.entries[i])
+		}
+	}
+
+	files := make(map[int64]*os.File)
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	commands := make([]*domain.CommandRecord, 0, len(selected))
+	for _, e := range selected {
+		f := files[e.segment]
+		if f == nil {
+			opened, err := os.Open(u.segmentPath(e.segment))
+			if err != nil {
+				return nil, fmt.Errorf("open command log: %w", err)
+			}
+			f = opened
+			files[e.segment] = f
+		}
+		buf := make([]byte, e.length)
+		if _, err := f.ReadAt(buf, e.offset); err != nil {
+			return nil, fmt.Errorf("read command log: %w", err)
+		}
+		var rec commandLogRecord
+		if err := json.Unmarshal(buf, &rec); err != nil {
+			return nil, fmt.Errorf("decode command: %w", err)
+		}
+		commands = append(commands, rec.command(userID))
+	}
+	return commands, nil
+}
+
+// ExportUserData returns everything stored about a user, with command history
+// read from the segment files.
+func (r *CommandLogRepository) ExportUserData(ctx context.Context, userID string) (*domain.UserDataExport, error) {
+	return exportUserData(ctx, r, userID)
+}
+
+// PurgeUser deletes a user's segment files along with their other records.
+func (r *CommandLogRepository) PurgeUser(ctx context.Context, userID string) error {
+	u := r.user(userID)
+	if err := func() error {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		if err := os.RemoveAll(u.dir); err != nil {
+			return fmt.Errorf("purge command log: %w", err)
+		}
+		u.reset()
+		return nil
+	}(); err != nil {
+		return err
+	}
+	return r.Repository.PurgeUser(ctx, userID)
+}
+
+// command converts a record to a CommandRecord.
+func (rec *commandLogRecord) command(userID string) *domain.CommandRecord {
+	return &domain.CommandRecord{
+		ID:        rec.ID,
+		UserID:    userID,
+		SessionID: rec.SessionID,
+		Sequence:  rec.Sequence,
+		Command:   rec.Command,
+		PWD:       rec.PWD,
+		ExitCode:  rec.ExitCode,
+		Duration:  time.Duration(rec.DurationMs) * time.Millisecond,
+		StartedAt: time.UnixMilli(rec.StartedAt),
+		EndedAt:   time.UnixMilli(rec.EndedAt),
+	}
+}
+
+// reset forgets the index, so the next access reloads it. u.mu must be held.
+func (u *commandLogUser) reset() {
+	u.loaded = false
+	u.entries = nil
+	u.segments = nil
+	u.size = 0
+	u.dead = 0
+	u.nextID = 0
+}
+
+func (u *commandLogUser) segmentPath(segment int64) string {
+	return filepath.Join(u.dir, fmt.Sprintf("%020d%s", segment, commandLogSuffix))
+}
+
+// load builds the index from the user's segment files on first access. A
+// torn last line, left by a crash mid-append, is truncated away. u.mu must
+// be held.
+func (u *commandLogUser) load() error {
+	if u.loaded {
+		return nil
+	}
+	if err := os.MkdirAll(u.dir, 0o750); err != nil {
+		return fmt.Errorf("create command log directory: %w", err)
+	}
+	names, err := os.ReadDir(u.dir)
+	if err != nil {
+		return fmt.Errorf("list command log segments: %w", err)
+	}
+	var segments []int64
+	for _, entry := range names {
+		name, ok := strings.CutSuffix(entry.Name(), commandLogSuffix)
+		if !ok {
+			continue
+		}
+		if segment, err := strconv.ParseInt(name, 10, 64); err == nil {
+			segments = append(segments, segment)
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+
+	u.reset()
+	u.segments = segments
+	u.nextID = 1
+	for _, segment := range segments {
+		size, err := u.scan(segment)
+		if err != nil {
+			return err
+		}
+		u.size = size
+	}
+	if n := len(u.entries) - maxCommandsPerUser; n > 0 {
+		u.entries = u.entries[n:]
+		u.dead += n
+	}
+	u.loaded = true
+	return nil
+}
+
+// scan indexes the commands of one segment and returns its valid size.
+func (u *commandLogUser) scan(segment int64) (int64, error) {
+	path := u.segmentPath(segment)
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("open command log: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	reader := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				if err := os.Truncate(path, offset); err != nil {
+					return 0, fmt.Errorf("truncate torn command log: %w", err)
+				}
+			}
+			return offset, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("read command log: %w", err)
+		}
+		// Records seen in an earlier segment survive a crash during compact.
+		var rec commandLogRecord
+		if json.Unmarshal(line, &rec) == nil && rec.ID >= u.nextID {
+			u.entries = append(u.entries, commandLogEntry{
+				id:        rec.ID,
+				sessionID: rec.SessionID,
+				segment:   segment,
+				offset:    offset,
+				length:    int64(len(line)),
+			})
+			u.nextID = max(u.nextID, rec.ID+1)
+		}
+		offset += int64(len(line))
+	}
+}
+
+// compact rewrites the live commands into a single new segment and removes
+// the old ones. The new segment is written to a temporary file and renamed
+// into place, so a crash leaves either the old segments or both, and load
+// skips the duplicates. u.mu must be held.
+func (u *commandLogUser) compact() error {
+	if len(u.entries) == 0 {
+		return nil
+	}
+	segment := u.entries[0].id
+	tmp, err := os.CreateTemp(u.dir, "compact-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	entries := make([]commandLogEntry, 0, len(u.entries))
+	var offset int64
+	err = func() error {
+		defer func() { _ = tmp.Close() }()
+		files := make(map[int64]*os.File)
+		defer func() {
+			for _, f := range files {
+				_ = f.Close()
+			}
+		}()
+		for _, e := range u.entries {
+			f := files[e.segment]
+			if f == nil {
+				opened, err := os.Open(u.segmentPath(e.segment))
+				if err != nil {
+					return err
+				}
+				f = opened
+				files[e.segment] = f
+			}
+			if _, err := io.Copy(tmp, io.NewSectionReader(f, e.offset, e.length)); err != nil {
+				return err
+			}
+			e.segment, e.offset = segment, offset
+			entries = append(entries, e)
+			offset += e.length
+		}
+		return tmp.Sync()
+	}()
+	if err != nil {
+		return err
+	}
+
+	old := u.segments
+	if err := os.Rename(tmp.Name(), u.segmentPath(segment)); err != nil {
+		return err
+	}
+	for _, s := range old {
+		if s != segment {
+			if err := os.Remove(u.segmentPath(s)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	u.entries = entries
+	u.segments = []int64{segment}
+	u.size = offset
+	u.dead = 0
+	return nil
+}
+
+// appendFile appends data to the file at path, creating it if needed.
+func appendFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,190 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/redis"
+)
+
+// insertContainerEvent appends to a user's container audit log and sets e.ID.
+func insertContainerEvent(ctx context.Context, db *sql.DB, d sqlDialect, e *domain.ContainerEvent) error {
+	bind := d.bind
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO container_events (user_id, container_id, event, reason, created_at)
+		VALUES (`+bind(1)+`, `+bind(2)+`, `+bind(3)+`, `+bind(4)+`, `+bind(5)+`)
+		RETURNING id`,
+		e.UserID, e.ContainerID, string(e.Event), e.Reason, e.CreatedAt.UnixMilli()).Scan(&e.ID)
+	if err != nil {
+		return fmt.Errorf("insert container event: %w", err)
+	}
+	return nil
+}
+
+// listContainerEvents returns up to limit of a user's container events,
+// newest first.
+func listContainerEvents(ctx context.Context, db *sql.DB, d sqlDialect, userID string, limit int) ([]*domain.ContainerEvent, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, container_id, event, reason, created_at FROM container_events
+		WHERE user_id = `+d.bind(1)+`
+		ORDER BY id DESC
+		LIMIT `+d.bind(2),
+		userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query container events: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			slog.Warn("failed to close rows", "query", "ListContainerEvents", "error", closeErr)
+		}
+	}()
+
+	var events []*domain.ContainerEvent
+	for rows.Next() {
+		e := &domain.ContainerEvent{UserID: userID}
+		var event string
+		var createdAt int64
+		if err := rows.Scan(&e.ID, &e.ContainerID, &event, &e.Reason, &createdAt); err != nil {
+			return nil, fmt.Errorf("scan container event: %w", err)
+		}
+		e.Event = domain.ContainerEventType(event)
+		e.CreatedAt = time.UnixMilli(createdAt)
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate container events: %w", err)
+	}
+	return events, nil
+}
+
+// pruneContainerEvents deletes container events older than retention.
+func pruneContainerEvents(ctx context.Context, db *sql.DB, d sqlDialect, retention time.Duration) (int64, error) {
+	result, err := db.ExecContext(ctx, `DELETE FROM container_events WHERE created_at < `+d.bind(1),
+		time.Now().Add(-retention).UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("prune container events: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("prune container events: %w", err)
+	}
+	return n, nil
+}
+
+// InsertContainerEvent appends to a user's container audit log.
+func (s *SQLiteStore) InsertContainerEvent(ctx context.Context, e *domain.ContainerEvent) error {
+	return insertContainerEvent(ctx, s.db, sqliteDialect, e)
+}
+
+// ListContainerEvents returns a user's container events, newest first.
+func (s *SQLiteStore) ListContainerEvents(ctx context.Context, userID string, limit int) ([]*domain.ContainerEvent, error) {
+	return listContainerEvents(ctx, s.db, sqliteDialect, userID, limit)
+}
+
+// PruneContainerEvents deletes container events older than retention.
+func (s *SQLiteStore) PruneContainerEvents(ctx context.Context, retention time.Duration) (int64, error) {
+	return pruneContainerEvents(ctx, s.db, sqliteDialect, retention)
+}
+
+// InsertContainerEvent appends to a user's container audit log.
+func (s *PostgresStore) InsertContainerEvent(ctx context.Context, e *domain.ContainerEvent) error {
+	return insertContainerEvent(ctx, s.db, postgresDialect, e)
+}
+
+// ListContainerEvents returns a user's container events, newest first.
+func (s *PostgresStore) ListContainerEvents(ctx context.Context, userID string, limit int) ([]*domain.ContainerEvent, error) {
+	return listContainerEvents(ctx, s.db, postgresDialect, userID, limit)
+}
+
+// PruneContainerEvents deletes container events older than retention.
+func (s *PostgresStore) PruneContainerEvents(ctx context.Context, retention time.Duration) (int64, error) {
+	return pruneContainerEvents(ctx, s.db, postgresDialect, retention)
+}
+
+// redisContainerEventLimit caps a user's container event list in Redis,
+// which is trimmed on insert instead of pruned by age.
+const redisContainerEventLimit = 500
+
+// redisContainerEvent is the JSON stored per event in a user's container
+// events list.
+type redisContainerEvent struct {
+	ID          int64  `json:"id"`
+	ContainerID string `json:"container_id"`
+	Event       string `json:"event"`
+	Reason      string `json:"reason,omitempty"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+// InsertContainerEvent prepends to a user's container events list, keeping
+// the newest redisContainerEventLimit entries.
+func (s *RedisStore) InsertContainerEvent(ctx context.Context, e *domain.ContainerEvent) error {
+	reply, err := s.client.Do(ctx, "INCR", s.key("container_events", "seq"))
+	if err != nil {
+		return fmt.Errorf("insert container event: %w", err)
+	}
+	id, ok := reply.(int64)
+	if !ok {
+		return fmt.Errorf("insert container event: %w", redis.ErrProtocol)
+	}
+	data, err := json.Marshal(redisContainerEvent{
+		ID:          id,
+		ContainerID: e.ContainerID,
+		Event:       string(e.Event),
+		Reason:      e.Reason,
+		CreatedAt:   e.CreatedAt.UnixMilli(),
+	})
+	if err != nil {
+		return fmt.Errorf("encode container event: %w", err)
+	}
+	key := s.key("container_events", e.UserID)
+	if _, err := s.client.Tx(ctx,
+		[]any{"LPUSH", key, string(data)},
+		[]any{"LTRIM", key, 0, redisContainerEventLimit - 1},
+	); err != nil {
+		return fmt.Errorf("insert container event: %w", err)
+	}
+	e.ID = id
+	return nil
+}
+
+// ListContainerEvents returns a user's container events, newest first.
+func (s *RedisStore) ListContainerEvents(ctx context.Context, userID string, limit int) ([]*domain.ContainerEvent, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	reply, err := s.client.Do(ctx, "LRANGE", s.key("container_events", userID), 0, limit-1)
+	if err != nil {
+		return nil, fmt.Errorf("query container events: %w", err)
+	}
+	items, err := redisStrings(reply)
+	if err != nil {
+		return nil, fmt.Errorf("query container events: %w", err)
+	}
+
+	events := make([]*domain.ContainerEvent, 0, len(items))
+	for _, item := range items {
+		var stored redisContainerEvent
+		if err := json.Unmarshal([]byte(item), &stored); err != nil {
+			return nil, fmt.Errorf("decode container event: %w", err)
+		}
+		events = append(events, &domain.ContainerEvent{
+			ID:          stored.ID,
+			UserID:      userID,
+			ContainerID: stored.ContainerID,
+			Event:       domain.ContainerEventType(stored.Event),
+			Reason:      stored.Reason,
+			CreatedAt:   time.UnixMilli(stored.CreatedAt),
+		})
+	}
+	return events, nil
+}
+
+// PruneContainerEvents is a no-op: Redis event lists are capped on insert.
+func (s *RedisStore) PruneContainerEvents(context.Context, time.Duration) (int64, error) {
+	return 0, nil
+}
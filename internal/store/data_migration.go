@@ -0,0 +1,577 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+)
+
+// dataMigrationBatchRows is how many rows one INSERT copies into PostgreSQL.
+const dataMigrationBatchRows = 500
+
+var (
+	// ErrTargetNotEmpty is returned by MigrateData when the PostgreSQL
+	// database already holds rows and replacing them was not asked for.
+	ErrTargetNotEmpty = errors.New("target database is not empty")
+
+	// ErrDataMismatch is returned by MigrateData when a table in PostgreSQL
+	// does not hold the same rows as in SQLite.
+	ErrDataMismatch = errors.New("target data does not match source")
+
+	errSchemaVersionMismatch = errors.New("source and target schema versions differ")
+	errMissingTargetTable    = errors.New("table missing in target database")
+	errMissingTargetColumn   = errors.New("column missing in target database")
+	errSealedSessions        = errors.New("agent sessions are encrypted; the encryption key is required")
+)
+
+// DataMigrationOptions configures MigrateData.
+type DataMigrationOptions struct {
+	// EncryptionKey is the DB_ENCRYPTION_KEY the SQLite database was written
+	// with. Agent session state is decrypted while copying, since PostgreSQL
+	// stores it in plaintext.
+	EncryptionKey string
+	// Replace empties target tables that already hold rows instead of
+	// refusing to copy.
+	Replace bool
+	// VerifyOnly compares the databases without copying.
+	VerifyOnly bool
+}
+
+// TableMigration reports the rows of one table on both sides. Checksums
+// cover every column and do not depend on row order.
+type TableMigration struct {
+	Table          string
+	SourceRows     int64
+	TargetRows     int64
+	SourceChecksum string
+	TargetChecksum string
+}
+
+// Verified reports whether the target holds the same rows as the source.
+func (t TableMigration) Verified() bool {
+	return t.SourceRows == t.TargetRows && t.SourceChecksum == t.TargetChecksum
+}
+
+// DataMigrationReport is the outcome of MigrateData.
+type DataMigrationReport struct {
+	SchemaVersion int
+	Copied        bool
+	Tables        []TableMigration
+}
+
+// Verified reports whether every table matched.
+func (r *DataMigrationReport) Verified() bool {
+	for _, table := range r.Tables {
+		if !table.Verified() {
+			return false
+		}
+	}
+	return true
+}
+
+// dataTable is a SQLite table and how its columns are stored in PostgreSQL.
+type dataTable struct {
+	name    string
+	columns []string
+	bools   map[int]bool // Column indexes stored as BOOLEAN, to nullability
+	serials []string     // Columns filled from a sequence
+}
+
+// MigrateData copies every table of the SQLite database at sqlitePath to the
+// PostgreSQL database at postgresURL, then compares row counts and checksums
+// of each table. Both schemas are migrated to the latest version first.
+//
+// The copy reads one consistent snapshot of SQLite and writes it in a single
+// PostgreSQL transaction, so it may run while servers still use SQLite: a
+// first run moves the bulk of the data and shows how long the final run,
+// after servers are stopped, takes. Rows written after the snapshot are only
+// copied by a later run with Replace. Tables are verified against the
+// snapshot; a VerifyOnly run compares against the live file and only matches
+// once servers are stopped.
+func MigrateData(ctx context.Context, sqlitePath, postgresURL string, opts DataMigrationOptions) (*DataMigrationReport, error) {
+	// NewSQLite would create a missing file.
+	if _, err := os.Stat(sqlitePath); err != nil {
+		return nil, fmt.Errorf("open source database: %w", err)
+	}
+	var enc *EncryptedRepository
+	if opts.EncryptionKey != "" {
+		repo, err := NewEncrypted(nil, opts.EncryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		enc = repo.(*EncryptedRepository)
+	}
+
+	srcRepo, err := NewSQLite(sqlitePath)
+	if err != nil {
+		return nil, fmt.Errorf("open source database: %w", err)
+	}
+	src := srcRepo.(*SQLiteStore)
+	defer func() { _ = src.Close() }()
+	dstRepo, err := NewPostgres(postgresURL, PoolOptions{MaxOpenConns: 2, MaxIdleConns: 2})
+	if err != nil {
+		return nil, fmt.Errorf("open target database: %w", err)
+	}
+	dst := dstRepo.(*PostgresStore)
+	defer func() { _ = dst.Close() }()
+
+	srcVersion, err := src.SchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dstVersion, err := dst.SchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if srcVersion != dstVersion {
+		return nil, fmt.Errorf("%w: %d and %d", errSchemaVersionMismatch, srcVersion, dstVersion)
+	}
+
+	tables, err := dataTables(ctx, src.db, dst.db)
+	if err != nil {
+		return nil, err
+	}
+	report := &DataMigrationReport{SchemaVersion: srcVersion, Copied: !opts.VerifyOnly}
+	m := &dataMigration{src: src.db, dst: dst.db, tables: tables, enc: enc}
+	if opts.VerifyOnly {
+		report.Tables, err = m.checksumSource(ctx)
+	} else {
+		report.Tables, err = m.copy(ctx, opts.Replace)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range report.Tables {
+		table := &report.Tables[i]
+		table.TargetRows, table.TargetChecksum, err = m.checksum(ctx, dst.db, tables[i], nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !report.Verified() {
+		return report, ErrDataMismatch
+	}
+	return report, nil
+}
+
+// dataTables lists the SQLite tables to copy, except the schema version
+// table, with the types their columns have in PostgreSQL.
+func dataTables(ctx context.Context, src, dst *sql.DB) ([]dataTable, error) {
+	names, err := queryStrings(ctx, src, `
+		SELECT name FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name != 'schema_version'
+		ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("list source tables: %w", err)
+	}
+	tables := make([]dataTable, 0, len(names))
+	for _, name := range names {
+		table, err := describeTable(ctx, src, dst, name)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+// describeTable reads the columns of one table on both sides.
+func describeTable(ctx context.Context, src, dst *sql.DB, name string) (dataTable, error) {
+	table := dataTable{name: name, bools: map[int]bool{}}
+	columns, err := queryStrings(ctx, src, `SELECT name FROM pragma_table_info(?) ORDER BY cid`, name)
+	if err != nil {
+		return table, fmt.Errorf("describe source table %s: %w", name, err)
+	}
+	table.columns = columns
+
+	type targetColumn struct {
+		dataType string
+		nullable bool
+		serial   bool
+	}
+	rows, err := dst.QueryContext(ctx, `
+		SELECT column_name, data_type, is_nullable = 'YES', COALESCE(column_default, '') LIKE 'nextval(%'
+		FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1`, name)
+	if err != nil {
+		return table, fmt.Errorf("describe target table %s: %w", name, err)
+	}
+	defer func() { _ = rows.Close() }()
+	target := map[string]targetColumn{}
+	for rows.Next() {
+		var column string
+		var c targetColumn
+		if err := rows.Scan(&column, &c.dataType, &c.nullable, &c.serial); err != nil {
+			return table, fmt.Errorf("describe target table %s: %w", name, err)
+		}
+		target[column] = c
+	}
+	if err := rows.Err(); err != nil {
+		return table, fmt.Errorf("describe target table %s: %w", name, err)
+	}
+	if len(target) == 0 {
+		return table, fmt.Errorf("%w: %s", errMissingTargetTable, name)
+	}
+
+	for i, column := range columns {
+		c, ok := target[column]
+		if !ok {
+			return table, fmt.Errorf("%w: %s.%s", errMissingTargetColumn, name, column)
+		}
+		if c.dataType == "boolean" {
+			table.bools[i] = c.nullable
+		}
+		if c.serial {
+			table.serials = append(table.serials, column)
+		}
+	}
+	return table, nil
+}
+
+func queryStrings(ctx context.Context, db *sql.DB, query string, args ...any) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// dataMigration copies tables from SQLite to PostgreSQL.
+type dataMigration struct {
+	src    *sql.DB
+	dst    *sql.DB
+	tables []dataTable
+	enc    *EncryptedRepository // Opens sealed agent session state, if set
+}
+
+// copy copies every table from one source snapshot in one target
+// transaction, returning the source side of the report.
+func (m *dataMigration) copy(ctx context.Context, replace bool) ([]TableMigration, error) {
+	srcTx, err := m.src.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin source snapshot: %w", err)
+	}
+	defer func() { _ = srcTx.Rollback() }()
+	dstTx, err := m.dst.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin target transaction: %w", err)
+	}
+	defer func() { _ = dstTx.Rollback() }()
+
+	if err := m.prepareTarget(ctx, dstTx, replace); err != nil {
+		return nil, err
+	}
+	results := make([]TableMigration, 0, len(m.tables))
+	for _, table := range m.tables {
+		rows, checksum, err := m.copyTable(ctx, srcTx, dstTx, table)
+		if err != nil {
+			return nil, fmt.Errorf("copy %s: %w", table.name, err)
+		}
+		for _, column := range table.serials {
+			if _, err := dstTx.ExecContext(ctx, fmt.Sprintf(
+				`SELECT setval(pg_get_serial_sequence($1, $2), COALESCE(MAX(%s), 0) + 1, false) FROM %s`,
+				quoteIdent(column), quoteIdent(table.name)), table.name, column); err != nil {
+				return nil, fmt.Errorf("reset %s.%s sequence: %w", table.name, column, err)
+			}
+		}
+		slog.Info("Copied table", "table", table.name, "rows", rows)
+		results = append(results, TableMigration{Table: table.name, SourceRows: rows, SourceChecksum: checksum})
+	}
+	if err := dstTx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit target transaction: %w", err)
+	}
+	return results, nil
+}
+
+// prepareTarget empties the target tables if replace is set, or makes sure
+// they are empty.
+func (m *dataMigration) prepareTarget(ctx context.Context, tx *sql.Tx, replace bool) error {
+	names := make([]string, len(m.tables))
+	for i, table := range m.tables {
+		names[i] = quoteIdent(table.name)
+	}
+	if replace {
+		if _, err := tx.ExecContext(ctx, `TRUNCATE `+strings.Join(names, ", ")); err != nil {
+			return fmt.Errorf("empty target tables: %w", err)
+		}
+		return nil
+	}
+	for i, table := range m.tables {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM `+names[i]+`)`).Scan(&exists); err != nil {
+			return fmt.Errorf("check target table %s: %w", table.name, err)
+		}
+		if exists {
+			return fmt.Errorf("%w: %s holds rows", ErrTargetNotEmpty, table.name)
+		}
+	}
+	return nil
+}
+
+// copyTable inserts the rows of table in batches and returns their count
+// and checksum.
+func (m *dataMigration) copyTable(ctx context.Context, src, dst *sql.Tx, table dataTable) (int64, string, error) {
+	rows, err := src.QueryContext(ctx, selectColumns(table))
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var sum rowChecksum
+	batch := make([]any, 0, dataMigrationBatchRows*len(table.columns))
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := dst.ExecContext(ctx, insertRows(table, len(batch)/len(table.columns)), batch...)
+		batch = batch[:0]
+		return err
+	}
+	for rows.Next() {
+		values, err := m.scanSourceRow(rows, table)
+		if err != nil {
+			return 0, "", err
+		}
+		sum.add(values)
+		batch = append(batch, values...)
+		if len(batch) == cap(batch) {
+			if err := flush(); err != nil {
+				return 0, "", err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, "", err
+	}
+	if err := flush(); err != nil {
+		return 0, "", err
+	}
+	return sum.rows, sum.String(), nil
+}
+
+// checksumSource checksums every source table from one snapshot.
+func (m *dataMigration) checksumSource(ctx context.Context) ([]TableMigration, error) {
+	tx, err := m.src.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin source snapshot: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	results := make([]TableMigration, 0, len(m.tables))
+	for _, table := range m.tables {
+		rows, checksum, err := m.checksum(ctx, tx, table, m.scanSourceRow)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, TableMigration{Table: table.name, SourceRows: rows, SourceChecksum: checksum})
+	}
+	return results, nil
+}
+
+// rowQueryer is a database or transaction rows are read from.
+type rowQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// checksum counts and checksums the rows of table in db, scanning them with
+// scan or, if nil, as they are.
+func (m *dataMigration) checksum(ctx context.Context, db rowQueryer, table dataTable, scan func(*sql.Rows, dataTable) ([]any, error)) (int64, string, error) {
+	if scan == nil {
+		scan = scanRow
+	}
+	rows, err := db.QueryContext(ctx, selectColumns(table))
+	if err != nil {
+		return 0, "", fmt.Errorf("checksum %s: %w", table.name, err)
+	}
+	defer func() { _ = rows.Close() }()
+	var sum rowChecksum
+	for rows.Next() {
+		values, err := scan(rows, table)
+		if err != nil {
+			return 0, "", fmt.Errorf("checksum %s: %w", table.name, err)
+		}
+		sum.add(values)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, "", fmt.Errorf("checksum %s: %w", table.name, err)
+	}
+	return sum.rows, sum.String(), nil
+}
+
+// scanSourceRow scans a SQLite row into the values PostgreSQL stores:
+// integer flags become booleans and sealed agent session state is opened.
+func (m *dataMigration) scanSourceRow(rows *sql.Rows, table dataTable) ([]any, error) {
+	values, err := scanRow(rows, table)
+	if err != nil {
+		return nil, err
+	}
+	for i, nullable := range table.bools {
+		if values[i] == nil && nullable {
+			continue
+		}
+		n, _ := values[i].(int64)
+		values[i] = n != 0
+	}
+	if table.name == "agent_sessions" || table.name == "agent_sessions_archive" {
+		if err := m.openSessionRow(table, values); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// openSessionRow decrypts the sealed state columns of an agent session row.
+func (m *dataMigration) openSessionRow(table dataTable, values []any) error {
+	session := &domain.AgentSession{}
+	state := map[string]int{}
+	for i, column := range table.columns {
+		switch column {
+		case "user_id":
+			session.UserID = stringValue(values[i])
+		case "session_id":
+			session.SessionID = stringValue(values[i])
+		case "messages_json", "challenge_json":
+			state[column] = i
+		}
+	}
+	for column, i := range state {
+		value := stringValue(values[i])
+		if !strings.HasPrefix(value, encryptedPrefix) {
+			continue
+		}
+		if m.enc == nil {
+			return errSealedSessions
+		}
+		plain, err := m.enc.openField(session, column, value)
+		if err != nil {
+			return err
+		}
+		values[i] = plain
+	}
+	return nil
+}
+
+func scanRow(rows *sql.Rows, table dataTable) ([]any, error) {
+	values := make([]any, len(table.columns))
+	ptrs := make([]any, len(values))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil, err
+	}
+	for i, value := range values {
+		// Drivers reuse byte slice buffers between rows.
+		if b, ok := value.([]byte); ok {
+			values[i] = string(b)
+		}
+	}
+	return values, nil
+}
+
+func stringValue(value any) string {
+	s, _ := value.(string)
+	return s
+}
+
+func selectColumns(table dataTable) string {
+	columns := make([]string, len(table.columns))
+	for i, column := range table.columns {
+		columns[i] = quoteIdent(column)
+	}
+	return `SELECT ` + strings.Join(columns, ", ") + ` FROM ` + quoteIdent(table.name)
+}
+
+// insertRows builds a PostgreSQL INSERT of n rows of table.
+func insertRows(table dataTable, n int) string {
+	var b strings.Builder
+	b.WriteString(`INSERT INTO ` + quoteIdent(table.name) + ` (`)
+	for i, column := range table.columns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(quoteIdent(column))
+	}
+	b.WriteString(`) VALUES `)
+	arg := 0
+	for row := range n {
+		if row > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for i := range table.columns {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			arg++
+			b.WriteString("$" + strconv.Itoa(arg))
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// rowChecksum combines row digests with XOR, so that the result does not
+// depend on the order the databases return rows in. Rows are unique by
+// primary key, so no two digests cancel out.
+type rowChecksum struct {
+	rows int64
+	sum  [sha256.Size]byte
+}
+
+// add adds a row. Values are encoded by kind, so that SQLite and PostgreSQL
+// driver types holding the same value digest alike.
+func (c *rowChecksum) add(values []any) {
+	h := sha256.New()
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+			h.Write([]byte{'n'})
+		case bool:
+			fmt.Fprintf(h, "b%t\x00", v)
+		case int64:
+			fmt.Fprintf(h, "i%d\x00", v)
+		case int32:
+			fmt.Fprintf(h, "i%d\x00", v)
+		case int:
+			fmt.Fprintf(h, "i%d\x00", v)
+		case float64:
+			fmt.Fprintf(h, "f%s\x00", strconv.FormatFloat(v, 'g', -1, 64))
+		case string:
+			fmt.Fprintf(h, "s%d:%s", len(v), v)
+		default:
+			fmt.Fprintf(h, "?%v\x00", v)
+		}
+	}
+	var digest [sha256.Size]byte
+	h.Sum(digest[:0])
+	for i := range c.sum {
+		c.sum[i] ^= digest[i]
+	}
+	c.rows++
+}
+
+func (c *rowChecksum) String() string {
+	return hex.EncodeToString(c.sum[:8])
+}
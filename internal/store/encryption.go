@@ -0,0 +1,194 @@
+package store
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+)
+
+// encryptedPrefix marks a field sealed by EncryptedRepository. Values without
+// it are plaintext stored before encryption was enabled; they are read as is
+// and encrypted when the session is next written.
+const encryptedPrefix = "enc:v1:"
+
+// errEncryptedField is returned when a sealed field cannot be opened, e.g.
+// because the key changed.
+var errEncryptedField = errors.New("cannot decrypt agent session field")
+
+// EncryptedRepository wraps a Repository to encrypt the conversation and
+// challenge state of agent sessions (messages_json and challenge_json) at
+// rest with AES-GCM. Each value is bound to its user, tab session and column,
+// so it cannot be opened after being copied to another row. Archived
+// sessions keep the ciphertext and are decrypted when listed.
+type EncryptedRepository struct {
+	Repository
+
+	aead cipher.AEAD
+}
+
+var _ Repository = (*EncryptedRepository)(nil)
+
+// NewEncrypted wraps repo to encrypt agent session state with key, a
+// base64-encoded 16, 24 or 32 byte AES key. An empty key returns repo
+// unchanged.
+func NewEncrypted(repo Repository, key string) (Repository, error) {
+	if key == "" {
+		return repo, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("decode encryption key: %w", err)
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	return &EncryptedRepository{Repository: repo, aead: aead}, nil
+}
+
+// GetAgentSession implements Repository.
+func (r *EncryptedRepository) GetAgentSession(ctx context.Context, userID, sessionID string) (*domain.AgentSession, error) {
+	session, err := r.Repository.GetAgentSession(ctx, userID, sessionID)
+	if err != nil || session == nil {
+		return session, err
+	}
+	if err := r.open(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// ListAgentSessions implements Repository.
+func (r *EncryptedRepository) ListAgentSessions(ctx context.Context, userID string) ([]*domain.AgentSession, error) {
+	sessions, err := r.Repository.ListAgentSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		if err := r.open(session); err != nil {
+			return nil, err
+		}
+	}
+	return sessions, nil
+}
+
+// UpsertAgentSession implements Repository. The caller's session keeps its
+// plaintext fields; its version and timestamps are updated as by the
+// wrapped repository.
+func (r *EncryptedRepository) UpsertAgentSession(ctx context.Context, session *domain.AgentSession) error {
+	sealed := *session
+	if err := r.seal(&sealed); err != nil {
+		return err
+	}
+	if err := r.Repository.UpsertAgentSession(ctx, &sealed); err != nil {
+		return err
+	}
+	session.Version = sealed.Version
+	session.CreatedAt = sealed.CreatedAt
+	session.UpdatedAt = sealed.UpdatedAt
+	return nil
+}
+
+// ListArchivedSessions implements Repository.
+func (r *EncryptedRepository) ListArchivedSessions(ctx context.Context, userID string) ([]*domain.ArchivedAgentSession, error) {
+	sessions, err := r.Repository.ListArchivedSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		if err := r.open(&session.AgentSession); err != nil {
+			return nil, err
+		}
+	}
+	return sessions, nil
+}
+
+// ExportUserData returns everything stored about a user, with agent session
+// state decrypted.
+func (r *EncryptedRepository) ExportUserData(ctx context.Context, userID string) (*domain.UserDataExport, error) {
+	return exportUserData(ctx, r, userID)
+}
+
+// seal encrypts session's state fields in place.
+func (r *EncryptedRepository) seal(session *domain.AgentSession) error {
+	messages, err := r.sealField(session, "messages_json", session.MessagesJSON)
+	if err != nil {
+		return err
+	}
+	session.MessagesJSON = messages
+	if session.ChallengeJSON != nil {
+		challenge, err := r.sealField(session, "challenge_json", *session.ChallengeJSON)
+		if err != nil {
+			return err
+		}
+		session.ChallengeJSON = &challenge
+	}
+	return nil
+}
+
+// open decrypts session's state fields in place.
+func (r *EncryptedRepository) open(session *domain.AgentSession) error {
+	messages, err := r.openField(session, "messages_json", session.MessagesJSON)
+	if err != nil {
+		return err
+	}
+	session.MessagesJSON = messages
+	if session.ChallengeJSON != nil {
+		challenge, err := r.openField(session, "challenge_json", *session.ChallengeJSON)
+		if err != nil {
+			return err
+		}
+		session.ChallengeJSON = &challenge
+	}
+	return nil
+}
+
+// sealField encrypts value as the named column of session's row. Empty
+// values are stored as is.
+func (r *EncryptedRepository) sealField(session *domain.AgentSession, column, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	nonce := make([]byte, r.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+	sealed := r.aead.Seal(nonce, nonce, []byte(value), fieldAD(session, column))
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openField decrypts the named column of session's row, passing plaintext
+// values through.
+func (r *EncryptedRepository) openField(session *domain.AgentSession, column, value string) (string, error) {
+	encoded, ok := strings.CutPrefix(value, encryptedPrefix)
+	if !ok {
+		return value, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < r.aead.NonceSize() {
+		return "", fmt.Errorf("%w: %s of user %s", errEncryptedField, column, session.UserID)
+	}
+	nonce, ciphertext := sealed[:r.aead.NonceSize()], sealed[r.aead.NonceSize():]
+	plain, err := r.aead.Open(nil, nonce, ciphertext, fieldAD(session, column))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s of user %s", errEncryptedField, column, session.UserID)
+	}
+	return string(plain), nil
+}
+
+// fieldAD is the additional data binding a sealed value to its row and
+// column.
+func fieldAD(session *domain.AgentSession, column string) []byte {
+	return []byte(column + "\x00" + session.UserID + "\x00" + session.SessionID)
+}
@@ -0,0 +1,189 @@
+package store
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+)
+
+const (
+	testMessages  = `[{"role":"user","content":"how do I list files?"}]`
+	testChallenge = `{"id":"ls-basics","step":2}`
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+}
+
+// newTestEncrypted wraps a fresh SQLite repository, returning the wrapper
+// and the repository underneath it.
+func newTestEncrypted(t *testing.T) (*EncryptedRepository, Repository) {
+	t.Helper()
+	inner := newTestSQLite(t)
+	repo, err := NewEncrypted(inner, testKey('k'))
+	if err != nil {
+		t.Fatalf("NewEncrypted: %v", err)
+	}
+	return repo.(*EncryptedRepository), inner
+}
+
+func newTestSession(userID, sessionID string) *domain.AgentSession {
+	challenge := testChallenge
+	return &domain.AgentSession{UserID: userID, SessionID: sessionID, MessagesJSON: testMessages, ChallengeJSON: &challenge}
+}
+
+func TestNewEncrypted(t *testing.T) {
+	inner := newTestSQLite(t)
+	if repo, err := NewEncrypted(inner, ""); err != nil || repo != inner {
+		t.Fatalf("NewEncrypted without a key = %v, %v; want the repository unchanged", repo, err)
+	}
+	if _, err := NewEncrypted(inner, "not base64!"); err == nil {
+		t.Fatal("NewEncrypted accepted a key that is not base64")
+	}
+	if _, err := NewEncrypted(inner, base64.StdEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Fatal("NewEncrypted accepted a 5 byte key")
+	}
+}
+
+func TestEncryptedRoundTrip(t *testing.T) {
+	repo, inner := newTestEncrypted(t)
+	ctx := t.Context()
+
+	session := newTestSession("alice", "tab-1")
+	if err := repo.UpsertAgentSession(ctx, session); err != nil {
+		t.Fatalf("UpsertAgentSession: %v", err)
+	}
+	if session.MessagesJSON != testMessages || session.Version != 1 {
+		t.Fatalf("caller's session = %+v; want plaintext kept and version advanced", session)
+	}
+
+	stored, err := inner.GetAgentSession(ctx, "alice", "tab-1")
+	if err != nil || stored == nil {
+		t.Fatalf("GetAgentSession of the wrapped repository: %+v, %v", stored, err)
+	}
+	// Spaces and dashes never appear in base64, so the plaintext cannot
+	// show up in a sealed value by chance.
+	sealed := map[string]string{stored.MessagesJSON: "list files", *stored.ChallengeJSON: "ls-basics"}
+	for value, plain := range sealed {
+		if !strings.HasPrefix(value, encryptedPrefix) || strings.Contains(value, plain) {
+			t.Fatalf("stored %q, want it sealed", value)
+		}
+	}
+
+	got, err := repo.GetAgentSession(ctx, "alice", "tab-1")
+	if err != nil || got.MessagesJSON != testMessages || *got.ChallengeJSON != testChallenge {
+		t.Fatalf("GetAgentSession = %+v, %v", got, err)
+	}
+	list, err := repo.ListAgentSessions(ctx, "alice")
+	if err != nil || len(list) != 1 || list[0].MessagesJSON != testMessages {
+		t.Fatalf("ListAgentSessions = %+v, %v", list, err)
+	}
+}
+
+func TestEncryptedReadsPlaintext(t *testing.T) {
+	repo, inner := newTestEncrypted(t)
+	ctx := t.Context()
+
+	// Rows written before encryption was enabled are read as is.
+	if err := inner.UpsertAgentSession(ctx, newTestSession("alice", "tab-1")); err != nil {
+		t.Fatalf("UpsertAgentSession: %v", err)
+	}
+	got, err := repo.GetAgentSession(ctx, "alice", "tab-1")
+	if err != nil || got.MessagesJSON != testMessages || *got.ChallengeJSON != testChallenge {
+		t.Fatalf("GetAgentSession of a plaintext row = %+v, %v", got, err)
+	}
+
+	// and sealed when next written.
+	if err := repo.UpsertAgentSession(ctx, got); err != nil {
+		t.Fatalf("UpsertAgentSession: %v", err)
+	}
+	if stored, _ := inner.GetAgentSession(ctx, "alice", "tab-1"); !strings.HasPrefix(stored.MessagesJSON, encryptedPrefix) {
+		t.Fatalf("rewritten row stored %q, want it sealed", stored.MessagesJSON)
+	}
+}
+
+func TestEncryptedBindsRowAndColumn(t *testing.T) {
+	repo, inner := newTestEncrypted(t)
+	ctx := t.Context()
+
+	if err := repo.UpsertAgentSession(ctx, newTestSession("alice", "tab-1")); err != nil {
+		t.Fatalf("UpsertAgentSession: %v", err)
+	}
+	sealed, err := inner.GetAgentSession(ctx, "alice", "tab-1")
+	if err != nil {
+		t.Fatalf("GetAgentSession: %v", err)
+	}
+
+	moves := map[string]*domain.AgentSession{
+		"another user":    {UserID: "mallory", SessionID: "tab-1", MessagesJSON: sealed.MessagesJSON},
+		"another session": {UserID: "alice", SessionID: "tab-2", MessagesJSON: sealed.MessagesJSON},
+		"another column":  {UserID: "alice", SessionID: "tab-3", MessagesJSON: *sealed.ChallengeJSON},
+	}
+	for name, moved := range moves {
+		if err := inner.UpsertAgentSession(ctx, moved); err != nil {
+			t.Fatalf("%s: UpsertAgentSession: %v", name, err)
+		}
+		if _, err := repo.GetAgentSession(ctx, moved.UserID, moved.SessionID); !errors.Is(err, errEncryptedField) {
+			t.Fatalf("%s: GetAgentSession = %v, want errEncryptedField", name, err)
+		}
+	}
+}
+
+func TestEncryptedWrongKey(t *testing.T) {
+	repo, inner := newTestEncrypted(t)
+	ctx := t.Context()
+
+	if err := repo.UpsertAgentSession(ctx, newTestSession("alice", "tab-1")); err != nil {
+		t.Fatalf("UpsertAgentSession: %v", err)
+	}
+	rekeyed, err := NewEncrypted(inner, testKey('x'))
+	if err != nil {
+		t.Fatalf("NewEncrypted: %v", err)
+	}
+	if _, err := rekeyed.GetAgentSession(ctx, "alice", "tab-1"); !errors.Is(err, errEncryptedField) {
+		t.Fatalf("GetAgentSession with another key = %v, want errEncryptedField", err)
+	}
+	if _, err := rekeyed.ListAgentSessions(ctx, "alice"); !errors.Is(err, errEncryptedField) {
+		t.Fatalf("ListAgentSessions with another key = %v, want errEncryptedField", err)
+	}
+}
+
+func TestEncryptedArchiveAndExport(t *testing.T) {
+	repo, _ := newTestEncrypted(t)
+	ctx := t.Context()
+
+	if err := repo.UpsertUser(ctx, &domain.User{UserID: "alice", Username: "alice", LastSeenAt: time.Now()}); err != nil {
+		t.Fatalf("UpsertUser: %v", err)
+	}
+	if err := repo.UpsertAgentSession(ctx, newTestSession("alice", "tab-1")); err != nil {
+		t.Fatalf("UpsertAgentSession: %v", err)
+	}
+	// A negative TTL archives every session.
+	if n, err := repo.CleanupExpiredSessions(ctx, -time.Hour); err != nil || n != 1 {
+		t.Fatalf("CleanupExpiredSessions = %d, %v; want 1 archived", n, err)
+	}
+	if err := repo.UpsertAgentSession(ctx, newTestSession("alice", "tab-2")); err != nil {
+		t.Fatalf("UpsertAgentSession: %v", err)
+	}
+
+	archived, err := repo.ListArchivedSessions(ctx, "alice")
+	if err != nil || len(archived) != 1 || archived[0].MessagesJSON != testMessages || *archived[0].ChallengeJSON != testChallenge {
+		t.Fatalf("ListArchivedSessions = %+v, %v", archived, err)
+	}
+
+	export, err := repo.ExportUserData(ctx, "alice")
+	if err != nil {
+		t.Fatalf("ExportUserData: %v", err)
+	}
+	if len(export.AgentSessions) != 1 || string(export.AgentSessions[0].Messages) != testMessages {
+		t.Fatalf("exported sessions = %+v", export.AgentSessions)
+	}
+	if len(export.ArchivedSessions) != 1 || string(export.ArchivedSessions[0].Messages) != testMessages ||
+		string(export.ArchivedSessions[0].Challenge) != testChallenge {
+		t.Fatalf("exported archived sessions = %+v", export.ArchivedSessions)
+	}
+}
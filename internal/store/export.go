@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+)
+
+// userDataReader is the part of a Repository an export reads from.
+type userDataReader interface {
+	GetUser(ctx context.Context, userID string) (*domain.User, error)
+	ListAgentSessions(ctx context.Context, userID string) ([]*domain.AgentSession, error)
+	ListCommands(ctx context.Context, userID, sessionID string, limit int) ([]*domain.CommandRecord, error)
+	ListArchivedSessions(ctx context.Context, userID string) ([]*domain.ArchivedAgentSession, error)
+}
+
+// exportUserData collects a user's records for ExportUserData. It returns
+// nil if the user does not exist.
+func exportUserData(ctx context.Context, r userDataReader, userID string) (*domain.UserDataExport, error) {
+	user, err := r.GetUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("export user: %w", err)
+	}
+	if user == nil {
+		return nil, nil
+	}
+	sessions, err := r.ListAgentSessions(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("export agent sessions: %w", err)
+	}
+	commands, err := r.ListCommands(ctx, userID, "", 0)
+	if err != nil {
+		return nil, fmt.Errorf("export commands: %w", err)
+	}
+	archived, err := r.ListArchivedSessions(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("export archived sessions: %w", err)
+	}
+	export := domain.NewUserDataExport(user, sessions, commands, time.Now())
+	export.ArchivedSessions = domain.NewArchivedSessionExports(archived)
+	return export, nil
+}
+
+// ExportUserData returns everything stored about a user.
+func (s *SQLiteStore) ExportUserData(ctx context.Context, userID string) (*domain.UserDataExport, error) {
+	return exportUserData(ctx, s, userID)
+}
+
+// ExportUserData returns everything stored about a user.
+func (s *PostgresStore) ExportUserData(ctx context.Context, userID string) (*domain.UserDataExport, error) {
+	return exportUserData(ctx, s, userID)
+}
+
+// ExportUserData returns everything stored about a user.
+func (s *RedisStore) ExportUserData(ctx context.Context, userID string) (*domain.UserDataExport, error) {
+	return exportUserData(ctx, s, userID)
+}
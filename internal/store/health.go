@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// HealthDetails reports database pressure for the health endpoint, so
+// operators can spot trouble before queries start failing.
+type HealthDetails struct {
+	Driver string `json:"driver"`
+	// WALBytes is the size of the write-ahead log: the SQLite -wal file, or
+	// the PostgreSQL WAL directory when the server lets us read it.
+	WALBytes int64 `json:"wal_bytes,omitempty"`
+	// BusyErrors counts SQLite lock contention errors (SQLITE_BUSY or
+	// "database is locked"): those the store retried on its own plus, when
+	// reported through InstrumentedRepository, those returned to callers.
+	BusyErrors int64 `json:"busy_errors"`
+	// RowCounts holds rows per table; PostgreSQL counts are planner
+	// estimates and Redis reports its total key count under "keys".
+	RowCounts map[string]int64 `json:"row_counts"`
+}
+
+// countRows counts the rows of every table keyed by user.
+func countRows(ctx context.Context, db *sql.DB) (map[string]int64, error) {
+	counts := make(map[string]int64, len(userTables))
+	for _, table := range userTables {
+		var n int64
+		// #nosec G202 -- table names come from the fixed userTables list.
+		if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table).Scan(&n); err != nil {
+			return nil, fmt.Errorf("count %s rows: %w", table, err)
+		}
+		counts[table] = n
+	}
+	return counts, nil
+}
+
+// HealthDetails reports the WAL file size, lock contention and row counts.
+func (s *SQLiteStore) HealthDetails(ctx context.Context) (*HealthDetails, error) {
+	counts, err := countRows(ctx, s.db)
+	if err != nil {
+		return nil, err
+	}
+	details := &HealthDetails{Driver: "sqlite", BusyErrors: s.busyRetries.Load(), RowCounts: counts}
+	if info, err := os.Stat(s.path + "-wal"); err == nil {
+		details.WALBytes = info.Size()
+	}
+	return details, nil
+}
+
+// HealthDetails reports the WAL directory size, if readable, and estimated
+// row counts from the statistics collector.
+func (s *PostgresStore) HealthDetails(ctx context.Context) (*HealthDetails, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT relname, n_live_tup FROM pg_stat_user_tables`)
+	if err != nil {
+		return nil, fmt.Errorf("query table stats: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			slog.Warn("failed to close rows", "query", "HealthDetails", "error", closeErr)
+		}
+	}()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var table string
+		var n int64
+		if err := rows.Scan(&table, &n); err != nil {
+			return nil, fmt.Errorf("scan table stats: %w", err)
+		}
+		counts[table] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate table stats: %w", err)
+	}
+
+	details := &HealthDetails{Driver: "postgres", RowCounts: counts}
+	// pg_ls_waldir needs superuser or pg_monitor; without it the size is omitted.
+	var wal sql.NullInt64
+	if err := s.db.QueryRowContext(ctx, `SELECT SUM(size) FROM pg_ls_waldir()`).Scan(&wal); err == nil {
+		details.WALBytes = wal.Int64
+	}
+	return details, nil
+}
+
+// HealthDetails reports the number of keys in the Redis database.
+func (s *RedisStore) HealthDetails(ctx context.Context) (*HealthDetails, error) {
+	reply, err := s.client.Do(ctx, "DBSIZE")
+	if err != nil {
+		return nil, fmt.Errorf("query key count: %w", err)
+	}
+	keys, _ := reply.(int64)
+	return &HealthDetails{Driver: "redis", RowCounts: map[string]int64{"keys": keys}}, nil
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+)
+
+// insertIntervention stores a hint outcome.
+func insertIntervention(ctx context.Context, db *sql.DB, d sqlDialect, i *domain.Intervention) error {
+	bind := d.bind
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO intervention_outcomes (user_id, session_id, response_type, pattern, outcome, hinted_at, resolved_at)
+		VALUES (`+bind(1)+`, `+bind(2)+`, `+bind(3)+`, `+bind(4)+`, `+bind(5)+`, `+bind(6)+`, `+bind(7)+`)`,
+		i.UserID, i.SessionID, i.ResponseType, i.Pattern, string(i.Outcome), i.HintedAt.UnixMilli(), i.ResolvedAt.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("insert intervention: %w", err)
+	}
+	return nil
+}
+
+type interventionKey struct {
+	responseType string
+	pattern      string
+}
+
+// listInterventionStats returns the outcomes of hints given from since
+// onwards, grouped by hint, most frequent first.
+func listInterventionStats(ctx context.Context, db *sql.DB, d sqlDialect, since time.Time) ([]*domain.InterventionStats, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT response_type, pattern, outcome, COUNT(*) FROM intervention_outcomes
+		WHERE hinted_at >= `+d.bind(1)+`
+		GROUP BY response_type, pattern, outcome`,
+		since.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("query intervention stats: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			slog.Warn("failed to close rows", "query", "ListInterventionStats", "error", closeErr)
+		}
+	}()
+
+	counts := make(map[interventionKey]map[domain.InterventionOutcome]int)
+	for rows.Next() {
+		var key interventionKey
+		var outcome string
+		var n int
+		if err := rows.Scan(&key.responseType, &key.pattern, &outcome, &n); err != nil {
+			return nil, fmt.Errorf("scan intervention stats: %w", err)
+		}
+		if counts[key] == nil {
+			counts[key] = make(map[domain.InterventionOutcome]int)
+		}
+		counts[key][domain.InterventionOutcome(outcome)] += n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate intervention stats: %w", err)
+	}
+
+	stats := make([]*domain.InterventionStats, 0, len(counts))
+	for key, c := range counts {
+		stats = append(stats, domain.NewInterventionStats(key.responseType, key.pattern, c))
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Hints != stats[j].Hints {
+			return stats[i].Hints > stats[j].Hints
+		}
+		if stats[i].ResponseType != stats[j].ResponseType {
+			return stats[i].ResponseType < stats[j].ResponseType
+		}
+		return stats[i].Pattern < stats[j].Pattern
+	})
+	return stats, nil
+}
+
+// InsertIntervention stores a hint outcome.
+func (s *SQLiteStore) InsertIntervention(ctx context.Context, i *domain.Intervention) error {
+	return insertIntervention(ctx, s.db, sqliteDialect, i)
+}
+
+// ListInterventionStats returns hint outcomes grouped by hint.
+func (s *SQLiteStore) ListInterventionStats(ctx context.Context, since time.Time) ([]*domain.InterventionStats, error) {
+	return listInterventionStats(ctx, s.db, sqliteDialect, since)
+}
+
+// InsertIntervention stores a hint outcome.
+func (s *PostgresStore) InsertIntervention(ctx context.Context, i *domain.Intervention) error {
+	return insertIntervention(ctx, s.db, postgresDialect, i)
+}
+
+// ListInterventionStats returns hint outcomes grouped by hint.
+func (s *PostgresStore) ListInterventionStats(ctx context.Context, since time.Time) ([]*domain.InterventionStats, error) {
+	return listInterventionStats(ctx, s.db, postgresDialect, since)
+}
+
+// InsertIntervention is a no-op: like command analytics, intervention
+// outcomes need a SQL store.
+func (s *RedisStore) InsertIntervention(context.Context, *domain.Intervention) error {
+	return nil
+}
+
+// ListInterventionStats returns nothing; see InsertIntervention.
+func (s *RedisStore) ListInterventionStats(context.Context, time.Time) ([]*domain.InterventionStats, error) {
+	return nil, nil
+}
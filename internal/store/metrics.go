@@ -0,0 +1,585 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/shared"
+)
+
+// QueryLatencyBuckets are the upper bounds of the latency histogram buckets
+// in QueryStats.
+var QueryLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// QueryStats summarizes the calls of one repository method.
+type QueryStats struct {
+	Calls  int64 `json:"calls"`
+	Errors int64 `json:"errors"`
+	// Conflicts counts errors caused by SQLite lock contention (SQLITE_BUSY
+	// or "database is locked"); they are included in Errors.
+	Conflicts int64   `json:"conflicts"`
+	TotalMs   float64 `json:"total_ms"`
+	MaxMs     float64 `json:"max_ms"`
+	// Histogram[i] counts calls that took at most QueryLatencyBuckets[i] and
+	// longer than the previous bound; the extra last entry counts slower calls.
+	Histogram []int64 `json:"histogram"`
+}
+
+// StatsReporter is implemented by repositories that record per-method query
+// metrics.
+type StatsReporter interface {
+	// Stats returns metrics keyed by repository method name.
+	Stats() map[string]QueryStats
+}
+
+// InstrumentedRepository wraps a Repository and records the latency and
+// errors of every call, whatever the backend.
+type InstrumentedRepository struct {
+	repo Repository
+
+	mu    sync.Mutex
+	stats map[string]*QueryStats
+}
+
+var (
+	_ Repository    = (*InstrumentedRepository)(nil)
+	_ StatsReporter = (*InstrumentedRepository)(nil)
+)
+
+// NewInstrumented wraps repo with query metrics.
+func NewInstrumented(repo Repository) *InstrumentedRepository {
+	return &InstrumentedRepository{
+		repo:  repo,
+		stats: make(map[string]*QueryStats),
+	}
+}
+
+// Unwrap returns the wrapped repository, e.g. to reach optional interfaces
+// such as Migrator.
+func (r *InstrumentedRepository) Unwrap() Repository {
+	return r.repo
+}
+
+// Stats returns a snapshot of the metrics recorded so far.
+func (r *InstrumentedRepository) Stats() map[string]QueryStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(map[string]QueryStats, len(r.stats))
+	for method, s := range r.stats {
+		snapshot := *s
+		snapshot.Histogram = append([]int64(nil), s.Histogram...)
+		out[method] = snapshot
+	}
+	return out
+}
+
+// observe records a call of method that started at start and returned err.
+func (r *InstrumentedRepository) observe(method string, start time.Time, err error) {
+	elapsed := time.Since(start)
+	ms := float64(elapsed) / float64(time.Millisecond)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.stats[method]
+	if !ok {
+		s = &QueryStats{Histogram: make([]int64, len(QueryLatencyBuckets)+1)}
+		r.stats[method] = s
+	}
+	s.Calls++
+	s.TotalMs += ms
+	s.MaxMs = max(s.MaxMs, ms)
+	bucket := len(QueryLatencyBuckets)
+	for i, bound := range QueryLatencyBuckets {
+		if elapsed <= bound {
+			bucket = i
+			break
+		}
+	}
+	s.Histogram[bucket]++
+	if err != nil {
+		s.Errors++
+		if shared.IsSQLiteConflictError(err) {
+			s.Conflicts++
+		}
+	}
+}
+
+// GetUser implements Repository.
+func (r *InstrumentedRepository) GetUser(ctx context.Context, userID string) (*domain.User, error) {
+	start := time.Now()
+	user, err := r.repo.GetUser(ctx, userID)
+	r.observe("GetUser", start, err)
+	return user, err
+}
+
+// UpsertUser implements Repository.
+func (r *InstrumentedRepository) UpsertUser(ctx context.Context, user *domain.User) error {
+	start := time.Now()
+	err := r.repo.UpsertUser(ctx, user)
+	r.observe("UpsertUser", start, err)
+	return err
+}
+
+// UpdateLastSeen implements Repository.
+func (r *InstrumentedRepository) UpdateLastSeen(ctx context.Context, userID string, lastSeen time.Time) error {
+	start := time.Now()
+	err := r.repo.UpdateLastSeen(ctx, userID, lastSeen)
+	r.observe("UpdateLastSeen", start, err)
+	return err
+}
+
+// UpdateContainerID implements Repository.
+func (r *InstrumentedRepository) UpdateContainerID(ctx context.Context, userID string, containerID string, expectedID string) error {
+	start := time.Now()
+	err := r.repo.UpdateContainerID(ctx, userID, containerID, expectedID)
+	r.observe("UpdateContainerID", start, err)
+	return err
+}
+
+// UpdateInstanceID implements Repository.
+func (r *InstrumentedRepository) UpdateInstanceID(ctx context.Context, userID string, instanceID string) error {
+	start := time.Now()
+	err := r.repo.UpdateInstanceID(ctx, userID, instanceID)
+	r.observe("UpdateInstanceID", start, err)
+	return err
+}
+
+// GetExpiredSessions implements Repository.
+func (r *InstrumentedRepository) GetExpiredSessions(ctx context.Context, ttl time.Duration) ([]*domain.User, error) {
+	start := time.Now()
+	users, err := r.repo.GetExpiredSessions(ctx, ttl)
+	r.observe("GetExpiredSessions", start, err)
+	return users, err
+}
+
+// GetActiveContainers implements Repository.
+func (r *InstrumentedRepository) GetActiveContainers(ctx context.Context) ([]*domain.User, error) {
+	start := time.Now()
+	users, err := r.repo.GetActiveContainers(ctx)
+	r.observe("GetActiveContainers", start, err)
+	return users, err
+}
+
+// SetKeepWarm implements Repository.
+func (r *InstrumentedRepository) SetKeepWarm(ctx context.Context, userID string, until time.Time) error {
+	start := time.Now()
+	err := r.repo.SetKeepWarm(ctx, userID, until)
+	r.observe("SetKeepWarm", start, err)
+	return err
+}
+
+// SetResourceTier implements Repository.
+func (r *InstrumentedRepository) SetResourceTier(ctx context.Context, userID, tier string) error {
+	start := time.Now()
+	err := r.repo.SetResourceTier(ctx, userID, tier)
+	r.observe("SetResourceTier", start, err)
+	return err
+}
+
+// SetClassroom implements Repository.
+func (r *InstrumentedRepository) SetClassroom(ctx context.Context, userID, classroom string) error {
+	start := time.Now()
+	err := r.repo.SetClassroom(ctx, userID, classroom)
+	r.observe("SetClassroom", start, err)
+	return err
+}
+
+// ListKeptWarmUsers implements Repository.
+func (r *InstrumentedRepository) ListKeptWarmUsers(ctx context.Context, now time.Time) ([]*domain.User, error) {
+	start := time.Now()
+	users, err := r.repo.ListKeptWarmUsers(ctx, now)
+	r.observe("ListKeptWarmUsers", start, err)
+	return users, err
+}
+
+// Ping implements Repository.
+func (r *InstrumentedRepository) Ping(ctx context.Context) error {
+	start := time.Now()
+	err := r.repo.Ping(ctx)
+	r.observe("Ping", start, err)
+	return err
+}
+
+// HealthDetails implements Repository. Lock contention errors returned to
+// callers are added to the ones the backend retried on its own.
+func (r *InstrumentedRepository) HealthDetails(ctx context.Context) (*HealthDetails, error) {
+	start := time.Now()
+	details, err := r.repo.HealthDetails(ctx)
+	r.observe("HealthDetails", start, err)
+	if details != nil {
+		for _, s := range r.Stats() {
+			details.BusyErrors += s.Conflicts
+		}
+	}
+	return details, err
+}
+
+// Close implements Repository.
+func (r *InstrumentedRepository) Close() error {
+	return r.repo.Close()
+}
+
+// GetAgentSession implements Repository.
+func (r *InstrumentedRepository) GetAgentSession(ctx context.Context, userID, sessionID string) (*domain.AgentSession, error) {
+	start := time.Now()
+	session, err := r.repo.GetAgentSession(ctx, userID, sessionID)
+	r.observe("GetAgentSession", start, err)
+	return session, err
+}
+
+// UpsertAgentSession implements Repository.
+func (r *InstrumentedRepository) UpsertAgentSession(ctx context.Context, session *domain.AgentSession) error {
+	start := time.Now()
+	err := r.repo.UpsertAgentSession(ctx, session)
+	r.observe("UpsertAgentSession", start, err)
+	return err
+}
+
+// DeleteAgentSession implements Repository.
+func (r *InstrumentedRepository) DeleteAgentSession(ctx context.Context, userID, sessionID string) error {
+	start := time.Now()
+	err := r.repo.DeleteAgentSession(ctx, userID, sessionID)
+	r.observe("DeleteAgentSession", start, err)
+	return err
+}
+
+// DeleteAgentSessions implements Repository.
+func (r *InstrumentedRepository) DeleteAgentSessions(ctx context.Context, userID string) error {
+	start := time.Now()
+	err := r.repo.DeleteAgentSessions(ctx, userID)
+	r.observe("DeleteAgentSessions", start, err)
+	return err
+}
+
+// ListAgentSessions implements Repository.
+func (r *InstrumentedRepository) ListAgentSessions(ctx context.Context, userID string) ([]*domain.AgentSession, error) {
+	start := time.Now()
+	sessions, err := r.repo.ListAgentSessions(ctx, userID)
+	r.observe("ListAgentSessions", start, err)
+	return sessions, err
+}
+
+// CleanupExpiredSessions implements Repository.
+func (r *InstrumentedRepository) CleanupExpiredSessions(ctx context.Context, ttl time.Duration) (int64, error) {
+	start := time.Now()
+	n, err := r.repo.CleanupExpiredSessions(ctx, ttl)
+	r.observe("CleanupExpiredSessions", start, err)
+	return n, err
+}
+
+// AggregateCommandStats implements Repository.
+func (r *InstrumentedRepository) AggregateCommandStats(ctx context.Context) (int64, error) {
+	start := time.Now()
+	n, err := r.repo.AggregateCommandStats(ctx)
+	r.observe("AggregateCommandStats", start, err)
+	return n, err
+}
+
+// ListDailyCommandStats implements Repository.
+func (r *InstrumentedRepository) ListDailyCommandStats(ctx context.Context, userID string, since time.Time) ([]*domain.DailyCommandStats, error) {
+	start := time.Now()
+	stats, err := r.repo.ListDailyCommandStats(ctx, userID, since)
+	r.observe("ListDailyCommandStats", start, err)
+	return stats, err
+}
+
+// InsertIntervention implements Repository.
+func (r *InstrumentedRepository) InsertIntervention(ctx context.Context, i *domain.Intervention) error {
+	start := time.Now()
+	err := r.repo.InsertIntervention(ctx, i)
+	r.observe("InsertIntervention", start, err)
+	return err
+}
+
+// ListInterventionStats implements Repository.
+func (r *InstrumentedRepository) ListInterventionStats(ctx context.Context, since time.Time) ([]*domain.InterventionStats, error) {
+	start := time.Now()
+	stats, err := r.repo.ListInterventionStats(ctx, since)
+	r.observe("ListInterventionStats", start, err)
+	return stats, err
+}
+
+// UpsertChallengeCheckpoint implements Repository.
+func (r *InstrumentedRepository) UpsertChallengeCheckpoint(ctx context.Context, c *domain.ChallengeCheckpoint) error {
+	start := time.Now()
+	err := r.repo.UpsertChallengeCheckpoint(ctx, c)
+	r.observe("UpsertChallengeCheckpoint", start, err)
+	return err
+}
+
+// ListChallengeCheckpoints implements Repository.
+func (r *InstrumentedRepository) ListChallengeCheckpoints(ctx context.Context, userID, challengeID string) ([]*domain.ChallengeCheckpoint, error) {
+	start := time.Now()
+	checkpoints, err := r.repo.ListChallengeCheckpoints(ctx, userID, challengeID)
+	r.observe("ListChallengeCheckpoints", start, err)
+	return checkpoints, err
+}
+
+// UpsertChallengeAssignment implements Repository.
+func (r *InstrumentedRepository) UpsertChallengeAssignment(ctx context.Context, a *domain.ChallengeAssignment) error {
+	start := time.Now()
+	err := r.repo.UpsertChallengeAssignment(ctx, a)
+	r.observe("UpsertChallengeAssignment", start, err)
+	return err
+}
+
+// ListChallengeAssignments implements Repository.
+func (r *InstrumentedRepository) ListChallengeAssignments(ctx context.Context, userID string) ([]*domain.ChallengeAssignment, error) {
+	start := time.Now()
+	assignments, err := r.repo.ListChallengeAssignments(ctx, userID)
+	r.observe("ListChallengeAssignments", start, err)
+	return assignments, err
+}
+
+// InsertChallengeAttempt implements Repository.
+func (r *InstrumentedRepository) InsertChallengeAttempt(ctx context.Context, a *domain.ChallengeAttempt) error {
+	start := time.Now()
+	err := r.repo.InsertChallengeAttempt(ctx, a)
+	r.observe("InsertChallengeAttempt", start, err)
+	return err
+}
+
+// ListChallengeAttempts implements Repository.
+func (r *InstrumentedRepository) ListChallengeAttempts(ctx context.Context, userID, challengeID string) ([]*domain.ChallengeAttempt, error) {
+	start := time.Now()
+	attempts, err := r.repo.ListChallengeAttempts(ctx, userID, challengeID)
+	r.observe("ListChallengeAttempts", start, err)
+	return attempts, err
+}
+
+// CompleteChallenge implements Repository.
+func (r *InstrumentedRepository) CompleteChallenge(ctx context.Context, c *domain.ChallengeCompletion) (bool, error) {
+	start := time.Now()
+	first, err := r.repo.CompleteChallenge(ctx, c)
+	r.observe("CompleteChallenge", start, err)
+	return first, err
+}
+
+// ListChallengeCompletions implements Repository.
+func (r *InstrumentedRepository) ListChallengeCompletions(ctx context.Context, userID string) ([]*domain.ChallengeCompletion, error) {
+	start := time.Now()
+	completions, err := r.repo.ListChallengeCompletions(ctx, userID)
+	r.observe("ListChallengeCompletions", start, err)
+	return completions, err
+}
+
+// InsertContainerEvent implements Repository.
+func (r *InstrumentedRepository) InsertContainerEvent(ctx context.Context, e *domain.ContainerEvent) error {
+	start := time.Now()
+	err := r.repo.InsertContainerEvent(ctx, e)
+	r.observe("InsertContainerEvent", start, err)
+	return err
+}
+
+// ListContainerEvents implements Repository.
+func (r *InstrumentedRepository) ListContainerEvents(ctx context.Context, userID string, limit int) ([]*domain.ContainerEvent, error) {
+	start := time.Now()
+	events, err := r.repo.ListContainerEvents(ctx, userID, limit)
+	r.observe("ListContainerEvents", start, err)
+	return events, err
+}
+
+// PruneContainerEvents implements Repository.
+func (r *InstrumentedRepository) PruneContainerEvents(ctx context.Context, retention time.Duration) (int64, error) {
+	start := time.Now()
+	n, err := r.repo.PruneContainerEvents(ctx, retention)
+	r.observe("PruneContainerEvents", start, err)
+	return n, err
+}
+
+// CreateSessionShare implements Repository.
+func (r *InstrumentedRepository) CreateSessionShare(ctx context.Context, share *domain.SessionShare) error {
+	start := time.Now()
+	err := r.repo.CreateSessionShare(ctx, share)
+	r.observe("CreateSessionShare", start, err)
+	return err
+}
+
+// GetSessionShare implements Repository.
+func (r *InstrumentedRepository) GetSessionShare(ctx context.Context, token string) (*domain.SessionShare, error) {
+	start := time.Now()
+	share, err := r.repo.GetSessionShare(ctx, token)
+	r.observe("GetSessionShare", start, err)
+	return share, err
+}
+
+// ListSessionShares implements Repository.
+func (r *InstrumentedRepository) ListSessionShares(ctx context.Context, userID string) ([]*domain.SessionShare, error) {
+	start := time.Now()
+	shares, err := r.repo.ListSessionShares(ctx, userID)
+	r.observe("ListSessionShares", start, err)
+	return shares, err
+}
+
+// DeleteSessionShare implements Repository.
+func (r *InstrumentedRepository) DeleteSessionShare(ctx context.Context, userID, token string) (bool, error) {
+	start := time.Now()
+	deleted, err := r.repo.DeleteSessionShare(ctx, userID, token)
+	r.observe("DeleteSessionShare", start, err)
+	return deleted, err
+}
+
+// PruneExpiredSessionShares implements Repository.
+func (r *InstrumentedRepository) PruneExpiredSessionShares(ctx context.Context) (int64, error) {
+	start := time.Now()
+	n, err := r.repo.PruneExpiredSessionShares(ctx)
+	r.observe("PruneExpiredSessionShares", start, err)
+	return n, err
+}
+
+// UpsertSnippet implements Repository.
+func (r *InstrumentedRepository) UpsertSnippet(ctx context.Context, snippet *domain.Snippet) error {
+	start := time.Now()
+	err := r.repo.UpsertSnippet(ctx, snippet)
+	r.observe("UpsertSnippet", start, err)
+	return err
+}
+
+// ListSnippets implements Repository.
+func (r *InstrumentedRepository) ListSnippets(ctx context.Context, userID string) ([]*domain.Snippet, error) {
+	start := time.Now()
+	snippets, err := r.repo.ListSnippets(ctx, userID)
+	r.observe("ListSnippets", start, err)
+	return snippets, err
+}
+
+// DeleteSnippet implements Repository.
+func (r *InstrumentedRepository) DeleteSnippet(ctx context.Context, userID, name string) (bool, error) {
+	start := time.Now()
+	deleted, err := r.repo.DeleteSnippet(ctx, userID, name)
+	r.observe("DeleteSnippet", start, err)
+	return deleted, err
+}
+
+// ListArchivedSessions implements Repository.
+func (r *InstrumentedRepository) ListArchivedSessions(ctx context.Context, userID string) ([]*domain.ArchivedAgentSession, error) {
+	start := time.Now()
+	sessions, err := r.repo.ListArchivedSessions(ctx, userID)
+	r.observe("ListArchivedSessions", start, err)
+	return sessions, err
+}
+
+// PruneArchivedSessions implements Repository.
+func (r *InstrumentedRepository) PruneArchivedSessions(ctx context.Context, retention time.Duration) (int64, error) {
+	start := time.Now()
+	n, err := r.repo.PruneArchivedSessions(ctx, retention)
+	r.observe("PruneArchivedSessions", start, err)
+	return n, err
+}
+
+// CreateNotification implements Repository.
+func (r *InstrumentedRepository) CreateNotification(ctx context.Context, n *domain.Notification) error {
+	start := time.Now()
+	err := r.repo.CreateNotification(ctx, n)
+	r.observe("CreateNotification", start, err)
+	return err
+}
+
+// ListNotifications implements Repository.
+func (r *InstrumentedRepository) ListNotifications(ctx context.Context, userID string, unreadOnly bool, limit int) ([]*domain.Notification, error) {
+	start := time.Now()
+	notifications, err := r.repo.ListNotifications(ctx, userID, unreadOnly, limit)
+	r.observe("ListNotifications", start, err)
+	return notifications, err
+}
+
+// MarkNotificationsRead implements Repository.
+func (r *InstrumentedRepository) MarkNotificationsRead(ctx context.Context, userID string, ids []int64, readAt time.Time) (int64, error) {
+	start := time.Now()
+	n, err := r.repo.MarkNotificationsRead(ctx, userID, ids, readAt)
+	r.observe("MarkNotificationsRead", start, err)
+	return n, err
+}
+
+// CountUnreadNotifications implements Repository.
+func (r *InstrumentedRepository) CountUnreadNotifications(ctx context.Context, userID string) (int, error) {
+	start := time.Now()
+	n, err := r.repo.CountUnreadNotifications(ctx, userID)
+	r.observe("CountUnreadNotifications", start, err)
+	return n, err
+}
+
+// EnqueueProvision implements Repository.
+func (r *InstrumentedRepository) EnqueueProvision(ctx context.Context, userID string, enqueuedAt time.Time) error {
+	start := time.Now()
+	err := r.repo.EnqueueProvision(ctx, userID, enqueuedAt)
+	r.observe("EnqueueProvision", start, err)
+	return err
+}
+
+// DequeueProvision implements Repository.
+func (r *InstrumentedRepository) DequeueProvision(ctx context.Context, userID string) error {
+	start := time.Now()
+	err := r.repo.DequeueProvision(ctx, userID)
+	r.observe("DequeueProvision", start, err)
+	return err
+}
+
+// ListProvisionQueue implements Repository.
+func (r *InstrumentedRepository) ListProvisionQueue(ctx context.Context) ([]string, error) {
+	start := time.Now()
+	userIDs, err := r.repo.ListProvisionQueue(ctx)
+	r.observe("ListProvisionQueue", start, err)
+	return userIDs, err
+}
+
+// ReserveEventIDs implements Repository.
+func (r *InstrumentedRepository) ReserveEventIDs(ctx context.Context, userID, sessionID string, n int64) (int64, error) {
+	start := time.Now()
+	mark, err := r.repo.ReserveEventIDs(ctx, userID, sessionID, n)
+	r.observe("ReserveEventIDs", start, err)
+	return mark, err
+}
+
+// InsertCommand implements Repository.
+func (r *InstrumentedRepository) InsertCommand(ctx context.Context, c *domain.CommandRecord) error {
+	start := time.Now()
+	err := r.repo.InsertCommand(ctx, c)
+	r.observe("InsertCommand", start, err)
+	return err
+}
+
+// ListCommands implements Repository.
+func (r *InstrumentedRepository) ListCommands(ctx context.Context, userID, sessionID string, limit int) ([]*domain.CommandRecord, error) {
+	start := time.Now()
+	commands, err := r.repo.ListCommands(ctx, userID, sessionID, limit)
+	r.observe("ListCommands", start, err)
+	return commands, err
+}
+
+// ExportUserData implements Repository.
+func (r *InstrumentedRepository) ExportUserData(ctx context.Context, userID string) (*domain.UserDataExport, error) {
+	start := time.Now()
+	export, err := r.repo.ExportUserData(ctx, userID)
+	r.observe("ExportUserData", start, err)
+	return export, err
+}
+
+// PurgeUser implements Repository.
+func (r *InstrumentedRepository) PurgeUser(ctx context.Context, userID string) error {
+	start := time.Now()
+	err := r.repo.PurgeUser(ctx, userID)
+	r.observe("PurgeUser", start, err)
+	return err
+}
+
+// DeleteLegacyLocalState implements Repository.
+func (r *InstrumentedRepository) DeleteLegacyLocalState(ctx context.Context) (int64, int64, error) {
+	start := time.Now()
+	users, sessions, err := r.repo.DeleteLegacyLocalState(ctx)
+	r.observe("DeleteLegacyLocalState", start, err)
+	return users, sessions, err
+}
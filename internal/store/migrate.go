@@ -0,0 +1,199 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// errUnknownSchemaVersion is returned when asked to migrate to a version that
+// no migration defines.
+var errUnknownSchemaVersion = errors.New("unknown schema version")
+
+// Migrator is implemented by repositories with a versioned schema.
+type Migrator interface {
+	// SchemaVersion returns the highest applied migration, or 0 for an empty
+	// database.
+	SchemaVersion(ctx context.Context) (int, error)
+
+	// MigrateTo applies or reverts migrations until the schema is at version.
+	// Version 0 reverts every migration.
+	MigrateTo(ctx context.Context, version int) error
+}
+
+var (
+	_ Migrator = (*SQLiteStore)(nil)
+	_ Migrator = (*PostgresStore)(nil)
+)
+
+// migration is one ordered schema change. up applies it and down reverts it;
+// each runs in its own transaction together with the schema_version update.
+type migration struct {
+	version int
+	name    string
+	up      func(ctx context.Context, tx *sql.Tx) error
+	down    func(ctx context.Context, tx *sql.Tx) error
+}
+
+// execMigration returns a migration step that runs a fixed SQL script.
+func execMigration(query string) func(ctx context.Context, tx *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, query)
+		return err
+	}
+}
+
+// migrator applies migrations to a database and records them in the
+// schema_version table. Migrations must be listed in ascending version order.
+type migrator struct {
+	db         *sql.DB
+	migrations []migration
+	// bind returns the placeholder for the nth (1-based) query argument.
+	bind func(n int) string
+	// lock, if set, runs first in every migration transaction to serialize
+	// servers migrating the same database.
+	lock func(ctx context.Context, tx *sql.Tx) error
+}
+
+func (m *migrator) ensureVersionTable(ctx context.Context) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at BIGINT NOT NULL
+	)`
+	return m.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("create schema_version table: %w", err)
+		}
+		return nil
+	})
+}
+
+// version returns the highest applied migration.
+func (m *migrator) version(ctx context.Context) (int, error) {
+	if err := m.ensureVersionTable(ctx); err != nil {
+		return 0, err
+	}
+	var version sql.NullInt64
+	if err := m.db.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_version`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("query schema version: %w", err)
+	}
+	return int(version.Int64), nil
+}
+
+// latest returns the version of the newest migration.
+func (m *migrator) latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].version
+}
+
+// migrateTo applies pending migrations up to target, or reverts applied ones
+// down to target.
+func (m *migrator) migrateTo(ctx context.Context, target int) error {
+	if target < 0 || target > m.latest() {
+		return fmt.Errorf("%w: %d (latest is %d)", errUnknownSchemaVersion, target, m.latest())
+	}
+	current, err := m.version(ctx)
+	if err != nil {
+		return err
+	}
+
+	if target >= current {
+		for _, mg := range m.migrations {
+			if mg.version <= current || mg.version > target {
+				continue
+			}
+			if err := m.apply(ctx, mg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		mg := m.migrations[i]
+		if mg.version > current || mg.version <= target {
+			continue
+		}
+		if err := m.revert(ctx, mg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply runs mg's up step unless another server applied it first.
+func (m *migrator) apply(ctx context.Context, mg migration) error {
+	return m.inTx(ctx, func(tx *sql.Tx) error {
+		applied, err := m.applied(ctx, tx, mg.version)
+		if err != nil || applied {
+			return err
+		}
+		if err := mg.up(ctx, tx); err != nil {
+			return fmt.Errorf("apply migration %d (%s): %w", mg.version, mg.name, err)
+		}
+		query := fmt.Sprintf(`INSERT INTO schema_version (version, name, applied_at) VALUES (%s, %s, %s)`,
+			m.bind(1), m.bind(2), m.bind(3))
+		if _, err := tx.ExecContext(ctx, query, mg.version, mg.name, time.Now().Unix()); err != nil {
+			return fmt.Errorf("record migration %d: %w", mg.version, err)
+		}
+		slog.Info("Applied schema migration", "version", mg.version, "name", mg.name)
+		return nil
+	})
+}
+
+// revert runs mg's down step if it is still applied.
+func (m *migrator) revert(ctx context.Context, mg migration) error {
+	return m.inTx(ctx, func(tx *sql.Tx) error {
+		applied, err := m.applied(ctx, tx, mg.version)
+		if err != nil || !applied {
+			return err
+		}
+		if err := mg.down(ctx, tx); err != nil {
+			return fmt.Errorf("revert migration %d (%s): %w", mg.version, mg.name, err)
+		}
+		query := fmt.Sprintf(`DELETE FROM schema_version WHERE version = %s`, m.bind(1))
+		if _, err := tx.ExecContext(ctx, query, mg.version); err != nil {
+			return fmt.Errorf("unrecord migration %d: %w", mg.version, err)
+		}
+		slog.Info("Reverted schema migration", "version", mg.version, "name", mg.name)
+		return nil
+	})
+}
+
+func (m *migrator) applied(ctx context.Context, tx *sql.Tx, version int) (bool, error) {
+	var n int
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM schema_version WHERE version = %s`, m.bind(1))
+	if err := tx.QueryRowContext(ctx, query, version).Scan(&n); err != nil {
+		return false, fmt.Errorf("check migration %d: %w", version, err)
+	}
+	return n > 0, nil
+}
+
+// inTx runs fn in a transaction, taking the migration lock first.
+func (m *migrator) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin migration: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if m.lock != nil {
+		if err := m.lock(ctx, tx); err != nil {
+			return fmt.Errorf("lock schema: %w", err)
+		}
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit migration: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// migratedStore is a repository with a versioned schema.
+type migratedStore interface {
+	Repository
+	Migrator
+	migrator() *migrator
+}
+
+// testMigrationsRoundTrip reverts every migration of a freshly opened store
+// one at a time, checks that only schema_version is left, applies them all
+// again and checks the store still works. tables lists the tables in the
+// store's database.
+func testMigrationsRoundTrip(t *testing.T, repo migratedStore, tables func(t *testing.T) []string) {
+	t.Helper()
+	ctx := t.Context()
+	latest := repo.migrator().latest()
+
+	if version, err := repo.SchemaVersion(ctx); err != nil || version != latest {
+		t.Fatalf("SchemaVersion of a new store = %d, %v; want %d", version, err, latest)
+	}
+	if err := repo.MigrateTo(ctx, latest+1); !errors.Is(err, errUnknownSchemaVersion) {
+		t.Fatalf("MigrateTo(%d) = %v, want errUnknownSchemaVersion", latest+1, err)
+	}
+
+	for target := latest - 1; target >= 0; target-- {
+		if err := repo.MigrateTo(ctx, target); err != nil {
+			t.Fatalf("MigrateTo(%d): %v", target, err)
+		}
+		if version, err := repo.SchemaVersion(ctx); err != nil || version != target {
+			t.Fatalf("SchemaVersion after reverting to %d = %d, %v", target, version, err)
+		}
+	}
+	if left := tables(t); !slices.Equal(left, []string{"schema_version"}) {
+		t.Fatalf("tables left after reverting every migration: %q", left)
+	}
+
+	if err := repo.MigrateTo(ctx, latest); err != nil {
+		t.Fatalf("MigrateTo(%d): %v", latest, err)
+	}
+	if version, err := repo.SchemaVersion(ctx); err != nil || version != latest {
+		t.Fatalf("SchemaVersion after reapplying = %d, %v; want %d", version, err, latest)
+	}
+	testRepository(t, repo)
+}
+
+// queryTables returns the sorted names a single-column query lists.
+func queryTables(t *testing.T, db *sql.DB, query string) []string {
+	t.Helper()
+	rows, err := db.QueryContext(t.Context(), query)
+	if err != nil {
+		t.Fatalf("list tables: %v", err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("list tables: %v", err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("list tables: %v", err)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestSQLiteMigrationsRoundTrip(t *testing.T) {
+	repo := newTestSQLite(t).(*SQLiteStore)
+	testMigrationsRoundTrip(t, repo, func(t *testing.T) []string {
+		return queryTables(t, repo.db, `SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'`)
+	})
+}
+
+func TestPostgresMigrationsRoundTrip(t *testing.T) {
+	repo := newTestPostgres(t)
+	testMigrationsRoundTrip(t, repo, func(t *testing.T) []string {
+		return queryTables(t, repo.db, `SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema()`)
+	})
+}
@@ -0,0 +1,581 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+	_ "github.com/lib/pq" // Register PostgreSQL driver.
+)
+
+// PoolOptions sizes the connection pool of a networked database.
+type PoolOptions struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// PostgresStore implements Repository using PostgreSQL, so several server
+// instances can share users, sessions and the provisioning queue.
+// Timestamps are stored as Unix seconds, matching SQLiteStore.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgres creates a new PostgreSQL-backed repository for the given
+// connection URL and migrates the schema to the latest version.
+func NewPostgres(dsn string, pool PoolOptions) (Repository, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+
+	if err := db.PingContext(context.Background()); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("ping database: %w", err)
+	}
+
+	store := &PostgresStore{db: db}
+	if err := store.initSchema(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("initialize schema: %w", err)
+	}
+
+	return store, nil
+}
+
+// postgresMigrationLockID keys the advisory lock that serializes servers
+// migrating the same database.
+const postgresMigrationLockID = 0x73687368 // "shsh"
+
+// initSchema migrates the database to the latest schema version.
+func (s *PostgresStore) initSchema() error {
+	m := s.migrator()
+	return m.migrateTo(context.Background(), m.latest())
+}
+
+func (s *PostgresStore) migrator() *migrator {
+	return &migrator{
+		db:         s.db,
+		migrations: postgresMigrations,
+		bind:       bindDollar,
+		lock: func(ctx context.Context, tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, postgresMigrationLockID)
+			return err
+		},
+	}
+}
+
+// SchemaVersion returns the highest applied schema migration.
+func (s *PostgresStore) SchemaVersion(ctx context.Context) (int, error) {
+	return s.migrator().version(ctx)
+}
+
+// MigrateTo applies or reverts schema migrations until version is reached.
+func (s *PostgresStore) MigrateTo(ctx context.Context, version int) error {
+	return s.migrator().migrateTo(ctx, version)
+}
+
+// Ping verifies database connectivity.
+func (s *PostgresStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// GetUser retrieves a user by their user ID.
+func (s *PostgresStore) GetUser(ctx context.Context, userID string) (*domain.User, error) {
+	query := `
+		SELECT user_id, username, container_id, instance_id,
+		       last_seen_at, volume_path, created_at, updated_at, keep_warm_until,
+		       resource_tier, classroom
+		FROM users WHERE user_id = $1`
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query user: %w", err)
+	}
+	users, err := scanUsers(rows, "user")
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, nil
+	}
+	return users[0], nil
+}
+
+// UpsertUser creates or updates a user record.
+func (s *PostgresStore) UpsertUser(ctx context.Context, user *domain.User) error {
+	query := `
+	INSERT INTO users (user_id, username, container_id, last_seen_at, volume_path, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (user_id) DO UPDATE SET
+		username = excluded.username,
+		last_seen_at = excluded.last_seen_at,
+		updated_at = excluded.updated_at`
+
+	var containerID interface{}
+	if user.ContainerID != "" {
+		containerID = user.ContainerID
+	}
+
+	_, err := s.db.ExecContext(ctx, query,
+		user.UserID, user.Username, containerID,
+		user.LastSeenAt.Unix(), user.VolumePath,
+		user.CreatedAt.Unix(), user.UpdatedAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("upsert user: %w", err)
+	}
+	return nil
+}
+
+// UpdateLastSeen updates the last_seen_at timestamp for a user.
+func (s *PostgresStore) UpdateLastSeen(ctx context.Context, userID string, lastSeen time.Time) error {
+	query := `UPDATE users SET last_seen_at = $1, updated_at = $2 WHERE user_id = $3`
+	if _, err := s.db.ExecContext(ctx, query, lastSeen.Unix(), time.Now().Unix(), userID); err != nil {
+		return fmt.Errorf("update last_seen: %w", err)
+	}
+	return nil
+}
+
+// UpdateContainerID updates the container_id for a user.
+func (s *PostgresStore) UpdateContainerID(ctx context.Context, userID string, containerID string, expectedID string) error {
+	query := `UPDATE users SET container_id = $1, updated_at = $2 WHERE user_id = $3`
+	args := []interface{}{nil, time.Now().Unix(), userID}
+
+	if containerID != "" {
+		args[0] = containerID
+	}
+
+	if expectedID != "" {
+		query += ` AND container_id = $4`
+		args = append(args, expectedID)
+	}
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("update container_id: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		if expectedID != "" {
+			return errOptimisticLockContainerID
+		}
+		return errUserNotFound
+	}
+	return nil
+}
+
+// UpdateInstanceID records which server instance holds the user's terminal session.
+func (s *PostgresStore) UpdateInstanceID(ctx context.Context, userID string, instanceID string) error {
+	query := `UPDATE users SET instance_id = $1, updated_at = $2 WHERE user_id = $3`
+	var value interface{}
+	if instanceID != "" {
+		value = instanceID
+	}
+
+	result, err := s.db.ExecContext(ctx, query, value, time.Now().Unix(), userID)
+	if err != nil {
+		return fmt.Errorf("update instance_id: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
+
+// GetExpiredSessions retrieves users whose containers have exceeded the inactivity TTL.
+func (s *PostgresStore) GetExpiredSessions(ctx context.Context, ttl time.Duration) ([]*domain.User, error) {
+	threshold := time.Now().Add(-ttl).Unix()
+	query := `
+		SELECT user_id, username, container_id, instance_id,
+		       last_seen_at, volume_path, created_at, updated_at, keep_warm_until,
+		       resource_tier, classroom
+		FROM users WHERE container_id IS NOT NULL AND last_seen_at < $1`
+
+	rows, err := s.db.QueryContext(ctx, query, threshold)
+	if err != nil {
+		return nil, fmt.Errorf("query expired sessions: %w", err)
+	}
+	return scanUsers(rows, "expired sessions")
+}
+
+// GetActiveContainers retrieves users that currently have a container assigned.
+func (s *PostgresStore) GetActiveContainers(ctx context.Context) ([]*domain.User, error) {
+	query := `
+		SELECT user_id, username, container_id, instance_id,
+		       last_seen_at, volume_path, created_at, updated_at, keep_warm_until,
+		       resource_tier, classroom
+		FROM users WHERE container_id IS NOT NULL AND container_id != ''`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("query active containers: %w", err)
+	}
+	return scanUsers(rows, "active containers")
+}
+
+// SetKeepWarm exempts a user from TTL cleanup and rate limits until the given time.
+func (s *PostgresStore) SetKeepWarm(ctx context.Context, userID string, until time.Time) error {
+	query := `UPDATE users SET keep_warm_until = $1, updated_at = $2 WHERE user_id = $3`
+	var value interface{}
+	if !until.IsZero() {
+		value = until.Unix()
+	}
+
+	result, err := s.db.ExecContext(ctx, query, value, time.Now().Unix(), userID)
+	if err != nil {
+		return fmt.Errorf("update keep_warm_until: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
+
+// SetResourceTier assigns a user's containers a resource tier; an empty tier
+// clears the assignment.
+func (s *PostgresStore) SetResourceTier(ctx context.Context, userID, tier string) error {
+	query := `UPDATE users SET resource_tier = $1, updated_at = $2 WHERE user_id = $3`
+	var value interface{}
+	if tier != "" {
+		value = tier
+	}
+
+	result, err := s.db.ExecContext(ctx, query, value, time.Now().Unix(), userID)
+	if err != nil {
+		return fmt.Errorf("update resource_tier: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
+
+// SetClassroom assigns a user to a classroom; an empty classroom removes them
+// from theirs.
+func (s *PostgresStore) SetClassroom(ctx context.Context, userID, classroom string) error {
+	query := `UPDATE users SET classroom = $1, updated_at = $2 WHERE user_id = $3`
+	var value interface{}
+	if classroom != "" {
+		value = classroom
+	}
+
+	result, err := s.db.ExecContext(ctx, query, value, time.Now().Unix(), userID)
+	if err != nil {
+		return fmt.Errorf("update classroom: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
+
+// ListKeptWarmUsers returns users whose keep-warm exemption is in effect at now.
+func (s *PostgresStore) ListKeptWarmUsers(ctx context.Context, now time.Time) ([]*domain.User, error) {
+	query := `
+		SELECT user_id, username, container_id, instance_id,
+		       last_seen_at, volume_path, created_at, updated_at, keep_warm_until,
+		       resource_tier, classroom
+		FROM users WHERE keep_warm_until > $1 ORDER BY keep_warm_until`
+
+	rows, err := s.db.QueryContext(ctx, query, now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("query kept warm users: %w", err)
+	}
+	return scanUsers(rows, "kept warm users")
+}
+
+// Close closes the database connection pool.
+func (s *PostgresStore) Close() error {
+	if err := s.db.Close(); err != nil {
+		return fmt.Errorf("close database: %w", err)
+	}
+	return nil
+}
+
+// GetAgentSession retrieves the agent session state of a user's tab session.
+func (s *PostgresStore) GetAgentSession(ctx context.Context, userID, sessionID string) (*domain.AgentSession, error) {
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(getAgentSessionQuery, "$1", "$2"), userID, sessionID)
+	session, err := scanAgentSession(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scan agent session: %w", err)
+	}
+	return session, nil
+}
+
+// ListAgentSessions returns every agent session of a user, most recently
+// updated first.
+func (s *PostgresStore) ListAgentSessions(ctx context.Context, userID string) ([]*domain.AgentSession, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(listAgentSessionsQuery, "$1"), userID)
+	if err != nil {
+		return nil, fmt.Errorf("list agent sessions: %w", err)
+	}
+	return scanAgentSessions(rows)
+}
+
+// UpsertAgentSession creates or updates agent session state, failing with
+// ErrVersionConflict if it changed since session was read.
+func (s *PostgresStore) UpsertAgentSession(ctx context.Context, session *domain.AgentSession) error {
+	return upsertAgentSession(ctx, s.db, postgresDialect, session)
+}
+
+// DeleteAgentSession removes the agent session state of one tab session.
+func (s *PostgresStore) DeleteAgentSession(ctx context.Context, userID, sessionID string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM agent_sessions WHERE user_id = $1 AND session_id = $2`, userID, sessionID); err != nil {
+		return fmt.Errorf("delete agent session: %w", err)
+	}
+	return nil
+}
+
+// DeleteAgentSessions removes every agent session of a user.
+func (s *PostgresStore) DeleteAgentSessions(ctx context.Context, userID string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM agent_sessions WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("delete agent sessions: %w", err)
+	}
+	return nil
+}
+
+// CleanupExpiredSessions archives sessions older than TTL. Moving them in
+// one statement keeps a session updated meanwhile from being archived.
+func (s *PostgresStore) CleanupExpiredSessions(ctx context.Context, ttl time.Duration) (int64, error) {
+	now := time.Now()
+	threshold := now.Add(-ttl).Unix()
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM stream_event_ids WHERE updated_at < $1`, threshold); err != nil {
+		return 0, fmt.Errorf("cleanup stream event ids: %w", err)
+	}
+	result, err := s.db.ExecContext(ctx, `
+		WITH expired AS (
+			DELETE FROM agent_sessions WHERE updated_at < $1
+			RETURNING `+archiveColumns+`
+		)
+		INSERT INTO agent_sessions_archive (`+archiveColumns+`, archived_at)
+		SELECT `+archiveColumns+`, $2 FROM expired`,
+		threshold, now.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("archive expired sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// ReserveEventIDs advances a tab session's SSE event ID high-water mark.
+func (s *PostgresStore) ReserveEventIDs(ctx context.Context, userID, sessionID string, n int64) (int64, error) {
+	query := `
+		INSERT INTO stream_event_ids (user_id, session_id, high_water, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, session_id) DO UPDATE SET
+			high_water = stream_event_ids.high_water + EXCLUDED.high_water,
+			updated_at = EXCLUDED.updated_at
+		RETURNING high_water`
+
+	var mark int64
+	if err := s.db.QueryRowContext(ctx, query, userID, sessionID, n, time.Now().Unix()).Scan(&mark); err != nil {
+		return 0, fmt.Errorf("reserve event ids: %w", err)
+	}
+	return mark, nil
+}
+
+// CreateNotification stores a notification and trims the user's oldest ones.
+func (s *PostgresStore) CreateNotification(ctx context.Context, n *domain.Notification) error {
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = time.Now()
+	}
+
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO notifications (user_id, kind, title, body, created_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		n.UserID, string(n.Kind), n.Title, n.Body, n.CreatedAt.Unix()).Scan(&n.ID)
+	if err != nil {
+		return fmt.Errorf("insert notification: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		DELETE FROM notifications
+		WHERE user_id = $1 AND id NOT IN (
+			SELECT id FROM notifications WHERE user_id = $1 ORDER BY id DESC LIMIT $2
+		)`, n.UserID, maxNotificationsPerUser)
+	if err != nil {
+		return fmt.Errorf("trim notifications: %w", err)
+	}
+	return nil
+}
+
+// ListNotifications returns a user's notifications, newest first.
+func (s *PostgresStore) ListNotifications(ctx context.Context, userID string, unreadOnly bool, limit int) ([]*domain.Notification, error) {
+	query := `
+		SELECT id, user_id, kind, title, body, created_at, read_at
+		FROM notifications WHERE user_id = $1`
+	if unreadOnly {
+		query += ` AND read_at IS NULL`
+	}
+	query += ` ORDER BY id DESC LIMIT $2`
+
+	rows, err := s.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query notifications: %w", err)
+	}
+	return scanNotifications(rows)
+}
+
+// MarkNotificationsRead marks notifications read; empty ids marks all of them.
+func (s *PostgresStore) MarkNotificationsRead(ctx context.Context, userID string, ids []int64, readAt time.Time) (int64, error) {
+	query := `UPDATE notifications SET read_at = $1 WHERE user_id = $2 AND read_at IS NULL`
+	args := []interface{}{readAt.Unix(), userID}
+	if len(ids) > 0 {
+		placeholders := make([]string, len(ids))
+		for i, id := range ids {
+			args = append(args, id)
+			placeholders[i] = "$" + strconv.Itoa(len(args))
+		}
+		query += ` AND id IN (` + strings.Join(placeholders, ", ") + `)`
+	}
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("mark notifications read: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// CountUnreadNotifications returns the number of unread notifications for a user.
+func (s *PostgresStore) CountUnreadNotifications(ctx context.Context, userID string) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count unread notifications: %w", err)
+	}
+	return count, nil
+}
+
+// EnqueueProvision adds a user to the provisioning wait queue.
+func (s *PostgresStore) EnqueueProvision(ctx context.Context, userID string, enqueuedAt time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO provision_queue (user_id, enqueued_at) VALUES ($1, $2) ON CONFLICT (user_id) DO NOTHING`,
+		userID, enqueuedAt.UnixNano())
+	if err != nil {
+		return fmt.Errorf("enqueue provision: %w", err)
+	}
+	return nil
+}
+
+// DequeueProvision removes a user from the provisioning wait queue.
+func (s *PostgresStore) DequeueProvision(ctx context.Context, userID string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM provision_queue WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("dequeue provision: %w", err)
+	}
+	return nil
+}
+
+// ListProvisionQueue returns queued user IDs, oldest first.
+func (s *PostgresStore) ListProvisionQueue(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT user_id FROM provision_queue ORDER BY enqueued_at, seq`)
+	if err != nil {
+		return nil, fmt.Errorf("query provision queue: %w", err)
+	}
+	return scanProvisionQueue(rows)
+}
+
+// InsertCommand stores an executed command and trims the user's oldest ones.
+func (s *PostgresStore) InsertCommand(ctx context.Context, c *domain.CommandRecord) error {
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO commands (user_id, session_id, sequence, command, pwd, exit_code, duration_ms, started_at, ended_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`,
+		c.UserID, c.SessionID, c.Sequence, c.Command, c.PWD, c.ExitCode,
+		c.Duration.Milliseconds(), c.StartedAt.UnixMilli(), c.EndedAt.UnixMilli()).Scan(&c.ID)
+	if err != nil {
+		return fmt.Errorf("insert command: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		DELETE FROM commands
+		WHERE user_id = $1 AND id NOT IN (
+			SELECT id FROM commands WHERE user_id = $1 ORDER BY id DESC LIMIT $2
+		)`, c.UserID, maxCommandsPerUser)
+	if err != nil {
+		return fmt.Errorf("trim commands: %w", err)
+	}
+	return nil
+}
+
+// ListCommands returns a user's executed commands, newest first.
+func (s *PostgresStore) ListCommands(ctx context.Context, userID, sessionID string, limit int) ([]*domain.CommandRecord, error) {
+	query := `
+		SELECT id, user_id, session_id, sequence, command, pwd, exit_code, duration_ms, started_at, ended_at
+		FROM commands WHERE user_id = $1`
+	args := []any{userID}
+	if sessionID != "" {
+		args = append(args, sessionID)
+		query += ` AND session_id = $` + strconv.Itoa(len(args))
+	}
+	query += ` ORDER BY id DESC`
+	if limit > 0 {
+		args = append(args, limit)
+		query += ` LIMIT $` + strconv.Itoa(len(args))
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query commands: %w", err)
+	}
+	return scanCommands(rows)
+}
+
+// DeleteLegacyLocalState removes pre-migration single-user local records.
+func (s *PostgresStore) DeleteLegacyLocalState(ctx context.Context) (int64, int64, error) {
+	userRes, err := s.db.ExecContext(ctx, `DELETE FROM users WHERE user_id = $1`, "local")
+	if err != nil {
+		return 0, 0, fmt.Errorf("delete legacy local user: %w", err)
+	}
+	userRows, err := userRes.RowsAffected()
+	if err != nil {
+		return 0, 0, fmt.Errorf("legacy local user rows affected: %w", err)
+	}
+
+	agentRes, err := s.db.ExecContext(ctx, `DELETE FROM agent_sessions WHERE user_id = $1`, "local")
+	if err != nil {
+		return 0, 0, fmt.Errorf("delete legacy local agent session: %w", err)
+	}
+	agentRows, err := agentRes.RowsAffected()
+	if err != nil {
+		return 0, 0, fmt.Errorf("legacy local agent session rows affected: %w", err)
+	}
+
+	return userRows, agentRows, nil
+}
@@ -0,0 +1,306 @@
+package store
+
+// postgresMigrations is the PostgreSQL schema history. Append new migrations
+// with the next version; never edit one that has shipped. Versions match
+// sqliteMigrations.
+var postgresMigrations = []migration{
+	{
+		version: 1,
+		name:    "create users and agent sessions",
+		up: execMigration(`
+		CREATE TABLE IF NOT EXISTS users (
+			user_id TEXT PRIMARY KEY,
+			username TEXT NOT NULL,
+			container_id TEXT,
+			last_seen_at BIGINT NOT NULL,
+			volume_path TEXT NOT NULL,
+			created_at BIGINT NOT NULL,
+			updated_at BIGINT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_last_seen ON users(last_seen_at) WHERE container_id IS NOT NULL;
+
+		CREATE TABLE IF NOT EXISTS agent_sessions (
+			user_id TEXT PRIMARY KEY,
+			last_proactive_msg BIGINT,
+			attempt_count INTEGER NOT NULL DEFAULT 0,
+			just_self_corrected BOOLEAN NOT NULL DEFAULT FALSE,
+			is_typing BOOLEAN NOT NULL DEFAULT FALSE,
+			challenge_json TEXT,
+			messages_json TEXT NOT NULL DEFAULT '',
+			created_at BIGINT NOT NULL,
+			updated_at BIGINT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_agent_sessions_updated ON agent_sessions(updated_at);`),
+		down: execMigration(`
+		DROP TABLE IF EXISTS agent_sessions;
+		DROP TABLE IF EXISTS users;`),
+	},
+	{
+		version: 2,
+		name:    "add users.instance_id",
+		up:      execMigration(`ALTER TABLE users ADD COLUMN IF NOT EXISTS instance_id TEXT`),
+		down:    execMigration(`ALTER TABLE users DROP COLUMN IF EXISTS instance_id`),
+	},
+	{
+		version: 3,
+		name:    "create notifications",
+		up: execMigration(`
+		CREATE TABLE IF NOT EXISTS notifications (
+			id BIGSERIAL PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			title TEXT NOT NULL DEFAULT '',
+			body TEXT NOT NULL,
+			created_at BIGINT NOT NULL,
+			read_at BIGINT
+		);
+		CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, id);`),
+		down: execMigration(`DROP TABLE IF EXISTS notifications`),
+	},
+	{
+		version: 4,
+		name:    "create provision queue",
+		up: execMigration(`
+		CREATE TABLE IF NOT EXISTS provision_queue (
+			seq BIGSERIAL,
+			user_id TEXT PRIMARY KEY,
+			enqueued_at BIGINT NOT NULL
+		);`),
+		down: execMigration(`DROP TABLE IF EXISTS provision_queue`),
+	},
+	{
+		version: 5,
+		name:    "create stream event ids",
+		up: execMigration(`
+		CREATE TABLE stream_event_ids (
+			user_id TEXT NOT NULL,
+			session_id TEXT NOT NULL,
+			high_water BIGINT NOT NULL,
+			updated_at BIGINT NOT NULL,
+			PRIMARY KEY (user_id, session_id)
+		);
+		CREATE INDEX idx_stream_event_ids_updated ON stream_event_ids(updated_at);`),
+		down: execMigration(`DROP TABLE stream_event_ids`),
+	},
+	{
+		version: 6,
+		name:    "create commands",
+		up: execMigration(`
+		CREATE TABLE commands (
+			id BIGSERIAL PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			session_id TEXT NOT NULL,
+			sequence INTEGER NOT NULL,
+			command TEXT NOT NULL,
+			pwd TEXT NOT NULL DEFAULT '',
+			exit_code INTEGER NOT NULL,
+			duration_ms BIGINT NOT NULL,
+			started_at BIGINT NOT NULL,
+			ended_at BIGINT NOT NULL
+		);
+		CREATE INDEX idx_commands_user ON commands(user_id, id);`),
+		down: execMigration(`DROP TABLE commands`),
+	},
+	{
+		version: 7,
+		name:    "add users.keep_warm_until",
+		up:      execMigration(`ALTER TABLE users ADD COLUMN IF NOT EXISTS keep_warm_until BIGINT`),
+		down:    execMigration(`ALTER TABLE users DROP COLUMN IF EXISTS keep_warm_until`),
+	},
+	{
+		version: 8,
+		name:    "create agent sessions archive",
+		up: execMigration(`
+		CREATE TABLE agent_sessions_archive (
+			id BIGSERIAL PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			last_proactive_msg BIGINT,
+			attempt_count INTEGER NOT NULL DEFAULT 0,
+			just_self_corrected BOOLEAN NOT NULL DEFAULT FALSE,
+			challenge_json TEXT,
+			messages_json TEXT NOT NULL DEFAULT '',
+			created_at BIGINT NOT NULL,
+			updated_at BIGINT NOT NULL,
+			archived_at BIGINT NOT NULL
+		);
+		CREATE INDEX idx_agent_sessions_archive_user ON agent_sessions_archive(user_id, id);
+		CREATE INDEX idx_agent_sessions_archive_archived ON agent_sessions_archive(archived_at);`),
+		down: execMigration(`DROP TABLE agent_sessions_archive`),
+	},
+	{
+		version: 9,
+		name:    "create command stats",
+		up: execMigration(`
+		CREATE TABLE command_stats_daily (
+			user_id TEXT NOT NULL,
+			day TEXT NOT NULL,
+			commands INTEGER NOT NULL DEFAULT 0,
+			errors INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (user_id, day)
+		);
+		CREATE TABLE command_tools_daily (
+			user_id TEXT NOT NULL,
+			day TEXT NOT NULL,
+			tool TEXT NOT NULL,
+			PRIMARY KEY (user_id, day, tool)
+		);
+		CREATE TABLE analytics_watermarks (
+			name TEXT PRIMARY KEY,
+			last_id BIGINT NOT NULL
+		);`),
+		down: execMigration(`
+		DROP TABLE analytics_watermarks;
+		DROP TABLE command_tools_daily;
+		DROP TABLE command_stats_daily;`),
+	},
+	{
+		version: 10,
+		name:    "create challenge checkpoints",
+		up: execMigration(`
+		CREATE TABLE challenge_checkpoints (
+			user_id TEXT NOT NULL,
+			challenge_id TEXT NOT NULL,
+			step INTEGER NOT NULL,
+			snapshot TEXT NOT NULL,
+			diff_json TEXT NOT NULL,
+			created_at BIGINT NOT NULL,
+			PRIMARY KEY (user_id, challenge_id, step)
+		);`),
+		down: execMigration(`DROP TABLE challenge_checkpoints`),
+	},
+	{
+		// Sessions stored before keep an empty session_id.
+		version: 11,
+		name:    "key agent sessions by tab session",
+		up: execMigration(`
+		ALTER TABLE agent_sessions ADD COLUMN session_id TEXT NOT NULL DEFAULT '';
+		ALTER TABLE agent_sessions DROP CONSTRAINT agent_sessions_pkey;
+		ALTER TABLE agent_sessions ADD PRIMARY KEY (user_id, session_id);
+		ALTER TABLE agent_sessions_archive ADD COLUMN session_id TEXT NOT NULL DEFAULT '';`),
+		// Only the most recently updated session of each user survives.
+		down: execMigration(`
+		DELETE FROM agent_sessions a USING agent_sessions b
+		WHERE a.user_id = b.user_id AND (a.updated_at, a.session_id) < (b.updated_at, b.session_id);
+		ALTER TABLE agent_sessions DROP CONSTRAINT agent_sessions_pkey;
+		ALTER TABLE agent_sessions DROP COLUMN session_id;
+		ALTER TABLE agent_sessions ADD PRIMARY KEY (user_id);
+		ALTER TABLE agent_sessions_archive DROP COLUMN session_id;`),
+	},
+	{
+		version: 12,
+		name:    "create session shares",
+		up: execMigration(`
+		CREATE TABLE session_shares (
+			token TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			session_id TEXT NOT NULL,
+			transcript_json TEXT NOT NULL,
+			created_at BIGINT NOT NULL,
+			expires_at BIGINT NOT NULL
+		);
+		CREATE INDEX idx_session_shares_user ON session_shares(user_id);
+		CREATE INDEX idx_session_shares_expires ON session_shares(expires_at);`),
+		down: execMigration(`DROP TABLE session_shares`),
+	},
+	{
+		version: 13,
+		name:    "create intervention outcomes",
+		up: execMigration(`
+		CREATE TABLE intervention_outcomes (
+			id BIGSERIAL PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			session_id TEXT NOT NULL,
+			response_type TEXT NOT NULL,
+			pattern TEXT NOT NULL DEFAULT '',
+			outcome TEXT NOT NULL,
+			hinted_at BIGINT NOT NULL,
+			resolved_at BIGINT NOT NULL
+		);
+		CREATE INDEX idx_intervention_outcomes_user ON intervention_outcomes(user_id);
+		CREATE INDEX idx_intervention_outcomes_hinted ON intervention_outcomes(hinted_at);`),
+		down: execMigration(`DROP TABLE intervention_outcomes`),
+	},
+	{
+		version: 14,
+		name:    "add agent_sessions.version",
+		up:      execMigration(`ALTER TABLE agent_sessions ADD COLUMN version BIGINT NOT NULL DEFAULT 0`),
+		down:    execMigration(`ALTER TABLE agent_sessions DROP COLUMN version`),
+	},
+	{
+		version: 15,
+		name:    "create challenge progress",
+		up: execMigration(`
+		CREATE TABLE challenge_assignments (
+			user_id TEXT NOT NULL,
+			challenge_id TEXT NOT NULL,
+			challenge_json TEXT NOT NULL,
+			hints_used INTEGER NOT NULL DEFAULT 0,
+			assigned_at BIGINT NOT NULL,
+			updated_at BIGINT NOT NULL,
+			PRIMARY KEY (user_id, challenge_id)
+		);
+		CREATE TABLE challenge_attempts (
+			id BIGSERIAL PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			challenge_id TEXT NOT NULL,
+			step INTEGER NOT NULL,
+			passed BOOLEAN NOT NULL,
+			attempted_at BIGINT NOT NULL
+		);
+		CREATE INDEX idx_challenge_attempts_user ON challenge_attempts(user_id, challenge_id, id);
+		CREATE TABLE challenge_completions (
+			user_id TEXT NOT NULL,
+			challenge_id TEXT NOT NULL,
+			attempts INTEGER NOT NULL,
+			hints_used INTEGER NOT NULL,
+			completed_at BIGINT NOT NULL,
+			PRIMARY KEY (user_id, challenge_id)
+		);`),
+		down: execMigration(`
+		DROP TABLE challenge_completions;
+		DROP TABLE challenge_attempts;
+		DROP TABLE challenge_assignments;`),
+	},
+	{
+		version: 16,
+		name:    "create container events",
+		up: execMigration(`
+		CREATE TABLE container_events (
+			id BIGSERIAL PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			container_id TEXT NOT NULL,
+			event TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			created_at BIGINT NOT NULL
+		);
+		CREATE INDEX idx_container_events_user ON container_events(user_id, id);
+		CREATE INDEX idx_container_events_created ON container_events(created_at);`),
+		down: execMigration(`DROP TABLE container_events;`),
+	},
+	{
+		version: 17,
+		name:    "add users.resource_tier",
+		up:      execMigration(`ALTER TABLE users ADD COLUMN IF NOT EXISTS resource_tier TEXT`),
+		down:    execMigration(`ALTER TABLE users DROP COLUMN IF EXISTS resource_tier`),
+	},
+	{
+		version: 18,
+		name:    "create snippets",
+		up: execMigration(`
+		CREATE TABLE snippets (
+			user_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			body TEXT NOT NULL,
+			updated_at BIGINT NOT NULL,
+			PRIMARY KEY (user_id, name)
+		);`),
+		down: execMigration(`DROP TABLE snippets;`),
+	},
+	{
+		version: 19,
+		name:    "add users.classroom",
+		up:      execMigration(`ALTER TABLE users ADD COLUMN IF NOT EXISTS classroom TEXT`),
+		down:    execMigration(`ALTER TABLE users DROP COLUMN IF EXISTS classroom`),
+	},
+}
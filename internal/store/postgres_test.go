@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// postgresTestURL names a disposable database the PostgreSQL tests may wipe;
+// they are skipped without it.
+const postgresTestURL = "SHSH_TEST_POSTGRES_URL"
+
+func TestPostgresDriverLinked(t *testing.T) {
+	if !slices.Contains(sql.Drivers(), "postgres") {
+		t.Fatalf("no postgres driver among %v", sql.Drivers())
+	}
+	// With the driver linked, a bad server fails to connect rather than
+	// to open.
+	_, err := NewPostgres("postgres://shsh@127.0.0.1:1/shsh?sslmode=disable&connect_timeout=5", PoolOptions{})
+	if err == nil || !strings.Contains(err.Error(), "ping database") {
+		t.Fatalf("expected a ping error, got %v", err)
+	}
+}
+
+func newTestPostgres(t *testing.T) *PostgresStore {
+	t.Helper()
+	dsn := os.Getenv(postgresTestURL)
+	if dsn == "" {
+		t.Skipf("%s is not set", postgresTestURL)
+	}
+	repo, err := NewPostgres(dsn, PoolOptions{MaxOpenConns: 4, MaxIdleConns: 4})
+	if err != nil {
+		t.Fatalf("NewPostgres: %v", err)
+	}
+	pg := repo.(*PostgresStore)
+	t.Cleanup(func() {
+		// Leave the database empty for the next run.
+		_ = pg.MigrateTo(context.Background(), 0)
+		_ = pg.Close()
+	})
+	// Start from an empty schema whatever an earlier run left behind.
+	if err := pg.MigrateTo(t.Context(), 0); err != nil {
+		t.Fatalf("migrate down: %v", err)
+	}
+	if err := pg.MigrateTo(t.Context(), pg.migrator().latest()); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	return pg
+}
+
+func TestPostgresRepository(t *testing.T) {
+	testRepository(t, newTestPostgres(t))
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// userTables lists every SQL table keyed by user_id. The users row goes last
+// so a failed purge can be retried with the user still resolvable.
+var userTables = []string{
+	"agent_sessions",
+	"agent_sessions_archive",
+	"challenge_assignments",
+	"challenge_attempts",
+	"challenge_checkpoints",
+	"challenge_completions",
+	"command_stats_daily",
+	"command_tools_daily",
+	"commands",
+	"container_events",
+	"intervention_outcomes",
+	"notifications",
+	"provision_queue",
+	"session_shares",
+	"snippets",
+	"stream_event_ids",
+	"users",
+}
+
+// purgeUserRows deletes a user's rows from every table in one transaction.
+// placeholder is the driver's bind parameter for the user ID.
+func purgeUserRows(ctx context.Context, db *sql.DB, placeholder, userID string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin purge: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, table := range userTables {
+		// #nosec G202 -- table names come from the fixed list above.
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = `+placeholder, userID); err != nil {
+			return fmt.Errorf("purge %s: %w", table, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit purge: %w", err)
+	}
+	return nil
+}
+
+// PurgeUser deletes every row stored for a user.
+func (s *SQLiteStore) PurgeUser(ctx context.Context, userID string) error {
+	s.agentSessionMu.Lock()
+	defer s.agentSessionMu.Unlock()
+	return purgeUserRows(ctx, s.db, "?", userID)
+}
+
+// PurgeUser deletes every row stored for a user.
+func (s *PostgresStore) PurgeUser(ctx context.Context, userID string) error {
+	return purgeUserRows(ctx, s.db, "$1", userID)
+}
+
+// PurgeUser deletes every key stored for a user. Tab event ID marks are keyed
+// by session and hold only counters; they are left to expire through their
+// TTL.
+func (s *RedisStore) PurgeUser(ctx context.Context, userID string) error {
+	sessionKeys, err := s.agentSessionKeys(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("purge user: %w", err)
+	}
+	shareKeys, err := s.sessionShareKeys(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("purge user: %w", err)
+	}
+	all, unread, data, read := s.notificationKeys(userID)
+	if _, err := s.client.Tx(ctx,
+		append([]any{"DEL"}, sessionKeys...),
+		append([]any{"DEL"}, shareKeys...),
+		[]any{"DEL", s.key("commands", userID)},
+		[]any{"DEL", s.key("checkpoints", userID)},
+		[]any{"DEL", s.key("snippets", userID)},
+		[]any{"DEL", s.key("container_events", userID)},
+		[]any{"DEL", s.key("challenge_assignments", userID), s.key("challenge_attempts", userID), s.key("challenge_completions", userID)},
+		[]any{"DEL", all, unread, data, read},
+		[]any{"ZREM", s.key("provision_queue"), userID},
+		[]any{"ZREM", s.key("users", "keep_warm"), userID},
+		[]any{"SREM", s.key("users", "containers"), userID},
+		[]any{"DEL", s.key("user", userID)},
+	); err != nil {
+		return fmt.Errorf("purge user: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,994 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/redis"
+)
+
+// redisKeyPrefix namespaces the server's keys; the Python agent uses agent:*.
+const redisKeyPrefix = "shsh:"
+
+// defaultRedisSessionTTL matches how long the TTL worker keeps idle agent
+// sessions in the SQL stores.
+const defaultRedisSessionTTL = 7 * 24 * time.Hour
+
+// RedisOptions configures a Redis-backed repository.
+type RedisOptions struct {
+	// URL is host:port or redis://[:password@]host:port[/db].
+	URL string
+	// Password and DB, when set, override those in URL.
+	Password string
+	DB       int
+	// SessionTTL is how long agent sessions and SSE event ID marks live after
+	// their last write; Redis expires them itself (default: 7 days).
+	SessionTTL time.Duration
+	// MaxIdleConns is how many connections are kept open between commands.
+	MaxIdleConns int
+}
+
+// RedisStore implements Repository using Redis, so deployments that already
+// run Redis for the Python agent can keep the server's state there too and
+// share it between instances. Agent sessions and SSE event ID marks carry a
+// TTL instead of being swept by CleanupExpiredSessions. Timestamps are stored
+// as Unix seconds, matching SQLiteStore.
+//
+// Keys (all under redisKeyPrefix):
+//
+//	user:<id>                  hash of user fields
+//	users:containers           set of users with a container assigned
+//	agent_session:<user>:<tab> hash of agent session fields, with TTL
+//	agent_sessions:<user>      set of a user's agent session tab IDs, with TTL
+//	event_ids:<user>:<session> SSE event ID high-water mark, with TTL
+//	notifications:<user>       sorted set of notification IDs
+//	notifications:<user>:*     unread IDs, notification bodies and read times
+//	provision_queue            sorted set of queued users by enqueue time
+//	commands:<user>            list of executed commands, newest first
+//	share:<token>              JSON session share link, expiring with the link
+//	shares:<user>              set of a user's share link tokens
+type RedisStore struct {
+	client     *redis.Client
+	sessionTTL time.Duration
+}
+
+// NewRedis creates a new Redis-backed repository and verifies the server is
+// reachable.
+func NewRedis(opts RedisOptions) (Repository, error) {
+	addr, password, db, err := redis.ParseAddr(opts.URL)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Password != "" {
+		password = opts.Password
+	}
+	if opts.DB != 0 {
+		db = opts.DB
+	}
+	if opts.SessionTTL <= 0 {
+		opts.SessionTTL = defaultRedisSessionTTL
+	}
+
+	store := &RedisStore{
+		client:     redis.NewClient(addr, password, db, opts.MaxIdleConns),
+		sessionTTL: opts.SessionTTL,
+	}
+	if err := store.Ping(context.Background()); err != nil {
+		store.client.Close()
+		return nil, fmt.Errorf("ping redis: %w", err)
+	}
+	return store, nil
+}
+
+func (s *RedisStore) key(parts ...string) string {
+	k := redisKeyPrefix
+	for i, p := range parts {
+		if i > 0 {
+			k += ":"
+		}
+		k += p
+	}
+	return k
+}
+
+// ttlSeconds returns the session TTL for EXPIRE, at least one second.
+func (s *RedisStore) ttlSeconds() int64 {
+	return max(int64(s.sessionTTL/time.Second), 1)
+}
+
+// Ping verifies Redis connectivity.
+func (s *RedisStore) Ping(ctx context.Context) error {
+	_, err := s.client.Do(ctx, "PING")
+	return err
+}
+
+// Close closes idle Redis connections.
+func (s *RedisStore) Close() error {
+	s.client.Close()
+	return nil
+}
+
+// GetUser retrieves a user by their user ID.
+func (s *RedisStore) GetUser(ctx context.Context, userID string) (*domain.User, error) {
+	reply, err := s.client.Do(ctx, "HGETALL", s.key("user", userID))
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+	fields, err := redisHash(reply)
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return redisUser(userID, fields), nil
+}
+
+// redisUpsertUserScript creates a user, or refreshes the username and last
+// seen time of an existing one, keeping its container and creation time.
+const redisUpsertUserScript = `
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	redis.call('HSET', KEYS[1], 'username', ARGV[2], 'last_seen_at', ARGV[4], 'updated_at', ARGV[7])
+	return 0
+end
+redis.call('HSET', KEYS[1], 'username', ARGV[2], 'container_id', ARGV[3], 'instance_id', '',
+	'last_seen_at', ARGV[4], 'volume_path', ARGV[5], 'created_at', ARGV[6], 'updated_at', ARGV[7])
+if ARGV[3] ~= '' then
+	redis.call('SADD', KEYS[2], ARGV[1])
+end
+return 1`
+
+// UpsertUser creates or updates a user record.
+func (s *RedisStore) UpsertUser(ctx context.Context, user *domain.User) error {
+	_, err := s.client.Do(ctx, "EVAL", redisUpsertUserScript, 2,
+		s.key("user", user.UserID), s.key("users", "containers"),
+		user.UserID, user.Username, user.ContainerID,
+		user.LastSeenAt.Unix(), user.VolumePath,
+		user.CreatedAt.Unix(), user.UpdatedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("upsert user: %w", err)
+	}
+	return nil
+}
+
+// redisUpdateHashScript sets fields on a hash only if it exists, returning 0
+// when it does not.
+const redisUpdateHashScript = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], unpack(ARGV))
+return 1`
+
+// UpdateLastSeen updates the last_seen_at timestamp for a user.
+func (s *RedisStore) UpdateLastSeen(ctx context.Context, userID string, lastSeen time.Time) error {
+	_, err := s.client.Do(ctx, "EVAL", redisUpdateHashScript, 1, s.key("user", userID),
+		"last_seen_at", lastSeen.Unix(), "updated_at", time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("update last_seen: %w", err)
+	}
+	return nil
+}
+
+// redisUpdateContainerScript sets a user's container if the current one
+// matches the expected ID, keeping the set of users with containers in step.
+// It returns 1 on success, 0 if the user does not exist and -1 on mismatch.
+const redisUpdateContainerScript = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	if ARGV[3] ~= '' then return -1 end
+	return 0
+end
+if ARGV[3] ~= '' and redis.call('HGET', KEYS[1], 'container_id') ~= ARGV[3] then
+	return -1
+end
+redis.call('HSET', KEYS[1], 'container_id', ARGV[2], 'updated_at', ARGV[4])
+if ARGV[2] == '' then
+	redis.call('SREM', KEYS[2], ARGV[1])
+else
+	redis.call('SADD', KEYS[2], ARGV[1])
+end
+return 1`
+
+// UpdateContainerID updates the container_id for a user.
+func (s *RedisStore) UpdateContainerID(ctx context.Context, userID string, containerID string, expectedID string) error {
+	reply, err := s.client.Do(ctx, "EVAL", redisUpdateContainerScript, 2,
+		s.key("user", userID), s.key("users", "containers"),
+		userID, containerID, expectedID, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("update container_id: %w", err)
+	}
+	switch reply {
+	case int64(0):
+		return errUserNotFound
+	case int64(-1):
+		return errOptimisticLockContainerID
+	}
+	return nil
+}
+
+// UpdateInstanceID records which server instance holds the user's terminal session.
+func (s *RedisStore) UpdateInstanceID(ctx context.Context, userID string, instanceID string) error {
+	reply, err := s.client.Do(ctx, "EVAL", redisUpdateHashScript, 1, s.key("user", userID),
+		"instance_id", instanceID, "updated_at", time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("update instance_id: %w", err)
+	}
+	if reply == int64(0) {
+		return errUserNotFound
+	}
+	return nil
+}
+
+// GetExpiredSessions retrieves users whose containers have exceeded the inactivity TTL.
+func (s *RedisStore) GetExpiredSessions(ctx context.Context, ttl time.Duration) ([]*domain.User, error) {
+	users, err := s.containerUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("query expired sessions: %w", err)
+	}
+	threshold := time.Now().Add(-ttl).Unix()
+	var expired []*domain.User
+	for _, user := range users {
+		if user.LastSeenAt.Unix() < threshold {
+			expired = append(expired, user)
+		}
+	}
+	return expired, nil
+}
+
+// GetActiveContainers retrieves users that currently have a container assigned.
+func (s *RedisStore) GetActiveContainers(ctx context.Context) ([]*domain.User, error) {
+	users, err := s.containerUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("query active containers: %w", err)
+	}
+	return users, nil
+}
+
+// redisSetKeepWarmScript sets a user's keep_warm_until and mirrors it in
+// the users:keep_warm sorted set. KEYS: user hash, keep-warm set. ARGV:
+// user ID, until (0 clears), updated_at. Returns 0 if the user is missing.
+const redisSetKeepWarmScript = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'keep_warm_until', ARGV[2], 'updated_at', ARGV[3])
+if ARGV[2] == '0' then
+	redis.call('ZREM', KEYS[2], ARGV[1])
+else
+	redis.call('ZADD', KEYS[2], ARGV[2], ARGV[1])
+end
+return 1`
+
+// SetKeepWarm exempts a user from TTL cleanup and rate limits until the given time.
+func (s *RedisStore) SetKeepWarm(ctx context.Context, userID string, until time.Time) error {
+	var value int64
+	if !until.IsZero() {
+		value = until.Unix()
+	}
+	reply, err := s.client.Do(ctx, "EVAL", redisSetKeepWarmScript, 2,
+		s.key("user", userID), s.key("users", "keep_warm"),
+		userID, value, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("update keep_warm_until: %w", err)
+	}
+	if reply == int64(0) {
+		return errUserNotFound
+	}
+	return nil
+}
+
+// redisSetUserFieldScript sets or clears an optional field of a user.
+// KEYS: user hash. ARGV: field, value (empty clears), updated_at. Returns 0
+// if the user is missing.
+const redisSetUserFieldScript = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+if ARGV[2] == '' then
+	redis.call('HDEL', KEYS[1], ARGV[1])
+else
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+end
+redis.call('HSET', KEYS[1], 'updated_at', ARGV[3])
+return 1`
+
+// SetResourceTier assigns a user's containers a resource tier; an empty tier
+// clears the assignment.
+func (s *RedisStore) SetResourceTier(ctx context.Context, userID, tier string) error {
+	return s.setUserField(ctx, userID, "resource_tier", tier)
+}
+
+// SetClassroom assigns a user to a classroom; an empty classroom removes them
+// from theirs.
+func (s *RedisStore) SetClassroom(ctx context.Context, userID, classroom string) error {
+	return s.setUserField(ctx, userID, "classroom", classroom)
+}
+
+func (s *RedisStore) setUserField(ctx context.Context, userID, field, value string) error {
+	reply, err := s.client.Do(ctx, "EVAL", redisSetUserFieldScript, 1,
+		s.key("user", userID), field, value, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("update %s: %w", field, err)
+	}
+	if reply == int64(0) {
+		return errUserNotFound
+	}
+	return nil
+}
+
+// ListKeptWarmUsers returns users whose keep-warm exemption is in effect at now.
+func (s *RedisStore) ListKeptWarmUsers(ctx context.Context, now time.Time) ([]*domain.User, error) {
+	setKey := s.key("users", "keep_warm")
+	replies, err := s.client.Pipeline(ctx,
+		[]any{"ZREMRANGEBYSCORE", setKey, "-inf", now.Unix()},
+		[]any{"ZRANGEBYSCORE", setKey, "(" + strconv.FormatInt(now.Unix(), 10), "+inf"},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query kept warm users: %w", err)
+	}
+	if rerr, ok := replies[1].(redis.Error); ok {
+		return nil, fmt.Errorf("query kept warm users: %w", rerr)
+	}
+	userIDs, err := redisStrings(replies[1])
+	if err != nil || len(userIDs) == 0 {
+		return nil, err
+	}
+
+	cmds := make([][]any, len(userIDs))
+	for i, userID := range userIDs {
+		cmds[i] = []any{"HGETALL", s.key("user", userID)}
+	}
+	if replies, err = s.client.Pipeline(ctx, cmds...); err != nil {
+		return nil, fmt.Errorf("query kept warm users: %w", err)
+	}
+
+	var users []*domain.User
+	for i, reply := range replies {
+		fields, err := redisHash(reply)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) == 0 {
+			continue // deleted since the set was read
+		}
+		users = append(users, redisUser(userIDs[i], fields))
+	}
+	return users, nil
+}
+
+// containerUsers loads every user in the users:containers set.
+func (s *RedisStore) containerUsers(ctx context.Context) ([]*domain.User, error) {
+	reply, err := s.client.Do(ctx, "SMEMBERS", s.key("users", "containers"))
+	if err != nil {
+		return nil, err
+	}
+	userIDs, err := redisStrings(reply)
+	if err != nil || len(userIDs) == 0 {
+		return nil, err
+	}
+
+	cmds := make([][]any, len(userIDs))
+	for i, userID := range userIDs {
+		cmds[i] = []any{"HGETALL", s.key("user", userID)}
+	}
+	replies, err := s.client.Pipeline(ctx, cmds...)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []*domain.User
+	for i, reply := range replies {
+		fields, err := redisHash(reply)
+		if err != nil {
+			return nil, err
+		}
+		// The user may have been deleted, or released the container, since
+		// the set was read.
+		if fields["container_id"] == "" {
+			continue
+		}
+		users = append(users, redisUser(userIDs[i], fields))
+	}
+	return users, nil
+}
+
+// agentSessionKey returns the hash holding a tab session's agent state.
+// Sessions stored before state was kept per tab live under the user's key.
+func (s *RedisStore) agentSessionKey(userID, sessionID string) string {
+	if sessionID == "" {
+		return s.key("agent_session", userID)
+	}
+	return s.key("agent_session", userID, sessionID)
+}
+
+// agentSessionIndexKey returns the set of a user's agent session IDs.
+func (s *RedisStore) agentSessionIndexKey(userID string) string {
+	return s.key("agent_sessions", userID)
+}
+
+// GetAgentSession retrieves the agent session state of a user's tab session.
+func (s *RedisStore) GetAgentSession(ctx context.Context, userID, sessionID string) (*domain.AgentSession, error) {
+	reply, err := s.client.Do(ctx, "HGETALL", s.agentSessionKey(userID, sessionID))
+	if err != nil {
+		return nil, fmt.Errorf("get agent session: %w", err)
+	}
+	fields, err := redisHash(reply)
+	if err != nil {
+		return nil, fmt.Errorf("get agent session: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return redisAgentSession(userID, sessionID, fields), nil
+}
+
+// ListAgentSessions returns every agent session of a user, most recently
+// updated first. Sessions whose hash expired are dropped from the index.
+func (s *RedisStore) ListAgentSessions(ctx context.Context, userID string) ([]*domain.AgentSession, error) {
+	sessionIDs, err := s.agentSessionIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	cmds := make([][]any, len(sessionIDs))
+	for i, sessionID := range sessionIDs {
+		cmds[i] = []any{"HGETALL", s.agentSessionKey(userID, sessionID)}
+	}
+	replies, err := s.client.Pipeline(ctx, cmds...)
+	if err != nil {
+		return nil, fmt.Errorf("list agent sessions: %w", err)
+	}
+
+	var sessions []*domain.AgentSession
+	var expired []any
+	for i, reply := range replies {
+		fields, err := redisHash(reply)
+		if err != nil {
+			return nil, fmt.Errorf("list agent sessions: %w", err)
+		}
+		if len(fields) == 0 {
+			if sessionIDs[i] != "" {
+				expired = append(expired, sessionIDs[i])
+			}
+			continue
+		}
+		sessions = append(sessions, redisAgentSession(userID, sessionIDs[i], fields))
+	}
+	if len(expired) > 0 {
+		if _, err := s.client.Do(ctx, append([]any{"SREM", s.agentSessionIndexKey(userID)}, expired...)...); err != nil {
+			slog.Debug("Failed to prune agent session index", "user_id", userID, "error", err)
+		}
+	}
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt) })
+	return sessions, nil
+}
+
+// agentSessionIDs returns the indexed session IDs of a user, plus "" for a
+// session stored before state was kept per tab.
+func (s *RedisStore) agentSessionIDs(ctx context.Context, userID string) ([]string, error) {
+	reply, err := s.client.Do(ctx, "SMEMBERS", s.agentSessionIndexKey(userID))
+	if err != nil {
+		return nil, fmt.Errorf("list agent sessions: %w", err)
+	}
+	sessionIDs, err := redisStrings(reply)
+	if err != nil {
+		return nil, fmt.Errorf("list agent sessions: %w", err)
+	}
+	return append(sessionIDs, ""), nil
+}
+
+// redisAgentSession builds an agent session from its hash fields.
+func redisAgentSession(userID, sessionID string, fields map[string]string) *domain.AgentSession {
+	session := &domain.AgentSession{
+		UserID:            userID,
+		SessionID:         sessionID,
+		AttemptCount:      int(redisInt(fields["attempt_count"])),
+		JustSelfCorrected: fields["just_self_corrected"] == "1",
+		IsTyping:          fields["is_typing"] == "1",
+		MessagesJSON:      fields["messages_json"],
+		CreatedAt:         time.Unix(redisInt(fields["created_at"]), 0),
+		UpdatedAt:         time.Unix(redisInt(fields["updated_at"]), 0),
+		Version:           redisInt(fields["version"]),
+	}
+	if v, ok := fields["last_proactive_msg"]; ok {
+		ts := time.Unix(redisInt(v), 0)
+		session.LastProactiveMsg = &ts
+	}
+	if v, ok := fields["challenge_json"]; ok {
+		session.ChallengeJSON = &v
+	}
+	return session
+}
+
+// redisUpsertAgentSessionScript writes an agent session if its version,
+// missing for sessions stored before versions were tracked, matches the
+// expected one, and restarts the TTLs of the session and, for tab sessions,
+// the user's session index. It returns 1 on success and 0 on a conflict.
+const redisUpsertAgentSessionScript = `
+local expected = tonumber(ARGV[1])
+local exists = redis.call('EXISTS', KEYS[1]) == 1
+if expected > 0 and not exists then
+	return 0
+end
+if tonumber(redis.call('HGET', KEYS[1], 'version') or '0') ~= expected then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'version', expected + 1, unpack(ARGV, 5))
+redis.call('HSETNX', KEYS[1], 'created_at', ARGV[4])
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+if ARGV[2] ~= '' then
+	redis.call('SADD', KEYS[2], ARGV[2])
+	redis.call('EXPIRE', KEYS[2], ARGV[3])
+end
+return 1`
+
+// UpsertAgentSession creates or updates agent session state, failing with
+// ErrVersionConflict if it changed since session was read, and restarts its
+// TTL and that of the user's session index.
+func (s *RedisStore) UpsertAgentSession(ctx context.Context, session *domain.AgentSession) error {
+	args := []any{"EVAL", redisUpsertAgentSessionScript, 2,
+		s.agentSessionKey(session.UserID, session.SessionID), s.agentSessionIndexKey(session.UserID),
+		session.Version, session.SessionID, s.ttlSeconds(), session.CreatedAt.Unix(),
+		"attempt_count", session.AttemptCount,
+		"just_self_corrected", redisBool(session.JustSelfCorrected),
+		"is_typing", redisBool(session.IsTyping),
+		"messages_json", session.MessagesJSON,
+		"updated_at", time.Now().Unix(),
+	}
+	// Unset optional fields keep their stored values, as in the SQL stores.
+	if session.LastProactiveMsg != nil {
+		args = append(args, "last_proactive_msg", session.LastProactiveMsg.Unix())
+	}
+	if session.ChallengeJSON != nil {
+		args = append(args, "challenge_json", *session.ChallengeJSON)
+	}
+
+	reply, err := s.client.Do(ctx, args...)
+	if err != nil {
+		return fmt.Errorf("upsert agent session: %w", err)
+	}
+	if n, _ := reply.(int64); n == 0 {
+		return fmt.Errorf("upsert agent session at version %d: %w", session.Version, ErrVersionConflict)
+	}
+	session.Version++
+	return nil
+}
+
+// DeleteAgentSession removes the agent session state of one tab session.
+func (s *RedisStore) DeleteAgentSession(ctx context.Context, userID, sessionID string) error {
+	if _, err := s.client.Tx(ctx,
+		[]any{"DEL", s.agentSessionKey(userID, sessionID)},
+		[]any{"SREM", s.agentSessionIndexKey(userID), sessionID},
+	); err != nil {
+		return fmt.Errorf("delete agent session: %w", err)
+	}
+	return nil
+}
+
+// DeleteAgentSessions removes every agent session of a user.
+func (s *RedisStore) DeleteAgentSessions(ctx context.Context, userID string) error {
+	keys, err := s.agentSessionKeys(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.client.Do(ctx, append([]any{"DEL"}, keys...)...); err != nil {
+		return fmt.Errorf("delete agent sessions: %w", err)
+	}
+	return nil
+}
+
+// agentSessionKeys returns every key holding a user's agent sessions,
+// including the index.
+func (s *RedisStore) agentSessionKeys(ctx context.Context, userID string) ([]any, error) {
+	sessionIDs, err := s.agentSessionIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	keys := []any{s.agentSessionIndexKey(userID)}
+	for _, sessionID := range sessionIDs {
+		keys = append(keys, s.agentSessionKey(userID, sessionID))
+	}
+	return keys, nil
+}
+
+// CleanupExpiredSessions is a no-op: agent sessions and event ID marks
+// expire through their Redis TTL, so nothing is archived.
+func (s *RedisStore) CleanupExpiredSessions(context.Context, time.Duration) (int64, error) {
+	return 0, nil
+}
+
+// ReserveEventIDs advances a tab session's SSE event ID high-water mark and
+// restarts its TTL.
+func (s *RedisStore) ReserveEventIDs(ctx context.Context, userID, sessionID string, n int64) (int64, error) {
+	key := s.key("event_ids", userID, sessionID)
+	replies, err := s.client.Tx(ctx,
+		[]any{"INCRBY", key, n},
+		[]any{"EXPIRE", key, s.ttlSeconds()},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("reserve event ids: %w", err)
+	}
+	mark, ok := replies[0].(int64)
+	if !ok {
+		return 0, fmt.Errorf("reserve event ids: %w", redis.ErrProtocol)
+	}
+	return mark, nil
+}
+
+// redisNotification is the stored form of a notification; its ID is the
+// hash field and its read time is kept separately.
+type redisNotification struct {
+	Kind      string `json:"kind"`
+	Title     string `json:"title,omitempty"`
+	Body      string `json:"body"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// notificationKeys returns the keys holding a user's notification IDs,
+// unread IDs, bodies and read times.
+func (s *RedisStore) notificationKeys(userID string) (all, unread, data, read string) {
+	all = s.key("notifications", userID)
+	return all, all + ":unread", all + ":data", all + ":read"
+}
+
+// redisCreateNotificationScript allocates an ID, stores the notification as
+// unread and deletes the user's oldest ones beyond the limit.
+const redisCreateNotificationScript = `
+local id = redis.call('INCR', KEYS[1])
+redis.call('HSET', KEYS[4], id, ARGV[1])
+redis.call('ZADD', KEYS[2], id, id)
+redis.call('ZADD', KEYS[3], id, id)
+local old = redis.call('ZRANGE', KEYS[2], 0, -(tonumber(ARGV[2]) + 1))
+for _, o in ipairs(old) do
+	redis.call('ZREM', KEYS[2], o)
+	redis.call('ZREM', KEYS[3], o)
+	redis.call('HDEL', KEYS[4], o)
+	redis.call('HDEL', KEYS[5], o)
+end
+return id`
+
+// CreateNotification stores a notification and trims the user's oldest ones.
+func (s *RedisStore) CreateNotification(ctx context.Context, n *domain.Notification) error {
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = time.Now()
+	}
+	data, err := json.Marshal(redisNotification{
+		Kind:      string(n.Kind),
+		Title:     n.Title,
+		Body:      n.Body,
+		CreatedAt: n.CreatedAt.Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("encode notification: %w", err)
+	}
+
+	all, unread, dataKey, read := s.notificationKeys(n.UserID)
+	reply, err := s.client.Do(ctx, "EVAL", redisCreateNotificationScript, 5,
+		s.key("notifications", "seq"), all, unread, dataKey, read,
+		data, maxNotificationsPerUser)
+	if err != nil {
+		return fmt.Errorf("insert notification: %w", err)
+	}
+	id, ok := reply.(int64)
+	if !ok {
+		return fmt.Errorf("insert notification: %w", redis.ErrProtocol)
+	}
+	n.ID = id
+	return nil
+}
+
+// ListNotifications returns a user's notifications, newest first.
+func (s *RedisStore) ListNotifications(ctx context.Context, userID string, unreadOnly bool, limit int) ([]*domain.Notification, error) {
+	all, unread, dataKey, read := s.notificationKeys(userID)
+	index := all
+	if unreadOnly {
+		index = unread
+	}
+	stop := -1
+	if limit > 0 {
+		stop = limit - 1
+	}
+	reply, err := s.client.Do(ctx, "ZREVRANGE", index, 0, stop)
+	if err != nil {
+		return nil, fmt.Errorf("query notifications: %w", err)
+	}
+	ids, err := redisStrings(reply)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	dataCmd := []any{"HMGET", dataKey}
+	readCmd := []any{"HMGET", read}
+	for _, id := range ids {
+		dataCmd = append(dataCmd, id)
+		readCmd = append(readCmd, id)
+	}
+	replies, err := s.client.Pipeline(ctx, dataCmd, readCmd)
+	if err != nil {
+		return nil, fmt.Errorf("query notifications: %w", err)
+	}
+	bodies, bodiesOK := replies[0].([]any)
+	readAts, readOK := replies[1].([]any)
+	if !bodiesOK || !readOK {
+		return nil, fmt.Errorf("query notifications: %w", redis.ErrProtocol)
+	}
+
+	var notifications []*domain.Notification
+	for i, id := range ids {
+		body, ok := bodies[i].(string)
+		if !ok {
+			continue // trimmed since the index was read
+		}
+		var stored redisNotification
+		if err := json.Unmarshal([]byte(body), &stored); err != nil {
+			return nil, fmt.Errorf("decode notification: %w", err)
+		}
+		n := &domain.Notification{
+			ID:        redisInt(id),
+			UserID:    userID,
+			Kind:      domain.NotificationKind(stored.Kind),
+			Title:     stored.Title,
+			Body:      stored.Body,
+			CreatedAt: time.Unix(stored.CreatedAt, 0),
+		}
+		if v, ok := readAts[i].(string); ok {
+			ts := time.Unix(redisInt(v), 0)
+			n.ReadAt = &ts
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, nil
+}
+
+// redisMarkReadScript marks the given unread notification IDs, or all unread
+// ones when none are given, as read and returns how many changed.
+const redisMarkReadScript = `
+local ids = {}
+if #ARGV > 1 then
+	for i = 2, #ARGV do ids[#ids + 1] = ARGV[i] end
+else
+	ids = redis.call('ZRANGE', KEYS[1], 0, -1)
+end
+local n = 0
+for _, id in ipairs(ids) do
+	if redis.call('ZREM', KEYS[1], id) == 1 then
+		redis.call('HSET', KEYS[2], id, ARGV[1])
+		n = n + 1
+	end
+end
+return n`
+
+// MarkNotificationsRead marks notifications read; empty ids marks all of them.
+func (s *RedisStore) MarkNotificationsRead(ctx context.Context, userID string, ids []int64, readAt time.Time) (int64, error) {
+	_, unread, _, read := s.notificationKeys(userID)
+	args := []any{"EVAL", redisMarkReadScript, 2, unread, read, readAt.Unix()}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	reply, err := s.client.Do(ctx, args...)
+	if err != nil {
+		return 0, fmt.Errorf("mark notifications read: %w", err)
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("mark notifications read: %w", redis.ErrProtocol)
+	}
+	return n, nil
+}
+
+// CountUnreadNotifications returns the number of unread notifications for a user.
+func (s *RedisStore) CountUnreadNotifications(ctx context.Context, userID string) (int, error) {
+	_, unread, _, _ := s.notificationKeys(userID)
+	reply, err := s.client.Do(ctx, "ZCARD", unread)
+	if err != nil {
+		return 0, fmt.Errorf("count unread notifications: %w", err)
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("count unread notifications: %w", redis.ErrProtocol)
+	}
+	return int(n), nil
+}
+
+// EnqueueProvision adds a user to the provisioning wait queue.
+func (s *RedisStore) EnqueueProvision(ctx context.Context, userID string, enqueuedAt time.Time) error {
+	// Microseconds keep the score exact in a float64.
+	if _, err := s.client.Do(ctx, "ZADD", s.key("provision_queue"), "NX", enqueuedAt.UnixMicro(), userID); err != nil {
+		return fmt.Errorf("enqueue provision: %w", err)
+	}
+	return nil
+}
+
+// DequeueProvision removes a user from the provisioning wait queue.
+func (s *RedisStore) DequeueProvision(ctx context.Context, userID string) error {
+	if _, err := s.client.Do(ctx, "ZREM", s.key("provision_queue"), userID); err != nil {
+		return fmt.Errorf("dequeue provision: %w", err)
+	}
+	return nil
+}
+
+// ListProvisionQueue returns queued user IDs, oldest first.
+func (s *RedisStore) ListProvisionQueue(ctx context.Context) ([]string, error) {
+	reply, err := s.client.Do(ctx, "ZRANGE", s.key("provision_queue"), 0, -1)
+	if err != nil {
+		return nil, fmt.Errorf("query provision queue: %w", err)
+	}
+	userIDs, err := redisStrings(reply)
+	if err != nil {
+		return nil, fmt.Errorf("query provision queue: %w", err)
+	}
+	return userIDs, nil
+}
+
+// redisCommand is the stored form of an executed command. Times are Unix
+// milliseconds, matching the SQL stores.
+type redisCommand struct {
+	ID         int64  `json:"id"`
+	SessionID  string `json:"session_id"`
+	Sequence   int    `json:"sequence"`
+	Command    string `json:"command"`
+	PWD        string `json:"pwd"`
+	ExitCode   int    `json:"exit_code"`
+	DurationMs int64  `json:"duration_ms"`
+	StartedAt  int64  `json:"started_at"`
+	EndedAt    int64  `json:"ended_at"`
+}
+
+// InsertCommand stores an executed command and trims the user's oldest ones.
+func (s *RedisStore) InsertCommand(ctx context.Context, c *domain.CommandRecord) error {
+	reply, err := s.client.Do(ctx, "INCR", s.key("commands", "seq"))
+	if err != nil {
+		return fmt.Errorf("insert command: %w", err)
+	}
+	id, ok := reply.(int64)
+	if !ok {
+		return fmt.Errorf("insert command: %w", redis.ErrProtocol)
+	}
+
+	data, err := json.Marshal(redisCommand{
+		ID:         id,
+		SessionID:  c.SessionID,
+		Sequence:   c.Sequence,
+		Command:    c.Command,
+		PWD:        c.PWD,
+		ExitCode:   c.ExitCode,
+		DurationMs: c.Duration.Milliseconds(),
+		StartedAt:  c.StartedAt.UnixMilli(),
+		EndedAt:    c.EndedAt.UnixMilli(),
+	})
+	if err != nil {
+		return fmt.Errorf("encode command: %w", err)
+	}
+
+	key := s.key("commands", c.UserID)
+	if _, err := s.client.Tx(ctx,
+		[]any{"LPUSH", key, data},
+		[]any{"LTRIM", key, 0, maxCommandsPerUser - 1},
+	); err != nil {
+		return fmt.Errorf("insert command: %w", err)
+	}
+	c.ID = id
+	return nil
+}
+
+// ListCommands returns a user's executed commands, newest first.
+func (s *RedisStore) ListCommands(ctx context.Context, userID, sessionID string, limit int) ([]*domain.CommandRecord, error) {
+	reply, err := s.client.Do(ctx, "LRANGE", s.key("commands", userID), 0, -1)
+	if err != nil {
+		return nil, fmt.Errorf("query commands: %w", err)
+	}
+	items, err := redisStrings(reply)
+	if err != nil {
+		return nil, fmt.Errorf("query commands: %w", err)
+	}
+
+	var commands []*domain.CommandRecord
+	for _, item := range items {
+		if limit > 0 && len(commands) == limit {
+			break
+		}
+		var stored redisCommand
+		if err := json.Unmarshal([]byte(item), &stored); err != nil {
+			return nil, fmt.Errorf("decode command: %w", err)
+		}
+		if sessionID != "" && stored.SessionID != sessionID {
+			continue
+		}
+		commands = append(commands, &domain.CommandRecord{
+			ID:        stored.ID,
+			UserID:    userID,
+			SessionID: stored.SessionID,
+			Sequence:  stored.Sequence,
+			Command:   stored.Command,
+			PWD:       stored.PWD,
+			ExitCode:  stored.ExitCode,
+			Duration:  time.Duration(stored.DurationMs) * time.Millisecond,
+			StartedAt: time.UnixMilli(stored.StartedAt),
+			EndedAt:   time.UnixMilli(stored.EndedAt),
+		})
+	}
+	return commands, nil
+}
+
+// DeleteLegacyLocalState removes pre-migration single-user local records.
+func (s *RedisStore) DeleteLegacyLocalState(ctx context.Context) (int64, int64, error) {
+	replies, err := s.client.Tx(ctx,
+		[]any{"DEL", s.key("user", "local")},
+		[]any{"SREM", s.key("users", "containers"), "local"},
+		[]any{"DEL", s.key("agent_session", "local")},
+	)
+	if err != nil {
+		return 0, 0, fmt.Errorf("delete legacy local state: %w", err)
+	}
+	users, _ := replies[0].(int64)
+	sessions, _ := replies[2].(int64)
+	return users, sessions, nil
+}
+
+// redisUser builds a user from its hash fields.
+func redisUser(userID string, fields map[string]string) *domain.User {
+	user := &domain.User{
+		UserID:       userID,
+		Username:     fields["username"],
+		ContainerID:  fields["container_id"],
+		InstanceID:   fields["instance_id"],
+		LastSeenAt:   time.Unix(redisInt(fields["last_seen_at"]), 0),
+		VolumePath:   fields["volume_path"],
+		CreatedAt:    time.Unix(redisInt(fields["created_at"]), 0),
+		UpdatedAt:    time.Unix(redisInt(fields["updated_at"]), 0),
+		ResourceTier: fields["resource_tier"],
+		Classroom:    fields["classroom"],
+	}
+	if until := redisInt(fields["keep_warm_until"]); until > 0 {
+		user.KeepWarmUntil = time.Unix(until, 0)
+	}
+	return user
+}
+
+// redisHash converts an HGETALL reply into a map.
+func redisHash(reply any) (map[string]string, error) {
+	items, err := redisStrings(reply)
+	if err != nil || len(items)%2 != 0 {
+		return nil, redis.ErrProtocol
+	}
+	fields := make(map[string]string, len(items)/2)
+	for i := 0; i < len(items); i += 2 {
+		fields[items[i]] = items[i+1]
+	}
+	return fields, nil
+}
+
+// redisStrings converts an array reply of strings.
+func redisStrings(reply any) ([]string, error) {
+	items, ok := reply.([]any)
+	if !ok {
+		return nil, redis.ErrProtocol
+	}
+	out := make([]string, len(items))
+	for i, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, redis.ErrProtocol
+		}
+		out[i] = s
+	}
+	return out, nil
+}
+
+// redisInt parses a stored integer, treating anything else as zero.
+func redisInt(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
+
+func redisBool(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
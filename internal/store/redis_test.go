@@ -0,0 +1,540 @@
+package store
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+)
+
+// fakeRedis serves the Redis commands RedisStore uses over RESP from memory.
+// Lua scripts cannot run here, so EVAL runs a Go stand-in registered for the
+// script's source; the scripts themselves only run against a real server
+// (see newTestRedis).
+type fakeRedis struct {
+	mu      sync.Mutex
+	strs    map[string]string
+	hashes  map[string]map[string]string
+	sets    map[string]map[string]bool
+	lists   map[string][]string
+	ttls    map[string]string
+	cmds    [][]string
+	scripts map[string]fakeScript
+}
+
+// fakeScript stands in for a Lua script; call is its redis.call.
+type fakeScript func(call func(args ...string) any, keys, argv []string) any
+
+// fakeStatus is a simple string reply such as +OK.
+type fakeStatus string
+
+// fakeError is an error reply.
+type fakeError string
+
+func startFakeRedis(t *testing.T) (*fakeRedis, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	srv := &fakeRedis{
+		strs:    make(map[string]string),
+		hashes:  make(map[string]map[string]string),
+		sets:    make(map[string]map[string]bool),
+		lists:   make(map[string][]string),
+		ttls:    make(map[string]string),
+		scripts: fakeRedisScripts(),
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+	return srv, ln.Addr().String()
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	var queued [][]string
+	inTx := false
+	for {
+		args, err := readFakeCommand(r)
+		if err != nil {
+			return
+		}
+		var reply any
+		switch strings.ToUpper(args[0]) {
+		case "MULTI":
+			inTx, queued = true, nil
+			reply = fakeStatus("OK")
+		case "EXEC":
+			results := make([]any, len(queued))
+			for i, cmd := range queued {
+				results[i] = s.exec(cmd)
+			}
+			inTx, queued = false, nil
+			reply = results
+		default:
+			if inTx {
+				queued = append(queued, args)
+				reply = fakeStatus("QUEUED")
+			} else {
+				reply = s.exec(args)
+			}
+		}
+		writeFakeReply(w, reply)
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// exec runs one command, recording it.
+func (s *fakeRedis) exec(args []string) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cmds = append(s.cmds, args)
+	return s.callLocked(args...)
+}
+
+//nolint:gocyclo // One case per command keeps the fake readable.
+func (s *fakeRedis) callLocked(args ...string) any {
+	key := func(i int) string {
+		if i < len(args) {
+			return args[i]
+		}
+		return ""
+	}
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return fakeStatus("PONG")
+	case "AUTH", "SELECT", "FLUSHDB":
+		return fakeStatus("OK")
+	case "DBSIZE":
+		return int64(len(s.strs) + len(s.hashes) + len(s.sets) + len(s.lists))
+	case "EXISTS":
+		if s.exists(key(1)) {
+			return int64(1)
+		}
+		return int64(0)
+	case "DEL":
+		var n int64
+		for _, k := range args[1:] {
+			if s.exists(k) {
+				n++
+			}
+			s.remove(k)
+		}
+		return n
+	case "EXPIRE":
+		if !s.exists(key(1)) {
+			return int64(0)
+		}
+		s.ttls[key(1)] = key(2)
+		return int64(1)
+	case "GET":
+		if v, ok := s.strs[key(1)]; ok {
+			return v
+		}
+		return nil
+	case "SET":
+		s.strs[key(1)] = key(2)
+		return fakeStatus("OK")
+	case "INCR", "INCRBY":
+		by := int64(1)
+		if len(args) > 2 {
+			by, _ = strconv.ParseInt(args[2], 10, 64)
+		}
+		n, _ := strconv.ParseInt(s.strs[key(1)], 10, 64)
+		n += by
+		s.strs[key(1)] = strconv.FormatInt(n, 10)
+		return n
+	case "HSET", "HSETNX":
+		h := s.hashes[key(1)]
+		if h == nil {
+			h = make(map[string]string)
+			s.hashes[key(1)] = h
+		}
+		var added int64
+		for i := 2; i+1 < len(args); i += 2 {
+			if _, ok := h[args[i]]; ok && strings.EqualFold(args[0], "HSETNX") {
+				continue
+			} else if !ok {
+				added++
+			}
+			h[args[i]] = args[i+1]
+		}
+		return added
+	case "HGET":
+		if v, ok := s.hashes[key(1)][key(2)]; ok {
+			return v
+		}
+		return nil
+	case "HGETALL":
+		h := s.hashes[key(1)]
+		fields := make([]any, 0, 2*len(h))
+		for _, f := range slices.Sorted(maps.Keys(h)) {
+			fields = append(fields, f, h[f])
+		}
+		return fields
+	case "HDEL":
+		var n int64
+		for _, f := range args[2:] {
+			if _, ok := s.hashes[key(1)][f]; ok {
+				delete(s.hashes[key(1)], f)
+				n++
+			}
+		}
+		return n
+	case "SADD":
+		set := s.sets[key(1)]
+		if set == nil {
+			set = make(map[string]bool)
+			s.sets[key(1)] = set
+		}
+		var n int64
+		for _, m := range args[2:] {
+			if !set[m] {
+				set[m] = true
+				n++
+			}
+		}
+		return n
+	case "SREM":
+		var n int64
+		for _, m := range args[2:] {
+			if s.sets[key(1)][m] {
+				delete(s.sets[key(1)], m)
+				n++
+			}
+		}
+		return n
+	case "SMEMBERS":
+		members := []any{}
+		for _, m := range slices.Sorted(maps.Keys(s.sets[key(1)])) {
+			members = append(members, m)
+		}
+		return members
+	case "LPUSH", "RPUSH":
+		for _, v := range args[2:] {
+			if strings.EqualFold(args[0], "LPUSH") {
+				s.lists[key(1)] = append([]string{v}, s.lists[key(1)]...)
+			} else {
+				s.lists[key(1)] = append(s.lists[key(1)], v)
+			}
+		}
+		return int64(len(s.lists[key(1)]))
+	case "LRANGE", "LTRIM":
+		list := s.lists[key(1)]
+		start, _ := strconv.Atoi(key(2))
+		stop, _ := strconv.Atoi(key(3))
+		if start < 0 {
+			start += len(list)
+		}
+		if stop < 0 {
+			stop += len(list)
+		}
+		start, stop = max(start, 0), min(stop+1, len(list))
+		if start > stop {
+			start = stop
+		}
+		if strings.EqualFold(args[0], "LTRIM") {
+			s.lists[key(1)] = list[start:stop]
+			return fakeStatus("OK")
+		}
+		items := []any{}
+		for _, v := range list[start:stop] {
+			items = append(items, v)
+		}
+		return items
+	case "EVAL":
+		script, ok := s.scripts[key(1)]
+		if !ok {
+			return fakeError("NOSCRIPT no stand-in for script")
+		}
+		n, _ := strconv.Atoi(key(2))
+		return script(s.callLocked, args[3:3+n], args[3+n:])
+	default:
+		return fakeError("ERR unknown command '" + args[0] + "'")
+	}
+}
+
+func (s *fakeRedis) exists(key string) bool {
+	_, str := s.strs[key]
+	return str || len(s.hashes[key]) > 0 || len(s.sets[key]) > 0 || len(s.lists[key]) > 0
+}
+
+func (s *fakeRedis) remove(key string) {
+	delete(s.strs, key)
+	delete(s.hashes, key)
+	delete(s.sets, key)
+	delete(s.lists, key)
+	delete(s.ttls, key)
+}
+
+// expire drops key as if its TTL had run out.
+func (s *fakeRedis) expire(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(key)
+}
+
+// ttl returns the TTL last set on key by EXPIRE.
+func (s *fakeRedis) ttl(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ttls[key]
+}
+
+// sent returns the commands the fake received, by name.
+func (s *fakeRedis) sent(name string) [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var cmds [][]string
+	for _, cmd := range s.cmds {
+		if strings.EqualFold(cmd[0], name) {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return cmds
+}
+
+// fakeRedisScripts returns Go stand-ins for the Lua scripts the tests run,
+// written to follow the Lua line by line.
+func fakeRedisScripts() map[string]fakeScript {
+	return map[string]fakeScript{
+		redisUpsertUserScript: func(call func(...string) any, keys, argv []string) any {
+			if call("EXISTS", keys[0]) == int64(1) {
+				call("HSET", keys[0], "username", argv[1], "last_seen_at", argv[3], "updated_at", argv[6])
+				return int64(0)
+			}
+			call("HSET", keys[0], "username", argv[1], "container_id", argv[2], "instance_id", "",
+				"last_seen_at", argv[3], "volume_path", argv[4], "created_at", argv[5], "updated_at", argv[6])
+			if argv[2] != "" {
+				call("SADD", keys[1], argv[0])
+			}
+			return int64(1)
+		},
+		redisUpdateContainerScript: func(call func(...string) any, keys, argv []string) any {
+			if call("EXISTS", keys[0]) == int64(0) {
+				if argv[2] != "" {
+					return int64(-1)
+				}
+				return int64(0)
+			}
+			if argv[2] != "" && call("HGET", keys[0], "container_id") != argv[2] {
+				return int64(-1)
+			}
+			call("HSET", keys[0], "container_id", argv[1], "updated_at", argv[3])
+			if argv[1] == "" {
+				call("SREM", keys[1], argv[0])
+			} else {
+				call("SADD", keys[1], argv[0])
+			}
+			return int64(1)
+		},
+		redisSetUserFieldScript: func(call func(...string) any, keys, argv []string) any {
+			if call("EXISTS", keys[0]) == int64(0) {
+				return int64(0)
+			}
+			if argv[1] == "" {
+				call("HDEL", keys[0], argv[0])
+			} else {
+				call("HSET", keys[0], argv[0], argv[1])
+			}
+			call("HSET", keys[0], "updated_at", argv[2])
+			return int64(1)
+		},
+		redisUpsertAgentSessionScript: func(call func(...string) any, keys, argv []string) any {
+			expected, _ := strconv.ParseInt(argv[0], 10, 64)
+			exists := call("EXISTS", keys[0]) == int64(1)
+			if expected > 0 && !exists {
+				return int64(0)
+			}
+			version, _ := call("HGET", keys[0], "version").(string)
+			if current, _ := strconv.ParseInt(version, 10, 64); current != expected {
+				return int64(0)
+			}
+			call(append([]string{"HSET", keys[0], "version", strconv.FormatInt(expected+1, 10)}, argv[4:]...)...)
+			call("HSETNX", keys[0], "created_at", argv[3])
+			call("EXPIRE", keys[0], argv[2])
+			if argv[1] != "" {
+				call("SADD", keys[1], argv[1])
+				call("EXPIRE", keys[1], argv[2])
+			}
+			return int64(1)
+		},
+	}
+}
+
+func readFakeCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("bad command header %q", line)
+	}
+	args := make([]string, 0, n)
+	for range n {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(header[1:]))
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func writeFakeReply(w *bufio.Writer, reply any) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case fakeStatus:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case fakeError:
+		fmt.Fprintf(w, "-%s\r\n", v)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []any:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, item := range v {
+			writeFakeReply(w, item)
+		}
+	}
+}
+
+// newTestRedis returns a RedisStore on a fake server, or on the real server
+// at SHSH_TEST_REDIS_URL when it is set. That database is flushed, so it
+// must be a scratch one.
+func newTestRedis(t *testing.T) (*RedisStore, *fakeRedis) {
+	t.Helper()
+	var srv *fakeRedis
+	url := os.Getenv("SHSH_TEST_REDIS_URL")
+	if url == "" {
+		srv, url = startFakeRedis(t)
+	}
+	repo, err := NewRedis(RedisOptions{URL: url, SessionTTL: time.Hour})
+	if err != nil {
+		t.Fatalf("NewRedis: %v", err)
+	}
+	store := repo.(*RedisStore)
+	t.Cleanup(func() { _ = store.Close() })
+	if srv == nil {
+		if _, err := store.client.Do(t.Context(), "FLUSHDB"); err != nil {
+			t.Fatalf("flush test database: %v", err)
+		}
+	}
+	return store, srv
+}
+
+func TestRedisRepository(t *testing.T) {
+	store, _ := newTestRedis(t)
+	testRepository(t, store)
+}
+
+func TestRedisAgentSessions(t *testing.T) {
+	store, srv := newTestRedis(t)
+	ctx := t.Context()
+
+	session := &domain.AgentSession{UserID: "alice", SessionID: "tab-1", MessagesJSON: "[]", CreatedAt: time.Unix(1_700_000_000, 0)}
+	if err := store.UpsertAgentSession(ctx, session); err != nil {
+		t.Fatalf("UpsertAgentSession: %v", err)
+	}
+	if session.Version != 1 {
+		t.Fatalf("version = %d after the first write, want 1", session.Version)
+	}
+	stale := *session
+	stale.Version = 0
+	if err := store.UpsertAgentSession(ctx, &stale); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("UpsertAgentSession at a stale version = %v, want ErrVersionConflict", err)
+	}
+
+	got, err := store.GetAgentSession(ctx, "alice", "tab-1")
+	if err != nil || got == nil || got.Version != 1 || got.MessagesJSON != "[]" {
+		t.Fatalf("GetAgentSession = %+v, %v", got, err)
+	}
+	if srv == nil {
+		return
+	}
+
+	// Sessions and the index expire through Redis rather than the TTL worker.
+	sessionKey, indexKey := store.agentSessionKey("alice", "tab-1"), store.agentSessionIndexKey("alice")
+	if ttl := srv.ttl(sessionKey); ttl != "3600" {
+		t.Fatalf("session TTL = %q, want 3600", ttl)
+	}
+	if ttl := srv.ttl(indexKey); ttl != "3600" {
+		t.Fatalf("index TTL = %q, want 3600", ttl)
+	}
+	srv.expire(sessionKey)
+	if sessions, err := store.ListAgentSessions(ctx, "alice"); err != nil || len(sessions) != 0 {
+		t.Fatalf("ListAgentSessions after expiry = %+v, %v", sessions, err)
+	}
+	if srem := srv.sent("SREM"); len(srem) != 1 || srem[0][1] != indexKey || srem[0][2] != "tab-1" {
+		t.Fatalf("expired session not pruned from the index: %q", srem)
+	}
+}
+
+func TestRedisReserveEventIDs(t *testing.T) {
+	store, srv := newTestRedis(t)
+	ctx := t.Context()
+
+	for _, step := range []struct{ n, want int64 }{{3, 3}, {2, 5}} {
+		mark, err := store.ReserveEventIDs(ctx, "alice", "tab-1", step.n)
+		if err != nil || mark != step.want {
+			t.Fatalf("ReserveEventIDs(%d) = %d, %v; want %d", step.n, mark, err, step.want)
+		}
+	}
+	if srv != nil {
+		if ttl := srv.ttl(store.key("event_ids", "alice", "tab-1")); ttl != "3600" {
+			t.Fatalf("event ID mark TTL = %q, want 3600", ttl)
+		}
+	}
+}
+
+func TestNewRedisConnectionSetup(t *testing.T) {
+	srv, addr := startFakeRedis(t)
+	repo, err := NewRedis(RedisOptions{URL: "redis://:from-url@" + addr + "/2", Password: "override"})
+	if err != nil {
+		t.Fatalf("NewRedis: %v", err)
+	}
+	defer repo.Close()
+
+	if auth := srv.sent("AUTH"); len(auth) != 1 || auth[0][1] != "override" {
+		t.Fatalf("AUTH = %q, want the Password option", auth)
+	}
+	if sel := srv.sent("SELECT"); len(sel) != 1 || sel[0][1] != "2" {
+		t.Fatalf("SELECT = %q, want the URL's database", sel)
+	}
+
+	if _, err := NewRedis(RedisOptions{URL: "http://" + addr}); err == nil {
+		t.Fatal("NewRedis accepted a non-redis URL")
+	}
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+)
+
+// archiveColumns are the agent session columns copied to and read from
+// agent_sessions_archive.
+const archiveColumns = `user_id, session_id, last_proactive_msg, attempt_count, just_self_corrected,
+	challenge_json, messages_json, created_at, updated_at`
+
+// listArchivedSessionsQuery selects a user's archived sessions, newest first;
+// the placeholder is filled in per driver.
+const listArchivedSessionsQuery = `
+	SELECT user_id, session_id, last_proactive_msg, attempt_count, just_self_corrected,
+	       challenge_json, COALESCE(messages_json, ''), created_at, updated_at, archived_at
+	FROM agent_sessions_archive WHERE user_id = %s ORDER BY id DESC`
+
+// scanArchivedSessions reads rows selected by listArchivedSessionsQuery.
+func scanArchivedSessions(rows *sql.Rows) ([]*domain.ArchivedAgentSession, error) {
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			slog.Warn("failed to close rows", "query", "list_archived_sessions", "error", closeErr)
+		}
+	}()
+
+	var sessions []*domain.ArchivedAgentSession
+	for rows.Next() {
+		var session domain.ArchivedAgentSession
+		var lastProactiveMsg sql.NullInt64
+		var challengeJSON sql.NullString
+		var createdAt, updatedAt, archivedAt int64
+		if err := rows.Scan(
+			&session.UserID, &session.SessionID, &lastProactiveMsg, &session.AttemptCount,
+			&session.JustSelfCorrected, &challengeJSON, &session.MessagesJSON,
+			&createdAt, &updatedAt, &archivedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan archived session: %w", err)
+		}
+		session.CreatedAt = time.Unix(createdAt, 0)
+		session.UpdatedAt = time.Unix(updatedAt, 0)
+		session.ArchivedAt = time.Unix(archivedAt, 0)
+		if lastProactiveMsg.Valid {
+			ts := time.Unix(lastProactiveMsg.Int64, 0)
+			session.LastProactiveMsg = &ts
+		}
+		if challengeJSON.Valid {
+			session.ChallengeJSON = &challengeJSON.String
+		}
+		sessions = append(sessions, &session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate archived sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// ListArchivedSessions returns a user's archived agent sessions, newest first.
+func (s *SQLiteStore) ListArchivedSessions(ctx context.Context, userID string) ([]*domain.ArchivedAgentSession, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(listArchivedSessionsQuery, "?"), userID)
+	if err != nil {
+		return nil, fmt.Errorf("list archived sessions: %w", err)
+	}
+	return scanArchivedSessions(rows)
+}
+
+// PruneArchivedSessions deletes sessions archived longer than retention ago.
+func (s *SQLiteStore) PruneArchivedSessions(ctx context.Context, retention time.Duration) (int64, error) {
+	threshold := time.Now().Add(-retention).Unix()
+	result, err := s.db.ExecContext(ctx, `DELETE FROM agent_sessions_archive WHERE archived_at <= ?`, threshold)
+	if err != nil {
+		return 0, fmt.Errorf("prune archived sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// ListArchivedSessions returns a user's archived agent sessions, newest first.
+func (s *PostgresStore) ListArchivedSessions(ctx context.Context, userID string) ([]*domain.ArchivedAgentSession, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(listArchivedSessionsQuery, "$1"), userID)
+	if err != nil {
+		return nil, fmt.Errorf("list archived sessions: %w", err)
+	}
+	return scanArchivedSessions(rows)
+}
+
+// PruneArchivedSessions deletes sessions archived longer than retention ago.
+func (s *PostgresStore) PruneArchivedSessions(ctx context.Context, retention time.Duration) (int64, error) {
+	threshold := time.Now().Add(-retention).Unix()
+	result, err := s.db.ExecContext(ctx, `DELETE FROM agent_sessions_archive WHERE archived_at <= $1`, threshold)
+	if err != nil {
+		return 0, fmt.Errorf("prune archived sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// ListArchivedSessions returns nothing: Redis agent sessions expire through
+// their TTL and are never archived.
+func (s *RedisStore) ListArchivedSessions(context.Context, string) ([]*domain.ArchivedAgentSession, error) {
+	return nil, nil
+}
+
+// PruneArchivedSessions is a no-op; see ListArchivedSessions.
+func (s *RedisStore) PruneArchivedSessions(context.Context, time.Duration) (int64, error) {
+	return 0, nil
+}
@@ -0,0 +1,314 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+)
+
+// createSessionShare stores a share link.
+func createSessionShare(ctx context.Context, db *sql.DB, d sqlDialect, share *domain.SessionShare) error {
+	bind := d.bind
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO session_shares (token, user_id, session_id, transcript_json, created_at, expires_at)
+		VALUES (`+bind(1)+`, `+bind(2)+`, `+bind(3)+`, `+bind(4)+`, `+bind(5)+`, `+bind(6)+`)`,
+		share.Token, share.UserID, share.SessionID, share.Transcript, share.CreatedAt.Unix(), share.ExpiresAt.Unix())
+	if err != nil {
+		return fmt.Errorf("create session share: %w", err)
+	}
+	return nil
+}
+
+// getSessionShare returns an unexpired share link by token.
+func getSessionShare(ctx context.Context, db *sql.DB, d sqlDialect, token string) (*domain.SessionShare, error) {
+	bind := d.bind
+	share := &domain.SessionShare{Token: token}
+	var createdAt, expiresAt int64
+	err := db.QueryRowContext(ctx, `
+		SELECT user_id, session_id, transcript_json, created_at, expires_at FROM session_shares
+		WHERE token = `+bind(1)+` AND expires_at > `+bind(2),
+		token, time.Now().Unix()).Scan(&share.UserID, &share.SessionID, &share.Transcript, &createdAt, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get session share: %w", err)
+	}
+	share.CreatedAt = time.Unix(createdAt, 0)
+	share.ExpiresAt = time.Unix(expiresAt, 0)
+	return share, nil
+}
+
+// listSessionShares returns a user's unexpired share links, newest first,
+// without their transcripts.
+func listSessionShares(ctx context.Context, db *sql.DB, d sqlDialect, userID string) ([]*domain.SessionShare, error) {
+	bind := d.bind
+	rows, err := db.QueryContext(ctx, `
+		SELECT token, session_id, created_at, expires_at FROM session_shares
+		WHERE user_id = `+bind(1)+` AND expires_at > `+bind(2)+`
+		ORDER BY created_at DESC, token`,
+		userID, time.Now().Unix())
+	if err != nil {
+		return nil, fmt.Errorf("query session shares: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			slog.Warn("failed to close rows", "query", "ListSessionShares", "error", closeErr)
+		}
+	}()
+
+	var shares []*domain.SessionShare
+	for rows.Next() {
+		share := &domain.SessionShare{UserID: userID}
+		var createdAt, expiresAt int64
+		if err := rows.Scan(&share.Token, &share.SessionID, &createdAt, &expiresAt); err != nil {
+			return nil, fmt.Errorf("scan session share: %w", err)
+		}
+		share.CreatedAt = time.Unix(createdAt, 0)
+		share.ExpiresAt = time.Unix(expiresAt, 0)
+		shares = append(shares, share)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate session shares: %w", err)
+	}
+	return shares, nil
+}
+
+// deleteSessionShare removes one of a user's share links.
+func deleteSessionShare(ctx context.Context, db *sql.DB, d sqlDialect, userID, token string) (bool, error) {
+	bind := d.bind
+	result, err := db.ExecContext(ctx, `DELETE FROM session_shares WHERE token = `+bind(1)+` AND user_id = `+bind(2), token, userID)
+	if err != nil {
+		return false, fmt.Errorf("delete session share: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("delete session share: %w", err)
+	}
+	return n > 0, nil
+}
+
+// pruneExpiredSessionShares deletes share links past their expiry.
+func pruneExpiredSessionShares(ctx context.Context, db *sql.DB, d sqlDialect) (int64, error) {
+	result, err := db.ExecContext(ctx, `DELETE FROM session_shares WHERE expires_at <= `+d.bind(1), time.Now().Unix())
+	if err != nil {
+		return 0, fmt.Errorf("prune session shares: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// CreateSessionShare stores a public share link.
+func (s *SQLiteStore) CreateSessionShare(ctx context.Context, share *domain.SessionShare) error {
+	return createSessionShare(ctx, s.db, sqliteDialect, share)
+}
+
+// GetSessionShare returns an unexpired share link by token.
+func (s *SQLiteStore) GetSessionShare(ctx context.Context, token string) (*domain.SessionShare, error) {
+	return getSessionShare(ctx, s.db, sqliteDialect, token)
+}
+
+// ListSessionShares returns a user's unexpired share links.
+func (s *SQLiteStore) ListSessionShares(ctx context.Context, userID string) ([]*domain.SessionShare, error) {
+	return listSessionShares(ctx, s.db, sqliteDialect, userID)
+}
+
+// DeleteSessionShare revokes one of a user's share links.
+func (s *SQLiteStore) DeleteSessionShare(ctx context.Context, userID, token string) (bool, error) {
+	return deleteSessionShare(ctx, s.db, sqliteDialect, userID, token)
+}
+
+// PruneExpiredSessionShares deletes expired share links.
+func (s *SQLiteStore) PruneExpiredSessionShares(ctx context.Context) (int64, error) {
+	return pruneExpiredSessionShares(ctx, s.db, sqliteDialect)
+}
+
+// CreateSessionShare stores a public share link.
+func (s *PostgresStore) CreateSessionShare(ctx context.Context, share *domain.SessionShare) error {
+	return createSessionShare(ctx, s.db, postgresDialect, share)
+}
+
+// GetSessionShare returns an unexpired share link by token.
+func (s *PostgresStore) GetSessionShare(ctx context.Context, token string) (*domain.SessionShare, error) {
+	return getSessionShare(ctx, s.db, postgresDialect, token)
+}
+
+// ListSessionShares returns a user's unexpired share links.
+func (s *PostgresStore) ListSessionShares(ctx context.Context, userID string) ([]*domain.SessionShare, error) {
+	return listSessionShares(ctx, s.db, postgresDialect, userID)
+}
+
+// DeleteSessionShare revokes one of a user's share links.
+func (s *PostgresStore) DeleteSessionShare(ctx context.Context, userID, token string) (bool, error) {
+	return deleteSessionShare(ctx, s.db, postgresDialect, userID, token)
+}
+
+// PruneExpiredSessionShares deletes expired share links.
+func (s *PostgresStore) PruneExpiredSessionShares(ctx context.Context) (int64, error) {
+	return pruneExpiredSessionShares(ctx, s.db, postgresDialect)
+}
+
+// redisShare is the JSON stored under share:<token>, which expires with the
+// link.
+type redisShare struct {
+	UserID     string `json:"user_id"`
+	SessionID  string `json:"session_id"`
+	Transcript string `json:"transcript"`
+	CreatedAt  int64  `json:"created_at"`
+	ExpiresAt  int64  `json:"expires_at"`
+}
+
+func (r *redisShare) share(token string) *domain.SessionShare {
+	return &domain.SessionShare{
+		Token:      token,
+		UserID:     r.UserID,
+		SessionID:  r.SessionID,
+		Transcript: r.Transcript,
+		CreatedAt:  time.Unix(r.CreatedAt, 0),
+		ExpiresAt:  time.Unix(r.ExpiresAt, 0),
+	}
+}
+
+// CreateSessionShare stores a public share link and indexes it under the
+// user.
+func (s *RedisStore) CreateSessionShare(ctx context.Context, share *domain.SessionShare) error {
+	data, err := json.Marshal(redisShare{
+		UserID:     share.UserID,
+		SessionID:  share.SessionID,
+		Transcript: share.Transcript,
+		CreatedAt:  share.CreatedAt.Unix(),
+		ExpiresAt:  share.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("encode session share: %w", err)
+	}
+	if _, err := s.client.Tx(ctx,
+		[]any{"SET", s.key("share", share.Token), string(data), "EXAT", share.ExpiresAt.Unix()},
+		[]any{"SADD", s.key("shares", share.UserID), share.Token},
+	); err != nil {
+		return fmt.Errorf("create session share: %w", err)
+	}
+	return nil
+}
+
+// GetSessionShare returns an unexpired share link by token.
+func (s *RedisStore) GetSessionShare(ctx context.Context, token string) (*domain.SessionShare, error) {
+	reply, err := s.client.Do(ctx, "GET", s.key("share", token))
+	if err != nil {
+		return nil, fmt.Errorf("get session share: %w", err)
+	}
+	data, ok := reply.(string)
+	if !ok {
+		return nil, nil
+	}
+	var stored redisShare
+	if err := json.Unmarshal([]byte(data), &stored); err != nil {
+		return nil, fmt.Errorf("decode session share: %w", err)
+	}
+	return stored.share(token), nil
+}
+
+// ListSessionShares returns a user's unexpired share links, newest first.
+// Expired links are dropped from the user's index.
+func (s *RedisStore) ListSessionShares(ctx context.Context, userID string) ([]*domain.SessionShare, error) {
+	tokens, err := s.shareTokens(ctx, userID)
+	if err != nil || len(tokens) == 0 {
+		return nil, err
+	}
+	cmd := []any{"MGET"}
+	for _, token := range tokens {
+		cmd = append(cmd, s.key("share", token))
+	}
+	reply, err := s.client.Do(ctx, cmd...)
+	if err != nil {
+		return nil, fmt.Errorf("list session shares: %w", err)
+	}
+	items, _ := reply.([]any)
+
+	var shares []*domain.SessionShare
+	var expired []any
+	for i, token := range tokens {
+		var data string
+		if i < len(items) {
+			data, _ = items[i].(string)
+		}
+		if data == "" {
+			expired = append(expired, token)
+			continue
+		}
+		var stored redisShare
+		if err := json.Unmarshal([]byte(data), &stored); err != nil {
+			return nil, fmt.Errorf("decode session share: %w", err)
+		}
+		share := stored.share(token)
+		share.Transcript = ""
+		shares = append(shares, share)
+	}
+	if len(expired) > 0 {
+		if _, err := s.client.Do(ctx, append([]any{"SREM", s.key("shares", userID)}, expired...)...); err != nil {
+			slog.Debug("Failed to prune session share index", "user_id", userID, "error", err)
+		}
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		if !shares[i].CreatedAt.Equal(shares[j].CreatedAt) {
+			return shares[i].CreatedAt.After(shares[j].CreatedAt)
+		}
+		return shares[i].Token < shares[j].Token
+	})
+	return shares, nil
+}
+
+// shareTokens returns the tokens indexed under a user.
+func (s *RedisStore) shareTokens(ctx context.Context, userID string) ([]string, error) {
+	reply, err := s.client.Do(ctx, "SMEMBERS", s.key("shares", userID))
+	if err != nil {
+		return nil, fmt.Errorf("list session shares: %w", err)
+	}
+	tokens, err := redisStrings(reply)
+	if err != nil {
+		return nil, fmt.Errorf("list session shares: %w", err)
+	}
+	return tokens, nil
+}
+
+// DeleteSessionShare revokes one of a user's share links.
+func (s *RedisStore) DeleteSessionShare(ctx context.Context, userID, token string) (bool, error) {
+	// Only the user's index proves ownership of the token.
+	reply, err := s.client.Do(ctx, "SREM", s.key("shares", userID), token)
+	if err != nil {
+		return false, fmt.Errorf("delete session share: %w", err)
+	}
+	if removed, _ := reply.(int64); removed == 0 {
+		return false, nil
+	}
+	if _, err := s.client.Do(ctx, "DEL", s.key("share", token)); err != nil {
+		return false, fmt.Errorf("delete session share: %w", err)
+	}
+	return true, nil
+}
+
+// PruneExpiredSessionShares is a no-op: share links expire through their
+// TTL and are dropped from user indexes by ListSessionShares.
+func (s *RedisStore) PruneExpiredSessionShares(context.Context) (int64, error) {
+	return 0, nil
+}
+
+// sessionShareKeys returns every key holding a user's share links,
+// including the index.
+func (s *RedisStore) sessionShareKeys(ctx context.Context, userID string) ([]any, error) {
+	tokens, err := s.shareTokens(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	keys := []any{s.key("shares", userID)}
+	for _, token := range tokens {
+		keys = append(keys, s.key("share", token))
+	}
+	return keys, nil
+}
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+)
+
+// upsertSnippet creates or replaces a snippet.
+func upsertSnippet(ctx context.Context, db *sql.DB, d sqlDialect, snippet *domain.Snippet) error {
+	bind := d.bind
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO snippets (user_id, name, description, body, updated_at)
+		VALUES (`+bind(1)+`, `+bind(2)+`, `+bind(3)+`, `+bind(4)+`, `+bind(5)+`)
+		ON CONFLICT (user_id, name) DO UPDATE SET
+			description = excluded.description,
+			body = excluded.body,
+			updated_at = excluded.updated_at`,
+		snippet.UserID, snippet.Name, snippet.Description, snippet.Body, snippet.UpdatedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("upsert snippet: %w", err)
+	}
+	return nil
+}
+
+// listSnippets returns a user's snippets sorted by name.
+func listSnippets(ctx context.Context, db *sql.DB, d sqlDialect, userID string) ([]*domain.Snippet, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT name, description, body, updated_at FROM snippets
+		WHERE user_id = `+d.bind(1)+`
+		ORDER BY name`,
+		userID)
+	if err != nil {
+		return nil, fmt.Errorf("query snippets: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			slog.Warn("failed to close rows", "query", "ListSnippets", "error", closeErr)
+		}
+	}()
+
+	var snippets []*domain.Snippet
+	for rows.Next() {
+		snippet := &domain.Snippet{UserID: userID}
+		var updatedAt int64
+		if err := rows.Scan(&snippet.Name, &snippet.Description, &snippet.Body, &updatedAt); err != nil {
+			return nil, fmt.Errorf("scan snippet: %w", err)
+		}
+		snippet.UpdatedAt = time.Unix(updatedAt, 0)
+		snippets = append(snippets, snippet)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate snippets: %w", err)
+	}
+	return snippets, nil
+}
+
+// deleteSnippet removes one of a user's snippets.
+func deleteSnippet(ctx context.Context, db *sql.DB, d sqlDialect, userID, name string) (bool, error) {
+	bind := d.bind
+	result, err := db.ExecContext(ctx, `DELETE FROM snippets WHERE user_id = `+bind(1)+` AND name = `+bind(2), userID, name)
+	if err != nil {
+		return false, fmt.Errorf("delete snippet: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("delete snippet: %w", err)
+	}
+	return n > 0, nil
+}
+
+// UpsertSnippet creates or replaces one of a user's snippets.
+func (s *SQLiteStore) UpsertSnippet(ctx context.Context, snippet *domain.Snippet) error {
+	return upsertSnippet(ctx, s.db, sqliteDialect, snippet)
+}
+
+// ListSnippets returns a user's snippets sorted by name.
+func (s *SQLiteStore) ListSnippets(ctx context.Context, userID string) ([]*domain.Snippet, error) {
+	return listSnippets(ctx, s.db, sqliteDialect, userID)
+}
+
+// DeleteSnippet removes one of a user's snippets.
+func (s *SQLiteStore) DeleteSnippet(ctx context.Context, userID, name string) (bool, error) {
+	return deleteSnippet(ctx, s.db, sqliteDialect, userID, name)
+}
+
+// UpsertSnippet creates or replaces one of a user's snippets.
+func (s *PostgresStore) UpsertSnippet(ctx context.Context, snippet *domain.Snippet) error {
+	return upsertSnippet(ctx, s.db, postgresDialect, snippet)
+}
+
+// ListSnippets returns a user's snippets sorted by name.
+func (s *PostgresStore) ListSnippets(ctx context.Context, userID string) ([]*domain.Snippet, error) {
+	return listSnippets(ctx, s.db, postgresDialect, userID)
+}
+
+// DeleteSnippet removes one of a user's snippets.
+func (s *PostgresStore) DeleteSnippet(ctx context.Context, userID, name string) (bool, error) {
+	return deleteSnippet(ctx, s.db, postgresDialect, userID, name)
+}
+
+// redisSnippet is the JSON stored per name in a user's snippets hash.
+type redisSnippet struct {
+	Description string `json:"description,omitempty"`
+	Body        string `json:"body"`
+	UpdatedAt   int64  `json:"updated_at"`
+}
+
+// UpsertSnippet creates or replaces one of a user's snippets.
+func (s *RedisStore) UpsertSnippet(ctx context.Context, snippet *domain.Snippet) error {
+	data, err := json.Marshal(redisSnippet{
+		Description: snippet.Description,
+		Body:        snippet.Body,
+		UpdatedAt:   snippet.UpdatedAt.Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("encode snippet: %w", err)
+	}
+	if _, err := s.client.Do(ctx, "HSET", s.key("snippets", snippet.UserID), snippet.Name, string(data)); err != nil {
+		return fmt.Errorf("upsert snippet: %w", err)
+	}
+	return nil
+}
+
+// ListSnippets returns a user's snippets sorted by name.
+func (s *RedisStore) ListSnippets(ctx context.Context, userID string) ([]*domain.Snippet, error) {
+	reply, err := s.client.Do(ctx, "HGETALL", s.key("snippets", userID))
+	if err != nil {
+		return nil, fmt.Errorf("list snippets: %w", err)
+	}
+	fields, err := redisHash(reply)
+	if err != nil {
+		return nil, fmt.Errorf("list snippets: %w", err)
+	}
+	snippets := make([]*domain.Snippet, 0, len(fields))
+	for name, data := range fields {
+		var stored redisSnippet
+		if err := json.Unmarshal([]byte(data), &stored); err != nil {
+			return nil, fmt.Errorf("decode snippet: %w", err)
+		}
+		snippets = append(snippets, &domain.Snippet{
+			UserID:      userID,
+			Name:        name,
+			Description: stored.Description,
+			Body:        stored.Body,
+			UpdatedAt:   time.Unix(stored.UpdatedAt, 0),
+		})
+	}
+	sort.Slice(snippets, func(i, j int) bool { return snippets[i].Name < snippets[j].Name })
+	return snippets, nil
+}
+
+// DeleteSnippet removes one of a user's snippets.
+func (s *RedisStore) DeleteSnippet(ctx context.Context, userID, name string) (bool, error) {
+	reply, err := s.client.Do(ctx, "HDEL", s.key("snippets", userID), name)
+	if err != nil {
+		return false, fmt.Errorf("delete snippet: %w", err)
+	}
+	removed, _ := reply.(int64)
+	return removed > 0, nil
+}
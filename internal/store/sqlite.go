@@ -8,7 +8,9 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ashureev/shsh-labs/internal/domain"
@@ -16,6 +18,14 @@ import (
 	_ "modernc.org/sqlite" // Register SQLite driver.
 )
 
+// maxNotificationsPerUser bounds the notifications kept for one user; older
+// ones are deleted as new ones arrive.
+const maxNotificationsPerUser = 200
+
+// maxCommandsPerUser bounds the executed commands kept for one user; older
+// ones are deleted as new ones arrive.
+const maxCommandsPerUser = 1000
+
 var (
 	errOptimisticLockContainerID = errors.New("optimistic lock failed: container_id does not match expected_id")
 	errUserNotFound              = errors.New("user not found")
@@ -24,7 +34,9 @@ var (
 // SQLiteStore implements Repository using SQLite.
 type SQLiteStore struct {
 	db             *sql.DB
-	agentSessionMu sync.Mutex // Mutex for agent session operations to prevent SQLITE_BUSY
+	path           string
+	agentSessionMu sync.Mutex   // Mutex for agent session operations to prevent SQLITE_BUSY
+	busyRetries    atomic.Int64 // SQLITE_BUSY errors retried internally
 }
 
 // NewSQLite creates a new SQLite-backed repository.
@@ -48,7 +60,7 @@ func NewSQLite(dbPath string) (Repository, error) {
 		return nil, fmt.Errorf("ping database: %w", err)
 	}
 
-	store := &SQLiteStore{db: db}
+	store := &SQLiteStore{db: db, path: dbPath}
 	if err := store.initSchema(); err != nil {
 		return nil, fmt.Errorf("initialize schema: %w", err)
 	}
@@ -56,37 +68,32 @@ func NewSQLite(dbPath string) (Repository, error) {
 	return store, nil
 }
 
+// initSchema migrates the database to the latest schema version.
 func (s *SQLiteStore) initSchema() error {
-	query := `
-	PRAGMA busy_timeout = 5000;
-	CREATE TABLE IF NOT EXISTS users (
-		user_id TEXT PRIMARY KEY,
-		username TEXT NOT NULL,
-		container_id TEXT,
-		last_seen_at INTEGER NOT NULL,
-		volume_path TEXT NOT NULL,
-		created_at INTEGER NOT NULL,
-		updated_at INTEGER NOT NULL
-	);
-	CREATE INDEX IF NOT EXISTS idx_last_seen ON users(last_seen_at) WHERE container_id IS NOT NULL;
-
-	CREATE TABLE IF NOT EXISTS agent_sessions (
-		user_id TEXT PRIMARY KEY,
-		last_proactive_msg INTEGER,
-		attempt_count INTEGER DEFAULT 0,
-		just_self_corrected INTEGER DEFAULT 0,
-		is_typing INTEGER DEFAULT 0,
-		challenge_json TEXT,
-		messages_json TEXT,
-		created_at INTEGER NOT NULL,
-		updated_at INTEGER NOT NULL
-	);
-	CREATE INDEX IF NOT EXISTS idx_agent_sessions_updated ON agent_sessions(updated_at);
-	`
-	if _, err := s.db.ExecContext(context.Background(), query); err != nil {
-		return fmt.Errorf("create schema: %w", err)
+	ctx := context.Background()
+	if _, err := s.db.ExecContext(ctx, `PRAGMA busy_timeout = 5000`); err != nil {
+		return fmt.Errorf("set busy timeout: %w", err)
 	}
-	return nil
+	m := s.migrator()
+	return m.migrateTo(ctx, m.latest())
+}
+
+func (s *SQLiteStore) migrator() *migrator {
+	return &migrator{
+		db:         s.db,
+		migrations: sqliteMigrations,
+		bind:       bindQuestion,
+	}
+}
+
+// SchemaVersion returns the highest applied schema migration.
+func (s *SQLiteStore) SchemaVersion(ctx context.Context) (int, error) {
+	return s.migrator().version(ctx)
+}
+
+// MigrateTo applies or reverts schema migrations until version is reached.
+func (s *SQLiteStore) MigrateTo(ctx context.Context, version int) error {
+	return s.migrator().migrateTo(ctx, version)
 }
 
 // Ping verifies database connectivity.
@@ -97,19 +104,23 @@ func (s *SQLiteStore) Ping(ctx context.Context) error {
 // GetUser retrieves a user by their user ID.
 func (s *SQLiteStore) GetUser(ctx context.Context, userID string) (*domain.User, error) {
 	query := `
-		SELECT user_id, username, container_id,
-		       last_seen_at, volume_path, created_at, updated_at 
+		SELECT user_id, username, container_id, instance_id,
+		       last_seen_at, volume_path, created_at, updated_at, keep_warm_until,
+		       resource_tier, classroom
 		FROM users WHERE user_id = ?`
 
 	row := s.db.QueryRowContext(ctx, query, userID)
 
 	var user domain.User
-	var containerID sql.NullString
+	var containerID, instanceID sql.NullString
 	var lastSeen, createdAt, updatedAt int64
+	var keepWarmUntil sql.NullInt64
+	var resourceTier, classroom sql.NullString
 
 	err := row.Scan(
-		&user.UserID, &user.Username, &containerID,
-		&lastSeen, &user.VolumePath, &createdAt, &updatedAt,
+		&user.UserID, &user.Username, &containerID, &instanceID,
+		&lastSeen, &user.VolumePath, &createdAt, &updatedAt, &keepWarmUntil,
+		&resourceTier, &classroom,
 	)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
@@ -119,9 +130,15 @@ func (s *SQLiteStore) GetUser(ctx context.Context, userID string) (*domain.User,
 	}
 
 	user.ContainerID = containerID.String
+	user.InstanceID = instanceID.String
 	user.LastSeenAt = time.Unix(lastSeen, 0)
 	user.CreatedAt = time.Unix(createdAt, 0)
 	user.UpdatedAt = time.Unix(updatedAt, 0)
+	if keepWarmUntil.Valid {
+		user.KeepWarmUntil = time.Unix(keepWarmUntil.Int64, 0)
+	}
+	user.ResourceTier = resourceTier.String
+	user.Classroom = classroom.String
 
 	return &user, nil
 }
@@ -205,46 +222,195 @@ func (s *SQLiteStore) UpdateContainerID(ctx context.Context, userID string, cont
 	return nil
 }
 
+// UpdateInstanceID records which server instance holds the user's terminal session.
+func (s *SQLiteStore) UpdateInstanceID(ctx context.Context, userID string, instanceID string) error {
+	query := `UPDATE users SET instance_id = ?, updated_at = ? WHERE user_id = ?`
+	var value interface{}
+	if instanceID != "" {
+		value = instanceID
+	}
+
+	result, err := s.db.ExecContext(ctx, query, value, time.Now().Unix(), userID)
+	if err != nil {
+		return fmt.Errorf("update instance_id: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
+
 // GetExpiredSessions retrieves users whose containers have exceeded the inactivity TTL.
 func (s *SQLiteStore) GetExpiredSessions(ctx context.Context, ttl time.Duration) ([]*domain.User, error) {
 	threshold := time.Now().Add(-ttl).Unix()
 	query := `
-		SELECT user_id, username, container_id,
-		       last_seen_at, volume_path, created_at, updated_at 
+		SELECT user_id, username, container_id, instance_id,
+		       last_seen_at, volume_path, created_at, updated_at, keep_warm_until,
+		       resource_tier, classroom
 		FROM users WHERE container_id IS NOT NULL AND last_seen_at < ?`
 
 	rows, err := s.db.QueryContext(ctx, query, threshold)
 	if err != nil {
 		return nil, fmt.Errorf("query expired sessions: %w", err)
 	}
+	users, err := scanUsers(rows, "expired sessions")
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// GetActiveContainers retrieves users that currently have a container assigned.
+func (s *SQLiteStore) GetActiveContainers(ctx context.Context) ([]*domain.User, error) {
+	query := `
+		SELECT user_id, username, container_id, instance_id,
+		       last_seen_at, volume_path, created_at, updated_at, keep_warm_until,
+		       resource_tier, classroom
+		FROM users WHERE container_id IS NOT NULL AND container_id != ''`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("query active containers: %w", err)
+	}
+	users, err := scanUsers(rows, "active containers")
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// SetKeepWarm exempts a user from TTL cleanup and rate limits until the given time.
+func (s *SQLiteStore) SetKeepWarm(ctx context.Context, userID string, until time.Time) error {
+	query := `UPDATE users SET keep_warm_until = ?, updated_at = ? WHERE user_id = ?`
+	var value interface{}
+	if !until.IsZero() {
+		value = until.Unix()
+	}
+
+	result, err := s.db.ExecContext(ctx, query, value, time.Now().Unix(), userID)
+	if err != nil {
+		return fmt.Errorf("update keep_warm_until: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
+
+// SetResourceTier assigns a user's containers a resource tier; an empty tier
+// clears the assignment.
+func (s *SQLiteStore) SetResourceTier(ctx context.Context, userID, tier string) error {
+	query := `UPDATE users SET resource_tier = ?, updated_at = ? WHERE user_id = ?`
+	var value interface{}
+	if tier != "" {
+		value = tier
+	}
+
+	result, err := s.db.ExecContext(ctx, query, value, time.Now().Unix(), userID)
+	if err != nil {
+		return fmt.Errorf("update resource_tier: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
+
+// SetClassroom assigns a user to a classroom; an empty classroom removes them
+// from theirs.
+func (s *SQLiteStore) SetClassroom(ctx context.Context, userID, classroom string) error {
+	query := `UPDATE users SET classroom = ?, updated_at = ? WHERE user_id = ?`
+	var value interface{}
+	if classroom != "" {
+		value = classroom
+	}
+
+	result, err := s.db.ExecContext(ctx, query, value, time.Now().Unix(), userID)
+	if err != nil {
+		return fmt.Errorf("update classroom: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get rows affected: %w", err)
+	}
+	if rows == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
+
+// ListKeptWarmUsers returns users whose keep-warm exemption is in effect at now.
+func (s *SQLiteStore) ListKeptWarmUsers(ctx context.Context, now time.Time) ([]*domain.User, error) {
+	query := `
+		SELECT user_id, username, container_id, instance_id,
+		       last_seen_at, volume_path, created_at, updated_at, keep_warm_until,
+		       resource_tier, classroom
+		FROM users WHERE keep_warm_until > ? ORDER BY keep_warm_until`
+
+	rows, err := s.db.QueryContext(ctx, query, now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("query kept warm users: %w", err)
+	}
+	return scanUsers(rows, "kept warm users")
+}
+
+// scanUsers reads user rows selected as (user_id, username, container_id,
+// instance_id, last_seen_at, volume_path, created_at, updated_at,
+// keep_warm_until, resource_tier, classroom) and closes rows.
+func scanUsers(rows *sql.Rows, what string) ([]*domain.User, error) {
 	defer func() {
 		if closeErr := rows.Close(); closeErr != nil {
-			slog.Warn("failed to close expired sessions rows", "error", closeErr)
+			slog.Warn("failed to close rows", "query", what, "error", closeErr)
 		}
 	}()
 
 	var users []*domain.User
 	for rows.Next() {
 		var user domain.User
-		var containerID sql.NullString
+		var containerID, instanceID sql.NullString
 		var lastSeen, createdAt, updatedAt int64
+		var keepWarmUntil sql.NullInt64
+		var resourceTier, classroom sql.NullString
 
 		if err := rows.Scan(
-			&user.UserID, &user.Username, &containerID,
-			&lastSeen, &user.VolumePath, &createdAt, &updatedAt,
+			&user.UserID, &user.Username, &containerID, &instanceID,
+			&lastSeen, &user.VolumePath, &createdAt, &updatedAt, &keepWarmUntil,
+			&resourceTier, &classroom,
 		); err != nil {
-			return nil, fmt.Errorf("scan expired session row: %w", err)
+			return nil, fmt.Errorf("scan %s row: %w", what, err)
 		}
 
 		user.ContainerID = containerID.String
+		user.InstanceID = instanceID.String
 		user.LastSeenAt = time.Unix(lastSeen, 0)
 		user.CreatedAt = time.Unix(createdAt, 0)
 		user.UpdatedAt = time.Unix(updatedAt, 0)
+		if keepWarmUntil.Valid {
+			user.KeepWarmUntil = time.Unix(keepWarmUntil.Int64, 0)
+		}
+		user.ResourceTier = resourceTier.String
+		user.Classroom = classroom.String
 		users = append(users, &user)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("iterate expired sessions: %w", err)
+		return nil, fmt.Errorf("iterate %s: %w", what, err)
 	}
 
 	return users, nil
@@ -258,101 +424,63 @@ func (s *SQLiteStore) Close() error {
 	return nil
 }
 
-// GetAgentSession retrieves agent session state for a user.
-func (s *SQLiteStore) GetAgentSession(ctx context.Context, userID string) (*domain.AgentSession, error) {
+// GetAgentSession retrieves the agent session state of a user's tab session.
+func (s *SQLiteStore) GetAgentSession(ctx context.Context, userID, sessionID string) (*domain.AgentSession, error) {
 	s.agentSessionMu.Lock()
 	defer s.agentSessionMu.Unlock()
 
-	query := `
-		SELECT user_id, last_proactive_msg, attempt_count, just_self_corrected,
-		       is_typing, challenge_json, messages_json, created_at, updated_at
-		FROM agent_sessions WHERE user_id = ?`
-
-	row := s.db.QueryRowContext(ctx, query, userID)
-
-	var session domain.AgentSession
-	var lastProactiveMsg sql.NullInt64
-	var challengeJSON sql.NullString
-	var messagesJSON string
-	var createdAt, updatedAt int64
-
-	err := row.Scan(
-		&session.UserID, &lastProactiveMsg, &session.AttemptCount,
-		&session.JustSelfCorrected, &session.IsTyping,
-		&challengeJSON, &messagesJSON,
-		&createdAt, &updatedAt,
-	)
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(getAgentSessionQuery, "?", "?"), userID, sessionID)
+	session, err := scanAgentSession(row)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("scan agent session: %w", err)
 	}
+	return session, nil
+}
 
-	session.CreatedAt = time.Unix(createdAt, 0)
-	session.UpdatedAt = time.Unix(updatedAt, 0)
+// ListAgentSessions returns every agent session of a user, most recently
+// updated first.
+func (s *SQLiteStore) ListAgentSessions(ctx context.Context, userID string) ([]*domain.AgentSession, error) {
+	s.agentSessionMu.Lock()
+	defer s.agentSessionMu.Unlock()
 
-	if lastProactiveMsg.Valid {
-		ts := time.Unix(lastProactiveMsg.Int64, 0)
-		session.LastProactiveMsg = &ts
-	}
-	if challengeJSON.Valid {
-		session.ChallengeJSON = &challengeJSON.String
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(listAgentSessionsQuery, "?"), userID)
+	if err != nil {
+		return nil, fmt.Errorf("list agent sessions: %w", err)
 	}
-	session.MessagesJSON = messagesJSON
-
-	return &session, nil
+	return scanAgentSessions(rows)
 }
 
-// UpsertAgentSession creates or updates agent session state.
+// UpsertAgentSession creates or updates agent session state, failing with
+// ErrVersionConflict if it changed since session was read.
 func (s *SQLiteStore) UpsertAgentSession(ctx context.Context, session *domain.AgentSession) error {
 	s.agentSessionMu.Lock()
 	defer s.agentSessionMu.Unlock()
 
-	query := `
-		INSERT INTO agent_sessions (
-			user_id, last_proactive_msg, attempt_count, just_self_corrected,
-			is_typing, challenge_json, messages_json, created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-		ON CONFLICT(user_id) DO UPDATE SET
-			last_proactive_msg = COALESCE(excluded.last_proactive_msg, agent_sessions.last_proactive_msg),
-			attempt_count = excluded.attempt_count,
-			just_self_corrected = excluded.just_self_corrected,
-			is_typing = excluded.is_typing,
-			challenge_json = COALESCE(excluded.challenge_json, agent_sessions.challenge_json),
-			messages_json = excluded.messages_json,
-			updated_at = excluded.updated_at`
-
-	var lastProactiveMsg interface{}
-	if session.LastProactiveMsg != nil {
-		lastProactiveMsg = session.LastProactiveMsg.Unix()
-	}
-
-	var challengeJSON interface{}
-	if session.ChallengeJSON != nil {
-		challengeJSON = *session.ChallengeJSON
-	}
+	return upsertAgentSession(ctx, s.db, sqliteDialect, session)
+}
 
-	_, err := s.db.ExecContext(ctx, query,
-		session.UserID, lastProactiveMsg, session.AttemptCount,
-		session.JustSelfCorrected, session.IsTyping,
-		challengeJSON, session.MessagesJSON,
-		session.CreatedAt.Unix(), time.Now().Unix(),
-	)
-	if err != nil {
-		return fmt.Errorf("upsert agent session: %w", err)
-	}
-	return nil
+// DeleteAgentSession removes the agent session state of one tab session.
+// Implements retry logic with exponential backoff to handle SQLITE_BUSY errors.
+func (s *SQLiteStore) DeleteAgentSession(ctx context.Context, userID, sessionID string) error {
+	return s.deleteAgentSessionsWithRetry(ctx, userID,
+		`DELETE FROM agent_sessions WHERE user_id = ? AND session_id = ?`, userID, sessionID)
 }
 
-// DeleteAgentSession removes agent session state.
+// DeleteAgentSessions removes every agent session of a user.
 // Implements retry logic with exponential backoff to handle SQLITE_BUSY errors.
-func (s *SQLiteStore) DeleteAgentSession(ctx context.Context, userID string) error {
+func (s *SQLiteStore) DeleteAgentSessions(ctx context.Context, userID string) error {
+	return s.deleteAgentSessionsWithRetry(ctx, userID, `DELETE FROM agent_sessions WHERE user_id = ?`, userID)
+}
+
+func (s *SQLiteStore) deleteAgentSessionsWithRetry(ctx context.Context, userID, query string, args ...any) error {
 	maxRetries := 3
 	baseDelay := 100 * time.Millisecond
 
 	for i := 0; i < maxRetries; i++ {
-		err := s.deleteAgentSessionOnce(ctx, userID)
+		err := s.deleteAgentSessionOnce(ctx, query, args...)
 		if err == nil {
 			return nil
 		}
@@ -360,6 +488,7 @@ func (s *SQLiteStore) DeleteAgentSession(ctx context.Context, userID string) err
 		// Check if it's a SQLITE_BUSY error
 		if shared.IsSQLiteConflictError(err) {
 			if i < maxRetries-1 {
+				s.busyRetries.Add(1)
 				delay := baseDelay * time.Duration(1<<i) // exponential backoff: 100ms, 200ms, 400ms
 				slog.Debug("DeleteAgentSession failed with SQLITE_BUSY, retrying",
 					"user_id", userID,
@@ -378,29 +507,299 @@ func (s *SQLiteStore) DeleteAgentSession(ctx context.Context, userID string) err
 }
 
 // deleteAgentSessionOnce performs a single delete attempt.
-func (s *SQLiteStore) deleteAgentSessionOnce(ctx context.Context, userID string) error {
+func (s *SQLiteStore) deleteAgentSessionOnce(ctx context.Context, query string, args ...any) error {
 	s.agentSessionMu.Lock()
 	defer s.agentSessionMu.Unlock()
 
-	query := `DELETE FROM agent_sessions WHERE user_id = ?`
-	_, err := s.db.ExecContext(ctx, query, userID)
-	if err != nil {
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
 		return fmt.Errorf("delete agent session: %w", err)
 	}
 	return nil
 }
 
-// CleanupExpiredSessions removes sessions older than TTL.
+// CleanupExpiredSessions archives sessions older than TTL.
 func (s *SQLiteStore) CleanupExpiredSessions(ctx context.Context, ttl time.Duration) (int64, error) {
-	threshold := time.Now().Add(-ttl).Unix()
-	query := `DELETE FROM agent_sessions WHERE updated_at < ?`
-	result, err := s.db.ExecContext(ctx, query, threshold)
+	now := time.Now()
+	threshold := now.Add(-ttl).Unix()
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM stream_event_ids WHERE updated_at < ?`, threshold); err != nil {
+		return 0, fmt.Errorf("cleanup stream event ids: %w", err)
+	}
+
+	s.agentSessionMu.Lock()
+	defer s.agentSessionMu.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin session archive: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO agent_sessions_archive (`+archiveColumns+`, archived_at)
+		SELECT `+archiveColumns+`, ? FROM agent_sessions WHERE updated_at < ?`,
+		now.Unix(), threshold); err != nil {
+		return 0, fmt.Errorf("archive expired sessions: %w", err)
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM agent_sessions WHERE updated_at < ?`, threshold)
 	if err != nil {
 		return 0, fmt.Errorf("cleanup expired sessions: %w", err)
 	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit session archive: %w", err)
+	}
 	return result.RowsAffected()
 }
 
+// ReserveEventIDs advances a tab session's SSE event ID high-water mark.
+func (s *SQLiteStore) ReserveEventIDs(ctx context.Context, userID, sessionID string, n int64) (int64, error) {
+	query := `
+		INSERT INTO stream_event_ids (user_id, session_id, high_water, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id, session_id) DO UPDATE SET
+			high_water = stream_event_ids.high_water + excluded.high_water,
+			updated_at = excluded.updated_at
+		RETURNING high_water`
+
+	var mark int64
+	if err := s.db.QueryRowContext(ctx, query, userID, sessionID, n, time.Now().Unix()).Scan(&mark); err != nil {
+		return 0, fmt.Errorf("reserve event ids: %w", err)
+	}
+	return mark, nil
+}
+
+// CreateNotification stores a notification and trims the user's oldest ones.
+func (s *SQLiteStore) CreateNotification(ctx context.Context, n *domain.Notification) error {
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = time.Now()
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO notifications (user_id, kind, title, body, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		n.UserID, string(n.Kind), n.Title, n.Body, n.CreatedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("insert notification: %w", err)
+	}
+	if n.ID, err = res.LastInsertId(); err != nil {
+		return fmt.Errorf("notification id: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		DELETE FROM notifications
+		WHERE user_id = ? AND id NOT IN (
+			SELECT id FROM notifications WHERE user_id = ? ORDER BY id DESC LIMIT ?
+		)`, n.UserID, n.UserID, maxNotificationsPerUser)
+	if err != nil {
+		return fmt.Errorf("trim notifications: %w", err)
+	}
+	return nil
+}
+
+// ListNotifications returns a user's notifications, newest first.
+func (s *SQLiteStore) ListNotifications(ctx context.Context, userID string, unreadOnly bool, limit int) ([]*domain.Notification, error) {
+	query := `
+		SELECT id, user_id, kind, title, body, created_at, read_at
+		FROM notifications WHERE user_id = ?`
+	if unreadOnly {
+		query += ` AND read_at IS NULL`
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+
+	rows, err := s.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query notifications: %w", err)
+	}
+	return scanNotifications(rows)
+}
+
+// scanNotifications reads notification rows selected as (id, user_id, kind,
+// title, body, created_at, read_at) and closes rows.
+func scanNotifications(rows *sql.Rows) ([]*domain.Notification, error) {
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			slog.Warn("failed to close rows", "query", "notifications", "error", closeErr)
+		}
+	}()
+
+	var notifications []*domain.Notification
+	for rows.Next() {
+		var n domain.Notification
+		var kind string
+		var createdAt int64
+		var readAt sql.NullInt64
+		if err := rows.Scan(&n.ID, &n.UserID, &kind, &n.Title, &n.Body, &createdAt, &readAt); err != nil {
+			return nil, fmt.Errorf("scan notification: %w", err)
+		}
+		n.Kind = domain.NotificationKind(kind)
+		n.CreatedAt = time.Unix(createdAt, 0)
+		if readAt.Valid {
+			ts := time.Unix(readAt.Int64, 0)
+			n.ReadAt = &ts
+		}
+		notifications = append(notifications, &n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate notifications: %w", err)
+	}
+	return notifications, nil
+}
+
+// MarkNotificationsRead marks notifications read; empty ids marks all of them.
+func (s *SQLiteStore) MarkNotificationsRead(ctx context.Context, userID string, ids []int64, readAt time.Time) (int64, error) {
+	query := `UPDATE notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL`
+	args := []interface{}{readAt.Unix(), userID}
+	if len(ids) > 0 {
+		query += ` AND id IN (?` + strings.Repeat(", ?", len(ids)-1) + `)`
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("mark notifications read: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// CountUnreadNotifications returns the number of unread notifications for a user.
+func (s *SQLiteStore) CountUnreadNotifications(ctx context.Context, userID string) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count unread notifications: %w", err)
+	}
+	return count, nil
+}
+
+// EnqueueProvision adds a user to the provisioning wait queue.
+func (s *SQLiteStore) EnqueueProvision(ctx context.Context, userID string, enqueuedAt time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT OR IGNORE INTO provision_queue (user_id, enqueued_at) VALUES (?, ?)`,
+		userID, enqueuedAt.UnixNano())
+	if err != nil {
+		return fmt.Errorf("enqueue provision: %w", err)
+	}
+	return nil
+}
+
+// DequeueProvision removes a user from the provisioning wait queue.
+func (s *SQLiteStore) DequeueProvision(ctx context.Context, userID string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM provision_queue WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("dequeue provision: %w", err)
+	}
+	return nil
+}
+
+// ListProvisionQueue returns queued user IDs, oldest first.
+func (s *SQLiteStore) ListProvisionQueue(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT user_id FROM provision_queue ORDER BY enqueued_at, rowid`)
+	if err != nil {
+		return nil, fmt.Errorf("query provision queue: %w", err)
+	}
+	return scanProvisionQueue(rows)
+}
+
+// scanProvisionQueue reads user_id rows and closes rows.
+func scanProvisionQueue(rows *sql.Rows) ([]string, error) {
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			slog.Warn("failed to close rows", "query", "provision_queue", "error", closeErr)
+		}
+	}()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("scan provision queue: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate provision queue: %w", err)
+	}
+	return userIDs, nil
+}
+
+// InsertCommand stores an executed command and trims the user's oldest ones.
+func (s *SQLiteStore) InsertCommand(ctx context.Context, c *domain.CommandRecord) error {
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO commands (user_id, session_id, sequence, command, pwd, exit_code, duration_ms, started_at, ended_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.UserID, c.SessionID, c.Sequence, c.Command, c.PWD, c.ExitCode,
+		c.Duration.Milliseconds(), c.StartedAt.UnixMilli(), c.EndedAt.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("insert command: %w", err)
+	}
+	if c.ID, err = res.LastInsertId(); err != nil {
+		return fmt.Errorf("command id: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		DELETE FROM commands
+		WHERE user_id = ? AND id NOT IN (
+			SELECT id FROM commands WHERE user_id = ? ORDER BY id DESC LIMIT ?
+		)`, c.UserID, c.UserID, maxCommandsPerUser)
+	if err != nil {
+		return fmt.Errorf("trim commands: %w", err)
+	}
+	return nil
+}
+
+// ListCommands returns a user's executed commands, newest first.
+func (s *SQLiteStore) ListCommands(ctx context.Context, userID, sessionID string, limit int) ([]*domain.CommandRecord, error) {
+	query := `
+		SELECT id, user_id, session_id, sequence, command, pwd, exit_code, duration_ms, started_at, ended_at
+		FROM commands WHERE user_id = ?`
+	args := []any{userID}
+	if sessionID != "" {
+		query += ` AND session_id = ?`
+		args = append(args, sessionID)
+	}
+	query += ` ORDER BY id DESC`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query commands: %w", err)
+	}
+	return scanCommands(rows)
+}
+
+// scanCommands reads command rows selected as (id, user_id, session_id,
+// sequence, command, pwd, exit_code, duration_ms, started_at, ended_at) and
+// closes rows.
+func scanCommands(rows *sql.Rows) ([]*domain.CommandRecord, error) {
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			slog.Warn("failed to close rows", "query", "commands", "error", closeErr)
+		}
+	}()
+
+	var commands []*domain.CommandRecord
+	for rows.Next() {
+		c := &domain.CommandRecord{}
+		var durationMs, startedAt, endedAt int64
+		if err := rows.Scan(&c.ID, &c.UserID, &c.SessionID, &c.Sequence, &c.Command, &c.PWD,
+			&c.ExitCode, &durationMs, &startedAt, &endedAt); err != nil {
+			return nil, fmt.Errorf("scan command: %w", err)
+		}
+		c.Duration = time.Duration(durationMs) * time.Millisecond
+		c.StartedAt = time.UnixMilli(startedAt)
+		c.EndedAt = time.UnixMilli(endedAt)
+		commands = append(commands, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate commands: %w", err)
+	}
+	return commands, nil
+}
+
 // DeleteLegacyLocalState removes pre-migration single-user local records.
 func (s *SQLiteStore) DeleteLegacyLocalState(ctx context.Context) (int64, int64, error) {
 	s.agentSessionMu.Lock()
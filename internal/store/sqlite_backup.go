@@ -0,0 +1,296 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+const (
+	// backupPagesPerStep is how many pages one backup step copies. Between
+	// steps the source database is unlocked, so writers are not held up for
+	// the whole snapshot.
+	backupPagesPerStep = 256
+	backupStepPause    = 10 * time.Millisecond
+
+	backupFilePrefix    = "playground-"
+	backupFileSuffix    = ".db"
+	backupTimeLayout    = "20060102T150405Z"
+	defaultBackupRetain = 7
+)
+
+// errNoBackup is returned by RestoreSQLite when a corrupt database has no
+// valid backup to restore from.
+var errNoBackup = errors.New("no valid backup found")
+
+// Backuper is implemented by repositories that can snapshot themselves to a
+// file.
+type Backuper interface {
+	// Backup writes a consistent copy of the database to path.
+	Backup(ctx context.Context, path string) error
+}
+
+// BackupOptions configures StartBackupWorker.
+type BackupOptions struct {
+	Dir      string        // Directory backups are written to
+	Interval time.Duration // Time between backups; <= 0 disables the worker
+	Retain   int           // Number of backups kept (default: 7)
+}
+
+// backupConn is the part of the modernc.org/sqlite driver connection that
+// exposes the online backup API.
+type backupConn interface {
+	NewBackup(dstURI string) (*sqlite.Backup, error)
+}
+
+var _ Backuper = (*SQLiteStore)(nil)
+
+// Backup writes a consistent snapshot of the live database to path using the
+// SQLite online backup API. The snapshot is written next to path and renamed
+// into place, so path never holds a partial copy.
+func (s *SQLiteStore) Backup(ctx context.Context, path string) error {
+	tmp := path + ".tmp"
+	_ = os.Remove(tmp)
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("get connection: %w", err)
+	}
+	defer conn.Close()
+
+	err = conn.Raw(func(dc any) error {
+		bc, ok := dc.(backupConn)
+		if !ok {
+			return fmt.Errorf("driver connection %T does not support backups", dc)
+		}
+		backup, err := bc.NewBackup(tmp)
+		if err != nil {
+			return fmt.Errorf("start backup: %w", err)
+		}
+		for {
+			more, err := backup.Step(backupPagesPerStep)
+			if err != nil {
+				_ = backup.Finish()
+				return fmt.Errorf("backup step: %w", err)
+			}
+			if !more {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				_ = backup.Finish()
+				return ctx.Err()
+			case <-time.After(backupStepPause):
+			}
+		}
+		if err := backup.Finish(); err != nil {
+			return fmt.Errorf("finish backup: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("rename backup: %w", err)
+	}
+	return nil
+}
+
+// StartBackupWorker runs a background goroutine that snapshots b into
+// opts.Dir every opts.Interval and prunes all but the newest opts.Retain
+// snapshots.
+func StartBackupWorker(ctx context.Context, b Backuper, opts BackupOptions) {
+	if opts.Interval <= 0 || opts.Dir == "" {
+		slog.Info("Database backups disabled")
+		return
+	}
+	if opts.Retain <= 0 {
+		opts.Retain = defaultBackupRetain
+	}
+
+	ticker := time.NewTicker(opts.Interval)
+	go func() {
+		defer ticker.Stop()
+		slog.Info("Database backup worker started", "dir", opts.Dir, "interval", opts.Interval, "retain", opts.Retain)
+
+		for {
+			select {
+			case <-ticker.C:
+				path, err := runBackup(ctx, b, opts)
+				if err != nil {
+					slog.Error("Database backup failed", "error", err)
+					continue
+				}
+				slog.Info("Database backup written", "path", path)
+			case <-ctx.Done():
+				slog.Info("Database backup worker stopped")
+				return
+			}
+		}
+	}()
+}
+
+// runBackup writes one timestamped snapshot and prunes old ones.
+func runBackup(ctx context.Context, b Backuper, opts BackupOptions) (string, error) {
+	if err := os.MkdirAll(opts.Dir, 0o750); err != nil {
+		return "", fmt.Errorf("create backup directory: %w", err)
+	}
+	name := backupFilePrefix + time.Now().UTC().Format(backupTimeLayout) + backupFileSuffix
+	path := filepath.Join(opts.Dir, name)
+	if err := b.Backup(ctx, path); err != nil {
+		return "", err
+	}
+
+	backups, err := listBackups(opts.Dir)
+	if err != nil {
+		return path, fmt.Errorf("list backups: %w", err)
+	}
+	for len(backups) > opts.Retain {
+		if err := os.Remove(backups[len(backups)-1]); err != nil {
+			slog.Warn("Failed to prune database backup", "path", backups[len(backups)-1], "error", err)
+		}
+		backups = backups[:len(backups)-1]
+	}
+	return path, nil
+}
+
+// listBackups returns the backups in dir, newest first. The timestamp in the
+// file name sorts lexically.
+func listBackups(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.Type().IsRegular() && strings.HasPrefix(name, backupFilePrefix) && strings.HasSuffix(name, backupFileSuffix) {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+	slices.Sort(paths)
+	slices.Reverse(paths)
+	return paths, nil
+}
+
+// checkSQLite runs a quick integrity check on the database file at path.
+func checkSQLite(path string) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(context.Background(), `PRAGMA quick_check`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return err
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("integrity check failed: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// RestoreSQLite checks the database at dbPath and, if it is corrupt, moves it
+// and its WAL files aside and replaces it with the newest backup in
+// backupDir that passes the same check. It returns the backup restored, or ""
+// if the database is missing or healthy.
+func RestoreSQLite(dbPath, backupDir string) (string, error) {
+	if _, err := os.Stat(dbPath); errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	checkErr := checkSQLite(dbPath)
+	if checkErr == nil {
+		return "", nil
+	}
+	slog.Error("Database is corrupt", "path", dbPath, "error", checkErr)
+
+	var candidates []string
+	if backupDir != "" {
+		backups, err := listBackups(backupDir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("list backups: %w", err)
+		}
+		candidates = backups
+	}
+	var source string
+	for _, path := range candidates {
+		if err := checkSQLite(path); err != nil {
+			slog.Warn("Skipping invalid database backup", "path", path, "error", err)
+			continue
+		}
+		source = path
+		break
+	}
+	if source == "" {
+		return "", fmt.Errorf("restore %s: %w", dbPath, errNoBackup)
+	}
+
+	suffix := ".corrupt-" + time.Now().UTC().Format(backupTimeLayout)
+	for _, ext := range []string{"", "-wal", "-shm"} {
+		if err := os.Rename(dbPath+ext, dbPath+ext+suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("move corrupt database aside: %w", err)
+		}
+	}
+	if err := copyFile(source, dbPath); err != nil {
+		return "", fmt.Errorf("restore %s: %w", source, err)
+	}
+	return source, nil
+}
+
+// copyFile copies src to dst through a temporary file renamed into place.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		_ = out.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
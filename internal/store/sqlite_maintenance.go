@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Maintainer is implemented by repositories that need periodic upkeep.
+type Maintainer interface {
+	// Maintain checkpoints the write-ahead log and compacts the database.
+	Maintain(ctx context.Context) error
+}
+
+// MaintenanceOptions configures StartMaintenanceWorker.
+type MaintenanceOptions struct {
+	Interval time.Duration // Time between runs; <= 0 disables the worker
+	// WindowStart and WindowEnd bound the local time of day a run may
+	// start, as offsets from midnight. WindowEnd before WindowStart wraps
+	// past midnight; equal bounds allow any time.
+	WindowStart time.Duration
+	WindowEnd   time.Duration
+}
+
+var _ Maintainer = (*SQLiteStore)(nil)
+
+// Maintain moves the WAL into the database and truncates it, then rebuilds
+// the database with VACUUM to return the pages freed by deletes and trims.
+// VACUUM blocks writers until it finishes, so it should run when traffic is
+// low.
+func (s *SQLiteStore) Maintain(ctx context.Context) error {
+	if err := s.checkpoint(ctx); err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, `VACUUM`); err != nil {
+		return fmt.Errorf("vacuum: %w", err)
+	}
+	// VACUUM writes the rebuilt database through the WAL.
+	return s.checkpoint(ctx)
+}
+
+// checkpoint runs a truncating WAL checkpoint. Readers still using old
+// snapshots can keep it from completing; the WAL is then left for the next
+// run.
+func (s *SQLiteStore) checkpoint(ctx context.Context) error {
+	var busy, walPages, checkpointed int
+	if err := s.db.QueryRowContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`).Scan(&busy, &walPages, &checkpointed); err != nil {
+		return fmt.Errorf("checkpoint wal: %w", err)
+	}
+	if busy != 0 {
+		slog.Warn("WAL checkpoint did not complete", "wal_pages", walPages, "checkpointed_pages", checkpointed)
+	}
+	return nil
+}
+
+// StartMaintenanceWorker runs a background goroutine that calls m.Maintain
+// every opts.Interval, holding each run back until the maintenance window
+// opens.
+func StartMaintenanceWorker(ctx context.Context, m Maintainer, opts MaintenanceOptions) {
+	if opts.Interval <= 0 {
+		slog.Info("Database maintenance disabled")
+		return
+	}
+
+	go func() {
+		slog.Info("Database maintenance worker started", "interval", opts.Interval,
+			"window_start", opts.WindowStart, "window_end", opts.WindowEnd)
+
+		// Runs are scheduled from the previous schedule rather than from when
+		// a run finished, so they do not drift out of the window.
+		next := nextMaintenance(time.Now().Add(opts.Interval), opts)
+		for {
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				slog.Info("Database maintenance worker stopped")
+				return
+			case <-timer.C:
+			}
+
+			start := time.Now()
+			if err := m.Maintain(ctx); err != nil {
+				slog.Error("Database maintenance failed", "error", err)
+			} else {
+				slog.Info("Database maintenance finished", "duration", time.Since(start))
+			}
+			next = nextMaintenance(next.Add(opts.Interval), opts)
+			if now := time.Now(); next.Before(now) {
+				next = nextMaintenance(now.Add(opts.Interval), opts)
+			}
+		}
+	}()
+}
+
+// nextMaintenance returns t if it falls in the maintenance window, and
+// otherwise when the window next opens.
+func nextMaintenance(t time.Time, opts MaintenanceOptions) time.Time {
+	if opts.WindowStart == opts.WindowEnd {
+		return t
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+	inWindow := offset >= opts.WindowStart && offset < opts.WindowEnd
+	if opts.WindowEnd < opts.WindowStart {
+		inWindow = offset >= opts.WindowStart || offset < opts.WindowEnd
+	}
+	switch {
+	case inWindow:
+		return t
+	case offset < opts.WindowStart:
+		return midnight.Add(opts.WindowStart)
+	default:
+		return midnight.AddDate(0, 0, 1).Add(opts.WindowStart)
+	}
+}
@@ -0,0 +1,383 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// sqliteMigrations is the SQLite schema history. Append new migrations with
+// the next version; never edit one that has shipped. Versions match
+// postgresMigrations.
+var sqliteMigrations = []migration{
+	{
+		version: 1,
+		name:    "create users and agent sessions",
+		// Databases created before versioning already have these tables.
+		up: execMigration(`
+		CREATE TABLE IF NOT EXISTS users (
+			user_id TEXT PRIMARY KEY,
+			username TEXT NOT NULL,
+			container_id TEXT,
+			last_seen_at INTEGER NOT NULL,
+			volume_path TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_last_seen ON users(last_seen_at) WHERE container_id IS NOT NULL;
+
+		CREATE TABLE IF NOT EXISTS agent_sessions (
+			user_id TEXT PRIMARY KEY,
+			last_proactive_msg INTEGER,
+			attempt_count INTEGER DEFAULT 0,
+			just_self_corrected INTEGER DEFAULT 0,
+			is_typing INTEGER DEFAULT 0,
+			challenge_json TEXT,
+			messages_json TEXT,
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_agent_sessions_updated ON agent_sessions(updated_at);`),
+		down: execMigration(`
+		DROP TABLE IF EXISTS agent_sessions;
+		DROP TABLE IF EXISTS users;`),
+	},
+	{
+		version: 2,
+		name:    "add users.instance_id",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return sqliteAddColumnIfMissing(ctx, tx, "users", "instance_id", "TEXT")
+		},
+		down: execMigration(`ALTER TABLE users DROP COLUMN instance_id`),
+	},
+	{
+		version: 3,
+		name:    "create notifications",
+		up: execMigration(`
+		CREATE TABLE IF NOT EXISTS notifications (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			title TEXT NOT NULL DEFAULT '',
+			body TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			read_at INTEGER
+		);
+		CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, id);`),
+		down: execMigration(`DROP TABLE IF EXISTS notifications`),
+	},
+	{
+		version: 4,
+		name:    "create provision queue",
+		up: execMigration(`
+		CREATE TABLE IF NOT EXISTS provision_queue (
+			user_id TEXT PRIMARY KEY,
+			enqueued_at INTEGER NOT NULL
+		);`),
+		down: execMigration(`DROP TABLE IF EXISTS provision_queue`),
+	},
+	{
+		version: 5,
+		name:    "create stream event ids",
+		up: execMigration(`
+		CREATE TABLE stream_event_ids (
+			user_id TEXT NOT NULL,
+			session_id TEXT NOT NULL,
+			high_water INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL,
+			PRIMARY KEY (user_id, session_id)
+		);
+		CREATE INDEX idx_stream_event_ids_updated ON stream_event_ids(updated_at);`),
+		down: execMigration(`DROP TABLE stream_event_ids`),
+	},
+	{
+		version: 6,
+		name:    "create commands",
+		up: execMigration(`
+		CREATE TABLE commands (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL,
+			session_id TEXT NOT NULL,
+			sequence INTEGER NOT NULL,
+			command TEXT NOT NULL,
+			pwd TEXT NOT NULL DEFAULT '',
+			exit_code INTEGER NOT NULL,
+			duration_ms INTEGER NOT NULL,
+			started_at INTEGER NOT NULL,
+			ended_at INTEGER NOT NULL
+		);
+		CREATE INDEX idx_commands_user ON commands(user_id, id);`),
+		down: execMigration(`DROP TABLE commands`),
+	},
+	{
+		version: 7,
+		name:    "add users.keep_warm_until",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			return sqliteAddColumnIfMissing(ctx, tx, "users", "keep_warm_until", "INTEGER")
+		},
+		down: execMigration(`ALTER TABLE users DROP COLUMN keep_warm_until`),
+	},
+	{
+		version: 8,
+		name:    "create agent sessions archive",
+		up: execMigration(`
+		CREATE TABLE agent_sessions_archive (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL,
+			last_proactive_msg INTEGER,
+			attempt_count INTEGER DEFAULT 0,
+			just_self_corrected INTEGER DEFAULT 0,
+			challenge_json TEXT,
+			messages_json TEXT,
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL,
+			archived_at INTEGER NOT NULL
+		);
+		CREATE INDEX idx_agent_sessions_archive_user ON agent_sessions_archive(user_id, id);
+		CREATE INDEX idx_agent_sessions_archive_archived ON agent_sessions_archive(archived_at);`),
+		down: execMigration(`DROP TABLE agent_sessions_archive`),
+	},
+	{
+		version: 9,
+		name:    "create command stats",
+		up: execMigration(`
+		CREATE TABLE command_stats_daily (
+			user_id TEXT NOT NULL,
+			day TEXT NOT NULL,
+			commands INTEGER NOT NULL DEFAULT 0,
+			errors INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (user_id, day)
+		);
+		CREATE TABLE command_tools_daily (
+			user_id TEXT NOT NULL,
+			day TEXT NOT NULL,
+			tool TEXT NOT NULL,
+			PRIMARY KEY (user_id, day, tool)
+		);
+		CREATE TABLE analytics_watermarks (
+			name TEXT PRIMARY KEY,
+			last_id INTEGER NOT NULL
+		);`),
+		down: execMigration(`
+		DROP TABLE analytics_watermarks;
+		DROP TABLE command_tools_daily;
+		DROP TABLE command_stats_daily;`),
+	},
+	{
+		version: 10,
+		name:    "create challenge checkpoints",
+		up: execMigration(`
+		CREATE TABLE challenge_checkpoints (
+			user_id TEXT NOT NULL,
+			challenge_id TEXT NOT NULL,
+			step INTEGER NOT NULL,
+			snapshot TEXT NOT NULL,
+			diff_json TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			PRIMARY KEY (user_id, challenge_id, step)
+		);`),
+		down: execMigration(`DROP TABLE challenge_checkpoints`),
+	},
+	{
+		// Sessions stored before keep an empty session_id.
+		version: 11,
+		name:    "key agent sessions by tab session",
+		up: execMigration(`
+		CREATE TABLE agent_sessions_new (
+			user_id TEXT NOT NULL,
+			session_id TEXT NOT NULL DEFAULT '',
+			last_proactive_msg INTEGER,
+			attempt_count INTEGER DEFAULT 0,
+			just_self_corrected INTEGER DEFAULT 0,
+			is_typing INTEGER DEFAULT 0,
+			challenge_json TEXT,
+			messages_json TEXT,
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL,
+			PRIMARY KEY (user_id, session_id)
+		);
+		INSERT INTO agent_sessions_new (user_id, last_proactive_msg, attempt_count, just_self_corrected,
+			is_typing, challenge_json, messages_json, created_at, updated_at)
+		SELECT user_id, last_proactive_msg, attempt_count, just_self_corrected,
+			is_typing, challenge_json, messages_json, created_at, updated_at
+		FROM agent_sessions;
+		DROP TABLE agent_sessions;
+		ALTER TABLE agent_sessions_new RENAME TO agent_sessions;
+		CREATE INDEX idx_agent_sessions_updated ON agent_sessions(updated_at);
+		ALTER TABLE agent_sessions_archive ADD COLUMN session_id TEXT NOT NULL DEFAULT '';`),
+		// Only the most recently updated session of each user survives.
+		down: execMigration(`
+		CREATE TABLE agent_sessions_old (
+			user_id TEXT PRIMARY KEY,
+			last_proactive_msg INTEGER,
+			attempt_count INTEGER DEFAULT 0,
+			just_self_corrected INTEGER DEFAULT 0,
+			is_typing INTEGER DEFAULT 0,
+			challenge_json TEXT,
+			messages_json TEXT,
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL
+		);
+		INSERT OR REPLACE INTO agent_sessions_old (user_id, last_proactive_msg, attempt_count, just_self_corrected,
+			is_typing, challenge_json, messages_json, created_at, updated_at)
+		SELECT user_id, last_proactive_msg, attempt_count, just_self_corrected,
+			is_typing, challenge_json, messages_json, created_at, updated_at
+		FROM agent_sessions ORDER BY updated_at, session_id;
+		DROP TABLE agent_sessions;
+		ALTER TABLE agent_sessions_old RENAME TO agent_sessions;
+		CREATE INDEX idx_agent_sessions_updated ON agent_sessions(updated_at);
+		ALTER TABLE agent_sessions_archive DROP COLUMN session_id;`),
+	},
+	{
+		version: 12,
+		name:    "create session shares",
+		up: execMigration(`
+		CREATE TABLE session_shares (
+			token TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			session_id TEXT NOT NULL,
+			transcript_json TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			expires_at INTEGER NOT NULL
+		);
+		CREATE INDEX idx_session_shares_user ON session_shares(user_id);
+		CREATE INDEX idx_session_shares_expires ON session_shares(expires_at);`),
+		down: execMigration(`DROP TABLE session_shares`),
+	},
+	{
+		version: 13,
+		name:    "create intervention outcomes",
+		up: execMigration(`
+		CREATE TABLE intervention_outcomes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL,
+			session_id TEXT NOT NULL,
+			response_type TEXT NOT NULL,
+			pattern TEXT NOT NULL DEFAULT '',
+			outcome TEXT NOT NULL,
+			hinted_at INTEGER NOT NULL,
+			resolved_at INTEGER NOT NULL
+		);
+		CREATE INDEX idx_intervention_outcomes_user ON intervention_outcomes(user_id);
+		CREATE INDEX idx_intervention_outcomes_hinted ON intervention_outcomes(hinted_at);`),
+		down: execMigration(`DROP TABLE intervention_outcomes`),
+	},
+	{
+		version: 14,
+		name:    "add agent_sessions.version",
+		up:      execMigration(`ALTER TABLE agent_sessions ADD COLUMN version INTEGER NOT NULL DEFAULT 0`),
+		down:    execMigration(`ALTER TABLE agent_sessions DROP COLUMN version`),
+	},
+	{
+		version: 15,
+		name:    "create challenge progress",
+		up: execMigration(`
+		CREATE TABLE challenge_assignments (
+			user_id TEXT NOT NULL,
+			challenge_id TEXT NOT NULL,
+			challenge_json TEXT NOT NULL,
+			hints_used INTEGER NOT NULL DEFAULT 0,
+			assigned_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL,
+			PRIMARY KEY (user_id, challenge_id)
+		);
+		CREATE TABLE challenge_attempts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL,
+			challenge_id TEXT NOT NULL,
+			step INTEGER NOT NULL,
+			passed INTEGER NOT NULL,
+			attempted_at INTEGER NOT NULL
+		);
+		CREATE INDEX idx_challenge_attempts_user ON challenge_attempts(user_id, challenge_id, id);
+		CREATE TABLE challenge_completions (
+			user_id TEXT NOT NULL,
+			challenge_id TEXT NOT NULL,
+			attempts INTEGER NOT NULL,
+			hints_used INTEGER NOT NULL,
+			completed_at INTEGER NOT NULL,
+			PRIMARY KEY (user_id, challenge_id)
+		);`),
+		down: execMigration(`
+		DROP TABLE challenge_completions;
+		DROP TABLE challenge_attempts;
+		DROP TABLE challenge_assignments;`),
+	},
+	{
+		version: 16,
+		name:    "create container events",
+		up: execMigration(`
+		CREATE TABLE container_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id TEXT NOT NULL,
+			container_id TEXT NOT NULL,
+			event TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL
+		);
+		CREATE INDEX idx_container_events_user ON container_events(user_id, id);
+		CREATE INDEX idx_container_events_created ON container_events(created_at);`),
+		down: execMigration(`DROP TABLE container_events;`),
+	},
+	{
+		version: 17,
+		name:    "add users.resource_tier",
+		up:      execMigration(`ALTER TABLE users ADD COLUMN resource_tier TEXT`),
+		down:    execMigration(`ALTER TABLE users DROP COLUMN resource_tier`),
+	},
+	{
+		version: 18,
+		name:    "create snippets",
+		up: execMigration(`
+		CREATE TABLE snippets (
+			user_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			body TEXT NOT NULL,
+			updated_at INTEGER NOT NULL,
+			PRIMARY KEY (user_id, name)
+		);`),
+		down: execMigration(`DROP TABLE snippets;`),
+	},
+	{
+		version: 19,
+		name:    "add users.classroom",
+		up:      execMigration(`ALTER TABLE users ADD COLUMN classroom TEXT`),
+		down:    execMigration(`ALTER TABLE users DROP COLUMN classroom`),
+	},
+}
+
+// sqliteAddColumnIfMissing adds a column unless a database created before
+// versioning already has it.
+func sqliteAddColumnIfMissing(ctx context.Context, tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("inspect %s schema: %w", table, err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			slog.Warn("failed to close rows", "query", "table_info", "error", closeErr)
+		}
+	}()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("scan %s schema: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate %s schema: %w", table, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("add %s.%s column: %w", table, column, err)
+	}
+	return nil
+}
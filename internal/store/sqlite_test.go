@@ -0,0 +1,20 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func newTestSQLite(t *testing.T) Repository {
+	t.Helper()
+	repo, err := NewSQLite(filepath.Join(t.TempDir(), "shsh.db"))
+	if err != nil {
+		t.Fatalf("NewSQLite: %v", err)
+	}
+	t.Cleanup(func() { _ = repo.Close() })
+	return repo
+}
+
+func TestSQLiteRepository(t *testing.T) {
+	testRepository(t, newTestSQLite(t))
+}
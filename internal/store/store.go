@@ -24,27 +24,214 @@ type Repository interface {
 	// container_id matches expectedID (optimistic locking).
 	UpdateContainerID(ctx context.Context, userID string, containerID string, expectedID string) error
 
+	// UpdateInstanceID records which server instance holds the user's terminal
+	// session; an empty instanceID clears it.
+	UpdateInstanceID(ctx context.Context, userID string, instanceID string) error
+
 	// GetExpiredSessions retrieves users whose containers have exceeded the inactivity TTL.
 	GetExpiredSessions(ctx context.Context, ttl time.Duration) ([]*domain.User, error)
 
+	// GetActiveContainers retrieves users that currently have a container assigned.
+	GetActiveContainers(ctx context.Context) ([]*domain.User, error)
+
+	// SetKeepWarm exempts a user from TTL cleanup and rate limits until the
+	// given time; a zero time clears the exemption.
+	SetKeepWarm(ctx context.Context, userID string, until time.Time) error
+
+	// SetResourceTier assigns a user's containers a named resource tier; an
+	// empty tier clears the assignment.
+	SetResourceTier(ctx context.Context, userID, tier string) error
+
+	// SetClassroom assigns a user to a classroom, whose banner, input
+	// filter, quiet hours, curriculum and broadcasts they get; an empty
+	// classroom removes them from theirs.
+	SetClassroom(ctx context.Context, userID, classroom string) error
+
+	// ListKeptWarmUsers returns users whose keep-warm exemption is still in
+	// effect at now, soonest to end first.
+	ListKeptWarmUsers(ctx context.Context, now time.Time) ([]*domain.User, error)
+
 	// Ping verifies database connectivity and returns an error if the database is unreachable.
 	Ping(ctx context.Context) error
 
+	// HealthDetails reports database pressure, such as WAL size, lock
+	// contention and row counts, for the health endpoint.
+	HealthDetails(ctx context.Context) (*HealthDetails, error)
+
 	// Close closes the database connection.
 	Close() error
 
-	// GetAgentSession retrieves agent session state for a user.
-	GetAgentSession(ctx context.Context, userID string) (*domain.AgentSession, error)
+	// GetAgentSession retrieves the agent session state of one of a user's
+	// tab sessions, or nil if there is none.
+	GetAgentSession(ctx context.Context, userID, sessionID string) (*domain.AgentSession, error)
+
+	// ListAgentSessions returns every agent session of a user, most recently
+	// updated first.
+	ListAgentSessions(ctx context.Context, userID string) ([]*domain.AgentSession, error)
 
-	// UpsertAgentSession creates or updates agent session state.
+	// UpsertAgentSession creates or updates the agent session state keyed by
+	// session.UserID and session.SessionID. It compares and swaps on
+	// session.Version: a session read at version N is written only if still
+	// at N, and one with version 0 only if none is stored, otherwise it
+	// returns ErrVersionConflict. On success session.Version is advanced.
 	UpsertAgentSession(ctx context.Context, session *domain.AgentSession) error
 
-	// DeleteAgentSession removes agent session state.
-	DeleteAgentSession(ctx context.Context, userID string) error
+	// DeleteAgentSession removes the agent session state of one tab session.
+	DeleteAgentSession(ctx context.Context, userID, sessionID string) error
+
+	// DeleteAgentSessions removes every agent session of a user.
+	DeleteAgentSessions(ctx context.Context, userID string) error
 
-	// CleanupExpiredSessions removes sessions older than TTL.
+	// CleanupExpiredSessions moves agent sessions older than TTL to the
+	// session archive, removes idle event ID marks, and returns how many
+	// agent sessions were archived.
 	CleanupExpiredSessions(ctx context.Context, ttl time.Duration) (int64, error)
 
+	// ListArchivedSessions returns a user's archived agent sessions, newest
+	// first.
+	ListArchivedSessions(ctx context.Context, userID string) ([]*domain.ArchivedAgentSession, error)
+
+	// PruneArchivedSessions deletes sessions archived longer than retention
+	// ago and returns how many were deleted.
+	PruneArchivedSessions(ctx context.Context, retention time.Duration) (int64, error)
+
+	// CreateNotification stores a notification for n.UserID and sets n.ID.
+	// Only the newest notifications per user are kept.
+	CreateNotification(ctx context.Context, n *domain.Notification) error
+
+	// ListNotifications returns a user's notifications, newest first.
+	ListNotifications(ctx context.Context, userID string, unreadOnly bool, limit int) ([]*domain.Notification, error)
+
+	// MarkNotificationsRead marks the given notifications read, or all of the
+	// user's notifications when ids is empty, and returns how many changed.
+	MarkNotificationsRead(ctx context.Context, userID string, ids []int64, readAt time.Time) (int64, error)
+
+	// CountUnreadNotifications returns the number of unread notifications for a user.
+	CountUnreadNotifications(ctx context.Context, userID string) (int, error)
+
+	// EnqueueProvision adds a user to the provisioning wait queue. A user
+	// already queued keeps their original position.
+	EnqueueProvision(ctx context.Context, userID string, enqueuedAt time.Time) error
+
+	// DequeueProvision removes a user from the provisioning wait queue.
+	DequeueProvision(ctx context.Context, userID string) error
+
+	// ListProvisionQueue returns queued user IDs, oldest first.
+	ListProvisionQueue(ctx context.Context) ([]string, error)
+
+	// ReserveEventIDs advances the SSE event ID high-water mark of a tab
+	// session by n and returns the new mark; the caller owns the IDs in
+	// (mark-n, mark]. Marks are removed by CleanupExpiredSessions once idle.
+	ReserveEventIDs(ctx context.Context, userID, sessionID string, n int64) (int64, error)
+
+	// InsertCommand stores an executed command and sets c.ID. Only the newest
+	// commands per user are kept.
+	InsertCommand(ctx context.Context, c *domain.CommandRecord) error
+
+	// ListCommands returns a user's commands, newest first, limited to one tab
+	// session unless sessionID is empty. A limit <= 0 returns every kept command.
+	ListCommands(ctx context.Context, userID, sessionID string, limit int) ([]*domain.CommandRecord, error)
+
+	// AggregateCommandStats folds commands inserted since the previous call
+	// into daily per-user stats and returns how many were folded. It is run
+	// by StartAnalyticsWorker.
+	AggregateCommandStats(ctx context.Context) (int64, error)
+
+	// ListDailyCommandStats returns a user's daily command stats for days
+	// from since onwards, oldest first. Days without commands are omitted.
+	ListDailyCommandStats(ctx context.Context, userID string, since time.Time) ([]*domain.DailyCommandStats, error)
+
+	// InsertIntervention stores the outcome of a proactive hint.
+	InsertIntervention(ctx context.Context, i *domain.Intervention) error
+
+	// ListInterventionStats returns the outcomes of hints given from since
+	// onwards, grouped by response type and pattern, most frequent first.
+	ListInterventionStats(ctx context.Context, since time.Time) ([]*domain.InterventionStats, error)
+
+	// UpsertChallengeCheckpoint stores the checkpoint taken when a user
+	// completed a challenge step, replacing an earlier one for that step.
+	UpsertChallengeCheckpoint(ctx context.Context, c *domain.ChallengeCheckpoint) error
+
+	// ListChallengeCheckpoints returns a user's checkpoints for a challenge,
+	// ordered by step.
+	ListChallengeCheckpoints(ctx context.Context, userID, challengeID string) ([]*domain.ChallengeCheckpoint, error)
+
+	// UpsertChallengeAssignment stores a user's state in a challenge they
+	// started, keeping the time it was first assigned.
+	UpsertChallengeAssignment(ctx context.Context, a *domain.ChallengeAssignment) error
+
+	// ListChallengeAssignments returns the challenges a user has started,
+	// most recently updated first.
+	ListChallengeAssignments(ctx context.Context, userID string) ([]*domain.ChallengeAssignment, error)
+
+	// InsertChallengeAttempt stores an attempt at a challenge step and sets
+	// a.ID.
+	InsertChallengeAttempt(ctx context.Context, a *domain.ChallengeAttempt) error
+
+	// ListChallengeAttempts returns a user's attempts at a challenge, oldest
+	// first.
+	ListChallengeAttempts(ctx context.Context, userID, challengeID string) ([]*domain.ChallengeAttempt, error)
+
+	// CompleteChallenge records that a user completed a challenge and
+	// reports whether this was the first time; later completions are not
+	// stored.
+	CompleteChallenge(ctx context.Context, c *domain.ChallengeCompletion) (bool, error)
+
+	// ListChallengeCompletions returns the challenges a user has completed,
+	// most recent first.
+	ListChallengeCompletions(ctx context.Context, userID string) ([]*domain.ChallengeCompletion, error)
+
+	// InsertContainerEvent appends a container lifecycle event to a user's
+	// audit log and sets e.ID.
+	InsertContainerEvent(ctx context.Context, e *domain.ContainerEvent) error
+
+	// ListContainerEvents returns up to limit of a user's container events,
+	// newest first.
+	ListContainerEvents(ctx context.Context, userID string, limit int) ([]*domain.ContainerEvent, error)
+
+	// PruneContainerEvents deletes container events older than retention and
+	// returns how many were deleted.
+	PruneContainerEvents(ctx context.Context, retention time.Duration) (int64, error)
+
+	// CreateSessionShare stores a public share link to a session transcript.
+	CreateSessionShare(ctx context.Context, share *domain.SessionShare) error
+
+	// GetSessionShare returns the share link with the given token, or nil if
+	// there is none or it has expired.
+	GetSessionShare(ctx context.Context, token string) (*domain.SessionShare, error)
+
+	// ListSessionShares returns a user's unexpired share links, newest first.
+	ListSessionShares(ctx context.Context, userID string) ([]*domain.SessionShare, error)
+
+	// DeleteSessionShare revokes one of a user's share links and reports
+	// whether it existed.
+	DeleteSessionShare(ctx context.Context, userID, token string) (bool, error)
+
+	// PruneExpiredSessionShares deletes expired share links and returns how
+	// many were deleted.
+	PruneExpiredSessionShares(ctx context.Context) (int64, error)
+
+	// UpsertSnippet creates or replaces one of a user's snippets by name.
+	UpsertSnippet(ctx context.Context, snippet *domain.Snippet) error
+
+	// ListSnippets returns a user's snippets sorted by name.
+	ListSnippets(ctx context.Context, userID string) ([]*domain.Snippet, error)
+
+	// DeleteSnippet removes one of a user's snippets and reports whether it
+	// existed.
+	DeleteSnippet(ctx context.Context, userID, name string) (bool, error)
+
+	// ExportUserData returns the user record, agent sessions and command
+	// history of a user as one bundle, or nil if the user does not exist.
+	ExportUserData(ctx context.Context, userID string) (*domain.UserDataExport, error)
+
+	// PurgeUser deletes the user record, agent session, archived sessions,
+	// command history and stats, challenge progress and checkpoints,
+	// container events, share links, snippets, notifications and queue entry
+	// of a user.
+	// Purging an unknown user is not an error.
+	PurgeUser(ctx context.Context, userID string) error
+
 	// DeleteLegacyLocalState removes legacy single-user records.
 	DeleteLegacyLocalState(ctx context.Context) (usersDeleted int64, agentSessionsDeleted int64, err error)
 }
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+)
+
+// testRepository exercises the parts of Repository every backend must agree
+// on, against an empty repo.
+func testRepository(t *testing.T, repo Repository) {
+	t.Helper()
+	ctx := t.Context()
+
+	if user, err := repo.GetUser(ctx, "alice"); err != nil || user != nil {
+		t.Fatalf("GetUser of a missing user = %+v, %v; want nil, nil", user, err)
+	}
+	seen := time.Unix(1_700_000_000, 0)
+	if err := repo.UpsertUser(ctx, &domain.User{UserID: "alice", Username: "alice", VolumePath: "/data/alice", LastSeenAt: seen}); err != nil {
+		t.Fatalf("UpsertUser: %v", err)
+	}
+	user, err := repo.GetUser(ctx, "alice")
+	if err != nil || user == nil {
+		t.Fatalf("GetUser: %+v, %v", user, err)
+	}
+	if user.Username != "alice" || user.VolumePath != "/data/alice" || !user.LastSeenAt.Equal(seen) {
+		t.Fatalf("GetUser = %+v", user)
+	}
+
+	// Container IDs change only from the one the caller expects.
+	if err := repo.UpdateContainerID(ctx, "alice", "c1", ""); err != nil {
+		t.Fatalf("UpdateContainerID: %v", err)
+	}
+	if err := repo.UpdateContainerID(ctx, "alice", "c2", "other"); !errors.Is(err, errOptimisticLockContainerID) {
+		t.Fatalf("UpdateContainerID from the wrong container = %v, want errOptimisticLockContainerID", err)
+	}
+	if user, _ := repo.GetUser(ctx, "alice"); user.ContainerID != "c1" {
+		t.Fatalf("container = %q, want c1", user.ContainerID)
+	}
+	if active, err := repo.GetActiveContainers(ctx); err != nil || len(active) != 1 || active[0].UserID != "alice" {
+		t.Fatalf("GetActiveContainers = %+v, %v", active, err)
+	}
+
+	if err := repo.SetClassroom(ctx, "alice", "period-3"); err != nil {
+		t.Fatalf("SetClassroom: %v", err)
+	}
+	if user, _ := repo.GetUser(ctx, "alice"); user.Classroom != "period-3" {
+		t.Fatalf("classroom = %q, want period-3", user.Classroom)
+	}
+	if err := repo.SetClassroom(ctx, "alice", ""); err != nil {
+		t.Fatalf("SetClassroom to clear: %v", err)
+	}
+	if user, _ := repo.GetUser(ctx, "alice"); user.Classroom != "" {
+		t.Fatalf("classroom = %q after clearing", user.Classroom)
+	}
+	if err := repo.SetClassroom(ctx, "bob", "period-3"); !errors.Is(err, errUserNotFound) {
+		t.Fatalf("SetClassroom of a missing user = %v, want errUserNotFound", err)
+	}
+
+	for i, command := range []string{"ls", "cd lab", "make"} {
+		started := seen.Add(time.Duration(i) * time.Second)
+		record := &domain.CommandRecord{UserID: "alice", SessionID: "tab-1", Sequence: i + 1, Command: command, PWD: "/home/learner", ExitCode: i, StartedAt: started, EndedAt: started}
+		if err := repo.InsertCommand(ctx, record); err != nil {
+			t.Fatalf("InsertCommand: %v", err)
+		}
+	}
+	commands, err := repo.ListCommands(ctx, "alice", "tab-1", 2)
+	if err != nil {
+		t.Fatalf("ListCommands: %v", err)
+	}
+	if len(commands) != 2 || commands[0].Command != "make" || commands[1].Command != "cd lab" {
+		t.Fatalf("ListCommands = %+v, want the newest two first", commands)
+	}
+
+	if err := repo.InsertContainerEvent(ctx, &domain.ContainerEvent{UserID: "alice", ContainerID: "c1", Event: domain.ContainerEventStop, Reason: "idle", CreatedAt: seen}); err != nil {
+		t.Fatalf("InsertContainerEvent: %v", err)
+	}
+	events, err := repo.ListContainerEvents(ctx, "alice", 10)
+	if err != nil || len(events) != 1 || events[0].Reason != "idle" {
+		t.Fatalf("ListContainerEvents = %+v, %v", events, err)
+	}
+}
@@ -0,0 +1,183 @@
+package store
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+)
+
+// CachedRepository wraps a Repository with an in-process LRU cache of user
+// records, which are read on every WebSocket connect, chat request and SSE
+// stream. Writes through this repository update or invalidate the cached
+// entry. Writes by other instances sharing the database are only seen once
+// an entry expires, so the TTL bounds how stale a user may be.
+type CachedRepository struct {
+	Repository
+
+	size int
+	ttl  time.Duration
+
+	mu    sync.Mutex
+	order *list.List // of *userCacheEntry, most recently used first
+	items map[string]*list.Element
+	// gen advances on every invalidation, so a read that raced with a write
+	// does not cache what it read.
+	gen uint64
+}
+
+// userCacheEntry is a cached user and when it stops being served.
+type userCacheEntry struct {
+	user    domain.User
+	expires time.Time
+}
+
+var _ Repository = (*CachedRepository)(nil)
+
+// NewUserCache wraps repo with a cache of up to size users, each kept for at
+// most ttl. A size or ttl <= 0 returns repo unchanged.
+func NewUserCache(repo Repository, size int, ttl time.Duration) Repository {
+	if size <= 0 || ttl <= 0 {
+		return repo
+	}
+	return &CachedRepository{
+		Repository: repo,
+		size:       size,
+		ttl:        ttl,
+		order:      list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// GetUser returns a copy of the cached user, reading through on a miss.
+// Unknown users are not cached.
+func (c *CachedRepository) GetUser(ctx context.Context, userID string) (*domain.User, error) {
+	user, gen, ok := c.lookup(userID)
+	if ok {
+		return user, nil
+	}
+	user, err := c.Repository.GetUser(ctx, userID)
+	if err != nil || user == nil {
+		return user, err
+	}
+	c.store(user, gen)
+	return user, nil
+}
+
+// UpsertUser implements Repository.
+func (c *CachedRepository) UpsertUser(ctx context.Context, user *domain.User) error {
+	defer c.invalidate(user.UserID)
+	return c.Repository.UpsertUser(ctx, user)
+}
+
+// UpdateLastSeen implements Repository. It is called on most terminal
+// messages, so the cached entry is updated rather than dropped.
+func (c *CachedRepository) UpdateLastSeen(ctx context.Context, userID string, lastSeen time.Time) error {
+	if err := c.Repository.UpdateLastSeen(ctx, userID, lastSeen); err != nil {
+		c.invalidate(userID)
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[userID]; ok {
+		el.Value.(*userCacheEntry).user.LastSeenAt = lastSeen
+	}
+	return nil
+}
+
+// UpdateContainerID implements Repository.
+func (c *CachedRepository) UpdateContainerID(ctx context.Context, userID, containerID, expectedID string) error {
+	defer c.invalidate(userID)
+	return c.Repository.UpdateContainerID(ctx, userID, containerID, expectedID)
+}
+
+// UpdateInstanceID implements Repository.
+func (c *CachedRepository) UpdateInstanceID(ctx context.Context, userID, instanceID string) error {
+	defer c.invalidate(userID)
+	return c.Repository.UpdateInstanceID(ctx, userID, instanceID)
+}
+
+// SetKeepWarm implements Repository.
+func (c *CachedRepository) SetKeepWarm(ctx context.Context, userID string, until time.Time) error {
+	defer c.invalidate(userID)
+	return c.Repository.SetKeepWarm(ctx, userID, until)
+}
+
+// SetResourceTier implements Repository.
+func (c *CachedRepository) SetResourceTier(ctx context.Context, userID, tier string) error {
+	defer c.invalidate(userID)
+	return c.Repository.SetResourceTier(ctx, userID, tier)
+}
+
+// SetClassroom implements Repository.
+func (c *CachedRepository) SetClassroom(ctx context.Context, userID, classroom string) error {
+	defer c.invalidate(userID)
+	return c.Repository.SetClassroom(ctx, userID, classroom)
+}
+
+// PurgeUser implements Repository.
+func (c *CachedRepository) PurgeUser(ctx context.Context, userID string) error {
+	defer c.invalidate(userID)
+	return c.Repository.PurgeUser(ctx, userID)
+}
+
+// DeleteLegacyLocalState implements Repository.
+func (c *CachedRepository) DeleteLegacyLocalState(ctx context.Context) (int64, int64, error) {
+	defer c.invalidate("local")
+	return c.Repository.DeleteLegacyLocalState(ctx)
+}
+
+// lookup returns a copy of a fresh cached user, or the current generation
+// to store a read-through result under.
+func (c *CachedRepository) lookup(userID string) (*domain.User, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[userID]
+	if !ok {
+		return nil, c.gen, false
+	}
+	entry := el.Value.(*userCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(el)
+		delete(c.items, userID)
+		return nil, c.gen, false
+	}
+	c.order.MoveToFront(el)
+	user := entry.user
+	return &user, c.gen, true
+}
+
+// store caches a copy of user unless an invalidation happened since gen,
+// evicting the least recently used entry when full.
+func (c *CachedRepository) store(user *domain.User, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	entry := &userCacheEntry{user: *user, expires: time.Now().Add(c.ttl)}
+	if el, ok := c.items[user.UserID]; ok {
+		el.Value = entry
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[user.UserID] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*userCacheEntry).user.UserID)
+	}
+}
+
+// invalidate drops userID's entry.
+func (c *CachedRepository) invalidate(userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	if el, ok := c.items[userID]; ok {
+		c.order.Remove(el)
+		delete(c.items, userID)
+	}
+}
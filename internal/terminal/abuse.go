@@ -0,0 +1,193 @@
+package terminal
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/store"
+	"github.com/coder/websocket"
+)
+
+const (
+	// maxAbuseLine bounds the command line tracked for abuse detection;
+	// longer lines are checked on their first maxAbuseLine bytes.
+	maxAbuseLine = 4096
+
+	// abuseStopTimeout bounds stopping a container terminated for abuse.
+	abuseStopTimeout = 30 * time.Second
+)
+
+// commandStart anchors a pattern to the start of a command: the line start
+// or a shell separator, optional wrappers such as sudo, and a path prefix.
+const commandStart = `(?:^|[;&|(]\s*)(?:(?:sudo|nohup|exec|timeout\s+\S+)\s+)*(?:\S*/)?`
+
+// abuseRule names a class of commands a public playground must not run.
+type abuseRule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// abuseRules are checked in order against every command line entered when
+// abuse detection is enabled.
+var abuseRules = []abuseRule{
+	{"fork_bomb", regexp.MustCompile(`:\s*\(\s*\)\s*\{.*:\s*\|\s*:`)},
+	{"miner", regexp.MustCompile(`(?i)` + commandStart + `(?:xmrig|minerd|cpuminer|ethminer|nbminer|t-rex)\b|stratum\+(?:tcp|ssl)://`)},
+	{"scanner", regexp.MustCompile(`(?i)` + commandStart + `(?:nmap|masscan|zmap|hping3)\b`)},
+	{"reverse_shell", regexp.MustCompile(`/dev/(?:tcp|udp)/|` + commandStart + `(?:nc|ncat|netcat)\s(?:.*\s)?-[a-z]*[ec]\b|` + commandStart + `socat\s.*\bexec:`)},
+	{"stress", regexp.MustCompile(commandStart + `stress(?:-ng)?(?:\s|$)`)},
+}
+
+// matchAbuse returns the name of the first rule line matches, or "".
+func matchAbuse(line string) string {
+	for _, rule := range abuseRules {
+		if rule.pattern.MatchString(line) {
+			return rule.name
+		}
+	}
+	return ""
+}
+
+// abuseDetector blocks abusive commands and counts strikes per user. Once a
+// user reaches the strike limit, their container is stopped. Detection is a
+// best-effort deterrent against the obvious cases; the sandbox limits and
+// egress policy remain the enforcement.
+type abuseDetector struct {
+	limit int
+
+	mu      sync.Mutex
+	strikes map[string]int // Blocked commands per user
+}
+
+// newAbuseDetector returns nil when detection is disabled.
+func newAbuseDetector(enabled bool, limit int) *abuseDetector {
+	if !enabled {
+		return nil
+	}
+	return &abuseDetector{limit: max(limit, 1), strikes: make(map[string]int)}
+}
+
+// strike records a blocked command and reports whether the user reached the
+// limit. Reaching it resets the count for the user's next container.
+func (d *abuseDetector) strike(userID string) (int, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.strikes[userID]++
+	n := d.strikes[userID]
+	if n < d.limit {
+		return n, false
+	}
+	delete(d.strikes, userID)
+	return n, true
+}
+
+// guard returns the input guard of a terminal connection, or nil when
+// detection is disabled.
+func (d *abuseDetector) guard() *abuseGuard {
+	if d == nil {
+		return nil
+	}
+	return &abuseGuard{}
+}
+
+// abuseGuard follows the command line typed into one terminal so it can be
+// checked before its Enter reaches the shell. It tracks plain typing,
+// backspace and line kills; lines edited through history or cursor keys are
+// seen as typed.
+type abuseGuard struct {
+	line []byte
+	esc  int // 0 outside escape sequences, 1 after ESC, 2 inside a CSI or SS3 sequence
+}
+
+// check feeds input to the guard. When an entered line matches a rule, it
+// returns the input up to that line with its Enter replaced by Ctrl-C, so
+// the shell discards the line, and the rule's name. A nil guard passes p
+// through.
+func (g *abuseGuard) check(p []byte) ([]byte, string) {
+	if g == nil {
+		return p, ""
+	}
+	for i, b := range p {
+		if g.esc > 0 {
+			g.escape(b)
+			continue
+		}
+		switch {
+		case b == '\r' || b == '\n':
+			rule := matchAbuse(string(g.line))
+			g.line = g.line[:0]
+			if rule != "" {
+				out := make([]byte, i+1)
+				copy(out, p[:i])
+				out[i] = 0x03
+				return out, rule
+			}
+		case b == 0x7f || b == 0x08:
+			_, size := utf8.DecodeLastRune(g.line)
+			g.line = g.line[:len(g.line)-size]
+		case b == 0x03 || b == 0x15: // Ctrl-C and Ctrl-U discard the line
+			g.line = g.line[:0]
+		case b == 0x1b:
+			g.esc = 1
+		case b < 0x20:
+		case len(g.line) < maxAbuseLine:
+			g.line = append(g.line, b)
+		}
+	}
+	return p, ""
+}
+
+// escape skips the bytes of an escape sequence such as an arrow key.
+func (g *abuseGuard) escape(b byte) {
+	switch {
+	case g.esc == 1 && (b == '[' || b == 'O'):
+		g.esc = 2
+	case g.esc == 1 || (b >= 0x40 && b <= 0x7e):
+		g.esc = 0
+	}
+}
+
+// reportAbuse tells the client its command was blocked and, once the user
+// reached the strike limit, stops their container. It reports whether the
+// session was terminated.
+func (h *WebSocketHandler) reportAbuse(ws *websocket.Conn, userID, sessionID, containerID, rule string) bool {
+	strikes, terminate := h.abuse.strike(userID)
+	slog.Warn("Blocked abusive terminal command",
+		"user_id", userID,
+		"session_id", sessionID,
+		"rule", rule,
+		"strikes", strikes)
+	if err := h.writeJSON(ws, map[string]string{"type": "error", "error": "command_blocked", "reason": rule}); err != nil {
+		slog.Debug("Failed to send command_blocked error", "error", err)
+	}
+	if !terminate {
+		return false
+	}
+
+	slog.Warn("Terminating container after repeated abuse", "user_id", userID, "container_id", containerID)
+	if err := h.writeJSON(ws, map[string]string{"type": "terminated", "reason": "abuse"}); err != nil {
+		slog.Debug("Failed to send terminated notice", "error", err)
+	}
+	go terminateForAbuse(h.repo, h.mgr, userID, containerID)
+	return true
+}
+
+// terminateForAbuse stops the user's container and unbinds it, so the next
+// provision starts from a fresh one.
+func terminateForAbuse(repo store.Repository, mgr container.Manager, userID, containerID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), abuseStopTimeout)
+	defer cancel()
+	if err := mgr.StopContainer(container.WithLifecycleReason(ctx, container.ReasonAbuse), containerID); err != nil {
+		slog.Error("Failed to stop container terminated for abuse",
+			"error", err,
+			"container_id", containerID,
+			"user_id", userID)
+	}
+	if err := repo.UpdateContainerID(ctx, userID, "", containerID); err != nil {
+		slog.Warn("Failed to clear container ID after abuse", "error", err, "user_id", userID)
+	}
+}
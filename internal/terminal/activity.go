@@ -0,0 +1,87 @@
+package terminal
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// activityRecordInterval limits how often a busy terminal records output.
+const activityRecordInterval = 10 * time.Second
+
+// ActivityTracker records terminal activity that last_seen_at (bumped only on
+// input) misses: output from the container and foreground commands that are
+// still running. The TTL worker consults it before reaping an "idle" session,
+// so a learner watching a long build is not treated as gone.
+type ActivityTracker struct {
+	mu         sync.RWMutex
+	lastOutput map[string]time.Time
+	monitor    *Monitor
+}
+
+// NewActivityTracker creates an empty activity tracker.
+func NewActivityTracker() *ActivityTracker {
+	return &ActivityTracker{lastOutput: make(map[string]time.Time)}
+}
+
+// SetMonitor lets running foreground commands count as activity. Without a
+// monitor only output is tracked.
+func (t *ActivityTracker) SetMonitor(monitor *Monitor) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.monitor = monitor
+}
+
+// RecordOutput notes that one of the user's terminals produced output at at.
+func (t *ActivityTracker) RecordOutput(userID string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if at.After(t.lastOutput[userID]) {
+		t.lastOutput[userID] = at
+	}
+}
+
+// LastActivity returns when the user's terminals were last active: now if a
+// foreground command is running, otherwise the time of their latest output,
+// or the zero time if nothing was recorded.
+func (t *ActivityTracker) LastActivity(userID string) time.Time {
+	last, monitor := t.recorded(userID)
+	if monitor != nil && monitor.CommandRunning(userID) {
+		return time.Now()
+	}
+	return last
+}
+
+// recorded returns the user's last output time and the monitor, if any.
+// The monitor is queried outside t.mu.
+func (t *ActivityTracker) recorded(userID string) (time.Time, *Monitor) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.lastOutput[userID], t.monitor
+}
+
+// Forget drops what was recorded for the user, e.g. once their container has
+// been cleaned up.
+func (t *ActivityTracker) Forget(userID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.lastOutput, userID)
+}
+
+// activityReader records output activity for a session, at most once per
+// activityRecordInterval, as output is read from the container.
+type activityReader struct {
+	r        io.Reader
+	tracker  *ActivityTracker
+	userID   string
+	recorded time.Time
+}
+
+func (a *activityReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	if now := time.Now(); n > 0 && now.Sub(a.recorded) >= activityRecordInterval {
+		a.recorded = now
+		a.tracker.RecordOutput(a.userID, now)
+	}
+	return n, err
+}
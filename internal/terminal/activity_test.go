@@ -0,0 +1,56 @@
+package terminal
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestActivityTrackerKeepsLatestOutput(t *testing.T) {
+	tracker := NewActivityTracker()
+	later := time.Now()
+	earlier := later.Add(-time.Minute)
+
+	tracker.RecordOutput(testUserID, later)
+	tracker.RecordOutput(testUserID, earlier)
+	if got := tracker.LastActivity(testUserID); !got.Equal(later) {
+		t.Fatalf("expected last activity %v, got %v", later, got)
+	}
+
+	tracker.Forget(testUserID)
+	if got := tracker.LastActivity(testUserID); !got.IsZero() {
+		t.Fatalf("expected no activity after Forget, got %v", got)
+	}
+}
+
+func TestActivityTrackerCountsRunningCommand(t *testing.T) {
+	tm := NewMonitor(nil, nil, nil)
+	defer tm.Stop()
+	tracker := NewActivityTracker()
+	tracker.SetMonitor(tm)
+
+	tm.RegisterSession(testUserID, testTabOne, "c1", "/home/u1")
+	if got := tracker.LastActivity(testUserID); !got.IsZero() {
+		t.Fatalf("expected no activity before a command runs, got %v", got)
+	}
+
+	// Pre-exec marker without an exit marker: the command is still running.
+	tm.ProcessOutput(context.Background(), testUserID, testTabOne, []byte("\x1b]133;A\x07$ \x1b]133;B\x07"))
+	if got := tracker.LastActivity(testUserID); time.Since(got) > time.Second {
+		t.Fatalf("expected a running command to count as current activity, got %v", got)
+	}
+}
+
+func TestActivityReaderRecordsOutput(t *testing.T) {
+	tracker := NewActivityTracker()
+	reader := &activityReader{r: strings.NewReader("make: building..."), tracker: tracker, userID: testUserID}
+
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	if got := tracker.LastActivity(testUserID); time.Since(got) > time.Second {
+		t.Fatalf("expected output to be recorded, got %v", got)
+	}
+}
@@ -0,0 +1,155 @@
+package terminal
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// runningAnalysis is an analysis job a worker is processing.
+type runningAnalysis struct {
+	userID    string
+	sessionID string
+	command   string
+	started   time.Time
+	cancel    context.CancelFunc
+	cancelled time.Time // When the watchdog cancelled the job; zero until then
+}
+
+// analysisWatchdogStats counts the watchdog's interventions.
+type analysisWatchdogStats struct {
+	cancelled atomic.Int64
+	recycled  atomic.Int64
+}
+
+// AnalysisStats reports the state of the analysis worker pool for the
+// health endpoint.
+type AnalysisStats struct {
+	Workers        int   `json:"workers"`         // Workers taking jobs
+	Busy           int   `json:"busy"`            // Jobs in progress, including those of recycled workers
+	Queued         int   `json:"queued"`          // Jobs waiting for a worker
+	StuckCancelled int64 `json:"stuck_cancelled"` // Jobs cancelled for running past the deadline
+	Recycled       int64 `json:"recycled"`        // Workers replaced because a cancelled job did not return
+}
+
+// startAnalysisWorker adds a worker to the pool. The caller accounts for it
+// in workerWg.
+func (tm *Monitor) startAnalysisWorker() {
+	tm.analysisMu.Lock()
+	defer tm.analysisMu.Unlock()
+	id := tm.nextWorkerID
+	tm.nextWorkerID++
+	go tm.analysisWorker(id)
+}
+
+// runAnalysisJob processes job under a context the watchdog can cancel.
+func (tm *Monitor) runAnalysisJob(workerID int, job analysisJob) {
+	ctx, cancel := context.WithCancel(job.ctx)
+	defer cancel()
+	job.ctx = ctx
+
+	func() {
+		tm.analysisMu.Lock()
+		defer tm.analysisMu.Unlock()
+		tm.running[workerID] = &runningAnalysis{
+			userID:    job.userID,
+			sessionID: job.sessionID,
+			command:   job.entry.Command,
+			started:   time.Now(),
+			cancel:    cancel,
+		}
+	}()
+	defer func() {
+		tm.analysisMu.Lock()
+		defer tm.analysisMu.Unlock()
+		delete(tm.running, workerID)
+	}()
+
+	tm.processAnalysisJob(job)
+}
+
+// workerRetired reports whether the watchdog replaced a worker while its
+// job was stuck, in which case the worker must exit without releasing its
+// workerWg slot, which passed to the replacement.
+func (tm *Monitor) workerRetired(workerID int) bool {
+	tm.analysisMu.Lock()
+	defer tm.analysisMu.Unlock()
+	if !tm.retired[workerID] {
+		return false
+	}
+	delete(tm.retired, workerID)
+	return true
+}
+
+// StartAnalysisWatchdog cancels analysis jobs running longer than
+// stuckAfter, such as those waiting on a hung agent stream, until ctx is
+// cancelled. A worker whose job still has not returned a grace period after
+// the cancellation is replaced, so stuck jobs cannot drain the fixed pool.
+// A stuckAfter <= 0 disables the watchdog.
+func (tm *Monitor) StartAnalysisWatchdog(ctx context.Context, stuckAfter time.Duration) {
+	if stuckAfter <= 0 {
+		return
+	}
+	// The grace period doubles as the check interval, so a job is cancelled
+	// at most a quarter of stuckAfter late.
+	grace := stuckAfter / 4
+	go func() {
+		ticker := time.NewTicker(grace)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				tm.checkStuckAnalyses(now, stuckAfter, grace)
+			}
+		}
+	}()
+}
+
+// checkStuckAnalyses cancels jobs running longer than stuckAfter and
+// replaces the workers of jobs cancelled at least grace ago.
+func (tm *Monitor) checkStuckAnalyses(now time.Time, stuckAfter, grace time.Duration) {
+	tm.analysisMu.Lock()
+	defer tm.analysisMu.Unlock()
+	for workerID, run := range tm.running {
+		switch {
+		case run.cancelled.IsZero() && now.Sub(run.started) >= stuckAfter:
+			run.cancel()
+			run.cancelled = now
+			tm.watchdog.cancelled.Add(1)
+			tm.logger.Warn("[MONITOR] Analysis job exceeded deadline, cancelling",
+				"user_id", run.userID,
+				"session_id", run.sessionID,
+				"command", run.command,
+				"running", now.Sub(run.started),
+			)
+		case !run.cancelled.IsZero() && !tm.retired[workerID] && now.Sub(run.cancelled) >= grace:
+			tm.retired[workerID] = true
+			tm.watchdog.recycled.Add(1)
+			id := tm.nextWorkerID
+			tm.nextWorkerID++
+			go tm.analysisWorker(id)
+			tm.logger.Error("[MONITOR] Cancelled analysis job did not return, recycling worker",
+				"user_id", run.userID,
+				"session_id", run.sessionID,
+				"command", run.command,
+				"running", now.Sub(run.started),
+			)
+		}
+	}
+}
+
+// AnalysisStats reports the analysis worker pool and the watchdog's
+// interventions.
+func (tm *Monitor) AnalysisStats() AnalysisStats {
+	tm.analysisMu.Lock()
+	defer tm.analysisMu.Unlock()
+	return AnalysisStats{
+		Workers:        tm.workerPoolSize,
+		Busy:           len(tm.running),
+		Queued:         len(tm.jobChan),
+		StuckCancelled: tm.watchdog.cancelled.Load(),
+		Recycled:       tm.watchdog.recycled.Load(),
+	}
+}
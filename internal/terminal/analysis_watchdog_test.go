@@ -0,0 +1,94 @@
+package terminal
+
+import (
+	"context"
+	"iter"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/agent"
+)
+
+// hangingProcessor blocks terminal analysis: "wait" until its context is
+// cancelled, anything else until release is closed.
+type hangingProcessor struct {
+	release chan struct{}
+}
+
+func (p *hangingProcessor) ProcessTerminalInput(ctx context.Context, input agent.TerminalInput) iter.Seq2[*agent.Response, error] {
+	return func(func(*agent.Response, error) bool) {
+		if input.Command == "wait" {
+			<-ctx.Done()
+			return
+		}
+		<-p.release
+	}
+}
+
+func (p *hangingProcessor) Chat(context.Context, agent.ChatRequest) iter.Seq2[*agent.ChatResponse, error] {
+	return func(func(*agent.ChatResponse, error) bool) {}
+}
+
+func (p *hangingProcessor) UpdateSessionSignals(context.Context, agent.SessionSignalRequest) error {
+	return nil
+}
+
+func (p *hangingProcessor) ResetSession(context.Context, string, string) error { return nil }
+func (p *hangingProcessor) GetStats() agent.Stats                              { return agent.Stats{} }
+func (p *hangingProcessor) Close()                                             {}
+
+func waitForAnalysisStats(t *testing.T, tm *Monitor, ok func(AnalysisStats) bool) AnalysisStats {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		stats := tm.AnalysisStats()
+		if ok(stats) {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out, stats %+v", stats)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAnalysisWatchdogCancelsStuckJobs(t *testing.T) {
+	processor := &hangingProcessor{release: make(chan struct{})}
+	service, _ := agent.NewServiceWithProcessor(processor)
+	tm := NewMonitor(service, make(chan *agent.Response, 1), nil)
+	defer tm.Stop()
+	tm.StartAnalysisWatchdog(t.Context(), 40*time.Millisecond)
+
+	tm.jobChan <- analysisJob{ctx: context.Background(), userID: "u1", sessionID: "s1", entry: &CommandEntry{Command: "wait"}}
+	stats := waitForAnalysisStats(t, tm, func(s AnalysisStats) bool { return s.StuckCancelled == 1 && s.Busy == 0 })
+	if stats.Recycled != 0 {
+		t.Fatalf("a job that honoured cancellation should not recycle its worker: %+v", stats)
+	}
+}
+
+func TestAnalysisWatchdogRecyclesHungWorkers(t *testing.T) {
+	processor := &hangingProcessor{release: make(chan struct{})}
+	service, _ := agent.NewServiceWithProcessor(processor)
+	tm := NewMonitor(service, make(chan *agent.Response, 1), nil)
+	tm.StartAnalysisWatchdog(t.Context(), 40*time.Millisecond)
+
+	tm.jobChan <- analysisJob{ctx: context.Background(), userID: "u1", sessionID: "s1", entry: &CommandEntry{Command: "hang"}}
+	waitForAnalysisStats(t, tm, func(s AnalysisStats) bool { return s.Recycled >= 1 })
+
+	// The pool keeps taking jobs while the hung one is stuck.
+	tm.jobChan <- analysisJob{ctx: context.Background(), userID: "u1", sessionID: "s1", entry: &CommandEntry{Command: "wait"}}
+	waitForAnalysisStats(t, tm, func(s AnalysisStats) bool { return s.StuckCancelled >= 2 && s.Queued == 0 })
+
+	close(processor.release)
+	waitForAnalysisStats(t, tm, func(s AnalysisStats) bool { return s.Busy == 0 })
+	stopped := make(chan struct{})
+	go func() {
+		tm.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stop waited on a recycled worker")
+	}
+}
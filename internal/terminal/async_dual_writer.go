@@ -5,6 +5,8 @@ import (
 	"log/slog"
 	"sync"
 	"time"
+
+	"github.com/ashureev/shsh-labs/internal/identity"
 )
 
 // AsyncDualWriter writes to both WebSocket and monitor asynchronously.
@@ -15,16 +17,17 @@ type AsyncDualWriter struct {
 	outputChan   chan []byte
 	userID       string
 	sessionID    string
-	sessionKey   string
+	sessionKey   identity.SessionKey
 	ctx          context.Context
 	cancel       context.CancelFunc
 	wg           sync.WaitGroup
 	logger       *slog.Logger
 	maxQueueSize int
+	flood        *outputFloodGuard
 }
 
 // NewAsyncDualWriter creates a new async dual writer for Monitor.
-func NewAsyncDualWriter(ws *wsWriter, monitor *Monitor, userID, sessionID, sessionKey string, logger *slog.Logger) *AsyncDualWriter {
+func NewAsyncDualWriter(ws *wsWriter, monitor *Monitor, userID, sessionID string, sessionKey identity.SessionKey, logger *slog.Logger) *AsyncDualWriter {
 	if logger == nil {
 		logger = slog.Default()
 	}
@@ -41,6 +44,7 @@ func NewAsyncDualWriter(ws *wsWriter, monitor *Monitor, userID, sessionID, sessi
 		cancel:       cancel,
 		logger:       logger,
 		maxQueueSize: 100,
+		flood:        newOutputFloodGuard(defaultFloodThreshold, defaultFloodSampleBudget),
 	}
 
 	// Start background processor
@@ -50,6 +54,13 @@ func NewAsyncDualWriter(ws *wsWriter, monitor *Monitor, userID, sessionID, sessi
 	return dw
 }
 
+// SetFloodLimits configures output flood detection. threshold is the output
+// rate in bytes/sec that triggers sampling (0 disables); sampleBudget is how
+// many bytes/sec still reach the monitor while sampling.
+func (w *AsyncDualWriter) SetFloodLimits(threshold, sampleBudget int) {
+	w.flood = newOutputFloodGuard(threshold, sampleBudget)
+}
+
 // Write implements io.Writer.
 // Writes to WebSocket synchronously, queues for monitor asynchronously.
 func (w *AsyncDualWriter) Write(p []byte) (int, error) {
@@ -59,6 +70,29 @@ func (w *AsyncDualWriter) Write(p []byte) (int, error) {
 		return n, err
 	}
 
+	// Under an output flood only a sample reaches the monitor; the browser
+	// still receives everything above.
+	forward, transition := w.flood.admit(p, time.Now())
+	switch transition {
+	case floodStarted:
+		w.logger.Warn("[ASYNC-WRITER] Output flood detected, sampling monitor input",
+			"user_id", w.userID,
+			"session_id", w.sessionID,
+		)
+		if w.monitor != nil {
+			w.monitor.NotifyOutputFlood(w.ctx, w.userID, w.sessionID)
+		}
+	case floodEnded:
+		w.logger.Info("[ASYNC-WRITER] Output flood ended",
+			"user_id", w.userID,
+			"session_id", w.sessionID,
+			"skipped_bytes", w.flood.skippedBytes(),
+		)
+	}
+	if !forward {
+		return n, nil
+	}
+
 	// Queue for monitor processing (non-blocking with backpressure)
 	data := make([]byte, len(p))
 	copy(data, p)
@@ -207,5 +241,6 @@ func (w *AsyncDualWriter) Stats() map[string]interface{} {
 		"queue_len":      len(w.outputChan),
 		"queue_capacity": cap(w.outputChan),
 		"max_queue_size": w.maxQueueSize,
+		"flood_skipped":  w.flood.skippedBytes(),
 	}
 }
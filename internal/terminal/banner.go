@@ -0,0 +1,158 @@
+package terminal
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/identity"
+)
+
+const (
+	// bannerScriptTimeout bounds the banner script so a slow one cannot hold
+	// up the terminal.
+	bannerScriptTimeout = 5 * time.Second
+	// maxBannerSize bounds the banner text and the script output each.
+	maxBannerSize = 8 * 1024
+	// bannerSeenTTL is how long a tab is remembered as having seen the banner
+	// for its container; reconnects within it do not repeat the banner.
+	bannerSeenTTL = 24 * time.Hour
+)
+
+// classroomNamePattern restricts classroom names used as banner file names.
+var classroomNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// ValidClassroom reports whether name can name a classroom, whose banner,
+// input filter and quiet hours are files named after it.
+func ValidClassroom(name string) bool {
+	return classroomNamePattern.MatchString(name)
+}
+
+// ClassroomResolver maps a user to their classroom for per-classroom banners.
+type ClassroomResolver interface {
+	// ClassroomOf returns the user's classroom, or "" if they are in none.
+	ClassroomOf(ctx context.Context, userID string) string
+}
+
+// terminalBanner writes a welcome message to a terminal the first time a tab
+// attaches to a container. The banner goes straight to the WebSocket, so the
+// monitor, the activity tracker and the shell never see it.
+type terminalBanner struct {
+	text   string // default banner text
+	dir    string // directory of <classroom>.txt banners replacing text
+	script string // shell command run in the container; its output follows the text
+	runner container.CommandRunner
+
+	mu   sync.Mutex
+	seen map[identity.SessionKey]bannerMark
+}
+
+// bannerMark records which container a tab last saw the banner for.
+type bannerMark struct {
+	containerID string
+	at          time.Time
+}
+
+// newTerminalBanner returns nil when no banner is configured.
+func newTerminalBanner(text, dir, script string, mgr container.Manager) *terminalBanner {
+	if text == "" && dir == "" && script == "" {
+		return nil
+	}
+	b := &terminalBanner{
+		text:   expandBannerEscapes(text),
+		dir:    dir,
+		script: script,
+		seen:   make(map[identity.SessionKey]bannerMark),
+	}
+	if script != "" {
+		runner, ok := mgr.(container.CommandRunner)
+		if !ok {
+			slog.Warn("Terminal banner script ignored: container manager cannot run commands")
+		}
+		b.runner = runner
+	}
+	return b
+}
+
+// firstAttach reports whether the tab has not seen the banner for containerID
+// yet, and records that it now has.
+func (b *terminalBanner) firstAttach(key identity.SessionKey, containerID string, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if mark, ok := b.seen[key]; ok && mark.containerID == containerID && now.Sub(mark.at) < bannerSeenTTL {
+		return false
+	}
+	for k, mark := range b.seen {
+		if now.Sub(mark.at) >= bannerSeenTTL {
+			delete(b.seen, k)
+		}
+	}
+	b.seen[key] = bannerMark{containerID: containerID, at: now}
+	return true
+}
+
+// render returns the banner for a user in classroom, ready for the terminal.
+func (b *terminalBanner) render(ctx context.Context, classroom, containerID string) []byte {
+	text := b.text
+	if classroomText, ok := b.classroomText(classroom); ok {
+		text = classroomText
+	}
+	out := []byte(toTerminalNewlines(text))
+
+	if b.runner != nil {
+		scriptCtx, cancel := context.WithTimeout(ctx, bannerScriptTimeout)
+		defer cancel()
+		output, exitCode, err := b.runner.RunCommand(scriptCtx, containerID, []string{"/bin/sh", "-c", b.script}, maxBannerSize)
+		switch {
+		case err != nil:
+			slog.Warn("Terminal banner script failed", "error", err, "container_id", containerID)
+		case exitCode != 0:
+			slog.Warn("Terminal banner script exited with error", "exit_code", exitCode, "container_id", containerID)
+		}
+		out = append(out, output...)
+	}
+	return out
+}
+
+// classroomText reads <dir>/<classroom>.txt, if there is one.
+func (b *terminalBanner) classroomText(classroom string) (string, bool) {
+	if b.dir == "" || !classroomNamePattern.MatchString(classroom) {
+		return "", false
+	}
+	data, err := os.ReadFile(filepath.Join(b.dir, classroom+".txt"))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("Failed to read classroom banner", "error", err, "classroom", classroom)
+		}
+		return "", false
+	}
+	if len(data) > maxBannerSize {
+		data = data[:maxBannerSize]
+	}
+	return string(data), true
+}
+
+// expandBannerEscapes turns the \n and \t sequences of a one-line environment
+// value into newlines and tabs, and \e into ESC for colors.
+func expandBannerEscapes(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\e`, "\x1b").Replace(s)
+}
+
+// toTerminalNewlines converts bare LFs to CRLF, as a raw terminal needs, and
+// ends non-empty text with one.
+func toTerminalNewlines(s string) string {
+	if s == "" {
+		return ""
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.TrimRight(s, "\n") + "\n"
+	return strings.ReplaceAll(s, "\n", "\r\n")
+}
@@ -0,0 +1,78 @@
+package terminal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/identity"
+)
+
+type fakeCommandRunner struct {
+	output []byte
+	cmd    []string
+}
+
+func (f *fakeCommandRunner) RunCommand(_ context.Context, _ string, cmd []string, _ int) ([]byte, int, error) {
+	f.cmd = cmd
+	return f.output, 0, nil
+}
+
+func TestTerminalBannerFirstAttach(t *testing.T) {
+	b := newTerminalBanner("hi", "", "", nil)
+	key := identity.NewSessionKey("u1", "tab1")
+	now := time.Now()
+
+	if !b.firstAttach(key, "c1", now) {
+		t.Fatal("expected banner on first attach")
+	}
+	if b.firstAttach(key, "c1", now.Add(time.Minute)) {
+		t.Fatal("expected no banner on reconnect to the same container")
+	}
+	if !b.firstAttach(key, "c2", now.Add(2*time.Minute)) {
+		t.Fatal("expected banner for a new container")
+	}
+	if !b.firstAttach(identity.NewSessionKey("u1", "tab2"), "c2", now) {
+		t.Fatal("expected banner for a new tab")
+	}
+	if !b.firstAttach(key, "c2", now.Add(bannerSeenTTL+2*time.Minute)) {
+		t.Fatal("expected banner once the mark expired")
+	}
+}
+
+func TestTerminalBannerRender(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "class-a.txt"), []byte("Class A\nrules\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	b := newTerminalBanner(`Welcome\n\e[1mtips\e[0m`, dir, "", nil)
+	runner := &fakeCommandRunner{output: []byte("from script\r\n")}
+	b.script = "motd"
+	b.runner = runner
+
+	got := string(b.render(context.Background(), "", "c1"))
+	if want := "Welcome\r\n\x1b[1mtips\x1b[0m\r\nfrom script\r\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if len(runner.cmd) != 3 || runner.cmd[2] != "motd" {
+		t.Fatalf("unexpected script command: %v", runner.cmd)
+	}
+
+	got = string(b.render(context.Background(), "class-a", "c1"))
+	if want := "Class A\r\nrules\r\nfrom script\r\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	// Names that could escape the directory are ignored.
+	got = string(b.render(context.Background(), "../class-a", "c1"))
+	if want := "Welcome\r\n\x1b[1mtips\x1b[0m\r\nfrom script\r\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestNewTerminalBannerDisabled(t *testing.T) {
+	if b := newTerminalBanner("", "", "", nil); b != nil {
+		t.Fatal("expected nil banner when nothing is configured")
+	}
+}
@@ -0,0 +1,75 @@
+package terminal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+)
+
+var errLabUnsupported = errors.New("manager cannot run labs")
+
+// colorTerms maps the color depth a client reports in the "colors" query
+// parameter to the TERM and COLORTERM its shell gets. Clients that report
+// nothing keep the attacher's defaults.
+var colorTerms = map[string]struct{ term, colorTerm string }{
+	"16":        {term: "xterm"},
+	"256":       {term: "xterm-256color"},
+	"truecolor": {term: "xterm-256color", colorTerm: "truecolor"},
+}
+
+// terminalOptionsFromRequest reads the client terminal's capabilities from
+// the WebSocket URL: "colors" (16, 256 or truecolor) and its initial "cols"
+// and "rows". Unknown or malformed values are ignored.
+func terminalOptionsFromRequest(r *http.Request) container.TerminalOptions {
+	q := r.URL.Query()
+	var opts container.TerminalOptions
+	if terms, ok := colorTerms[q.Get("colors")]; ok {
+		opts.Term, opts.ColorTerm = terms.term, terms.colorTerm
+	}
+	opts.Cols = parseTerminalSize(q.Get("cols"))
+	opts.Rows = parseTerminalSize(q.Get("rows"))
+	return opts
+}
+
+// parseTerminalSize returns 0 for a missing or malformed dimension; the
+// attacher bounds the rest.
+func parseTerminalSize(v string) uint {
+	n, err := strconv.ParseUint(v, 10, 16)
+	if err != nil {
+		return 0
+	}
+	return uint(n)
+}
+
+// createExec opens a shell in the container, matching the client terminal
+// when the attacher supports it.
+func (h *WebSocketHandler) createExec(ctx context.Context, containerID string, opts container.TerminalOptions) (string, io.ReadWriteCloser, error) {
+	attacher := h.execAttacher()
+	if creator, ok := attacher.(container.TerminalExecCreator); ok {
+		return creator.CreateTerminalExecSession(ctx, containerID, opts)
+	}
+	return attacher.CreateExecSession(ctx, containerID)
+}
+
+// openTerminal opens a shell in the user's container, or on a node of their
+// lab when node is set.
+func (h *WebSocketHandler) openTerminal(ctx context.Context, userID, containerID, node string, opts container.TerminalOptions) (string, io.ReadWriteCloser, error) {
+	if node == "" {
+		return h.createExec(ctx, containerID, opts)
+	}
+	labs, ok := h.mgr.(container.TopologyManager)
+	if !ok {
+		return "", nil, errLabUnsupported
+	}
+	return labs.AttachNode(ctx, userID, containerID, node, opts)
+}
+
+// nodeSessionID returns the session ID of a lab node terminal opened from
+// the tab sessionID.
+func nodeSessionID(sessionID, node string) string {
+	return sessionID + "/" + node
+}
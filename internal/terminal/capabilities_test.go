@@ -0,0 +1,27 @@
+package terminal
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+)
+
+func TestTerminalOptionsFromRequest(t *testing.T) {
+	tests := []struct {
+		query string
+		want  container.TerminalOptions
+	}{
+		{"", container.TerminalOptions{}},
+		{"?colors=truecolor&cols=132&rows=43", container.TerminalOptions{Term: "xterm-256color", ColorTerm: "truecolor", Cols: 132, Rows: 43}},
+		{"?colors=256", container.TerminalOptions{Term: "xterm-256color"}},
+		{"?colors=16&cols=-1&rows=abc", container.TerminalOptions{Term: "xterm"}},
+		{"?colors=vt100;rm&cols=99999999", container.TerminalOptions{}},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/ws/terminal"+tt.query, nil)
+		if got := terminalOptionsFromRequest(r); got != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package terminal
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/ashureev/shsh-labs/internal/identity"
+)
+
+// CommandHook is implemented by subsystems that react to completed commands,
+// such as the curriculum engine, achievements or analytics. Hooks see every
+// command, including editor launches and commands from hidden tabs, whether
+// or not AI analysis is enabled.
+//
+// Hooks run synchronously on the terminal output path and must return
+// quickly; slow work belongs on the hook's own goroutine.
+type CommandHook interface {
+	OnCommandCompleted(entry CommandEntry, session CommandSession)
+}
+
+// CommandSession describes the terminal a command completed in.
+type CommandSession struct {
+	Key         identity.SessionKey
+	UserID      string
+	SessionID   string
+	ContainerID string
+	VolumePath  string
+}
+
+// CommandListener is a function that is notified of completed commands. It
+// implements CommandHook for callers that only need the session key.
+type CommandListener func(key identity.SessionKey, entry CommandEntry)
+
+// OnCommandCompleted calls l(session.Key, entry).
+func (l CommandListener) OnCommandCompleted(entry CommandEntry, session CommandSession) {
+	l(session.Key, entry)
+}
+
+// AddCommandHook subscribes hook to completed commands. Hooks are called in
+// the order they were added and must be added before sessions start
+// producing output.
+func (tm *Monitor) AddCommandHook(hook CommandHook) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.hooks = append(tm.hooks, hook)
+}
+
+// notifyCommandHooks passes a completed command to every hook. A panicking
+// hook is logged and skipped so it cannot take down the terminal session or
+// starve the hooks after it.
+func (tm *Monitor) notifyCommandHooks(key identity.SessionKey, entry *CommandEntry) {
+	hooks, session := tm.commandHookTargets(key)
+	for _, hook := range hooks {
+		tm.callCommandHook(hook, *entry, session)
+	}
+}
+
+// commandHookTargets returns the registered hooks and a snapshot of the
+// session they are notified about. Hooks run without tm.mu held.
+func (tm *Monitor) commandHookTargets(key identity.SessionKey) ([]CommandHook, CommandSession) {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	session := CommandSession{Key: key, UserID: key.UserID(), SessionID: key.SessionID()}
+	if state := tm.sessions[key]; state != nil {
+		session.ContainerID = state.ContainerID
+		session.VolumePath = state.VolumePath
+	}
+	return tm.hooks, session
+}
+
+func (tm *Monitor) callCommandHook(hook CommandHook, entry CommandEntry, session CommandSession) {
+	defer func() {
+		if r := recover(); r != nil {
+			tm.logger.Error("[MONITOR] Command hook panicked",
+				"hook", fmt.Sprintf("%T", hook),
+				"user_id", session.UserID,
+				"session_id", session.SessionID,
+				"panic", r,
+				"stack", string(debug.Stack()),
+			)
+		}
+	}()
+	hook.OnCommandCompleted(entry, session)
+}
@@ -0,0 +1,71 @@
+package terminal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ashureev/shsh-labs/internal/identity"
+)
+
+type recordingHook struct {
+	entries  []CommandEntry
+	sessions []CommandSession
+}
+
+func (h *recordingHook) OnCommandCompleted(entry CommandEntry, session CommandSession) {
+	h.entries = append(h.entries, entry)
+	h.sessions = append(h.sessions, session)
+}
+
+type panickingHook struct{}
+
+func (panickingHook) OnCommandCompleted(CommandEntry, CommandSession) { panic("boom") }
+
+func TestCommandHookReceivesEntryAndSession(t *testing.T) {
+	tm := NewMonitor(nil, nil, nil)
+	defer tm.Stop()
+	hook := &recordingHook{}
+	tm.AddCommandHook(hook)
+	tm.RegisterSession("u1", "s1", "c1", "/home/u1")
+
+	tm.handleCommandExecuted(context.Background(), "u1", "s1", &CommandEntry{Command: "ls", ExitCode: 0})
+
+	if len(hook.entries) != 1 || hook.entries[0].Command != "ls" {
+		t.Fatalf("expected ls to be reported, got %+v", hook.entries)
+	}
+	want := CommandSession{Key: identity.NewSessionKey("u1", "s1"), UserID: "u1", SessionID: "s1", ContainerID: "c1", VolumePath: "/home/u1"}
+	if hook.sessions[0] != want {
+		t.Fatalf("expected session %+v, got %+v", want, hook.sessions[0])
+	}
+}
+
+func TestCommandHookSeesEditorCommands(t *testing.T) {
+	tm := NewMonitor(nil, nil, nil)
+	defer tm.Stop()
+	hook := &recordingHook{}
+	tm.AddCommandHook(hook)
+	tm.RegisterSession("u1", "s1", "c1", "/home/u1")
+
+	tm.handleCommandExecuted(context.Background(), "u1", "s1", &CommandEntry{Command: "vim notes.txt"})
+
+	if len(hook.entries) != 1 {
+		t.Fatalf("expected editor command to reach hooks, got %d entries", len(hook.entries))
+	}
+}
+
+func TestCommandHookPanicDoesNotStopLaterHooks(t *testing.T) {
+	tm := NewMonitor(nil, nil, nil)
+	defer tm.Stop()
+	var listened []string
+	tm.AddCommandHook(panickingHook{})
+	tm.AddCommandHook(CommandListener(func(_ identity.SessionKey, entry CommandEntry) {
+		listened = append(listened, entry.Command)
+	}))
+	tm.RegisterSession("u1", "s1", "c1", "/home/u1")
+
+	tm.handleCommandExecuted(context.Background(), "u1", "s1", &CommandEntry{Command: "pwd"})
+
+	if len(listened) != 1 || listened[0] != "pwd" {
+		t.Fatalf("expected listener after a panicking hook to run, got %v", listened)
+	}
+}
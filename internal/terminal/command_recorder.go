@@ -0,0 +1,76 @@
+package terminal
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/store"
+)
+
+const (
+	// commandRecorderQueueSize bounds commands waiting to be written.
+	commandRecorderQueueSize = 256
+	// commandInsertTimeout bounds a single insert.
+	commandInsertTimeout = 5 * time.Second
+)
+
+// CommandRecorder is a CommandHook that persists completed commands in the
+// repository, so history survives restarts. Writes happen on a background
+// worker; when the repository falls behind, commands are dropped rather than
+// stalling the monitor.
+type CommandRecorder struct {
+	repo  store.Repository
+	queue chan *domain.CommandRecord
+}
+
+// NewCommandRecorder creates a recorder. Call Start before registering it.
+func NewCommandRecorder(repo store.Repository) *CommandRecorder {
+	return &CommandRecorder{
+		repo:  repo,
+		queue: make(chan *domain.CommandRecord, commandRecorderQueueSize),
+	}
+}
+
+// Start runs the writer until ctx is cancelled.
+func (r *CommandRecorder) Start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case c := <-r.queue:
+				r.insert(ctx, c)
+			}
+		}
+	}()
+}
+
+// OnCommandCompleted implements CommandHook.
+func (r *CommandRecorder) OnCommandCompleted(entry CommandEntry, session CommandSession) {
+	c := &domain.CommandRecord{
+		UserID:    session.UserID,
+		SessionID: session.SessionID,
+		Sequence:  entry.Sequence,
+		Command:   entry.Command,
+		PWD:       entry.PWD,
+		ExitCode:  entry.ExitCode,
+		Duration:  entry.Duration,
+		StartedAt: entry.StartTime,
+		EndedAt:   entry.EndTime,
+	}
+	select {
+	case r.queue <- c:
+	default:
+		slog.Warn("Command history queue full, dropping command", "user_id", session.UserID, "session_id", session.SessionID)
+	}
+}
+
+func (r *CommandRecorder) insert(ctx context.Context, c *domain.CommandRecord) {
+	ctx, cancel := context.WithTimeout(ctx, commandInsertTimeout)
+	defer cancel()
+	if err := r.repo.InsertCommand(ctx, c); err != nil {
+		slog.Error("Failed to persist command", "error", err, "user_id", c.UserID, "session_id", c.SessionID)
+	}
+}
@@ -0,0 +1,68 @@
+package terminal
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/store"
+)
+
+// commandRepo records inserted commands.
+type commandRepo struct {
+	store.Repository
+	mu       sync.Mutex
+	commands []*domain.CommandRecord
+}
+
+func (r *commandRepo) InsertCommand(_ context.Context, c *domain.CommandRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = append(r.commands, c)
+	return nil
+}
+
+func (r *commandRepo) inserted() []*domain.CommandRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*domain.CommandRecord(nil), r.commands...)
+}
+
+func TestCommandRecorderPersistsCompletedCommands(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := &commandRepo{}
+	recorder := NewCommandRecorder(repo)
+	recorder.Start(ctx)
+
+	tm := NewMonitor(nil, nil, nil)
+	defer tm.Stop()
+	tm.AddCommandHook(recorder)
+	tm.RegisterSession("u1", "s1", "c1", "/home/u1")
+
+	start := time.Unix(1_700_000_000, 0)
+	tm.handleCommandExecuted(ctx, "u1", "s1", &CommandEntry{
+		Sequence:  1,
+		Command:   "ls -la",
+		PWD:       "/home/learner",
+		ExitCode:  2,
+		Duration:  time.Second,
+		StartTime: start,
+		EndTime:   start.Add(time.Second),
+	})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(repo.inserted()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	commands := repo.inserted()
+	if len(commands) != 1 {
+		t.Fatalf("expected one persisted command, got %d", len(commands))
+	}
+	c := commands[0]
+	if c.UserID != "u1" || c.SessionID != "s1" || c.Command != "ls -la" || c.ExitCode != 2 || !c.EndedAt.Equal(start.Add(time.Second)) {
+		t.Fatalf("unexpected persisted command: %+v", c)
+	}
+}
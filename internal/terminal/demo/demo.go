@@ -0,0 +1,244 @@
+// Package demo keeps a library of terminal demos recorded by instructors.
+//
+// A demo is recorded from an instructor's live terminal session and saved as
+// a replay transcript (see internal/terminal/replay), one JSON file per demo.
+// When served, the transcript is split into steps at every command the
+// instructor submitted, so learners can play the whole demo or step through
+// it one command at a time.
+package demo
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ashureev/shsh-labs/internal/terminal"
+	"github.com/ashureev/shsh-labs/internal/terminal/replay"
+)
+
+// Errors returned by the library.
+var (
+	ErrInvalidName  = errors.New("demo names are 1-64 lowercase letters, digits or dashes")
+	ErrNotFound     = errors.New("demo not found")
+	ErrRecording    = errors.New("a recording is already in progress")
+	ErrNotRecording = errors.New("no recording in progress")
+	ErrEmpty        = errors.New("recording captured no terminal output")
+)
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+// Summary describes a demo in the library listing.
+type Summary struct {
+	Name       string    `json:"name"`
+	Title      string    `json:"title,omitempty"`
+	StepCount  int       `json:"step_count"`
+	DurationMS int64     `json:"duration_ms"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// Demo is a recorded demo split into steps.
+type Demo struct {
+	Summary
+	Steps []Step `json:"steps"`
+}
+
+// Step is the output of one command: its echo as it was typed, what it
+// printed and the next prompt. The first step also holds anything printed
+// before the first keystroke.
+type Step struct {
+	Command string  `json:"command,omitempty"`
+	Frames  []Frame `json:"frames"`
+}
+
+// Frame is a chunk of output and the pause before it.
+type Frame struct {
+	DelayMS int    `json:"delay_ms"`
+	Data    string `json:"data"`
+}
+
+// PlaybackFrames converts the step's frames for PTYController.Play.
+func (s Step) PlaybackFrames() []terminal.PlaybackFrame {
+	frames := make([]terminal.PlaybackFrame, len(s.Frames))
+	for i, f := range s.Frames {
+		frames[i] = terminal.PlaybackFrame{
+			Delay: time.Duration(f.DelayMS) * time.Millisecond,
+			Data:  []byte(f.Data),
+		}
+	}
+	return frames
+}
+
+// Library stores demos as transcripts in a directory and records new ones.
+type Library struct {
+	dir         string
+	maxDuration time.Duration
+
+	mu         sync.Mutex
+	recordings map[string]*recording // by demo name
+}
+
+// NewLibrary creates a library in dir. Recordings stop capturing after
+// maxDuration; zero means no limit.
+func NewLibrary(dir string, maxDuration time.Duration) *Library {
+	return &Library{
+		dir:         dir,
+		maxDuration: maxDuration,
+		recordings:  make(map[string]*recording),
+	}
+}
+
+// List returns the saved demos sorted by name. Files that fail to load are
+// skipped.
+func (l *Library) List() ([]Summary, error) {
+	entries, err := os.ReadDir(l.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Summary{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read demo directory: %w", err)
+	}
+
+	summaries := make([]Summary, 0, len(entries))
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || e.IsDir() || !namePattern.MatchString(name) {
+			continue
+		}
+		d, err := l.Get(name)
+		if err != nil {
+			slog.Warn("Skipping unreadable demo", "error", err, "demo", name)
+			continue
+		}
+		summaries = append(summaries, d.Summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Name < summaries[j].Name })
+	return summaries, nil
+}
+
+// Get loads a demo and splits it into steps.
+func (l *Library) Get(name string) (*Demo, error) {
+	if !namePattern.MatchString(name) {
+		return nil, ErrInvalidName
+	}
+	path := l.path(name)
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("stat demo: %w", err)
+	}
+	t, err := replay.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Demo{
+		Summary: Summary{Name: name, Title: t.Description, RecordedAt: info.ModTime().UTC()},
+		Steps:   splitSteps(t.Events),
+	}
+	d.StepCount = len(d.Steps)
+	for _, ev := range t.Events {
+		d.DurationMS += int64(ev.DelayMS)
+	}
+	return d, nil
+}
+
+// Delete removes a saved demo.
+func (l *Library) Delete(name string) error {
+	if !namePattern.MatchString(name) {
+		return ErrInvalidName
+	}
+	if err := os.Remove(l.path(name)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("delete demo: %w", err)
+	}
+	return nil
+}
+
+func (l *Library) path(name string) string {
+	return filepath.Join(l.dir, name+".json")
+}
+
+// splitSteps groups transcript events into steps. A step ends once a command
+// is submitted with Enter and its output has been printed, i.e. at the next
+// keystroke. Pauses before input are carried over to the next output frame.
+func splitSteps(events []replay.Event) []Step {
+	steps := []Step{{Frames: []Frame{}}}
+	var command []rune
+	submitted := false
+	delay := 0
+
+	for _, ev := range events {
+		delay += ev.DelayMS
+		cur := &steps[len(steps)-1]
+		switch ev.Direction {
+		case replay.DirectionInput:
+			if submitted {
+				steps = append(steps, Step{Frames: []Frame{}})
+				cur = &steps[len(steps)-1]
+				command, submitted = nil, false
+			}
+			command, submitted = applyInput(command, ev.Data)
+			cur.Command = strings.TrimSpace(string(command))
+		case replay.DirectionOutput:
+			cur.Frames = append(cur.Frames, Frame{DelayMS: delay, Data: ev.Data})
+			delay = 0
+		}
+	}
+	return steps
+}
+
+// applyInput applies keystrokes to the command line being typed. It handles
+// backspace and Ctrl-U and ignores other control keys and escape sequences,
+// which is enough to label a step; the output frames show what really
+// happened.
+func applyInput(line []rune, data string) ([]rune, bool) {
+	submitted := false
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRuneInString(data[i:])
+		i += size
+		switch {
+		case r == '\r' || r == '\n':
+			submitted = true
+		case r == 0x7f || r == '\b':
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+			}
+		case r == 0x15: // Ctrl-U
+			line = line[:0]
+		case r == 0x1b:
+			i += escapeLength(data[i:])
+		case r >= 0x20 && !submitted:
+			line = append(line, r)
+		}
+	}
+	return line, submitted
+}
+
+// escapeLength returns the length of the escape sequence body following ESC
+// in s, e.g. "[A" for the up arrow.
+func escapeLength(s string) int {
+	if s == "" {
+		return 0
+	}
+	if s[0] != '[' && s[0] != 'O' {
+		return 1
+	}
+	for i := 1; i < len(s); i++ {
+		if s[i] >= 0x40 && s[i] <= 0x7e {
+			return i + 1
+		}
+	}
+	return len(s)
+}
@@ -0,0 +1,88 @@
+package demo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/terminal"
+	"github.com/ashureev/shsh-labs/internal/terminal/replay"
+)
+
+var _ terminal.SessionTap = (*Library)(nil)
+
+func TestLibraryRecordAndGet(t *testing.T) {
+	lib := NewLibrary(t.TempDir(), time.Hour)
+	if err := lib.StartRecording("ls-basics", "Listing files", "anon_1"); err != nil {
+		t.Fatalf("StartRecording() error = %v", err)
+	}
+	if err := lib.StartRecording("other", "", "anon_1"); !errors.Is(err, ErrRecording) {
+		t.Fatalf("second recording for the same user: got %v, want ErrRecording", err)
+	}
+
+	lib.TapOutput("anon_1", "tab1", []byte("$ "))
+	lib.TapInput("anon_1", "tab1", []byte("lx"))
+	lib.TapInput("anon_1", "tab2", []byte("ignored"))
+	lib.TapOutput("anon_2", "tab1", []byte("other user"))
+	lib.TapInput("anon_1", "tab1", []byte("\x7fs\r"))
+	lib.TapOutput("anon_1", "tab1", []byte("lxs\r\nnotes.txt\r\n\xe2\x9c"))
+	lib.TapOutput("anon_1", "tab1", []byte("\x93\r\n$ "))
+	lib.TapInput("anon_1", "tab1", []byte("pwd\r"))
+	lib.TapOutput("anon_1", "tab1", []byte("pwd\r\n/home/learner\r\n$ "))
+
+	d, err := lib.StopRecording("ls-basics")
+	if err != nil {
+		t.Fatalf("StopRecording() error = %v", err)
+	}
+	if d.Title != "Listing files" || d.StepCount != 2 {
+		t.Fatalf("unexpected summary: %+v", d.Summary)
+	}
+	if got := []string{d.Steps[0].Command, d.Steps[1].Command}; got[0] != "ls" || got[1] != "pwd" {
+		t.Fatalf("step commands = %q", got)
+	}
+	if f := d.Steps[0].Frames; len(f) != 3 || f[0].Data != "$ " || f[1].Data != "lxs\r\nnotes.txt\r\n" || f[2].Data != "✓\r\n$ " {
+		t.Fatalf("step 0 frames = %+v", f)
+	}
+
+	summaries, err := lib.List()
+	if err != nil || len(summaries) != 1 || summaries[0].Name != "ls-basics" {
+		t.Fatalf("List() = %+v, %v", summaries, err)
+	}
+	if _, err := lib.StopRecording("ls-basics"); !errors.Is(err, ErrNotRecording) {
+		t.Fatalf("StopRecording() twice: got %v, want ErrNotRecording", err)
+	}
+	if err := lib.Delete("ls-basics"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := lib.Get("ls-basics"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get() after delete: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestLibraryRejectsEmptyAndInvalid(t *testing.T) {
+	lib := NewLibrary(t.TempDir(), 0)
+	if err := lib.StartRecording("../etc", "", "anon_1"); !errors.Is(err, ErrInvalidName) {
+		t.Fatalf("got %v, want ErrInvalidName", err)
+	}
+	if err := lib.StartRecording("quiet", "", "anon_1"); err != nil {
+		t.Fatal(err)
+	}
+	lib.TapInput("anon_1", "tab1", []byte("ls\r"))
+	if _, err := lib.StopRecording("quiet"); !errors.Is(err, ErrEmpty) {
+		t.Fatalf("got %v, want ErrEmpty", err)
+	}
+}
+
+func TestSplitStepsCarriesDelays(t *testing.T) {
+	steps := splitSteps([]replay.Event{
+		{Direction: replay.DirectionOutput, Data: "$ "},
+		{Direction: replay.DirectionInput, Data: "echo hi\x1b[D\r", DelayMS: 400},
+		{Direction: replay.DirectionOutput, Data: "hi\r\n", DelayMS: 30},
+	})
+	if len(steps) != 1 || steps[0].Command != "echo hi" || len(steps[0].Frames) != 2 {
+		t.Fatalf("steps = %+v", steps)
+	}
+	if got := steps[0].Frames[1].DelayMS; got != 430 {
+		t.Fatalf("delay = %d, want input pause carried over (430)", got)
+	}
+}
@@ -0,0 +1,187 @@
+package demo
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ashureev/shsh-labs/internal/terminal/replay"
+)
+
+// maxRecordingBytes bounds the terminal traffic kept for one demo.
+const maxRecordingBytes = 4 << 20
+
+// recording captures one terminal session of an instructor. It locks onto
+// the first session (browser tab) with traffic once started.
+type recording struct {
+	title     string
+	userID    string
+	sessionID string
+	started   time.Time
+	last      time.Time
+	size      int
+	full      bool
+	pending   []byte // Output ending in an incomplete UTF-8 sequence
+	events    []replay.Event
+}
+
+// StartRecording starts recording the next terminal session of userID with
+// traffic, to be saved as demo name when stopped.
+func (l *Library) StartRecording(name, title, userID string) error {
+	if !namePattern.MatchString(name) {
+		return ErrInvalidName
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.recordings[name]; ok {
+		return ErrRecording
+	}
+	for _, rec := range l.recordings {
+		if rec.userID == userID {
+			return ErrRecording
+		}
+	}
+	now := time.Now()
+	l.recordings[name] = &recording{title: title, userID: userID, started: now, last: now}
+	return nil
+}
+
+// StopRecording ends a recording and saves it to the library, replacing any
+// demo of the same name.
+func (l *Library) StopRecording(name string) (*Demo, error) {
+	rec, err := l.takeRecording(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(rec.pending) > 0 {
+		rec.add(replay.DirectionOutput, rec.pending, rec.last)
+	}
+	hasOutput := false
+	for _, ev := range rec.events {
+		hasOutput = hasOutput || ev.Direction == replay.DirectionOutput
+	}
+	if !hasOutput {
+		return nil, ErrEmpty
+	}
+
+	t := replay.Transcript{Name: name, Description: rec.title, Events: rec.events}
+	if err := l.save(name, &t); err != nil {
+		return nil, err
+	}
+	slog.Info("Demo recorded", "demo", name, "user_id", rec.userID, "events", len(rec.events), "bytes", rec.size)
+	return l.Get(name)
+}
+
+func (l *Library) takeRecording(name string) (*recording, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rec, ok := l.recordings[name]
+	if !ok {
+		return nil, ErrNotRecording
+	}
+	delete(l.recordings, name)
+	return rec, nil
+}
+
+// save writes the transcript through a temporary file so readers never see
+// a partial demo.
+func (l *Library) save(name string, t *replay.Transcript) error {
+	if err := os.MkdirAll(l.dir, 0o750); err != nil {
+		return fmt.Errorf("create demo directory: %w", err)
+	}
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal demo: %w", err)
+	}
+	f, err := os.CreateTemp(l.dir, "."+name+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("create demo file: %w", err)
+	}
+	tmp := f.Name()
+	defer func() { _ = os.Remove(tmp) }()
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("write demo: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close demo file: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(l.dir, name+".json")); err != nil {
+		return fmt.Errorf("save demo: %w", err)
+	}
+	return nil
+}
+
+// TapInput implements terminal.SessionTap.
+func (l *Library) TapInput(userID, sessionID string, p []byte) {
+	l.tap(userID, sessionID, replay.DirectionInput, p)
+}
+
+// TapOutput implements terminal.SessionTap.
+func (l *Library) TapOutput(userID, sessionID string, p []byte) {
+	l.tap(userID, sessionID, replay.DirectionOutput, p)
+}
+
+func (l *Library) tap(userID, sessionID, dir string, p []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.recordings) == 0 {
+		return
+	}
+	now := time.Now()
+	for name, rec := range l.recordings {
+		if rec.userID != userID || rec.full {
+			continue
+		}
+		if rec.sessionID == "" {
+			rec.sessionID = sessionID
+		} else if rec.sessionID != sessionID {
+			continue
+		}
+		if (l.maxDuration > 0 && now.Sub(rec.started) > l.maxDuration) || rec.size+len(p) > maxRecordingBytes {
+			rec.full = true
+			slog.Warn("Demo recording limit reached, ignoring further traffic", "demo", name, "user_id", userID)
+			continue
+		}
+		data := p
+		if dir == replay.DirectionOutput {
+			// Hold back a trailing partial character: transcripts store text.
+			data = append(rec.pending, p...)
+			cut := completeUTF8(data)
+			rec.pending = append([]byte(nil), data[cut:]...)
+			data = data[:cut]
+		}
+		if len(data) > 0 {
+			rec.add(dir, data, now)
+		}
+	}
+}
+
+// add appends an event, timed relative to the previous one.
+func (r *recording) add(dir string, p []byte, at time.Time) {
+	r.events = append(r.events, replay.Event{
+		Direction: dir,
+		Data:      string(p),
+		DelayMS:   int(at.Sub(r.last).Milliseconds()),
+	})
+	r.last = at
+	r.size += len(p)
+}
+
+// completeUTF8 returns the length of the longest prefix of p that does not
+// end inside a multi-byte UTF-8 sequence.
+func completeUTF8(p []byte) int {
+	for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(p[i]) {
+			if utf8.FullRune(p[i:]) {
+				return len(p)
+			}
+			return i
+		}
+	}
+	return len(p)
+}
@@ -0,0 +1,128 @@
+package terminal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/agent"
+)
+
+const (
+	// defaultNotifyCommandAfter is how long a command must run before its
+	// completion in a hidden tab is relayed as a desktop notification.
+	defaultNotifyCommandAfter = 10 * time.Second
+	// bellNotifyInterval limits bell notifications per session, so a program
+	// ringing in a loop produces one notification rather than a stream.
+	bellNotifyInterval = 10 * time.Second
+)
+
+// SetDesktopNotifications configures which events in a hidden tab are relayed
+// to the browser as desktop notifications: terminal bells, and completions of
+// commands that ran for at least commandAfter (0 disables those).
+func (tm *Monitor) SetDesktopNotifications(bell bool, commandAfter time.Duration) {
+	tm.notifyBell = bell
+	tm.notifyAfter = max(commandAfter, 0)
+}
+
+// relayBell sends a bell notification if data rings the bell while the
+// session's tab is hidden.
+func (tm *Monitor) relayBell(ctx context.Context, session *SessionState, data []byte) {
+	if !session.ringBell(data, time.Now()) {
+		return
+	}
+	tm.sendToSidebar(ctx, session.UserID, &agent.Response{
+		Type:      string(agent.ResponseTypeBell),
+		Content:   "Your terminal rang the bell.",
+		UserID:    session.UserID,
+		SessionID: session.SessionID,
+	})
+}
+
+// ringBell scans data for a bell and reports whether it should be relayed:
+// the tab is hidden and no bell was relayed within bellNotifyInterval.
+func (s *SessionState) ringBell(data []byte, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.bell.scan(data) || !s.Suspended || now.Sub(s.lastBellNotify) < bellNotifyInterval {
+		return false
+	}
+	s.lastBellNotify = now
+	return true
+}
+
+// relayCommandFinished sends a notification when a long-running command
+// finishes while the session's tab is hidden.
+func (tm *Monitor) relayCommandFinished(ctx context.Context, session *SessionState, entry *CommandEntry) {
+	if tm.notifyAfter <= 0 || entry.Duration < tm.notifyAfter || !session.IsSuspended() {
+		return
+	}
+
+	took := entry.Duration.Round(time.Second)
+	body := fmt.Sprintf("`%s` finished after %s.", entry.Command, took)
+	if entry.ExitCode != ExitCodeUnknown {
+		body = fmt.Sprintf("`%s` exited with %d after %s.", entry.Command, entry.ExitCode, took)
+	}
+	tm.sendToSidebar(ctx, session.UserID, &agent.Response{
+		Type:      string(agent.ResponseTypeCommandFinished),
+		Content:   body,
+		UserID:    session.UserID,
+		SessionID: session.SessionID,
+	})
+}
+
+// bellScanner finds BEL characters in terminal output across chunk
+// boundaries. BEL also terminates OSC strings, such as the shell integration
+// markers and window titles; those do not count as bells.
+type bellScanner struct {
+	state bellScanState
+}
+
+type bellScanState uint8
+
+const (
+	bellScanText      bellScanState = iota
+	bellScanEscape                  // after ESC
+	bellScanString                  // inside an OSC, DCS, APC, PM or SOS string
+	bellScanStringEsc               // after ESC inside a string
+)
+
+// scan reports whether data contains a bell.
+func (b *bellScanner) scan(data []byte) bool {
+	rang := false
+	for _, c := range data {
+		switch b.state {
+		case bellScanText:
+			switch c {
+			case 0x1b:
+				b.state = bellScanEscape
+			case 0x07:
+				rang = true
+			}
+		case bellScanEscape:
+			switch c {
+			case ']', 'P', '_', '^', 'X':
+				b.state = bellScanString
+			case 0x1b:
+			default:
+				b.state = bellScanText
+			}
+		case bellScanString:
+			switch c {
+			case 0x07:
+				b.state = bellScanText
+			case 0x1b:
+				b.state = bellScanStringEsc
+			}
+		case bellScanStringEsc:
+			switch c {
+			case '\\':
+				b.state = bellScanText
+			case 0x1b:
+			default:
+				b.state = bellScanString
+			}
+		}
+	}
+	return rang
+}
@@ -0,0 +1,91 @@
+package terminal
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/agent"
+)
+
+func TestBellScannerIgnoresStringTerminators(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   bool
+	}{
+		{name: "plain bell", chunks: []string{"done\a"}, want: true},
+		{name: "osc 133 marker", chunks: []string{"\x1b]133;D;0\a$ "}, want: false},
+		{name: "window title", chunks: []string{"\x1b]0;user@host\a"}, want: false},
+		{name: "osc split across chunks", chunks: []string{"\x1b]13", "3;A\a"}, want: false},
+		{name: "bell after st-terminated osc", chunks: []string{"\x1b]0;t\x1b\\", "\a"}, want: true},
+		{name: "csi sequence", chunks: []string{"\x1b[31mred\x1b[0m"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bellScanner
+			got := false
+			for _, chunk := range tt.chunks {
+				got = b.scan([]byte(chunk)) || got
+			}
+			if got != tt.want {
+				t.Fatalf("scan = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBellRelayedOnlyWhileHiddenAndRateLimited(t *testing.T) {
+	sidebar := make(chan *agent.Response, 4)
+	tm := NewMonitor(nil, sidebar, nil)
+	defer tm.Stop()
+
+	ctx := context.Background()
+	tm.RegisterSession("u1", "s1", "c1", "/home/u1")
+	tm.ProcessOutput(ctx, "u1", "s1", []byte("\a"))
+	if len(sidebar) != 0 {
+		t.Fatal("expected no notification while visible")
+	}
+
+	tm.SetSessionVisible(ctx, "u1", "s1", false)
+	tm.ProcessOutput(ctx, "u1", "s1", []byte("\a"))
+	tm.ProcessOutput(ctx, "u1", "s1", []byte("\a"))
+	if len(sidebar) != 1 {
+		t.Fatalf("expected one rate-limited notification, got %d", len(sidebar))
+	}
+	if resp := <-sidebar; resp.Type != string(agent.ResponseTypeBell) || resp.SessionID != "s1" {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+
+	session := tm.GetSessionState("u1", "s1")
+	if !session.ringBell([]byte("\a"), time.Now().Add(bellNotifyInterval)) {
+		t.Fatal("expected bell to be relayed again after the interval")
+	}
+}
+
+func TestLongCommandRelayedWhileHidden(t *testing.T) {
+	sidebar := make(chan *agent.Response, 4)
+	tm := NewMonitor(nil, sidebar, nil)
+	defer tm.Stop()
+	tm.SetDesktopNotifications(false, time.Minute)
+
+	ctx := context.Background()
+	tm.RegisterSession("u1", "s1", "c1", "/home/u1")
+	tm.SetSessionVisible(ctx, "u1", "s1", false)
+
+	tm.handleCommandExecuted(ctx, "u1", "s1", &CommandEntry{Command: "sleep 1", Duration: time.Second})
+	if len(sidebar) != 0 {
+		t.Fatal("expected no notification for a short command")
+	}
+
+	tm.handleCommandExecuted(ctx, "u1", "s1", &CommandEntry{Command: "make", ExitCode: 2, Duration: 90 * time.Second})
+	select {
+	case resp := <-sidebar:
+		if resp.Type != string(agent.ResponseTypeCommandFinished) || !strings.Contains(resp.Content, "`make` exited with 2 after 1m30s") {
+			t.Fatalf("unexpected response %+v", resp)
+		}
+	default:
+		t.Fatal("expected a command notification")
+	}
+}
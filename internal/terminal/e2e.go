@@ -0,0 +1,288 @@
+package terminal
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/coder/websocket"
+)
+
+// End-to-end terminal encryption. The browser offers an ephemeral P-256 key
+// in the e2e query parameter and the server answers with its own in a plain
+// {"type":"e2e","key":...,"sig":...} message, signed with the deployment's
+// signing key. The browser checks the signature against the public key built
+// into the page bundle, so a proxy relaying the connection cannot put its own
+// key in place of the server's.
+//
+// Only terminal content is sealed: keystrokes on their way in and output on
+// its way out travel in binary frames under AES-256-GCM, with a key per
+// direction derived with HKDF-SHA256 from the shared secret. The nonce
+// counts the frames sent in its direction, so a frame that is dropped,
+// replayed or reordered fails to open and ends the connection. Control
+// messages (resizes, pings, pair status, errors) stay plain JSON in text
+// frames; they carry no commands or output.
+//
+// Keystrokes are opened just before they enter the shell and the monitor,
+// and output is sealed once the monitor has seen it. The connection
+// registry, the pair fan-out and control message handling only ever pass
+// sealed frames.
+
+// e2eKeyParam is the query parameter carrying the browser's public key.
+const e2eKeyParam = "e2e"
+
+// e2eInfo binds derived keys and signatures to this protocol and its
+// version.
+const e2eInfo = "shsh-labs terminal e2e v2"
+
+var (
+	errE2EKey        = errors.New("invalid e2e public key")
+	errE2EFrame      = errors.New("e2e frame failed to open")
+	errE2ENoOffer    = errors.New("e2e key offer required")
+	errE2ESigningKey = errors.New("e2e signing key must be a base64 PKCS#8 P-256 key")
+	errE2EPlainInput = errors.New("plain input on an encrypted terminal")
+)
+
+// ParseE2ESigningKey parses the base64 PKCS#8 DER encoding of the P-256 key
+// signing the server's key shares.
+func ParseE2ESigningKey(encoded string) (*ecdsa.PrivateKey, error) {
+	der, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errE2ESigningKey, err)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errE2ESigningKey, err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok || key.Curve != elliptic.P256() {
+		return nil, errE2ESigningKey
+	}
+	return key, nil
+}
+
+// E2EPublicKey returns the base64 SPKI DER encoding of the signing key's
+// public half, the form the frontend pins.
+func E2EPublicKey(key *ecdsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("encode e2e public key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(der), nil
+}
+
+// e2eAnswer is the server's reply to a key offer.
+type e2eAnswer struct {
+	Type string `json:"type"`
+	Key  string `json:"key"` // Server's public key, base64url
+	Sig  string `json:"sig"` // ECDSA signature of the transcript, r || s, base64url
+}
+
+// frameCipher seals a connection's outgoing frames and opens its incoming
+// ones.
+type frameCipher struct {
+	mu      sync.Mutex // Held across sealing and writing, so frames leave in nonce order
+	seal    cipher.AEAD
+	sendSeq uint64
+
+	open    cipher.AEAD
+	recvSeq uint64 // Only touched by the connection's single reader
+}
+
+// negotiateE2E answers the key offered in r, returning the frame cipher and
+// the signed answer to send back. It returns errE2ENoOffer if r offers no
+// key.
+func negotiateE2E(r *http.Request, signingKey *ecdsa.PrivateKey) (*frameCipher, *e2eAnswer, error) {
+	offer := r.URL.Query().Get(e2eKeyParam)
+	if offer == "" {
+		return nil, nil, errE2ENoOffer
+	}
+	clientPub, err := base64.RawURLEncoding.DecodeString(offer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", errE2EKey, err)
+	}
+	peer, err := ecdh.P256().NewPublicKey(clientPub)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", errE2EKey, err)
+	}
+	priv, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate e2e key: %w", err)
+	}
+	shared, err := priv.ECDH(peer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", errE2EKey, err)
+	}
+	serverPub := priv.PublicKey().Bytes()
+	sig, err := signE2EKeys(signingKey, clientPub, serverPub)
+	if err != nil {
+		return nil, nil, err
+	}
+	toServer, toClient, err := deriveFrameKeys(shared, clientPub, serverPub)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := newFrameCipher(toClient, toServer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, &e2eAnswer{
+		Type: "e2e",
+		Key:  base64.RawURLEncoding.EncodeToString(serverPub),
+		Sig:  base64.RawURLEncoding.EncodeToString(sig),
+	}, nil
+}
+
+// e2eTranscript returns the digest a key exchange's signature covers.
+func e2eTranscript(clientPub, serverPub []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(e2eInfo))
+	h.Write(clientPub)
+	h.Write(serverPub)
+	return h.Sum(nil)
+}
+
+// signE2EKeys signs both public keys of an exchange, returning the fixed
+// size r || s encoding WebCrypto verifies.
+func signE2EKeys(key *ecdsa.PrivateKey, clientPub, serverPub []byte) ([]byte, error) {
+	r, s, err := ecdsa.Sign(rand.Reader, key, e2eTranscript(clientPub, serverPub))
+	if err != nil {
+		return nil, fmt.Errorf("sign e2e keys: %w", err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return sig, nil
+}
+
+// deriveFrameKeys derives the keys of frames sent to the server and to the
+// client from the ECDH shared secret. Both public keys salt the derivation.
+func deriveFrameKeys(shared, clientPub, serverPub []byte) (toServer, toClient []byte, err error) {
+	salt := append(append([]byte{}, clientPub...), serverPub...)
+	keys, err := hkdf.Key(sha256.New, shared, salt, e2eInfo, 64)
+	if err != nil {
+		return nil, nil, fmt.Errorf("derive e2e keys: %w", err)
+	}
+	return keys[:32], keys[32:], nil
+}
+
+// newFrameCipher creates a cipher sealing with sealKey and opening with
+// openKey.
+func newFrameCipher(sealKey, openKey []byte) (*frameCipher, error) {
+	seal, err := newGCM(sealKey)
+	if err != nil {
+		return nil, err
+	}
+	open, err := newGCM(openKey)
+	if err != nil {
+		return nil, err
+	}
+	return &frameCipher{seal: seal, open: open}, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create e2e cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("create e2e cipher: %w", err)
+	}
+	return aead, nil
+}
+
+// frameNonce returns the nonce of the seq-th frame of a direction.
+func frameNonce(seq uint64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], seq)
+	return nonce
+}
+
+// write seals terminal output and writes it to conn.
+func (c *frameCipher) write(ctx context.Context, conn *websocket.Conn, p []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	frame := c.seal.Seal(nil, frameNonce(c.sendSeq), p, nil)
+	c.sendSeq++
+	return conn.Write(ctx, websocket.MessageBinary, frame)
+}
+
+// openFrame opens the next frame read from the connection.
+func (c *frameCipher) openFrame(typ websocket.MessageType, frame []byte) ([]byte, error) {
+	if typ != websocket.MessageBinary {
+		return nil, errE2EPlainInput
+	}
+	plain, err := c.open.Open(nil, frameNonce(c.recvSeq), frame, nil)
+	if err != nil {
+		return nil, errE2EFrame
+	}
+	c.recvSeq++
+	return plain, nil
+}
+
+// terminalConn is a connection terminal output is written to, with the
+// cipher sealing it when the connection is end-to-end encrypted.
+type terminalConn struct {
+	conn   *websocket.Conn
+	sealer *frameCipher // nil for plain connections
+}
+
+// writeOutput writes terminal output to the connection, sealed if it is
+// encrypted.
+func (c terminalConn) writeOutput(ctx context.Context, p []byte) error {
+	if c.sealer != nil {
+		return c.sealer.write(ctx, c.conn, p)
+	}
+	return c.conn.Write(ctx, websocket.MessageBinary, p)
+}
+
+// SetE2ESigningKey sets the key signing the server's key shares, required
+// when terminals are end-to-end encrypted.
+func (h *WebSocketHandler) SetE2ESigningKey(key *ecdsa.PrivateKey) {
+	h.e2eKey = key
+}
+
+// acceptE2E negotiates encryption of a new connection when the server
+// requires it, answering the browser's key in plain text. It returns the
+// connection's cipher, nil for plain connections, and reports whether the
+// connection may be used; refused connections have been told why.
+func (h *WebSocketHandler) acceptE2E(ws *websocket.Conn, r *http.Request, userID string) (*frameCipher, bool) {
+	if h.cfg == nil || !h.cfg.Terminal.E2E {
+		return nil, true
+	}
+	if h.e2eKey == nil {
+		slog.Error("Terminal refused: end-to-end encryption has no signing key", "user_id", userID)
+		if err := h.writeJSON(ws, map[string]string{"error": "e2e_unavailable"}); err != nil {
+			slog.Debug("Failed to send e2e_unavailable error", "error", err)
+		}
+		return nil, false
+	}
+	c, answer, err := negotiateE2E(r, h.e2eKey)
+	if err != nil {
+		slog.Warn("Terminal refused without end-to-end encryption", "error", err, "user_id", userID)
+		if err := h.writeJSON(ws, map[string]string{"error": "e2e_required"}); err != nil {
+			slog.Debug("Failed to send e2e_required error", "error", err)
+		}
+		return nil, false
+	}
+	if err := h.writeJSON(ws, answer); err != nil {
+		slog.Debug("Failed to send e2e key", "error", err, "user_id", userID)
+		return nil, false
+	}
+	return c, true
+}
@@ -0,0 +1,307 @@
+package terminal
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/coder/websocket"
+)
+
+func newTestSigningKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate signing key: %v", err)
+	}
+	return key
+}
+
+// newE2EHandler returns a handler requiring end-to-end encryption, signing
+// with key.
+func newE2EHandler(sm *SessionManager, key *ecdsa.PrivateKey) *WebSocketHandler {
+	h := &WebSocketHandler{sm: sm, cfg: &config.Config{Terminal: config.TerminalConfig{E2E: true, MaxInputSize: defaultWSMaxInputSize}}}
+	h.SetE2ESigningKey(key)
+	return h
+}
+
+// newE2EServer serves the test partner's follower terminal with end-to-end
+// encryption required.
+func newE2EServer(t *testing.T, h *WebSocketHandler) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer func() { _ = ws.CloseNow() }()
+		sealer, ok := h.acceptE2E(ws, r, testPartnerID)
+		if !ok {
+			return
+		}
+		h.serveFollower(r.Context(), terminalConn{conn: ws, sealer: sealer}, testPartnerID)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// dialE2E connects offering a fresh key, checks the server's answer is
+// signed by pinned and returns the connection with the client's side of the
+// frame cipher.
+func dialE2E(ctx context.Context, t *testing.T, url string, pinned *ecdsa.PublicKey) (*websocket.Conn, *frameCipher) {
+	t.Helper()
+	priv, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	clientPub := priv.PublicKey().Bytes()
+	conn, _, err := websocket.Dial(ctx, url+"?"+e2eKeyParam+"="+base64.RawURLEncoding.EncodeToString(clientPub), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.CloseNow() })
+
+	_, data, err := conn.Read(ctx)
+	if err != nil {
+		t.Fatalf("read e2e key: %v", err)
+	}
+	var answer e2eAnswer
+	if err := json.Unmarshal(data, &answer); err != nil || answer.Type != "e2e" {
+		t.Fatalf("expected the server's e2e key, got %s", data)
+	}
+	serverPub, _ := base64.RawURLEncoding.DecodeString(answer.Key)
+	sig, _ := base64.RawURLEncoding.DecodeString(answer.Sig)
+	if !verifyE2EAnswer(pinned, clientPub, serverPub, sig) {
+		t.Fatal("the server's key is not signed by the pinned key")
+	}
+	peer, err := ecdh.P256().NewPublicKey(serverPub)
+	if err != nil {
+		t.Fatalf("server key: %v", err)
+	}
+	shared, err := priv.ECDH(peer)
+	if err != nil {
+		t.Fatalf("ecdh: %v", err)
+	}
+	toServer, toClient, err := deriveFrameKeys(shared, clientPub, serverPub)
+	if err != nil {
+		t.Fatalf("derive: %v", err)
+	}
+	c, err := newFrameCipher(toServer, toClient)
+	if err != nil {
+		t.Fatalf("cipher: %v", err)
+	}
+	return conn, c
+}
+
+// verifyE2EAnswer checks an r || s signature as the browser does.
+func verifyE2EAnswer(pinned *ecdsa.PublicKey, clientPub, serverPub, sig []byte) bool {
+	if len(sig) != 64 {
+		return false
+	}
+	r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	return ecdsa.Verify(pinned, e2eTranscript(clientPub, serverPub), r, s)
+}
+
+func TestE2EFramesAreOpaqueOnTheWire(t *testing.T) {
+	sm := NewSessionManager()
+	key := newTestSigningKey(t)
+	h := newE2EHandler(sm, key)
+	if _, err := sm.StartPairing(testHostID, testPartnerID); err != nil {
+		t.Fatalf("StartPairing: %v", err)
+	}
+	if _, err := sm.GrantControl(testHostID); err != nil {
+		t.Fatalf("GrantControl: %v", err)
+	}
+	hostInput := &lockedBuffer{}
+	sm.RegisterInput(testHostID, PairSessionID, hostInput)
+	srv := newE2EServer(t, h)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	conn, c := dialE2E(ctx, t, url, &key.PublicKey)
+
+	// Control messages such as the pair status stay plain.
+	typ, data, err := conn.Read(ctx)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if typ != websocket.MessageText || !bytes.Contains(data, []byte(`"type":"pair"`)) {
+		t.Fatalf("expected the plain pair status, got %v %q", typ, data)
+	}
+
+	// Sealed keystrokes reach the shell.
+	if err := c.write(ctx, conn, []byte("ls\r")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for hostInput.String() != "ls\r" {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected sealed input in host shell, got %q", hostInput.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Mirrored output is sealed for this connection.
+	mirror := &pairMirror{ctx: ctx, sm: sm, hostID: testHostID}
+	if _, err := mirror.Write([]byte("secret.txt\r\n")); err != nil {
+		t.Fatalf("mirror: %v", err)
+	}
+	typ, frame, err := conn.Read(ctx)
+	if err != nil {
+		t.Fatalf("read mirrored output: %v", err)
+	}
+	if bytes.Contains(frame, []byte("secret")) {
+		t.Fatalf("output crossed the wire in plain text: %q", frame)
+	}
+	if data, err := c.openFrame(typ, frame); err != nil || string(data) != "secret.txt\r\n" {
+		t.Fatalf("expected the mirrored output, got %q %v", data, err)
+	}
+
+	// Plain keystrokes are not accepted once the connection is sealed.
+	plain, _ := json.Marshal(wsMessage{Type: "data", Content: "whoami\r"})
+	if err := conn.Write(ctx, websocket.MessageText, plain); err != nil {
+		t.Fatalf("write plain: %v", err)
+	}
+	if _, _, err := conn.Read(ctx); err == nil {
+		t.Fatal("expected the server to end the connection")
+	}
+	if got := hostInput.String(); got != "ls\r" {
+		t.Fatalf("plain input reached the shell: %q", got)
+	}
+}
+
+func TestE2EAnswerIsSigned(t *testing.T) {
+	key := newTestSigningKey(t)
+	h := newE2EHandler(NewSessionManager(), key)
+	srv := newE2EServer(t, h)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	priv, _ := ecdh.P256().GenerateKey(rand.Reader)
+	clientPub := priv.PublicKey().Bytes()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"?"+e2eKeyParam+"="+base64.RawURLEncoding.EncodeToString(clientPub), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer func() { _ = conn.CloseNow() }()
+	_, data, err := conn.Read(ctx)
+	if err != nil {
+		t.Fatalf("read e2e key: %v", err)
+	}
+	var answer e2eAnswer
+	if err := json.Unmarshal(data, &answer); err != nil {
+		t.Fatalf("decode answer: %v", err)
+	}
+	serverPub, _ := base64.RawURLEncoding.DecodeString(answer.Key)
+	sig, _ := base64.RawURLEncoding.DecodeString(answer.Sig)
+
+	if !verifyE2EAnswer(&key.PublicKey, clientPub, serverPub, sig) {
+		t.Fatal("answer does not verify with the signing key")
+	}
+	if verifyE2EAnswer(&newTestSigningKey(t).PublicKey, clientPub, serverPub, sig) {
+		t.Fatal("answer verifies with another key")
+	}
+	// A key swapped in by a proxy does not match the signature.
+	swapped, _ := ecdh.P256().GenerateKey(rand.Reader)
+	if verifyE2EAnswer(&key.PublicKey, clientPub, swapped.PublicKey().Bytes(), sig) {
+		t.Fatal("signature covers a substituted server key")
+	}
+}
+
+func TestParseE2ESigningKey(t *testing.T) {
+	key := newTestSigningKey(t)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	parsed, err := ParseE2ESigningKey(base64.StdEncoding.EncodeToString(der))
+	if err != nil || !parsed.Equal(key) {
+		t.Fatalf("ParseE2ESigningKey = %v, %v", parsed, err)
+	}
+	pub, err := E2EPublicKey(parsed)
+	if err != nil {
+		t.Fatalf("E2EPublicKey: %v", err)
+	}
+	spki, _ := base64.StdEncoding.DecodeString(pub)
+	if got, err := x509.ParsePKIXPublicKey(spki); err != nil || !key.PublicKey.Equal(got) {
+		t.Fatalf("E2EPublicKey does not encode the public key: %v", err)
+	}
+
+	other, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	otherDER, _ := x509.MarshalPKCS8PrivateKey(other)
+	for name, encoded := range map[string]string{
+		"not base64": "not base64!",
+		"not pkcs8":  base64.StdEncoding.EncodeToString([]byte("short")),
+		"p-384":      base64.StdEncoding.EncodeToString(otherDER),
+	} {
+		if _, err := ParseE2ESigningKey(encoded); !errors.Is(err, errE2ESigningKey) {
+			t.Fatalf("%s: ParseE2ESigningKey = %v, want errE2ESigningKey", name, err)
+		}
+	}
+}
+
+func TestE2EFrameCipherRejectsReplays(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	sender, _ := newFrameCipher(key, key)
+	receiver, _ := newFrameCipher(key, key)
+
+	first := sender.seal.Seal(nil, frameNonce(0), []byte("ls"), nil)
+	second := sender.seal.Seal(nil, frameNonce(1), []byte("pwd"), nil)
+	if _, err := receiver.openFrame(websocket.MessageBinary, second); err == nil {
+		t.Fatal("a frame out of order must not open")
+	}
+	if data, err := receiver.openFrame(websocket.MessageBinary, first); err != nil || string(data) != "ls" {
+		t.Fatalf("expected the first frame, got %q %v", data, err)
+	}
+	if _, err := receiver.openFrame(websocket.MessageBinary, first); err == nil {
+		t.Fatal("a replayed frame must not open")
+	}
+	if data, err := receiver.openFrame(websocket.MessageBinary, second); err != nil || string(data) != "pwd" {
+		t.Fatalf("expected the second frame, got %q %v", data, err)
+	}
+	if _, err := receiver.openFrame(websocket.MessageText, second); !errors.Is(err, errE2EPlainInput) {
+		t.Fatalf("a text frame opened: %v", err)
+	}
+}
+
+func TestE2ERequiresKeyOffer(t *testing.T) {
+	srv := newE2EServer(t, newE2EHandler(NewSessionManager(), newTestSigningKey(t)))
+	unsigned := newE2EServer(t, newE2EHandler(NewSessionManager(), nil))
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	offer, _ := ecdh.P256().GenerateKey(rand.Reader)
+	tests := []struct {
+		url, query, want string
+	}{
+		{srv.URL, "", "e2e_required"},
+		{srv.URL, "?e2e=bm90LWEta2V5", "e2e_required"},
+		{unsigned.URL, "?e2e=" + base64.RawURLEncoding.EncodeToString(offer.PublicKey().Bytes()), "e2e_unavailable"},
+	}
+	for _, tt := range tests {
+		conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(tt.url, "http")+tt.query, nil)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		_, data, err := conn.Read(ctx)
+		_ = conn.CloseNow()
+		if err != nil || !bytes.Contains(data, []byte(tt.want)) {
+			t.Fatalf("query %q: expected %s, got %s %v", tt.query, tt.want, data, err)
+		}
+	}
+}
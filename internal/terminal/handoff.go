@@ -0,0 +1,44 @@
+package terminal
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/handoff"
+)
+
+// ConnectedUsers returns the users with a terminal connected and the
+// containers bound to them, for the process replacing this one.
+func (h *WebSocketHandler) ConnectedUsers(ctx context.Context) []handoff.ActiveUser {
+	var users []handoff.ActiveUser
+	for _, userID := range h.sm.Users() {
+		user, err := h.repo.GetUser(ctx, userID)
+		if err != nil || user == nil || user.ContainerID == "" {
+			continue
+		}
+		users = append(users, handoff.ActiveUser{UserID: userID, ContainerID: user.ContainerID})
+	}
+	return users
+}
+
+// ResumeUsers takes over the users whose terminals the previous process
+// dropped when it shut down. Their sessions are marked seen, so the restart
+// does not count towards their idle TTL, and their containers are paused as
+// usual if their terminals do not reconnect. Users whose container has been
+// replaced since are skipped.
+func (h *WebSocketHandler) ResumeUsers(ctx context.Context, users []handoff.ActiveUser) {
+	now := time.Now()
+	for _, resumed := range users {
+		user, err := h.repo.GetUser(ctx, resumed.UserID)
+		if err != nil || user == nil || user.ContainerID != resumed.ContainerID {
+			continue
+		}
+		if err := h.repo.UpdateLastSeen(ctx, resumed.UserID, now); err != nil {
+			slog.Warn("Failed to mark resumed user seen", "error", err, "user_id", resumed.UserID)
+		}
+		if h.idle != nil {
+			h.idle.schedule(resumed.UserID, resumed.ContainerID)
+		}
+	}
+}
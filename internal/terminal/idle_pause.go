@@ -0,0 +1,117 @@
+package terminal
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+)
+
+const (
+	// defaultAutoPauseDelay is how long a container may sit without terminals
+	// before it is paused.
+	defaultAutoPauseDelay = 5 * time.Minute
+	// pauseOpTimeout bounds a single pause or resume call.
+	pauseOpTimeout = 10 * time.Second
+)
+
+// idlePauser pauses a user's container once their last terminal has been
+// disconnected for delay, and resumes it when a terminal attaches again, so
+// containers left open in a background tab stop using CPU.
+type idlePauser struct {
+	pauser container.Pauser
+	sm     *SessionManager
+	delay  time.Duration // zero disables automatic pausing; resume still works
+
+	mu      sync.Mutex
+	pending map[string]*pendingPause
+}
+
+// pendingPause is a scheduled pause; its identity tells a firing timer
+// whether it was cancelled or replaced in the meantime.
+type pendingPause struct {
+	timer *time.Timer
+}
+
+// newIdlePauser returns nil when mgr cannot pause containers.
+func newIdlePauser(mgr container.Manager, sm *SessionManager, delay time.Duration) *idlePauser {
+	pauser, ok := mgr.(container.Pauser)
+	if !ok {
+		return nil
+	}
+	return &idlePauser{
+		pauser:  pauser,
+		sm:      sm,
+		delay:   delay,
+		pending: make(map[string]*pendingPause),
+	}
+}
+
+// resume cancels any pending pause for the user and unpauses their container
+// if it was paused, before a terminal attaches to it.
+func (p *idlePauser) resume(ctx context.Context, userID, containerID string) {
+	p.cancel(userID)
+
+	resumeCtx, cancel := context.WithTimeout(ctx, pauseOpTimeout)
+	defer cancel()
+	if err := p.pauser.ResumeContainer(resumeCtx, containerID); err != nil {
+		slog.Warn("Failed to resume container", "error", err, "container_id", containerID, "user_id", userID)
+	}
+}
+
+// schedule arms a pause of containerID after a terminal for the user closes.
+// When the timer fires the pause is skipped if any terminal is attached again.
+func (p *idlePauser) schedule(userID, containerID string) {
+	if p.delay <= 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if previous, ok := p.pending[userID]; ok {
+		previous.timer.Stop()
+	}
+	entry := &pendingPause{}
+	entry.timer = time.AfterFunc(p.delay, func() {
+		if !p.claim(userID, entry) || p.sm.HasSessions(userID) {
+			return
+		}
+		p.pause(userID, containerID)
+	})
+	p.pending[userID] = entry
+}
+
+// cancel stops the user's pending pause, if any.
+func (p *idlePauser) cancel(userID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if entry, ok := p.pending[userID]; ok {
+		entry.timer.Stop()
+		delete(p.pending, userID)
+	}
+}
+
+// claim removes entry from the pending set and reports whether it was still
+// the user's current pause, i.e. it was not cancelled or replaced.
+func (p *idlePauser) claim(userID string, entry *pendingPause) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pending[userID] != entry {
+		return false
+	}
+	delete(p.pending, userID)
+	return true
+}
+
+func (p *idlePauser) pause(userID, containerID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), pauseOpTimeout)
+	defer cancel()
+	if err := p.pauser.PauseContainer(ctx, containerID); err != nil {
+		// The container may have been destroyed since the terminal closed.
+		slog.Debug("Failed to pause idle container", "error", err, "container_id", containerID, "user_id", userID)
+		return
+	}
+	slog.Info("Paused idle container", "container_id", containerID, "user_id", userID, "idle", p.delay)
+}
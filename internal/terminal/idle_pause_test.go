@@ -0,0 +1,94 @@
+package terminal
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+type fakePauser struct {
+	mu      sync.Mutex
+	paused  []string
+	resumed []string
+}
+
+func (f *fakePauser) PauseContainer(_ context.Context, containerID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.paused = append(f.paused, containerID)
+	return nil
+}
+
+func (f *fakePauser) ResumeContainer(_ context.Context, containerID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.resumed = append(f.resumed, containerID)
+	return nil
+}
+
+func (f *fakePauser) pausedCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.paused)
+}
+
+func newTestIdlePauser(sm *SessionManager, delay time.Duration) (*idlePauser, *fakePauser) {
+	pauser := &fakePauser{}
+	return &idlePauser{pauser: pauser, sm: sm, delay: delay, pending: make(map[string]*pendingPause)}, pauser
+}
+
+func TestIdlePauserPausesAfterLastTerminal(t *testing.T) {
+	idle, pauser := newTestIdlePauser(NewSessionManager(), 10*time.Millisecond)
+
+	idle.schedule(testUserID, "container-1")
+
+	deadline := time.Now().Add(time.Second)
+	for pauser.pausedCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if pauser.pausedCount() != 1 {
+		t.Fatalf("expected container to be paused once, got %d", pauser.pausedCount())
+	}
+}
+
+func TestIdlePauserSkipsWhenTerminalReattached(t *testing.T) {
+	sm := NewSessionManager()
+	idle, pauser := newTestIdlePauser(sm, 10*time.Millisecond)
+
+	idle.schedule(testUserID, "container-1")
+	sm.Register(testUserID, testTabOne, &websocket.Conn{})
+
+	time.Sleep(50 * time.Millisecond)
+	if pauser.pausedCount() != 0 {
+		t.Fatalf("expected no pause while a terminal is attached, got %d", pauser.pausedCount())
+	}
+}
+
+func TestIdlePauserResumeCancelsPendingPause(t *testing.T) {
+	idle, pauser := newTestIdlePauser(NewSessionManager(), 20*time.Millisecond)
+
+	idle.schedule(testUserID, "container-1")
+	idle.resume(t.Context(), testUserID, "container-1")
+
+	time.Sleep(60 * time.Millisecond)
+	if pauser.pausedCount() != 0 {
+		t.Fatalf("expected pending pause to be cancelled, got %d", pauser.pausedCount())
+	}
+	pauser.mu.Lock()
+	defer pauser.mu.Unlock()
+	if len(pauser.resumed) != 1 {
+		t.Fatalf("expected one resume, got %v", pauser.resumed)
+	}
+}
+
+func TestIdlePauserDisabled(t *testing.T) {
+	idle, _ := newTestIdlePauser(NewSessionManager(), 0)
+
+	idle.schedule(testUserID, "container-1")
+	if len(idle.pending) != 0 {
+		t.Fatal("expected no timer when automatic pausing is disabled")
+	}
+}
@@ -0,0 +1,115 @@
+package terminal
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// inputKeySet marks the control bytes (0x00-0x1f) dropped from terminal input.
+type inputKeySet [0x20]bool
+
+// filter returns p without the blocked bytes. It returns p itself when
+// nothing is dropped.
+func (s *inputKeySet) filter(p []byte) []byte {
+	drop := 0
+	for _, b := range p {
+		if b < 0x20 && s[b] {
+			drop++
+		}
+	}
+	if drop == 0 {
+		return p
+	}
+	out := make([]byte, 0, len(p)-drop)
+	for _, b := range p {
+		if b >= 0x20 || !s[b] {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// parseInputKeys parses a list of key names such as "ctrl-s, ctrl-q"
+// separated by commas or whitespace. It returns the names it did not
+// recognize alongside the keys it did.
+func parseInputKeys(spec string) (inputKeySet, []string) {
+	var keys inputKeySet
+	var invalid []string
+	fields := strings.FieldsFunc(spec, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	for _, name := range fields {
+		b, ok := controlKeyByte(name)
+		if !ok {
+			invalid = append(invalid, name)
+			continue
+		}
+		keys[b] = true
+	}
+	return keys, invalid
+}
+
+// controlKeyByte maps "ctrl-<key>" (or "ctrl+<key>") to the byte the
+// terminal sends for it. Ctrl-[ is ESC, which starts arrow and function key
+// sequences, so it cannot be blocked.
+func controlKeyByte(name string) (byte, bool) {
+	lower := strings.ToLower(strings.TrimSpace(name))
+	key, ok := strings.CutPrefix(lower, "ctrl-")
+	if !ok {
+		key, ok = strings.CutPrefix(lower, "ctrl+")
+	}
+	if !ok || len(key) != 1 {
+		return 0, false
+	}
+	c := key[0]
+	if c >= 'a' && c <= 'z' {
+		c -= 'a' - 'A'
+	}
+	if c < '@' || c > '_' || c == '[' {
+		return 0, false
+	}
+	return c & 0x1f, true
+}
+
+// inputFilter holds the configured key-blocking policy: a default set, and a
+// directory of <classroom>.keys files replacing it for classroom members.
+type inputFilter struct {
+	keys inputKeySet
+	dir  string
+}
+
+// newInputFilter returns nil when no filtering is configured.
+func newInputFilter(spec, dir string) *inputFilter {
+	if spec == "" && dir == "" {
+		return nil
+	}
+	keys, invalid := parseInputKeys(spec)
+	if len(invalid) > 0 {
+		slog.Warn("Ignoring unknown terminal input filter keys", "keys", invalid)
+	}
+	return &inputFilter{keys: keys, dir: dir}
+}
+
+// policyFor returns the keys blocked for a member of classroom. An empty
+// classroom file blocks nothing.
+func (f *inputFilter) policyFor(classroom string) inputKeySet {
+	if f.dir == "" || !classroomNamePattern.MatchString(classroom) {
+		return f.keys
+	}
+	data, err := os.ReadFile(filepath.Join(f.dir, classroom+".keys"))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("Failed to read classroom input filter", "error", err, "classroom", classroom)
+		}
+		return f.keys
+	}
+	keys, invalid := parseInputKeys(string(data))
+	if len(invalid) > 0 {
+		slog.Warn("Ignoring unknown classroom input filter keys", "keys", invalid, "classroom", classroom)
+	}
+	return keys
+}
@@ -0,0 +1,65 @@
+package terminal
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseInputKeys(t *testing.T) {
+	keys, invalid := parseInputKeys("ctrl-s, CTRL+Q\nctrl-\\ ctrl-[ alt-x ctrl-")
+	for _, b := range []byte{0x13, 0x11, 0x1c} {
+		if !keys[b] {
+			t.Fatalf("expected byte %#x to be blocked", b)
+		}
+	}
+	if keys[0x1b] {
+		t.Fatal("ESC must never be blocked")
+	}
+	if want := []string{"ctrl-[", "alt-x", "ctrl-"}; !slices.Equal(invalid, want) {
+		t.Fatalf("invalid = %v, want %v", invalid, want)
+	}
+}
+
+func TestInputKeySetFilter(t *testing.T) {
+	keys, _ := parseInputKeys("ctrl-s,ctrl-z")
+	if got := string(keys.filter([]byte("ls\x13 -l\x1a\r"))); got != "ls -l\r" {
+		t.Fatalf("got %q", got)
+	}
+	// Escape sequences pass through untouched.
+	if got := string(keys.filter([]byte("\x1b[A"))); got != "\x1b[A" {
+		t.Fatalf("got %q", got)
+	}
+	var none inputKeySet
+	if string(none.filter([]byte("\x13"))) != "\x13" {
+		t.Fatal("empty set must not filter")
+	}
+}
+
+func TestInputFilterPolicyFor(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "exam.keys"), []byte("ctrl-s\nctrl-q\nctrl-z\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "open.keys"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f := newInputFilter("ctrl-s,ctrl-q", dir)
+
+	if keys := f.policyFor(""); !keys[0x13] || keys[0x1a] {
+		t.Fatal("expected default policy outside classrooms")
+	}
+	if keys := f.policyFor("exam"); !keys[0x1a] {
+		t.Fatal("expected classroom policy to block ctrl-z")
+	}
+	if keys := f.policyFor("open"); keys != (inputKeySet{}) {
+		t.Fatal("expected empty classroom file to block nothing")
+	}
+	if keys := f.policyFor("../exam"); keys[0x1a] {
+		t.Fatal("expected names escaping the directory to be ignored")
+	}
+	if newInputFilter("", "") != nil {
+		t.Fatal("expected nil filter when nothing is configured")
+	}
+}
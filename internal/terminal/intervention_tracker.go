@@ -0,0 +1,157 @@
+package terminal
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/agent"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/store"
+)
+
+// interventionQueueSize bounds outcomes waiting to be written.
+const interventionQueueSize = 256
+
+// pendingHint is a hint waiting for the learner's next command.
+type pendingHint struct {
+	intervention domain.Intervention
+	trigger      CommandEntry
+}
+
+// InterventionTracker is a CommandHook that judges proactive hints by the
+// next command the learner runs in the same tab session, and persists the
+// outcomes for the intervention analytics. Like CommandRecorder, it writes
+// on a background worker and drops outcomes when the repository falls
+// behind.
+type InterventionTracker struct {
+	repo  store.Repository
+	queue chan *domain.Intervention
+
+	mu      sync.Mutex
+	pending map[identity.SessionKey]*pendingHint
+}
+
+// NewInterventionTracker creates a tracker. Call Start before registering
+// it.
+func NewInterventionTracker(repo store.Repository) *InterventionTracker {
+	return &InterventionTracker{
+		repo:    repo,
+		queue:   make(chan *domain.Intervention, interventionQueueSize),
+		pending: make(map[identity.SessionKey]*pendingHint),
+	}
+}
+
+// Start runs the writer until ctx is cancelled.
+func (t *InterventionTracker) Start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case i := <-t.queue:
+				t.insert(ctx, i)
+			}
+		}
+	}()
+}
+
+// isIntervention reports whether a sidebar response is a hint whose effect
+// is worth measuring.
+func isIntervention(resp *agent.Response) bool {
+	switch agent.ResponseType(resp.Type) {
+	case agent.ResponseTypePattern, agent.ResponseTypeLLM, agent.ResponseTypeAlert:
+		return true
+	default:
+		return false
+	}
+}
+
+// OnHint starts tracking a hint given about trigger. Further responses about
+// the same command are ignored; a hint still waiting for a follow-up when a
+// hint about a later command arrives is closed as having none.
+func (t *InterventionTracker) OnHint(key identity.SessionKey, trigger CommandEntry, resp *agent.Response) {
+	if resp == nil || !isIntervention(resp) {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if p, ok := t.pending[key]; ok {
+		if p.trigger.Sequence == trigger.Sequence {
+			return
+		}
+		t.resolveLocked(key, domain.InterventionNoFollowUp)
+	}
+	t.pending[key] = &pendingHint{
+		intervention: domain.Intervention{
+			UserID:       key.UserID(),
+			SessionID:    key.SessionID(),
+			ResponseType: resp.Type,
+			Pattern:      resp.Pattern,
+			HintedAt:     time.Now(),
+		},
+		trigger: trigger,
+	}
+}
+
+// OnCommandCompleted implements CommandHook, resolving the session's pending
+// hint with the first command that completes after it.
+func (t *InterventionTracker) OnCommandCompleted(entry CommandEntry, session CommandSession) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.pending[session.Key]
+	if !ok || entry.Sequence <= p.trigger.Sequence {
+		return
+	}
+	t.resolveLocked(session.Key, interventionOutcome(p.trigger, entry))
+}
+
+// Forget closes a session's pending hint as having no follow-up, e.g. when
+// its terminal closes.
+func (t *InterventionTracker) Forget(key identity.SessionKey) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.pending[key]; ok {
+		t.resolveLocked(key, domain.InterventionNoFollowUp)
+	}
+}
+
+// resolveLocked queues the outcome of key's pending hint and stops tracking
+// it. Callers must hold t.mu.
+func (t *InterventionTracker) resolveLocked(key identity.SessionKey, outcome domain.InterventionOutcome) {
+	p := t.pending[key]
+	delete(t.pending, key)
+	i := p.intervention
+	i.Outcome = outcome
+	i.ResolvedAt = time.Now()
+	select {
+	case t.queue <- &i:
+	default:
+		slog.Warn("Intervention queue full, dropping outcome", "user_id", key.UserID(), "session_id", key.SessionID())
+	}
+}
+
+// interventionOutcome judges a hint about trigger by the next command.
+func interventionOutcome(trigger, next CommandEntry) domain.InterventionOutcome {
+	switch {
+	case next.ExitCode == ExitCodeUnknown:
+		return domain.InterventionNoFollowUp
+	case !next.Failed():
+		return domain.InterventionResolved
+	case strings.Join(strings.Fields(next.Command), " ") == strings.Join(strings.Fields(trigger.Command), " "):
+		return domain.InterventionRepeated
+	default:
+		return domain.InterventionFailed
+	}
+}
+
+func (t *InterventionTracker) insert(ctx context.Context, i *domain.Intervention) {
+	ctx, cancel := context.WithTimeout(ctx, commandInsertTimeout)
+	defer cancel()
+	if err := t.repo.InsertIntervention(ctx, i); err != nil {
+		slog.Error("Failed to persist intervention outcome", "error", err, "user_id", i.UserID, "session_id", i.SessionID)
+	}
+}
@@ -0,0 +1,82 @@
+package terminal
+
+import (
+	"testing"
+
+	"github.com/ashureev/shsh-labs/internal/agent"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/identity"
+)
+
+// nextOutcome returns the next queued intervention outcome, if any.
+func nextOutcome(t *testing.T, tracker *InterventionTracker) *domain.Intervention {
+	t.Helper()
+	select {
+	case i := <-tracker.queue:
+		return i
+	default:
+		return nil
+	}
+}
+
+func TestInterventionTrackerJudgesNextCommand(t *testing.T) {
+	key := identity.NewSessionKey("u1", "s1")
+	session := CommandSession{Key: key, UserID: "u1", SessionID: "s1"}
+	hint := &agent.Response{Type: string(agent.ResponseTypePattern), Pattern: "permission_denied"}
+	trigger := CommandEntry{Sequence: 1, Command: "cat /etc/shadow", ExitCode: 1}
+
+	tests := []struct {
+		name string
+		next CommandEntry
+		want domain.InterventionOutcome
+	}{
+		{"succeeded", CommandEntry{Sequence: 2, Command: "sudo cat /etc/shadow", ExitCode: 0}, domain.InterventionResolved},
+		{"repeated", CommandEntry{Sequence: 2, Command: "cat  /etc/shadow ", ExitCode: 1}, domain.InterventionRepeated},
+		{"failed differently", CommandEntry{Sequence: 2, Command: "less /etc/shadow", ExitCode: 1}, domain.InterventionFailed},
+		{"exit unknown", CommandEntry{Sequence: 2, Command: "ls", ExitCode: ExitCodeUnknown}, domain.InterventionNoFollowUp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewInterventionTracker(nil)
+			tracker.OnHint(key, trigger, hint)
+			tracker.OnHint(key, trigger, hint) // A second chunk about the same command.
+			tracker.OnCommandCompleted(CommandEntry{Sequence: 1, Command: trigger.Command, ExitCode: 1}, session)
+			if got := nextOutcome(t, tracker); got != nil {
+				t.Fatalf("trigger command resolved the hint: %+v", got)
+			}
+
+			tracker.OnCommandCompleted(tt.next, session)
+			got := nextOutcome(t, tracker)
+			if got == nil {
+				t.Fatal("no outcome recorded")
+			}
+			if got.Outcome != tt.want || got.UserID != "u1" || got.SessionID != "s1" || got.Pattern != "permission_denied" {
+				t.Fatalf("unexpected outcome: %+v", got)
+			}
+			if extra := nextOutcome(t, tracker); extra != nil {
+				t.Fatalf("unexpected extra outcome: %+v", extra)
+			}
+		})
+	}
+}
+
+func TestInterventionTrackerClosesAbandonedHints(t *testing.T) {
+	key := identity.NewSessionKey("u1", "s1")
+	tracker := NewInterventionTracker(nil)
+
+	tracker.OnHint(key, CommandEntry{Sequence: 1}, &agent.Response{Type: string(agent.ResponseTypeBell)})
+	tracker.Forget(key)
+	if got := nextOutcome(t, tracker); got != nil {
+		t.Fatalf("desktop notification tracked as a hint: %+v", got)
+	}
+
+	tracker.OnHint(key, CommandEntry{Sequence: 1}, &agent.Response{Type: string(agent.ResponseTypeLLM)})
+	tracker.OnHint(key, CommandEntry{Sequence: 2}, &agent.Response{Type: string(agent.ResponseTypeLLM)})
+	if got := nextOutcome(t, tracker); got == nil || got.Outcome != domain.InterventionNoFollowUp {
+		t.Fatalf("superseded hint outcome = %+v, want no_follow_up", got)
+	}
+	tracker.Forget(key)
+	if got := nextOutcome(t, tracker); got == nil || got.Outcome != domain.InterventionNoFollowUp {
+		t.Fatalf("forgotten hint outcome = %+v, want no_follow_up", got)
+	}
+}
@@ -2,25 +2,69 @@
 package terminal
 
 import (
+	"io"
 	"log/slog"
 	"sync"
 
 	"github.com/coder/websocket"
 )
 
-// SessionManager manages active WebSocket connections for users.
+// SessionManager manages active WebSocket connections for users and the
+// pairs sharing a terminal.
 type SessionManager struct {
 	mu     sync.RWMutex
 	active map[string]map[string]*websocket.Conn
+	inputs map[string]map[string]io.Writer
+	pairs  map[string]*pairing // keyed by both members
 }
 
 // NewSessionManager creates a new session manager.
 func NewSessionManager() *SessionManager {
 	return &SessionManager{
 		active: make(map[string]map[string]*websocket.Conn),
+		inputs: make(map[string]map[string]io.Writer),
+		pairs:  make(map[string]*pairing),
 	}
 }
 
+// RegisterInput records the writer that feeds keystrokes into a session's terminal.
+// Server-side features (e.g. running a suggested command) write through it so
+// injected input follows the same path as user keystrokes.
+func (m *SessionManager) RegisterInput(userID, sessionID string, w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.inputs[userID]; !exists {
+		m.inputs[userID] = make(map[string]io.Writer)
+	}
+	m.inputs[userID][sessionID] = w
+}
+
+// UnregisterInput removes the input writer for a session if it is still current.
+func (m *SessionManager) UnregisterInput(userID, sessionID string, w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if sessions, ok := m.inputs[userID]; ok {
+		if current, exists := sessions[sessionID]; exists && current == w {
+			delete(sessions, sessionID)
+			if len(sessions) == 0 {
+				delete(m.inputs, userID)
+			}
+		}
+	}
+}
+
+// InputWriter returns the terminal input writer for a session, or nil if none is attached.
+func (m *SessionManager) InputWriter(userID, sessionID string) io.Writer {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if sessions, ok := m.inputs[userID]; ok {
+		return sessions[sessionID]
+	}
+	return nil
+}
+
 // GetActive returns the active connection for a user and session.
 func (m *SessionManager) GetActive(userID, sessionID string) *websocket.Conn {
 	m.mu.RLock()
@@ -31,6 +75,26 @@ func (m *SessionManager) GetActive(userID, sessionID string) *websocket.Conn {
 	return nil
 }
 
+// HasSessions reports whether the user has any terminal connected.
+func (m *SessionManager) HasSessions(userID string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.active[userID]) > 0
+}
+
+// Users returns the users with a terminal connected.
+func (m *SessionManager) Users() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	users := make([]string, 0, len(m.active))
+	for userID, sessions := range m.active {
+		if len(sessions) > 0 {
+			users = append(users, userID)
+		}
+	}
+	return users
+}
+
 // Register adds a new WebSocket connection for a user/session.
 func (m *SessionManager) Register(userID, sessionID string, conn *websocket.Conn) {
 	m.mu.Lock()
@@ -83,4 +147,5 @@ func (m *SessionManager) CloseSession(userID string) {
 		slog.Info("Terminal session closed", "user_id", userID, "session_id", sid)
 	}
 	delete(m.active, userID)
+	delete(m.inputs, userID)
 }
@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/ashureev/shsh-labs/internal/agent"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/shared"
 )
 
 // Common prompt patterns used across all monitor implementations.
@@ -28,26 +30,6 @@ var cdPattern = regexp.MustCompile(`cd\s+(\S+)`)
 // editorCommandPattern detects editor commands (vim, nano, etc.).
 var editorCommandPattern = regexp.MustCompile(`^(?:\s*)\b(vim?|nano|emacs|less|more|man)\b`)
 
-// Pre-computed lowercase error indicators for detectExitCode.
-var lowerErrorIndicators [][]byte
-
-func init() {
-	errorIndicators := []string{
-		"command not found",
-		"no such file or directory",
-		"permission denied",
-		"invalid argument",
-		"operation not permitted",
-		"syntax error",
-		"cannot access",
-		"not recognized",
-	}
-	lowerErrorIndicators = make([][]byte, len(errorIndicators))
-	for i, indicator := range errorIndicators {
-		lowerErrorIndicators[i] = []byte(strings.ToLower(indicator))
-	}
-}
-
 // MonitorState represents the current state of terminal monitoring.
 type MonitorState int
 
@@ -67,7 +49,7 @@ const (
 type SessionState struct {
 	UserID           string
 	SessionID        string
-	SessionKey       string
+	SessionKey       identity.SessionKey
 	ContainerID      string
 	VolumePath       string
 	CurrentDir       string
@@ -75,6 +57,7 @@ type SessionState struct {
 	CommandCount     int
 	PendingCommand   string
 	OutputBuffer     bytes.Buffer
+	OutputDropped    int // Bytes discarded from the front of OutputBuffer to stay within the cap
 	CommandStartTime time.Time
 	IsCollecting     bool
 	IsTyping         bool
@@ -83,10 +66,45 @@ type SessionState struct {
 	State            MonitorState
 	InEditorMode     bool
 	EditorName       string
+	Suspended        bool      // Tab hidden: AI analysis and proactive messages paused
+	SuspendedAt      time.Time // When the tab was last hidden
+	away             awaySummary
+	bell             bellScanner
+	lastBellNotify   time.Time
+	quietWindows     []quietWindow // Daily windows proactive messages are held back in
 
 	mu sync.RWMutex
 }
 
+// appendOutputLocked adds fallback-collected output, keeping memory bounded by
+// discarding the oldest bytes once the buffer reaches twice the cap. Callers
+// must hold s.mu.
+func (s *SessionState) appendOutputLocked(data []byte, limit int) {
+	s.OutputBuffer.Write(data)
+	if limit <= 0 || s.OutputBuffer.Len() <= 2*limit {
+		return
+	}
+	excess := s.OutputBuffer.Len() - limit
+	s.OutputBuffer.Next(excess)
+	s.OutputDropped += excess
+}
+
+// capturedOutputLocked returns the collected output, at most limit bytes from
+// the end, prefixed with a truncation marker if anything was dropped. Callers
+// must hold s.mu (read or write).
+func (s *SessionState) capturedOutputLocked(limit int) string {
+	out := s.OutputBuffer.Bytes()
+	dropped := s.OutputDropped
+	if limit > 0 && len(out) > limit {
+		dropped += len(out) - limit
+		out = out[len(out)-limit:]
+	}
+	if dropped == 0 {
+		return string(out)
+	}
+	return shared.TruncationMarker(dropped) + "\n" + strings.ToValidUTF8(string(out), "")
+}
+
 // analysisJob represents a job for async AI analysis.
 type analysisJob struct {
 	ctx       context.Context
@@ -109,11 +127,25 @@ type Monitor struct {
 	sidebarChan    chan *agent.Response
 	logger         *slog.Logger
 	mu             sync.RWMutex
-	sessions       map[string]*SessionState
+	sessions       map[identity.SessionKey]*SessionState
 	maxBufferSize  int
 	jobChan        chan analysisJob
 	workerWg       sync.WaitGroup
 	workerPoolSize int
+	analysisMu     sync.Mutex
+	running        map[int]*runningAnalysis // Jobs in progress by worker ID
+	retired        map[int]bool             // Workers replaced by the watchdog while stuck
+	nextWorkerID   int
+	watchdog       analysisWatchdogStats
+	hooks          []CommandHook
+	notifyBell     bool          // Relay bells from hidden tabs as desktop notifications
+	notifyAfter    time.Duration // Relay completions of commands at least this long from hidden tabs; 0 disables
+	interventions  *InterventionTracker
+	quiet          *quietHours // nil when no quiet hours are configured
+	focusMu        sync.Mutex
+	focus          map[string]time.Time // Per-user focus windows holding back proactive messages
+	dropsMu        sync.Mutex
+	sidebarDrops   map[identity.SessionKey]int // Responses dropped since the session's last drop marker
 }
 
 // defaultMaxBufferSize is the default maximum output buffer size per session (64KB).
@@ -136,28 +168,53 @@ func NewMonitor(agentService *agent.Service, sidebarChan chan *agent.Response, l
 		parser:         NewOSC133CommandParser(logger),
 		sidebarChan:    sidebarChan,
 		logger:         logger,
-		sessions:       make(map[string]*SessionState),
+		sessions:       make(map[identity.SessionKey]*SessionState),
 		maxBufferSize:  defaultMaxBufferSize,
 		jobChan:        make(chan analysisJob, defaultJobChanSize),
 		workerPoolSize: defaultWorkerPoolSize,
+		running:        make(map[int]*runningAnalysis),
+		retired:        make(map[int]bool),
+		notifyBell:     true,
+		notifyAfter:    defaultNotifyCommandAfter,
+		focus:          make(map[string]time.Time),
+		sidebarDrops:   make(map[identity.SessionKey]int),
 	}
 
 	// Start worker pool for async AI analysis
 	for i := 0; i < tm.workerPoolSize; i++ {
 		tm.workerWg.Add(1)
-		go tm.analysisWorker()
+		tm.startAnalysisWorker()
 	}
 
 	return tm
 }
 
-// analysisWorker processes AI analysis jobs asynchronously.
-func (tm *Monitor) analysisWorker() {
-	defer tm.workerWg.Done()
+// SetMaxBufferSize sets how much command output is kept per session for AI
+// analysis. Longer output keeps its tail behind a truncation marker.
+func (tm *Monitor) SetMaxBufferSize(size int) {
+	if size > 0 {
+		tm.maxBufferSize = size
+	}
+}
 
+// SetInterventionTracker measures the effect of the hints sent to sessions
+// with tracker, which is also subscribed to completed commands. Call it
+// before sessions start producing output.
+func (tm *Monitor) SetInterventionTracker(tracker *InterventionTracker) {
+	tm.AddCommandHook(tracker)
+	tm.interventions = tracker
+}
+
+// analysisWorker processes AI analysis jobs asynchronously until the job
+// channel is closed or the watchdog replaces it.
+func (tm *Monitor) analysisWorker(id int) {
 	for job := range tm.jobChan {
-		tm.processAnalysisJob(job)
+		tm.runAnalysisJob(id, job)
+		if tm.workerRetired(id) {
+			return
+		}
 	}
+	tm.workerWg.Done()
 }
 
 // processAnalysisJob processes a single analysis job.
@@ -167,7 +224,7 @@ func (tm *Monitor) processAnalysisJob(job analysisJob) {
 	if job.session != nil {
 		job.session.mu.RLock()
 		if job.session.IsCollecting {
-			output = job.session.OutputBuffer.String()
+			output = job.session.capturedOutputLocked(tm.maxBufferSize)
 		}
 		job.session.mu.RUnlock()
 	}
@@ -189,7 +246,7 @@ func (tm *Monitor) processAnalysisJob(job analysisJob) {
 		UserID:     job.userID,
 		SessionID:  job.sessionID,
 		Duration:   job.entry.Duration,
-		HasOSC133:  tm.parser.HasOSC133Support(job.userID + ":" + job.sessionID),
+		HasOSC133:  tm.parser.HasOSC133Support(identity.NewSessionKey(job.userID, job.sessionID)),
 	}
 
 	// Process through Micro-Agent
@@ -216,11 +273,36 @@ func (tm *Monitor) processAnalysisJob(job analysisJob) {
 			}(),
 		)
 
+		// Quiet hours and focus windows hold proactive messages back
+		// entirely; chat is not affected.
+		if response != nil && !response.Silent && job.session != nil && tm.isQuiet(job.session, time.Now()) {
+			tm.logger.Info("[MONITOR] Quiet hours, proactive message suppressed",
+				"user_id", job.userID,
+				"session_id", job.sessionID,
+				"type", response.Type,
+			)
+			continue
+		}
+
+		// Drop proactive messages that arrive after the tab was hidden;
+		// the recap on return tells the learner what they missed.
+		if response != nil && !response.Silent && job.session != nil && job.session.recordDroppedIfSuspended() {
+			tm.logger.Info("[MONITOR] Session suspended, proactive message suppressed",
+				"user_id", job.userID,
+				"session_id", job.sessionID,
+				"type", response.Type,
+			)
+			continue
+		}
+
 		// Send to sidebar if not silent
 		if response != nil && !response.Silent {
 			response.UserID = job.userID
 			response.SessionID = job.sessionID
 			tm.sendToSidebar(job.ctx, job.userID, response)
+			if tm.interventions != nil {
+				tm.interventions.OnHint(identity.NewSessionKey(job.userID, job.sessionID), *job.entry, response)
+			}
 		}
 	}
 }
@@ -231,17 +313,13 @@ func (tm *Monitor) Stop() {
 	tm.workerWg.Wait()
 }
 
-func monitorSessionKey(userID, sessionID string) string {
-	return userID + ":" + sessionID
-}
-
 // RegisterSession registers a new terminal session for monitoring.
 func (tm *Monitor) RegisterSession(userID, sessionID, containerID, volumePath string) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
-	sessionKey := monitorSessionKey(userID, sessionID)
+	sessionKey := identity.NewSessionKey(userID, sessionID)
 
-	tm.sessions[sessionKey] = &SessionState{
+	session := &SessionState{
 		UserID:       userID,
 		SessionID:    sessionID,
 		SessionKey:   sessionKey,
@@ -250,6 +328,10 @@ func (tm *Monitor) RegisterSession(userID, sessionID, containerID, volumePath st
 		LastActivity: time.Now(),
 		State:        MonitorStateIdle,
 	}
+	if tm.quiet != nil {
+		session.quietWindows = tm.quiet.windows
+	}
+	tm.sessions[sessionKey] = session
 
 	// Also register with the OSC 133 parser
 	tm.parser.RegisterSession(sessionKey, containerID)
@@ -266,17 +348,21 @@ func (tm *Monitor) RegisterSession(userID, sessionID, containerID, volumePath st
 func (tm *Monitor) UnregisterSession(userID, sessionID string) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
-	sessionKey := monitorSessionKey(userID, sessionID)
+	sessionKey := identity.NewSessionKey(userID, sessionID)
 
 	delete(tm.sessions, sessionKey)
 	tm.parser.UnregisterSession(sessionKey)
+	if tm.interventions != nil {
+		tm.interventions.Forget(sessionKey)
+	}
+	tm.takeSidebarDrops(sessionKey)
 
 	tm.logger.Info("[MONITOR] Session unregistered", "user_id", userID, "session_id", sessionID)
 }
 
 // ProcessInput processes user keyboard input (WebSocket -> Container).
 func (tm *Monitor) ProcessInput(ctx context.Context, userID, sessionID string, data []byte) {
-	sessionKey := monitorSessionKey(userID, sessionID)
+	sessionKey := identity.NewSessionKey(userID, sessionID)
 	tm.mu.RLock()
 	session, exists := tm.sessions[sessionKey]
 	tm.mu.RUnlock()
@@ -347,13 +433,14 @@ func (tm *Monitor) ProcessInput(ctx context.Context, userID, sessionID string, d
 		session.IsCollecting = true
 		session.State = MonitorStateCollecting
 		session.OutputBuffer.Reset()
+		session.OutputDropped = 0
 		session.mu.Unlock()
 	}
 }
 
 // ProcessOutput processes terminal output (Container -> WebSocket).
 func (tm *Monitor) ProcessOutput(ctx context.Context, userID, sessionID string, data []byte) {
-	sessionKey := monitorSessionKey(userID, sessionID)
+	sessionKey := identity.NewSessionKey(userID, sessionID)
 	tm.mu.Lock()
 	session, exists := tm.sessions[sessionKey]
 	tm.mu.Unlock()
@@ -367,6 +454,10 @@ func (tm *Monitor) ProcessOutput(ctx context.Context, userID, sessionID string,
 	session.LastActivity = time.Now()
 	session.mu.Unlock()
 
+	if tm.notifyBell {
+		tm.relayBell(ctx, session, data)
+	}
+
 	previewLen := len(data)
 	if previewLen > 100 {
 		previewLen = 100
@@ -465,7 +556,7 @@ func (tm *Monitor) ProcessOutput(ctx context.Context, userID, sessionID string,
 	// session.mu guards OutputBuffer — same lock used by processAnalysisJob reader.
 	if session.IsCollecting && session.PendingCommand != "" && !tm.parser.HasOSC133Support(sessionKey) {
 		session.mu.Lock()
-		session.OutputBuffer.Write(data)
+		session.appendOutputLocked(data, tm.maxBufferSize)
 		session.mu.Unlock()
 
 		// Check for prompt pattern or timeout
@@ -478,7 +569,10 @@ func (tm *Monitor) ProcessOutput(ctx context.Context, userID, sessionID string,
 
 // handleCommandExecuted processes a completed command with its metadata.
 func (tm *Monitor) handleCommandExecuted(ctx context.Context, userID, sessionID string, entry *CommandEntry) {
-	sessionKey := monitorSessionKey(userID, sessionID)
+	sessionKey := identity.NewSessionKey(userID, sessionID)
+
+	tm.notifyCommandHooks(sessionKey, entry)
+
 	// Skip editor commands - don't send them to AI
 	if matches := editorCommandPattern.FindStringSubmatch(entry.Command); len(matches) > 1 {
 		tm.logger.Info("[MONITOR] Skipping editor command for AI processing",
@@ -510,6 +604,20 @@ func (tm *Monitor) handleCommandExecuted(ctx context.Context, userID, sessionID
 		tm.agentService.UpdateSessionTypingStatus(ctx, userID, sessionID, false)
 	}
 
+	if session != nil {
+		tm.relayCommandFinished(ctx, session, entry)
+	}
+
+	// Hidden tabs get no AI analysis; remember the command for the recap instead.
+	if session != nil && session.recordIfSuspended(entry) {
+		tm.logger.Info("[MONITOR] Session suspended, skipping AI analysis",
+			"user_id", userID,
+			"session_id", sessionID,
+			"command", entry.Command,
+		)
+		return
+	}
+
 	// Truncate output for logging
 	var outputPreview string
 	if session != nil && session.IsCollecting {
@@ -538,6 +646,11 @@ func (tm *Monitor) handleCommandExecuted(ctx context.Context, userID, sessionID
 		"output_preview", outputPreview,
 	)
 
+	// Without an agent there is nothing to analyze.
+	if tm.agentService == nil {
+		return
+	}
+
 	// Enqueue job for async processing instead of blocking
 	job := analysisJob{
 		ctx:       ctx,
@@ -587,13 +700,13 @@ func (tm *Monitor) checkFallbackCompletion(ctx context.Context, userID, sessionI
 	}
 
 	// Create command entry
-	sessionKey := monitorSessionKey(userID, sessionID)
+	sessionKey := identity.NewSessionKey(userID, sessionID)
 	pwd := tm.parser.GetCurrentDir(sessionKey)
 	entry := &CommandEntry{
 		Sequence:  session.CommandCount + 1,
 		Command:   session.PendingCommand,
 		PWD:       pwd,
-		ExitCode:  tm.detectExitCodeBytes(outputBytes),
+		ExitCode:  ExitCodeUnknown, // no exit marker; output text is not a reliable signal
 		Duration:  duration,
 		Timestamp: session.CommandStartTime,
 		StartTime: session.CommandStartTime,
@@ -615,10 +728,13 @@ func (tm *Monitor) checkFallbackCompletion(ctx context.Context, userID, sessionI
 	session.IsCollecting = false
 	session.PendingCommand = ""
 	session.OutputBuffer.Reset()
+	session.OutputDropped = 0
 	session.State = MonitorStateIdle
 }
 
-// sendToSidebar sends a response to the sidebar channel.
+// sendToSidebar sends a response to the sidebar channel. A response that
+// does not fit is dropped and counted; the next response for the session is
+// preceded by a marker reporting the drops, so the UI can show the gap.
 func (tm *Monitor) sendToSidebar(ctx context.Context, userID string, response *agent.Response) {
 	tm.logger.Info("[MONITOR] Sending to sidebar",
 		"user_id", userID,
@@ -627,6 +743,9 @@ func (tm *Monitor) sendToSidebar(ctx context.Context, userID string, response *a
 		"channel_len", len(tm.sidebarChan),
 	)
 
+	sessionKey := identity.NewSessionKey(userID, response.SessionID)
+	tm.sendDropMarker(sessionKey, response)
+
 	select {
 	case tm.sidebarChan <- response:
 		tm.logger.Info("[MONITOR] Response sent to sidebar successfully",
@@ -638,13 +757,52 @@ func (tm *Monitor) sendToSidebar(ctx context.Context, userID string, response *a
 			"user_id", userID,
 		)
 	default:
+		tm.dropsMu.Lock()
+		defer tm.dropsMu.Unlock()
+		tm.sidebarDrops[sessionKey]++
 		tm.logger.Warn("[MONITOR] Sidebar channel full, response dropped",
 			"user_id", userID,
 			"channel_len", len(tm.sidebarChan),
+			"pending_dropped", tm.sidebarDrops[sessionKey],
 		)
 	}
 }
 
+// sendDropMarker reports the responses dropped for a session ahead of
+// response, addressed like it. Drops stay counted if the channel is still
+// full.
+func (tm *Monitor) sendDropMarker(sessionKey identity.SessionKey, response *agent.Response) {
+	dropped := tm.takeSidebarDrops(sessionKey)
+	if dropped == 0 {
+		return
+	}
+	marker := &agent.Response{
+		Type:      string(agent.ResponseTypeMessagesDropped),
+		UserID:    response.UserID,
+		SessionID: response.SessionID,
+		Target:    response.Target,
+		Classroom: response.Classroom,
+		Dropped:   dropped,
+	}
+	select {
+	case tm.sidebarChan <- marker:
+	default:
+		tm.dropsMu.Lock()
+		defer tm.dropsMu.Unlock()
+		tm.sidebarDrops[sessionKey] += dropped
+	}
+}
+
+// takeSidebarDrops returns and resets the number of responses dropped for a
+// session.
+func (tm *Monitor) takeSidebarDrops(sessionKey identity.SessionKey) int {
+	tm.dropsMu.Lock()
+	defer tm.dropsMu.Unlock()
+	dropped := tm.sidebarDrops[sessionKey]
+	delete(tm.sidebarDrops, sessionKey)
+	return dropped
+}
+
 // detectPromptBytes checks if output contains a shell prompt (bytes version).
 func (tm *Monitor) detectPromptBytes(output []byte) bool {
 	for _, pattern := range promptPatterns {
@@ -655,20 +813,13 @@ func (tm *Monitor) detectPromptBytes(output []byte) bool {
 	return false
 }
 
-// detectExitCodeBytes attempts to determine exit code from output using bytes.
-func (tm *Monitor) detectExitCodeBytes(output []byte) int {
-	lowerOutput := bytes.ToLower(output)
-	for _, indicator := range lowerErrorIndicators {
-		if bytes.Contains(lowerOutput, indicator) {
-			return 1
-		}
-	}
-	return 0
-}
-
 // extractPWDFromOutput extracts current directory from output.
 func (tm *Monitor) extractPWDFromOutput(userID, sessionID string, data []byte) {
-	sessionKey := monitorSessionKey(userID, sessionID)
+	sessionKey := identity.NewSessionKey(userID, sessionID)
+	// The shell reports its real cwd via state markers; skip the heuristics.
+	if tm.parser.HasShellState(sessionKey) {
+		return
+	}
 	output := string(data)
 
 	// Look for cd commands
@@ -689,22 +840,42 @@ func (tm *Monitor) extractPWDFromOutput(userID, sessionID string, data []byte) {
 
 // GetCurrentCommand returns the command currently being typed.
 func (tm *Monitor) GetCurrentCommand(userID, sessionID string) string {
-	return tm.parser.GetCurrentCommand(monitorSessionKey(userID, sessionID))
+	return tm.parser.GetCurrentCommand(identity.NewSessionKey(userID, sessionID))
 }
 
 // GetLastCommand returns the last executed command.
 func (tm *Monitor) GetLastCommand(userID, sessionID string) string {
-	return tm.parser.GetLastCommand(monitorSessionKey(userID, sessionID))
+	return tm.parser.GetLastCommand(identity.NewSessionKey(userID, sessionID))
 }
 
 // GetCommandHistory returns the command history for a session.
 func (tm *Monitor) GetCommandHistory(userID, sessionID string, limit int) []CommandEntry {
-	return tm.parser.GetCommandHistory(monitorSessionKey(userID, sessionID), limit)
+	return tm.parser.GetCommandHistory(identity.NewSessionKey(userID, sessionID), limit)
+}
+
+// CommandRunning reports whether a foreground command is still executing in
+// any of the user's terminals.
+func (tm *Monitor) CommandRunning(userID string) bool {
+	tm.mu.RLock()
+	var keys []identity.SessionKey
+	for key, session := range tm.sessions {
+		if session.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	tm.mu.RUnlock()
+
+	for _, key := range keys {
+		if tm.parser.IsExecuting(key) {
+			return true
+		}
+	}
+	return false
 }
 
 // HasOSC133Support returns whether OSC 133 markers have been detected.
 func (tm *Monitor) HasOSC133Support(userID, sessionID string) bool {
-	return tm.parser.HasOSC133Support(monitorSessionKey(userID, sessionID))
+	return tm.parser.HasOSC133Support(identity.NewSessionKey(userID, sessionID))
 }
 
 // IsInEditorMode returns whether the user is currently in editor mode.
@@ -712,7 +883,7 @@ func (tm *Monitor) IsInEditorMode(userID, sessionID string) bool {
 	tm.mu.RLock()
 	defer tm.mu.RUnlock()
 
-	session, exists := tm.sessions[monitorSessionKey(userID, sessionID)]
+	session, exists := tm.sessions[identity.NewSessionKey(userID, sessionID)]
 	if !exists {
 		return false
 	}
@@ -724,7 +895,7 @@ func (tm *Monitor) GetEditorName(userID, sessionID string) string {
 	tm.mu.RLock()
 	defer tm.mu.RUnlock()
 
-	session, exists := tm.sessions[monitorSessionKey(userID, sessionID)]
+	session, exists := tm.sessions[identity.NewSessionKey(userID, sessionID)]
 	if !exists {
 		return ""
 	}
@@ -734,7 +905,7 @@ func (tm *Monitor) GetEditorName(userID, sessionID string) string {
 // UpdateTypingStatus updates whether the user is currently typing.
 func (tm *Monitor) UpdateTypingStatus(userID, sessionID string, isTyping bool) {
 	tm.mu.Lock()
-	session, exists := tm.sessions[monitorSessionKey(userID, sessionID)]
+	session, exists := tm.sessions[identity.NewSessionKey(userID, sessionID)]
 	var changed bool
 	if exists {
 		changed = session.IsTyping != isTyping
@@ -753,21 +924,21 @@ func (tm *Monitor) UpdateTypingStatus(userID, sessionID string, isTyping bool) {
 
 // IsTyping returns whether the user is currently typing.
 func (tm *Monitor) IsTyping(userID, sessionID string) bool {
-	return tm.parser.IsTyping(monitorSessionKey(userID, sessionID))
+	return tm.parser.IsTyping(identity.NewSessionKey(userID, sessionID))
 }
 
 // GetSessionState returns the current state for a session.
 func (tm *Monitor) GetSessionState(userID, sessionID string) *SessionState {
 	tm.mu.RLock()
 	defer tm.mu.RUnlock()
-	return tm.sessions[monitorSessionKey(userID, sessionID)]
+	return tm.sessions[identity.NewSessionKey(userID, sessionID)]
 }
 
 // GetStats returns monitoring statistics for a session.
 func (tm *Monitor) GetStats(userID, sessionID string) map[string]any {
 	tm.mu.RLock()
 	defer tm.mu.RUnlock()
-	sessionKey := monitorSessionKey(userID, sessionID)
+	sessionKey := identity.NewSessionKey(userID, sessionID)
 
 	session, exists := tm.sessions[sessionKey]
 	if !exists {
@@ -788,5 +959,6 @@ func (tm *Monitor) GetStats(userID, sessionID string) map[string]any {
 		"buffer_capacity": tm.maxBufferSize,
 		"in_editor_mode":  session.InEditorMode,
 		"editor_name":     session.EditorName,
+		"suspended":       session.IsSuspended(),
 	}
 }
@@ -43,27 +43,3 @@ func BenchmarkDetectPrompt(b *testing.B) {
 		}
 	}
 }
-
-func BenchmarkDetectExitCode(b *testing.B) {
-	tm := NewMonitor(nil, nil, nil)
-
-	// Use []byte inputs to match the production detectExitCodeBytes path.
-	outputs := [][]byte{
-		[]byte("command not found"),
-		[]byte("No such file or directory"),
-		[]byte("Permission denied"),
-		[]byte("Invalid argument"),
-		[]byte("Operation not permitted"),
-		[]byte("syntax error"),
-		[]byte("cannot access"),
-		[]byte("not recognized"),
-		[]byte("success output here"),
-	}
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		for _, output := range outputs {
-			tm.detectExitCodeBytes(output)
-		}
-	}
-}
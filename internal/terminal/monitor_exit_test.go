@@ -1,43 +1,53 @@
 package terminal
 
 import (
-	"strings"
+	"context"
 	"testing"
+	"time"
 )
 
-// Copy of detectExitCode logic from monitor.go to test it locally.
-func detectExitCode(output string) int {
-	errorIndicators := []string{
-		"command not found",
-		"No such file or directory",
-		"Permission denied",
-		"Invalid argument",
-		"Operation not permitted",
-		"syntax error",
-		"cannot access",
-		"not recognized",
+func TestFallbackCompletionReportsUnknownExitCode(t *testing.T) {
+	tm := NewMonitor(nil, nil, nil)
+	defer tm.Stop()
+	hook := &recordingHook{}
+	tm.AddCommandHook(hook)
+	tm.RegisterSession("u1", "s1", "c1", "/home/u1")
+
+	// Output that merely mentions an error must not be guessed as a failure.
+	session := &SessionState{
+		PendingCommand:   "grep denied /var/log/auth.log",
+		CommandStartTime: time.Now().Add(-time.Second),
+		IsCollecting:     true,
 	}
+	session.OutputBuffer.WriteString("sshd: Permission denied (publickey)\nlearner@lab:~$ ls")
 
-	lowerOutput := strings.ToLower(output)
-	for _, indicator := range errorIndicators {
-		if strings.Contains(lowerOutput, strings.ToLower(indicator)) {
-			return 1
-		}
+	tm.checkFallbackCompletion(context.Background(), "u1", "s1", session)
+
+	if len(hook.entries) != 1 {
+		t.Fatalf("expected one completed command, got %d", len(hook.entries))
+	}
+	entry := hook.entries[0]
+	if entry.ExitCode != ExitCodeUnknown {
+		t.Fatalf("expected unknown exit code, got %d", entry.ExitCode)
+	}
+	if entry.Failed() {
+		t.Fatal("expected an unknown exit code not to count as a failure")
 	}
-	return 0
 }
 
-func TestAptUpdate_ExitCodeDetection(t *testing.T) {
-	output := `Get:1 http://security.ubuntu.com/ubuntu jammy-security InRelease [129 kB]
-Get:2 http://archive.ubuntu.com/ubuntu jammy InRelease [270 kB]
-Fetched 44.0 MB in 32s (1390 kB/s)                                                                                      
-Reading package lists... Done
-Building dependency tree... Done
-Reading state information... Done
-6 packages can be upgraded. Run 'apt list --upgradable' to see them.`
-
-	code := detectExitCode(output)
-	if code != 0 {
-		t.Errorf("Expected ExitCode 0 (Success) for apt output, got %d", code)
+func TestCommandEntryFailed(t *testing.T) {
+	tests := []struct {
+		code int
+		want bool
+	}{
+		{0, false},
+		{1, true},
+		{127, true},
+		{ExitCodeUnknown, false},
+	}
+	for _, tt := range tests {
+		if got := (CommandEntry{ExitCode: tt.code}).Failed(); got != tt.want {
+			t.Errorf("Failed() with exit code %d = %v, want %v", tt.code, got, tt.want)
+		}
 	}
 }
@@ -0,0 +1,81 @@
+package terminal
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ashureev/shsh-labs/internal/agent"
+	"github.com/ashureev/shsh-labs/internal/shared"
+)
+
+func TestCapturedOutputKeepsTailWithMarker(t *testing.T) {
+	const limit = 64
+	s := &SessionState{}
+	for i := 0; i < 10; i++ {
+		s.appendOutputLocked([]byte(strings.Repeat("x", 30)), limit)
+	}
+	s.appendOutputLocked([]byte("ERROR: disk full"), limit)
+
+	if s.OutputBuffer.Len() > 2*limit {
+		t.Fatalf("buffer exceeded bound: %d bytes", s.OutputBuffer.Len())
+	}
+
+	out := s.capturedOutputLocked(limit)
+	if !strings.HasPrefix(out, "…[truncated 252 bytes]…\n") {
+		t.Fatalf("expected truncation marker with exact count, got %q", out)
+	}
+	if !strings.HasSuffix(out, "ERROR: disk full") {
+		t.Fatalf("expected tail to be preserved, got %q", out)
+	}
+}
+
+func TestCapturedOutputUnderLimitUnchanged(t *testing.T) {
+	s := &SessionState{}
+	s.appendOutputLocked([]byte("hello\n"), 64)
+	if out := s.capturedOutputLocked(64); out != "hello\n" {
+		t.Fatalf("expected output unchanged, got %q", out)
+	}
+}
+
+func TestTruncateWithMarkerRespectsLimit(t *testing.T) {
+	in := strings.Repeat("a", 5000) + strings.Repeat("é", 500) + strings.Repeat("z", 5000)
+	for _, limit := range []int{10, 64, 100, 1000, 4096} {
+		out := shared.TruncateWithMarker(in, limit)
+		if len(out) > limit {
+			t.Errorf("limit %d: got %d bytes", limit, len(out))
+		}
+		if limit >= 100 && (!strings.HasPrefix(out, "a") || !strings.HasSuffix(out, "z") || !strings.Contains(out, "[truncated ")) {
+			t.Errorf("limit %d: expected head, marker and tail, got %q", limit, out)
+		}
+	}
+	if out := shared.TruncateWithMarker("short", 100); out != "short" {
+		t.Errorf("expected short input unchanged, got %q", out)
+	}
+}
+
+func TestSidebarDropsReportedWithNextResponse(t *testing.T) {
+	sidebar := make(chan *agent.Response, 1)
+	tm := NewMonitor(nil, sidebar, nil)
+	defer tm.Stop()
+
+	ctx := context.Background()
+	for _, content := range []string{"first", "second", "third"} {
+		tm.sendToSidebar(ctx, "u1", &agent.Response{Type: "llm", Content: content, UserID: "u1", SessionID: "s1"})
+	}
+	<-sidebar
+
+	// Still full after the marker: the response is dropped and counted too.
+	sidebar <- &agent.Response{}
+	tm.sendToSidebar(ctx, "u1", &agent.Response{Type: "llm", Content: "fourth", UserID: "u1", SessionID: "s1"})
+	<-sidebar
+
+	tm.sendToSidebar(ctx, "u1", &agent.Response{Type: "llm", Content: "fifth", UserID: "u1", SessionID: "s1"})
+	marker := <-sidebar
+	if marker.Type != string(agent.ResponseTypeMessagesDropped) || marker.Dropped != 3 || marker.SessionID != "s1" {
+		t.Fatalf("unexpected marker: %+v", marker)
+	}
+	if len(sidebar) != 0 {
+		t.Fatal("expected the response after the marker to be dropped by the full channel")
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/ashureev/shsh-labs/internal/identity"
 )
 
 // TestOutputBufferNoRace verifies that concurrent ProcessOutput and
@@ -48,7 +50,7 @@ func TestOutputBufferNoRace(t *testing.T) {
 		defer wg.Done()
 		for i := 0; i < iterations; i++ {
 			tm.mu.RLock()
-			session, exists := tm.sessions[monitorSessionKey(userID, sessionID)]
+			session, exists := tm.sessions[identity.NewSessionKey(userID, sessionID)]
 			tm.mu.RUnlock()
 
 			if exists {
@@ -0,0 +1,42 @@
+package terminal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ashureev/shsh-labs/internal/identity"
+)
+
+func TestMonitorTabsOfSameUserAreIndependent(t *testing.T) {
+	tm := NewMonitor(nil, nil, nil)
+	defer tm.Stop()
+
+	ctx := context.Background()
+	tm.RegisterSession("u1", "tab-a", "c1", "/home/u1")
+	tm.RegisterSession("u1", "tab-b", "c1", "/home/u1")
+
+	tm.ProcessInput(ctx, "u1", "tab-a", []byte("ls -la\r"))
+	tm.parser.SetEditorMode(identity.NewSessionKey("u1", "tab-a"), true, "vim")
+
+	if got := tm.GetSessionState("u1", "tab-a").PendingCommand; got != "ls -la" {
+		t.Fatalf("expected pending command on tab-a, got %q", got)
+	}
+	if got := tm.GetSessionState("u1", "tab-b").PendingCommand; got != "" {
+		t.Fatalf("expected tab-b untouched, got pending %q", got)
+	}
+	if tm.IsInEditorMode("u1", "tab-b") {
+		t.Fatal("expected editor mode on tab-a not to leak into tab-b")
+	}
+
+	tm.UnregisterSession("u1", "tab-a")
+	if tm.GetSessionState("u1", "tab-b") == nil {
+		t.Fatal("expected tab-b to survive closing tab-a")
+	}
+}
+
+func TestSessionKeySplitsOnFirstSeparator(t *testing.T) {
+	key := identity.NewSessionKey("anon_abc", "tab:1")
+	if key.UserID() != "anon_abc" || key.SessionID() != "tab:1" {
+		t.Fatalf("unexpected split: user=%q session=%q", key.UserID(), key.SessionID())
+	}
+}
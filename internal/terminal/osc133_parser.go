@@ -4,10 +4,15 @@ import (
 	"bytes"
 	"fmt"
 	"log/slog"
+	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/ashureev/shsh-labs/internal/agent"
+	"github.com/ashureev/shsh-labs/internal/identity"
 )
 
 // OSC 133 marker types.
@@ -23,8 +28,27 @@ const (
 	// Editor marker types (custom extension).
 	OSC133EditorStart = "G" // Editor started (custom marker)
 	OSC133EditorEnd   = "H" // Editor exited (custom marker)
+
+	// OSC133ShellState reports cwd, exit code and an env snapshot at each
+	// prompt (custom marker): ESC ] 133 ; I ; cwd=<v> ; exit=<n> ; env.<NAME>=<v> BEL.
+	OSC133ShellState = "I"
 )
 
+// maxShellStateValue bounds a single value reported by the shell state marker.
+const maxShellStateValue = 4096
+
+// shellStateEnvAllowlist lists environment variables accepted from the shell
+// state marker. Anything else is ignored even if the shell reports it.
+var shellStateEnvAllowlist = map[string]bool{
+	"USER":        true,
+	"HOME":        true,
+	"SHELL":       true,
+	"PATH":        true,
+	"OLDPWD":      true,
+	"VIRTUAL_ENV": true,
+	"SHLVL":       true,
+}
+
 // MaxCommandHistory is the maximum number of commands to keep in history.
 // When exceeded, oldest entries are removed in batches to avoid frequent reslicing.
 const MaxCommandHistory = 1000
@@ -42,7 +66,7 @@ type OSC133Marker struct {
 
 // OSC133Session tracks command state for a user session using OSC 133 markers.
 type OSC133Session struct {
-	UserID         string
+	Key            identity.SessionKey
 	ContainerID    string
 	CurrentCommand strings.Builder
 	LastCommand    string
@@ -59,6 +83,9 @@ type OSC133Session struct {
 	EditorName     string         // Name of active editor (vim, nano, etc.)
 	InEscapeSeq    bool           // Whether ANSI escape sequence parsing is in progress
 	EscSawBracket  bool           // Whether ESC [ has been seen for CSI sequence
+	HasShellState  bool           // Whether shell state (I) markers have been detected
+	StateExitCode  *int           // Exit code from the latest shell state marker
+	Env            map[string]string
 }
 
 // OSC133State represents the state machine for OSC 133 processing.
@@ -75,21 +102,32 @@ const (
 	OSC133StateCompleted // Command completed, waiting for next prompt
 )
 
+// ExitCodeUnknown is the ExitCode of a command whose completion was detected
+// without the shell reporting its status, e.g. by the prompt fallback. It is
+// passed to the agent unchanged.
+const ExitCodeUnknown = agent.ExitCodeUnknown
+
 // CommandEntry represents a completed command with metadata.
 type CommandEntry struct {
 	Sequence  int
 	Command   string
 	PWD       string
-	ExitCode  int
+	ExitCode  int // ExitCodeUnknown when the shell did not report one
 	Duration  time.Duration
 	Timestamp time.Time
 	StartTime time.Time
 	EndTime   time.Time
+	Env       map[string]string // Allowlisted env snapshot at command end; nil without shell state markers
+}
+
+// Failed reports whether the shell reported a non-zero exit code.
+func (e CommandEntry) Failed() bool {
+	return e.ExitCode != 0 && e.ExitCode != ExitCodeUnknown
 }
 
 // OSC133CommandParser parses OSC 133 markers from terminal output.
 type OSC133CommandParser struct {
-	sessions map[string]*OSC133Session
+	sessions map[identity.SessionKey]*OSC133Session
 	mu       sync.RWMutex
 	logger   *slog.Logger
 
@@ -106,6 +144,9 @@ type OSC133CommandParser struct {
 	// Editor detection patterns
 	editorStartRegex *regexp.Regexp
 	editorEndRegex   *regexp.Regexp
+
+	// Shell state pattern
+	shellStateRegex *regexp.Regexp
 }
 
 // NewOSC133CommandParser creates a new OSC 133 command parser.
@@ -115,7 +156,7 @@ func NewOSC133CommandParser(logger *slog.Logger) *OSC133CommandParser {
 	}
 
 	return &OSC133CommandParser{
-		sessions: make(map[string]*OSC133Session),
+		sessions: make(map[identity.SessionKey]*OSC133Session),
 		logger:   logger,
 
 		// OSC 133 marker patterns: \x1b]133;<type>;<data>\x07
@@ -131,55 +172,58 @@ func NewOSC133CommandParser(logger *slog.Logger) *OSC133CommandParser {
 		// Editor detection patterns
 		editorStartRegex: regexp.MustCompile(`\x1b\]133;G;([^\x07]*)\x07`),
 		editorEndRegex:   regexp.MustCompile(`\x1b\]133;H(?:;[^\x07]*)?\x07`),
+
+		// Shell state pattern
+		shellStateRegex: regexp.MustCompile(`\x1b\]133;I;([^\x07]*)\x07`),
 	}
 }
 
 // RegisterSession registers a new session for OSC 133 tracking.
-func (p *OSC133CommandParser) RegisterSession(userID, containerID string) {
+func (p *OSC133CommandParser) RegisterSession(key identity.SessionKey, containerID string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	p.sessions[userID] = &OSC133Session{
-		UserID:         userID,
+	p.sessions[key] = &OSC133Session{
+		Key:            key,
 		ContainerID:    containerID,
 		HasOSC133:      false,
 		State:          OSC133StateIdle,
 		CommandHistory: make([]CommandEntry, 0, 100),
 	}
 
-	p.logger.Info("[OSC133] Session registered", "user_id", userID, "container_id", containerID)
+	p.logger.Info("[OSC133] Session registered", "session_key", key, "container_id", containerID)
 }
 
 // UnregisterSession removes a session from tracking.
-func (p *OSC133CommandParser) UnregisterSession(userID string) {
+func (p *OSC133CommandParser) UnregisterSession(key identity.SessionKey) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	delete(p.sessions, userID)
-	p.logger.Info("[OSC133] Session unregistered", "user_id", userID)
+	delete(p.sessions, key)
+	p.logger.Info("[OSC133] Session unregistered", "session_key", key)
 }
 
 // ProcessOutput processes terminal output and detects OSC 133 markers.
 // Returns the completed command if one is detected.
-func (p *OSC133CommandParser) ProcessOutput(userID string, data []byte) *CommandEntry {
+func (p *OSC133CommandParser) ProcessOutput(key identity.SessionKey, data []byte) *CommandEntry {
 	previewLen := len(data)
 	if previewLen > 50 {
 		previewLen = 50
 	}
 	p.logger.Info("[OSC133] Processing output",
-		"user_id", userID,
+		"session_key", key,
 		"data_len", len(data),
 		"data_preview", string(data[:previewLen]),
 	)
 
 	// Try to detect OSC 133 markers first - process ALL markers in order
 	markers := p.extractAllOSC133Markers(data)
-	p.logger.Info("[OSC133] Markers found", "user_id", userID, "count", len(markers))
+	p.logger.Info("[OSC133] Markers found", "session_key", key, "count", len(markers))
 	if len(markers) > 0 {
 		var finalEntry *CommandEntry
 		for _, marker := range markers {
-			p.logger.Info("[OSC133] Processing marker", "user_id", userID, "marker_type", marker.Type, "marker_data", marker.Data)
-			if entry := p.handleOSC133Marker(userID, marker); entry != nil {
+			p.logger.Info("[OSC133] Processing marker", "session_key", key, "marker_type", marker.Type, "marker_data", marker.Data)
+			if entry := p.handleOSC133Marker(key, marker); entry != nil {
 				finalEntry = entry // Keep the last completed command
 			}
 		}
@@ -188,7 +232,7 @@ func (p *OSC133CommandParser) ProcessOutput(userID string, data []byte) *Command
 
 	// Fallback to prompt detection if no OSC 133 markers found
 	p.mu.Lock()
-	session := p.sessions[userID]
+	session := p.sessions[key]
 	p.mu.Unlock()
 
 	if session == nil {
@@ -197,7 +241,7 @@ func (p *OSC133CommandParser) ProcessOutput(userID string, data []byte) *Command
 
 	// Check for fallback prompt
 	if p.promptRegex.Match(data) {
-		p.logger.Debug("[OSC133] Fallback prompt detected", "user_id", userID)
+		p.logger.Debug("[OSC133] Fallback prompt detected", "session_key", key)
 		return nil
 	}
 
@@ -207,11 +251,11 @@ func (p *OSC133CommandParser) ProcessOutput(userID string, data []byte) *Command
 // ProcessInput processes raw keyboard input (fallback for shells without OSC 133).
 //
 //nolint:gocognit // Stateful byte-by-byte parser favors explicit branches.
-func (p *OSC133CommandParser) ProcessInput(userID string, data []byte) (string, bool) {
+func (p *OSC133CommandParser) ProcessInput(key identity.SessionKey, data []byte) (string, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	session := p.sessions[userID]
+	session := p.sessions[key]
 	if session == nil {
 		return "", false
 	}
@@ -255,7 +299,7 @@ func (p *OSC133CommandParser) ProcessInput(userID string, data []byte) (string,
 				session.PendingCommand = cmd // Store for OSC 133 handler
 				session.CurrentCommand.Reset()
 				session.CommandStart = time.Now()
-				p.logger.Info("[OSC133] Command captured from input", "user_id", userID, "command", cmd)
+				p.logger.Info("[OSC133] Command captured from input", "session_key", key, "command", cmd)
 				return cmd, true
 			}
 			session.CurrentCommand.Reset()
@@ -273,7 +317,7 @@ func (p *OSC133CommandParser) ProcessInput(userID string, data []byte) (string,
 		default:
 			if b >= 0x20 {
 				session.CurrentCommand.WriteByte(b)
-				p.logger.Debug("[OSC133] Char added to buffer", "user_id", userID, "char", string(b), "buffer", session.CurrentCommand.String())
+				p.logger.Debug("[OSC133] Char added to buffer", "session_key", key, "char", string(b), "buffer", session.CurrentCommand.String())
 			}
 		}
 	}
@@ -294,6 +338,7 @@ func (p *OSC133CommandParser) extractOSC133Marker(data []byte) *OSC133Marker {
 		{p.postExecRegex, OSC133PostExec},
 		{p.editorStartRegex, OSC133EditorStart},
 		{p.editorEndRegex, OSC133EditorEnd},
+		{p.shellStateRegex, OSC133ShellState},
 	}
 
 	for _, m := range markers {
@@ -350,11 +395,11 @@ func (p *OSC133CommandParser) extractAllOSC133Markers(data []byte) []*OSC133Mark
 }
 
 // handleOSC133Marker processes an OSC 133 marker and returns a completed command if applicable.
-func (p *OSC133CommandParser) handleOSC133Marker(userID string, marker *OSC133Marker) *CommandEntry {
+func (p *OSC133CommandParser) handleOSC133Marker(key identity.SessionKey, marker *OSC133Marker) *CommandEntry {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	session := p.sessions[userID]
+	session := p.sessions[key]
 	if session == nil {
 		return nil
 	}
@@ -363,7 +408,7 @@ func (p *OSC133CommandParser) handleOSC133Marker(userID string, marker *OSC133Ma
 	session.HasOSC133 = true
 
 	p.logger.Debug("[OSC133] Marker received",
-		"user_id", userID,
+		"session_key", key,
 		"type", marker.Type,
 		"data", marker.Data,
 		"state", session.State,
@@ -381,7 +426,7 @@ func (p *OSC133CommandParser) handleOSC133Marker(userID string, marker *OSC133Ma
 			session.LastCommand = session.PendingCommand
 		}
 		p.logger.Info("[OSC133] Pre-exec marker, command ready",
-			"user_id", userID,
+			"session_key", key,
 			"command", session.LastCommand,
 			"pending_command", session.PendingCommand,
 		)
@@ -393,7 +438,7 @@ func (p *OSC133CommandParser) handleOSC133Marker(userID string, marker *OSC133Ma
 
 	case OSC133CommandExit:
 		p.logger.Info("[OSC133] Exit marker received",
-			"user_id", userID,
+			"session_key", key,
 			"state", session.State,
 			"exit_code_str", marker.Data,
 			"last_command", session.LastCommand,
@@ -403,13 +448,16 @@ func (p *OSC133CommandParser) handleOSC133Marker(userID string, marker *OSC133Ma
 		if session.State == OSC133StateExecuting || session.State == OSC133StateIdle || session.State == OSC133StateInPrompt {
 			session.CommandEnd = marker.Timestamp
 
-			// Parse exit code from data
+			// Parse exit code from data, falling back to the shell state marker
 			exitCode := 0
 			if marker.Data != "" {
 				if _, err := fmt.Sscanf(marker.Data, "%d", &exitCode); err != nil {
 					p.logger.Warn("[OSC133] Failed to parse exit code", "data", marker.Data, "error", err)
 				}
+			} else if session.StateExitCode != nil {
+				exitCode = *session.StateExitCode
 			}
+			session.StateExitCode = nil
 			session.ExitCode = exitCode
 
 			// Calculate duration
@@ -425,6 +473,7 @@ func (p *OSC133CommandParser) handleOSC133Marker(userID string, marker *OSC133Ma
 				Timestamp: marker.Timestamp,
 				StartTime: session.CommandStart,
 				EndTime:   session.CommandEnd,
+				Env:       session.Env, // Replaced, never mutated, by later state markers
 			}
 
 			// Add to history, removing oldest entries in batches if limit exceeded
@@ -438,7 +487,7 @@ func (p *OSC133CommandParser) handleOSC133Marker(userID string, marker *OSC133Ma
 			session.State = OSC133StateIdle
 
 			p.logger.Info("[OSC133] Command completed",
-				"user_id", userID,
+				"session_key", key,
 				"command", entry.Command,
 				"exit_code", exitCode,
 				"duration_ms", duration.Milliseconds(),
@@ -458,7 +507,7 @@ func (p *OSC133CommandParser) handleOSC133Marker(userID string, marker *OSC133Ma
 		session.CurrentCommand.Reset()
 		session.PendingCommand = ""
 		p.logger.Info("[OSC133] Editor started",
-			"user_id", userID,
+			"session_key", key,
 			"editor", marker.Data,
 		)
 
@@ -466,19 +515,28 @@ func (p *OSC133CommandParser) handleOSC133Marker(userID string, marker *OSC133Ma
 		session.InEditor = false
 		session.EditorName = ""
 		p.logger.Info("[OSC133] Editor exited",
-			"user_id", userID,
+			"session_key", key,
 		)
+
+	case OSC133ShellState:
+		state := parseShellState(marker.Data)
+		session.HasShellState = true
+		if state.cwd != "" {
+			session.CurrentDir = state.cwd
+		}
+		session.StateExitCode = state.exitCode
+		session.Env = state.env
 	}
 
 	return nil
 }
 
 // GetCurrentCommand returns the command currently being typed.
-func (p *OSC133CommandParser) GetCurrentCommand(userID string) string {
+func (p *OSC133CommandParser) GetCurrentCommand(key identity.SessionKey) string {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	session := p.sessions[userID]
+	session := p.sessions[key]
 	if session == nil {
 		return ""
 	}
@@ -486,11 +544,11 @@ func (p *OSC133CommandParser) GetCurrentCommand(userID string) string {
 }
 
 // GetLastCommand returns the last executed command.
-func (p *OSC133CommandParser) GetLastCommand(userID string) string {
+func (p *OSC133CommandParser) GetLastCommand(key identity.SessionKey) string {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	session := p.sessions[userID]
+	session := p.sessions[key]
 	if session == nil {
 		return ""
 	}
@@ -498,11 +556,11 @@ func (p *OSC133CommandParser) GetLastCommand(userID string) string {
 }
 
 // GetCommandHistory returns the command history for a session.
-func (p *OSC133CommandParser) GetCommandHistory(userID string, limit int) []CommandEntry {
+func (p *OSC133CommandParser) GetCommandHistory(key identity.SessionKey, limit int) []CommandEntry {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	session := p.sessions[userID]
+	session := p.sessions[key]
 	if session == nil {
 		return nil
 	}
@@ -512,15 +570,18 @@ func (p *OSC133CommandParser) GetCommandHistory(userID string, limit int) []Comm
 		history = history[len(history)-limit:]
 	}
 
-	return history
+	// Return a copy so callers can iterate without holding the parser lock.
+	out := make([]CommandEntry, len(history))
+	copy(out, history)
+	return out
 }
 
 // GetCurrentDir returns the current working directory for a session.
-func (p *OSC133CommandParser) GetCurrentDir(userID string) string {
+func (p *OSC133CommandParser) GetCurrentDir(key identity.SessionKey) string {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	session := p.sessions[userID]
+	session := p.sessions[key]
 	if session == nil {
 		return ""
 	}
@@ -528,11 +589,11 @@ func (p *OSC133CommandParser) GetCurrentDir(userID string) string {
 }
 
 // HasOSC133Support returns whether OSC 133 markers have been detected for a session.
-func (p *OSC133CommandParser) HasOSC133Support(userID string) bool {
+func (p *OSC133CommandParser) HasOSC133Support(key identity.SessionKey) bool {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	session := p.sessions[userID]
+	session := p.sessions[key]
 	if session == nil {
 		return false
 	}
@@ -540,11 +601,11 @@ func (p *OSC133CommandParser) HasOSC133Support(userID string) bool {
 }
 
 // UpdateCurrentDir updates the current working directory.
-func (p *OSC133CommandParser) UpdateCurrentDir(userID, dir string) {
+func (p *OSC133CommandParser) UpdateCurrentDir(key identity.SessionKey, dir string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	session := p.sessions[userID]
+	session := p.sessions[key]
 	if session != nil {
 		session.CurrentDir = dir
 	}
@@ -552,11 +613,11 @@ func (p *OSC133CommandParser) UpdateCurrentDir(userID, dir string) {
 
 // SetCommandBuffer allows external sources to set the current command.
 // This is used when we detect the command from shell logging.
-func (p *OSC133CommandParser) SetCommandBuffer(userID, command string) {
+func (p *OSC133CommandParser) SetCommandBuffer(key identity.SessionKey, command string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	session := p.sessions[userID]
+	session := p.sessions[key]
 	if session != nil {
 		session.LastCommand = command
 		session.CurrentCommand.Reset()
@@ -564,12 +625,38 @@ func (p *OSC133CommandParser) SetCommandBuffer(userID, command string) {
 	}
 }
 
+// HasShellState returns whether shell state markers have been detected for a session.
+// When true, CurrentDir comes from the shell itself rather than output heuristics.
+func (p *OSC133CommandParser) HasShellState(key identity.SessionKey) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	session := p.sessions[key]
+	if session == nil {
+		return false
+	}
+	return session.HasShellState
+}
+
+// IsExecuting returns whether a command has started and not yet exited.
+// Always false for shells that do not emit OSC 133 markers.
+func (p *OSC133CommandParser) IsExecuting(key identity.SessionKey) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	session := p.sessions[key]
+	if session == nil {
+		return false
+	}
+	return session.HasOSC133 && session.State == OSC133StateExecuting
+}
+
 // IsTyping returns whether the user is currently typing.
-func (p *OSC133CommandParser) IsTyping(userID string) bool {
+func (p *OSC133CommandParser) IsTyping(key identity.SessionKey) bool {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	session := p.sessions[userID]
+	session := p.sessions[key]
 	if session == nil {
 		return false
 	}
@@ -578,11 +665,11 @@ func (p *OSC133CommandParser) IsTyping(userID string) bool {
 }
 
 // IsInEditor returns whether the user is currently in an editor.
-func (p *OSC133CommandParser) IsInEditor(userID string) bool {
+func (p *OSC133CommandParser) IsInEditor(key identity.SessionKey) bool {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	session := p.sessions[userID]
+	session := p.sessions[key]
 	if session == nil {
 		return false
 	}
@@ -590,11 +677,11 @@ func (p *OSC133CommandParser) IsInEditor(userID string) bool {
 }
 
 // GetEditorName returns the name of the active editor (if any).
-func (p *OSC133CommandParser) GetEditorName(userID string) string {
+func (p *OSC133CommandParser) GetEditorName(key identity.SessionKey) string {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	session := p.sessions[userID]
+	session := p.sessions[key]
 	if session == nil {
 		return ""
 	}
@@ -602,11 +689,11 @@ func (p *OSC133CommandParser) GetEditorName(userID string) string {
 }
 
 // SetEditorMode sets the editor mode externally (fallback when OSC 133 G markers aren't available).
-func (p *OSC133CommandParser) SetEditorMode(userID string, inEditor bool, editorName string) {
+func (p *OSC133CommandParser) SetEditorMode(key identity.SessionKey, inEditor bool, editorName string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	session := p.sessions[userID]
+	session := p.sessions[key]
 	if session == nil {
 		return
 	}
@@ -619,7 +706,7 @@ func (p *OSC133CommandParser) SetEditorMode(userID string, inEditor bool, editor
 		session.PendingCommand = ""
 	}
 	p.logger.Info("[OSC133] Editor mode set externally",
-		"user_id", userID,
+		"session_key", key,
 		"in_editor", inEditor,
 		"editor_name", editorName,
 	)
@@ -660,3 +747,45 @@ func (p *OSC133CommandParser) ExtractOSC133Markers(data []byte) []*OSC133Marker
 
 	return markers
 }
+
+// shellState holds the fields of a shell state (I) marker.
+type shellState struct {
+	cwd      string
+	exitCode *int
+	env      map[string]string
+}
+
+// parseShellState decodes "key=value" fields separated by ';' with
+// percent-encoded values. Unknown keys and non-allowlisted env vars are ignored.
+func parseShellState(data string) shellState {
+	var state shellState
+	for _, field := range strings.Split(data, ";") {
+		key, raw, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		value, err := url.PathUnescape(raw)
+		if err != nil || len(value) > maxShellStateValue {
+			continue
+		}
+
+		switch {
+		case key == "cwd":
+			state.cwd = value
+		case key == "exit":
+			if code, err := strconv.Atoi(value); err == nil {
+				state.exitCode = &code
+			}
+		case strings.HasPrefix(key, "env."):
+			name := strings.TrimPrefix(key, "env.")
+			if !shellStateEnvAllowlist[name] {
+				continue
+			}
+			if state.env == nil {
+				state.env = make(map[string]string)
+			}
+			state.env[name] = value
+		}
+	}
+	return state
+}
@@ -3,6 +3,8 @@ package terminal
 import (
 	"testing"
 	"time"
+
+	"github.com/ashureev/shsh-labs/internal/identity"
 )
 
 //nolint:nestif // Test assertions are clearer with explicit nested checks.
@@ -85,30 +87,30 @@ func TestOSC133MarkerExtraction(t *testing.T) {
 
 func TestOSC133CommandLifecycle(t *testing.T) {
 	parser := NewOSC133CommandParser(nil)
-	userID := "test-user"
+	key := identity.NewSessionKey("test-user", "default")
 	containerID := "test-container"
 
-	parser.RegisterSession(userID, containerID)
-	defer parser.UnregisterSession(userID)
+	parser.RegisterSession(key, containerID)
+	defer parser.UnregisterSession(key)
 
 	command := "ls -la"
-	parser.SetCommandBuffer(userID, command)
+	parser.SetCommandBuffer(key, command)
 
 	preExecMarker := parser.extractOSC133Marker([]byte{0x1b, ']', '1', '3', '3', ';', 'B', 0x07})
-	entry := parser.handleOSC133Marker(userID, preExecMarker)
+	entry := parser.handleOSC133Marker(key, preExecMarker)
 	if entry != nil {
 		t.Errorf("pre-exec should not produce command entry, got %+v", entry)
 	}
 
 	execMarker := parser.extractOSC133Marker([]byte{0x1b, ']', '1', '3', '3', ';', 'C', 0x07})
-	entry = parser.handleOSC133Marker(userID, execMarker)
+	entry = parser.handleOSC133Marker(key, execMarker)
 	if entry != nil {
 		t.Errorf("exec marker should not produce entry, got %+v", entry)
 	}
 
 	time.Sleep(10 * time.Millisecond)
 	exitMarker := parser.extractOSC133Marker([]byte{0x1b, ']', '1', '3', '3', ';', 'D', ';', '0', 0x07})
-	entry = parser.handleOSC133Marker(userID, exitMarker)
+	entry = parser.handleOSC133Marker(key, exitMarker)
 	if entry == nil {
 		t.Error("exit marker should produce command entry")
 		return
@@ -130,29 +132,29 @@ func TestOSC133CommandLifecycle(t *testing.T) {
 		t.Errorf("entry.Sequence = %v, want %v", entry.Sequence, 1)
 	}
 
-	if !parser.HasOSC133Support(userID) {
+	if !parser.HasOSC133Support(key) {
 		t.Error("OSC 133 support should be detected")
 	}
 }
 
 func TestOSC133FallbackInputProcessing(t *testing.T) {
 	parser := NewOSC133CommandParser(nil)
-	userID := "test-user"
+	key := identity.NewSessionKey("test-user", "default")
 
-	parser.RegisterSession(userID, "test-container")
-	defer parser.UnregisterSession(userID)
+	parser.RegisterSession(key, "test-container")
+	defer parser.UnregisterSession(key)
 
-	_, executed := parser.ProcessInput(userID, []byte("l"))
+	_, executed := parser.ProcessInput(key, []byte("l"))
 	if executed {
 		t.Error("partial command should not execute")
 	}
 
-	_, executed = parser.ProcessInput(userID, []byte("s"))
+	_, executed = parser.ProcessInput(key, []byte("s"))
 	if executed {
 		t.Error("partial command should not execute")
 	}
 
-	cmd, executed := parser.ProcessInput(userID, []byte("\n"))
+	cmd, executed := parser.ProcessInput(key, []byte("\n"))
 	if !executed {
 		t.Error("Enter should execute command")
 	}
@@ -161,26 +163,26 @@ func TestOSC133FallbackInputProcessing(t *testing.T) {
 		t.Errorf("cmd = %v, want ls", cmd)
 	}
 
-	if parser.HasOSC133Support(userID) {
+	if parser.HasOSC133Support(key) {
 		t.Error("OSC 133 support should not be detected without markers")
 	}
 }
 
 func TestOSC133FallbackIgnoresArrowEscapeSequences(t *testing.T) {
 	parser := NewOSC133CommandParser(nil)
-	userID := "test-user-escape"
+	key := identity.NewSessionKey("test-user-escape", "default")
 
-	parser.RegisterSession(userID, "test-container")
-	defer parser.UnregisterSession(userID)
+	parser.RegisterSession(key, "test-container")
+	defer parser.UnregisterSession(key)
 
 	// Up arrow key (ESC [ A) should not be treated as literal command text.
-	if cmd, executed := parser.ProcessInput(userID, []byte{0x1b, '[', 'A'}); executed || cmd != "" {
+	if cmd, executed := parser.ProcessInput(key, []byte{0x1b, '[', 'A'}); executed || cmd != "" {
 		t.Fatalf("escape sequence should not execute command, got executed=%v cmd=%q", executed, cmd)
 	}
 
 	// Next real command should execute correctly and not include leftover "[A".
-	_, _ = parser.ProcessInput(userID, []byte("docker"))
-	cmd, executed := parser.ProcessInput(userID, []byte("\n"))
+	_, _ = parser.ProcessInput(key, []byte("docker"))
+	cmd, executed := parser.ProcessInput(key, []byte("\n"))
 	if !executed {
 		t.Fatal("expected enter to execute command")
 	}
@@ -199,3 +201,35 @@ func BenchmarkOSC133MarkerExtraction(b *testing.B) {
 		parser.extractOSC133Marker(data)
 	}
 }
+
+func TestOSC133ShellStateMarker(t *testing.T) {
+	parser := NewOSC133CommandParser(nil)
+	key := identity.NewSessionKey("user1", "tab1")
+	parser.RegisterSession(key, "container1")
+
+	parser.ProcessInput(key, []byte("cd /tmp/a;b && false\r"))
+	parser.ProcessOutput(key, []byte("\x1b]133;B\x07"))
+	entry := parser.ProcessOutput(key, []byte(
+		"\x1b]133;C\x07"+
+			"\x1b]133;I;cwd=/tmp/a%3Bb;exit=1;env.VIRTUAL_ENV=/venv;env.AWS_SECRET_ACCESS_KEY=x\x07"+
+			"\x1b]133;D;1\x07"))
+
+	if entry == nil {
+		t.Fatal("expected completed command")
+	}
+	if entry.PWD != "/tmp/a;b" {
+		t.Errorf("expected decoded PWD /tmp/a;b, got %q", entry.PWD)
+	}
+	if entry.ExitCode != 1 {
+		t.Errorf("expected exit code 1, got %d", entry.ExitCode)
+	}
+	if entry.Env["VIRTUAL_ENV"] != "/venv" {
+		t.Errorf("expected VIRTUAL_ENV in env snapshot, got %v", entry.Env)
+	}
+	if _, ok := entry.Env["AWS_SECRET_ACCESS_KEY"]; ok {
+		t.Error("expected non-allowlisted env var to be dropped")
+	}
+	if !parser.HasShellState(key) {
+		t.Error("expected shell state support to be detected")
+	}
+}
@@ -0,0 +1,149 @@
+package terminal
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/agent"
+)
+
+const (
+	// defaultFloodThreshold is the output rate (bytes/sec) above which a
+	// session switches to sampled monitor forwarding.
+	defaultFloodThreshold = 256 * 1024
+	// defaultFloodSampleBudget is how many bytes/sec still reach the monitor
+	// while sampling. Chunks carrying OSC 133 markers are always forwarded.
+	defaultFloodSampleBudget = 16 * 1024
+	// floodWindow is the rate measurement window.
+	floodWindow = time.Second
+)
+
+// osc133Prefix identifies chunks carrying shell integration markers.
+var osc133Prefix = []byte("\x1b]133;")
+
+// floodTransition reports a change in flood state from outputFloodGuard.
+type floodTransition int
+
+const (
+	floodUnchanged floodTransition = iota
+	floodStarted
+	floodEnded
+)
+
+// outputFloodGuard detects runaway terminal output (`yes`, `cat /dev/urandom`)
+// and decides which chunks are forwarded to the monitor. The browser stream is
+// never throttled; only the analysis path is sampled.
+type outputFloodGuard struct {
+	threshold    int // bytes per window that trigger sampling
+	sampleBudget int // bytes per window forwarded while sampling
+
+	mu          sync.Mutex
+	windowStart time.Time
+	windowBytes int
+	sampled     int // bytes forwarded in the current window while flooding
+	flooding    bool
+	skipped     int64 // bytes withheld from the monitor during this flood
+	markerOpen  bool  // The last chunk ended partway through an OSC 133 marker
+}
+
+func newOutputFloodGuard(threshold, sampleBudget int) *outputFloodGuard {
+	return &outputFloodGuard{threshold: threshold, sampleBudget: sampleBudget}
+}
+
+// admit records a chunk of output and reports whether it should be forwarded
+// to the monitor, along with any flood state transition.
+func (g *outputFloodGuard) admit(p []byte, now time.Time) (bool, floodTransition) {
+	if g == nil || g.threshold <= 0 {
+		return true, floodUnchanged
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	transition := floodUnchanged
+	if now.Sub(g.windowStart) >= floodWindow {
+		// Leave flood mode once a full window stays under half the threshold.
+		// A gap of two windows means at least one window was silent.
+		quiet := g.windowBytes < g.threshold/2 || now.Sub(g.windowStart) >= 2*floodWindow
+		if g.flooding && quiet {
+			g.flooding = false
+			transition = floodEnded
+		}
+		g.windowStart = now
+		g.windowBytes = 0
+		g.sampled = 0
+	}
+
+	g.windowBytes += len(p)
+	if !g.flooding && g.windowBytes > g.threshold {
+		g.flooding = true
+		g.skipped = 0
+		transition = floodStarted
+	}
+
+	// Command boundaries must always reach the parser, including markers
+	// split across reads: the chunk a marker starts in and the one it ends
+	// in are both forwarded.
+	continued := g.markerOpen
+	g.markerOpen = endsInOSC133(p)
+	if !g.flooding {
+		return true, transition
+	}
+	if continued || g.markerOpen || bytes.Contains(p, osc133Prefix) {
+		return true, transition
+	}
+	if g.sampled+len(p) <= g.sampleBudget {
+		g.sampled += len(p)
+		return true, transition
+	}
+	g.skipped += int64(len(p))
+	return false, transition
+}
+
+// endsInOSC133 reports whether p ends partway through an OSC 133 marker,
+// either in its prefix or before the BEL or ST terminating it.
+func endsInOSC133(p []byte) bool {
+	if i := bytes.LastIndex(p, osc133Prefix); i >= 0 {
+		rest := p[i+len(osc133Prefix):]
+		return bytes.IndexByte(rest, '\a') < 0 && !bytes.Contains(rest, []byte("\x1b\\"))
+	}
+	for n := min(len(osc133Prefix)-1, len(p)); n > 0; n-- {
+		if bytes.HasSuffix(p, osc133Prefix[:n]) {
+			return true
+		}
+	}
+	return false
+}
+
+// skippedBytes returns how many bytes were withheld during the current or last flood.
+func (g *outputFloodGuard) skippedBytes() int64 {
+	if g == nil {
+		return 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.skipped
+}
+
+// floodWarning is shown to the learner when their terminal floods with output.
+const floodWarning = "Your terminal is producing a lot of output very quickly. " +
+	"Hints may be less accurate until it settles. Press Ctrl+C to stop the running command."
+
+// NotifyOutputFlood warns the learner that a command is flooding the terminal
+// and AI analysis is working from sampled output.
+func (tm *Monitor) NotifyOutputFlood(ctx context.Context, userID, sessionID string) {
+	session := tm.GetSessionState(userID, sessionID)
+	if session == nil || session.IsSuspended() {
+		return
+	}
+
+	tm.sendToSidebar(ctx, userID, &agent.Response{
+		Type:      string(agent.ResponseTypeAlert),
+		Content:   floodWarning,
+		Alert:     floodWarning,
+		UserID:    userID,
+		SessionID: sessionID,
+	})
+}
@@ -0,0 +1,80 @@
+package terminal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOutputFloodGuardSamplesAndRecovers(t *testing.T) {
+	g := newOutputFloodGuard(1000, 200)
+	now := time.Unix(1_700_000_000, 0)
+	chunk := make([]byte, 100)
+
+	// Under the threshold everything is forwarded.
+	for i := 0; i < 10; i++ {
+		if ok, tr := g.admit(chunk, now); !ok || tr != floodUnchanged {
+			t.Fatalf("chunk %d: expected forward without transition, got %v %v", i, ok, tr)
+		}
+	}
+
+	// Crossing the threshold starts sampling.
+	if _, tr := g.admit(chunk, now); tr != floodStarted {
+		t.Fatalf("expected flood to start, got %v", tr)
+	}
+	forwarded := 0
+	for i := 0; i < 20; i++ {
+		if ok, _ := g.admit(chunk, now); ok {
+			forwarded++
+		}
+	}
+	if forwarded != 1 {
+		t.Fatalf("expected sample budget to admit 1 more chunk, got %d", forwarded)
+	}
+
+	// OSC 133 markers always pass so command completion is still detected.
+	if ok, _ := g.admit([]byte("\x1b]133;D;0\x07"), now); !ok {
+		t.Fatal("expected OSC 133 marker chunk to be forwarded")
+	}
+
+	// A quiet window ends the flood.
+	now = now.Add(2 * time.Second)
+	if ok, tr := g.admit(chunk, now); !ok || tr != floodEnded {
+		t.Fatalf("expected flood to end, got %v %v", ok, tr)
+	}
+	if g.skippedBytes() == 0 {
+		t.Fatal("expected skipped bytes to be recorded")
+	}
+}
+
+func TestOutputFloodGuardForwardsSplitMarkers(t *testing.T) {
+	g := newOutputFloodGuard(1000, 0)
+	now := time.Unix(1_700_000_000, 0)
+	if _, tr := g.admit(make([]byte, 2000), now); tr != floodStarted {
+		t.Fatalf("expected flood to start, got %v", tr)
+	}
+
+	for _, split := range [][]string{
+		{"output\x1b]13", "3;D;0\x07more output"},
+		{"output\x1b]133;D", ";0\x07more output"},
+		{"output\x1b]133;D;0\x1b", "\\more output"},
+	} {
+		for i, chunk := range split {
+			if ok, _ := g.admit([]byte(chunk), now); !ok {
+				t.Errorf("%q: expected part %d to be forwarded", split, i)
+			}
+		}
+		if ok, _ := g.admit([]byte("plain output"), now); ok {
+			t.Errorf("%q: expected output after the marker to be sampled out", split)
+		}
+	}
+}
+
+func TestOutputFloodGuardDisabled(t *testing.T) {
+	g := newOutputFloodGuard(0, 0)
+	big := make([]byte, 1<<20)
+	for i := 0; i < 5; i++ {
+		if ok, tr := g.admit(big, time.Now()); !ok || tr != floodUnchanged {
+			t.Fatalf("expected disabled guard to forward everything, got %v %v", ok, tr)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package terminal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// PairSessionID is the tab session ID of a pair's shared terminal. The host
+// attaches it to their container with /ws/terminal?pair=1; the partner's
+// pair connection follows it.
+const PairSessionID = "pair"
+
+// Pairing errors.
+var (
+	ErrNotPaired      = errors.New("terminal: user is not paired")
+	ErrAlreadyPaired  = errors.New("terminal: user is already paired")
+	ErrSelfPairing    = errors.New("terminal: cannot pair a user with themselves")
+	ErrNotDriver      = errors.New("terminal: only the driver can hand over control")
+	ErrNotNavigator   = errors.New("terminal: only the navigator can request control")
+	ErrNoHostTerminal = errors.New("terminal: host terminal is not connected")
+)
+
+// PairStatus describes a pair. The host owns the container both learners
+// work in; the driver is whichever of them may currently type.
+type PairStatus struct {
+	Host             string    `json:"host"`
+	Partner          string    `json:"partner"`
+	Driver           string    `json:"driver"`
+	ControlRequested bool      `json:"control_requested"`
+	Since            time.Time `json:"since"`
+}
+
+// Navigator returns the member of the pair who is not driving.
+func (p PairStatus) Navigator() string {
+	if p.Driver == p.Host {
+		return p.Partner
+	}
+	return p.Host
+}
+
+// pairing is a pair's state in the session manager.
+type pairing struct {
+	status    PairStatus
+	followers map[*websocket.Conn]*frameCipher // partner connections mirroring the host terminal, with their ciphers
+}
+
+// pairAudit returns a logger for pairing audit records.
+func pairAudit(status PairStatus) *slog.Logger {
+	return slog.With("audit", "pairing", "host", status.Host, "partner", status.Partner)
+}
+
+// StartPairing pairs partnerID with hostID, who drives first. Neither may
+// already be paired.
+func (m *SessionManager) StartPairing(hostID, partnerID string) (PairStatus, error) {
+	if hostID == partnerID {
+		return PairStatus{}, ErrSelfPairing
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.pairs[hostID] != nil || m.pairs[partnerID] != nil {
+		return PairStatus{}, ErrAlreadyPaired
+	}
+	p := &pairing{
+		status:    PairStatus{Host: hostID, Partner: partnerID, Driver: hostID, Since: time.Now()},
+		followers: make(map[*websocket.Conn]*frameCipher),
+	}
+	m.pairs[hostID] = p
+	m.pairs[partnerID] = p
+	pairAudit(p.status).Info("Pairing started")
+	return p.status, nil
+}
+
+// EndPairing dissolves the pair userID belongs to and closes both members'
+// pair connections.
+func (m *SessionManager) EndPairing(userID, reason string) (PairStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := m.pairs[userID]
+	if p == nil {
+		return PairStatus{}, ErrNotPaired
+	}
+	delete(m.pairs, p.status.Host)
+	delete(m.pairs, p.status.Partner)
+	for _, member := range []string{p.status.Host, p.status.Partner} {
+		if conn := m.active[member][PairSessionID]; conn != nil {
+			if err := conn.Close(websocket.StatusNormalClosure, "pairing ended"); err != nil {
+				slog.Debug("Failed to close pair terminal", "user_id", member, "error", err)
+			}
+		}
+	}
+	pairAudit(p.status).Info("Pairing ended", "by", userID, "reason", reason)
+	return p.status, nil
+}
+
+// Pairing returns the pair userID belongs to.
+func (m *SessionManager) Pairing(userID string) (PairStatus, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if p := m.pairs[userID]; p != nil {
+		return p.status, true
+	}
+	return PairStatus{}, false
+}
+
+// ListPairings returns every active pair.
+func (m *SessionManager) ListPairings() []PairStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var pairs []PairStatus
+	for userID, p := range m.pairs {
+		if userID == p.status.Host {
+			pairs = append(pairs, p.status)
+		}
+	}
+	return pairs
+}
+
+// RequestControl records that the navigator wants to type and notifies the
+// pair.
+func (m *SessionManager) RequestControl(userID string) (PairStatus, error) {
+	status, err := m.updatePairing(userID, func(p *PairStatus) error {
+		if p.Driver == userID {
+			return ErrNotNavigator
+		}
+		p.ControlRequested = true
+		return nil
+	})
+	if err == nil {
+		pairAudit(status).Info("Control requested", "by", userID)
+	}
+	return status, err
+}
+
+// GrantControl hands typing over from the driver to the navigator.
+func (m *SessionManager) GrantControl(userID string) (PairStatus, error) {
+	status, err := m.updatePairing(userID, func(p *PairStatus) error {
+		if p.Driver != userID {
+			return ErrNotDriver
+		}
+		p.Driver = p.Navigator()
+		p.ControlRequested = false
+		return nil
+	})
+	if err == nil {
+		pairAudit(status).Info("Control granted", "from", userID, "to", status.Driver)
+	}
+	return status, err
+}
+
+// updatePairing applies update to userID's pair and sends the new status to
+// both members' pair connections.
+func (m *SessionManager) updatePairing(userID string, update func(*PairStatus) error) (PairStatus, error) {
+	status, conns, err := func() (PairStatus, []*websocket.Conn, error) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		p := m.pairs[userID]
+		if p == nil {
+			return PairStatus{}, nil, ErrNotPaired
+		}
+		next := p.status
+		if err := update(&next); err != nil {
+			return PairStatus{}, nil, err
+		}
+		p.status = next
+		return next, m.pairConnsLocked(p), nil
+	}()
+	if err != nil {
+		return PairStatus{}, err
+	}
+	broadcastPairStatus(conns, status)
+	return status, nil
+}
+
+// pairConnsLocked returns the host's pair terminal and the partner's
+// followers. m.mu must be held.
+func (m *SessionManager) pairConnsLocked(p *pairing) []*websocket.Conn {
+	conns := make([]*websocket.Conn, 0, len(p.followers)+1)
+	if conn := m.active[p.status.Host][PairSessionID]; conn != nil {
+		conns = append(conns, conn)
+	}
+	for conn := range p.followers {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// broadcastPairStatus sends a "pair" message with status to conns.
+func broadcastPairStatus(conns []*websocket.Conn, status PairStatus) {
+	data, err := json.Marshal(struct {
+		Type string `json:"type"`
+		PairStatus
+	}{Type: "pair", PairStatus: status})
+	if err != nil {
+		return
+	}
+	for _, conn := range conns {
+		if err := conn.Write(context.Background(), websocket.MessageText, data); err != nil {
+			slog.Debug("Failed to send pair status", "error", err)
+		}
+	}
+}
+
+// canType reports whether userID's keystrokes may reach a pair terminal.
+func (m *SessionManager) canType(userID string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	p := m.pairs[userID]
+	return p == nil || p.status.Driver == userID
+}
+
+// addPairFollower mirrors the host's pair terminal to a partner connection
+// and returns the current status.
+func (m *SessionManager) addPairFollower(partnerID string, out terminalConn) (PairStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := m.pairs[partnerID]
+	if p == nil || p.status.Partner != partnerID {
+		return PairStatus{}, ErrNotPaired
+	}
+	p.followers[out.conn] = out.sealer
+	return p.status, nil
+}
+
+// removePairFollower stops mirroring to conn.
+func (m *SessionManager) removePairFollower(partnerID string, conn *websocket.Conn) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if p := m.pairs[partnerID]; p != nil {
+		delete(p.followers, conn)
+	}
+}
+
+// pairFollowers returns the partner connections following hostID's pair
+// terminal.
+func (m *SessionManager) pairFollowers(hostID string) []terminalConn {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	p := m.pairs[hostID]
+	if p == nil || p.status.Host != hostID {
+		return nil
+	}
+	conns := make([]terminalConn, 0, len(p.followers))
+	for conn, sealer := range p.followers {
+		conns = append(conns, terminalConn{conn: conn, sealer: sealer})
+	}
+	return conns
+}
+
+// pairMirror copies a host's pair terminal output to the partner's
+// connections. A slow or closed follower never holds up the host.
+type pairMirror struct {
+	ctx    context.Context
+	sm     *SessionManager
+	hostID string
+}
+
+func (w *pairMirror) Write(p []byte) (int, error) {
+	for _, out := range w.sm.pairFollowers(w.hostID) {
+		writeCtx, cancel := context.WithTimeout(w.ctx, time.Second)
+		if err := out.writeOutput(writeCtx, p); err != nil {
+			slog.Debug("Failed to mirror pair output", "host", w.hostID, "error", err)
+		}
+		cancel()
+	}
+	return len(p), nil
+}
+
+// pairControl handles the pairing messages of a pair connection and reports
+// whether msg was one.
+func (h *WebSocketHandler) pairControl(ws *websocket.Conn, userID string, msg wsMessage) bool {
+	var err error
+	switch msg.Type {
+	case "request_control":
+		_, err = h.sm.RequestControl(userID)
+	case "grant_control":
+		_, err = h.sm.GrantControl(userID)
+	default:
+		return false
+	}
+	if err != nil {
+		if writeErr := h.writeJSON(ws, map[string]string{"type": "error", "error": pairErrorCode(err)}); writeErr != nil {
+			slog.Debug("Failed to send pairing error", "error", writeErr)
+		}
+	}
+	return true
+}
+
+// pairErrorCode maps a pairing error to the code sent to clients.
+func pairErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrNotDriver):
+		return "not_driver"
+	case errors.Is(err, ErrNotNavigator):
+		return "not_navigator"
+	case errors.Is(err, ErrNoHostTerminal):
+		return "host_not_connected"
+	default:
+		return "not_paired"
+	}
+}
+
+// serveFollower runs the partner's side of a pair: the host's terminal
+// output arrives through pairMirror, and keystrokes reach the host's shell
+// only while the partner drives.
+//
+//nolint:gocognit // Message dispatch mirrors inputLoop for the follower side.
+func (h *WebSocketHandler) serveFollower(ctx context.Context, out terminalConn, partnerID string) {
+	ws := out.conn
+	status, err := h.sm.addPairFollower(partnerID, out)
+	if err != nil {
+		if writeErr := h.writeJSON(ws, map[string]string{"error": "not_paired"}); writeErr != nil {
+			slog.Debug("Failed to send not_paired error", "error", writeErr)
+		}
+		return
+	}
+	defer h.sm.removePairFollower(partnerID, ws)
+	broadcastPairStatus([]*websocket.Conn{ws}, status)
+
+	audit := pairAudit(status)
+	audit.Info("Partner joined pair terminal")
+	defer audit.Info("Partner left pair terminal")
+
+	// The host's classroom policy applies to everything typed into their shell.
+	var blocked inputKeySet
+	if h.inputFilter != nil {
+		blocked = h.inputFilter.policyFor(h.classroomOf(ctx, status.Host))
+	}
+
+	for {
+		typ, message, err := ws.Read(ctx)
+		if err != nil {
+			return
+		}
+		// As in inputLoop, an encrypted terminal's keystrokes arrive sealed
+		// and nothing else may carry them.
+		if out.sealer != nil && typ == websocket.MessageBinary {
+			data, err := out.sealer.openFrame(typ, message)
+			if err != nil {
+				slog.Warn("Encrypted partner input refused", "error", err, "user_id", partnerID)
+				return
+			}
+			h.forwardPartnerInput(ws, status.Host, partnerID, &blocked, data)
+			continue
+		}
+		var msg wsMessage
+		if err := json.Unmarshal(message, &msg); err != nil {
+			continue
+		}
+		if h.pairControl(ws, partnerID, msg) {
+			continue
+		}
+		switch msg.Type {
+		case "data":
+			if out.sealer != nil {
+				slog.Warn("Encrypted partner input refused", "error", errE2EPlainInput, "user_id", partnerID)
+				return
+			}
+			h.forwardPartnerInput(ws, status.Host, partnerID, &blocked, []byte(msg.Content))
+		case "ping":
+			if err := h.writeJSON(ws, map[string]string{"type": "pong"}); err != nil {
+				slog.Debug("Failed to send pong", "error", err)
+			}
+		case "terminate":
+			return
+		}
+	}
+}
+
+// forwardPartnerInput types the partner's keystrokes into the host's pair
+// terminal while the partner drives.
+func (h *WebSocketHandler) forwardPartnerInput(ws *websocket.Conn, hostID, partnerID string, blocked *inputKeySet, data []byte) {
+	if len(data) > h.maxInputSize() || !h.sm.canType(partnerID) {
+		return
+	}
+	if data = blocked.filter(data); len(data) == 0 {
+		return
+	}
+	input := h.sm.InputWriter(hostID, PairSessionID)
+	if input == nil {
+		if err := h.writeJSON(ws, map[string]string{"type": "error", "error": pairErrorCode(ErrNoHostTerminal)}); err != nil {
+			slog.Debug("Failed to send host_not_connected error", "error", err)
+		}
+		return
+	}
+	if _, err := input.Write(data); err != nil {
+		slog.Debug("Failed to forward partner input", "error", err, "host", hostID)
+	}
+}
@@ -0,0 +1,199 @@
+package terminal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+const (
+	testHostID    = "host"
+	testPartnerID = "partner"
+)
+
+// lockedBuffer is a bytes.Buffer safe for concurrent writes and reads.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestSessionManager_PairingControl(t *testing.T) {
+	sm := NewSessionManager()
+	if _, err := sm.StartPairing(testHostID, testHostID); !errors.Is(err, ErrSelfPairing) {
+		t.Fatalf("expected ErrSelfPairing, got %v", err)
+	}
+	status, err := sm.StartPairing(testHostID, testPartnerID)
+	if err != nil {
+		t.Fatalf("StartPairing: %v", err)
+	}
+	if status.Driver != testHostID {
+		t.Fatalf("expected host to drive first, got %q", status.Driver)
+	}
+	if _, err := sm.StartPairing(testPartnerID, "other"); !errors.Is(err, ErrAlreadyPaired) {
+		t.Fatalf("expected ErrAlreadyPaired, got %v", err)
+	}
+	if sm.canType(testPartnerID) || !sm.canType(testHostID) || !sm.canType("other") {
+		t.Fatal("only the driver and unpaired users may type")
+	}
+
+	if _, err := sm.RequestControl(testHostID); !errors.Is(err, ErrNotNavigator) {
+		t.Fatalf("expected ErrNotNavigator, got %v", err)
+	}
+	if status, err = sm.RequestControl(testPartnerID); err != nil || !status.ControlRequested {
+		t.Fatalf("RequestControl: %+v, %v", status, err)
+	}
+	if _, err := sm.GrantControl(testPartnerID); !errors.Is(err, ErrNotDriver) {
+		t.Fatalf("expected ErrNotDriver, got %v", err)
+	}
+	if status, err = sm.GrantControl(testHostID); err != nil || status.Driver != testPartnerID || status.ControlRequested {
+		t.Fatalf("GrantControl: %+v, %v", status, err)
+	}
+	if !sm.canType(testPartnerID) || sm.canType(testHostID) {
+		t.Fatal("expected control to pass to the partner")
+	}
+
+	if pairs := sm.ListPairings(); len(pairs) != 1 || pairs[0].Host != testHostID {
+		t.Fatalf("unexpected pairs: %+v", pairs)
+	}
+	if _, err := sm.EndPairing(testPartnerID, "test"); err != nil {
+		t.Fatalf("EndPairing: %v", err)
+	}
+	if _, ok := sm.Pairing(testHostID); ok {
+		t.Fatal("expected pairing to end for both members")
+	}
+	if _, err := sm.EndPairing(testHostID, "test"); !errors.Is(err, ErrNotPaired) {
+		t.Fatalf("expected ErrNotPaired, got %v", err)
+	}
+}
+
+func TestWebSocketHandler_PairFollower(t *testing.T) {
+	sm := NewSessionManager()
+	h := &WebSocketHandler{sm: sm}
+	if _, err := sm.StartPairing(testHostID, testPartnerID); err != nil {
+		t.Fatalf("StartPairing: %v", err)
+	}
+	hostInput := &lockedBuffer{}
+	sm.RegisterInput(testHostID, PairSessionID, hostInput)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer func() { _ = ws.CloseNow() }()
+		h.serveFollower(r.Context(), terminalConn{conn: ws}, testPartnerID)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer func() { _ = conn.CloseNow() }()
+
+	// readStatus returns the first pair status message with driver.
+	readStatus := func(driver string) PairStatus {
+		t.Helper()
+		for {
+			typ, data, err := conn.Read(ctx)
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			var msg struct {
+				Type string `json:"type"`
+				PairStatus
+			}
+			if typ == websocket.MessageText && json.Unmarshal(data, &msg) == nil && msg.Type == "pair" && msg.Driver == driver {
+				return msg.PairStatus
+			}
+		}
+	}
+	send := func(v any) {
+		t.Helper()
+		data, _ := json.Marshal(v)
+		if err := conn.Write(ctx, websocket.MessageText, data); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	readStatus(testHostID)
+
+	// Navigator keystrokes are dropped; a control request reaches the pair.
+	send(wsMessage{Type: "data", Content: "rm -rf x\r"})
+	send(wsMessage{Type: "request_control"})
+	if status := waitForPairing(t, sm, func(s PairStatus) bool { return s.ControlRequested }); !status.ControlRequested {
+		t.Fatal("expected control request to be recorded")
+	}
+	if got := hostInput.String(); got != "" {
+		t.Fatalf("navigator input reached the shell: %q", got)
+	}
+
+	// Once granted, the partner types into the host's shell.
+	if _, err := sm.GrantControl(testHostID); err != nil {
+		t.Fatalf("GrantControl: %v", err)
+	}
+	readStatus(testPartnerID)
+	send(wsMessage{Type: "data", Content: "ls\r"})
+	deadline := time.Now().Add(2 * time.Second)
+	for hostInput.String() != "ls\r" {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected driver input in host shell, got %q", hostInput.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Host terminal output is mirrored to the partner.
+	mirror := &pairMirror{ctx: ctx, sm: sm, hostID: testHostID}
+	if _, err := mirror.Write([]byte("file.txt\r\n")); err != nil {
+		t.Fatalf("mirror: %v", err)
+	}
+	for {
+		typ, data, err := conn.Read(ctx)
+		if err != nil {
+			t.Fatalf("read mirrored output: %v", err)
+		}
+		if typ == websocket.MessageBinary {
+			if string(data) != "file.txt\r\n" {
+				t.Fatalf("unexpected mirrored output %q", data)
+			}
+			break
+		}
+	}
+}
+
+// waitForPairing polls the test host's pair until cond holds or a second
+// passes.
+func waitForPairing(t *testing.T, sm *SessionManager, cond func(PairStatus) bool) PairStatus {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		status, ok := sm.Pairing(testHostID)
+		if ok && cond(status) || time.Now().After(deadline) {
+			return status
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -2,21 +2,23 @@
 package terminal
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"log/slog"
+	"math/rand/v2"
+	"strings"
 	"sync"
 	"time"
-
-	"github.com/docker/docker/client"
 )
 
 // PTYController provides AI typing capabilities for terminal sessions.
-// It can inject keystrokes into a Docker container's terminal to simulate
+// It can inject keystrokes into a container's terminal to simulate
 // human-like typing for demonstrations.
 type PTYController struct {
-	dockerClient *client.Client
-	config       PTYConfig
-	mu           sync.RWMutex
-	logger       *slog.Logger
+	config PTYConfig
+	mu     sync.RWMutex
+	logger *slog.Logger
 }
 
 // PTYConfig holds configuration for PTY operations.
@@ -29,6 +31,8 @@ type PTYConfig struct {
 	ThinkPause time.Duration
 	// PunctuationPause is extra delay after punctuation (default: 100ms)
 	PunctuationPause time.Duration
+	// MaxPlaybackPause caps idle gaps when playing back a recording (default: 2s)
+	MaxPlaybackPause time.Duration
 }
 
 // DefaultPTYConfig returns sensible defaults for human-like typing.
@@ -38,6 +42,7 @@ func DefaultPTYConfig() PTYConfig {
 		JitterMax:        25 * time.Millisecond,
 		ThinkPause:       500 * time.Millisecond,
 		PunctuationPause: 100 * time.Millisecond,
+		MaxPlaybackPause: 2 * time.Second,
 	}
 }
 
@@ -51,14 +56,13 @@ type TypeResult struct {
 }
 
 // NewPTYController creates a new PTY controller for AI typing.
-func NewPTYController(dockerClient *client.Client, config PTYConfig, logger *slog.Logger) *PTYController {
+func NewPTYController(config PTYConfig, logger *slog.Logger) *PTYController {
 	if logger == nil {
 		logger = slog.Default()
 	}
 	return &PTYController{
-		dockerClient: dockerClient,
-		config:       config,
-		logger:       logger,
+		config: config,
+		logger: logger,
 	}
 }
 
@@ -75,3 +79,103 @@ func (p *PTYController) GetConfig() PTYConfig {
 	defer p.mu.RUnlock()
 	return p.config
 }
+
+// TypeCommand types a command into w one keystroke at a time using the
+// configured human-like timing, optionally pressing Enter afterwards.
+// Typing stops early if ctx is cancelled.
+func (p *PTYController) TypeCommand(ctx context.Context, w io.Writer, command string, execute bool) TypeResult {
+	cfg := p.GetConfig()
+	start := time.Now()
+	result := TypeResult{Command: command}
+
+	if err := sleepContext(ctx, cfg.ThinkPause); err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	for _, r := range command {
+		if _, err := io.WriteString(w, string(r)); err != nil {
+			result.Error = fmt.Errorf("type character %d: %w", result.CharactersTyped, err)
+			result.Duration = time.Since(start)
+			return result
+		}
+		result.CharactersTyped++
+
+		delay := cfg.TypingSpeed
+		if cfg.JitterMax > 0 {
+			delay += rand.N(cfg.JitterMax) //nolint:gosec // Typing jitter does not need a CSPRNG.
+		}
+		if strings.ContainsRune(".,;:|&", r) {
+			delay += cfg.PunctuationPause
+		}
+		if err := sleepContext(ctx, delay); err != nil {
+			result.Error = err
+			result.Duration = time.Since(start)
+			return result
+		}
+	}
+
+	if execute {
+		if _, err := io.WriteString(w, "\r"); err != nil {
+			result.Error = fmt.Errorf("send enter: %w", err)
+			result.Duration = time.Since(start)
+			return result
+		}
+		result.Executed = true
+	}
+
+	result.Duration = time.Since(start)
+	p.logger.Info("[PTY] Command typed",
+		"command", command,
+		"characters", result.CharactersTyped,
+		"executed", result.Executed,
+		"duration_ms", result.Duration.Milliseconds(),
+	)
+	return result
+}
+
+// PlaybackFrame is a chunk of recorded output and the pause before it.
+type PlaybackFrame struct {
+	Delay time.Duration
+	Data  []byte
+}
+
+// Play writes recorded frames to w with their original timing scaled by
+// speed (2 plays twice as fast). Pauses longer than MaxPlaybackPause are
+// shortened to it, so a recording does not stall while the instructor was
+// talking. Playback stops early if ctx is cancelled.
+func (p *PTYController) Play(ctx context.Context, w io.Writer, frames []PlaybackFrame, speed float64) error {
+	cfg := p.GetConfig()
+	if speed <= 0 {
+		speed = 1
+	}
+	for i, f := range frames {
+		delay := time.Duration(float64(f.Delay) / speed)
+		if cfg.MaxPlaybackPause > 0 && delay > cfg.MaxPlaybackPause {
+			delay = cfg.MaxPlaybackPause
+		}
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+		if _, err := w.Write(f.Data); err != nil {
+			return fmt.Errorf("play frame %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// sleepContext waits for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
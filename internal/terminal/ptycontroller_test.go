@@ -1,6 +1,9 @@
 package terminal
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"testing"
 	"time"
 )
@@ -23,7 +26,7 @@ func TestDefaultPTYConfig(t *testing.T) {
 
 func TestNewPTYController(t *testing.T) {
 	config := DefaultPTYConfig()
-	controller := NewPTYController(nil, config, nil)
+	controller := NewPTYController(config, nil)
 
 	if controller == nil {
 		t.Fatal("expected controller to be created")
@@ -36,7 +39,7 @@ func TestNewPTYController(t *testing.T) {
 
 func TestPTYController_SetTypingSpeed(t *testing.T) {
 	config := DefaultPTYConfig()
-	controller := NewPTYController(nil, config, nil)
+	controller := NewPTYController(config, nil)
 
 	newSpeed := 100 * time.Millisecond
 	controller.SetTypingSpeed(newSpeed)
@@ -53,7 +56,7 @@ func TestPTYController_GetConfig(t *testing.T) {
 		ThinkPause:       200 * time.Millisecond,
 		PunctuationPause: 50 * time.Millisecond,
 	}
-	controller := NewPTYController(nil, config, nil)
+	controller := NewPTYController(config, nil)
 
 	retrievedConfig := controller.GetConfig()
 
@@ -65,3 +68,71 @@ func TestPTYController_GetConfig(t *testing.T) {
 		t.Errorf("expected JitterMax %v, got %v", config.JitterMax, retrievedConfig.JitterMax)
 	}
 }
+
+func TestPTYController_TypeCommand(t *testing.T) {
+	controller := NewPTYController(PTYConfig{}, nil)
+	var buf bytes.Buffer
+
+	result := controller.TypeCommand(context.Background(), &buf, "ls -la", true)
+
+	if result.Error != nil {
+		t.Fatalf("unexpected error: %v", result.Error)
+	}
+	if buf.String() != "ls -la\r" {
+		t.Errorf("expected typed command with enter, got %q", buf.String())
+	}
+	if result.CharactersTyped != 6 || !result.Executed {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
+
+func TestPTYController_TypeCommandCancelled(t *testing.T) {
+	controller := NewPTYController(PTYConfig{ThinkPause: time.Second}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var buf bytes.Buffer
+
+	result := controller.TypeCommand(ctx, &buf, "rm -rf tmp", true)
+
+	if result.Error == nil {
+		t.Fatal("expected cancellation error")
+	}
+	if buf.Len() != 0 || result.Executed {
+		t.Errorf("expected nothing typed, got %q", buf.String())
+	}
+}
+
+func TestPTYController_Play(t *testing.T) {
+	controller := NewPTYController(PTYConfig{MaxPlaybackPause: 10 * time.Millisecond}, nil)
+	frames := []PlaybackFrame{
+		{Data: []byte("$ ls\r\n")},
+		{Delay: time.Hour, Data: []byte("file.txt\r\n")},
+	}
+
+	var buf bytes.Buffer
+	start := time.Now()
+	if err := controller.Play(context.Background(), &buf, frames, 1); err != nil {
+		t.Fatalf("Play() error = %v", err)
+	}
+	if got := buf.String(); got != "$ ls\r\nfile.txt\r\n" {
+		t.Errorf("output = %q", got)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("long pause was not capped, took %v", elapsed)
+	}
+}
+
+func TestPTYController_PlayCancelled(t *testing.T) {
+	controller := NewPTYController(PTYConfig{}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var buf bytes.Buffer
+	err := controller.Play(ctx, &buf, []PlaybackFrame{{Delay: time.Second, Data: []byte("x")}}, 2)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Play() error = %v, want context.Canceled", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("wrote %q after cancellation", buf.String())
+	}
+}
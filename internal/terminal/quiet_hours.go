@@ -0,0 +1,234 @@
+package terminal
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// quietWindow is a daily span of local time, as offsets from midnight. An
+// end before the start wraps past midnight.
+type quietWindow struct {
+	start time.Duration
+	end   time.Duration
+}
+
+// contains reports whether t falls in the window.
+func (w quietWindow) contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if w.end < w.start {
+		return offset >= w.start || offset < w.end
+	}
+	return offset >= w.start && offset < w.end
+}
+
+// String formats the window as HH:MM-HH:MM.
+func (w quietWindow) String() string {
+	clock := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+	}
+	return clock(w.start) + "-" + clock(w.end)
+}
+
+// parseQuietWindows parses a list of HH:MM-HH:MM windows such as
+// "22:00-07:00, 12:00-13:00" separated by commas or whitespace. It returns
+// the entries it could not parse alongside the windows it could.
+func parseQuietWindows(spec string) ([]quietWindow, []string) {
+	var windows []quietWindow
+	var invalid []string
+	fields := strings.FieldsFunc(spec, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	for _, field := range fields {
+		from, to, ok := strings.Cut(field, "-")
+		start, startErr := time.Parse("15:04", from)
+		end, endErr := time.Parse("15:04", to)
+		if !ok || startErr != nil || endErr != nil || from == to {
+			invalid = append(invalid, field)
+			continue
+		}
+		windows = append(windows, quietWindow{
+			start: time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute,
+			end:   time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute,
+		})
+	}
+	return windows, invalid
+}
+
+// quietHours holds the configured quiet hours: default windows, and a
+// directory of <classroom>.quiet files replacing them for classroom members.
+type quietHours struct {
+	windows []quietWindow
+	dir     string
+}
+
+// newQuietHours returns nil when no quiet hours are configured.
+func newQuietHours(spec, dir string) *quietHours {
+	if spec == "" && dir == "" {
+		return nil
+	}
+	windows, invalid := parseQuietWindows(spec)
+	if len(invalid) > 0 {
+		slog.Warn("Ignoring invalid quiet hours", "windows", invalid)
+	}
+	return &quietHours{windows: windows, dir: dir}
+}
+
+// policyFor returns the quiet windows of a member of classroom. An empty
+// classroom file has no quiet hours.
+func (q *quietHours) policyFor(classroom string) []quietWindow {
+	if q.dir == "" || !classroomNamePattern.MatchString(classroom) {
+		return q.windows
+	}
+	data, err := os.ReadFile(filepath.Join(q.dir, classroom+".quiet"))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("Failed to read classroom quiet hours", "error", err, "classroom", classroom)
+		}
+		return q.windows
+	}
+	windows, invalid := parseQuietWindows(string(data))
+	if len(invalid) > 0 {
+		slog.Warn("Ignoring invalid classroom quiet hours", "windows", invalid, "classroom", classroom)
+	}
+	return windows
+}
+
+// Reasons proactive messages are held back, reported in QuietStatus.
+const (
+	QuietReasonQuietHours = "quiet_hours"
+	QuietReasonFocus      = "focus"
+)
+
+// QuietStatus describes whether a user's proactive messages are held back.
+// Chat is never affected.
+type QuietStatus struct {
+	Active     bool      `json:"active"`
+	Reason     string    `json:"reason,omitempty"` // QuietReasonQuietHours or QuietReasonFocus
+	Windows    []string  `json:"windows"`          // Daily quiet hours, HH:MM-HH:MM in server local time
+	FocusUntil time.Time `json:"focus_until,omitzero"`
+}
+
+// SetQuietHours holds back proactive messages during daily windows given as
+// HH:MM-HH:MM in server local time, e.g. "22:00-07:00,12:00-13:00". Files
+// named <classroom>.quiet in dir replace them for classroom members. Call it
+// before sessions are registered.
+func (tm *Monitor) SetQuietHours(spec, dir string) {
+	tm.quiet = newQuietHours(spec, dir)
+}
+
+// hasClassroomQuietHours reports whether quiet hours depend on the
+// classroom. It is safe to call on a nil monitor.
+func (tm *Monitor) hasClassroomQuietHours() bool {
+	return tm != nil && tm.quiet != nil && tm.quiet.dir != ""
+}
+
+// SetSessionClassroom applies the quiet hours of classroom to a registered
+// session.
+func (tm *Monitor) SetSessionClassroom(userID, sessionID, classroom string) {
+	if tm.quiet == nil {
+		return
+	}
+	session := tm.GetSessionState(userID, sessionID)
+	if session == nil {
+		return
+	}
+	windows := tm.quiet.policyFor(classroom)
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	session.quietWindows = windows
+}
+
+// SetFocus holds back a user's proactive messages until until, across all of
+// their tabs. A zero or past time ends the focus window.
+func (tm *Monitor) SetFocus(userID string, until time.Time) {
+	tm.focusMu.Lock()
+	defer tm.focusMu.Unlock()
+	if !until.After(time.Now()) {
+		delete(tm.focus, userID)
+		return
+	}
+	tm.focus[userID] = until
+}
+
+// focusUntil returns the end of a user's focus window, or zero if there is
+// none at now.
+func (tm *Monitor) focusUntil(userID string, now time.Time) time.Time {
+	tm.focusMu.Lock()
+	defer tm.focusMu.Unlock()
+	until, ok := tm.focus[userID]
+	if !ok {
+		return time.Time{}
+	}
+	if !until.After(now) {
+		delete(tm.focus, userID)
+		return time.Time{}
+	}
+	return until
+}
+
+// QuietStatus reports whether a user's proactive messages are held back at
+// now. Quiet hours come from any of the user's open tabs, which share a
+// classroom, or from the defaults.
+func (tm *Monitor) QuietStatus(userID string, now time.Time) QuietStatus {
+	windows, ok := tm.userQuietWindows(userID)
+	if !ok && tm.quiet != nil {
+		windows = tm.quiet.windows
+	}
+
+	status := QuietStatus{Windows: make([]string, 0, len(windows)), FocusUntil: tm.focusUntil(userID, now)}
+	for _, w := range windows {
+		status.Windows = append(status.Windows, w.String())
+	}
+	switch {
+	case !status.FocusUntil.IsZero():
+		status.Active, status.Reason = true, QuietReasonFocus
+	case inQuietWindow(windows, now):
+		status.Active, status.Reason = true, QuietReasonQuietHours
+	}
+	return status
+}
+
+// userQuietWindows returns the quiet hours of one of the user's open tabs,
+// reporting false if the user has none open.
+func (tm *Monitor) userQuietWindows(userID string) ([]quietWindow, bool) {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	for key, session := range tm.sessions {
+		if key.UserID() == userID {
+			return session.getQuietWindows(), true
+		}
+	}
+	return nil, false
+}
+
+// getQuietWindows returns the session's quiet hours.
+func (s *SessionState) getQuietWindows() []quietWindow {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.quietWindows
+}
+
+// isQuiet reports whether proactive messages to session are held back at
+// now.
+func (tm *Monitor) isQuiet(session *SessionState, now time.Time) bool {
+	if !tm.focusUntil(session.UserID, now).IsZero() {
+		return true
+	}
+	return inQuietWindow(session.getQuietWindows(), now)
+}
+
+// inQuietWindow reports whether t falls in any of windows.
+func inQuietWindow(windows []quietWindow, t time.Time) bool {
+	for _, w := range windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package terminal
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseQuietWindows(t *testing.T) {
+	windows, invalid := parseQuietWindows("22:00-07:00, 12:30-13:00 9-10 08:00-08:00")
+	if len(windows) != 2 || windows[0].String() != "22:00-07:00" || windows[1].String() != "12:30-13:00" {
+		t.Fatalf("unexpected windows: %v", windows)
+	}
+	if !slices.Equal(invalid, []string{"9-10", "08:00-08:00"}) {
+		t.Fatalf("unexpected invalid entries: %v", invalid)
+	}
+
+	at := func(hour, minute int) time.Time { return time.Date(2026, 1, 10, hour, minute, 0, 0, time.Local) }
+	for _, tc := range []struct {
+		t    time.Time
+		want bool
+	}{
+		{at(23, 0), true},
+		{at(3, 0), true},
+		{at(7, 0), false},
+		{at(12, 45), true},
+		{at(13, 0), false},
+		{at(18, 0), false},
+	} {
+		if got := inQuietWindow(windows, tc.t); got != tc.want {
+			t.Errorf("inQuietWindow(%s) = %v, want %v", tc.t.Format("15:04"), got, tc.want)
+		}
+	}
+}
+
+func TestQuietHoursPerClassroomAndFocus(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "night-school.quiet"), []byte("00:00-23:59\n"), 0o600); err != nil {
+		t.Fatalf("write classroom quiet hours: %v", err)
+	}
+	tm := NewMonitor(nil, nil, nil)
+	defer tm.Stop()
+	tm.SetQuietHours("", dir)
+
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.Local)
+	tm.RegisterSession("u1", "s1", "c1", "/home/u1")
+	if status := tm.QuietStatus("u1", now); status.Active || len(status.Windows) != 0 {
+		t.Fatalf("expected no quiet hours by default, got %+v", status)
+	}
+
+	tm.SetSessionClassroom("u1", "s1", "night-school")
+	status := tm.QuietStatus("u1", now)
+	if !status.Active || status.Reason != QuietReasonQuietHours || !slices.Equal(status.Windows, []string{"00:00-23:59"}) {
+		t.Fatalf("expected classroom quiet hours, got %+v", status)
+	}
+	if !tm.isQuiet(tm.GetSessionState("u1", "s1"), now) {
+		t.Fatal("expected session to be quiet")
+	}
+
+	tm.RegisterSession("u2", "s1", "c2", "/home/u2")
+	if tm.isQuiet(tm.GetSessionState("u2", "s1"), time.Now()) {
+		t.Fatal("expected other learner not to be quiet")
+	}
+	tm.SetFocus("u2", time.Now().Add(time.Hour))
+	if status := tm.QuietStatus("u2", time.Now()); !status.Active || status.Reason != QuietReasonFocus || status.FocusUntil.IsZero() {
+		t.Fatalf("expected focus window, got %+v", status)
+	}
+	if !tm.isQuiet(tm.GetSessionState("u2", "s1"), time.Now()) {
+		t.Fatal("expected focus to quiet the session")
+	}
+	tm.SetFocus("u2", time.Time{})
+	if tm.QuietStatus("u2", time.Now()).Active {
+		t.Fatal("expected focus window to end")
+	}
+}
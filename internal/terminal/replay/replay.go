@@ -0,0 +1,171 @@
+// Package replay feeds recorded terminal transcripts through the monitor and
+// checks the commands it detects.
+//
+// A transcript is a JSON file listing the bytes the browser sent ("in") and
+// the bytes the container printed ("out"), in order, plus the commands the
+// monitor is expected to report. Regressions in OSC 133 parsing, editor
+// detection, or fallback prompt handling can be captured by saving the
+// offending stream as a transcript under testdata/; every transcript there is
+// replayed by the package tests.
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+)
+
+// Event directions.
+const (
+	DirectionInput  = "in"  // Keystrokes sent from the browser to the container
+	DirectionOutput = "out" // Bytes printed by the container
+)
+
+// Replay identifiers used for the synthetic monitor session.
+const (
+	replayUserID    = "replay"
+	replaySessionID = "transcript"
+)
+
+var (
+	errNoEvents         = errors.New("transcript has no events")
+	errInvalidDirection = errors.New("event direction must be \"in\" or \"out\"")
+)
+
+// Event is one chunk of terminal traffic.
+type Event struct {
+	Direction string `json:"dir"`
+	Data      string `json:"data"`
+	DelayMS   int    `json:"delay_ms,omitempty"` // Pause before this event (for fallback timing)
+}
+
+// Expectation describes a command the monitor should report. Empty fields
+// are not checked.
+type Expectation struct {
+	Command  string `json:"command"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+	PWD      string `json:"pwd,omitempty"`
+}
+
+// Transcript is a recorded terminal session with expected results.
+type Transcript struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description,omitempty"`
+	Events      []Event       `json:"events"`
+	Expect      []Expectation `json:"expect"`
+}
+
+// Parse decodes a transcript from JSON.
+func Parse(r io.Reader) (*Transcript, error) {
+	var t Transcript
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&t); err != nil {
+		return nil, fmt.Errorf("decode transcript: %w", err)
+	}
+	if len(t.Events) == 0 {
+		return nil, errNoEvents
+	}
+	for i, ev := range t.Events {
+		if ev.Direction != DirectionInput && ev.Direction != DirectionOutput {
+			return nil, fmt.Errorf("event %d: %w", i, errInvalidDirection)
+		}
+	}
+	return &t, nil
+}
+
+// Load reads a transcript file.
+func Load(path string) (*Transcript, error) {
+	f, err := os.Open(path) //nolint:gosec // Path comes from the caller (tests or CLI).
+	if err != nil {
+		return nil, fmt.Errorf("open transcript: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	t, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return t, nil
+}
+
+// Result holds the commands the monitor reported during a replay.
+type Result struct {
+	Entries []terminal.CommandEntry
+}
+
+// Run replays a transcript through a fresh monitor without an AI agent.
+// Input is handled like the WebSocket handler does: keystrokes typed while an
+// editor is open are not passed to the monitor.
+func Run(ctx context.Context, t *Transcript) Result {
+	monitor := terminal.NewMonitor(nil, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer monitor.Stop()
+
+	var mu sync.Mutex
+	var result Result
+	monitor.AddCommandHook(terminal.CommandListener(func(_ identity.SessionKey, entry terminal.CommandEntry) {
+		mu.Lock()
+		defer mu.Unlock()
+		result.Entries = append(result.Entries, entry)
+	}))
+
+	monitor.RegisterSession(replayUserID, replaySessionID, "replay-container", "")
+	defer monitor.UnregisterSession(replayUserID, replaySessionID)
+
+	for _, ev := range t.Events {
+		if ev.DelayMS > 0 {
+			time.Sleep(time.Duration(ev.DelayMS) * time.Millisecond)
+		}
+		switch ev.Direction {
+		case DirectionInput:
+			if !monitor.IsInEditorMode(replayUserID, replaySessionID) {
+				monitor.ProcessInput(ctx, replayUserID, replaySessionID, []byte(ev.Data))
+			}
+		case DirectionOutput:
+			monitor.ProcessOutput(ctx, replayUserID, replaySessionID, []byte(ev.Data))
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return result
+}
+
+// Check compares the replay result against the transcript's expectations and
+// returns a description of each mismatch.
+func (r Result) Check(expect []Expectation) []string {
+	var problems []string
+	if len(r.Entries) != len(expect) {
+		problems = append(problems, fmt.Sprintf("expected %d commands, got %d: %q", len(expect), len(r.Entries), r.commands()))
+	}
+	for i := 0; i < len(expect) && i < len(r.Entries); i++ {
+		want, got := expect[i], r.Entries[i]
+		if want.Command != got.Command {
+			problems = append(problems, fmt.Sprintf("command %d: expected %q, got %q", i, want.Command, got.Command))
+		}
+		if want.ExitCode != nil && *want.ExitCode != got.ExitCode {
+			problems = append(problems, fmt.Sprintf("command %d (%q): expected exit %d, got %d", i, got.Command, *want.ExitCode, got.ExitCode))
+		}
+		if want.PWD != "" && want.PWD != got.PWD {
+			problems = append(problems, fmt.Sprintf("command %d (%q): expected pwd %q, got %q", i, got.Command, want.PWD, got.PWD))
+		}
+	}
+	return problems
+}
+
+func (r Result) commands() []string {
+	out := make([]string, len(r.Entries))
+	for i, e := range r.Entries {
+		out[i] = e.Command
+	}
+	return out
+}
@@ -0,0 +1,43 @@
+package replay
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTranscripts(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if err != nil {
+		t.Fatalf("glob transcripts: %v", err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no transcripts found in testdata")
+	}
+
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			transcript, err := Load(path)
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			result := Run(context.Background(), transcript)
+			for _, problem := range result.Check(transcript.Expect) {
+				t.Error(problem)
+			}
+		})
+	}
+}
+
+func TestParseRejectsInvalidTranscripts(t *testing.T) {
+	for name, body := range map[string]string{
+		"no events":     `{"name":"x","events":[]}`,
+		"bad direction": `{"name":"x","events":[{"dir":"sideways","data":"ls"}]}`,
+		"unknown field": `{"name":"x","events":[{"dir":"in","data":"ls"}],"bogus":1}`,
+	} {
+		if _, err := Parse(strings.NewReader(body)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
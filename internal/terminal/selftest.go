@@ -0,0 +1,302 @@
+package terminal
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/agent"
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/identity"
+)
+
+// Statuses of a self-test step.
+const (
+	SelfTestOK      = "ok"
+	SelfTestFailed  = "failed"
+	SelfTestSkipped = "skipped"
+)
+
+const (
+	// defaultSelfTestStepTimeout bounds each step of a self-test.
+	defaultSelfTestStepTimeout = 30 * time.Second
+
+	// selfTestSessionID is the tab session the self-test's shell runs in.
+	selfTestSessionID = "selftest"
+
+	// selfTestPollInterval is how often the self-test checks for the
+	// shell's first prompt.
+	selfTestPollInterval = 50 * time.Millisecond
+)
+
+// errSelfTestSkipped marks a step that did not run.
+var errSelfTestSkipped = errors.New("skipped")
+
+// SelfTestStep is the outcome of one step of a self-test.
+type SelfTestStep struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	DurationMS int64  `json:"duration_ms"`
+	Detail     string `json:"detail,omitempty"`
+}
+
+// SelfTestReport is the outcome of a self-test run.
+type SelfTestReport struct {
+	Passed      bool           `json:"passed"`
+	UserID      string         `json:"user_id"`
+	ContainerID string         `json:"container_id,omitempty"`
+	Steps       []SelfTestStep `json:"steps"`
+}
+
+// SelfTest verifies a deployment end to end: it provisions a throwaway
+// container, opens a shell in it, runs a command through a private monitor
+// to check the shell's OSC 133 markers yield a command entry, asks the agent
+// about the command when AI is enabled, and removes everything again.
+type SelfTest struct {
+	mgr          container.Manager
+	agentService *agent.Service
+	logger       *slog.Logger
+	stepTimeout  time.Duration
+}
+
+// NewSelfTest creates a self-test against mgr. A nil agentService skips the
+// agent step.
+func NewSelfTest(mgr container.Manager, agentService *agent.Service, logger *slog.Logger) *SelfTest {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SelfTest{
+		mgr:          mgr,
+		agentService: agentService,
+		logger:       logger,
+		stepTimeout:  defaultSelfTestStepTimeout,
+	}
+}
+
+// selfTestRun is the state of one self-test run.
+type selfTestRun struct {
+	*SelfTest
+
+	report  *SelfTestReport
+	conn    io.ReadWriteCloser
+	monitor *Monitor
+	entries chan CommandEntry
+	entry   CommandEntry
+}
+
+// Run performs the self-test. Steps after a failed one are skipped, except
+// cleanup, which always runs.
+func (s *SelfTest) Run(ctx context.Context) *SelfTestReport {
+	ctx = container.WithLifecycleReason(ctx, container.ReasonSelfTest)
+	run := &selfTestRun{
+		SelfTest: s,
+		report:   &SelfTestReport{UserID: "selftest-" + randomHex(6), Passed: true},
+	}
+
+	run.step(ctx, "provision", run.provision)
+	run.step(ctx, "exec", run.exec)
+	run.step(ctx, "command", run.command)
+	run.step(ctx, "agent", run.agent)
+
+	// Cleanup runs even if the caller's context ended.
+	run.do(context.WithoutCancel(ctx), "cleanup", run.cleanup)
+
+	s.logger.Info("[SELFTEST] Completed",
+		"passed", run.report.Passed,
+		"user_id", run.report.UserID,
+		"container_id", run.report.ContainerID,
+	)
+	return run.report
+}
+
+// step runs fn unless an earlier step failed.
+func (r *selfTestRun) step(ctx context.Context, name string, fn func(context.Context) (string, error)) {
+	if !r.report.Passed {
+		r.report.Steps = append(r.report.Steps, SelfTestStep{Name: name, Status: SelfTestSkipped, Detail: "earlier step failed"})
+		return
+	}
+	r.do(ctx, name, fn)
+}
+
+// do runs fn under the step timeout and records its outcome.
+func (r *selfTestRun) do(ctx context.Context, name string, fn func(context.Context) (string, error)) {
+	result := SelfTestStep{Name: name, Status: SelfTestSkipped}
+	ctx, cancel := context.WithTimeout(ctx, r.stepTimeout)
+	defer cancel()
+	start := time.Now()
+	detail, err := fn(ctx)
+	result.DurationMS = time.Since(start).Milliseconds()
+	result.Detail = detail
+	switch {
+	case errors.Is(err, errSelfTestSkipped):
+	case err != nil:
+		result.Status = SelfTestFailed
+		result.Detail = err.Error()
+		r.report.Passed = false
+		r.logger.Warn("[SELFTEST] Step failed", "step", name, "user_id", r.report.UserID, "error", err)
+	default:
+		result.Status = SelfTestOK
+	}
+	r.report.Steps = append(r.report.Steps, result)
+}
+
+// provision creates the throwaway container.
+func (r *selfTestRun) provision(ctx context.Context) (string, error) {
+	containerID, err := r.mgr.EnsureContainer(ctx, r.report.UserID, "", "", time.Time{}, nil)
+	if err != nil {
+		return "", fmt.Errorf("provision container: %w", err)
+	}
+	r.report.ContainerID = containerID
+	return containerID, nil
+}
+
+// exec opens a shell in the container and feeds its output to a private
+// monitor, so the self-test does not reach learners' sidebars or hooks.
+func (r *selfTestRun) exec(ctx context.Context) (string, error) {
+	execID, conn, err := r.mgr.CreateExecSession(ctx, r.report.ContainerID)
+	if err != nil {
+		return "", fmt.Errorf("create exec session: %w", err)
+	}
+	r.conn = conn
+
+	entries := make(chan CommandEntry, 4)
+	r.monitor = NewMonitor(nil, make(chan *agent.Response, 1), r.logger)
+	r.monitor.AddCommandHook(CommandListener(func(_ identity.SessionKey, entry CommandEntry) {
+		select {
+		case entries <- entry:
+		default:
+		}
+	}))
+	r.monitor.RegisterSession(r.report.UserID, selfTestSessionID, r.report.ContainerID, "")
+	r.entries = entries
+
+	go r.pumpOutput(context.WithoutCancel(ctx))
+	return execID, nil
+}
+
+// pumpOutput passes shell output to the monitor until the exec closes.
+func (r *selfTestRun) pumpOutput(ctx context.Context) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.conn.Read(buf)
+		if n > 0 {
+			r.monitor.ProcessOutput(ctx, r.report.UserID, selfTestSessionID, buf[:n])
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// command waits for the shell's first prompt, runs an echo of a random
+// nonce and waits for the monitor to record it.
+func (r *selfTestRun) command(ctx context.Context) (string, error) {
+	key := identity.NewSessionKey(r.report.UserID, selfTestSessionID)
+	ticker := time.NewTicker(selfTestPollInterval)
+	defer ticker.Stop()
+	for !r.monitor.parser.HasOSC133Support(key) {
+		select {
+		case <-ctx.Done():
+			return "", errors.New("shell printed no OSC 133 prompt marker")
+		case <-ticker.C:
+		}
+	}
+
+	command := "echo shsh-selftest-" + randomHex(4)
+	r.monitor.ProcessInput(ctx, r.report.UserID, selfTestSessionID, []byte(command+"\r"))
+	if _, err := r.conn.Write([]byte(command + "\r")); err != nil {
+		return "", fmt.Errorf("write command: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("no command entry recorded for %q", command)
+		case entry := <-r.entries:
+			if entry.Command != command {
+				continue
+			}
+			if entry.ExitCode != 0 {
+				return "", fmt.Errorf("%q exited with code %d", command, entry.ExitCode)
+			}
+			r.entry = entry
+			return command, nil
+		}
+	}
+}
+
+// agent sends the recorded command to the agent and expects a response.
+func (r *selfTestRun) agent(ctx context.Context) (string, error) {
+	if r.agentService == nil {
+		return "AI disabled", errSelfTestSkipped
+	}
+	input := agent.TerminalInput{
+		Command:   r.entry.Command,
+		PWD:       r.entry.PWD,
+		ExitCode:  r.entry.ExitCode,
+		Timestamp: r.entry.Timestamp.Unix(),
+		UserID:    r.report.UserID,
+		SessionID: selfTestSessionID,
+		Duration:  r.entry.Duration,
+		HasOSC133: true,
+	}
+	for response, err := range r.agentService.ProcessTerminalInput(ctx, input) {
+		if err != nil {
+			return "", fmt.Errorf("agent stream: %w", err)
+		}
+		if response == nil {
+			continue
+		}
+		if response.Type == "error" {
+			return "", fmt.Errorf("agent error: %s", response.Content)
+		}
+		return "response type " + response.Type, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return "", fmt.Errorf("agent stream: %w", err)
+	}
+	return "", errors.New("agent returned no response")
+}
+
+// cleanup closes the shell and removes the container, its volume and any
+// agent state. It reports the first failure after attempting every part.
+func (r *selfTestRun) cleanup(ctx context.Context) (string, error) {
+	var errs []error
+	if r.conn != nil {
+		if err := r.conn.Close(); err != nil {
+			r.logger.Debug("[SELFTEST] Closing exec session failed", "error", err)
+		}
+	}
+	if r.monitor != nil {
+		r.monitor.UnregisterSession(r.report.UserID, selfTestSessionID)
+		r.monitor.Stop()
+	}
+	if r.agentService != nil && r.entry.Command != "" {
+		if err := r.agentService.ResetSession(ctx, r.report.UserID, selfTestSessionID); err != nil {
+			errs = append(errs, fmt.Errorf("reset agent session: %w", err))
+		}
+	}
+	if r.report.ContainerID != "" {
+		if err := r.mgr.StopContainer(ctx, r.report.ContainerID); err != nil {
+			errs = append(errs, fmt.Errorf("stop container: %w", err))
+		}
+	}
+	if remover, ok := r.mgr.(container.VolumeRemover); ok {
+		if err := remover.RemoveVolume(ctx, r.report.UserID); err != nil {
+			errs = append(errs, fmt.Errorf("remove volume: %w", err))
+		}
+	}
+	return "", errors.Join(errs...)
+}
+
+// randomHex returns n random bytes as hex.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,192 @@
+package terminal
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"iter"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/agent"
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/docker/docker/client"
+)
+
+// selfTestManager provisions one fake container whose shell echoes its
+// commands, with OSC 133 markers unless plain is set.
+type selfTestManager struct {
+	plain bool
+
+	mu      sync.Mutex
+	stopped []string
+	removed []string
+}
+
+func (m *selfTestManager) EnsureContainer(context.Context, string, string, string, time.Time, map[string]string) (string, error) {
+	return "c-selftest", nil
+}
+
+func (m *selfTestManager) StopContainer(_ context.Context, containerID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stopped = append(m.stopped, containerID)
+	return nil
+}
+
+func (m *selfTestManager) RemoveVolume(_ context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.removed = append(m.removed, userID)
+	return nil
+}
+
+func (m *selfTestManager) CreateExecSession(context.Context, string) (string, io.ReadWriteCloser, error) {
+	conn, shell := net.Pipe()
+	go m.runShell(shell)
+	return "exec-selftest", conn, nil
+}
+
+// runShell plays a shell on conn until it is closed.
+func (m *selfTestManager) runShell(conn net.Conn) {
+	defer conn.Close()
+	prompt := "\x1b]133;A\x07$ "
+	if m.plain {
+		prompt = "$ "
+	}
+	if _, err := io.WriteString(conn, prompt); err != nil {
+		return
+	}
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\r')
+		if err != nil {
+			return
+		}
+		command := strings.TrimSuffix(line, "\r")
+		output := strings.TrimPrefix(command, "echo ") + "\r\n"
+		if !m.plain {
+			output = "\x1b]133;B\x07\r\n" + output + "\x1b]133;C\x07\x1b]133;D;0\x07"
+		}
+		if _, err := io.WriteString(conn, output+prompt); err != nil {
+			return
+		}
+	}
+}
+
+func (m *selfTestManager) IsRunning(context.Context, string) (bool, error)             { return true, nil }
+func (m *selfTestManager) ProbeContainer(context.Context, string) error                { return nil }
+func (m *selfTestManager) ResizeExecSession(context.Context, string, uint, uint) error { return nil }
+func (m *selfTestManager) Client() *client.Client                                      { return nil }
+func (m *selfTestManager) EnsureNetwork(context.Context) (string, error)               { return "", nil }
+func (m *selfTestManager) Runtime() container.RuntimeStatus                            { return container.RuntimeStatus{} }
+func (m *selfTestManager) ReapOrphans(context.Context, container.OwnerLookup, time.Duration) (container.ReapResult, error) {
+	return container.ReapResult{}, nil
+}
+
+// respondingProcessor answers every command with one hint.
+type respondingProcessor struct {
+	hangingProcessor
+
+	mu     sync.Mutex
+	inputs []agent.TerminalInput
+	resets int
+}
+
+func (p *respondingProcessor) ProcessTerminalInput(_ context.Context, input agent.TerminalInput) iter.Seq2[*agent.Response, error] {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inputs = append(p.inputs, input)
+	return func(yield func(*agent.Response, error) bool) {
+		yield(&agent.Response{Type: "hint", Content: "ok"}, nil)
+	}
+}
+
+func (p *respondingProcessor) ResetSession(context.Context, string, string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.resets++
+	return nil
+}
+
+func stepStatuses(report *SelfTestReport) map[string]string {
+	statuses := make(map[string]string)
+	for _, step := range report.Steps {
+		statuses[step.Name] = step.Status
+	}
+	return statuses
+}
+
+func TestSelfTestPasses(t *testing.T) {
+	mgr := &selfTestManager{}
+	processor := &respondingProcessor{}
+	service, _ := agent.NewServiceWithProcessor(processor)
+	st := NewSelfTest(mgr, service, nil)
+	st.stepTimeout = 2 * time.Second
+
+	report := st.Run(t.Context())
+	if !report.Passed {
+		t.Fatalf("self-test failed: %+v", report.Steps)
+	}
+	want := map[string]string{"provision": SelfTestOK, "exec": SelfTestOK, "command": SelfTestOK, "agent": SelfTestOK, "cleanup": SelfTestOK}
+	for name, status := range want {
+		if got := stepStatuses(report)[name]; got != status {
+			t.Errorf("step %s: got %q, want %q", name, got, status)
+		}
+	}
+
+	processor.mu.Lock()
+	defer processor.mu.Unlock()
+	if len(processor.inputs) != 1 || !strings.HasPrefix(processor.inputs[0].Command, "echo shsh-selftest-") {
+		t.Fatalf("agent inputs = %+v", processor.inputs)
+	}
+	if processor.resets != 1 {
+		t.Errorf("agent session reset %d times, want 1", processor.resets)
+	}
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	if len(mgr.stopped) != 1 || mgr.stopped[0] != "c-selftest" {
+		t.Errorf("stopped = %v", mgr.stopped)
+	}
+	if len(mgr.removed) != 1 || mgr.removed[0] != report.UserID {
+		t.Errorf("removed volumes = %v, want [%s]", mgr.removed, report.UserID)
+	}
+}
+
+func TestSelfTestFailsWithoutOSC133AndCleansUp(t *testing.T) {
+	mgr := &selfTestManager{plain: true}
+	st := NewSelfTest(mgr, nil, nil)
+	st.stepTimeout = 200 * time.Millisecond
+
+	report := st.Run(t.Context())
+	if report.Passed {
+		t.Fatal("self-test passed without OSC 133 markers")
+	}
+	statuses := stepStatuses(report)
+	if statuses["command"] != SelfTestFailed || statuses["agent"] != SelfTestSkipped || statuses["cleanup"] != SelfTestOK {
+		t.Fatalf("steps = %+v", report.Steps)
+	}
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	if len(mgr.stopped) != 1 {
+		t.Errorf("container stopped %d times, want 1", len(mgr.stopped))
+	}
+}
+
+func TestSelfTestSkipsAgentWhenDisabled(t *testing.T) {
+	st := NewSelfTest(&selfTestManager{}, nil, nil)
+	st.stepTimeout = 2 * time.Second
+
+	report := st.Run(t.Context())
+	if !report.Passed {
+		t.Fatalf("self-test failed: %+v", report.Steps)
+	}
+	if got := stepStatuses(report)["agent"]; got != SelfTestSkipped {
+		t.Errorf("agent step = %q, want skipped", got)
+	}
+}
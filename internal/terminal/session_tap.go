@@ -0,0 +1,39 @@
+package terminal
+
+import "io"
+
+// SessionTap observes the traffic of terminal sessions, e.g. to record a
+// demo. Both methods are called on the session's I/O path and must not block
+// or retain p.
+type SessionTap interface {
+	TapInput(userID, sessionID string, p []byte)
+	TapOutput(userID, sessionID string, p []byte)
+}
+
+// SetSessionTap lets tap observe the input and output of every session.
+func (h *WebSocketHandler) SetSessionTap(tap SessionTap) {
+	h.tap = tap
+}
+
+// tapInput passes input that reached the container to the tap, if any.
+func (h *WebSocketHandler) tapInput(userID, sessionID string, p []byte) {
+	if h.tap != nil {
+		h.tap.TapInput(userID, sessionID, p)
+	}
+}
+
+// tapReader passes container output to a SessionTap as it is read.
+type tapReader struct {
+	r         io.Reader
+	tap       SessionTap
+	userID    string
+	sessionID string
+}
+
+func (t *tapReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 {
+		t.tap.TapOutput(t.userID, t.sessionID, p[:n])
+	}
+	return n, err
+}
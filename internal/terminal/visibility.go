@@ -0,0 +1,244 @@
+package terminal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/agent"
+)
+
+// awaySummary accumulates activity while a session's tab is hidden.
+type awaySummary struct {
+	Commands    int
+	Failures    int
+	LastFailure *CommandEntry
+	Dropped     int // Proactive messages suppressed while hidden
+}
+
+// IsSuspended reports whether AI analysis is paused for the session.
+func (s *SessionState) IsSuspended() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Suspended
+}
+
+// recordIfSuspended tallies a completed command for the recap when the session
+// is suspended. It returns true if the command should skip AI analysis.
+func (s *SessionState) recordIfSuspended(entry *CommandEntry) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.Suspended {
+		return false
+	}
+	s.away.Commands++
+	if entry.Failed() {
+		s.away.Failures++
+		e := *entry
+		s.away.LastFailure = &e
+	}
+	return true
+}
+
+// recordDroppedIfSuspended counts a suppressed proactive message when the
+// session is suspended. It returns true if the message should be dropped.
+func (s *SessionState) recordDroppedIfSuspended() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.Suspended {
+		return false
+	}
+	s.away.Dropped++
+	return true
+}
+
+// setSuspended suspends or resumes AI analysis for the session and reports
+// whether that changed anything. Resuming returns what happened while the
+// session was suspended and for how long.
+func (s *SessionState) setSuspended(suspended bool) (away awaySummary, awayFor time.Duration, changed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Suspended == suspended {
+		return awaySummary{}, 0, false
+	}
+	s.Suspended = suspended
+	if suspended {
+		s.SuspendedAt = time.Now()
+		s.away = awaySummary{}
+		return awaySummary{}, 0, true
+	}
+	away, awayFor = s.away, time.Since(s.SuspendedAt)
+	s.away = awaySummary{}
+	return away, awayFor, true
+}
+
+// SetSessionVisible suspends or resumes AI monitoring for a session based on
+// browser tab visibility. Hidden tabs skip analysis and proactive messages;
+// on return the learner receives a recap of what happened while away.
+func (tm *Monitor) SetSessionVisible(ctx context.Context, userID, sessionID string, visible bool) {
+	session := tm.GetSessionState(userID, sessionID)
+	if session == nil {
+		return
+	}
+	away, awayFor, changed := session.setSuspended(!visible)
+	if !changed {
+		return
+	}
+	if !visible {
+		tm.logger.Info("[MONITOR] Tab hidden, suspending AI analysis", "user_id", userID, "session_id", sessionID)
+		return
+	}
+
+	tm.logger.Info("[MONITOR] Tab visible, resuming AI analysis",
+		"user_id", userID,
+		"session_id", sessionID,
+		"away_ms", awayFor.Milliseconds(),
+		"commands", away.Commands,
+		"dropped_messages", away.Dropped,
+	)
+
+	if recap := buildAwayRecap(away); recap != "" {
+		tm.sendToSidebar(ctx, userID, &agent.Response{
+			Type:      string(agent.ResponseTypeRecap),
+			Content:   recap,
+			Sidebar:   recap,
+			UserID:    userID,
+			SessionID: sessionID,
+		})
+	}
+}
+
+// buildAwayRecap renders a short summary of activity while the tab was hidden.
+// Returns an empty string when nothing worth mentioning happened.
+func buildAwayRecap(away awaySummary) string {
+	if away.Commands == 0 && away.Dropped == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("While you were away: ")
+	switch away.Commands {
+	case 0:
+		b.WriteString("no commands finished")
+	case 1:
+		b.WriteString("1 command finished")
+	default:
+		fmt.Fprintf(&b, "%d commands finished", away.Commands)
+	}
+	if away.Failures > 0 {
+		fmt.Fprintf(&b, " (%d failed)", away.Failures)
+	}
+	b.WriteString(".")
+	if away.LastFailure != nil {
+		fmt.Fprintf(&b, " Last error: `%s` exited with %d.", away.LastFailure.Command, away.LastFailure.ExitCode)
+	}
+	if away.Dropped > 0 {
+		fmt.Fprintf(&b, " %d hint(s) were held back.", away.Dropped)
+	}
+	return b.String()
+}
+
+// tabVisibility tracks whether the browser tab behind a WebSocket connection
+// is visible. The tab counts as hidden if the client says so or if pings stop
+// arriving; the monitor is only notified when the combined state changes.
+type tabVisibility struct {
+	monitor   *Monitor
+	userID    string
+	sessionID string
+
+	mu             sync.Mutex
+	lastPing       time.Time
+	reportedHidden bool // Client sent visibility=hidden
+	pingHidden     bool // No ping within the timeout
+
+	pushMu sync.Mutex // Serializes pushes, so the monitor ends on the latest state
+	pushed bool       // Last state pushed to the monitor; guarded by pushMu
+}
+
+func newTabVisibility(monitor *Monitor, userID, sessionID string) *tabVisibility {
+	return &tabVisibility{
+		monitor:   monitor,
+		userID:    userID,
+		sessionID: sessionID,
+		lastPing:  time.Now(),
+	}
+}
+
+// ping records a heartbeat from the client.
+func (v *tabVisibility) ping(ctx context.Context) {
+	v.update(func() {
+		v.lastPing = time.Now()
+		v.pingHidden = false
+	})
+	v.push(ctx)
+}
+
+// report records an explicit visibility change from the client.
+func (v *tabVisibility) report(ctx context.Context, visible bool) {
+	v.update(func() {
+		v.reportedHidden = !visible
+		if visible {
+			// A visible tab resumes its heartbeat; don't wait for the next ping.
+			v.lastPing = time.Now()
+			v.pingHidden = false
+		}
+	})
+	v.push(ctx)
+}
+
+// checkPings marks the tab hidden if no ping arrived within timeout.
+func (v *tabVisibility) checkPings(ctx context.Context, now time.Time, timeout time.Duration) {
+	v.update(func() {
+		if now.Sub(v.lastPing) > timeout {
+			v.pingHidden = true
+		}
+	})
+	v.push(ctx)
+}
+
+// watchPings runs checkPings until ctx is cancelled.
+func (v *tabVisibility) watchPings(ctx context.Context, timeout time.Duration) {
+	ticker := time.NewTicker(timeout / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			v.checkPings(ctx, now, timeout)
+		}
+	}
+}
+
+// update applies fn to the tracked state under v.mu.
+func (v *tabVisibility) update(fn func()) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	fn()
+}
+
+// isHidden reports the combined state.
+func (v *tabVisibility) isHidden() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.reportedHidden || v.pingHidden
+}
+
+// push tells the monitor the combined state if it changed since the last
+// push. The monitor is called without holding v.mu, so pings and reports
+// never wait on it.
+func (v *tabVisibility) push(ctx context.Context) {
+	if v.monitor == nil {
+		return
+	}
+	v.pushMu.Lock()
+	defer v.pushMu.Unlock()
+	hidden := v.isHidden()
+	if hidden == v.pushed {
+		return
+	}
+	v.pushed = hidden
+	v.monitor.SetSessionVisible(ctx, v.userID, v.sessionID, !hidden)
+}
@@ -0,0 +1,88 @@
+package terminal
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/agent"
+)
+
+func TestHiddenSessionSkipsAnalysisAndSendsRecap(t *testing.T) {
+	sidebar := make(chan *agent.Response, 4)
+	tm := NewMonitor(nil, sidebar, nil)
+	defer tm.Stop()
+
+	ctx := context.Background()
+	tm.RegisterSession("u1", "s1", "c1", "/home/u1")
+	tm.SetSessionVisible(ctx, "u1", "s1", false)
+
+	tm.handleCommandExecuted(ctx, "u1", "s1", &CommandEntry{Command: "ls", ExitCode: 0})
+	tm.handleCommandExecuted(ctx, "u1", "s1", &CommandEntry{Command: "cat nope", ExitCode: 1})
+	if len(tm.jobChan) != 0 {
+		t.Fatalf("expected no analysis jobs while hidden, got %d", len(tm.jobChan))
+	}
+
+	tm.SetSessionVisible(ctx, "u1", "s1", true)
+	select {
+	case resp := <-sidebar:
+		if resp.Type != string(agent.ResponseTypeRecap) {
+			t.Fatalf("expected recap, got %q", resp.Type)
+		}
+		if !strings.Contains(resp.Content, "2 commands finished (1 failed)") || !strings.Contains(resp.Content, "cat nope") {
+			t.Fatalf("unexpected recap: %q", resp.Content)
+		}
+	default:
+		t.Fatal("expected a recap on return")
+	}
+	if tm.GetSessionState("u1", "s1").IsSuspended() {
+		t.Fatal("expected session to resume")
+	}
+}
+
+func TestVisibleReturnWithoutActivitySendsNothing(t *testing.T) {
+	sidebar := make(chan *agent.Response, 1)
+	tm := NewMonitor(nil, sidebar, nil)
+	defer tm.Stop()
+
+	ctx := context.Background()
+	tm.RegisterSession("u1", "s1", "c1", "/home/u1")
+	tm.SetSessionVisible(ctx, "u1", "s1", false)
+	tm.SetSessionVisible(ctx, "u1", "s1", true)
+
+	if len(sidebar) != 0 {
+		t.Fatalf("expected no recap, got %d messages", len(sidebar))
+	}
+}
+
+func TestTabVisibilityMissingPings(t *testing.T) {
+	tm := NewMonitor(nil, make(chan *agent.Response, 1), nil)
+	defer tm.Stop()
+
+	ctx := context.Background()
+	tm.RegisterSession("u1", "s1", "c1", "/home/u1")
+	v := newTabVisibility(tm, "u1", "s1")
+
+	v.checkPings(ctx, time.Now().Add(time.Minute), 90*time.Second)
+	if tm.GetSessionState("u1", "s1").IsSuspended() {
+		t.Fatal("expected session visible within ping timeout")
+	}
+
+	v.checkPings(ctx, time.Now().Add(2*time.Minute), 90*time.Second)
+	if !tm.GetSessionState("u1", "s1").IsSuspended() {
+		t.Fatal("expected session suspended after missed pings")
+	}
+
+	v.ping(ctx)
+	if tm.GetSessionState("u1", "s1").IsSuspended() {
+		t.Fatal("expected ping to resume session")
+	}
+
+	// An explicitly hidden tab stays hidden even though throttled pings continue.
+	v.report(ctx, false)
+	v.ping(ctx)
+	if !tm.GetSessionState("u1", "s1").IsSuspended() {
+		t.Fatal("expected explicit hidden report to win over pings")
+	}
+}
@@ -2,6 +2,7 @@ package terminal
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"encoding/json"
 	"errors"
 	"io"
@@ -10,31 +11,100 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ashureev/shsh-labs/internal/config"
 	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/domain"
 	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/session"
 	"github.com/ashureev/shsh-labs/internal/store"
 	"github.com/coder/websocket"
 )
 
+// Defaults used when the handler is created without configuration.
+const (
+	defaultHiddenPingTimeout = 90 * time.Second
+	defaultWSMaxMessageSize  = 64 * 1024
+	defaultWSMaxInputSize    = 16 * 1024
+)
+
+// ExecAttacher creates and resizes interactive exec sessions. container.Manager
+// attaches locally; a terminal broker client attaches on a remote Docker host.
+type ExecAttacher interface {
+	CreateExecSession(ctx context.Context, containerID string) (string, io.ReadWriteCloser, error)
+	ResizeExecSession(ctx context.Context, execID string, cols, rows uint) error
+}
+
 // WebSocketHandler handles WebSocket-based terminal sessions.
 type WebSocketHandler struct {
 	repo          store.Repository
 	mgr           container.Manager
+	exec          ExecAttacher
 	sm            *SessionManager
 	monitor       *Monitor
+	idle          *idlePauser // nil when the manager cannot pause containers
+	activity      *ActivityTracker
+	banner        *terminalBanner // nil when no banner is configured
+	inputFilter   *inputFilter    // nil when no input filtering is configured
+	abuse         *abuseDetector  // nil when abuse detection is disabled
+	classrooms    ClassroomResolver
+	tap           SessionTap        // nil unless sessions are being observed
+	e2eKey        *ecdsa.PrivateKey // Signs key shares of end-to-end encrypted terminals
 	allowedOrigin string
 	isDev         bool
+	cfg           *config.Config
+	sessions      *session.Lifecycle
 }
 
 // NewWebSocketHandler creates a new WebSocket handler.
+//
+// Deprecated: Use NewWebSocketHandlerWithConfig instead.
 func NewWebSocketHandler(repo store.Repository, mgr container.Manager, sm *SessionManager, allowedOrigin string, isDev bool) *WebSocketHandler {
 	return &WebSocketHandler{
 		repo:          repo,
 		mgr:           mgr,
 		sm:            sm,
+		idle:          newIdlePauser(mgr, sm, defaultAutoPauseDelay),
 		allowedOrigin: allowedOrigin,
 		isDev:         isDev,
+		sessions:      session.NewLifecycle(nil),
+	}
+}
+
+// NewWebSocketHandlerWithConfig creates a new WebSocket handler with configuration.
+func NewWebSocketHandlerWithConfig(repo store.Repository, mgr container.Manager, sm *SessionManager, cfg *config.Config) *WebSocketHandler {
+	return &WebSocketHandler{
+		repo:          repo,
+		mgr:           mgr,
+		sm:            sm,
+		idle:          newIdlePauser(mgr, sm, cfg.Container.AutoPauseDelay),
+		banner:        newTerminalBanner(cfg.Terminal.Banner, cfg.Terminal.BannerDir, cfg.Terminal.BannerScript, mgr),
+		inputFilter:   newInputFilter(cfg.Terminal.InputFilter, cfg.Terminal.InputFilterDir),
+		abuse:         newAbuseDetector(cfg.Terminal.AbuseDetection, cfg.Terminal.AbuseStrikes),
+		allowedOrigin: cfg.FrontendURL,
+		isDev:         cfg.IsDevelopment(),
+		cfg:           cfg,
+		sessions:      session.NewLifecycle(nil),
+	}
+}
+
+// SetExecAttacher delegates exec attachment, e.g. to a terminal broker.
+// By default the container manager attaches directly.
+func (h *WebSocketHandler) SetExecAttacher(exec ExecAttacher) {
+	h.exec = exec
+}
+
+// execAttacher returns the configured attacher, falling back to the manager.
+func (h *WebSocketHandler) execAttacher() ExecAttacher {
+	if h.exec != nil {
+		return h.exec
 	}
+	return h.mgr
+}
+
+// SetSessionLifecycle shares the session lifecycle with the agent stream
+// handler, so state of a tab is torn down once both its connections closed.
+func (h *WebSocketHandler) SetSessionLifecycle(l *session.Lifecycle) {
+	h.sessions = l
 }
 
 // SetMonitor sets the terminal monitor for proactive AI monitoring.
@@ -42,12 +112,57 @@ func (h *WebSocketHandler) SetMonitor(monitor *Monitor) {
 	h.monitor = monitor
 }
 
+// SetActivityTracker records container output (and, with a monitor, running
+// commands) so the TTL worker can tell busy sessions from idle ones.
+func (h *WebSocketHandler) SetActivityTracker(tracker *ActivityTracker) {
+	h.activity = tracker
+}
+
+// SetClassroomResolver enables per-classroom banners, input filters and
+// quiet hours from their directories.
+func (h *WebSocketHandler) SetClassroomResolver(resolver ClassroomResolver) {
+	h.classrooms = resolver
+}
+
+// hiddenPingTimeout returns how long a connection may go without pings before
+// its tab is treated as hidden. Zero disables ping-based detection.
+func (h *WebSocketHandler) hiddenPingTimeout() time.Duration {
+	if h.cfg != nil {
+		return h.cfg.Terminal.HiddenPingTimeout
+	}
+	return defaultHiddenPingTimeout
+}
+
+// maxMessageSize returns the largest WebSocket frame accepted from the client.
+func (h *WebSocketHandler) maxMessageSize() int64 {
+	if h.cfg != nil {
+		return h.cfg.Terminal.MaxMessageSize
+	}
+	return defaultWSMaxMessageSize
+}
+
+// floodLimits returns the output flood threshold and sampling budget in bytes/sec.
+func (h *WebSocketHandler) floodLimits() (threshold, sampleBudget int) {
+	if h.cfg != nil {
+		return h.cfg.Terminal.FloodThreshold, h.cfg.Terminal.FloodSampleBudget
+	}
+	return defaultFloodThreshold, defaultFloodSampleBudget
+}
+
+// maxInputSize returns the largest terminal input accepted in one message.
+func (h *WebSocketHandler) maxInputSize() int {
+	if h.cfg != nil {
+		return h.cfg.Terminal.MaxInputSize
+	}
+	return defaultWSMaxInputSize
+}
+
 // wsWriter adapts websocket.Conn to io.Writer.
 // Uses context.Background() for writes since WebSocket library handles its own
 // connection state. The passed context is only for initial setup.
 type wsWriter struct {
-	conn *websocket.Conn
-	ctx  context.Context
+	out terminalConn
+	ctx context.Context
 }
 
 func (w *wsWriter) Write(p []byte) (int, error) {
@@ -56,7 +171,7 @@ func (w *wsWriter) Write(p []byte) (int, error) {
 		return 0, w.ctx.Err()
 	}
 
-	if err := w.conn.Write(context.Background(), websocket.MessageBinary, p); err != nil {
+	if err := w.out.writeOutput(context.Background(), p); err != nil {
 		// Check if this is a closed connection error - these are expected
 		// when clients disconnect abruptly
 		if w.ctx.Err() != nil {
@@ -70,6 +185,47 @@ func (w *wsWriter) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
+// terminalInput writes keystrokes into a container exec session and mirrors
+// them to the terminal monitor for command detection. Both the WebSocket input
+// loop and server-side injection (PTYController) write through it; mu keeps
+// their writes whole and in the same order for the shell and the monitor.
+type terminalInput struct {
+	ctx       context.Context
+	exec      io.Writer
+	monitor   *Monitor
+	userID    string
+	sessionID string
+
+	mu sync.Mutex
+}
+
+// Write sends data to the container and to the monitor.
+// Editor keystrokes are not shell commands, so they skip the monitor.
+func (t *terminalInput) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n, err := t.exec.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	if t.monitor != nil {
+		inEditor := t.monitor.IsInEditorMode(t.userID, t.sessionID)
+		slog.Debug("[WS] Editor mode check", "user_id", t.userID, "session_id", t.sessionID, "in_editor", inEditor, "content", string(p))
+		if !inEditor {
+			t.monitor.ProcessInput(t.ctx, t.userID, t.sessionID, p)
+		}
+	}
+	return n, nil
+}
+
+// WriteRaw sends data to the container without monitor processing.
+func (t *terminalInput) WriteRaw(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.exec.Write(p)
+}
+
 // wsMessage represents WebSocket message structure.
 type wsMessage struct {
 	Type    string `json:"type"`
@@ -79,9 +235,24 @@ type wsMessage struct {
 }
 
 // ServeHTTP implements http.Handler for WebSocket upgrade.
+// With pair=1 the connection joins the user's pair instead: the host
+// attaches the shared terminal and the partner follows it.
+// With node=<name> it opens a shell on that node of the user's lab instead
+// of their container.
+//
+//nolint:gocognit // Pair connections branch off before the exec session is set up.
 func (h *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	userID := identity.UserIDFromContext(r.Context())
 	sessionID := identity.SessionIDFromContext(r.Context())
+	paired := r.URL.Query().Get("pair") == "1"
+	node := r.URL.Query().Get("node")
+	if paired {
+		sessionID = PairSessionID
+		node = ""
+	} else if node != "" {
+		// A node terminal sits next to the tab's own terminal.
+		sessionID = nodeSessionID(sessionID, node)
+	}
 	slog.Info("WebSocket connection request", "user_id", userID, "session_id", sessionID, "ip", r.RemoteAddr)
 
 	if !h.checkOrigin(r) {
@@ -97,33 +268,74 @@ func (h *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		slog.Error("Failed to accept WebSocket", "error", err, "user_id", userID)
 		return
 	}
+	// Frames larger than this close the connection with StatusMessageTooBig
+	// before they are buffered in full.
+	ws.SetReadLimit(h.maxMessageSize())
 	defer func() {
 		if closeErr := ws.Close(websocket.StatusNormalClosure, "session ended"); closeErr != nil {
 			slog.Debug("Failed to close websocket", "error", closeErr, "user_id", userID)
 		}
 	}()
+	sealer, ok := h.acceptE2E(ws, r, userID)
+	if !ok {
+		return
+	}
+	out := terminalConn{conn: ws, sealer: sealer}
+
+	// Per-session state is registered with the hold and released by its
+	// single Close when the connection ends.
+	hold := h.sessions.Acquire(userID, sessionID)
+	defer hold.Close()
 
 	h.sm.Register(userID, sessionID, ws)
-	defer h.sm.Unregister(userID, sessionID, ws)
+	hold.Defer(func() { h.sm.Unregister(userID, sessionID, ws) })
 
 	ctx, cancel := context.WithCancel(r.Context())
 	defer cancel()
 
+	var pair PairStatus
+	if paired {
+		var ok bool
+		if pair, ok = h.sm.Pairing(userID); !ok {
+			if err := h.writeJSON(ws, map[string]string{"error": "not_paired"}); err != nil {
+				slog.Debug("Failed to send not_paired error", "error", err)
+			}
+			return
+		}
+		if pair.Partner == userID {
+			h.serveFollower(ctx, out, userID)
+			return
+		}
+	}
+
 	user, err := h.repo.GetUser(ctx, userID)
 	if err != nil || user == nil || user.ContainerID == "" {
 		slog.Warn("Container not ready", "user_id", userID)
-		if err := h.writeJSON(ws, map[string]string{"error": "container_not_ready"}); err != nil {
+		msg := map[string]string{"error": "container_not_ready"}
+		if reason := h.deathReason(ctx, userID); reason != "" {
+			msg["reason"] = reason
+		}
+		if err := h.writeJSON(ws, msg); err != nil {
 			slog.Debug("Failed to send container_not_ready error", "error", err)
 		}
 		return
 	}
 
-	slog.Info("Attaching to container", "container_id", user.ContainerID, "user_id", userID)
-	execID, execStream, err := h.mgr.CreateExecSession(ctx, user.ContainerID)
+	if h.idle != nil {
+		h.idle.resume(ctx, userID, user.ContainerID)
+		defer h.idle.schedule(userID, user.ContainerID)
+	}
+
+	slog.Info("Attaching to container", "container_id", user.ContainerID, "user_id", userID, "node", node)
+	execID, execStream, err := h.openTerminal(ctx, userID, user.ContainerID, node, terminalOptionsFromRequest(r))
 	if err != nil {
-		slog.Error("Failed to create exec session", "error", err)
-		if err := h.writeJSON(ws, map[string]string{"error": "failed_to_create_exec"}); err != nil {
-			slog.Debug("Failed to send failed_to_create_exec error", "error", err)
+		slog.Error("Failed to create exec session", "error", err, "node", node)
+		code := "failed_to_create_exec"
+		if errors.Is(err, container.ErrNodeNotFound) {
+			code = "node_not_found"
+		}
+		if err := h.writeJSON(ws, map[string]string{"error": code}); err != nil {
+			slog.Debug("Failed to send exec error", "error", err, "code", code)
 		}
 		return
 	}
@@ -133,10 +345,50 @@ func (h *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	// Register session with terminal monitor for AI monitoring
-	if h.monitor != nil {
+	// Register session with terminal monitor for AI monitoring. A connection
+	// replacing this one re-registers it, so only the last terminal of the
+	// tab unregisters. Lab nodes are not the learner's container, so their
+	// terminals are not monitored.
+	if h.monitor != nil && node == "" {
 		h.monitor.RegisterSession(userID, sessionID, user.ContainerID, user.VolumePath)
-		defer h.monitor.UnregisterSession(userID, sessionID)
+		hold.Defer(func() {
+			if current := h.sm.GetActive(userID, sessionID); current == nil || current == ws {
+				h.monitor.UnregisterSession(userID, sessionID)
+			}
+		})
+	}
+
+	input := &terminalInput{
+		ctx:       ctx,
+		exec:      execStream,
+		monitor:   h.monitor,
+		userID:    userID,
+		sessionID: sessionID,
+	}
+	h.sm.RegisterInput(userID, sessionID, input)
+	hold.Defer(func() { h.sm.UnregisterInput(userID, sessionID, input) })
+
+	classroom := h.classroomOf(ctx, userID)
+	if h.monitor != nil && classroom != "" {
+		h.monitor.SetSessionClassroom(userID, sessionID, classroom)
+	}
+	var blocked inputKeySet
+	if h.inputFilter != nil {
+		blocked = h.inputFilter.policyFor(classroom)
+	}
+
+	// Written before the output loop starts, so the banner precedes the
+	// shell prompt and bypasses the monitor.
+	if node == "" {
+		h.writeBanner(ctx, out, userID, sessionID, user.ContainerID, classroom)
+	}
+	if paired {
+		broadcastPairStatus([]*websocket.Conn{ws}, pair)
+	}
+
+	visibility := newTabVisibility(h.monitor, userID, sessionID)
+	if timeout := h.hiddenPingTimeout(); h.monitor != nil && timeout > 0 {
+		go visibility.watchPings(ctx, timeout)
 	}
 
 	var wg sync.WaitGroup
@@ -146,20 +398,59 @@ func (h *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	go func() {
 		defer wg.Done()
 		defer cancel()
-		h.inputLoop(ctx, ws, execStream, userID, sessionID, execID)
+		h.inputLoop(ctx, out, input, visibility, &blocked, h.abuse.guard(), userID, sessionID, user.ContainerID, execID)
 	}()
 
 	// Output loop: container -> WebSocket.
 	go func() {
 		defer wg.Done()
 		defer cancel()
-		h.outputLoop(ctx, ws, execStream, userID)
+		h.outputLoop(ctx, out, execStream, userID, sessionID)
 	}()
 
 	wg.Wait()
 	slog.Info("Terminal session ended", "user_id", userID)
 }
 
+// classroomOf returns the user's classroom when a per-classroom setting
+// needs it, and "" otherwise.
+func (h *WebSocketHandler) classroomOf(ctx context.Context, userID string) string {
+	if h.classrooms == nil || (h.banner == nil && h.inputFilter == nil && !h.monitor.hasClassroomQuietHours()) {
+		return ""
+	}
+	return h.classrooms.ClassroomOf(ctx, userID)
+}
+
+// deathReason returns why the watchdog removed the user's last container,
+// oom_killed or crashed, if that is the last thing that happened to it, so
+// the client can explain the missing container.
+func (h *WebSocketHandler) deathReason(ctx context.Context, userID string) string {
+	events, err := h.repo.ListContainerEvents(ctx, userID, 1)
+	if err != nil || len(events) == 0 || events[0].Event != domain.ContainerEventStop {
+		return ""
+	}
+	switch reason := events[0].Reason; reason {
+	case container.ReasonOOMKilled, container.ReasonCrashed:
+		return reason
+	}
+	return ""
+}
+
+// writeBanner sends the configured banner the first time the tab attaches
+// to containerID.
+func (h *WebSocketHandler) writeBanner(ctx context.Context, out terminalConn, userID, sessionID, containerID, classroom string) {
+	if h.banner == nil || !h.banner.firstAttach(identity.NewSessionKey(userID, sessionID), containerID, time.Now()) {
+		return
+	}
+	banner := h.banner.render(ctx, classroom, containerID)
+	if len(banner) == 0 {
+		return
+	}
+	if err := out.writeOutput(ctx, banner); err != nil {
+		slog.Debug("Failed to write terminal banner", "error", err, "user_id", userID)
+	}
+}
+
 func (h *WebSocketHandler) checkOrigin(r *http.Request) bool {
 	if h.isDev {
 		return true
@@ -176,10 +467,11 @@ func (h *WebSocketHandler) checkOrigin(r *http.Request) bool {
 }
 
 //nolint:gocognit // Message dispatch must coordinate websocket, terminal, and monitor state.
-func (h *WebSocketHandler) inputLoop(ctx context.Context, ws *websocket.Conn, execStream io.Writer, userID, sessionID, execID string) {
+func (h *WebSocketHandler) inputLoop(ctx context.Context, out terminalConn, execStream *terminalInput, visibility *tabVisibility, blocked *inputKeySet, guard *abuseGuard, userID, sessionID, containerID, execID string) {
+	ws := out.conn
 	slog.Debug("Starting input loop", "user_id", userID)
 	for {
-		_, message, err := ws.Read(ctx)
+		typ, message, err := ws.Read(ctx)
 		if err != nil {
 			if websocket.CloseStatus(err) != -1 {
 				slog.Debug("WebSocket closed by client", "user_id", userID)
@@ -189,41 +481,77 @@ func (h *WebSocketHandler) inputLoop(ctx context.Context, ws *websocket.Conn, ex
 			return
 		}
 
+		// Keystrokes of an encrypted terminal arrive sealed in binary
+		// frames and are opened only here, on their way to the shell.
+		if out.sealer != nil && typ == websocket.MessageBinary {
+			data, err := out.sealer.openFrame(typ, message)
+			if err != nil {
+				slog.Warn("Encrypted terminal input refused", "error", err, "user_id", userID)
+				return
+			}
+			if !h.typeInput(ws, execStream, blocked, guard, data, userID, sessionID, containerID) {
+				return
+			}
+			go h.touchLastSeen(userID)
+			continue
+		}
+
 		var msg wsMessage
 		if err := json.Unmarshal(message, &msg); err != nil {
+			if out.sealer != nil {
+				slog.Warn("Encrypted terminal input refused", "error", errE2EPlainInput, "user_id", userID)
+				return
+			}
 			// Fallback to raw data.
-			if _, err := execStream.Write(message); err != nil {
+			if len(message) > h.maxInputSize() {
+				slog.Warn("Raw terminal input too large, dropped", "user_id", userID, "size", len(message))
+				continue
+			}
+			if message = blocked.filter(message); len(message) == 0 || !h.mayType(userID, sessionID) {
+				continue
+			}
+			var rule string
+			message, rule = guard.check(message)
+			if _, err := execStream.WriteRaw(message); err != nil {
 				slog.Error("Exec stream write error", "error", err)
 				return
 			}
+			h.tapInput(userID, sessionID, message)
+			if rule != "" && h.reportAbuse(ws, userID, sessionID, containerID, rule) {
+				return
+			}
 			continue
 		}
 
 		switch msg.Type {
 		case "data":
-			// Send to container
-			if _, err := execStream.Write([]byte(msg.Content)); err != nil {
-				slog.Error("Exec stdin write error", "error", err)
+			if out.sealer != nil {
+				slog.Warn("Encrypted terminal input refused", "error", errE2EPlainInput, "user_id", userID)
 				return
 			}
-
-			// Also process through terminal monitor for command detection
-			// Skip if in editor mode - editor keystrokes are not shell commands
-			if h.monitor != nil {
-				inEditor := h.monitor.IsInEditorMode(userID, sessionID)
-				slog.Debug("[WS] Editor mode check", "user_id", userID, "session_id", sessionID, "in_editor", inEditor, "content", msg.Content)
-				if !inEditor {
-					h.monitor.ProcessInput(ctx, userID, sessionID, []byte(msg.Content))
-				}
+			if !h.typeInput(ws, execStream, blocked, guard, []byte(msg.Content), userID, sessionID, containerID) {
+				return
 			}
 		case "ping":
+			visibility.ping(ctx)
 			if err := h.writeJSON(ws, map[string]string{"type": "pong"}); err != nil {
 				slog.Debug("Failed to send pong", "error", err)
 			}
+		case "visibility":
+			switch msg.Content {
+			case "hidden":
+				visibility.report(ctx, false)
+			case "visible":
+				visibility.report(ctx, true)
+			}
 		case "resize":
-			if err := h.mgr.ResizeExecSession(ctx, execID, msg.Cols, msg.Rows); err != nil {
+			if err := h.execAttacher().ResizeExecSession(ctx, execID, msg.Cols, msg.Rows); err != nil {
 				slog.Warn("Failed to resize", "error", err)
 			}
+		case "request_control", "grant_control":
+			if sessionID == PairSessionID {
+				h.pairControl(ws, userID, msg)
+			}
 		case "terminate":
 			slog.Info("Terminal terminate requested", "user_id", userID, "session_id", sessionID)
 			if err := h.writeJSON(ws, map[string]string{"type": "terminated"}); err != nil {
@@ -232,25 +560,68 @@ func (h *WebSocketHandler) inputLoop(ctx context.Context, ws *websocket.Conn, ex
 			return
 		}
 
-		// Update last seen asynchronously with timeout.
-		go func() {
-			updateCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
-			if err := h.repo.UpdateLastSeen(updateCtx, userID, time.Now()); err != nil {
-				slog.Warn("Failed to update last seen", "error", err)
-			}
-		}()
+		go h.touchLastSeen(userID)
+	}
+}
+
+// touchLastSeen records that the user is active, with a timeout.
+func (h *WebSocketHandler) touchLastSeen(userID string) {
+	updateCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.repo.UpdateLastSeen(updateCtx, userID, time.Now()); err != nil {
+		slog.Warn("Failed to update last seen", "error", err)
 	}
 }
 
-func (h *WebSocketHandler) outputLoop(ctx context.Context, ws *websocket.Conn, execStream io.Reader, userID string) {
-	sessionID := identity.SessionIDFromContext(ctx)
-	sessionKey := userID + ":" + sessionID
-	wsWriter := &wsWriter{ws, ctx}
+// typeInput sends keystrokes to the shell and the monitor, after the size
+// limit, the classroom's blocked keys and abuse detection. It reports
+// whether the connection should stay open.
+func (h *WebSocketHandler) typeInput(ws *websocket.Conn, execStream *terminalInput, blocked *inputKeySet, guard *abuseGuard, data []byte, userID, sessionID, containerID string) bool {
+	if len(data) > h.maxInputSize() {
+		slog.Warn("Terminal input too large, dropped",
+			"user_id", userID,
+			"session_id", sessionID,
+			"size", len(data),
+			"limit", h.maxInputSize(),
+		)
+		if err := h.writeJSON(ws, map[string]string{"type": "error", "error": "input_too_large"}); err != nil {
+			slog.Debug("Failed to send input_too_large error", "error", err)
+		}
+		return true
+	}
+	// Blocked keys are dropped before the shell or the monitor sees them.
+	data = blocked.filter(data)
+	if len(data) == 0 || !h.mayType(userID, sessionID) {
+		return true
+	}
+	// An abusive command line has its Enter replaced before it runs.
+	data, rule := guard.check(data)
+	// Send to container and through the terminal monitor for command detection.
+	if _, err := execStream.Write(data); err != nil {
+		slog.Error("Exec stdin write error", "error", err)
+		return false
+	}
+	h.tapInput(userID, sessionID, data)
+	return rule == "" || !h.reportAbuse(ws, userID, sessionID, containerID, rule)
+}
+
+func (h *WebSocketHandler) outputLoop(ctx context.Context, out terminalConn, execStream io.Reader, userID, sessionID string) {
+	sessionKey := identity.NewSessionKey(userID, sessionID)
+	wsWriter := &wsWriter{out, ctx}
+	if h.activity != nil {
+		execStream = &activityReader{r: execStream, tracker: h.activity, userID: userID}
+	}
+	if h.tap != nil {
+		execStream = &tapReader{r: execStream, tap: h.tap, userID: userID, sessionID: sessionID}
+	}
+	if sessionID == PairSessionID {
+		execStream = io.TeeReader(execStream, &pairMirror{ctx: ctx, sm: h.sm, hostID: userID})
+	}
 
 	if h.monitor != nil {
 		// Use async dual writer to prevent blocking WebSocket I/O
 		writer := NewAsyncDualWriter(wsWriter, h.monitor, userID, sessionID, sessionKey, nil)
+		writer.SetFloodLimits(h.floodLimits())
 		defer func() {
 			if closeErr := writer.Close(); closeErr != nil {
 				slog.Debug("Failed to close async dual writer", "error", closeErr, "user_id", userID)
@@ -268,6 +639,12 @@ func (h *WebSocketHandler) outputLoop(ctx context.Context, ws *websocket.Conn, e
 	}
 }
 
+// mayType reports whether the user's keystrokes reach the shell: in a pair
+// terminal only the driver types.
+func (h *WebSocketHandler) mayType(userID, sessionID string) bool {
+	return sessionID != PairSessionID || h.sm.canType(userID)
+}
+
 func (h *WebSocketHandler) writeJSON(ws *websocket.Conn, v interface{}) error {
 	data, err := json.Marshal(v)
 	if err != nil {
@@ -0,0 +1,87 @@
+package terminal
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/store"
+)
+
+// eventRepo returns fixed container events, newest first.
+type eventRepo struct {
+	store.Repository
+	events []*domain.ContainerEvent
+}
+
+func (r *eventRepo) ListContainerEvents(_ context.Context, _ string, limit int) ([]*domain.ContainerEvent, error) {
+	return r.events[:min(limit, len(r.events))], nil
+}
+
+func TestDeathReason(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []*domain.ContainerEvent
+		want   string
+	}{
+		{"no events", nil, ""},
+		{"oom killed", []*domain.ContainerEvent{{Event: domain.ContainerEventStop, Reason: container.ReasonOOMKilled}}, "oom_killed"},
+		{"crashed", []*domain.ContainerEvent{{Event: domain.ContainerEventStop, Reason: container.ReasonCrashed}}, "crashed"},
+		{"expired", []*domain.ContainerEvent{{Event: domain.ContainerEventStop, Reason: container.ReasonTTL}}, ""},
+		{"recreated since", []*domain.ContainerEvent{
+			{Event: domain.ContainerEventCreate, Reason: container.ReasonOOMKilled},
+			{Event: domain.ContainerEventStop, Reason: container.ReasonOOMKilled},
+		}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &WebSocketHandler{repo: &eventRepo{events: tt.events}}
+			if got := h.deathReason(context.Background(), "u1"); got != tt.want {
+				t.Fatalf("deathReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// overlapWriter counts writes that start while another is in progress.
+type overlapWriter struct {
+	inFlight, overlaps atomic.Int32
+}
+
+func (w *overlapWriter) Write(p []byte) (int, error) {
+	if w.inFlight.Add(1) > 1 {
+		w.overlaps.Add(1)
+	}
+	time.Sleep(time.Microsecond)
+	w.inFlight.Add(-1)
+	return len(p), nil
+}
+
+func TestTerminalInputSerializesWriters(t *testing.T) {
+	exec := &overlapWriter{}
+	input := &terminalInput{ctx: t.Context(), exec: exec, userID: "alice", sessionID: "tab-1"}
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				// The input loop writes raw frames; injection types keystrokes.
+				if i%2 == 0 {
+					_, _ = input.WriteRaw([]byte("ls\r"))
+				} else {
+					_, _ = input.Write([]byte("x"))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n := exec.overlaps.Load(); n > 0 {
+		t.Fatalf("%d writes overlapped", n)
+	}
+}
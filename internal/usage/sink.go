@@ -0,0 +1,212 @@
+package usage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/config"
+)
+
+const (
+	// sinkTimeout bounds one webhook or Stripe request.
+	sinkTimeout = 30 * time.Second
+
+	// SignatureHeader carries the hex HMAC-SHA256 of a webhook body, keyed
+	// with the webhook secret.
+	SignatureHeader = "X-Shsh-Signature"
+
+	// stripeMeterEventsURL is the Stripe API endpoint receiving meter events.
+	stripeMeterEventsURL = "https://api.stripe.com/v1/billing/meter_events"
+)
+
+var errSinkStatus = errors.New("usage sink rejected records")
+
+// NewSink returns the sink configured by cfg, or nil when metering is
+// disabled.
+func NewSink(cfg config.UsageConfig) Sink {
+	switch cfg.Sink {
+	case config.UsageSinkFile:
+		return &FileSink{Path: cfg.FilePath}
+	case config.UsageSinkWebhook:
+		return &WebhookSink{URL: cfg.WebhookURL, Secret: cfg.WebhookSecret}
+	case config.UsageSinkStripe:
+		return &StripeSink{Key: cfg.StripeKey, Customers: cfg.StripeCustomers, EventPrefix: cfg.StripeEventPrefix}
+	default:
+		return nil
+	}
+}
+
+// FileSink appends records to a file, one JSON object per line.
+type FileSink struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// Emit appends records to the file.
+func (s *FileSink) Emit(_ context.Context, records []Record) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("encode usage record: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o750); err != nil {
+		return fmt.Errorf("create usage directory: %w", err)
+	}
+	f, err := os.OpenFile(s.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open usage file: %w", err)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("write usage file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close usage file: %w", err)
+	}
+	return nil
+}
+
+// WebhookSink posts each batch of records as {"records": [...]}. With a
+// secret, the body is signed in SignatureHeader so receivers can verify
+// it. Any 2xx response accepts the batch.
+type WebhookSink struct {
+	URL    string
+	Secret string
+	Client *http.Client // nil uses a client with sinkTimeout
+}
+
+// Emit posts records to the webhook.
+func (s *WebhookSink) Emit(ctx context.Context, records []Record) error {
+	body, err := json.Marshal(map[string][]Record{"records": records})
+	if err != nil {
+		return fmt.Errorf("encode usage records: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create usage webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(s.Secret, body))
+	}
+	return send(client(s.Client), req)
+}
+
+// Sign returns the signature a webhook body is sent with.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// StripeSink reports records as Stripe billing meter events named
+// EventPrefix + metric, e.g. shsh_container_seconds. The meters must exist
+// in Stripe; container_seconds and ai_calls meters sum their events and the
+// storage_bytes meter takes the last one. Customers names a JSON file of
+// user IDs to Stripe customer IDs, read on every flush so signups apply
+// without a restart; records of users it does not list are skipped.
+type StripeSink struct {
+	Key         string
+	Customers   string
+	EventPrefix string
+	Client      *http.Client // nil uses a client with sinkTimeout
+	URL         string       // Meter events endpoint; empty uses Stripe's
+}
+
+// Emit sends one meter event per record. Record IDs are sent as event
+// identifiers, so Stripe ignores events it already received.
+func (s *StripeSink) Emit(ctx context.Context, records []Record) error {
+	customers, err := readCustomers(s.Customers)
+	if err != nil {
+		return err
+	}
+	endpoint := s.URL
+	if endpoint == "" {
+		endpoint = stripeMeterEventsURL
+	}
+
+	skipped := 0
+	for _, r := range records {
+		customer := customers[r.UserID]
+		if customer == "" {
+			skipped++
+			continue
+		}
+		form := url.Values{
+			"event_name":                  {s.EventPrefix + r.Metric},
+			"identifier":                  {r.ID},
+			"timestamp":                   {strconv.FormatInt(r.PeriodEnd.Unix(), 10)},
+			"payload[stripe_customer_id]": {customer},
+			"payload[value]":              {strconv.FormatInt(r.Quantity, 10)},
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBufferString(form.Encode()))
+		if err != nil {
+			return fmt.Errorf("create stripe request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer "+s.Key)
+		if err := send(client(s.Client), req); err != nil {
+			return fmt.Errorf("record %s: %w", r.ID, err)
+		}
+	}
+	if skipped > 0 {
+		slog.Warn("Skipped usage records of users without a Stripe customer", "records", skipped)
+	}
+	return nil
+}
+
+// readCustomers reads the user ID to Stripe customer ID mapping.
+func readCustomers(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read stripe customers: %w", err)
+	}
+	var customers map[string]string
+	if err := json.Unmarshal(data, &customers); err != nil {
+		return nil, fmt.Errorf("decode stripe customers: %w", err)
+	}
+	return customers, nil
+}
+
+func client(c *http.Client) *http.Client {
+	if c != nil {
+		return c
+	}
+	return &http.Client{Timeout: sinkTimeout}
+}
+
+// send performs req, treating any non-2xx response as a rejection.
+func send(c *http.Client, req *http.Request) error {
+	resp, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("send usage records: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%w: %s: %s", errSinkStatus, resp.Status, bytes.TrimSpace(detail))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,263 @@
+// Package usage meters per-user resource usage so a hosted deployment can
+// bill for it.
+//
+// A Meter accumulates three metrics per user and emits them as Records at
+// the end of every period:
+//   - container_seconds: time a container was bound to the user, sampled
+//     from the store, so it survives restarts up to one sample
+//   - ai_calls: chat messages and terminal analyses that responded
+//   - storage_bytes: bytes held by the user's volumes at the period's end
+//
+// Quantities are integers so totals stay exact; container-hours are billed
+// by dividing container_seconds by 3600. Records carry a stable ID, and a
+// period a sink rejected is emitted again with the same IDs, so sinks must
+// treat IDs as idempotency keys.
+//
+// Every server samples the containers in the shared store, so only one
+// server of a deployment should meter usage.
+package usage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+)
+
+// Metrics recorded per user.
+const (
+	MetricContainerSeconds = "container_seconds"
+	MetricAICalls          = "ai_calls"
+	MetricStorageBytes     = "storage_bytes"
+)
+
+const (
+	// maxPendingRecords bounds the records kept for retry while the sink
+	// fails; the oldest are dropped beyond it.
+	maxPendingRecords = 100000
+
+	// storageTimeout bounds measuring volume sizes at the end of a period.
+	storageTimeout = 2 * time.Minute
+
+	// maxSampleGap bounds the container time one sample adds, in sample
+	// intervals, so a stalled worker does not bill for time it did not see.
+	maxSampleGap = 2
+)
+
+// Record is the usage of one metric by one user over a period.
+type Record struct {
+	ID          string    `json:"id"` // Stable across retries: user, metric and period start
+	UserID      string    `json:"user_id"`
+	Metric      string    `json:"metric"`
+	Quantity    int64     `json:"quantity"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+}
+
+// Sink receives the records of finished periods.
+type Sink interface {
+	// Emit delivers records. An error makes the meter emit them again with
+	// the next period.
+	Emit(ctx context.Context, records []Record) error
+}
+
+// ActiveContainerLister lists the users with a bound container;
+// store.Repository implements it.
+type ActiveContainerLister interface {
+	GetActiveContainers(ctx context.Context) ([]*domain.User, error)
+}
+
+// StorageReporter measures the bytes each user's volumes hold;
+// container.VolumeUsageReporter implements it.
+type StorageReporter interface {
+	VolumeUsage(ctx context.Context) (map[string]int64, error)
+}
+
+// Options configures a Meter.
+type Options struct {
+	SampleInterval time.Duration // Time between container samples
+	FlushInterval  time.Duration // Length of a usage period
+}
+
+// Meter accumulates usage and emits it to a sink once per period.
+type Meter struct {
+	sink    Sink
+	users   ActiveContainerLister
+	storage StorageReporter // nil leaves storage unmetered
+	opts    Options
+
+	mu          sync.Mutex
+	periodStart time.Time
+	lastSample  time.Time
+	containers  map[string]time.Duration // Container time per user this period
+	aiCalls     map[string]int64         // AI calls per user this period
+	pending     []Record                 // Records the sink has not accepted yet
+
+	flushMu sync.Mutex // Serializes flushes
+}
+
+// NewMeter creates a meter emitting to sink. storage may be nil when the
+// container backend cannot measure volumes.
+func NewMeter(sink Sink, users ActiveContainerLister, storage StorageReporter, opts Options) *Meter {
+	now := time.Now()
+	return &Meter{
+		sink:        sink,
+		users:       users,
+		storage:     storage,
+		opts:        opts,
+		periodStart: now,
+		lastSample:  now,
+		containers:  make(map[string]time.Duration),
+		aiCalls:     make(map[string]int64),
+	}
+}
+
+// RecordAICall counts one AI call of userID. It implements
+// agent.UsageRecorder.
+func (m *Meter) RecordAICall(userID string) {
+	if userID == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.aiCalls[userID]++
+}
+
+// Start samples containers every sample interval and flushes every flush
+// interval until ctx is cancelled. Call Flush on shutdown to emit the
+// period in progress.
+func (m *Meter) Start(ctx context.Context) {
+	sample := time.NewTicker(m.opts.SampleInterval)
+	flush := time.NewTicker(m.opts.FlushInterval)
+	go func() {
+		defer sample.Stop()
+		defer flush.Stop()
+		slog.Info("Usage meter started", "sample_interval", m.opts.SampleInterval, "flush_interval", m.opts.FlushInterval)
+
+		for {
+			select {
+			case <-sample.C:
+				if err := m.Sample(ctx); err != nil {
+					slog.Error("Usage sampling failed", "error", err)
+				}
+			case <-flush.C:
+				if err := m.Flush(ctx); err != nil {
+					slog.Error("Usage flush failed", "error", err)
+				}
+			case <-ctx.Done():
+				slog.Info("Usage meter stopped")
+				return
+			}
+		}
+	}()
+}
+
+// Sample adds the time since the previous sample to every user with a bound
+// container.
+func (m *Meter) Sample(ctx context.Context) error {
+	users, err := m.users.GetActiveContainers(ctx)
+	if err != nil {
+		return fmt.Errorf("list active containers: %w", err)
+	}
+	m.addContainerTime(users, time.Now())
+	return nil
+}
+
+func (m *Meter) addContainerTime(users []*domain.User, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elapsed := min(now.Sub(m.lastSample), maxSampleGap*m.opts.SampleInterval)
+	m.lastSample = now
+	if elapsed <= 0 {
+		return
+	}
+	for _, user := range users {
+		m.containers[user.UserID] += elapsed
+	}
+}
+
+// Flush ends the current period and emits its records, together with those
+// of earlier periods the sink rejected.
+func (m *Meter) Flush(ctx context.Context) error {
+	m.flushMu.Lock()
+	defer m.flushMu.Unlock()
+
+	var storage map[string]int64
+	if m.storage != nil {
+		storageCtx, cancel := context.WithTimeout(ctx, storageTimeout)
+		var err error
+		storage, err = m.storage.VolumeUsage(storageCtx)
+		cancel()
+		if err != nil {
+			// Partial results still bill the hosts that answered.
+			slog.Warn("Failed to measure volume usage", "error", err)
+		}
+	}
+
+	records := m.endPeriod(time.Now(), storage)
+	if len(records) == 0 {
+		return nil
+	}
+	if err := m.sink.Emit(ctx, records); err != nil {
+		m.retry(records)
+		return fmt.Errorf("emit %d usage records: %w", len(records), err)
+	}
+	slog.Info("Usage records emitted", "records", len(records))
+	return nil
+}
+
+// endPeriod closes the current period and returns its records after the
+// pending ones.
+func (m *Meter) endPeriod(end time.Time, storage map[string]int64) []Record {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	start := m.periodStart
+	var records []Record
+	add := func(userID, metric string, quantity int64) {
+		if quantity <= 0 {
+			return
+		}
+		records = append(records, Record{
+			ID:          fmt.Sprintf("%s:%s:%d", userID, metric, start.UnixNano()),
+			UserID:      userID,
+			Metric:      metric,
+			Quantity:    quantity,
+			PeriodStart: start,
+			PeriodEnd:   end,
+		})
+	}
+	for userID, d := range m.containers {
+		add(userID, MetricContainerSeconds, int64(d.Round(time.Second)/time.Second))
+	}
+	for userID, n := range m.aiCalls {
+		add(userID, MetricAICalls, n)
+	}
+	for userID, size := range storage {
+		add(userID, MetricStorageBytes, size)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+
+	m.periodStart = end
+	m.containers = make(map[string]time.Duration)
+	m.aiCalls = make(map[string]int64)
+	records = append(m.pending, records...)
+	m.pending = nil
+	return records
+}
+
+// retry keeps records for the next flush, dropping the oldest beyond
+// maxPendingRecords.
+func (m *Meter) retry(records []Record) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if drop := len(records) - maxPendingRecords; drop > 0 {
+		slog.Warn("Dropping unsent usage records", "records", drop)
+		records = records[drop:]
+	}
+	m.pending = records
+}
@@ -0,0 +1,186 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/domain"
+)
+
+type fakeUsers []*domain.User
+
+func (f fakeUsers) GetActiveContainers(context.Context) ([]*domain.User, error) { return f, nil }
+
+type fakeStorage map[string]int64
+
+func (f fakeStorage) VolumeUsage(context.Context) (map[string]int64, error) { return f, nil }
+
+// recordingSink keeps emitted records and fails while err is set.
+type recordingSink struct {
+	mu      sync.Mutex
+	err     error
+	records []Record
+}
+
+func (s *recordingSink) Emit(_ context.Context, records []Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.records = append(s.records, records...)
+	return nil
+}
+
+func quantities(records []Record) map[string]int64 {
+	q := make(map[string]int64)
+	for _, r := range records {
+		q[r.UserID+"/"+r.Metric] += r.Quantity
+	}
+	return q
+}
+
+func TestMeterAggregatesPerPeriod(t *testing.T) {
+	sink := &recordingSink{err: errors.New("unavailable")}
+	users := fakeUsers{{UserID: "u1"}, {UserID: "u2"}}
+	m := NewMeter(sink, users, fakeStorage{"u1": 4096}, Options{SampleInterval: time.Minute, FlushInterval: time.Hour})
+	start := m.lastSample
+
+	m.addContainerTime(users, start.Add(time.Minute))
+	m.addContainerTime(users[:1], start.Add(2*time.Minute))
+	// A stalled sample is capped at maxSampleGap intervals.
+	m.addContainerTime(users[:1], start.Add(time.Hour))
+	m.RecordAICall("u2")
+	m.RecordAICall("u2")
+	m.RecordAICall("")
+
+	if err := m.Flush(context.Background()); err == nil {
+		t.Fatal("expected the sink error")
+	}
+	sink.err = nil
+	m.RecordAICall("u1")
+	if err := m.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := quantities(sink.records)
+	want := map[string]int64{
+		"u1/container_seconds": 240,
+		"u2/container_seconds": 60,
+		"u1/ai_calls":          1,
+		"u2/ai_calls":          2,
+		"u1/storage_bytes":     2 * 4096, // Measured at the end of each period
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %d, want %d", k, got[k], v)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("unexpected records: %v", got)
+	}
+
+	// The retried period keeps its IDs; the next one gets new ones.
+	ids := make(map[string]int)
+	for _, r := range sink.records {
+		ids[r.ID]++
+	}
+	for id, n := range ids {
+		if n != 1 {
+			t.Errorf("record %s emitted %d times", id, n)
+		}
+	}
+}
+
+func TestFileSinkAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage", "usage.ndjson")
+	sink := &FileSink{Path: path}
+	for i := 0; i < 2; i++ {
+		if err := sink.Emit(context.Background(), []Record{{ID: "a", UserID: "u1", Metric: MetricAICalls, Quantity: 1}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Fatalf("expected 2 lines, got %q", data)
+	}
+}
+
+func TestWebhookSinkSigns(t *testing.T) {
+	var body []byte
+	var signature string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+	}))
+	defer srv.Close()
+
+	sink := &WebhookSink{URL: srv.URL, Secret: "s3cret"}
+	if err := sink.Emit(context.Background(), []Record{{ID: "a", UserID: "u1", Metric: MetricAICalls, Quantity: 3}}); err != nil {
+		t.Fatal(err)
+	}
+	var batch struct{ Records []Record }
+	if err := json.Unmarshal(body, &batch); err != nil || len(batch.Records) != 1 || batch.Records[0].Quantity != 3 {
+		t.Fatalf("unexpected body %s: %v", body, err)
+	}
+	if signature != Sign("s3cret", body) {
+		t.Fatalf("bad signature %q", signature)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	if err := (&WebhookSink{URL: failing.URL}).Emit(context.Background(), nil); !errors.Is(err, errSinkStatus) {
+		t.Fatalf("expected rejection, got %v", err)
+	}
+}
+
+func TestStripeSinkSendsMeterEvents(t *testing.T) {
+	var events []url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = r.ParseForm()
+		events = append(events, r.PostForm)
+	}))
+	defer srv.Close()
+
+	customers := filepath.Join(t.TempDir(), "customers.json")
+	if err := os.WriteFile(customers, []byte(`{"u1":"cus_123"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sink := &StripeSink{Key: "sk_test", Customers: customers, EventPrefix: "shsh_", URL: srv.URL}
+	end := time.Unix(1700000000, 0)
+	err := sink.Emit(context.Background(), []Record{
+		{ID: "u1:container_seconds:1", UserID: "u1", Metric: MetricContainerSeconds, Quantity: 3600, PeriodEnd: end},
+		{ID: "u2:ai_calls:1", UserID: "u2", Metric: MetricAICalls, Quantity: 1, PeriodEnd: end},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected one event for the known customer, got %d", len(events))
+	}
+	e := events[0]
+	if e.Get("event_name") != "shsh_container_seconds" || e.Get("identifier") != "u1:container_seconds:1" ||
+		e.Get("payload[stripe_customer_id]") != "cus_123" || e.Get("payload[value]") != "3600" || e.Get("timestamp") != "1700000000" {
+		t.Fatalf("unexpected meter event %v", e)
+	}
+}
@@ -40,6 +40,7 @@ class AgentState(TypedDict):
     pwd: str
     exit_code: int
     output: str
+    container_context: str  # Container snapshot for chat, "" if none
 
     # --- Memory ---
     messages: Annotated[list, add_messages]
@@ -172,8 +173,8 @@ class GraphBuilder:
         # LLM Logic
 
         # 4. LLM Generation
-        if not self.settings.enable_llm or state["exit_code"] == 0:
-            # Default to silent if success and no LLM or pattern
+        if not self.settings.enable_llm or state["exit_code"] <= 0:
+            # Default to silent if success (or unknown) and no LLM or pattern
             return {
                 "routing_outcome": "silent",
                 "response": PipelineResponse(type="silent", silent=True)
@@ -254,6 +255,8 @@ class GraphBuilder:
         history_messages = state.get("messages", [])[:-1] if state.get("messages") else []
 
         system_prompt = self.llm_client.build_system_prompt()
+        if state.get("container_context"):
+            system_prompt = f"{system_prompt}\n\n{state['container_context']}"
         (
             system_prompt,
             history,
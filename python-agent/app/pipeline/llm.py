@@ -11,6 +11,7 @@ from langchain_core.messages import AIMessage, HumanMessage, SystemMessage
 from langchain_core.runnables import RunnableConfig
 
 from app.config import Settings
+from app.pipeline.types import EXIT_CODE_UNKNOWN
 
 logger = logging.getLogger(__name__)
 
@@ -345,11 +346,36 @@ class LLMClient:
             "Keep it SHORT."
         )
 
+    def build_container_context(self, state: Any) -> str:
+        """Format a ContainerState snapshot for the chat system prompt.
+
+        Returns an empty string when there is no snapshot or it is empty.
+        """
+        if state is None:
+            return ""
+        parts = []
+        if state.uptime:
+            parts.append(f"Container {state.uptime}.")
+        for title, text in (
+            ("Current directory (ls -la)", state.working_dir),
+            ("Processes", state.processes),
+            ("Disk usage (df -h)", state.disk_usage),
+            ("Environment", state.environment),
+        ):
+            if text.strip():
+                parts.append(f"{title}:\n```\n{text.strip()}\n```")
+        if not parts:
+            return ""
+        return (
+            "The learner's container right now; use it instead of guessing:\n\n"
+            + "\n\n".join(parts)
+        )
+
     def build_terminal_prompt(self, command: str, pwd: str, exit_code: int, output: str) -> str:
         return (
             f"Current directory: {pwd}\n"
             f"Command: `{command}`\n"
-            f"Exit code: {exit_code}\n"
+            f"Exit code: {'unknown' if exit_code == EXIT_CODE_UNKNOWN else exit_code}\n"
             f"Output:\n```\n{output}\n```\n"
             "Explain what happened and the next best command."
         )
@@ -68,7 +68,8 @@ class SilenceChecker:
         Returns:
             SilenceDecision indicating whether to be silent and why.
         """
-        has_error = input_data.exit_code != 0
+        # An unknown exit code is not evidence of an error.
+        has_error = input_data.exit_code > 0
 
         if session and session.in_editor_mode:
             return SilenceDecision(True, SilenceReason.IN_EDITOR_MODE.value)
@@ -2,6 +2,10 @@
 
 from dataclasses import dataclass, field
 
+# Sent as exit_code when the shell did not report one (e.g. the terminal
+# lacks OSC 133 support). Treat it as neither success nor failure.
+EXIT_CODE_UNKNOWN = -1
+
 
 @dataclass(slots=True)
 class PipelineResponse:
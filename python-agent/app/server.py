@@ -76,6 +76,7 @@ class AgentServicer(agent_pb2_grpc.AgentServiceServicer):
         pwd: str = "",
         exit_code: int = 0,
         output: str = "",
+        container_context: str = "",
         messages: Optional[list] = None,
     ) -> AgentState:
         """Build an AgentState dictionary with common defaults."""
@@ -86,6 +87,7 @@ class AgentServicer(agent_pb2_grpc.AgentServiceServicer):
             "pwd": pwd,
             "exit_code": exit_code,
             "output": output,
+            "container_context": container_context,
             "messages": messages if messages is not None else [],
             "summary": "",
             "session": session,
@@ -133,6 +135,9 @@ class AgentServicer(agent_pb2_grpc.AgentServiceServicer):
                 user_id=user_id,
                 session_id=session_id,
                 session=session,
+                container_context=self.llm_client.build_container_context(
+                    getattr(request, "container_state", None)
+                ),
                 messages=[ensure_message_id(HumanMessage(content=request.message))],
             )
 
@@ -57,6 +57,7 @@ def _base_state(**kwargs) -> AgentState:
         "pwd": "/home/user",
         "exit_code": 0,
         "output": "",
+        "container_context": "",
         "messages": [],
         "summary": "",
         "session": SessionState(user_id="user-1"),
@@ -177,6 +178,22 @@ class TestChatFlow:
         assert len(result["messages"]) == 4
         assert mock_llm_client.generate.called
 
+    @pytest.mark.asyncio
+    async def test_chat_adds_container_context_to_system_prompt(
+        self, graph_builder: GraphBuilder, mock_llm_client: MagicMock
+    ) -> None:
+        app = graph_builder.build_chat_graph().compile()
+        state = _base_state(
+            container_context="Disk usage (df -h):\n/dev/sda1 100%",
+            messages=[HumanMessage(content="Why can't I save my file?")],
+        )
+
+        await app.ainvoke(state)
+
+        system_prompt = mock_llm_client.generate.call_args.kwargs["system_prompt"]
+        assert system_prompt.startswith("system")
+        assert "/dev/sda1 100%" in system_prompt
+
     @pytest.mark.asyncio
     async def test_chat_compacts_history_when_token_budget_exceeded(
         self, graph_builder: GraphBuilder, mock_llm_client: MagicMock
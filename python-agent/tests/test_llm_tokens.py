@@ -73,3 +73,24 @@ async def test_generate_accepts_callback_manager_in_run_config() -> None:
 
     assert result.error is None
     assert result.response == "ok"
+
+
+def test_build_container_context_skips_empty_parts() -> None:
+    client = LLMClient(model=None, settings=Settings(enable_llm=False))
+    state = SimpleNamespace(
+        processes="",
+        disk_usage="Filesystem Size Used\n/dev/sda1 10G 10G",
+        environment="",
+        uptime="up 5m",
+        working_dir="  ",
+    )
+
+    context = client.build_container_context(state)
+
+    assert "Container up 5m." in context
+    assert "/dev/sda1 10G 10G" in context
+    assert "Processes" not in context
+    assert "Current directory" not in context
+    assert client.build_container_context(None) == ""
+    empty = SimpleNamespace(processes="", disk_usage="", environment="", uptime="", working_dir="")
+    assert client.build_container_context(empty) == ""
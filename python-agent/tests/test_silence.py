@@ -5,6 +5,7 @@ from datetime import datetime, timedelta, timezone
 import pytest
 
 from app.pipeline.silence import SessionState, SilenceChecker, SilenceReason, TerminalInput
+from app.pipeline.types import EXIT_CODE_UNKNOWN
 
 
 @pytest.fixture
@@ -56,6 +57,14 @@ class TestSilenceChecker:
         assert decision.silent is False
         assert decision.reason == SilenceReason.MAY_SPEAK.value
 
+    def test_silence_safe_exploration_with_unknown_exit(self, checker, session, terminal_input):
+        # An unknown exit code is not treated as an error
+        terminal_input.command = "cat /var/log/auth.log"
+        terminal_input.exit_code = EXIT_CODE_UNKNOWN
+        decision = checker.check(session, terminal_input)
+        assert decision.silent is True
+        assert decision.reason == SilenceReason.SAFE_EXPLORATION.value
+
     def test_silence_cooldown_active(self, checker, session, terminal_input):
         terminal_input.command = "unknown_command"  # Not a safe command
         terminal_input.exit_code = 0  # Success? weird but let's assume
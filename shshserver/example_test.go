@@ -0,0 +1,69 @@
+package shshserver_test
+
+import (
+	"context"
+	"iter"
+	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
+
+	"github.com/ashureev/shsh-labs/shshserver"
+)
+
+// echoProcessor is a Processor that answers chat by echoing the message and
+// leaves terminal commands alone.
+type echoProcessor struct{}
+
+func (echoProcessor) ProcessTerminalInput(context.Context, shshserver.TerminalInput) iter.Seq2[*shshserver.Response, error] {
+	return func(func(*shshserver.Response, error) bool) {}
+}
+
+func (echoProcessor) Chat(_ context.Context, req shshserver.ChatRequest) iter.Seq2[*shshserver.ChatResponse, error] {
+	return func(yield func(*shshserver.ChatResponse, error) bool) {
+		yield(&shshserver.ChatResponse{Response: "You said: " + req.Message}, nil)
+	}
+}
+
+func (echoProcessor) UpdateSessionSignals(context.Context, shshserver.SessionSignalRequest) error {
+	return nil
+}
+
+func (echoProcessor) ResetSession(context.Context, string, string) error { return nil }
+
+func (echoProcessor) GetStats() shshserver.ProcessorStats { return shshserver.ProcessorStats{} }
+
+func (echoProcessor) Close() {}
+
+// Embedding the playground under /lab/ of another program's mux, with its
+// own tutor in place of the Python agent.
+func ExampleNew() {
+	cfg, err := shshserver.LoadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv, err := shshserver.New(cfg,
+		shshserver.WithProcessor(echoProcessor{}),
+		shshserver.WithFrontend(nil),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+	srv.Start(ctx)
+
+	mux := http.NewServeMux()
+	mux.Handle("/lab/", http.StripPrefix("/lab", srv.Handler()))
+	httpSrv := &http.Server{Addr: ":8080", Handler: mux}
+	httpSrv.RegisterOnShutdown(srv.CloseStreams)
+	go func() {
+		<-ctx.Done()
+		_ = httpSrv.Shutdown(context.Background())
+	}()
+	if err := httpSrv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	srv.Shutdown(context.Background())
+}
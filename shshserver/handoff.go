@@ -0,0 +1,69 @@
+package shshserver
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/handoff"
+)
+
+// resumeHandoff takes over the state the previous process left on shutdown.
+// It must run before the server accepts requests.
+func (s *Server) resumeHandoff(ctx context.Context) {
+	cfg := s.cfg
+	if cfg.Handoff.File == "" {
+		return
+	}
+	state, err := handoff.Consume(cfg.Handoff.File, cfg.InstanceID, cfg.Handoff.MaxAge, time.Now())
+	if errors.Is(err, handoff.ErrStale) {
+		slog.Info("Ignoring handoff state", "reason", err)
+		return
+	}
+	if err != nil {
+		slog.Warn("Failed to read handoff state", "error", err)
+		return
+	}
+	if state == nil {
+		return
+	}
+
+	s.wsHandler.ResumeUsers(ctx, state.Users)
+	s.challengeHandler.ResumeSudoGrants(ctx, state.SudoGrants)
+	if s.agentHandler != nil {
+		s.agentHandler.ResumeEventStreams(state.EventStreams)
+	}
+	slog.Info("Resumed from handoff state",
+		"written_at", state.WrittenAt,
+		"users", len(state.Users),
+		"sudo_grants", len(state.SudoGrants),
+		"event_streams", len(state.EventStreams.Sessions))
+}
+
+// writeHandoff leaves the process's state for the one replacing it. It must
+// run after the server stopped accepting requests.
+func (s *Server) writeHandoff(ctx context.Context) {
+	cfg := s.cfg
+	if cfg.Handoff.File == "" {
+		return
+	}
+	state := &handoff.State{
+		InstanceID: cfg.InstanceID,
+		WrittenAt:  time.Now(),
+		Users:      s.wsHandler.ConnectedUsers(ctx),
+		SudoGrants: s.challengeHandler.SudoGrants(),
+	}
+	if s.agentHandler != nil {
+		state.EventStreams = s.agentHandler.EventStreamState()
+	}
+	if err := handoff.Write(cfg.Handoff.File, state); err != nil {
+		slog.Error("Failed to write handoff state", "error", err)
+		return
+	}
+	slog.Info("Wrote handoff state",
+		"file", cfg.Handoff.File,
+		"users", len(state.Users),
+		"sudo_grants", len(state.SudoGrants),
+		"event_streams", len(state.EventStreams.Sessions))
+}
@@ -0,0 +1,267 @@
+package shshserver_test
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/ashureev/shsh-labs/shshserver"
+	"github.com/docker/docker/client"
+)
+
+// stubRepository and stubManager implement the storage and container
+// interfaces from outside the module's internal packages, the way an
+// embedding program would. They fail to compile if a signature names a type
+// shshserver does not re-export.
+var (
+	_ shshserver.Repository = stubRepository{}
+	_ shshserver.Manager    = stubManager{}
+)
+
+type stubRepository struct{}
+
+func (stubRepository) AggregateCommandStats(ctx context.Context) (int64, error) { return 0, nil }
+
+func (stubRepository) CleanupExpiredSessions(ctx context.Context, ttl time.Duration) (int64, error) {
+	return 0, nil
+}
+
+func (stubRepository) Close() error { return nil }
+
+func (stubRepository) CompleteChallenge(ctx context.Context, c *shshserver.ChallengeCompletion) (bool, error) {
+	return false, nil
+}
+
+func (stubRepository) CountUnreadNotifications(ctx context.Context, userID string) (int, error) {
+	return 0, nil
+}
+
+func (stubRepository) CreateNotification(ctx context.Context, n *shshserver.Notification) error {
+	return nil
+}
+
+func (stubRepository) CreateSessionShare(ctx context.Context, share *shshserver.SessionShare) error {
+	return nil
+}
+
+func (stubRepository) DeleteAgentSession(ctx context.Context, userID string, sessionID string) error {
+	return nil
+}
+
+func (stubRepository) DeleteAgentSessions(ctx context.Context, userID string) error { return nil }
+
+func (stubRepository) DeleteLegacyLocalState(ctx context.Context) (usersDeleted int64, agentSessionsDeleted int64, err error) {
+	return 0, 0, nil
+}
+
+func (stubRepository) DeleteSessionShare(ctx context.Context, userID string, token string) (bool, error) {
+	return false, nil
+}
+
+func (stubRepository) DeleteSnippet(ctx context.Context, userID string, name string) (bool, error) {
+	return false, nil
+}
+
+func (stubRepository) DequeueProvision(ctx context.Context, userID string) error { return nil }
+
+func (stubRepository) EnqueueProvision(ctx context.Context, userID string, enqueuedAt time.Time) error {
+	return nil
+}
+
+func (stubRepository) ExportUserData(ctx context.Context, userID string) (*shshserver.UserDataExport, error) {
+	return nil, nil
+}
+
+func (stubRepository) GetActiveContainers(ctx context.Context) ([]*shshserver.User, error) {
+	return nil, nil
+}
+
+func (stubRepository) GetAgentSession(ctx context.Context, userID string, sessionID string) (*shshserver.AgentSession, error) {
+	return nil, nil
+}
+
+func (stubRepository) GetExpiredSessions(ctx context.Context, ttl time.Duration) ([]*shshserver.User, error) {
+	return nil, nil
+}
+
+func (stubRepository) GetSessionShare(ctx context.Context, token string) (*shshserver.SessionShare, error) {
+	return nil, nil
+}
+
+func (stubRepository) GetUser(ctx context.Context, userID string) (*shshserver.User, error) {
+	return nil, nil
+}
+
+func (stubRepository) HealthDetails(ctx context.Context) (*shshserver.HealthDetails, error) {
+	return nil, nil
+}
+
+func (stubRepository) InsertChallengeAttempt(ctx context.Context, a *shshserver.ChallengeAttempt) error {
+	return nil
+}
+
+func (stubRepository) InsertCommand(ctx context.Context, c *shshserver.CommandRecord) error {
+	return nil
+}
+
+func (stubRepository) InsertContainerEvent(ctx context.Context, e *shshserver.ContainerEvent) error {
+	return nil
+}
+
+func (stubRepository) InsertIntervention(ctx context.Context, i *shshserver.Intervention) error {
+	return nil
+}
+
+func (stubRepository) ListAgentSessions(ctx context.Context, userID string) ([]*shshserver.AgentSession, error) {
+	return nil, nil
+}
+
+func (stubRepository) ListArchivedSessions(ctx context.Context, userID string) ([]*shshserver.ArchivedAgentSession, error) {
+	return nil, nil
+}
+
+func (stubRepository) ListChallengeAssignments(ctx context.Context, userID string) ([]*shshserver.ChallengeAssignment, error) {
+	return nil, nil
+}
+
+func (stubRepository) ListChallengeAttempts(ctx context.Context, userID string, challengeID string) ([]*shshserver.ChallengeAttempt, error) {
+	return nil, nil
+}
+
+func (stubRepository) ListChallengeCheckpoints(ctx context.Context, userID string, challengeID string) ([]*shshserver.ChallengeCheckpoint, error) {
+	return nil, nil
+}
+
+func (stubRepository) ListChallengeCompletions(ctx context.Context, userID string) ([]*shshserver.ChallengeCompletion, error) {
+	return nil, nil
+}
+
+func (stubRepository) ListCommands(ctx context.Context, userID string, sessionID string, limit int) ([]*shshserver.CommandRecord, error) {
+	return nil, nil
+}
+
+func (stubRepository) ListContainerEvents(ctx context.Context, userID string, limit int) ([]*shshserver.ContainerEvent, error) {
+	return nil, nil
+}
+
+func (stubRepository) ListDailyCommandStats(ctx context.Context, userID string, since time.Time) ([]*shshserver.DailyCommandStats, error) {
+	return nil, nil
+}
+
+func (stubRepository) ListInterventionStats(ctx context.Context, since time.Time) ([]*shshserver.InterventionStats, error) {
+	return nil, nil
+}
+
+func (stubRepository) ListKeptWarmUsers(ctx context.Context, now time.Time) ([]*shshserver.User, error) {
+	return nil, nil
+}
+
+func (stubRepository) ListNotifications(ctx context.Context, userID string, unreadOnly bool, limit int) ([]*shshserver.Notification, error) {
+	return nil, nil
+}
+
+func (stubRepository) ListProvisionQueue(ctx context.Context) ([]string, error) { return nil, nil }
+
+func (stubRepository) ListSessionShares(ctx context.Context, userID string) ([]*shshserver.SessionShare, error) {
+	return nil, nil
+}
+
+func (stubRepository) ListSnippets(ctx context.Context, userID string) ([]*shshserver.Snippet, error) {
+	return nil, nil
+}
+
+func (stubRepository) MarkNotificationsRead(ctx context.Context, userID string, ids []int64, readAt time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (stubRepository) Ping(ctx context.Context) error { return nil }
+
+func (stubRepository) PruneArchivedSessions(ctx context.Context, retention time.Duration) (int64, error) {
+	return 0, nil
+}
+
+func (stubRepository) PruneContainerEvents(ctx context.Context, retention time.Duration) (int64, error) {
+	return 0, nil
+}
+
+func (stubRepository) PruneExpiredSessionShares(ctx context.Context) (int64, error) { return 0, nil }
+
+func (stubRepository) PurgeUser(ctx context.Context, userID string) error { return nil }
+
+func (stubRepository) ReserveEventIDs(ctx context.Context, userID string, sessionID string, n int64) (int64, error) {
+	return 0, nil
+}
+
+func (stubRepository) SetClassroom(ctx context.Context, userID string, classroom string) error {
+	return nil
+}
+
+func (stubRepository) SetKeepWarm(ctx context.Context, userID string, until time.Time) error {
+	return nil
+}
+
+func (stubRepository) SetResourceTier(ctx context.Context, userID string, tier string) error {
+	return nil
+}
+
+func (stubRepository) UpdateContainerID(ctx context.Context, userID string, containerID string, expectedID string) error {
+	return nil
+}
+
+func (stubRepository) UpdateInstanceID(ctx context.Context, userID string, instanceID string) error {
+	return nil
+}
+
+func (stubRepository) UpdateLastSeen(ctx context.Context, userID string, lastSeen time.Time) error {
+	return nil
+}
+
+func (stubRepository) UpsertAgentSession(ctx context.Context, session *shshserver.AgentSession) error {
+	return nil
+}
+
+func (stubRepository) UpsertChallengeAssignment(ctx context.Context, a *shshserver.ChallengeAssignment) error {
+	return nil
+}
+
+func (stubRepository) UpsertChallengeCheckpoint(ctx context.Context, c *shshserver.ChallengeCheckpoint) error {
+	return nil
+}
+
+func (stubRepository) UpsertSnippet(ctx context.Context, snippet *shshserver.Snippet) error {
+	return nil
+}
+
+func (stubRepository) UpsertUser(ctx context.Context, user *shshserver.User) error { return nil }
+
+type stubManager struct{}
+
+func (stubManager) Client() *client.Client { return nil }
+
+func (stubManager) CreateExecSession(ctx context.Context, containerID string) (string, io.ReadWriteCloser, error) {
+	return "", nil, nil
+}
+
+func (stubManager) EnsureContainer(ctx context.Context, userID string, currentContainerID string, image string, lastSeenAt time.Time, env map[string]string) (string, error) {
+	return "", nil
+}
+
+func (stubManager) EnsureNetwork(ctx context.Context) (string, error) { return "", nil }
+
+func (stubManager) IsRunning(ctx context.Context, containerID string) (bool, error) {
+	return false, nil
+}
+
+func (stubManager) ProbeContainer(ctx context.Context, containerID string) error { return nil }
+
+func (stubManager) ReapOrphans(ctx context.Context, exists shshserver.OwnerLookup, grace time.Duration) (shshserver.ReapResult, error) {
+	return shshserver.ReapResult{}, nil
+}
+
+func (stubManager) ResizeExecSession(ctx context.Context, execID string, cols uint, rows uint) error {
+	return nil
+}
+
+func (stubManager) Runtime() shshserver.RuntimeStatus { return shshserver.RuntimeStatus{} }
+
+func (stubManager) StopContainer(ctx context.Context, containerID string) error { return nil }
@@ -0,0 +1,727 @@
+// Package shshserver embeds the playground in another Go program: learner
+// containers, the terminal WebSocket with its command monitor, and the
+// tutoring agent, served from one http.Handler.
+//
+// The cmd/server binary is a thin wrapper around this package. A program
+// embedding it loads or builds a Config, creates a Server and mounts its
+// handler:
+//
+//	cfg, err := shshserver.LoadConfig()
+//	...
+//	srv, err := shshserver.New(cfg, shshserver.WithProcessor(myAgent))
+//	...
+//	srv.Start(ctx)
+//	defer srv.Shutdown(context.Background())
+//	http.ListenAndServe(":8080", srv.Handler())
+//
+// By default the server opens the repository and container backend cfg
+// selects; WithRepository and WithManager plug in others. Without a
+// Processor the terminal works but the AI features are off.
+package shshserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ashureev/shsh-labs/internal/affinity"
+	"github.com/ashureev/shsh-labs/internal/agent"
+	"github.com/ashureev/shsh-labs/internal/api"
+	"github.com/ashureev/shsh-labs/internal/broker"
+	"github.com/ashureev/shsh-labs/internal/config"
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/curriculum"
+	"github.com/ashureev/shsh-labs/internal/identity"
+	"github.com/ashureev/shsh-labs/internal/middleware"
+	"github.com/ashureev/shsh-labs/internal/session"
+	"github.com/ashureev/shsh-labs/internal/store"
+	"github.com/ashureev/shsh-labs/internal/terminal"
+	"github.com/ashureev/shsh-labs/internal/terminal/demo"
+	"github.com/ashureev/shsh-labs/internal/usage"
+	"github.com/ashureev/shsh-labs/web"
+	"github.com/go-chi/chi/v5"
+	chiMiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+type (
+	// Config is the server configuration, as loaded from the environment by
+	// LoadConfig.
+	Config = config.Config
+	// Repository stores users, sessions and command history.
+	Repository = store.Repository
+	// Processor analyzes terminal commands and answers chat messages; the
+	// gRPC client of the Python agent is one.
+	Processor = agent.Processor
+	// Manager runs learner containers.
+	Manager = container.Manager
+)
+
+// LoadConfig loads and validates the configuration from the environment.
+func LoadConfig() (*Config, error) {
+	return config.Load()
+}
+
+// NewGrpcProcessor connects to the Python agent service at addr.
+func NewGrpcProcessor(addr string, logger *slog.Logger) (Processor, error) {
+	return agent.NewGrpcClient(addr, logger)
+}
+
+// Option configures a Server.
+type Option func(*options)
+
+type options struct {
+	repo      Repository
+	mgr       Manager
+	processor Processor
+	logger    *slog.Logger
+	frontend  http.Handler
+	noUI      bool
+}
+
+// WithRepository makes the server store its data in repo instead of the
+// database cfg selects. repo is used as is and stays open after Shutdown.
+func WithRepository(repo Repository) Option {
+	return func(o *options) { o.repo = repo }
+}
+
+// WithManager makes the server run containers with mgr instead of the
+// backend cfg selects.
+func WithManager(mgr Manager) Option {
+	return func(o *options) { o.mgr = mgr }
+}
+
+// WithProcessor enables the AI features, with p analyzing commands and
+// answering chat. The server closes p on Shutdown, or when New fails.
+func WithProcessor(p Processor) Option {
+	return func(o *options) { o.processor = p }
+}
+
+// WithLogger sets the logger of the terminal monitor and agent. It defaults
+// to slog.Default().
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) { o.logger = logger }
+}
+
+// WithFrontend serves h for every path the API does not handle, instead of
+// the embedded frontend. A nil h serves nothing there, for programs that
+// mount Handler below their own routes.
+func WithFrontend(h http.Handler) Option {
+	return func(o *options) {
+		o.frontend = h
+		o.noUI = h == nil
+	}
+}
+
+// Server is an embeddable playground server.
+type Server struct {
+	cfg    *Config
+	logger *slog.Logger
+	repo   Repository
+	mgr    Manager
+	router chi.Router
+
+	backuper   store.Backuper
+	maintainer store.Maintainer
+
+	sm                  *terminal.SessionManager
+	activity            *terminal.ActivityTracker
+	wsHandler           *terminal.WebSocketHandler
+	containerHandler    *api.ContainerHandler
+	challengeHandler    *api.ChallengeHandler
+	agentHandler        *agent.Handler
+	terminalMonitor     *terminal.Monitor
+	commandRecorder     *terminal.CommandRecorder
+	interventionTracker *terminal.InterventionTracker
+	catalog             *curriculum.Catalog
+	imageBuilder        *container.Builder
+	usageMeter          *usage.Meter
+
+	// closers release what New opened, in reverse order.
+	closers []func()
+}
+
+// New creates a server from cfg. It connects to the repository and
+// container backend, but starts no background work until Start.
+func New(cfg *Config, opts ...Option) (_ *Server, err error) {
+	o := options{logger: slog.Default()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	s := &Server{cfg: cfg, logger: o.logger}
+	defer func() {
+		if err != nil {
+			s.close()
+			if s.agentHandler == nil && o.processor != nil {
+				o.processor.Close()
+			}
+		}
+	}()
+
+	if err := s.openRepository(o.repo); err != nil {
+		return nil, err
+	}
+	if err := s.openManager(o.mgr); err != nil {
+		return nil, err
+	}
+	if err := s.wire(o); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// openRepository opens the database cfg selects, unless repo is given.
+func (s *Server) openRepository(repo Repository) error {
+	cfg := s.cfg
+	if repo == nil {
+		var err error
+		switch cfg.Database.Driver {
+		case config.DBDriverPostgres:
+			repo, err = store.NewPostgres(cfg.Database.URL, store.PoolOptions{
+				MaxOpenConns:    cfg.Database.MaxOpenConns,
+				MaxIdleConns:    cfg.Database.MaxIdleConns,
+				ConnMaxLifetime: cfg.Database.ConnMaxLifetime,
+			})
+		case config.DBDriverRedis:
+			repo, err = store.NewRedis(store.RedisOptions{
+				URL:          cfg.Database.RedisURL,
+				Password:     cfg.Database.RedisPassword,
+				DB:           cfg.Database.RedisDB,
+				SessionTTL:   cfg.Database.RedisSessionTTL,
+				MaxIdleConns: cfg.Database.MaxIdleConns,
+			})
+		default:
+			restored, restoreErr := store.RestoreSQLite(cfg.DBPath, cfg.Database.BackupDir)
+			if restoreErr != nil {
+				slog.Error("Failed to restore database from backup", "error", restoreErr)
+			} else if restored != "" {
+				slog.Warn("Restored corrupt database from backup", "path", cfg.DBPath, "backup", restored)
+			}
+			repo, err = store.NewSQLite(cfg.DBPath)
+		}
+		if err != nil {
+			return fmt.Errorf("initialize database: %w", err)
+		}
+		s.backuper, _ = repo.(store.Backuper)
+		s.maintainer, _ = repo.(store.Maintainer)
+		opened := repo
+		if repo, err = store.NewEncrypted(opened, cfg.Database.EncryptionKey); err != nil {
+			_ = opened.Close()
+			return fmt.Errorf("initialize database encryption: %w", err)
+		}
+		if repo, err = store.NewCommandLog(repo, cfg.Database.CommandLogDir, cfg.Database.CommandLogSegmentSize); err != nil {
+			_ = opened.Close()
+			return fmt.Errorf("initialize command log: %w", err)
+		}
+		repo = store.NewInstrumented(store.NewUserCache(repo, cfg.Database.UserCacheSize, cfg.Database.UserCacheTTL))
+		s.onClose(func() {
+			if closeErr := repo.Close(); closeErr != nil {
+				slog.Error("Failed to close repository", "error", closeErr)
+			}
+		})
+	}
+	s.repo = repo
+
+	if err := repo.Ping(context.Background()); err != nil {
+		return fmt.Errorf("database health check: %w", err)
+	}
+	slog.Info("Database connected", "driver", cfg.Database.Driver)
+
+	usersDeleted, sessionsDeleted, err := repo.DeleteLegacyLocalState(context.Background())
+	if err != nil {
+		return fmt.Errorf("cleanup legacy local state: %w", err)
+	}
+	slog.Info("Legacy local state cleanup complete", "users_deleted", usersDeleted, "agent_sessions_deleted", sessionsDeleted)
+	return nil
+}
+
+// openManager connects to the container backend cfg selects, unless mgr is
+// given, and ensures the playground network exists.
+func (s *Server) openManager(mgr Manager) error {
+	cfg := s.cfg
+	if mgr == nil {
+		var err error
+		switch {
+		case cfg.Container.Backend == config.ContainerBackendKubernetes:
+			mgr, err = container.NewKubernetesManagerWithConfig(cfg)
+		case cfg.Container.Backend == config.ContainerBackendPodman:
+			mgr, err = container.NewPodmanManagerWithConfig(cfg)
+		case len(cfg.Container.Hosts) > 0:
+			mgr, err = container.NewPoolManagerWithConfig(cfg)
+		default:
+			mgr, err = container.NewDockerManagerWithConfig(cfg)
+		}
+		if err != nil {
+			return fmt.Errorf("initialize container manager: %w", err)
+		}
+	}
+	if auditor, ok := mgr.(container.EventAuditor); ok {
+		auditor.SetEventRecorder(s.repo)
+	}
+	s.mgr = mgr
+	slog.Info("Container manager initialized")
+
+	// Ensure custom bridge network exists for playground containers.
+	networkID, err := mgr.EnsureNetwork(context.Background())
+	if err != nil {
+		return fmt.Errorf("ensure playground network: %w", err)
+	}
+	slog.Info("Playground network ready", "network_id", networkID)
+	return nil
+}
+
+// wire creates the handlers and the router.
+//
+//nolint:funlen // Wiring is intentionally sequential to keep dependency setup explicit.
+func (s *Server) wire(o options) error {
+	cfg, repo, mgr, logger := s.cfg, s.repo, s.mgr, s.logger
+
+	s.sm = terminal.NewSessionManager()
+
+	baseHandler := api.NewHandler(repo, mgr, s.sm, cfg.FrontendURL)
+	healthHandler := api.NewHealthHandler(repo, api.WithManager(mgr), api.WithConfig(cfg))
+	s.wsHandler = terminal.NewWebSocketHandlerWithConfig(repo, mgr, s.sm, cfg)
+	// Shared by the terminal and agent stream handlers, so a tab's state is
+	// torn down once both of its connections closed.
+	sessions := session.NewLifecycle(logger)
+	s.wsHandler.SetSessionLifecycle(sessions)
+	s.activity = terminal.NewActivityTracker()
+	s.wsHandler.SetActivityTracker(s.activity)
+	if cfg.Broker.Addr != "" {
+		brokerClient, err := broker.NewClient(cfg.Broker.Addr, cfg.Broker.Token, broker.WithTLS(broker.TLSConfig{
+			CertFile: cfg.Broker.TLSCert,
+			KeyFile:  cfg.Broker.TLSKey,
+			CAFile:   cfg.Broker.TLSCA,
+		}))
+		if err != nil {
+			return fmt.Errorf("initialize terminal broker client: %w", err)
+		}
+		s.onClose(func() {
+			if closeErr := brokerClient.Close(); closeErr != nil {
+				slog.Error("Failed to close terminal broker client", "error", closeErr)
+			}
+		})
+		s.wsHandler.SetExecAttacher(brokerClient)
+		slog.Info("Terminal exec attachment delegated to broker", "address", cfg.Broker.Addr)
+	}
+	if cfg.Terminal.E2E {
+		key, err := terminal.ParseE2ESigningKey(cfg.Terminal.E2ESigningKey)
+		if err != nil {
+			return fmt.Errorf("initialize terminal encryption: %w", err)
+		}
+		publicKey, err := terminal.E2EPublicKey(key)
+		if err != nil {
+			return fmt.Errorf("initialize terminal encryption: %w", err)
+		}
+		s.wsHandler.SetE2ESigningKey(key)
+		// The frontend must be built with this key in VITE_TERMINAL_E2E_PUBLIC_KEY.
+		slog.Info("Terminal end-to-end encryption enabled", "public_key", publicKey)
+	}
+
+	var sidebarChan chan *agent.Response
+	var conversationLogger agent.ConversationLogger
+	var aiBudget *agent.Budget
+	if o.processor != nil {
+		// Create channel for Agent responses to sidebar
+		sidebarChan = make(chan *agent.Response, 100)
+
+		var err error
+		conversationLogger, err = agent.NewConversationLogger(agent.ConversationLogConfig{
+			Enabled:       cfg.ConversationLog.Enabled,
+			Dir:           cfg.ConversationLog.Dir,
+			GlobalEnabled: cfg.ConversationLog.GlobalEnabled,
+			GlobalPath:    cfg.ConversationLog.GlobalPath,
+			QueueSize:     cfg.ConversationLog.QueueSize,
+		}, logger)
+		if err != nil {
+			return fmt.Errorf("initialize conversation logger: %w", err)
+		}
+
+		handlerOpts := []agent.HandlerOption{
+			agent.WithConversationLogger(conversationLogger),
+			agent.WithConfig(cfg),
+			agent.WithSessionLifecycle(sessions),
+		}
+		if inspector, ok := mgr.(container.StateInspector); ok {
+			handlerOpts = append(handlerOpts, agent.WithStateInspector(inspector))
+		}
+		s.agentHandler, err = agent.NewHandler(o.processor, repo, sidebarChan, handlerOpts...)
+		if err != nil {
+			return fmt.Errorf("initialize agent handler: %w", err)
+		}
+		s.onClose(s.agentHandler.Close)
+
+		// Degrade AI features instead of waiting on a failing agent.
+		if cfg.AIBudget.Window > 0 {
+			aiBudget = agent.NewBudget(cfg.AIBudget)
+			if cfg.AIBudget.WebhookURL != "" {
+				aiBudget.SetNotifier(agent.NewBudgetWebhook(cfg.AIBudget.WebhookURL))
+			}
+			s.agentHandler.GetService().SetBudget(aiBudget)
+		}
+
+		// Initialize terminal monitor with OSC 133 support and fallback detection
+		s.terminalMonitor = terminal.NewMonitor(s.agentHandler.GetService(), sidebarChan, logger)
+		s.terminalMonitor.SetMaxBufferSize(cfg.Terminal.MaxCapturedOutput)
+		s.terminalMonitor.SetDesktopNotifications(cfg.Terminal.NotifyBell, cfg.Terminal.NotifyAfter)
+		s.terminalMonitor.SetQuietHours(cfg.Terminal.QuietHours, cfg.Terminal.QuietHoursDir)
+		s.wsHandler.SetMonitor(s.terminalMonitor)
+		s.activity.SetMonitor(s.terminalMonitor)
+		slog.Info("Terminal monitor initialized with OSC 133 support")
+	} else {
+		slog.Info("AI features disabled (no agent processor)")
+	}
+	aiEnabled := s.agentHandler != nil
+
+	// Metered usage lets a hosted deployment bill per user.
+	if sink := usage.NewSink(cfg.Usage); sink != nil {
+		storage, _ := mgr.(container.VolumeUsageReporter)
+		if storage == nil {
+			slog.Info("Container backend cannot measure volumes; storage usage is not metered")
+		}
+		s.usageMeter = usage.NewMeter(sink, repo, storage, usage.Options{
+			SampleInterval: cfg.Usage.SampleInterval,
+			FlushInterval:  cfg.Usage.FlushInterval,
+		})
+		if s.agentHandler != nil {
+			s.agentHandler.GetService().SetUsageRecorder(s.usageMeter)
+		}
+	}
+
+	// Create container handler with AI enabled flag, config, and optional agent session reset support.
+	containerOpts := []api.Option{api.WithAI(aiEnabled), api.WithConfig(cfg)}
+	if s.agentHandler != nil {
+		containerOpts = append(containerOpts, api.WithSessionResetter(s.agentHandler.GetService()))
+	}
+	s.containerHandler = api.NewContainerHandler(baseHandler, containerOpts...)
+	if purger, ok := conversationLogger.(agent.ConversationLogPurger); ok {
+		s.containerHandler.SetConversationLogPurger(purger)
+	}
+	if s.terminalMonitor != nil {
+		healthHandler.SetAnalysisReporter(s.terminalMonitor)
+		s.containerHandler.SetQuietHours(s.terminalMonitor)
+	}
+	if aiBudget != nil {
+		healthHandler.SetAIBudgetReporter(aiBudget)
+	}
+
+	var routeRegistry affinity.Registry
+	if cfg.Affinity.RedisAddr != "" {
+		registry, err := affinity.NewRedisRegistry(cfg.Affinity.RedisAddr, cfg.Affinity.KeyTTL)
+		if err != nil {
+			return fmt.Errorf("initialize route registry: %w", err)
+		}
+		routeRegistry = registry
+		s.containerHandler.SetRouteRegistry(routeRegistry)
+		slog.Info("Publishing session routes to Redis", "address", cfg.Affinity.RedisAddr, "instance_id", cfg.InstanceID)
+	}
+	routeHintHandler := api.NewRouteHintHandler(baseHandler, routeRegistry, cfg)
+
+	notificationHandler := api.NewNotificationHandler(baseHandler)
+	pairingHandler := api.NewPairingHandler(baseHandler)
+	clientErrorHandler := api.NewClientErrorHandler(baseHandler, cfg)
+	// Challenges from git curriculum sources are served alongside the
+	// built-in ones; sources are registered through the admin API.
+	s.catalog = curriculum.NewCatalog(curriculum.Embedded(), cfg.Curriculum.Dir, cfg.Curriculum.MaxBundleSize)
+	if err := s.catalog.Load(); err != nil {
+		slog.Warn("Failed to load curriculum sources", "error", err, "dir", cfg.Curriculum.Dir)
+	}
+	s.challengeHandler = api.NewChallengeHandler(baseHandler, curriculum.Embedded(), api.WithConfig(cfg), api.WithCatalog(s.catalog))
+
+	// Admins assign users to classrooms, which pick their terminal banner,
+	// input filter and quiet hours, curriculum and announcements.
+	classrooms := store.NewClassrooms(repo)
+	s.wsHandler.SetClassroomResolver(classrooms)
+	s.challengeHandler.SetClassroomResolver(classrooms)
+	if s.agentHandler != nil {
+		s.agentHandler.SetClassroomResolver(classrooms)
+	}
+
+	ptyController := terminal.NewPTYController(terminal.DefaultPTYConfig(), logger)
+	runHandler := api.NewTerminalRunHandler(baseHandler, ptyController, api.WithConfig(cfg))
+
+	// Instructors record demos from their own terminal through the admin API.
+	demoLibrary := demo.NewLibrary(cfg.Terminal.DemoDir, cfg.Terminal.DemoMaxDuration)
+	s.wsHandler.SetSessionTap(demoLibrary)
+	demoHandler := api.NewDemoHandler(baseHandler, demoLibrary, ptyController)
+
+	// Terminal history is captured by the monitor, so it is only populated when AI is enabled.
+	// Completed commands are persisted so history survives restarts.
+	historyHandler := api.NewHistoryHandler(nil)
+	// Screen-reader summaries come from the same command pipeline.
+	accessibilityHandler := api.NewAccessibilityHandler(nil, cfg)
+	// Hints are judged by the command that follows them.
+	if s.terminalMonitor != nil {
+		s.commandRecorder = terminal.NewCommandRecorder(repo)
+		s.terminalMonitor.AddCommandHook(s.commandRecorder)
+		historyHandler = api.NewPersistentHistoryHandler(repo)
+		accessibilityFeed := terminal.NewAccessibilityFeed()
+		s.terminalMonitor.AddCommandHook(accessibilityFeed)
+		accessibilityHandler = api.NewAccessibilityHandler(accessibilityFeed, cfg)
+		s.interventionTracker = terminal.NewInterventionTracker(repo)
+		s.terminalMonitor.SetInterventionTracker(s.interventionTracker)
+	}
+
+	// Chat rate limits are only reported when AI is enabled.
+	adminHandler := api.NewAdminHandler(baseHandler, cfg)
+	adminHandler.SetDemoLibrary(demoLibrary)
+	adminHandler.SetCurriculum(s.catalog)
+	// Instructors grant learners sudo; learners only see and give up grants.
+	adminHandler.SetSudo(s.challengeHandler)
+	if s.agentHandler != nil {
+		adminHandler.SetBroadcaster(s.agentHandler)
+	}
+	// Challenges can ship their lab's environment as a Dockerfile; the
+	// images are built at startup and rebuilt through the admin API.
+	if b, ok := mgr.(container.ImageBuilder); ok {
+		catalog := s.catalog
+		s.imageBuilder = container.NewBuilder(b, func() []container.BuildSpec {
+			var specs []container.BuildSpec
+			for _, build := range catalog.Builds() {
+				specs = append(specs, container.BuildSpec{Ref: build.Ref, Source: build.Challenge, Context: build.Context})
+			}
+			return specs
+		})
+		adminHandler.SetImageBuilder(s.imageBuilder)
+	}
+	var selfTestAgent *agent.Service
+	if s.agentHandler != nil {
+		selfTestAgent = s.agentHandler.GetService()
+	}
+	adminHandler.SetSelfTest(terminal.NewSelfTest(mgr, selfTestAgent, logger))
+	exportHandler := api.NewExportHandler(baseHandler)
+	fileHandler := api.NewFileHandler(baseHandler, cfg)
+	portForwardHandler := api.NewPortForwardHandler(baseHandler)
+	shareHandler := api.NewShareHandler(baseHandler, cfg)
+	limitsHandler := api.NewLimitsHandler(baseHandler, nil, cfg)
+	if s.agentHandler != nil {
+		limitsHandler = api.NewLimitsHandler(baseHandler, s.agentHandler, cfg)
+	}
+
+	frontend := o.frontend
+	if frontend == nil && !o.noUI {
+		frontend = web.SPAHandler()
+	}
+
+	// Setup router.
+	r := chi.NewRouter()
+
+	// Global middleware.
+	r.Use(chiMiddleware.RequestID)
+	r.Use(chiMiddleware.RealIP)
+	r.Use(chiMiddleware.Logger)
+	r.Use(chiMiddleware.Recoverer)
+	r.Use(middleware.CORS([]string{"*"}))
+
+	// Public routes (no anonymous identity, so health probes don't create users).
+	healthHandler.RegisterHealth(r)
+	adminHandler.RegisterRoutes(r)
+	if cfg.FileAPI {
+		shareHandler.RegisterPublicRoutes(r)
+	}
+
+	// All other routes use identity middleware (no auth needed).
+	r.Group(func(r chi.Router) {
+		r.Use(identity.Middleware(repo, cfg.IsDevelopment()))
+
+		s.containerHandler.RegisterRoutes(r)
+		historyHandler.RegisterRoutes(r)
+		accessibilityHandler.RegisterRoutes(r)
+		runHandler.RegisterRoutes(r)
+		routeHintHandler.RegisterRoutes(r)
+		notificationHandler.RegisterRoutes(r)
+		pairingHandler.RegisterRoutes(r)
+		clientErrorHandler.RegisterRoutes(r)
+		s.challengeHandler.RegisterRoutes(r)
+		limitsHandler.RegisterRoutes(r)
+		// The file browser, export and share hand out the user's files; the
+		// public profile turns them off.
+		if cfg.FileAPI {
+			fileHandler.RegisterRoutes(r)
+			exportHandler.RegisterRoutes(r)
+			shareHandler.RegisterRoutes(r)
+		}
+		demoHandler.RegisterRoutes(r)
+		// Web servers learners start are only shown to the learner, but
+		// still serve arbitrary content; the public profile turns them off.
+		if cfg.PortForward {
+			portForwardHandler.RegisterRoutes(r)
+		}
+
+		// Agent routes (only if AI is enabled)
+		if s.agentHandler != nil {
+			s.agentHandler.RegisterRoutes(r)
+		}
+
+		// WebSocket endpoint.
+		r.Get("/ws/terminal", s.wsHandler.ServeHTTP)
+
+		// Serve the frontend (SPA catch-all).
+		if frontend != nil {
+			r.Handle("/*", frontend)
+		}
+	})
+	s.router = r
+	return nil
+}
+
+// Handler returns the handler serving the API, the terminal WebSocket and,
+// unless disabled with WithFrontend, the frontend.
+func (s *Server) Handler() http.Handler {
+	return s.router
+}
+
+// Start starts the background workers, which run until ctx is cancelled,
+// and takes over the state a previous process handed off. It must be called
+// once, before Handler serves requests.
+func (s *Server) Start(ctx context.Context) {
+	cfg, repo, mgr := s.cfg, s.repo, s.mgr
+
+	onExpire := func(userID string) {
+		s.sm.CloseSession(userID)
+		s.activity.Forget(userID)
+	}
+	container.StartTTLWorkerWithActivity(ctx, repo, mgr, cfg.SessionTTL, onExpire, s.activity, cfg)
+	slog.Info("TTL worker started", "session_ttl", cfg.SessionTTL)
+	onRecycle := func(userID string) {
+		s.sm.CloseSession(userID)
+		s.containerHandler.ForgetRoute(ctx, userID)
+	}
+	container.StartHealthWorkerWithConfig(ctx, repo, mgr, onRecycle, cfg)
+	var recreate container.RecreateFunc
+	if cfg.Container.AutoRecreate {
+		recreate = s.containerHandler.RecreateContainer
+	}
+	container.StartWatchdogWithConfig(ctx, repo, mgr, s.sm.CloseSession, recreate, cfg)
+	container.StartReaperWithConfig(ctx, repo, mgr, cfg)
+	container.StartHostHealthWorkerWithConfig(ctx, mgr, cfg)
+	// Warm the image cache of each host with the playground images and those
+	// of challenge labs, retrying failed pulls; /health is not ready until
+	// they are available. Pool hosts that recover later are warmed as they do.
+	if prePuller, ok := mgr.(container.ImagePrePuller); ok {
+		prePuller.SetImageSource(s.catalog.Images)
+		if cfg.Container.PrePullConcurrency > 0 {
+			container.EnsureImages(ctx, prePuller)
+		}
+	}
+	if s.imageBuilder != nil {
+		if err := s.imageBuilder.Build(ctx, false); err != nil {
+			slog.Warn("Failed to start challenge image builds", "error", err)
+		}
+	}
+	if s.backuper != nil {
+		store.StartBackupWorker(ctx, s.backuper, store.BackupOptions{
+			Dir:      cfg.Database.BackupDir,
+			Interval: cfg.Database.BackupInterval,
+			Retain:   cfg.Database.BackupRetain,
+		})
+	}
+	if s.maintainer != nil {
+		store.StartMaintenanceWorker(ctx, s.maintainer, store.MaintenanceOptions{
+			Interval:    cfg.Database.MaintenanceInterval,
+			WindowStart: cfg.Database.MaintenanceWindow.Start,
+			WindowEnd:   cfg.Database.MaintenanceWindow.End,
+		})
+	}
+	store.StartAnalyticsWorker(ctx, repo, cfg.Database.AnalyticsInterval)
+	s.containerHandler.StartProvisionQueue(ctx)
+	if s.usageMeter != nil {
+		s.usageMeter.Start(ctx)
+	}
+	if cfg.Curriculum.SyncInterval > 0 {
+		s.catalog.Start(ctx, cfg.Curriculum.SyncInterval, cfg.Curriculum.SyncTimeout)
+	}
+	if s.commandRecorder != nil {
+		s.commandRecorder.Start(ctx)
+	}
+	if s.interventionTracker != nil {
+		s.interventionTracker.Start(ctx)
+	}
+	if s.terminalMonitor != nil {
+		s.terminalMonitor.StartAnalysisWatchdog(ctx, cfg.Terminal.AnalysisDeadline)
+	}
+
+	s.resumeHandoff(ctx)
+}
+
+// CloseStreams ends the agent's event streams, which would otherwise hold
+// up an http.Server's shutdown until it times out. Register it with
+// http.Server.RegisterOnShutdown.
+func (s *Server) CloseStreams() {
+	if s.agentHandler != nil {
+		s.agentHandler.CloseStreams()
+	}
+}
+
+// Shutdown hands off the server's state to its successor, emits the last
+// usage records and releases what New opened. It must be called after
+// Handler stopped serving requests.
+func (s *Server) Shutdown(ctx context.Context) {
+	s.writeHandoff(ctx)
+	if s.usageMeter != nil {
+		if err := s.usageMeter.Flush(ctx); err != nil {
+			slog.Error("Failed to emit final usage records", "error", err)
+		}
+	}
+	s.close()
+}
+
+// Run serves on cfg.Port until ctx is cancelled, then shuts down
+// gracefully. It calls Start and Shutdown itself.
+func (s *Server) Run(ctx context.Context) error {
+	// Note: SSE connections require long timeouts (no WriteTimeout)
+	// Keepalive runs every 10s to maintain connection
+	srv := &http.Server{
+		Addr:         ":" + s.cfg.Port,
+		Handler:      s.Handler(),
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 0,                 // 0 = no timeout for SSE support
+		IdleTimeout:  120 * time.Second, // 2 minutes for idle connections
+	}
+	srv.RegisterOnShutdown(s.CloseStreams)
+
+	s.Start(ctx)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Server listening", "addr", srv.Addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+	case err := <-serveErr:
+		s.close()
+		if !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("serve: %w", err)
+		}
+		return nil
+	}
+
+	slog.Info("Shutting down gracefully...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		s.close()
+		return fmt.Errorf("server forced to shutdown: %w", err)
+	}
+	s.Shutdown(shutdownCtx)
+	return nil
+}
+
+// onClose registers f to run when the server is closed.
+func (s *Server) onClose(f func()) {
+	s.closers = append(s.closers, f)
+}
+
+// close releases everything registered with onClose, most recent first.
+func (s *Server) close() {
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		s.closers[i]()
+	}
+	s.closers = nil
+}
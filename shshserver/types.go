@@ -0,0 +1,51 @@
+package shshserver
+
+import (
+	"github.com/ashureev/shsh-labs/internal/agent"
+	"github.com/ashureev/shsh-labs/internal/container"
+	"github.com/ashureev/shsh-labs/internal/domain"
+	"github.com/ashureev/shsh-labs/internal/store"
+)
+
+// Types in the signatures of Processor, so other packages can implement it.
+type (
+	TerminalInput        = agent.TerminalInput
+	Response             = agent.Response
+	ResponseTarget       = agent.Target
+	ChatRequest          = agent.ChatRequest
+	ChatResponse         = agent.ChatResponse
+	SessionSignalRequest = agent.SessionSignalRequest
+	ProcessorStats       = agent.Stats
+)
+
+// ExitCodeUnknown is TerminalInput.ExitCode when the shell did not report
+// the command's status.
+const ExitCodeUnknown = agent.ExitCodeUnknown
+
+// Types in the signatures of Repository, so other packages can implement it.
+type (
+	User                 = domain.User
+	AgentSession         = domain.AgentSession
+	ArchivedAgentSession = domain.ArchivedAgentSession
+	ChallengeAssignment  = domain.ChallengeAssignment
+	ChallengeAttempt     = domain.ChallengeAttempt
+	ChallengeCheckpoint  = domain.ChallengeCheckpoint
+	ChallengeCompletion  = domain.ChallengeCompletion
+	CommandRecord        = domain.CommandRecord
+	ContainerEvent       = domain.ContainerEvent
+	DailyCommandStats    = domain.DailyCommandStats
+	Intervention         = domain.Intervention
+	InterventionStats    = domain.InterventionStats
+	Notification         = domain.Notification
+	SessionShare         = domain.SessionShare
+	Snippet              = domain.Snippet
+	UserDataExport       = domain.UserDataExport
+	HealthDetails        = store.HealthDetails
+)
+
+// Types in the signatures of Manager, so other packages can implement it.
+type (
+	OwnerLookup   = container.OwnerLookup
+	ReapResult    = container.ReapResult
+	RuntimeStatus = container.RuntimeStatus
+)
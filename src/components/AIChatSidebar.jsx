@@ -4,6 +4,7 @@ import remarkGfm from 'remark-gfm';
 import { useAuth } from '../context/AuthContext';
 import { useChatStore } from '../store/chatStore';
 import { useChatUIStore } from '../store/chatUIStore';
+import { reportClientError } from '../errorReporting';
 
 // Role Badge Component
 const RoleBadge = ({ role }) => {
@@ -46,9 +47,10 @@ const RoleBadge = ({ role }) => {
     );
 };
 
-// Code Block with Copy
-const CodeBlock = ({ language, code }) => {
+// Code Block with Copy, and Run for commands the server marked runnable
+const CodeBlock = ({ language, code, command }) => {
     const [copied, setCopied] = useState(false);
+    const runInTerminal = useChatUIStore((state) => state.runInTerminal);
 
     const handleCopy = () => {
         navigator.clipboard.writeText(code);
@@ -56,16 +58,32 @@ const CodeBlock = ({ language, code }) => {
         setTimeout(() => setCopied(false), 2000);
     };
 
+    const handleRun = () => {
+        if (window.confirm(`Run in your terminal?\n\n${command}`)) {
+            runInTerminal(command);
+        }
+    };
+
     return (
         <div className="my-3">
             <div className="flex justify-between items-center px-3 py-1.5 bg-term-black border border-border border-b-0">
                 <span className="text-[10px] text-muted font-mono uppercase">{language || 'bash'}</span>
-                <button
-                    onClick={handleCopy}
-                    className="text-[10px] text-muted hover:text-fg transition-colors"
-                >
-                    {copied ? 'Copied' : 'Copy'}
-                </button>
+                <div className="flex gap-3">
+                    {command && runInTerminal && (
+                        <button
+                            onClick={handleRun}
+                            className="text-[10px] text-muted hover:text-fg transition-colors"
+                        >
+                            Run
+                        </button>
+                    )}
+                    <button
+                        onClick={handleCopy}
+                        className="text-[10px] text-muted hover:text-fg transition-colors"
+                    >
+                        {copied ? 'Copied' : 'Copy'}
+                    </button>
+                </div>
             </div>
             <pre className="bg-term-black p-3 m-0 overflow-x-auto border border-border">
                 <code className="text-xs text-term-cyan font-mono">{code}</code>
@@ -116,7 +134,8 @@ const Message = memo(({ message, isLatest }) => {
                                     const codeStr = String(children).replace(/\n$/, '');
 
                                     if (!inline && match) {
-                                        return <CodeBlock language={match[1]} code={codeStr} />;
+                                        const block = message.codeBlocks?.find((b) => b.runnable && b.code === codeStr);
+                                        return <CodeBlock language={match[1]} code={codeStr} command={block?.command} />;
                                     }
                                     return (
                                         <code
@@ -286,6 +305,7 @@ export const AIChatSidebar = memo(() => {
             const reader = resp.body.getReader();
             const decoder = new TextDecoder();
             let buffer = '';
+            let eventName = 'message';
 
             while (true) {
                 const { done, value } = await reader.read();
@@ -296,14 +316,22 @@ export const AIChatSidebar = memo(() => {
 
                 for (const line of lines) {
                     const trimmed = line.trim();
+                    if (trimmed.startsWith('event:')) {
+                        eventName = trimmed.slice(6).trim();
+                        continue;
+                    }
                     if (!trimmed || !trimmed.startsWith('data:')) continue;
+                    // Error events carry plain text, not JSON.
+                    if (eventName === 'error') continue;
                     try {
                         const data = JSON.parse(trimmed.slice(5));
                         if (data.response) {
                             // Accumulate in ref instead of updating state immediately
                             streamBufferRef.current += data.response;
                         }
-                    } catch { /* ignore */ } 
+                    } catch (err) {
+                        reportClientError('sse_parse', err, { component: 'AIChatSidebar' });
+                    }
                 }
                 if (done) break;
             }
@@ -2,6 +2,7 @@ import React, { memo } from "react";
 import { motion as Motion } from "framer-motion";
 import Terminal from "lucide-react/dist/esm/icons/terminal";
 import Activity from "lucide-react/dist/esm/icons/activity";
+import Clock from "lucide-react/dist/esm/icons/clock";
 import { useAuth } from "../context/AuthContext";
 
 const StatCard = memo(({ label, value, icon }) => {
@@ -42,6 +43,11 @@ const QuickAction = memo(({ title, description, icon, onClick, primary = false }
 export const Dashboard = ({ onStartTerminal }) => {
     const { user } = useAuth();
     const [isLaunching, setIsLaunching] = React.useState(false);
+    // Set by an instructor via the admin API; the session skips TTL cleanup
+    // and chat rate limits until then.
+    const keepWarmUntil = user?.keep_warm_until
+        ? new Date(user.keep_warm_until).toLocaleTimeString([], { hour: "2-digit", minute: "2-digit" })
+        : null;
 
     const handleLaunch = async () => {
         if (isLaunching) return;
@@ -70,6 +76,9 @@ export const Dashboard = ({ onStartTerminal }) => {
                 <div className="grid grid-cols-2 gap-4 mb-16 max-w-md">
                     <StatCard label="Active Status" value={user?.container_id ? "Running" : "Standby"} icon={Activity} />
                     <StatCard label="Environment" value="Ubuntu 22.04 LTS" icon={Terminal} />
+                    {keepWarmUntil && (
+                        <StatCard label="Kept Warm Until" value={keepWarmUntil} icon={Clock} />
+                    )}
                 </div>
 
                 <div className="max-w-2xl">
@@ -0,0 +1,175 @@
+import { useEffect, useRef, useState, useCallback } from 'react';
+import { Terminal } from '@xterm/xterm';
+import { FitAddon } from '@xterm/addon-fit';
+import '@xterm/xterm/css/xterm.css';
+
+// Playback speeds offered for /api/demos/{name}/play (clamped server-side).
+const SPEEDS = [0.5, 1, 2, 4];
+
+// Replays instructor demos from /api/demos into a read-only terminal pane,
+// either in full or one recorded command at a time.
+export const DemoPlayer = ({ theme, onClose }) => {
+    const paneRef = useRef(null);
+    const termRef = useRef(null);
+    const sourceRef = useRef(null);
+
+    const [demos, setDemos] = useState([]);
+    const [demo, setDemo] = useState(null);
+    const [nextStep, setNextStep] = useState(0);
+    const [playing, setPlaying] = useState(false);
+    const [speed, setSpeed] = useState(1);
+    const [error, setError] = useState(null);
+
+    useEffect(() => {
+        fetch('/api/demos', { credentials: 'include' })
+            .then(res => (res.ok ? res.json() : Promise.reject(res.status)))
+            .then(data => setDemos(data.demos || []))
+            .catch(() => setError('Could not load demos.'));
+    }, []);
+
+    useEffect(() => {
+        if (!demo || !paneRef.current) return undefined;
+        const term = new Terminal({
+            theme,
+            fontFamily: '"JetBrains Mono", monospace',
+            fontSize: 13,
+            lineHeight: 1.4,
+            disableStdin: true,
+            cursorBlink: false,
+            convertEol: true,
+        });
+        const fitAddon = new FitAddon();
+        term.loadAddon(fitAddon);
+        term.open(paneRef.current);
+        fitAddon.fit();
+        termRef.current = term;
+        return () => {
+            sourceRef.current?.close();
+            sourceRef.current = null;
+            term.dispose();
+            termRef.current = null;
+        };
+    }, [demo, theme]);
+
+    const stop = useCallback(() => {
+        sourceRef.current?.close();
+        sourceRef.current = null;
+        setPlaying(false);
+    }, []);
+
+    // Streams demo_frame events; step is omitted to play the whole demo.
+    const play = useCallback((step) => {
+        if (!demo) return;
+        stop();
+        if (step === undefined || step === 0) {
+            termRef.current?.reset();
+        }
+        const params = new URLSearchParams({ speed: String(speed) });
+        if (step !== undefined) params.set('step', String(step));
+        const source = new EventSource(
+            `/api/demos/${encodeURIComponent(demo.name)}/play?${params}`,
+            { withCredentials: true },
+        );
+        sourceRef.current = source;
+        setPlaying(true);
+        source.addEventListener('demo_frame', (event) => {
+            const frame = JSON.parse(event.data);
+            if (frame.data) termRef.current?.write(frame.data);
+            if (frame.done) {
+                stop();
+                setNextStep(step === undefined ? demo.steps.length : frame.step + 1);
+            }
+        });
+        // The stream ends after the done event; anything else is a lost connection.
+        source.onerror = () => stop();
+    }, [demo, speed, stop]);
+
+    const open = (name) => {
+        fetch(`/api/demos/${encodeURIComponent(name)}`, { credentials: 'include' })
+            .then(res => (res.ok ? res.json() : Promise.reject(res.status)))
+            .then(data => {
+                setDemo(data);
+                setNextStep(0);
+            })
+            .catch(() => setError('Could not load this demo.'));
+    };
+
+    const finished = demo && nextStep >= demo.steps.length;
+
+    return (
+        <div className="absolute inset-0 bg-bg/95 z-40 flex items-center justify-center p-4">
+            <div className="w-full max-w-4xl h-full max-h-[36rem] border border-border bg-panel rounded-sm flex flex-col">
+                <div className="flex items-center px-4 py-2 tui-border-b text-xs">
+                    <span className="text-muted uppercase tracking-wider">Demos</span>
+                    {demo && <span className="text-fg ml-3 truncate">{demo.title || demo.name}</span>}
+                    <button onClick={onClose} className="ml-auto text-muted hover:text-fg transition-colors">
+                        Close
+                    </button>
+                </div>
+
+                {error && <p className="px-4 py-2 text-xs text-term-red">{error}</p>}
+
+                {!demo ? (
+                    <ul className="flex-1 overflow-y-auto p-2 text-xs">
+                        {demos.length === 0 && !error && (
+                            <li className="px-2 py-1 text-muted">No demos have been recorded yet.</li>
+                        )}
+                        {demos.map(d => (
+                            <li key={d.name}>
+                                <button
+                                    onClick={() => open(d.name)}
+                                    className="w-full text-left px-2 py-1.5 hover:bg-border/50 transition-colors flex gap-3"
+                                >
+                                    <span className="text-fg">{d.title || d.name}</span>
+                                    <span className="text-muted ml-auto">
+                                        {d.step_count} steps · {Math.round(d.duration_ms / 1000)}s
+                                    </span>
+                                </button>
+                            </li>
+                        ))}
+                    </ul>
+                ) : (
+                    <>
+                        <div className="flex-1 relative p-2">
+                            <div ref={paneRef} className="absolute inset-2" />
+                        </div>
+                        <div className="flex items-center gap-4 px-4 py-2 border-t border-border text-xs text-muted">
+                            <button
+                                onClick={() => (playing ? stop() : play())}
+                                className="hover:text-fg transition-colors"
+                            >
+                                {playing ? 'Stop' : 'Play all'}
+                            </button>
+                            <button
+                                onClick={() => play(nextStep)}
+                                disabled={playing || finished}
+                                className="hover:text-fg transition-colors disabled:opacity-40"
+                            >
+                                Next step
+                            </button>
+                            <span className="truncate">
+                                {finished
+                                    ? 'End of demo'
+                                    : `Step ${nextStep + 1}/${demo.steps.length}${demo.steps[nextStep]?.command ? `: ${demo.steps[nextStep].command}` : ''}`}
+                            </span>
+                            <select
+                                value={speed}
+                                onChange={e => setSpeed(Number(e.target.value))}
+                                className="ml-auto bg-bg border border-border text-fg px-1"
+                                aria-label="Playback speed"
+                            >
+                                {SPEEDS.map(s => <option key={s} value={s}>{s}x</option>)}
+                            </select>
+                            <button
+                                onClick={() => { stop(); setDemo(null); }}
+                                className="hover:text-fg transition-colors"
+                            >
+                                Back
+                            </button>
+                        </div>
+                    </>
+                )}
+            </div>
+        </div>
+    );
+};
@@ -15,6 +15,55 @@ const ProvisioningHeaderLogs = () => (
 // Global tracker to deduplicate requests across React StrictMode re-mounts in dev
 let activeProvisionPromise = null;
 
+const newIdempotencyKey = () =>
+    (globalThis.crypto?.randomUUID?.() || `${Date.now()}-${Math.random().toString(36).slice(2)}`);
+
+// Log line and progress shown for each stage streamed by /api/provision/events.
+const PROVISION_STAGES = {
+    pulling_image: { message: "Pulling sandbox image...", progress: 30 },
+    creating: { message: "Creating sandbox container...", progress: 55 },
+    starting: { message: "Starting sandbox container...", progress: 80 },
+};
+
+// Follows an accepted provision operation over SSE until it finishes.
+// Resolves with the final operation; onStage is called with each new stage
+// and the event that reported it.
+const followProvision = (operationId, onStage, signal) => new Promise((resolve, reject) => {
+    const source = new EventSource(
+        `/api/provision/events?operation_id=${encodeURIComponent(operationId)}`,
+        { withCredentials: true },
+    );
+    const close = () => source.close();
+    signal.addEventListener('abort', () => {
+        close();
+        reject(new DOMException('Aborted', 'AbortError'));
+    });
+
+    let lastStage = null;
+    source.addEventListener('progress', (event) => {
+        const data = JSON.parse(event.data);
+        // A queued operation re-reports its stage whenever its position moves.
+        const stageKey = `${data.stage}:${data.queue_position || 0}`;
+        if (data.stage && stageKey !== lastStage) {
+            lastStage = stageKey;
+            onStage(data.stage, data);
+        }
+        if (data.status === 'ready') {
+            close();
+            resolve(data);
+        } else if (data.status === 'failed') {
+            close();
+            reject({ status: 500, data });
+        }
+    });
+    source.onerror = () => {
+        // The stream ends after the final event; anything else is a lost connection.
+        if (source.readyState === EventSource.CLOSED) {
+            reject({ status: 0, data: { error: "Lost connection to provisioning stream" } });
+        }
+    };
+});
+
 export const ProvisioningState = ({ onComplete }) => {
     const { authFetch } = useAuth();
     const [logs, setLogs] = useState([]);
@@ -40,7 +89,10 @@ export const ProvisioningState = ({ onComplete }) => {
                 if (!activeProvisionPromise) {
                     activeProvisionPromise = authFetch('/api/provision', {
                         method: 'POST',
-                        headers: { 'Content-Type': 'application/json' },
+                        headers: {
+                            'Content-Type': 'application/json',
+                            'Idempotency-Key': newIdempotencyKey(),
+                        },
                         // No signal here, so this survives the StrictMode re-mount
                     }).then(async res => {
                         const data = await res.json().catch(() => ({}));
@@ -54,15 +106,29 @@ export const ProvisioningState = ({ onComplete }) => {
                     addLog("Syncing with active compute lock...", "info");
                 }
 
-                const data = await activeProvisionPromise;
-
+                let data = await activeProvisionPromise;
                 if (!isMounted) return;
 
-                addLog("Locking compute resources...", "info");
-                setProgress(40);
+                if (data.status === 'provisioning') {
+                    addLog("Locking compute resources...", "info");
+                    setProgress(20);
 
-                addLog("Attaching sandbox container...", "load");
-                setProgress(70);
+                    data = await followProvision(data.operation_id, (stage, event) => {
+                        if (!isMounted) return;
+                        if (stage === 'queued') {
+                            addLog(`All sandboxes are busy. Waiting in queue (position ${event.queue_position})...`, "wait");
+                            return;
+                        }
+                        const step = PROVISION_STAGES[stage];
+                        if (!step) return;
+                        addLog(step.message, "load");
+                        setProgress(step.progress);
+                    }, controller.signal);
+                } else if (data.status === 'failed') {
+                    throw { status: 500, data };
+                }
+
+                if (!isMounted) return;
 
                 addLog(`Instance ${data.container_id.substring(0, 8)} operational.`, "success");
                 setProgress(100);
@@ -7,10 +7,14 @@ import { WebglAddon } from '@xterm/addon-webgl';
 import { Unicode11Addon } from '@xterm/addon-unicode11';
 import '@xterm/xterm/css/xterm.css';
 import { AIChatSidebar } from './AIChatSidebar';
+import { DemoPlayer } from './DemoPlayer';
 import { ToastContainer, useToast } from './ToastSystem';
 import { useChatStore } from '../store/chatStore';
 import { useChatUIStore } from '../store/chatUIStore';
+import { usePreferencesStore } from '../store/preferencesStore';
 import { useAuth } from '../context/AuthContext';
+import { reportClientError } from '../errorReporting';
+import { E2EChannel, terminalE2ERequired } from '../terminalE2E';
 
 // Tokyo Night Terminal Theme
 const TERMINAL_THEME = {
@@ -92,7 +96,7 @@ const LeaveTerminalModal = memo(({ onStay, onKeep, onConfirm }) => {
 });
 
 // Header Component - Tokyo Night TUI Style
-const Header = memo(({ status, onDestroy, onToggleChat, isChatOpen, sessionInfo, aiEnabled, onHomeClick }) => {
+const Header = memo(({ status, onDestroy, onToggleChat, isChatOpen, onToggleNotify, isNotifyOn, sessionInfo, aiEnabled, onHomeClick }) => {
 
     const getStatusDot = () => {
         switch (status) {
@@ -139,6 +143,12 @@ const Header = memo(({ status, onDestroy, onToggleChat, isChatOpen, sessionInfo,
                             <span className="text-[10px] font-bold text-muted uppercase tracking-wider">Agent</span>
                             <ToggleSwitch checked={isChatOpen} onChange={onToggleChat} />
                         </div>
+
+                        {/* Desktop notifications while the tab is hidden */}
+                        <div className="flex items-center gap-2" title="Notify me about bells and finished commands while this tab is hidden">
+                            <span className="text-[10px] font-bold text-muted uppercase tracking-wider">Notify</span>
+                            <ToggleSwitch checked={isNotifyOn} onChange={onToggleNotify} />
+                        </div>
                     </>
                 )}
 
@@ -200,7 +210,7 @@ const ConnectionOverlay = memo(({ onRetry, status }) => {
 });
 
 // Terminal Toolbar
-const TerminalToolbar = memo(({ onClear, terminalRef }) => {
+const TerminalToolbar = memo(({ onClear, onDemos, terminalRef }) => {
     const handleCopy = () => {
         const content = terminalRef.current?.getSelection();
         if (content) navigator.clipboard.writeText(content);
@@ -212,6 +222,12 @@ const TerminalToolbar = memo(({ onClear, terminalRef }) => {
                 <span className="text-xs text-muted uppercase tracking-wider">Terminal</span>
             </div>
             <div className="flex items-center gap-4 ml-auto">
+                <button
+                    onClick={onDemos}
+                    className="text-xs text-muted hover:text-fg transition-colors"
+                >
+                    Demos
+                </button>
                 <button
                     onClick={onClear}
                     className="text-xs text-muted hover:text-fg transition-colors"
@@ -237,10 +253,13 @@ export const TerminalSession = ({ onDestroy }) => {
     const isSidebarOpen = useChatUIStore((state) => state.isSidebarOpen);
     const toggleSidebar = useChatUIStore((state) => state.toggleSidebar);
     const resetChatUI = useChatUIStore((state) => state.resetChatUI);
+    const desktopNotifications = usePreferencesStore((state) => state.desktopNotifications);
+    const setDesktopNotifications = usePreferencesStore((state) => state.setDesktopNotifications);
     const terminalRef = useRef(null);
     const xtermRef = useRef(null);
     const fitAddonRef = useRef(null);
     const socketRef = useRef(null);
+    const e2eRef = useRef(null);
     const initializedRef = useRef(false);
     const reconnectAttemptsRef = useRef(0);
     const resizeTimeoutRef = useRef(null);
@@ -252,6 +271,8 @@ export const TerminalSession = ({ onDestroy }) => {
     const [connectionStatus, setConnectionStatus] = useState('connecting');
     const [aiEnabled, setAiEnabled] = useState(false);
     const [isLeaveModalOpen, setIsLeaveModalOpen] = useState(false);
+    const [isDemoPlayerOpen, setIsDemoPlayerOpen] = useState(false);
+    const [activityAnnouncement, setActivityAnnouncement] = useState('');
     const [sessionInfo] = useState({
         name: 'shsh-session',
         node: 'node-01',
@@ -273,17 +294,32 @@ export const TerminalSession = ({ onDestroy }) => {
             });
     }, []);
 
+    // Sends a control or input message. Keystrokes of an encrypted terminal
+    // are sealed; control messages always travel plain. The returned promise
+    // settles once the message was written.
+    const sendMessage = useCallback((msg) => {
+        const socket = socketRef.current;
+        if (socket?.readyState !== WebSocket.OPEN) return Promise.resolve();
+        const channel = e2eRef.current;
+        if (channel && msg.type === 'data') {
+            return channel.sendInput(msg.content).catch((err) => {
+                reportClientError('terminal_e2e', err, { component: 'TerminalSession' });
+                socket.close();
+            });
+        }
+        socket.send(JSON.stringify(msg));
+        return Promise.resolve();
+    }, []);
+
     const sendResize = useCallback((cols, rows) => {
         if (!mountedRef.current) return;
         if (socketRef.current?.readyState === WebSocket.OPEN) {
             if (resizeTimeoutRef.current) clearTimeout(resizeTimeoutRef.current);
             resizeTimeoutRef.current = setTimeout(() => {
-                if (socketRef.current?.readyState === WebSocket.OPEN) {
-                    socketRef.current.send(JSON.stringify({ type: 'resize', cols, rows }));
-                }
+                sendMessage({ type: 'resize', cols, rows });
             }, 60);
         }
-    }, []);
+    }, [sendMessage]);
 
     const initTerminalSession = useCallback(() => {
         if (!mountedRef.current || initializedRef.current || !xtermRef.current) return;
@@ -295,18 +331,40 @@ export const TerminalSession = ({ onDestroy }) => {
         sendResize(term.cols, term.rows);
     }, [sendResize]);
 
-    const connect = useCallback(() => {
+    const connect = useCallback(async () => {
         if (!mountedRef.current || !sessionReady || !sessionId) return;
         if (socketRef.current) {
             socketRef.current.onclose = null;
             socketRef.current.close();
+            socketRef.current = null;
         }
+        // Encrypted terminals offer a fresh key on every connection.
+        let channel = null;
+        if (await terminalE2ERequired()) {
+            try {
+                channel = await E2EChannel.offer();
+            } catch (err) {
+                reportClientError('terminal_e2e', err, { component: 'TerminalSession' });
+            }
+        }
+        if (!mountedRef.current || socketRef.current) return;
 
         const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-        const wsURL = `${protocol}//${window.location.host}/ws/terminal?session_id=${encodeURIComponent(sessionId)}`;
+        // Report xterm.js capabilities so the shell starts with the right TERM
+        // and size instead of 80x24 until the first resize.
+        const params = new URLSearchParams({ session_id: sessionId, colors: 'truecolor' });
+        const dims = fitAddonRef.current?.proposeDimensions();
+        if (dims?.cols && dims?.rows) {
+            params.set('cols', String(dims.cols));
+            params.set('rows', String(dims.rows));
+        }
+        if (channel) params.set('e2e', channel.param);
+        const wsURL = `${protocol}//${window.location.host}/ws/terminal?${params}`;
         const socket = new WebSocket(wsURL);
         socket.binaryType = 'arraybuffer';
         socketRef.current = socket;
+        e2eRef.current = channel;
+        channel?.attach(socket);
 
         socket.onopen = () => {
             if (!mountedRef.current) {
@@ -315,9 +373,12 @@ export const TerminalSession = ({ onDestroy }) => {
             }
             setConnectionStatus('connected');
             reconnectAttemptsRef.current = 0;
+            if (document.hidden) {
+                sendMessage({ type: 'visibility', content: 'hidden' });
+            }
             heartbeatIntervalRef.current = setInterval(() => {
                 if (socket.readyState === WebSocket.OPEN && mountedRef.current) {
-                    socket.send(JSON.stringify({ type: 'ping' }));
+                    sendMessage({ type: 'ping' });
                 }
             }, 20000);
         };
@@ -339,10 +400,10 @@ export const TerminalSession = ({ onDestroy }) => {
 
         socket.onerror = () => setConnectionStatus('disconnected');
 
-        socket.onmessage = (event) => {
-            if (typeof event.data === 'string') {
+        const handleMessage = ({ text, bytes }) => {
+            if (text !== undefined) {
                 try {
-                    const msg = JSON.parse(event.data);
+                    const msg = JSON.parse(text);
                     if (msg.type === 'pong') return;
                 } catch { /* ignored */ }
                 return;
@@ -351,18 +412,59 @@ export const TerminalSession = ({ onDestroy }) => {
             if (!initializedRef.current) {
                 initTerminalSession();
             }
-            xtermRef.current?.write(new Uint8Array(event.data));
+            xtermRef.current?.write(bytes);
+        };
+
+        const failE2E = (err) => {
+            reportClientError('terminal_e2e', err, { component: 'TerminalSession' });
+            socket.close();
         };
-    }, [initTerminalSession, sessionId, sessionReady]);
+
+        socket.onmessage = (event) => {
+            if (typeof event.data === 'string') {
+                // The server's signed key arrives first; other text messages
+                // are plain control messages.
+                if (channel && !channel.accepted) {
+                    try {
+                        const msg = JSON.parse(event.data);
+                        if (msg.type === 'e2e') {
+                            channel.accept(msg.key, msg.sig).catch(failE2E);
+                            return;
+                        }
+                    } catch { /* ignored */ }
+                }
+                handleMessage({ text: event.data });
+                return;
+            }
+            // Output of an encrypted terminal is sealed.
+            if (channel) {
+                channel.receive(event.data).then((bytes) => handleMessage({ bytes }), failE2E);
+                return;
+            }
+            handleMessage({ bytes: new Uint8Array(event.data) });
+        };
+    }, [initTerminalSession, sendMessage, sessionId, sessionReady]);
+
+    useEffect(() => {
+        const handleVisibilityChange = () => {
+            sendMessage({
+                type: 'visibility',
+                content: document.hidden ? 'hidden' : 'visible',
+            });
+        };
+        document.addEventListener('visibilitychange', handleVisibilityChange);
+        return () => document.removeEventListener('visibilitychange', handleVisibilityChange);
+    }, [sendMessage]);
 
     const handleTerminate = useCallback(async () => {
         if (terminatingRef.current) return;
         terminatingRef.current = true;
 
         if (socketRef.current?.readyState === WebSocket.OPEN) {
-            socketRef.current.send(JSON.stringify({ type: 'terminate' }));
-            socketRef.current.onclose = null;
-            socketRef.current.close();
+            const socket = socketRef.current;
+            await sendMessage({ type: 'terminate' });
+            socket.onclose = null;
+            socket.close();
         }
 
         resetChat();
@@ -374,7 +476,7 @@ export const TerminalSession = ({ onDestroy }) => {
         }
         rotateSessionId();
         onDestroy();
-    }, [authFetch, onDestroy, resetChat, resetChatUI, rotateSessionId]);
+    }, [authFetch, onDestroy, resetChat, resetChatUI, rotateSessionId, sendMessage]);
 
     useEffect(() => {
         if (!isLeaveModalOpen) return;
@@ -413,10 +515,14 @@ export const TerminalSession = ({ onDestroy }) => {
 
         connect();
 
-        const onDataDisposable = term.onData(data => {
-            if (socketRef.current?.readyState === WebSocket.OPEN) {
-                socketRef.current.send(JSON.stringify({ type: 'data', content: data }));
-            }
+        const sendInput = (data) => {
+            sendMessage({ type: 'data', content: data });
+        };
+        const onDataDisposable = term.onData(sendInput);
+        // Runnable code blocks in the sidebar type their command and press Enter.
+        useChatUIStore.getState().setRunInTerminal((command) => {
+            sendInput(command.replace(/\n/g, '\r') + '\r');
+            term.focus();
         });
 
         const resizeObserver = new ResizeObserver(() => {
@@ -439,7 +545,26 @@ export const TerminalSession = ({ onDestroy }) => {
             resetChat();
             resetChatUI();
         };
-    }, [connect, resetChat, resetChatUI, sendResize]);
+    }, [connect, resetChat, resetChatUI, sendMessage, sendResize]);
+
+    const toggleDesktopNotifications = useCallback(async () => {
+        if (desktopNotifications) {
+            setDesktopNotifications(false);
+            return;
+        }
+        if (typeof Notification === 'undefined') {
+            addToast({ type: 'error', title: 'Notifications', message: 'This browser does not support desktop notifications.' });
+            return;
+        }
+        const permission = Notification.permission === 'default'
+            ? await Notification.requestPermission()
+            : Notification.permission;
+        if (permission !== 'granted') {
+            addToast({ type: 'error', title: 'Notifications', message: 'Allow notifications for this site to enable them.' });
+            return;
+        }
+        setDesktopNotifications(true);
+    }, [addToast, desktopNotifications, setDesktopNotifications]);
 
     // SSE connection for safety warnings and proactive tips (only if AI enabled)
     useEffect(() => {
@@ -447,6 +572,7 @@ export const TerminalSession = ({ onDestroy }) => {
 
         let reconnectTimeout = null;
         let lastEventId = null;
+        let streamEpoch = null;
         let reconnectAttempts = 0;
         const maxReconnectAttempts = 10;
         const baseReconnectDelay = 1000;
@@ -455,28 +581,58 @@ export const TerminalSession = ({ onDestroy }) => {
             let url = `/api/agent/stream?session_id=${encodeURIComponent(sessionId)}`;
             if (lastEventId) {
                 url += `&lastEventId=${lastEventId}`;
+                // Lets the server ignore an ID from a sequence that restarted.
+                if (streamEpoch) url += `&epoch=${encodeURIComponent(streamEpoch)}`;
             }
 
             const eventSource = new EventSource(url, { withCredentials: true });
             eventSourceRef.current = eventSource;
 
-            eventSource.addEventListener('connected', (e) => {
-                reconnectAttempts = 0;
+            // Payload contracts: docs/asyncapi.json (generated from internal/events).
+            eventSource.addEventListener('system', (e) => {
                 try {
                     const data = JSON.parse(e.data);
+                    if (data.status !== 'connected') return;
+                    reconnectAttempts = 0;
+                    if (data.epoch) streamEpoch = data.epoch;
                     if (data.event_id) lastEventId = data.event_id;
-                } catch { /* ignore */ }
+                } catch (err) {
+                    reportClientError('sse_parse', err, { component: 'TerminalSession', event: 'system' });
+                }
             });
 
-            eventSource.addEventListener('message', (e) => {
+            // Long messages arrive as ordered parts sharing chunk.id; only the
+            // last part carries the event ID.
+            const pendingChunks = new Map();
+            const reassemble = (data) => {
+                if (!data.chunk) return data;
+                const { id, index, count } = data.chunk;
+                const parts = pendingChunks.get(id) || [];
+                parts[index] = data;
+                if (index < count - 1) {
+                    pendingChunks.set(id, parts);
+                    return null;
+                }
+                pendingChunks.delete(id);
+                return {
+                    ...data,
+                    content: parts.map((p) => p?.content || '').join(''),
+                    sidebar: parts.map((p) => p?.sidebar || '').join(''),
+                    chunk: undefined
+                };
+            };
+
+            const handleAgentEvent = (e) => {
                 if (e.lastEventId) lastEventId = e.lastEventId;
 
                 try {
-                    const data = JSON.parse(e.data);
+                    const data = reassemble(JSON.parse(e.data));
+                    if (!data) return;
                     if (useChatUIStore.getState().isSidebarOpen && (data.content || data.sidebar)) {
                         addMessage({
                             role: 'assistant',
                             content: data.sidebar || data.content,
+                            codeBlocks: data.code_blocks,
                             type: data.type,
                             proactive: true
                         });
@@ -488,7 +644,40 @@ export const TerminalSession = ({ onDestroy }) => {
                             message: data.sidebar || data.content || 'Command detected'
                         });
                     }
-                } catch { /* ignore */ }
+                } catch (err) {
+                    reportClientError('sse_parse', err, { component: 'TerminalSession', event: e.type });
+                }
+            };
+            eventSource.addEventListener('desktop_notification', (e) => {
+                if (e.lastEventId) lastEventId = e.lastEventId;
+                if (!usePreferencesStore.getState().desktopNotifications || !document.hidden) return;
+                if (typeof Notification === 'undefined' || Notification.permission !== 'granted') return;
+                try {
+                    const data = JSON.parse(e.data);
+                    const notification = new Notification(data.title, { body: data.body, tag: `shsh-${data.reason}` });
+                    notification.onclick = () => {
+                        window.focus();
+                        notification.close();
+                    };
+                } catch (err) {
+                    reportClientError('sse_parse', err, { component: 'TerminalSession', event: e.type });
+                }
+            });
+            eventSource.addEventListener('proactive_hint', handleAgentEvent);
+            eventSource.addEventListener('alert', handleAgentEvent);
+            // A gap marker: the server dropped messages because a queue was full.
+            eventSource.addEventListener('messages_dropped', (e) => {
+                if (e.lastEventId) lastEventId = e.lastEventId;
+                try {
+                    const data = JSON.parse(e.data);
+                    if (!useChatUIStore.getState().isSidebarOpen || !data.count) return;
+                    addMessage({
+                        role: 'system',
+                        content: `${data.count} ${data.count === 1 ? 'message was' : 'messages were'} skipped because the tutor fell behind.`
+                    });
+                } catch (err) {
+                    reportClientError('sse_parse', err, { component: 'TerminalSession', event: e.type });
+                }
             });
 
             eventSource.addEventListener('error', () => {
@@ -511,6 +700,26 @@ export const TerminalSession = ({ onDestroy }) => {
         };
     }, [addMessage, addToast, aiEnabled, sessionId, sessionReady]);
 
+    // Screen readers announce command results and new prompts from the
+    // terminal_activity stream rather than reading raw terminal output. The
+    // stream is produced by the same monitor as the agent stream.
+    useEffect(() => {
+        if (!aiEnabled || !sessionReady || !sessionId) return;
+
+        const source = new EventSource(`/api/terminal/activity?session_id=${encodeURIComponent(sessionId)}`, { withCredentials: true });
+        source.addEventListener('terminal_activity', (e) => {
+            try {
+                const data = JSON.parse(e.data);
+                // Announcing the prompt as well would cut off the result it
+                // immediately follows.
+                if (data.kind === 'command') setActivityAnnouncement(data.summary);
+            } catch (err) {
+                reportClientError('sse_parse', err, { component: 'TerminalSession', event: e.type });
+            }
+        });
+        return () => source.close();
+    }, [aiEnabled, sessionId, sessionReady]);
+
     return (
         <div className="h-screen bg-bg flex flex-col overflow-hidden selection:bg-selection selection:text-white">
             <ToastContainer toasts={toasts} onDismiss={dismissToast} />
@@ -519,6 +728,8 @@ export const TerminalSession = ({ onDestroy }) => {
                 onDestroy={handleTerminate}
                 onToggleChat={toggleSidebar}
                 isChatOpen={isSidebarOpen}
+                onToggleNotify={toggleDesktopNotifications}
+                isNotifyOn={desktopNotifications}
                 sessionInfo={sessionInfo}
                 aiEnabled={aiEnabled}
                 onHomeClick={() => setIsLeaveModalOpen(true)}
@@ -527,13 +738,18 @@ export const TerminalSession = ({ onDestroy }) => {
                 <section className="flex-1 flex flex-col bg-bg relative min-w-0">
                     <TerminalToolbar
                         onClear={() => xtermRef.current?.clear()}
+                        onDemos={() => setIsDemoPlayerOpen(true)}
                         terminalRef={xtermRef}
                     />
                     <div className="flex-1 relative p-2">
                         <div ref={terminalRef} className="absolute inset-2" />
+                        <div className="sr-only" role="status" aria-live="polite">{activityAnnouncement}</div>
                         {(connectionStatus === 'disconnected' || connectionStatus === 'reconnecting') && (
                             <ConnectionOverlay status={connectionStatus} onRetry={connect} />
                         )}
+                        {isDemoPlayerOpen && (
+                            <DemoPlayer theme={TERMINAL_THEME} onClose={() => setIsDemoPlayerOpen(false)} />
+                        )}
                         {isLeaveModalOpen && (
                             <LeaveTerminalModal
                                 onStay={() => setIsLeaveModalOpen(false)}
@@ -0,0 +1,46 @@
+// Sends frontend failures to POST /api/client-errors so they show up in the
+// server log next to the user's session. Reporting never throws.
+
+const ENDPOINT = '/api/client-errors';
+const TAB_SESSION_KEY = 'shsh_session_id';
+// Per page load; a render loop must not flood the server.
+const MAX_REPORTS = 20;
+const MAX_STACK = 4000;
+
+let sent = 0;
+const seen = new Set();
+
+export function reportClientError(kind, error, extra = {}) {
+    try {
+        const message = String(error?.message || error || 'unknown error');
+        const fingerprint = `${kind}:${message}`;
+        if (sent >= MAX_REPORTS || seen.has(fingerprint)) return;
+        seen.add(fingerprint);
+        sent++;
+
+        const { component, requestId, ...context } = extra;
+        const headers = { 'Content-Type': 'application/json' };
+        const sessionId = sessionStorage.getItem(TAB_SESSION_KEY);
+        if (sessionId) headers['X-SHSH-Session-ID'] = sessionId;
+
+        fetch(ENDPOINT, {
+            method: 'POST',
+            headers,
+            keepalive: true,
+            body: JSON.stringify({
+                kind,
+                message,
+                stack: typeof error?.stack === 'string' ? error.stack.slice(0, MAX_STACK) : undefined,
+                url: window.location.pathname,
+                component,
+                request_id: requestId,
+                context: Object.fromEntries(Object.entries(context).map(([k, v]) => [k, String(v)])),
+            }),
+        }).catch(() => { /* best effort */ });
+    } catch { /* best effort */ }
+}
+
+export function installGlobalErrorReporting() {
+    window.addEventListener('error', (e) => reportClientError('uncaught', e.error || e.message));
+    window.addEventListener('unhandledrejection', (e) => reportClientError('unhandled_rejection', e.reason));
+}
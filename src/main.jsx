@@ -4,6 +4,9 @@ import { BrowserRouter } from 'react-router-dom'
 import { AuthProvider } from './context/AuthContext'
 import './index.css'
 import App from './App.jsx'
+import { installGlobalErrorReporting } from './errorReporting'
+
+installGlobalErrorReporting()
 
 createRoot(document.getElementById('root')).render(
   <StrictMode>
@@ -9,5 +9,10 @@ export const useChatUIStore = create((set) => ({
 
   setSidebarOpen: (isSidebarOpen) => set({ isSidebarOpen }),
 
-  resetChatUI: () => set({ isSidebarOpen: true })
+  // Types a command into the terminal; set by TerminalSession while connected.
+  runInTerminal: null,
+
+  setRunInTerminal: (runInTerminal) => set({ runInTerminal }),
+
+  resetChatUI: () => set({ isSidebarOpen: true, runInTerminal: null })
 }));
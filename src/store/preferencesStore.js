@@ -0,0 +1,31 @@
+import { create } from 'zustand';
+
+const DESKTOP_NOTIFICATIONS_KEY = 'shsh.desktopNotifications';
+
+const readFlag = (key) => {
+  try {
+    return localStorage.getItem(key) === 'true';
+  } catch {
+    return false;
+  }
+};
+
+const writeFlag = (key, value) => {
+  try {
+    localStorage.setItem(key, String(value));
+  } catch {
+    /* storage unavailable; keep the in-memory value */
+  }
+};
+
+// Learner preferences kept in this browser.
+export const usePreferencesStore = create((set) => ({
+  // Show desktop notifications for terminal bells and finished commands
+  // while the tab is hidden.
+  desktopNotifications: readFlag(DESKTOP_NOTIFICATIONS_KEY),
+
+  setDesktopNotifications: (desktopNotifications) => {
+    writeFlag(DESKTOP_NOTIFICATIONS_KEY, desktopNotifications);
+    set({ desktopNotifications });
+  }
+}));
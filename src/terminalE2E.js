@@ -0,0 +1,143 @@
+// End-to-end encryption of the terminal WebSocket (SHSH_TERMINAL_E2E). The
+// browser offers an ephemeral P-256 key in the e2e query parameter and the
+// server answers with {"type":"e2e","key":...,"sig":...}, its own key signed
+// by the deployment's signing key. The signature is checked against the
+// public key pinned at build time in VITE_TERMINAL_E2E_PUBLIC_KEY, so a proxy
+// cannot answer with a key of its own. Keystrokes and output then travel in
+// binary frames: AES-GCM with a key per direction derived by HKDF-SHA256 and
+// the frame's sequence number as nonce. Control messages stay plain JSON.
+// Must match internal/terminal/e2e.go.
+
+const INFO = new TextEncoder().encode('shsh-labs terminal e2e v2');
+const PINNED_KEY = import.meta.env.VITE_TERMINAL_E2E_PUBLIC_KEY || '';
+
+let configPromise = null;
+
+// Reports whether the server requires encrypted terminals, asking once per
+// page load.
+export function terminalE2ERequired() {
+    if (!configPromise) {
+        configPromise = fetch('/api/config')
+            .then(res => res.json())
+            .then(data => Boolean(data.terminal_e2e))
+            .catch(() => {
+                configPromise = null;
+                return false;
+            });
+    }
+    return configPromise;
+}
+
+function toBase64URL(bytes) {
+    let binary = '';
+    for (const b of bytes) binary += String.fromCharCode(b);
+    return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+}
+
+function fromBase64(text) {
+    return Uint8Array.from(atob(text), (c) => c.charCodeAt(0));
+}
+
+function fromBase64URL(text) {
+    return fromBase64(text.replace(/-/g, '+').replace(/_/g, '/'));
+}
+
+function concat(...parts) {
+    const out = new Uint8Array(parts.reduce((n, part) => n + part.length, 0));
+    let offset = 0;
+    for (const part of parts) {
+        out.set(part, offset);
+        offset += part.length;
+    }
+    return out;
+}
+
+function nonce(seq) {
+    const iv = new Uint8Array(12);
+    new DataView(iv.buffer).setBigUint64(4, seq);
+    return iv;
+}
+
+// E2EChannel encrypts one terminal socket. Keystrokes sent or frames
+// received before the server's key is accepted wait for the keys.
+export class E2EChannel {
+    static async offer() {
+        if (!PINNED_KEY) throw new Error('VITE_TERMINAL_E2E_PUBLIC_KEY is not set');
+        const keyPair = await crypto.subtle.generateKey({ name: 'ECDH', namedCurve: 'P-256' }, false, ['deriveBits']);
+        const publicKey = new Uint8Array(await crypto.subtle.exportKey('raw', keyPair.publicKey));
+        return new E2EChannel(keyPair, publicKey);
+    }
+
+    constructor(keyPair, publicKey) {
+        this.keyPair = keyPair;
+        this.publicKey = publicKey;
+        this.param = toBase64URL(publicKey);
+        this.socket = null;
+        this.accepted = false;
+        this.keys = new Promise((resolve, reject) => {
+            this.resolveKeys = resolve;
+            this.rejectKeys = reject;
+        });
+        this.keys.catch(() => {});
+        this.sendSeq = 0n;
+        this.recvSeq = 0n;
+        this.sendChain = Promise.resolve();
+        this.recvChain = Promise.resolve();
+    }
+
+    attach(socket) {
+        this.socket = socket;
+    }
+
+    // Checks the server's key is signed by the pinned key, then derives the
+    // frame keys from it.
+    async accept(serverKey, signature) {
+        this.accepted = true;
+        try {
+            const serverRaw = fromBase64URL(serverKey);
+            const pinned = await crypto.subtle.importKey('spki', fromBase64(PINNED_KEY), { name: 'ECDSA', namedCurve: 'P-256' }, false, ['verify']);
+            const signed = await crypto.subtle.verify(
+                { name: 'ECDSA', hash: 'SHA-256' }, pinned, fromBase64URL(signature), concat(INFO, this.publicKey, serverRaw),
+            );
+            if (!signed) throw new Error('terminal e2e key is not signed by the pinned key');
+
+            const peer = await crypto.subtle.importKey('raw', serverRaw, { name: 'ECDH', namedCurve: 'P-256' }, false, []);
+            const shared = await crypto.subtle.deriveBits({ name: 'ECDH', public: peer }, this.keyPair.privateKey, 256);
+            const hkdfKey = await crypto.subtle.importKey('raw', shared, 'HKDF', false, ['deriveBits']);
+            const salt = concat(this.publicKey, serverRaw);
+            const bits = new Uint8Array(await crypto.subtle.deriveBits({ name: 'HKDF', hash: 'SHA-256', salt, info: INFO }, hkdfKey, 512));
+            const [toServer, toClient] = await Promise.all([
+                crypto.subtle.importKey('raw', bits.slice(0, 32), 'AES-GCM', false, ['encrypt']),
+                crypto.subtle.importKey('raw', bits.slice(32), 'AES-GCM', false, ['decrypt']),
+            ]);
+            this.resolveKeys({ toServer, toClient });
+        } catch (err) {
+            this.rejectKeys(err);
+            throw err;
+        }
+    }
+
+    // Seals keystrokes; the returned promise settles once they were written.
+    sendInput(text) {
+        const payload = new TextEncoder().encode(text);
+        const iv = nonce(this.sendSeq++);
+        this.sendChain = this.sendChain
+            .then(() => this.keys)
+            .then((keys) => crypto.subtle.encrypt({ name: 'AES-GCM', iv }, keys.toServer, payload))
+            .then((frame) => {
+                if (this.socket?.readyState === WebSocket.OPEN) this.socket.send(frame);
+            });
+        return this.sendChain;
+    }
+
+    // Opens a binary frame of output. Results resolve in the order frames
+    // arrived; a frame that fails to open rejects.
+    receive(data) {
+        const iv = nonce(this.recvSeq++);
+        const opened = this.recvChain
+            .then(() => this.keys)
+            .then(async (keys) => new Uint8Array(await crypto.subtle.decrypt({ name: 'AES-GCM', iv }, keys.toClient, data)));
+        this.recvChain = opened.catch(() => {});
+        return opened;
+    }
+}